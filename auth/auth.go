@@ -13,7 +13,7 @@ import (
 
 	"github.com/gorilla/feeds"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/shared"
 )
 
@@ -445,8 +445,8 @@ func StartApiServer() {
 		Port:   shared.GetEnv("AUTH_WEB_PORT", "3000"),
 	}
 
-	logger := shared.CreateLogger(true)
-	db := postgres.NewDB(cfg.DbURL, logger)
+	logger := shared.CreateLogger("auth", true)
+	db := backend.NewDB(cfg.DbURL, logger)
 	defer db.Close()
 
 	client := &Client{
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/picosh/pico/db/backend"
+	"github.com/picosh/pico/db/remote"
+	"github.com/picosh/pico/shared"
+)
+
+// dbapi serves DATABASE_URL to the services that point their own
+// DATABASE_URL at it, so they need no access to the database themselves.
+func main() {
+	debug := shared.GetEnv("DATABASE_API_DEBUG", "0")
+	port := shared.GetEnv("DATABASE_API_PORT", "3100")
+	secret := shared.GetEnv("DATABASE_API_SECRET", "")
+	logger := shared.CreateLogger("dbapi", debug == "1")
+
+	if secret == "" {
+		logger.Error("DATABASE_API_SECRET must be set")
+		os.Exit(1)
+	}
+	databaseUrl := shared.GetEnv("DATABASE_URL", "")
+	if remote.IsURL(databaseUrl) {
+		logger.Error("DATABASE_URL must point at the database itself")
+		os.Exit(1)
+	}
+	dbh := backend.Open(databaseUrl, logger)
+	defer dbh.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle(remote.Prefix, remote.NewServer(dbh, secret, logger))
+	mux.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	logger.Info("Starting database api", "port", port)
+	logger.Error(http.ListenAndServe(fmt.Sprintf(":%s", port), mux).Error())
+}
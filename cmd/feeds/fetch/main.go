@@ -4,13 +4,13 @@ import (
 	"fmt"
 
 	"github.com/mmcdole/gofeed"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/feeds"
 )
 
 func main() {
 	cfg := feeds.NewConfigSite()
-	dbh := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	dbh := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer dbh.Close()
 	fetcher := feeds.NewFetcher(dbh, cfg)
 	fp := gofeed.NewParser()
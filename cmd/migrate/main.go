@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/sql/migrations"
+)
+
+func main() {
+	status := flag.Bool("status", false, "list pending migrations without applying them")
+	baseline := flag.String("baseline", "", "mark every migration up to this version as applied without running it")
+	flag.Parse()
+
+	logger := shared.CreateLogger("migrate", false)
+	dbh := postgres.NewDB(shared.GetEnv("DATABASE_URL", ""), logger)
+	defer dbh.Close()
+
+	var versions []string
+	var err error
+	switch {
+	case *baseline != "":
+		versions, err = dbh.Baseline(migrations.FS, *baseline)
+	case *status:
+		pending, perr := dbh.PendingMigrations(migrations.FS)
+		for _, migration := range pending {
+			versions = append(versions, migration.Version)
+		}
+		err = perr
+	default:
+		versions, err = dbh.Migrate(migrations.FS)
+	}
+
+	for _, version := range versions {
+		fmt.Println(version)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
@@ -1,7 +1,25 @@
 package main
 
-import "github.com/picosh/pico/pgs"
+import (
+	"os"
+
+	"github.com/picosh/pico/pgs"
+)
 
 func main() {
+	// `pgs-ssh gc [--write]` reconciles storage once instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		os.Exit(pgs.RunGC(os.Args[2:]))
+	}
+	// `pgs-ssh scan-report [--since 168h]` lists what the upload scanner
+	// flagged
+	if len(os.Args) > 1 && os.Args[1] == "scan-report" {
+		os.Exit(pgs.RunScanReport(os.Args[2:]))
+	}
+	// `pgs-ssh config validate [--file pgs.env]` prints the resolved
+	// settings and what is wrong with them
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(pgs.RunConfig(os.Args[2:]))
+	}
 	pgs.StartSshServer()
 }
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/remote"
+	"github.com/picosh/pico/db/sqlite"
+	"github.com/picosh/pico/shared"
+)
+
+// Open opens the database `databaseUrl` points at, `sqlite:` urls are a
+// file on disk, `http(s):` urls a database api authenticated with
+// DATABASE_API_SECRET and everything else is handed to postgres.
+func Open(databaseUrl string, logger *slog.Logger) db.DB {
+	if sqlite.IsURL(databaseUrl) {
+		return sqlite.NewDB(databaseUrl, logger)
+	}
+	if remote.IsURL(databaseUrl) {
+		return remote.NewDB(databaseUrl, shared.GetEnv("DATABASE_API_SECRET", ""), logger)
+	}
+	return postgres.NewDB(databaseUrl, logger)
+}
+
+// NewDB opens the database like Open and caches user and feature lookups
+// for DATABASE_CACHE_TTL, 0 disables it.
+func NewDB(databaseUrl string, logger *slog.Logger) db.DB {
+	dbpool := Open(databaseUrl, logger)
+
+	ttl, err := time.ParseDuration(shared.GetEnv("DATABASE_CACHE_TTL", "30s"))
+	if err != nil {
+		logger.Error("invalid DATABASE_CACHE_TTL", "err", err.Error())
+		return dbpool
+	}
+	if ttl <= 0 {
+		return dbpool
+	}
+	return db.NewCachedDB(dbpool, ttl)
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+type cachedUser struct {
+	user    *User
+	expires time.Time
+}
+
+type cachedFeature struct {
+	userID  string
+	has     bool
+	ff      *FeatureFlag
+	expires time.Time
+}
+
+// CachedDB memoizes the lookups every ssh connection and asset request
+// makes: the user behind a public key and the feature flags of a user.
+// Changes made through CachedDB drop the affected entries right away,
+// changes made by other processes show up once the ttl runs out.
+type CachedDB struct {
+	DB
+	ttl      time.Duration
+	mu       sync.RWMutex
+	users    map[string]cachedUser
+	has      map[string]cachedFeature
+	features map[string]cachedFeature
+	// gen changes with every invalidation so a lookup that raced one does
+	// not put what it read back into the cache
+	gen   uint64
+	swept time.Time
+}
+
+func NewCachedDB(dbpool DB, ttl time.Duration) *CachedDB {
+	return &CachedDB{
+		DB:       dbpool,
+		ttl:      ttl,
+		users:    map[string]cachedUser{},
+		has:      map[string]cachedFeature{},
+		features: map[string]cachedFeature{},
+	}
+}
+
+// callers are free to change what they get back so hand out copies.
+func copyUser(user *User) *User {
+	cp := *user
+	if user.PublicKey != nil {
+		pk := *user.PublicKey
+		cp.PublicKey = &pk
+	}
+	return &cp
+}
+
+// generation is read before going to the database.
+func (me *CachedDB) generation() uint64 {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.gen
+}
+
+// store runs set under the lock unless something was invalidated since
+// gen was read, it also drops expired entries once per ttl.
+func (me *CachedDB) store(gen uint64, set func(expires time.Time)) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if gen != me.gen {
+		return
+	}
+	now := time.Now()
+	set(now.Add(me.ttl))
+
+	if now.Sub(me.swept) < me.ttl {
+		return
+	}
+	me.swept = now
+	for key, cached := range me.users {
+		if now.After(cached.expires) {
+			delete(me.users, key)
+		}
+	}
+	for _, cache := range []map[string]cachedFeature{me.has, me.features} {
+		for key, cached := range cache {
+			if now.After(cached.expires) {
+				delete(cache, key)
+			}
+		}
+	}
+}
+
+func featureKey(userID, feature string) string {
+	return userID + ":" + feature
+}
+
+// InvalidateUser drops everything cached for the user, call it whenever
+// keys, names or the suspension of a user change outside of CachedDB.
+func (me *CachedDB) InvalidateUser(userID string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for key, cached := range me.users {
+		if cached.user.ID == userID {
+			delete(me.users, key)
+		}
+	}
+	me.invalidateFeatures(userID)
+}
+
+// InvalidateFeatures drops the cached feature flags of the user, an empty
+// userID drops them for everyone.
+func (me *CachedDB) InvalidateFeatures(userID string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.invalidateFeatures(userID)
+}
+
+func (me *CachedDB) invalidateFeatures(userID string) {
+	me.gen += 1
+	for _, cache := range []map[string]cachedFeature{me.has, me.features} {
+		for key, cached := range cache {
+			if userID == "" || cached.userID == userID {
+				delete(cache, key)
+			}
+		}
+	}
+}
+
+func (me *CachedDB) invalidateKeys(pubkeyIDs []string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.gen += 1
+	for key, cached := range me.users {
+		if cached.user.PublicKey == nil {
+			continue
+		}
+		for _, id := range pubkeyIDs {
+			if cached.user.PublicKey.ID == id {
+				delete(me.users, key)
+			}
+		}
+	}
+}
+
+func (me *CachedDB) FindUserForKey(name string, pubkey string) (*User, error) {
+	// with several accounts on one key the name picks the user
+	key := name + " " + pubkey
+	me.mu.RLock()
+	cached, ok := me.users[key]
+	me.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return copyUser(cached.user), nil
+	}
+
+	gen := me.generation()
+	user, err := me.DB.FindUserForKey(name, pubkey)
+	if err != nil {
+		return user, err
+	}
+	me.store(gen, func(expires time.Time) {
+		me.users[key] = cachedUser{user: copyUser(user), expires: expires}
+	})
+	return user, nil
+}
+
+func (me *CachedDB) HasFeatureForUser(userID string, feature string) bool {
+	key := featureKey(userID, feature)
+	me.mu.RLock()
+	cached, ok := me.has[key]
+	me.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.has
+	}
+
+	gen := me.generation()
+	has := me.DB.HasFeatureForUser(userID, feature)
+	me.store(gen, func(expires time.Time) {
+		me.has[key] = cachedFeature{userID: userID, has: has, expires: expires}
+	})
+	return has
+}
+
+// FindFeatureForUser caches users without the feature too, they make up
+// most of the lookups.
+func (me *CachedDB) FindFeatureForUser(userID string, feature string) (*FeatureFlag, error) {
+	key := featureKey(userID, feature)
+	me.mu.RLock()
+	cached, ok := me.features[key]
+	me.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		if cached.ff == nil {
+			return nil, sql.ErrNoRows
+		}
+		ff := *cached.ff
+		return &ff, nil
+	}
+
+	gen := me.generation()
+	ff, err := me.DB.FindFeatureForUser(userID, feature)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ff, err
+	}
+	me.store(gen, func(expires time.Time) {
+		entry := cachedFeature{userID: userID, expires: expires}
+		if err == nil {
+			cp := *ff
+			entry.ff = &cp
+		}
+		me.features[key] = entry
+	})
+	return ff, err
+}
+
+func (me *CachedDB) RemoveUsers(userIDs []string) error {
+	err := me.DB.RemoveUsers(userIDs)
+	for _, userID := range userIDs {
+		me.InvalidateUser(userID)
+	}
+	return err
+}
+
+func (me *CachedDB) RemoveKeys(pubkeyIDs []string) error {
+	err := me.DB.RemoveKeys(pubkeyIDs)
+	me.invalidateKeys(pubkeyIDs)
+	return err
+}
+
+func (me *CachedDB) RemovePublicKey(userID, pubkeyID string) error {
+	err := me.DB.RemovePublicKey(userID, pubkeyID)
+	me.invalidateKeys([]string{pubkeyID})
+	return err
+}
+
+func (me *CachedDB) SetUserName(userID string, name string) error {
+	err := me.DB.SetUserName(userID, name)
+	me.InvalidateUser(userID)
+	return err
+}
+
+func (me *CachedDB) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	err := me.DB.SetUserSuspended(userID, suspended, operatorID)
+	me.InvalidateUser(userID)
+	return err
+}
+
+func (me *CachedDB) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	err := me.DB.SetUserReadOnly(userID, readOnly, operatorID)
+	me.InvalidateUser(userID)
+	return err
+}
+
+func (me *CachedDB) SetFeatureForUser(userID, name string, data FeatureFlagData, expiresAt time.Time) error {
+	err := me.DB.SetFeatureForUser(userID, name, data, expiresAt)
+	me.InvalidateFeatures(userID)
+	return err
+}
+
+func (me *CachedDB) RemoveFeatureForUser(userID, name string) error {
+	err := me.DB.RemoveFeatureForUser(userID, name)
+	me.InvalidateFeatures(userID)
+	return err
+}
+
+// AddPicoPlusUser only knows the user name so every cached flag goes.
+func (me *CachedDB) AddPicoPlusUser(username string, paymentType, txId string) error {
+	err := me.DB.AddPicoPlusUser(username, paymentType, txId)
+	me.InvalidateFeatures("")
+	return err
+}
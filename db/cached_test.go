@@ -0,0 +1,104 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingDB struct {
+	DB
+	mu       sync.Mutex
+	calls    int
+	features map[string]bool
+}
+
+func (me *countingDB) count() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.calls += 1
+}
+
+func (me *countingDB) FindUserForKey(name, pubkey string) (*User, error) {
+	me.count()
+	return &User{ID: "user-1", Name: "erock", PublicKey: &PublicKey{ID: "key-1", Key: pubkey}}, nil
+}
+
+func (me *countingDB) HasFeatureForUser(userID, feature string) bool {
+	me.count()
+	return me.features[feature]
+}
+
+func (me *countingDB) FindFeatureForUser(userID, feature string) (*FeatureFlag, error) {
+	me.count()
+	if !me.features[feature] {
+		return nil, sql.ErrNoRows
+	}
+	return &FeatureFlag{UserID: userID, Name: feature}, nil
+}
+
+func (me *countingDB) RemovePublicKey(userID, pubkeyID string) error { return nil }
+
+func (me *countingDB) AddPicoPlusUser(username, paymentType, txId string) error {
+	me.features["pgs"] = true
+	return nil
+}
+
+func TestCachedDB(t *testing.T) {
+	backend := &countingDB{features: map[string]bool{}}
+	dbpool := NewCachedDB(backend, time.Minute)
+
+	user, _ := dbpool.FindUserForKey("", "ssh-ed25519 AAAA")
+	user.Name = "changed"
+	user, _ = dbpool.FindUserForKey("", "ssh-ed25519 AAAA")
+	if backend.calls != 1 {
+		t.Fatalf("expected a cached user, backend was called %d times", backend.calls)
+	}
+	if user.Name != "erock" {
+		t.Errorf("expected callers not to change the cache, got (%s)", user.Name)
+	}
+
+	err := dbpool.RemovePublicKey("user-1", "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = dbpool.FindUserForKey("", "ssh-ed25519 AAAA")
+	if backend.calls != 2 {
+		t.Fatal("expected a removed key to be looked up again")
+	}
+
+	for i := 0; i < 3; i++ {
+		if dbpool.HasFeatureForUser("user-1", "pgs") {
+			t.Fatal("expected no feature yet")
+		}
+		_, err := dbpool.FindFeatureForUser("user-1", "pgs")
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected no feature yet, got %v", err)
+		}
+	}
+	if backend.calls != 4 {
+		t.Fatalf("expected missing features to be cached, backend was called %d times", backend.calls)
+	}
+
+	_ = dbpool.AddPicoPlusUser("erock", "stripe", "tx")
+	if !dbpool.HasFeatureForUser("user-1", "pgs") {
+		t.Error("expected the new feature after invalidation")
+	}
+	ff, err := dbpool.FindFeatureForUser("user-1", "pgs")
+	if err != nil || ff.Name != "pgs" {
+		t.Errorf("expected the new feature after invalidation, got %v", err)
+	}
+}
+
+func TestCachedDBExpires(t *testing.T) {
+	backend := &countingDB{features: map[string]bool{}}
+	dbpool := NewCachedDB(backend, time.Millisecond)
+	_ = dbpool.HasFeatureForUser("user-1", "pgs")
+	time.Sleep(5 * time.Millisecond)
+	_ = dbpool.HasFeatureForUser("user-1", "pgs")
+	if backend.calls != 2 {
+		t.Errorf("expected an expired entry to be looked up again, backend was called %d times", backend.calls)
+	}
+}
@@ -7,12 +7,21 @@ import (
 	"errors"
 	"regexp"
 	"time"
+
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
 )
 
 var ErrNameTaken = errors.New("username has already been claimed")
 var ErrNameDenied = errors.New("username is on the denylist")
 var ErrNameInvalid = errors.New("username has invalid characters in it")
 var ErrPublicKeyTaken = errors.New("public key is already associated with another user")
+var ErrPublicKeyExists = errors.New("public key is already added to this account")
+var ErrLastPublicKey = errors.New("cannot remove the only public key of an account")
+var ErrUserSuspended = errors.New("account suspended")
+var ErrUserReadOnly = errors.New("account is read-only, uploads and changes are disabled")
+var ErrNotOrgMember = errors.New("not a member of this organization")
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
 
 type PublicKey struct {
 	ID        string     `json:"id"`
@@ -22,15 +31,50 @@ type PublicKey struct {
 }
 
 type User struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	PublicKey *PublicKey `json:"public_key,omitempty"`
-	CreatedAt *time.Time `json:"created_at"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	PublicKey   *PublicKey `json:"public_key,omitempty"`
+	CreatedAt   *time.Time `json:"created_at"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+	ReadOnlyAt  *time.Time `json:"read_only_at"`
+}
+
+// The states of an account. Read-only accounts are still served and can
+// look at their projects but cannot change them, suspended accounts are
+// neither served nor let in.
+const (
+	UserActive    = "active"
+	UserReadOnly  = "read-only"
+	UserSuspended = "suspended"
+)
+
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil && !u.SuspendedAt.IsZero()
+}
+
+func (u *User) IsReadOnly() bool {
+	return u.ReadOnlyAt != nil && !u.ReadOnlyAt.IsZero()
+}
+
+// State is the most restrictive state the account is in.
+func (u *User) State() string {
+	if u.IsSuspended() {
+		return UserSuspended
+	}
+	if u.IsReadOnly() {
+		return UserReadOnly
+	}
+	return UserActive
 }
 
 type PostData struct {
 	ImgPath    string     `json:"img_path"`
 	LastDigest *time.Time `json:"last_digest"`
+	// FeedDigests is when each feed with its own interval, e.g.
+	// `=> https://example.com/rss weekly`, was last sent
+	FeedDigests map[string]*time.Time `json:"feed_digests,omitempty"`
+	// CanonicalURL points search engines at where a post was first published
+	CanonicalURL string `json:"canonical_url,omitempty"`
 }
 
 // Make the Attrs struct implement the driver.Valuer interface. This method
@@ -57,8 +101,206 @@ type Project struct {
 	ProjectDir string     `json:"project_dir"`
 	Username   string     `json:"username"`
 	Acl        ProjectAcl `json:"acl"`
+	Csp        ProjectCsp `json:"csp"`
+	// Sitemap generates `sitemap.xml` and `robots.txt` on every deploy
+	// unless the project brings its own.
+	Sitemap   bool       `json:"sitemap"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ProjectDomain maps a custom domain onto a project, it is only served once
+// the TXT record holding `Token` has been verified. `VerifiedAt` is when the
+// record was last found, it is checked again periodically.
+type ProjectDomain struct {
+	ID          string     `json:"id"`
+	ProjectID   string     `json:"project_id"`
+	ProjectName string     `json:"project_name"`
+	Domain      string     `json:"domain"`
+	Token       string     `json:"token"`
+	VerifiedAt  *time.Time `json:"verified_at"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// Webhook is a url that is sent a signed payload whenever one of the
+// user's projects is created, updated or deleted.
+type Webhook struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	URL       string     `json:"url"`
+	Secret    string     `json:"secret"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// ProjectEvent records that a project was created, updated or deleted,
+// `FileCount` is how many files it held right after.
+type ProjectEvent struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	ProjectName string     `json:"project_name"`
+	Event       string     `json:"event"`
+	FileCount   int        `json:"file_count"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// AuditEntry is a change made to the account `UserID`, `Actor` made it.
+// They are the same user unless a member acted for an organization.
+type AuditEntry struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	ActorID   string `json:"actor_id"`
+	Actor     string `json:"actor"`
+	Space     string `json:"space"`
+	Action    string `json:"action"`
+	SessionID string `json:"session_id"`
+	Path      string `json:"path"`
+	// RemoteAddr is the client address the change came from.
+	RemoteAddr string     `json:"remote_addr"`
 	CreatedAt  *time.Time `json:"created_at"`
-	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+// TrashObject is a deleted asset, it is kept below `TrashPath` in the
+// user's bucket until `ExpiresAt` so it can be restored to `Path`.
+type TrashObject struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Path      string     `json:"path"`
+	TrashPath string     `json:"trash_path"`
+	Size      int64      `json:"size"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// ProjectEnv is a variable substituted into a project's files when they
+// are uploaded, `Value` is stored encrypted.
+type ProjectEnv struct {
+	ID        string     `json:"id"`
+	ProjectID string     `json:"project_id"`
+	Key       string     `json:"key"`
+	Value     string     `json:"value"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ProjectSigningKey is the minisign or gpg public key the deploys of a
+// project must be signed with.
+type ProjectSigningKey struct {
+	ProjectID string     `json:"project_id"`
+	Key       string     `json:"key"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// DomainCert is the tls certificate issued for a verified project domain,
+// `KeyPEM` is stored encrypted.
+type DomainCert struct {
+	ID        string     `json:"id"`
+	Domain    string     `json:"domain"`
+	CertPEM   string     `json:"cert_pem"`
+	KeyPEM    string     `json:"key_pem"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// OrgMember gives a user a role in an organization. An organization is an
+// account without keys of its own, its members deploy to its projects.
+type OrgMember struct {
+	ID        string     `json:"id"`
+	OrgID     string     `json:"org_id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+const (
+	RoleOwner    = "owner"
+	RoleDeployer = "deployer"
+	RoleViewer   = "viewer"
+)
+
+var OrgRoles = []string{RoleOwner, RoleDeployer, RoleViewer}
+
+// CanDeploy is true for the roles allowed to change the org's projects.
+func (m *OrgMember) CanDeploy() bool {
+	return m.Role == RoleOwner || m.Role == RoleDeployer
+}
+
+// ProjectAccess is one way into a private project over http, `Value` is a
+// bcrypt hashed password or the name of a pico user.
+type ProjectAccess struct {
+	ID        string     `json:"id"`
+	ProjectID string     `json:"project_id"`
+	Kind      string     `json:"kind"`
+	Value     string     `json:"-"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+const (
+	AccessPassword = "password"
+	AccessUser     = "user"
+)
+
+// AnalyticsDay is how often `Name`, a project or a post, was served on a
+// day and to how many different visitors.
+type AnalyticsDay struct {
+	UserID  string    `json:"user_id"`
+	Space   string    `json:"space"`
+	Name    string    `json:"name"`
+	Day     time.Time `json:"day"`
+	Hits    int       `json:"hits"`
+	Uniques int       `json:"uniques"`
+}
+
+// BandwidthMonth is how many bytes `Name`, a project, served in the
+// calendar month that starts on `Month`.
+type BandwidthMonth struct {
+	UserID string    `json:"user_id"`
+	Space  string    `json:"space"`
+	Name   string    `json:"name"`
+	Month  time.Time `json:"month"`
+	Bytes  int64     `json:"bytes"`
+}
+
+func (d *ProjectDomain) IsVerified() bool {
+	return d.VerifiedAt != nil
+}
+
+// ProjectDeploy is a revision of a project, an immutable copy of its assets
+// taken when a deploy was promoted. The `Current` revision is served.
+type ProjectDeploy struct {
+	ID        string     `json:"id"`
+	ProjectID string     `json:"project_id"`
+	Revision  int        `json:"revision"`
+	Current   bool       `json:"current"`
+	FileCount int        `json:"file_count"`
+	Size      int64      `json:"size"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// StorageUsage is what the asset bucket of a user takes up as uploads
+// account for it, `Held` is what uploads still being stored reserved.
+type StorageUsage struct {
+	UserID       string     `json:"user_id"`
+	Used         int64      `json:"used"`
+	Held         int64      `json:"held"`
+	ReconciledAt *time.Time `json:"reconciled_at"`
+}
+
+// ObjectManifest points a path in a bucket at the content addressed object
+// holding its bytes, `Meta` is the object metadata as json.
+type ObjectManifest struct {
+	Bucket    string     `json:"bucket"`
+	Path      string     `json:"path"`
+	Checksum  string     `json:"checksum"`
+	Size      int64      `json:"size"`
+	Meta      []byte     `json:"meta"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+func (p *Project) IsExpired() bool {
+	return p.ExpiresAt != nil && time.Now().After(*p.ExpiresAt)
 }
 
 type ProjectAcl struct {
@@ -83,6 +325,29 @@ func (p *ProjectAcl) Scan(value interface{}) error {
 	return json.Unmarshal(b, &p)
 }
 
+type ProjectCsp struct {
+	Policy     string `json:"policy"`
+	ReportOnly bool   `json:"report_only"`
+	ReportURI  string `json:"report_uri"`
+}
+
+// Make the Attrs struct implement the driver.Valuer interface. This method
+// simply returns the JSON-encoded representation of the struct.
+func (p ProjectCsp) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Make the Attrs struct implement the sql.Scanner interface. This method
+// simply decodes a JSON-encoded value into the struct fields.
+func (p *ProjectCsp) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &p)
+}
+
 type FeedItemData struct {
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
@@ -129,6 +394,15 @@ type Post struct {
 	MimeType    string     `json:"mime_type"`
 	Data        PostData   `json:"data"`
 	Tags        []string   `json:"tags"`
+	// Scheduled posts stay out of listings until their publish_at passed
+	Scheduled bool `json:"scheduled"`
+}
+
+// PostSearchResult is a post matching a search along with an excerpt of its
+// text where the terms were found wrapped in `**`.
+type PostSearchResult struct {
+	*Post
+	Snippet string `json:"snippet"`
 }
 
 type Paginate[T any] struct {
@@ -164,10 +438,46 @@ type FeedItem struct {
 	CreatedAt *time.Time
 }
 
+// DigestSubscription holds the token every feed digest of a user links to
+// so they can stop all of them, `UnsubscribedAt` is set once they did.
+type DigestSubscription struct {
+	UserID         string     `json:"user_id"`
+	Token          string     `json:"token"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
+
+func (d *DigestSubscription) IsUnsubscribed() bool {
+	return d.UnsubscribedAt != nil
+}
+
+// PostEmailSender is an address whose emails become posts of the user.
+type PostEmailSender struct {
+	UserID    string     `json:"user_id"`
+	Email     string     `json:"email"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// UserSummary is an account as operators see it in `admin users`.
+type UserSummary struct {
+	*User
+	Projects int
+	// Features are the names of the active feature flags of the user
+	Features []string
+}
+
+// Tokens are scoped to what they authenticate, a token that reads feeds
+// must not be able to deploy.
+const (
+	TokenScopeDefault = ""
+	TokenScopeDeploy  = "deploy"
+)
+
 type Token struct {
 	ID        string
 	UserID    string
 	Name      string
+	Scope     string
 	CreatedAt *time.Time
 	ExpiresAt *time.Time
 }
@@ -207,6 +517,35 @@ func (ff *FeatureFlag) FindFileMax(defaultSize int64) int64 {
 	return ff.Data.FileMax
 }
 
+// FindFileCountMax returns how many files a user may keep, per project
+// for pgs and per user for the post services.
+func (ff *FeatureFlag) FindFileCountMax(defaultCount int) int {
+	if ff.Data.FileCountMax == 0 {
+		return defaultCount
+	}
+	return ff.Data.FileCountMax
+}
+
+// FindObjectCountMax returns how many files a user may keep across all of
+// their projects.
+func (ff *FeatureFlag) FindObjectCountMax(defaultCount int) int {
+	if ff.Data.ObjectCountMax == 0 {
+		return defaultCount
+	}
+	return ff.Data.ObjectCountMax
+}
+
+// ApplyQuota fills in the limits the feature flag leaves unset from a plan,
+// limits set on the flag itself always win.
+func (ff *FeatureFlag) ApplyQuota(quota *Quota) {
+	if quota == nil {
+		return
+	}
+	ff.Data.StorageMax = ff.FindStorageMax(quota.StorageMax)
+	ff.Data.FileMax = ff.FindFileMax(quota.FileMax)
+	ff.Data.FileCountMax = ff.FindFileCountMax(quota.FileCountMax)
+}
+
 func (ff *FeatureFlag) IsValid() bool {
 	if ff.ExpiresAt.IsZero() {
 		return false
@@ -217,6 +556,20 @@ func (ff *FeatureFlag) IsValid() bool {
 type FeatureFlagData struct {
 	StorageMax uint64 `json:"storage_max"`
 	FileMax    int64  `json:"file_max"`
+	// FileCountMax caps how many files can be stored, 0 is unlimited
+	FileCountMax int `json:"file_count_max"`
+	// ObjectCountMax caps how many files a user keeps across every
+	// project, 0 is unlimited
+	ObjectCountMax int `json:"object_count_max"`
+}
+
+// Quota is a storage plan granted to users that hold its feature flag.
+type Quota struct {
+	Plan         string
+	Service      string
+	StorageMax   uint64
+	FileMax      int64
+	FileCountMax int
 }
 
 // Make the Attrs struct implement the driver.Valuer interface. This method
@@ -283,6 +636,9 @@ type DB interface {
 	FindPublicKeyForKey(pubkey string) (*PublicKey, error)
 	FindKeysForUser(user *User) ([]*PublicKey, error)
 	RemoveKeys(pubkeyIDs []string) error
+	InsertPublicKey(userID, pubkey string) (*PublicKey, error)
+	RemovePublicKey(userID, pubkeyID string) error
+	ListKeysForUser(userID string) ([]*PublicKey, error)
 
 	FindSiteAnalytics(space string) (*Analytics, error)
 
@@ -293,16 +649,35 @@ type DB interface {
 	FindUser(userID string) (*User, error)
 	ValidateName(name string) (bool, error)
 	SetUserName(userID string, name string) error
+	SetUserSuspended(userID string, suspended bool, operatorID string) error
+	SetUserReadOnly(userID string, readOnly bool, operatorID string) error
 
+	// FindUserForToken only accepts tokens of the default scope.
 	FindUserForToken(token string) (*User, error)
+	FindUserForScopedToken(token, scope string) (*User, error)
 	FindTokensForUser(userID string) ([]*Token, error)
 	InsertToken(userID, name string) (string, error)
+	InsertScopedToken(userID, name, scope string) (string, error)
 	RemoveToken(tokenID string) error
 
+	// FindUserSummaries lists the accounts whose name contains filter, an
+	// empty filter lists everyone.
+	FindUserSummaries(filter string) ([]*UserSummary, error)
+	// SetFeatureForUser grants a feature flag until expiresAt, it takes
+	// over from any flag of the same name the user holds.
+	SetFeatureForUser(userID, name string, data FeatureFlagData, expiresAt time.Time) error
+	// RemoveFeatureForUser expires the active flags of that name.
+	RemoveFeatureForUser(userID, name string) error
+	// RemoveTokensForUser revokes every api token of the user and returns
+	// how many there were.
+	RemoveTokensForUser(userID string) (int, error)
+
 	FindPosts() ([]*Post, error)
 	FindPost(postID string) (*Post, error)
 	FindPostsForUser(pager *Pager, userID string, space string) (*Paginate[*Post], error)
 	FindAllPostsForUser(userID string, space string) ([]*Post, error)
+	// FindPostCountForUser is how many posts a user has in space.
+	FindPostCountForUser(userID string, space string) (int, error)
 	FindPostsBeforeDate(date *time.Time, space string) ([]*Post, error)
 	FindExpiredPosts(space string) ([]*Post, error)
 	FindUpdatedPostsForUser(userID string, space string) ([]*Post, error)
@@ -313,6 +688,12 @@ type DB interface {
 	InsertPost(post *Post) (*Post, error)
 	UpdatePost(post *Post) (*Post, error)
 	RemovePosts(postIDs []string) error
+	// PublishScheduledPosts flips scheduled posts whose publish_at passed
+	// live and returns them.
+	PublishScheduledPosts(limit int) ([]*Post, error)
+	// SearchPostsForUser finds the published posts matching query, the best
+	// matches first.
+	SearchPostsForUser(userID, space, query string, limit int) ([]*PostSearchResult, error)
 
 	ReplaceTagsForPost(tags []string, postID string) error
 	FindUserPostsByTag(pager *Pager, tag, userID, space string) (*Paginate[*Post], error)
@@ -327,21 +708,162 @@ type DB interface {
 	AddPicoPlusUser(username string, paymentType, txId string) error
 	FindFeatureForUser(userID string, feature string) (*FeatureFlag, error)
 	HasFeatureForUser(userID string, feature string) bool
+	FindQuotaForUser(userID string, feature string) (*Quota, error)
+	HasAnyFeatureForUser(userID string, features ...string) (bool, error)
 	FindTotalSizeForUser(userID string) (int, error)
 
 	InsertFeedItems(postID string, items []*FeedItem) error
 	FindFeedItemsByPostID(postID string) ([]*FeedItem, error)
+	// UpsertDigestSubscription returns the subscription of the user, it is
+	// created with a new token the first time.
+	UpsertDigestSubscription(userID string) (*DigestSubscription, error)
+	// UnsubscribeDigests stops the digests of the user the token belongs to.
+	UnsubscribeDigests(token string) (*DigestSubscription, error)
+	ResubscribeDigests(userID string) error
+	// AddPostEmailSender lets emails from the address post as the user,
+	// adding it twice is not an error.
+	AddPostEmailSender(userID, email string) error
+	RemovePostEmailSender(userID, email string) error
+	FindPostEmailSenders(userID string) ([]*PostEmailSender, error)
 
 	InsertProject(userID, name, projectDir string) (string, error)
 	UpdateProject(userID, name string) error
 	UpdateProjectAcl(userID, name string, acl ProjectAcl) error
+	UpdateProjectCsp(userID, name string, csp ProjectCsp) error
+	UpdateProjectSitemap(userID, name string, sitemap bool) error
+	UpsertHeaders(projectID string, rules []*headers.HeaderRule) error
+	UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error
 	LinkToProject(userID, projectID, projectDir string, commit bool) error
 	RemoveProject(projectID string) error
+	SetProjectExpiry(projectID string, expiresAt *time.Time) error
+	ClaimExpiredProjects(limit int) ([]*Project, error)
+	RenameProject(userID, oldName, newName string) error
 	FindProjectByName(userID, name string) (*Project, error)
 	FindProjectLinks(userID, name string) ([]*Project, error)
 	FindProjectsByUser(userID string) ([]*Project, error)
 	FindProjectsByPrefix(userID, name string) ([]*Project, error)
+	FindStaleProjects(userID string, updatedBefore time.Time) ([]*Project, error)
 	FindAllProjects(page *Pager, by string) (*Paginate[*Project], error)
+	FindProjectObjectCount(userID, name string) (*int, error)
+	FindObjectCountsForUser(userID string) (map[string]*int, error)
+	SetProjectObjectCount(userID, name string, count *int) error
+	AdjustProjectObjectCount(userID, name string, delta int) error
+
+	InsertProjectDomain(projectID, domain string) (string, error)
+	RemoveProjectDomain(userID, domain string) error
+	FindProjectDomains(userID string) ([]*ProjectDomain, error)
+	FindUnverifiedDomains(limit int) ([]*ProjectDomain, error)
+	VerifyProjectDomain(domainID string) error
+	// FindDomainsToRecheck returns verified domains whose TXT record was
+	// last found before verifiedBefore.
+	FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*ProjectDomain, error)
+	// UnverifyProjectDomain stops serving a domain until its TXT record is
+	// found again.
+	UnverifyProjectDomain(domainID string) error
+	FindSubdomainForDomain(domain string) (string, error)
+	// UpsertDomainCert stores the certificate of a domain or replaces it.
+	UpsertDomainCert(cert *DomainCert) error
+	FindDomainCert(domain string) (*DomainCert, error)
+	// FindDomainsForCerts returns verified domains without a certificate
+	// or with one that expires before renewBefore.
+	FindDomainsForCerts(renewBefore time.Time, limit int) ([]*ProjectDomain, error)
+
+	InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error
+	FindProjectDeploys(projectID string) ([]*ProjectDeploy, error)
+	FindCurrentDeploy(userID, projectName string) (*ProjectDeploy, error)
+	SetCurrentDeploy(projectID string, revision int) error
+	ClearCurrentDeploy(userID, projectName string) error
+	RemoveProjectDeploy(deployID string) error
+
+	InsertWebhook(userID, url, secret string) (string, error)
+	FindWebhooksForUser(userID string) ([]*Webhook, error)
+	RemoveWebhook(userID, webhookID string) error
+
+	InsertAuditEntry(entry *AuditEntry) error
+	// FindAuditLog returns the newest entries since then first.
+	FindAuditLog(userID string, since time.Time, limit int) ([]*AuditEntry, error)
+
+	InsertTrashObject(obj *TrashObject) error
+	// FindTrashObjects returns the trash of a user, newest first.
+	FindTrashObjects(userID string) ([]*TrashObject, error)
+	RemoveTrashObject(id string) error
+	ClaimExpiredTrash(limit int) ([]*TrashObject, error)
+
+	// SetProjectEnv inserts the variable or replaces its value.
+	SetProjectEnv(projectID, key, value string) error
+	RemoveProjectEnv(projectID, key string) error
+	// FindProjectEnv returns the variables of a project sorted by key.
+	FindProjectEnv(projectID string) ([]*ProjectEnv, error)
+
+	// SetProjectSigningKey registers the key deploys of a project are
+	// verified with, replacing the previous one.
+	SetProjectSigningKey(projectID, key string) error
+	RemoveProjectSigningKey(projectID string) error
+	// FindProjectSigningKey returns nil when the project accepts unsigned
+	// deploys.
+	FindProjectSigningKey(projectID string) (*ProjectSigningKey, error)
+
+	// CreateOrg registers the organization name with ownerID as its owner.
+	CreateOrg(ownerID, name string) (*User, error)
+	// FindOrgForName fails for regular users.
+	FindOrgForName(name string) (*User, error)
+	// FindOrgMember returns ErrNotOrgMember when userID has no role.
+	FindOrgMember(orgID, userID string) (*OrgMember, error)
+	FindOrgMembers(orgID string) ([]*OrgMember, error)
+	SetOrgMember(orgID, userID, role string) error
+	RemoveOrgMember(orgID, userID string) error
+
+	// SetProjectAccess replaces every way into the project with entries.
+	SetProjectAccess(projectID string, entries []*ProjectAccess) error
+	FindProjectAccess(projectID string) ([]*ProjectAccess, error)
+
+	InsertProjectEvent(event *ProjectEvent) error
+	// FindProjectEventsForUser returns the newest events first.
+	FindProjectEventsForUser(userID string, limit int) ([]*ProjectEvent, error)
+
+	// AddAnalytics adds the counts of day onto the ones already stored.
+	AddAnalytics(day *AnalyticsDay) error
+	// FindAnalytics returns the days from since on, oldest first. An empty
+	// name returns the days of every project or post.
+	FindAnalytics(userID, space, name string, since time.Time) ([]*AnalyticsDay, error)
+
+	// AddBandwidth adds the bytes of month onto the ones already stored.
+	AddBandwidth(month *BandwidthMonth) error
+	// FindBandwidth returns what every project of the user served in the
+	// month, the busiest first.
+	FindBandwidth(userID, space string, month time.Time) ([]*BandwidthMonth, error)
+
+	// SeedStorageUsage starts the usage of a user at used unless there is
+	// one already.
+	SeedStorageUsage(userID string, used int64) error
+	// ReserveStorage holds size bytes for an upload to projectName as long
+	// as what is used and held stays within max, otherwise it returns
+	// ErrQuotaExceeded. The reservation of projectName does not count, it
+	// was made for this upload. It returns the id of the hold.
+	ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error)
+	// ReserveProjectStorage holds size bytes for an upcoming deploy of
+	// projectName like ReserveStorage, it replaces the previous reservation
+	// of the project.
+	ReserveProjectStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error)
+	// CommitStorage drops the hold and adds delta, what was stored in the
+	// end, to the usage.
+	CommitStorage(userID, holdID string, delta int64) error
+	ReleaseStorage(holdID string) error
+	// AddStorageUsage accounts for changes that need no hold, e.g. deletes.
+	AddStorageUsage(userID string, delta int64) error
+	// SetStorageUsage replaces the usage with what storage reports unless
+	// an upload holds space, then it returns false since the numbers are
+	// still moving. Reservations of projects do not change the usage.
+	SetStorageUsage(userID string, used int64) (bool, error)
+	// FindStorageUsages returns every usage, the longest unreconciled first.
+	FindStorageUsages() ([]*StorageUsage, error)
+	RemoveExpiredStorageHolds() (int, error)
+
+	UpsertObjectManifest(manifest *ObjectManifest) error
+	FindObjectManifest(bucket, fpath string) (*ObjectManifest, error)
+	FindObjectManifests(bucket, prefix string) ([]*ObjectManifest, error)
+	RemoveObjectManifest(bucket, fpath string) error
+	CountObjectManifestRefs(bucket, checksum string) (int, error)
 
 	Close() error
 }
@@ -0,0 +1,1921 @@
+// Package dbtest holds the conformance tests every implementation of
+// db.DB has to pass so services behave the same on any backend.
+package dbtest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+)
+
+var seq atomic.Int64
+
+// unique names keep the tests independent when they share a database.
+func unique(prefix string) string {
+	return fmt.Sprintf("%s%s%d", prefix, strconv.FormatInt(time.Now().UnixNano(), 36), seq.Add(1))
+}
+
+func register(t *testing.T, dbpool db.DB) *db.User {
+	t.Helper()
+	name := unique("u")
+	user, err := dbpool.RegisterUser(name, "ssh-ed25519 "+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// Run exercises every method of db.DB against dbpool, which needs a fully
+// migrated schema.
+func Run(t *testing.T, dbpool db.DB) {
+	t.Run("users", func(t *testing.T) { testUsers(t, dbpool) })
+	t.Run("keys", func(t *testing.T) { testKeys(t, dbpool) })
+	t.Run("tokens", func(t *testing.T) { testTokens(t, dbpool) })
+	t.Run("posts", func(t *testing.T) { testPosts(t, dbpool) })
+	t.Run("scheduled", func(t *testing.T) { testScheduledPosts(t, dbpool) })
+	t.Run("search", func(t *testing.T) { testSearchPosts(t, dbpool) })
+	t.Run("features", func(t *testing.T) { testFeatures(t, dbpool) })
+	t.Run("admin", func(t *testing.T) { testAdmin(t, dbpool) })
+	t.Run("projects", func(t *testing.T) { testProjects(t, dbpool) })
+	t.Run("env", func(t *testing.T) { testProjectEnv(t, dbpool) })
+	t.Run("signing keys", func(t *testing.T) { testSigningKeys(t, dbpool) })
+	t.Run("digest subscriptions", func(t *testing.T) { testDigestSubscriptions(t, dbpool) })
+	t.Run("post email senders", func(t *testing.T) { testPostEmailSenders(t, dbpool) })
+	t.Run("domains", func(t *testing.T) { testDomains(t, dbpool) })
+	t.Run("certs", func(t *testing.T) { testDomainCerts(t, dbpool) })
+	t.Run("deploys", func(t *testing.T) { testDeploys(t, dbpool) })
+	t.Run("webhooks", func(t *testing.T) { testWebhooks(t, dbpool) })
+	t.Run("access", func(t *testing.T) { testProjectAccess(t, dbpool) })
+	t.Run("orgs", func(t *testing.T) { testOrgs(t, dbpool) })
+	t.Run("audit", func(t *testing.T) { testAuditLog(t, dbpool) })
+	t.Run("trash", func(t *testing.T) { testTrash(t, dbpool) })
+	t.Run("events", func(t *testing.T) { testProjectEvents(t, dbpool) })
+	t.Run("analytics", func(t *testing.T) { testAnalytics(t, dbpool) })
+	t.Run("bandwidth", func(t *testing.T) { testBandwidth(t, dbpool) })
+	t.Run("manifests", func(t *testing.T) { testManifests(t, dbpool) })
+	t.Run("storage usage", func(t *testing.T) { testStorageUsage(t, dbpool) })
+}
+
+func testUsers(t *testing.T, dbpool db.DB) {
+	name := unique("U")
+	user, err := dbpool.RegisterUser(name, "ssh-ed25519 "+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != strings.ToLower(name) || user.PublicKey == nil || user.CreatedAt == nil {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if user.IsSuspended() {
+		t.Error("new users are not suspended")
+	}
+
+	_, err = dbpool.RegisterUser(name, "ssh-ed25519 other"+name)
+	if !errors.Is(err, db.ErrNameTaken) {
+		t.Errorf("expected the name to be taken, got %v", err)
+	}
+	_, err = dbpool.ValidateName("admin")
+	if !errors.Is(err, db.ErrNameDenied) {
+		t.Errorf("expected admin to be denied, got %v", err)
+	}
+	_, err = dbpool.ValidateName("not valid")
+	if !errors.Is(err, db.ErrNameInvalid) {
+		t.Errorf("expected the name to be invalid, got %v", err)
+	}
+
+	found, err := dbpool.FindUserForKey("", "ssh-ed25519 "+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("expected user (%s), got (%s)", user.ID, found.ID)
+	}
+	found, err = dbpool.FindUserForNameAndKey(name, "ssh-ed25519 "+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID || found.PublicKey.Key != "ssh-ed25519 "+name {
+		t.Errorf("unexpected user %+v", found)
+	}
+
+	operator := register(t, dbpool)
+	err = dbpool.SetUserSuspended(user.ID, true, operator.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found.IsSuspended() {
+		t.Error("expected the user to be suspended")
+	}
+	err = dbpool.SetUserSuspended(user.ID, false, operator.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.IsSuspended() {
+		t.Error("expected the user to be unsuspended")
+	}
+
+	err = dbpool.SetUserReadOnly(user.ID, true, operator.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindUserForKey("", "ssh-ed25519 "+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found.IsReadOnly() || found.State() != db.UserReadOnly {
+		t.Errorf("expected the user to be read-only, got (%s)", found.State())
+	}
+	err = dbpool.SetUserReadOnly(user.ID, false, operator.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.State() != db.UserActive {
+		t.Errorf("expected the user to be active, got (%s)", found.State())
+	}
+
+	renamed := unique("r")
+	err = dbpool.SetUserName(user.ID, renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindUserForName(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("expected user (%s), got (%s)", user.ID, found.ID)
+	}
+
+	users, err := dbpool.FindUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) < 2 {
+		t.Errorf("expected at least two users, got (%d)", len(users))
+	}
+
+	err = dbpool.RemoveUsers([]string{user.ID, operator.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindUser(user.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the user to be removed, got %v", err)
+	}
+}
+
+func testKeys(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	other := register(t, dbpool)
+
+	_, err := dbpool.InsertPublicKey(user.ID, user.PublicKey.Key)
+	if !errors.Is(err, db.ErrPublicKeyExists) {
+		t.Errorf("expected the key to exist, got %v", err)
+	}
+	_, err = dbpool.InsertPublicKey(user.ID, other.PublicKey.Key)
+	if !errors.Is(err, db.ErrPublicKeyTaken) {
+		t.Errorf("expected the key to be taken, got %v", err)
+	}
+
+	second, err := dbpool.InsertPublicKey(user.ID, "ssh-ed25519 second"+user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID == "" || second.CreatedAt == nil {
+		t.Errorf("unexpected key %+v", second)
+	}
+	keys, err := dbpool.ListKeysForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[1].ID != second.ID {
+		t.Fatalf("expected the new key last, got %+v", keys)
+	}
+
+	err = dbpool.RemovePublicKey(user.ID, keys[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.RemovePublicKey(user.ID, second.ID)
+	if !errors.Is(err, db.ErrLastPublicKey) {
+		t.Errorf("expected the last key to stay, got %v", err)
+	}
+	err = dbpool.RemovePublicKey(other.ID, second.ID)
+	if err == nil {
+		t.Error("expected keys of other users to be left alone")
+	}
+
+	err = dbpool.RemoveKeys([]string{second.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err = dbpool.FindKeysForUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no keys, got %+v", keys)
+	}
+}
+
+func testTokens(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	token, err := dbpool.InsertToken(user.ID, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := dbpool.FindUserForToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("expected user (%s), got (%s)", user.ID, found.ID)
+	}
+
+	tokens, err := dbpool.FindTokensForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "ci" || tokens[0].ExpiresAt == nil {
+		t.Fatalf("unexpected tokens %+v", tokens)
+	}
+
+	err = dbpool.RemoveToken(tokens[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindUserForToken(token)
+	if err == nil {
+		t.Error("expected a removed token to be rejected")
+	}
+
+	deploy, err := dbpool.InsertScopedToken(user.ID, "deploy", db.TokenScopeDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindUserForScopedToken(deploy, db.TokenScopeDeploy)
+	if err != nil || found.ID != user.ID {
+		t.Errorf("expected the deploy token to find user (%s), got (%+v, %v)", user.ID, found, err)
+	}
+	_, err = dbpool.FindUserForToken(deploy)
+	if err == nil {
+		t.Error("expected a deploy token to be rejected for the default scope")
+	}
+	feed, err := dbpool.InsertToken(user.ID, "feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindUserForScopedToken(feed, db.TokenScopeDeploy)
+	if err == nil {
+		t.Error("expected a default token to be rejected for deploys")
+	}
+	tokens, err = dbpool.FindTokensForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopes := map[string]string{}
+	for _, tok := range tokens {
+		scopes[tok.Name] = tok.Scope
+	}
+	if scopes["deploy"] != db.TokenScopeDeploy || scopes["feed"] != db.TokenScopeDefault {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+}
+
+func testPosts(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	space := "prose"
+	publishAt := time.Now().Add(-48 * time.Hour)
+	post, err := dbpool.InsertPost(&db.Post{
+		UserID:    user.ID,
+		Filename:  "hello.md",
+		Slug:      "hello",
+		Title:     "hello",
+		Text:      "# hello",
+		PublishAt: &publishAt,
+		UpdatedAt: &publishAt,
+		Space:     space,
+		FileSize:  7,
+		MimeType:  "text/markdown",
+		Shasum:    "abc",
+		Data:      db.PostData{ImgPath: "/img.png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Username != user.Name || post.Data.ImgPath != "/img.png" || post.Views != 0 {
+		t.Errorf("unexpected post %+v", post)
+	}
+	if post.PublishAt == nil || !post.PublishAt.Equal(publishAt) {
+		t.Errorf("expected publish at (%s), got (%v)", publishAt, post.PublishAt)
+	}
+
+	err = dbpool.ReplaceTagsForPost([]string{"go", "db"}, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.ReplaceTagsForPost([]string{"go"}, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := dbpool.FindPostWithFilename("hello.md", user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"go"}, found.Tags); diff != "" {
+		t.Error(diff)
+	}
+	tags, err := dbpool.FindTagsForPost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"go"}, tags); diff != "" {
+		t.Error(diff)
+	}
+
+	alias := unique("old")
+	err = dbpool.ReplaceAliasesForPost([]string{alias, "rss"}, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = dbpool.FindPostWithSlug(alias, user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != post.ID {
+		t.Errorf("expected the alias to find (%s), got (%s)", post.ID, found.ID)
+	}
+	_, err = dbpool.FindPostWithSlug("rss", user.ID, space)
+	if err == nil {
+		t.Error("expected denied aliases to be skipped")
+	}
+
+	post.Title = "updated"
+	post.Hidden = true
+	updated, err := dbpool.UpdatePost(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "updated" || !updated.Hidden {
+		t.Errorf("unexpected post %+v", updated)
+	}
+	drafts, err := dbpool.FindPostsByTag(&db.Pager{Num: 10}, "go", space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range drafts.Data {
+		if p.ID == post.ID {
+			t.Error("expected drafts to stay out of the tag feed")
+		}
+	}
+	post.Hidden = false
+	_, err = dbpool.UpdatePost(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	views, err := dbpool.AddViewCount(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 1 {
+		t.Errorf("expected (1) view, got (%d)", views)
+	}
+
+	pager, err := dbpool.FindPostsForUser(&db.Pager{Num: 10, Page: 0}, user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pager.Data) != 1 || pager.Data[0].ID != post.ID || pager.Total < 1 {
+		t.Fatalf("unexpected page %+v", pager)
+	}
+	tagged, err := dbpool.FindUserPostsByTag(&db.Pager{Num: 10, Page: 0}, "go", user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagged.Data) != 1 {
+		t.Errorf("expected one tagged post, got (%d)", len(tagged.Data))
+	}
+	posts, err := dbpool.FindUpdatedPostsForUser(user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 {
+		t.Errorf("expected one post, got (%d)", len(posts))
+	}
+	for _, find := range []func(*db.Pager, string) (*db.Paginate[*db.Post], error){
+		dbpool.FindAllPosts,
+		dbpool.FindAllUpdatedPosts,
+	} {
+		page, err := find(&db.Pager{Num: 1000, Page: 0}, space)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !containsPost(page.Data, post.ID) {
+			t.Error("expected the post in the feed")
+		}
+	}
+	page, err := dbpool.FindPostsByTag(&db.Pager{Num: 1000, Page: 0}, "go", space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsPost(page.Data, post.ID) {
+		t.Error("expected the post in the tag feed")
+	}
+
+	expiresAt := time.Now().Add(-time.Hour)
+	paste, err := dbpool.InsertPost(&db.Post{
+		UserID:    user.ID,
+		Filename:  "paste.txt",
+		Slug:      "paste",
+		Title:     "paste",
+		PublishAt: &publishAt,
+		UpdatedAt: &publishAt,
+		ExpiresAt: &expiresAt,
+		Space:     "pastes",
+		FileSize:  3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := dbpool.FindExpiredPosts("pastes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsPost(expired, paste.ID) {
+		t.Error("expected the paste to be expired")
+	}
+	before, err := dbpool.FindPostsBeforeDate(&expiresAt, "pastes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsPost(before, paste.ID) {
+		t.Error("expected the paste to be published before now")
+	}
+
+	size, err := dbpool.FindTotalSizeForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 10 {
+		t.Errorf("expected (10) bytes, got (%d)", size)
+	}
+	all, err := dbpool.FindAllPostsForUser(user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Errorf("expected one post, got (%d)", len(all))
+	}
+	count, err := dbpool.FindPostCountForUser(user.ID, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected one post, got (%d)", count)
+	}
+
+	err = dbpool.InsertFeedItems(post.ID, []*db.FeedItem{
+		{PostID: post.ID, GUID: "1", Data: db.FeedItemData{Title: "one"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := dbpool.FindFeedItemsByPostID(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Data.Title != "one" {
+		t.Errorf("unexpected feed items %+v", items)
+	}
+
+	analytics, err := dbpool.FindSiteAnalytics(space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analytics.TotalPosts < 1 || analytics.UsersWithPost < 1 {
+		t.Errorf("unexpected analytics %+v", analytics)
+	}
+
+	err = dbpool.RemovePosts([]string{post.ID, paste.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindPost(post.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the post to be removed, got %v", err)
+	}
+}
+
+func containsPost(posts []*db.Post, postID string) bool {
+	for _, post := range posts {
+		if post.ID == postID {
+			return true
+		}
+	}
+	return false
+}
+
+func testScheduledPosts(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	space := "prose"
+	insert := func(slug string, publishAt time.Time) *db.Post {
+		post, err := dbpool.InsertPost(&db.Post{
+			UserID:    user.ID,
+			Filename:  slug + ".md",
+			Slug:      slug,
+			Text:      "# " + slug,
+			PublishAt: &publishAt,
+			UpdatedAt: &publishAt,
+			Space:     space,
+			Scheduled: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+	due := insert("due", time.Now().Add(-time.Minute))
+	later := insert("later", time.Now().Add(48*time.Hour))
+	if !due.Scheduled || !later.Scheduled {
+		t.Fatalf("expected both posts to be scheduled")
+	}
+
+	listed := func() []string {
+		pager, err := dbpool.FindPostsForUser(&db.Pager{Num: 10, Page: 0}, user.ID, space)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slugs := []string{}
+		for _, post := range pager.Data {
+			slugs = append(slugs, post.Slug)
+		}
+		return slugs
+	}
+	if diff := cmp.Diff([]string{}, listed()); diff != "" {
+		t.Errorf("expected scheduled posts to stay unlisted %s", diff)
+	}
+
+	published := []string{}
+	for i := 0; i < 2; i++ {
+		posts, err := dbpool.PublishScheduledPosts(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range posts {
+			if post.UserID == user.ID {
+				published = append(published, post.Slug)
+			}
+		}
+	}
+	if diff := cmp.Diff([]string{"due"}, published); diff != "" {
+		t.Errorf("expected only the due post to be published once %s", diff)
+	}
+	if diff := cmp.Diff([]string{"due"}, listed()); diff != "" {
+		t.Errorf("expected the published post to be listed %s", diff)
+	}
+}
+
+func testSearchPosts(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	space := "prose"
+	now := time.Now()
+	insert := func(slug, title, text string, hidden bool) *db.Post {
+		post, err := dbpool.InsertPost(&db.Post{
+			UserID:    user.ID,
+			Filename:  slug + ".md",
+			Slug:      slug,
+			Title:     title,
+			Text:      text,
+			PublishAt: &now,
+			UpdatedAt: &now,
+			Space:     space,
+			Hidden:    hidden,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+	insert("body", "notes", "some thoughts about the compiler and its garden", false)
+	insert("title", "compiler garden", "nothing else to say", false)
+	insert("draft", "compiler", "a compiler draft", true)
+	other := insert("other", "cooking", "pasta recipes", false)
+
+	search := func(query string) ([]string, []*db.PostSearchResult) {
+		results, err := dbpool.SearchPostsForUser(user.ID, space, query, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slugs := []string{}
+		for _, result := range results {
+			slugs = append(slugs, result.Slug)
+		}
+		return slugs, results
+	}
+
+	slugs, results := search("compiler garden")
+	if diff := cmp.Diff([]string{"title", "body"}, slugs); diff != "" {
+		t.Fatalf("expected title matches first and no drafts %s", diff)
+	}
+	if !strings.Contains(results[1].Snippet, "**compiler**") {
+		t.Errorf("expected the match highlighted in (%s)", results[1].Snippet)
+	}
+	if slugs, _ := search(`"unbalanced -quote`); len(slugs) != 0 {
+		t.Errorf("expected no matches, got %v", slugs)
+	}
+
+	other.Text = "a garden of pasta"
+	_, err := dbpool.UpdatePost(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slugs, _ := search("pasta"); !cmp.Equal([]string{"other"}, slugs) {
+		t.Errorf("expected the updated post to match, got %v", slugs)
+	}
+	err = dbpool.RemovePosts([]string{other.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slugs, _ := search("pasta"); len(slugs) != 0 {
+		t.Errorf("expected removed posts to be gone, got %v", slugs)
+	}
+}
+
+func testFeatures(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	if dbpool.HasFeatureForUser(user.ID, "pgs") {
+		t.Error("expected no feature yet")
+	}
+	_, err := dbpool.FindFeatureForUser(user.ID, "pgs")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no feature yet, got %v", err)
+	}
+	has, err := dbpool.HasAnyFeatureForUser(user.ID, "pgs", "prose")
+	if err != nil || has {
+		t.Errorf("expected no feature yet, got (%t, %v)", has, err)
+	}
+
+	err = dbpool.AddPicoPlusUser(user.Name, "stripe", "tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dbpool.HasFeatureForUser(user.ID, "pgs") {
+		t.Error("expected pico+ to grant pgs")
+	}
+	ff, err := dbpool.FindFeatureForUser(user.ID, "pgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Data.StorageMax != 10000000000 || ff.PaymentHistoryID != "" || !ff.IsValid() {
+		t.Errorf("unexpected feature flag %+v", ff)
+	}
+	has, err = dbpool.HasAnyFeatureForUser(user.ID, "nope", "tuns")
+	if err != nil || !has {
+		t.Errorf("expected tuns, got (%t, %v)", has, err)
+	}
+
+	_, err = dbpool.FindQuotaForUser(user.ID, unique("service"))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no quota plan, got %v", err)
+	}
+}
+
+func testAdmin(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	_, err := dbpool.InsertProject(user.ID, "blog", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := db.FeatureFlagData{StorageMax: 100, FileMax: 10}
+	err = dbpool.SetFeatureForUser(user.ID, "pgs", data, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.SetFeatureForUser(user.ID, "plus", db.FeatureFlagData{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff, err := dbpool.FindFeatureForUser(user.ID, "pgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Data.StorageMax != 100 || ff.Data.FileMax != 10 {
+		t.Errorf("unexpected feature flag %+v", ff)
+	}
+
+	summaries, err := dbpool.FindUserSummaries(user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].ID != user.ID {
+		t.Fatalf("unexpected summaries %+v", summaries)
+	}
+	if summaries[0].Projects != 1 {
+		t.Errorf("expected 1 project, got %d", summaries[0].Projects)
+	}
+	if diff := cmp.Diff([]string{"pgs", "plus"}, summaries[0].Features); diff != "" {
+		t.Error(diff)
+	}
+
+	// a shorter grant still takes over
+	err = dbpool.SetFeatureForUser(user.ID, "pgs", db.FeatureFlagData{StorageMax: 5}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff, err = dbpool.FindFeatureForUser(user.ID, "pgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Data.StorageMax != 5 {
+		t.Errorf("expected the new grant, got %+v", ff)
+	}
+
+	err = dbpool.RemoveFeatureForUser(user.ID, "pgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbpool.HasFeatureForUser(user.ID, "pgs") {
+		t.Error("expected pgs to be removed")
+	}
+
+	_, err = dbpool.InsertToken(user.ID, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.InsertToken(user.ID, "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := dbpool.RemoveTokensForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 tokens removed, got %d", count)
+	}
+	tokens, err := dbpool.FindTokensForUser(user.ID)
+	if err != nil || len(tokens) != 0 {
+		t.Errorf("expected no tokens, got (%+v, %v)", tokens, err)
+	}
+}
+
+func testProjects(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	_, err := dbpool.InsertProject(user.ID, "Not Valid", "Not Valid")
+	if err == nil {
+		t.Error("expected an invalid project name to be rejected")
+	}
+
+	blogID, err := dbpool.InsertProject(user.ID, "blog", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := dbpool.FindProjectByName(user.ID, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blog.ID != blogID || blog.Acl.Type != "public" || blog.Sitemap || blog.ExpiresAt != nil || blog.UpdatedAt == nil {
+		t.Errorf("unexpected project %+v", blog)
+	}
+
+	acl := db.ProjectAcl{Type: "public_keys", Data: []string{"key"}}
+	err = dbpool.UpdateProjectAcl(user.ID, "blog", acl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csp := db.ProjectCsp{Policy: "default-src 'self'"}
+	err = dbpool.UpdateProjectCsp(user.ID, "blog", csp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.UpdateProjectSitemap(user.ID, "blog", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err = dbpool.FindProjectByName(user.ID, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(acl, blog.Acl); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(csp, blog.Csp); diff != "" {
+		t.Error(diff)
+	}
+	if !blog.Sitemap {
+		t.Error("expected sitemap to be enabled")
+	}
+
+	prodID, err := dbpool.InsertProject(user.ID, "prod", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.LinkToProject(user.ID, prodID, "blog", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stagingID, err := dbpool.InsertProject(user.ID, "staging", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.LinkToProject(user.ID, stagingID, "prod", true)
+	if err == nil {
+		t.Error("expected linking to a link to fail")
+	}
+	links, err := dbpool.FindProjectLinks(user.ID, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].ID != prodID {
+		t.Fatalf("expected prod to link to blog, got %+v", links)
+	}
+
+	prefixed, err := dbpool.FindProjectsByPrefix(user.ID, "bl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefixed) != 1 || prefixed[0].ID != blogID {
+		t.Errorf("expected only blog, got %+v", prefixed)
+	}
+
+	err = dbpool.RenameProject(user.ID, "blog", "staging")
+	if err == nil {
+		t.Error("expected renaming onto an existing project to fail")
+	}
+	err = dbpool.RenameProject(user.ID, "blog", "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := dbpool.FindProjectByName(user.ID, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.ProjectDir != "site" {
+		t.Errorf("expected links to follow the rename, got (%s)", prod.ProjectDir)
+	}
+
+	projects, err := dbpool.FindProjectsByUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+	if diff := cmp.Diff([]string{"prod", "site", "staging"}, names); diff != "" {
+		t.Error(diff)
+	}
+	stale, err := dbpool.FindStaleProjects(user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 3 {
+		t.Errorf("expected every project to be stale, got (%d)", len(stale))
+	}
+	stale, err = dbpool.FindStaleProjects(user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("expected no stale projects, got (%d)", len(stale))
+	}
+
+	testObjectCounts(t, dbpool, user)
+
+	err = dbpool.UpdateProject(user.ID, "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.UpsertHeaders(blogID, []*headers.HeaderRule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.UpsertHeaders(blogID, []*headers.HeaderRule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.UpsertRedirects(blogID, []*redirects.RedirectRule{{From: "/old", To: "/new", Status: 301}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.UpsertRedirects(blogID, []*redirects.RedirectRule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(-time.Minute)
+	for _, projectID := range []string{blogID, stagingID} {
+		err = dbpool.SetProjectExpiry(projectID, &expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	claimed, err := dbpool.ClaimExpiredProjects(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsProject(claimed, stagingID) {
+		t.Error("expected the expired project to be claimed")
+	}
+	if containsProject(claimed, blogID) {
+		t.Error("expected a project with links not to be claimed")
+	}
+	claimed, err = dbpool.ClaimExpiredProjects(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsProject(claimed, stagingID) {
+		t.Error("expected a claimed project not to be claimed again")
+	}
+
+	all, err := dbpool.FindAllProjects(&db.Pager{Num: 1000, Page: 0}, "projects.updated_at")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsProject(all.Data, prodID) {
+		t.Error("expected prod in every project")
+	}
+
+	err = dbpool.RemoveProject(stagingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindProjectByName(user.ID, "staging")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the project to be removed, got %v", err)
+	}
+}
+
+func testProjectEnv(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	projectID, err := dbpool.InsertProject(user.ID, "site", "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kv := range [][2]string{{"TOKEN", "one"}, {"API_URL", "https://api"}, {"TOKEN", "two"}} {
+		err := dbpool.SetProjectEnv(projectID, kv[0], kv[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env, err := dbpool.FindProjectEnv(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, variable := range env {
+		got = append(got, variable.Key+"="+variable.Value)
+	}
+	if diff := cmp.Diff([]string{"API_URL=https://api", "TOKEN=two"}, got); diff != "" {
+		t.Errorf("expected the variables sorted by key with the latest value %s", diff)
+	}
+
+	err = dbpool.RemoveProjectEnv(projectID, "TOKEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.RemoveProjectEnv(projectID, "TOKEN")
+	if err == nil {
+		t.Error("expected removing a missing variable to fail")
+	}
+	env, err = dbpool.FindProjectEnv(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 1 || env[0].Key != "API_URL" {
+		t.Errorf("expected only API_URL to be left, found %+v", env)
+	}
+}
+
+func testSigningKeys(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	projectID, err := dbpool.InsertProject(user.ID, "site", "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := dbpool.FindProjectSigningKey(projectID)
+	if err != nil || key != nil {
+		t.Fatalf("expected no signing key, got %+v (%v)", key, err)
+	}
+	for _, text := range []string{"RWQone", "RWQtwo"} {
+		err := dbpool.SetProjectSigningKey(projectID, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, err = dbpool.FindProjectSigningKey(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil || key.Key != "RWQtwo" || key.CreatedAt == nil {
+		t.Fatalf("expected the latest key, got %+v", key)
+	}
+
+	err = dbpool.RemoveProjectSigningKey(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.RemoveProjectSigningKey(projectID)
+	if err == nil {
+		t.Error("expected removing a missing key to fail")
+	}
+	key, _ = dbpool.FindProjectSigningKey(projectID)
+	if key != nil {
+		t.Errorf("expected the key to be removed, found %+v", key)
+	}
+}
+
+func testDigestSubscriptions(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	sub, err := dbpool.UpsertDigestSubscription(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Token == "" || sub.IsUnsubscribed() {
+		t.Fatalf("expected a new subscription, got %+v", sub)
+	}
+	again, err := dbpool.UpsertDigestSubscription(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Token != sub.Token {
+		t.Errorf("expected the token to stay (%s), got (%s)", sub.Token, again.Token)
+	}
+
+	stopped, err := dbpool.UnsubscribeDigests(sub.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped.UserID != user.ID || !stopped.IsUnsubscribed() {
+		t.Fatalf("expected the user to be unsubscribed, got %+v", stopped)
+	}
+	_, err = dbpool.UnsubscribeDigests("00000000-0000-0000-0000-000000000000")
+	if err == nil {
+		t.Error("expected an unknown token to fail")
+	}
+
+	err = dbpool.ResubscribeDigests(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, _ = dbpool.UpsertDigestSubscription(user.ID)
+	if sub.IsUnsubscribed() {
+		t.Errorf("expected the user to be subscribed again, got %+v", sub)
+	}
+}
+
+func testPostEmailSenders(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	for _, email := range []string{"me@example.com", "alt@example.com", "me@example.com"} {
+		err := dbpool.AddPostEmailSender(user.ID, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	senders, err := dbpool.FindPostEmailSenders(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(senders) != 2 || senders[0].Email != "alt@example.com" || senders[1].Email != "me@example.com" {
+		t.Fatalf("expected both senders once, got %+v", senders)
+	}
+
+	err = dbpool.RemovePostEmailSender(user.ID, "alt@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.RemovePostEmailSender(user.ID, "alt@example.com")
+	if err == nil {
+		t.Error("expected removing a missing sender to fail")
+	}
+	senders, _ = dbpool.FindPostEmailSenders(user.ID)
+	if len(senders) != 1 {
+		t.Errorf("expected one sender left, got %+v", senders)
+	}
+}
+
+// testObjectCounts expects site to hold its own files and prod to link to it.
+func testObjectCounts(t *testing.T, dbpool db.DB, user *db.User) {
+	count, err := dbpool.FindProjectObjectCount(user.ID, "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != nil {
+		t.Errorf("expected a new project not to be counted, got (%d)", *count)
+	}
+	err = dbpool.AdjustProjectObjectCount(user.ID, "site", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, _ = dbpool.FindProjectObjectCount(user.ID, "site")
+	if count != nil {
+		t.Error("expected an uncounted project to stay uncounted")
+	}
+
+	three := 3
+	err = dbpool.SetProjectObjectCount(user.ID, "site", &three)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delta := range []int{-5, 2} {
+		err = dbpool.AdjustProjectObjectCount(user.ID, "site", delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts, err := dbpool.FindObjectCountsForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := counts["prod"]; ok {
+		t.Error("expected links to be left out")
+	}
+	if counts["site"] == nil || *counts["site"] != 2 {
+		t.Errorf("expected site to never drop below zero, got %v", counts["site"])
+	}
+
+	err = dbpool.SetProjectObjectCount(user.ID, "site", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, _ = dbpool.FindProjectObjectCount(user.ID, "site")
+	if count != nil {
+		t.Error("expected the count to be forgotten")
+	}
+}
+
+func containsProject(projects []*db.Project, projectID string) bool {
+	for _, project := range projects {
+		if project.ID == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+func testDomains(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	projectID, err := dbpool.InsertProject(user.ID, "blog", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domain := unique("d") + ".example.com"
+	token, err := dbpool.InsertProjectDomain(projectID, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == "" {
+		t.Error("expected a verification token")
+	}
+	_, err = dbpool.InsertProjectDomain(projectID, domain)
+	if err == nil {
+		t.Error("expected a domain to only be added once")
+	}
+	_, err = dbpool.FindSubdomainForDomain(domain)
+	if err == nil {
+		t.Error("expected an unverified domain not to resolve")
+	}
+
+	domains, err := dbpool.FindProjectDomains(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) != 1 || domains[0].ProjectName != "blog" || domains[0].IsVerified() {
+		t.Fatalf("unexpected domains %+v", domains)
+	}
+	unverified, err := dbpool.FindUnverifiedDomains(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unverified) == 0 {
+		t.Error("expected an unverified domain")
+	}
+
+	err = dbpool.VerifyProjectDomain(domains[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subdomain, err := dbpool.FindSubdomainForDomain(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subdomain != user.Name+"-blog" {
+		t.Errorf("expected (%s-blog), got (%s)", user.Name, subdomain)
+	}
+
+	recheck := func(verifiedBefore time.Time) bool {
+		found, err := dbpool.FindDomainsToRecheck(verifiedBefore, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slices.ContainsFunc(found, func(d *db.ProjectDomain) bool { return d.Domain == domain })
+	}
+	if recheck(time.Now().Add(-time.Hour)) {
+		t.Error("expected a freshly verified domain not to be rechecked")
+	}
+	if !recheck(time.Now().Add(time.Hour)) {
+		t.Error("expected a verified domain to be rechecked once it is due")
+	}
+	err = dbpool.UnverifyProjectDomain(domains[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindSubdomainForDomain(domain)
+	if err == nil {
+		t.Error("expected an unverified domain to stop resolving")
+	}
+	if recheck(time.Now().Add(time.Hour)) {
+		t.Error("expected an unverified domain to wait for the pending sweep")
+	}
+	err = dbpool.VerifyProjectDomain(domains[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := register(t, dbpool)
+	err = dbpool.RemoveProjectDomain(other.ID, domain)
+	if err == nil {
+		t.Error("expected domains of other users to be left alone")
+	}
+	err = dbpool.RemoveProjectDomain(user.ID, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.RemoveProjectDomain(user.ID, domain)
+	if err == nil {
+		t.Error("expected a removed domain to be gone")
+	}
+}
+
+func testDomainCerts(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	projectID, err := dbpool.InsertProject(user.ID, "blog", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	domain := unique("c") + ".example.com"
+	_, err = dbpool.InsertProjectDomain(projectID, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasDomain := func(renewBefore time.Time) bool {
+		domains, err := dbpool.FindDomainsForCerts(renewBefore, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range domains {
+			if d.Domain == domain {
+				return true
+			}
+		}
+		return false
+	}
+	if hasDomain(time.Now()) {
+		t.Error("expected an unverified domain not to get a certificate")
+	}
+
+	domains, err := dbpool.FindProjectDomains(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.VerifyProjectDomain(domains[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasDomain(time.Now()) {
+		t.Error("expected a verified domain without a certificate to need one")
+	}
+
+	_, err = dbpool.FindDomainCert(domain)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no certificate, got %v", err)
+	}
+	expires := time.Now().Add(90 * 24 * time.Hour)
+	for _, certPEM := range []string{"first", "second"} {
+		err = dbpool.UpsertDomainCert(&db.DomainCert{Domain: domain, CertPEM: certPEM, KeyPEM: "key", ExpiresAt: &expires})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := dbpool.FindDomainCert(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.CertPEM != "second" || cert.KeyPEM != "key" || cert.ExpiresAt == nil {
+		t.Errorf("expected the latest certificate, got %+v", cert)
+	}
+	if hasDomain(time.Now().Add(30 * 24 * time.Hour)) {
+		t.Error("expected a fresh certificate not to be renewed")
+	}
+	if !hasDomain(time.Now().Add(100 * 24 * time.Hour)) {
+		t.Error("expected an expiring certificate to be renewed")
+	}
+
+	err = dbpool.RemoveProjectDomain(user.ID, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindDomainCert(domain)
+	if err == nil {
+		t.Error("expected the certificate to go with its domain")
+	}
+}
+
+func testProjectAccess(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	projectID, err := dbpool.InsertProject(user.ID, "private", "private")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dbpool.SetProjectAccess(projectID, []*db.ProjectAccess{
+		{Kind: db.AccessPassword, Value: "hash"},
+		{Kind: db.AccessUser, Value: "friend"},
+		{Kind: db.AccessUser, Value: "friend"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := dbpool.FindProjectAccess(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Kind != db.AccessPassword || entries[1].Value != "friend" || entries[0].CreatedAt == nil {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	err = dbpool.SetProjectAccess(projectID, []*db.ProjectAccess{{Kind: db.AccessUser, Value: "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = dbpool.FindProjectAccess(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Value != "other" {
+		t.Fatalf("expected the entries to be replaced, found %+v", entries)
+	}
+
+	err = dbpool.RemoveProject(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = dbpool.FindProjectAccess(projectID)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected removing the project to drop its entries, found %+v (%v)", entries, err)
+	}
+}
+
+func testOrgs(t *testing.T, dbpool db.DB) {
+	owner := register(t, dbpool)
+	friend := register(t, dbpool)
+	name := unique("org")
+
+	org, err := dbpool.CreateOrg(owner.ID, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.Name != strings.ToLower(name) {
+		t.Fatalf("unexpected org %+v", org)
+	}
+	_, err = dbpool.CreateOrg(owner.ID, name)
+	if err == nil {
+		t.Error("expected a taken name to fail")
+	}
+	_, err = dbpool.FindOrgForName(owner.Name)
+	if err == nil {
+		t.Error("expected a regular user not to be an org")
+	}
+
+	member, err := dbpool.FindOrgMember(org.ID, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.Role != db.RoleOwner || member.Name != owner.Name || !member.CanDeploy() {
+		t.Errorf("unexpected owner %+v", member)
+	}
+	_, err = dbpool.FindOrgMember(org.ID, friend.ID)
+	if !errors.Is(err, db.ErrNotOrgMember) {
+		t.Errorf("expected ErrNotOrgMember, found %v", err)
+	}
+
+	for _, role := range []string{db.RoleDeployer, db.RoleViewer} {
+		err = dbpool.SetOrgMember(org.ID, friend.ID, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	members, err := dbpool.FindOrgMembers(org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("expected setting a role twice to keep one membership, found %+v", members)
+	}
+	member, err = dbpool.FindOrgMember(org.ID, friend.ID)
+	if err != nil || member.Role != db.RoleViewer || member.CanDeploy() {
+		t.Fatalf("expected the latest role, found %+v (%v)", member, err)
+	}
+
+	err = dbpool.RemoveOrgMember(org.ID, friend.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindOrgMember(org.ID, friend.ID)
+	if !errors.Is(err, db.ErrNotOrgMember) {
+		t.Errorf("expected the member to be removed, found %v", err)
+	}
+}
+
+func testAuditLog(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	since := time.Now().Add(-time.Minute)
+	for _, path := range []string{"/blog/index.html", "/blog/style.css"} {
+		err := dbpool.InsertAuditEntry(&db.AuditEntry{
+			UserID:     user.ID,
+			ActorID:    user.ID,
+			Actor:      user.Name,
+			Space:      "pgs",
+			Action:     "write",
+			SessionID:  "abc",
+			Path:       path,
+			RemoteAddr: "2001:db8::1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := dbpool.FindAuditLog(user.ID, since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/blog/style.css" || entries[0].SessionID != "abc" || entries[0].RemoteAddr != "2001:db8::1" || entries[0].CreatedAt == nil {
+		t.Fatalf("expected the newest entry first, found %+v", entries)
+	}
+	entries, err = dbpool.FindAuditLog(user.ID, since, 1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected the limit to apply, found %+v (%v)", entries, err)
+	}
+	entries, err = dbpool.FindAuditLog(user.ID, time.Now().Add(time.Hour), 10)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected nothing from the future, found %+v (%v)", entries, err)
+	}
+}
+
+func testTrash(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for _, obj := range []*db.TrashObject{
+		{UserID: user.ID, Path: "/blog/old.html", TrashPath: ".trash/1/blog/old.html", Size: 10, ExpiresAt: &past},
+		{UserID: user.ID, Path: "/blog/new.html", TrashPath: ".trash/2/blog/new.html", Size: 20, ExpiresAt: &future},
+	} {
+		err := dbpool.InsertTrashObject(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objs, err := dbpool.FindTrashObjects(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 || objs[0].Path != "/blog/new.html" || objs[0].Size != 20 || objs[0].ExpiresAt == nil {
+		t.Fatalf("expected the newest object first, found %+v", objs)
+	}
+
+	claimed, err := dbpool.ClaimExpiredTrash(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, obj := range claimed {
+		if obj.UserID == user.ID {
+			found = append(found, obj.TrashPath)
+		}
+	}
+	if len(found) != 1 || found[0] != ".trash/1/blog/old.html" {
+		t.Fatalf("expected only the expired object to be claimed, found %v", found)
+	}
+	claimed, err = dbpool.ClaimExpiredTrash(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range claimed {
+		if obj.UserID == user.ID {
+			t.Fatalf("expected a claimed object not to be claimed again, found %+v", obj)
+		}
+	}
+
+	for _, obj := range objs {
+		err = dbpool.RemoveTrashObject(obj.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	objs, err = dbpool.FindTrashObjects(user.ID)
+	if err != nil || len(objs) != 0 {
+		t.Fatalf("expected the trash to be empty, found %+v (%v)", objs, err)
+	}
+}
+
+func testDeploys(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	projectID, err := dbpool.InsertProject(user.ID, "blog", "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, revision := range []int{1, 2} {
+		err := dbpool.InsertProjectDeploy(projectID, revision, revision*10, int64(revision*100))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	current, err := dbpool.FindCurrentDeploy(user.ID, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Revision != 2 || current.FileCount != 20 || current.Size != 200 || !current.Current {
+		t.Errorf("unexpected deploy %+v", current)
+	}
+
+	err = dbpool.SetCurrentDeploy(projectID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.SetCurrentDeploy(projectID, 9)
+	if err == nil {
+		t.Error("expected a missing revision to fail")
+	}
+	deploys, err := dbpool.FindProjectDeploys(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deploys) != 2 || deploys[0].Revision != 2 || deploys[0].Current || !deploys[1].Current {
+		t.Fatalf("expected revision 1 to be current, got %+v %+v", deploys[0], deploys[1])
+	}
+
+	err = dbpool.ClearCurrentDeploy(user.ID, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindCurrentDeploy(user.ID, "blog")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no current deploy, got %v", err)
+	}
+
+	err = dbpool.RemoveProjectDeploy(deploys[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploys, err = dbpool.FindProjectDeploys(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deploys) != 1 {
+		t.Errorf("expected one deploy, got (%d)", len(deploys))
+	}
+}
+
+func testWebhooks(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	id, err := dbpool.InsertWebhook(user.ID, "https://example.com/hook", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.InsertWebhook(user.ID, "https://example.com/hook", "secret")
+	if err == nil {
+		t.Error("expected a url to only be added once")
+	}
+
+	webhooks, err := dbpool.FindWebhooksForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 1 || webhooks[0].ID != id || webhooks[0].Secret != "secret" {
+		t.Fatalf("unexpected webhooks %+v", webhooks)
+	}
+
+	other := register(t, dbpool)
+	err = dbpool.RemoveWebhook(other.ID, id)
+	if err == nil {
+		t.Error("expected webhooks of other users to be left alone")
+	}
+	err = dbpool.RemoveWebhook(user.ID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testProjectEvents(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	for _, event := range []*db.ProjectEvent{
+		{UserID: user.ID, ProjectName: "blog", Event: "project.create", FileCount: 1},
+		{UserID: user.ID, ProjectName: "blog", Event: "project.update", FileCount: 3},
+		{UserID: user.ID, ProjectName: "docs", Event: "project.delete"},
+	} {
+		err := dbpool.InsertProjectEvent(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := dbpool.FindProjectEventsForUser(user.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, event := range events {
+		got = append(got, fmt.Sprintf("%s %s %d", event.ProjectName, event.Event, event.FileCount))
+	}
+	if diff := cmp.Diff([]string{"docs project.delete 0", "blog project.update 3"}, got); diff != "" {
+		t.Errorf("expected the newest events first %s", diff)
+	}
+
+	other := register(t, dbpool)
+	events, err = dbpool.FindProjectEventsForUser(other.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events for another user, got %d", len(events))
+	}
+}
+
+func testAnalytics(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	yesterday := today.AddDate(0, 0, -1)
+	for _, day := range []*db.AnalyticsDay{
+		{UserID: user.ID, Space: "pgs", Name: "blog", Day: yesterday, Hits: 5, Uniques: 2},
+		{UserID: user.ID, Space: "pgs", Name: "blog", Day: today, Hits: 3, Uniques: 1},
+		{UserID: user.ID, Space: "pgs", Name: "blog", Day: today, Hits: 2, Uniques: 2},
+		{UserID: user.ID, Space: "pgs", Name: "docs", Day: today, Hits: 1, Uniques: 1},
+		{UserID: user.ID, Space: "prose", Name: "blog", Day: today, Hits: 9, Uniques: 9},
+	} {
+		err := dbpool.AddAnalytics(day)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(name string, since time.Time) []string {
+		days, err := dbpool.FindAnalytics(user.ID, "pgs", name, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, day := range days {
+			got = append(got, fmt.Sprintf("%s %s %d %d", day.Name, day.Day.Format(time.DateOnly), day.Hits, day.Uniques))
+		}
+		return got
+	}
+	expected := []string{
+		fmt.Sprintf("blog %s 5 2", yesterday.Format(time.DateOnly)),
+		fmt.Sprintf("blog %s 5 3", today.Format(time.DateOnly)),
+	}
+	if diff := cmp.Diff(expected, find("blog", yesterday)); diff != "" {
+		t.Errorf("expected counts to add up per day %s", diff)
+	}
+	expected = []string{
+		fmt.Sprintf("blog %s 5 3", today.Format(time.DateOnly)),
+		fmt.Sprintf("docs %s 1 1", today.Format(time.DateOnly)),
+	}
+	if diff := cmp.Diff(expected, find("", today)); diff != "" {
+		t.Errorf("expected every project since today %s", diff)
+	}
+}
+
+func testBandwidth(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := month.AddDate(0, -1, 0)
+	for _, cur := range []*db.BandwidthMonth{
+		{UserID: user.ID, Space: "pgs", Name: "blog", Month: month, Bytes: 100},
+		{UserID: user.ID, Space: "pgs", Name: "blog", Month: month, Bytes: 50},
+		{UserID: user.ID, Space: "pgs", Name: "docs", Month: month, Bytes: 500},
+		{UserID: user.ID, Space: "pgs", Name: "blog", Month: last, Bytes: 7},
+		{UserID: user.ID, Space: "prose", Name: "blog", Month: month, Bytes: 9},
+	} {
+		err := dbpool.AddBandwidth(cur)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	months, err := dbpool.FindBandwidth(user.ID, "pgs", month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, cur := range months {
+		got = append(got, fmt.Sprintf("%s %s %d", cur.Name, cur.Month.Format(time.DateOnly), cur.Bytes))
+	}
+	expected := []string{
+		fmt.Sprintf("docs %s 500", month.Format(time.DateOnly)),
+		fmt.Sprintf("blog %s 150", month.Format(time.DateOnly)),
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("expected bytes to add up per month %s", diff)
+	}
+}
+
+func testManifests(t *testing.T, dbpool db.DB) {
+	bucket := unique("bucket")
+	for _, manifest := range []*db.ObjectManifest{
+		{Bucket: bucket, Path: "blog/index.html", Checksum: "a", Size: 1, Meta: []byte(`{}`)},
+		{Bucket: bucket, Path: "blog/about.html", Checksum: "a", Size: 1, Meta: []byte(`{}`)},
+		{Bucket: bucket, Path: "docs/index.html", Checksum: "b", Size: 2, Meta: []byte(`{}`)},
+	} {
+		err := dbpool.UpsertObjectManifest(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := dbpool.CountObjectManifestRefs(bucket, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected (2) refs, got (%d)", count)
+	}
+
+	err = dbpool.UpsertObjectManifest(&db.ObjectManifest{
+		Bucket: bucket, Path: "blog/about.html", Checksum: "c", Size: 3, Meta: []byte(`{"a":1}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := dbpool.FindObjectManifest(bucket, "blog/about.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Checksum != "c" || manifest.Size != 3 || string(manifest.Meta) != `{"a":1}` {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	manifests, err := dbpool.FindObjectManifests(bucket, "blog/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, manifest := range manifests {
+		paths = append(paths, manifest.Path)
+	}
+	if diff := cmp.Diff([]string{"blog/about.html", "blog/index.html"}, paths); diff != "" {
+		t.Error(diff)
+	}
+
+	err = dbpool.RemoveObjectManifest(bucket, "blog/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.FindObjectManifest(bucket, "blog/index.html")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the manifest to be removed, got %v", err)
+	}
+}
+
+func findUsage(t *testing.T, dbpool db.DB, userID string) *db.StorageUsage {
+	usages, err := dbpool.FindStorageUsages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, usage := range usages {
+		if usage.UserID == userID {
+			return usage
+		}
+	}
+	t.Fatalf("no usage found for (%s)", userID)
+	return nil
+}
+
+func testStorageUsage(t *testing.T, dbpool db.DB) {
+	user := register(t, dbpool)
+	expires := time.Now().Add(time.Hour)
+
+	err := dbpool.SeedStorageUsage(user.ID, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the first seed counts
+	err = dbpool.SeedStorageUsage(user.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := dbpool.ReserveStorage(user.ID, "blog", 30, 100, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.ReserveStorage(user.ID, "blog", 30, 100, expires)
+	if !errors.Is(err, db.ErrQuotaExceeded) {
+		t.Fatalf("expected held space to count against the quota, got %v", err)
+	}
+	if usage := findUsage(t, dbpool, user.ID); usage.Used != 50 || usage.Held != 30 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	set, err := dbpool.SetStorageUsage(user.ID, 10)
+	if err != nil || set {
+		t.Fatalf("expected no reconcile while space is held, got %v (%v)", set, err)
+	}
+
+	err = dbpool.CommitStorage(user.ID, first, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := dbpool.ReserveStorage(user.ID, "blog", 30, 100, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.ReleaseStorage(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbpool.AddStorageUsage(user.ID, -100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage := findUsage(t, dbpool, user.ID); usage.Used != 0 || usage.Held != 0 {
+		t.Fatalf("expected usage to settle at zero, got %+v", usage)
+	}
+
+	set, err = dbpool.SetStorageUsage(user.ID, 42)
+	if err != nil || !set {
+		t.Fatalf("expected reconcile to apply, got %v (%v)", set, err)
+	}
+	if usage := findUsage(t, dbpool, user.ID); usage.Used != 42 || usage.ReconciledAt == nil {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	_, err = dbpool.ReserveStorage(user.ID, "blog", 10, 100, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := dbpool.RemoveExpiredStorageHolds()
+	if err != nil || removed < 1 {
+		t.Fatalf("expected lapsed holds to be removed, got %d (%v)", removed, err)
+	}
+
+	_, err = dbpool.ReserveProjectStorage(user.ID, "old", 50, 100, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbpool.ReserveProjectStorage(user.ID, "docs", 50, 100, expires)
+	if err != nil {
+		t.Fatalf("expected a lapsed reservation not to count, got %v", err)
+	}
+	_, err = dbpool.ReserveProjectStorage(user.ID, "docs", 50, 100, expires)
+	if err != nil {
+		t.Fatalf("expected a reservation to replace the one of its project, got %v", err)
+	}
+	_, err = dbpool.ReserveStorage(user.ID, "blog", 10, 100, expires)
+	if !errors.Is(err, db.ErrQuotaExceeded) {
+		t.Fatalf("expected a reservation to count against other projects, got %v", err)
+	}
+	third, err := dbpool.ReserveStorage(user.ID, "docs", 10, 100, expires)
+	if err != nil {
+		t.Fatalf("expected an upload to draw on the reservation of its project, got %v", err)
+	}
+	err = dbpool.ReleaseStorage(third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err = dbpool.SetStorageUsage(user.ID, 42)
+	if err != nil || !set {
+		t.Fatalf("expected reservations not to hold up a reconcile, got %v (%v)", set, err)
+	}
+}
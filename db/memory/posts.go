@@ -0,0 +1,748 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/picosh/pico/db"
+)
+
+func (me *MemoryDB) copyPost(p *post, withTags bool) *db.Post {
+	cp := p.Post
+	cp.Username = ""
+	if user := me.findUser(p.UserID); user != nil {
+		cp.Username = user.Name
+	}
+	cp.Tags = nil
+	if withTags && len(p.tags) > 0 {
+		cp.Tags = slices.Clone(p.tags)
+	}
+	return &cp
+}
+
+func (me *MemoryDB) findPost(postID string) *post {
+	for _, p := range me.posts {
+		if p.ID == postID {
+			return p
+		}
+	}
+	return nil
+}
+
+// findPosts copies the posts matching match, sorted by less when it is set.
+func (me *MemoryDB) findPosts(match func(*post) bool, less func(a, b *post) bool, withTags bool) []*db.Post {
+	found := []*post{}
+	for _, p := range me.posts {
+		if match(p) {
+			found = append(found, p)
+		}
+	}
+	if less != nil {
+		sort.SliceStable(found, func(i, j int) bool { return less(found[i], found[j]) })
+	}
+	posts := []*db.Post{}
+	for _, p := range found {
+		posts = append(posts, me.copyPost(p, withTags))
+	}
+	return posts
+}
+
+// isPublished is true for posts that made it into listings.
+func isPublished(p *post) bool {
+	if p.PublishAt == nil || p.Scheduled {
+		return false
+	}
+	return !date(*p.PublishAt).After(date(time.Now()))
+}
+
+func isListed(p *post) bool {
+	return !p.Hidden && isPublished(p)
+}
+
+func publishedLater(a, b *post) bool {
+	return a.PublishAt.After(*b.PublishAt)
+}
+
+func updatedLater(a, b *post) bool {
+	if a.UpdatedAt == nil || b.UpdatedAt == nil {
+		return a.UpdatedAt != nil
+	}
+	return a.UpdatedAt.After(*b.UpdatedAt)
+}
+
+func (me *MemoryDB) postCount(space, tag string) int {
+	count := 0
+	for _, p := range me.posts {
+		if p.Hidden || p.Space != space {
+			continue
+		}
+		if tag != "" && !slices.Contains(p.tags, tag) {
+			continue
+		}
+		count += 1
+	}
+	return count
+}
+
+func (me *MemoryDB) FindPostsBeforeDate(d *time.Time, space string) ([]*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findPosts(func(p *post) bool {
+		return p.Space == space && p.PublishAt != nil && !date(*p.PublishAt).After(date(*d))
+	}, nil, false), nil
+}
+
+func (me *MemoryDB) FindPostWithFilename(filename string, userID string, space string) (*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, p := range me.posts {
+		if p.Filename == filename && p.UserID == userID && p.Space == space {
+			return me.copyPost(p, true), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (me *MemoryDB) FindPostWithSlug(slug string, userID string, space string) (*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, p := range me.posts {
+		if p.Slug == slug && p.UserID == userID && p.Space == space {
+			return me.copyPost(p, true), nil
+		}
+	}
+	// attempt to find post inside post_aliases
+	for _, p := range me.posts {
+		if p.UserID == userID && p.Space == space && slices.Contains(p.aliases, slug) {
+			return me.copyPost(p, false), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (me *MemoryDB) FindPost(postID string) (*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findPost(postID)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	return me.copyPost(p, false), nil
+}
+
+func (me *MemoryDB) FindAllPosts(page *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	score := func(p *post) float64 {
+		views := math.Max(float64(p.Views), 1)
+		age := time.Since(*p.PublishAt).Seconds() / (14 * 8600)
+		return math.Log2(views) / age
+	}
+	posts := me.findPosts(func(p *post) bool {
+		return isListed(p) && p.Space == space
+	}, func(a, b *post) bool {
+		return score(a) > score(b)
+	}, false)
+	for _, p := range posts {
+		p.Score = fmt.Sprint(math.Log2(math.Max(float64(p.Views), 1)) / (time.Since(*p.PublishAt).Seconds() / (14 * 8600)))
+	}
+	return pager(posts, page, me.postCount(space, "")), nil
+}
+
+func (me *MemoryDB) FindAllUpdatedPosts(page *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	posts := me.findPosts(func(p *post) bool {
+		return isListed(p) && p.Space == space
+	}, updatedLater, false)
+	for _, p := range posts {
+		p.Score = "0"
+	}
+	return pager(posts, page, me.postCount(space, "")), nil
+}
+
+func (me *MemoryDB) InsertPost(np *db.Post) (*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, p := range me.posts {
+		if p.UserID != np.UserID || p.Space != np.Space {
+			continue
+		}
+		if p.Filename == np.Filename {
+			return nil, fmt.Errorf("post with filename (%s) already exists", np.Filename)
+		}
+		if p.Slug == np.Slug {
+			return nil, fmt.Errorf("post with slug (%s) already exists", np.Slug)
+		}
+	}
+	p := &post{Post: *np}
+	p.ID = newID()
+	p.CreatedAt = now()
+	p.Views = 0
+	p.Tags = nil
+	me.posts = append(me.posts, p)
+	return me.copyPost(p, false), nil
+}
+
+func (me *MemoryDB) UpdatePost(np *db.Post) (*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findPost(np.ID)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	p.Slug = np.Slug
+	p.Title = np.Title
+	p.Text = np.Text
+	p.Description = np.Description
+	p.UpdatedAt = np.UpdatedAt
+	p.PublishAt = np.PublishAt
+	p.FileSize = np.FileSize
+	p.Shasum = np.Shasum
+	p.Data = np.Data
+	p.Hidden = np.Hidden
+	p.ExpiresAt = np.ExpiresAt
+	p.Scheduled = np.Scheduled
+	return me.copyPost(p, false), nil
+}
+
+func (me *MemoryDB) removePosts(postIDs []string) {
+	me.posts = slices.DeleteFunc(me.posts, func(p *post) bool { return slices.Contains(postIDs, p.ID) })
+	me.feedItems = slices.DeleteFunc(me.feedItems, func(item *db.FeedItem) bool {
+		return slices.Contains(postIDs, item.PostID)
+	})
+}
+
+func (me *MemoryDB) RemovePosts(postIDs []string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.removePosts(postIDs)
+	return nil
+}
+
+func (me *MemoryDB) FindPostsForUser(page *db.Pager, userID string, space string) (*db.Paginate[*db.Post], error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	posts := me.findPosts(func(p *post) bool {
+		return isListed(p) && p.UserID == userID && p.Space == space
+	}, func(a, b *post) bool {
+		if a.PublishAt.Equal(*b.PublishAt) {
+			return a.Slug > b.Slug
+		}
+		return publishedLater(a, b)
+	}, true)
+	return pager(posts, page, me.postCount(space, "")), nil
+}
+
+func (me *MemoryDB) FindAllPostsForUser(userID string, space string) ([]*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findPosts(func(p *post) bool {
+		return p.UserID == userID && p.Space == space
+	}, func(a, b *post) bool {
+		if a.PublishAt == nil || b.PublishAt == nil {
+			return a.PublishAt != nil
+		}
+		return publishedLater(a, b)
+	}, false), nil
+}
+
+func (me *MemoryDB) FindPostCountForUser(userID string, space string) (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := 0
+	for _, p := range me.posts {
+		if p.UserID == userID && p.Space == space {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+func (me *MemoryDB) FindPosts() ([]*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findPosts(func(p *post) bool { return true }, nil, false), nil
+}
+
+func (me *MemoryDB) FindExpiredPosts(space string) ([]*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	return me.findPosts(func(p *post) bool {
+		return p.Space == space && p.ExpiresAt != nil && !p.ExpiresAt.After(t)
+	}, nil, false), nil
+}
+
+func (me *MemoryDB) FindUpdatedPostsForUser(userID string, space string) ([]*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findPosts(func(p *post) bool {
+		return isPublished(p) && p.UserID == userID && p.Space == space
+	}, updatedLater, false), nil
+}
+
+func (me *MemoryDB) Close() error {
+	me.Logger.Info("Closing db")
+	return nil
+}
+
+func (me *MemoryDB) AddViewCount(postID string) (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findPost(postID)
+	if p == nil {
+		return 0, sql.ErrNoRows
+	}
+	p.Views += 1
+	return p.Views, nil
+}
+
+// PublishScheduledPosts takes up to limit scheduled posts whose publish_at
+// has passed live, every post is only ever returned to one caller.
+func (me *MemoryDB) PublishScheduledPosts(limit int) ([]*db.Post, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	due := []*post{}
+	for _, p := range me.posts {
+		if p.Scheduled && p.PublishAt != nil && !p.PublishAt.After(t) {
+			due = append(due, p)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].PublishAt.Before(*due[j].PublishAt) })
+	posts := []*db.Post{}
+	for _, p := range due[:min(limit, len(due))] {
+		p.Scheduled = false
+		posts = append(posts, me.copyPost(p, false))
+	}
+	return posts, nil
+}
+
+type span struct {
+	start int
+	end   int
+}
+
+// words splits text into the spans of its words the way the full text
+// search tokenizer does.
+func words(text string) []span {
+	spans := []span{}
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+	return spans
+}
+
+func countTerm(text, term string) int {
+	count := 0
+	for _, w := range words(text) {
+		if strings.EqualFold(text[w.start:w.end], term) {
+			count += 1
+		}
+	}
+	return count
+}
+
+// snippet is the excerpt of text around the first term, terms are wrapped
+// in `**`.
+func snippet(text string, terms []string) string {
+	spans := words(text)
+	if len(spans) == 0 {
+		return ""
+	}
+	isTerm := func(w span) bool {
+		return slices.ContainsFunc(terms, func(term string) bool {
+			return strings.EqualFold(text[w.start:w.end], term)
+		})
+	}
+	first := max(slices.IndexFunc(spans, isTerm), 0)
+	start := max(min(first, len(spans)-24), 0)
+	end := min(start+24, len(spans))
+
+	var out strings.Builder
+	if start > 0 {
+		out.WriteString("...")
+	}
+	pos := spans[start].start
+	for _, w := range spans[start:end] {
+		out.WriteString(text[pos:w.start])
+		if isTerm(w) {
+			out.WriteString("**" + text[w.start:w.end] + "**")
+		} else {
+			out.WriteString(text[w.start:w.end])
+		}
+		pos = w.end
+	}
+	if end < len(spans) {
+		out.WriteString("...")
+	}
+	return out.String()
+}
+
+func (me *MemoryDB) SearchPostsForUser(userID, space, query string, limit int) ([]*db.PostSearchResult, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	results := []*db.PostSearchResult{}
+	terms := []string{}
+	for _, w := range words(query) {
+		terms = append(terms, query[w.start:w.end])
+	}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	// weighted like the full text index, a title match counts the most
+	scores := map[string]int{}
+	matches := []*post{}
+	for _, p := range me.posts {
+		if !isListed(p) || p.UserID != userID || p.Space != space {
+			continue
+		}
+		score := 0
+		for _, term := range terms {
+			count := 10*countTerm(p.Title, term) + 5*countTerm(p.Description, term) + countTerm(p.Text, term)
+			if count == 0 {
+				score = 0
+				break
+			}
+			score += count
+		}
+		if score == 0 {
+			continue
+		}
+		scores[p.ID] = score
+		matches = append(matches, p)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if scores[a.ID] == scores[b.ID] {
+			return publishedLater(a, b)
+		}
+		return scores[a.ID] > scores[b.ID]
+	})
+
+	for _, p := range matches[:min(limit, len(matches))] {
+		results = append(results, &db.PostSearchResult{
+			Post:    me.copyPost(p, false),
+			Snippet: snippet(p.Text, terms),
+		})
+	}
+	return results, nil
+}
+
+func (me *MemoryDB) ReplaceTagsForPost(tags []string, postID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findPost(postID)
+	if p == nil {
+		return sql.ErrNoRows
+	}
+	p.tags = []string{}
+	for _, tag := range tags {
+		if !slices.Contains(p.tags, tag) {
+			p.tags = append(p.tags, tag)
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) ReplaceAliasesForPost(aliases []string, postID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findPost(postID)
+	if p == nil {
+		return sql.ErrNoRows
+	}
+	p.aliases = []string{}
+	for _, alias := range aliases {
+		if slices.Contains(aliasDenyList, alias) {
+			me.Logger.Info(
+				"name is in the deny list for aliases because it conflicts with a static route, skipping",
+				"alias", alias,
+			)
+			continue
+		}
+		p.aliases = append(p.aliases, alias)
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindUserPostsByTag(page *db.Pager, tag, userID, space string) (*db.Paginate[*db.Post], error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	posts := me.findPosts(func(p *post) bool {
+		return isListed(p) && p.UserID == userID && p.Space == space && slices.Contains(p.tags, tag)
+	}, publishedLater, false)
+	return pager(posts, page, me.postCount(space, "")), nil
+}
+
+func (me *MemoryDB) FindPostsByTag(page *db.Pager, tag, space string) (*db.Paginate[*db.Post], error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	posts := me.findPosts(func(p *post) bool {
+		return isListed(p) && p.Space == space && slices.Contains(p.tags, tag)
+	}, publishedLater, false)
+	for _, p := range posts {
+		p.Score = "0"
+	}
+	return pager(posts, page, me.postCount(space, tag)), nil
+}
+
+func (me *MemoryDB) FindPopularTags(space string) ([]string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	tally := map[string]int{}
+	tags := []string{}
+	for _, p := range me.posts {
+		if p.Space != space {
+			continue
+		}
+		for _, tag := range p.tags {
+			if tally[tag] == 0 {
+				tags = append(tags, tag)
+			}
+			tally[tag] += 1
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tally[tags[i]] > tally[tags[j]] })
+	return tags[:min(5, len(tags))], nil
+}
+
+func (me *MemoryDB) FindTagsForPost(postID string) ([]string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findPost(postID)
+	if p == nil {
+		return []string{}, nil
+	}
+	return slices.Clone(p.tags), nil
+}
+
+func (me *MemoryDB) AddPicoPlusUser(username, paymentType, txId string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	user := me.findUserForName(username)
+	if user == nil {
+		return sql.ErrNoRows
+	}
+	expiresAt := time.Now().AddDate(1, 0, 0)
+	for _, feature := range picoPlusFeatures {
+		me.insertFeature(user.ID, feature.name, feature.data, expiresAt)
+	}
+	return nil
+}
+
+func (me *MemoryDB) findFeatureForUser(userID string, feature string) (*db.FeatureFlag, error) {
+	var found *db.FeatureFlag
+	for _, ff := range me.flags {
+		if ff.UserID != userID || ff.Name != feature {
+			continue
+		}
+		if found == nil || ff.ExpiresAt.After(*found.ExpiresAt) {
+			found = ff
+		}
+	}
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	cp := *found
+	return &cp, nil
+}
+
+func (me *MemoryDB) FindFeatureForUser(userID string, feature string) (*db.FeatureFlag, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findFeatureForUser(userID, feature)
+}
+
+// FindQuotaForUser picks the largest of the Quotas the user holds an active
+// feature flag for.
+func (me *MemoryDB) FindQuotaForUser(userID string, feature string) (*db.Quota, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	var found *db.Quota
+	for _, quota := range me.Quotas {
+		if quota.Service != feature {
+			continue
+		}
+		ff, err := me.findFeatureForUser(userID, quota.Plan)
+		if err != nil || !ff.IsValid() {
+			continue
+		}
+		if found == nil || quota.StorageMax > found.StorageMax {
+			found = quota
+		}
+	}
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	cp := *found
+	return &cp, nil
+}
+
+func (me *MemoryDB) HasFeatureForUser(userID string, feature string) bool {
+	ff, err := me.FindFeatureForUser(userID, feature)
+	if err != nil {
+		return false
+	}
+	return ff.IsValid()
+}
+
+func (me *MemoryDB) HasAnyFeatureForUser(userID string, features ...string) (bool, error) {
+	for _, feature := range features {
+		ff, err := me.FindFeatureForUser(userID, feature)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if ff.IsValid() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (me *MemoryDB) FindTotalSizeForUser(userID string) (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	size := 0
+	for _, p := range me.posts {
+		if p.UserID == userID {
+			size += p.FileSize
+		}
+	}
+	return size, nil
+}
+
+func (me *MemoryDB) InsertFeedItems(postID string, items []*db.FeedItem) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, item := range items {
+		me.feedItems = append(me.feedItems, &db.FeedItem{
+			ID:        newID(),
+			PostID:    item.PostID,
+			GUID:      item.GUID,
+			Data:      item.Data,
+			CreatedAt: now(),
+		})
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindFeedItemsByPostID(postID string) ([]*db.FeedItem, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	items := []*db.FeedItem{}
+	for _, item := range me.feedItems {
+		if item.PostID == postID {
+			cp := *item
+			items = append(items, &cp)
+		}
+	}
+	return items, nil
+}
+
+func (me *MemoryDB) findDigestSubscription(match func(*db.DigestSubscription) bool) *db.DigestSubscription {
+	for _, sub := range me.digests {
+		if match(sub) {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) UpsertDigestSubscription(userID string) (*db.DigestSubscription, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	sub := me.findDigestSubscription(func(s *db.DigestSubscription) bool { return s.UserID == userID })
+	if sub == nil {
+		sub = &db.DigestSubscription{UserID: userID, Token: newID(), CreatedAt: now()}
+		me.digests = append(me.digests, sub)
+	}
+	cp := *sub
+	return &cp, nil
+}
+
+func (me *MemoryDB) UnsubscribeDigests(token string) (*db.DigestSubscription, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	sub := me.findDigestSubscription(func(s *db.DigestSubscription) bool { return s.Token == token })
+	if sub == nil {
+		return nil, fmt.Errorf("unsubscribe token not found")
+	}
+	if sub.UnsubscribedAt == nil {
+		sub.UnsubscribedAt = now()
+	}
+	cp := *sub
+	return &cp, nil
+}
+
+func (me *MemoryDB) ResubscribeDigests(userID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	sub := me.findDigestSubscription(func(s *db.DigestSubscription) bool { return s.UserID == userID })
+	if sub != nil {
+		sub.UnsubscribedAt = nil
+	}
+	return nil
+}
+
+func (me *MemoryDB) AddPostEmailSender(userID, email string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, sender := range me.senders {
+		if sender.UserID == userID && sender.Email == email {
+			return nil
+		}
+	}
+	me.senders = append(me.senders, &db.PostEmailSender{UserID: userID, Email: email, CreatedAt: now()})
+	return nil
+}
+
+func (me *MemoryDB) RemovePostEmailSender(userID, email string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := len(me.senders)
+	me.senders = slices.DeleteFunc(me.senders, func(s *db.PostEmailSender) bool {
+		return s.UserID == userID && s.Email == email
+	})
+	if count == len(me.senders) {
+		return fmt.Errorf("email sender not found")
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindPostEmailSenders(userID string) ([]*db.PostEmailSender, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	senders := []*db.PostEmailSender{}
+	for _, sender := range me.senders {
+		if sender.UserID == userID {
+			cp := *sender
+			senders = append(senders, &cp)
+		}
+	}
+	sort.SliceStable(senders, func(i, j int) bool { return senders[i].Email < senders[j].Email })
+	return senders, nil
+}
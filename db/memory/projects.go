@@ -0,0 +1,1277 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+)
+
+func (me *MemoryDB) copyProject(p *project) *db.Project {
+	cp := p.Project
+	cp.Username = ""
+	if user := me.findUser(p.UserID); user != nil {
+		cp.Username = user.Name
+	}
+	cp.Acl.Data = slices.Clone(p.Acl.Data)
+	return &cp
+}
+
+func (me *MemoryDB) findProject(match func(*project) bool) *project {
+	for _, p := range me.projects {
+		if match(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) findProjectByName(userID, name string) *project {
+	return me.findProject(func(p *project) bool { return p.UserID == userID && p.Name == name })
+}
+
+func (me *MemoryDB) findProjectByID(projectID string) *project {
+	return me.findProject(func(p *project) bool { return p.ID == projectID })
+}
+
+// findProjects copies the projects matching match sorted by less.
+func (me *MemoryDB) findProjects(match func(*project) bool, less func(a, b *project) bool) []*db.Project {
+	found := []*project{}
+	for _, p := range me.projects {
+		if match(p) {
+			found = append(found, p)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return less(found[i], found[j]) })
+	projects := []*db.Project{}
+	for _, p := range found {
+		projects = append(projects, me.copyProject(p))
+	}
+	return projects
+}
+
+func byName(a, b *project) bool {
+	return a.Name < b.Name
+}
+
+func byUpdatedAt(a, b *project) bool {
+	if a.UpdatedAt.Equal(*b.UpdatedAt) {
+		return a.Name < b.Name
+	}
+	return a.UpdatedAt.Before(*b.UpdatedAt)
+}
+
+// updateProject runs update on the project of the user and bumps its
+// updated_at.
+func (me *MemoryDB) updateProject(userID, name string, update func(*project)) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByName(userID, name)
+	if p == nil {
+		return nil
+	}
+	update(p)
+	p.UpdatedAt = now()
+	return nil
+}
+
+func (me *MemoryDB) InsertProject(userID, name, projectDir string) (string, error) {
+	if !shared.IsValidSubdomain(name) {
+		return "", fmt.Errorf("(%s) is not a valid project name, must match /^[a-z0-9-]+$/", name)
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.findProjectByName(userID, name) != nil {
+		return "", fmt.Errorf("project (%s) already exists", name)
+	}
+	t := now()
+	p := &project{Project: db.Project{
+		ID:         newID(),
+		UserID:     userID,
+		Name:       name,
+		ProjectDir: projectDir,
+		Acl:        db.ProjectAcl{Type: "public", Data: []string{}},
+		CreatedAt:  t,
+		UpdatedAt:  t,
+	}}
+	me.projects = append(me.projects, p)
+	return p.ID, nil
+}
+
+func (me *MemoryDB) UpdateProject(userID, name string) error {
+	return me.updateProject(userID, name, func(p *project) {})
+}
+
+func (me *MemoryDB) UpdateProjectAcl(userID, name string, acl db.ProjectAcl) error {
+	return me.updateProject(userID, name, func(p *project) {
+		p.Acl = db.ProjectAcl{Type: acl.Type, Data: slices.Clone(acl.Data)}
+	})
+}
+
+func (me *MemoryDB) UpdateProjectCsp(userID, name string, csp db.ProjectCsp) error {
+	return me.updateProject(userID, name, func(p *project) { p.Csp = csp })
+}
+
+func (me *MemoryDB) UpdateProjectSitemap(userID, name string, sitemap bool) error {
+	return me.updateProject(userID, name, func(p *project) { p.Sitemap = sitemap })
+}
+
+func (me *MemoryDB) UpsertHeaders(projectID string, rules []*headers.HeaderRule) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByID(projectID)
+	if p != nil {
+		p.headers = rules
+	}
+	return nil
+}
+
+func (me *MemoryDB) UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByID(projectID)
+	if p != nil {
+		p.redirects = rules
+	}
+	return nil
+}
+
+// LinkToProject points a project at the files of another. A project that
+// is itself a link can't be linked to.
+func (me *MemoryDB) LinkToProject(userID, projectID, projectDir string, commit bool) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	linkToProject := me.findProjectByName(userID, projectDir)
+	if linkToProject == nil {
+		return sql.ErrNoRows
+	}
+	isAlreadyLinked := linkToProject.Name != linkToProject.ProjectDir
+	sameProject := linkToProject.ID == projectID
+
+	if !sameProject && isAlreadyLinked {
+		return fmt.Errorf(
+			"cannot link (%s) to (%s) because it is also a link to (%s)",
+			projectID,
+			projectDir,
+			linkToProject.ProjectDir,
+		)
+	}
+
+	if commit {
+		if p := me.findProjectByID(projectID); p != nil {
+			p.ProjectDir = projectDir
+			p.UpdatedAt = now()
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) removeProject(projectID string) {
+	me.projects = slices.DeleteFunc(me.projects, func(p *project) bool { return p.ID == projectID })
+	for _, d := range me.domains {
+		if d.ProjectID == projectID {
+			me.certs = slices.DeleteFunc(me.certs, func(c *db.DomainCert) bool { return c.Domain == d.Domain })
+		}
+	}
+	me.domains = slices.DeleteFunc(me.domains, func(d *db.ProjectDomain) bool { return d.ProjectID == projectID })
+	me.deploys = slices.DeleteFunc(me.deploys, func(d *db.ProjectDeploy) bool { return d.ProjectID == projectID })
+	me.env = slices.DeleteFunc(me.env, func(e *db.ProjectEnv) bool { return e.ProjectID == projectID })
+	me.signingKeys = slices.DeleteFunc(me.signingKeys, func(k *db.ProjectSigningKey) bool { return k.ProjectID == projectID })
+	me.access = slices.DeleteFunc(me.access, func(a *db.ProjectAccess) bool { return a.ProjectID == projectID })
+}
+
+func (me *MemoryDB) RemoveProject(projectID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.removeProject(projectID)
+	return nil
+}
+
+func (me *MemoryDB) SetProjectExpiry(projectID string, expiresAt *time.Time) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByID(projectID)
+	if p != nil {
+		p.ExpiresAt = expiresAt
+		p.claimedAt = nil
+	}
+	return nil
+}
+
+// ClaimExpiredProjects marks up to limit expired projects as claimed so
+// concurrent sweepers never purge the same project. Claims older than
+// `expireClaimTimeout` are considered abandoned and can be claimed again.
+// Projects other projects link to are left alone, their links serve them.
+func (me *MemoryDB) ClaimExpiredProjects(limit int) ([]*db.Project, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	abandoned := t.Add(-expireClaimTimeout)
+	expired := []*project{}
+	for _, p := range me.projects {
+		if p.ExpiresAt == nil || !p.ExpiresAt.Before(t) {
+			continue
+		}
+		if p.claimedAt != nil && !p.claimedAt.Before(abandoned) {
+			continue
+		}
+		if me.hasLinks(p) {
+			continue
+		}
+		expired = append(expired, p)
+	}
+	sort.SliceStable(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(*expired[j].ExpiresAt) })
+	projects := []*db.Project{}
+	for _, p := range expired[:min(limit, len(expired))] {
+		claimedAt := t
+		p.claimedAt = &claimedAt
+		projects = append(projects, me.copyProject(p))
+	}
+	return projects, nil
+}
+
+// hasLinks is true when other projects of the user point at p.
+func (me *MemoryDB) hasLinks(p *project) bool {
+	for _, link := range me.projects {
+		if link.UserID == p.UserID && link.Name != link.ProjectDir && link.ProjectDir == p.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (me *MemoryDB) RenameProject(userID, oldName, newName string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.findProjectByName(userID, newName) != nil {
+		return fmt.Errorf("project (%s) already exists", newName)
+	}
+
+	t := now()
+	if p := me.findProjectByName(userID, oldName); p != nil {
+		p.Name = newName
+		p.UpdatedAt = t
+	}
+	// the project itself and any projects linking to it
+	for _, p := range me.projects {
+		if p.UserID == userID && p.ProjectDir == oldName {
+			p.ProjectDir = newName
+			p.UpdatedAt = t
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByName(userID, name)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	return me.copyProject(p), nil
+}
+
+func (me *MemoryDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findProjects(func(p *project) bool {
+		return p.UserID == userID && p.Name != p.ProjectDir && p.ProjectDir == name
+	}, byName), nil
+}
+
+func (me *MemoryDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findProjects(func(p *project) bool { return p.UserID == userID }, byName), nil
+}
+
+func (me *MemoryDB) FindProjectsByPrefix(userID, prefix string) ([]*db.Project, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findProjects(func(p *project) bool {
+		return p.UserID == userID && p.Name == p.ProjectDir && strings.HasPrefix(p.Name, prefix)
+	}, byUpdatedAt), nil
+}
+
+// FindStaleProjects returns the projects of a user that have not been
+// updated since updatedBefore, the longest untouched first.
+func (me *MemoryDB) FindStaleProjects(userID string, updatedBefore time.Time) ([]*db.Project, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findProjects(func(p *project) bool {
+		return p.UserID == userID && p.UpdatedAt.Before(updatedBefore)
+	}, byUpdatedAt), nil
+}
+
+// FindAllProjects sorts by the column `by` names, created_at unless it is
+// one of the updated_at columns.
+func (me *MemoryDB) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.Project], error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	projects := me.findProjects(func(p *project) bool { return true }, func(a, b *project) bool {
+		if strings.HasSuffix(by, "updated_at") {
+			return a.UpdatedAt.After(*b.UpdatedAt)
+		}
+		return a.CreatedAt.After(*b.CreatedAt)
+	})
+	return pager(projects, page, len(projects)), nil
+}
+
+func copyCount(count *int) *int {
+	if count == nil {
+		return nil
+	}
+	n := *count
+	return &n
+}
+
+// FindProjectObjectCount is nil until the project has been counted.
+func (me *MemoryDB) FindProjectObjectCount(userID, name string) (*int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByName(userID, name)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyCount(p.objectCount), nil
+}
+
+// FindObjectCountsForUser returns the object count of every project that
+// holds its own files, links are left out.
+func (me *MemoryDB) FindObjectCountsForUser(userID string) (map[string]*int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	counts := map[string]*int{}
+	for _, p := range me.projects {
+		if p.UserID == userID && p.Name == p.ProjectDir {
+			counts[p.Name] = copyCount(p.objectCount)
+		}
+	}
+	return counts, nil
+}
+
+// SetProjectObjectCount records a fresh count, nil forgets it so the next
+// upload counts the project again.
+func (me *MemoryDB) SetProjectObjectCount(userID, name string, count *int) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if p := me.findProjectByName(userID, name); p != nil {
+		p.objectCount = copyCount(count)
+	}
+	return nil
+}
+
+// AdjustProjectObjectCount leaves projects that were never counted alone.
+func (me *MemoryDB) AdjustProjectObjectCount(userID, name string, delta int) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if p := me.findProjectByName(userID, name); p != nil && p.objectCount != nil {
+		count := max(*p.objectCount+delta, 0)
+		p.objectCount = &count
+	}
+	return nil
+}
+
+func (me *MemoryDB) copyDomain(d *db.ProjectDomain) *db.ProjectDomain {
+	cp := *d
+	if p := me.findProjectByID(d.ProjectID); p != nil {
+		cp.ProjectName = p.Name
+	}
+	return &cp
+}
+
+func (me *MemoryDB) findDomains(match func(*db.ProjectDomain) bool, less func(a, b *db.ProjectDomain) bool, limit int) []*db.ProjectDomain {
+	found := []*db.ProjectDomain{}
+	for _, d := range me.domains {
+		if match(d) {
+			found = append(found, d)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return less(found[i], found[j]) })
+	if limit >= 0 {
+		found = found[:min(limit, len(found))]
+	}
+	domains := []*db.ProjectDomain{}
+	for _, d := range found {
+		domains = append(domains, me.copyDomain(d))
+	}
+	return domains
+}
+
+func byDomain(a, b *db.ProjectDomain) bool {
+	return a.Domain < b.Domain
+}
+
+func (me *MemoryDB) InsertProjectDomain(projectID, domain string) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, d := range me.domains {
+		if d.Domain == domain {
+			return "", fmt.Errorf("domain (%s) already exists", domain)
+		}
+	}
+	d := &db.ProjectDomain{
+		ID:        newID(),
+		ProjectID: projectID,
+		Domain:    domain,
+		Token:     newID(),
+		CreatedAt: now(),
+	}
+	me.domains = append(me.domains, d)
+	return d.Token, nil
+}
+
+func (me *MemoryDB) RemoveProjectDomain(userID, domain string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := len(me.domains)
+	me.domains = slices.DeleteFunc(me.domains, func(d *db.ProjectDomain) bool {
+		p := me.findProjectByID(d.ProjectID)
+		return d.Domain == domain && p != nil && p.UserID == userID
+	})
+	if count == len(me.domains) {
+		return fmt.Errorf("domain (%s) not found", domain)
+	}
+	me.certs = slices.DeleteFunc(me.certs, func(c *db.DomainCert) bool { return c.Domain == domain })
+	return nil
+}
+
+func (me *MemoryDB) FindProjectDomains(userID string) ([]*db.ProjectDomain, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findDomains(func(d *db.ProjectDomain) bool {
+		p := me.findProjectByID(d.ProjectID)
+		return p != nil && p.UserID == userID
+	}, byDomain, -1), nil
+}
+
+func (me *MemoryDB) FindUnverifiedDomains(limit int) ([]*db.ProjectDomain, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findDomains(func(d *db.ProjectDomain) bool {
+		return !d.IsVerified() && me.findProjectByID(d.ProjectID) != nil
+	}, func(a, b *db.ProjectDomain) bool {
+		return a.CreatedAt.Before(*b.CreatedAt)
+	}, limit), nil
+}
+
+func (me *MemoryDB) VerifyProjectDomain(domainID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, d := range me.domains {
+		if d.ID == domainID {
+			d.VerifiedAt = now()
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findDomains(func(d *db.ProjectDomain) bool {
+		return d.IsVerified() && d.VerifiedAt.Before(verifiedBefore) && me.findProjectByID(d.ProjectID) != nil
+	}, func(a, b *db.ProjectDomain) bool {
+		return a.VerifiedAt.Before(*b.VerifiedAt)
+	}, limit), nil
+}
+
+func (me *MemoryDB) UnverifyProjectDomain(domainID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, d := range me.domains {
+		if d.ID == domainID {
+			d.VerifiedAt = nil
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindSubdomainForDomain(domain string) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, d := range me.domains {
+		if d.Domain != domain || !d.IsVerified() {
+			continue
+		}
+		p := me.findProjectByID(d.ProjectID)
+		if p == nil {
+			continue
+		}
+		user := me.findUser(p.UserID)
+		if user == nil {
+			continue
+		}
+		return fmt.Sprintf("%s-%s", user.Name, p.Name), nil
+	}
+	return "", sql.ErrNoRows
+}
+
+func (me *MemoryDB) findDomainCert(domain string) *db.DomainCert {
+	for _, c := range me.certs {
+		if c.Domain == domain {
+			return c
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) UpsertDomainCert(cert *db.DomainCert) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	found := me.findDomainCert(cert.Domain)
+	if found == nil {
+		found = &db.DomainCert{ID: newID(), Domain: cert.Domain, CreatedAt: now()}
+		me.certs = append(me.certs, found)
+	}
+	found.CertPEM = cert.CertPEM
+	found.KeyPEM = cert.KeyPEM
+	found.ExpiresAt = cert.ExpiresAt
+	found.UpdatedAt = now()
+	return nil
+}
+
+func (me *MemoryDB) FindDomainCert(domain string) (*db.DomainCert, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	found := me.findDomainCert(domain)
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	cp := *found
+	return &cp, nil
+}
+
+func (me *MemoryDB) FindDomainsForCerts(renewBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findDomains(func(d *db.ProjectDomain) bool {
+		if !d.IsVerified() || me.findProjectByID(d.ProjectID) == nil {
+			return false
+		}
+		cert := me.findDomainCert(d.Domain)
+		return cert == nil || cert.ExpiresAt == nil || cert.ExpiresAt.Before(renewBefore)
+	}, byDomain, limit), nil
+}
+
+func (me *MemoryDB) InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, d := range me.deploys {
+		if d.ProjectID == projectID && d.Revision == revision {
+			return fmt.Errorf("revision (%d) already exists", revision)
+		}
+	}
+	for _, d := range me.deploys {
+		if d.ProjectID == projectID {
+			d.Current = false
+		}
+	}
+	me.deploys = append(me.deploys, &db.ProjectDeploy{
+		ID:        newID(),
+		ProjectID: projectID,
+		Revision:  revision,
+		Current:   true,
+		FileCount: fileCount,
+		Size:      size,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (me *MemoryDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	deploys := []*db.ProjectDeploy{}
+	for _, d := range me.deploys {
+		if d.ProjectID == projectID {
+			cp := *d
+			deploys = append(deploys, &cp)
+		}
+	}
+	sort.SliceStable(deploys, func(i, j int) bool { return deploys[i].Revision > deploys[j].Revision })
+	return deploys, nil
+}
+
+func (me *MemoryDB) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByName(userID, projectName)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	for _, d := range me.deploys {
+		if d.ProjectID == p.ID && d.Current {
+			cp := *d
+			return &cp, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (me *MemoryDB) SetCurrentDeploy(projectID string, revision int) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	idx := slices.IndexFunc(me.deploys, func(d *db.ProjectDeploy) bool {
+		return d.ProjectID == projectID && d.Revision == revision
+	})
+	if idx < 0 {
+		return fmt.Errorf("revision (%d) not found", revision)
+	}
+	for _, d := range me.deploys {
+		if d.ProjectID == projectID {
+			d.Current = false
+		}
+	}
+	me.deploys[idx].Current = true
+	return nil
+}
+
+func (me *MemoryDB) ClearCurrentDeploy(userID, projectName string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	p := me.findProjectByName(userID, projectName)
+	if p == nil {
+		return nil
+	}
+	for _, d := range me.deploys {
+		if d.ProjectID == p.ID {
+			d.Current = false
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) RemoveProjectDeploy(deployID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.deploys = slices.DeleteFunc(me.deploys, func(d *db.ProjectDeploy) bool { return d.ID == deployID })
+	return nil
+}
+
+func (me *MemoryDB) InsertWebhook(userID, url, secret string) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, w := range me.webhooks {
+		if w.UserID == userID && w.URL == url {
+			return "", fmt.Errorf("webhook (%s) already exists", url)
+		}
+	}
+	w := &db.Webhook{ID: newID(), UserID: userID, URL: url, Secret: secret, CreatedAt: now()}
+	me.webhooks = append(me.webhooks, w)
+	return w.ID, nil
+}
+
+func (me *MemoryDB) FindWebhooksForUser(userID string) ([]*db.Webhook, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	webhooks := []*db.Webhook{}
+	for _, w := range me.webhooks {
+		if w.UserID == userID {
+			cp := *w
+			webhooks = append(webhooks, &cp)
+		}
+	}
+	return webhooks, nil
+}
+
+func (me *MemoryDB) RemoveWebhook(userID, webhookID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := len(me.webhooks)
+	me.webhooks = slices.DeleteFunc(me.webhooks, func(w *db.Webhook) bool {
+		return w.UserID == userID && w.ID == webhookID
+	})
+	if count == len(me.webhooks) {
+		return fmt.Errorf("webhook (%s) not found", webhookID)
+	}
+	return nil
+}
+
+func (me *MemoryDB) InsertAuditEntry(entry *db.AuditEntry) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	cp := *entry
+	cp.ID = newID()
+	cp.CreatedAt = now()
+	me.audit = append(me.audit, &cp)
+	return nil
+}
+
+func (me *MemoryDB) FindAuditLog(userID string, since time.Time, limit int) ([]*db.AuditEntry, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	entries := []*db.AuditEntry{}
+	// appended in order, walking back finds the newest first
+	for i := len(me.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := me.audit[i]
+		if entry.UserID == userID && !entry.CreatedAt.Before(since) {
+			cp := *entry
+			entries = append(entries, &cp)
+		}
+	}
+	return entries, nil
+}
+
+func (me *MemoryDB) InsertTrashObject(obj *db.TrashObject) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	cp := *obj
+	cp.ID = newID()
+	cp.CreatedAt = now()
+	me.trash = append(me.trash, &trashObject{TrashObject: cp})
+	return nil
+}
+
+func (me *MemoryDB) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	objs := []*db.TrashObject{}
+	for i := len(me.trash) - 1; i >= 0; i-- {
+		if me.trash[i].UserID == userID {
+			cp := me.trash[i].TrashObject
+			objs = append(objs, &cp)
+		}
+	}
+	return objs, nil
+}
+
+func (me *MemoryDB) RemoveTrashObject(id string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.trash = slices.DeleteFunc(me.trash, func(o *trashObject) bool { return o.ID == id })
+	return nil
+}
+
+// ClaimExpiredTrash works like ClaimExpiredProjects.
+func (me *MemoryDB) ClaimExpiredTrash(limit int) ([]*db.TrashObject, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	abandoned := t.Add(-expireClaimTimeout)
+	expired := []*trashObject{}
+	for _, o := range me.trash {
+		if o.ExpiresAt == nil || !o.ExpiresAt.Before(t) {
+			continue
+		}
+		if o.claimedAt != nil && !o.claimedAt.Before(abandoned) {
+			continue
+		}
+		expired = append(expired, o)
+	}
+	sort.SliceStable(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(*expired[j].ExpiresAt) })
+	objs := []*db.TrashObject{}
+	for _, o := range expired[:min(limit, len(expired))] {
+		claimedAt := t
+		o.claimedAt = &claimedAt
+		cp := o.TrashObject
+		objs = append(objs, &cp)
+	}
+	return objs, nil
+}
+
+func (me *MemoryDB) SetProjectEnv(projectID, key, value string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, e := range me.env {
+		if e.ProjectID == projectID && e.Key == key {
+			e.Value = value
+			e.UpdatedAt = now()
+			return nil
+		}
+	}
+	t := now()
+	me.env = append(me.env, &db.ProjectEnv{
+		ID:        newID(),
+		ProjectID: projectID,
+		Key:       key,
+		Value:     value,
+		CreatedAt: t,
+		UpdatedAt: t,
+	})
+	return nil
+}
+
+func (me *MemoryDB) RemoveProjectEnv(projectID, key string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := len(me.env)
+	me.env = slices.DeleteFunc(me.env, func(e *db.ProjectEnv) bool { return e.ProjectID == projectID && e.Key == key })
+	if count == len(me.env) {
+		return fmt.Errorf("variable (%s) not found", key)
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindProjectEnv(projectID string) ([]*db.ProjectEnv, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	env := []*db.ProjectEnv{}
+	for _, e := range me.env {
+		if e.ProjectID == projectID {
+			cp := *e
+			env = append(env, &cp)
+		}
+	}
+	sort.SliceStable(env, func(i, j int) bool { return env[i].Key < env[j].Key })
+	return env, nil
+}
+
+func (me *MemoryDB) SetProjectSigningKey(projectID, key string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.signingKeys = slices.DeleteFunc(me.signingKeys, func(k *db.ProjectSigningKey) bool { return k.ProjectID == projectID })
+	me.signingKeys = append(me.signingKeys, &db.ProjectSigningKey{ProjectID: projectID, Key: key, CreatedAt: now()})
+	return nil
+}
+
+func (me *MemoryDB) RemoveProjectSigningKey(projectID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := len(me.signingKeys)
+	me.signingKeys = slices.DeleteFunc(me.signingKeys, func(k *db.ProjectSigningKey) bool { return k.ProjectID == projectID })
+	if count == len(me.signingKeys) {
+		return fmt.Errorf("signing key not found")
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, k := range me.signingKeys {
+		if k.ProjectID == projectID {
+			cp := *k
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (me *MemoryDB) setOrgMember(orgID, userID, role string) {
+	for _, m := range me.members {
+		if m.OrgID == orgID && m.UserID == userID {
+			m.Role = role
+			return
+		}
+	}
+	me.members = append(me.members, &db.OrgMember{
+		ID:        newID(),
+		OrgID:     orgID,
+		UserID:    userID,
+		Role:      role,
+		CreatedAt: now(),
+	})
+}
+
+func (me *MemoryDB) CreateOrg(ownerID, name string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	lowerName := strings.ToLower(name)
+	valid, err := me.validateName(lowerName)
+	if !valid {
+		return nil, err
+	}
+
+	org := me.insertUser(lowerName)
+	me.orgs[org.ID] = true
+	me.setOrgMember(org.ID, ownerID, db.RoleOwner)
+	return copyUser(org), nil
+}
+
+func (me *MemoryDB) FindOrgForName(name string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	user := me.findUserForName(name)
+	if user == nil || !me.orgs[user.ID] {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(user), nil
+}
+
+func (me *MemoryDB) copyMember(m *db.OrgMember) *db.OrgMember {
+	cp := *m
+	if user := me.findUser(m.UserID); user != nil {
+		cp.Name = user.Name
+	}
+	return &cp
+}
+
+func (me *MemoryDB) FindOrgMember(orgID, userID string) (*db.OrgMember, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, m := range me.members {
+		if m.OrgID == orgID && m.UserID == userID && me.findUser(userID) != nil {
+			return me.copyMember(m), nil
+		}
+	}
+	return nil, db.ErrNotOrgMember
+}
+
+func (me *MemoryDB) FindOrgMembers(orgID string) ([]*db.OrgMember, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	members := []*db.OrgMember{}
+	for _, m := range me.members {
+		if m.OrgID == orgID && me.findUser(m.UserID) != nil {
+			members = append(members, me.copyMember(m))
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+func (me *MemoryDB) SetOrgMember(orgID, userID, role string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.setOrgMember(orgID, userID, role)
+	return nil
+}
+
+func (me *MemoryDB) RemoveOrgMember(orgID, userID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.members = slices.DeleteFunc(me.members, func(m *db.OrgMember) bool {
+		return m.OrgID == orgID && m.UserID == userID
+	})
+	return nil
+}
+
+func (me *MemoryDB) SetProjectAccess(projectID string, entries []*db.ProjectAccess) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.access = slices.DeleteFunc(me.access, func(a *db.ProjectAccess) bool { return a.ProjectID == projectID })
+	for _, entry := range entries {
+		exists := slices.ContainsFunc(me.access, func(a *db.ProjectAccess) bool {
+			return a.ProjectID == projectID && a.Kind == entry.Kind && a.Value == entry.Value
+		})
+		if exists {
+			continue
+		}
+		me.access = append(me.access, &db.ProjectAccess{
+			ID:        newID(),
+			ProjectID: projectID,
+			Kind:      entry.Kind,
+			Value:     entry.Value,
+			CreatedAt: now(),
+		})
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindProjectAccess(projectID string) ([]*db.ProjectAccess, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	entries := []*db.ProjectAccess{}
+	for _, a := range me.access {
+		if a.ProjectID == projectID {
+			cp := *a
+			entries = append(entries, &cp)
+		}
+	}
+	return entries, nil
+}
+
+func (me *MemoryDB) InsertProjectEvent(event *db.ProjectEvent) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	cp := *event
+	cp.ID = newID()
+	cp.CreatedAt = now()
+	me.events = append(me.events, &cp)
+	return nil
+}
+
+func (me *MemoryDB) FindProjectEventsForUser(userID string, limit int) ([]*db.ProjectEvent, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	events := []*db.ProjectEvent{}
+	for i := len(me.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if me.events[i].UserID == userID {
+			cp := *me.events[i]
+			events = append(events, &cp)
+		}
+	}
+	return events, nil
+}
+
+func (me *MemoryDB) AddAnalytics(day *db.AnalyticsDay) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	d := date(day.Day)
+	for _, a := range me.analytics {
+		if a.UserID == day.UserID && a.Space == day.Space && a.Name == day.Name && a.Day.Equal(d) {
+			a.Hits += day.Hits
+			a.Uniques += day.Uniques
+			return nil
+		}
+	}
+	cp := *day
+	cp.Day = d
+	me.analytics = append(me.analytics, &cp)
+	return nil
+}
+
+func (me *MemoryDB) FindAnalytics(userID, space, name string, since time.Time) ([]*db.AnalyticsDay, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	days := []*db.AnalyticsDay{}
+	for _, a := range me.analytics {
+		if a.UserID != userID || a.Space != space || (name != "" && a.Name != name) || a.Day.Before(date(since)) {
+			continue
+		}
+		cp := *a
+		days = append(days, &cp)
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		if days[i].Day.Equal(days[j].Day) {
+			return days[i].Name < days[j].Name
+		}
+		return days[i].Day.Before(days[j].Day)
+	})
+	return days, nil
+}
+
+func (me *MemoryDB) AddBandwidth(month *db.BandwidthMonth) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, b := range me.bandwidth {
+		if b.UserID == month.UserID && b.Space == month.Space && b.Name == month.Name && b.Month.Equal(month.Month) {
+			b.Bytes += month.Bytes
+			return nil
+		}
+	}
+	cp := *month
+	me.bandwidth = append(me.bandwidth, &cp)
+	return nil
+}
+
+func (me *MemoryDB) FindBandwidth(userID, space string, month time.Time) ([]*db.BandwidthMonth, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	months := []*db.BandwidthMonth{}
+	for _, b := range me.bandwidth {
+		if b.UserID == userID && b.Space == space && b.Month.Equal(month) {
+			cp := *b
+			months = append(months, &cp)
+		}
+	}
+	sort.SliceStable(months, func(i, j int) bool {
+		if months[i].Bytes == months[j].Bytes {
+			return months[i].Name < months[j].Name
+		}
+		return months[i].Bytes > months[j].Bytes
+	})
+	return months, nil
+}
+
+func copyManifest(manifest *db.ObjectManifest) *db.ObjectManifest {
+	cp := *manifest
+	cp.Meta = slices.Clone(manifest.Meta)
+	return &cp
+}
+
+func (me *MemoryDB) UpsertObjectManifest(manifest *db.ObjectManifest) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	cp := copyManifest(manifest)
+	cp.UpdatedAt = now()
+	me.manifests[manifestKey{manifest.Bucket, manifest.Path}] = cp
+	return nil
+}
+
+func (me *MemoryDB) FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	manifest, ok := me.manifests[manifestKey{bucket, fpath}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyManifest(manifest), nil
+}
+
+func (me *MemoryDB) FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	manifests := []*db.ObjectManifest{}
+	for key, manifest := range me.manifests {
+		if key.bucket == bucket && strings.HasPrefix(key.path, prefix) {
+			manifests = append(manifests, copyManifest(manifest))
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Path < manifests[j].Path })
+	return manifests, nil
+}
+
+func (me *MemoryDB) RemoveObjectManifest(bucket, fpath string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	delete(me.manifests, manifestKey{bucket, fpath})
+	return nil
+}
+
+// CountObjectManifestRefs is how many paths in bucket point at checksum.
+func (me *MemoryDB) CountObjectManifestRefs(bucket, checksum string) (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := 0
+	for key, manifest := range me.manifests {
+		if key.bucket == bucket && manifest.Checksum == checksum {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+func (me *MemoryDB) seedStorageUsage(userID string, used int64) {
+	if _, ok := me.usage[userID]; !ok {
+		me.usage[userID] = &db.StorageUsage{UserID: userID, Used: used}
+	}
+}
+
+// held is what the unexpired holds of the user reserved.
+func (me *MemoryDB) held(userID string, at time.Time) int64 {
+	var held int64
+	for _, h := range me.holds {
+		if h.userID == userID && h.expiresAt.After(at) {
+			held += h.size
+		}
+	}
+	return held
+}
+
+func (me *MemoryDB) addStorageUsage(userID string, delta int64) {
+	if usage, ok := me.usage[userID]; ok {
+		usage.Used = max(usage.Used+delta, 0)
+	}
+}
+
+func (me *MemoryDB) SeedStorageUsage(userID string, used int64) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.seedStorageUsage(userID, used)
+	return nil
+}
+
+func (me *MemoryDB) ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	return me.holdStorage(userID, projectName, size, max, expiresAt, false)
+}
+
+func (me *MemoryDB) ReserveProjectStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	return me.holdStorage(userID, projectName, size, max, expiresAt, true)
+}
+
+// holdStorage holds space for an upload, or reserves it for a project
+// when reservation is set.
+func (me *MemoryDB) holdStorage(userID, projectName string, size, max int64, expiresAt time.Time, reservation bool) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	// a user without usage yet starts out empty
+	me.seedStorageUsage(userID, 0)
+	used := me.usage[userID].Used
+	held := int64(0)
+	for _, h := range me.holds {
+		if h.userID == userID && h.expiresAt.After(time.Now()) && (h.projectName == "" || h.projectName != projectName) {
+			held += h.size
+		}
+	}
+	if max > 0 && used+held+size > max {
+		return "", db.ErrQuotaExceeded
+	}
+
+	holdProject := ""
+	if reservation {
+		holdProject = projectName
+		for id, h := range me.holds {
+			if h.userID == userID && h.projectName == projectName {
+				delete(me.holds, id)
+			}
+		}
+	}
+	id := newID()
+	me.holds[id] = &hold{userID: userID, projectName: holdProject, size: size, expiresAt: expiresAt}
+	return id, nil
+}
+
+func (me *MemoryDB) CommitStorage(userID, holdID string, delta int64) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	delete(me.holds, holdID)
+	me.addStorageUsage(userID, delta)
+	return nil
+}
+
+func (me *MemoryDB) ReleaseStorage(holdID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	delete(me.holds, holdID)
+	return nil
+}
+
+func (me *MemoryDB) AddStorageUsage(userID string, delta int64) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.addStorageUsage(userID, delta)
+	return nil
+}
+
+func (me *MemoryDB) SetStorageUsage(userID string, used int64) (bool, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	usage, ok := me.usage[userID]
+	t := time.Now()
+	if !ok {
+		return false, nil
+	}
+	for _, h := range me.holds {
+		if h.userID == userID && h.projectName == "" && h.expiresAt.After(t) {
+			return false, nil
+		}
+	}
+	usage.Used = used
+	usage.ReconciledAt = &t
+	return true, nil
+}
+
+func (me *MemoryDB) FindStorageUsages() ([]*db.StorageUsage, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	usages := []*db.StorageUsage{}
+	for _, usage := range me.usage {
+		cp := *usage
+		cp.Held = me.held(usage.UserID, t)
+		usages = append(usages, &cp)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		a, b := usages[i].ReconciledAt, usages[j].ReconciledAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	return usages, nil
+}
+
+func (me *MemoryDB) RemoveExpiredStorageHolds() (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	count := 0
+	for id, h := range me.holds {
+		if h.expiresAt.Before(t) {
+			delete(me.holds, id)
+			count += 1
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,667 @@
+// Package memory keeps a db.DB in memory. It passes the same conformance
+// tests as the sql backends so services can be tested, or run locally,
+// without a database.
+package memory
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+)
+
+// how long a sweeper may hold an expired project before another can claim it.
+var expireClaimTimeout = 10 * time.Minute
+
+// picoPlusFeatures are the feature flags, and their limits, pico+ grants.
+var picoPlusFeatures = []struct {
+	name string
+	data db.FeatureFlagData
+}{
+	{name: "pgs", data: db.FeatureFlagData{StorageMax: 10000000000, FileMax: 50000000}},
+	{name: "imgs", data: db.FeatureFlagData{StorageMax: 2000000000}},
+	{name: "prose", data: db.FeatureFlagData{StorageMax: 1000000000, FileMax: 50000000}},
+	{name: "tuns"},
+}
+
+// aliasDenyList are slugs that conflict with a static route.
+var aliasDenyList = []string{
+	"rss",
+	"rss.xml",
+	"atom.xml",
+	"feed.xml",
+	"styles.css",
+	"main.css",
+	"prose.css",
+	"syntax.css",
+	"card.png",
+	"favicon-16x16.png",
+	"favicon-32x32.png",
+	"apple-touch-icon.png",
+	"favicon.ico",
+	"robots.txt",
+	"atom",
+	"blog/index.xml",
+}
+
+type token struct {
+	db.Token
+	value string
+}
+
+type post struct {
+	db.Post
+	tags    []string
+	aliases []string
+}
+
+type project struct {
+	db.Project
+	headers     []*headers.HeaderRule
+	redirects   []*redirects.RedirectRule
+	objectCount *int
+	claimedAt   *time.Time
+}
+
+type trashObject struct {
+	db.TrashObject
+	claimedAt *time.Time
+}
+
+type hold struct {
+	userID string
+	// projectName is set for reservations of `reserve`
+	projectName string
+	size        int64
+	expiresAt   time.Time
+}
+
+type manifestKey struct {
+	bucket string
+	path   string
+}
+
+// MemoryDB is safe for concurrent use, everything it returns is a copy.
+type MemoryDB struct {
+	Logger *slog.Logger
+	// Quotas are the storage plans FindQuotaForUser picks from, there is
+	// no way to create them through db.DB.
+	Quotas []*db.Quota
+
+	mu          sync.Mutex
+	users       []*db.User
+	orgs        map[string]bool
+	keys        []*db.PublicKey
+	tokens      []*token
+	flags       []*db.FeatureFlag
+	posts       []*post
+	feedItems   []*db.FeedItem
+	digests     []*db.DigestSubscription
+	senders     []*db.PostEmailSender
+	projects    []*project
+	domains     []*db.ProjectDomain
+	certs       []*db.DomainCert
+	deploys     []*db.ProjectDeploy
+	webhooks    []*db.Webhook
+	audit       []*db.AuditEntry
+	trash       []*trashObject
+	env         []*db.ProjectEnv
+	signingKeys []*db.ProjectSigningKey
+	members     []*db.OrgMember
+	access      []*db.ProjectAccess
+	events      []*db.ProjectEvent
+	analytics   []*db.AnalyticsDay
+	bandwidth   []*db.BandwidthMonth
+	manifests   map[manifestKey]*db.ObjectManifest
+	usage       map[string]*db.StorageUsage
+	holds       map[string]*hold
+}
+
+var _ db.DB = (*MemoryDB)(nil)
+
+func NewDB(logger *slog.Logger) *MemoryDB {
+	return &MemoryDB{
+		Logger:    logger,
+		orgs:      map[string]bool{},
+		manifests: map[manifestKey]*db.ObjectManifest{},
+		usage:     map[string]*db.StorageUsage{},
+		holds:     map[string]*hold{},
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func now() *time.Time {
+	t := time.Now()
+	return &t
+}
+
+// date is what sql's date() keeps of a time.
+func date(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func pager[T any](data []T, page *db.Pager, count int) *db.Paginate[T] {
+	start := min(page.Num*page.Page, len(data))
+	end := min(start+page.Num, len(data))
+	return &db.Paginate[T]{
+		Data:  data[start:end],
+		Total: int(math.Ceil(float64(count) / float64(page.Num))),
+	}
+}
+
+func (me *MemoryDB) findUser(userID string) *db.User {
+	for _, user := range me.users {
+		if user.ID == userID {
+			return user
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) findUserForName(name string) *db.User {
+	name = strings.ToLower(name)
+	for _, user := range me.users {
+		if user.Name == name {
+			return user
+		}
+	}
+	return nil
+}
+
+func copyUser(user *db.User) *db.User {
+	cp := *user
+	cp.PublicKey = nil
+	return &cp
+}
+
+func (me *MemoryDB) findKeys(match func(*db.PublicKey) bool) []*db.PublicKey {
+	keys := []*db.PublicKey{}
+	for _, pk := range me.keys {
+		if match(pk) {
+			cp := *pk
+			keys = append(keys, &cp)
+		}
+	}
+	return keys
+}
+
+func (me *MemoryDB) validateName(name string) (bool, error) {
+	lower := strings.ToLower(name)
+	if slices.Contains(db.DenyList, lower) {
+		return false, fmt.Errorf("%s is on deny list: %w", lower, db.ErrNameDenied)
+	}
+	v := db.NameValidator.MatchString(lower)
+	if !v {
+		return false, fmt.Errorf("%s is invalid: %w", lower, db.ErrNameInvalid)
+	}
+	if me.findUserForName(lower) == nil {
+		return true, nil
+	}
+	return false, fmt.Errorf("%s already taken: %w", lower, db.ErrNameTaken)
+}
+
+func (me *MemoryDB) insertUser(name string) *db.User {
+	user := &db.User{ID: newID(), Name: name, CreatedAt: now()}
+	me.users = append(me.users, user)
+	return user
+}
+
+func (me *MemoryDB) linkUserKey(userID string, key string) error {
+	if len(me.findKeys(func(pk *db.PublicKey) bool { return pk.Key == key })) > 0 {
+		return db.ErrPublicKeyTaken
+	}
+	me.keys = append(me.keys, &db.PublicKey{ID: newID(), UserID: userID, Key: key, CreatedAt: now()})
+	return nil
+}
+
+func (me *MemoryDB) RegisterUser(username string, pubkey string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	lowerName := strings.ToLower(username)
+	valid, err := me.validateName(lowerName)
+	if !valid {
+		return nil, err
+	}
+	pk, _ := me.findPublicKeyForKey(pubkey)
+	if pk != nil {
+		return nil, db.ErrPublicKeyTaken
+	}
+
+	user := me.insertUser(lowerName)
+	err = me.linkUserKey(user.ID, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return me.findUserForKey(username, pubkey)
+}
+
+func (me *MemoryDB) RemoveUsers(userIDs []string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, userID := range userIDs {
+		me.users = slices.DeleteFunc(me.users, func(u *db.User) bool { return u.ID == userID })
+		delete(me.orgs, userID)
+		me.keys = slices.DeleteFunc(me.keys, func(pk *db.PublicKey) bool { return pk.UserID == userID })
+		me.tokens = slices.DeleteFunc(me.tokens, func(t *token) bool { return t.UserID == userID })
+		me.flags = slices.DeleteFunc(me.flags, func(ff *db.FeatureFlag) bool { return ff.UserID == userID })
+		postIDs := []string{}
+		for _, p := range me.posts {
+			if p.UserID == userID {
+				postIDs = append(postIDs, p.ID)
+			}
+		}
+		me.removePosts(postIDs)
+		for _, p := range slices.Clone(me.projects) {
+			if p.UserID == userID {
+				me.removeProject(p.ID)
+			}
+		}
+		me.digests = slices.DeleteFunc(me.digests, func(d *db.DigestSubscription) bool { return d.UserID == userID })
+		me.senders = slices.DeleteFunc(me.senders, func(s *db.PostEmailSender) bool { return s.UserID == userID })
+		me.webhooks = slices.DeleteFunc(me.webhooks, func(w *db.Webhook) bool { return w.UserID == userID })
+		me.audit = slices.DeleteFunc(me.audit, func(e *db.AuditEntry) bool { return e.UserID == userID })
+		me.trash = slices.DeleteFunc(me.trash, func(o *trashObject) bool { return o.UserID == userID })
+		me.members = slices.DeleteFunc(me.members, func(m *db.OrgMember) bool {
+			return m.OrgID == userID || m.UserID == userID
+		})
+		me.events = slices.DeleteFunc(me.events, func(e *db.ProjectEvent) bool { return e.UserID == userID })
+		me.analytics = slices.DeleteFunc(me.analytics, func(a *db.AnalyticsDay) bool { return a.UserID == userID })
+		me.bandwidth = slices.DeleteFunc(me.bandwidth, func(b *db.BandwidthMonth) bool { return b.UserID == userID })
+		delete(me.usage, userID)
+		for id, h := range me.holds {
+			if h.userID == userID {
+				delete(me.holds, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (me *MemoryDB) LinkUserKey(userID string, key string, tx *sql.Tx) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.linkUserKey(userID, key)
+}
+
+func (me *MemoryDB) findPublicKeyForKey(key string) (*db.PublicKey, error) {
+	keys := me.findKeys(func(pk *db.PublicKey) bool { return pk.Key == key })
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found for key provided")
+	}
+
+	// several users sharing a key have to log in with their username
+	if len(keys) > 1 {
+		return nil, &db.ErrMultiplePublicKeys{}
+	}
+
+	return keys[0], nil
+}
+
+func (me *MemoryDB) FindPublicKeyForKey(key string) (*db.PublicKey, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findPublicKeyForKey(key)
+}
+
+func (me *MemoryDB) FindKeysForUser(user *db.User) ([]*db.PublicKey, error) {
+	return me.ListKeysForUser(user.ID)
+}
+
+func (me *MemoryDB) RemoveKeys(keyIDs []string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.keys = slices.DeleteFunc(me.keys, func(pk *db.PublicKey) bool { return slices.Contains(keyIDs, pk.ID) })
+	return nil
+}
+
+// InsertPublicKey adds another key to an account, a key can only ever
+// belong to one account.
+func (me *MemoryDB) InsertPublicKey(userID, key string) (*db.PublicKey, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, pk := range me.findKeys(func(pk *db.PublicKey) bool { return pk.Key == key }) {
+		if pk.UserID == userID {
+			return nil, db.ErrPublicKeyExists
+		}
+		return nil, db.ErrPublicKeyTaken
+	}
+
+	pk := &db.PublicKey{ID: newID(), UserID: userID, Key: key, CreatedAt: now()}
+	me.keys = append(me.keys, pk)
+	cp := *pk
+	return &cp, nil
+}
+
+// RemovePublicKey refuses to remove the last key of an account since the
+// user would have no way to log back in.
+func (me *MemoryDB) RemovePublicKey(userID, keyID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	keys := me.findKeys(func(pk *db.PublicKey) bool { return pk.UserID == userID })
+	if !slices.ContainsFunc(keys, func(pk *db.PublicKey) bool { return pk.ID == keyID }) {
+		return fmt.Errorf("public key (%s) not found", keyID)
+	}
+	if len(keys) <= 1 {
+		return db.ErrLastPublicKey
+	}
+	me.keys = slices.DeleteFunc(me.keys, func(pk *db.PublicKey) bool { return pk.ID == keyID })
+	return nil
+}
+
+func (me *MemoryDB) ListKeysForUser(userID string) ([]*db.PublicKey, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	keys := me.findKeys(func(pk *db.PublicKey) bool { return pk.UserID == userID })
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(*keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (me *MemoryDB) FindSiteAnalytics(space string) (*db.Analytics, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	t := time.Now()
+	year, month, _ := t.Date()
+	begMonth := time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+
+	analytics := &db.Analytics{TotalUsers: len(me.users)}
+	for _, user := range me.users {
+		if !user.CreatedAt.Before(begMonth) {
+			analytics.UsersLastMonth += 1
+		}
+		if slices.ContainsFunc(me.posts, func(p *post) bool { return p.UserID == user.ID && p.Space == space }) {
+			analytics.UsersWithPost += 1
+		}
+	}
+	for _, p := range me.posts {
+		if p.Space != space {
+			continue
+		}
+		analytics.TotalPosts += 1
+		if !p.CreatedAt.Before(begMonth) {
+			analytics.PostsLastMonth += 1
+		}
+	}
+	return analytics, nil
+}
+
+func (me *MemoryDB) findUserForKey(username string, key string) (*db.User, error) {
+	pk, err := me.findPublicKeyForKey(key)
+	if err == nil {
+		user := me.findUser(pk.UserID)
+		if user == nil {
+			return nil, sql.ErrNoRows
+		}
+		found := copyUser(user)
+		found.PublicKey = pk
+		return found, nil
+	}
+
+	var multiple *db.ErrMultiplePublicKeys
+	if errors.As(err, &multiple) {
+		user, err := me.findUserForNameAndKey(username, key)
+		if err != nil {
+			return nil, &db.ErrMultiplePublicKeys{}
+		}
+		return user, nil
+	}
+
+	return nil, err
+}
+
+func (me *MemoryDB) FindUserForKey(username string, key string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findUserForKey(username, key)
+}
+
+func (me *MemoryDB) FindUser(userID string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	user := me.findUser(userID)
+	if user == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(user), nil
+}
+
+func (me *MemoryDB) ValidateName(name string) (bool, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.validateName(name)
+}
+
+func (me *MemoryDB) FindUserForName(name string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	user := me.findUserForName(name)
+	if user == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(user), nil
+}
+
+func (me *MemoryDB) findUserForNameAndKey(name string, key string) (*db.User, error) {
+	user := me.findUserForName(name)
+	if user == nil {
+		return nil, sql.ErrNoRows
+	}
+	keys := me.findKeys(func(pk *db.PublicKey) bool { return pk.UserID == user.ID && pk.Key == key })
+	if len(keys) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	found := copyUser(user)
+	found.PublicKey = keys[0]
+	return found, nil
+}
+
+func (me *MemoryDB) FindUserForNameAndKey(name string, key string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.findUserForNameAndKey(name, key)
+}
+
+func (me *MemoryDB) FindUserForToken(tkn string) (*db.User, error) {
+	return me.FindUserForScopedToken(tkn, db.TokenScopeDefault)
+}
+
+func (me *MemoryDB) FindUserForScopedToken(tkn, scope string) (*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, t := range me.tokens {
+		if t.value != tkn || t.Scope != scope || !t.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		user := me.findUser(t.UserID)
+		if user == nil {
+			break
+		}
+		return copyUser(user), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (me *MemoryDB) SetUserName(userID string, name string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	lowerName := strings.ToLower(name)
+	valid, err := me.validateName(lowerName)
+	if !valid {
+		return err
+	}
+	if user := me.findUser(userID); user != nil {
+		user.Name = lowerName
+	}
+	return nil
+}
+
+func (me *MemoryDB) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	user := me.findUser(userID)
+	if user == nil {
+		return nil
+	}
+	user.SuspendedAt = nil
+	if suspended {
+		user.SuspendedAt = now()
+	}
+	return nil
+}
+
+func (me *MemoryDB) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	user := me.findUser(userID)
+	if user == nil {
+		return nil
+	}
+	user.ReadOnlyAt = nil
+	if readOnly {
+		user.ReadOnlyAt = now()
+	}
+	return nil
+}
+
+func (me *MemoryDB) FindUserSummaries(filter string) ([]*db.UserSummary, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	summaries := []*db.UserSummary{}
+	for _, user := range me.sortedUsers() {
+		if !strings.Contains(user.Name, filter) {
+			continue
+		}
+		summary := &db.UserSummary{User: copyUser(user), Features: []string{}}
+		for _, p := range me.projects {
+			if p.UserID == user.ID {
+				summary.Projects += 1
+			}
+		}
+		for _, ff := range me.flags {
+			if ff.UserID == user.ID && ff.IsValid() && !slices.Contains(summary.Features, ff.Name) {
+				summary.Features = append(summary.Features, ff.Name)
+			}
+		}
+		slices.Sort(summary.Features)
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// expireFeature ends the flags of that name that are still active.
+func (me *MemoryDB) expireFeature(userID, name string, at time.Time) {
+	for _, ff := range me.flags {
+		if ff.UserID == userID && ff.Name == name && ff.ExpiresAt.After(at) {
+			expiresAt := at
+			ff.ExpiresAt = &expiresAt
+		}
+	}
+}
+
+func (me *MemoryDB) insertFeature(userID, name string, data db.FeatureFlagData, expiresAt time.Time) {
+	me.flags = append(me.flags, &db.FeatureFlag{
+		ID:        newID(),
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: now(),
+		ExpiresAt: &expiresAt,
+		Data:      data,
+	})
+}
+
+func (me *MemoryDB) SetFeatureForUser(userID, name string, data db.FeatureFlagData, expiresAt time.Time) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.expireFeature(userID, name, time.Now())
+	me.insertFeature(userID, name, data, expiresAt)
+	return nil
+}
+
+func (me *MemoryDB) RemoveFeatureForUser(userID, name string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.expireFeature(userID, name, time.Now())
+	return nil
+}
+
+func (me *MemoryDB) RemoveTokensForUser(userID string) (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	count := len(me.tokens)
+	me.tokens = slices.DeleteFunc(me.tokens, func(t *token) bool { return t.UserID == userID })
+	return count - len(me.tokens), nil
+}
+
+func (me *MemoryDB) sortedUsers() []*db.User {
+	users := slices.Clone(me.users)
+	sort.SliceStable(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+func (me *MemoryDB) FindUsers() ([]*db.User, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	users := []*db.User{}
+	for _, user := range me.sortedUsers() {
+		users = append(users, copyUser(user))
+	}
+	return users, nil
+}
+
+func (me *MemoryDB) FindTokensForUser(userID string) ([]*db.Token, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	tokens := []*db.Token{}
+	for _, t := range me.tokens {
+		if t.UserID == userID {
+			cp := t.Token
+			tokens = append(tokens, &cp)
+		}
+	}
+	return tokens, nil
+}
+
+func (me *MemoryDB) InsertToken(userID, name string) (string, error) {
+	return me.InsertScopedToken(userID, name, db.TokenScopeDefault)
+}
+
+func (me *MemoryDB) InsertScopedToken(userID, name, scope string) (string, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, t := range me.tokens {
+		if t.UserID == userID && t.Name == name {
+			return "", fmt.Errorf("token (%s) already exists", name)
+		}
+	}
+	expiresAt := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := &token{
+		Token: db.Token{ID: newID(), UserID: userID, Name: name, Scope: scope, CreatedAt: now(), ExpiresAt: &expiresAt},
+		value: newID(),
+	}
+	me.tokens = append(me.tokens, t)
+	return t.value, nil
+}
+
+func (me *MemoryDB) RemoveToken(tokenID string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.tokens = slices.DeleteFunc(me.tokens, func(t *token) bool { return t.ID == tokenID })
+	return nil
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/picosh/pico/db/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbpool := NewDB(slog.Default())
+	defer dbpool.Close()
+	dbtest.Run(t, dbpool)
+}
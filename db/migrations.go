@@ -0,0 +1,37 @@
+package db
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Migration is one embedded sql file, its version is the file name
+// without the extension, e.g. 20240315_add_webhooks.
+type Migration struct {
+	Version string
+	SQL     string
+}
+
+// ReadMigrations lists the migrations in fsys in the order they apply.
+func ReadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	migrations := []Migration{}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{
+			Version: strings.TrimSuffix(path.Base(name), ".sql"),
+			SQL:     string(data),
+		})
+	}
+	return migrations, nil
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20240301_b.sql": {Data: []byte("SELECT 2;")},
+		"20220310_a.sql": {Data: []byte("SELECT 1;")},
+		"README.md":      {Data: []byte("not a migration")},
+	}
+	found, err := ReadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Migration{
+		{Version: "20220310_a", SQL: "SELECT 1;"},
+		{Version: "20240301_b", SQL: "SELECT 2;"},
+	}
+	if diff := cmp.Diff(expected, found); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+
+	"github.com/picosh/pico/db"
+)
+
+// migrationLockID serializes migrations across every process that starts
+// at the same time.
+const migrationLockID = 7283491
+
+const (
+	sqlCreateSchemaVersion = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version character varying(255) NOT NULL,
+		applied_at timestamp without time zone NOT NULL DEFAULT NOW(),
+		CONSTRAINT schema_version_pkey PRIMARY KEY (version)
+	)`
+	sqlSelectSchemaVersions = `SELECT version FROM schema_version ORDER BY version ASC`
+	sqlInsertSchemaVersion  = `INSERT INTO schema_version (version) VALUES ($1) ON CONFLICT DO NOTHING`
+	sqlHasUsersTable        = `SELECT to_regclass('app_users') IS NOT NULL`
+	sqlMigrationLock        = `SELECT pg_advisory_xact_lock($1)`
+)
+
+// querier is either the pool or a transaction.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func (me *PsqlDB) appliedVersions(q querier) (map[string]bool, error) {
+	applied := map[string]bool{}
+	rs, err := q.Query(sqlSelectSchemaVersions)
+	if err != nil {
+		return applied, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var version string
+		err := rs.Scan(&version)
+		if err != nil {
+			return applied, err
+		}
+		applied[version] = true
+	}
+	return applied, rs.Err()
+}
+
+// PendingMigrations are the migrations in fsys that schema_version does not
+// list yet.
+func (me *PsqlDB) PendingMigrations(fsys fs.FS) ([]db.Migration, error) {
+	_, err := me.Db.Exec(sqlCreateSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := db.ReadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := me.appliedVersions(me.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []db.Migration{}
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every pending migration in its own transaction and
+// records it in schema_version, it returns the versions it applied.
+// A database that was set up by hand before schema_version existed is left
+// alone until it is baselined.
+func (me *PsqlDB) Migrate(fsys fs.FS) ([]string, error) {
+	pending, err := me.PendingMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := me.appliedVersions(me.Db)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 && len(pending) > 0 {
+		var hasUsers bool
+		err := me.Db.QueryRow(sqlHasUsersTable).Scan(&hasUsers)
+		if err != nil {
+			return nil, err
+		}
+		if hasUsers {
+			return nil, fmt.Errorf("database has tables but no schema version, baseline it with `migrate -baseline {version}` first")
+		}
+	}
+
+	done := []string{}
+	for _, migration := range pending {
+		applied, err := me.applyMigration(migration)
+		if err != nil {
+			return done, fmt.Errorf("migration (%s) failed: %w", migration.Version, err)
+		}
+		if applied {
+			me.Logger.Info("applied migration", "version", migration.Version)
+			done = append(done, migration.Version)
+		}
+	}
+	return done, nil
+}
+
+// applyMigration reports false when another process applied it while we
+// waited for the lock.
+func (me *PsqlDB) applyMigration(migration db.Migration) (bool, error) {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlMigrationLock, migrationLockID)
+	if err != nil {
+		return false, err
+	}
+	applied, err := me.appliedVersions(tx)
+	if err != nil {
+		return false, err
+	}
+	if applied[migration.Version] {
+		return false, nil
+	}
+
+	_, err = tx.Exec(migration.SQL)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(sqlInsertSchemaVersion, migration.Version)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Baseline marks every migration up to and including version as applied
+// without running it, for databases migrated by hand before.
+func (me *PsqlDB) Baseline(fsys fs.FS, version string) ([]string, error) {
+	migrations, err := db.ReadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, migration := range migrations {
+		if migration.Version == version {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("migration (%s) not found", version)
+	}
+
+	_, err = me.Db.Exec(sqlCreateSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	marked := []string{}
+	for _, migration := range migrations {
+		if migration.Version > version {
+			break
+		}
+		_, err := me.Db.Exec(sqlInsertSchemaVersion, migration.Version)
+		if err != nil {
+			return marked, err
+		}
+		marked = append(marked, migration.Version)
+	}
+	return marked, nil
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/sql/migrations"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	found, err := db.ReadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) == 0 || found[0].Version != "20220310_init" {
+		t.Fatalf("expected the init migration first, got %v", found)
+	}
+	seen := map[string]bool{}
+	for _, migration := range found {
+		if seen[migration.Version] {
+			t.Errorf("duplicate version (%s)", migration.Version)
+		}
+		seen[migration.Version] = true
+	}
+}
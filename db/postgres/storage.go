@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -15,13 +16,19 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+	"github.com/picosh/pico/sql/migrations"
 )
 
 var PAGER_SIZE = 15
 
+// how long a sweeper may hold an expired project before another can claim it.
+var expireClaimTimeout = 10 * time.Minute
+
 var SelectPost = `
 	posts.id, user_id, app_users.name, filename, slug, title, text, description,
-	posts.created_at, publish_at, posts.updated_at, hidden, file_size, mime_type, shasum, data, expires_at, views`
+	posts.created_at, publish_at, posts.updated_at, hidden, file_size, mime_type, shasum, data, expires_at, views, scheduled`
 
 var (
 	sqlSelectPosts = fmt.Sprintf(`
@@ -61,7 +68,7 @@ var (
 	SELECT %s
 	FROM posts
 	LEFT JOIN app_users ON app_users.id = posts.user_id
-	WHERE user_id = $1 AND publish_at::date <= CURRENT_DATE AND cur_space = $2
+	WHERE user_id = $1 AND publish_at::date <= CURRENT_DATE AND scheduled = FALSE AND cur_space = $2
 	ORDER BY posts.updated_at DESC`, SelectPost)
 
 	sqlSelectExpiredPosts = fmt.Sprintf(`
@@ -82,11 +89,27 @@ var (
 		hidden = FALSE AND
 		user_id = $1 AND
 		publish_at::date <= CURRENT_DATE AND
+		scheduled = FALSE AND
 		cur_space = $2
 	GROUP BY %s
 	ORDER BY publish_at DESC, slug DESC
 	LIMIT $3 OFFSET $4`, SelectPost, SelectPost)
 
+	sqlSearchPostsForUser = fmt.Sprintf(`
+	SELECT %s, ts_headline('english', text, search_query, 'StartSel=**, StopSel=**, MaxFragments=1, MaxWords=24, MinWords=12')
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	CROSS JOIN websearch_to_tsquery('english', $3) search_query
+	WHERE
+		hidden = FALSE AND
+		user_id = $1 AND
+		publish_at::date <= CURRENT_DATE AND
+		scheduled = FALSE AND
+		cur_space = $2 AND
+		search_vector @@ search_query
+	ORDER BY ts_rank(search_vector, search_query) DESC, publish_at DESC
+	LIMIT $4`, SelectPost)
+
 	sqlSelectAllPostsForUser = fmt.Sprintf(`
 	SELECT %s
 	FROM posts
@@ -114,8 +137,10 @@ var (
 	LEFT JOIN app_users ON app_users.id = posts.user_id
 	LEFT JOIN post_tags ON post_tags.post_id = posts.id
 	WHERE
+		hidden = FALSE AND
 		post_tags.name = $3 AND
 		publish_at::date <= CURRENT_DATE AND
+		scheduled = FALSE AND
 		cur_space = $4
 	ORDER BY publish_at DESC
 	LIMIT $1 OFFSET $2`
@@ -130,6 +155,7 @@ var (
 		user_id = $1 AND
 		(post_tags.name = $2 OR hidden = true) AND
 		publish_at::date <= CURRENT_DATE AND
+		scheduled = FALSE AND
 		cur_space = $3
 	ORDER BY publish_at DESC
 	LIMIT $4 OFFSET $5`, SelectPost)
@@ -138,19 +164,32 @@ var (
 const (
 	sqlSelectPublicKey         = `SELECT id, user_id, public_key, created_at FROM public_keys WHERE public_key = $1`
 	sqlSelectPublicKeys        = `SELECT id, user_id, public_key, created_at FROM public_keys WHERE user_id = $1`
-	sqlSelectUser              = `SELECT id, name, created_at FROM app_users WHERE id = $1`
-	sqlSelectUserForName       = `SELECT id, name, created_at FROM app_users WHERE name = $1`
-	sqlSelectUserForNameAndKey = `SELECT app_users.id, app_users.name, app_users.created_at, public_keys.id as pk_id, public_keys.public_key, public_keys.created_at as pk_created_at FROM app_users LEFT JOIN public_keys ON public_keys.user_id = app_users.id WHERE app_users.name = $1 AND public_keys.public_key = $2`
-	sqlSelectUsers             = `SELECT id, name, created_at FROM app_users ORDER BY name ASC`
+	sqlListKeysForUser         = `SELECT id, user_id, public_key, created_at FROM public_keys WHERE user_id = $1 ORDER BY created_at ASC`
+	sqlLockKeysForUser         = `SELECT id FROM public_keys WHERE user_id = $1 FOR UPDATE`
+	sqlAddPublicKey            = `INSERT INTO public_keys (user_id, public_key) VALUES ($1, $2) RETURNING id, created_at`
+	sqlSelectUser              = `SELECT id, name, created_at, suspended_at, read_only_at FROM app_users WHERE id = $1`
+	sqlSelectUserForName       = `SELECT id, name, created_at, suspended_at, read_only_at FROM app_users WHERE name = $1`
+	sqlSelectUserForNameAndKey = `SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at, public_keys.id as pk_id, public_keys.public_key, public_keys.created_at as pk_created_at FROM app_users LEFT JOIN public_keys ON public_keys.user_id = app_users.id WHERE app_users.name = $1 AND public_keys.public_key = $2`
+	sqlSelectUsers             = `SELECT id, name, created_at, suspended_at, read_only_at FROM app_users ORDER BY name ASC`
 
 	sqlSelectUserForToken = `
-	SELECT app_users.id, app_users.name, app_users.created_at
+	SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at
 	FROM app_users
 	LEFT JOIN tokens ON tokens.user_id = app_users.id
-	WHERE tokens.token = $1 AND tokens.expires_at > NOW()`
-	sqlInsertToken         = `INSERT INTO tokens (user_id, name) VALUES($1, $2) RETURNING token;`
+	WHERE tokens.token = $1 AND tokens.scope = $2 AND tokens.expires_at > NOW()`
+	sqlInsertToken         = `INSERT INTO tokens (user_id, name, scope) VALUES($1, $2, $3) RETURNING token;`
 	sqlRemoveToken         = `DELETE FROM tokens WHERE id = $1`
-	sqlSelectTokensForUser = `SELECT id, user_id, name, created_at, expires_at FROM tokens WHERE user_id = $1`
+	sqlRemoveTokensForUser = `DELETE FROM tokens WHERE user_id = $1`
+	sqlSelectUserSummaries = `
+	SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at,
+		(SELECT count(*) FROM projects WHERE projects.user_id = app_users.id),
+		(SELECT string_agg(DISTINCT name, ',') FROM feature_flags WHERE feature_flags.user_id = app_users.id AND feature_flags.expires_at > NOW())
+	FROM app_users
+	WHERE COALESCE(app_users.name, '') LIKE '%' || $1 || '%'
+	ORDER BY app_users.name ASC`
+	sqlInsertFeatureForUser = `INSERT INTO feature_flags (user_id, name, data, expires_at) VALUES ($1, $2, $3, $4)`
+	sqlExpireFeatureForUser = `UPDATE feature_flags SET expires_at = $3 WHERE user_id = $1 AND name = $2 AND expires_at > $3`
+	sqlSelectTokensForUser  = `SELECT id, user_id, name, scope, created_at, expires_at FROM tokens WHERE user_id = $1`
 
 	sqlSelectTotalUsers          = `SELECT count(id) FROM app_users`
 	sqlSelectUsersAfterDate      = `SELECT count(id) FROM app_users WHERE created_at >= $1`
@@ -158,8 +197,16 @@ const (
 	sqlSelectTotalPostsAfterDate = `SELECT count(id) FROM posts WHERE created_at >= $1 AND cur_space = $2`
 	sqlSelectUsersWithPost       = `SELECT count(app_users.id) FROM app_users WHERE EXISTS (SELECT 1 FROM posts WHERE user_id = app_users.id AND cur_space = $1);`
 
-	sqlSelectFeatureForUser = `SELECT id, user_id, payment_history_id, name, data, created_at, expires_at FROM feature_flags WHERE user_id = $1 AND name = $2 ORDER BY expires_at DESC LIMIT 1`
-	sqlSelectSizeForUser    = `SELECT COALESCE(sum(file_size), 0) FROM posts WHERE user_id = $1`
+	sqlSelectFeatureForUser   = `SELECT id, user_id, payment_history_id, name, data, created_at, expires_at FROM feature_flags WHERE user_id = $1 AND name = $2 ORDER BY expires_at DESC LIMIT 1`
+	sqlSelectSizeForUser      = `SELECT COALESCE(sum(file_size), 0) FROM posts WHERE user_id = $1`
+	sqlSelectPostCountForUser = `SELECT count(id) FROM posts WHERE user_id = $1 AND cur_space = $2`
+	sqlSelectQuotaForUser     = `
+	SELECT quota_plans.name, quota_plans.service, quota_plans.storage_max, quota_plans.file_max, quota_plans.file_count_max
+	FROM quota_plans
+	INNER JOIN feature_flags ON feature_flags.name = quota_plans.name
+	WHERE feature_flags.user_id = $1 AND quota_plans.service = $2 AND feature_flags.expires_at > NOW()
+	ORDER BY quota_plans.storage_max DESC
+	LIMIT 1`
 
 	sqlSelectPostIdByAliasSlug = `SELECT post_id FROM post_aliases WHERE slug = $1`
 	sqlSelectTagPostCount      = `
@@ -184,7 +231,7 @@ const (
 		0 AS "score"
 	FROM posts
 	LEFT JOIN app_users ON app_users.id = posts.user_id
-	WHERE hidden = FALSE AND publish_at::date <= CURRENT_DATE AND cur_space = $3
+	WHERE hidden = FALSE AND publish_at::date <= CURRENT_DATE AND scheduled = FALSE AND cur_space = $3
 	ORDER BY updated_at DESC
 	LIMIT $1 OFFSET $2`
 	sqlSelectPostsByRank = `
@@ -212,6 +259,7 @@ const (
 	WHERE
 		hidden = FALSE AND
 		publish_at::date <= CURRENT_DATE AND
+		scheduled = FALSE AND
 		cur_space = $3
 	ORDER BY score DESC
 	LIMIT $1 OFFSET $2`
@@ -231,8 +279,8 @@ const (
 	sqlInsertPost      = `
 	INSERT INTO posts
 		(user_id, filename, slug, title, text, description, publish_at, hidden, cur_space,
-		file_size, mime_type, shasum, data, expires_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		file_size, mime_type, shasum, data, expires_at, updated_at, scheduled)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	RETURNING id`
 	sqlInsertUser      = `INSERT INTO app_users (name) VALUES($1) returning id`
 	sqlInsertTag       = `INSERT INTO post_tags (post_id, name) VALUES($1, $2) RETURNING id;`
@@ -242,27 +290,264 @@ const (
 	sqlUpdatePost = `
 	UPDATE posts
 	SET slug = $1, title = $2, text = $3, description = $4, updated_at = $5, publish_at = $6,
-		file_size = $7, shasum = $8, data = $9, hidden = $11, expires_at = $12
+		file_size = $7, shasum = $8, data = $9, hidden = $11, expires_at = $12, scheduled = $13
 	WHERE id = $10`
-	sqlUpdateUserName = `UPDATE app_users SET name = $1 WHERE id = $2`
-	sqlIncrementViews = `UPDATE posts SET views = views + 1 WHERE id = $1 RETURNING views`
+	sqlUpdateUserName        = `UPDATE app_users SET name = $1 WHERE id = $2`
+	sqlSuspendUser           = `UPDATE app_users SET suspended_at = $2, suspended_by = $3 WHERE id = $1`
+	sqlUnsuspendUser         = `UPDATE app_users SET suspended_at = NULL, suspended_by = NULL WHERE id = $1`
+	sqlSetUserReadOnly       = `UPDATE app_users SET read_only_at = $2, read_only_by = $3 WHERE id = $1`
+	sqlUnsetUserReadOnly     = `UPDATE app_users SET read_only_at = NULL, read_only_by = NULL WHERE id = $1`
+	sqlIncrementViews        = `UPDATE posts SET views = views + 1 WHERE id = $1 RETURNING views`
+	sqlPublishScheduledPosts = `
+	UPDATE posts SET scheduled = FALSE
+	WHERE id IN (
+		SELECT id FROM posts
+		WHERE scheduled = TRUE AND publish_at <= $2
+		ORDER BY publish_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, user_id, filename, slug, publish_at, cur_space`
 
 	sqlRemoveAliasesByPost = `DELETE FROM post_aliases WHERE post_id = $1`
 	sqlRemoveTagsByPost    = `DELETE FROM post_tags WHERE post_id = $1`
 	sqlRemovePosts         = `DELETE FROM posts WHERE id = ANY($1::uuid[])`
 	sqlRemoveKeys          = `DELETE FROM public_keys WHERE id = ANY($1::uuid[])`
+	sqlRemovePublicKey     = `DELETE FROM public_keys WHERE user_id = $1 AND id = $2`
 	sqlRemoveUsers         = `DELETE FROM app_users WHERE id = ANY($1::uuid[])`
 
 	sqlInsertProject        = `INSERT INTO projects (user_id, name, project_dir) VALUES ($1, $2, $3) RETURNING id;`
 	sqlUpdateProject        = `UPDATE projects SET updated_at = $3 WHERE user_id = $1 AND name = $2;`
 	sqlUpdateProjectAcl     = `UPDATE projects SET acl = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
-	sqlFindProjectByName    = `SELECT id, user_id, name, project_dir, acl, created_at, updated_at FROM projects WHERE user_id = $1 AND name = $2;`
-	sqlSelectProjectCount   = `SELECT count(id) FROM projects`
-	sqlFindProjectsByUser   = `SELECT id, user_id, name, project_dir, acl, created_at, updated_at FROM projects WHERE user_id = $1 ORDER BY name ASC, updated_at DESC;`
-	sqlFindProjectsByPrefix = `SELECT id, user_id, name, project_dir, acl, created_at, updated_at FROM projects WHERE user_id = $1 AND name = project_dir AND name ILIKE $2 ORDER BY updated_at ASC, name ASC;`
-	sqlFindProjectLinks     = `SELECT id, user_id, name, project_dir, acl, created_at, updated_at FROM projects WHERE user_id = $1 AND name != project_dir AND project_dir = $2 ORDER BY name ASC;`
-	sqlLinkToProject        = `UPDATE projects SET project_dir = $1, updated_at = $2 WHERE id = $3;`
-	sqlRemoveProject        = `DELETE FROM projects WHERE id = $1;`
+	sqlUpdateProjectCsp     = `UPDATE projects SET csp = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlUpdateProjectSitemap = `UPDATE projects SET sitemap = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlSetProjectExpiry     = `UPDATE projects SET expires_at = $2, expire_claimed_at = NULL WHERE id = $1;`
+	sqlClaimExpiredProjects = `
+	UPDATE projects SET expire_claimed_at = $2
+	WHERE id IN (
+		SELECT id FROM projects
+		WHERE expires_at < $2 AND (expire_claimed_at IS NULL OR expire_claimed_at < $3) AND
+			NOT EXISTS (
+				SELECT 1 FROM projects AS links
+				WHERE links.user_id = projects.user_id AND links.name != links.project_dir AND links.project_dir = projects.name
+			)
+		ORDER BY expires_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at;`
+	sqlUpsertProjectHeaders = `
+	INSERT INTO project_headers (project_id, rules, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (project_id) DO UPDATE SET rules = $2, updated_at = $3;`
+	sqlUpsertProjectRedirects = `
+	INSERT INTO project_redirects (project_id, rules, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (project_id) DO UPDATE SET rules = $2, updated_at = $3;`
+	sqlFindProjectByName        = `SELECT id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at FROM projects WHERE user_id = $1 AND name = $2;`
+	sqlSelectProjectCount       = `SELECT count(id) FROM projects`
+	sqlFindProjectsByUser       = `SELECT id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at FROM projects WHERE user_id = $1 ORDER BY name ASC, updated_at DESC;`
+	sqlFindProjectsByPrefix     = `SELECT id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at FROM projects WHERE user_id = $1 AND name = project_dir AND name ILIKE $2 ORDER BY updated_at ASC, name ASC;`
+	sqlFindStaleProjects        = `SELECT id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at FROM projects WHERE user_id = $1 AND updated_at < $2 ORDER BY updated_at ASC, name ASC;`
+	sqlFindProjectLinks         = `SELECT id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at FROM projects WHERE user_id = $1 AND name != project_dir AND project_dir = $2 ORDER BY name ASC;`
+	sqlLinkToProject            = `UPDATE projects SET project_dir = $1, updated_at = $2 WHERE id = $3;`
+	sqlRemoveProject            = `DELETE FROM projects WHERE id = $1;`
+	sqlFindProjectObjectCount   = `SELECT object_count FROM projects WHERE user_id = $1 AND name = $2;`
+	sqlFindObjectCountsForUser  = `SELECT name, object_count FROM projects WHERE user_id = $1 AND name = project_dir;`
+	sqlSetProjectObjectCount    = `UPDATE projects SET object_count = $3 WHERE user_id = $1 AND name = $2;`
+	sqlAdjustProjectObjectCount = `UPDATE projects SET object_count = GREATEST(object_count + $3, 0) WHERE user_id = $1 AND name = $2 AND object_count IS NOT NULL;`
+	sqlRenameProject            = `UPDATE projects SET name = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlRenameProjectDir         = `UPDATE projects SET project_dir = $3, updated_at = $4 WHERE user_id = $1 AND project_dir = $2;`
+
+	sqlInsertProjectDomain = `INSERT INTO project_domains (project_id, domain) VALUES ($1, $2) RETURNING token;`
+	sqlRemoveProjectDomain = `
+	DELETE FROM project_domains USING projects
+	WHERE projects.id = project_domains.project_id AND projects.user_id = $1 AND project_domains.domain = $2;`
+	sqlSelectProjectDomains = `
+	SELECT project_domains.id, project_domains.project_id, projects.name, project_domains.domain, project_domains.token, project_domains.verified_at, project_domains.created_at
+	FROM project_domains
+	INNER JOIN projects ON projects.id = project_domains.project_id`
+	sqlFindProjectDomains     = sqlSelectProjectDomains + ` WHERE projects.user_id = $1 ORDER BY project_domains.domain ASC;`
+	sqlFindUnverifiedDomains  = sqlSelectProjectDomains + ` WHERE project_domains.verified_at IS NULL ORDER BY project_domains.created_at ASC LIMIT $1;`
+	sqlVerifyProjectDomain    = `UPDATE project_domains SET verified_at = $2 WHERE id = $1;`
+	sqlFindDomainsToRecheck   = sqlSelectProjectDomains + ` WHERE project_domains.verified_at < $1 ORDER BY project_domains.verified_at ASC LIMIT $2;`
+	sqlUnverifyProjectDomain  = `UPDATE project_domains SET verified_at = NULL WHERE id = $1;`
+	sqlFindSubdomainForDomain = `
+	SELECT app_users.name, projects.name
+	FROM project_domains
+	INNER JOIN projects ON projects.id = project_domains.project_id
+	INNER JOIN app_users ON app_users.id = projects.user_id
+	WHERE project_domains.domain = $1 AND project_domains.verified_at IS NOT NULL;`
+
+	sqlInsertProjectDeploy = `
+	INSERT INTO project_deploys (project_id, revision, current, file_count, size)
+	VALUES ($1, $2, true, $3, $4);`
+	sqlSelectProjectDeploys = `
+	SELECT project_deploys.id, project_deploys.project_id, project_deploys.revision, project_deploys.current,
+		project_deploys.file_count, project_deploys.size, project_deploys.created_at
+	FROM project_deploys`
+	sqlFindProjectDeploys = sqlSelectProjectDeploys + ` WHERE project_deploys.project_id = $1 ORDER BY project_deploys.revision DESC;`
+	sqlFindCurrentDeploy  = sqlSelectProjectDeploys + `
+	INNER JOIN projects ON projects.id = project_deploys.project_id
+	WHERE projects.user_id = $1 AND projects.name = $2 AND project_deploys.current;`
+	sqlResetCurrentDeploy = `UPDATE project_deploys SET current = false WHERE project_id = $1 AND current;`
+	sqlSetCurrentDeploy   = `UPDATE project_deploys SET current = true WHERE project_id = $1 AND revision = $2;`
+	sqlClearCurrentDeploy = `
+	UPDATE project_deploys SET current = false FROM projects
+	WHERE projects.id = project_deploys.project_id AND projects.user_id = $1 AND projects.name = $2 AND project_deploys.current;`
+	sqlRemoveProjectDeploy = `DELETE FROM project_deploys WHERE id = $1;`
+
+	sqlInsertWebhook       = `INSERT INTO webhooks (user_id, url, secret) VALUES ($1, $2, $3) RETURNING id;`
+	sqlFindWebhooksForUser = `SELECT id, user_id, url, secret, created_at FROM webhooks WHERE user_id = $1 ORDER BY created_at ASC;`
+	sqlRemoveWebhook       = `DELETE FROM webhooks WHERE user_id = $1 AND id = $2;`
+
+	sqlInsertAuditEntry = `
+	INSERT INTO audit_log (user_id, actor_id, actor, space, action, session_id, path, remote_addr)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	sqlFindAuditLog = `
+	SELECT id, user_id, actor_id, actor, space, action, session_id, path, remote_addr, created_at
+	FROM audit_log
+	WHERE user_id = $1 AND created_at >= $2
+	ORDER BY created_at DESC
+	LIMIT $3;`
+
+	sqlSetProjectEnv = `
+	INSERT INTO project_env (project_id, key, value) VALUES ($1, $2, $3)
+	ON CONFLICT (project_id, key) DO UPDATE SET value = excluded.value, updated_at = NOW();`
+	sqlRemoveProjectEnv = `DELETE FROM project_env WHERE project_id = $1 AND key = $2;`
+	sqlFindProjectEnv   = `
+	SELECT id, project_id, key, value, created_at, updated_at
+	FROM project_env
+	WHERE project_id = $1
+	ORDER BY key ASC;`
+
+	sqlSetProjectSigningKey = `
+	INSERT INTO project_signing_keys (project_id, key) VALUES ($1, $2)
+	ON CONFLICT (project_id) DO UPDATE SET key = excluded.key, created_at = NOW();`
+	sqlRemoveProjectSigningKey = `DELETE FROM project_signing_keys WHERE project_id = $1;`
+	sqlFindProjectSigningKey   = `SELECT project_id, key, created_at FROM project_signing_keys WHERE project_id = $1;`
+
+	sqlUpsertDigestSubscription = `
+	INSERT INTO digest_subscriptions (user_id) VALUES ($1)
+	ON CONFLICT (user_id) DO UPDATE SET user_id = excluded.user_id
+	RETURNING user_id, token, unsubscribed_at, created_at;`
+	sqlUnsubscribeDigests = `
+	UPDATE digest_subscriptions SET unsubscribed_at = COALESCE(unsubscribed_at, NOW())
+	WHERE token = $1
+	RETURNING user_id, token, unsubscribed_at, created_at;`
+	sqlResubscribeDigests = `UPDATE digest_subscriptions SET unsubscribed_at = NULL WHERE user_id = $1;`
+
+	sqlAddPostEmailSender = `
+	INSERT INTO post_email_senders (user_id, email) VALUES ($1, $2)
+	ON CONFLICT (user_id, email) DO NOTHING;`
+	sqlRemovePostEmailSender = `DELETE FROM post_email_senders WHERE user_id = $1 AND email = $2;`
+	sqlFindPostEmailSenders  = `
+	SELECT user_id, email, created_at FROM post_email_senders
+	WHERE user_id = $1
+	ORDER BY email;`
+
+	sqlUpsertDomainCert = `
+	INSERT INTO domain_certs (domain, cert_pem, key_pem, expires_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (domain) DO UPDATE SET cert_pem = excluded.cert_pem, key_pem = excluded.key_pem,
+		expires_at = excluded.expires_at, updated_at = NOW();`
+	sqlFindDomainCert = `
+	SELECT id, domain, cert_pem, key_pem, expires_at, created_at, updated_at
+	FROM domain_certs
+	WHERE domain = $1;`
+	sqlFindDomainsForCerts = sqlSelectProjectDomains + `
+	LEFT JOIN domain_certs ON domain_certs.domain = project_domains.domain
+	WHERE project_domains.verified_at IS NOT NULL AND (domain_certs.id IS NULL OR domain_certs.expires_at < $1)
+	ORDER BY project_domains.domain ASC
+	LIMIT $2;`
+
+	sqlInsertTrashObject = `
+	INSERT INTO trash_objects (user_id, path, trash_path, size, expires_at)
+	VALUES ($1, $2, $3, $4, $5);`
+	sqlFindTrashObjects = `
+	SELECT id, user_id, path, trash_path, size, expires_at, created_at
+	FROM trash_objects
+	WHERE user_id = $1
+	ORDER BY created_at DESC;`
+	sqlRemoveTrashObject = `DELETE FROM trash_objects WHERE id = $1;`
+	sqlClaimExpiredTrash = `
+	UPDATE trash_objects SET purge_claimed_at = $2
+	WHERE id IN (
+		SELECT id FROM trash_objects
+		WHERE expires_at < $2 AND (purge_claimed_at IS NULL OR purge_claimed_at < $3)
+		ORDER BY expires_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, user_id, path, trash_path, size, expires_at, created_at;`
+
+	sqlInsertOrg       = `INSERT INTO orgs (id) VALUES ($1);`
+	sqlFindOrgForName  = `SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at FROM app_users INNER JOIN orgs ON orgs.id = app_users.id WHERE app_users.name = $1;`
+	sqlSelectOrgMember = `SELECT org_members.id, org_members.org_id, org_members.user_id, app_users.name, org_members.role, org_members.created_at FROM org_members INNER JOIN app_users ON app_users.id = org_members.user_id`
+	sqlSetOrgMember    = `
+	INSERT INTO org_members (org_id, user_id, role) VALUES ($1, $2, $3)
+	ON CONFLICT (org_id, user_id) DO UPDATE SET role = excluded.role;`
+	sqlRemoveOrgMember = `DELETE FROM org_members WHERE org_id = $1 AND user_id = $2;`
+
+	sqlRemoveProjectAccess = `DELETE FROM project_acls WHERE project_id = $1;`
+	sqlInsertProjectAccess = `INSERT INTO project_acls (project_id, kind, value) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`
+	sqlFindProjectAccess   = `SELECT id, project_id, kind, value, created_at FROM project_acls WHERE project_id = $1 ORDER BY created_at ASC;`
+
+	sqlInsertProjectEvent       = `INSERT INTO project_events (user_id, project_name, event, file_count) VALUES ($1, $2, $3, $4);`
+	sqlFindProjectEventsForUser = `SELECT id, user_id, project_name, event, file_count, created_at FROM project_events WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2;`
+
+	sqlAddAnalytics = `
+	INSERT INTO analytics_daily (user_id, space, name, day, hits, uniques)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id, space, name, day)
+	DO UPDATE SET hits = analytics_daily.hits + excluded.hits, uniques = analytics_daily.uniques + excluded.uniques;`
+	sqlFindAnalytics = `
+	SELECT user_id, space, name, day, hits, uniques FROM analytics_daily
+	WHERE user_id = $1 AND space = $2 AND ($3 = '' OR name = $3) AND day >= $4
+	ORDER BY day ASC, name ASC;`
+
+	sqlAddBandwidth = `
+	INSERT INTO bandwidth_monthly (user_id, space, name, month, bytes)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, space, name, month)
+	DO UPDATE SET bytes = bandwidth_monthly.bytes + excluded.bytes;`
+	sqlFindBandwidth = `
+	SELECT user_id, space, name, month, bytes FROM bandwidth_monthly
+	WHERE user_id = $1 AND space = $2 AND month = $3
+	ORDER BY bytes DESC, name ASC;`
+
+	sqlUpsertObjectManifest = `
+	INSERT INTO object_manifests (bucket, path, checksum, size, meta, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (bucket, path)
+	DO UPDATE SET checksum = $3, size = $4, meta = $5, updated_at = $6;`
+	sqlSelectObjectManifests  = `SELECT bucket, path, checksum, size, meta, updated_at FROM object_manifests`
+	sqlFindObjectManifest     = sqlSelectObjectManifests + ` WHERE bucket = $1 AND path = $2;`
+	sqlFindObjectManifests    = sqlSelectObjectManifests + ` WHERE bucket = $1 AND starts_with(path, $2) ORDER BY path ASC;`
+	sqlRemoveObjectManifest   = `DELETE FROM object_manifests WHERE bucket = $1 AND path = $2;`
+	sqlCountObjectManifestRef = `SELECT count(*) FROM object_manifests WHERE bucket = $1 AND checksum = $2;`
+
+	sqlSeedStorageUsage = `
+	INSERT INTO storage_usage (user_id, used) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO NOTHING;`
+	sqlLockStorageUsage  = `SELECT used FROM storage_usage WHERE user_id = $1 FOR UPDATE;`
+	sqlFindStorageHeld   = `SELECT COALESCE(SUM(size), 0) FROM storage_holds WHERE user_id = $1 AND expires_at > $2 AND (project_name = '' OR project_name != $3);`
+	sqlInsertStorageHold = `INSERT INTO storage_holds (user_id, size, expires_at, project_name) VALUES ($1, $2, $3, $4) RETURNING id;`
+	sqlRemoveStorageHold = `DELETE FROM storage_holds WHERE id = $1;`
+	sqlRemoveReservation = `DELETE FROM storage_holds WHERE user_id = $1 AND project_name = $2;`
+	sqlAddStorageUsage   = `UPDATE storage_usage SET used = GREATEST(used + $2, 0) WHERE user_id = $1;`
+	sqlSetStorageUsage   = `
+	UPDATE storage_usage SET used = $2, reconciled_at = $3
+	WHERE user_id = $1 AND NOT EXISTS (
+		SELECT 1 FROM storage_holds WHERE user_id = $1 AND expires_at > $3 AND project_name = ''
+	);`
+	sqlFindStorageUsages = `
+	SELECT user_id, used, COALESCE((
+		SELECT SUM(size) FROM storage_holds
+		WHERE storage_holds.user_id = storage_usage.user_id AND expires_at > $1
+	), 0), reconciled_at
+	FROM storage_usage
+	ORDER BY reconciled_at ASC;`
+	sqlRemoveExpiredStorageHolds = `DELETE FROM storage_holds WHERE expires_at < $1;`
 )
 
 type PsqlDB struct {
@@ -295,6 +580,7 @@ func CreatePostFromRow(r RowScanner) (*db.Post, error) {
 		&post.Data,
 		&post.ExpiresAt,
 		&post.Views,
+		&post.Scheduled,
 	)
 	if err != nil {
 		return nil, err
@@ -324,6 +610,7 @@ func CreatePostWithTagsFromRow(r RowScanner) (*db.Post, error) {
 		&post.Data,
 		&post.ExpiresAt,
 		&post.Views,
+		&post.Scheduled,
 		&tagStr,
 	)
 	if err != nil {
@@ -354,6 +641,13 @@ func NewDB(databaseUrl string, logger *slog.Logger) *PsqlDB {
 		d.Logger.Error(err.Error())
 	}
 	d.Db = db
+
+	if shared.GetEnv("DATABASE_AUTO_MIGRATE", "false") == "true" {
+		_, err := d.Migrate(migrations.FS)
+		if err != nil {
+			d.Logger.Error("could not migrate database", "err", err.Error())
+		}
+	}
 	return d
 }
 
@@ -481,6 +775,107 @@ func (me *PsqlDB) RemoveKeys(keyIDs []string) error {
 	return err
 }
 
+// InsertPublicKey adds another key to an account, a key can only ever
+// belong to one account.
+func (me *PsqlDB) InsertPublicKey(userID, key string) (*db.PublicKey, error) {
+	rs, err := me.Db.Query(sqlSelectPublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		pk := &db.PublicKey{}
+		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Key, &pk.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if pk.UserID == userID {
+			return nil, db.ErrPublicKeyExists
+		}
+		return nil, db.ErrPublicKeyTaken
+	}
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	pk := &db.PublicKey{UserID: userID, Key: key}
+	err = me.Db.QueryRow(sqlAddPublicKey, userID, key).Scan(&pk.ID, &pk.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// RemovePublicKey refuses to remove the last key of an account since the
+// user would have no way to log back in.
+func (me *PsqlDB) RemovePublicKey(userID, keyID string) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// lock every key of the user so two removals can't both see a spare
+	rs, err := tx.Query(sqlLockKeysForUser, userID)
+	if err != nil {
+		return err
+	}
+	found := false
+	count := 0
+	for rs.Next() {
+		var id string
+		err := rs.Scan(&id)
+		if err != nil {
+			rs.Close()
+			return err
+		}
+		if id == keyID {
+			found = true
+		}
+		count += 1
+	}
+	rs.Close()
+	if rs.Err() != nil {
+		return rs.Err()
+	}
+
+	if !found {
+		return fmt.Errorf("public key (%s) not found", keyID)
+	}
+	if count <= 1 {
+		return db.ErrLastPublicKey
+	}
+
+	_, err = tx.Exec(sqlRemovePublicKey, userID, keyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (me *PsqlDB) ListKeysForUser(userID string) ([]*db.PublicKey, error) {
+	keys := []*db.PublicKey{}
+	rs, err := me.Db.Query(sqlListKeysForUser, userID)
+	if err != nil {
+		return keys, err
+	}
+	for rs.Next() {
+		pk := &db.PublicKey{}
+		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Key, &pk.CreatedAt)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, pk)
+	}
+	if rs.Err() != nil {
+		return keys, rs.Err()
+	}
+	return keys, nil
+}
+
 func (me *PsqlDB) FindSiteAnalytics(space string) (*db.Analytics, error) {
 	analytics := &db.Analytics{}
 	r := me.Db.QueryRow(sqlSelectTotalUsers)
@@ -574,7 +969,7 @@ func (me *PsqlDB) FindUser(userID string) (*db.User, error) {
 	user := &db.User{}
 	var un sql.NullString
 	r := me.Db.QueryRow(sqlSelectUser, userID)
-	err := r.Scan(&user.ID, &un, &user.CreatedAt)
+	err := r.Scan(&user.ID, &un, &user.CreatedAt, &user.SuspendedAt, &user.ReadOnlyAt)
 	if err != nil {
 		return nil, err
 	}
@@ -603,7 +998,7 @@ func (me *PsqlDB) ValidateName(name string) (bool, error) {
 func (me *PsqlDB) FindUserForName(name string) (*db.User, error) {
 	user := &db.User{}
 	r := me.Db.QueryRow(sqlSelectUserForName, strings.ToLower(name))
-	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt)
+	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt, &user.SuspendedAt, &user.ReadOnlyAt)
 	if err != nil {
 		return nil, err
 	}
@@ -615,7 +1010,7 @@ func (me *PsqlDB) FindUserForNameAndKey(name string, key string) (*db.User, erro
 	pk := &db.PublicKey{}
 
 	r := me.Db.QueryRow(sqlSelectUserForNameAndKey, strings.ToLower(name), key)
-	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt, &pk.ID, &pk.Key, &pk.CreatedAt)
+	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt, &user.SuspendedAt, &user.ReadOnlyAt, &pk.ID, &pk.Key, &pk.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -625,10 +1020,14 @@ func (me *PsqlDB) FindUserForNameAndKey(name string, key string) (*db.User, erro
 }
 
 func (me *PsqlDB) FindUserForToken(token string) (*db.User, error) {
+	return me.FindUserForScopedToken(token, db.TokenScopeDefault)
+}
+
+func (me *PsqlDB) FindUserForScopedToken(token, scope string) (*db.User, error) {
 	user := &db.User{}
 
-	r := me.Db.QueryRow(sqlSelectUserForToken, token)
-	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt)
+	r := me.Db.QueryRow(sqlSelectUserForToken, token, scope)
+	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt, &user.SuspendedAt, &user.ReadOnlyAt)
 	if err != nil {
 		return nil, err
 	}
@@ -647,6 +1046,26 @@ func (me *PsqlDB) SetUserName(userID string, name string) error {
 	return err
 }
 
+func (me *PsqlDB) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	var err error
+	if suspended {
+		_, err = me.Db.Exec(sqlSuspendUser, userID, time.Now(), operatorID)
+	} else {
+		_, err = me.Db.Exec(sqlUnsuspendUser, userID)
+	}
+	return err
+}
+
+func (me *PsqlDB) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	var err error
+	if readOnly {
+		_, err = me.Db.Exec(sqlSetUserReadOnly, userID, time.Now(), operatorID)
+	} else {
+		_, err = me.Db.Exec(sqlUnsetUserReadOnly, userID)
+	}
+	return err
+}
+
 func (me *PsqlDB) FindPostWithFilename(filename string, persona_id string, space string) (*db.Post, error) {
 	r := me.Db.QueryRow(sqlSelectPostWithFilename, filename, persona_id, space)
 	post, err := CreatePostWithTagsFromRow(r)
@@ -767,6 +1186,7 @@ func (me *PsqlDB) InsertPost(post *db.Post) (*db.Post, error) {
 		post.Data,
 		post.ExpiresAt,
 		post.UpdatedAt,
+		post.Scheduled,
 	).Scan(&id)
 	if err != nil {
 		return nil, err
@@ -790,6 +1210,7 @@ func (me *PsqlDB) UpdatePost(post *db.Post) (*db.Post, error) {
 		post.ID,
 		post.Hidden,
 		post.ExpiresAt,
+		post.Scheduled,
 	)
 	if err != nil {
 		return nil, err
@@ -936,6 +1357,74 @@ func (me *PsqlDB) AddViewCount(postID string) (int, error) {
 	return views, nil
 }
 
+func (me *PsqlDB) FindUserSummaries(filter string) ([]*db.UserSummary, error) {
+	summaries := []*db.UserSummary{}
+	rs, err := me.Db.Query(sqlSelectUserSummaries, filter)
+	if err != nil {
+		return summaries, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var name, features sql.NullString
+		summary := &db.UserSummary{User: &db.User{}}
+		err := rs.Scan(
+			&summary.ID,
+			&name,
+			&summary.CreatedAt,
+			&summary.SuspendedAt,
+			&summary.ReadOnlyAt,
+			&summary.Projects,
+			&features,
+		)
+		if err != nil {
+			return summaries, err
+		}
+		summary.Name = name.String
+		summary.Features = []string{}
+		if features.String != "" {
+			summary.Features = strings.Split(features.String, ",")
+			slices.Sort(summary.Features)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rs.Err()
+}
+
+func (me *PsqlDB) SetFeatureForUser(userID, name string, data db.FeatureFlagData, expiresAt time.Time) error {
+	tx, err := me.Db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// a longer grant left around would win over the new one
+	_, err = tx.Exec(sqlExpireFeatureForUser, userID, name, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sqlInsertFeatureForUser, userID, name, data, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (me *PsqlDB) RemoveFeatureForUser(userID, name string) error {
+	_, err := me.Db.Exec(sqlExpireFeatureForUser, userID, name, time.Now())
+	return err
+}
+
+func (me *PsqlDB) RemoveTokensForUser(userID string) (int, error) {
+	res, err := me.Db.Exec(sqlRemoveTokensForUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
 func (me *PsqlDB) FindUsers() ([]*db.User, error) {
 	var users []*db.User
 	rs, err := me.Db.Query(sqlSelectUsers)
@@ -949,6 +1438,8 @@ func (me *PsqlDB) FindUsers() ([]*db.User, error) {
 			&user.ID,
 			&name,
 			&user.CreatedAt,
+			&user.SuspendedAt,
+			&user.ReadOnlyAt,
 		)
 		if err != nil {
 			return users, err
@@ -1199,6 +1690,23 @@ func (me *PsqlDB) FindFeatureForUser(userID string, feature string) (*db.Feature
 	return ff, nil
 }
 
+// FindQuotaForUser returns the largest plan a user holds an active feature
+// flag for within a service.
+func (me *PsqlDB) FindQuotaForUser(userID string, feature string) (*db.Quota, error) {
+	quota := &db.Quota{}
+	err := me.Db.QueryRow(sqlSelectQuotaForUser, userID, feature).Scan(
+		&quota.Plan,
+		&quota.Service,
+		&quota.StorageMax,
+		&quota.FileMax,
+		&quota.FileCountMax,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
 func (me *PsqlDB) HasFeatureForUser(userID string, feature string) bool {
 	ff, err := me.FindFeatureForUser(userID, feature)
 	if err != nil {
@@ -1207,6 +1715,31 @@ func (me *PsqlDB) HasFeatureForUser(userID string, feature string) bool {
 	return ff.IsValid()
 }
 
+func (me *PsqlDB) HasAnyFeatureForUser(userID string, features ...string) (bool, error) {
+	for _, feature := range features {
+		ff, err := me.FindFeatureForUser(userID, feature)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if ff.IsValid() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (me *PsqlDB) FindPostCountForUser(userID string, space string) (int, error) {
+	var count int
+	err := me.Db.QueryRow(sqlSelectPostCountForUser, userID, space).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (me *PsqlDB) FindTotalSizeForUser(userID string) (int, error) {
 	var fileSize int
 	err := me.Db.QueryRow(sqlSelectSizeForUser, userID).Scan(&fileSize)
@@ -1296,77 +1829,81 @@ func (me *PsqlDB) UpdateProjectAcl(userID, name string, acl db.ProjectAcl) error
 	return err
 }
 
-func (me *PsqlDB) LinkToProject(userID, projectID, projectDir string, commit bool) error {
-	linkToProject, err := me.FindProjectByName(userID, projectDir)
-	if err != nil {
-		return err
-	}
-	isAlreadyLinked := linkToProject.Name != linkToProject.ProjectDir
-	sameProject := linkToProject.ID == projectID
+func (me *PsqlDB) UpdateProjectCsp(userID, name string, csp db.ProjectCsp) error {
+	_, err := me.Db.Exec(sqlUpdateProjectCsp, userID, name, csp, time.Now())
+	return err
+}
 
-	/*
-		A project linked to another project which is also linked to a
-		project is forbidden.  CI/CD Example:
-			- ProjectProd links to ProjectStaging
-			- ProjectStaging links to ProjectMain
-			- We merge `main` and trigger a deploy which uploads to ProjectMain
-			- All three get updated immediately
-		This scenario was not the intent of our CI/CD.  What we actually
-		wanted was to create a snapshot of ProjectMain and have ProjectStaging
-		link to the snapshot, but that's not the intended design of pgs.
+func (me *PsqlDB) UpdateProjectSitemap(userID, name string, sitemap bool) error {
+	_, err := me.Db.Exec(sqlUpdateProjectSitemap, userID, name, sitemap, time.Now())
+	return err
+}
 
-		So we want to close that gap here.
+func nullCount(count sql.NullInt64) *int {
+	if !count.Valid {
+		return nil
+	}
+	n := int(count.Int64)
+	return &n
+}
 
-		We ensure that `project.Name` and `project.ProjectDir` are identical
-		when there is no aliasing.
-	*/
-	if !sameProject && isAlreadyLinked {
-		return fmt.Errorf(
-			"cannot link (%s) to (%s) because it is also a link to (%s)",
-			projectID,
-			projectDir,
-			linkToProject.ProjectDir,
-		)
+// FindProjectObjectCount is nil until the project has been counted.
+func (me *PsqlDB) FindProjectObjectCount(userID, name string) (*int, error) {
+	var count sql.NullInt64
+	err := me.Db.QueryRow(sqlFindProjectObjectCount, userID, name).Scan(&count)
+	if err != nil {
+		return nil, err
 	}
+	return nullCount(count), nil
+}
 
-	if commit {
-		_, err = me.Db.Exec(
-			sqlLinkToProject,
-			projectDir,
-			time.Now(),
-			projectID,
-		)
+// FindObjectCountsForUser returns the object count of every project that
+// holds its own files, links are left out.
+func (me *PsqlDB) FindObjectCountsForUser(userID string) (map[string]*int, error) {
+	counts := map[string]*int{}
+	rs, err := me.Db.Query(sqlFindObjectCountsForUser, userID)
+	if err != nil {
+		return counts, err
 	}
-	return err
+	defer rs.Close()
+	for rs.Next() {
+		var name string
+		var count sql.NullInt64
+		err := rs.Scan(&name, &count)
+		if err != nil {
+			return counts, err
+		}
+		counts[name] = nullCount(count)
+	}
+	return counts, rs.Err()
 }
 
-func (me *PsqlDB) RemoveProject(projectID string) error {
-	_, err := me.Db.Exec(sqlRemoveProject, projectID)
+// SetProjectObjectCount records a fresh count, nil forgets it so the next
+// upload counts the project again.
+func (me *PsqlDB) SetProjectObjectCount(userID, name string, count *int) error {
+	_, err := me.Db.Exec(sqlSetProjectObjectCount, userID, name, count)
 	return err
 }
 
-func (me *PsqlDB) FindProjectByName(userID, name string) (*db.Project, error) {
-	project := &db.Project{}
-	r := me.Db.QueryRow(sqlFindProjectByName, userID, name)
-	err := r.Scan(
-		&project.ID,
-		&project.UserID,
-		&project.Name,
-		&project.ProjectDir,
-		&project.Acl,
-		&project.CreatedAt,
-		&project.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
+// AdjustProjectObjectCount leaves projects that were never counted alone.
+func (me *PsqlDB) AdjustProjectObjectCount(userID, name string, delta int) error {
+	_, err := me.Db.Exec(sqlAdjustProjectObjectCount, userID, name, delta)
+	return err
+}
 
-	return project, nil
+func (me *PsqlDB) SetProjectExpiry(projectID string, expiresAt *time.Time) error {
+	_, err := me.Db.Exec(sqlSetProjectExpiry, projectID, expiresAt)
+	return err
 }
 
-func (me *PsqlDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+// ClaimExpiredProjects marks up to limit expired projects as claimed so
+// concurrent sweepers never purge the same project. Claims older than
+// `expireClaimTimeout` are considered abandoned and can be claimed again.
+// Projects other projects link to are left alone, their links serve them.
+func (me *PsqlDB) ClaimExpiredProjects(limit int) ([]*db.Project, error) {
 	var projects []*db.Project
-	rs, err := me.Db.Query(sqlFindProjectLinks, userID, name)
+	now := time.Now()
+	rs, err := me.Db.Query(sqlClaimExpiredProjects, limit, now, now.Add(-expireClaimTimeout))
 	if err != nil {
 		return nil, err
 	}
@@ -1378,6 +1915,9 @@ func (me *PsqlDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
 			&project.Name,
 			&project.ProjectDir,
 			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
 			&project.CreatedAt,
 			&project.UpdatedAt,
 		)
@@ -1395,42 +1935,1246 @@ func (me *PsqlDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
 	return projects, nil
 }
 
-func (me *PsqlDB) FindProjectsByPrefix(userID, prefix string) ([]*db.Project, error) {
-	var projects []*db.Project
-	rs, err := me.Db.Query(sqlFindProjectsByPrefix, userID, prefix+"%")
+// PublishScheduledPosts takes up to limit scheduled posts whose publish_at
+// has passed live, every post is only ever returned to one caller.
+func (me *PsqlDB) PublishScheduledPosts(limit int) ([]*db.Post, error) {
+	rs, err := me.Db.Query(sqlPublishScheduledPosts, limit, time.Now())
 	if err != nil {
 		return nil, err
 	}
+	defer rs.Close()
+
+	posts := []*db.Post{}
 	for rs.Next() {
-		project := &db.Project{}
-		err := rs.Scan(
-			&project.ID,
-			&project.UserID,
-			&project.Name,
-			&project.ProjectDir,
-			&project.Acl,
-			&project.CreatedAt,
-			&project.UpdatedAt,
-		)
+		post := &db.Post{}
+		err := rs.Scan(&post.ID, &post.UserID, &post.Filename, &post.Slug, &post.PublishAt, &post.Space)
 		if err != nil {
 			return nil, err
 		}
-
-		projects = append(projects, project)
-	}
-
-	if rs.Err() != nil {
-		return nil, rs.Err()
+		posts = append(posts, post)
 	}
-
-	return projects, nil
+	return posts, rs.Err()
 }
 
-func (me *PsqlDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
-	var projects []*db.Project
-	rs, err := me.Db.Query(sqlFindProjectsByUser, userID)
+func (me *PsqlDB) SearchPostsForUser(userID, space, query string, limit int) ([]*db.PostSearchResult, error) {
+	results := []*db.PostSearchResult{}
+	rs, err := me.Db.Query(sqlSearchPostsForUser, userID, space, query, limit)
 	if err != nil {
-		return nil, err
+		return results, err
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		result := &db.PostSearchResult{Post: &db.Post{}}
+		post := result.Post
+		err := rs.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Username,
+			&post.Filename,
+			&post.Slug,
+			&post.Title,
+			&post.Text,
+			&post.Description,
+			&post.CreatedAt,
+			&post.PublishAt,
+			&post.UpdatedAt,
+			&post.Hidden,
+			&post.FileSize,
+			&post.MimeType,
+			&post.Shasum,
+			&post.Data,
+			&post.ExpiresAt,
+			&post.Views,
+			&post.Scheduled,
+			&result.Snippet,
+		)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, rs.Err()
+}
+
+func (me *PsqlDB) UpsertHeaders(projectID string, rules []*headers.HeaderRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = me.Db.Exec(sqlUpsertProjectHeaders, projectID, data, time.Now())
+	return err
+}
+
+func (me *PsqlDB) UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = me.Db.Exec(sqlUpsertProjectRedirects, projectID, data, time.Now())
+	return err
+}
+
+func (me *PsqlDB) InsertProjectDomain(projectID, domain string) (string, error) {
+	var token string
+	err := me.Db.QueryRow(sqlInsertProjectDomain, projectID, domain).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (me *PsqlDB) RemoveProjectDomain(userID, domain string) error {
+	res, err := me.Db.Exec(sqlRemoveProjectDomain, userID, domain)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("domain (%s) not found", domain)
+	}
+	return nil
+}
+
+func (me *PsqlDB) findProjectDomains(query string, args ...interface{}) ([]*db.ProjectDomain, error) {
+	domains := []*db.ProjectDomain{}
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return domains, err
+	}
+	for rs.Next() {
+		domain := &db.ProjectDomain{}
+		err := rs.Scan(
+			&domain.ID,
+			&domain.ProjectID,
+			&domain.ProjectName,
+			&domain.Domain,
+			&domain.Token,
+			&domain.VerifiedAt,
+			&domain.CreatedAt,
+		)
+		if err != nil {
+			return domains, err
+		}
+		domains = append(domains, domain)
+	}
+	if rs.Err() != nil {
+		return domains, rs.Err()
+	}
+	return domains, nil
+}
+
+func (me *PsqlDB) FindProjectDomains(userID string) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindProjectDomains, userID)
+}
+
+func (me *PsqlDB) FindUnverifiedDomains(limit int) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindUnverifiedDomains, limit)
+}
+
+func (me *PsqlDB) VerifyProjectDomain(domainID string) error {
+	_, err := me.Db.Exec(sqlVerifyProjectDomain, domainID, time.Now())
+	return err
+}
+
+func (me *PsqlDB) FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindDomainsToRecheck, verifiedBefore, limit)
+}
+
+func (me *PsqlDB) UnverifyProjectDomain(domainID string) error {
+	_, err := me.Db.Exec(sqlUnverifyProjectDomain, domainID)
+	return err
+}
+
+// FindSubdomainForDomain resolves a verified custom domain into the
+// `user-project` subdomain it serves.
+func (me *PsqlDB) FindSubdomainForDomain(domain string) (string, error) {
+	var username, projectName string
+	err := me.Db.QueryRow(sqlFindSubdomainForDomain, domain).Scan(&username, &projectName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", username, projectName), nil
+}
+
+// InsertProjectDeploy records a new revision and makes it the current one.
+func (me *PsqlDB) InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlResetCurrentDeploy, projectID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sqlInsertProjectDeploy, projectID, revision, fileCount, size)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (me *PsqlDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	deploys := []*db.ProjectDeploy{}
+	rs, err := me.Db.Query(sqlFindProjectDeploys, projectID)
+	if err != nil {
+		return deploys, err
+	}
+	for rs.Next() {
+		deploy := &db.ProjectDeploy{}
+		err := rs.Scan(
+			&deploy.ID,
+			&deploy.ProjectID,
+			&deploy.Revision,
+			&deploy.Current,
+			&deploy.FileCount,
+			&deploy.Size,
+			&deploy.CreatedAt,
+		)
+		if err != nil {
+			return deploys, err
+		}
+		deploys = append(deploys, deploy)
+	}
+	if rs.Err() != nil {
+		return deploys, rs.Err()
+	}
+	return deploys, nil
+}
+
+func (me *PsqlDB) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	deploy := &db.ProjectDeploy{}
+	err := me.Db.QueryRow(sqlFindCurrentDeploy, userID, projectName).Scan(
+		&deploy.ID,
+		&deploy.ProjectID,
+		&deploy.Revision,
+		&deploy.Current,
+		&deploy.FileCount,
+		&deploy.Size,
+		&deploy.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return deploy, nil
+}
+
+// SetCurrentDeploy swaps which revision of a project is served.
+func (me *PsqlDB) SetCurrentDeploy(projectID string, revision int) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlResetCurrentDeploy, projectID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(sqlSetCurrentDeploy, projectID, revision)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("revision (%d) not found", revision)
+	}
+
+	return tx.Commit()
+}
+
+// ClearCurrentDeploy goes back to serving the project directory itself.
+func (me *PsqlDB) ClearCurrentDeploy(userID, projectName string) error {
+	_, err := me.Db.Exec(sqlClearCurrentDeploy, userID, projectName)
+	return err
+}
+
+func (me *PsqlDB) RemoveProjectDeploy(deployID string) error {
+	_, err := me.Db.Exec(sqlRemoveProjectDeploy, deployID)
+	return err
+}
+
+func (me *PsqlDB) InsertWebhook(userID, url, secret string) (string, error) {
+	var id string
+	err := me.Db.QueryRow(sqlInsertWebhook, userID, url, secret).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (me *PsqlDB) FindWebhooksForUser(userID string) ([]*db.Webhook, error) {
+	webhooks := []*db.Webhook{}
+	rs, err := me.Db.Query(sqlFindWebhooksForUser, userID)
+	if err != nil {
+		return webhooks, err
+	}
+	for rs.Next() {
+		webhook := &db.Webhook{}
+		err := rs.Scan(
+			&webhook.ID,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Secret,
+			&webhook.CreatedAt,
+		)
+		if err != nil {
+			return webhooks, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if rs.Err() != nil {
+		return webhooks, rs.Err()
+	}
+	return webhooks, nil
+}
+
+func (me *PsqlDB) RemoveWebhook(userID, webhookID string) error {
+	res, err := me.Db.Exec(sqlRemoveWebhook, userID, webhookID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("webhook (%s) not found", webhookID)
+	}
+	return nil
+}
+
+func (me *PsqlDB) InsertAuditEntry(entry *db.AuditEntry) error {
+	_, err := me.Db.Exec(
+		sqlInsertAuditEntry,
+		entry.UserID,
+		entry.ActorID,
+		entry.Actor,
+		entry.Space,
+		entry.Action,
+		entry.SessionID,
+		entry.Path,
+		entry.RemoteAddr,
+	)
+	return err
+}
+
+func (me *PsqlDB) FindAuditLog(userID string, since time.Time, limit int) ([]*db.AuditEntry, error) {
+	entries := []*db.AuditEntry{}
+	rs, err := me.Db.Query(sqlFindAuditLog, userID, since, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		entry := &db.AuditEntry{}
+		err := rs.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.ActorID,
+			&entry.Actor,
+			&entry.Space,
+			&entry.Action,
+			&entry.SessionID,
+			&entry.Path,
+			&entry.RemoteAddr,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rs.Err()
+}
+
+func (me *PsqlDB) SetProjectEnv(projectID, key, value string) error {
+	_, err := me.Db.Exec(sqlSetProjectEnv, projectID, key, value)
+	return err
+}
+
+func (me *PsqlDB) RemoveProjectEnv(projectID, key string) error {
+	res, err := me.Db.Exec(sqlRemoveProjectEnv, projectID, key)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("variable (%s) not found", key)
+	}
+	return nil
+}
+
+func (me *PsqlDB) FindProjectEnv(projectID string) ([]*db.ProjectEnv, error) {
+	env := []*db.ProjectEnv{}
+	rs, err := me.Db.Query(sqlFindProjectEnv, projectID)
+	if err != nil {
+		return env, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		variable := &db.ProjectEnv{}
+		err := rs.Scan(
+			&variable.ID,
+			&variable.ProjectID,
+			&variable.Key,
+			&variable.Value,
+			&variable.CreatedAt,
+			&variable.UpdatedAt,
+		)
+		if err != nil {
+			return env, err
+		}
+		env = append(env, variable)
+	}
+	return env, rs.Err()
+}
+
+func (me *PsqlDB) SetProjectSigningKey(projectID, key string) error {
+	_, err := me.Db.Exec(sqlSetProjectSigningKey, projectID, key)
+	return err
+}
+
+func (me *PsqlDB) RemoveProjectSigningKey(projectID string) error {
+	res, err := me.Db.Exec(sqlRemoveProjectSigningKey, projectID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("signing key not found")
+	}
+	return nil
+}
+
+func (me *PsqlDB) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	key := &db.ProjectSigningKey{}
+	err := me.Db.QueryRow(sqlFindProjectSigningKey, projectID).Scan(
+		&key.ProjectID,
+		&key.Key,
+		&key.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (me *PsqlDB) UpsertDigestSubscription(userID string) (*db.DigestSubscription, error) {
+	sub := &db.DigestSubscription{}
+	err := me.Db.QueryRow(sqlUpsertDigestSubscription, userID).Scan(
+		&sub.UserID,
+		&sub.Token,
+		&sub.UnsubscribedAt,
+		&sub.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (me *PsqlDB) UnsubscribeDigests(token string) (*db.DigestSubscription, error) {
+	sub := &db.DigestSubscription{}
+	err := me.Db.QueryRow(sqlUnsubscribeDigests, token).Scan(
+		&sub.UserID,
+		&sub.Token,
+		&sub.UnsubscribedAt,
+		&sub.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("unsubscribe token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (me *PsqlDB) ResubscribeDigests(userID string) error {
+	_, err := me.Db.Exec(sqlResubscribeDigests, userID)
+	return err
+}
+
+func (me *PsqlDB) AddPostEmailSender(userID, email string) error {
+	_, err := me.Db.Exec(sqlAddPostEmailSender, userID, email)
+	return err
+}
+
+func (me *PsqlDB) RemovePostEmailSender(userID, email string) error {
+	res, err := me.Db.Exec(sqlRemovePostEmailSender, userID, email)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("email sender not found")
+	}
+	return nil
+}
+
+func (me *PsqlDB) FindPostEmailSenders(userID string) ([]*db.PostEmailSender, error) {
+	senders := []*db.PostEmailSender{}
+	rs, err := me.Db.Query(sqlFindPostEmailSenders, userID)
+	if err != nil {
+		return senders, err
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		sender := &db.PostEmailSender{}
+		err := rs.Scan(&sender.UserID, &sender.Email, &sender.CreatedAt)
+		if err != nil {
+			return senders, err
+		}
+		senders = append(senders, sender)
+	}
+	return senders, rs.Err()
+}
+
+func (me *PsqlDB) UpsertDomainCert(cert *db.DomainCert) error {
+	_, err := me.Db.Exec(sqlUpsertDomainCert, cert.Domain, cert.CertPEM, cert.KeyPEM, cert.ExpiresAt)
+	return err
+}
+
+func (me *PsqlDB) FindDomainCert(domain string) (*db.DomainCert, error) {
+	cert := &db.DomainCert{}
+	err := me.Db.QueryRow(sqlFindDomainCert, domain).Scan(
+		&cert.ID,
+		&cert.Domain,
+		&cert.CertPEM,
+		&cert.KeyPEM,
+		&cert.ExpiresAt,
+		&cert.CreatedAt,
+		&cert.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (me *PsqlDB) FindDomainsForCerts(renewBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindDomainsForCerts, renewBefore, limit)
+}
+
+func (me *PsqlDB) InsertTrashObject(obj *db.TrashObject) error {
+	_, err := me.Db.Exec(sqlInsertTrashObject, obj.UserID, obj.Path, obj.TrashPath, obj.Size, obj.ExpiresAt)
+	return err
+}
+
+func (me *PsqlDB) findTrashObjects(query string, args ...interface{}) ([]*db.TrashObject, error) {
+	objs := []*db.TrashObject{}
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		obj := &db.TrashObject{}
+		err := rs.Scan(
+			&obj.ID,
+			&obj.UserID,
+			&obj.Path,
+			&obj.TrashPath,
+			&obj.Size,
+			&obj.ExpiresAt,
+			&obj.CreatedAt,
+		)
+		if err != nil {
+			return objs, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, rs.Err()
+}
+
+func (me *PsqlDB) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	return me.findTrashObjects(sqlFindTrashObjects, userID)
+}
+
+func (me *PsqlDB) RemoveTrashObject(id string) error {
+	_, err := me.Db.Exec(sqlRemoveTrashObject, id)
+	return err
+}
+
+// ClaimExpiredTrash marks up to limit expired trash objects as claimed the
+// same way ClaimExpiredProjects does.
+func (me *PsqlDB) ClaimExpiredTrash(limit int) ([]*db.TrashObject, error) {
+	now := time.Now()
+	return me.findTrashObjects(sqlClaimExpiredTrash, limit, now, now.Add(-expireClaimTimeout))
+}
+
+func (me *PsqlDB) CreateOrg(ownerID, name string) (*db.User, error) {
+	lowerName := strings.ToLower(name)
+	valid, err := me.ValidateName(lowerName)
+	if !valid {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var id string
+	err = tx.QueryRow(sqlInsertUser, lowerName).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(sqlInsertOrg, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(sqlSetOrgMember, id, ownerID, db.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return me.FindOrgForName(lowerName)
+}
+
+func (me *PsqlDB) FindOrgForName(name string) (*db.User, error) {
+	user := &db.User{}
+	err := me.Db.QueryRow(sqlFindOrgForName, strings.ToLower(name)).Scan(
+		&user.ID,
+		&user.Name,
+		&user.CreatedAt,
+		&user.SuspendedAt,
+		&user.ReadOnlyAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func scanOrgMember(r RowScanner) (*db.OrgMember, error) {
+	member := &db.OrgMember{}
+	err := r.Scan(
+		&member.ID,
+		&member.OrgID,
+		&member.UserID,
+		&member.Name,
+		&member.Role,
+		&member.CreatedAt,
+	)
+	return member, err
+}
+
+func (me *PsqlDB) FindOrgMember(orgID, userID string) (*db.OrgMember, error) {
+	r := me.Db.QueryRow(sqlSelectOrgMember+` WHERE org_members.org_id = $1 AND org_members.user_id = $2;`, orgID, userID)
+	member, err := scanOrgMember(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, db.ErrNotOrgMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (me *PsqlDB) FindOrgMembers(orgID string) ([]*db.OrgMember, error) {
+	members := []*db.OrgMember{}
+	rs, err := me.Db.Query(sqlSelectOrgMember+` WHERE org_members.org_id = $1 ORDER BY app_users.name ASC;`, orgID)
+	if err != nil {
+		return members, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		member, err := scanOrgMember(rs)
+		if err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, rs.Err()
+}
+
+func (me *PsqlDB) SetOrgMember(orgID, userID, role string) error {
+	_, err := me.Db.Exec(sqlSetOrgMember, orgID, userID, role)
+	return err
+}
+
+func (me *PsqlDB) RemoveOrgMember(orgID, userID string) error {
+	_, err := me.Db.Exec(sqlRemoveOrgMember, orgID, userID)
+	return err
+}
+
+func (me *PsqlDB) SetProjectAccess(projectID string, entries []*db.ProjectAccess) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlRemoveProjectAccess, projectID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		_, err = tx.Exec(sqlInsertProjectAccess, projectID, entry.Kind, entry.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (me *PsqlDB) FindProjectAccess(projectID string) ([]*db.ProjectAccess, error) {
+	entries := []*db.ProjectAccess{}
+	rs, err := me.Db.Query(sqlFindProjectAccess, projectID)
+	if err != nil {
+		return entries, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		entry := &db.ProjectAccess{}
+		err := rs.Scan(
+			&entry.ID,
+			&entry.ProjectID,
+			&entry.Kind,
+			&entry.Value,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rs.Err()
+}
+
+func (me *PsqlDB) InsertProjectEvent(event *db.ProjectEvent) error {
+	_, err := me.Db.Exec(sqlInsertProjectEvent, event.UserID, event.ProjectName, event.Event, event.FileCount)
+	return err
+}
+
+func (me *PsqlDB) FindProjectEventsForUser(userID string, limit int) ([]*db.ProjectEvent, error) {
+	events := []*db.ProjectEvent{}
+	rs, err := me.Db.Query(sqlFindProjectEventsForUser, userID, limit)
+	if err != nil {
+		return events, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		event := &db.ProjectEvent{}
+		err := rs.Scan(
+			&event.ID,
+			&event.UserID,
+			&event.ProjectName,
+			&event.Event,
+			&event.FileCount,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, rs.Err()
+}
+
+func (me *PsqlDB) AddAnalytics(day *db.AnalyticsDay) error {
+	_, err := me.Db.Exec(
+		sqlAddAnalytics,
+		day.UserID,
+		day.Space,
+		day.Name,
+		day.Day.Format(time.DateOnly),
+		day.Hits,
+		day.Uniques,
+	)
+	return err
+}
+
+func (me *PsqlDB) FindAnalytics(userID, space, name string, since time.Time) ([]*db.AnalyticsDay, error) {
+	days := []*db.AnalyticsDay{}
+	rs, err := me.Db.Query(sqlFindAnalytics, userID, space, name, since.Format(time.DateOnly))
+	if err != nil {
+		return days, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		day := &db.AnalyticsDay{}
+		err := rs.Scan(&day.UserID, &day.Space, &day.Name, &day.Day, &day.Hits, &day.Uniques)
+		if err != nil {
+			return days, err
+		}
+		days = append(days, day)
+	}
+	return days, rs.Err()
+}
+
+func (me *PsqlDB) AddBandwidth(month *db.BandwidthMonth) error {
+	_, err := me.Db.Exec(
+		sqlAddBandwidth,
+		month.UserID,
+		month.Space,
+		month.Name,
+		month.Month.Format(time.DateOnly),
+		month.Bytes,
+	)
+	return err
+}
+
+func (me *PsqlDB) FindBandwidth(userID, space string, month time.Time) ([]*db.BandwidthMonth, error) {
+	months := []*db.BandwidthMonth{}
+	rs, err := me.Db.Query(sqlFindBandwidth, userID, space, month.Format(time.DateOnly))
+	if err != nil {
+		return months, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		found := &db.BandwidthMonth{}
+		err := rs.Scan(&found.UserID, &found.Space, &found.Name, &found.Month, &found.Bytes)
+		if err != nil {
+			return months, err
+		}
+		months = append(months, found)
+	}
+	return months, rs.Err()
+}
+
+func (me *PsqlDB) UpsertObjectManifest(manifest *db.ObjectManifest) error {
+	_, err := me.Db.Exec(
+		sqlUpsertObjectManifest,
+		manifest.Bucket,
+		manifest.Path,
+		manifest.Checksum,
+		manifest.Size,
+		manifest.Meta,
+		time.Now(),
+	)
+	return err
+}
+
+func scanObjectManifest(scanner interface{ Scan(...any) error }) (*db.ObjectManifest, error) {
+	manifest := &db.ObjectManifest{}
+	err := scanner.Scan(
+		&manifest.Bucket,
+		&manifest.Path,
+		&manifest.Checksum,
+		&manifest.Size,
+		&manifest.Meta,
+		&manifest.UpdatedAt,
+	)
+	return manifest, err
+}
+
+func (me *PsqlDB) FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error) {
+	return scanObjectManifest(me.Db.QueryRow(sqlFindObjectManifest, bucket, fpath))
+}
+
+// FindObjectManifests returns every path in bucket starting with prefix.
+func (me *PsqlDB) FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error) {
+	manifests := []*db.ObjectManifest{}
+	rs, err := me.Db.Query(sqlFindObjectManifests, bucket, prefix)
+	if err != nil {
+		return manifests, err
+	}
+	for rs.Next() {
+		manifest, err := scanObjectManifest(rs)
+		if err != nil {
+			return manifests, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	if rs.Err() != nil {
+		return manifests, rs.Err()
+	}
+	return manifests, nil
+}
+
+func (me *PsqlDB) RemoveObjectManifest(bucket, fpath string) error {
+	_, err := me.Db.Exec(sqlRemoveObjectManifest, bucket, fpath)
+	return err
+}
+
+// CountObjectManifestRefs is how many paths in bucket point at checksum.
+func (me *PsqlDB) CountObjectManifestRefs(bucket, checksum string) (int, error) {
+	var count int
+	err := me.Db.QueryRow(sqlCountObjectManifestRef, bucket, checksum).Scan(&count)
+	return count, err
+}
+
+func (me *PsqlDB) SeedStorageUsage(userID string, used int64) error {
+	_, err := me.Db.Exec(sqlSeedStorageUsage, userID, used)
+	return err
+}
+
+func (me *PsqlDB) ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	return me.holdStorage(userID, projectName, size, max, expiresAt, false)
+}
+
+func (me *PsqlDB) ReserveProjectStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	return me.holdStorage(userID, projectName, size, max, expiresAt, true)
+}
+
+// holdStorage locks the usage of the user so two uploads can't both see
+// the same free space. A reservation replaces the one of its project, the
+// holds of uploads name no project.
+func (me *PsqlDB) holdStorage(userID, projectName string, size, max int64, expiresAt time.Time, reservation bool) (string, error) {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// a user without usage yet starts out empty
+	_, err = tx.Exec(sqlSeedStorageUsage, userID, 0)
+	if err != nil {
+		return "", err
+	}
+	var used int64
+	err = tx.QueryRow(sqlLockStorageUsage, userID).Scan(&used)
+	if err != nil {
+		return "", err
+	}
+	var held int64
+	err = tx.QueryRow(sqlFindStorageHeld, userID, time.Now(), projectName).Scan(&held)
+	if err != nil {
+		return "", err
+	}
+	if max > 0 && used+held+size > max {
+		return "", db.ErrQuotaExceeded
+	}
+
+	holdProject := ""
+	if reservation {
+		holdProject = projectName
+		_, err = tx.Exec(sqlRemoveReservation, userID, projectName)
+		if err != nil {
+			return "", err
+		}
+	}
+	var id string
+	err = tx.QueryRow(sqlInsertStorageHold, userID, size, expiresAt, holdProject).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, tx.Commit()
+}
+
+func (me *PsqlDB) CommitStorage(userID, holdID string, delta int64) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlRemoveStorageHold, holdID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sqlAddStorageUsage, userID, delta)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (me *PsqlDB) ReleaseStorage(holdID string) error {
+	_, err := me.Db.Exec(sqlRemoveStorageHold, holdID)
+	return err
+}
+
+func (me *PsqlDB) AddStorageUsage(userID string, delta int64) error {
+	_, err := me.Db.Exec(sqlAddStorageUsage, userID, delta)
+	return err
+}
+
+func (me *PsqlDB) SetStorageUsage(userID string, used int64) (bool, error) {
+	res, err := me.Db.Exec(sqlSetStorageUsage, userID, used, time.Now())
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+func (me *PsqlDB) FindStorageUsages() ([]*db.StorageUsage, error) {
+	usages := []*db.StorageUsage{}
+	rs, err := me.Db.Query(sqlFindStorageUsages, time.Now())
+	if err != nil {
+		return usages, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		usage := &db.StorageUsage{}
+		err := rs.Scan(&usage.UserID, &usage.Used, &usage.Held, &usage.ReconciledAt)
+		if err != nil {
+			return usages, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rs.Err()
+}
+
+func (me *PsqlDB) RemoveExpiredStorageHolds() (int, error) {
+	res, err := me.Db.Exec(sqlRemoveExpiredStorageHolds, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+func (me *PsqlDB) RenameProject(userID, oldName, newName string) error {
+	_, err := me.FindProjectByName(userID, newName)
+	if err == nil {
+		return fmt.Errorf("project (%s) already exists", newName)
+	}
+
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now()
+	_, err = tx.Exec(sqlRenameProject, userID, oldName, newName, now)
+	if err != nil {
+		return err
+	}
+
+	// the project itself and any projects linking to it
+	_, err = tx.Exec(sqlRenameProjectDir, userID, oldName, newName, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (me *PsqlDB) LinkToProject(userID, projectID, projectDir string, commit bool) error {
+	linkToProject, err := me.FindProjectByName(userID, projectDir)
+	if err != nil {
+		return err
+	}
+	isAlreadyLinked := linkToProject.Name != linkToProject.ProjectDir
+	sameProject := linkToProject.ID == projectID
+
+	/*
+		A project linked to another project which is also linked to a
+		project is forbidden.  CI/CD Example:
+			- ProjectProd links to ProjectStaging
+			- ProjectStaging links to ProjectMain
+			- We merge `main` and trigger a deploy which uploads to ProjectMain
+			- All three get updated immediately
+		This scenario was not the intent of our CI/CD.  What we actually
+		wanted was to create a snapshot of ProjectMain and have ProjectStaging
+		link to the snapshot, but that's not the intended design of pgs.
+
+		So we want to close that gap here.
+
+		We ensure that `project.Name` and `project.ProjectDir` are identical
+		when there is no aliasing.
+	*/
+	if !sameProject && isAlreadyLinked {
+		return fmt.Errorf(
+			"cannot link (%s) to (%s) because it is also a link to (%s)",
+			projectID,
+			projectDir,
+			linkToProject.ProjectDir,
+		)
+	}
+
+	if commit {
+		_, err = me.Db.Exec(
+			sqlLinkToProject,
+			projectDir,
+			time.Now(),
+			projectID,
+		)
+	}
+	return err
+}
+
+func (me *PsqlDB) RemoveProject(projectID string) error {
+	_, err := me.Db.Exec(sqlRemoveProject, projectID)
+	return err
+}
+
+func (me *PsqlDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	project := &db.Project{}
+	r := me.Db.QueryRow(sqlFindProjectByName, userID, name)
+	err := r.Scan(
+		&project.ID,
+		&project.UserID,
+		&project.Name,
+		&project.ProjectDir,
+		&project.Acl,
+		&project.Csp,
+		&project.Sitemap,
+		&project.ExpiresAt,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+func (me *PsqlDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	var projects []*db.Project
+	rs, err := me.Db.Query(sqlFindProjectLinks, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	for rs.Next() {
+		project := &db.Project{}
+		err := rs.Scan(
+			&project.ID,
+			&project.UserID,
+			&project.Name,
+			&project.ProjectDir,
+			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, project)
+	}
+
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	return projects, nil
+}
+
+func (me *PsqlDB) FindProjectsByPrefix(userID, prefix string) ([]*db.Project, error) {
+	var projects []*db.Project
+	rs, err := me.Db.Query(sqlFindProjectsByPrefix, userID, prefix+"%")
+	if err != nil {
+		return nil, err
+	}
+	for rs.Next() {
+		project := &db.Project{}
+		err := rs.Scan(
+			&project.ID,
+			&project.UserID,
+			&project.Name,
+			&project.ProjectDir,
+			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, project)
+	}
+
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	return projects, nil
+}
+
+// FindStaleProjects returns the projects of a user that have not been
+// updated since updatedBefore, oldest first.
+func (me *PsqlDB) FindStaleProjects(userID string, updatedBefore time.Time) ([]*db.Project, error) {
+	var projects []*db.Project
+	rs, err := me.Db.Query(sqlFindStaleProjects, userID, updatedBefore)
+	if err != nil {
+		return nil, err
+	}
+	for rs.Next() {
+		project := &db.Project{}
+		err := rs.Scan(
+			&project.ID,
+			&project.UserID,
+			&project.Name,
+			&project.ProjectDir,
+			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, project)
+	}
+
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	return projects, nil
+}
+
+func (me *PsqlDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	var projects []*db.Project
+	rs, err := me.Db.Query(sqlFindProjectsByUser, userID)
+	if err != nil {
+		return nil, err
 	}
 	for rs.Next() {
 		project := &db.Project{}
@@ -1440,6 +3184,9 @@ func (me *PsqlDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
 			&project.Name,
 			&project.ProjectDir,
 			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
 			&project.CreatedAt,
 			&project.UpdatedAt,
 		)
@@ -1460,7 +3207,7 @@ func (me *PsqlDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
 func (me *PsqlDB) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.Project], error) {
 	var projects []*db.Project
 	sqlFindAllProjects := fmt.Sprintf(`
-	SELECT projects.id, user_id, app_users.name as username, projects.name, project_dir, projects.acl, projects.created_at, projects.updated_at
+	SELECT projects.id, user_id, app_users.name as username, projects.name, project_dir, projects.acl, projects.csp, projects.sitemap, projects.expires_at, projects.created_at, projects.updated_at
 	FROM projects
 	LEFT JOIN app_users ON app_users.id = projects.user_id
 	ORDER BY %s DESC
@@ -1478,6 +3225,9 @@ func (me *PsqlDB) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.P
 			&project.Name,
 			&project.ProjectDir,
 			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
 			&project.CreatedAt,
 			&project.UpdatedAt,
 		)
@@ -1507,8 +3257,12 @@ func (me *PsqlDB) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.P
 }
 
 func (me *PsqlDB) InsertToken(userID, name string) (string, error) {
+	return me.InsertScopedToken(userID, name, db.TokenScopeDefault)
+}
+
+func (me *PsqlDB) InsertScopedToken(userID, name, scope string) (string, error) {
 	var token string
-	err := me.Db.QueryRow(sqlInsertToken, userID, name).Scan(&token)
+	err := me.Db.QueryRow(sqlInsertToken, userID, name, scope).Scan(&token)
 	if err != nil {
 		return "", err
 	}
@@ -1528,7 +3282,7 @@ func (me *PsqlDB) FindTokensForUser(userID string) ([]*db.Token, error) {
 	}
 	for rs.Next() {
 		pk := &db.Token{}
-		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Name, &pk.CreatedAt, &pk.ExpiresAt)
+		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Name, &pk.Scope, &pk.CreatedAt, &pk.ExpiresAt)
 		if err != nil {
 			return keys, err
 		}
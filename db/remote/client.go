@@ -0,0 +1,875 @@
+package remote
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+)
+
+// Client is a db.DB whose calls are answered by a Server.
+type Client struct {
+	URL    string
+	Secret string
+	Client *http.Client
+	Logger *slog.Logger
+}
+
+var _ db.DB = (*Client)(nil)
+
+func NewDB(databaseUrl, secret string, logger *slog.Logger) *Client {
+	logger.Info("Connecting to database api", "databaseUrl", databaseUrl)
+	return &Client{
+		URL:    strings.TrimSuffix(databaseUrl, "/"),
+		Secret: secret,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Logger: logger,
+	}
+}
+
+// call sends args to method and decodes what it returned into results, in
+// order, the error of the method is returned as an *Error.
+func (me *Client) call(method string, args []any, results ...any) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, me.URL+Prefix+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "Bearer "+me.Secret)
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := me.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("database api responded with (%d): %s", resp.StatusCode, strings.TrimSpace(string(text)))
+	}
+
+	out := struct {
+		Results []json.RawMessage `json:"results"`
+		Error   *Error            `json:"error"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	if err != nil {
+		return err
+	}
+	if out.Error != nil {
+		return out.Error
+	}
+	if len(out.Results) != len(results) {
+		return fmt.Errorf("%s: expected (%d) results, got (%d)", method, len(results), len(out.Results))
+	}
+	for i, raw := range out.Results {
+		err := json.Unmarshal(raw, results[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+func (me *Client) RegisterUser(name, pubkey string) (*db.User, error) {
+	var out *db.User
+	err := me.call("RegisterUser", []any{name, pubkey}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveUsers(userIDs []string) error {
+	return me.call("RemoveUsers", []any{userIDs})
+}
+
+// LinkUserKey can not join a transaction of the caller, tx must be nil.
+func (me *Client) LinkUserKey(userID string, pubkey string, tx *sql.Tx) error {
+	if tx != nil {
+		return ErrTransaction
+	}
+	return me.call("LinkUserKey", []any{userID, pubkey, nil})
+}
+
+func (me *Client) FindPublicKeyForKey(pubkey string) (*db.PublicKey, error) {
+	var out *db.PublicKey
+	err := me.call("FindPublicKeyForKey", []any{pubkey}, &out)
+	return out, err
+}
+
+func (me *Client) FindKeysForUser(user *db.User) ([]*db.PublicKey, error) {
+	var out []*db.PublicKey
+	err := me.call("FindKeysForUser", []any{user}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveKeys(pubkeyIDs []string) error {
+	return me.call("RemoveKeys", []any{pubkeyIDs})
+}
+
+func (me *Client) InsertPublicKey(userID, pubkey string) (*db.PublicKey, error) {
+	var out *db.PublicKey
+	err := me.call("InsertPublicKey", []any{userID, pubkey}, &out)
+	return out, err
+}
+
+func (me *Client) RemovePublicKey(userID, pubkeyID string) error {
+	return me.call("RemovePublicKey", []any{userID, pubkeyID})
+}
+
+func (me *Client) ListKeysForUser(userID string) ([]*db.PublicKey, error) {
+	var out []*db.PublicKey
+	err := me.call("ListKeysForUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) FindSiteAnalytics(space string) (*db.Analytics, error) {
+	var out *db.Analytics
+	err := me.call("FindSiteAnalytics", []any{space}, &out)
+	return out, err
+}
+
+func (me *Client) FindUsers() ([]*db.User, error) {
+	var out []*db.User
+	err := me.call("FindUsers", []any{}, &out)
+	return out, err
+}
+
+func (me *Client) FindUserForName(name string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindUserForName", []any{name}, &out)
+	return out, err
+}
+
+func (me *Client) FindUserForNameAndKey(name string, pubkey string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindUserForNameAndKey", []any{name, pubkey}, &out)
+	return out, err
+}
+
+func (me *Client) FindUserForKey(name string, pubkey string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindUserForKey", []any{name, pubkey}, &out)
+	return out, err
+}
+
+func (me *Client) FindUser(userID string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) ValidateName(name string) (bool, error) {
+	var out bool
+	err := me.call("ValidateName", []any{name}, &out)
+	return out, err
+}
+
+func (me *Client) SetUserName(userID string, name string) error {
+	return me.call("SetUserName", []any{userID, name})
+}
+
+func (me *Client) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	return me.call("SetUserSuspended", []any{userID, suspended, operatorID})
+}
+
+func (me *Client) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	return me.call("SetUserReadOnly", []any{userID, readOnly, operatorID})
+}
+
+func (me *Client) FindUserForToken(token string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindUserForToken", []any{token}, &out)
+	return out, err
+}
+
+func (me *Client) FindUserForScopedToken(token, scope string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindUserForScopedToken", []any{token, scope}, &out)
+	return out, err
+}
+
+func (me *Client) FindTokensForUser(userID string) ([]*db.Token, error) {
+	var out []*db.Token
+	err := me.call("FindTokensForUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) InsertToken(userID, name string) (string, error) {
+	var out string
+	err := me.call("InsertToken", []any{userID, name}, &out)
+	return out, err
+}
+
+func (me *Client) InsertScopedToken(userID, name, scope string) (string, error) {
+	var out string
+	err := me.call("InsertScopedToken", []any{userID, name, scope}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveToken(tokenID string) error {
+	return me.call("RemoveToken", []any{tokenID})
+}
+
+func (me *Client) FindUserSummaries(filter string) ([]*db.UserSummary, error) {
+	var out []*db.UserSummary
+	err := me.call("FindUserSummaries", []any{filter}, &out)
+	return out, err
+}
+
+func (me *Client) SetFeatureForUser(userID, name string, data db.FeatureFlagData, expiresAt time.Time) error {
+	return me.call("SetFeatureForUser", []any{userID, name, data, expiresAt})
+}
+
+func (me *Client) RemoveFeatureForUser(userID, name string) error {
+	return me.call("RemoveFeatureForUser", []any{userID, name})
+}
+
+func (me *Client) RemoveTokensForUser(userID string) (int, error) {
+	var out int
+	err := me.call("RemoveTokensForUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) FindPosts() ([]*db.Post, error) {
+	var out []*db.Post
+	err := me.call("FindPosts", []any{}, &out)
+	return out, err
+}
+
+func (me *Client) FindPost(postID string) (*db.Post, error) {
+	var out *db.Post
+	err := me.call("FindPost", []any{postID}, &out)
+	return out, err
+}
+
+func (me *Client) FindPostsForUser(pager *db.Pager, userID string, space string) (*db.Paginate[*db.Post], error) {
+	var out *db.Paginate[*db.Post]
+	err := me.call("FindPostsForUser", []any{pager, userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindAllPostsForUser(userID string, space string) ([]*db.Post, error) {
+	var out []*db.Post
+	err := me.call("FindAllPostsForUser", []any{userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindPostsBeforeDate(date *time.Time, space string) ([]*db.Post, error) {
+	var out []*db.Post
+	err := me.call("FindPostsBeforeDate", []any{date, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindExpiredPosts(space string) ([]*db.Post, error) {
+	var out []*db.Post
+	err := me.call("FindExpiredPosts", []any{space}, &out)
+	return out, err
+}
+
+func (me *Client) FindUpdatedPostsForUser(userID string, space string) ([]*db.Post, error) {
+	var out []*db.Post
+	err := me.call("FindUpdatedPostsForUser", []any{userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindPostWithFilename(filename string, userID string, space string) (*db.Post, error) {
+	var out *db.Post
+	err := me.call("FindPostWithFilename", []any{filename, userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindPostWithSlug(slug string, userID string, space string) (*db.Post, error) {
+	var out *db.Post
+	err := me.call("FindPostWithSlug", []any{slug, userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindAllPosts(pager *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	var out *db.Paginate[*db.Post]
+	err := me.call("FindAllPosts", []any{pager, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindAllUpdatedPosts(pager *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	var out *db.Paginate[*db.Post]
+	err := me.call("FindAllUpdatedPosts", []any{pager, space}, &out)
+	return out, err
+}
+
+func (me *Client) InsertPost(post *db.Post) (*db.Post, error) {
+	var out *db.Post
+	err := me.call("InsertPost", []any{post}, &out)
+	return out, err
+}
+
+func (me *Client) UpdatePost(post *db.Post) (*db.Post, error) {
+	var out *db.Post
+	err := me.call("UpdatePost", []any{post}, &out)
+	return out, err
+}
+
+func (me *Client) RemovePosts(postIDs []string) error {
+	return me.call("RemovePosts", []any{postIDs})
+}
+
+func (me *Client) PublishScheduledPosts(limit int) ([]*db.Post, error) {
+	var out []*db.Post
+	err := me.call("PublishScheduledPosts", []any{limit}, &out)
+	return out, err
+}
+
+func (me *Client) SearchPostsForUser(userID, space, query string, limit int) ([]*db.PostSearchResult, error) {
+	var out []*db.PostSearchResult
+	err := me.call("SearchPostsForUser", []any{userID, space, query, limit}, &out)
+	return out, err
+}
+
+func (me *Client) ReplaceTagsForPost(tags []string, postID string) error {
+	return me.call("ReplaceTagsForPost", []any{tags, postID})
+}
+
+func (me *Client) FindUserPostsByTag(pager *db.Pager, tag, userID, space string) (*db.Paginate[*db.Post], error) {
+	var out *db.Paginate[*db.Post]
+	err := me.call("FindUserPostsByTag", []any{pager, tag, userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindPostsByTag(pager *db.Pager, tag, space string) (*db.Paginate[*db.Post], error) {
+	var out *db.Paginate[*db.Post]
+	err := me.call("FindPostsByTag", []any{pager, tag, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindPopularTags(space string) ([]string, error) {
+	var out []string
+	err := me.call("FindPopularTags", []any{space}, &out)
+	return out, err
+}
+
+func (me *Client) FindTagsForPost(postID string) ([]string, error) {
+	var out []string
+	err := me.call("FindTagsForPost", []any{postID}, &out)
+	return out, err
+}
+
+func (me *Client) ReplaceAliasesForPost(aliases []string, postID string) error {
+	return me.call("ReplaceAliasesForPost", []any{aliases, postID})
+}
+
+func (me *Client) AddViewCount(postID string) (int, error) {
+	var out int
+	err := me.call("AddViewCount", []any{postID}, &out)
+	return out, err
+}
+
+func (me *Client) AddPicoPlusUser(username string, paymentType, txId string) error {
+	return me.call("AddPicoPlusUser", []any{username, paymentType, txId})
+}
+
+func (me *Client) FindFeatureForUser(userID string, feature string) (*db.FeatureFlag, error) {
+	var out *db.FeatureFlag
+	err := me.call("FindFeatureForUser", []any{userID, feature}, &out)
+	return out, err
+}
+
+func (me *Client) HasFeatureForUser(userID string, feature string) bool {
+	var out bool
+	err := me.call("HasFeatureForUser", []any{userID, feature}, &out)
+	if err != nil {
+		me.Logger.Error("could not call HasFeatureForUser", "err", err.Error())
+	}
+	return out
+}
+
+func (me *Client) FindQuotaForUser(userID string, feature string) (*db.Quota, error) {
+	var out *db.Quota
+	err := me.call("FindQuotaForUser", []any{userID, feature}, &out)
+	return out, err
+}
+
+func (me *Client) HasAnyFeatureForUser(userID string, features ...string) (bool, error) {
+	var out bool
+	err := me.call("HasAnyFeatureForUser", []any{userID, features}, &out)
+	return out, err
+}
+
+func (me *Client) FindPostCountForUser(userID string, space string) (int, error) {
+	var out int
+	err := me.call("FindPostCountForUser", []any{userID, space}, &out)
+	return out, err
+}
+
+func (me *Client) FindTotalSizeForUser(userID string) (int, error) {
+	var out int
+	err := me.call("FindTotalSizeForUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) InsertFeedItems(postID string, items []*db.FeedItem) error {
+	return me.call("InsertFeedItems", []any{postID, items})
+}
+
+func (me *Client) FindFeedItemsByPostID(postID string) ([]*db.FeedItem, error) {
+	var out []*db.FeedItem
+	err := me.call("FindFeedItemsByPostID", []any{postID}, &out)
+	return out, err
+}
+
+func (me *Client) UpsertDigestSubscription(userID string) (*db.DigestSubscription, error) {
+	var out *db.DigestSubscription
+	err := me.call("UpsertDigestSubscription", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) UnsubscribeDigests(token string) (*db.DigestSubscription, error) {
+	var out *db.DigestSubscription
+	err := me.call("UnsubscribeDigests", []any{token}, &out)
+	return out, err
+}
+
+func (me *Client) ResubscribeDigests(userID string) error {
+	return me.call("ResubscribeDigests", []any{userID})
+}
+
+func (me *Client) AddPostEmailSender(userID, email string) error {
+	return me.call("AddPostEmailSender", []any{userID, email})
+}
+
+func (me *Client) RemovePostEmailSender(userID, email string) error {
+	return me.call("RemovePostEmailSender", []any{userID, email})
+}
+
+func (me *Client) FindPostEmailSenders(userID string) ([]*db.PostEmailSender, error) {
+	var out []*db.PostEmailSender
+	err := me.call("FindPostEmailSenders", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) InsertProject(userID, name, projectDir string) (string, error) {
+	var out string
+	err := me.call("InsertProject", []any{userID, name, projectDir}, &out)
+	return out, err
+}
+
+func (me *Client) UpdateProject(userID, name string) error {
+	return me.call("UpdateProject", []any{userID, name})
+}
+
+func (me *Client) UpdateProjectAcl(userID, name string, acl db.ProjectAcl) error {
+	return me.call("UpdateProjectAcl", []any{userID, name, acl})
+}
+
+func (me *Client) UpdateProjectCsp(userID, name string, csp db.ProjectCsp) error {
+	return me.call("UpdateProjectCsp", []any{userID, name, csp})
+}
+
+func (me *Client) UpdateProjectSitemap(userID, name string, sitemap bool) error {
+	return me.call("UpdateProjectSitemap", []any{userID, name, sitemap})
+}
+
+func (me *Client) UpsertHeaders(projectID string, rules []*headers.HeaderRule) error {
+	return me.call("UpsertHeaders", []any{projectID, rules})
+}
+
+func (me *Client) UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error {
+	return me.call("UpsertRedirects", []any{projectID, rules})
+}
+
+func (me *Client) LinkToProject(userID, projectID, projectDir string, commit bool) error {
+	return me.call("LinkToProject", []any{userID, projectID, projectDir, commit})
+}
+
+func (me *Client) RemoveProject(projectID string) error {
+	return me.call("RemoveProject", []any{projectID})
+}
+
+func (me *Client) SetProjectExpiry(projectID string, expiresAt *time.Time) error {
+	return me.call("SetProjectExpiry", []any{projectID, expiresAt})
+}
+
+func (me *Client) ClaimExpiredProjects(limit int) ([]*db.Project, error) {
+	var out []*db.Project
+	err := me.call("ClaimExpiredProjects", []any{limit}, &out)
+	return out, err
+}
+
+func (me *Client) RenameProject(userID, oldName, newName string) error {
+	return me.call("RenameProject", []any{userID, oldName, newName})
+}
+
+func (me *Client) FindProjectByName(userID, name string) (*db.Project, error) {
+	var out *db.Project
+	err := me.call("FindProjectByName", []any{userID, name}, &out)
+	return out, err
+}
+
+func (me *Client) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	var out []*db.Project
+	err := me.call("FindProjectLinks", []any{userID, name}, &out)
+	return out, err
+}
+
+func (me *Client) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	var out []*db.Project
+	err := me.call("FindProjectsByUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) FindProjectsByPrefix(userID, name string) ([]*db.Project, error) {
+	var out []*db.Project
+	err := me.call("FindProjectsByPrefix", []any{userID, name}, &out)
+	return out, err
+}
+
+func (me *Client) FindStaleProjects(userID string, updatedBefore time.Time) ([]*db.Project, error) {
+	var out []*db.Project
+	err := me.call("FindStaleProjects", []any{userID, updatedBefore}, &out)
+	return out, err
+}
+
+func (me *Client) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.Project], error) {
+	var out *db.Paginate[*db.Project]
+	err := me.call("FindAllProjects", []any{page, by}, &out)
+	return out, err
+}
+
+func (me *Client) FindProjectObjectCount(userID, name string) (*int, error) {
+	var out *int
+	err := me.call("FindProjectObjectCount", []any{userID, name}, &out)
+	return out, err
+}
+
+func (me *Client) FindObjectCountsForUser(userID string) (map[string]*int, error) {
+	var out map[string]*int
+	err := me.call("FindObjectCountsForUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) SetProjectObjectCount(userID, name string, count *int) error {
+	return me.call("SetProjectObjectCount", []any{userID, name, count})
+}
+
+func (me *Client) AdjustProjectObjectCount(userID, name string, delta int) error {
+	return me.call("AdjustProjectObjectCount", []any{userID, name, delta})
+}
+
+func (me *Client) InsertProjectDomain(projectID, domain string) (string, error) {
+	var out string
+	err := me.call("InsertProjectDomain", []any{projectID, domain}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveProjectDomain(userID, domain string) error {
+	return me.call("RemoveProjectDomain", []any{userID, domain})
+}
+
+func (me *Client) FindProjectDomains(userID string) ([]*db.ProjectDomain, error) {
+	var out []*db.ProjectDomain
+	err := me.call("FindProjectDomains", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) FindUnverifiedDomains(limit int) ([]*db.ProjectDomain, error) {
+	var out []*db.ProjectDomain
+	err := me.call("FindUnverifiedDomains", []any{limit}, &out)
+	return out, err
+}
+
+func (me *Client) VerifyProjectDomain(domainID string) error {
+	return me.call("VerifyProjectDomain", []any{domainID})
+}
+
+func (me *Client) FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	var out []*db.ProjectDomain
+	err := me.call("FindDomainsToRecheck", []any{verifiedBefore, limit}, &out)
+	return out, err
+}
+
+func (me *Client) UnverifyProjectDomain(domainID string) error {
+	return me.call("UnverifyProjectDomain", []any{domainID})
+}
+
+func (me *Client) FindSubdomainForDomain(domain string) (string, error) {
+	var out string
+	err := me.call("FindSubdomainForDomain", []any{domain}, &out)
+	return out, err
+}
+
+func (me *Client) UpsertDomainCert(cert *db.DomainCert) error {
+	return me.call("UpsertDomainCert", []any{cert})
+}
+
+func (me *Client) FindDomainCert(domain string) (*db.DomainCert, error) {
+	var out *db.DomainCert
+	err := me.call("FindDomainCert", []any{domain}, &out)
+	return out, err
+}
+
+func (me *Client) FindDomainsForCerts(renewBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	var out []*db.ProjectDomain
+	err := me.call("FindDomainsForCerts", []any{renewBefore, limit}, &out)
+	return out, err
+}
+
+func (me *Client) InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error {
+	return me.call("InsertProjectDeploy", []any{projectID, revision, fileCount, size})
+}
+
+func (me *Client) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	var out []*db.ProjectDeploy
+	err := me.call("FindProjectDeploys", []any{projectID}, &out)
+	return out, err
+}
+
+func (me *Client) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	var out *db.ProjectDeploy
+	err := me.call("FindCurrentDeploy", []any{userID, projectName}, &out)
+	return out, err
+}
+
+func (me *Client) SetCurrentDeploy(projectID string, revision int) error {
+	return me.call("SetCurrentDeploy", []any{projectID, revision})
+}
+
+func (me *Client) ClearCurrentDeploy(userID, projectName string) error {
+	return me.call("ClearCurrentDeploy", []any{userID, projectName})
+}
+
+func (me *Client) RemoveProjectDeploy(deployID string) error {
+	return me.call("RemoveProjectDeploy", []any{deployID})
+}
+
+func (me *Client) InsertWebhook(userID, url, secret string) (string, error) {
+	var out string
+	err := me.call("InsertWebhook", []any{userID, url, secret}, &out)
+	return out, err
+}
+
+func (me *Client) FindWebhooksForUser(userID string) ([]*db.Webhook, error) {
+	var out []*db.Webhook
+	err := me.call("FindWebhooksForUser", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveWebhook(userID, webhookID string) error {
+	return me.call("RemoveWebhook", []any{userID, webhookID})
+}
+
+func (me *Client) InsertAuditEntry(entry *db.AuditEntry) error {
+	return me.call("InsertAuditEntry", []any{entry})
+}
+
+func (me *Client) FindAuditLog(userID string, since time.Time, limit int) ([]*db.AuditEntry, error) {
+	var out []*db.AuditEntry
+	err := me.call("FindAuditLog", []any{userID, since, limit}, &out)
+	return out, err
+}
+
+func (me *Client) InsertTrashObject(obj *db.TrashObject) error {
+	return me.call("InsertTrashObject", []any{obj})
+}
+
+func (me *Client) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	var out []*db.TrashObject
+	err := me.call("FindTrashObjects", []any{userID}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveTrashObject(id string) error {
+	return me.call("RemoveTrashObject", []any{id})
+}
+
+func (me *Client) ClaimExpiredTrash(limit int) ([]*db.TrashObject, error) {
+	var out []*db.TrashObject
+	err := me.call("ClaimExpiredTrash", []any{limit}, &out)
+	return out, err
+}
+
+func (me *Client) SetProjectEnv(projectID, key, value string) error {
+	return me.call("SetProjectEnv", []any{projectID, key, value})
+}
+
+func (me *Client) RemoveProjectEnv(projectID, key string) error {
+	return me.call("RemoveProjectEnv", []any{projectID, key})
+}
+
+func (me *Client) FindProjectEnv(projectID string) ([]*db.ProjectEnv, error) {
+	var out []*db.ProjectEnv
+	err := me.call("FindProjectEnv", []any{projectID}, &out)
+	return out, err
+}
+
+func (me *Client) SetProjectSigningKey(projectID, key string) error {
+	return me.call("SetProjectSigningKey", []any{projectID, key})
+}
+
+func (me *Client) RemoveProjectSigningKey(projectID string) error {
+	return me.call("RemoveProjectSigningKey", []any{projectID})
+}
+
+func (me *Client) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	var out *db.ProjectSigningKey
+	err := me.call("FindProjectSigningKey", []any{projectID}, &out)
+	return out, err
+}
+
+func (me *Client) CreateOrg(ownerID, name string) (*db.User, error) {
+	var out *db.User
+	err := me.call("CreateOrg", []any{ownerID, name}, &out)
+	return out, err
+}
+
+func (me *Client) FindOrgForName(name string) (*db.User, error) {
+	var out *db.User
+	err := me.call("FindOrgForName", []any{name}, &out)
+	return out, err
+}
+
+func (me *Client) FindOrgMember(orgID, userID string) (*db.OrgMember, error) {
+	var out *db.OrgMember
+	err := me.call("FindOrgMember", []any{orgID, userID}, &out)
+	return out, err
+}
+
+func (me *Client) FindOrgMembers(orgID string) ([]*db.OrgMember, error) {
+	var out []*db.OrgMember
+	err := me.call("FindOrgMembers", []any{orgID}, &out)
+	return out, err
+}
+
+func (me *Client) SetOrgMember(orgID, userID, role string) error {
+	return me.call("SetOrgMember", []any{orgID, userID, role})
+}
+
+func (me *Client) RemoveOrgMember(orgID, userID string) error {
+	return me.call("RemoveOrgMember", []any{orgID, userID})
+}
+
+func (me *Client) SetProjectAccess(projectID string, entries []*db.ProjectAccess) error {
+	return me.call("SetProjectAccess", []any{projectID, toAccessEntries(entries)})
+}
+
+func (me *Client) FindProjectAccess(projectID string) ([]*db.ProjectAccess, error) {
+	var out []*accessEntry
+	err := me.call("FindProjectAccess", []any{projectID}, &out)
+	return fromAccessEntries(out), err
+}
+
+func (me *Client) InsertProjectEvent(event *db.ProjectEvent) error {
+	return me.call("InsertProjectEvent", []any{event})
+}
+
+func (me *Client) FindProjectEventsForUser(userID string, limit int) ([]*db.ProjectEvent, error) {
+	var out []*db.ProjectEvent
+	err := me.call("FindProjectEventsForUser", []any{userID, limit}, &out)
+	return out, err
+}
+
+func (me *Client) AddAnalytics(day *db.AnalyticsDay) error {
+	return me.call("AddAnalytics", []any{day})
+}
+
+func (me *Client) FindAnalytics(userID, space, name string, since time.Time) ([]*db.AnalyticsDay, error) {
+	var out []*db.AnalyticsDay
+	err := me.call("FindAnalytics", []any{userID, space, name, since}, &out)
+	return out, err
+}
+
+func (me *Client) AddBandwidth(month *db.BandwidthMonth) error {
+	return me.call("AddBandwidth", []any{month})
+}
+
+func (me *Client) FindBandwidth(userID, space string, month time.Time) ([]*db.BandwidthMonth, error) {
+	var out []*db.BandwidthMonth
+	err := me.call("FindBandwidth", []any{userID, space, month}, &out)
+	return out, err
+}
+
+func (me *Client) SeedStorageUsage(userID string, used int64) error {
+	return me.call("SeedStorageUsage", []any{userID, used})
+}
+
+func (me *Client) ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	var out string
+	err := me.call("ReserveStorage", []any{userID, projectName, size, max, expiresAt}, &out)
+	return out, err
+}
+
+func (me *Client) ReserveProjectStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	var out string
+	err := me.call("ReserveProjectStorage", []any{userID, projectName, size, max, expiresAt}, &out)
+	return out, err
+}
+
+func (me *Client) CommitStorage(userID, holdID string, delta int64) error {
+	return me.call("CommitStorage", []any{userID, holdID, delta})
+}
+
+func (me *Client) ReleaseStorage(holdID string) error {
+	return me.call("ReleaseStorage", []any{holdID})
+}
+
+func (me *Client) AddStorageUsage(userID string, delta int64) error {
+	return me.call("AddStorageUsage", []any{userID, delta})
+}
+
+func (me *Client) SetStorageUsage(userID string, used int64) (bool, error) {
+	var out bool
+	err := me.call("SetStorageUsage", []any{userID, used}, &out)
+	return out, err
+}
+
+func (me *Client) FindStorageUsages() ([]*db.StorageUsage, error) {
+	var out []*db.StorageUsage
+	err := me.call("FindStorageUsages", []any{}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveExpiredStorageHolds() (int, error) {
+	var out int
+	err := me.call("RemoveExpiredStorageHolds", []any{}, &out)
+	return out, err
+}
+
+func (me *Client) UpsertObjectManifest(manifest *db.ObjectManifest) error {
+	return me.call("UpsertObjectManifest", []any{manifest})
+}
+
+func (me *Client) FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error) {
+	var out *db.ObjectManifest
+	err := me.call("FindObjectManifest", []any{bucket, fpath}, &out)
+	return out, err
+}
+
+func (me *Client) FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error) {
+	var out []*db.ObjectManifest
+	err := me.call("FindObjectManifests", []any{bucket, prefix}, &out)
+	return out, err
+}
+
+func (me *Client) RemoveObjectManifest(bucket, fpath string) error {
+	return me.call("RemoveObjectManifest", []any{bucket, fpath})
+}
+
+func (me *Client) CountObjectManifestRefs(bucket, checksum string) (int, error) {
+	var out int
+	err := me.call("CountObjectManifestRefs", []any{bucket, checksum}, &out)
+	return out, err
+}
+
+// Close lets go of idle connections, the database stays open.
+func (me *Client) Close() error {
+	me.Client.CloseIdleConnections()
+	return nil
+}
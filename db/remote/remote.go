@@ -0,0 +1,111 @@
+// Package remote serves db.DB over http and implements it on top of that,
+// so the web tier and the ssh services can run apart from the database.
+//
+// A call is a POST to `/rpc/{Method}` whose body is the json array of its
+// arguments, the answer holds the json array of what it returned.
+package remote
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+// Prefix is where calls are served.
+var Prefix = "/rpc/"
+
+// IsURL is true for the urls of a database served by this package.
+func IsURL(databaseUrl string) bool {
+	u, err := url.Parse(databaseUrl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// sentinels are the errors callers check with errors.Is, they keep their
+// identity across the wire.
+var sentinels = map[string]error{
+	"no_rows":             sql.ErrNoRows,
+	"name_taken":          db.ErrNameTaken,
+	"name_denied":         db.ErrNameDenied,
+	"name_invalid":        db.ErrNameInvalid,
+	"public_key_taken":    db.ErrPublicKeyTaken,
+	"public_key_exists":   db.ErrPublicKeyExists,
+	"last_public_key":     db.ErrLastPublicKey,
+	"user_suspended":      db.ErrUserSuspended,
+	"user_read_only":      db.ErrUserReadOnly,
+	"not_org_member":      db.ErrNotOrgMember,
+	"quota_exceeded":      db.ErrQuotaExceeded,
+	"method_not_found":    ErrMethodNotFound,
+	"transaction_refused": ErrTransaction,
+}
+
+var ErrMethodNotFound = errors.New("method not found")
+
+// ErrTransaction is returned for calls that take a transaction, those can
+// not span processes.
+var ErrTransaction = errors.New("transactions are not supported over the api")
+
+// Error is an error returned by the database on the other end.
+type Error struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return sentinels[e.Code]
+}
+
+func toError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	for code, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			return &Error{Code: code, Message: err.Error()}
+		}
+	}
+	return &Error{Message: err.Error()}
+}
+
+type response struct {
+	Results []any  `json:"results"`
+	Error   *Error `json:"error,omitempty"`
+}
+
+// accessEntry carries a db.ProjectAccess with its `Value`, which its own
+// json leaves out so it is never shown to users.
+type accessEntry struct {
+	ID        string     `json:"id"`
+	ProjectID string     `json:"project_id"`
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+func toAccessEntries(entries []*db.ProjectAccess) []*accessEntry {
+	if entries == nil {
+		return nil
+	}
+	out := make([]*accessEntry, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, (*accessEntry)(entry))
+	}
+	return out
+}
+
+func fromAccessEntries(entries []*accessEntry) []*db.ProjectAccess {
+	if entries == nil {
+		return nil
+	}
+	out := make([]*db.ProjectAccess, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, (*db.ProjectAccess)(entry))
+	}
+	return out
+}
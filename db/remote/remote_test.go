@@ -0,0 +1,67 @@
+package remote
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/dbtest"
+	"github.com/picosh/pico/db/sqlite"
+)
+
+func newClient(t *testing.T, secret string) *Client {
+	dbpool := sqlite.NewDB("sqlite://"+filepath.Join(t.TempDir(), "pico.db"), slog.Default())
+	t.Cleanup(func() { dbpool.Close() })
+	srv := httptest.NewServer(NewServer(dbpool, "secret", slog.Default()))
+	t.Cleanup(srv.Close)
+	return NewDB(srv.URL, secret, slog.Default())
+}
+
+func TestConformance(t *testing.T) {
+	client := newClient(t, "secret")
+	defer client.Close()
+	dbtest.Run(t, client)
+}
+
+func TestErrors(t *testing.T) {
+	client := newClient(t, "secret")
+	_, err := client.FindUser("00000000-0000-0000-0000-000000000000")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows across the wire, got (%v)", err)
+	}
+	_, err = client.RegisterUser("admin", "ssh-ed25519 admin")
+	if !errors.Is(err, db.ErrNameDenied) {
+		t.Errorf("expected db.ErrNameDenied across the wire, got (%v)", err)
+	}
+	err = client.call("Close", []any{})
+	if !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected Close to be refused, got (%v)", err)
+	}
+	err = client.call("LinkUserKey", []any{"1", "key", map[string]any{}})
+	if !errors.Is(err, ErrTransaction) {
+		t.Errorf("expected a transaction to be refused, got (%v)", err)
+	}
+
+	_, err = newClient(t, "nope").FindUsers()
+	if err == nil {
+		t.Error("expected a wrong secret to be refused")
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	fixtures := map[string]bool{
+		"http://db-api:3000":                  true,
+		"https://db.pico.sh":                  true,
+		"postgres://pico@localhost:5432/pico": false,
+		"sqlite:pico.db":                      false,
+	}
+	for url, expected := range fixtures {
+		if IsURL(url) != expected {
+			t.Errorf("%s: expected %t", url, expected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package remote
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+// MaxRequestSize keeps the arguments of a call to a sane size.
+var MaxRequestSize int64 = 32 * 1024 * 1024
+
+var (
+	dbType     = reflect.TypeOf((*db.DB)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	txType     = reflect.TypeOf((*sql.Tx)(nil))
+	accessType = reflect.TypeOf([]*db.ProjectAccess(nil))
+)
+
+// Server answers calls to the methods of db.DB, except Close, from clients
+// that know the secret.
+type Server struct {
+	DB     db.DB
+	Secret string
+	Logger *slog.Logger
+}
+
+func NewServer(dbpool db.DB, secret string, logger *slog.Logger) *Server {
+	return &Server{DB: dbpool, Secret: secret, Logger: logger}
+}
+
+// decodeArgs reads the arguments of method in the order it takes them, the
+// variadic one as a slice.
+func decodeArgs(method reflect.Type, raw []json.RawMessage) ([]reflect.Value, error) {
+	if len(raw) != method.NumIn() {
+		return nil, fmt.Errorf("expected (%d) arguments, got (%d)", method.NumIn(), len(raw))
+	}
+	args := []reflect.Value{}
+	for i := 0; i < method.NumIn(); i++ {
+		argType := method.In(i)
+		switch argType {
+		case txType:
+			if string(raw[i]) != "null" {
+				return nil, ErrTransaction
+			}
+			args = append(args, reflect.Zero(txType))
+			continue
+		case accessType:
+			entries := []*accessEntry{}
+			err := json.Unmarshal(raw[i], &entries)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, reflect.ValueOf(fromAccessEntries(entries)))
+			continue
+		}
+
+		arg := reflect.New(argType)
+		err := json.Unmarshal(raw[i], arg.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("argument (%d): %w", i, err)
+		}
+		args = append(args, arg.Elem())
+	}
+	return args, nil
+}
+
+// call runs name with the json arguments, an error it returns is the error
+// of the call.
+func (s *Server) call(name string, raw []json.RawMessage) ([]any, error) {
+	spec, ok := dbType.MethodByName(name)
+	if !ok || name == "Close" {
+		return nil, ErrMethodNotFound
+	}
+	method := reflect.ValueOf(s.DB).MethodByName(name)
+	args, err := decodeArgs(spec.Type, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []reflect.Value
+	if spec.Type.IsVariadic() {
+		out = method.CallSlice(args)
+	} else {
+		out = method.Call(args)
+	}
+	results := []any{}
+	for _, value := range out {
+		if value.Type() == errorType {
+			if !value.IsNil() {
+				return nil, value.Interface().(error)
+			}
+			continue
+		}
+		if value.Type() == accessType {
+			results = append(results, toAccessEntries(value.Interface().([]*db.ProjectAccess)))
+			continue
+		}
+		results = append(results, value.Interface())
+	}
+	return results, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("authorization"), "Bearer ")
+	if s.Secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Secret)) != 1 {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	name, ok := strings.CutPrefix(r.URL.Path, Prefix)
+	if !ok || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	raw := []json.RawMessage{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestSize)).Decode(&raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	results, err := s.call(name, raw)
+	resp := &response{Results: results, Error: toError(err)}
+	if err != nil {
+		s.Logger.Debug("call failed", "method", name, "duration", time.Since(start), "err", err.Error())
+	}
+
+	w.Header().Set("content-type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		s.Logger.Error("could not write response", "method", name, "err", err.Error())
+	}
+}
@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/picosh/pico/db"
+)
+
+// migrationsFS holds the sqlite flavor of sql/migrations, a change to the
+// postgres schema needs a matching file here.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+const (
+	sqlCreateSchemaVersion = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version varchar(255) NOT NULL,
+		applied_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+		CONSTRAINT schema_version_pkey PRIMARY KEY (version)
+	)`
+	sqlSelectSchemaVersion = `SELECT version FROM schema_version WHERE version = $1`
+	sqlInsertSchemaVersion = `INSERT INTO schema_version (version) VALUES ($1) ON CONFLICT DO NOTHING`
+)
+
+// querier is either the pool or a transaction.
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func isApplied(q querier, version string) (bool, error) {
+	var found string
+	err := q.QueryRow(sqlSelectSchemaVersion, version).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Migrate applies every migration the database has not seen yet, it runs
+// whenever the database is opened so there is nothing to set up by hand.
+func (me *SqliteDB) Migrate() ([]string, error) {
+	fsys, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := db.ReadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	_, err = me.Db.Exec(sqlCreateSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []string{}
+	for _, migration := range migrations {
+		applied, err := isApplied(me.Db, migration.Version)
+		if err != nil {
+			return done, err
+		}
+		if applied {
+			continue
+		}
+		applied, err = me.applyMigration(migration)
+		if err != nil {
+			return done, fmt.Errorf("migration (%s) failed: %w", migration.Version, err)
+		}
+		if applied {
+			me.Logger.Info("applied migration", "version", migration.Version)
+			done = append(done, migration.Version)
+		}
+	}
+	return done, nil
+}
+
+// applyMigration reports false when another process applied it while we
+// waited for the write lock.
+func (me *SqliteDB) applyMigration(migration db.Migration) (bool, error) {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	applied, err := isApplied(tx, migration.Version)
+	if err != nil || applied {
+		return false, err
+	}
+	_, err = tx.Exec(migration.SQL)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(sqlInsertSchemaVersion, migration.Version)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
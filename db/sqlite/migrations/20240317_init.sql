@@ -0,0 +1,260 @@
+-- The schema postgres ends up with after every migration in sql/migrations.
+-- ids are random v4 uuids and json columns are blobs so they scan the same
+-- way they do from postgres.
+
+CREATE TABLE IF NOT EXISTS app_users (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  name varchar(50),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  suspended_at timestamp,
+  suspended_by text,
+  CONSTRAINT unique_name UNIQUE (name),
+  CONSTRAINT app_user_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_app_users_suspended_by
+    FOREIGN KEY(suspended_by)
+  REFERENCES app_users(id)
+  ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS public_keys (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  public_key varchar(2048) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT user_public_keys_pkey PRIMARY KEY (id),
+  CONSTRAINT unique_key_for_user UNIQUE (user_id, public_key),
+  CONSTRAINT fk_user_public_keys_owner
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  filename varchar(255),
+  slug varchar(255) NOT NULL DEFAULT '',
+  title varchar(255) NOT NULL,
+  text text NOT NULL DEFAULT '',
+  description varchar(150) NOT NULL DEFAULT '',
+  publish_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  expires_at timestamp,
+  hidden boolean NOT NULL DEFAULT false,
+  cur_space varchar(50),
+  views integer DEFAULT 0,
+  shasum char(64) NOT NULL DEFAULT '',
+  mime_type varchar(250) NOT NULL DEFAULT '',
+  file_size integer NOT NULL DEFAULT 0,
+  data blob NOT NULL DEFAULT (CAST('{}' AS BLOB)),
+  CONSTRAINT posts_pkey PRIMARY KEY (id),
+  CONSTRAINT unique_filename_for_user UNIQUE (user_id, cur_space, filename),
+  CONSTRAINT unique_slug_for_user UNIQUE (user_id, cur_space, slug),
+  CONSTRAINT fk_posts_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS posts_filename ON posts (filename);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  post_id text NOT NULL,
+  name varchar(50),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT post_tags_unique_name UNIQUE (post_id, name),
+  CONSTRAINT post_tags_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_post_tags_post
+    FOREIGN KEY(post_id)
+  REFERENCES posts(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS post_aliases (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  post_id text NOT NULL,
+  slug varchar(255) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT post_aliases_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_post_aliases_posts
+    FOREIGN KEY(post_id)
+  REFERENCES posts(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS feed_items (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  post_id text NOT NULL,
+  guid varchar(1000) NOT NULL,
+  data blob NOT NULL DEFAULT (CAST('{}' AS BLOB)),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT feed_items_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_feed_items_posts
+    FOREIGN KEY(post_id)
+  REFERENCES posts(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS payment_history (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text,
+  amount bigint NOT NULL,
+  payment_type varchar(50),
+  data blob NOT NULL DEFAULT (CAST('{"notes": ""}' AS BLOB)),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT payment_history_aliases_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_payment_history_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+);
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  payment_history_id text,
+  name varchar(50),
+  data blob NOT NULL DEFAULT (CAST('{}' AS BLOB)),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  expires_at timestamp NOT NULL DEFAULT (datetime('now', '+1 year')),
+  CONSTRAINT feature_flags_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_features_user_post
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE,
+  CONSTRAINT fk_features_payment_history
+    FOREIGN KEY(payment_history_id)
+  REFERENCES payment_history(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS quota_plans (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  name varchar(50) NOT NULL,
+  service varchar(50) NOT NULL,
+  storage_max bigint NOT NULL DEFAULT 0,
+  file_max bigint NOT NULL DEFAULT 0,
+  file_count_max integer NOT NULL DEFAULT 0,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT quota_plans_unique_name UNIQUE (name, service),
+  CONSTRAINT quota_plans_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  name varchar(256) NOT NULL,
+  token varchar(256) NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  expires_at timestamp NOT NULL DEFAULT '2100-01-01 00:00:00',
+  CONSTRAINT user_tokens_pkey PRIMARY KEY (id),
+  CONSTRAINT unique_token UNIQUE (token),
+  CONSTRAINT unique_user_name UNIQUE (user_id, name),
+  CONSTRAINT fk_user_tokens_owner
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS projects (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  name varchar(255) NOT NULL,
+  project_dir text NOT NULL DEFAULT '',
+  acl blob NOT NULL DEFAULT (CAST('{"type":"public","data":[]}' AS BLOB)),
+  csp blob NOT NULL DEFAULT (CAST('{"policy":"","report_only":false,"report_uri":""}' AS BLOB)),
+  expires_at timestamp,
+  expire_claimed_at timestamp,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT projects_pkey PRIMARY KEY (id),
+  CONSTRAINT unique_name_for_user UNIQUE (user_id, name),
+  CONSTRAINT fk_projects_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+  ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS projects_expires_at_idx ON projects (expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS project_headers (
+  project_id text NOT NULL,
+  rules blob NOT NULL DEFAULT (CAST('[]' AS BLOB)),
+  updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_headers_pkey PRIMARY KEY (project_id),
+  CONSTRAINT fk_project_headers_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS project_domains (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  project_id text NOT NULL,
+  domain varchar(255) NOT NULL,
+  token text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  verified_at timestamp,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_domains_unique_domain UNIQUE (domain),
+  CONSTRAINT project_domains_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_project_domains_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS project_deploys (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  project_id text NOT NULL,
+  revision integer NOT NULL,
+  current boolean NOT NULL DEFAULT false,
+  file_count integer NOT NULL DEFAULT 0,
+  size bigint NOT NULL DEFAULT 0,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_deploys_unique_revision UNIQUE (project_id, revision),
+  CONSTRAINT project_deploys_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_project_deploys_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS project_deploys_current_idx
+  ON project_deploys (project_id) WHERE current;
+
+CREATE TABLE IF NOT EXISTS object_manifests (
+  bucket varchar(255) NOT NULL,
+  path text NOT NULL,
+  checksum varchar(64) NOT NULL,
+  size bigint NOT NULL DEFAULT 0,
+  meta blob NOT NULL DEFAULT (CAST('{}' AS BLOB)),
+  updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT object_manifests_pkey PRIMARY KEY (bucket, path)
+);
+
+CREATE INDEX IF NOT EXISTS object_manifests_checksum_idx
+  ON object_manifests (bucket, checksum);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  url text NOT NULL,
+  secret varchar(64) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT webhooks_unique_url UNIQUE (user_id, url),
+  CONSTRAINT webhooks_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_webhooks_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN object_count integer;
@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN scheduled boolean NOT NULL DEFAULT FALSE;
+UPDATE posts SET scheduled = TRUE WHERE julianday(publish_at) > julianday('now');
+CREATE INDEX posts_scheduled_idx ON posts (publish_at) WHERE scheduled = TRUE;
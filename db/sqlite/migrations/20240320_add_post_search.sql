@@ -0,0 +1,11 @@
+CREATE VIRTUAL TABLE posts_search USING fts5(post_id UNINDEXED, title, description, text, tokenize = 'porter unicode61');
+INSERT INTO posts_search (post_id, title, description, text) SELECT id, title, description, text FROM posts;
+CREATE TRIGGER posts_search_insert AFTER INSERT ON posts BEGIN
+  INSERT INTO posts_search (post_id, title, description, text) VALUES (new.id, new.title, new.description, new.text);
+END;
+CREATE TRIGGER posts_search_update AFTER UPDATE OF title, description, text ON posts BEGIN
+  UPDATE posts_search SET title = new.title, description = new.description, text = new.text WHERE post_id = new.id;
+END;
+CREATE TRIGGER posts_search_delete AFTER DELETE ON posts BEGIN
+  DELETE FROM posts_search WHERE post_id = old.id;
+END;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS project_events (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  project_name varchar(255) NOT NULL,
+  event varchar(50) NOT NULL,
+  file_count integer NOT NULL DEFAULT 0,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_events_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_project_events_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX project_events_user_idx ON project_events (user_id, created_at DESC);
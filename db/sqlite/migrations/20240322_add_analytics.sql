@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS analytics_daily (
+  user_id text NOT NULL,
+  space varchar(50) NOT NULL,
+  name varchar(255) NOT NULL,
+  day date NOT NULL,
+  hits integer NOT NULL DEFAULT 0,
+  uniques integer NOT NULL DEFAULT 0,
+  CONSTRAINT analytics_daily_pkey PRIMARY KEY (user_id, space, name, day),
+  CONSTRAINT fk_analytics_daily_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
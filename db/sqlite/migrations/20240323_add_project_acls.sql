@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS project_acls (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  project_id text NOT NULL,
+  kind varchar(50) NOT NULL,
+  value text NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_acls_pkey PRIMARY KEY (id),
+  CONSTRAINT project_acls_unique UNIQUE (project_id, kind, value),
+  CONSTRAINT fk_project_acls_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS orgs (
+  id text NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT orgs_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_orgs_app_users
+    FOREIGN KEY(id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  org_id text NOT NULL,
+  user_id text NOT NULL,
+  role varchar(50) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT org_members_pkey PRIMARY KEY (id),
+  CONSTRAINT org_members_unique UNIQUE (org_id, user_id),
+  CONSTRAINT fk_org_members_orgs
+    FOREIGN KEY(org_id)
+  REFERENCES orgs(id)
+  ON DELETE CASCADE,
+  CONSTRAINT fk_org_members_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX org_members_user_idx ON org_members (user_id);
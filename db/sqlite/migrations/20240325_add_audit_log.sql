@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  actor_id text NOT NULL,
+  actor varchar(255) NOT NULL,
+  space varchar(255) NOT NULL,
+  action varchar(50) NOT NULL,
+  session_id varchar(255) NOT NULL DEFAULT '',
+  path text NOT NULL DEFAULT '',
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT audit_log_pkey PRIMARY KEY (id)
+);
+CREATE INDEX audit_log_user_idx ON audit_log (user_id, created_at DESC);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
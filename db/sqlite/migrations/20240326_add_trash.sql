@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS trash_objects (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  path text NOT NULL,
+  trash_path text NOT NULL,
+  size integer NOT NULL DEFAULT 0,
+  expires_at timestamp NOT NULL,
+  purge_claimed_at timestamp,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT trash_objects_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_trash_objects_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX trash_objects_user_idx ON trash_objects (user_id, path);
+CREATE INDEX trash_objects_expires_idx ON trash_objects (expires_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS domain_certs (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  domain varchar(255) NOT NULL,
+  cert_pem text NOT NULL,
+  key_pem text NOT NULL,
+  expires_at timestamp NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT domain_certs_pkey PRIMARY KEY (id),
+  CONSTRAINT domain_certs_unique_domain UNIQUE (domain),
+  CONSTRAINT fk_domain_certs_project_domains
+    FOREIGN KEY(domain)
+  REFERENCES project_domains(domain)
+  ON DELETE CASCADE
+);
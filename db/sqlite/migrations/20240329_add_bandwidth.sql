@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS bandwidth_monthly (
+  user_id text NOT NULL,
+  space varchar(50) NOT NULL,
+  name varchar(255) NOT NULL,
+  month date NOT NULL,
+  bytes integer NOT NULL DEFAULT 0,
+  CONSTRAINT bandwidth_monthly_pkey PRIMARY KEY (user_id, space, name, month),
+  CONSTRAINT fk_bandwidth_monthly_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE app_users ADD COLUMN read_only_at timestamp;
+ALTER TABLE app_users ADD COLUMN read_only_by text REFERENCES app_users(id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+ALTER TABLE audit_log ADD COLUMN remote_addr varchar(255) NOT NULL DEFAULT '';
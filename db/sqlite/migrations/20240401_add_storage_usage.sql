@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS storage_usage (
+  user_id text NOT NULL,
+  used integer NOT NULL DEFAULT 0,
+  reconciled_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT storage_usage_pkey PRIMARY KEY (user_id),
+  CONSTRAINT fk_storage_usage_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS storage_holds (
+  id text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  user_id text NOT NULL,
+  size integer NOT NULL,
+  expires_at timestamp NOT NULL,
+  CONSTRAINT storage_holds_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_storage_holds_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX storage_holds_user_idx ON storage_holds (user_id);
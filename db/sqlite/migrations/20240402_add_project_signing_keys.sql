@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS project_signing_keys (
+  project_id text NOT NULL,
+  key text NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_signing_keys_pkey PRIMARY KEY (project_id),
+  CONSTRAINT fk_project_signing_keys_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+  user_id text NOT NULL,
+  token text NOT NULL DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+  unsubscribed_at timestamp,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT digest_subscriptions_pkey PRIMARY KEY (user_id),
+  CONSTRAINT unique_digest_subscriptions_token UNIQUE (token),
+  CONSTRAINT fk_digest_subscriptions_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS post_email_senders (
+  user_id text NOT NULL,
+  email varchar(255) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT post_email_senders_pkey PRIMARY KEY (user_id, email),
+  CONSTRAINT fk_post_email_senders_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE tokens ADD COLUMN scope varchar(32) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- the parsed rules of a project's `_redirects`, kept like `_headers`
+CREATE TABLE IF NOT EXISTS project_redirects (
+  project_id text NOT NULL,
+  rules blob NOT NULL DEFAULT (CAST('[]' AS BLOB)),
+  updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  CONSTRAINT project_redirects_pkey PRIMARY KEY (project_id),
+  CONSTRAINT fk_project_redirects_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
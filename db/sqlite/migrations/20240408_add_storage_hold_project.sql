@@ -0,0 +1,3 @@
+-- holds made by `reserve` for an upcoming deploy name their project, the
+-- holds of running uploads have none
+ALTER TABLE storage_holds ADD COLUMN project_name text NOT NULL DEFAULT '';
@@ -0,0 +1,3088 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+	_ "modernc.org/sqlite"
+)
+
+// how long a sweeper may hold an expired project before another can claim it.
+var expireClaimTimeout = 10 * time.Minute
+
+// Times are compared through julianday() since they are stored as text
+// with whatever offset they were written with.
+
+var selectPost = `
+	posts.id, user_id, app_users.name, filename, slug, title, text, description,
+	posts.created_at, publish_at, posts.updated_at, hidden, file_size, mime_type, shasum, data, expires_at, views, scheduled`
+
+var (
+	sqlSelectPosts = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id`, selectPost)
+
+	sqlSelectPostsBeforeDate = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE date(publish_at) <= date($1) AND cur_space = $2`, selectPost)
+
+	sqlSelectPostWithFilename = fmt.Sprintf(`
+	SELECT %s, group_concat(coalesce(post_tags.name, ''), ',') tags
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	LEFT JOIN post_tags ON post_tags.post_id = posts.id
+	WHERE filename = $1 AND user_id = $2 AND cur_space = $3
+	GROUP BY posts.id`, selectPost)
+
+	sqlSelectPostWithSlug = fmt.Sprintf(`
+	SELECT %s, group_concat(coalesce(post_tags.name, ''), ',') tags
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	LEFT JOIN post_tags ON post_tags.post_id = posts.id
+	WHERE slug = $1 AND user_id = $2 AND cur_space = $3
+	GROUP BY posts.id`, selectPost)
+
+	sqlSelectPost = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE posts.id = $1`, selectPost)
+
+	sqlSelectUpdatedPostsForUser = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE user_id = $1 AND date(publish_at) <= date('now') AND scheduled = FALSE AND cur_space = $2
+	ORDER BY julianday(posts.updated_at) DESC`, selectPost)
+
+	sqlSelectExpiredPosts = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE cur_space = $1 AND julianday(expires_at) <= julianday('now')`, selectPost)
+
+	sqlSelectPostsForUser = fmt.Sprintf(`
+	SELECT %s, group_concat(coalesce(post_tags.name, ''), ',') tags
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	LEFT JOIN post_tags ON post_tags.post_id = posts.id
+	WHERE
+		hidden = FALSE AND
+		user_id = $1 AND
+		date(publish_at) <= date('now') AND
+		scheduled = FALSE AND
+		cur_space = $2
+	GROUP BY posts.id
+	ORDER BY julianday(publish_at) DESC, slug DESC
+	LIMIT $3 OFFSET $4`, selectPost)
+
+	sqlSearchPostsForUser = fmt.Sprintf(`
+	WITH matches AS (
+		SELECT post_id, bm25(posts_search, 0, 10.0, 5.0, 1.0) score, snippet(posts_search, 3, '**', '**', '...', 24) snippet
+		FROM posts_search
+		WHERE posts_search MATCH $3
+	)
+	SELECT %s, matches.snippet
+	FROM matches
+	JOIN posts ON posts.id = matches.post_id
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE
+		hidden = FALSE AND
+		user_id = $1 AND
+		date(publish_at) <= date('now') AND
+		scheduled = FALSE AND
+		cur_space = $2
+	ORDER BY matches.score ASC, julianday(publish_at) DESC
+	LIMIT $4`, selectPost)
+
+	sqlSelectAllPostsForUser = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE
+		user_id = $1 AND
+		cur_space = $2
+	ORDER BY julianday(publish_at) DESC`, selectPost)
+
+	sqlSelectUserPostsByTag = fmt.Sprintf(`
+	SELECT %s
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	LEFT JOIN post_tags ON post_tags.post_id = posts.id
+	WHERE
+		hidden = FALSE AND
+		user_id = $1 AND
+		(post_tags.name = $2 OR hidden = true) AND
+		date(publish_at) <= date('now') AND
+		scheduled = FALSE AND
+		cur_space = $3
+	ORDER BY julianday(publish_at) DESC
+	LIMIT $4 OFFSET $5`, selectPost)
+)
+
+const (
+	sqlSelectProject = `SELECT id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at FROM projects`
+
+	sqlSelectPublicKey         = `SELECT id, user_id, public_key, created_at FROM public_keys WHERE public_key = $1`
+	sqlSelectPublicKeys        = `SELECT id, user_id, public_key, created_at FROM public_keys WHERE user_id = $1`
+	sqlListKeysForUser         = `SELECT id, user_id, public_key, created_at FROM public_keys WHERE user_id = $1 ORDER BY julianday(created_at) ASC, rowid ASC`
+	sqlAddPublicKey            = `INSERT INTO public_keys (user_id, public_key) VALUES ($1, $2) RETURNING id, created_at`
+	sqlSelectUser              = `SELECT id, name, created_at, suspended_at, read_only_at FROM app_users WHERE id = $1`
+	sqlSelectUserForName       = `SELECT id, name, created_at, suspended_at, read_only_at FROM app_users WHERE name = $1`
+	sqlSelectUserForNameAndKey = `SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at, public_keys.id as pk_id, public_keys.public_key, public_keys.created_at as pk_created_at FROM app_users LEFT JOIN public_keys ON public_keys.user_id = app_users.id WHERE app_users.name = $1 AND public_keys.public_key = $2`
+	sqlSelectUsers             = `SELECT id, name, created_at, suspended_at, read_only_at FROM app_users ORDER BY name ASC`
+
+	sqlSelectUserForToken = `
+	SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at
+	FROM app_users
+	LEFT JOIN tokens ON tokens.user_id = app_users.id
+	WHERE tokens.token = $1 AND tokens.scope = $2 AND julianday(tokens.expires_at) > julianday('now')`
+	sqlInsertToken         = `INSERT INTO tokens (user_id, name, scope) VALUES($1, $2, $3) RETURNING token;`
+	sqlRemoveToken         = `DELETE FROM tokens WHERE id = $1`
+	sqlRemoveTokensForUser = `DELETE FROM tokens WHERE user_id = $1`
+	sqlSelectUserSummaries = `
+	SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at,
+		(SELECT count(*) FROM projects WHERE projects.user_id = app_users.id),
+		(SELECT group_concat(DISTINCT name) FROM feature_flags WHERE feature_flags.user_id = app_users.id AND julianday(feature_flags.expires_at) > julianday('now'))
+	FROM app_users
+	WHERE COALESCE(app_users.name, '') LIKE '%' || $1 || '%'
+	ORDER BY app_users.name ASC`
+	sqlInsertFeatureForUser = `INSERT INTO feature_flags (user_id, name, data, expires_at) VALUES ($1, $2, $3, $4)`
+	sqlExpireFeatureForUser = `UPDATE feature_flags SET expires_at = $3 WHERE user_id = $1 AND name = $2 AND julianday(expires_at) > julianday($3)`
+	sqlSelectTokensForUser  = `SELECT id, user_id, name, scope, created_at, expires_at FROM tokens WHERE user_id = $1`
+
+	sqlSelectTotalUsers          = `SELECT count(id) FROM app_users`
+	sqlSelectUsersAfterDate      = `SELECT count(id) FROM app_users WHERE julianday(created_at) >= julianday($1)`
+	sqlSelectTotalPosts          = `SELECT count(id) FROM posts WHERE cur_space = $1`
+	sqlSelectTotalPostsAfterDate = `SELECT count(id) FROM posts WHERE julianday(created_at) >= julianday($1) AND cur_space = $2`
+	sqlSelectUsersWithPost       = `SELECT count(app_users.id) FROM app_users WHERE EXISTS (SELECT 1 FROM posts WHERE user_id = app_users.id AND cur_space = $1);`
+
+	sqlSelectFeatureForUser   = `SELECT id, user_id, payment_history_id, name, data, created_at, expires_at FROM feature_flags WHERE user_id = $1 AND name = $2 ORDER BY julianday(expires_at) DESC LIMIT 1`
+	sqlSelectSizeForUser      = `SELECT COALESCE(sum(file_size), 0) FROM posts WHERE user_id = $1`
+	sqlSelectPostCountForUser = `SELECT count(id) FROM posts WHERE user_id = $1 AND cur_space = $2`
+	sqlSelectQuotaForUser     = `
+	SELECT quota_plans.name, quota_plans.service, quota_plans.storage_max, quota_plans.file_max, quota_plans.file_count_max
+	FROM quota_plans
+	INNER JOIN feature_flags ON feature_flags.name = quota_plans.name
+	WHERE feature_flags.user_id = $1 AND quota_plans.service = $2 AND julianday(feature_flags.expires_at) > julianday('now')
+	ORDER BY quota_plans.storage_max DESC
+	LIMIT 1`
+
+	sqlSelectPostIdByAliasSlug = `SELECT post_id FROM post_aliases WHERE slug = $1`
+	sqlSelectTagPostCount      = `
+	SELECT count(posts.id)
+	FROM posts
+	LEFT JOIN post_tags ON post_tags.post_id = posts.id
+	WHERE hidden = FALSE AND cur_space=$1 and post_tags.name = $2`
+	sqlSelectPostCount       = `SELECT count(id) FROM posts WHERE hidden = FALSE AND cur_space=$1`
+	sqlSelectAllUpdatedPosts = `
+	SELECT
+		posts.id,
+		user_id,
+		filename,
+		slug,
+		title,
+		text,
+		description,
+		publish_at,
+		app_users.name as username,
+		posts.updated_at,
+		posts.mime_type,
+		0 AS "score"
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE hidden = FALSE AND date(publish_at) <= date('now') AND scheduled = FALSE AND cur_space = $3
+	ORDER BY julianday(posts.updated_at) DESC
+	LIMIT $1 OFFSET $2`
+	sqlSelectPostsByRank = `
+	SELECT
+		posts.id,
+		user_id,
+		filename,
+		slug,
+		title,
+		text,
+		description,
+		publish_at,
+		app_users.name as username,
+		posts.updated_at,
+		posts.mime_type,
+		(
+			log(2.0, COALESCE(NULLIF(posts.views, 0), 1)) / (
+				((julianday('now') - julianday(posts.publish_at)) * 86400) / (14 * 8600)
+			)
+		) AS "score"
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	WHERE
+		hidden = FALSE AND
+		date(publish_at) <= date('now') AND
+		scheduled = FALSE AND
+		cur_space = $3
+	ORDER BY score DESC
+	LIMIT $1 OFFSET $2`
+	sqlSelectPostsByTag = `
+	SELECT
+		posts.id,
+		user_id,
+		filename,
+		slug,
+		title,
+		text,
+		description,
+		publish_at,
+		app_users.name as username,
+		posts.updated_at,
+		posts.mime_type,
+		0 AS "score"
+	FROM posts
+	LEFT JOIN app_users ON app_users.id = posts.user_id
+	LEFT JOIN post_tags ON post_tags.post_id = posts.id
+	WHERE
+		hidden = FALSE AND
+		post_tags.name = $3 AND
+		date(publish_at) <= date('now') AND
+		scheduled = FALSE AND
+		cur_space = $4
+	ORDER BY julianday(publish_at) DESC
+	LIMIT $1 OFFSET $2`
+
+	sqlSelectPopularTags = `
+	SELECT name, count(post_id) as "tally"
+	FROM post_tags
+	LEFT JOIN posts ON posts.id = post_id
+	WHERE posts.cur_space = $1
+	GROUP BY name
+	ORDER BY tally DESC
+	LIMIT 5`
+	sqlSelectTagsForPost     = `SELECT name FROM post_tags WHERE post_id=$1`
+	sqlSelectFeedItemsByPost = `SELECT id, post_id, guid, data, created_at FROM feed_items WHERE post_id=$1`
+
+	sqlInsertPublicKey = `INSERT INTO public_keys (user_id, public_key) VALUES ($1, $2)`
+	sqlInsertPost      = `
+	INSERT INTO posts
+		(user_id, filename, slug, title, text, description, publish_at, hidden, cur_space,
+		file_size, mime_type, shasum, data, expires_at, updated_at, scheduled)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	RETURNING id`
+	sqlInsertUser      = `INSERT INTO app_users (name) VALUES($1) returning id`
+	sqlInsertTag       = `INSERT INTO post_tags (post_id, name) VALUES($1, $2) RETURNING id;`
+	sqlInsertAliases   = `INSERT INTO post_aliases (post_id, slug) VALUES($1, $2) RETURNING id;`
+	sqlInsertFeedItems = `INSERT INTO feed_items (post_id, guid, data) VALUES ($1, $2, $3) RETURNING id;`
+
+	sqlUpdatePost = `
+	UPDATE posts
+	SET slug = $1, title = $2, text = $3, description = $4, updated_at = $5, publish_at = $6,
+		file_size = $7, shasum = $8, data = $9, hidden = $11, expires_at = $12, scheduled = $13
+	WHERE id = $10`
+	sqlUpdateUserName        = `UPDATE app_users SET name = $1 WHERE id = $2`
+	sqlSuspendUser           = `UPDATE app_users SET suspended_at = $2, suspended_by = $3 WHERE id = $1`
+	sqlUnsuspendUser         = `UPDATE app_users SET suspended_at = NULL, suspended_by = NULL WHERE id = $1`
+	sqlSetUserReadOnly       = `UPDATE app_users SET read_only_at = $2, read_only_by = $3 WHERE id = $1`
+	sqlUnsetUserReadOnly     = `UPDATE app_users SET read_only_at = NULL, read_only_by = NULL WHERE id = $1`
+	sqlIncrementViews        = `UPDATE posts SET views = views + 1 WHERE id = $1 RETURNING views`
+	sqlPublishScheduledPosts = `
+	UPDATE posts SET scheduled = FALSE
+	WHERE id IN (
+		SELECT id FROM posts
+		WHERE scheduled = TRUE AND julianday(publish_at) <= julianday($2)
+		ORDER BY publish_at ASC
+		LIMIT $1
+	)
+	RETURNING id, user_id, filename, slug, publish_at, cur_space`
+
+	sqlRemoveAliasesByPost = `DELETE FROM post_aliases WHERE post_id = $1`
+	sqlRemoveTagsByPost    = `DELETE FROM post_tags WHERE post_id = $1`
+	sqlRemovePosts         = `DELETE FROM posts WHERE id IN (%s)`
+	sqlRemoveKeys          = `DELETE FROM public_keys WHERE id IN (%s)`
+	sqlRemovePublicKey     = `DELETE FROM public_keys WHERE user_id = $1 AND id = $2`
+	sqlRemoveUsers         = `DELETE FROM app_users WHERE id IN (%s)`
+
+	sqlInsertProject        = `INSERT INTO projects (user_id, name, project_dir) VALUES ($1, $2, $3) RETURNING id;`
+	sqlUpdateProject        = `UPDATE projects SET updated_at = $3 WHERE user_id = $1 AND name = $2;`
+	sqlUpdateProjectAcl     = `UPDATE projects SET acl = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlUpdateProjectCsp     = `UPDATE projects SET csp = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlUpdateProjectSitemap = `UPDATE projects SET sitemap = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlSetProjectExpiry     = `UPDATE projects SET expires_at = $2, expire_claimed_at = NULL WHERE id = $1;`
+	sqlClaimExpiredProjects = `
+	UPDATE projects SET expire_claimed_at = $2
+	WHERE id IN (
+		SELECT id FROM projects
+		WHERE julianday(expires_at) < julianday($2) AND
+			(expire_claimed_at IS NULL OR julianday(expire_claimed_at) < julianday($3)) AND
+			NOT EXISTS (
+				SELECT 1 FROM projects AS links
+				WHERE links.user_id = projects.user_id AND links.name != links.project_dir AND links.project_dir = projects.name
+			)
+		ORDER BY julianday(expires_at) ASC
+		LIMIT $1
+	)
+	RETURNING id, user_id, name, project_dir, acl, csp, sitemap, expires_at, created_at, updated_at;`
+	sqlUpsertProjectHeaders = `
+	INSERT INTO project_headers (project_id, rules, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (project_id) DO UPDATE SET rules = $2, updated_at = $3;`
+	sqlUpsertProjectRedirects = `
+	INSERT INTO project_redirects (project_id, rules, updated_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (project_id) DO UPDATE SET rules = $2, updated_at = $3;`
+	sqlFindProjectByName        = sqlSelectProject + ` WHERE user_id = $1 AND name = $2;`
+	sqlSelectProjectCount       = `SELECT count(id) FROM projects`
+	sqlFindProjectsByUser       = sqlSelectProject + ` WHERE user_id = $1 ORDER BY name ASC, julianday(updated_at) DESC;`
+	sqlFindProjectsByPrefix     = sqlSelectProject + ` WHERE user_id = $1 AND name = project_dir AND name LIKE $2 ORDER BY julianday(updated_at) ASC, name ASC;`
+	sqlFindStaleProjects        = sqlSelectProject + ` WHERE user_id = $1 AND julianday(updated_at) < julianday($2) ORDER BY julianday(updated_at) ASC, name ASC;`
+	sqlFindProjectLinks         = sqlSelectProject + ` WHERE user_id = $1 AND name != project_dir AND project_dir = $2 ORDER BY name ASC;`
+	sqlLinkToProject            = `UPDATE projects SET project_dir = $1, updated_at = $2 WHERE id = $3;`
+	sqlRemoveProject            = `DELETE FROM projects WHERE id = $1;`
+	sqlFindProjectObjectCount   = `SELECT object_count FROM projects WHERE user_id = $1 AND name = $2;`
+	sqlFindObjectCountsForUser  = `SELECT name, object_count FROM projects WHERE user_id = $1 AND name = project_dir;`
+	sqlSetProjectObjectCount    = `UPDATE projects SET object_count = $3 WHERE user_id = $1 AND name = $2;`
+	sqlAdjustProjectObjectCount = `UPDATE projects SET object_count = max(object_count + $3, 0) WHERE user_id = $1 AND name = $2 AND object_count IS NOT NULL;`
+	sqlRenameProject            = `UPDATE projects SET name = $3, updated_at = $4 WHERE user_id = $1 AND name = $2;`
+	sqlRenameProjectDir         = `UPDATE projects SET project_dir = $3, updated_at = $4 WHERE user_id = $1 AND project_dir = $2;`
+
+	sqlInsertProjectDomain = `INSERT INTO project_domains (project_id, domain) VALUES ($1, $2) RETURNING token;`
+	sqlRemoveProjectDomain = `
+	DELETE FROM project_domains
+	WHERE domain = $2 AND project_id IN (SELECT id FROM projects WHERE user_id = $1);`
+	sqlSelectProjectDomains = `
+	SELECT project_domains.id, project_domains.project_id, projects.name, project_domains.domain, project_domains.token, project_domains.verified_at, project_domains.created_at
+	FROM project_domains
+	INNER JOIN projects ON projects.id = project_domains.project_id`
+	sqlFindProjectDomains     = sqlSelectProjectDomains + ` WHERE projects.user_id = $1 ORDER BY project_domains.domain ASC;`
+	sqlFindUnverifiedDomains  = sqlSelectProjectDomains + ` WHERE project_domains.verified_at IS NULL ORDER BY julianday(project_domains.created_at) ASC LIMIT $1;`
+	sqlVerifyProjectDomain    = `UPDATE project_domains SET verified_at = $2 WHERE id = $1;`
+	sqlFindDomainsToRecheck   = sqlSelectProjectDomains + ` WHERE julianday(project_domains.verified_at) < julianday($1) ORDER BY julianday(project_domains.verified_at) ASC LIMIT $2;`
+	sqlUnverifyProjectDomain  = `UPDATE project_domains SET verified_at = NULL WHERE id = $1;`
+	sqlFindSubdomainForDomain = `
+	SELECT app_users.name, projects.name
+	FROM project_domains
+	INNER JOIN projects ON projects.id = project_domains.project_id
+	INNER JOIN app_users ON app_users.id = projects.user_id
+	WHERE project_domains.domain = $1 AND project_domains.verified_at IS NOT NULL;`
+
+	sqlInsertProjectDeploy = `
+	INSERT INTO project_deploys (project_id, revision, current, file_count, size)
+	VALUES ($1, $2, true, $3, $4);`
+	sqlSelectProjectDeploys = `
+	SELECT project_deploys.id, project_deploys.project_id, project_deploys.revision, project_deploys.current,
+		project_deploys.file_count, project_deploys.size, project_deploys.created_at
+	FROM project_deploys`
+	sqlFindProjectDeploys = sqlSelectProjectDeploys + ` WHERE project_deploys.project_id = $1 ORDER BY project_deploys.revision DESC;`
+	sqlFindCurrentDeploy  = sqlSelectProjectDeploys + `
+	INNER JOIN projects ON projects.id = project_deploys.project_id
+	WHERE projects.user_id = $1 AND projects.name = $2 AND project_deploys.current;`
+	sqlResetCurrentDeploy = `UPDATE project_deploys SET current = false WHERE project_id = $1 AND current;`
+	sqlSetCurrentDeploy   = `UPDATE project_deploys SET current = true WHERE project_id = $1 AND revision = $2;`
+	sqlClearCurrentDeploy = `
+	UPDATE project_deploys SET current = false
+	WHERE current AND project_id IN (SELECT id FROM projects WHERE user_id = $1 AND name = $2);`
+	sqlRemoveProjectDeploy = `DELETE FROM project_deploys WHERE id = $1;`
+
+	sqlInsertWebhook       = `INSERT INTO webhooks (user_id, url, secret) VALUES ($1, $2, $3) RETURNING id;`
+	sqlFindWebhooksForUser = `SELECT id, user_id, url, secret, created_at FROM webhooks WHERE user_id = $1 ORDER BY julianday(created_at) ASC, rowid ASC;`
+	sqlRemoveWebhook       = `DELETE FROM webhooks WHERE user_id = $1 AND id = $2;`
+
+	sqlInsertAuditEntry = `
+	INSERT INTO audit_log (user_id, actor_id, actor, space, action, session_id, path, remote_addr)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	sqlFindAuditLog = `
+	SELECT id, user_id, actor_id, actor, space, action, session_id, path, remote_addr, created_at
+	FROM audit_log
+	WHERE user_id = $1 AND julianday(created_at) >= julianday($2)
+	ORDER BY julianday(created_at) DESC, rowid DESC
+	LIMIT $3;`
+
+	sqlSetProjectEnv = `
+	INSERT INTO project_env (project_id, key, value) VALUES ($1, $2, $3)
+	ON CONFLICT (project_id, key) DO UPDATE SET value = excluded.value, updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now');`
+	sqlRemoveProjectEnv = `DELETE FROM project_env WHERE project_id = $1 AND key = $2;`
+	sqlFindProjectEnv   = `
+	SELECT id, project_id, key, value, created_at, updated_at
+	FROM project_env
+	WHERE project_id = $1
+	ORDER BY key ASC;`
+
+	sqlSetProjectSigningKey = `
+	INSERT INTO project_signing_keys (project_id, key) VALUES ($1, $2)
+	ON CONFLICT (project_id) DO UPDATE SET key = excluded.key, created_at = strftime('%Y-%m-%d %H:%M:%f', 'now');`
+	sqlRemoveProjectSigningKey = `DELETE FROM project_signing_keys WHERE project_id = $1;`
+	sqlFindProjectSigningKey   = `SELECT project_id, key, created_at FROM project_signing_keys WHERE project_id = $1;`
+
+	sqlUpsertDigestSubscription = `
+	INSERT INTO digest_subscriptions (user_id) VALUES ($1)
+	ON CONFLICT (user_id) DO UPDATE SET user_id = excluded.user_id
+	RETURNING user_id, token, unsubscribed_at, created_at;`
+	sqlUnsubscribeDigests = `
+	UPDATE digest_subscriptions SET unsubscribed_at = COALESCE(unsubscribed_at, strftime('%Y-%m-%d %H:%M:%f', 'now'))
+	WHERE token = $1
+	RETURNING user_id, token, unsubscribed_at, created_at;`
+	sqlResubscribeDigests = `UPDATE digest_subscriptions SET unsubscribed_at = NULL WHERE user_id = $1;`
+
+	sqlAddPostEmailSender = `
+	INSERT INTO post_email_senders (user_id, email) VALUES ($1, $2)
+	ON CONFLICT (user_id, email) DO NOTHING;`
+	sqlRemovePostEmailSender = `DELETE FROM post_email_senders WHERE user_id = $1 AND email = $2;`
+	sqlFindPostEmailSenders  = `
+	SELECT user_id, email, created_at FROM post_email_senders
+	WHERE user_id = $1
+	ORDER BY email;`
+
+	sqlUpsertDomainCert = `
+	INSERT INTO domain_certs (domain, cert_pem, key_pem, expires_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (domain) DO UPDATE SET cert_pem = excluded.cert_pem, key_pem = excluded.key_pem,
+		expires_at = excluded.expires_at, updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now');`
+	sqlFindDomainCert = `
+	SELECT id, domain, cert_pem, key_pem, expires_at, created_at, updated_at
+	FROM domain_certs
+	WHERE domain = $1;`
+	sqlFindDomainsForCerts = sqlSelectProjectDomains + `
+	LEFT JOIN domain_certs ON domain_certs.domain = project_domains.domain
+	WHERE project_domains.verified_at IS NOT NULL AND (domain_certs.id IS NULL OR julianday(domain_certs.expires_at) < julianday($1))
+	ORDER BY project_domains.domain ASC
+	LIMIT $2;`
+
+	sqlInsertTrashObject = `
+	INSERT INTO trash_objects (user_id, path, trash_path, size, expires_at)
+	VALUES ($1, $2, $3, $4, $5);`
+	sqlFindTrashObjects = `
+	SELECT id, user_id, path, trash_path, size, expires_at, created_at
+	FROM trash_objects
+	WHERE user_id = $1
+	ORDER BY julianday(created_at) DESC, rowid DESC;`
+	sqlRemoveTrashObject = `DELETE FROM trash_objects WHERE id = $1;`
+	sqlClaimExpiredTrash = `
+	UPDATE trash_objects SET purge_claimed_at = $2
+	WHERE id IN (
+		SELECT id FROM trash_objects
+		WHERE julianday(expires_at) < julianday($2) AND
+			(purge_claimed_at IS NULL OR julianday(purge_claimed_at) < julianday($3))
+		ORDER BY julianday(expires_at) ASC
+		LIMIT $1
+	)
+	RETURNING id, user_id, path, trash_path, size, expires_at, created_at;`
+
+	sqlInsertOrg       = `INSERT INTO orgs (id) VALUES ($1);`
+	sqlFindOrgForName  = `SELECT app_users.id, app_users.name, app_users.created_at, app_users.suspended_at, app_users.read_only_at FROM app_users INNER JOIN orgs ON orgs.id = app_users.id WHERE app_users.name = $1;`
+	sqlSelectOrgMember = `SELECT org_members.id, org_members.org_id, org_members.user_id, app_users.name, org_members.role, org_members.created_at FROM org_members INNER JOIN app_users ON app_users.id = org_members.user_id`
+	sqlSetOrgMember    = `
+	INSERT INTO org_members (org_id, user_id, role) VALUES ($1, $2, $3)
+	ON CONFLICT (org_id, user_id) DO UPDATE SET role = excluded.role;`
+	sqlRemoveOrgMember = `DELETE FROM org_members WHERE org_id = $1 AND user_id = $2;`
+
+	sqlRemoveProjectAccess = `DELETE FROM project_acls WHERE project_id = $1;`
+	sqlInsertProjectAccess = `INSERT INTO project_acls (project_id, kind, value) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`
+	sqlFindProjectAccess   = `SELECT id, project_id, kind, value, created_at FROM project_acls WHERE project_id = $1 ORDER BY julianday(created_at) ASC, rowid ASC;`
+
+	sqlInsertProjectEvent       = `INSERT INTO project_events (user_id, project_name, event, file_count) VALUES ($1, $2, $3, $4);`
+	sqlFindProjectEventsForUser = `SELECT id, user_id, project_name, event, file_count, created_at FROM project_events WHERE user_id = $1 ORDER BY julianday(created_at) DESC, rowid DESC LIMIT $2;`
+
+	sqlAddAnalytics = `
+	INSERT INTO analytics_daily (user_id, space, name, day, hits, uniques)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id, space, name, day)
+	DO UPDATE SET hits = analytics_daily.hits + excluded.hits, uniques = analytics_daily.uniques + excluded.uniques;`
+	sqlFindAnalytics = `
+	SELECT user_id, space, name, day, hits, uniques FROM analytics_daily
+	WHERE user_id = $1 AND space = $2 AND ($3 = '' OR name = $3) AND day >= $4
+	ORDER BY day ASC, name ASC;`
+
+	sqlAddBandwidth = `
+	INSERT INTO bandwidth_monthly (user_id, space, name, month, bytes)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, space, name, month)
+	DO UPDATE SET bytes = bandwidth_monthly.bytes + excluded.bytes;`
+	sqlFindBandwidth = `
+	SELECT user_id, space, name, month, bytes FROM bandwidth_monthly
+	WHERE user_id = $1 AND space = $2 AND month = $3
+	ORDER BY bytes DESC, name ASC;`
+
+	sqlUpsertObjectManifest = `
+	INSERT INTO object_manifests (bucket, path, checksum, size, meta, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (bucket, path)
+	DO UPDATE SET checksum = $3, size = $4, meta = $5, updated_at = $6;`
+	sqlSelectObjectManifests  = `SELECT bucket, path, checksum, size, meta, updated_at FROM object_manifests`
+	sqlFindObjectManifest     = sqlSelectObjectManifests + ` WHERE bucket = $1 AND path = $2;`
+	sqlFindObjectManifests    = sqlSelectObjectManifests + ` WHERE bucket = $1 AND substr(path, 1, length($2)) = $2 ORDER BY path ASC;`
+	sqlRemoveObjectManifest   = `DELETE FROM object_manifests WHERE bucket = $1 AND path = $2;`
+	sqlCountObjectManifestRef = `SELECT count(*) FROM object_manifests WHERE bucket = $1 AND checksum = $2;`
+
+	sqlSeedStorageUsage = `
+	INSERT INTO storage_usage (user_id, used) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO NOTHING;`
+	sqlLockStorageUsage  = `SELECT used FROM storage_usage WHERE user_id = $1;`
+	sqlFindStorageHeld   = `SELECT COALESCE(SUM(size), 0) FROM storage_holds WHERE user_id = $1 AND julianday(expires_at) > julianday($2) AND (project_name = '' OR project_name != $3);`
+	sqlInsertStorageHold = `INSERT INTO storage_holds (user_id, size, expires_at, project_name) VALUES ($1, $2, $3, $4) RETURNING id;`
+	sqlRemoveStorageHold = `DELETE FROM storage_holds WHERE id = $1;`
+	sqlRemoveReservation = `DELETE FROM storage_holds WHERE user_id = $1 AND project_name = $2;`
+	sqlAddStorageUsage   = `UPDATE storage_usage SET used = MAX(used + $2, 0) WHERE user_id = $1;`
+	sqlSetStorageUsage   = `
+	UPDATE storage_usage SET used = $2, reconciled_at = $3
+	WHERE user_id = $1 AND NOT EXISTS (
+		SELECT 1 FROM storage_holds WHERE user_id = $1 AND julianday(expires_at) > julianday($3) AND project_name = ''
+	);`
+	sqlFindStorageUsages = `
+	SELECT user_id, used, COALESCE((
+		SELECT SUM(size) FROM storage_holds
+		WHERE storage_holds.user_id = storage_usage.user_id AND julianday(expires_at) > julianday($1)
+	), 0), reconciled_at
+	FROM storage_usage
+	ORDER BY julianday(reconciled_at) ASC;`
+	sqlRemoveExpiredStorageHolds = `DELETE FROM storage_holds WHERE julianday(expires_at) < julianday($1);`
+
+	sqlInsertPaymentHistory = `INSERT INTO payment_history (user_id, payment_type, amount, data) VALUES ($1, $2, 20 * 1000000, $3);`
+	sqlInsertFeatureFlag    = `INSERT INTO feature_flags (user_id, name, data, expires_at) VALUES ($1, $2, $3, datetime('now', '+1 year'));`
+)
+
+// picoPlusFeatures are the feature flags, and their limits, pico+ grants.
+var picoPlusFeatures = []struct {
+	name string
+	data db.FeatureFlagData
+}{
+	{name: "pgs", data: db.FeatureFlagData{StorageMax: 10000000000, FileMax: 50000000}},
+	{name: "imgs", data: db.FeatureFlagData{StorageMax: 2000000000}},
+	{name: "prose", data: db.FeatureFlagData{StorageMax: 1000000000, FileMax: 50000000}},
+	{name: "tuns"},
+}
+
+type SqliteDB struct {
+	Logger *slog.Logger
+	Db     *sql.DB
+}
+
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+// IsURL reports whether a database url points at a sqlite file, e.g.
+// `sqlite:///var/lib/pico/pico.db` or `sqlite:pico.db`.
+func IsURL(databaseUrl string) bool {
+	return strings.HasPrefix(databaseUrl, "sqlite:")
+}
+
+// dsn turns a sqlite url into what the driver expects. Every connection
+// enforces foreign keys, waits on a busy database instead of failing and
+// takes the write lock as soon as a transaction starts.
+func dsn(databaseUrl string) string {
+	name := strings.TrimPrefix(databaseUrl, "sqlite:")
+	name = strings.TrimPrefix(name, "//")
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite&_txlock=immediate"
+	if strings.Contains(name, "?") {
+		return "file:" + name + "&" + params
+	}
+	return "file:" + name + "?" + params
+}
+
+// inList expands ids into placeholders for `IN (%s)` since sqlite has
+// no arrays.
+func inList(query string, ids []string) (string, []any) {
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	return fmt.Sprintf(query, strings.Join(placeholders, ", ")), args
+}
+
+// ftsQuery quotes every word so fts5 matches them as plain terms, the
+// query syntax would otherwise turn stray quotes or dashes into errors.
+func ftsQuery(query string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(query) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func createPostFromRow(r RowScanner) (*db.Post, error) {
+	post := &db.Post{}
+	err := r.Scan(
+		&post.ID,
+		&post.UserID,
+		&post.Username,
+		&post.Filename,
+		&post.Slug,
+		&post.Title,
+		&post.Text,
+		&post.Description,
+		&post.CreatedAt,
+		&post.PublishAt,
+		&post.UpdatedAt,
+		&post.Hidden,
+		&post.FileSize,
+		&post.MimeType,
+		&post.Shasum,
+		&post.Data,
+		&post.ExpiresAt,
+		&post.Views,
+		&post.Scheduled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func createPostWithTagsFromRow(r RowScanner) (*db.Post, error) {
+	post := &db.Post{}
+	tagStr := ""
+	err := r.Scan(
+		&post.ID,
+		&post.UserID,
+		&post.Username,
+		&post.Filename,
+		&post.Slug,
+		&post.Title,
+		&post.Text,
+		&post.Description,
+		&post.CreatedAt,
+		&post.PublishAt,
+		&post.UpdatedAt,
+		&post.Hidden,
+		&post.FileSize,
+		&post.MimeType,
+		&post.Shasum,
+		&post.Data,
+		&post.ExpiresAt,
+		&post.Views,
+		&post.Scheduled,
+		&tagStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := strings.Split(tagStr, ",")
+	for _, tag := range tags {
+		tg := strings.TrimSpace(tag)
+		if tg == "" {
+			continue
+		}
+		post.Tags = append(post.Tags, tg)
+	}
+
+	return post, nil
+}
+
+func createProjectFromRow(r RowScanner) (*db.Project, error) {
+	project := &db.Project{}
+	err := r.Scan(
+		&project.ID,
+		&project.UserID,
+		&project.Name,
+		&project.ProjectDir,
+		&project.Acl,
+		&project.Csp,
+		&project.Sitemap,
+		&project.ExpiresAt,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func NewDB(databaseUrl string, logger *slog.Logger) *SqliteDB {
+	var err error
+	d := &SqliteDB{
+		Logger: logger,
+	}
+	d.Logger.Info("Connecting to sqlite", "databaseUrl", databaseUrl)
+
+	db, err := sql.Open("sqlite", dsn(databaseUrl))
+	if err != nil {
+		d.Logger.Error(err.Error())
+	}
+	d.Db = db
+
+	// there is no separate migrate step for a database that is just a file
+	_, err = d.Migrate()
+	if err != nil {
+		d.Logger.Error("could not migrate database", "err", err.Error())
+	}
+	return d
+}
+
+func (me *SqliteDB) findPosts(query string, args ...any) ([]*db.Post, error) {
+	var posts []*db.Post
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return posts, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		post, err := createPostFromRow(rs)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if rs.Err() != nil {
+		return posts, rs.Err()
+	}
+	return posts, nil
+}
+
+func (me *SqliteDB) findProjects(query string, args ...any) ([]*db.Project, error) {
+	var projects []*db.Project
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		project, err := createProjectFromRow(rs)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+	return projects, nil
+}
+
+func (me *SqliteDB) findKeys(query string, args ...any) ([]*db.PublicKey, error) {
+	keys := []*db.PublicKey{}
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return keys, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		pk := &db.PublicKey{}
+		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Key, &pk.CreatedAt)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, pk)
+	}
+	if rs.Err() != nil {
+		return keys, rs.Err()
+	}
+	return keys, nil
+}
+
+func (me *SqliteDB) RegisterUser(username string, pubkey string) (*db.User, error) {
+	lowerName := strings.ToLower(username)
+	valid, err := me.ValidateName(lowerName)
+	if !valid {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var id string
+	err = tx.QueryRow(sqlInsertUser, lowerName).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = me.LinkUserKey(id, pubkey, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return me.FindUserForKey(username, pubkey)
+}
+
+func (me *SqliteDB) RemoveUsers(userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	query, args := inList(sqlRemoveUsers, userIDs)
+	_, err := me.Db.Exec(query, args...)
+	return err
+}
+
+func (me *SqliteDB) LinkUserKey(userID string, key string, tx *sql.Tx) error {
+	pk, _ := me.FindPublicKeyForKey(key)
+	if pk != nil {
+		return db.ErrPublicKeyTaken
+	}
+	var err error
+	if tx != nil {
+		_, err = tx.Exec(sqlInsertPublicKey, userID, key)
+	} else {
+		_, err = me.Db.Exec(sqlInsertPublicKey, userID, key)
+	}
+	return err
+}
+
+func (me *SqliteDB) FindPublicKeyForKey(key string) (*db.PublicKey, error) {
+	keys, err := me.findKeys(sqlSelectPublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found for key provided")
+	}
+
+	// several users sharing a key have to log in with their username
+	if len(keys) > 1 {
+		return nil, &db.ErrMultiplePublicKeys{}
+	}
+
+	return keys[0], nil
+}
+
+func (me *SqliteDB) FindKeysForUser(user *db.User) ([]*db.PublicKey, error) {
+	return me.findKeys(sqlSelectPublicKeys, user.ID)
+}
+
+func (me *SqliteDB) RemoveKeys(keyIDs []string) error {
+	if len(keyIDs) == 0 {
+		return nil
+	}
+	query, args := inList(sqlRemoveKeys, keyIDs)
+	_, err := me.Db.Exec(query, args...)
+	return err
+}
+
+// InsertPublicKey adds another key to an account, a key can only ever
+// belong to one account.
+func (me *SqliteDB) InsertPublicKey(userID, key string) (*db.PublicKey, error) {
+	keys, err := me.findKeys(sqlSelectPublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, pk := range keys {
+		if pk.UserID == userID {
+			return nil, db.ErrPublicKeyExists
+		}
+		return nil, db.ErrPublicKeyTaken
+	}
+
+	pk := &db.PublicKey{UserID: userID, Key: key}
+	err = me.Db.QueryRow(sqlAddPublicKey, userID, key).Scan(&pk.ID, &pk.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// RemovePublicKey refuses to remove the last key of an account since the
+// user would have no way to log back in.
+func (me *SqliteDB) RemovePublicKey(userID, keyID string) error {
+	// the transaction holds the write lock so two removals can't both see
+	// a spare key
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rs, err := tx.Query(sqlSelectPublicKeys, userID)
+	if err != nil {
+		return err
+	}
+	found := false
+	count := 0
+	for rs.Next() {
+		pk := &db.PublicKey{}
+		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Key, &pk.CreatedAt)
+		if err != nil {
+			rs.Close()
+			return err
+		}
+		if pk.ID == keyID {
+			found = true
+		}
+		count += 1
+	}
+	rs.Close()
+	if rs.Err() != nil {
+		return rs.Err()
+	}
+
+	if !found {
+		return fmt.Errorf("public key (%s) not found", keyID)
+	}
+	if count <= 1 {
+		return db.ErrLastPublicKey
+	}
+
+	_, err = tx.Exec(sqlRemovePublicKey, userID, keyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (me *SqliteDB) ListKeysForUser(userID string) ([]*db.PublicKey, error) {
+	return me.findKeys(sqlListKeysForUser, userID)
+}
+
+func (me *SqliteDB) FindSiteAnalytics(space string) (*db.Analytics, error) {
+	analytics := &db.Analytics{}
+	err := me.Db.QueryRow(sqlSelectTotalUsers).Scan(&analytics.TotalUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = me.Db.QueryRow(sqlSelectTotalPosts, space).Scan(&analytics.TotalPosts)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	year, month, _ := now.Date()
+	begMonth := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+
+	err = me.Db.QueryRow(sqlSelectTotalPostsAfterDate, begMonth, space).Scan(&analytics.PostsLastMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	err = me.Db.QueryRow(sqlSelectUsersAfterDate, begMonth).Scan(&analytics.UsersLastMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	err = me.Db.QueryRow(sqlSelectUsersWithPost, space).Scan(&analytics.UsersWithPost)
+	if err != nil {
+		return nil, err
+	}
+
+	return analytics, nil
+}
+
+func (me *SqliteDB) FindPostsBeforeDate(date *time.Time, space string) ([]*db.Post, error) {
+	return me.findPosts(sqlSelectPostsBeforeDate, date, space)
+}
+
+func (me *SqliteDB) FindUserForKey(username string, key string) (*db.User, error) {
+	me.Logger.Info("attempting to find user with only public key", "key", key)
+	pk, err := me.FindPublicKeyForKey(key)
+	if err == nil {
+		user, err := me.FindUser(pk.UserID)
+		if err != nil {
+			return nil, err
+		}
+		user.PublicKey = pk
+		return user, nil
+	}
+
+	if errors.Is(err, &db.ErrMultiplePublicKeys{}) {
+		me.Logger.Info("detected multiple users with same public key", "user", username)
+		user, err := me.FindUserForNameAndKey(username, key)
+		if err != nil {
+			me.Logger.Info("could not find user by username and public key", "user", username, "key", key)
+			return nil, &db.ErrMultiplePublicKeys{}
+		}
+		return user, nil
+	}
+
+	return nil, err
+}
+
+func (me *SqliteDB) FindUser(userID string) (*db.User, error) {
+	user := &db.User{}
+	var un sql.NullString
+	err := me.Db.QueryRow(sqlSelectUser, userID).Scan(&user.ID, &un, &user.CreatedAt, &user.SuspendedAt, &user.ReadOnlyAt)
+	if err != nil {
+		return nil, err
+	}
+	user.Name = un.String
+	return user, nil
+}
+
+func (me *SqliteDB) ValidateName(name string) (bool, error) {
+	lower := strings.ToLower(name)
+	if slices.Contains(db.DenyList, lower) {
+		return false, fmt.Errorf("%s is on deny list: %w", lower, db.ErrNameDenied)
+	}
+	v := db.NameValidator.MatchString(lower)
+	if !v {
+		return false, fmt.Errorf("%s is invalid: %w", lower, db.ErrNameInvalid)
+	}
+	user, _ := me.FindUserForName(lower)
+	if user == nil {
+		return true, nil
+	}
+	return false, fmt.Errorf("%s already taken: %w", lower, db.ErrNameTaken)
+}
+
+func (me *SqliteDB) FindUserForName(name string) (*db.User, error) {
+	user := &db.User{}
+	err := me.Db.QueryRow(sqlSelectUserForName, strings.ToLower(name)).Scan(
+		&user.ID,
+		&user.Name,
+		&user.CreatedAt,
+		&user.SuspendedAt,
+		&user.ReadOnlyAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (me *SqliteDB) FindUserForNameAndKey(name string, key string) (*db.User, error) {
+	user := &db.User{}
+	pk := &db.PublicKey{}
+
+	r := me.Db.QueryRow(sqlSelectUserForNameAndKey, strings.ToLower(name), key)
+	err := r.Scan(&user.ID, &user.Name, &user.CreatedAt, &user.SuspendedAt, &user.ReadOnlyAt, &pk.ID, &pk.Key, &pk.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	user.PublicKey = pk
+	return user, nil
+}
+
+func (me *SqliteDB) FindUserForToken(token string) (*db.User, error) {
+	return me.FindUserForScopedToken(token, db.TokenScopeDefault)
+}
+
+func (me *SqliteDB) FindUserForScopedToken(token, scope string) (*db.User, error) {
+	user := &db.User{}
+	err := me.Db.QueryRow(sqlSelectUserForToken, token, scope).Scan(
+		&user.ID,
+		&user.Name,
+		&user.CreatedAt,
+		&user.SuspendedAt,
+		&user.ReadOnlyAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (me *SqliteDB) SetUserName(userID string, name string) error {
+	lowerName := strings.ToLower(name)
+	valid, err := me.ValidateName(lowerName)
+	if !valid {
+		return err
+	}
+
+	_, err = me.Db.Exec(sqlUpdateUserName, lowerName, userID)
+	return err
+}
+
+func (me *SqliteDB) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	var err error
+	if suspended {
+		_, err = me.Db.Exec(sqlSuspendUser, userID, time.Now(), operatorID)
+	} else {
+		_, err = me.Db.Exec(sqlUnsuspendUser, userID)
+	}
+	return err
+}
+
+func (me *SqliteDB) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	var err error
+	if readOnly {
+		_, err = me.Db.Exec(sqlSetUserReadOnly, userID, time.Now(), operatorID)
+	} else {
+		_, err = me.Db.Exec(sqlUnsetUserReadOnly, userID)
+	}
+	return err
+}
+
+func (me *SqliteDB) FindPostWithFilename(filename string, userID string, space string) (*db.Post, error) {
+	r := me.Db.QueryRow(sqlSelectPostWithFilename, filename, userID, space)
+	return createPostWithTagsFromRow(r)
+}
+
+func (me *SqliteDB) FindPostWithSlug(slug string, userID string, space string) (*db.Post, error) {
+	r := me.Db.QueryRow(sqlSelectPostWithSlug, slug, userID, space)
+	post, err := createPostWithTagsFromRow(r)
+	if err != nil {
+		// attempt to find post inside post_aliases
+		postID := ""
+		err := me.Db.QueryRow(sqlSelectPostIdByAliasSlug, slug).Scan(&postID)
+		if err != nil {
+			return nil, err
+		}
+
+		return me.FindPost(postID)
+	}
+
+	return post, nil
+}
+
+func (me *SqliteDB) FindPost(postID string) (*db.Post, error) {
+	return createPostFromRow(me.Db.QueryRow(sqlSelectPost, postID))
+}
+
+func (me *SqliteDB) postPager(rs *sql.Rows, pageNum int, space string, tag string) (*db.Paginate[*db.Post], error) {
+	defer rs.Close()
+	var posts []*db.Post
+	for rs.Next() {
+		post := &db.Post{}
+		err := rs.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Filename,
+			&post.Slug,
+			&post.Title,
+			&post.Text,
+			&post.Description,
+			&post.PublishAt,
+			&post.Username,
+			&post.UpdatedAt,
+			&post.MimeType,
+			&post.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, post)
+	}
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	var count int
+	var err error
+	if tag == "" {
+		err = me.Db.QueryRow(sqlSelectPostCount, space).Scan(&count)
+	} else {
+		err = me.Db.QueryRow(sqlSelectTagPostCount, space, tag).Scan(&count)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pager := &db.Paginate[*db.Post]{
+		Data:  posts,
+		Total: int(math.Ceil(float64(count) / float64(pageNum))),
+	}
+
+	return pager, nil
+}
+
+func (me *SqliteDB) FindAllPosts(page *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	rs, err := me.Db.Query(sqlSelectPostsByRank, page.Num, page.Num*page.Page, space)
+	if err != nil {
+		return nil, err
+	}
+	return me.postPager(rs, page.Num, space, "")
+}
+
+func (me *SqliteDB) FindAllUpdatedPosts(page *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	rs, err := me.Db.Query(sqlSelectAllUpdatedPosts, page.Num, page.Num*page.Page, space)
+	if err != nil {
+		return nil, err
+	}
+	return me.postPager(rs, page.Num, space, "")
+}
+
+func (me *SqliteDB) InsertPost(post *db.Post) (*db.Post, error) {
+	var id string
+	err := me.Db.QueryRow(
+		sqlInsertPost,
+		post.UserID,
+		post.Filename,
+		post.Slug,
+		post.Title,
+		post.Text,
+		post.Description,
+		post.PublishAt,
+		post.Hidden,
+		post.Space,
+		post.FileSize,
+		post.MimeType,
+		post.Shasum,
+		post.Data,
+		post.ExpiresAt,
+		post.UpdatedAt,
+		post.Scheduled,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return me.FindPost(id)
+}
+
+func (me *SqliteDB) UpdatePost(post *db.Post) (*db.Post, error) {
+	_, err := me.Db.Exec(
+		sqlUpdatePost,
+		post.Slug,
+		post.Title,
+		post.Text,
+		post.Description,
+		post.UpdatedAt,
+		post.PublishAt,
+		post.FileSize,
+		post.Shasum,
+		post.Data,
+		post.ID,
+		post.Hidden,
+		post.ExpiresAt,
+		post.Scheduled,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return me.FindPost(post.ID)
+}
+
+func (me *SqliteDB) RemovePosts(postIDs []string) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	query, args := inList(sqlRemovePosts, postIDs)
+	_, err := me.Db.Exec(query, args...)
+	return err
+}
+
+func (me *SqliteDB) FindPostsForUser(page *db.Pager, userID string, space string) (*db.Paginate[*db.Post], error) {
+	var posts []*db.Post
+	rs, err := me.Db.Query(
+		sqlSelectPostsForUser,
+		userID,
+		space,
+		page.Num,
+		page.Num*page.Page,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		post, err := createPostWithTagsFromRow(rs)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, post)
+	}
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	var count int
+	err = me.Db.QueryRow(sqlSelectPostCount, space).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := &db.Paginate[*db.Post]{
+		Data:  posts,
+		Total: int(math.Ceil(float64(count) / float64(page.Num))),
+	}
+	return pager, nil
+}
+
+func (me *SqliteDB) FindAllPostsForUser(userID string, space string) ([]*db.Post, error) {
+	return me.findPosts(sqlSelectAllPostsForUser, userID, space)
+}
+
+func (me *SqliteDB) FindPosts() ([]*db.Post, error) {
+	return me.findPosts(sqlSelectPosts)
+}
+
+func (me *SqliteDB) FindExpiredPosts(space string) ([]*db.Post, error) {
+	return me.findPosts(sqlSelectExpiredPosts, space)
+}
+
+func (me *SqliteDB) FindUpdatedPostsForUser(userID string, space string) ([]*db.Post, error) {
+	return me.findPosts(sqlSelectUpdatedPostsForUser, userID, space)
+}
+
+func (me *SqliteDB) Close() error {
+	me.Logger.Info("Closing db")
+	return me.Db.Close()
+}
+
+func (me *SqliteDB) AddViewCount(postID string) (int, error) {
+	views := 0
+	err := me.Db.QueryRow(sqlIncrementViews, postID).Scan(&views)
+	if err != nil {
+		return views, err
+	}
+	return views, nil
+}
+
+func (me *SqliteDB) FindUserSummaries(filter string) ([]*db.UserSummary, error) {
+	summaries := []*db.UserSummary{}
+	rs, err := me.Db.Query(sqlSelectUserSummaries, filter)
+	if err != nil {
+		return summaries, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var name, features sql.NullString
+		summary := &db.UserSummary{User: &db.User{}}
+		err := rs.Scan(
+			&summary.ID,
+			&name,
+			&summary.CreatedAt,
+			&summary.SuspendedAt,
+			&summary.ReadOnlyAt,
+			&summary.Projects,
+			&features,
+		)
+		if err != nil {
+			return summaries, err
+		}
+		summary.Name = name.String
+		summary.Features = []string{}
+		if features.String != "" {
+			summary.Features = strings.Split(features.String, ",")
+			slices.Sort(summary.Features)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rs.Err()
+}
+
+func (me *SqliteDB) SetFeatureForUser(userID, name string, data db.FeatureFlagData, expiresAt time.Time) error {
+	tx, err := me.Db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// a longer grant left around would win over the new one
+	_, err = tx.Exec(sqlExpireFeatureForUser, userID, name, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sqlInsertFeatureForUser, userID, name, data, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (me *SqliteDB) RemoveFeatureForUser(userID, name string) error {
+	_, err := me.Db.Exec(sqlExpireFeatureForUser, userID, name, time.Now())
+	return err
+}
+
+func (me *SqliteDB) RemoveTokensForUser(userID string) (int, error) {
+	res, err := me.Db.Exec(sqlRemoveTokensForUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+func (me *SqliteDB) FindUsers() ([]*db.User, error) {
+	var users []*db.User
+	rs, err := me.Db.Query(sqlSelectUsers)
+	if err != nil {
+		return users, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var name sql.NullString
+		user := &db.User{}
+		err := rs.Scan(
+			&user.ID,
+			&name,
+			&user.CreatedAt,
+			&user.SuspendedAt,
+			&user.ReadOnlyAt,
+		)
+		if err != nil {
+			return users, err
+		}
+		user.Name = name.String
+
+		users = append(users, user)
+	}
+	if rs.Err() != nil {
+		return users, rs.Err()
+	}
+	return users, nil
+}
+
+func (me *SqliteDB) ReplaceTagsForPost(tags []string, postID string) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlRemoveTagsByPost, postID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		id := ""
+		err := tx.QueryRow(sqlInsertTag, postID, tag).Scan(&id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// aliasDenyList are slugs that conflict with a static route.
+var aliasDenyList = []string{
+	"rss",
+	"rss.xml",
+	"atom.xml",
+	"feed.xml",
+	"styles.css",
+	"main.css",
+	"prose.css",
+	"syntax.css",
+	"card.png",
+	"favicon-16x16.png",
+	"favicon-32x32.png",
+	"apple-touch-icon.png",
+	"favicon.ico",
+	"robots.txt",
+	"atom",
+	"blog/index.xml",
+}
+
+func (me *SqliteDB) ReplaceAliasesForPost(aliases []string, postID string) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlRemoveAliasesByPost, postID)
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range aliases {
+		if slices.Contains(aliasDenyList, alias) {
+			me.Logger.Info(
+				"name is in the deny list for aliases because it conflicts with a static route, skipping",
+				"alias", alias,
+			)
+			continue
+		}
+		id := ""
+		err := tx.QueryRow(sqlInsertAliases, postID, alias).Scan(&id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (me *SqliteDB) FindUserPostsByTag(page *db.Pager, tag, userID, space string) (*db.Paginate[*db.Post], error) {
+	posts, err := me.findPosts(
+		sqlSelectUserPostsByTag,
+		userID,
+		tag,
+		space,
+		page.Num,
+		page.Num*page.Page,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = me.Db.QueryRow(sqlSelectPostCount, space).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := &db.Paginate[*db.Post]{
+		Data:  posts,
+		Total: int(math.Ceil(float64(count) / float64(page.Num))),
+	}
+	return pager, nil
+}
+
+func (me *SqliteDB) FindPostsByTag(pager *db.Pager, tag, space string) (*db.Paginate[*db.Post], error) {
+	rs, err := me.Db.Query(
+		sqlSelectPostsByTag,
+		pager.Num,
+		pager.Num*pager.Page,
+		tag,
+		space,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return me.postPager(rs, pager.Num, space, tag)
+}
+
+func (me *SqliteDB) FindPopularTags(space string) ([]string, error) {
+	tags := make([]string, 0)
+	rs, err := me.Db.Query(sqlSelectPopularTags, space)
+	if err != nil {
+		return tags, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		name := ""
+		tally := 0
+		err := rs.Scan(&name, &tally)
+		if err != nil {
+			return tags, err
+		}
+
+		tags = append(tags, name)
+	}
+	if rs.Err() != nil {
+		return tags, rs.Err()
+	}
+	return tags, nil
+}
+
+func (me *SqliteDB) FindTagsForPost(postID string) ([]string, error) {
+	tags := make([]string, 0)
+	rs, err := me.Db.Query(sqlSelectTagsForPost, postID)
+	if err != nil {
+		return tags, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		name := ""
+		err := rs.Scan(&name)
+		if err != nil {
+			return tags, err
+		}
+
+		tags = append(tags, name)
+	}
+	if rs.Err() != nil {
+		return tags, rs.Err()
+	}
+	return tags, nil
+}
+
+func (me *SqliteDB) FindFeatureForUser(userID string, feature string) (*db.FeatureFlag, error) {
+	ff := &db.FeatureFlag{}
+	// payment history is allowed to be null
+	var paymentHistoryID sql.NullString
+	err := me.Db.QueryRow(sqlSelectFeatureForUser, userID, feature).Scan(
+		&ff.ID,
+		&ff.UserID,
+		&paymentHistoryID,
+		&ff.Name,
+		&ff.Data,
+		&ff.CreatedAt,
+		&ff.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ff.PaymentHistoryID = paymentHistoryID.String
+
+	return ff, nil
+}
+
+// FindQuotaForUser returns the largest plan a user holds an active feature
+// flag for within a service.
+func (me *SqliteDB) FindQuotaForUser(userID string, feature string) (*db.Quota, error) {
+	quota := &db.Quota{}
+	err := me.Db.QueryRow(sqlSelectQuotaForUser, userID, feature).Scan(
+		&quota.Plan,
+		&quota.Service,
+		&quota.StorageMax,
+		&quota.FileMax,
+		&quota.FileCountMax,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+func (me *SqliteDB) HasFeatureForUser(userID string, feature string) bool {
+	ff, err := me.FindFeatureForUser(userID, feature)
+	if err != nil {
+		return false
+	}
+	return ff.IsValid()
+}
+
+func (me *SqliteDB) HasAnyFeatureForUser(userID string, features ...string) (bool, error) {
+	for _, feature := range features {
+		ff, err := me.FindFeatureForUser(userID, feature)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if ff.IsValid() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (me *SqliteDB) FindPostCountForUser(userID string, space string) (int, error) {
+	var count int
+	err := me.Db.QueryRow(sqlSelectPostCountForUser, userID, space).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (me *SqliteDB) FindTotalSizeForUser(userID string) (int, error) {
+	var fileSize int
+	err := me.Db.QueryRow(sqlSelectSizeForUser, userID).Scan(&fileSize)
+	if err != nil {
+		return 0, err
+	}
+	return fileSize, nil
+}
+
+func (me *SqliteDB) InsertFeedItems(postID string, items []*db.FeedItem) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, item := range items {
+		_, err := tx.Exec(
+			sqlInsertFeedItems,
+			item.PostID,
+			item.GUID,
+			item.Data,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (me *SqliteDB) FindFeedItemsByPostID(postID string) ([]*db.FeedItem, error) {
+	items := make([]*db.FeedItem, 0)
+	rs, err := me.Db.Query(sqlSelectFeedItemsByPost, postID)
+	if err != nil {
+		return items, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		item := &db.FeedItem{}
+		err := rs.Scan(
+			&item.ID,
+			&item.PostID,
+			&item.GUID,
+			&item.Data,
+			&item.CreatedAt,
+		)
+		if err != nil {
+			return items, err
+		}
+
+		items = append(items, item)
+	}
+	if rs.Err() != nil {
+		return items, rs.Err()
+	}
+	return items, nil
+}
+
+func (me *SqliteDB) InsertProject(userID, name, projectDir string) (string, error) {
+	if !shared.IsValidSubdomain(name) {
+		return "", fmt.Errorf("(%s) is not a valid project name, must match /^[a-z0-9-]+$/", name)
+	}
+
+	var id string
+	err := me.Db.QueryRow(sqlInsertProject, userID, name, projectDir).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (me *SqliteDB) UpdateProject(userID, name string) error {
+	_, err := me.Db.Exec(sqlUpdateProject, userID, name, time.Now())
+	return err
+}
+
+func (me *SqliteDB) UpdateProjectAcl(userID, name string, acl db.ProjectAcl) error {
+	_, err := me.Db.Exec(sqlUpdateProjectAcl, userID, name, acl, time.Now())
+	return err
+}
+
+func (me *SqliteDB) UpdateProjectCsp(userID, name string, csp db.ProjectCsp) error {
+	_, err := me.Db.Exec(sqlUpdateProjectCsp, userID, name, csp, time.Now())
+	return err
+}
+
+func (me *SqliteDB) UpdateProjectSitemap(userID, name string, sitemap bool) error {
+	_, err := me.Db.Exec(sqlUpdateProjectSitemap, userID, name, sitemap, time.Now())
+	return err
+}
+
+func nullCount(count sql.NullInt64) *int {
+	if !count.Valid {
+		return nil
+	}
+	n := int(count.Int64)
+	return &n
+}
+
+// FindProjectObjectCount is nil until the project has been counted.
+func (me *SqliteDB) FindProjectObjectCount(userID, name string) (*int, error) {
+	var count sql.NullInt64
+	err := me.Db.QueryRow(sqlFindProjectObjectCount, userID, name).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	return nullCount(count), nil
+}
+
+// FindObjectCountsForUser returns the object count of every project that
+// holds its own files, links are left out.
+func (me *SqliteDB) FindObjectCountsForUser(userID string) (map[string]*int, error) {
+	counts := map[string]*int{}
+	rs, err := me.Db.Query(sqlFindObjectCountsForUser, userID)
+	if err != nil {
+		return counts, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var name string
+		var count sql.NullInt64
+		err := rs.Scan(&name, &count)
+		if err != nil {
+			return counts, err
+		}
+		counts[name] = nullCount(count)
+	}
+	return counts, rs.Err()
+}
+
+// SetProjectObjectCount records a fresh count, nil forgets it so the next
+// upload counts the project again.
+func (me *SqliteDB) SetProjectObjectCount(userID, name string, count *int) error {
+	_, err := me.Db.Exec(sqlSetProjectObjectCount, userID, name, count)
+	return err
+}
+
+// AdjustProjectObjectCount leaves projects that were never counted alone.
+func (me *SqliteDB) AdjustProjectObjectCount(userID, name string, delta int) error {
+	_, err := me.Db.Exec(sqlAdjustProjectObjectCount, userID, name, delta)
+	return err
+}
+
+func (me *SqliteDB) SetProjectExpiry(projectID string, expiresAt *time.Time) error {
+	_, err := me.Db.Exec(sqlSetProjectExpiry, projectID, expiresAt)
+	return err
+}
+
+// ClaimExpiredProjects marks up to limit expired projects as claimed so
+// concurrent sweepers never purge the same project. Claims older than
+// `expireClaimTimeout` are considered abandoned and can be claimed again.
+// Projects other projects link to are left alone, their links serve them.
+func (me *SqliteDB) ClaimExpiredProjects(limit int) ([]*db.Project, error) {
+	now := time.Now()
+	return me.findProjects(sqlClaimExpiredProjects, limit, now, now.Add(-expireClaimTimeout))
+}
+
+// PublishScheduledPosts takes up to limit scheduled posts whose publish_at
+// has passed live, every post is only ever returned to one caller.
+func (me *SqliteDB) PublishScheduledPosts(limit int) ([]*db.Post, error) {
+	rs, err := me.Db.Query(sqlPublishScheduledPosts, limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	posts := []*db.Post{}
+	for rs.Next() {
+		post := &db.Post{}
+		err := rs.Scan(&post.ID, &post.UserID, &post.Filename, &post.Slug, &post.PublishAt, &post.Space)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rs.Err()
+}
+
+func (me *SqliteDB) SearchPostsForUser(userID, space, query string, limit int) ([]*db.PostSearchResult, error) {
+	results := []*db.PostSearchResult{}
+	match := ftsQuery(query)
+	if match == "" {
+		return results, nil
+	}
+	rs, err := me.Db.Query(sqlSearchPostsForUser, userID, space, match, limit)
+	if err != nil {
+		return results, err
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		result := &db.PostSearchResult{Post: &db.Post{}}
+		post := result.Post
+		err := rs.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Username,
+			&post.Filename,
+			&post.Slug,
+			&post.Title,
+			&post.Text,
+			&post.Description,
+			&post.CreatedAt,
+			&post.PublishAt,
+			&post.UpdatedAt,
+			&post.Hidden,
+			&post.FileSize,
+			&post.MimeType,
+			&post.Shasum,
+			&post.Data,
+			&post.ExpiresAt,
+			&post.Views,
+			&post.Scheduled,
+			&result.Snippet,
+		)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, rs.Err()
+}
+
+func (me *SqliteDB) UpsertHeaders(projectID string, rules []*headers.HeaderRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = me.Db.Exec(sqlUpsertProjectHeaders, projectID, data, time.Now())
+	return err
+}
+
+func (me *SqliteDB) UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = me.Db.Exec(sqlUpsertProjectRedirects, projectID, data, time.Now())
+	return err
+}
+
+func (me *SqliteDB) InsertProjectDomain(projectID, domain string) (string, error) {
+	var token string
+	err := me.Db.QueryRow(sqlInsertProjectDomain, projectID, domain).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (me *SqliteDB) RemoveProjectDomain(userID, domain string) error {
+	res, err := me.Db.Exec(sqlRemoveProjectDomain, userID, domain)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("domain (%s) not found", domain)
+	}
+	return nil
+}
+
+func (me *SqliteDB) findProjectDomains(query string, args ...any) ([]*db.ProjectDomain, error) {
+	domains := []*db.ProjectDomain{}
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return domains, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		domain := &db.ProjectDomain{}
+		err := rs.Scan(
+			&domain.ID,
+			&domain.ProjectID,
+			&domain.ProjectName,
+			&domain.Domain,
+			&domain.Token,
+			&domain.VerifiedAt,
+			&domain.CreatedAt,
+		)
+		if err != nil {
+			return domains, err
+		}
+		domains = append(domains, domain)
+	}
+	if rs.Err() != nil {
+		return domains, rs.Err()
+	}
+	return domains, nil
+}
+
+func (me *SqliteDB) FindProjectDomains(userID string) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindProjectDomains, userID)
+}
+
+func (me *SqliteDB) FindUnverifiedDomains(limit int) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindUnverifiedDomains, limit)
+}
+
+func (me *SqliteDB) VerifyProjectDomain(domainID string) error {
+	_, err := me.Db.Exec(sqlVerifyProjectDomain, domainID, time.Now())
+	return err
+}
+
+func (me *SqliteDB) FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindDomainsToRecheck, verifiedBefore, limit)
+}
+
+func (me *SqliteDB) UnverifyProjectDomain(domainID string) error {
+	_, err := me.Db.Exec(sqlUnverifyProjectDomain, domainID)
+	return err
+}
+
+// FindSubdomainForDomain resolves a verified custom domain into the
+// `user-project` subdomain it serves.
+func (me *SqliteDB) FindSubdomainForDomain(domain string) (string, error) {
+	var username, projectName string
+	err := me.Db.QueryRow(sqlFindSubdomainForDomain, domain).Scan(&username, &projectName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", username, projectName), nil
+}
+
+// InsertProjectDeploy records a new revision and makes it the current one.
+func (me *SqliteDB) InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlResetCurrentDeploy, projectID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sqlInsertProjectDeploy, projectID, revision, fileCount, size)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanProjectDeploy(r RowScanner) (*db.ProjectDeploy, error) {
+	deploy := &db.ProjectDeploy{}
+	err := r.Scan(
+		&deploy.ID,
+		&deploy.ProjectID,
+		&deploy.Revision,
+		&deploy.Current,
+		&deploy.FileCount,
+		&deploy.Size,
+		&deploy.CreatedAt,
+	)
+	return deploy, err
+}
+
+func (me *SqliteDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	deploys := []*db.ProjectDeploy{}
+	rs, err := me.Db.Query(sqlFindProjectDeploys, projectID)
+	if err != nil {
+		return deploys, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		deploy, err := scanProjectDeploy(rs)
+		if err != nil {
+			return deploys, err
+		}
+		deploys = append(deploys, deploy)
+	}
+	if rs.Err() != nil {
+		return deploys, rs.Err()
+	}
+	return deploys, nil
+}
+
+func (me *SqliteDB) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	deploy, err := scanProjectDeploy(me.Db.QueryRow(sqlFindCurrentDeploy, userID, projectName))
+	if err != nil {
+		return nil, err
+	}
+	return deploy, nil
+}
+
+// SetCurrentDeploy swaps which revision of a project is served.
+func (me *SqliteDB) SetCurrentDeploy(projectID string, revision int) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlResetCurrentDeploy, projectID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(sqlSetCurrentDeploy, projectID, revision)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("revision (%d) not found", revision)
+	}
+
+	return tx.Commit()
+}
+
+// ClearCurrentDeploy goes back to serving the project directory itself.
+func (me *SqliteDB) ClearCurrentDeploy(userID, projectName string) error {
+	_, err := me.Db.Exec(sqlClearCurrentDeploy, userID, projectName)
+	return err
+}
+
+func (me *SqliteDB) RemoveProjectDeploy(deployID string) error {
+	_, err := me.Db.Exec(sqlRemoveProjectDeploy, deployID)
+	return err
+}
+
+func (me *SqliteDB) InsertWebhook(userID, url, secret string) (string, error) {
+	var id string
+	err := me.Db.QueryRow(sqlInsertWebhook, userID, url, secret).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (me *SqliteDB) FindWebhooksForUser(userID string) ([]*db.Webhook, error) {
+	webhooks := []*db.Webhook{}
+	rs, err := me.Db.Query(sqlFindWebhooksForUser, userID)
+	if err != nil {
+		return webhooks, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		webhook := &db.Webhook{}
+		err := rs.Scan(
+			&webhook.ID,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Secret,
+			&webhook.CreatedAt,
+		)
+		if err != nil {
+			return webhooks, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if rs.Err() != nil {
+		return webhooks, rs.Err()
+	}
+	return webhooks, nil
+}
+
+func (me *SqliteDB) RemoveWebhook(userID, webhookID string) error {
+	res, err := me.Db.Exec(sqlRemoveWebhook, userID, webhookID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("webhook (%s) not found", webhookID)
+	}
+	return nil
+}
+
+func (me *SqliteDB) InsertAuditEntry(entry *db.AuditEntry) error {
+	_, err := me.Db.Exec(
+		sqlInsertAuditEntry,
+		entry.UserID,
+		entry.ActorID,
+		entry.Actor,
+		entry.Space,
+		entry.Action,
+		entry.SessionID,
+		entry.Path,
+		entry.RemoteAddr,
+	)
+	return err
+}
+
+func (me *SqliteDB) FindAuditLog(userID string, since time.Time, limit int) ([]*db.AuditEntry, error) {
+	entries := []*db.AuditEntry{}
+	rs, err := me.Db.Query(sqlFindAuditLog, userID, since, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		entry := &db.AuditEntry{}
+		err := rs.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.ActorID,
+			&entry.Actor,
+			&entry.Space,
+			&entry.Action,
+			&entry.SessionID,
+			&entry.Path,
+			&entry.RemoteAddr,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rs.Err()
+}
+
+func (me *SqliteDB) SetProjectEnv(projectID, key, value string) error {
+	_, err := me.Db.Exec(sqlSetProjectEnv, projectID, key, value)
+	return err
+}
+
+func (me *SqliteDB) RemoveProjectEnv(projectID, key string) error {
+	res, err := me.Db.Exec(sqlRemoveProjectEnv, projectID, key)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("variable (%s) not found", key)
+	}
+	return nil
+}
+
+func (me *SqliteDB) FindProjectEnv(projectID string) ([]*db.ProjectEnv, error) {
+	env := []*db.ProjectEnv{}
+	rs, err := me.Db.Query(sqlFindProjectEnv, projectID)
+	if err != nil {
+		return env, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		variable := &db.ProjectEnv{}
+		err := rs.Scan(
+			&variable.ID,
+			&variable.ProjectID,
+			&variable.Key,
+			&variable.Value,
+			&variable.CreatedAt,
+			&variable.UpdatedAt,
+		)
+		if err != nil {
+			return env, err
+		}
+		env = append(env, variable)
+	}
+	return env, rs.Err()
+}
+
+func (me *SqliteDB) SetProjectSigningKey(projectID, key string) error {
+	_, err := me.Db.Exec(sqlSetProjectSigningKey, projectID, key)
+	return err
+}
+
+func (me *SqliteDB) RemoveProjectSigningKey(projectID string) error {
+	res, err := me.Db.Exec(sqlRemoveProjectSigningKey, projectID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("signing key not found")
+	}
+	return nil
+}
+
+func (me *SqliteDB) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	key := &db.ProjectSigningKey{}
+	err := me.Db.QueryRow(sqlFindProjectSigningKey, projectID).Scan(
+		&key.ProjectID,
+		&key.Key,
+		&key.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (me *SqliteDB) UpsertDigestSubscription(userID string) (*db.DigestSubscription, error) {
+	sub := &db.DigestSubscription{}
+	err := me.Db.QueryRow(sqlUpsertDigestSubscription, userID).Scan(
+		&sub.UserID,
+		&sub.Token,
+		&sub.UnsubscribedAt,
+		&sub.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (me *SqliteDB) UnsubscribeDigests(token string) (*db.DigestSubscription, error) {
+	sub := &db.DigestSubscription{}
+	err := me.Db.QueryRow(sqlUnsubscribeDigests, token).Scan(
+		&sub.UserID,
+		&sub.Token,
+		&sub.UnsubscribedAt,
+		&sub.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("unsubscribe token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (me *SqliteDB) ResubscribeDigests(userID string) error {
+	_, err := me.Db.Exec(sqlResubscribeDigests, userID)
+	return err
+}
+
+func (me *SqliteDB) AddPostEmailSender(userID, email string) error {
+	_, err := me.Db.Exec(sqlAddPostEmailSender, userID, email)
+	return err
+}
+
+func (me *SqliteDB) RemovePostEmailSender(userID, email string) error {
+	res, err := me.Db.Exec(sqlRemovePostEmailSender, userID, email)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("email sender not found")
+	}
+	return nil
+}
+
+func (me *SqliteDB) FindPostEmailSenders(userID string) ([]*db.PostEmailSender, error) {
+	senders := []*db.PostEmailSender{}
+	rs, err := me.Db.Query(sqlFindPostEmailSenders, userID)
+	if err != nil {
+		return senders, err
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		sender := &db.PostEmailSender{}
+		err := rs.Scan(&sender.UserID, &sender.Email, &sender.CreatedAt)
+		if err != nil {
+			return senders, err
+		}
+		senders = append(senders, sender)
+	}
+	return senders, rs.Err()
+}
+
+func (me *SqliteDB) UpsertDomainCert(cert *db.DomainCert) error {
+	_, err := me.Db.Exec(sqlUpsertDomainCert, cert.Domain, cert.CertPEM, cert.KeyPEM, cert.ExpiresAt)
+	return err
+}
+
+func (me *SqliteDB) FindDomainCert(domain string) (*db.DomainCert, error) {
+	cert := &db.DomainCert{}
+	err := me.Db.QueryRow(sqlFindDomainCert, domain).Scan(
+		&cert.ID,
+		&cert.Domain,
+		&cert.CertPEM,
+		&cert.KeyPEM,
+		&cert.ExpiresAt,
+		&cert.CreatedAt,
+		&cert.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (me *SqliteDB) FindDomainsForCerts(renewBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	return me.findProjectDomains(sqlFindDomainsForCerts, renewBefore, limit)
+}
+
+func (me *SqliteDB) InsertTrashObject(obj *db.TrashObject) error {
+	_, err := me.Db.Exec(sqlInsertTrashObject, obj.UserID, obj.Path, obj.TrashPath, obj.Size, obj.ExpiresAt)
+	return err
+}
+
+func (me *SqliteDB) findTrashObjects(query string, args ...any) ([]*db.TrashObject, error) {
+	objs := []*db.TrashObject{}
+	rs, err := me.Db.Query(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		obj := &db.TrashObject{}
+		err := rs.Scan(
+			&obj.ID,
+			&obj.UserID,
+			&obj.Path,
+			&obj.TrashPath,
+			&obj.Size,
+			&obj.ExpiresAt,
+			&obj.CreatedAt,
+		)
+		if err != nil {
+			return objs, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, rs.Err()
+}
+
+func (me *SqliteDB) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	return me.findTrashObjects(sqlFindTrashObjects, userID)
+}
+
+func (me *SqliteDB) RemoveTrashObject(id string) error {
+	_, err := me.Db.Exec(sqlRemoveTrashObject, id)
+	return err
+}
+
+// ClaimExpiredTrash marks up to limit expired trash objects as claimed the
+// same way ClaimExpiredProjects does.
+func (me *SqliteDB) ClaimExpiredTrash(limit int) ([]*db.TrashObject, error) {
+	now := time.Now()
+	return me.findTrashObjects(sqlClaimExpiredTrash, limit, now, now.Add(-expireClaimTimeout))
+}
+
+func (me *SqliteDB) CreateOrg(ownerID, name string) (*db.User, error) {
+	lowerName := strings.ToLower(name)
+	valid, err := me.ValidateName(lowerName)
+	if !valid {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var id string
+	err = tx.QueryRow(sqlInsertUser, lowerName).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(sqlInsertOrg, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(sqlSetOrgMember, id, ownerID, db.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return me.FindOrgForName(lowerName)
+}
+
+func (me *SqliteDB) FindOrgForName(name string) (*db.User, error) {
+	user := &db.User{}
+	err := me.Db.QueryRow(sqlFindOrgForName, strings.ToLower(name)).Scan(
+		&user.ID,
+		&user.Name,
+		&user.CreatedAt,
+		&user.SuspendedAt,
+		&user.ReadOnlyAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func scanOrgMember(r RowScanner) (*db.OrgMember, error) {
+	member := &db.OrgMember{}
+	err := r.Scan(
+		&member.ID,
+		&member.OrgID,
+		&member.UserID,
+		&member.Name,
+		&member.Role,
+		&member.CreatedAt,
+	)
+	return member, err
+}
+
+func (me *SqliteDB) FindOrgMember(orgID, userID string) (*db.OrgMember, error) {
+	r := me.Db.QueryRow(sqlSelectOrgMember+` WHERE org_members.org_id = $1 AND org_members.user_id = $2;`, orgID, userID)
+	member, err := scanOrgMember(r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, db.ErrNotOrgMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (me *SqliteDB) FindOrgMembers(orgID string) ([]*db.OrgMember, error) {
+	members := []*db.OrgMember{}
+	rs, err := me.Db.Query(sqlSelectOrgMember+` WHERE org_members.org_id = $1 ORDER BY app_users.name ASC;`, orgID)
+	if err != nil {
+		return members, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		member, err := scanOrgMember(rs)
+		if err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, rs.Err()
+}
+
+func (me *SqliteDB) SetOrgMember(orgID, userID, role string) error {
+	_, err := me.Db.Exec(sqlSetOrgMember, orgID, userID, role)
+	return err
+}
+
+func (me *SqliteDB) RemoveOrgMember(orgID, userID string) error {
+	_, err := me.Db.Exec(sqlRemoveOrgMember, orgID, userID)
+	return err
+}
+
+func (me *SqliteDB) SetProjectAccess(projectID string, entries []*db.ProjectAccess) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlRemoveProjectAccess, projectID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		_, err = tx.Exec(sqlInsertProjectAccess, projectID, entry.Kind, entry.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (me *SqliteDB) FindProjectAccess(projectID string) ([]*db.ProjectAccess, error) {
+	entries := []*db.ProjectAccess{}
+	rs, err := me.Db.Query(sqlFindProjectAccess, projectID)
+	if err != nil {
+		return entries, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		entry := &db.ProjectAccess{}
+		err := rs.Scan(
+			&entry.ID,
+			&entry.ProjectID,
+			&entry.Kind,
+			&entry.Value,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rs.Err()
+}
+
+func (me *SqliteDB) InsertProjectEvent(event *db.ProjectEvent) error {
+	_, err := me.Db.Exec(sqlInsertProjectEvent, event.UserID, event.ProjectName, event.Event, event.FileCount)
+	return err
+}
+
+func (me *SqliteDB) FindProjectEventsForUser(userID string, limit int) ([]*db.ProjectEvent, error) {
+	events := []*db.ProjectEvent{}
+	rs, err := me.Db.Query(sqlFindProjectEventsForUser, userID, limit)
+	if err != nil {
+		return events, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		event := &db.ProjectEvent{}
+		err := rs.Scan(
+			&event.ID,
+			&event.UserID,
+			&event.ProjectName,
+			&event.Event,
+			&event.FileCount,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, rs.Err()
+}
+
+func (me *SqliteDB) AddAnalytics(day *db.AnalyticsDay) error {
+	_, err := me.Db.Exec(
+		sqlAddAnalytics,
+		day.UserID,
+		day.Space,
+		day.Name,
+		day.Day.Format(time.DateOnly),
+		day.Hits,
+		day.Uniques,
+	)
+	return err
+}
+
+func (me *SqliteDB) FindAnalytics(userID, space, name string, since time.Time) ([]*db.AnalyticsDay, error) {
+	days := []*db.AnalyticsDay{}
+	rs, err := me.Db.Query(sqlFindAnalytics, userID, space, name, since.Format(time.DateOnly))
+	if err != nil {
+		return days, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		day := &db.AnalyticsDay{}
+		err := rs.Scan(&day.UserID, &day.Space, &day.Name, &day.Day, &day.Hits, &day.Uniques)
+		if err != nil {
+			return days, err
+		}
+		days = append(days, day)
+	}
+	return days, rs.Err()
+}
+
+func (me *SqliteDB) AddBandwidth(month *db.BandwidthMonth) error {
+	_, err := me.Db.Exec(
+		sqlAddBandwidth,
+		month.UserID,
+		month.Space,
+		month.Name,
+		month.Month.Format(time.DateOnly),
+		month.Bytes,
+	)
+	return err
+}
+
+func (me *SqliteDB) FindBandwidth(userID, space string, month time.Time) ([]*db.BandwidthMonth, error) {
+	months := []*db.BandwidthMonth{}
+	rs, err := me.Db.Query(sqlFindBandwidth, userID, space, month.Format(time.DateOnly))
+	if err != nil {
+		return months, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		found := &db.BandwidthMonth{}
+		err := rs.Scan(&found.UserID, &found.Space, &found.Name, &found.Month, &found.Bytes)
+		if err != nil {
+			return months, err
+		}
+		months = append(months, found)
+	}
+	return months, rs.Err()
+}
+
+func (me *SqliteDB) UpsertObjectManifest(manifest *db.ObjectManifest) error {
+	_, err := me.Db.Exec(
+		sqlUpsertObjectManifest,
+		manifest.Bucket,
+		manifest.Path,
+		manifest.Checksum,
+		manifest.Size,
+		manifest.Meta,
+		time.Now(),
+	)
+	return err
+}
+
+func scanObjectManifest(r RowScanner) (*db.ObjectManifest, error) {
+	manifest := &db.ObjectManifest{}
+	err := r.Scan(
+		&manifest.Bucket,
+		&manifest.Path,
+		&manifest.Checksum,
+		&manifest.Size,
+		&manifest.Meta,
+		&manifest.UpdatedAt,
+	)
+	return manifest, err
+}
+
+func (me *SqliteDB) FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error) {
+	return scanObjectManifest(me.Db.QueryRow(sqlFindObjectManifest, bucket, fpath))
+}
+
+// FindObjectManifests returns every path in bucket starting with prefix.
+func (me *SqliteDB) FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error) {
+	manifests := []*db.ObjectManifest{}
+	rs, err := me.Db.Query(sqlFindObjectManifests, bucket, prefix)
+	if err != nil {
+		return manifests, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		manifest, err := scanObjectManifest(rs)
+		if err != nil {
+			return manifests, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	if rs.Err() != nil {
+		return manifests, rs.Err()
+	}
+	return manifests, nil
+}
+
+func (me *SqliteDB) RemoveObjectManifest(bucket, fpath string) error {
+	_, err := me.Db.Exec(sqlRemoveObjectManifest, bucket, fpath)
+	return err
+}
+
+// CountObjectManifestRefs is how many paths in bucket point at checksum.
+func (me *SqliteDB) CountObjectManifestRefs(bucket, checksum string) (int, error) {
+	var count int
+	err := me.Db.QueryRow(sqlCountObjectManifestRef, bucket, checksum).Scan(&count)
+	return count, err
+}
+
+func (me *SqliteDB) SeedStorageUsage(userID string, used int64) error {
+	_, err := me.Db.Exec(sqlSeedStorageUsage, userID, used)
+	return err
+}
+
+func (me *SqliteDB) ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	return me.holdStorage(userID, projectName, size, max, expiresAt, false)
+}
+
+func (me *SqliteDB) ReserveProjectStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	return me.holdStorage(userID, projectName, size, max, expiresAt, true)
+}
+
+// holdStorage locks the usage of the user so two uploads can't both see
+// the same free space. A reservation replaces the one of its project, the
+// holds of uploads name no project.
+func (me *SqliteDB) holdStorage(userID, projectName string, size, max int64, expiresAt time.Time, reservation bool) (string, error) {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// a user without usage yet starts out empty
+	_, err = tx.Exec(sqlSeedStorageUsage, userID, 0)
+	if err != nil {
+		return "", err
+	}
+	var used int64
+	err = tx.QueryRow(sqlLockStorageUsage, userID).Scan(&used)
+	if err != nil {
+		return "", err
+	}
+	var held int64
+	err = tx.QueryRow(sqlFindStorageHeld, userID, time.Now(), projectName).Scan(&held)
+	if err != nil {
+		return "", err
+	}
+	if max > 0 && used+held+size > max {
+		return "", db.ErrQuotaExceeded
+	}
+
+	holdProject := ""
+	if reservation {
+		holdProject = projectName
+		_, err = tx.Exec(sqlRemoveReservation, userID, projectName)
+		if err != nil {
+			return "", err
+		}
+	}
+	var id string
+	err = tx.QueryRow(sqlInsertStorageHold, userID, size, expiresAt, holdProject).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, tx.Commit()
+}
+
+func (me *SqliteDB) CommitStorage(userID, holdID string, delta int64) error {
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(sqlRemoveStorageHold, holdID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sqlAddStorageUsage, userID, delta)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (me *SqliteDB) ReleaseStorage(holdID string) error {
+	_, err := me.Db.Exec(sqlRemoveStorageHold, holdID)
+	return err
+}
+
+func (me *SqliteDB) AddStorageUsage(userID string, delta int64) error {
+	_, err := me.Db.Exec(sqlAddStorageUsage, userID, delta)
+	return err
+}
+
+func (me *SqliteDB) SetStorageUsage(userID string, used int64) (bool, error) {
+	res, err := me.Db.Exec(sqlSetStorageUsage, userID, used, time.Now())
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+func (me *SqliteDB) FindStorageUsages() ([]*db.StorageUsage, error) {
+	usages := []*db.StorageUsage{}
+	rs, err := me.Db.Query(sqlFindStorageUsages, time.Now())
+	if err != nil {
+		return usages, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		usage := &db.StorageUsage{}
+		err := rs.Scan(&usage.UserID, &usage.Used, &usage.Held, &usage.ReconciledAt)
+		if err != nil {
+			return usages, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rs.Err()
+}
+
+func (me *SqliteDB) RemoveExpiredStorageHolds() (int, error) {
+	res, err := me.Db.Exec(sqlRemoveExpiredStorageHolds, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+func (me *SqliteDB) RenameProject(userID, oldName, newName string) error {
+	_, err := me.FindProjectByName(userID, newName)
+	if err == nil {
+		return fmt.Errorf("project (%s) already exists", newName)
+	}
+
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now()
+	_, err = tx.Exec(sqlRenameProject, userID, oldName, newName, now)
+	if err != nil {
+		return err
+	}
+
+	// the project itself and any projects linking to it
+	_, err = tx.Exec(sqlRenameProjectDir, userID, oldName, newName, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LinkToProject points a project at the files of another. A project that
+// is itself a link cannot be linked to so a deploy never fans out through
+// a chain of links.
+func (me *SqliteDB) LinkToProject(userID, projectID, projectDir string, commit bool) error {
+	linkToProject, err := me.FindProjectByName(userID, projectDir)
+	if err != nil {
+		return err
+	}
+	isAlreadyLinked := linkToProject.Name != linkToProject.ProjectDir
+	sameProject := linkToProject.ID == projectID
+
+	if !sameProject && isAlreadyLinked {
+		return fmt.Errorf(
+			"cannot link (%s) to (%s) because it is also a link to (%s)",
+			projectID,
+			projectDir,
+			linkToProject.ProjectDir,
+		)
+	}
+
+	if commit {
+		_, err = me.Db.Exec(
+			sqlLinkToProject,
+			projectDir,
+			time.Now(),
+			projectID,
+		)
+	}
+	return err
+}
+
+func (me *SqliteDB) RemoveProject(projectID string) error {
+	_, err := me.Db.Exec(sqlRemoveProject, projectID)
+	return err
+}
+
+func (me *SqliteDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	return createProjectFromRow(me.Db.QueryRow(sqlFindProjectByName, userID, name))
+}
+
+func (me *SqliteDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	return me.findProjects(sqlFindProjectLinks, userID, name)
+}
+
+func (me *SqliteDB) FindProjectsByPrefix(userID, prefix string) ([]*db.Project, error) {
+	return me.findProjects(sqlFindProjectsByPrefix, userID, prefix+"%")
+}
+
+// FindStaleProjects returns the projects of a user that have not been
+// updated since updatedBefore, oldest first.
+func (me *SqliteDB) FindStaleProjects(userID string, updatedBefore time.Time) ([]*db.Project, error) {
+	return me.findProjects(sqlFindStaleProjects, userID, updatedBefore)
+}
+
+func (me *SqliteDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	return me.findProjects(sqlFindProjectsByUser, userID)
+}
+
+func (me *SqliteDB) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.Project], error) {
+	var projects []*db.Project
+	sqlFindAllProjects := fmt.Sprintf(`
+	SELECT projects.id, user_id, app_users.name as username, projects.name, project_dir, projects.acl, projects.csp, projects.sitemap, projects.expires_at, projects.created_at, projects.updated_at
+	FROM projects
+	LEFT JOIN app_users ON app_users.id = projects.user_id
+	ORDER BY %s DESC
+	LIMIT $1 OFFSET $2`, by)
+	rs, err := me.Db.Query(sqlFindAllProjects, page.Num, page.Num*page.Page)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		project := &db.Project{}
+		err := rs.Scan(
+			&project.ID,
+			&project.UserID,
+			&project.Username,
+			&project.Name,
+			&project.ProjectDir,
+			&project.Acl,
+			&project.Csp,
+			&project.Sitemap,
+			&project.ExpiresAt,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, project)
+	}
+	if rs.Err() != nil {
+		return nil, rs.Err()
+	}
+
+	var count int
+	err = me.Db.QueryRow(sqlSelectProjectCount).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := &db.Paginate[*db.Project]{
+		Data:  projects,
+		Total: int(math.Ceil(float64(count) / float64(page.Num))),
+	}
+
+	return pager, nil
+}
+
+func (me *SqliteDB) InsertToken(userID, name string) (string, error) {
+	return me.InsertScopedToken(userID, name, db.TokenScopeDefault)
+}
+
+func (me *SqliteDB) InsertScopedToken(userID, name, scope string) (string, error) {
+	var token string
+	err := me.Db.QueryRow(sqlInsertToken, userID, name, scope).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (me *SqliteDB) RemoveToken(tokenID string) error {
+	_, err := me.Db.Exec(sqlRemoveToken, tokenID)
+	return err
+}
+
+func (me *SqliteDB) FindTokensForUser(userID string) ([]*db.Token, error) {
+	var keys []*db.Token
+	rs, err := me.Db.Query(sqlSelectTokensForUser, userID)
+	if err != nil {
+		return keys, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		pk := &db.Token{}
+		err := rs.Scan(&pk.ID, &pk.UserID, &pk.Name, &pk.Scope, &pk.CreatedAt, &pk.ExpiresAt)
+		if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, pk)
+	}
+	if rs.Err() != nil {
+		return keys, rs.Err()
+	}
+	return keys, nil
+}
+
+func (me *SqliteDB) AddPicoPlusUser(username, paymentType, txId string) error {
+	user, err := me.FindUserForName(username)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := me.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if paymentType != "" {
+		data := db.PaymentHistoryData{
+			Notes: "",
+			TxID:  txId,
+		}
+		_, err := tx.Exec(sqlInsertPaymentHistory, user.ID, paymentType, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, feature := range picoPlusFeatures {
+		_, err := tx.Exec(sqlInsertFeatureFlag, user.ID, feature.name, feature.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
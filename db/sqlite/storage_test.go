@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/picosh/pico/db/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbpool := NewDB("sqlite://"+filepath.Join(t.TempDir(), "pico.db"), slog.Default())
+	defer dbpool.Close()
+	dbtest.Run(t, dbpool)
+}
+
+func TestMigrateTwice(t *testing.T) {
+	dbpool := NewDB("sqlite:"+filepath.Join(t.TempDir(), "pico.db"), slog.Default())
+	defer dbpool.Close()
+	versions, err := dbpool.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("expected nothing left to migrate, got %v", versions)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	fixtures := []struct {
+		url    string
+		prefix string
+	}{
+		{url: "sqlite:///var/lib/pico.db", prefix: "file:/var/lib/pico.db?_pragma"},
+		{url: "sqlite:pico.db", prefix: "file:pico.db?_pragma"},
+		{url: "sqlite:pico.db?cache=shared", prefix: "file:pico.db?cache=shared&_pragma"},
+	}
+	for _, fixture := range fixtures {
+		actual := dsn(fixture.url)
+		if actual[:len(fixture.prefix)] != fixture.prefix {
+			t.Errorf("expected (%s) to start with (%s), got (%s)", fixture.url, fixture.prefix, actual)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/shared"
 	"github.com/picosh/pico/shared/storage"
 )
@@ -21,9 +21,51 @@ func createStaticRoutes() []shared.Route {
 	}
 }
 
+type UnsubscribePageData struct {
+	Site         shared.SitePageData
+	Token        string
+	Unsubscribed bool
+}
+
+// unsubscribeHandler asks before stopping the digests of a user on GET, so
+// link scanners do not unsubscribe anyone, and stops them on POST, which is
+// also what one-click unsubscribe in mail clients sends.
+func unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	logger := shared.GetLogger(r)
+	cfg := shared.GetCfg(r)
+	dbpool := shared.GetDB(r)
+	token := shared.GetField(r, 0)
+
+	data := UnsubscribePageData{Site: *cfg.GetSiteData(), Token: token}
+	if r.Method == http.MethodPost {
+		sub, err := dbpool.UnsubscribeDigests(token)
+		if err != nil {
+			logger.Info("could not unsubscribe", "err", err.Error())
+			http.Error(w, "unsubscribe link not found", http.StatusNotFound)
+			return
+		}
+		logger.Info("unsubscribed from digests", "userId", sub.UserID)
+		data.Unsubscribed = true
+	}
+
+	ts, err := shared.RenderTemplate(cfg, []string{cfg.StaticPath("html/unsubscribe.page.tmpl")})
+	if err != nil {
+		logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = ts.Execute(w, data)
+	if err != nil {
+		logger.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func createMainRoutes(staticRoutes []shared.Route) []shared.Route {
 	routes := []shared.Route{
 		shared.NewRoute("GET", "/", shared.CreatePageHandler("html/marketing.page.tmpl")),
+		shared.NewRoute("GET", "/unsubscribe/([^/]+)", unsubscribeHandler),
+		shared.NewRoute("POST", "/unsubscribe/([^/]+)", unsubscribeHandler),
 	}
 
 	routes = append(
@@ -36,17 +78,13 @@ func createMainRoutes(staticRoutes []shared.Route) []shared.Route {
 
 func StartApiServer() {
 	cfg := NewConfigSite()
-	db := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	db := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer db.Close()
 	logger := cfg.Logger
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
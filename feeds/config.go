@@ -1,7 +1,10 @@
 package feeds
 
 import (
+	"time"
+
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/clientip"
 	"github.com/picosh/pico/wish/cms/config"
 )
 
@@ -15,11 +18,19 @@ func NewConfigSite() *shared.ConfigSite {
 	protocol := shared.GetEnv("FEEDS_PROTOCOL", "https")
 	allowRegister := shared.GetEnv("FEEDS_ALLOW_REGISTER", "1")
 	storageDir := shared.GetEnv("IMGS_STORAGE_DIR", ".storage")
+	storageBackend := shared.GetEnv("STORAGE_BACKEND", "")
 	minioURL := shared.GetEnv("MINIO_URL", "")
 	minioUser := shared.GetEnv("MINIO_ROOT_USER", "")
 	minioPass := shared.GetEnv("MINIO_ROOT_PASSWORD", "")
 	dbURL := shared.GetEnv("DATABASE_URL", "")
+	trustedProxies := shared.GetEnv("TRUSTED_PROXIES", clientip.PrivateRanges)
+	sessionIdleTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_IDLE_TIMEOUT", "15m"))
+	sessionMaxTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_MAX_TIMEOUT", "6h"))
+	sessionKeepAlive, _ := time.ParseDuration(shared.GetEnv("SSH_KEEPALIVE_INTERVAL", "30s"))
 	sendgridKey := shared.GetEnv("SENDGRID_API_KEY", "")
+	smtpAddr := shared.GetEnv("FEEDS_SMTP_ADDR", "")
+	smtpUser := shared.GetEnv("FEEDS_SMTP_USER", "")
+	smtpPass := shared.GetEnv("FEEDS_SMTP_PASS", "")
 	useImgProxy := shared.GetEnv("USE_IMGPROXY", "1")
 
 	intro := "To get started, enter a username.\n"
@@ -27,27 +38,35 @@ func NewConfigSite() *shared.ConfigSite {
 
 	return &shared.ConfigSite{
 		Debug:                debug == "1",
+		TrustedProxies:       clientip.ParseTrusted(shared.SplitList(trustedProxies)),
+		SessionIdleTimeout:   sessionIdleTimeout,
+		SessionMaxTimeout:    sessionMaxTimeout,
+		SessionKeepAlive:     sessionKeepAlive,
 		SubdomainsEnabled:    subdomains == "1",
 		CustomdomainsEnabled: customdomains == "1",
 		UseImgProxy:          useImgProxy == "1",
 		SendgridKey:          sendgridKey,
+		SmtpAddr:             smtpAddr,
+		SmtpUser:             smtpUser,
+		SmtpPass:             smtpPass,
 		ConfigCms: config.ConfigCms{
-			Domain:        domain,
-			Email:         email,
-			Port:          port,
-			Protocol:      protocol,
-			DbURL:         dbURL,
-			StorageDir:    storageDir,
-			MinioURL:      minioURL,
-			MinioUser:     minioUser,
-			MinioPass:     minioPass,
-			Description:   "An rss-to-email digest service for hackers",
-			IntroText:     intro,
-			Space:         "feeds",
-			AllowedExt:    []string{".txt"},
-			HiddenPosts:   []string{"_header.txt", "_readme.txt"},
-			Logger:        shared.CreateLogger(debug == "1"),
-			AllowRegister: allowRegister == "1",
+			Domain:         domain,
+			Email:          email,
+			Port:           port,
+			Protocol:       protocol,
+			DbURL:          dbURL,
+			StorageDir:     storageDir,
+			StorageBackend: storageBackend,
+			MinioURL:       minioURL,
+			MinioUser:      minioUser,
+			MinioPass:      minioPass,
+			Description:    "An rss-to-email digest service for hackers",
+			IntroText:      intro,
+			Space:          "feeds",
+			AllowedExt:     []string{".txt"},
+			HiddenPosts:    []string{"_header.txt", "_readme.txt"},
+			Logger:         shared.CreateLogger("feeds", debug == "1"),
+			AllowRegister:  allowRegister == "1",
 		},
 	}
 }
@@ -7,6 +7,7 @@ import (
 	html "html/template"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
@@ -14,8 +15,6 @@ import (
 	"github.com/mmcdole/gofeed"
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/shared"
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
 var ErrNoRecentArticles = errors.New("no recent articles")
@@ -63,6 +62,8 @@ type DigestFeed struct {
 
 type DigestOptions struct {
 	InlineContent bool
+	// UnsubscribeURL stops every digest of the user when visited
+	UnsubscribeURL string
 }
 
 func itemToTemplate(item *gofeed.Item) *FeedItemTmpl {
@@ -85,9 +86,9 @@ func digestOptionToTime(date time.Time, interval string) time.Time {
 		return date.Add(6 * time.Hour)
 	} else if interval == "12hour" {
 		return date.Add(12 * time.Hour)
-	} else if interval == "1day" || interval == "" {
+	} else if interval == "1day" || interval == "daily" || interval == "" {
 		return date.Add(1 * day)
-	} else if interval == "7day" {
+	} else if interval == "7day" || interval == "weekly" {
 		return date.Add(7 * day)
 	} else if interval == "30day" {
 		return date.Add(30 * day)
@@ -107,18 +108,34 @@ func isValidItem(item *gofeed.Item, feedItems []*db.FeedItem) bool {
 	return true
 }
 
+// feedInterval is the interval a feed is digested at when its line names
+// one, e.g. `=> https://example.com/rss weekly`, instead of the interval of
+// the post.
+func feedInterval(item *shared.ListItem) string {
+	if item.IsURL && slices.Contains(shared.DigestIntervalOpts, item.Value) {
+		return item.Value
+	}
+	return ""
+}
+
 type Fetcher struct {
-	cfg *shared.ConfigSite
-	db  db.DB
+	cfg    *shared.ConfigSite
+	db     db.DB
+	sender Sender
 }
 
 func NewFetcher(dbpool db.DB, cfg *shared.ConfigSite) *Fetcher {
 	return &Fetcher{
-		db:  dbpool,
-		cfg: cfg,
+		db:     dbpool,
+		cfg:    cfg,
+		sender: NewSender(cfg),
 	}
 }
 
+func (f *Fetcher) UnsubscribeURL(token string) string {
+	return fmt.Sprintf("%s://%s/unsubscribe/%s", f.cfg.Protocol, f.cfg.Domain, token)
+}
+
 func (f *Fetcher) Validate(lastDigest *time.Time, parsed *shared.ListParsedText) error {
 	if lastDigest == nil {
 		return nil
@@ -137,14 +154,25 @@ func (f *Fetcher) RunPost(user *db.User, post *db.Post) error {
 
 	parsed := shared.ListParseText(post.Text)
 
-	f.cfg.Logger.Info("last digest at", "user", user.Name, "lastDigest", post.Data.LastDigest)
-	err := f.Validate(post.Data.LastDigest, parsed)
+	sub, err := f.db.UpsertDigestSubscription(user.ID)
 	if err != nil {
-		f.cfg.Logger.Info(err.Error(), "user", user.Name)
+		return err
+	}
+	if sub.IsUnsubscribed() {
+		f.cfg.Logger.Info("user unsubscribed from digests, skipping", "user", user.Name)
 		return nil
 	}
 
+	f.cfg.Logger.Info("last digest at", "user", user.Name, "lastDigest", post.Data.LastDigest)
+	postErr := f.Validate(post.Data.LastDigest, parsed)
+	if postErr != nil {
+		f.cfg.Logger.Info(postErr.Error(), "user", user.Name)
+	}
+
+	now := time.Now().UTC()
 	urls := []string{}
+	// feeds with their own interval, their digest time is kept apart
+	scheduled := []string{}
 	for _, item := range parsed.Items {
 		url := ""
 		if item.IsText {
@@ -157,27 +185,63 @@ func (f *Fetcher) RunPost(user *db.User, post *db.Post) error {
 			continue
 		}
 
+		interval := feedInterval(item)
+		if interval == "" {
+			if postErr != nil {
+				continue
+			}
+		} else {
+			last := post.Data.FeedDigests[url]
+			if last == nil {
+				last = post.Data.LastDigest
+			}
+			if last != nil && digestOptionToTime(*last, interval).After(now) {
+				continue
+			}
+			scheduled = append(scheduled, url)
+		}
+
 		urls = append(urls, url)
 	}
 
-	msgBody, err := f.FetchAll(urls, parsed.InlineContent, post.ID, user.Name)
+	if len(urls) == 0 {
+		return nil
+	}
+
+	opts := DigestOptions{
+		InlineContent:  parsed.InlineContent,
+		UnsubscribeURL: f.UnsubscribeURL(sub.Token),
+	}
+	msgBody, err := f.FetchAll(urls, opts, post.ID, user.Name)
 	if err != nil {
 		return err
 	}
 
 	subject := fmt.Sprintf("%s feed digest", post.Title)
-	err = f.SendEmail(user.Name, parsed.Email, subject, msgBody)
+	err = f.SendEmail(user.Name, parsed.Email, subject, msgBody, opts.UnsubscribeURL)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().UTC()
-	post.Data.LastDigest = &now
+	if postErr == nil {
+		post.Data.LastDigest = &now
+	}
+	if len(scheduled) > 0 && post.Data.FeedDigests == nil {
+		post.Data.FeedDigests = map[string]*time.Time{}
+	}
+	for _, url := range scheduled {
+		post.Data.FeedDigests[url] = &now
+	}
 	_, err = f.db.UpdatePost(post)
 	return err
 }
 
 func (f *Fetcher) RunUser(user *db.User) error {
+	// suspended users get no digests
+	if user.IsSuspended() {
+		return nil
+	}
+
 	posts, err := f.db.FindPostsForUser(&db.Pager{Num: 1000}, user.ID, "feeds")
 	if err != nil {
 		return err
@@ -316,9 +380,9 @@ type MsgBody struct {
 	Text string
 }
 
-func (f *Fetcher) FetchAll(urls []string, inlineContent bool, postID string, username string) (*MsgBody, error) {
+func (f *Fetcher) FetchAll(urls []string, opts DigestOptions, postID string, username string) (*MsgBody, error) {
 	fp := gofeed.NewParser()
-	feeds := &DigestFeed{Options: DigestOptions{InlineContent: inlineContent}}
+	feeds := &DigestFeed{Options: opts}
 	feedItems, err := f.db.FindFeedItemsByPostID(postID)
 	if err != nil {
 		return nil, err
@@ -378,41 +442,25 @@ func (f *Fetcher) FetchAll(urls []string, inlineContent bool, postID string, use
 	}, nil
 }
 
-func (f *Fetcher) SendEmail(username, email string, subject string, msg *MsgBody) error {
+func (f *Fetcher) SendEmail(username, email string, subject string, msg *MsgBody, unsubscribeURL string) error {
 	if email == "" {
 		return fmt.Errorf("(%s) does not have an email associated with their feed post", username)
 	}
 
-	from := mail.NewEmail("team pico", f.cfg.Email)
-	to := mail.NewEmail(username, email)
-
-	// f.cfg.Logger.Infof("message body (%s)", plainTextContent)
-
-	message := mail.NewSingleEmail(from, subject, to, msg.Text, msg.Html)
-	client := sendgrid.NewSendClient(f.cfg.SendgridKey)
-
 	f.cfg.Logger.Info("sending email digest", "user", username)
-	response, err := client.Send(message)
-	if err != nil {
-		return err
-	}
-
-	// f.cfg.Logger.Infof("(%s) email digest response: %v", username, response)
-
-	if len(response.Headers["X-Message-Id"]) > 0 {
-		f.cfg.Logger.Info(
-			"successfully sent email digest",
-			"email", email,
-			"x-message-id", response.Headers["X-Message-Id"][0],
-		)
-	} else {
-		f.cfg.Logger.Error(
-			"could not find x-message-id, which means sending an email failed",
-			"email", email,
-		)
-	}
-
-	return nil
+	return f.sender.Send(&Email{
+		FromName: "team pico",
+		From:     f.cfg.Email,
+		ToName:   username,
+		To:       email,
+		Subject:  subject,
+		Text:     msg.Text,
+		Html:     msg.Html,
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", unsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
 }
 
 func (f *Fetcher) Run() error {
@@ -0,0 +1,72 @@
+package feeds
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+)
+
+func TestFeedInterval(t *testing.T) {
+	parsed := shared.ListParseText(`=: digest_interval daily
+=> https://example.com/rss weekly
+=> https://example.com/atom
+=> https://example.com/blog my blog
+https://example.com/text`)
+
+	expected := []string{"", "weekly", "", "", ""}
+	for i, item := range parsed.Items {
+		if interval := feedInterval(item); interval != expected[i] {
+			t.Errorf("item (%s): expected interval (%s), got (%s)", item.Value, expected[i], interval)
+		}
+	}
+	if parsed.DigestInterval != "daily" {
+		t.Errorf("expected the post interval to be daily, got (%s)", parsed.DigestInterval)
+	}
+
+	date := time.Date(2024, 4, 4, 0, 0, 0, 0, time.UTC)
+	if got := digestOptionToTime(date, "weekly"); !got.Equal(date.Add(7 * 24 * time.Hour)) {
+		t.Errorf("expected weekly to be 7 days, got %s", got)
+	}
+	if got := digestOptionToTime(date, "daily"); !got.Equal(date.Add(24 * time.Hour)) {
+		t.Errorf("expected daily to be 1 day, got %s", got)
+	}
+}
+
+type feedsDB struct {
+	db.DB
+	lookups int
+}
+
+func (f *feedsDB) FindPostsForUser(pager *db.Pager, userID string, space string) (*db.Paginate[*db.Post], error) {
+	f.lookups += 1
+	return &db.Paginate[*db.Post]{}, nil
+}
+
+func TestRunUserSuspended(t *testing.T) {
+	suspendedAt := time.Now()
+	fixtures := []struct {
+		name    string
+		user    *db.User
+		lookups int
+	}{
+		{name: "active", user: &db.User{ID: "1", Name: "reader"}, lookups: 1},
+		{name: "suspended", user: &db.User{ID: "2", Name: "spammer", SuspendedAt: &suspendedAt}, lookups: 0},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dbpool := &feedsDB{}
+			cfg := &shared.ConfigSite{}
+			cfg.Logger = slog.Default()
+			err := NewFetcher(dbpool, cfg).RunUser(fixture.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dbpool.lookups != fixture.lookups {
+				t.Fatalf("expected (%d) feed lookups, found (%d)", fixture.lookups, dbpool.lookups)
+			}
+		})
+	}
+}
@@ -59,5 +59,11 @@ func (p *FeedHooks) FileMeta(s ssh.Session, data *filehandlers.PostMetaData) err
 		data.Data.LastDigest = &now
 	}
 
+	// uploading a feed post is asking for its digests again
+	err := p.Db.ResubscribeDigests(data.User.ID)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
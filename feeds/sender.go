@@ -0,0 +1,182 @@
+package feeds
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"github.com/sendgrid/sendgrid-go"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Email is a digest ready to be sent, Headers are added on top of the ones
+// every message has.
+type Email struct {
+	FromName string
+	From     string
+	ToName   string
+	To       string
+	Subject  string
+	Text     string
+	Html     string
+	Headers  map[string]string
+}
+
+// Sender delivers digests, over smtp when FEEDS_SMTP_ADDR is set and
+// through sendgrid otherwise.
+type Sender interface {
+	Send(email *Email) error
+}
+
+func NewSender(cfg *shared.ConfigSite) Sender {
+	if cfg.SmtpAddr != "" {
+		return &SmtpSender{Addr: cfg.SmtpAddr, User: cfg.SmtpUser, Pass: cfg.SmtpPass}
+	}
+	return &SendgridSender{Key: cfg.SendgridKey, Cfg: cfg}
+}
+
+type SendgridSender struct {
+	Key string
+	Cfg *shared.ConfigSite
+}
+
+func (s *SendgridSender) Send(email *Email) error {
+	from := sgmail.NewEmail(email.FromName, email.From)
+	to := sgmail.NewEmail(email.ToName, email.To)
+	message := sgmail.NewSingleEmail(from, email.Subject, to, email.Text, email.Html)
+	for key, value := range email.Headers {
+		message.SetHeader(key, value)
+	}
+	client := sendgrid.NewSendClient(s.Key)
+
+	response, err := client.Send(message)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid responded with (%d): %s", response.StatusCode, response.Body)
+	}
+
+	if len(response.Headers["X-Message-Id"]) > 0 {
+		s.Cfg.Logger.Info(
+			"successfully sent email digest",
+			"email", email.To,
+			"x-message-id", response.Headers["X-Message-Id"][0],
+		)
+	} else {
+		s.Cfg.Logger.Error(
+			"could not find x-message-id, which means sending an email failed",
+			"email", email.To,
+		)
+	}
+	return nil
+}
+
+// SmtpSender delivers to a relay at Addr (host:port), upgrading to tls
+// when it offers STARTTLS and logging in when User is set.
+type SmtpSender struct {
+	Addr string
+	User string
+	Pass string
+}
+
+func (s *SmtpSender) Send(email *Email) error {
+	msg, err := buildMessage(email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.User != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.User, s.Pass, host)
+	}
+	return smtp.SendMail(s.Addr, auth, email.From, []string{email.To}, msg)
+}
+
+func messageID(from string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	_, domain, _ := strings.Cut(from, "@")
+	if domain == "" {
+		domain = "localhost"
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// buildMessage writes email as a multipart/alternative message with the
+// text part first, clients show the last part they understand.
+func buildMessage(email *Email, date time.Time) ([]byte, error) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	parts := []struct {
+		contentType string
+		text        string
+	}{
+		{contentType: "text/plain; charset=utf-8", text: email.Text},
+		{contentType: "text/html; charset=utf-8", text: email.Html},
+	}
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.text))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"From":         (&mail.Address{Name: email.FromName, Address: email.From}).String(),
+		"To":           (&mail.Address{Name: email.ToName, Address: email.To}).String(),
+		"Subject":      mime.QEncoding.Encode("utf-8", email.Subject),
+		"Date":         date.Format(time.RFC1123Z),
+		"Message-ID":   messageID(email.From),
+		"MIME-Version": "1.0",
+		"Content-Type": fmt.Sprintf("multipart/alternative; boundary=%q", mw.Boundary()),
+	}
+	for key, value := range email.Headers {
+		headers[key] = value
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	msg := &bytes.Buffer{}
+	for _, key := range keys {
+		fmt.Fprintf(msg, "%s: %s\r\n", key, headers[key])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package feeds
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	msg, err := buildMessage(&Email{
+		FromName: "team pico",
+		From:     "hello@feeds.sh",
+		ToName:   "erock",
+		To:       "erock@example.com",
+		Subject:  "daily feed digest ✓",
+		Text:     "new articles",
+		Html:     "<p>new articles</p>",
+		Headers:  map[string]string{"List-Unsubscribe": "<https://feeds.sh/unsubscribe/abc>"},
+	}, time.Date(2024, 4, 4, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "daily feed digest ✓" {
+		t.Errorf("expected the subject to survive encoding, got (%s)", subject)
+	}
+	if parsed.Header.Get("List-Unsubscribe") != "<https://feeds.sh/unsubscribe/abc>" {
+		t.Errorf("expected the extra headers, got %v", parsed.Header)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@feeds.sh>") {
+		t.Errorf("expected a message id on the sender domain, got (%s)", parsed.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got (%s) %v", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	expected := []string{"new articles", "<p>new articles</p>"}
+	for _, text := range expected {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if string(body) != text {
+			t.Errorf("expected part (%s), got (%s)", text, body)
+		}
+	}
+}
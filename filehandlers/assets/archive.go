@@ -0,0 +1,279 @@
+package uploadassets
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// archiveKind is the format of an archive uploaded to the root of a
+// project, empty for anything else. Archives in subdirectories are stored
+// as they are.
+func archiveKind(fpath string) string {
+	dir := path.Dir(fpath)
+	if dir == "/" || path.Dir(dir) != "/" {
+		return ""
+	}
+
+	name := strings.ToLower(path.Base(fpath))
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+type ctxExpandingKey struct{}
+
+// expands is true for an archive upload that is expanded rather than
+// stored. Archives inside an archive are stored as they are.
+func (h *UploadAssetHandler) expands(s ssh.Session, entry *utils.FileEntry) bool {
+	return h.Cfg.ExpandArchives && !h.expanding(s) && archiveKind(entry.Filepath) != ""
+}
+
+// expanding is true while the files of an archive are being written.
+func (h *UploadAssetHandler) expanding(s ssh.Session) bool {
+	expanding, _ := s.Context().Value(ctxExpandingKey{}).(bool)
+	return expanding
+}
+
+// archivePath is where an archive member ends up inside the project. Names
+// that are absolute or climb out of the project are rejected.
+func archivePath(projectName, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("(%s) is an absolute path", name)
+	}
+	fpath, err := shared.SanitizeUploadPath(name)
+	if err != nil {
+		return "", err
+	}
+	if fpath == "/" {
+		return "", fmt.Errorf("(%s) is not a file", name)
+	}
+	return path.Join("/", projectName, fpath), nil
+}
+
+// archiveMember is a file inside an archive, skip is set for anything
+// that is not a regular file or a link. Symlinks carry their target in
+// link, hardlinks the name of the member they link to in hardlink.
+type archiveMember struct {
+	name     string
+	size     int64
+	mtime    int64
+	open     func() (io.ReadCloser, error)
+	link     string
+	hardlink string
+	skip     error
+}
+
+func walkTar(r io.Reader, fn func(archiveMember) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			member := archiveMember{name: hdr.Name, link: hdr.Linkname}
+			if hdr.Typeflag == tar.TypeLink {
+				member = archiveMember{name: hdr.Name, hardlink: hdr.Linkname}
+			}
+			err = fn(member)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			err = fn(archiveMember{name: hdr.Name, skip: fmt.Errorf("(%s) is not a regular file", hdr.Name)})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = fn(archiveMember{
+			name:  hdr.Name,
+			size:  hdr.Size,
+			mtime: hdr.ModTime.Unix(),
+			open:  func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(r io.ReaderAt, size int64, fn func(archiveMember) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		// zip stores the target of a symlink as its contents
+		if file.Mode()&fs.ModeSymlink != 0 {
+			member := archiveMember{name: file.Name}
+			target, err := readZipLink(file)
+			if err != nil {
+				member.skip = fmt.Errorf("(%s) is a symlink we cannot read: %w", file.Name, err)
+			} else {
+				member.link = target
+			}
+			err = fn(member)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			err = fn(archiveMember{name: file.Name, skip: fmt.Errorf("(%s) is not a regular file", file.Name)})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = fn(archiveMember{
+			name:  file.Name,
+			size:  int64(file.UncompressedSize64),
+			mtime: file.Modified.Unix(),
+			open:  file.Open,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readZipLink(file *zip.File) (string, error) {
+	if file.UncompressedSize64 > maxLinkTarget {
+		return "", fmt.Errorf("target is longer than (%d bytes)", maxLinkTarget)
+	}
+	contents, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer contents.Close()
+	target, err := io.ReadAll(io.LimitReader(contents, maxLinkTarget))
+	return string(target), err
+}
+
+// expandArchive writes every file of an archive into the project it was
+// uploaded to, each one going through `Write` like any other upload. A
+// member that is skipped or fails is reported with the rest of the output,
+// the upload only fails when the archive itself can't be read or none of
+// its files could be written.
+func (h *UploadAssetHandler) expandArchive(s ssh.Session, entry *utils.FileEntry, sp *spool) (string, error) {
+	s.Context().SetValue(ctxExpandingKey{}, true)
+	defer s.Context().SetValue(ctxExpandingKey{}, false)
+
+	projectName := shared.GetProjectName(entry)
+	lines := []string{}
+	written := 0
+
+	expand := func(member archiveMember) error {
+		if err := s.Context().Err(); err != nil {
+			return err
+		}
+		if member.skip != nil {
+			lines = append(lines, fmt.Sprintf("skipping %s", member.skip))
+			return nil
+		}
+
+		fpath, err := archivePath(projectName, member.name)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("skipping %s", err))
+			return nil
+		}
+
+		var msg string
+		switch {
+		case member.link != "":
+			_, err = storage.ResolveLink(projectName, fpath, member.link)
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("skipping (%s): %s", member.name, err))
+				return nil
+			}
+			msg, err = h.symlink(s, fpath, member.link)
+		case member.hardlink != "":
+			var src string
+			src, err = archivePath(projectName, member.hardlink)
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("skipping (%s): %s", member.name, err))
+				return nil
+			}
+			msg, err = h.hardlink(s, src, fpath)
+		default:
+			var contents io.ReadCloser
+			contents, err = member.open()
+			if err != nil {
+				return err
+			}
+			defer contents.Close()
+
+			msg, err = h.Write(s, &utils.FileEntry{
+				Filepath: fpath,
+				Size:     member.size,
+				Mtime:    member.mtime,
+				Reader:   contents,
+			})
+		}
+		if err != nil {
+			lines = append(lines, err.Error())
+			return nil
+		}
+		written += 1
+		if msg != "" {
+			lines = append(lines, msg)
+		}
+		return nil
+	}
+
+	var err error
+	switch archiveKind(entry.Filepath) {
+	case "zip":
+		err = walkZip(sp.Reader(), sp.size, expand)
+	case "tar.gz":
+		err = walkTar(io.NewSectionReader(sp.Reader(), 0, sp.size), expand)
+	}
+	if err != nil {
+		return "", fmt.Errorf("ERROR: could not expand (%s), (%d) files were written: %w", entry.Filepath, written, err)
+	}
+	if written == 0 && len(lines) > 0 {
+		return "", fmt.Errorf("ERROR: could not expand (%s):\r\n%s", entry.Filepath, strings.Join(lines, "\r\n"))
+	}
+
+	h.logger(s).Info("expanded archive", "filename", entry.Filepath, "count", written)
+	return strings.Join(lines, "\r\n"), nil
+}
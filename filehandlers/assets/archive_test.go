@@ -0,0 +1,177 @@
+package uploadassets
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+var archiveFiles = map[string]string{
+	"index.html":     "<h1>hello</h1>",
+	"css/main.html":  "<p>nested</p>",
+	"../escape.html": "<p>nope</p>",
+}
+
+func zipArchive(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, text := range archiveFiles {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(text))
+	}
+	hdr := &zip.FileHeader{Name: "link.html"}
+	hdr.SetMode(os.ModeSymlink | 0o777)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("/etc/passwd"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, text := range archiveFiles {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(text)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write([]byte(text))
+	}
+	err := tw.WriteHeader(&tar.Header{Name: "link.html", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExpandArchive(t *testing.T) {
+	for name, archive := range map[string][]byte{
+		"/test/site.zip":    zipArchive(t),
+		"/test/site.tar.gz": tarArchive(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{ExpandArchives: true})
+			handler.Cfg.AllowedExt = []string{".html"}
+
+			out, err := handler.Write(s, &utils.FileEntry{Filepath: name, Reader: bytes.NewReader(archive)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, fpath := range []string{"/test/index.html", "/test/css/main.html"} {
+				if _, err := st.GetObjectSize(bucket, fpath); err != nil {
+					t.Fatalf("expected (%s) to be expanded, got %s", fpath, err)
+				}
+			}
+			for _, fpath := range []string{name, "/escape.html", "/test/escape.html", "/test/link.html"} {
+				if _, err := st.GetObjectSize(bucket, fpath); err == nil {
+					t.Fatalf("expected (%s) not to be stored", fpath)
+				}
+			}
+
+			lines := strings.Split(out, "\r\n")
+			if len(lines) != 4 || !strings.Contains(out, "index.html") || !strings.Contains(out, "skipping (link.html)") {
+				t.Fatalf("expected one line per member, got %q", out)
+			}
+		})
+	}
+}
+
+func TestArchiveKind(t *testing.T) {
+	fixtures := map[string]string{
+		"/test/site.zip":     "zip",
+		"/test/SITE.TGZ":     "tar.gz",
+		"/test/site.tar.gz":  "tar.gz",
+		"/test/dl/site.zip":  "",
+		"/site.zip":          "",
+		"/test/site.tar.bz2": "",
+	}
+	for fpath, kind := range fixtures {
+		if archiveKind(fpath) != kind {
+			t.Fatalf("expected (%s) to be (%q), got (%q)", fpath, kind, archiveKind(fpath))
+		}
+	}
+}
+
+func TestExpandArchiveLinks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	headers := []*tar.Header{
+		{Name: "index.html", Mode: 0o644, Size: 14, Typeflag: tar.TypeReg},
+		{Name: "latest.html", Linkname: "index.html", Typeflag: tar.TypeSymlink},
+		{Name: "copy.html", Linkname: "index.html", Typeflag: tar.TypeLink},
+	}
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			_, _ = tw.Write([]byte("<h1>hello</h1>"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{ExpandArchives: true}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	_, err = handler.Write(s, &utils.FileEntry{Filepath: "/test/site.tar.gz", Reader: bytes.NewReader(buf.Bytes())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := st.GetObjectMeta(bucket, "/test/latest.html")
+	if err != nil || meta.Symlink != "index.html" {
+		t.Fatalf("expected a symlink marker, got %+v %v", meta, err)
+	}
+	size, err := st.GetObjectSize(bucket, "/test/copy.html")
+	if err != nil || size != 14 {
+		t.Fatalf("expected the hardlink to be a copy, got (%d) %v", size, err)
+	}
+}
@@ -0,0 +1,21 @@
+package uploadassets
+
+import (
+	"github.com/charmbracelet/ssh"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/audit"
+)
+
+// audit appends a change made in this session to the audit log of the
+// account being changed, dry runs change nothing so they are left out.
+func (h *UploadAssetHandler) audit(s ssh.Session, action, fpath string) {
+	if h.isDryRun(s) {
+		return
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	entry := audit.NewEntry(user, futil.GetActor(s), h.Cfg.Space, s.Context().SessionID(), s.RemoteAddr(), action, fpath)
+	audit.Record(h.DBPool, h.logger(s), entry)
+}
@@ -0,0 +1,327 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/build"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxBuildKey struct{}
+
+// pendingProjects collects the projects an upload session changed, their
+// builds and sitemaps run once the session is done.
+type pendingProjects struct {
+	mu       sync.Mutex
+	projects map[string]bool
+}
+
+func markPending(s ssh.Session, key any, projectName string) {
+	pending, ok := s.Context().Value(key).(*pendingProjects)
+	if !ok || pending == nil {
+		return
+	}
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	pending.projects[projectName] = true
+}
+
+// sorted returns the projects in the order their work runs.
+func (p *pendingProjects) sorted() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	projects := []string{}
+	for projectName := range p.projects {
+		projects = append(projects, projectName)
+	}
+	slices.Sort(projects)
+	return projects
+}
+
+// isBuildSpec is true for the `_build` file at the root of a project.
+func isBuildSpec(fpath, projectName string) bool {
+	return fpath == "/"+projectName+"/"+build.SpecFile
+}
+
+// buildLogPath is where the output of the last build of a project is kept.
+func buildLogPath(projectName string) string {
+	return path.Join(build.LogDir, projectName+".log")
+}
+
+// buildGenerators are the generators a `_build` file can pick, none when
+// builds are disabled for lack of a sandbox.
+func (h *UploadAssetHandler) buildGenerators() []string {
+	if h.Builder == nil {
+		return nil
+	}
+	return h.Cfg.BuildGenerators
+}
+
+func (h *UploadAssetHandler) markBuild(s ssh.Session, projectName string) {
+	markPending(s, ctxBuildKey{}, projectName)
+}
+
+// mirror runs write, which uploads the files of projectName, then removes
+// every file it did not upload like `rsync --delete`.
+func (h *UploadAssetHandler) mirror(s ssh.Session, projectName string, write func() error) error {
+	tracker := &rsyncTracker{seen: map[string]bool{}}
+	s.Context().SetValue(ctxRsyncTrackerKey{}, tracker)
+	err := write()
+	h.waitWrites(s)
+	s.Context().SetValue(ctxRsyncTrackerKey{}, nil)
+	if err != nil {
+		return err
+	}
+
+	tracker.mu.Lock()
+	failed := tracker.failed
+	tracker.mu.Unlock()
+	if failed {
+		return fmt.Errorf("some files were rejected, see `command doctor`")
+	}
+	h.rsyncDelete(s, tracker, projectName)
+	return nil
+}
+
+// fetchSources copies the files of projectName to dir, without our own
+// versions and compressed copies.
+func (h *UploadAssetHandler) fetchSources(s ssh.Session, bucket sst.Bucket, projectName, dir string) error {
+	entries, err := storage.WalkObjects(h.Storage, bucket, projectName)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if storage.IsVersion(entry.Path) {
+			continue
+		}
+		if _, ok := storage.SidecarBase(entry.Path); ok {
+			continue
+		}
+
+		rel := strings.TrimPrefix(entry.Path, projectName+"/")
+		dest := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+rel)))
+		err := os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err != nil {
+			return err
+		}
+		_, contents, err := h.Read(s, &utils.FileEntry{Filepath: "/" + entry.Path})
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(contents)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(dest, data, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployBuild replaces the files of the target project with what the
+// generator wrote to dir.
+func (h *UploadAssetHandler) deployBuild(s ssh.Session, target, dir string) (int, error) {
+	// the session's project is the one with the sources
+	s.Context().SetValue(ctxProjectKey{}, nil)
+
+	count := 0
+	err := h.mirror(s, target, func() error {
+		return filepath.WalkDir(dir, func(fpath string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, fpath)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(fpath)
+			if err != nil {
+				return err
+			}
+			_, err = h.Write(s, &utils.FileEntry{
+				Filepath: path.Join("/", target, filepath.ToSlash(rel)),
+				Mode:     0o644,
+				Size:     int64(len(data)),
+				Mtime:    time.Now().Unix(),
+				Reader:   bytes.NewReader(data),
+			})
+			if err != nil {
+				h.logger(s).Error("could not deploy built file", "filename", rel, "err", err.Error())
+			}
+			count += 1
+			return nil
+		})
+	})
+	return count, err
+}
+
+// runBuild builds the project when it has a `_build` file, the output of
+// the generator is shown to the user and kept for `command logs`.
+func (h *UploadAssetHandler) runBuild(s ssh.Session, projectName string) {
+	bucket, err := getBucket(s)
+	if err != nil {
+		return
+	}
+	_, specFile, err := h.Read(s, &utils.FileEntry{Filepath: "/" + projectName + "/" + build.SpecFile})
+	if err != nil {
+		return
+	}
+	text, err := io.ReadAll(specFile)
+	specFile.Close()
+	if err != nil {
+		return
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	logger := h.logger(s).With("project", projectName)
+	stderr := s.Stderr()
+
+	spec, err := build.ParseSpec(string(text), h.buildGenerators(), projectName)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "could not build (%s): %s\r\n", projectName, err)
+		return
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "building (%s) into (%s) with %s at %s\n", projectName, spec.Target, spec.Generator, time.Now().UTC().Format(time.RFC3339))
+	_, _ = stderr.Write(out.Bytes())
+	log := io.MultiWriter(out, stderr)
+
+	err = h.build(s, bucket, projectName, spec, log)
+	if err != nil {
+		logger.Error("build failed", "err", err.Error())
+		fmt.Fprintf(log, "build failed: %s\n", err)
+		_, _ = fmt.Fprintf(stderr, "see `command logs %s` for the output of this build\r\n", projectName)
+	} else {
+		fmt.Fprintf(log, "deployed to %s\n", h.Cfg.AssetURL(user.Name, spec.Target, ""))
+	}
+
+	_, err = h.Storage.PutObject(
+		bucket,
+		buildLogPath(projectName),
+		utils.NopReaderAtCloser(bytes.NewReader(out.Bytes())),
+		&utils.FileEntry{Filepath: buildLogPath(projectName), Size: int64(out.Len()), Mtime: time.Now().Unix()},
+	)
+	if err != nil {
+		logger.Error("could not save build log", "err", err.Error())
+	}
+}
+
+func (h *UploadAssetHandler) build(s ssh.Session, bucket sst.Bucket, projectName string, spec *build.Spec, log io.Writer) error {
+	tmp, err := os.MkdirTemp("", "pgs-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	out := filepath.Join(tmp, "out")
+
+	err = h.fetchSources(s, bucket, projectName, src)
+	if err != nil {
+		return fmt.Errorf("could not fetch sources: %w", err)
+	}
+	err = h.Builder.Run(s.Context(), spec, src, out, log)
+	if err != nil {
+		return err
+	}
+
+	count, err := h.deployBuild(s, spec.Target, out)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s did not write any files", spec.Generator)
+	}
+	return nil
+}
+
+// BuildMiddleware runs the builds of the projects an upload changed once
+// it is done, after an atomic deploy was promoted.
+func BuildMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if h.Builder == nil || h.isDryRun(s) || !isUploadCmd(s.Command()) {
+				next(s)
+				return
+			}
+
+			pending := &pendingProjects{projects: map[string]bool{}}
+			s.Context().SetValue(ctxBuildKey{}, pending)
+			next(s)
+			s.Context().SetValue(ctxBuildKey{}, nil)
+			if s.Context().Err() != nil {
+				return
+			}
+
+			for _, projectName := range pending.sorted() {
+				h.runBuild(s, projectName)
+			}
+		}
+	}
+}
+
+// logs prints the output of the last build of a project.
+func (h *UploadAssetHandler) logs(s ssh.Session, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: logs {project}")
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return "", err
+	}
+	contents, _, _, err := h.Storage.GetObject(bucket, buildLogPath(args[0]))
+	if err != nil {
+		return "", fmt.Errorf("project (%s) has not been built", args[0])
+	}
+	defer contents.Close()
+	text, err := io.ReadAll(contents)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(strings.TrimSpace(string(text)), "\n", "\r\n"), nil
+}
+
+// LogsMiddleware handles `command logs {project}`.
+func LogsMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "logs") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			out, err := h.logs(s, cmd[2:])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
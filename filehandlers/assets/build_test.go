@@ -0,0 +1,117 @@
+package uploadassets
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/build"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestRunBuild(t *testing.T) {
+	build.Generators["fake"] = build.Generator{
+		Name: "fake",
+		Args: func(src, out string) []string {
+			return []string{"sh", "-c", `echo converting; mkdir -p "$1" && cp index.md "$1/index.html"`, "sh", out}
+		},
+	}
+	defer delete(build.Generators, "fake")
+
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fpath, text := range map[string]string{
+		"/src/_build":     "generator = \"fake\"\ntarget = \"blog\"",
+		"/src/index.md":   "# hello",
+		"/blog/stale.css": "body {}",
+	} {
+		_, err = st.PutObject(bucket, fpath, utils.NopReaderAtCloser(strings.NewReader(text)), &utils.FileEntry{Filepath: fpath})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// `env` stands in for a real sandbox, it runs the command as is
+	cfg := &shared.ConfigSite{BuildGenerators: []string{"fake"}, BuildSandbox: []string{"env"}}
+	cfg.Domain = "pgs.sh"
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(&gitDB{fakeDB: fakeDB{projects: []string{"src", "blog"}}}, cfg, st)
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	handler.runBuild(s, "src")
+	if !strings.Contains(s.stderr.String(), "converting") {
+		t.Fatalf("expected the build output over ssh, got %q", s.stderr.String())
+	}
+
+	_, contents, err := handler.Read(s, &utils.FileEntry{Filepath: "/blog/index.html"})
+	if err != nil {
+		t.Fatalf("expected the output to be deployed to the target: %v", err)
+	}
+	built := &bytes.Buffer{}
+	_, _ = built.ReadFrom(contents)
+	if built.String() != "# hello" {
+		t.Fatalf("expected the built file, got %q", built.String())
+	}
+	if _, err := st.GetObjectSize(bucket, "/blog/stale.css"); err == nil {
+		t.Fatal("expected files the build did not write to be removed")
+	}
+
+	logs, err := handler.logs(s, []string{"src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs, "converting") || !strings.Contains(logs, "deployed to") {
+		t.Fatalf("expected the build log, got %q", logs)
+	}
+	_, err = handler.logs(s, []string{"blog"})
+	if err == nil {
+		t.Fatal("expected no logs for a project that was never built")
+	}
+
+	ok, err := handler.validateAsset(&FileData{
+		FileEntry:   &utils.FileEntry{Filepath: "/src/_build", Size: 10},
+		Text:        []byte("generator = \"hugo\"\ntarget = \"blog\""),
+		User:        &db.User{ID: "1", Name: "test"},
+		ProjectName: "src",
+		FeatureFlag: db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)),
+	})
+	if ok || err == nil || !strings.Contains(err.Error(), "invalid _build file") {
+		t.Fatalf("expected a generator that is not enabled to be refused, got %v", err)
+	}
+}
+
+func TestBuildNeedsSandbox(t *testing.T) {
+	cfg := &shared.ConfigSite{BuildGenerators: []string{"hugo"}}
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(&fakeDB{}, cfg, nil)
+	if handler.Builder != nil {
+		t.Fatal("expected builds to stay disabled without a sandbox")
+	}
+
+	_, err := handler.validateAsset(&FileData{
+		FileEntry:   &utils.FileEntry{Filepath: "/src/_build", Size: 10},
+		Text:        []byte("generator = \"hugo\"\ntarget = \"blog\""),
+		User:        &db.User{ID: "1", Name: "test"},
+		ProjectName: "src",
+		FeatureFlag: db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)),
+	})
+	if err == nil || !strings.Contains(err.Error(), "builds are not enabled") {
+		t.Fatalf("expected _build files to be refused without a sandbox, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package uploadassets
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+)
+
+type ctxCaseFoldKey struct{}
+
+// caseFolds are the files of each project keyed by shared.FoldPath.
+func caseFolds(s ssh.Session) map[string]map[string]string {
+	folds, ok := s.Context().Value(ctxCaseFoldKey{}).(map[string]map[string]string)
+	if !ok {
+		folds = map[string]map[string]string{}
+		s.Context().SetValue(ctxCaseFoldKey{}, folds)
+	}
+	return folds
+}
+
+// caseCollision returns the file in the project that fpath only differs
+// from in case, empty when there is none and fpath is recorded as taken.
+// The project is walked once per connection.
+func (h *UploadAssetHandler) caseCollision(s ssh.Session, bucket sst.Bucket, projectName, fpath string) (string, error) {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	files, ok := caseFolds(s)[projectName]
+	ops.accounting.Unlock()
+
+	if !ok {
+		entries, err := storage.WalkObjects(h.Storage, bucket, projectName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		walked := map[string]string{}
+		for _, entry := range h.userFiles(entries) {
+			stored := "/" + entry.Path
+			walked[shared.FoldPath(stored)] = stored
+		}
+
+		ops.accounting.Lock()
+		folds := caseFolds(s)
+		if files, ok = folds[projectName]; !ok {
+			files = walked
+			folds[projectName] = files
+		}
+		ops.accounting.Unlock()
+	}
+
+	key := shared.FoldPath(fpath)
+	ops.accounting.Lock()
+	defer ops.accounting.Unlock()
+	if other, ok := files[key]; ok && other != fpath {
+		return other, nil
+	}
+	files[key] = fpath
+	return "", nil
+}
+
+// forgetCase frees the name of a deleted file, renaming `README.md` to
+// `readme.md` is a delete and a write.
+func (h *UploadAssetHandler) forgetCase(s ssh.Session, projectName, fpath string) {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	defer ops.accounting.Unlock()
+	files, ok := caseFolds(s)[projectName]
+	if !ok {
+		return
+	}
+	key := shared.FoldPath(fpath)
+	if files[key] == fpath {
+		delete(files, key)
+	}
+}
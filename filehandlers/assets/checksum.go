@@ -0,0 +1,54 @@
+package uploadassets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	sst "github.com/picosh/pobj/storage"
+)
+
+type ctxClientChecksumKey struct{}
+
+var checksumRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// parseChecksum accepts a hex encoded sha256, as printed by `sha256sum`.
+func parseChecksum(text string) (string, error) {
+	checksum := strings.ToLower(strings.TrimSpace(text))
+	if !checksumRe.MatchString(checksum) {
+		return "", fmt.Errorf("checksum (%s) must be a hex encoded sha256", text)
+	}
+	return checksum, nil
+}
+
+// getClientChecksum is the sha256 the client says it sent, if any.
+func getClientChecksum(s ssh.Session) string {
+	checksum, _ := s.Context().Value(ctxClientChecksumKey{}).(string)
+	return checksum
+}
+
+// checkClientChecksum makes sure we received the file the client hashed.
+func checkClientChecksum(s ssh.Session, fpath, checksum string) error {
+	expected := getClientChecksum(s)
+	if expected == "" || expected == checksum {
+		return nil
+	}
+	return fmt.Errorf(
+		"ERROR: (%s) checksum mismatch, client sent (%s) but we received (%s)",
+		fpath,
+		expected,
+		checksum,
+	)
+}
+
+// unchanged reports whether fpath is already stored with checksum, there
+// is no point in writing it again. A symlink with the same text is not the
+// same file.
+func (h *UploadAssetHandler) unchanged(bucket sst.Bucket, fpath, checksum string) bool {
+	if checksum == "" {
+		return false
+	}
+	meta, err := h.Storage.GetObjectMeta(bucket, fpath)
+	return err == nil && meta.Checksum == checksum && meta.Symlink == ""
+}
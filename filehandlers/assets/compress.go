@@ -0,0 +1,115 @@
+package uploadassets
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// compressAsset returns the bytes we should store for data, gzipping text
+// assets above `CompressThreshold` and flagging them in meta so reads can
+// inflate them again. Quotas are charged for what is actually stored.
+func (h *UploadAssetHandler) compressAsset(data *FileData, assetFilename string, meta *storage.ObjectMeta) []byte {
+	if !storage.ShouldCompress(assetFilename, data.ContentType, int64(len(data.Text)), h.Cfg.CompressThreshold, h.Cfg.CompressTypes) {
+		return data.Text
+	}
+
+	compressed, err := storage.Compress(data.Text)
+	if err != nil {
+		h.dataLogger(data).Error("could not compress asset", "filename", assetFilename, "err", err.Error())
+		return data.Text
+	}
+	if len(compressed) >= len(data.Text) {
+		return data.Text
+	}
+
+	meta.ContentEncoding = "gzip"
+	data.DeltaFileSize -= int64(len(data.Text) - len(compressed))
+	return compressed
+}
+
+// writeSidecars stores brotli and gzip copies of text assets above
+// `PrecompressThreshold` next to them. Sidecars record the checksum they
+// were made from so the web server never serves a stale one, an asset that
+// no longer qualifies has its sidecars removed.
+func (h *UploadAssetHandler) writeSidecars(ctx context.Context, data *FileData, assetFilename, storePath string, meta *storage.ObjectMeta) error {
+	if h.Cfg.PrecompressThreshold <= 0 {
+		return nil
+	}
+
+	size := int64(len(data.Text))
+	eligible := data.Size > 0 && data.Text != nil && meta.ContentEncoding == "" &&
+		storage.ShouldCompress(assetFilename, data.ContentType, size, h.Cfg.PrecompressThreshold, h.Cfg.CompressTypes)
+
+	for _, sc := range storage.Sidecars {
+		var compressed []byte
+		if eligible {
+			var err error
+			compressed, err = sc.Compress(data.Text)
+			if err != nil {
+				h.dataLogger(data).Error("could not precompress asset", "filename", assetFilename, "encoding", sc.Encoding, "err", err.Error())
+			}
+		}
+
+		prevSize, _ := h.Storage.GetObjectSize(data.Bucket, assetFilename+sc.Ext)
+		if compressed == nil || int64(len(compressed)) >= size {
+			// a staged deploy can still roll back, leave them be
+			if prevSize > 0 && data.StagingPath == "" {
+				data.DeltaFileSize -= h.removeSidecar(data.Bucket, assetFilename, sc)
+			}
+			continue
+		}
+
+		fpath := storePath + sc.Ext
+		_, err := h.Storage.PutObjectCtx(
+			ctx,
+			data.Bucket,
+			fpath,
+			utils.NopReaderAtCloser(bytes.NewReader(compressed)),
+			&utils.FileEntry{Filepath: fpath, Size: int64(len(compressed)), Mtime: data.Mtime},
+			&storage.ObjectMeta{
+				ContentType:     data.ContentType,
+				Checksum:        shared.Shasum(compressed),
+				Mtime:           data.Mtime,
+				ContentEncoding: sc.Encoding,
+				Source:          data.Checksum,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		data.DeltaFileSize += int64(len(compressed)) - prevSize
+	}
+
+	return nil
+}
+
+// removeSidecar deletes a sidecar of fpath, it returns the bytes freed.
+func (h *UploadAssetHandler) removeSidecar(bucket sst.Bucket, fpath string, sc storage.Sidecar) int64 {
+	size, err := h.Storage.GetObjectSize(bucket, fpath+sc.Ext)
+	if err != nil {
+		return 0
+	}
+	err = h.Storage.DeleteObject(bucket, fpath+sc.Ext)
+	if err != nil {
+		h.Cfg.Logger.Error("could not remove sidecar", "filename", fpath+sc.Ext, "err", err.Error())
+		return 0
+	}
+	return size
+}
+
+// removeSidecars deletes every sidecar of fpath, it returns the bytes freed.
+func (h *UploadAssetHandler) removeSidecars(bucket sst.Bucket, fpath string) int64 {
+	if h.Cfg.PrecompressThreshold <= 0 {
+		return 0
+	}
+	freed := int64(0)
+	for _, sc := range storage.Sidecars {
+		freed += h.removeSidecar(bucket, fpath, sc)
+	}
+	return freed
+}
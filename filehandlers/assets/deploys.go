@@ -0,0 +1,297 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxDetachedKey struct{}
+
+// deployProjects returns the projects a list of promoted files belong to.
+func deployProjects(files []string) []string {
+	seen := map[string]bool{}
+	projects := []string{}
+	for _, fpath := range files {
+		projectName := strings.Split(strings.TrimPrefix(fpath, "/"), "/")[0]
+		if projectName == "" || seen[projectName] {
+			continue
+		}
+		seen[projectName] = true
+		projects = append(projects, projectName)
+	}
+	return projects
+}
+
+// recordDeploys snapshots every project a promoted deploy touched into a
+// new revision and makes it the one being served.
+func (h *UploadAssetHandler) recordDeploys(s ssh.Session, bucket sst.Bucket, files []string) {
+	if h.Cfg.KeepDeploys <= 0 {
+		return
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		h.logger(s).Error(err.Error())
+		return
+	}
+
+	for _, projectName := range deployProjects(files) {
+		rev, err := h.recordDeploy(s, bucket, user, projectName)
+		if err != nil {
+			h.logger(s).Error("could not record deploy", "project", projectName, "err", err.Error())
+			msg := fmt.Sprintf("could not record revision for (%s), rollback will not include this deploy\r\n", projectName)
+			_, _ = s.Stderr().Write([]byte(msg))
+			continue
+		}
+		_, _ = s.Stderr().Write([]byte(fmt.Sprintf("deployed (%s) revision (%d)\r\n", projectName, rev)))
+	}
+}
+
+func (h *UploadAssetHandler) recordDeploy(s ssh.Session, bucket sst.Bucket, user *db.User, projectName string) (int, error) {
+	unlock := h.projects.lock(user.ID, projectName)
+	defer unlock()
+
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return 0, err
+	}
+	deploys, err := h.DBPool.FindProjectDeploys(project.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	rev := 1
+	if len(deploys) > 0 {
+		rev = deploys[0].Revision + 1
+	}
+
+	count, size, err := storage.SnapshotDeploy(h.Storage, bucket, projectName, rev)
+	if err != nil {
+		return 0, err
+	}
+	err = h.DBPool.InsertProjectDeploy(project.ID, rev, count, size)
+	if err != nil {
+		_, _, _ = storage.DeleteObjects(h.Storage, bucket, storage.DeployName(projectName, rev))
+		return 0, err
+	}
+	h.adjustStorage(s, size)
+
+	h.logger(s).Info(
+		"recorded deploy",
+		"project", projectName,
+		"revision", rev,
+		"count", count,
+		"size", size,
+	)
+
+	deploys = append([]*db.ProjectDeploy{{Revision: rev, Current: true}}, deploys...)
+	h.pruneDeploys(s, bucket, projectName, deploys, rev)
+	return rev, nil
+}
+
+// pruneDeploys removes revisions beyond `KeepDeploys`, both their assets
+// and their rows.
+func (h *UploadAssetHandler) pruneDeploys(s ssh.Session, bucket sst.Bucket, projectName string, deploys []*db.ProjectDeploy, current int) {
+	revisions := []int{}
+	for _, deploy := range deploys {
+		revisions = append(revisions, deploy.Revision)
+	}
+
+	removed, size, err := storage.PruneDeploys(h.Storage, bucket, projectName, revisions, current, h.Cfg.KeepDeploys)
+	h.adjustStorage(s, -size)
+	if err != nil {
+		h.logger(s).Error("could not prune revisions", "project", projectName, "err", err.Error())
+	}
+
+	for _, rev := range removed {
+		for _, deploy := range deploys {
+			if deploy.Revision != rev {
+				continue
+			}
+			err := h.DBPool.RemoveProjectDeploy(deploy.ID)
+			if err != nil {
+				h.logger(s).Error("could not remove revision", "project", projectName, "revision", rev, "err", err.Error())
+			}
+		}
+	}
+}
+
+// detachDeploy stops serving a revision once a project is written to
+// outside of a deploy, otherwise the change would only show up after the
+// next one. It runs once per project and session.
+func (h *UploadAssetHandler) detachDeploy(s ssh.Session, user *db.User, projectName string) {
+	if h.Cfg.KeepDeploys <= 0 || getStaging(s) != nil || h.isDryRun(s) {
+		return
+	}
+
+	detached, ok := s.Context().Value(ctxDetachedKey{}).(map[string]bool)
+	if !ok {
+		detached = map[string]bool{}
+		s.Context().SetValue(ctxDetachedKey{}, detached)
+	}
+	if detached[projectName] {
+		return
+	}
+	detached[projectName] = true
+
+	err := h.DBPool.ClearCurrentDeploy(user.ID, projectName)
+	if err != nil {
+		h.logger(s).Error("could not detach project from its revision", "project", projectName, "err", err.Error())
+	}
+}
+
+func formatDeploy(deploy *db.ProjectDeploy) string {
+	created := ""
+	if deploy.CreatedAt != nil {
+		created = deploy.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	line := fmt.Sprintf(
+		"%d\t%s\t%d files\t%s",
+		deploy.Revision,
+		created,
+		deploy.FileCount,
+		shared.HumanSize(deploy.Size),
+	)
+	if deploy.Current {
+		line += "\t(current)"
+	}
+	return line
+}
+
+func (h *UploadAssetHandler) revisions(s ssh.Session, projectName string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return "", fmt.Errorf("project (%s) not found", projectName)
+	}
+
+	deploys, err := h.DBPool.FindProjectDeploys(project.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(deploys) == 0 {
+		return fmt.Sprintf("no revisions for (%s)", projectName), nil
+	}
+
+	lines := []string{}
+	for _, deploy := range deploys {
+		lines = append(lines, formatDeploy(deploy))
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+// rollbackDeploy serves an earlier revision of a project, by default the
+// one before the current revision. Nothing is copied, only which revision
+// is current changes.
+func (h *UploadAssetHandler) rollbackDeploy(s ssh.Session, projectName string, rev int) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return "", fmt.Errorf("project (%s) not found", projectName)
+	}
+
+	deploys, err := h.DBPool.FindProjectDeploys(project.ID)
+	if err != nil {
+		return "", err
+	}
+
+	current := 0
+	for _, deploy := range deploys {
+		if deploy.Current {
+			current = deploy.Revision
+		}
+	}
+	if rev == 0 {
+		for _, deploy := range deploys {
+			// there is no current revision after writes outside of a
+			// deploy, the newest one is the previous state then
+			if current == 0 || deploy.Revision < current {
+				rev = deploy.Revision
+				break
+			}
+		}
+		if rev == 0 {
+			return "", fmt.Errorf("no earlier revision of (%s) to roll back to", projectName)
+		}
+	}
+	if rev == current {
+		return fmt.Sprintf("(%s) is already serving revision (%d)", projectName, rev), nil
+	}
+
+	err = h.DBPool.SetCurrentDeploy(project.ID, rev)
+	if err != nil {
+		return "", err
+	}
+
+	h.logger(s).Info(
+		"rolled back project",
+		"project", projectName,
+		"from", current,
+		"to", rev,
+	)
+	return fmt.Sprintf("(%s) now serving revision (%d)", projectName, rev), nil
+}
+
+// DeployMiddleware handles `command revisions {project}` and
+// `command rollback {project} [rev]`.
+func DeployMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && (cmd[1] == "revisions" || cmd[1] == "rollback")) {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			if h.Cfg.KeepDeploys <= 0 {
+				utils.ErrorHandler(s, fmt.Errorf("revisions are not enabled"))
+				return
+			}
+
+			var out string
+			var err error
+			args := cmd[2:]
+			switch {
+			case cmd[1] == "revisions" && len(args) == 1:
+				out, err = h.revisions(s, args[0])
+			case cmd[1] == "rollback" && (len(args) == 1 || len(args) == 2):
+				rev := 0
+				if len(args) == 2 {
+					rev, err = strconv.Atoi(args[1])
+					if err != nil || rev <= 0 {
+						utils.ErrorHandler(s, fmt.Errorf("(%s) is not a valid revision", args[1]))
+						return
+					}
+				}
+				out, err = h.rollbackDeploy(s, args[0], rev)
+			default:
+				err = fmt.Errorf("usage: revisions {project} | rollback {project} [rev]")
+			}
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package uploadassets
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type deployDB struct {
+	fakeDB
+	deploys []*db.ProjectDeploy
+}
+
+func (f *deployDB) InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error {
+	for _, deploy := range f.deploys {
+		deploy.Current = false
+	}
+	deploy := &db.ProjectDeploy{
+		ID:        fmt.Sprintf("%d", revision),
+		ProjectID: projectID,
+		Revision:  revision,
+		Current:   true,
+		FileCount: fileCount,
+		Size:      size,
+	}
+	f.deploys = append([]*db.ProjectDeploy{deploy}, f.deploys...)
+	return nil
+}
+
+func (f *deployDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	return f.deploys, nil
+}
+
+func (f *deployDB) SetCurrentDeploy(projectID string, revision int) error {
+	for _, deploy := range f.deploys {
+		deploy.Current = deploy.Revision == revision
+	}
+	return nil
+}
+
+func (f *deployDB) RemoveProjectDeploy(deployID string) error {
+	deploys := []*db.ProjectDeploy{}
+	for _, deploy := range f.deploys {
+		if deploy.ID != deployID {
+			deploys = append(deploys, deploy)
+		}
+	}
+	f.deploys = deploys
+	return nil
+}
+
+func TestDeployRevisions(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbpool := &deployDB{fakeDB: fakeDB{projects: []string{"test"}}}
+	handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{KeepDeploys: 2}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	for _, text := range []string{"one", "two", "three"} {
+		_, err = st.PutObject(bucket, "test/index.html", utils.NopReaderAtCloser(strings.NewReader(text)), &utils.FileEntry{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.recordDeploys(s, bucket, []string{"/test/index.html"})
+	}
+
+	if _, err := st.GetObjectSize(bucket, storage.DeployName("test", 1)+"/index.html"); err == nil {
+		t.Fatal("expected revision (1) to be pruned")
+	}
+	if len(dbpool.deploys) != 2 || dbpool.deploys[0].Revision != 3 || !dbpool.deploys[0].Current {
+		t.Fatalf("expected revisions (3, 2) with (3) current, got %+v", dbpool.deploys)
+	}
+	if getStorageSize(s) != uint64(len("two")+len("three")) {
+		t.Fatalf("expected kept revisions to count against storage, found (%d)", getStorageSize(s))
+	}
+
+	out, err := handler.rollbackDeploy(s, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "(test) now serving revision (2)" || !dbpool.deploys[1].Current {
+		t.Fatalf("expected rollback to revision (2), got %q", out)
+	}
+	contents, _, _, err := st.GetObject(bucket, storage.DeployName("test", 2)+"/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = contents.Close()
+
+	// the next deploy is current again and prunes the rolled back revision
+	_, err = st.PutObject(bucket, "test/index.html", utils.NopReaderAtCloser(strings.NewReader("four")), &utils.FileEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.Cfg.KeepDeploys = 1
+	handler.recordDeploys(s, bucket, []string{"/test/index.html"})
+	revisions := []int{}
+	for _, deploy := range dbpool.deploys {
+		revisions = append(revisions, deploy.Revision)
+	}
+	if fmt.Sprint(revisions) != "[4]" {
+		t.Fatalf("expected only revision (4) to be kept, got %v", revisions)
+	}
+
+	_, err = handler.rollbackDeploy(s, "test", 0)
+	if err == nil {
+		t.Fatal("expected rollback without an earlier revision to fail")
+	}
+}
@@ -0,0 +1,302 @@
+package uploadassets
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/domains"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// how many failed uploads `command doctor` remembers per user.
+var maxRecentErrors = 5
+
+var (
+	lookupCNAME  = net.LookupCNAME
+	verifyDomain = domains.IsVerified
+)
+
+type uploadError struct {
+	At   time.Time
+	Path string
+	Err  string
+}
+
+// recentErrors keeps the last failed uploads of every user in memory so
+// `command doctor` can show them, they do not survive a restart.
+type recentErrors struct {
+	mu     sync.Mutex
+	byUser map[string][]uploadError
+}
+
+func (r *recentErrors) add(userID, fpath string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byUser == nil {
+		r.byUser = map[string][]uploadError{}
+	}
+	found := append(r.byUser[userID], uploadError{At: time.Now(), Path: fpath, Err: err.Error()})
+	if len(found) > maxRecentErrors {
+		found = found[len(found)-maxRecentErrors:]
+	}
+	r.byUser[userID] = found
+}
+
+func (r *recentErrors) find(userID string) []uploadError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]uploadError{}, r.byUser[userID]...)
+}
+
+func (h *UploadAssetHandler) recordError(s ssh.Session, fpath string, err error) {
+	user, uerr := futil.GetUser(s)
+	if uerr != nil {
+		return
+	}
+	h.failures.add(user.ID, fpath, err)
+}
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type doctorCheck struct {
+	status string
+	name   string
+	msg    string
+	// fix tells the user what to do about a warning or a failure
+	fix string
+}
+
+func (c doctorCheck) String() string {
+	line := fmt.Sprintf("[%s] %s: %s", c.status, c.name, c.msg)
+	if c.fix != "" {
+		line += "\r\n       " + c.fix
+	}
+	return line
+}
+
+// doctor runs the checks an upload depends on and explains the ones that
+// fail, it never changes anything.
+func (h *UploadAssetHandler) doctor(s ssh.Session) string {
+	checks := []doctorCheck{}
+	appDomain := strings.Split(h.Cfg.Domain, ":")[0]
+
+	key, err := shared.KeyText(s)
+	if err != nil {
+		checks = append(checks, doctorCheck{
+			status: checkFail, name: "key", msg: "no public key was offered",
+			fix: "connect with the ssh key you registered, e.g. `ssh -i ~/.ssh/id_ed25519`",
+		})
+		return doctorReport(checks)
+	}
+	user, err := h.findUser(s, key)
+	if err != nil || user == nil || user.ID == "" {
+		checks = append(checks, doctorCheck{
+			status: checkFail, name: "key", msg: "this key is not registered",
+			fix: fmt.Sprintf("create an account with `ssh new@%s` or add the key from a registered one with `command keys add`", appDomain),
+		})
+		return doctorReport(checks)
+	}
+	checks = append(checks, doctorCheck{status: checkOK, name: "key", msg: fmt.Sprintf("registered to (%s)", user.Name)})
+
+	org, member, err := OrgUser(s, h.DBPool, user)
+	if err != nil {
+		checks = append(checks, doctorCheck{
+			status: checkFail, name: "org", msg: err.Error(),
+			fix: "ask an owner of the organization to add you",
+		})
+		return doctorReport(checks)
+	}
+	if member != nil {
+		check := doctorCheck{status: checkOK, name: "org", msg: fmt.Sprintf("acting for (%s) as (%s)", org.Name, member.Role)}
+		if !member.CanDeploy() {
+			check.status = checkWarn
+			check.fix = "your role can only look at the projects, ask an owner for the deployer role"
+		}
+		checks = append(checks, check)
+	}
+	user = org
+
+	if user.IsSuspended() {
+		checks = append(checks, doctorCheck{
+			status: checkFail, name: "account", msg: "suspended",
+			fix: "contact the operators of this site",
+		})
+	} else if user.IsReadOnly() {
+		checks = append(checks, doctorCheck{
+			status: checkFail, name: "account", msg: "read-only, uploads and changes are disabled",
+			fix: "contact the operators of this site",
+		})
+	} else {
+		checks = append(checks, doctorCheck{status: checkOK, name: "account", msg: "active"})
+	}
+
+	if len(h.Cfg.RequiredFeatures) > 0 {
+		features := strings.Join(h.Cfg.RequiredFeatures, ", ")
+		ok, err := h.DBPool.HasAnyFeatureForUser(user.ID, h.Cfg.RequiredFeatures...)
+		switch {
+		case err != nil:
+			checks = append(checks, doctorCheck{status: checkFail, name: "features", msg: err.Error()})
+		case ok:
+			checks = append(checks, doctorCheck{status: checkOK, name: "features", msg: fmt.Sprintf("one of (%s)", features)})
+		default:
+			checks = append(checks, doctorCheck{
+				status: checkFail, name: "features", msg: fmt.Sprintf("missing, one of (%s) is required to upload", features),
+				fix: "uploads are refused until the account has one of these features",
+			})
+		}
+	}
+
+	ff := h.featureFlag(user)
+	if ff.ExpiresAt != nil && !ff.IsValid() {
+		checks = append(checks, doctorCheck{
+			status: checkWarn, name: "plan", msg: fmt.Sprintf("expired at %s", ff.ExpiresAt.Format(time.DateOnly)),
+			fix: "the free tier limits apply until the plan is renewed",
+		})
+	}
+
+	bucket, err := h.Storage.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err != nil {
+		checks = append(checks, doctorCheck{status: checkOK, name: "bucket", msg: "not created yet, it will be on your first upload"})
+	} else {
+		checks = append(checks, doctorCheck{status: checkOK, name: "bucket", msg: "exists"})
+		checks = append(checks, h.quotaCheck(bucket, ff.Data.StorageMax))
+	}
+
+	checks = append(checks, h.domainChecks(user.ID, appDomain)...)
+
+	failures := h.failures.find(user.ID)
+	if len(failures) == 0 {
+		checks = append(checks, doctorCheck{status: checkOK, name: "errors", msg: "no failed uploads since the last restart"})
+	}
+	for i := len(failures) - 1; i >= 0; i-- {
+		failure := failures[i]
+		checks = append(checks, doctorCheck{
+			status: checkWarn,
+			name:   "errors",
+			msg:    fmt.Sprintf("%s %s: %s", failure.At.Format(time.DateTime), failure.Path, failure.Err),
+		})
+	}
+
+	return doctorReport(checks)
+}
+
+func (h *UploadAssetHandler) quotaCheck(bucket sst.Bucket, storageMax uint64) doctorCheck {
+	stats, err := h.Storage.GetBucketStats(bucket)
+	if err != nil {
+		return doctorCheck{status: checkFail, name: "quota", msg: err.Error()}
+	}
+	used := fmt.Sprintf(
+		"used %s of %s across (%d) files",
+		shared.HumanSize(int64(stats.TotalSize)),
+		shared.HumanSize(int64(storageMax)),
+		stats.FileCount,
+	)
+
+	switch {
+	case storageMax > 0 && stats.TotalSize >= storageMax:
+		return doctorCheck{
+			status: checkFail, name: "quota", msg: used,
+			fix: "uploads are refused until you remove files or projects, see `df --projects`",
+		}
+	case storageMax > 0 && stats.TotalSize >= storageMax/10*9:
+		return doctorCheck{
+			status: checkWarn, name: "quota", msg: used,
+			fix: "large uploads might be refused, see `df --projects` for what takes up space",
+		}
+	}
+	return doctorCheck{status: checkOK, name: "quota", msg: used}
+}
+
+// domainChecks looks up the dns records of the user's custom domains,
+// pending domains need their TXT record and verified ones their CNAME.
+func (h *UploadAssetHandler) domainChecks(userID, appDomain string) []doctorCheck {
+	if !h.Cfg.ProjectDomains {
+		return nil
+	}
+	found, err := h.DBPool.FindProjectDomains(userID)
+	if err != nil {
+		return []doctorCheck{{status: checkFail, name: "domains", msg: err.Error()}}
+	}
+
+	checks := []doctorCheck{}
+	for _, domain := range found {
+		name := fmt.Sprintf("domain %s", domain.Domain)
+		record := domains.VerifyRecord(h.Cfg.Space, domain.Domain)
+		if !domain.IsVerified() {
+			if verifyDomain(h.Cfg.Space, domain) {
+				checks = append(checks, doctorCheck{
+					status: checkOK, name: name, msg: "TXT record found, it is served once the next check verifies it",
+				})
+				continue
+			}
+			checks = append(checks, doctorCheck{
+				status: checkWarn, name: name, msg: "pending, the TXT record was not found",
+				fix: fmt.Sprintf("add `%s TXT %s` to your dns", record, domain.Token),
+			})
+			continue
+		}
+
+		cname, err := lookupCNAME(domain.Domain)
+		if err != nil || strings.TrimSuffix(cname, ".") != appDomain {
+			checks = append(checks, doctorCheck{
+				status: checkWarn, name: name, msg: fmt.Sprintf("verified but does not point at (%s)", appDomain),
+				fix: fmt.Sprintf("add `%s CNAME %s` to your dns", domain.Domain, appDomain),
+			})
+			continue
+		}
+		checks = append(checks, doctorCheck{
+			status: checkOK, name: name, msg: fmt.Sprintf("serves (%s)", domain.ProjectName),
+		})
+	}
+	return checks
+}
+
+func doctorReport(checks []doctorCheck) string {
+	lines := []string{}
+	problems := 0
+	for _, check := range checks {
+		if check.status != checkOK {
+			problems += 1
+		}
+		lines = append(lines, check.String())
+	}
+	if problems == 0 {
+		lines = append(lines, "", "everything looks good")
+	} else {
+		lines = append(lines, "", fmt.Sprintf("found (%d) problems", problems))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// DoctorMiddleware handles `command doctor` so users can find out why
+// their uploads fail without asking.
+func DoctorMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "doctor") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			_, _ = s.Write([]byte(h.doctor(s) + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestDoctor(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"test/index.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("0123456789"))),
+		&utils.FileEntry{Filepath: "test/index.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	dbpool := &domainDB{domains: []*db.ProjectDomain{
+		{Domain: "pending.com", ProjectName: "test", Token: "token"},
+		{Domain: "moved.com", ProjectName: "test", VerifiedAt: &now},
+		{Domain: "example.com", ProjectName: "test", VerifiedAt: &now},
+	}}
+	cfg := &shared.ConfigSite{ProjectDomains: true}
+	cfg.MaxSize = 10
+	cfg.Domain = "pgs.sh"
+	cfg.Space = "pgs"
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(dbpool, cfg, st)
+	handler.failures.add("1", "/test/big.bin", fmt.Errorf("file too large"))
+
+	origVerify, origCNAME := verifyDomain, lookupCNAME
+	verifyDomain = func(space string, domain *db.ProjectDomain) bool { return false }
+	lookupCNAME = func(host string) (string, error) {
+		if host == "example.com" {
+			return "pgs.sh.", nil
+		}
+		return host + ".", nil
+	}
+	defer func() {
+		verifyDomain = origVerify
+		lookupCNAME = origCNAME
+	}()
+
+	s := newFakeSession()
+	s.key = newTestKey(t)
+	out := handler.doctor(s)
+
+	for _, expected := range []string{
+		"[ok] key: registered to (test)",
+		"[ok] bucket: exists",
+		"[fail] quota: used 10 of 10 across (1) files",
+		"[warn] domain pending.com: pending",
+		"add `_pgs-verify.pending.com TXT token` to your dns",
+		"[warn] domain moved.com: verified but does not point at (pgs.sh)",
+		"[ok] domain example.com: serves (test)",
+		"/test/big.bin: file too large",
+		"found (4) problems",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+
+	out = handler.doctor(newFakeSession())
+	if !strings.Contains(out, "[fail] key: no public key was offered") {
+		t.Fatalf("expected a missing key to fail, got:\n%s", out)
+	}
+}
@@ -0,0 +1,126 @@
+package uploadassets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/domains"
+	"github.com/picosh/send/send/utils"
+)
+
+var domainLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+func validateDomain(domain, appDomain string) error {
+	labels := strings.Split(domain, ".")
+	if len(domain) > 253 || len(labels) < 2 {
+		return fmt.Errorf("(%s) is not a valid domain", domain)
+	}
+	for _, label := range labels {
+		if !domainLabel.MatchString(label) {
+			return fmt.Errorf("(%s) is not a valid domain", domain)
+		}
+	}
+	if domain == appDomain || strings.HasSuffix(domain, "."+appDomain) {
+		return fmt.Errorf("(%s) is already served as a subdomain", domain)
+	}
+	return nil
+}
+
+// domain handles `add <domain> <project>`, `rm <domain>` and `ls`. Added
+// domains are only served while `domains.Sweep` keeps finding their TXT
+// record.
+func (h *UploadAssetHandler) domain(s ssh.Session, args []string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	appDomain := strings.Split(h.Cfg.Domain, ":")[0]
+
+	switch {
+	case len(args) == 3 && args[0] == "add":
+		domain := strings.ToLower(strings.TrimSuffix(args[1], "."))
+		err := validateDomain(domain, appDomain)
+		if err != nil {
+			return "", err
+		}
+
+		project, err := h.DBPool.FindProjectByName(user.ID, args[2])
+		if err != nil {
+			return "", fmt.Errorf("project (%s) not found", args[2])
+		}
+
+		token, err := h.DBPool.InsertProjectDomain(project.ID, domain)
+		if err != nil {
+			h.logger(s).Error("could not add domain", "domain", domain, "err", err.Error())
+			return "", fmt.Errorf("domain (%s) is already in use", domain)
+		}
+
+		return strings.Join([]string{
+			fmt.Sprintf("added domain (%s) to project (%s), it is served once verified", domain, project.Name),
+			"add these records to your dns, keep the TXT record as it is checked again periodically:",
+			fmt.Sprintf("  %s TXT %s", domains.VerifyRecord(h.Cfg.Space, domain), token),
+			fmt.Sprintf("  %s CNAME %s", domain, appDomain),
+		}, "\r\n"), nil
+	case len(args) == 2 && args[0] == "rm":
+		domain := strings.ToLower(strings.TrimSuffix(args[1], "."))
+		err := h.DBPool.RemoveProjectDomain(user.ID, domain)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("removed domain (%s)", domain), nil
+	case len(args) == 1 && args[0] == "ls":
+		found, err := h.DBPool.FindProjectDomains(user.ID)
+		if err != nil {
+			return "", err
+		}
+		if len(found) == 0 {
+			return "no domains", nil
+		}
+
+		lines := []string{}
+		for _, domain := range found {
+			status := "verified"
+			if !domain.IsVerified() {
+				status = fmt.Sprintf(
+					"pending, %s TXT %s",
+					domains.VerifyRecord(h.Cfg.Space, domain.Domain),
+					domain.Token,
+				)
+			}
+			lines = append(lines, fmt.Sprintf("%s -> %s (%s)", domain.Domain, domain.ProjectName, status))
+		}
+		return strings.Join(lines, "\r\n"), nil
+	}
+
+	return "", fmt.Errorf("usage: domain add {domain} {project} | domain rm {domain} | domain ls")
+}
+
+// DomainMiddleware handles `command domain` so users can serve a project
+// from their own domain.
+func DomainMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "domain") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			out, err := h.domain(s, cmd[2:])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
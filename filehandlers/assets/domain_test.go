@@ -0,0 +1,76 @@
+package uploadassets
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+)
+
+type domainDB struct {
+	fakeDB
+	domains []*db.ProjectDomain
+}
+
+func (f *domainDB) InsertProjectDomain(projectID, domain string) (string, error) {
+	for _, d := range f.domains {
+		if d.Domain == domain {
+			return "", fmt.Errorf("duplicate domain")
+		}
+	}
+	f.domains = append(f.domains, &db.ProjectDomain{ProjectName: projectID, Domain: domain, Token: "token"})
+	return "token", nil
+}
+
+func (f *domainDB) FindProjectDomains(userID string) ([]*db.ProjectDomain, error) {
+	return f.domains, nil
+}
+
+func TestDomain(t *testing.T) {
+	dbpool := &domainDB{fakeDB: fakeDB{projects: []string{"test"}}}
+	cfg := &shared.ConfigSite{}
+	cfg.Domain = "pgs.sh"
+	cfg.Space = "pgs"
+	handler := NewUploadAssetHandler(dbpool, cfg, nil)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	fixtures := []struct {
+		name   string
+		args   []string
+		output string
+		err    string
+	}{
+		{name: "invalid", args: []string{"add", "example", "test"}, err: "not a valid domain"},
+		{name: "subdomain", args: []string{"add", "test.pgs.sh", "test"}, err: "already served"},
+		{name: "missing-project", args: []string{"add", "example.com", "nope"}, err: "project (nope) not found"},
+		{name: "add", args: []string{"add", "Example.com.", "test"}, output: "_pgs-verify.example.com TXT token"},
+		{name: "in-use", args: []string{"add", "example.com", "test"}, err: "already in use"},
+		{name: "ls", args: []string{"ls"}, output: "example.com -> test (pending, _pgs-verify.example.com TXT token)"},
+		{name: "usage", args: []string{"rm"}, err: "usage"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			out, err := handler.domain(s, fixture.args)
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected error %q, got %v", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, fixture.output) {
+				t.Fatalf("expected output to contain %q, got %q", fixture.output, out)
+			}
+		})
+	}
+}
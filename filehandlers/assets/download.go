@@ -0,0 +1,306 @@
+package uploadassets
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/scp"
+	"github.com/picosh/send/send/utils"
+)
+
+// downloadChunk is how much of an object is fetched per range request
+// while streaming it to the client.
+const downloadChunk = 1 << 20
+
+// readAsset opens fpath through `Read` so downloads are decompressed,
+// verified and fetched in ranges exactly like sftp and rsync reads.
+func (h *UploadAssetHandler) readAsset(s ssh.Session, fpath string) (os.FileInfo, utils.ReaderAtCloser, error) {
+	return h.Read(s, &utils.FileEntry{Filepath: "/" + strings.TrimPrefix(fpath, "/")})
+}
+
+func copyRange(w io.Writer, contents io.ReaderAt, offset, length int64) (int64, error) {
+	return io.CopyBuffer(w, io.NewSectionReader(contents, offset, length), make([]byte, downloadChunk))
+}
+
+// cat streams `{project}/{path}` to w, optionally starting at an offset
+// and stopping after length bytes so large files can be resumed.
+func (h *UploadAssetHandler) cat(s ssh.Session, w io.Writer, args []string) (int64, error) {
+	usage := fmt.Errorf("usage: cat {project}/{path} [offset] [length]")
+	if len(args) < 1 || len(args) > 3 {
+		return 0, usage
+	}
+
+	nums := []int64{}
+	for _, arg := range args[1:] {
+		num, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || num < 0 {
+			return 0, usage
+		}
+		nums = append(nums, num)
+	}
+
+	info, contents, err := h.readAsset(s, args[0])
+	if err != nil {
+		return 0, err
+	}
+	defer contents.Close()
+
+	offset := int64(0)
+	if len(nums) > 0 {
+		offset = nums[0]
+	}
+	if offset > info.Size() {
+		return 0, fmt.Errorf("offset (%d) is past the end of (%s), it is %d bytes", offset, args[0], info.Size())
+	}
+	length := info.Size() - offset
+	if len(nums) > 1 && nums[1] < length {
+		length = nums[1]
+	}
+
+	return copyRange(w, contents, offset, length)
+}
+
+// CatMiddleware handles `command cat {project}/{path} [offset] [length]`.
+func CatMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "cat") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			_, err := h.cat(s, s, cmd[2:])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+		}
+	}
+}
+
+// scpSource speaks the sending side of the scp protocol, every line we
+// send is acknowledged by the client with a zero byte.
+type scpSource struct {
+	rw io.ReadWriter
+	// times sends the mtime of every file, `scp -p`
+	times bool
+}
+
+func (c *scpSource) ack() error {
+	buf := make([]byte, 1)
+	_, err := io.ReadFull(c.rw, buf)
+	if err != nil {
+		return err
+	}
+	if buf[0] == 0 {
+		return nil
+	}
+
+	msg := []byte{}
+	for {
+		_, err := io.ReadFull(c.rw, buf)
+		if err != nil || buf[0] == '\n' {
+			break
+		}
+		msg = append(msg, buf[0])
+	}
+	return fmt.Errorf("scp: %s", msg)
+}
+
+func (c *scpSource) send(line string) error {
+	_, err := io.WriteString(c.rw, line)
+	if err != nil {
+		return err
+	}
+	return c.ack()
+}
+
+func (c *scpSource) file(info os.FileInfo, contents io.ReaderAt) error {
+	if c.times {
+		mtime := info.ModTime().Unix()
+		err := c.send(fmt.Sprintf("T%d 0 %d 0\n", mtime, mtime))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.send(fmt.Sprintf("C0644 %d %s\n", info.Size(), info.Name()))
+	if err != nil {
+		return err
+	}
+	_, err = copyRange(c.rw, contents, 0, info.Size())
+	if err != nil {
+		return err
+	}
+	_, err = c.rw.Write([]byte{0})
+	if err != nil {
+		return err
+	}
+	return c.ack()
+}
+
+// scpDownload sends fpath to the client for `scp -f`. Recursive copies
+// walk the project and mirror its directories.
+func (h *UploadAssetHandler) scpDownload(s ssh.Session, rw io.ReadWriter, info scp.Info, times bool) error {
+	c := &scpSource{rw: rw, times: times}
+	// the client starts by acknowledging nothing in particular
+	err := c.ack()
+	if err != nil {
+		return err
+	}
+
+	fpath := strings.Trim(path.Clean("/"+info.Path), "/")
+	if info.Recursive {
+		bucket, err := getBucket(s)
+		if err != nil {
+			return err
+		}
+		infos, err := h.Storage.BatchStat(bucket, []string{fpath})
+		if err != nil {
+			return err
+		}
+		if _, ok := infos[fpath]; !ok {
+			return h.scpDownloadDir(s, c, fpath)
+		}
+	}
+
+	stat, contents, err := h.readAsset(s, fpath)
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+	return c.file(stat, contents)
+}
+
+func (h *UploadAssetHandler) scpDownloadDir(s ssh.Session, c *scpSource, dir string) error {
+	if dir == "" {
+		return fmt.Errorf("scp -r needs a project, e.g. {project} or {project}/{dir}")
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return err
+	}
+	entries, err := storage.WalkObjects(h.Storage, bucket, dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s: %w", dir, os.ErrNotExist)
+	}
+
+	names := map[string]bool{}
+	fpaths := []string{}
+	for _, entry := range entries {
+		names[entry.Path] = true
+		fpaths = append(fpaths, entry.Path)
+	}
+	sort.Strings(fpaths)
+
+	err = c.send(fmt.Sprintf("D0755 0 %s\n", path.Base(dir)))
+	if err != nil {
+		return err
+	}
+
+	// open is the stack of directories below dir we are inside of
+	open := []string{}
+	for _, fpath := range fpaths {
+		// sidecars are rebuilt from the file they were made from
+		if base, ok := storage.SidecarBase(fpath); ok && names[base] {
+			continue
+		}
+
+		rel := strings.TrimPrefix(fpath, dir+"/")
+		parts := strings.Split(path.Dir(rel), "/")
+		if parts[0] == "." {
+			parts = []string{}
+		}
+
+		common := 0
+		for common < len(open) && common < len(parts) && open[common] == parts[common] {
+			common += 1
+		}
+		for len(open) > common {
+			err := c.send("E\n")
+			if err != nil {
+				return err
+			}
+			open = open[:len(open)-1]
+		}
+		for _, part := range parts[common:] {
+			err := c.send(fmt.Sprintf("D0755 0 %s\n", part))
+			if err != nil {
+				return err
+			}
+			open = append(open, part)
+		}
+
+		stat, contents, err := h.readAsset(s, fpath)
+		if err != nil {
+			return err
+		}
+		err = c.file(stat, contents)
+		_ = contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for range open {
+		err := c.send("E\n")
+		if err != nil {
+			return err
+		}
+	}
+	return c.send("E\n")
+}
+
+// ScpMiddleware adds downloads, `scp -f`, to the scp uploads the send
+// library handles.
+func ScpMiddleware(h *UploadAssetHandler) wish.Middleware {
+	upload := scp.Middleware(h)
+	return func(next ssh.Handler) ssh.Handler {
+		uploadHandler := upload(next)
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if len(cmd) == 0 || cmd[0] != "scp" || !slices.Contains(cmd, "-f") {
+				uploadHandler(s)
+				return
+			}
+
+			info := scp.Info{Ok: true, Op: scp.OpCopyToClient}
+			for i, arg := range cmd {
+				switch arg {
+				case "-r":
+					info.Recursive = true
+				case "-f":
+					if i+1 < len(cmd) {
+						info.Path = cmd[i+1]
+					}
+				}
+			}
+
+			err := h.scpDownload(s, s, info, slices.Contains(cmd, "-p"))
+			if err != nil {
+				h.logger(s).Error("could not download", "path", info.Path, "err", err.Error())
+				// a fatal scp error is shown by the client as is
+				_, _ = s.Write([]byte(fmt.Sprintf("\x02%s\n", err)))
+				_ = s.Exit(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/scp"
+	"github.com/picosh/send/send/utils"
+)
+
+// scpClient acknowledges everything the server sends.
+type scpClient struct {
+	io.Reader
+	bytes.Buffer
+}
+
+func (c *scpClient) Read(p []byte) (int, error) { return c.Reader.Read(p) }
+
+func setupDownload(t *testing.T) (*UploadAssetHandler, *fakeSession, map[string][]byte) {
+	t.Helper()
+	handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{
+		CompressThreshold:    1024,
+		PrecompressThreshold: 1024,
+		CompressTypes:        storage.DefaultCompressTypes,
+	})
+	handler.Cfg.AllowedExt = []string{".html", ".css"}
+
+	files := map[string][]byte{
+		"/test/index.html":   bytes.Repeat([]byte("<p>hello world</p>\n"), 100),
+		"/test/css/main.css": []byte("body {}"),
+	}
+	for fpath, text := range files {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: bytes.NewReader(text)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return handler, s, files
+}
+
+func TestCat(t *testing.T) {
+	handler, s, files := setupDownload(t)
+
+	// compressed at rest, streamed as uploaded
+	var out bytes.Buffer
+	_, err := handler.cat(s, &out, []string{"test/index.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), files["/test/index.html"]) {
+		t.Fatalf("expected the original contents, got %q", out.String())
+	}
+
+	out.Reset()
+	_, err = handler.cat(s, &out, []string{"test/css/main.css", "5", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "{" {
+		t.Fatalf("expected one byte at the offset, got %q", out.String())
+	}
+
+	if _, err := handler.cat(s, &out, []string{"test/css/main.css", "8"}); err == nil {
+		t.Fatal("expected an offset past the end to fail")
+	}
+	if _, err := handler.cat(s, &out, []string{"test/missing.css"}); err == nil {
+		t.Fatal("expected a missing file to fail")
+	}
+}
+
+func TestScpDownload(t *testing.T) {
+	handler, s, files := setupDownload(t)
+
+	client := &scpClient{Reader: bytes.NewReader(make([]byte, 64))}
+	info := scp.Info{Ok: true, Op: scp.OpCopyToClient, Path: "test/css/main.css"}
+	err := handler.scpDownload(s, client, info, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(client.String(), "T") || !strings.HasSuffix(client.String(), "C0644 7 main.css\nbody {}\x00") {
+		t.Fatalf("unexpected scp stream %q", client.String())
+	}
+
+	client = &scpClient{Reader: bytes.NewReader(make([]byte, 64))}
+	info = scp.Info{Ok: true, Op: scp.OpCopyToClient, Path: "test", Recursive: true}
+	err = handler.scpDownload(s, client, info, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := files["/test/index.html"]
+	expected := "D0755 0 test\n" +
+		"D0755 0 css\n" +
+		"C0644 7 main.css\nbody {}\x00" +
+		"E\n" +
+		fmt.Sprintf("C0644 %d index.html\n%s\x00", len(html), html) +
+		"E\n"
+	if client.String() != expected {
+		t.Fatalf("unexpected scp stream %q", client.String())
+	}
+
+	// the client refusing a file stops the copy
+	client = &scpClient{Reader: strings.NewReader("\x00\x02no space left\n")}
+	err = handler.scpDownload(s, client, scp.Info{Ok: true, Op: scp.OpCopyToClient, Path: "test/index.html"}, false)
+	if err == nil || !strings.Contains(err.Error(), "no space left") {
+		t.Fatalf("expected the client's error, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package uploadassets
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/shared"
+)
+
+type ctxSessionOpsKey struct{}
+
+// sessionOps counts the uploads and deletes a session is running.
+type sessionOps struct {
+	running atomic.Int64
+	// accounting guards the storage size and file counts of the session,
+	// queued writes settle them from their own goroutine
+	accounting sync.Mutex
+}
+
+func getSessionOps(s ssh.Session) *sessionOps {
+	ops, ok := s.Context().Value(ctxSessionOpsKey{}).(*sessionOps)
+	if !ok {
+		ops = &sessionOps{}
+		s.Context().SetValue(ctxSessionOpsKey{}, ops)
+	}
+	return ops
+}
+
+// track counts an upload or delete for Drain. Once draining, only sessions
+// already in the middle of one, e.g. expanding an archive or running an
+// import, may start more so they are not cut short.
+func (h *UploadAssetHandler) track(s ssh.Session) (func(), error) {
+	ops := getSessionOps(s)
+	if ops.running.Load() > 0 {
+		h.inflight.Join()
+	} else if !h.inflight.Start() {
+		return nil, shared.ErrShuttingDown
+	}
+	ops.running.Add(1)
+
+	return func() {
+		ops.running.Add(-1)
+		h.inflight.Done()
+	}, nil
+}
+
+// Drain refuses new uploads and deletes, then waits for running ones and
+// the hooks, webhooks and cache purges they started, until ctx is done.
+func (h *UploadAssetHandler) Drain(ctx context.Context) error {
+	err := h.inflight.Drain(ctx)
+	if err != nil {
+		return err
+	}
+	if h.Webhooks != nil {
+		err = h.Webhooks.Wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if h.Purger != nil {
+		return h.Purger.Wait(ctx)
+	}
+	return nil
+}
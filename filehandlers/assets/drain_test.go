@@ -0,0 +1,70 @@
+package uploadassets
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestDrain(t *testing.T) {
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{}, nil)
+	handler.Cfg.Logger = slog.Default()
+
+	running := newFakeSession()
+	futil.SetUser(running, &db.User{ID: "1", Name: "test"})
+	done, err := handler.track(running)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- handler.Drain(context.Background())
+	}()
+
+	// wait for the drain to start refusing
+	idle := newFakeSession()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err = handler.Write(idle, &utils.FileEntry{Filepath: "/test/index.html", Reader: strings.NewReader("hi")})
+		if errors.Is(err, shared.ErrShuttingDown) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected writes to be refused, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// a session in the middle of an operation may finish it
+	nested, err := handler.track(running)
+	if err != nil {
+		t.Fatalf("expected nested operation to be allowed, got %v", err)
+	}
+	nested()
+
+	select {
+	case <-drained:
+		t.Fatal("drain returned while an upload was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	done()
+	err = <-drained
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = handler.track(newFakeSession())
+	if !errors.Is(err, shared.ErrShuttingDown) {
+		t.Fatalf("expected shutting down, got %v", err)
+	}
+}
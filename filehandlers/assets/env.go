@@ -0,0 +1,220 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+var (
+	envKey     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envPattern = regexp.MustCompile(`\{\{\s*env\s+"([A-Za-z_][A-Za-z0-9_]*)"\s*\}\}`)
+	// only text the browser reads gets its placeholders replaced
+	envExts = []string{".html", ".htm", ".js", ".mjs", ".css"}
+)
+
+type ctxEnvKey struct{}
+
+// sessionEnv caches the decrypted variables of every project an upload
+// session writes to.
+type sessionEnv struct {
+	mu        sync.Mutex
+	byProject map[string]map[string]string
+}
+
+// projectEnv returns the decrypted variables of projectName, nil when it
+// has none or does not exist yet.
+func (h *UploadAssetHandler) projectEnv(userID, projectName string) (map[string]string, error) {
+	project, err := h.DBPool.FindProjectByName(userID, projectName)
+	if err != nil {
+		return nil, nil
+	}
+	found, err := h.DBPool.FindProjectEnv(project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for _, variable := range found {
+		value, err := h.EnvBox.Open(variable.Value)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt variable (%s): %w", variable.Key, err)
+		}
+		env[variable.Key] = value
+	}
+	return env, nil
+}
+
+func (h *UploadAssetHandler) sessionEnv(s ssh.Session, userID, projectName string) (map[string]string, error) {
+	cache, ok := s.Context().Value(ctxEnvKey{}).(*sessionEnv)
+	if !ok {
+		cache = &sessionEnv{byProject: map[string]map[string]string{}}
+		s.Context().SetValue(ctxEnvKey{}, cache)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if env, ok := cache.byProject[projectName]; ok {
+		return env, nil
+	}
+	env, err := h.projectEnv(userID, projectName)
+	if err != nil {
+		return nil, err
+	}
+	cache.byProject[projectName] = env
+	return env, nil
+}
+
+// substituteEnv replaces `{{ env "KEY" }}` in html, js and css files with
+// the project's variables, unknown keys are left as they are.
+func (h *UploadAssetHandler) substituteEnv(s ssh.Session, data *FileData) error {
+	if h.EnvBox == nil || data.Text == nil {
+		return nil
+	}
+	if !slices.Contains(envExts, strings.ToLower(filepath.Ext(data.Filepath))) {
+		return nil
+	}
+	if !envPattern.Match(data.Text) {
+		return nil
+	}
+
+	// what a signed project serves is exactly what was signed
+	key, err := h.sessionKey(s, data.User.ID, data.ProjectName)
+	if err != nil || key != nil {
+		return err
+	}
+
+	env, err := h.sessionEnv(s, data.User.ID, data.ProjectName)
+	if err != nil || len(env) == 0 {
+		return err
+	}
+
+	text := envPattern.ReplaceAllFunc(data.Text, func(match []byte) []byte {
+		key := string(envPattern.FindSubmatch(match)[1])
+		if value, ok := env[key]; ok {
+			return []byte(value)
+		}
+		return match
+	})
+	if bytes.Equal(text, data.Text) {
+		return nil
+	}
+
+	delta := int64(len(text)) - data.Size
+	data.Text = text
+	data.Contents = utils.NopReaderAtCloser(bytes.NewReader(text))
+	data.Size = int64(len(text))
+	data.DeltaFileSize += delta
+	data.Checksum = shared.Shasum(text)
+	return nil
+}
+
+// env handles `set <project> KEY=value...`, `rm <project> KEY` and
+// `ls <project>`, values are encrypted before they are stored and never
+// printed back.
+func (h *UploadAssetHandler) env(s ssh.Session, args []string) (string, error) {
+	if h.EnvBox == nil {
+		return "", fmt.Errorf("project variables are not enabled")
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	usage := fmt.Errorf("usage: env set {project} {KEY=value}... | env rm {project} {KEY} | env ls {project}")
+	if len(args) < 2 {
+		return "", usage
+	}
+	project, err := h.DBPool.FindProjectByName(user.ID, args[1])
+	if err != nil {
+		return "", fmt.Errorf("project (%s) not found", args[1])
+	}
+
+	switch {
+	case len(args) > 2 && args[0] == "set":
+		err := checkDeploy(s)
+		if err != nil {
+			return "", err
+		}
+		keys := []string{}
+		for _, pair := range args[2:] {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || !envKey.MatchString(key) {
+				return "", fmt.Errorf("(%s) is not a valid KEY=value pair", pair)
+			}
+			sealed, err := h.EnvBox.Seal(value)
+			if err != nil {
+				return "", err
+			}
+			err = h.DBPool.SetProjectEnv(project.ID, key, sealed)
+			if err != nil {
+				return "", err
+			}
+			keys = append(keys, key)
+		}
+		return fmt.Sprintf(
+			"set (%s) for project (%s), it applies to the next upload",
+			strings.Join(keys, ", "), project.Name,
+		), nil
+	case len(args) == 3 && args[0] == "rm":
+		err := checkDeploy(s)
+		if err != nil {
+			return "", err
+		}
+		err = h.DBPool.RemoveProjectEnv(project.ID, args[2])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("removed (%s) from project (%s)", args[2], project.Name), nil
+	case len(args) == 2 && args[0] == "ls":
+		found, err := h.DBPool.FindProjectEnv(project.ID)
+		if err != nil {
+			return "", err
+		}
+		if len(found) == 0 {
+			return "no variables", nil
+		}
+		lines := []string{}
+		for _, variable := range found {
+			lines = append(lines, variable.Key)
+		}
+		return strings.Join(lines, "\r\n"), nil
+	}
+
+	return "", usage
+}
+
+// EnvMiddleware handles `command env` so users can keep settings like api
+// urls out of the files they upload.
+func EnvMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "env") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			out, err := h.env(s, cmd[2:])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package uploadassets
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+type envDB struct {
+	fakeDB
+	env map[string]string
+}
+
+func (f *envDB) SetProjectEnv(projectID, key, value string) error {
+	f.env[key] = value
+	return nil
+}
+
+func (f *envDB) RemoveProjectEnv(projectID, key string) error {
+	if _, ok := f.env[key]; !ok {
+		return fmt.Errorf("variable (%s) not found", key)
+	}
+	delete(f.env, key)
+	return nil
+}
+
+func (f *envDB) FindProjectEnv(projectID string) ([]*db.ProjectEnv, error) {
+	env := []*db.ProjectEnv{}
+	for _, key := range []string{"API_URL", "TOKEN"} {
+		if value, ok := f.env[key]; ok {
+			env = append(env, &db.ProjectEnv{ProjectID: projectID, Key: key, Value: value})
+		}
+	}
+	return env, nil
+}
+
+func TestEnv(t *testing.T) {
+	dbpool := &envDB{fakeDB: fakeDB{projects: []string{"site"}}, env: map[string]string{}}
+	cfg := &shared.ConfigSite{EnvSecret: "secret"}
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(dbpool, cfg, nil)
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	fixtures := []struct {
+		name   string
+		args   []string
+		output string
+		err    string
+	}{
+		{name: "missing-project", args: []string{"ls", "nope"}, err: "project (nope) not found"},
+		{name: "empty", args: []string{"ls", "site"}, output: "no variables"},
+		{name: "invalid", args: []string{"set", "site", "1KEY=value"}, err: "not a valid"},
+		{name: "set", args: []string{"set", "site", "API_URL=https://api.example.com", "TOKEN=a=b"}, output: "set (API_URL, TOKEN)"},
+		{name: "ls", args: []string{"ls", "site"}, output: "API_URL\r\nTOKEN"},
+		{name: "rm", args: []string{"rm", "site", "TOKEN"}, output: "removed (TOKEN)"},
+		{name: "rm-missing", args: []string{"rm", "site", "TOKEN"}, err: "not found"},
+		{name: "usage", args: []string{"get", "site"}, err: "usage"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			out, err := handler.env(s, fixture.args)
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected error %q, got %v", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, fixture.output) {
+				t.Fatalf("expected output to contain %q, got %q", fixture.output, out)
+			}
+		})
+	}
+
+	if strings.Contains(dbpool.env["API_URL"], "example.com") {
+		t.Fatal("expected values to be stored encrypted")
+	}
+
+	text := `fetch("{{ env "API_URL" }}/posts", {{env "MISSING"}})`
+	data := &FileData{
+		FileEntry:     &utils.FileEntry{Filepath: "/site/app.js", Size: int64(len(text))},
+		Text:          []byte(text),
+		User:          &db.User{ID: "1", Name: "test"},
+		ProjectName:   "site",
+		DeltaFileSize: int64(len(text)),
+	}
+	err := handler.substituteEnv(s, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `fetch("https://api.example.com/posts", {{env "MISSING"}})`
+	contents, _ := io.ReadAll(io.NewSectionReader(data.Contents, 0, data.Size))
+	if string(data.Text) != expected || string(contents) != expected {
+		t.Fatalf("expected known variables to be replaced, got %q", data.Text)
+	}
+	if data.Size != int64(len(expected)) || data.DeltaFileSize != int64(len(expected)) {
+		t.Fatalf("expected the size to follow the substitution, got (%d)", data.Size)
+	}
+	if data.Checksum != shared.Shasum([]byte(expected)) {
+		t.Fatal("expected the checksum of the substituted file")
+	}
+
+	txt := &FileData{
+		FileEntry:   &utils.FileEntry{Filepath: "/site/notes.txt", Size: int64(len(text))},
+		Text:        []byte(text),
+		User:        &db.User{ID: "1", Name: "test"},
+		ProjectName: "site",
+	}
+	err = handler.substituteEnv(s, txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(txt.Text) != text {
+		t.Fatal("expected other file types to be left alone")
+	}
+
+	disabled := NewUploadAssetHandler(dbpool, &shared.ConfigSite{}, nil)
+	_, err = disabled.env(s, []string{"ls", "site"})
+	if err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("expected env to be disabled without a secret, got %v", err)
+	}
+}
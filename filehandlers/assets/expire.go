@@ -0,0 +1,49 @@
+package uploadassets
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/expire"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// resetExpiredProject handles uploads to a project that has expired but
+// has not been swept yet. Depending on `ResetExpired` we either wipe it and
+// start over or reject the upload.
+func (h *UploadAssetHandler) resetExpiredProject(s ssh.Session, bucket sst.Bucket, project *db.Project) error {
+	if !h.Cfg.ResetExpired {
+		return fmt.Errorf("ERROR: project (%s) has expired", project.Name)
+	}
+
+	count, size, err := expire.PurgeProject(h.Storage, bucket, project)
+	if err != nil {
+		h.logger(s).Error("could not purge expired project", "project", project.Name, "err", err.Error())
+		return err
+	}
+	h.adjustStorage(s, -size)
+	h.forgetFileCount(s, project.Name)
+
+	_, size, err = expire.PurgeRevisions(h.DBPool, h.Storage, bucket, project)
+	h.adjustStorage(s, -size)
+	if err != nil {
+		h.logger(s).Error("could not purge revisions of expired project", "project", project.Name, "err", err.Error())
+		return err
+	}
+
+	err = h.DBPool.SetProjectExpiry(project.ID, nil)
+	if err != nil {
+		h.logger(s).Error("could not clear project expiry", "project", project.Name, "err", err.Error())
+		return err
+	}
+	project.ExpiresAt = nil
+
+	h.logger(s).Info(
+		"reset expired project",
+		"project", project.Name,
+		"count", count,
+		"size", size,
+	)
+	return nil
+}
@@ -0,0 +1,178 @@
+package uploadassets
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// exportSpaces are the services whose posts live in the database.
+var exportSpaces = []string{"prose", "pastes", "feeds"}
+
+type exportArchive struct {
+	tw    *tar.Writer
+	now   time.Time
+	count int
+}
+
+func (a *exportArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	if modTime.IsZero() {
+		modTime = a.now
+	}
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(a.tw, r, size)
+	if err != nil {
+		return fmt.Errorf("could not export (%s): %w", name, err)
+	}
+	a.count += 1
+	return nil
+}
+
+func (a *exportArchive) addBytes(name string, modTime time.Time, data []byte) error {
+	return a.add(name, int64(len(data)), modTime, bytes.NewReader(data))
+}
+
+func (h *UploadAssetHandler) exportAssets(a *exportArchive, bucket sst.Bucket) error {
+	files, err := h.Storage.ListObjects(bucket, "/", true)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name()] = true
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		// sidecars are rebuilt from the file they were made from
+		if base, ok := storage.SidecarBase(name); ok && names[base] {
+			continue
+		}
+
+		// objects are fetched one at a time so only one is ever open
+		contents, size, modTime, err := h.Storage.GetObject(bucket, name)
+		if err != nil {
+			return fmt.Errorf("could not export (%s): %w", name, err)
+		}
+		if storage.IsCompressed(h.Storage, bucket, name) {
+			contents, size, err = storage.Decompress(contents)
+			if err != nil {
+				return fmt.Errorf("could not export (%s): %w", name, err)
+			}
+		}
+		err = a.add(path.Join("assets", name), size, modTime, contents)
+		_ = contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// export streams a tar.gz of everything the user has into w: project
+// settings, every post and every asset. Nothing is buffered beyond the
+// file being written.
+func (h *UploadAssetHandler) export(s ssh.Session, w io.Writer) (int, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return 0, err
+	}
+
+	gz := gzip.NewWriter(w)
+	a := &exportArchive{tw: tar.NewWriter(gz), now: time.Now()}
+
+	projects, err := h.DBPool.FindProjectsByUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.MarshalIndent(projects, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	err = a.addBytes("projects.json", a.now, data)
+	if err != nil {
+		return a.count, err
+	}
+
+	for _, space := range exportSpaces {
+		posts, err := h.DBPool.FindAllPostsForUser(user.ID, space)
+		if err != nil {
+			return a.count, err
+		}
+		for _, post := range posts {
+			modTime := a.now
+			if post.UpdatedAt != nil {
+				modTime = *post.UpdatedAt
+			}
+			err = a.addBytes(path.Join("posts", space, post.Filename), modTime, []byte(post.Text))
+			if err != nil {
+				return a.count, err
+			}
+		}
+	}
+
+	bucket, err := h.Storage.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err == nil {
+		err = h.exportAssets(a, bucket)
+		if err != nil {
+			return a.count, err
+		}
+	}
+
+	err = a.tw.Close()
+	if err != nil {
+		return a.count, err
+	}
+	return a.count, gz.Close()
+}
+
+// ExportMiddleware handles `command export`, the archive is written to
+// stdout so `ssh pgs.sh command export > backup.tgz` saves it.
+func ExportMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "export") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			count, err := h.export(s, s)
+			if err != nil {
+				h.logger(s).Error("could not export", "count", count, "err", err.Error())
+				utils.ErrorHandler(s, err)
+				return
+			}
+			h.logger(s).Info("exported account", "count", count)
+			_, _ = s.Stderr().Write([]byte(fmt.Sprintf("exported (%d) files\r\n", count)))
+		}
+	}
+}
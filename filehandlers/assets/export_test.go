@@ -0,0 +1,92 @@
+package uploadassets
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type exportDB struct {
+	fakeDB
+}
+
+func (f *exportDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	return []*db.Project{{ID: "test", Name: "test", ProjectDir: "test"}}, nil
+}
+
+func (f *exportDB) FindAllPostsForUser(userID, space string) ([]*db.Post, error) {
+	if space != "prose" {
+		return []*db.Post{}, nil
+	}
+	return []*db.Post{{Filename: "hello.md", Text: "# hello"}}, nil
+}
+
+func TestExport(t *testing.T) {
+	handler, s, _, _ := setupUpload(t, &exportDB{}, &shared.ConfigSite{
+		CompressThreshold:    1024,
+		PrecompressThreshold: 1024,
+		CompressTypes:        storage.DefaultCompressTypes,
+	})
+	handler.Cfg.AllowedExt = []string{".html", ".css"}
+
+	html := bytes.Repeat([]byte("<p>hello world</p>\n"), 100)
+	files := map[string][]byte{
+		"/test/index.html": html,
+		"/test/style.css":  []byte("body {}"),
+	}
+	for fpath, text := range files {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: bytes.NewReader(text)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	count, err := handler.export(s, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	found := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found[hdr.Name] = data
+	}
+
+	expected := map[string][]byte{
+		"assets/test/index.html": html,
+		"assets/test/style.css":  []byte("body {}"),
+		"posts/prose/hello.md":   []byte("# hello"),
+	}
+	for name, text := range expected {
+		if !bytes.Equal(found[name], text) {
+			t.Fatalf("expected (%s) to hold the original contents, got %q", name, found[name])
+		}
+	}
+	// projects.json plus the files, sidecars are left out
+	if count != 4 || len(found) != 4 || found["projects.json"] == nil {
+		t.Fatalf("unexpected archive entries (%d): %v", count, found)
+	}
+}
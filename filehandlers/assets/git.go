@@ -0,0 +1,161 @@
+package uploadassets
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/gitpack"
+	"github.com/picosh/send/send/utils"
+)
+
+func isGitPush(cmd []string) bool {
+	return len(cmd) == 2 && cmd[0] == "git-receive-pack"
+}
+
+// gitProject turns the repository of `git push ssh://host/blog.git` into
+// the project it deploys to.
+func gitProject(repo string) (string, error) {
+	name := strings.TrimSuffix(strings.Trim(path.Clean("/"+repo), "/"), ".git")
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("usage: git push ssh://{host}/{project}.git {branch}")
+	}
+	return name, nil
+}
+
+// deployPush writes every file of the pushed commit to the project and
+// removes the ones that are not in it, like `rsync --delete`.
+func (h *UploadAssetHandler) deployPush(s ssh.Session, projectName string, pack *gitpack.Pack, commitID string) (int, error) {
+	files, err := pack.Files(commitID)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("the pushed commit has no files")
+	}
+
+	mtime := time.Now().Unix()
+	err = h.mirror(s, projectName, func() error {
+		for _, file := range files {
+			_, err := h.Write(s, &utils.FileEntry{
+				Filepath: path.Join("/", projectName, file.Path),
+				Mode:     file.Mode,
+				Size:     file.Size,
+				Mtime:    mtime,
+				Atime:    mtime,
+				Reader:   file.Reader(),
+			})
+			if err != nil {
+				h.logger(s).Error("could not deploy pushed file", "filename", file.Path, "err", err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// receivePack speaks git's receive-pack protocol. We keep no history, so
+// no refs are advertised and the client sends everything it has, the
+// pushed branch is then deployed like an upload.
+func (h *UploadAssetHandler) receivePack(s ssh.Session, projectName string) error {
+	err := gitpack.Advertise(s)
+	if err != nil {
+		return err
+	}
+	req, err := gitpack.ReadRequest(s)
+	if err != nil {
+		return err
+	}
+	// the client had nothing to push
+	if len(req.Commands) == 0 {
+		return nil
+	}
+	band := gitpack.NewSideband(s, req.Has("side-band-64k"))
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return err
+	}
+
+	hasPack := false
+	for _, cmd := range req.Commands {
+		hasPack = hasPack || !cmd.IsDelete()
+	}
+	var pack *gitpack.Pack
+	if hasPack {
+		maxSize := int64(0)
+		if ff, err := futil.GetFeatureFlag(s); err == nil {
+			maxSize = int64(ff.Data.StorageMax)
+		}
+		pack, err = gitpack.ReadPack(s, maxSize)
+		if err != nil {
+			return band.Report(err, nil)
+		}
+		defer pack.Close()
+	}
+
+	statuses := []gitpack.Status{}
+	deployed := false
+	for _, cmd := range req.Commands {
+		status := gitpack.Status{Ref: cmd.Ref}
+		switch {
+		case cmd.IsDelete():
+			status.Err = "deleting refs is not supported, use `command rm` to remove files"
+		case !strings.HasPrefix(cmd.Ref, "refs/heads/"):
+			status.Err = "only branches can be deployed"
+		case deployed:
+			status.Err = "only one branch can be deployed per push"
+		default:
+			deployed = true
+			err := checkDeploy(s)
+			if err == nil {
+				var count int
+				count, err = h.deployPush(s, projectName, pack, cmd.New)
+				if err == nil {
+					_ = band.Progress(fmt.Sprintf(
+						"deployed (%d) files from %s to %s",
+						count,
+						strings.TrimPrefix(cmd.Ref, "refs/heads/"),
+						h.Cfg.AssetURL(user.Name, projectName, ""),
+					))
+				}
+			}
+			if err != nil {
+				status.Err = err.Error()
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return band.Report(nil, statuses)
+}
+
+// GitPushMiddleware deploys a project with `git push
+// ssh://pgs.sh/{project}.git main`, through the same checks as scp.
+func GitPushMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !isGitPush(cmd) {
+				next(s)
+				return
+			}
+
+			projectName, err := gitProject(cmd[1])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			err = h.receivePack(s, projectName)
+			if err != nil {
+				h.logger(s).Error("git push failed", "project", projectName, "err", err.Error())
+				utils.ErrorHandler(s, err)
+			}
+		}
+	}
+}
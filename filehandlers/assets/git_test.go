@@ -0,0 +1,144 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/gitpack"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// gitSession is a session the git client talks to over stdin and stdout.
+type gitSession struct {
+	*fakeSession
+	stdin  io.Reader
+	stdout bytes.Buffer
+}
+
+func (s *gitSession) Read(p []byte) (int, error)  { return s.stdin.Read(p) }
+func (s *gitSession) Write(p []byte) (int, error) { return s.stdout.Write(p) }
+
+type gitDB struct {
+	fakeDB
+}
+
+func (f *gitDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func TestGitProject(t *testing.T) {
+	fixtures := map[string]string{
+		"/blog.git": "blog",
+		"blog":      "blog",
+		"/a/b.git":  "",
+		"/.git":     "",
+		"/":         "",
+	}
+	for repo, expected := range fixtures {
+		name, err := gitProject(repo)
+		if name != expected || (expected == "") != (err != nil) {
+			t.Errorf("%s: expected (%s), got (%s, %v)", repo, expected, name, err)
+		}
+	}
+}
+
+func TestReceivePack(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	run := func(stdin string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Stdin = strings.NewReader(stdin)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@pico.sh",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@pico.sh",
+		)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %s: %s", strings.Join(args, " "), err)
+		}
+		return string(out)
+	}
+	run("", "init", "-q")
+	_ = os.MkdirAll(filepath.Join(repo, "css"), 0o755)
+	_ = os.WriteFile(filepath.Join(repo, "index.html"), []byte("<h1>hi</h1>"), 0o644)
+	_ = os.WriteFile(filepath.Join(repo, "css", "site.css"), []byte("body {}"), 0o644)
+	run("", "add", "-A")
+	run("", "commit", "-q", "-m", "init")
+	head := strings.TrimSpace(run("", "rev-parse", "HEAD"))
+	pack := run("HEAD\n", "pack-objects", "--stdout", "--revs")
+
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"/blog/old.html",
+		utils.NopReaderAtCloser(strings.NewReader("old")),
+		&utils.FileEntry{Filepath: "/blog/old.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &shared.ConfigSite{}
+	cfg.Domain = "pgs.sh"
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(&gitDB{fakeDB: fakeDB{projects: []string{"blog"}}}, cfg, st)
+
+	req := &bytes.Buffer{}
+	_ = gitpack.WritePkt(req, []byte(fmt.Sprintf("%s %s refs/heads/main\x00report-status side-band-64k\n", gitpack.ZeroID, head)))
+	_ = gitpack.WriteFlush(req)
+	req.WriteString(pack)
+
+	s := &gitSession{fakeSession: newFakeSession(), stdin: req}
+	s.command = []string{"git-receive-pack", "/blog.git"}
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	err = handler.receivePack(s, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := s.stdout.String()
+	if !strings.Contains(out, "capabilities^{}") {
+		t.Fatalf("expected the capabilities to be advertised, got %q", out)
+	}
+	if !strings.Contains(out, "deployed (2) files from main to") {
+		t.Fatalf("expected the deploy url in the push output, got %q", out)
+	}
+	if !strings.Contains(out, "ok refs/heads/main") {
+		t.Fatalf("expected the branch to be accepted, got %q", out)
+	}
+
+	for _, fpath := range []string{"/blog/index.html", "/blog/css/site.css"} {
+		if _, err := st.GetObjectSize(bucket, fpath); err != nil {
+			t.Fatalf("expected (%s) to be deployed", fpath)
+		}
+	}
+	if _, err := st.GetObjectSize(bucket, "/blog/old.html"); err == nil {
+		t.Fatal("expected files missing from the push to be removed")
+	}
+}
@@ -2,12 +2,16 @@ package uploadassets
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,8 +19,21 @@ import (
 	"github.com/picosh/pico/db"
 	futil "github.com/picosh/pico/filehandlers/util"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/activity"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/authn"
+	"github.com/picosh/pico/shared/build"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/crypt"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/pico/shared/purge"
+	"github.com/picosh/pico/shared/redirects"
+	"github.com/picosh/pico/shared/scan"
+	"github.com/picosh/pico/shared/signing"
 	"github.com/picosh/pico/shared/storage"
-	"github.com/picosh/pobj"
+	"github.com/picosh/pico/shared/tracing"
+	"github.com/picosh/pico/shared/webhooks"
 	sst "github.com/picosh/pobj/storage"
 	"github.com/picosh/send/send/utils"
 )
@@ -24,6 +41,9 @@ import (
 type ctxBucketKey struct{}
 type ctxStorageSizeKey struct{}
 type ctxProjectKey struct{}
+type ctxFileCountKey struct{}
+type ctxObjectCountKey struct{}
+type ctxBucketStatsKey struct{}
 
 func getProject(s ssh.Session) *db.Project {
 	v := s.Context().Value(ctxProjectKey{})
@@ -46,76 +66,411 @@ func getStorageSize(s ssh.Session) uint64 {
 	return s.Context().Value(ctxStorageSizeKey{}).(uint64)
 }
 
-func incrementStorageSize(s ssh.Session, fileSize int64) uint64 {
-	curSize := getStorageSize(s)
-	var nextStorageSize uint64
-	if fileSize < 0 {
-		nextStorageSize = curSize - uint64(fileSize)
-	} else {
-		nextStorageSize = curSize + uint64(fileSize)
+// applyDelta adds a signed size difference to a storage size without
+// wrapping below zero.
+func applyDelta(size uint64, delta int64) uint64 {
+	if delta >= 0 {
+		return size + uint64(delta)
 	}
+	if uint64(-delta) > size {
+		return 0
+	}
+	return size - uint64(-delta)
+}
+
+func incrementStorageSize(s ssh.Session, fileSize int64) uint64 {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	defer ops.accounting.Unlock()
+	nextStorageSize := applyDelta(getStorageSize(s), fileSize)
 	s.Context().SetValue(ctxStorageSizeKey{}, nextStorageSize)
 	return nextStorageSize
 }
 
+// adjustStorage is `incrementStorageSize` for changes that don't go
+// through `storeAsset`, it also keeps the usage every session of the user
+// shares in step.
+func (h *UploadAssetHandler) adjustStorage(s ssh.Session, delta int64) uint64 {
+	user, err := futil.GetUser(s)
+	if err == nil && delta != 0 {
+		err = h.tracedDB(s.Context()).AddStorageUsage(user.ID, delta)
+		if err != nil {
+			h.logger(s).Error("could not account for storage usage", "err", err.Error())
+		}
+	}
+	return incrementStorageSize(s, delta)
+}
+
 type FileData struct {
 	*utils.FileEntry
+	// Text is the whole file when it fit in memory, larger files are only
+	// available through Contents
 	Text          []byte
+	Contents      utils.ReaderAtCloser
 	User          *db.User
 	Bucket        sst.Bucket
 	StorageSize   uint64
 	FeatureFlag   *db.FeatureFlag
 	DeltaFileSize int64
+	ContentType   string
+	Checksum      string
+	// IsNew is set when no object exists yet at this path
+	IsNew            bool
+	ProjectName      string
+	ProjectFileCount int
+	// UserFileCount is the number of files across every project
+	UserFileCount int
+	// StagingPath is where the file is stored until an atomic deploy is
+	// promoted, empty writes straight to the project
+	StagingPath string
+	// Symlink is the target of a symlink upload, see symlink.go
+	Symlink string
+	// Logger is the session logger tagged with the project
+	Logger *slog.Logger
 }
 
 type UploadAssetHandler struct {
 	DBPool  db.DB
 	Cfg     *shared.ConfigSite
 	Storage storage.StorageServe
+	// Sessions are the live connections of each user
+	Sessions *Sessions
+	// RateLimiter is nil when uploads are not throttled
+	RateLimiter UploadLimiter
+	// RequestLimiter is nil when sessions per key are not limited
+	RequestLimiter *TokenBucketLimiter
+	// Webhooks is nil when webhooks are not enabled
+	Webhooks *webhooks.Sender
+	// Purger is nil when no cdn is configured
+	Purger *purge.Purger
+	// Events is where the changes of sessions are published, the webhooks,
+	// the purger and the deploy feed subscribe to it
+	Events bus.Bus
+	// Scanner is nil when uploads are not scanned
+	Scanner scan.Scanner
+	// EnvBox is nil when project variables are not enabled
+	EnvBox *crypt.Box
+	// Builder is nil when no generators are enabled
+	Builder *build.Runner
+	// Auth resolves the user of a key, nil only looks up registered keys
+	Auth authn.Authenticator
+	// PostWriters store the posts of `command import` by their space,
+	// posts of a space without one are not imported
+	PostWriters map[string]PostWriter
+
+	projects projectLocks
+	deploys  deployLocks
+	inflight shared.Inflight
+	failures recentErrors
 }
 
 func NewUploadAssetHandler(dbpool db.DB, cfg *shared.ConfigSite, storage storage.StorageServe) *UploadAssetHandler {
-	return &UploadAssetHandler{
-		DBPool:  dbpool,
-		Cfg:     cfg,
-		Storage: storage,
+	handler := &UploadAssetHandler{
+		DBPool:   dbpool,
+		Cfg:      cfg,
+		Storage:  storage,
+		Sessions: NewSessions(),
+		Events:   cfg.Events,
+	}
+	if handler.Events == nil {
+		handler.Events = bus.NewLocal()
+	}
+	activity.Subscribe(handler.Events, dbpool, cfg.Logger)
+	if cfg.UploadRateLimit > 0 {
+		handler.RateLimiter = NewTokenBucketLimiter(cfg.UploadRateLimit, cfg.UploadBurst)
+	}
+	if cfg.RequestRateLimit > 0 {
+		handler.RequestLimiter = NewRequestLimiter(cfg.RequestRateLimit, cfg.RequestBurst)
+	}
+	if cfg.Webhooks {
+		handler.Webhooks = webhooks.NewSender(dbpool, cfg.Logger, cfg.WebhookMaxRetries, cfg.WebhookBaseDelay)
+		handler.Webhooks.Subscribe(handler.Events)
+	}
+	if cfg.PurgeProvider != "" {
+		provider, err := purge.NewProvider(cfg.PurgeProvider, cfg.PurgeURL, cfg.PurgeZone, cfg.PurgeToken)
+		if err != nil {
+			cfg.Logger.Error("could not set up cache purging", "err", err.Error())
+		} else {
+			handler.Purger = purge.NewPurger(provider, cfg.PurgeAll, cfg.Logger, cfg.WebhookMaxRetries, cfg.WebhookBaseDelay)
+			handler.Purger.Subscribe(handler.Events)
+		}
+	}
+	if cfg.ScanProvider != "" {
+		scanner, err := scan.NewScanner(cfg.ScanProvider, cfg.ScanURL, cfg.ScanToken)
+		if err != nil {
+			cfg.Logger.Error("could not set up upload scanning", "err", err.Error())
+		} else {
+			handler.Scanner = scanner
+		}
+	}
+	if len(cfg.AuthProviders) > 0 {
+		auth, err := authn.FromConfig(cfg, dbpool)
+		if err != nil {
+			cfg.Logger.Error("could not set up auth providers, only registered keys are accepted", "err", err.Error())
+		} else {
+			handler.Auth = auth
+		}
+	}
+	if len(cfg.BuildGenerators) > 0 {
+		// generators run whatever a project's config tells them to, we never
+		// run them outside of a sandbox
+		if len(cfg.BuildSandbox) == 0 {
+			cfg.Logger.Error("PGS_BUILD_SANDBOX is not set, builds are disabled")
+		} else {
+			handler.Builder = build.NewRunner(cfg.BuildGenerators, cfg.BuildSandbox, cfg.BuildTimeout, cfg.BuildConcurrency)
+		}
 	}
+	if cfg.EnvSecret != "" {
+		box, err := crypt.NewBox(cfg.EnvSecret)
+		if err != nil {
+			cfg.Logger.Error("could not set up project variables", "err", err.Error())
+		} else {
+			handler.EnvBox = box
+		}
+	}
+	return handler
 }
 
 func (h *UploadAssetHandler) GetLogger() *slog.Logger {
 	return h.Cfg.Logger
 }
 
+// logger tags every line with the session and user, outside of a session
+// it is the service logger.
+func (h *UploadAssetHandler) logger(s ssh.Session) *slog.Logger {
+	return shared.SessionLogger(s.Context(), h.Cfg.Logger)
+}
+
+// tracedDB is DBPool recording its queries in the current span of ctx.
+func (h *UploadAssetHandler) tracedDB(ctx context.Context) db.DB {
+	return tracing.NewDB(h.DBPool, tracing.FromContext(ctx))
+}
+
+// tracedStorage is Storage recording its calls in the current span of ctx.
+func (h *UploadAssetHandler) tracedStorage(ctx context.Context) storage.StorageServe {
+	return storage.NewTracingStorage(h.Storage, tracing.FromContext(ctx))
+}
+
+// emit tells the subscribers of Events what a session changed.
+func (h *UploadAssetHandler) emit(s ssh.Session, ev *bus.Event) {
+	if h.isDryRun(s) {
+		return
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	ev.UserID, ev.User, ev.Space = user.ID, user.Name, h.Cfg.Space
+	err = h.Events.Publish(ev)
+	if err != nil {
+		h.logger(s).Error("could not publish event", "topic", ev.Topic, "err", err.Error())
+	}
+}
+
+func (h *UploadAssetHandler) dataLogger(data *FileData) *slog.Logger {
+	if data.Logger != nil {
+		return data.Logger
+	}
+	if data.User != nil {
+		return h.Cfg.Logger.With("user", data.User.Name)
+	}
+	return h.Cfg.Logger
+}
+
 func (h *UploadAssetHandler) Read(s ssh.Session, entry *utils.FileEntry) (os.FileInfo, utils.ReaderAtCloser, error) {
 	user, err := futil.GetUser(s)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	isDir := strings.HasSuffix(entry.Filepath, "/")
+	entry.Filepath, err = shared.SanitizePath(entry.Filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bucket, err := h.tracedStorage(s.Context()).GetBucket(shared.GetAssetBucketName(user.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fname, contents, size, modTime, err := h.getObjectOrIndex(
+		bucket,
+		shared.GetAssetFileName(entry),
+		isDir,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the stored mtime is what the client sent at upload, objects stored
+	// before we kept it have none
+	if modTime.IsZero() && entry.Mtime > 0 {
+		modTime = time.Unix(entry.Mtime, 0)
+	}
+
 	fileInfo := &utils.VirtualFile{
-		FName:    filepath.Base(entry.Filepath),
+		FName:    filepath.Base(fname),
 		FIsDir:   false,
-		FSize:    entry.Size,
-		FModTime: time.Unix(entry.Mtime, 0),
+		FSize:    size,
+		FModTime: modTime,
+	}
+
+	// rsync reads a file to decide whether to skip it, skipped files still
+	// belong to the project
+	if tracker := getRsyncTracker(s); tracker != nil {
+		tracker.record(fname, nil)
+	}
+
+	// compressed objects are inflated in memory, byte ranges into the
+	// stored object would not line up with what the client sees
+	if storage.IsCompressed(h.Storage, bucket, fname) {
+		decoded, decodedSize, err := storage.Decompress(contents)
+		if err != nil {
+			return nil, nil, err
+		}
+		fileInfo.FSize = decodedSize
+		return fileInfo, decoded, nil
+	}
+
+	if h.Cfg.VerifyReads {
+		checksum := ""
+		if meta, err := h.Storage.GetObjectMeta(bucket, fname); err == nil {
+			checksum = meta.Checksum
+		}
+		verified, err := verifyObject(contents, fname, size, checksum)
+		if err != nil {
+			h.logger(s).Error(
+				"object failed verification",
+				"bucket", bucket.Name,
+				"filename", fname,
+				"err", err.Error(),
+			)
+			return nil, nil, err
+		}
+		return fileInfo, verified, nil
 	}
 
-	bucket, err := h.Storage.GetBucket(shared.GetAssetBucketName(user.ID))
+	// only the byte ranges the client asks for are fetched from storage
+	_ = contents.Close()
+	reader := storage.NewRangeReader(h.Storage, bucket, fname, size)
+
+	return fileInfo, reader, nil
+}
+
+// ReadFiles fetches many files concurrently, e.g. to prefetch a project
+// for a bulk download. Files that fail are reported by path.
+func (h *UploadAssetHandler) ReadFiles(s ssh.Session, fpaths []string) (map[string]utils.ReaderAtCloser, map[string]error, error) {
+	user, err := futil.GetUser(s)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	fname := shared.GetAssetFileName(entry)
-	contents, size, modTime, err := h.Storage.GetObject(bucket, fname)
+	bucket, err := h.tracedStorage(s.Context()).GetBucket(shared.GetAssetBucketName(user.ID))
 	if err != nil {
 		return nil, nil, err
 	}
 
-	fileInfo.FSize = size
-	fileInfo.FModTime = modTime
+	errs := map[string]error{}
+	names := []string{}
+	for _, fpath := range fpaths {
+		clean, err := shared.SanitizePath(fpath)
+		if err != nil {
+			errs[fpath] = err
+			continue
+		}
+		names = append(names, clean)
+	}
 
-	reader := pobj.NewAllReaderAt(contents)
+	results, fetchErrs := storage.GetObjects(h.Storage, bucket, names, h.Cfg.StorageConcurrency)
+	for name, err := range fetchErrs {
+		errs[name] = err
+	}
+	for name, contents := range results {
+		if !storage.IsCompressed(h.Storage, bucket, name) {
+			continue
+		}
+		decoded, _, err := storage.Decompress(contents)
+		if err != nil {
+			delete(results, name)
+			errs[name] = err
+			continue
+		}
+		results[name] = decoded
+	}
+	return results, errs, nil
+}
 
-	return fileInfo, reader, nil
+// getObjectOrIndex falls back to the index file below fname when fname is a
+// directory or does not exist. The error for fname wins when neither is found.
+func (h *UploadAssetHandler) getObjectOrIndex(bucket sst.Bucket, fname string, isDir bool) (string, utils.ReaderAtCloser, int64, time.Time, error) {
+	var origErr error
+	if !isDir {
+		contents, size, modTime, err := h.Storage.GetObject(bucket, fname)
+		if err == nil && !isDirObject(contents) {
+			return fname, contents, size, modTime, nil
+		}
+		if err == nil {
+			_ = contents.Close()
+			err = fmt.Errorf("%s: %w", fname, os.ErrNotExist)
+		}
+		origErr = err
+	}
+
+	indexFile := h.Cfg.IndexFile
+	if indexFile == "" {
+		indexFile = "index.html"
+	}
+
+	indexName := filepath.Join(fname, indexFile)
+	contents, size, modTime, err := h.Storage.GetObject(bucket, indexName)
+	if err != nil {
+		if origErr != nil {
+			return fname, nil, 0, time.Time{}, origErr
+		}
+		return fname, nil, 0, time.Time{}, err
+	}
+	return indexName, contents, size, modTime, nil
+}
+
+// isDirObject catches the filesystem backend happily opening a directory.
+func isDirObject(contents utils.ReaderAtCloser) bool {
+	file, ok := contents.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.IsDir()
+}
+
+// verifyObject reads the entire object so we never hand a truncated file
+// to the client while reporting the full size. Objects uploaded with a
+// checksum are hashed as well, which catches corruption of the same length.
+func verifyObject(contents utils.ReaderAtCloser, fname string, size int64, checksum string) (utils.ReaderAtCloser, error) {
+	defer contents.Close()
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	actual := int64(len(data))
+	if actual != size {
+		return nil, fmt.Errorf(
+			"ERROR: (%s) is corrupt, storage returned (%d bytes) but recorded (%d bytes)",
+			fname,
+			actual,
+			size,
+		)
+	}
+
+	if checksum != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != checksum {
+			return nil, fmt.Errorf("ERROR: (%s) is corrupt, its checksum does not match the one recorded at upload", fname)
+		}
+	}
+
+	return utils.NopReaderAtCloser(bytes.NewReader(data)), nil
 }
 
 func (h *UploadAssetHandler) List(s ssh.Session, fpath string, isDir bool, recursive bool) ([]os.FileInfo, error) {
@@ -129,7 +484,7 @@ func (h *UploadAssetHandler) List(s ssh.Session, fpath string, isDir bool, recur
 	cleanFilename := fpath
 
 	bucketName := shared.GetAssetBucketName(user.ID)
-	bucket, err := h.Storage.GetBucket(bucketName)
+	bucket, err := h.tracedStorage(s.Context()).GetBucket(bucketName)
 	if err != nil {
 		return fileList, err
 	}
@@ -151,7 +506,7 @@ func (h *UploadAssetHandler) List(s ssh.Session, fpath string, isDir bool, recur
 			cleanFilename += "/"
 		}
 
-		foundList, err := h.Storage.ListObjects(bucket, cleanFilename, recursive)
+		foundList, err := h.tracedStorage(s.Context()).ListObjects(bucket, cleanFilename, recursive)
 		if err != nil {
 			return fileList, err
 		}
@@ -162,61 +517,135 @@ func (h *UploadAssetHandler) List(s ssh.Session, fpath string, isDir bool, recur
 	return fileList, nil
 }
 
+// findUser resolves the user behind the session's key with the configured
+// auth providers.
+func (h *UploadAssetHandler) findUser(s ssh.Session, key string) (*db.User, error) {
+	if h.Auth == nil {
+		return h.tracedDB(s.Context()).FindUserForKey(s.User(), key)
+	}
+	return h.Auth.Authenticate(s.User(), key)
+}
+
 func (h *UploadAssetHandler) Validate(s ssh.Session) error {
-	var err error
+	err := h.CheckRateLimit(s)
+	if err != nil {
+		return err
+	}
+
 	key, err := shared.KeyText(s)
 	if err != nil {
 		return fmt.Errorf("key not found")
 	}
 
-	user, err := h.DBPool.FindUserForKey(s.User(), key)
+	traced, span := tracing.Start(s, "UploadAssetHandler.Validate")
+	err = h.validate(traced, s, key)
+	span.End(err)
+	return err
+}
+
+// validate finds the user of key, s is the session itself so it is
+// tracked as the one that connected.
+func (h *UploadAssetHandler) validate(traced, s ssh.Session, key string) error {
+	user, err := h.findUser(traced, key)
 	if err != nil {
 		return err
 	}
+	if user.IsSuspended() {
+		return db.ErrUserSuspended
+	}
+	h.trackSession(s, user.ID)
 
-	if user.Name == "" {
-		return fmt.Errorf("must have username set")
+	org, member, err := OrgUser(s, h.DBPool, user)
+	if err != nil {
+		return err
+	}
+	if member != nil {
+		h.logger(s).Info("acting for organization", "user", user.Name, "org", org.Name, "role", member.Role)
 	}
 
+	return h.validateUser(traced, org)
+}
+
+// featureFlag is the user's pgs flag with every limit filled in from
+// their plan or the site's defaults.
+func (h *UploadAssetHandler) featureFlag(user *db.User) *db.FeatureFlag {
 	ff, err := h.DBPool.FindFeatureForUser(user.ID, "pgs")
 	// pgs.sh has a free tier so users might not have a feature flag
 	// in which case we set sane defaults
 	if err != nil {
-		ff = db.NewFeatureFlag(
-			user.ID,
-			"pgs",
-			h.Cfg.MaxSize,
-			h.Cfg.MaxAssetSize,
-		)
+		ff = db.NewFeatureFlag(user.ID, "pgs", 0, 0)
+	}
+	// a plan fills in whatever the user's own flag leaves unset
+	quota, err := h.DBPool.FindQuotaForUser(user.ID, "pgs")
+	if err == nil {
+		ff.ApplyQuota(quota)
 	}
 	// this is jank
-	ff.Data.StorageMax = ff.FindStorageMax(h.Cfg.MaxSize)
+	ff.Data.StorageMax = ff.FindStorageMax(shared.GetQuotaForUser(h.DBPool, h.Cfg, user.ID))
 	ff.Data.FileMax = ff.FindFileMax(h.Cfg.MaxAssetSize)
+	ff.Data.FileCountMax = ff.FindFileCountMax(h.Cfg.MaxFilesPerProject)
+	ff.Data.ObjectCountMax = ff.FindObjectCountMax(h.Cfg.MaxObjectsPerUser)
+	return ff
+}
+
+// validateUser is everything `Validate` checks once it knows who the user
+// is, webdav requests find the user by token and pick up from here.
+func (h *UploadAssetHandler) validateUser(s ssh.Session, user *db.User) error {
+	if user.Name == "" {
+		return fmt.Errorf("must have username set")
+	}
+
+	if user.IsSuspended() {
+		return db.ErrUserSuspended
+	}
+
+	if len(h.Cfg.RequiredFeatures) > 0 {
+		ok, err := h.tracedDB(s.Context()).HasAnyFeatureForUser(user.ID, h.Cfg.RequiredFeatures...)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf(
+				"you must have one of these features to upload: %s",
+				strings.Join(h.Cfg.RequiredFeatures, ", "),
+			)
+		}
+	}
 
+	ff := h.featureFlag(user)
 	futil.SetFeatureFlag(s, ff)
 	futil.SetUser(s, user)
 
 	assetBucket := shared.GetAssetBucketName(user.ID)
-	bucket, err := h.Storage.UpsertBucket(assetBucket)
+	bucket, err := h.tracedStorage(s.Context()).UpsertBucket(assetBucket)
 	if err != nil {
 		return err
 	}
 	s.Context().SetValue(ctxBucketKey{}, bucket)
 
-	totalStorageSize, err := h.Storage.GetBucketQuota(bucket)
-	if err != nil {
-		return err
+	// the running storage size is kept up to date by `Write` so we only
+	// need to walk the bucket once per session
+	if _, ok := s.Context().Value(ctxBucketStatsKey{}).(storage.BucketStats); !ok {
+		stats, err := h.tracedStorage(s.Context()).GetBucketStats(bucket)
+		if err != nil {
+			return err
+		}
+		s.Context().SetValue(ctxBucketStatsKey{}, stats)
+		s.Context().SetValue(ctxStorageSizeKey{}, stats.TotalSize)
+		// uploads of every session account for themselves from here on
+		err = h.tracedDB(s.Context()).SeedStorageUsage(user.ID, int64(stats.TotalSize))
+		if err != nil {
+			return err
+		}
+		h.logger(s).Info(
+			"bucket size",
+			"bytes", stats.TotalSize,
+			"files", stats.FileCount,
+		)
 	}
-	s.Context().SetValue(ctxStorageSizeKey{}, totalStorageSize)
-	h.Cfg.Logger.Info(
-		"bucket size",
-		"user", user.Name,
-		"bytes", totalStorageSize,
-	)
 
-	h.Cfg.Logger.Info(
+	h.logger(s).Info(
 		"attempting to upload files",
-		"user", user.Name,
 		"space", h.Cfg.Space,
 	)
 
@@ -224,53 +653,247 @@ func (h *UploadAssetHandler) Validate(s ssh.Session) error {
 }
 
 func (h *UploadAssetHandler) Write(s ssh.Session, entry *utils.FileEntry) (string, error) {
+	done, err := h.track(s)
+	if err != nil {
+		return "", err
+	}
+
+	s, span := tracing.Start(s, "UploadAssetHandler.Write", "file", entry.Filepath, "size", entry.Size)
+
+	start := time.Now()
+	// an expanded archive records each of its files instead of itself
+	expands := h.expands(s, entry)
+	finish := func(msg string, err error) (string, error) {
+		defer done()
+		if err != nil {
+			h.reportError(s, entry.Filepath, err)
+			h.recordError(s, entry.Filepath, err)
+		}
+		record := !expands || err != nil
+		if tracker := getRsyncTracker(s); tracker != nil && record {
+			tracker.record(entry.Filepath, err)
+		}
+		if stage := getStaging(s); stage != nil && !h.isDryRun(s) && record {
+			stage.record(entry.Filepath, err)
+		}
+		if err == nil && strings.HasPrefix(entry.Filepath, "/") {
+			h.recordEvent(s, shared.GetProjectName(entry), webhooks.ProjectUpdate)
+			h.markBuild(s, shared.GetProjectName(entry))
+			h.markSitemap(s, shared.GetProjectName(entry))
+			h.markLint(s, shared.GetProjectName(entry))
+		}
+		if err == nil && !expands {
+			h.audit(s, audit.ActionWrite, entry.Filepath)
+			h.purgeAsset(s, entry.Filepath)
+		}
+		if record {
+			metrics.ObserveUpload(entry.Size, time.Since(start), err)
+		}
+		h.emitEvent(h.Cfg.OnUpload, s, entry, time.Since(start), err)
+		span.End(err)
+		return msg, err
+	}
+
+	msg, err := h.write(s, entry, finish)
+	if errors.Is(err, errQueued) {
+		return "", nil
+	}
+	return finish(msg, err)
+}
+
+// emitEvent runs hook without blocking the transfer.
+func (h *UploadAssetHandler) emitEvent(hook func(shared.UploadEvent), s ssh.Session, entry *utils.FileEntry, duration time.Duration, err error) {
+	if hook == nil {
+		return
+	}
+
+	evt := shared.UploadEvent{
+		Filename: entry.Filepath,
+		Size:     entry.Size,
+		Duration: duration,
+		Err:      err,
+	}
+	if user, err := futil.GetUser(s); err == nil {
+		evt.User = user.Name
+	}
+	if strings.HasPrefix(entry.Filepath, "/") {
+		evt.Project = shared.GetProjectName(entry)
+	}
+
+	h.inflight.Go(func() {
+		hook(evt)
+	})
+}
+
+// findOrCreateProject runs under the project lock so concurrent sessions
+// uploading to the same new project only insert it once.
+func (h *UploadAssetHandler) findOrCreateProject(s ssh.Session, bucket sst.Bucket, user *db.User, projectName string) (*db.Project, error) {
+	dbpool := h.tracedDB(s.Context())
+	project, err := dbpool.FindProjectByName(user.ID, projectName)
+	if err == nil {
+		if project.IsExpired() {
+			err = h.resetExpiredProject(s, bucket, project)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = dbpool.UpdateProject(user.ID, projectName)
+		if err != nil {
+			h.logger(s).Error("could not update project", "err", err.Error())
+			return nil, err
+		}
+	} else {
+		_, err = dbpool.InsertProject(user.ID, projectName, projectName)
+		if err != nil {
+			h.logger(s).Error("could not create project", "err", err.Error())
+			return nil, err
+		}
+		project, err = dbpool.FindProjectByName(user.ID, projectName)
+		if err != nil {
+			h.logger(s).Error("could not find project", "err", err.Error())
+			return nil, err
+		}
+		h.recordEvent(s, projectName, webhooks.ProjectCreate)
+		h.audit(s, audit.ActionProjectCreate, projectName)
+	}
+	return project, nil
+}
+
+// write stores entry, or queues it when the session has a write queue in
+// which case it returns errQueued and finish is called once it is stored.
+func (h *UploadAssetHandler) write(s ssh.Session, entry *utils.FileEntry, finish func(string, error) (string, error)) (string, error) {
 	user, err := futil.GetUser(s)
 	if err != nil {
-		h.Cfg.Logger.Error(err.Error())
+		h.logger(s).Error(err.Error())
 		return "", err
 	}
+	err = checkDeploy(s)
+	if err != nil {
+		return "", err
+	}
+
+	fpath, err := shared.SanitizeUploadPath(entry.Filepath)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: invalid file path: %w", err)
+	}
+	entry.Filepath = fpath
+
+	maxFileSize := int64(h.Cfg.MaxFileSize)
+	if maxFileSize > 0 && entry.Size > maxFileSize {
+		return "", fmt.Errorf(
+			"ERROR: file (%s) is (%d bytes) which exceeds max file size (%d bytes)",
+			entry.Filepath,
+			entry.Size,
+			maxFileSize,
+		)
+	}
 
-	var origText []byte
-	if b, err := io.ReadAll(entry.Reader); err == nil {
-		origText = b
+	// entry.Size is not reliable so we also guard reading the file
+	reader := storage.ContextReader(s.Context(), entry.Reader)
+	if h.RateLimiter != nil {
+		reader = newThrottledReader(s.Context(), reader, h.RateLimiter, user.ID)
+	}
+	reader, stopProgress := h.trackProgress(s, entry.Filepath, reader)
+	if maxFileSize > 0 {
+		reader = io.LimitReader(reader, maxFileSize+1)
+	}
+
+	sp := newSpool(h.Cfg.MemoryBufferSize)
+	// a queued write closes the spool once it is stored
+	queued := false
+	defer func() {
+		if !queued {
+			_ = sp.Close()
+		}
+	}()
+	_, err = io.Copy(sp, reader)
+	stopProgress()
+	if err := s.Context().Err(); err != nil {
+		return "", fmt.Errorf("ERROR: transfer of (%s) aborted: %w", entry.Filepath, err)
+	}
+	if err != nil {
+		h.logger(s).Error("could not read upload", "filename", entry.Filepath, "err", err.Error())
+		return "", fmt.Errorf("ERROR: could not read (%s): %w", entry.Filepath, err)
+	}
+	if maxFileSize > 0 && sp.size > maxFileSize {
+		return "", fmt.Errorf(
+			"ERROR: file (%s) exceeds max file size (%d bytes)",
+			entry.Filepath,
+			maxFileSize,
+		)
+	}
+	// some clients create then truncate a file, we never want those to
+	// become zero-byte objects or empty projects
+	if sp.size == 0 {
+		if h.Cfg.AllowEmptyFiles {
+			h.logger(s).Info("skipping empty file", "filename", entry.Filepath)
+			h.reportSkip(s, entry.Filepath, "empty file")
+			return "", nil
+		}
+		return "", fmt.Errorf("ERROR: (%s) is empty, skipping", entry.Filepath)
+	}
+	// sftp, scp and rsync do not agree on what they report as the file
+	// size so the bytes we actually read are the source of truth
+	entry.Size = sp.size
+	err = checkClientChecksum(s, entry.Filepath, sp.Checksum())
+	if err != nil {
+		return "", err
 	}
-	fileSize := binary.Size(origText)
-	// TODO: hack for now until I figure out how to get correct
-	// filesize from sftp,scp,rsync
-	entry.Size = int64(fileSize)
 
 	bucket, err := getBucket(s)
 	if err != nil {
-		h.Cfg.Logger.Error(err.Error())
+		h.logger(s).Error(err.Error())
 		return "", err
 	}
+	projectName := shared.GetProjectName(entry)
+	if isIgnoreFile(entry, projectName) {
+		if sp.Bytes() == nil || sp.size > maxIgnoreSize {
+			return "", fmt.Errorf("ERROR: (%s) is too large to be a valid %s file", entry.Filepath, ignoreFile)
+		}
+		rules, err := parseIgnore(string(sp.Bytes()))
+		if err != nil {
+			return "", fmt.Errorf("ERROR: (%s) invalid %s file, %w", entry.Filepath, ignoreFile, err)
+		}
+		setIgnore(s, projectName, rules)
+	} else if h.projectIgnore(s, bucket, projectName).ignored(strings.TrimPrefix(entry.Filepath, "/"+projectName)) {
+		h.logger(s).Info("skipping ignored file", "filename", entry.Filepath)
+		h.reportSkip(s, entry.Filepath, "ignored")
+		return "", nil
+	}
+
+	symlink := ""
+	if isSymlink(entry) {
+		symlink, err = linkTarget(entry, sp)
+		if err != nil {
+			return "", err
+		}
+	} else if h.expands(s, entry) {
+		return h.expandArchive(s, entry, sp)
+	}
 
 	hasProject := getProject(s)
-	projectName := shared.GetProjectName(entry)
+	dryRun := h.isDryRun(s)
+	logger := h.logger(s).With("project", projectName)
 
 	// find, create, or update project if we haven't already done it
-	if hasProject == nil {
-		project, err := h.DBPool.FindProjectByName(user.ID, projectName)
-		if err == nil {
-			err = h.DBPool.UpdateProject(user.ID, projectName)
-			if err != nil {
-				h.Cfg.Logger.Error("could not update project", "err", err.Error())
-				return "", err
-			}
-		} else {
-			_, err = h.DBPool.InsertProject(user.ID, projectName, projectName)
-			if err != nil {
-				h.Cfg.Logger.Error("could not create project", "err", err.Error())
-				return "", err
-			}
-			project, err = h.DBPool.FindProjectByName(user.ID, projectName)
-			if err != nil {
-				h.Cfg.Logger.Error("could not find project", "err", err.Error())
-				return "", err
-			}
+	if hasProject == nil && !dryRun {
+		unlock := h.projects.lock(user.ID, projectName)
+		project, err := h.findOrCreateProject(s, bucket, user, projectName)
+		unlock()
+		if err != nil {
+			return "", err
 		}
 		s.Context().SetValue(ctxProjectKey{}, project)
 	}
+	err = h.lockDeploy(s, user.ID, projectName)
+	if err != nil {
+		return "", err
+	}
+	err = h.checkSigned(s, user.ID, projectName)
+	if err != nil {
+		return "", err
+	}
+	h.detachDeploy(s, user, projectName)
 
 	storageSize := getStorageSize(s)
 	featureFlag, err := futil.GetFeatureFlag(s)
@@ -278,34 +901,133 @@ func (h *UploadAssetHandler) Write(s ssh.Session, entry *utils.FileEntry) (strin
 		return "", err
 	}
 	// calculate the filsize difference between the same file already
-	// stored and the updated file being uploaded
+	// stored and the updated file being uploaded, an overwrite replaces
+	// the old object's size instead of adding to it
 	assetFilename := shared.GetAssetFileName(entry)
-	curFileSize, _ := h.Storage.GetObjectSize(bucket, assetFilename)
-	deltaFileSize := curFileSize - entry.Size
+	if symlink != "" {
+		_, err = storage.CheckLink(h.Storage, bucket, projectName, assetFilename, symlink)
+		if err != nil {
+			return "", fmt.Errorf("ERROR: cannot store symlink (%s): %w", entry.Filepath, err)
+		}
+	}
+	curFileSize, err := h.tracedStorage(s.Context()).GetObjectSize(bucket, assetFilename)
+	isNew := err != nil
+	deltaFileSize := entry.Size - curFileSize
+	if !isNew && h.Cfg.KeepVersions > 0 {
+		// the current copy is kept as a version instead of being replaced
+		deltaFileSize, err = h.versionedDelta(bucket, assetFilename, entry.Size)
+		if err != nil {
+			return "", err
+		}
+	}
+	if isNew && h.Cfg.RejectCaseCollisions {
+		other, err := h.caseCollision(s, bucket, projectName, assetFilename)
+		if err != nil {
+			return "", err
+		}
+		if other != "" {
+			return "", fmt.Errorf("ERROR: (%s) only differs in case from (%s), case-insensitive clients could not download both", entry.Filepath, other)
+		}
+	}
+
+	fileCount := 0
+	if isNew && featureFlag.FindFileCountMax(h.Cfg.MaxFilesPerProject) > 0 {
+		fileCount, err = h.getProjectFileCount(s, bucket, projectName)
+		if err != nil {
+			return "", err
+		}
+	}
+	userFileCount := 0
+	if isNew && featureFlag.FindObjectCountMax(h.Cfg.MaxObjectsPerUser) > 0 {
+		userFileCount, err = h.getUserFileCount(s, bucket)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	data := &FileData{
-		FileEntry:     entry,
-		User:          user,
-		Text:          origText,
-		Bucket:        bucket,
-		StorageSize:   storageSize,
-		FeatureFlag:   featureFlag,
-		DeltaFileSize: deltaFileSize,
+		FileEntry:        entry,
+		User:             user,
+		Text:             sp.Bytes(),
+		Contents:         sp.Reader(),
+		Checksum:         sp.Checksum(),
+		Bucket:           bucket,
+		StorageSize:      storageSize,
+		FeatureFlag:      featureFlag,
+		DeltaFileSize:    deltaFileSize,
+		ContentType:      storage.DetectContentType(entry.Filepath, sp.head),
+		IsNew:            isNew,
+		ProjectName:      projectName,
+		Logger:           logger,
+		ProjectFileCount: fileCount,
+		UserFileCount:    userFileCount,
+		Symlink:          symlink,
+	}
+	if symlink == "" {
+		err = h.substituteEnv(s, data)
+		if err != nil {
+			logger.Error(err.Error())
+			return "", err
+		}
+	}
+	if stage := getStaging(s); stage != nil {
+		data.StagingPath = stage.path(assetFilename)
+	}
+	// a staged deploy only publishes what it stores, an unchanged file
+	// still has to be written there
+	skipUnchanged := h.Cfg.SkipUnchanged || getClientChecksum(s) != ""
+	if skipUnchanged && !isNew && data.StagingPath == "" && symlink == "" && h.unchanged(bucket, assetFilename, data.Checksum) {
+		logger.Info("skipping unchanged file", "filename", entry.Filepath, "checksum", data.Checksum)
+		h.reportSkip(s, entry.Filepath, "unchanged")
+		return "", nil
+	}
+	if queue := getWriteQueue(s); queue != nil && !dryRun && !h.expanding(s) {
+		err = h.queueAsset(s, queue, data, sp, finish)
+		if err != nil {
+			logger.Error(err.Error())
+			return "", err
+		}
+		queued = true
+		return "", errQueued
+	}
+
+	if dryRun {
+		err = h.checkAsset(data)
+	} else {
+		err = h.writeAsset(s.Context(), data)
 	}
-	err = h.writeAsset(data)
 	if err != nil {
-		h.Cfg.Logger.Error(err.Error())
+		logger.Error(err.Error())
 		return "", err
 	}
-	nextStorageSize := incrementStorageSize(s, deltaFileSize)
+	if isNew && !dryRun {
+		h.adjustProjectFileCount(s, projectName, 1)
+	}
+
+	// staged rules are saved once their deploy is promoted
+	if !dryRun && data.StagingPath == "" {
+		err = h.saveRules(user, projectName, entry, data.Text)
+		if err != nil {
+			logger.Error("could not save rules", "err", err.Error())
+			return "", err
+		}
+	}
+	// compression and sidecars change what was actually stored
+	nextStorageSize := incrementStorageSize(s, data.DeltaFileSize)
+	return h.wroteAsset(s, data, nextStorageSize, dryRun), nil
+}
 
+// wroteAsset reports a stored file and sums it up for the client.
+func (h *UploadAssetHandler) wroteAsset(s ssh.Session, data *FileData, nextStorageSize uint64, dryRun bool) string {
+	projectName := data.ProjectName
 	url := h.Cfg.AssetURL(
-		user.Name,
+		data.User.Name,
 		projectName,
 		strings.Replace(data.Filepath, "/"+projectName+"/", "", 1),
 	)
+	h.reportWrite(s, data.Filepath, data.Size, url, data.IsNew)
 
-	maxSize := int(featureFlag.Data.StorageMax)
+	maxSize := int(data.FeatureFlag.Data.StorageMax)
 	str := fmt.Sprintf(
 		"%s (space: %.2f/%.2fGB, %.2f%%)",
 		url,
@@ -313,23 +1035,218 @@ func (h *UploadAssetHandler) Write(s ssh.Session, entry *utils.FileEntry) (strin
 		shared.BytesToGB(maxSize),
 		(float32(nextStorageSize)/float32(maxSize))*100,
 	)
+	if dryRun {
+		str = "(dry run, nothing was written) " + str
+	}
 
-	return str, nil
+	return str
 }
 
-func (h *UploadAssetHandler) validateAsset(data *FileData) (bool, error) {
-	storageMax := data.FeatureFlag.Data.StorageMax
-	var nextStorageSize uint64
-	if data.DeltaFileSize < 0 {
-		nextStorageSize = data.StorageSize - uint64(data.DeltaFileSize)
+// isDryRun is true when the server is configured for dry runs or the
+// client asked for one, e.g. `ssh pgs.sh -- --dry-run`.
+func (h *UploadAssetHandler) isDryRun(s ssh.Session) bool {
+	return h.Cfg.DryRun || slices.Contains(s.Command(), "--dry-run")
+}
+
+func (h *UploadAssetHandler) Delete(s ssh.Session, entry *utils.FileEntry) error {
+	done, err := h.track(s)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	s, span := tracing.Start(s, "UploadAssetHandler.Delete", "file", entry.Filepath)
+	start := time.Now()
+	err = h.delete(s, entry)
+	if err == nil && strings.HasPrefix(entry.Filepath, "/") {
+		h.recordEvent(s, shared.GetProjectName(entry), webhooks.ProjectUpdate)
+		h.markSitemap(s, shared.GetProjectName(entry))
+		h.markLint(s, shared.GetProjectName(entry))
+	}
+	if err == nil {
+		h.audit(s, audit.ActionDelete, entry.Filepath)
+		h.purgeAsset(s, entry.Filepath)
+	}
+	metrics.ObserveDelete(err)
+	h.emitEvent(h.Cfg.OnDelete, s, entry, time.Since(start), err)
+	span.End(err)
+	return err
+}
+
+func (h *UploadAssetHandler) delete(s ssh.Session, entry *utils.FileEntry) error {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		h.logger(s).Error(err.Error())
+		return err
+	}
+	err = checkDeploy(s)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := getBucket(s)
+	if err != nil {
+		h.logger(s).Error(err.Error())
+		return err
+	}
+
+	entry.Filepath, err = shared.SanitizePath(entry.Filepath)
+	if err != nil {
+		return fmt.Errorf("ERROR: invalid file path: %w", err)
+	}
+
+	projectName := shared.GetProjectName(entry)
+	err = h.lockDeploy(s, user.ID, projectName)
+	if err != nil {
+		return err
+	}
+	assetFilename := shared.GetAssetFileName(entry)
+	logger := h.logger(s).With("project", projectName)
+	h.forgetCase(s, projectName, assetFilename)
+	if isIgnoreFile(entry, projectName) {
+		setIgnore(s, projectName, ignoreRules{})
+	}
+
+	// rsync looked the file up and removed it already
+	batch := getDeleteBatch(s)
+	var fileSize int64
+	found := false
+	if batch != nil {
+		fileSize, found = batch.size(assetFilename)
+	} else {
+		fileSize, err = h.tracedStorage(s.Context()).GetObjectSize(bucket, assetFilename)
+		found = err == nil
+	}
+	if !found {
+		return fmt.Errorf("ERROR: file (%s) not found", entry.Filepath)
+	}
+	entry.Size = fileSize
+
+	logger.Info(
+		"deleting file from bucket",
+		"bucket", bucket.Name,
+		"filename", assetFilename,
+	)
+
+	trashed := false
+	if batch != nil {
+		err = batch.removed(assetFilename)
+	} else {
+		trashed, err = h.trashAsset(user, bucket, assetFilename, fileSize)
+	}
+	if err != nil {
+		return err
+	}
+	// trash counts against the quota until it is purged
+	if trashed {
+		fileSize = 0
+	}
+	if batch != nil {
+		fileSize += batch.sidecars(assetFilename)
 	} else {
-		nextStorageSize = data.StorageSize + uint64(data.DeltaFileSize)
+		fileSize += h.removeSidecars(bucket, assetFilename)
+	}
+	h.adjustStorage(s, -fileSize)
+	h.adjustProjectFileCount(s, projectName, -1)
+	h.detachDeploy(s, user, projectName)
+
+	err = h.saveRules(user, projectName, entry, nil)
+	if err != nil {
+		logger.Error("could not clear rules", "err", err.Error())
+	}
+
+	removed, err := h.removeEmptyProject(user, bucket, projectName)
+	if removed {
+		// force the next upload to recreate the project
+		s.Context().SetValue(ctxProjectKey{}, nil)
+		h.recordEvent(s, projectName, webhooks.ProjectDelete)
+		h.audit(s, audit.ActionProjectDelete, projectName)
+	}
+	return err
+}
+
+// isProjectHeaders is true for the `_headers` file at the root of a project,
+// the only one we apply.
+func isProjectHeaders(entry *utils.FileEntry, projectName string) bool {
+	return entry.Filepath == "/"+projectName+"/_headers"
+}
+
+func (h *UploadAssetHandler) saveHeaders(user *db.User, projectName string, text []byte) error {
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return err
 	}
-	if nextStorageSize >= storageMax {
+	rules, err := headers.ValidateHeaderText(string(text))
+	if err != nil {
+		return err
+	}
+	return h.DBPool.UpsertHeaders(project.ID, rules)
+}
+
+// isProjectRedirects is true for the `_redirects` file at the root of a
+// project, the only one we apply.
+func isProjectRedirects(entry *utils.FileEntry, projectName string) bool {
+	return entry.Filepath == "/"+projectName+"/_redirects"
+}
+
+func (h *UploadAssetHandler) saveRedirects(user *db.User, projectName string, text []byte) error {
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return err
+	}
+	rules, err := redirects.ParseRedirectText(string(text))
+	if err != nil {
+		return err
+	}
+	return h.DBPool.UpsertRedirects(project.ID, rules)
+}
+
+// saveRules keeps the `_headers` or `_redirects` of a project in the
+// database once the file is stored, text is nil when it was removed.
+func (h *UploadAssetHandler) saveRules(user *db.User, projectName string, entry *utils.FileEntry, text []byte) error {
+	if isProjectHeaders(entry, projectName) {
+		return h.saveHeaders(user, projectName, text)
+	}
+	if isProjectRedirects(entry, projectName) {
+		return h.saveRedirects(user, projectName, text)
+	}
+	return nil
+}
+
+// removeEmptyProject cleans up the project row once its last asset has
+// been deleted, unless other projects still link to it.
+func (h *UploadAssetHandler) removeEmptyProject(user *db.User, bucket sst.Bucket, projectName string) (bool, error) {
+	files, err := h.Storage.ListObjects(bucket, projectName+"/", true)
+	if err != nil || len(files) > 0 {
+		return false, nil
+	}
+
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return false, nil
+	}
+
+	links, err := h.DBPool.FindProjectLinks(user.ID, projectName)
+	if err != nil || len(links) > 0 {
+		return false, nil
+	}
+
+	h.Cfg.Logger.Info(
+		"removing empty project",
+		"user", user.Name,
+		"project", projectName,
+	)
+	err = h.DBPool.RemoveProject(project.ID)
+	return err == nil, err
+}
+
+func (h *UploadAssetHandler) validateAsset(data *FileData) (bool, error) {
+	storageMax := data.FeatureFlag.Data.StorageMax
+	nextStorageSize := applyDelta(data.StorageSize, data.DeltaFileSize)
+	if data.DeltaFileSize > 0 && nextStorageSize > storageMax {
 		return false, fmt.Errorf(
-			"ERROR: user (%s) has exceeded (%d bytes) max (%d bytes)",
-			data.User.Name,
-			data.StorageSize,
+			"ERROR: quota exceeded: would use (%d bytes) of (%d bytes)",
+			nextStorageSize,
 			storageMax,
 		)
 	}
@@ -346,6 +1263,17 @@ func (h *UploadAssetHandler) validateAsset(data *FileData) (bool, error) {
 		return false, fmt.Errorf("ERROR: file (%s) has exceeded maximum file size (%d bytes)", fname, fileMax)
 	}
 
+	// special files are validated from their text, which large files do
+	// not keep in memory
+	isBuild := isBuildSpec(data.Filepath, data.ProjectName)
+	isIgnore := isIgnoreFile(data.FileEntry, data.ProjectName)
+	isRedirects := isProjectRedirects(data.FileEntry, data.ProjectName)
+	isHeaders := isProjectHeaders(data.FileEntry, data.ProjectName)
+	isSpecial := isRedirects || isHeaders || isBuild || isIgnore || isManifest(fname) || strings.Contains(fname, "/.well-known/")
+	if isSpecial && data.Text == nil && data.Size > 0 {
+		return false, fmt.Errorf("ERROR: (%s) is too large to be a valid %s file", data.Filepath, fname)
+	}
+
 	// ".well-known" is a special case
 	if strings.Contains(fname, "/.well-known/") {
 		if shared.IsTextFile(string(data.Text)) {
@@ -355,25 +1283,92 @@ func (h *UploadAssetHandler) validateAsset(data *FileData) (bool, error) {
 		}
 	}
 
+	if shared.IsExtInList(fname, h.Cfg.DeniedExt) {
+		return false, fmt.Errorf(
+			"ERROR: (%s) invalid file, extension (%s) is not allowed",
+			fname,
+			strings.ToLower(filepath.Ext(fname)),
+		)
+	}
+
+	if fileSize > 0 && storage.MatchContentType(data.ContentType, h.Cfg.DeniedTypes) {
+		return false, fmt.Errorf(
+			"ERROR: (%s) invalid file, content type (%s) is not allowed",
+			fname,
+			data.ContentType,
+		)
+	}
+
 	// special file we use for custom routing
-	if fname == "_redirects" || fname == "_headers" {
+	if isRedirects {
+		_, err := redirects.ParseRedirectText(string(data.Text))
+		if err != nil {
+			return false, fmt.Errorf("ERROR: (%s) invalid _redirects file, %w", data.Filepath, err)
+		}
+		return true, nil
+	}
+
+	if isHeaders {
+		_, err := headers.ValidateHeaderText(string(data.Text))
+		if err != nil {
+			return false, fmt.Errorf("ERROR: (%s) invalid _headers file, %w", data.Filepath, err)
+		}
+		return true, nil
+	}
+
+	if isIgnore {
+		_, err := parseIgnore(string(data.Text))
+		if err != nil {
+			return false, fmt.Errorf("ERROR: (%s) invalid %s file, %w", data.Filepath, ignoreFile, err)
+		}
+		return true, nil
+	}
+
+	// signed deploys, the signature can only be checked once it is deployed
+	if fname == manifestFile {
+		_, err := signing.ParseManifest(string(data.Text))
+		if err != nil {
+			return false, fmt.Errorf("ERROR: (%s) invalid %s file, %w", data.Filepath, manifestFile, err)
+		}
+		return true, nil
+	}
+	if isManifest(fname) {
+		return true, nil
+	}
+
+	if isBuild {
+		_, err := build.ParseSpec(string(data.Text), h.buildGenerators(), data.ProjectName)
+		if err != nil {
+			return false, fmt.Errorf("ERROR: (%s) invalid _build file, %w", data.Filepath, err)
+		}
 		return true, nil
 	}
 
 	if !shared.IsExtAllowed(fname, h.Cfg.AllowedExt) {
 		extStr := strings.Join(h.Cfg.AllowedExt, ",")
 		err := fmt.Errorf(
-			"ERROR: (%s) invalid file, format must be (%s), skipping",
+			"ERROR: (%s) invalid file, extension (%s) must be one of (%s), skipping",
 			fname,
+			strings.ToLower(filepath.Ext(fname)),
 			extStr,
 		)
 		return false, err
 	}
 
+	if fileSize > 0 && len(h.Cfg.AllowedTypes) > 0 && !storage.MatchContentType(data.ContentType, h.Cfg.AllowedTypes) {
+		return false, fmt.Errorf(
+			"ERROR: (%s) invalid file, content type (%s) must be one of (%s), skipping",
+			fname,
+			data.ContentType,
+			strings.Join(h.Cfg.AllowedTypes, ","),
+		)
+	}
+
 	return true, nil
 }
 
-func (h *UploadAssetHandler) writeAsset(data *FileData) error {
+// checkAsset runs every check an upload has to pass before we store it.
+func (h *UploadAssetHandler) checkAsset(data *FileData) error {
 	valid, err := h.validateAsset(data)
 	if !valid {
 		return err
@@ -381,31 +1376,221 @@ func (h *UploadAssetHandler) writeAsset(data *FileData) error {
 
 	assetFilename := shared.GetAssetFileName(data.FileEntry)
 
-	if data.Size == 0 {
-		err = h.Storage.DeleteObject(data.Bucket, assetFilename)
+	if data.Size > 0 {
+		err = h.validateLinks(data)
 		if err != nil {
 			return err
 		}
-	} else {
-		reader := bytes.NewReader(data.Text)
+	}
 
-		h.Cfg.Logger.Info(
-			"uploading file to bucket",
-			"user", data.User.Name,
-			"bucket", data.Bucket.Name,
-			"filename", assetFilename,
+	maxFiles := data.FeatureFlag.FindFileCountMax(h.Cfg.MaxFilesPerProject)
+	if maxFiles > 0 && data.IsNew && data.Size > 0 && data.ProjectFileCount >= maxFiles {
+		return fmt.Errorf(
+			"ERROR: project (%s) has reached the max number of files (%d)",
+			data.ProjectName,
+			maxFiles,
 		)
+	}
+	maxUserFiles := data.FeatureFlag.FindObjectCountMax(h.Cfg.MaxObjectsPerUser)
+	if maxUserFiles > 0 && data.IsNew && data.Size > 0 && data.UserFileCount >= maxUserFiles {
+		return fmt.Errorf(
+			"ERROR: user (%s) has reached the max number of files across all projects (%d)",
+			data.User.Name,
+			maxUserFiles,
+		)
+	}
+
+	if h.Cfg.KeepVersions > 0 && storage.IsVersion(assetFilename) {
+		return fmt.Errorf(
+			"ERROR: (%s) collides with the name of a previous version, rename it before uploading",
+			data.Filepath,
+		)
+	}
+
+	return nil
+}
+
+func (h *UploadAssetHandler) writeAsset(ctx context.Context, data *FileData) error {
+	err := h.checkAsset(data)
+	if err != nil {
+		return err
+	}
+	err = h.scanAsset(ctx, data)
+	if err != nil {
+		return err
+	}
+	return h.storeAsset(ctx, data)
+}
 
-		_, err := h.Storage.PutObject(
-			data.Bucket,
-			assetFilename,
-			utils.NopReaderAtCloser(reader),
-			data.FileEntry,
+// storageHoldTTL is how long a write holds its space in the usage every
+// session of a user shares, a process that dies mid upload can't keep it.
+var storageHoldTTL = time.Hour
+
+// storeAsset puts a file that passed `checkAsset` in storage. The quota
+// check of a session only knows about its own writes, the space is held
+// in the shared usage first so parallel uploads can't all fit into the
+// same free space.
+func (h *UploadAssetHandler) storeAsset(ctx context.Context, data *FileData) error {
+	hold := ""
+	if data.DeltaFileSize > 0 {
+		var err error
+		storageMax := int64(data.FeatureFlag.Data.StorageMax)
+		hold, err = h.tracedDB(ctx).ReserveStorage(
+			data.User.ID,
+			data.ProjectName,
+			data.DeltaFileSize,
+			storageMax,
+			time.Now().Add(storageHoldTTL),
 		)
+		if errors.Is(err, db.ErrQuotaExceeded) {
+			return fmt.Errorf(
+				"ERROR: quota exceeded: (%s) does not fit into (%d bytes) alongside other running uploads",
+				data.Filepath,
+				storageMax,
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := h.putAsset(ctx, data)
+	h.settleUsage(data, hold, err)
+	return err
+}
+
+// settleUsage trues up the shared usage once a write is done, a failed
+// write gives its hold back.
+func (h *UploadAssetHandler) settleUsage(data *FileData, hold string, writeErr error) {
+	var err error
+	switch {
+	case writeErr != nil && hold != "":
+		err = h.DBPool.ReleaseStorage(hold)
+	case writeErr != nil:
+	case hold != "":
+		// compression and sidecars change what was actually stored
+		err = h.DBPool.CommitStorage(data.User.ID, hold, data.DeltaFileSize)
+	case data.DeltaFileSize != 0:
+		err = h.DBPool.AddStorageUsage(data.User.ID, data.DeltaFileSize)
+	}
+	if err != nil {
+		h.dataLogger(data).Error("could not account for storage usage", "err", err.Error())
+	}
+}
+
+// putAsset does the writing for `storeAsset`.
+func (h *UploadAssetHandler) putAsset(ctx context.Context, data *FileData) error {
+	var err error
+	assetFilename := shared.GetAssetFileName(data.FileEntry)
+
+	// empty files never get here, write skips or rejects them
+	if data.Checksum == "" {
+		data.Checksum = shared.Shasum(data.Text)
+	}
+	meta := &storage.ObjectMeta{
+		ContentType: data.ContentType,
+		Checksum:    data.Checksum,
+		Symlink:     data.Symlink,
+	}
+	// files too large to keep in memory are streamed as they are
+	var reader utils.ReaderAtCloser
+	if data.Text == nil && data.Contents != nil {
+		reader = data.Contents
+	} else if data.Symlink != "" {
+		reader = utils.NopReaderAtCloser(bytes.NewReader(data.Text))
+	} else {
+		reader = utils.NopReaderAtCloser(bytes.NewReader(h.compressAsset(data, assetFilename, meta)))
+	}
+	// keep the client's mtime so listings and conditional requests
+	// stay meaningful, clients that do not send one get upload time
+	if data.Mtime <= 0 {
+		data.Mtime = time.Now().Unix()
+	}
+	meta.Mtime = data.Mtime
+
+	storePath := assetFilename
+	if data.StagingPath != "" {
+		storePath = data.StagingPath
+	}
+
+	h.dataLogger(data).Info(
+		"uploading file to bucket",
+		"bucket", data.Bucket.Name,
+		"filename", storePath,
+		"contentType", data.ContentType,
+		"checksum", data.Checksum,
+		"contentEncoding", meta.ContentEncoding,
+	)
+
+	// staged files are versioned when they are promoted
+	if h.Cfg.KeepVersions > 0 && data.StagingPath == "" {
+		err = h.versionAsset(data.Bucket, assetFilename)
 		if err != nil {
 			return err
 		}
 	}
 
+	_, err = h.tracedStorage(ctx).PutObjectCtx(
+		ctx,
+		data.Bucket,
+		storePath,
+		reader,
+		data.FileEntry,
+		meta,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = h.writeSidecars(ctx, data, assetFilename, storePath, meta)
+	if err != nil {
+		return err
+	}
+
+	if h.Cfg.VerifyUploads {
+		return h.verifyUpload(data, storePath)
+	}
+
+	return nil
+}
+
+// verifyUpload re-reads the stored object to make sure it was not
+// truncated or otherwise corrupted on the way to storage.
+func (h *UploadAssetHandler) verifyUpload(data *FileData, assetFilename string) error {
+	contents, _, _, err := h.Storage.GetObject(data.Bucket, assetFilename)
+	if err != nil {
+		return err
+	}
+	if storage.IsCompressed(h.Storage, data.Bucket, assetFilename) {
+		contents, _, err = storage.Decompress(contents)
+		if err != nil {
+			return err
+		}
+	}
+	defer contents.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, contents)
+	if err != nil {
+		return err
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if checksum != data.Checksum {
+		h.dataLogger(data).Error(
+			"uploaded object failed checksum verification",
+			"bucket", data.Bucket.Name,
+			"filename", assetFilename,
+			"expected", data.Checksum,
+			"actual", checksum,
+		)
+		return fmt.Errorf(
+			"ERROR: (%s) checksum mismatch after upload, expected (%s) but stored (%s)",
+			data.Filepath,
+			data.Checksum,
+			checksum,
+		)
+	}
+
 	return nil
 }
@@ -0,0 +1,1732 @@
+package uploadassets
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type fakeContext struct {
+	context.Context
+	sync.Mutex
+	values map[interface{}]interface{}
+}
+
+func (c *fakeContext) Value(key interface{}) interface{} {
+	c.Lock()
+	v, ok := c.values[key]
+	c.Unlock()
+	if ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (c *fakeContext) SetValue(key, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[key] = value
+}
+
+func (c *fakeContext) User() string                  { return "test" }
+func (c *fakeContext) SessionID() string             { return "" }
+func (c *fakeContext) ClientVersion() string         { return "" }
+func (c *fakeContext) ServerVersion() string         { return "" }
+func (c *fakeContext) RemoteAddr() net.Addr          { return nil }
+func (c *fakeContext) LocalAddr() net.Addr           { return nil }
+func (c *fakeContext) Permissions() *ssh.Permissions { return nil }
+
+type fakeSession struct {
+	ssh.Session
+	ctx     *fakeContext
+	command []string
+	key     ssh.PublicKey
+	remote  net.Addr
+	stderr  bytes.Buffer
+	closed  bool
+}
+
+func (s *fakeSession) Context() ssh.Context     { return s.ctx }
+func (s *fakeSession) Command() []string        { return s.command }
+func (s *fakeSession) User() string             { return "test" }
+func (s *fakeSession) PublicKey() ssh.PublicKey { return s.key }
+func (s *fakeSession) RemoteAddr() net.Addr     { return s.remote }
+func (s *fakeSession) Stderr() io.ReadWriter    { return &s.stderr }
+func (s *fakeSession) Environ() []string        { return nil }
+func (s *fakeSession) Subsystem() string        { return "" }
+func (s *fakeSession) Exit(code int) error      { return nil }
+func (s *fakeSession) Close() error             { s.closed = true; return nil }
+func (s *fakeSession) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	return ssh.Pty{}, nil, false
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{
+		ctx: &fakeContext{
+			Context: context.Background(),
+			values:  map[interface{}]interface{}{},
+		},
+	}
+}
+
+// setupUpload is a handler storing to a new bucket on disk and a session
+// of user 1, with a gigabyte of storage, uploading to it.
+func setupUpload(t *testing.T, dbpool db.DB, cfg *shared.ConfigSite) (*UploadAssetHandler, *fakeSession, *storage.StorageFS, sst.Bucket) {
+	t.Helper()
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUploadAssetHandler(dbpool, cfg, st)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+	return handler, s, st, bucket
+}
+
+type fakeDB struct {
+	db.DB
+	// mu guards what queued writes record from their own goroutine
+	mu       sync.Mutex
+	projects []string
+	quota    *db.Quota
+	counts   map[string]*int
+	events   []*db.ProjectEvent
+	audit    []*db.AuditEntry
+	// usage and holds stand in for the storage usage shared by sessions
+	usage map[string]int64
+	holds map[string]int64
+	held  int
+	// headers are the `_headers` rules saved for each project
+	headers map[string][]*headers.HeaderRule
+	// redirects are the `_redirects` rules saved for each project
+	redirects map[string][]*redirects.RedirectRule
+}
+
+func (f *fakeDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	if slices.Contains(f.projects, name) {
+		return &db.Project{ID: name, Name: name, ProjectDir: name}, nil
+	}
+	return nil, db.ErrNameInvalid
+}
+
+func (f *fakeDB) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) FindUserForKey(name, key string) (*db.User, error) {
+	return &db.User{ID: "1", Name: name}, nil
+}
+
+func (f *fakeDB) FindFeatureForUser(userID, feature string) (*db.FeatureFlag, error) {
+	return nil, db.ErrNameInvalid
+}
+
+func (f *fakeDB) FindQuotaForUser(userID, feature string) (*db.Quota, error) {
+	if f.quota == nil {
+		return nil, db.ErrNameInvalid
+	}
+	return f.quota, nil
+}
+
+func (f *fakeDB) InsertProject(userID, name, projectDir string) (string, error) {
+	f.projects = append(f.projects, name)
+	return name, nil
+}
+
+func (f *fakeDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	return []*db.ProjectDeploy{}, nil
+}
+
+func (f *fakeDB) FindProjectObjectCount(userID, name string) (*int, error) {
+	return f.counts[name], nil
+}
+
+func (f *fakeDB) FindObjectCountsForUser(userID string) (map[string]*int, error) {
+	counts := map[string]*int{}
+	for _, name := range f.projects {
+		counts[name] = f.counts[name]
+	}
+	return counts, nil
+}
+
+func (f *fakeDB) SetProjectObjectCount(userID, name string, count *int) error {
+	if f.counts == nil {
+		f.counts = map[string]*int{}
+	}
+	f.counts[name] = count
+	return nil
+}
+
+func (f *fakeDB) AdjustProjectObjectCount(userID, name string, delta int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if count := f.counts[name]; count != nil {
+		*count = max(*count+delta, 0)
+	}
+	return nil
+}
+
+func (f *fakeDB) InsertProjectEvent(event *db.ProjectEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeDB) SeedStorageUsage(userID string, used int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.usage == nil {
+		f.usage = map[string]int64{}
+	}
+	if _, ok := f.usage[userID]; !ok {
+		f.usage[userID] = used
+	}
+	return nil
+}
+
+func (f *fakeDB) ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.usage == nil {
+		f.usage = map[string]int64{}
+	}
+	if f.holds == nil {
+		f.holds = map[string]int64{}
+	}
+	held := int64(0)
+	for _, size := range f.holds {
+		held += size
+	}
+	if max > 0 && f.usage[userID]+held+size > max {
+		return "", db.ErrQuotaExceeded
+	}
+	f.held += 1
+	id := fmt.Sprintf("hold-%d", f.held)
+	f.holds[id] = size
+	return id, nil
+}
+
+func (f *fakeDB) CommitStorage(userID, holdID string, delta int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.holds, holdID)
+	f.usage[userID] = max(f.usage[userID]+delta, 0)
+	return nil
+}
+
+func (f *fakeDB) ReleaseStorage(holdID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.holds, holdID)
+	return nil
+}
+
+func (f *fakeDB) AddStorageUsage(userID string, delta int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if used, ok := f.usage[userID]; ok {
+		f.usage[userID] = max(used+delta, 0)
+	}
+	return nil
+}
+
+func (f *fakeDB) UpsertHeaders(projectID string, rules []*headers.HeaderRule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.headers == nil {
+		f.headers = map[string][]*headers.HeaderRule{}
+	}
+	f.headers[projectID] = rules
+	return nil
+}
+
+func (f *fakeDB) UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.redirects == nil {
+		f.redirects = map[string][]*redirects.RedirectRule{}
+	}
+	f.redirects[projectID] = rules
+	return nil
+}
+
+func (f *fakeDB) InsertAuditEntry(entry *db.AuditEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.audit = append(f.audit, entry)
+	return nil
+}
+
+func TestWriteEmptyFile(t *testing.T) {
+	for _, allowEmpty := range []bool{false, true} {
+		dbpool := &fakeDB{}
+		handler := NewUploadAssetHandler(
+			dbpool,
+			&shared.ConfigSite{AllowEmptyFiles: allowEmpty},
+			nil,
+		)
+		handler.Cfg.Logger = slog.Default()
+
+		s := newFakeSession()
+		futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+		_, err := handler.Write(s, &utils.FileEntry{
+			Filepath: "/test/index.html",
+			Reader:   bytes.NewReader([]byte{}),
+		})
+		if allowEmpty && err != nil {
+			t.Fatalf("expected empty file to be skipped, got %s", err)
+		}
+		if !allowEmpty && err == nil {
+			t.Fatal("expected empty file to be rejected")
+		}
+		if len(dbpool.projects) > 0 {
+			t.Fatalf("expected no project to be created, found %v", dbpool.projects)
+		}
+	}
+}
+
+func TestWriteAssetMaxFiles(t *testing.T) {
+	handler := NewUploadAssetHandler(
+		&fakeDB{},
+		&shared.ConfigSite{MaxFilesPerProject: 2},
+		nil,
+	)
+	handler.Cfg.Logger = slog.Default()
+
+	data := &FileData{
+		FileEntry:        &utils.FileEntry{Filepath: "/test/a.txt", Size: 2},
+		Text:             []byte("hi"),
+		User:             &db.User{ID: "1", Name: "test"},
+		FeatureFlag:      db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)),
+		DeltaFileSize:    2,
+		IsNew:            true,
+		ProjectName:      "test",
+		ProjectFileCount: 2,
+	}
+
+	err := handler.writeAsset(context.Background(), data)
+	if err == nil || !strings.Contains(err.Error(), "max number of files") {
+		t.Fatalf("expected new file to be rejected when the project is full, got %v", err)
+	}
+}
+
+type budgetDB struct {
+	fakeDB
+}
+
+func (f *budgetDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func TestWriteObjectBudget(t *testing.T) {
+	dbpool := &budgetDB{fakeDB{projects: []string{"blog", "docs"}}}
+	cfg := &shared.ConfigSite{MaxObjectsPerUser: 3}
+	cfg.MaxSize = 1000
+	cfg.MaxAssetSize = 100
+	handler, s, st, bucket := setupUpload(t, dbpool, cfg)
+	handler.Cfg.AllowedExt = []string{".html"}
+	ff := db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB))
+	ff.Data.ObjectCountMax = ff.FindObjectCountMax(cfg.MaxObjectsPerUser)
+	futil.SetFeatureFlag(s, ff)
+
+	for _, fpath := range []string{"blog/a.html", "blog/a.html.gz", "docs/b.html"} {
+		_, err := st.PutObject(bucket, fpath, utils.NopReaderAtCloser(strings.NewReader("hi")), &utils.FileEntry{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write := func(fpath string) error {
+		_, err := handler.Write(s, &utils.FileEntry{
+			Filepath: fpath,
+			Reader:   strings.NewReader("<h1>hi</h1>"),
+		})
+		return err
+	}
+
+	// the sidecar does not count so there is room for one more file
+	err := write("/blog/c.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := dbpool.counts["blog"]; count == nil || *count != 2 {
+		t.Fatalf("expected blog to be counted and updated, got %v", count)
+	}
+	err = write("/docs/d.html")
+	if err == nil || !strings.Contains(err.Error(), "max number of files across all projects (3)") {
+		t.Fatalf("expected the user budget to be hit, got %v", err)
+	}
+	// overwrites do not add a file
+	err = write("/docs/b.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = handler.Delete(s, &utils.FileEntry{Filepath: "/blog/c.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = write("/docs/d.html")
+	if err != nil {
+		t.Fatalf("expected a delete to free up the budget, got %v", err)
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	fixtures := []struct {
+		size   uint64
+		delta  int64
+		expect uint64
+	}{
+		{size: 10, delta: 5, expect: 15},
+		{size: 10, delta: 0, expect: 10},
+		{size: 10, delta: -4, expect: 6},
+		{size: 10, delta: -10, expect: 0},
+		{size: 10, delta: -20, expect: 0},
+	}
+	for _, fixture := range fixtures {
+		actual := applyDelta(fixture.size, fixture.delta)
+		if actual != fixture.expect {
+			t.Errorf("applyDelta(%d, %d) = %d, expected %d", fixture.size, fixture.delta, actual, fixture.expect)
+		}
+	}
+}
+
+func TestWriteQuotaOverwrite(t *testing.T) {
+	handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{})
+	handler.Cfg.AllowedExt = []string{".html"}
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", 40, 40))
+
+	steps := []struct {
+		fpath string
+		size  int
+		valid bool
+	}{
+		{fpath: "/blog/a.html", size: 30, valid: true},
+		// an overwrite only counts what it adds
+		{fpath: "/blog/a.html", size: 38, valid: true},
+		{fpath: "/blog/b.html", size: 5, valid: false},
+		{fpath: "/blog/a.html", size: 10, valid: true},
+		// filling the quota exactly is allowed
+		{fpath: "/blog/b.html", size: 30, valid: true},
+		{fpath: "/blog/c.html", size: 1, valid: false},
+	}
+	for _, step := range steps {
+		_, err := handler.Write(s, &utils.FileEntry{
+			Filepath: step.fpath,
+			Reader:   strings.NewReader(strings.Repeat("a", step.size)),
+			Size:     int64(step.size),
+		})
+		if step.valid && err != nil {
+			t.Fatalf("expected %s (%d bytes) to be written, got %s", step.fpath, step.size, err)
+		}
+		if !step.valid && (err == nil || !strings.Contains(err.Error(), "quota exceeded")) {
+			t.Fatalf("expected %s (%d bytes) to exceed the quota, got %v", step.fpath, step.size, err)
+		}
+	}
+}
+
+func TestValidateContentTypes(t *testing.T) {
+	fixtures := []struct {
+		name        string
+		fpath       string
+		contentType string
+		err         string
+	}{
+		{name: "allowed", fpath: "/test/logo.png", contentType: "image/png"},
+		{name: "denied", fpath: "/test/run.exe", contentType: "application/x-msdownload", err: "content type (application/x-msdownload) is not allowed"},
+		{name: "not-allowed", fpath: "/test/main.js", contentType: "text/javascript; charset=utf-8", err: "must be one of (image/,application/x-msdownload)"},
+	}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{
+		AllowedTypes: []string{"image/", "application/x-msdownload"},
+		DeniedTypes:  []string{"application/x-msdownload"},
+	}, nil)
+	handler.Cfg.Logger = slog.Default()
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			data := &FileData{
+				FileEntry:   &utils.FileEntry{Filepath: fixture.fpath, Size: 2},
+				Text:        []byte("hi"),
+				User:        &db.User{ID: "1", Name: "test"},
+				FeatureFlag: db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)),
+				ContentType: fixture.contentType,
+			}
+
+			valid, err := handler.validateAsset(data)
+			if fixture.err == "" {
+				if !valid {
+					t.Fatalf("expected (%s) to be allowed, got %v", fixture.fpath, err)
+				}
+				return
+			}
+			if valid || !strings.Contains(err.Error(), fixture.err) || !strings.Contains(err.Error(), path.Base(fixture.fpath)) {
+				t.Fatalf("expected (%s) to be rejected with %q, got %v", fixture.fpath, fixture.err, err)
+			}
+		})
+	}
+}
+
+func TestWriteUploadEvent(t *testing.T) {
+	events := make(chan shared.UploadEvent, 1)
+	handler := NewUploadAssetHandler(
+		&fakeDB{},
+		&shared.ConfigSite{OnUpload: func(evt shared.UploadEvent) { events <- evt }},
+		nil,
+	)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	_, err := handler.Write(s, &utils.FileEntry{
+		Filepath: "/test/index.html",
+		Reader:   bytes.NewReader([]byte{}),
+	})
+	if err == nil {
+		t.Fatal("expected empty file to be rejected")
+	}
+
+	select {
+	case evt := <-events:
+		if evt.User != "test" || evt.Project != "test" || evt.Filename != "/test/index.html" || evt.Err == nil {
+			t.Fatalf("unexpected upload event: %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected upload event")
+	}
+}
+
+func TestWriteDryRun(t *testing.T) {
+	dbpool := &fakeDB{}
+	handler, s, st, bucket := setupUpload(t, dbpool, &shared.ConfigSite{})
+	handler.Cfg.AllowedExt = []string{".html"}
+	s.command = []string{"--dry-run"}
+
+	msg, err := handler.Write(s, &utils.FileEntry{
+		Filepath: "/test/index.html",
+		Reader:   bytes.NewReader([]byte("<h1>hi</h1>")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg, "dry run") {
+		t.Fatalf("expected dry run message, got (%s)", msg)
+	}
+	if len(dbpool.projects) > 0 {
+		t.Fatalf("expected no project to be created, found %v", dbpool.projects)
+	}
+	_, err = st.GetObjectSize(bucket, "/test/index.html")
+	if err == nil {
+		t.Fatal("expected nothing to be written")
+	}
+
+	_, err = handler.Write(s, &utils.FileEntry{
+		Filepath: "/test/main.exe",
+		Reader:   bytes.NewReader([]byte("binary")),
+	})
+	if err == nil {
+		t.Fatal("expected dry run to still validate extensions")
+	}
+}
+
+type countingStorage struct {
+	storage.StorageServe
+	walks int
+}
+
+func (c *countingStorage) GetBucketStats(bucket sst.Bucket) (storage.BucketStats, error) {
+	c.walks += 1
+	return c.StorageServe.GetBucketStats(bucket)
+}
+
+func TestBucketStatsOncePerSession(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &countingStorage{StorageServe: fs}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.MaxSize = uint64(shared.GB)
+	handler.Cfg.MaxAssetSize = int64(shared.MB)
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newFakeSession()
+	s.key = key
+
+	for i := 0; i < 2; i++ {
+		err = handler.Validate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"a.html", "b.html", "c.html"} {
+		_, err = handler.Write(s, &utils.FileEntry{
+			Filepath: "/test/" + name,
+			Reader:   bytes.NewReader([]byte("<h1>hi</h1>")),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if st.walks != 1 {
+		t.Fatalf("expected bucket to be walked once per session, walked %d times", st.walks)
+	}
+	if getStorageSize(s) != 33 {
+		t.Fatalf("expected storage size to track writes, got %d", getStorageSize(s))
+	}
+}
+
+func TestReadIndexFile(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fpath := range []string{"/test/blog/index.html", "/test/about.html"} {
+		_, err = st.PutObject(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(bytes.NewReader([]byte("<h1>hi</h1>"))),
+			&utils.FileEntry{Filepath: fpath},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	fixtures := []struct {
+		fpath string
+		name  string
+	}{
+		{fpath: "/test/blog/", name: "index.html"},
+		{fpath: "/test/blog", name: "index.html"},
+		{fpath: "/test/about.html", name: "about.html"},
+		{fpath: "/test/missing/", name: ""},
+		{fpath: "/test/missing.html", name: ""},
+	}
+
+	for _, fixture := range fixtures {
+		info, _, err := handler.Read(s, &utils.FileEntry{Filepath: fixture.fpath})
+		if fixture.name == "" {
+			if err == nil {
+				t.Fatalf("expected (%s) to not be found", fixture.fpath)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("(%s): %s", fixture.fpath, err)
+		}
+		if info.Name() != fixture.name {
+			t.Fatalf("(%s): expected (%s), got (%s)", fixture.fpath, fixture.name, info.Name())
+		}
+	}
+}
+
+func TestReadVerify(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := []byte("<h1>hi</h1>")
+	for _, fpath := range []string{"/test/ok.html", "/test/corrupt.html"} {
+		_, err = st.PutObjectWithMeta(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(bytes.NewReader(text)),
+			&utils.FileEntry{Filepath: fpath},
+			&storage.ObjectMeta{Checksum: shared.Shasum(text)},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = st.PutObject(
+		bucket,
+		"/test/legacy.html",
+		utils.NopReaderAtCloser(bytes.NewReader(text)),
+		&utils.FileEntry{Filepath: "/test/legacy.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same length, different bytes
+	err = os.WriteFile(filepath.Join(bucket.Path, "test", "corrupt.html"), []byte("<h1>ho</h1>"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{VerifyReads: true}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	fixtures := []struct {
+		fpath   string
+		corrupt bool
+	}{
+		{fpath: "/test/ok.html"},
+		{fpath: "/test/legacy.html"},
+		{fpath: "/test/corrupt.html", corrupt: true},
+	}
+	for _, fixture := range fixtures {
+		_, contents, err := handler.Read(s, &utils.FileEntry{Filepath: fixture.fpath})
+		if fixture.corrupt {
+			if err == nil || !strings.Contains(err.Error(), "checksum") {
+				t.Fatalf("(%s): expected a checksum error, got %v", fixture.fpath, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("(%s): %s", fixture.fpath, err)
+		}
+		data, _ := io.ReadAll(contents)
+		if !bytes.Equal(data, text) {
+			t.Fatalf("(%s): expected %q, got %q", fixture.fpath, text, data)
+		}
+	}
+}
+
+func TestWriteRecordsActualSize(t *testing.T) {
+	text := []byte("<h1>hello world</h1>")
+	// what each client tends to report for the same file
+	fixtures := []struct {
+		name     string
+		reported int64
+	}{
+		{name: "sftp", reported: 0},
+		{name: "scp", reported: int64(len(text))},
+		{name: "rsync", reported: 4096},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{})
+			handler.Cfg.AllowedExt = []string{".html"}
+
+			entry := &utils.FileEntry{
+				Filepath: "/test/index.html",
+				Size:     fixture.reported,
+				Reader:   bytes.NewReader(text),
+			}
+			_, err := handler.Write(s, entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := st.GetObjectSize(bucket, "/test/index.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := int64(len(text))
+			if entry.Size != expected || size != expected || getStorageSize(s) != uint64(expected) {
+				t.Fatalf(
+					"expected (%d bytes), entry (%d) stored (%d) quota (%d)",
+					expected, entry.Size, size, getStorageSize(s),
+				)
+			}
+		})
+	}
+}
+
+func TestWriteRedirects(t *testing.T) {
+	fixtures := []struct {
+		name  string
+		fpath string
+		text  string
+		err   bool
+		saved int
+	}{
+		{name: "root", fpath: "/test/_redirects", text: "/old /new 301", saved: 1},
+		{name: "root invalid", fpath: "/test/_redirects", text: "/old /new 999", err: true},
+		{name: "nested", fpath: "/test/docs/_redirects", text: "/old /new 999"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dbpool := &fakeDB{}
+			handler, s, _, _ := setupUpload(t, dbpool, &shared.ConfigSite{})
+
+			_, err := handler.Write(s, &utils.FileEntry{
+				Filepath: fixture.fpath,
+				Reader:   strings.NewReader(fixture.text),
+			})
+			if fixture.err != (err != nil) {
+				t.Fatalf("expected error (%t), got %v", fixture.err, err)
+			}
+			if len(dbpool.redirects["test"]) != fixture.saved {
+				t.Fatalf("expected (%d) saved rules, got %v", fixture.saved, dbpool.redirects)
+			}
+		})
+	}
+}
+
+type expiredDB struct {
+	fakeDB
+	cleared bool
+}
+
+func (f *expiredDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	expiresAt := time.Now().Add(-time.Hour)
+	if f.cleared {
+		return &db.Project{ID: name, Name: name, ProjectDir: name}, nil
+	}
+	return &db.Project{ID: name, Name: name, ProjectDir: name, ExpiresAt: &expiresAt}, nil
+}
+
+func (f *expiredDB) SetProjectExpiry(projectID string, expiresAt *time.Time) error {
+	f.cleared = expiresAt == nil
+	return nil
+}
+
+func (f *expiredDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func TestWriteExpiredProject(t *testing.T) {
+	for _, reset := range []bool{false, true} {
+		dbpool := &expiredDB{}
+		handler, s, st, bucket := setupUpload(t, dbpool, &shared.ConfigSite{ResetExpired: reset})
+		handler.Cfg.AllowedExt = []string{".html"}
+
+		old := []byte("old")
+		_, err := st.PutObject(
+			bucket,
+			"/test/old.html",
+			utils.NopReaderAtCloser(bytes.NewReader(old)),
+			&utils.FileEntry{Filepath: "/test/old.html"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(len(old)))
+
+		text := []byte("<h1>hello</h1>")
+		_, err = handler.Write(s, &utils.FileEntry{
+			Filepath: "/test/index.html",
+			Reader:   bytes.NewReader(text),
+		})
+		if !reset {
+			if err == nil || !strings.Contains(err.Error(), "has expired") {
+				t.Fatalf("expected upload to expired project to be rejected, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := st.GetObjectSize(bucket, "/test/old.html"); err == nil {
+			t.Fatal("expected expired project assets to be purged")
+		}
+		if !dbpool.cleared {
+			t.Fatal("expected project expiry to be cleared")
+		}
+		if getStorageSize(s) != uint64(len(text)) {
+			t.Fatalf("expected storage size (%d), found (%d)", len(text), getStorageSize(s))
+		}
+	}
+}
+
+type featureDB struct {
+	fakeDB
+	features []string
+}
+
+func (f *featureDB) HasAnyFeatureForUser(userID string, features ...string) (bool, error) {
+	for _, feature := range features {
+		if slices.Contains(f.features, feature) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestValidateRequiredFeatures(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		required []string
+		features []string
+		valid    bool
+	}{
+		{name: "none-required", valid: true},
+		{name: "missing", required: []string{"pgs"}, valid: false},
+		{name: "any", required: []string{"pgs", "prose"}, features: []string{"prose"}, valid: true},
+	}
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			dbpool := &featureDB{features: fixture.features}
+			handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{RequiredFeatures: fixture.required}, st)
+			handler.Cfg.Logger = slog.Default()
+
+			s := newFakeSession()
+			s.key = key
+
+			err = handler.Validate(s)
+			if fixture.valid && err != nil {
+				t.Fatalf("expected user to be allowed, got %s", err)
+			}
+			if !fixture.valid && err == nil {
+				t.Fatal("expected user to be rejected")
+			}
+		})
+	}
+}
+
+type suspendedDB struct {
+	fakeDB
+	suspendedAt *time.Time
+}
+
+func (f *suspendedDB) FindUserForKey(name, key string) (*db.User, error) {
+	return &db.User{ID: "1", Name: name, SuspendedAt: f.suspendedAt}, nil
+}
+
+func TestValidateSuspended(t *testing.T) {
+	suspendedAt := time.Now()
+	fixtures := []struct {
+		name        string
+		suspendedAt *time.Time
+		valid       bool
+	}{
+		{name: "active", valid: true},
+		{name: "zero", suspendedAt: &time.Time{}, valid: true},
+		{name: "suspended", suspendedAt: &suspendedAt, valid: false},
+	}
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := NewUploadAssetHandler(&suspendedDB{suspendedAt: fixture.suspendedAt}, &shared.ConfigSite{}, st)
+			handler.Cfg.Logger = slog.Default()
+
+			s := newFakeSession()
+			s.key = key
+
+			err = handler.Validate(s)
+			if fixture.valid && err != nil {
+				t.Fatalf("expected user to be allowed, got %s", err)
+			}
+			if !fixture.valid && !errors.Is(err, db.ErrUserSuspended) {
+				t.Fatalf("expected user to be rejected as suspended, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateQuotaPlan(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		quota    *db.Quota
+		expected db.FeatureFlagData
+	}{
+		{
+			name:     "config",
+			expected: db.FeatureFlagData{StorageMax: 1000, FileMax: 100, FileCountMax: 10},
+		},
+		{
+			name:     "plan",
+			quota:    &db.Quota{Plan: "plus", Service: "pgs", StorageMax: 5000, FileMax: 500},
+			expected: db.FeatureFlagData{StorageMax: 5000, FileMax: 500, FileCountMax: 10},
+		},
+	}
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &shared.ConfigSite{MaxFilesPerProject: 10}
+			cfg.MaxSize = 1000
+			cfg.MaxAssetSize = 100
+			handler := NewUploadAssetHandler(&fakeDB{quota: fixture.quota}, cfg, st)
+			handler.Cfg.Logger = slog.Default()
+
+			s := newFakeSession()
+			s.key = key
+
+			err = handler.Validate(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ff, err := futil.GetFeatureFlag(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ff.Data != fixture.expected {
+				t.Fatalf("expected limits %+v, found %+v", fixture.expected, ff.Data)
+			}
+		})
+	}
+}
+
+func TestReadPreservesMtime(t *testing.T) {
+	fixtures := []struct {
+		name  string
+		mtime int64
+	}{
+		{name: "client", mtime: 1709288400},
+		{name: "upload-time", mtime: 0},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{})
+			handler.Cfg.AllowedExt = []string{".html"}
+
+			start := time.Now().Unix()
+			_, err := handler.Write(s, &utils.FileEntry{
+				Filepath: "/test/index.html",
+				Mtime:    fixture.mtime,
+				Reader:   bytes.NewReader([]byte("<h1>hi</h1>")),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, contents, err := handler.Read(s, &utils.FileEntry{Filepath: "/test/index.html"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer contents.Close()
+
+			mtime := info.ModTime().Unix()
+			if fixture.mtime > 0 && mtime != fixture.mtime {
+				t.Fatalf("expected mtime (%d), got (%d)", fixture.mtime, mtime)
+			}
+			if fixture.mtime == 0 && mtime < start {
+				t.Fatalf("expected upload time (>= %d), got (%d)", start, mtime)
+			}
+		})
+	}
+}
+
+func TestWritePrecompress(t *testing.T) {
+	handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{
+		PrecompressThreshold: 1024,
+		CompressTypes:        storage.DefaultCompressTypes,
+	})
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	text := bytes.Repeat([]byte("<p>hello world</p>\n"), 100)
+	_, err := handler.Write(s, &utils.FileEntry{Filepath: "/test/index.html", Reader: bytes.NewReader(text)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := int64(len(text))
+	for _, sc := range storage.Sidecars {
+		meta, err := st.GetObjectMeta(bucket, "/test/index.html"+sc.Ext)
+		if err != nil {
+			t.Fatalf("expected (%s) sidecar, got %s", sc.Encoding, err)
+		}
+		if meta.Source != shared.Shasum(text) || meta.ContentEncoding != sc.Encoding {
+			t.Fatalf("unexpected sidecar meta %+v", meta)
+		}
+		size, _ := st.GetObjectSize(bucket, "/test/index.html"+sc.Ext)
+		total += size
+	}
+	if getStorageSize(s) != uint64(total) {
+		t.Fatalf("expected quota to include sidecars (%d), got (%d)", total, getStorageSize(s))
+	}
+
+	_, err = handler.Write(s, &utils.FileEntry{Filepath: "/test/index.html", Reader: bytes.NewReader([]byte("hi"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sc := range storage.Sidecars {
+		if _, err := st.GetObjectSize(bucket, "/test/index.html"+sc.Ext); err == nil {
+			t.Fatalf("expected (%s) sidecar to be removed", sc.Encoding)
+		}
+	}
+	if getStorageSize(s) != 2 {
+		t.Fatalf("expected quota to drop the sidecars, got (%d)", getStorageSize(s))
+	}
+}
+
+func TestWriteCompressedRoundTrip(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 2048)...)
+	fixtures := []struct {
+		name       string
+		fpath      string
+		text       []byte
+		compressed bool
+	}{
+		{name: "html", fpath: "/test/index.html", text: bytes.Repeat([]byte("<p>hello world</p>\n"), 100), compressed: true},
+		{name: "png", fpath: "/test/logo.png", text: png, compressed: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{
+				CompressThreshold: 1024,
+				CompressTypes:     storage.DefaultCompressTypes,
+				VerifyUploads:     true,
+			})
+			handler.Cfg.AllowedExt = []string{".html", ".png"}
+
+			_, err := handler.Write(s, &utils.FileEntry{
+				Filepath: fixture.fpath,
+				Reader:   bytes.NewReader(fixture.text),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if storage.IsCompressed(st, bucket, fixture.fpath) != fixture.compressed {
+				t.Fatalf("expected compressed to be (%t)", fixture.compressed)
+			}
+			stored, err := st.GetObjectSize(bucket, fixture.fpath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if getStorageSize(s) != uint64(stored) {
+				t.Fatalf("expected quota to track stored size (%d), got (%d)", stored, getStorageSize(s))
+			}
+
+			info, contents, err := handler.Read(s, &utils.FileEntry{Filepath: fixture.fpath})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer contents.Close()
+			actual, err := io.ReadAll(io.NewSectionReader(contents, 0, info.Size()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(actual, fixture.text) || info.Size() != int64(len(fixture.text)) {
+				t.Fatalf("expected byte-identical read, got (%d bytes)", len(actual))
+			}
+		})
+	}
+}
+
+func TestWriteProgress(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		command []string
+		expect  bool
+	}{
+		{name: "scp", command: []string{"scp", "-t", "test"}, expect: true},
+		{name: "pipe", command: []string{"pipe", "test"}, expect: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{ShowProgress: true})
+			handler.Cfg.AllowedExt = []string{".html"}
+			s.command = fixture.command
+
+			_, err := handler.Write(s, &utils.FileEntry{
+				Filepath: "/test/index.html",
+				Reader:   bytes.NewReader([]byte("<h1>hi</h1>")),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := s.stderr.String()
+			if fixture.expect && !strings.Contains(out, "/test/index.html: 11 (") {
+				t.Fatalf("expected progress on stderr, got %q", out)
+			}
+			if !fixture.expect && out != "" {
+				t.Fatalf("expected no progress, got %q", out)
+			}
+		})
+	}
+}
+
+type unknownKeyDB struct {
+	fakeDB
+}
+
+func (f *unknownKeyDB) FindUserForKey(name, key string) (*db.User, error) {
+	return nil, db.ErrNameInvalid
+}
+
+func TestUploadReport(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		command []string
+		lines   bool
+		summary bool
+	}{
+		{name: "default", command: []string{"scp", "-t", "test"}, summary: true},
+		{name: "scp-verbose", command: []string{"scp", "-v", "-t", "test"}, lines: true, summary: true},
+		{name: "rsync-verbose", command: []string{"rsync", "--server", "-vlogDtpre.iLsfxC", ".", "test"}, lines: true, summary: true},
+		{name: "quiet", command: []string{"scp", "-q", "-v", "-t", "test"}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{})
+			handler.Cfg.AllowedExt = []string{".html"}
+			s.command = fixture.command
+
+			UploadReportMiddleware(handler)(func(s ssh.Session) {
+				for _, fpath := range []string{"/test/index.html", "/test/index.html", "/test/main.exe"} {
+					_, _ = handler.Write(s, &utils.FileEntry{
+						Filepath: fpath,
+						Reader:   bytes.NewReader([]byte("<h1>hi</h1>")),
+					})
+				}
+			})(s)
+
+			out := s.stderr.String()
+			hasLines := strings.Contains(out, "uploaded /test/index.html (11) ") &&
+				strings.Contains(out, "overwrote /test/index.html") &&
+				strings.Contains(out, "failed /test/main.exe")
+			if hasLines != fixture.lines {
+				t.Fatalf("expected per-file lines (%t), got %q", fixture.lines, out)
+			}
+			hasSummary := strings.Contains(out, "uploaded (2) files (22), (1) overwritten, (0) skipped, (1) failed, space: 11 of ")
+			if hasSummary != fixture.summary {
+				t.Fatalf("expected summary (%t), got %q", fixture.summary, out)
+			}
+		})
+	}
+}
+
+func TestWhoami(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newFakeSession()
+	s.key = key
+
+	handler := NewUploadAssetHandler(&unknownKeyDB{}, &shared.ConfigSite{}, st)
+	_, err = handler.whoami(s)
+	if err != errKeyNotRecognized {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+
+	handler = NewUploadAssetHandler(&featureDB{}, &shared.ConfigSite{RequiredFeatures: []string{"pgs"}}, st)
+	out, err := handler.whoami(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "user: test") || !strings.Contains(out, "features: missing") {
+		t.Fatalf("expected user and missing feature, got %q", out)
+	}
+	if _, err := st.GetBucket("static-1"); err == nil {
+		t.Fatal("expected whoami to not create a bucket")
+	}
+}
+
+// lockDB widens the gap between finding and inserting a project so
+// concurrent uploads would both insert it without the project lock.
+type lockDB struct {
+	fakeDB
+	mu      sync.Mutex
+	inserts int
+}
+
+func (f *lockDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	f.mu.Lock()
+	project, err := f.fakeDB.FindProjectByName(userID, name)
+	f.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	return project, err
+}
+
+func (f *lockDB) InsertProject(userID, name, projectDir string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inserts += 1
+	return f.fakeDB.InsertProject(userID, name, projectDir)
+}
+
+func (f *lockDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func TestWriteConcurrentNewProject(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbpool := &lockDB{}
+	handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, name := range []string{"index.html", "about.html"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := newFakeSession()
+			futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+			futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+			s.Context().SetValue(ctxBucketKey{}, bucket)
+			s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+			_, errs[i] = handler.Write(s, &utils.FileEntry{
+				Filepath: "/test/" + name,
+				Reader:   bytes.NewReader([]byte("<h1>hello</h1>")),
+			})
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dbpool.inserts != 1 || len(dbpool.projects) != 1 {
+		t.Fatalf("expected one project to be created, inserted %d: %v", dbpool.inserts, dbpool.projects)
+	}
+}
+
+func TestWriteSpoolsLargeFiles(t *testing.T) {
+	handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{MemoryBufferSize: 32, VerifyUploads: true})
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	// larger than the buffer so it has to go through a temporary file
+	text := []byte(strings.Repeat("<p>hello world</p>", 10))
+
+	_, err := handler.Write(s, &utils.FileEntry{
+		Filepath: "/test/index.html",
+		Reader:   bytes.NewReader(text),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _, _, err := st.GetObject(bucket, "/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	stored, err := io.ReadAll(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, text) {
+		t.Fatalf("expected stored file to match upload, got %q", stored)
+	}
+
+	meta, err := st.GetObjectMeta(bucket, "/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Checksum != shared.Shasum(text) || !strings.HasPrefix(meta.ContentType, "text/html") {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+}
+
+func TestVerifyUpload(t *testing.T) {
+	text := []byte("<h1>hello</h1>")
+	fixtures := []struct {
+		name     string
+		stored   []byte
+		checksum string
+		err      string
+	}{
+		{name: "match", stored: text, checksum: shared.Shasum(text)},
+		{name: "corrupted", stored: []byte("<h1>hellp</h1>"), checksum: shared.Shasum(text), err: "checksum mismatch"},
+		{name: "truncated", stored: text[:4], checksum: shared.Shasum(text), err: "checksum mismatch"},
+		{name: "missing", checksum: shared.Shasum(text), err: "no such file"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, _, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{VerifyUploads: true})
+			if fixture.stored != nil {
+				_, err := st.PutObject(bucket, "test/index.html", utils.NopReaderAtCloser(bytes.NewReader(fixture.stored)), &utils.FileEntry{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data := &FileData{
+				FileEntry: &utils.FileEntry{Filepath: "/test/index.html"},
+				User:      &db.User{ID: "1", Name: "test"},
+				Bucket:    bucket,
+				Checksum:  fixture.checksum,
+			}
+			err := handler.verifyUpload(data, "test/index.html")
+			if fixture.err == "" && err != nil {
+				t.Fatalf("expected the upload to verify, got %s", err)
+			}
+			if fixture.err != "" && (err == nil || !strings.Contains(err.Error(), fixture.err)) {
+				t.Fatalf("expected %q, got %v", fixture.err, err)
+			}
+		})
+	}
+}
+
+func TestWriteSessionLogger(t *testing.T) {
+	handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{})
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	var out bytes.Buffer
+	shared.SetSessionLogger(s.Context(), slog.New(slog.NewJSONHandler(&out, nil)).With("session", "abc"))
+	// setting the user adds it to the session logger
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	_, err := handler.Write(s, &utils.FileEntry{
+		Filepath: "/test/index.html",
+		Reader:   bytes.NewReader([]byte("<h1>hi</h1>")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		entry := map[string]any{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("expected json log line, got %q", line)
+		}
+		if entry["session"] != "abc" || entry["user"] != "test" {
+			t.Fatalf("expected session and user on every line, got %q", line)
+		}
+		if entry["msg"] == "uploading file to bucket" {
+			found = entry["project"] == "test"
+		}
+	}
+	if !found {
+		t.Fatalf("expected upload to be logged with its project, got %q", out.String())
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{SkipUnchanged: true, KeepVersions: 1})
+	s.command = []string{"scp", "-v", "-t", "test"}
+
+	UploadReportMiddleware(handler)(func(s ssh.Session) {
+		for _, text := range []string{"<h1>hi</h1>", "<h1>hi</h1>", "<h1>yo</h1>"} {
+			_, err := handler.Write(s, &utils.FileEntry{
+				Filepath: "/test/index.html",
+				Reader:   bytes.NewReader([]byte(text)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})(s)
+
+	out := s.stderr.String()
+	if !strings.Contains(out, "skipped /test/index.html (unchanged)") || !strings.Contains(out, "overwrote /test/index.html") {
+		t.Fatalf("expected the second upload to be skipped and the third stored, got %q", out)
+	}
+	// only the change is kept as a version
+	entries, err := storage.WalkObjects(st, bucket, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the file and one version, got %v", entries)
+	}
+}
+
+func TestVersionsQuota(t *testing.T) {
+	handler, s, _, _ := setupUpload(t, &fakeDB{}, &shared.ConfigSite{KeepVersions: 1})
+
+	// the first overwrite keeps the old copy, the second pushes it out
+	for i, expected := range []uint64{10, 20, 20} {
+		_, err := handler.Write(s, &utils.FileEntry{
+			Filepath: "/test/index.html",
+			Reader:   bytes.NewReader([]byte(fmt.Sprintf("<p>%d....</p>", i)[:10])),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if getStorageSize(s) != expected {
+			t.Fatalf("expected (%d) bytes to be counted after upload (%d), got (%d)", expected, i, getStorageSize(s))
+		}
+	}
+}
+
+func TestUploadPathNormalization(t *testing.T) {
+	handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{RejectCaseCollisions: true})
+
+	write := func(fpath string) error {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: strings.NewReader("<h1>hi</h1>")})
+		return err
+	}
+
+	// decomposed names are stored composed
+	if err := write("/test/cafe\u0301.html"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetObjectSize(bucket, "/test/caf\u00e9.html"); err != nil {
+		t.Fatalf("expected the name to be stored in NFC, got %s", err)
+	}
+	for _, fpath := range []string{"/test/index\r.html", "/test/" + strings.Repeat("a", 256) + ".html"} {
+		if err := write(fpath); err == nil || !strings.Contains(err.Error(), "invalid file path") {
+			t.Fatalf("expected (%q) to be rejected, got %v", fpath, err)
+		}
+	}
+
+	if err := write("/test/README.html"); err != nil {
+		t.Fatal(err)
+	}
+	err := write("/test/readme.html")
+	if err == nil || !strings.Contains(err.Error(), "only differs in case from (/test/README.html)") {
+		t.Fatalf("expected a case collision, got %v", err)
+	}
+	// the same name is an overwrite
+	if err := write("/test/README.html"); err != nil {
+		t.Fatal(err)
+	}
+	// deleting the file frees its name
+	err = handler.Delete(s, &utils.FileEntry{Filepath: "/test/README.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write("/test/readme.html"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteSharedQuota(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := fs.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbpool := &fakeDB{}
+	handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{}, fs)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	// each session only knows about its own writes
+	write := func(fpath string) error {
+		s := newFakeSession()
+		futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+		futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", 15, int64(shared.GB)))
+		s.Context().SetValue(ctxBucketKey{}, bucket)
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+		_, err := handler.Write(s, &utils.FileEntry{
+			Filepath: fpath,
+			Reader:   strings.NewReader("0123456789"),
+		})
+		return err
+	}
+
+	err = write("/blog/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = write("/docs/index.html")
+	if err == nil || !strings.Contains(err.Error(), "alongside other running uploads") {
+		t.Fatalf("expected the shared usage to reject the second write, got %v", err)
+	}
+	if _, err := fs.GetObjectSize(bucket, "/docs/index.html"); err == nil {
+		t.Fatal("expected the rejected file not to be stored")
+	}
+	if dbpool.usage["1"] != 10 || len(dbpool.holds) != 0 {
+		t.Fatalf("expected only the stored file to count, found (%d bytes) and holds %v", dbpool.usage["1"], dbpool.holds)
+	}
+}
+
+func TestWriteReservedStorage(t *testing.T) {
+	dbpool := memory.NewDB(slog.Default())
+	handler, s, _, _ := setupUpload(t, dbpool, &shared.ConfigSite{})
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	// `reserve` holds all but a few bytes for the next deploy of docs
+	_, err := dbpool.ReserveProjectStorage("1", "docs", int64(shared.GB)-5, int64(shared.GB), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(fpath string) error {
+		_, err := handler.Write(s, &utils.FileEntry{
+			Filepath: fpath,
+			Reader:   strings.NewReader("<h1>hi</h1>"),
+		})
+		return err
+	}
+
+	err = write("/blog/index.html")
+	if err == nil || !strings.Contains(err.Error(), "quota") {
+		t.Fatalf("expected the reservation of docs to count against blog, got %v", err)
+	}
+	err = write("/docs/index.html")
+	if err != nil {
+		t.Fatalf("expected docs to upload into its own reservation, got %v", err)
+	}
+}
+
+func TestDeleteEmptyProject(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		files   []string
+		linked  bool
+		removed bool
+	}{
+		{name: "last-file", files: []string{"index.html"}, removed: true},
+		{name: "files-left", files: []string{"index.html", "about.html"}, removed: false},
+		{name: "linked", files: []string{"index.html"}, linked: true, removed: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dbpool := memory.NewDB(slog.Default())
+			handler, s, _, _ := setupUpload(t, dbpool, &shared.ConfigSite{})
+			handler.Cfg.AllowedExt = []string{".html"}
+
+			for _, name := range fixture.files {
+				_, err := handler.Write(s, &utils.FileEntry{
+					Filepath: "/blog/" + name,
+					Reader:   strings.NewReader("<h1>hi</h1>"),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if fixture.linked {
+				id, err := dbpool.InsertProject("1", "prod", "prod")
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = dbpool.LinkToProject("1", id, "blog", true)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := handler.Delete(s, &utils.FileEntry{Filepath: "/blog/index.html"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = dbpool.FindProjectByName("1", "blog")
+			if fixture.removed && err == nil {
+				t.Error("expected the empty project to be removed")
+			}
+			if !fixture.removed && err != nil {
+				t.Errorf("expected the project to be kept, got %s", err)
+			}
+
+			err = handler.Delete(s, &utils.FileEntry{Filepath: "/blog/index.html"})
+			if err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("expected deleting a missing file to fail, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package uploadassets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+)
+
+type ctxHTTPSessionKey struct{}
+
+func getHTTPSession(ctx context.Context) (*futil.RequestSession, error) {
+	s, ok := ctx.Value(ctxHTTPSessionKey{}).(*futil.RequestSession)
+	if !ok {
+		return nil, fmt.Errorf("http session not found")
+	}
+	return s, nil
+}
+
+// tokenUser accepts a deploy token either as the basic auth password, with
+// the user name as the user, or as a bearer token. Tokens of any other
+// scope, e.g. the ones reading feeds, cannot upload.
+func (h *UploadAssetHandler) tokenUser(r *http.Request) (*db.User, error) {
+	name, token, ok := r.BasicAuth()
+	if !ok {
+		token, ok = strings.CutPrefix(r.Header.Get("authorization"), "Bearer ")
+	}
+	if !ok || token == "" {
+		return nil, fmt.Errorf("missing credentials")
+	}
+
+	user, err := h.DBPool.FindUserForScopedToken(token, db.TokenScopeDeploy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	if name != "" && name != user.Name {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return user, nil
+}
+
+// authHTTP finds the user for the request's token and runs the same checks
+// as an ssh session before anything is uploaded, it writes the error
+// response itself when that fails. The body is capped at the largest file
+// the user may upload.
+func (h *UploadAssetHandler) authHTTP(w http.ResponseWriter, r *http.Request, protocol string) (*futil.RequestSession, bool) {
+	user, err := h.tokenUser(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="pgs"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	s := futil.NewRequestSession(r, user)
+	logger := h.Cfg.Logger.With("session", shared.NewSessionID(), "protocol", protocol)
+	shared.SetSessionLogger(s.Context(), logger)
+	err = h.validateUser(s, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	if ff, err := futil.GetFeatureFlag(s); err == nil && ff.Data.FileMax > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, ff.Data.FileMax)
+	}
+	return s, true
+}
@@ -0,0 +1,190 @@
+package uploadassets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// ignoreFile lists paths we skip on upload, it lives at the root of a
+// project and uses rsync style patterns:
+//
+//	# editor junk
+//	.DS_Store
+//	node_modules/
+//	*.map
+//	!vendor.js.map
+//	/drafts/**
+//
+// A pattern without a slash matches a name anywhere in the project, a
+// leading slash anchors it to the root and a trailing slash only matches
+// directories. `*` stays inside a directory, `**` does not. `!` keeps
+// files an earlier pattern ignored, the last matching pattern wins.
+const ignoreFile = ".pgsignore"
+
+// maxIgnoreSize keeps the ignore file small enough to parse on every
+// connection.
+const maxIgnoreSize = 64 * 1024
+
+type ignoreRule struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+type ignoreRules []ignoreRule
+
+// parseIgnore reads the patterns of an ignore file.
+func parseIgnore(text string) (ignoreRules, error) {
+	rules := ignoreRules{}
+	for num, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		re, err := ignorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d (%s): %w", num+1, line, err)
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ignorePattern turns a glob into a regexp matched against paths relative
+// to the project, a match also covers everything below it.
+func ignorePattern(pattern string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+
+	expr := strings.Builder{}
+	for i := 0; i < len(pattern); i += 1 {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i += 1
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	prefix := "^(.*/)?"
+	if anchored {
+		prefix = "^"
+	}
+	suffix := "(/.*)?$"
+	if dirOnly {
+		suffix = "/.*$"
+	}
+	return regexp.Compile(prefix + expr.String() + suffix)
+}
+
+// ignored reports whether fpath, relative to the project, is skipped.
+func (rules ignoreRules) ignored(fpath string) bool {
+	fpath = strings.TrimPrefix(fpath, "/")
+	ignored := false
+	for _, rule := range rules {
+		if rule.re.MatchString(fpath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// isIgnoreFile is true for the ignore file at the root of a project, it is
+// never ignored itself.
+func isIgnoreFile(entry *utils.FileEntry, projectName string) bool {
+	return entry.Filepath == "/"+projectName+"/"+ignoreFile
+}
+
+type ctxIgnoreKey struct{}
+
+func ignoreCache(s ssh.Session) map[string]ignoreRules {
+	cache, ok := s.Context().Value(ctxIgnoreKey{}).(map[string]ignoreRules)
+	if !ok {
+		cache = map[string]ignoreRules{}
+		s.Context().SetValue(ctxIgnoreKey{}, cache)
+	}
+	return cache
+}
+
+// setIgnore replaces the rules of a project for the rest of the connection,
+// files sent after an ignore file follow it even before it is stored.
+func setIgnore(s ssh.Session, projectName string, rules ignoreRules) {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	defer ops.accounting.Unlock()
+	ignoreCache(s)[projectName] = rules
+}
+
+// projectIgnore returns the patterns of the stored ignore file of a project,
+// read once per connection. A missing or broken file ignores nothing.
+func (h *UploadAssetHandler) projectIgnore(s ssh.Session, bucket sst.Bucket, projectName string) ignoreRules {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	rules, ok := ignoreCache(s)[projectName]
+	ops.accounting.Unlock()
+	if ok {
+		return rules
+	}
+
+	rules = ignoreRules{}
+	contents, _, _, err := h.Storage.GetObject(bucket, path.Join(projectName, ignoreFile))
+	if err == nil {
+		text, err := io.ReadAll(io.LimitReader(contents, maxIgnoreSize))
+		_ = contents.Close()
+		if err == nil {
+			rules, err = parseIgnore(string(text))
+		}
+		if err != nil {
+			h.logger(s).Error("could not read ignore file", "project", projectName, "err", err.Error())
+			rules = ignoreRules{}
+		}
+	}
+
+	ops.accounting.Lock()
+	defer ops.accounting.Unlock()
+	cache := ignoreCache(s)
+	if cur, ok := cache[projectName]; ok {
+		return cur
+	}
+	cache[projectName] = rules
+	return rules
+}
@@ -0,0 +1,110 @@
+package uploadassets
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := parseIgnore(strings.Join([]string{
+		"# editor junk",
+		".DS_Store",
+		"node_modules/",
+		"*.map",
+		"!vendor.js.map",
+		"/drafts/**",
+		"docs/*.tmp",
+		"[._]swp",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := map[string]bool{
+		"index.html":                 false,
+		".DS_Store":                  true,
+		"css/.DS_Store":              true,
+		"node_modules/pkg/index.js":  true,
+		"lib/node_modules/index.js":  true,
+		"node_modules":               false,
+		"js/main.js.map":             true,
+		"js/vendor.js.map":           false,
+		"drafts/post.html":           true,
+		"blog/drafts/post.html":      false,
+		"docs/a.tmp":                 true,
+		"docs/nested/a.tmp":          false,
+		".swp":                       true,
+		"css/main.css":               false,
+		"node_modules.html":          false,
+		"js/main.js.mapping.html":    false,
+		"drafts.html":                false,
+		"css/.DS_Store/nope/x.html":  true,
+		"/js/main.js.map":            true,
+		"images/node_modules/a.png":  true,
+		"images/not_node_modules/a":  false,
+		"docs/a.tmp/inside/file.txt": true,
+	}
+	for fpath, expected := range fixtures {
+		if rules.ignored(fpath) != expected {
+			t.Errorf("expected (%s) ignored to be (%t)", fpath, expected)
+		}
+	}
+
+	if _, err := parseIgnore("ok\n[abc"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the broken line to be reported, got %v", err)
+	}
+}
+
+func TestWriteIgnored(t *testing.T) {
+	handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{})
+	s.command = []string{"scp", "-v", "-t", "test"}
+
+	UploadReportMiddleware(handler)(func(s ssh.Session) {
+		// the ignore file applies to the files sent after it
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: "/test/.pgsignore", Reader: strings.NewReader(".DS_Store\n*.map\n")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fpath := range []string{"/test/index.html", "/test/.DS_Store", "/test/js/main.js.map"} {
+			_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: bytes.NewReader([]byte("<h1>hi</h1>"))})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})(s)
+
+	for fpath, stored := range map[string]bool{"/test/.pgsignore": true, "/test/index.html": true, "/test/.DS_Store": false, "/test/js/main.js.map": false} {
+		if _, err := st.GetObjectSize(bucket, fpath); (err == nil) != stored {
+			t.Errorf("expected (%s) stored to be (%t)", fpath, stored)
+		}
+	}
+	if out := s.stderr.String(); !strings.Contains(out, "skipped /test/.DS_Store (ignored)") {
+		t.Errorf("expected the ignored file to be reported, got %q", out)
+	}
+
+	// the next connection reads the stored ignore file
+	next := newFakeSession()
+	futil.SetUser(next, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(next, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	next.Context().SetValue(ctxBucketKey{}, bucket)
+	next.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+	_, err := handler.Write(next, &utils.FileEntry{Filepath: "/test/css/.DS_Store", Reader: strings.NewReader("junk")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetObjectSize(bucket, "/test/css/.DS_Store"); err == nil {
+		t.Error("expected the stored ignore file to apply to later connections")
+	}
+
+	_, err = handler.Write(next, &utils.FileEntry{Filepath: "/test/.pgsignore", Reader: strings.NewReader("[oops")})
+	if err == nil || !strings.Contains(err.Error(), "invalid .pgsignore file") {
+		t.Errorf("expected a broken ignore file to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package uploadassets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+// importOverhead is how much larger than the storage quota an archive may
+// be, for the posts, projects.json and tar headers it holds next to the
+// assets.
+var importOverhead = 64 * int64(shared.MB)
+
+var errArchiveTooLarge = errors.New("archive is larger than your storage quota allows")
+
+// cappedReader fails once more than n bytes were read instead of cutting
+// the stream short like io.LimitReader, a truncated archive would only
+// fail later with a confusing error.
+type cappedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > c.n+1 {
+		p = p[:c.n+1]
+	}
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	if c.n < 0 {
+		return n, errArchiveTooLarge
+	}
+	return n, err
+}
+
+// PostWriter stores a post the way an upload to its service does, so
+// imported posts are parsed and checked like any other.
+type PostWriter interface {
+	Write(s ssh.Session, entry *utils.FileEntry) (string, error)
+}
+
+// importPlan is what a first pass over the archive found, nothing is
+// applied until the whole archive was read and checked.
+type importPlan struct {
+	projects  []*db.Project
+	conflicts []string
+	assets    int
+	posts     int
+	delta     int64
+}
+
+// importEntry splits an archive path into what `export` put there.
+func importEntry(name string) (kind string, rest string) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "projects.json" {
+		return "projects", ""
+	}
+	kind, rest, _ = strings.Cut(name, "/")
+	return kind, rest
+}
+
+// isInternalAsset is true for the directories we keep our own state in,
+// like staged deploys and revisions, they are not restored.
+func isInternalAsset(rest string) bool {
+	return strings.HasPrefix(rest, ".")
+}
+
+func (h *UploadAssetHandler) planImport(s ssh.Session, user *db.User, r io.Reader) (*importPlan, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read archive: %w", err)
+	}
+	defer gz.Close()
+
+	bucket, err := getBucket(s)
+	if err != nil {
+		return nil, err
+	}
+	featureFlag, err := futil.GetFeatureFlag(s)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &importPlan{}
+	seen := map[string]bool{}
+	conflict := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			plan.conflicts = append(plan.conflicts, name)
+		}
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		kind, rest := importEntry(hdr.Name)
+		switch kind {
+		case "projects":
+			err := json.NewDecoder(tr).Decode(&plan.projects)
+			if err != nil {
+				return nil, fmt.Errorf("could not read projects.json: %w", err)
+			}
+			for _, project := range plan.projects {
+				_, err := h.DBPool.FindProjectByName(user.ID, project.Name)
+				if err == nil {
+					conflict("project " + project.Name)
+				}
+			}
+		case "assets":
+			if rest == "" || isInternalAsset(rest) {
+				continue
+			}
+			projectName, _, _ := strings.Cut(rest, "/")
+			_, err := h.DBPool.FindProjectByName(user.ID, projectName)
+			if err == nil {
+				conflict("project " + projectName)
+			}
+			plan.assets += 1
+			plan.delta += hdr.Size
+			if cur, err := h.Storage.GetObjectSize(bucket, "/"+rest); err == nil {
+				plan.delta -= cur
+			}
+		case "posts":
+			space, filename, _ := strings.Cut(rest, "/")
+			if filename == "" {
+				continue
+			}
+			_, err := h.DBPool.FindPostWithFilename(filename, user.ID, space)
+			if err == nil {
+				conflict(fmt.Sprintf("post %s/%s", space, filename))
+			}
+			plan.posts += 1
+		}
+
+		// bail as soon as we know, instead of reading the rest
+		next := applyDelta(getStorageSize(s), plan.delta)
+		if plan.delta > 0 && next > featureFlag.Data.StorageMax {
+			return nil, fmt.Errorf(
+				"ERROR: quota exceeded: import would use (%d bytes) of (%d bytes)",
+				next,
+				featureFlag.Data.StorageMax,
+			)
+		}
+	}
+	return plan, nil
+}
+
+func (h *UploadAssetHandler) importProject(user *db.User, project *db.Project) error {
+	cur, err := h.DBPool.FindProjectByName(user.ID, project.Name)
+	if err != nil {
+		_, err = h.DBPool.InsertProject(user.ID, project.Name, project.ProjectDir)
+		return err
+	}
+	if cur.ProjectDir == project.ProjectDir {
+		return nil
+	}
+	return h.DBPool.LinkToProject(user.ID, cur.ID, project.ProjectDir, true)
+}
+
+// importPost hands a post to the writer of its space.
+func (h *UploadAssetHandler) importPost(s ssh.Session, space string, entry *utils.FileEntry) error {
+	writer, ok := h.PostWriters[space]
+	if !ok {
+		return fmt.Errorf("posts of (%s) cannot be imported here, upload them to %s instead", space, space)
+	}
+	_, err := writer.Write(s, entry)
+	return err
+}
+
+func (h *UploadAssetHandler) applyImport(s ssh.Session, user *db.User, plan *importPlan, r io.Reader) (int, []string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer gz.Close()
+
+	// projects first so links point where they did before
+	for _, project := range plan.projects {
+		err := h.importProject(user, project)
+		if err != nil {
+			return 0, nil, fmt.Errorf("could not restore project (%s): %w", project.Name, err)
+		}
+	}
+
+	count := 0
+	failed := []string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, failed, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		kind, rest := importEntry(hdr.Name)
+		switch kind {
+		case "assets":
+			if rest == "" || isInternalAsset(rest) {
+				continue
+			}
+			_, err = h.Write(s, &utils.FileEntry{
+				Filepath: "/" + rest,
+				Size:     hdr.Size,
+				Mtime:    hdr.ModTime.Unix(),
+				Reader:   tr,
+			})
+		case "posts":
+			space, filename, _ := strings.Cut(rest, "/")
+			if filename == "" {
+				continue
+			}
+			err = h.importPost(s, space, &utils.FileEntry{
+				Filepath: "/" + filename,
+				Size:     hdr.Size,
+				Mtime:    hdr.ModTime.Unix(),
+				Reader:   tr,
+			})
+		default:
+			continue
+		}
+		if err != nil {
+			h.logger(s).Error("could not import file", "filename", hdr.Name, "err", err.Error())
+			failed = append(failed, fmt.Sprintf("%s: %s", hdr.Name, err))
+			continue
+		}
+		count += 1
+	}
+	return count, failed, nil
+}
+
+// importArchive restores an archive made by `command export` from r.
+// Everything is read once to check the quota and look for projects and
+// posts that already exist, only then is anything written. Existing ones
+// are only overwritten with force.
+func (h *UploadAssetHandler) importArchive(s ssh.Session, r io.Reader, force bool) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	featureFlag, err := futil.GetFeatureFlag(s)
+	if err != nil {
+		return "", err
+	}
+
+	// the archive is read twice so it is kept until we are done
+	sp := newSpool(h.Cfg.MemoryBufferSize)
+	defer sp.Close()
+
+	capped := &cappedReader{r: r, n: int64(featureFlag.Data.StorageMax) + importOverhead}
+	tee := io.TeeReader(capped, sp)
+	plan, err := h.planImport(s, user, tee)
+	if err != nil {
+		return "", err
+	}
+	// keep whatever trails the tar stream so the spool holds the archive
+	_, err = io.Copy(io.Discard, tee)
+	if err != nil {
+		return "", err
+	}
+	if len(plan.conflicts) > 0 && !force {
+		return "", fmt.Errorf(
+			"these already exist, use `import --force` to overwrite them:\r\n%s",
+			strings.Join(plan.conflicts, "\r\n"),
+		)
+	}
+
+	count, failed, err := h.applyImport(s, user, plan, sp.Reader())
+	if err != nil {
+		return "", err
+	}
+
+	h.logger(s).Info(
+		"imported archive",
+		"projects", len(plan.projects),
+		"assets", plan.assets,
+		"posts", plan.posts,
+		"failed", len(failed),
+	)
+	lines := []string{fmt.Sprintf(
+		"imported (%d) files and (%d) projects, (%d) overwritten",
+		count,
+		len(plan.projects),
+		len(plan.conflicts),
+	)}
+	if len(failed) > 0 {
+		lines = append(lines, fmt.Sprintf("(%d) files failed:", len(failed)))
+		lines = append(lines, failed...)
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+// ImportMiddleware handles `command import [--force]`, it reads the
+// archive from stdin so `ssh pgs.sh command import < backup.tgz` restores
+// a backup.
+func ImportMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "import") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			args := cmd[2:]
+			force := len(args) == 1 && args[0] == "--force"
+			if len(args) > 0 && !force {
+				utils.ErrorHandler(s, fmt.Errorf("usage: import [--force] < backup.tgz"))
+				return
+			}
+
+			out, err := h.importArchive(s, s, force)
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Stderr().Write([]byte(out + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package uploadassets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/filehandlers"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type importDB struct {
+	exportDB
+	posts map[string]*db.Post
+}
+
+func (f *importDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func (f *importDB) FindPostWithFilename(filename, userID, space string) (*db.Post, error) {
+	post, ok := f.posts[space+"/"+filename]
+	if !ok {
+		return nil, db.ErrNameInvalid
+	}
+	return post, nil
+}
+
+func (f *importDB) InsertPost(post *db.Post) (*db.Post, error) {
+	post.ID = post.Space + "/" + post.Filename
+	f.posts[post.ID] = post
+	return post, nil
+}
+
+func (f *importDB) UpdatePost(post *db.Post) (*db.Post, error) {
+	cur := f.posts[post.ID]
+	cur.Text = post.Text
+	cur.Title = post.Title
+	return cur, nil
+}
+
+func (f *importDB) FindTotalSizeForUser(userID string) (int, error) {
+	return 0, nil
+}
+
+func (f *importDB) ReplaceTagsForPost(tags []string, postID string) error {
+	return nil
+}
+
+func (f *importDB) ReplaceAliasesForPost(aliases []string, postID string) error {
+	return nil
+}
+
+// titleHooks stand in for the hooks of a service, they refuse what they
+// would not accept over scp either.
+type titleHooks struct{}
+
+func (h *titleHooks) FileValidate(s ssh.Session, data *filehandlers.PostMetaData) (bool, error) {
+	if !strings.HasSuffix(data.Filename, ".md") {
+		return false, fmt.Errorf("(%s) is not markdown", data.Filename)
+	}
+	return true, nil
+}
+
+func (h *titleHooks) FileMeta(s ssh.Session, data *filehandlers.PostMetaData) error {
+	data.Title = strings.TrimPrefix(data.Text, "# ")
+	return nil
+}
+
+func newImportSession(t *testing.T, dbpool db.DB, maxSize uint64) (*UploadAssetHandler, *fakeSession, storage.StorageServe) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html", ".css"}
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", maxSize, int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+	return handler, s, st
+}
+
+func TestImportArchive(t *testing.T) {
+	handler, s, _ := newImportSession(t, &exportDB{}, uint64(shared.GB))
+	files := map[string]string{
+		"/test/index.html": "<h1>hi</h1>",
+		"/test/style.css":  "body {}",
+	}
+	for fpath, text := range files {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: strings.NewReader(text)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var archive bytes.Buffer
+	_, err := handler.export(s, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, small, _ := newImportSession(t, &importDB{posts: map[string]*db.Post{}}, 10)
+	_, err = full.importArchive(small, bytes.NewReader(archive.Bytes()), false)
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("expected import over quota to be refused, got %v", err)
+	}
+
+	dbpool := &importDB{posts: map[string]*db.Post{}}
+	restore, rs, st := newImportSession(t, dbpool, uint64(shared.GB))
+	proseCfg := &shared.ConfigSite{}
+	proseCfg.Space = "prose"
+	proseCfg.Logger = slog.Default()
+	restore.PostWriters = map[string]PostWriter{
+		"prose": filehandlers.NewScpPostHandler(dbpool, proseCfg, &titleHooks{}, st),
+	}
+	out, err := restore.importArchive(rs, bytes.NewReader(archive.Bytes()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "imported (3) files") {
+		t.Fatalf("unexpected summary %q", out)
+	}
+
+	bucket, _ := getBucket(rs)
+	for fpath, text := range files {
+		contents, _, _, err := st.GetObject(bucket, fpath)
+		if err != nil {
+			t.Fatalf("expected (%s) to be restored: %s", fpath, err)
+		}
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(contents)
+		_ = contents.Close()
+		if buf.String() != text {
+			t.Fatalf("expected (%s) to hold %q, got %q", fpath, text, buf.String())
+		}
+	}
+	post := dbpool.posts["prose/hello.md"]
+	if post == nil || post.Text != "# hello" || post.Title != "hello" {
+		t.Fatalf("expected post to be restored through the hooks, got %v", dbpool.posts)
+	}
+
+	// the project and post exist now
+	_, err = restore.importArchive(rs, bytes.NewReader(archive.Bytes()), false)
+	if err == nil || !strings.Contains(err.Error(), "project test") || !strings.Contains(err.Error(), "post prose/hello.md") {
+		t.Fatalf("expected conflicts to be reported, got %v", err)
+	}
+	_, err = restore.importArchive(rs, bytes.NewReader(archive.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a writer for their space posts are not imported
+	restore.PostWriters = nil
+	out, err = restore.importArchive(rs, bytes.NewReader(archive.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "posts of (prose) cannot be imported here") {
+		t.Fatalf("expected the post to fail, got %q", out)
+	}
+}
+
+func TestImportArchiveTooLarge(t *testing.T) {
+	defer func(prev int64) { importOverhead = prev }(importOverhead)
+	importOverhead = 0
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	_, _ = io.CopyN(gz, rand.Reader, 1024)
+	_ = gz.Close()
+
+	handler, s, _ := newImportSession(t, &importDB{posts: map[string]*db.Post{}}, 100)
+	_, err := handler.importArchive(s, &archive, false)
+	if !errors.Is(err, errArchiveTooLarge) {
+		t.Fatalf("expected an archive past the quota to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/send/send/utils"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// parseKey accepts a line from authorized_keys, the comment is dropped and
+// the key is stored the same way a session key is.
+func parseKey(text string) (string, error) {
+	pk, _, _, _, err := gossh.ParseAuthorizedKey([]byte(text))
+	if err != nil {
+		return "", fmt.Errorf("could not parse public key: %w", err)
+	}
+	return shared.KeyForKeyText(pk)
+}
+
+func fingerprint(key string) string {
+	pk, _, _, _, err := gossh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return "unknown"
+	}
+	return gossh.FingerprintSHA256(pk)
+}
+
+func (h *UploadAssetHandler) listKeys(s ssh.Session) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	keys, err := h.DBPool.ListKeysForUser(user.ID)
+	if err != nil {
+		return "", err
+	}
+	current, _ := shared.KeyText(s)
+
+	lines := []string{}
+	for _, key := range keys {
+		created := ""
+		if key.CreatedAt != nil {
+			created = key.CreatedAt.Format("2006-01-02")
+		}
+		line := fmt.Sprintf("%s\t%s\t%s", key.ID, fingerprint(key.Key), created)
+		if key.Key == current {
+			line += "\t(current)"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+func (h *UploadAssetHandler) addKey(s ssh.Session, text string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	key, err := parseKey(text)
+	if err != nil {
+		return "", err
+	}
+	pk, err := h.DBPool.InsertPublicKey(user.ID, key)
+	if err != nil {
+		return "", err
+	}
+	h.logger(s).Info("added public key", "key", pk.ID)
+	h.audit(s, audit.ActionKeyAdd, pk.ID)
+	h.emit(s, &bus.Event{Topic: bus.KeyAdd, Key: pk.ID})
+	return fmt.Sprintf("public key (%s) added: %s", pk.ID, fingerprint(key)), nil
+}
+
+func (h *UploadAssetHandler) removeKey(s ssh.Session, id string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	err = h.DBPool.RemovePublicKey(user.ID, id)
+	if err != nil {
+		return "", err
+	}
+	h.logger(s).Info("removed public key", "key", id)
+	h.audit(s, audit.ActionKeyRemove, id)
+	return fmt.Sprintf("public key (%s) removed", id), nil
+}
+
+// KeysMiddleware handles `command keys list`, `command keys add {key}` and
+// `command keys remove {id}` so users can manage their keys without the
+// web ui. The key to add is a line from authorized_keys.
+func KeysMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "keys") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			var out string
+			var err error
+			args := cmd[2:]
+			switch {
+			case len(args) == 1 && args[0] == "list":
+				out, err = h.listKeys(s)
+			case len(args) > 1 && args[0] == "add":
+				out, err = h.addKey(s, strings.Join(args[1:], " "))
+			case len(args) == 2 && args[0] == "remove":
+				out, err = h.removeKey(s, args[1])
+			default:
+				err = fmt.Errorf("usage: keys list | keys add {key} | keys remove {id}")
+			}
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
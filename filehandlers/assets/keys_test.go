@@ -0,0 +1,113 @@
+package uploadassets
+
+import (
+	"crypto/ed25519"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/audit"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type keysDB struct {
+	fakeDB
+	keys []*db.PublicKey
+}
+
+func (f *keysDB) InsertPublicKey(userID, key string) (*db.PublicKey, error) {
+	for _, pk := range f.keys {
+		if pk.Key == key {
+			return nil, db.ErrPublicKeyExists
+		}
+	}
+	now := time.Now()
+	pk := &db.PublicKey{ID: key[len(key)-4:], UserID: userID, Key: key, CreatedAt: &now}
+	f.keys = append(f.keys, pk)
+	return pk, nil
+}
+
+func (f *keysDB) ListKeysForUser(userID string) ([]*db.PublicKey, error) {
+	return f.keys, nil
+}
+
+func newTestKey(t *testing.T) gossh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKeysCommand(t *testing.T) {
+	dbpool := &keysDB{}
+	handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{}, nil)
+	handler.Cfg.Logger = slog.Default()
+
+	current := newTestKey(t)
+	s := newFakeSession()
+	s.key = current
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	fixtures := []struct {
+		name string
+		text string
+		err  string
+	}{
+		{name: "current", text: string(gossh.MarshalAuthorizedKey(current))},
+		{name: "with comment", text: strings.TrimSpace(string(gossh.MarshalAuthorizedKey(newTestKey(t)))) + " me@laptop"},
+		{name: "duplicate", text: string(gossh.MarshalAuthorizedKey(current)), err: db.ErrPublicKeyExists.Error()},
+		{name: "garbage", text: "ssh-ed25519 nope", err: "could not parse public key"},
+	}
+	for _, fixture := range fixtures {
+		_, err := handler.addKey(s, fixture.text)
+		if fixture.err == "" && err != nil {
+			t.Fatalf("%s: unexpected error %s", fixture.name, err)
+		}
+		if fixture.err != "" && (err == nil || !strings.Contains(err.Error(), fixture.err)) {
+			t.Fatalf("%s: expected (%s), got %v", fixture.name, fixture.err, err)
+		}
+	}
+
+	// only the keys that were added end up in the audit log
+	if len(dbpool.audit) != 2 || dbpool.audit[0].Action != audit.ActionKeyAdd || dbpool.audit[0].Actor != "test" {
+		t.Fatalf("expected two key.add audit entries, got %+v", dbpool.audit)
+	}
+
+	// keys are stored without their comment like session keys are
+	for _, pk := range dbpool.keys {
+		if strings.Count(pk.Key, " ") != 1 {
+			t.Fatalf("expected normalized key, got %q", pk.Key)
+		}
+	}
+
+	out, err := handler.listKeys(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out, "\r\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "(current)") || strings.HasSuffix(lines[1], "(current)") {
+		t.Fatalf("expected two keys with the session key marked, got %q", out)
+	}
+	if !strings.Contains(lines[1], gossh.FingerprintSHA256(current)[:7]) {
+		t.Fatalf("expected fingerprints in listing, got %q", out)
+	}
+
+	// keys inserted before created_at was recorded have none
+	dbpool.keys[0].CreatedAt = nil
+	out, err = handler.listKeys(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Split(out, "\r\n")) != 2 {
+		t.Fatalf("expected a key without a creation date to be listed, got %q", out)
+	}
+}
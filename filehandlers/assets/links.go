@@ -0,0 +1,99 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/picosh/pico/shared/storage"
+	"golang.org/x/net/html"
+)
+
+// isHostAllowed matches a host against the allowlist, entries starting
+// with a "." also match any subdomain.
+func isHostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, ".") {
+			if host == entry[1:] || strings.HasSuffix(host, entry) {
+				return true
+			}
+			continue
+		}
+		if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// findDisallowedLink scans the `src` and `href` attributes of an html
+// document and returns the first url pointing to a host outside of the
+// allowlist. Relative urls and non-http schemes are ignored. The document
+// is tokenized as it is read so large files are never held in memory.
+func findDisallowedLink(r io.Reader, allowed []string) string {
+	tokenizer := html.NewTokenizer(r)
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return ""
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		for {
+			key, val, more := tokenizer.TagAttr()
+			attr := string(key)
+			if attr == "src" || attr == "href" {
+				link := strings.TrimSpace(string(val))
+				u, err := url.Parse(link)
+				if err == nil && u.Host != "" && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https") {
+					if !isHostAllowed(u.Hostname(), allowed) {
+						return link
+					}
+				}
+			}
+			if !more {
+				break
+			}
+		}
+	}
+}
+
+func (h *UploadAssetHandler) validateLinks(data *FileData) error {
+	if len(h.Cfg.AllowedHosts) == 0 {
+		return nil
+	}
+
+	if !strings.HasPrefix(storage.GetMimeType(data.Filepath), "text/html") {
+		return nil
+	}
+
+	var r io.Reader
+	switch {
+	case data.Text != nil:
+		r = bytes.NewReader(data.Text)
+	case data.Contents != nil:
+		r = io.NewSectionReader(data.Contents, 0, data.Size)
+	default:
+		return nil
+	}
+
+	allowed := append([]string{h.Cfg.Domain, "." + h.Cfg.Domain}, h.Cfg.AllowedHosts...)
+	link := findDisallowedLink(r, allowed)
+	if link != "" {
+		return fmt.Errorf(
+			"ERROR: (%s) references (%s) which is not an allowed host",
+			data.Filepath,
+			link,
+		)
+	}
+	return nil
+}
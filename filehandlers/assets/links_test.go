@@ -0,0 +1,63 @@
+package uploadassets
+
+import (
+	"strings"
+	"testing"
+)
+
+type LinkFixture struct {
+	name    string
+	input   string
+	allowed []string
+	expect  string
+}
+
+func TestFindDisallowedLink(t *testing.T) {
+	fixtures := []LinkFixture{
+		{
+			name:    "relative",
+			input:   `<a href="/about">about</a><img src="img/cat.png" />`,
+			allowed: []string{},
+			expect:  "",
+		},
+		{
+			name:    "allowed-host",
+			input:   `<script src="https://cdn.example.com/app.js"></script>`,
+			allowed: []string{"cdn.example.com"},
+			expect:  "",
+		},
+		{
+			name:    "allowed-subdomain",
+			input:   `<link href="https://fonts.example.com/font.css" rel="stylesheet">`,
+			allowed: []string{".example.com"},
+			expect:  "",
+		},
+		{
+			name:    "disallowed-host",
+			input:   `<a href="/ok">ok</a><img src="https://evil.com/track.gif">`,
+			allowed: []string{"example.com"},
+			expect:  "https://evil.com/track.gif",
+		},
+		{
+			name:    "protocol-relative",
+			input:   `<script src="//evil.com/app.js"></script>`,
+			allowed: []string{"example.com"},
+			expect:  "//evil.com/app.js",
+		},
+		{
+			name:    "ignore-mailto",
+			input:   `<a href="mailto:hello@evil.com">email</a>`,
+			allowed: []string{"example.com"},
+			expect:  "",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			results := findDisallowedLink(strings.NewReader(fixture.input), fixture.allowed)
+			if results != fixture.expect {
+				t.Fatalf("expected %q, got %q", fixture.expect, results)
+			}
+		})
+	}
+}
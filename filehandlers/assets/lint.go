@@ -0,0 +1,172 @@
+package uploadassets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared/linkcheck"
+	"github.com/picosh/pico/shared/redirects"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxLintKey struct{}
+
+// lintReportPath is where the last link check of a project is kept.
+func lintReportPath(projectName string) string {
+	return path.Join(linkcheck.Dir, projectName+".json")
+}
+
+func (h *UploadAssetHandler) markLint(s ssh.Session, projectName string) {
+	markPending(s, ctxLintKey{}, projectName)
+}
+
+// checkLinks crawls the pages of projectName and records the links that
+// lead to none of its files, nil once the project is gone.
+func (h *UploadAssetHandler) checkLinks(bucket sst.Bucket, projectName string) (*linkcheck.Report, error) {
+	entries, err := storage.WalkObjects(h.Storage, bucket, projectName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		_ = h.Storage.DeleteObject(bucket, lintReportPath(projectName))
+		return nil, nil
+	}
+
+	site := &linkcheck.Site{Files: map[string]bool{}}
+	pages := []string{}
+	for _, entry := range h.userFiles(entries) {
+		rel := strings.TrimPrefix(entry.Path, projectName+"/")
+		site.Files[rel] = true
+		if path.Ext(rel) == ".html" {
+			pages = append(pages, rel)
+		}
+	}
+	if site.Files["_redirects"] {
+		text, err := h.readStaged(bucket, path.Join(projectName, "_redirects"))
+		if err == nil {
+			site.Redirects, _ = redirects.ParseRedirectText(string(text))
+		}
+	}
+
+	report := &linkcheck.Report{CheckedAt: time.Now().UTC(), Pages: len(pages), Broken: []linkcheck.Broken{}}
+	for _, page := range pages {
+		text, err := h.readStaged(bucket, path.Join(projectName, page))
+		if err != nil {
+			return nil, fmt.Errorf("could not read (%s): %w", page, err)
+		}
+		links := linkcheck.Links(text)
+		report.Links += len(links)
+		report.Broken = append(report.Broken, site.Check(page, links)...)
+	}
+
+	text, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	_, err = h.Storage.PutObject(
+		bucket,
+		lintReportPath(projectName),
+		utils.NopReaderAtCloser(bytes.NewReader(text)),
+		&utils.FileEntry{Filepath: lintReportPath(projectName), Size: int64(len(text)), Mtime: time.Now().Unix()},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// lint prints the last link check of a project.
+func (h *UploadAssetHandler) lint(s ssh.Session, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: lint {project}")
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return "", err
+	}
+	text, err := h.readStaged(bucket, lintReportPath(args[0]))
+	if err != nil {
+		return "", fmt.Errorf("project (%s) has not been checked, links are checked after every deploy", args[0])
+	}
+	report := &linkcheck.Report{}
+	err = json.Unmarshal(text, report)
+	if err != nil {
+		return "", err
+	}
+
+	out := []string{fmt.Sprintf(
+		"checked (%d) links on (%d) pages of (%s) at %s, (%d) broken",
+		report.Links,
+		report.Pages,
+		args[0],
+		report.CheckedAt.Format(time.RFC3339),
+		len(report.Broken),
+	)}
+	for _, broken := range report.Broken {
+		out = append(out, fmt.Sprintf("%s\t%s", broken.Page, broken.Link))
+	}
+	return strings.Join(out, "\r\n"), nil
+}
+
+// LintMiddleware checks the links of the projects an upload changed once
+// it is done, in the background so the session does not wait for it, and
+// handles `command lint {project}` which shows what was found.
+func LintMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if h.Cfg.CheckLinks && !h.isDryRun(s) && isUploadCmd(cmd) {
+				pending := &pendingProjects{projects: map[string]bool{}}
+				s.Context().SetValue(ctxLintKey{}, pending)
+				next(s)
+				s.Context().SetValue(ctxLintKey{}, nil)
+
+				bucket, err := getBucket(s)
+				if err != nil {
+					return
+				}
+				logger := h.logger(s)
+				go func() {
+					for _, projectName := range pending.sorted() {
+						report, err := h.checkLinks(bucket, projectName)
+						if err != nil {
+							logger.Error("could not check links", "project", projectName, "err", err.Error())
+							continue
+						}
+						if report == nil {
+							continue
+						}
+						logger.Info("checked links", "project", projectName, "broken", len(report.Broken))
+					}
+				}()
+				return
+			}
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "lint") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			out, err := h.lint(s, cmd[2:])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
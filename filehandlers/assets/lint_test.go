@@ -0,0 +1,78 @@
+package uploadassets
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestLint(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbpool := &signingDB{fakeDB: fakeDB{projects: []string{"site"}}, keys: map[string]string{}}
+	cfg := &shared.ConfigSite{CheckLinks: true}
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(dbpool, cfg, st)
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	if _, err := handler.lint(s, []string{"site"}); err == nil || !strings.Contains(err.Error(), "has not been checked") {
+		t.Fatalf("expected no report before a deploy, got (%v)", err)
+	}
+
+	files := map[string]string{
+		"/site/index.html":      `<a href="/about">about</a><a href="/posts/hello">moved</a><img src="logo.png">`,
+		"/site/about.html":      `<a href="/">home</a><a href="/contact.html">contact</a>`,
+		"/site/blog/index.html": `<a href="post.html">post</a>`,
+		"/site/_redirects":      "/posts/*  /blog/:splat  301\n",
+	}
+	for fpath, text := range files {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: bytes.NewReader([]byte(text))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := handler.checkLinks(bucket, "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pages != 3 || report.Links != 6 || len(report.Broken) != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	out, err := handler.lint(s, []string{"site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"about.html\t/contact.html", "blog/index.html\tpost.html", "index.html\tlogo.png"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected (%s) in the report:\n%s", line, out)
+		}
+	}
+	if !strings.Contains(out, "checked (6) links on (3) pages of (site)") {
+		t.Errorf("unexpected summary:\n%s", out)
+	}
+
+	// a project that is gone drops its report
+	if report, err := handler.checkLinks(bucket, "nope"); report != nil || err != nil {
+		t.Fatalf("expected nothing to check, got %+v (%v)", report, err)
+	}
+}
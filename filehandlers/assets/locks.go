@@ -0,0 +1,122 @@
+package uploadassets
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	futil "github.com/picosh/pico/filehandlers/util"
+)
+
+// projectLocks serializes finding or creating a project across sessions so
+// two uploads to a new project cannot both try to insert it. Locks are
+// never removed, there is one small mutex per project a server has seen.
+type projectLocks struct {
+	locks sync.Map
+}
+
+func (p *projectLocks) lock(userID, projectName string) func() {
+	v, _ := p.locks.LoadOrStore(userID+"/"+projectName, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// deployLocks keep two sessions from deploying to the same project at
+// once, their files would interleave. Unlike projectLocks they are held
+// for as long as the session is connected.
+type deployLocks struct {
+	mu   sync.Mutex
+	held map[string]*deployLock
+}
+
+type deployLock struct {
+	holder string
+	since  time.Time
+	// released is closed once the session holding the lock lets go
+	released chan struct{}
+}
+
+// acquire takes the lock of key for holder, waiting up to timeout for the
+// session holding it to finish.
+func (d *deployLocks) acquire(ctx context.Context, key, holder string, timeout time.Duration) (func(), error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		d.mu.Lock()
+		if d.held == nil {
+			d.held = map[string]*deployLock{}
+		}
+		current, ok := d.held[key]
+		if !ok {
+			lock := &deployLock{holder: holder, since: time.Now(), released: make(chan struct{})}
+			d.held[key] = lock
+			d.mu.Unlock()
+			return func() {
+				d.mu.Lock()
+				delete(d.held, key)
+				d.mu.Unlock()
+				close(lock.released)
+			}, nil
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-current.released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, fmt.Errorf(
+				"deploy in progress by (%s) since %s",
+				current.holder,
+				current.since.UTC().Format(time.TimeOnly),
+			)
+		}
+	}
+}
+
+type ctxDeployLocksKey struct{}
+
+// sessionLocks are the projects a session holds the deploy lock of.
+type sessionLocks struct {
+	mu        sync.Mutex
+	byProject map[string]bool
+}
+
+// lockDeploy takes the deploy lock of projectName the first time the
+// session writes to it and holds it until the session ends, so a deploy
+// that is staged is promoted before anyone else gets to write.
+func (h *UploadAssetHandler) lockDeploy(s ssh.Session, userID, projectName string) error {
+	if h.Cfg.DeployLockTimeout <= 0 || h.isDryRun(s) {
+		return nil
+	}
+	locks, ok := s.Context().Value(ctxDeployLocksKey{}).(*sessionLocks)
+	if !ok {
+		locks = &sessionLocks{byProject: map[string]bool{}}
+		s.Context().SetValue(ctxDeployLocksKey{}, locks)
+	}
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if locks.byProject[projectName] {
+		return nil
+	}
+
+	holder := "unknown"
+	if actor := futil.GetActor(s); actor != nil {
+		holder = actor.Name
+	}
+	release, err := h.deploys.acquire(s.Context(), userID+"/"+projectName, holder, h.Cfg.DeployLockTimeout)
+	if err != nil {
+		return fmt.Errorf("ERROR: cannot write to (%s), %w", projectName, err)
+	}
+	locks.byProject[projectName] = true
+	go func() {
+		<-s.Context().Done()
+		release()
+	}()
+	return nil
+}
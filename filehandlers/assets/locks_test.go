@@ -0,0 +1,97 @@
+package uploadassets
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestDeployLocks(t *testing.T) {
+	locks := &deployLocks{}
+	release, err := locks.acquire(context.Background(), "1/blog", "alice", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = locks.acquire(context.Background(), "1/blog", "bob", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "deploy in progress by (alice)") {
+		t.Fatalf("expected the lock to be held by alice, got (%v)", err)
+	}
+	other, err := locks.acquire(context.Background(), "1/docs", "bob", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected other projects to be free: %s", err)
+	}
+	other()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = locks.acquire(context.Background(), "1/blog", "bob", time.Second)
+	if err != nil {
+		t.Fatalf("expected bob to get the lock once alice let go: %s", err)
+	}
+	release()
+}
+
+func TestWriteDeployLock(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &shared.ConfigSite{DeployLockTimeout: 20 * time.Millisecond}
+	cfg.Logger = slog.Default()
+	dbpool := &signingDB{fakeDB: fakeDB{projects: []string{"blog", "docs"}}, keys: map[string]string{}}
+	handler := NewUploadAssetHandler(dbpool, cfg, st)
+
+	session := func(name string) (*fakeSession, context.CancelFunc) {
+		s := newFakeSession()
+		ctx, cancel := context.WithCancel(context.Background())
+		s.ctx.Context = ctx
+		futil.SetUser(s, &db.User{ID: "1", Name: "team"})
+		futil.SetActor(s, &db.User{ID: name, Name: name})
+		futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+		s.Context().SetValue(ctxBucketKey{}, bucket)
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+		return s, cancel
+	}
+	write := func(s *fakeSession, fpath string) error {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: bytes.NewReader([]byte("hello"))})
+		return err
+	}
+
+	alice, done := session("alice")
+	for _, fpath := range []string{"/blog/index.html", "/blog/about.html"} {
+		if err := write(alice, fpath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bob, _ := session("bob")
+	err = write(bob, "/blog/index.html")
+	if err == nil || !strings.Contains(err.Error(), "deploy in progress by (alice)") {
+		t.Fatalf("expected bob to wait for alice, got (%v)", err)
+	}
+	if err := write(bob, "/docs/index.html"); err != nil {
+		t.Fatalf("expected other projects to be free: %s", err)
+	}
+
+	done()
+	time.Sleep(10 * time.Millisecond)
+	if err := write(bob, "/blog/index.html"); err != nil {
+		t.Fatalf("expected the lock to be released with alice's session: %s", err)
+	}
+}
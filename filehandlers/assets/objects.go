@@ -0,0 +1,167 @@
+package uploadassets
+
+import (
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// countFiles leaves out the objects we store alongside a file, sidecars
+// and previous versions are not something the user uploaded.
+func (h *UploadAssetHandler) countFiles(entries []storage.ObjectEntry) int {
+	return len(h.userFiles(entries))
+}
+
+// userFiles are the entries the user uploaded, see countFiles.
+func (h *UploadAssetHandler) userFiles(entries []storage.ObjectEntry) []storage.ObjectEntry {
+	paths := map[string]bool{}
+	for _, entry := range entries {
+		paths[entry.Path] = true
+	}
+	files := []storage.ObjectEntry{}
+	for _, entry := range entries {
+		if base, ok := storage.SidecarBase(entry.Path); ok && paths[base] {
+			continue
+		}
+		if h.Cfg.KeepVersions > 0 && storage.IsVersion(entry.Path) {
+			continue
+		}
+		files = append(files, entry)
+	}
+	return files
+}
+
+// countProject walks a project that has no count yet and records it so
+// later sessions only read the project row.
+func (h *UploadAssetHandler) countProject(user *db.User, bucket sst.Bucket, projectName string) (int, error) {
+	entries, err := storage.WalkObjects(h.Storage, bucket, projectName)
+	if err != nil {
+		return 0, err
+	}
+	count := h.countFiles(entries)
+	err = h.DBPool.SetProjectObjectCount(user.ID, projectName, &count)
+	if err != nil {
+		h.Cfg.Logger.Error("could not save object count", "project", projectName, "err", err.Error())
+	}
+	return count, nil
+}
+
+// getProjectFileCount returns the number of files in a project. The count
+// lives on the project row and is cached on the connection.
+func (h *UploadAssetHandler) getProjectFileCount(s ssh.Session, bucket sst.Bucket, projectName string) (int, error) {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	counts, ok := s.Context().Value(ctxFileCountKey{}).(map[string]int)
+	if !ok {
+		counts = map[string]int{}
+		s.Context().SetValue(ctxFileCountKey{}, counts)
+	}
+	count, ok := counts[projectName]
+	ops.accounting.Unlock()
+	if ok {
+		return count, nil
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return 0, err
+	}
+	found, err := h.DBPool.FindProjectObjectCount(user.ID, projectName)
+	if err == nil && found != nil {
+		count = *found
+	} else {
+		count, err = h.countProject(user, bucket, projectName)
+		if err != nil {
+			return 0, err
+		}
+	}
+	ops.accounting.Lock()
+	counts[projectName] = count
+	ops.accounting.Unlock()
+	return count, nil
+}
+
+// getUserFileCount returns the number of files across every project of the
+// user, projects that were never counted are walked once.
+func (h *UploadAssetHandler) getUserFileCount(s ssh.Session, bucket sst.Bucket) (int, error) {
+	if count, ok := s.Context().Value(ctxObjectCountKey{}).(int); ok {
+		return count, nil
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return 0, err
+	}
+	counts, err := h.DBPool.FindObjectCountsForUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for projectName, count := range counts {
+		if count != nil {
+			total += *count
+			continue
+		}
+		n, err := h.countProject(user, bucket, projectName)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	s.Context().SetValue(ctxObjectCountKey{}, total)
+	return total, nil
+}
+
+// adjustProjectFileCount records a file that was added to or removed from
+// a project on the connection and on the project row.
+func (h *UploadAssetHandler) adjustProjectFileCount(s ssh.Session, projectName string, delta int) {
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	if counts, ok := s.Context().Value(ctxFileCountKey{}).(map[string]int); ok {
+		if _, ok := counts[projectName]; ok {
+			counts[projectName] += delta
+		}
+	}
+	if total, ok := s.Context().Value(ctxObjectCountKey{}).(int); ok {
+		s.Context().SetValue(ctxObjectCountKey{}, max(total+delta, 0))
+	}
+	ops.accounting.Unlock()
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	err = h.DBPool.AdjustProjectObjectCount(user.ID, projectName, delta)
+	if err != nil {
+		h.logger(s).Error("could not update object count", "project", projectName, "err", err.Error())
+	}
+}
+
+// forgetFileCount drops the count of a project after many files changed at
+// once, the next upload counts it again.
+func (h *UploadAssetHandler) forgetFileCount(s ssh.Session, projectName string) {
+	if counts, ok := s.Context().Value(ctxFileCountKey{}).(map[string]int); ok {
+		delete(counts, projectName)
+	}
+	if _, ok := s.Context().Value(ctxObjectCountKey{}).(int); ok {
+		s.Context().SetValue(ctxObjectCountKey{}, nil)
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	err = h.DBPool.SetProjectObjectCount(user.ID, projectName, nil)
+	if err != nil {
+		h.logger(s).Error("could not reset object count", "project", projectName, "err", err.Error())
+	}
+}
+
+// forgetFileCounts forgets every project a list of files belongs to.
+func (h *UploadAssetHandler) forgetFileCounts(s ssh.Session, files []string) {
+	for _, projectName := range deployProjects(files) {
+		h.forgetFileCount(s, projectName)
+	}
+}
@@ -0,0 +1,144 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+)
+
+type ctxOrgMemberKey struct{}
+
+// OrgUser switches to the organization a user logged in as, `ssh
+// org@pgs.sh`, when an org has that name. Everything is then done with the
+// org's account and buckets, the membership says what the user may do.
+func OrgUser(s ssh.Session, dbpool db.DB, user *db.User) (*db.User, *db.OrgMember, error) {
+	if s.User() == "" || strings.EqualFold(s.User(), user.Name) {
+		return user, nil, nil
+	}
+	org, err := dbpool.FindOrgForName(s.User())
+	if err != nil {
+		// not an org, the login name is ignored like it always was
+		return user, nil, nil
+	}
+	member, err := dbpool.FindOrgMember(org.ID, user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("(%s): %w", org.Name, err)
+	}
+	if org.IsSuspended() {
+		return nil, nil, db.ErrUserSuspended
+	}
+	s.Context().SetValue(ctxOrgMemberKey{}, member)
+	futil.SetActor(s, user)
+	return org, member, nil
+}
+
+func getOrgMember(s ssh.Session) *db.OrgMember {
+	member, _ := s.Context().Value(ctxOrgMemberKey{}).(*db.OrgMember)
+	return member
+}
+
+// roleRank orders the org roles, each role may do what the ones below it
+// may do.
+var roleRank = map[string]int{
+	db.RoleViewer:   0,
+	db.RoleDeployer: 1,
+	db.RoleOwner:    2,
+}
+
+type commandRule struct {
+	role string
+	// write commands are refused for read-only accounts too
+	write bool
+}
+
+// commandRules is the least role an org member needs to run a `command`,
+// keyed by the command and, where it matters, its first argument.
+// Commands that are missing need an owner so a new command stays closed
+// to members until it is added here.
+var commandRules = map[string]commandRule{
+	"whoami":           {role: db.RoleViewer},
+	"doctor":           {role: db.RoleViewer},
+	"logs":             {role: db.RoleViewer},
+	"lint":             {role: db.RoleViewer},
+	"cat":              {role: db.RoleViewer},
+	"export":           {role: db.RoleViewer},
+	"revisions":        {role: db.RoleViewer},
+	"trash ls":         {role: db.RoleViewer},
+	"domain ls":        {role: db.RoleViewer},
+	"webhook ls":       {role: db.RoleViewer},
+	"signing-key show": {role: db.RoleViewer},
+	"env ls":           {role: db.RoleDeployer},
+	"env set":          {role: db.RoleDeployer, write: true},
+	"env rm":           {role: db.RoleDeployer, write: true},
+	"link":             {role: db.RoleDeployer, write: true},
+	"unlink":           {role: db.RoleDeployer, write: true},
+	"rollback":         {role: db.RoleDeployer, write: true},
+	"restore":          {role: db.RoleDeployer, write: true},
+	"publish":          {role: db.RoleDeployer, write: true},
+	"import":           {role: db.RoleDeployer, write: true},
+	"domain add":       {role: db.RoleDeployer, write: true},
+	"domain rm":        {role: db.RoleDeployer, write: true},
+	"webhook add":      {role: db.RoleDeployer, write: true},
+	"webhook rm":       {role: db.RoleDeployer, write: true},
+	// keys and tokens log in as the org itself, read-only accounts may
+	// still manage their own
+	"keys list":    {role: db.RoleOwner},
+	"keys add":     {role: db.RoleOwner},
+	"keys remove":  {role: db.RoleOwner},
+	"token list":   {role: db.RoleOwner},
+	"token create": {role: db.RoleOwner},
+	"token revoke": {role: db.RoleOwner},
+}
+
+func findCommandRule(cmd []string) commandRule {
+	if len(cmd) > 2 {
+		if rule, ok := commandRules[cmd[1]+" "+cmd[2]]; ok {
+			return rule
+		}
+	}
+	if len(cmd) > 1 {
+		if rule, ok := commandRules[cmd[1]]; ok {
+			return rule
+		}
+	}
+	return commandRule{role: db.RoleOwner, write: true}
+}
+
+// checkCommand is called by every `command` middleware, it rejects org
+// members whose role is below what the command needs and read-only
+// accounts for commands that change something.
+func checkCommand(s ssh.Session) error {
+	cmd := s.Command()
+	rule := findCommandRule(cmd)
+	member := getOrgMember(s)
+	if member != nil && roleRank[member.Role] < roleRank[rule.role] {
+		name := strings.Join(cmd[1:min(len(cmd), 3)], " ")
+		return fmt.Errorf("ERROR: role (%s) cannot run (%s) for this organization, it needs (%s)", member.Role, name, rule.role)
+	}
+	if !rule.write {
+		return nil
+	}
+	return checkDeploy(s)
+}
+
+// checkDeploy rejects changes from org members whose role only lets them
+// look at the org's projects and from read-only accounts.
+func checkDeploy(s ssh.Session) error {
+	member := getOrgMember(s)
+	if member != nil && !member.CanDeploy() {
+		return fmt.Errorf("ERROR: role (%s) cannot change the projects of this organization", member.Role)
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return nil
+	}
+	for _, account := range []*db.User{user, futil.GetActor(s)} {
+		if account.IsReadOnly() {
+			return fmt.Errorf("ERROR: (%s): %w", account.Name, db.ErrUserReadOnly)
+		}
+	}
+	return nil
+}
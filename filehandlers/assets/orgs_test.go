@@ -0,0 +1,141 @@
+package uploadassets
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+)
+
+type orgDB struct {
+	db.DB
+	roles map[string]string
+}
+
+func (o *orgDB) FindOrgForName(name string) (*db.User, error) {
+	if name != "test" {
+		return nil, db.ErrNameInvalid
+	}
+	return &db.User{ID: "org", Name: name}, nil
+}
+
+func (o *orgDB) FindOrgMember(orgID, userID string) (*db.OrgMember, error) {
+	role, ok := o.roles[userID]
+	if !ok {
+		return nil, db.ErrNotOrgMember
+	}
+	return &db.OrgMember{OrgID: orgID, UserID: userID, Role: role}, nil
+}
+
+func TestOrgUser(t *testing.T) {
+	dbpool := &orgDB{roles: map[string]string{"deployer": db.RoleDeployer, "viewer": db.RoleViewer}}
+
+	// the fake session always logs in as `test`
+	s := newFakeSession()
+	user, member, err := OrgUser(s, dbpool, &db.User{ID: "1", Name: "test"})
+	if err != nil || member != nil || user.ID != "1" {
+		t.Fatalf("expected logging in as yourself to keep the user, found %+v %+v (%v)", user, member, err)
+	}
+
+	_, _, err = OrgUser(newFakeSession(), dbpool, &db.User{ID: "stranger", Name: "stranger"})
+	if !errors.Is(err, db.ErrNotOrgMember) {
+		t.Fatalf("expected ErrNotOrgMember, found %v", err)
+	}
+
+	s = newFakeSession()
+	user, member, err = OrgUser(s, dbpool, &db.User{ID: "deployer", Name: "deployer"})
+	if err != nil || user.ID != "org" || member.Role != db.RoleDeployer {
+		t.Fatalf("expected to act for the org, found %+v %+v (%v)", user, member, err)
+	}
+	if checkDeploy(s) != nil {
+		t.Fatal("expected a deployer to change projects")
+	}
+
+	s = newFakeSession()
+	_, _, err = OrgUser(s, dbpool, &db.User{ID: "viewer", Name: "viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkDeploy(s) == nil {
+		t.Fatal("expected a viewer not to change projects")
+	}
+}
+
+func TestCheckDeployReadOnly(t *testing.T) {
+	now := time.Now()
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	if checkDeploy(s) != nil {
+		t.Fatal("expected an active account to change projects")
+	}
+
+	futil.SetUser(s, &db.User{ID: "1", Name: "test", ReadOnlyAt: &now})
+	if err := checkDeploy(s); !errors.Is(err, db.ErrUserReadOnly) {
+		t.Fatalf("expected ErrUserReadOnly, found %v", err)
+	}
+
+	// a member of a read-only org is stopped too
+	s = newFakeSession()
+	futil.SetUser(s, &db.User{ID: "org", Name: "org", ReadOnlyAt: &now})
+	futil.SetActor(s, &db.User{ID: "1", Name: "test"})
+	if err := checkDeploy(s); !errors.Is(err, db.ErrUserReadOnly) {
+		t.Fatalf("expected ErrUserReadOnly, found %v", err)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	dbpool := &orgDB{roles: map[string]string{
+		"owner":    db.RoleOwner,
+		"deployer": db.RoleDeployer,
+		"viewer":   db.RoleViewer,
+	}}
+
+	cases := []struct {
+		userID  string
+		command []string
+		allowed bool
+	}{
+		{"viewer", []string{"command", "logs", "site"}, true},
+		{"viewer", []string{"command", "trash", "ls"}, true},
+		{"viewer", []string{"command", "keys", "add", "ssh-ed25519", "AAAA"}, false},
+		{"viewer", []string{"command", "token", "create", "ci"}, false},
+		{"viewer", []string{"command", "link", "site", "other"}, false},
+		{"viewer", []string{"command", "rollback", "site"}, false},
+		{"viewer", []string{"command", "domain", "add", "example.com", "site"}, false},
+		{"deployer", []string{"command", "link", "site", "other"}, true},
+		{"deployer", []string{"command", "keys", "list"}, false},
+		{"deployer", []string{"command", "token", "create", "ci"}, false},
+		// commands missing from the rules are for owners only
+		{"deployer", []string{"command", "something-new"}, false},
+		{"owner", []string{"command", "keys", "add", "ssh-ed25519", "AAAA"}, true},
+		{"owner", []string{"command", "token", "create", "ci"}, true},
+	}
+	for _, tc := range cases {
+		s := newFakeSession()
+		s.command = tc.command
+		user, _, err := OrgUser(s, dbpool, &db.User{ID: tc.userID, Name: tc.userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		futil.SetUser(s, user)
+		err = checkCommand(s)
+		if (err == nil) != tc.allowed {
+			t.Errorf("%s running %v: expected allowed (%v), found %v", tc.userID, tc.command, tc.allowed, err)
+		}
+	}
+
+	// not acting for an org, only read-only accounts are stopped
+	now := time.Now()
+	s := newFakeSession()
+	s.command = []string{"command", "link", "site", "other"}
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	if err := checkCommand(s); err != nil {
+		t.Fatalf("expected an account to run its own commands, found %v", err)
+	}
+	futil.SetUser(s, &db.User{ID: "1", Name: "test", ReadOnlyAt: &now})
+	if err := checkCommand(s); !errors.Is(err, db.ErrUserReadOnly) {
+		t.Fatalf("expected ErrUserReadOnly, found %v", err)
+	}
+}
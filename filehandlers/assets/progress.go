@@ -0,0 +1,93 @@
+package uploadassets
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/shared"
+)
+
+// how often a progress line is written while a file is uploading.
+var progressInterval = 2 * time.Second
+
+type progressReader struct {
+	io.Reader
+	n atomic.Int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.n.Add(int64(n))
+	return n, err
+}
+
+// showProgress decides if a session can take progress lines on stderr. We
+// never write to the data channel so scp, sftp and rsync are unaffected,
+// but commands whose output is consumed by a program (`pipe`, `ls`, ...)
+// are left alone, as are clients that say their terminal is dumb.
+func (h *UploadAssetHandler) showProgress(s ssh.Session) bool {
+	if !h.Cfg.ShowProgress {
+		return false
+	}
+	if slices.Contains(s.Environ(), "TERM=dumb") {
+		return false
+	}
+
+	if _, _, isPty := s.Pty(); isPty {
+		return true
+	}
+
+	cmd := s.Command()
+	if len(cmd) == 0 {
+		return s.Subsystem() == "sftp"
+	}
+	return cmd[0] == "scp" || cmd[0] == "rsync"
+}
+
+// trackProgress counts the bytes read from reader and reports them to the
+// client's stderr until the returned stop func is called.
+func (h *UploadAssetHandler) trackProgress(s ssh.Session, name string, reader io.Reader) (io.Reader, func()) {
+	if !h.showProgress(s) {
+		return reader, func() {}
+	}
+
+	pr := &progressReader{Reader: reader}
+	start := time.Now()
+	report := func() {
+		n := pr.n.Load()
+		rate := int64(0)
+		if secs := time.Since(start).Seconds(); secs > 0 {
+			rate = int64(float64(n) / secs)
+		}
+		out := fmt.Sprintf("%s: %s (%s/s)\r\n", name, shared.HumanSize(n), shared.HumanSize(rate))
+		_, _ = s.Stderr().Write([]byte(out))
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return pr, func() {
+		close(done)
+		wg.Wait()
+		report()
+	}
+}
@@ -0,0 +1,91 @@
+package uploadassets
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/bus"
+)
+
+type ctxPurgeKey struct{}
+
+// purgeURLs collects the urls an upload session changed so the cache is
+// purged once, after the deploy is done.
+type purgeURLs struct {
+	mu   sync.Mutex
+	urls []string
+	seen map[string]bool
+}
+
+func (p *purgeURLs) add(urls ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, u := range urls {
+		if p.seen[u] {
+			continue
+		}
+		p.seen[u] = true
+		p.urls = append(p.urls, u)
+	}
+}
+
+// assetURLs are the public urls fpath is served at, an index is also
+// served at its directory.
+func (h *UploadAssetHandler) assetURLs(username, fpath string) []string {
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean("/"+fpath), "/"), "/", 2)
+	if len(parts) < 2 {
+		return nil
+	}
+	projectName, rel := parts[0], parts[1]
+
+	urls := []string{h.Cfg.AssetURL(username, projectName, rel)}
+	if path.Base(rel) == h.Cfg.IndexFile || path.Base(rel) == "index.html" {
+		dir := strings.TrimSuffix(rel, path.Base(rel))
+		urls = append(urls, h.Cfg.AssetURL(username, projectName, dir))
+	}
+	return urls
+}
+
+// purgeAsset publishes that fpath changed so it is dropped from the cdn
+// cache, upload sessions wait until they are done, anything else
+// publishes right away.
+func (h *UploadAssetHandler) purgeAsset(s ssh.Session, fpath string) {
+	if h.isDryRun(s) || !strings.HasPrefix(fpath, "/") {
+		return
+	}
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	urls := h.assetURLs(user.Name, fpath)
+
+	if pending, ok := s.Context().Value(ctxPurgeKey{}).(*purgeURLs); ok {
+		pending.add(urls...)
+		return
+	}
+	h.emit(s, &bus.Event{Topic: bus.AssetsChange, URLs: urls})
+}
+
+// PurgeMiddleware publishes what an upload session changed for the cdn
+// cache once the whole transfer, including an atomic deploy, is done.
+func PurgeMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if !isUploadCmd(s.Command()) {
+				next(s)
+				return
+			}
+
+			pending := &purgeURLs{seen: map[string]bool{}}
+			s.Context().SetValue(ctxPurgeKey{}, pending)
+			next(s)
+			if len(pending.urls) > 0 {
+				h.emit(s, &bus.Event{Topic: bus.AssetsChange, URLs: pending.urls})
+			}
+		}
+	}
+}
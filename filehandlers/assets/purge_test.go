@@ -0,0 +1,62 @@
+package uploadassets
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/purge"
+)
+
+func TestPurgeMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	payloads := []purge.WebhookPayload{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := purge.WebhookPayload{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		payloads = append(payloads, payload)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := &shared.ConfigSite{PurgeProvider: purge.ProviderWebhook, PurgeURL: srv.URL}
+	cfg.Protocol = "https"
+	cfg.Domain = "pgs.sh"
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(&fakeDB{}, cfg, nil)
+
+	s := newFakeSession()
+	s.command = []string{"scp", "-t", "/"}
+	futil.SetUser(s, &db.User{ID: "1", Name: "erock"})
+	PurgeMiddleware(handler)(func(s ssh.Session) {
+		handler.purgeAsset(s, "/test/index.html")
+		handler.purgeAsset(s, "/test/index.html")
+		handler.purgeAsset(s, "/erock/docs/main.css")
+		if len(payloads) != 0 {
+			t.Fatal("expected purge to wait for the session")
+		}
+	})(s)
+
+	err := handler.Purger.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []purge.WebhookPayload{{URLs: []string{
+		"https://erock-test.pgs.sh/index.html",
+		"https://erock-test.pgs.sh/",
+		"https://erock.pgs.sh/docs/main.css",
+	}}}
+	if diff := cmp.Diff(expected, payloads); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,129 @@
+package uploadassets
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+type ctxWriteQueueKey struct{}
+
+// errQueued is returned by write for a file that is stored in the
+// background, the result is reported once it is.
+var errQueued = errors.New("write queued")
+
+// writeQueue stores the files of a scp or rsync session in the background,
+// at most `UploadConcurrency` at once, so reading the next file from the
+// client overlaps with storing the ones before it.
+type writeQueue struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newWriteQueue(concurrency int) *writeQueue {
+	return &writeQueue{slots: make(chan struct{}, concurrency)}
+}
+
+func getWriteQueue(s ssh.Session) *writeQueue {
+	queue, ok := s.Context().Value(ctxWriteQueueKey{}).(*writeQueue)
+	if !ok {
+		return nil
+	}
+	return queue
+}
+
+// run blocks until a slot is free, a slow store pushes back on the client
+// instead of spooling the whole session.
+func (q *writeQueue) run(fn func()) {
+	q.slots <- struct{}{}
+	q.wg.Add(1)
+	go func() {
+		defer func() {
+			<-q.slots
+			q.wg.Done()
+		}()
+		fn()
+	}()
+}
+
+// waitWrites returns once every queued write of the session is stored.
+func (h *UploadAssetHandler) waitWrites(s ssh.Session) {
+	if queue := getWriteQueue(s); queue != nil {
+		queue.wg.Wait()
+	}
+}
+
+// queueAsset checks data right away so a rejected file is still reported
+// in turn, then stores it in the background. What it takes up is reserved
+// before it is queued so the files checked while it is stored count it.
+func (h *UploadAssetHandler) queueAsset(s ssh.Session, queue *writeQueue, data *FileData, sp *spool, finish func(string, error) (string, error)) error {
+	err := h.checkAsset(data)
+	if err != nil {
+		return err
+	}
+
+	reserved := data.DeltaFileSize
+	incrementStorageSize(s, reserved)
+	if data.IsNew {
+		h.adjustProjectFileCount(s, data.ProjectName, 1)
+	}
+
+	queue.run(func() {
+		defer sp.Close()
+		msg, err := finish(h.settleAsset(s, data, reserved))
+		// Write already returned so we print what rsync and scp would have
+		if err != nil {
+			_, _ = s.Stderr().Write([]byte(err.Error() + "\r\n"))
+		}
+		if msg != "" {
+			_, _ = s.Stderr().Write([]byte(msg + "\r\n"))
+		}
+	})
+	return nil
+}
+
+// settleAsset stores a queued file and trues up what was reserved for it,
+// a failed write gives the reservation back.
+func (h *UploadAssetHandler) settleAsset(s ssh.Session, data *FileData, reserved int64) (string, error) {
+	// queued files are scanned by the queue so scans run concurrently too
+	err := h.scanAsset(s.Context(), data)
+	if err == nil {
+		err = h.storeAsset(s.Context(), data)
+	}
+	if err == nil && data.StagingPath == "" {
+		err = h.saveRules(data.User, data.ProjectName, data.FileEntry, data.Text)
+	}
+	if err != nil {
+		data.Logger.Error(err.Error())
+		incrementStorageSize(s, -reserved)
+		if data.IsNew {
+			h.adjustProjectFileCount(s, data.ProjectName, -1)
+		}
+		return "", err
+	}
+
+	// compression and sidecars change what was actually stored
+	nextStorageSize := incrementStorageSize(s, data.DeltaFileSize-reserved)
+	return h.wroteAsset(s, data, nextStorageSize, false), nil
+}
+
+// WriteQueueMiddleware lets scp and rsync uploads store up to
+// `UploadConcurrency` files at once. It waits for all of them before the
+// session moves on, e.g. to promote an atomic deploy.
+func WriteQueueMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if h.Cfg.UploadConcurrency <= 1 || !isUploadCmd(s.Command()) {
+				next(s)
+				return
+			}
+
+			s.Context().SetValue(ctxWriteQueueKey{}, newWriteQueue(h.Cfg.UploadConcurrency))
+			next(s)
+			h.waitWrites(s)
+			s.Context().SetValue(ctxWriteQueueKey{}, nil)
+		}
+	}
+}
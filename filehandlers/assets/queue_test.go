@@ -0,0 +1,124 @@
+package uploadassets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// slowStorage takes a while to store each object and fails the ones named
+// fail, it remembers how many were stored at once.
+type slowStorage struct {
+	storage.StorageServe
+	running atomic.Int64
+	most    atomic.Int64
+}
+
+func (st *slowStorage) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *storage.ObjectMeta) (string, error) {
+	running := st.running.Add(1)
+	defer st.running.Add(-1)
+	if running > st.most.Load() {
+		st.most.Store(running)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if strings.Contains(fpath, "fail") {
+		return "", fmt.Errorf("storage is down")
+	}
+	return st.StorageServe.PutObjectCtx(ctx, bucket, fpath, contents, entry, meta)
+}
+
+type lockedBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Read(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Read(p)
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+type queueSession struct {
+	*fakeSession
+	out lockedBuffer
+}
+
+func (s *queueSession) Stderr() io.ReadWriter { return &s.out }
+
+func TestWriteQueue(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := fs.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &slowStorage{StorageServe: fs}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{UploadConcurrency: 3}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	s := &queueSession{fakeSession: newFakeSession()}
+	s.command = []string{"scp", "-t", "/test"}
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", 35, int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	errs := map[string]error{}
+	WriteQueueMiddleware(handler)(func(_ ssh.Session) {
+		for _, name := range []string{"a", "fail", "b", "c"} {
+			fpath := "/test/" + name + ".html"
+			_, errs[name] = handler.Write(s, &utils.FileEntry{
+				Filepath: fpath,
+				Reader:   strings.NewReader("0123456789"),
+			})
+		}
+	})(s)
+
+	// the failed write still held its space when c was checked
+	if errs["a"] != nil || errs["fail"] != nil || errs["b"] != nil {
+		t.Fatalf("expected files to be queued, got %v", errs)
+	}
+	if errs["c"] == nil || !strings.Contains(errs["c"].Error(), "quota exceeded") {
+		t.Fatalf("expected c to exceed the quota, got %v", errs["c"])
+	}
+	if st.most.Load() < 2 {
+		t.Fatal("expected files to be stored at the same time")
+	}
+
+	for _, fpath := range []string{"/test/a.html", "/test/b.html"} {
+		if _, err := fs.GetObjectSize(bucket, fpath); err != nil {
+			t.Errorf("expected (%s) to be stored", fpath)
+		}
+	}
+	if getStorageSize(s) != 20 {
+		t.Fatalf("expected the failed write to give its space back, used (%d bytes)", getStorageSize(s))
+	}
+	if out := s.out.buf.String(); !strings.Contains(out, "storage is down") {
+		t.Fatalf("expected the failed write to be reported, got (%s)", out)
+	}
+}
@@ -0,0 +1,243 @@
+package uploadassets
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/shared/clientip"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// UploadLimiter paces how fast a user can upload. It is an interface so
+// the in-memory limiter can be swapped for a shared one when we run more
+// than one ssh server.
+type UploadLimiter interface {
+	// Wait blocks until key is allowed to send n more bytes.
+	Wait(ctx context.Context, key string, n int) error
+	// Burst is the largest chunk a single Wait should be asked for.
+	Burst() int
+}
+
+// how often idle buckets are dropped.
+var limiterSweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketLimiter gives every key `burst` bytes up front which refill
+// at `rate` bytes per second. State lives for the lifetime of the process
+// so it carries across files and sessions for the same user, buckets that
+// have refilled are dropped as a new one would be no different.
+type TokenBucketLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewTokenBucketLimiter(rate int64, burst int64) *TokenBucketLimiter {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &TokenBucketLimiter{
+		rate:    float64(rate),
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// NewRequestLimiter allows `perMinute` requests per key after an initial
+// `burst`.
+func NewRequestLimiter(perMinute int64, burst int64) *TokenBucketLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &TokenBucketLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+func (l *TokenBucketLimiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.burst)
+}
+
+// setRate retunes a running limiter, buckets keep what they earned up to
+// the new burst.
+func (l *TokenBucketLimiter) setRate(rate, burst float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.burst = burst
+	for _, bucket := range l.buckets {
+		bucket.tokens = min(bucket.tokens, burst)
+	}
+}
+
+// ReloadLimits applies reloaded rate limits to the running limiters, a
+// limit that was off when the server started stays off until a restart.
+func (h *UploadAssetHandler) ReloadLimits() {
+	if limiter, ok := h.RateLimiter.(*TokenBucketLimiter); ok && h.Cfg.UploadRateLimit > 0 {
+		next := NewTokenBucketLimiter(h.Cfg.UploadRateLimit, h.Cfg.UploadBurst)
+		limiter.setRate(next.rate, next.burst)
+	}
+	if h.RequestLimiter != nil && h.Cfg.RequestRateLimit > 0 {
+		next := NewRequestLimiter(h.Cfg.RequestRateLimit, h.Cfg.RequestBurst)
+		h.RequestLimiter.setRate(next.rate, next.burst)
+	}
+}
+
+// refill returns the bucket of key with the tokens it earned since it was
+// last used, the caller has to hold the lock.
+func (l *TokenBucketLimiter) refill(key string, now time.Time) *tokenBucket {
+	if now.Sub(l.lastSweep) >= limiterSweepInterval {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = min(l.burst, bucket.tokens+elapsed*l.rate)
+	bucket.last = now
+	return bucket
+}
+
+// sweep drops the buckets that are full again, otherwise every key ever
+// seen, like each address of a scan, would be kept forever.
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// reserve takes n tokens and returns how long the caller has to wait for
+// the bucket to pay off its debt.
+func (l *TokenBucketLimiter) reserve(key string, n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(key, now)
+	bucket.tokens -= float64(n)
+
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / l.rate * float64(time.Second))
+}
+
+// allow takes n tokens only when the bucket has them, otherwise nothing is
+// taken and it returns how long until there are enough.
+func (l *TokenBucketLimiter) allow(key string, n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(key, now)
+	if bucket.tokens >= float64(n) {
+		bucket.tokens -= float64(n)
+		return 0
+	}
+	return time.Duration((float64(n) - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *TokenBucketLimiter) Wait(ctx context.Context, key string, n int) error {
+	wait := l.reserve(key, n, time.Now())
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledReader slows reads down instead of failing them so clients
+// like rsync keep going, just slower.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter UploadLimiter
+	key     string
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, limiter UploadLimiter, key string) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter, key: key}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := t.limiter.Burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := t.r.Read(p)
+	if n > 0 {
+		waitErr := t.limiter.Wait(t.ctx, t.key, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type ctxRateCheckedKey struct{}
+
+// rateKeys are the limits a session counts against: its public key and
+// the network it connects from, so rotating keys doesn't get around the
+// limit.
+func rateKeys(s ssh.Session) []string {
+	keys := []string{}
+	if s.PublicKey() != nil {
+		keys = append(keys, gossh.FingerprintSHA256(s.PublicKey()))
+	}
+	if source := clientip.Key(clientip.FromAddr(s.RemoteAddr())); source != "" {
+		keys = append(keys, "ip:"+source)
+	}
+	return keys
+}
+
+// CheckRateLimit counts the session against the limit of its public key
+// and its source address, so a client can't flood the storage backend or
+// the database by opening sessions in a loop. A session is only counted
+// once no matter how many middlewares ask.
+func (h *UploadAssetHandler) CheckRateLimit(s ssh.Session) error {
+	if h.RequestLimiter == nil {
+		return nil
+	}
+	if checked, _ := s.Context().Value(ctxRateCheckedKey{}).(bool); checked {
+		return nil
+	}
+	s.Context().SetValue(ctxRateCheckedKey{}, true)
+
+	now := time.Now()
+	for _, key := range rateKeys(s) {
+		wait := h.RequestLimiter.allow(key, 1, now)
+		if wait == 0 {
+			continue
+		}
+		h.logger(s).Info("rate limited", "key", key, "remote", s.RemoteAddr(), "retryAfter", wait)
+		return fmt.Errorf("rate limit exceeded, try again in %ds", int(math.Ceil(wait.Seconds())))
+	}
+	return nil
+}
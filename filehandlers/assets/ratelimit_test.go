@@ -0,0 +1,204 @@
+package uploadassets
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(100, 200)
+	now := time.Now()
+
+	if wait := limiter.reserve("1", 200, now); wait != 0 {
+		t.Fatalf("expected burst to be free, waited %s", wait)
+	}
+	if wait := limiter.reserve("1", 50, now); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, waited %s", wait)
+	}
+	// other users have their own bucket
+	if wait := limiter.reserve("2", 100, now); wait != 0 {
+		t.Fatalf("expected separate bucket per user, waited %s", wait)
+	}
+	// refill pays the debt back and then some
+	if wait := limiter.reserve("1", 50, now.Add(time.Second)); wait != 0 {
+		t.Fatalf("expected refilled bucket, waited %s", wait)
+	}
+}
+
+func TestRequestLimiter(t *testing.T) {
+	limiter := NewRequestLimiter(60, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if wait := limiter.allow("1", 1, now); wait != 0 {
+			t.Fatalf("expected burst to be allowed, waited %s", wait)
+		}
+	}
+	if wait := limiter.allow("1", 1, now); wait != time.Second {
+		t.Fatalf("expected to be told to wait 1s, got %s", wait)
+	}
+	// a refused request takes nothing so it is allowed once refilled
+	if wait := limiter.allow("1", 1, now.Add(time.Second)); wait != 0 {
+		t.Fatalf("expected refilled bucket, waited %s", wait)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	limiter := NewRequestLimiter(60, 2)
+	now := time.Now()
+
+	limiter.allow("idle", 2, now)
+	// by the next sweep idle has refilled and is no different from a new
+	// bucket, while the one in use still owes tokens
+	limiter.allow("busy", 2, now.Add(limiterSweepInterval))
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("expected the refilled bucket to be dropped")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("expected the bucket in use to be kept")
+	}
+}
+
+func TestReloadLimits(t *testing.T) {
+	cfg := &shared.ConfigSite{UploadRateLimit: 100, RequestRateLimit: 60, RequestBurst: 2}
+	handler := &UploadAssetHandler{
+		Cfg:            cfg,
+		RateLimiter:    NewTokenBucketLimiter(cfg.UploadRateLimit, cfg.UploadBurst),
+		RequestLimiter: NewRequestLimiter(cfg.RequestRateLimit, cfg.RequestBurst),
+	}
+	now := time.Now()
+	handler.RequestLimiter.allow("1", 1, now)
+
+	cfg.Reload(&shared.ConfigSite{UploadRateLimit: 1000, RequestRateLimit: 120, RequestBurst: 1})
+	handler.ReloadLimits()
+
+	if handler.RateLimiter.Burst() != 1000 {
+		t.Errorf("expected the upload burst to follow the new rate, got (%d)", handler.RateLimiter.Burst())
+	}
+	if wait := handler.RequestLimiter.allow("1", 1, now); wait != 0 {
+		t.Fatalf("expected the bucket to keep what it had, waited %s", wait)
+	}
+	if wait := handler.RequestLimiter.allow("1", 1, now); wait != 500*time.Millisecond {
+		t.Fatalf("expected the new rate to apply, waited %s", wait)
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{RequestRateLimit: 1}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newFakeSession()
+	s.key = key
+	// the command middlewares and Validate both check the same session
+	for i := 0; i < 2; i++ {
+		err = handler.Validate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := newFakeSession()
+	next.key = key
+	err = handler.Validate(next)
+	if err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Fatalf("expected second session to be limited, got %v", err)
+	}
+}
+
+func TestCheckRateLimitSource(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{RequestRateLimit: 1}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	session := func(addr string) *fakeSession {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := gossh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newFakeSession()
+		s.key = key
+		s.remote = net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))
+		return s
+	}
+
+	err = handler.CheckRateLimit(session("[2001:db8::1]:2222"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a fresh key from the same /64 still counts against the network
+	err = handler.CheckRateLimit(session("[2001:db8::2]:2222"))
+	if err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Fatalf("expected the network to be limited, got %v", err)
+	}
+	err = handler.CheckRateLimit(session("[2001:db8:0:1::1]:2222"))
+	if err != nil {
+		t.Fatalf("expected another network to have its own limit, got %v", err)
+	}
+}
+
+type recordingLimiter struct {
+	chunks []int
+}
+
+func (r *recordingLimiter) Wait(ctx context.Context, key string, n int) error {
+	r.chunks = append(r.chunks, n)
+	return nil
+}
+
+func (r *recordingLimiter) Burst() int { return 4 }
+
+func TestThrottledReader(t *testing.T) {
+	limiter := &recordingLimiter{}
+	reader := newThrottledReader(context.Background(), bytes.NewReader([]byte("0123456789")), limiter, "1")
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789" {
+		t.Fatalf("unexpected data %q", data)
+	}
+
+	total := 0
+	for _, chunk := range limiter.chunks {
+		if chunk > 4 {
+			t.Fatalf("expected reads no larger than burst, got %v", limiter.chunks)
+		}
+		total += chunk
+	}
+	if total != 10 {
+		t.Fatalf("expected every byte to be paced, got %v", limiter.chunks)
+	}
+}
@@ -0,0 +1,168 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+)
+
+type ctxReportKey struct{}
+
+type reportLevel int
+
+const (
+	reportQuiet reportLevel = iota
+	reportSummary
+	reportVerbose
+)
+
+// uploadReport tallies the files of a scp or rsync session so they can be
+// summed up once it is done.
+type uploadReport struct {
+	mu          sync.Mutex
+	level       reportLevel
+	files       int
+	overwritten int
+	skipped     int
+	failed      int
+	size        int64
+}
+
+func getReport(s ssh.Session) *uploadReport {
+	report, ok := s.Context().Value(ctxReportKey{}).(*uploadReport)
+	if !ok {
+		return nil
+	}
+	return report
+}
+
+// parseReportLevel looks for `-v` and `-q` in the command the client sent.
+// scp forwards them as they are, rsync folds `-v` into its server flags
+// (`-vlogDtpre.iLsfxC`).
+func parseReportLevel(cmd []string) reportLevel {
+	level := reportSummary
+	for _, arg := range cmd[1:] {
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			return reportQuiet
+		case arg == "-v" || arg == "--verbose":
+			level = reportVerbose
+		case cmd[0] == "rsync" && strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+			flags := strings.Split(arg, ".")[0]
+			if strings.Contains(flags, "v") {
+				level = reportVerbose
+			}
+		}
+	}
+	return level
+}
+
+func (r *uploadReport) line(s ssh.Session, out string) {
+	if r.level < reportVerbose {
+		return
+	}
+	_, _ = s.Stderr().Write([]byte(out + "\r\n"))
+}
+
+func (h *UploadAssetHandler) reportWrite(s ssh.Session, fpath string, size int64, url string, isNew bool) {
+	report := getReport(s)
+	if report == nil {
+		return
+	}
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	status := "uploaded"
+	report.files += 1
+	report.size += size
+	if !isNew {
+		status = "overwrote"
+		report.overwritten += 1
+	}
+	report.line(s, fmt.Sprintf("%s %s (%s) %s", status, fpath, shared.HumanSize(size), url))
+}
+
+func (h *UploadAssetHandler) reportSkip(s ssh.Session, fpath string, reason string) {
+	report := getReport(s)
+	if report == nil {
+		return
+	}
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.skipped += 1
+	report.line(s, fmt.Sprintf("skipped %s (%s)", fpath, reason))
+}
+
+func (h *UploadAssetHandler) reportError(s ssh.Session, fpath string, err error) {
+	report := getReport(s)
+	if report == nil {
+		return
+	}
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.failed += 1
+	report.line(s, fmt.Sprintf("failed %s: %s", fpath, err))
+}
+
+func (h *UploadAssetHandler) summary(s ssh.Session, report *uploadReport) string {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	out := fmt.Sprintf(
+		"uploaded (%d) files (%s), (%d) overwritten, (%d) skipped, (%d) failed",
+		report.files,
+		shared.HumanSize(report.size),
+		report.overwritten,
+		report.skipped,
+		report.failed,
+	)
+
+	featureFlag, err := futil.GetFeatureFlag(s)
+	if err != nil {
+		return out
+	}
+	used := getStorageSize(s)
+	storageMax := featureFlag.Data.StorageMax
+	remaining := uint64(0)
+	if storageMax > used {
+		remaining = storageMax - used
+	}
+	return out + fmt.Sprintf(
+		", space: %s of %s used (%s remaining)",
+		shared.HumanSize(int64(used)),
+		shared.HumanSize(int64(storageMax)),
+		shared.HumanSize(int64(remaining)),
+	)
+}
+
+// UploadReportMiddleware writes a status line per file with `-v` and a
+// summary once a scp or rsync upload finished, `-q` silences both. It all
+// goes to stderr so the transfer itself is unaffected.
+func UploadReportMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !isUploadCmd(cmd) {
+				next(s)
+				return
+			}
+
+			report := &uploadReport{level: parseReportLevel(cmd)}
+			s.Context().SetValue(ctxReportKey{}, report)
+			next(s)
+			s.Context().SetValue(ctxReportKey{}, nil)
+
+			if report.level == reportQuiet || report.files+report.skipped+report.failed == 0 {
+				return
+			}
+			_, _ = s.Stderr().Write([]byte(h.summary(s, report) + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package uploadassets
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared/storage"
+	wishrsync "github.com/picosh/send/send/rsync"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxRsyncTrackerKey struct{}
+
+// rsyncTracker records every path the client sent or that rsync skipped
+// because it was unchanged, so we know what still belongs in storage.
+type rsyncTracker struct {
+	mu     sync.Mutex
+	seen   map[string]bool
+	failed bool
+}
+
+func (t *rsyncTracker) record(fpath string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.failed = true
+		return
+	}
+	t.seen[strings.TrimPrefix(fpath, "/")] = true
+}
+
+func getRsyncTracker(s ssh.Session) *rsyncTracker {
+	tracker, ok := s.Context().Value(ctxRsyncTrackerKey{}).(*rsyncTracker)
+	if !ok {
+		return nil
+	}
+	return tracker
+}
+
+func isRsyncDelete(cmd []string) bool {
+	if len(cmd) == 0 || cmd[0] != "rsync" {
+		return false
+	}
+
+	isDelete := false
+	for _, arg := range cmd {
+		// we only delete when receiving files
+		if arg == "--sender" {
+			return false
+		}
+		if strings.HasPrefix(arg, "--delete") {
+			isDelete = true
+		}
+	}
+	return isDelete
+}
+
+// RsyncMiddleware wraps the rsync middleware to support `--delete`. Once a
+// transfer finishes cleanly, any stored object under the destination that
+// the client did not send is removed.
+func RsyncMiddleware(h *UploadAssetHandler) wish.Middleware {
+	mdw := wishrsync.Middleware(h)
+	return func(next ssh.Handler) ssh.Handler {
+		rsyncHandler := mdw(next)
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !isRsyncDelete(cmd) {
+				rsyncHandler(s)
+				return
+			}
+
+			tracker := &rsyncTracker{seen: map[string]bool{}}
+			s.Context().SetValue(ctxRsyncTrackerKey{}, tracker)
+			rsyncHandler(s)
+			// queued files are only recorded once they are stored
+			h.waitWrites(s)
+			s.Context().SetValue(ctxRsyncTrackerKey{}, nil)
+
+			root := strings.Trim(cmd[len(cmd)-1], "/")
+			h.rsyncDelete(s, tracker, root)
+		}
+	}
+}
+
+func (h *UploadAssetHandler) rsyncDelete(s ssh.Session, tracker *rsyncTracker, root string) {
+	logger := h.logger(s).With("root", root)
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	// never delete anything after a partial or aborted transfer
+	if tracker.failed || len(tracker.seen) == 0 || s.Context().Err() != nil {
+		logger.Info("skipping rsync delete, transfer did not complete")
+		return
+	}
+
+	// deleting from the bucket root would wipe every project
+	if root == "" || root == "." {
+		logger.Info("skipping rsync delete, no project provided")
+		return
+	}
+
+	bucket, err := getBucket(s)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	entries, err := storage.WalkObjects(h.Storage, bucket, root)
+	if err != nil {
+		logger.Error("could not list objects for rsync delete", "err", err)
+		return
+	}
+
+	extraneous := []string{}
+	for _, entry := range entries {
+		if tracker.seen[entry.Path] {
+			continue
+		}
+		// previous versions are ours, the client never has them
+		if h.Cfg.KeepVersions > 0 && storage.IsVersion(entry.Path) {
+			continue
+		}
+		// so are the sidecars of files the client kept
+		if base, ok := storage.SidecarBase(entry.Path); ok && tracker.seen[base] {
+			continue
+		}
+		extraneous = append(extraneous, entry.Path)
+	}
+
+	// with an atomic deploy the new files are not in place yet, deleting
+	// has to wait until they are promoted
+	if stage := getStaging(s); stage != nil {
+		if h.Cfg.DeferPublish {
+			logger.Info("skipping rsync delete, publishing is deferred")
+			_, _ = s.Stderr().Write([]byte("rsync --delete is ignored until you publish, remove files with `command rm`\r\n"))
+			return
+		}
+		stage.mu.Lock()
+		stage.deletes = extraneous
+		stage.mu.Unlock()
+		return
+	}
+
+	h.deleteFiles(s, extraneous)
+}
+
+type ctxDeleteBatchKey struct{}
+
+// deleteBatch is what one batch of rsync deletes found and removed in
+// storage. Each file is still accounted for on its own like `rm`, without
+// a request per object.
+type deleteBatch struct {
+	infos map[string]os.FileInfo
+	errs  map[string]error
+}
+
+func getDeleteBatch(s ssh.Session) *deleteBatch {
+	batch, ok := s.Context().Value(ctxDeleteBatchKey{}).(*deleteBatch)
+	if !ok {
+		return nil
+	}
+	return batch
+}
+
+func (b *deleteBatch) size(fpath string) (int64, bool) {
+	info, ok := b.infos[strings.TrimPrefix(fpath, "/")]
+	if !ok {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// removed reports whether fpath could be removed, a path is only handed
+// out once so a sidecar the client listed next to its file is not counted
+// twice.
+func (b *deleteBatch) removed(fpath string) error {
+	fpath = strings.TrimPrefix(fpath, "/")
+	delete(b.infos, fpath)
+	return b.errs[fpath]
+}
+
+// sidecars returns the bytes freed by the sidecars of fpath.
+func (b *deleteBatch) sidecars(fpath string) int64 {
+	freed := int64(0)
+	for _, sc := range storage.Sidecars {
+		size, ok := b.size(fpath + sc.Ext)
+		if ok && b.removed(fpath+sc.Ext) == nil {
+			freed += size
+		}
+	}
+	return freed
+}
+
+// deleteFiles removes what rsync found extraneous. Without a trash the
+// files and their sidecars are looked up and removed in one batch first.
+func (h *UploadAssetHandler) deleteFiles(s ssh.Session, fpaths []string) {
+	if h.Cfg.TrashRetention <= 0 && len(fpaths) > 0 && !h.isDryRun(s) {
+		batch, err := h.removeBatch(s, fpaths)
+		if err != nil {
+			h.logger(s).Error("could not remove files in a batch", "err", err)
+		} else {
+			s.Context().SetValue(ctxDeleteBatchKey{}, batch)
+			defer s.Context().SetValue(ctxDeleteBatchKey{}, nil)
+		}
+	}
+
+	for _, fpath := range fpaths {
+		h.logger(s).Info("rsync delete removing file", "filename", fpath)
+		err := h.Delete(s, &utils.FileEntry{Filepath: "/" + fpath})
+		if err != nil {
+			h.logger(s).Error("could not delete file", "filename", fpath, "err", err)
+			_, _ = s.Stderr().Write([]byte(err.Error() + "\r\n"))
+			continue
+		}
+		_, _ = s.Stderr().Write([]byte("deleted " + fpath + "\r\n"))
+	}
+}
+
+func (h *UploadAssetHandler) removeBatch(s ssh.Session, fpaths []string) (*deleteBatch, error) {
+	bucket, err := getBucket(s)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []string{}
+	for _, fpath := range fpaths {
+		objects = append(objects, fpath)
+		if h.Cfg.PrecompressThreshold > 0 {
+			for _, sc := range storage.Sidecars {
+				objects = append(objects, fpath+sc.Ext)
+			}
+		}
+	}
+	infos, err := h.Storage.BatchStat(bucket, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]string, 0, len(infos))
+	for fpath := range infos {
+		found = append(found, fpath)
+	}
+	return &deleteBatch{infos: infos, errs: h.Storage.BatchDelete(bucket, found)}, nil
+}
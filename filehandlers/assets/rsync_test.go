@@ -0,0 +1,158 @@
+package uploadassets
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestIsRsyncDelete(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		cmd    []string
+		expect bool
+	}{
+		{
+			name:   "delete",
+			cmd:    []string{"rsync", "--server", "-vlogDtpre.iLsfxC", "--delete", ".", "/proj/"},
+			expect: true,
+		},
+		{
+			name:   "delete-after",
+			cmd:    []string{"rsync", "--server", "-vre.iLsfxC", "--delete-after", ".", "/proj/"},
+			expect: true,
+		},
+		{
+			name:   "no-delete",
+			cmd:    []string{"rsync", "--server", "-vre.iLsfxC", ".", "/proj/"},
+			expect: false,
+		},
+		{
+			name:   "sender",
+			cmd:    []string{"rsync", "--server", "--sender", "--delete", ".", "/proj/"},
+			expect: false,
+		},
+		{
+			name:   "scp",
+			cmd:    []string{"scp", "-t", "--delete", "/proj/"},
+			expect: false,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			if isRsyncDelete(fixture.cmd) != fixture.expect {
+				t.Fatalf("expected %v for %v", fixture.expect, fixture.cmd)
+			}
+		})
+	}
+}
+
+func TestRsyncDelete(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		st, err := storage.NewStorageFS(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bucket, err := st.UpsertBucket("static-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fpath := range []string{"/proj/index.html", "/proj/old.html", "/proj/index.html.v1"} {
+			_, err = st.PutObject(
+				bucket,
+				fpath,
+				utils.NopReaderAtCloser(strings.NewReader("hi")),
+				&utils.FileEntry{Filepath: fpath},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		handler := NewUploadAssetHandler(&fakeDB{projects: []string{"proj"}}, &shared.ConfigSite{KeepVersions: 1}, st)
+		handler.Cfg.Logger = slog.Default()
+
+		s := newFakeSession()
+		futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+		s.Context().SetValue(ctxBucketKey{}, bucket)
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(6))
+
+		tracker := &rsyncTracker{seen: map[string]bool{"proj/index.html": true}}
+		var stage *staging
+		if atomic {
+			stage = &staging{prefix: storage.StagingDir + "/1"}
+			s.Context().SetValue(ctxStagingKey{}, stage)
+		}
+		handler.rsyncDelete(s, tracker, "proj")
+
+		_, err = st.GetObjectSize(bucket, "/proj/old.html")
+		if atomic && err != nil {
+			t.Fatal("expected delete to wait for the staged files to be promoted")
+		}
+		if atomic {
+			s.Context().SetValue(ctxStagingKey{}, nil)
+			handler.promoteStaging(s, stage)
+			_, err = st.GetObjectSize(bucket, "/proj/old.html")
+		}
+		if err == nil {
+			t.Fatalf("expected extraneous file to be deleted (atomic %t)", atomic)
+		}
+		for _, fpath := range []string{"/proj/index.html", "/proj/index.html.v1"} {
+			if _, err := st.GetObjectSize(bucket, fpath); err != nil {
+				t.Fatalf("expected (%s) to be kept (atomic %t)", fpath, atomic)
+			}
+		}
+	}
+}
+
+func TestRsyncDeleteBatch(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fpath := range []string{"/proj/index.html", "/proj/old.css", "/proj/old.css.gz", "/proj/old.html"} {
+		_, err = st.PutObject(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(strings.NewReader("hi")),
+			&utils.FileEntry{Filepath: fpath},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := NewUploadAssetHandler(&fakeDB{projects: []string{"proj"}}, &shared.ConfigSite{PrecompressThreshold: 1024}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(8))
+
+	tracker := &rsyncTracker{seen: map[string]bool{"proj/index.html": true}}
+	handler.rsyncDelete(s, tracker, "proj")
+
+	entries, err := storage.WalkObjects(st, bucket, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "proj/index.html" {
+		t.Fatalf("expected only index.html to be left, got %v", entries)
+	}
+	// the sidecar is listed on its own too, it must only be counted once
+	if size := getStorageSize(s); size != 2 {
+		t.Fatalf("expected (2) bytes left, got (%d)", size)
+	}
+}
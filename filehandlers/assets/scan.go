@@ -0,0 +1,118 @@
+package uploadassets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/picosh/pico/shared/scan"
+	"github.com/picosh/send/send/utils"
+)
+
+// QuarantineBucket holds the files a scanner flagged and a record of every
+// detection, operators read it back with `pgs-ssh scan-report`.
+var QuarantineBucket = "quarantine"
+
+// DetectionSuffix names the record stored next to a flagged file.
+var DetectionSuffix = ".scan.json"
+
+// assetReader reads the whole upload without moving the reader
+// storeAsset streams from.
+func assetReader(data *FileData) *io.SectionReader {
+	if data.Text == nil && data.Contents != nil {
+		return io.NewSectionReader(data.Contents, 0, data.Size)
+	}
+	return io.NewSectionReader(bytes.NewReader(data.Text), 0, int64(len(data.Text)))
+}
+
+// scanAsset hands the upload to the scanner before it is stored, flagged
+// files are refused and recorded for the operators.
+func (h *UploadAssetHandler) scanAsset(ctx context.Context, data *FileData) error {
+	if h.Scanner == nil || data.Size == 0 {
+		return nil
+	}
+	if h.Cfg.ScanMaxSize > 0 && data.Size > h.Cfg.ScanMaxSize {
+		return nil
+	}
+
+	result, err := h.Scanner.Scan(ctx, assetReader(data))
+	if err != nil {
+		if h.Cfg.ScanFailOpen {
+			h.dataLogger(data).Warn("could not scan file, storing it anyway", "err", err.Error())
+			return nil
+		}
+		h.dataLogger(data).Error("could not scan file", "err", err.Error())
+		return fmt.Errorf("ERROR: (%s) could not be scanned, try again later", data.Filepath)
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	action := h.Cfg.ScanAction
+	if action != scan.ActionQuarantine {
+		action = scan.ActionReject
+	}
+	h.dataLogger(data).Warn(
+		"scanner flagged file",
+		"signature", result.Signature,
+		"action", action,
+	)
+	err = h.quarantine(data, scan.Detection{
+		User:      data.User.Name,
+		Project:   data.ProjectName,
+		Path:      data.Filepath,
+		Size:      data.Size,
+		Signature: result.Signature,
+		Action:    action,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		h.dataLogger(data).Error("could not record detection", "err", err.Error())
+	}
+
+	return fmt.Errorf("ERROR: (%s) was rejected by the malware scanner (%s)", data.Filepath, result.Signature)
+}
+
+// quarantine records the detection and, for ActionQuarantine, keeps the
+// file itself. Every detection gets its own directory so repeated uploads
+// of the same path are all kept.
+func (h *UploadAssetHandler) quarantine(data *FileData, detection scan.Detection) error {
+	bucket, err := h.Storage.UpsertBucket(QuarantineBucket)
+	if err != nil {
+		return err
+	}
+	name := path.Join(
+		detection.User,
+		strconv.FormatInt(detection.CreatedAt.UnixNano(), 10),
+		data.Filepath,
+	)
+
+	if detection.Action == scan.ActionQuarantine {
+		_, err = h.Storage.PutObject(
+			bucket,
+			name,
+			utils.NopReaderAtCloser(assetReader(data)),
+			&utils.FileEntry{Filepath: name, Size: data.Size, Mtime: detection.CreatedAt.Unix()},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	record, err := json.Marshal(detection)
+	if err != nil {
+		return err
+	}
+	_, err = h.Storage.PutObject(
+		bucket,
+		name+DetectionSuffix,
+		utils.NopReaderAtCloser(bytes.NewReader(record)),
+		&utils.FileEntry{Filepath: name + DetectionSuffix, Size: int64(len(record))},
+	)
+	return err
+}
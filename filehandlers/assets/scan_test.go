@@ -0,0 +1,106 @@
+package uploadassets
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/scan"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type fakeScanner struct {
+	err     error
+	scanned []string
+}
+
+func (f *fakeScanner) Scan(ctx context.Context, contents io.Reader) (scan.Result, error) {
+	data, _ := io.ReadAll(contents)
+	f.scanned = append(f.scanned, string(data))
+	if f.err != nil {
+		return scan.Result{}, f.err
+	}
+	if strings.Contains(string(data), "virus") {
+		return scan.Result{Infected: true, Signature: "Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+func TestScanAsset(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		action   string
+		failOpen bool
+		scanErr  error
+		text     string
+		err      string
+		// stored are the paths left in the quarantine bucket
+		stored int
+	}{
+		{name: "clean", action: scan.ActionReject, text: "hello"},
+		{name: "reject", action: scan.ActionReject, text: "a virus", err: "rejected by the malware scanner (Test-Signature)", stored: 1},
+		{name: "quarantine", action: scan.ActionQuarantine, text: "a virus", err: "rejected", stored: 2},
+		{name: "scan-error", action: scan.ActionReject, scanErr: fmt.Errorf("down"), text: "hello", err: "could not be scanned"},
+		{name: "fail-open", action: scan.ActionReject, scanErr: fmt.Errorf("down"), failOpen: true, text: "hello"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &shared.ConfigSite{ScanAction: fixture.action, ScanFailOpen: fixture.failOpen}
+			cfg.Logger = slog.Default()
+			handler := NewUploadAssetHandler(&fakeDB{}, cfg, st)
+			scanner := &fakeScanner{err: fixture.scanErr}
+			handler.Scanner = scanner
+
+			data := &FileData{
+				FileEntry:   &utils.FileEntry{Filepath: "/test/a.txt", Size: int64(len(fixture.text))},
+				Text:        []byte(fixture.text),
+				User:        &db.User{ID: "1", Name: "erock"},
+				ProjectName: "test",
+			}
+			err = handler.scanAsset(context.Background(), data)
+			if fixture.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if fixture.err != "" && (err == nil || !strings.Contains(err.Error(), fixture.err)) {
+				t.Fatalf("expected error %q, got %v", fixture.err, err)
+			}
+			if len(scanner.scanned) != 1 || scanner.scanned[0] != fixture.text {
+				t.Fatalf("expected the whole file to be scanned once, got %q", scanner.scanned)
+			}
+
+			stored := []storage.ObjectEntry{}
+			bucket, err := st.GetBucket(QuarantineBucket)
+			if err == nil {
+				stored, err = storage.WalkObjects(st, bucket, "erock")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(stored) != fixture.stored {
+				t.Fatalf("expected (%d) objects in quarantine, got (%d)", fixture.stored, len(stored))
+			}
+		})
+	}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{ScanMaxSize: 2}, nil)
+	scanner := &fakeScanner{}
+	handler.Scanner = scanner
+	err := handler.scanAsset(context.Background(), &FileData{
+		FileEntry: &utils.FileEntry{Filepath: "/test/a.txt", Size: 5},
+		Text:      []byte("virus"),
+	})
+	if err != nil || len(scanner.scanned) > 0 {
+		t.Fatal("expected files over the max size to be skipped")
+	}
+}
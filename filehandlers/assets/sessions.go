@@ -0,0 +1,89 @@
+package uploadassets
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Sessions tracks the live connections of each user on this server so an
+// operator can cut them off, e.g. after suspending a compromised account.
+type Sessions struct {
+	mu   sync.Mutex
+	next int
+	data map[string]map[int]ssh.Session
+}
+
+func NewSessions() *Sessions {
+	return &Sessions{
+		data: map[string]map[int]ssh.Session{},
+	}
+}
+
+// Add registers a session of the user, the returned func forgets it.
+func (r *Sessions) Add(userID string, s ssh.Session) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next += 1
+	id := r.next
+	if r.data[userID] == nil {
+		r.data[userID] = map[int]ssh.Session{}
+	}
+	r.data[userID][id] = s
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.data[userID], id)
+		if len(r.data[userID]) == 0 {
+			delete(r.data, userID)
+		}
+	}
+}
+
+// Count is how many sessions of the user are live.
+func (r *Sessions) Count(userID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.data[userID])
+}
+
+// Expire closes every session of the user and returns how many there were.
+func (r *Sessions) Expire(userID string) int {
+	r.mu.Lock()
+	sessions := r.data[userID]
+	delete(r.data, userID)
+	r.mu.Unlock()
+
+	for _, s := range sessions {
+		_, _ = fmt.Fprint(s.Stderr(), "session expired by an operator\r\n")
+		_ = s.Exit(1)
+		_ = s.Close()
+	}
+	return len(sessions)
+}
+
+type ctxSessionKey struct{}
+
+// trackSession registers the session once, it is forgotten when the
+// connection ends.
+func (h *UploadAssetHandler) trackSession(s ssh.Session, userID string) {
+	if h.Sessions == nil {
+		return
+	}
+	ops := getSessionOps(s)
+	ops.accounting.Lock()
+	defer ops.accounting.Unlock()
+	if s.Context().Value(ctxSessionKey{}) != nil {
+		return
+	}
+	s.Context().SetValue(ctxSessionKey{}, userID)
+
+	remove := h.Sessions.Add(userID, s)
+	go func() {
+		<-s.Context().Done()
+		remove()
+	}()
+}
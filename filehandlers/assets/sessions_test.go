@@ -0,0 +1,58 @@
+package uploadassets
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionsExpire(t *testing.T) {
+	sessions := NewSessions()
+	one := newFakeSession()
+	two := newFakeSession()
+	other := newFakeSession()
+
+	forget := sessions.Add("1", one)
+	sessions.Add("1", two)
+	sessions.Add("2", other)
+	forget()
+	if sessions.Count("1") != 1 {
+		t.Fatalf("expected 1 session, got %d", sessions.Count("1"))
+	}
+
+	if closed := sessions.Expire("1"); closed != 1 {
+		t.Errorf("expected 1 session closed, got %d", closed)
+	}
+	if !two.closed || one.closed {
+		t.Error("expected only the registered session to be closed")
+	}
+	if !strings.Contains(two.stderr.String(), "expired") {
+		t.Errorf("expected the user to be told, got %q", two.stderr.String())
+	}
+	if sessions.Count("1") != 0 || sessions.Count("2") != 1 {
+		t.Error("expected only the sessions of the user to be expired")
+	}
+}
+
+func TestTrackSession(t *testing.T) {
+	h := &UploadAssetHandler{Sessions: NewSessions()}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newFakeSession()
+	s.ctx.Context = ctx
+
+	h.trackSession(s, "1")
+	h.trackSession(s, "1")
+	if h.Sessions.Count("1") != 1 {
+		t.Fatalf("expected the session once, got %d", h.Sessions.Count("1"))
+	}
+
+	cancel()
+	for range 100 {
+		if h.Sessions.Count("1") == 0 {
+			return
+		}
+		<-time.After(time.Millisecond)
+	}
+	t.Error("expected the session to be forgotten when it ends")
+}
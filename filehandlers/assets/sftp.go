@@ -0,0 +1,542 @@
+package uploadassets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+	"github.com/pkg/sftp"
+)
+
+// SftpOption serves sftp with the full request set, not only uploads, so
+// editors can mount a bucket and edit sites in place. Projects show up as
+// the top level directories.
+func SftpOption(h *UploadAssetHandler) ssh.Option {
+	return func(server *ssh.Server) error {
+		if server.SubsystemHandlers == nil {
+			server.SubsystemHandlers = map[string]ssh.SubsystemHandler{}
+		}
+		server.SubsystemHandlers["sftp"] = SftpSubsystem(h)
+		return nil
+	}
+}
+
+func SftpSubsystem(h *UploadAssetHandler) ssh.SubsystemHandler {
+	return func(s ssh.Session) {
+		defer func() {
+			if r := recover(); r != nil {
+				h.logger(s).Error("error running sftp subsystem", "err", r)
+				_, _ = s.Stderr().Write([]byte("error running sftp subsystem\r\n"))
+			}
+		}()
+
+		err := h.Validate(s)
+		if err != nil {
+			utils.ErrorHandler(s, err)
+			return
+		}
+
+		server := sftp.NewRequestServer(s, sftpHandlers(s, h))
+		err = server.Serve()
+		if err != nil && !errors.Is(err, io.EOF) {
+			h.logger(s).Error("error serving sftp subsystem", "err", err)
+		}
+	}
+}
+
+func sftpHandlers(s ssh.Session, h *UploadAssetHandler) sftp.Handlers {
+	handler := &sftpHandler{session: s, handler: h}
+	return sftp.Handlers{
+		FileGet:  handler,
+		FilePut:  handler,
+		FileCmd:  handler,
+		FileList: handler,
+	}
+}
+
+type sftpHandler struct {
+	session ssh.Session
+	handler *UploadAssetHandler
+}
+
+type sftpLister []os.FileInfo
+
+func (l sftpLister) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// stat looks fpath up as a file first, directories only exist as prefixes
+// so they are found by listing what is in them. An unfinished upload
+// reports what was stored so far so clients know where to resume.
+func (f *sftpHandler) stat(fpath string) (os.FileInfo, error) {
+	fpath = path.Clean("/" + fpath)
+	if fpath == "/" {
+		return &utils.VirtualFile{FName: "/", FIsDir: true}, nil
+	}
+	name := path.Base(fpath)
+
+	bucket, err := getBucket(f.session)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(fpath, "/")
+	infos, err := f.handler.tracedStorage(f.session.Context()).BatchStat(bucket, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := infos[key]; ok {
+		return info, nil
+	}
+	if _, upload, err := f.pending(fpath); err == nil {
+		return &utils.VirtualFile{FName: name, FSize: upload.Size()}, nil
+	}
+
+	// a failed listing means the directory does not exist
+	files, _ := f.handler.List(f.session, fpath, true, false)
+	for _, file := range files {
+		if strings.Trim(file.Name(), "/") != "" {
+			return &utils.VirtualFile{FName: name, FIsDir: true}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		files, err := f.handler.List(f.session, r.Filepath, true, false)
+		if err != nil {
+			return nil, err
+		}
+		listing := []os.FileInfo{}
+		for _, file := range files {
+			if strings.Trim(file.Name(), "/") == "" {
+				continue
+			}
+			listing = append(listing, file)
+		}
+		return sftpLister(listing), nil
+	case "Stat", "Lstat":
+		file, err := f.stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return sftpLister{file}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// Fileread only fetches the ranges the client asks for, see `Read`.
+func (f *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	file, err := f.stat(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDir() {
+		return nil, os.ErrInvalid
+	}
+
+	_, reader, err := f.handler.Read(f.session, &utils.FileEntry{Filepath: r.Filepath})
+	return reader, err
+}
+
+// uploadKey is where a resumable sftp upload of fpath is put together.
+func uploadKey(fpath string) string {
+	return path.Join(storage.UploadsDir, path.Clean("/"+fpath))
+}
+
+// sftpWriter collects writes in a temporary file since clients may write
+// at any offset, the upload happens once the client closes the file. With
+// a chunk size every full chunk at the start of the file is also stored as
+// a part of a multipart upload as soon as it arrives, so a client whose
+// connection dropped can resume from there with `reput`.
+type sftpWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	// base is the offset the file starts at, stored is how much of the
+	// upload is kept in parts and end is the furthest write
+	base   int64
+	stored int64
+	end    int64
+	// spans are the ranges written so far, merged and sorted
+	spans  [][2]int64
+	upload *storage.MultipartUpload
+	bucket sst.Bucket
+	key    string
+	failed bool
+
+	entry   *utils.FileEntry
+	handler *sftpHandler
+}
+
+func (w *sftpWriter) mark(start, end int64) {
+	w.spans = append(w.spans, [2]int64{start, end})
+	sort.Slice(w.spans, func(i, j int) bool {
+		return w.spans[i][0] < w.spans[j][0]
+	})
+
+	merged := w.spans[:1]
+	for _, span := range w.spans[1:] {
+		last := &merged[len(merged)-1]
+		if span[0] > last[1] {
+			merged = append(merged, span)
+			continue
+		}
+		last[1] = max(last[1], span[1])
+	}
+	w.spans = merged
+}
+
+// seed copies the stored file into the temporary one, a client writing at
+// an offset only changes part of the file and keeps the rest.
+func (w *sftpWriter) seed(size int64) error {
+	_, contents, err := w.handler.handler.Read(w.handler.session, &utils.FileEntry{Filepath: w.entry.Filepath})
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	_, err = io.Copy(w.file, io.NewSectionReader(contents, 0, size))
+	if err != nil {
+		return err
+	}
+	w.end = size
+	if size > 0 {
+		w.mark(0, size)
+	}
+	return nil
+}
+
+// contiguous is how far the file was written without gaps.
+func (w *sftpWriter) contiguous() int64 {
+	if len(w.spans) == 0 || w.spans[0][0] > w.stored {
+		return w.stored
+	}
+	return w.spans[0][1]
+}
+
+// checkLimits stops a write that would make the file larger than the user
+// may upload, or keep more in parts than is left of their quota. Parts do
+// not count towards storage until the upload is completed.
+func (w *sftpWriter) checkLimits(end int64) error {
+	ff, err := futil.GetFeatureFlag(w.handler.session)
+	if err != nil {
+		return err
+	}
+	if end > ff.Data.FileMax {
+		return fmt.Errorf("ERROR: file (%s) has exceeded maximum file size (%d bytes)", path.Base(w.entry.Filepath), ff.Data.FileMax)
+	}
+	next := int64(getStorageSize(w.handler.session)) + end
+	if next > int64(ff.Data.StorageMax) {
+		return fmt.Errorf("ERROR: quota exceeded: would use (%d bytes) of (%d bytes)", next, ff.Data.StorageMax)
+	}
+	return nil
+}
+
+func (w *sftpWriter) storePart(size int64) error {
+	st := w.handler.handler.Storage
+	err := w.checkLimits(w.stored + size)
+	if err != nil {
+		return err
+	}
+	if w.upload == nil {
+		id, err := st.CreateMultipartUpload(w.bucket, w.key)
+		if err != nil {
+			return err
+		}
+		w.upload = &storage.MultipartUpload{ID: id}
+	}
+
+	part, err := st.PutObjectPart(
+		w.bucket,
+		w.key,
+		w.upload.ID,
+		w.upload.NextPart(),
+		io.NewSectionReader(w.file, w.stored-w.base, size),
+		size,
+	)
+	if err != nil {
+		return err
+	}
+	w.upload.Parts = append(w.upload.Parts, part)
+	w.stored += size
+	return nil
+}
+
+func (w *sftpWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	// a resumed client may send again what is already stored
+	if off < w.stored {
+		skip := w.stored - off
+		if skip >= int64(n) {
+			return n, nil
+		}
+		p = p[skip:]
+		off = w.stored
+	}
+
+	err := w.checkLimits(off + int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.file.WriteAt(p, off-w.base)
+	if err != nil {
+		return 0, err
+	}
+	end := off + int64(len(p))
+	w.end = max(w.end, end)
+	w.mark(off, end)
+
+	chunk := w.handler.handler.Cfg.SftpChunkSize
+	if chunk <= 0 {
+		return n, nil
+	}
+	for w.contiguous()-w.stored >= chunk {
+		err := w.storePart(chunk)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// TransferError keeps the stored parts around for the client to resume.
+func (w *sftpWriter) TransferError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failed = true
+}
+
+func (w *sftpWriter) Close() error {
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed {
+		return nil
+	}
+
+	if w.upload == nil {
+		w.entry.Reader = io.NewSectionReader(w.file, 0, w.end)
+	} else {
+		contents, err := w.complete()
+		if err != nil {
+			return err
+		}
+		defer contents.Close()
+		w.entry.Reader = contents
+	}
+
+	msg, err := w.handler.handler.Write(w.handler.session, w.entry)
+	if err != nil {
+		_, _ = w.handler.session.Stderr().Write([]byte(err.Error() + "\r\n"))
+		return err
+	}
+	if msg != "" {
+		_, _ = w.handler.session.Stderr().Write([]byte(msg + "\r\n"))
+	}
+	return nil
+}
+
+// complete stores what is left as the last part and opens the assembled
+// upload, which is removed again once it is closed.
+func (w *sftpWriter) complete() (io.ReadCloser, error) {
+	st := w.handler.handler.Storage
+	if w.end > w.stored {
+		err := w.storePart(w.end - w.stored)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := st.CompleteMultipartUpload(w.bucket, w.key, w.upload.ID, w.upload.Parts)
+	if err != nil {
+		return nil, err
+	}
+	contents, _, _, err := st.GetObject(w.bucket, w.key)
+	if err != nil {
+		_ = st.DeleteObject(w.bucket, w.key)
+		return nil, err
+	}
+	return &removeOnClose{ReadCloser: contents, remove: func() error {
+		return st.DeleteObject(w.bucket, w.key)
+	}}, nil
+}
+
+type removeOnClose struct {
+	io.ReadCloser
+	remove func() error
+}
+
+func (r *removeOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	_ = r.remove()
+	return err
+}
+
+// pending finds an unfinished upload of fpath to resume, one older than
+// storage.UploadTTL is aborted and cannot be resumed anymore.
+func (f *sftpHandler) pending(fpath string) (sst.Bucket, *storage.MultipartUpload, error) {
+	bucket, err := getBucket(f.session)
+	if err != nil {
+		return bucket, nil, err
+	}
+	if f.handler.Cfg.SftpChunkSize <= 0 {
+		return bucket, nil, os.ErrNotExist
+	}
+	upload, err := f.handler.Storage.FindMultipartUpload(bucket, uploadKey(fpath))
+	if err != nil {
+		return bucket, nil, err
+	}
+	if upload.Stale(time.Now()) {
+		err = f.handler.Storage.AbortMultipartUpload(bucket, uploadKey(fpath), upload.ID)
+		if err != nil {
+			return bucket, nil, err
+		}
+		return bucket, nil, os.ErrNotExist
+	}
+	return bucket, upload, nil
+}
+
+// Filewrite resumes an unfinished upload unless the client truncates the
+// file, which starts over. Without either the stored file is edited in
+// place.
+func (f *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	bucket, upload, err := f.pending(r.Filepath)
+	if upload == nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if upload != nil && r.Pflags().Trunc {
+		err = f.handler.Storage.AbortMultipartUpload(bucket, uploadKey(r.Filepath), upload.ID)
+		if err != nil {
+			return nil, err
+		}
+		upload = nil
+	}
+
+	file, err := os.CreateTemp("", "sftp-*")
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := r.Attributes()
+	w := &sftpWriter{
+		file:   file,
+		bucket: bucket,
+		key:    uploadKey(r.Filepath),
+		entry: &utils.FileEntry{
+			Filepath: r.Filepath,
+			Mode:     attrs.FileMode(),
+			Mtime:    int64(attrs.Mtime),
+			Atime:    int64(attrs.Atime),
+		},
+		handler: f,
+	}
+	if upload != nil {
+		w.upload = upload
+		w.base = upload.Size()
+		w.stored = w.base
+		w.end = w.base
+		return w, nil
+	}
+	if r.Pflags().Trunc {
+		return w, nil
+	}
+
+	stored, err := f.stat(r.Filepath)
+	if err == nil && !stored.IsDir() {
+		err = w.seed(stored.Size())
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return w, nil
+}
+
+// rename uploads the file again under its new name so it goes through the
+// same checks and quota accounting as any other upload.
+func (f *sftpHandler) rename(src, dst string) error {
+	file, err := f.stat(src)
+	if err != nil {
+		return err
+	}
+	if file.IsDir() {
+		return fmt.Errorf("renaming directories is not supported")
+	}
+	// a rename that only changes case is not a collision with itself
+	if clean, err := shared.SanitizePath(src); err == nil {
+		f.handler.forgetCase(f.session, shared.GetProjectName(&utils.FileEntry{Filepath: clean}), clean)
+	}
+
+	_, contents, err := f.handler.Read(f.session, &utils.FileEntry{Filepath: src})
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	_, err = f.handler.Write(f.session, &utils.FileEntry{
+		Filepath: dst,
+		Reader:   io.NewSectionReader(contents, 0, file.Size()),
+	})
+	if err != nil {
+		return err
+	}
+	return f.handler.Delete(f.session, &utils.FileEntry{Filepath: src})
+}
+
+func (f *sftpHandler) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Remove":
+		// removing an unfinished upload gives up on resuming it
+		if bucket, upload, err := f.pending(r.Filepath); err == nil {
+			err = f.handler.Storage.AbortMultipartUpload(bucket, uploadKey(r.Filepath), upload.ID)
+			if err != nil {
+				return err
+			}
+			if _, err := f.stat(r.Filepath); err != nil {
+				return nil
+			}
+		}
+		return f.handler.Delete(f.session, &utils.FileEntry{Filepath: r.Filepath})
+	case "Rename":
+		return f.rename(r.Filepath, r.Target)
+	// for symlinks Filepath is the target and Target the new link
+	case "Symlink":
+		_, err := f.handler.symlink(f.session, r.Target, r.Filepath)
+		return err
+	case "Link":
+		_, err := f.handler.hardlink(f.session, r.Filepath, r.Target)
+		return err
+	// directories come and go with the files in them
+	case "Mkdir", "Rmdir", "Setstat":
+		return nil
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
@@ -0,0 +1,353 @@
+package uploadassets
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+	"github.com/pkg/sftp"
+)
+
+type sftpConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// newSftpClient serves the sftp handlers over a pipe, drop cuts the
+// connection like a client that went away mid transfer.
+func newSftpClient(t *testing.T, s *fakeSession, handler *UploadAssetHandler) (client *sftp.Client, drop func()) {
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+	server := sftp.NewRequestServer(sftpConn{serverRead, serverWrite}, sftpHandlers(s, handler))
+	done := make(chan struct{})
+	go func() {
+		_ = server.Serve()
+		close(done)
+	}()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closing the server ends the client's reads so it can shut down
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return client, func() {
+		_ = clientWrite.Close()
+		<-done
+	}
+}
+
+func newSftpHandler(t *testing.T) (*UploadAssetHandler, *fakeSession) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUploadAssetHandler(&lockDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html", ".css"}
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+	return handler, s
+}
+
+func TestSftp(t *testing.T) {
+	handler, s := newSftpHandler(t)
+	client, _ := newSftpClient(t, s, handler)
+
+	for fpath, text := range map[string]string{"/test/index.html": "<h1>hello world</h1>", "/test/main.css": "body {}"} {
+		file, err := client.Create(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.Write([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := client.Stat("/test")
+	if err != nil || !info.IsDir() {
+		t.Fatalf("expected project to be a directory, got %v (%v)", info, err)
+	}
+	info, err = client.Stat("/test/index.html")
+	if err != nil || info.IsDir() || info.Size() != 20 {
+		t.Fatalf("expected file stat, got %v (%v)", info, err)
+	}
+
+	file, err := client.Open("/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part := make([]byte, 5)
+	_, err = file.ReadAt(part, 4)
+	_ = file.Close()
+	if err != nil || string(part) != "hello" {
+		t.Fatalf("expected partial read, got %q (%v)", part, err)
+	}
+
+	err = client.Rename("/test/index.html", "/test/home.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat("/test/index.html"); err == nil {
+		t.Fatal("expected renamed file to be gone")
+	}
+
+	err = client.Remove("/test/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := client.ReadDir("/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	if diff := cmp.Diff([]string{"home.html"}, names); diff != "" {
+		t.Error(diff)
+	}
+	if getStorageSize(s) != 20 {
+		t.Fatalf("expected quota to follow rename and remove, got %d", getStorageSize(s))
+	}
+}
+
+// listCounter counts listings so stat can be checked to not list.
+type listCounter struct {
+	storage.StorageServe
+	lists int
+}
+
+func (l *listCounter) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	l.lists += 1
+	return l.StorageServe.ListObjects(bucket, dir, recursive)
+}
+
+func TestSftpWriteAt(t *testing.T) {
+	handler, s := newSftpHandler(t)
+	st := &listCounter{StorageServe: handler.Storage}
+	handler.Storage = st
+	client, _ := newSftpClient(t, s, handler)
+
+	file, err := client.Create("/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Write([]byte("<h1>hello world</h1>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st.lists = 0
+	info, err := client.Stat("/test/index.html")
+	if err != nil || info.Size() != 20 {
+		t.Fatalf("expected file stat, got %v (%v)", info, err)
+	}
+	if st.lists != 0 {
+		t.Fatalf("expected stat of a file to not list its directory, listed %d times", st.lists)
+	}
+
+	file, err = client.OpenFile("/test/index.html", os.O_WRONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt([]byte("HELLO"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err = client.Open("/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil || string(text) != "<h1>HELLO world</h1>" {
+		t.Fatalf("expected the rest of the file to be kept, got %q (%v)", text, err)
+	}
+}
+
+func TestSftpResume(t *testing.T) {
+	handler, s := newSftpHandler(t)
+	handler.Cfg.SftpChunkSize = 4
+	bucket, _ := getBucket(s)
+
+	client, drop := newSftpClient(t, s, handler)
+	file, err := client.Create("/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Write([]byte("<h1>hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop()
+
+	if _, err := handler.Storage.GetObjectSize(bucket, "test/index.html"); err == nil {
+		t.Fatal("expected dropped upload not to be stored")
+	}
+
+	client, _ = newSftpClient(t, s, handler)
+	info, err := client.Stat("/test/index.html")
+	if err != nil || info.Size() != 8 {
+		t.Fatalf("expected the stored chunks to be reported, got %v (%v)", info, err)
+	}
+
+	file, err = client.OpenFile("/test/index.html", os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Seek(info.Size(), io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Write([]byte("o world</h1>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, contents, err := handler.Read(s, &utils.FileEntry{Filepath: "/test/index.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	text, _ := io.ReadAll(contents)
+	if string(text) != "<h1>hello world</h1>" {
+		t.Fatalf("expected resumed upload, got %q", text)
+	}
+	if _, err := handler.Storage.FindMultipartUpload(bucket, uploadKey("/test/index.html")); err == nil {
+		t.Fatal("expected upload to be finished")
+	}
+	if _, err := handler.Storage.GetObjectSize(bucket, uploadKey("/test/index.html")); err == nil {
+		t.Fatal("expected assembled upload to be removed")
+	}
+}
+
+func TestSftpLimits(t *testing.T) {
+	handler, s := newSftpHandler(t)
+	handler.Cfg.SftpChunkSize = 4
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", 100, 10))
+	bucket, _ := getBucket(s)
+
+	client, _ := newSftpClient(t, s, handler)
+	file, err := client.Create("/test/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// past the max file size, nothing is spooled or kept in parts
+	_, err = file.WriteAt([]byte("<h1>"), 1<<30)
+	if err == nil {
+		t.Fatal("expected a write past the max file size to fail")
+	}
+	_, err = file.Write([]byte("<h1>hello world</h1>"))
+	if err == nil {
+		t.Fatal("expected a file over the max file size to fail")
+	}
+	_ = file.Close()
+	if upload, err := handler.Storage.FindMultipartUpload(bucket, uploadKey("/test/index.html")); err == nil && upload.Size() > 10 {
+		t.Fatalf("expected no more than the max file size in parts, got %d", upload.Size())
+	}
+
+	// what is stored counts against the quota
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", 100, 100))
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(95))
+	file, err = client.Create("/test/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Write([]byte("body { color: red; }"))
+	if err == nil {
+		t.Fatal("expected a file over the quota to fail")
+	}
+	_ = file.Close()
+}
+
+func TestSftpLinks(t *testing.T) {
+	handler, s := newSftpHandler(t)
+	client, _ := newSftpClient(t, s, handler)
+	bucket, _ := getBucket(s)
+
+	file, err := client.Create("/test/posts/one.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Write([]byte("<h1>one</h1>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Symlink("posts/one.html", "/test/latest.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := handler.Storage.GetObjectMeta(bucket, "/test/latest.html")
+	if err != nil || meta.Symlink != "posts/one.html" {
+		t.Fatalf("expected a symlink marker, got %+v %v", meta, err)
+	}
+	for target, link := range map[string]string{"/etc/passwd": "/test/passwd.html", "../other/index.html": "/test/other.html", "../latest.html": "/test/posts/one.html"} {
+		if err := client.Symlink(target, link); err == nil {
+			t.Fatalf("expected symlink (%s) to (%s) to be refused", link, target)
+		}
+	}
+
+	// hardlinks are copies of the file at the end of the links
+	err = client.Link("/test/latest.html", "/test/copy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, contents, err := handler.Read(s, &utils.FileEntry{Filepath: "/test/copy.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	text, _ := io.ReadAll(contents)
+	if string(text) != "<h1>one</h1>" {
+		t.Fatalf("expected a copy of the linked file, got %q", text)
+	}
+	meta, err = handler.Storage.GetObjectMeta(bucket, "/test/copy.html")
+	if err != nil || meta.Symlink != "" {
+		t.Fatalf("expected a regular file, got %+v %v", meta, err)
+	}
+}
@@ -0,0 +1,309 @@
+package uploadassets
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/signing"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// manifestFile lists the sha256 of the files of a signed project, e.g.
+// made with `sha256sum`, and is signed next to it with minisign or gpg.
+const manifestFile = "_pgs_manifest"
+
+var signatureExts = []string{".minisig", ".asc", ".sig"}
+
+// isManifest is true for the manifest and its signatures.
+func isManifest(fname string) bool {
+	ext, ok := strings.CutPrefix(fname, manifestFile)
+	return ok && (ext == "" || slices.Contains(signatureExts, ext))
+}
+
+// maxSigningKeySize keeps a key read from stdin to a sane size.
+const maxSigningKeySize = 64 * 1024
+
+type ctxSignedKey struct{}
+
+// sessionKeys caches the signing key of every project an upload session
+// writes to.
+type sessionKeys struct {
+	mu        sync.Mutex
+	byProject map[string]signing.Key
+}
+
+// projectKey returns the key the deploys of projectName are verified with,
+// nil when it accepts unsigned deploys or does not exist yet.
+func (h *UploadAssetHandler) projectKey(userID, projectName string) (signing.Key, error) {
+	project, err := h.DBPool.FindProjectByName(userID, projectName)
+	if err != nil {
+		return nil, nil
+	}
+	found, err := h.DBPool.FindProjectSigningKey(project.ID)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return signing.ParseKey(found.Key)
+}
+
+func (h *UploadAssetHandler) sessionKey(s ssh.Session, userID, projectName string) (signing.Key, error) {
+	cache, ok := s.Context().Value(ctxSignedKey{}).(*sessionKeys)
+	if !ok {
+		cache = &sessionKeys{byProject: map[string]signing.Key{}}
+		s.Context().SetValue(ctxSignedKey{}, cache)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if key, ok := cache.byProject[projectName]; ok {
+		return key, nil
+	}
+	key, err := h.projectKey(userID, projectName)
+	if err != nil {
+		return nil, err
+	}
+	cache.byProject[projectName] = key
+	return key, nil
+}
+
+// checkSigned refuses writes to a signed project outside of a staged
+// deploy, those would go live before anything could be verified.
+func (h *UploadAssetHandler) checkSigned(s ssh.Session, userID, projectName string) error {
+	key, err := h.sessionKey(s, userID, projectName)
+	if err != nil {
+		return fmt.Errorf("ERROR: could not read the signing key of (%s): %w", projectName, err)
+	}
+	if key != nil && getStaging(s) == nil {
+		return fmt.Errorf("ERROR: project (%s) only accepts signed deploys with scp or rsync", projectName)
+	}
+	return nil
+}
+
+// readStaged returns the contents of fpath as they were uploaded.
+func (h *UploadAssetHandler) readStaged(bucket sst.Bucket, fpath string) ([]byte, error) {
+	contents, _, _, err := h.Storage.GetObject(bucket, fpath)
+	if err != nil {
+		return nil, err
+	}
+	if storage.IsCompressed(h.Storage, bucket, fpath) {
+		contents, _, err = storage.Decompress(contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer contents.Close()
+	return io.ReadAll(contents)
+}
+
+// verifyDeploy checks the staged files of every signed project against
+// the manifest of the project before any of them are promoted. A deploy
+// that does not bring a manifest is checked against the live one, rsync
+// only sends what changed.
+func (h *UploadAssetHandler) verifyDeploy(bucket sst.Bucket, userID, prefix string, files []string) error {
+	byProject := map[string][]string{}
+	for _, fpath := range files {
+		projectName, _, _ := strings.Cut(strings.TrimPrefix(fpath, "/"), "/")
+		byProject[projectName] = append(byProject[projectName], fpath)
+	}
+
+	for projectName, projectFiles := range byProject {
+		key, err := h.projectKey(userID, projectName)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			continue
+		}
+		err = h.verifyProject(bucket, key, prefix, projectName, projectFiles)
+		if err != nil {
+			return fmt.Errorf("project (%s): %w", projectName, err)
+		}
+	}
+	return nil
+}
+
+func (h *UploadAssetHandler) verifyProject(bucket sst.Bucket, key signing.Key, prefix, projectName string, files []string) error {
+	// paths relative to the project mapped to where they are staged
+	staged := map[string]string{}
+	for _, fpath := range files {
+		rel := strings.TrimPrefix(fpath, "/"+projectName+"/")
+		staged[rel] = filepath.Join(prefix, strings.TrimPrefix(fpath, "/"))
+	}
+	manifestPath, ok := staged[manifestFile]
+	if !ok {
+		manifestPath = filepath.Join(projectName, manifestFile)
+	}
+
+	text, err := h.readStaged(bucket, manifestPath)
+	if err != nil {
+		return fmt.Errorf("deploy must include a signed %s", manifestFile)
+	}
+	// a signature that comes with the deploy wins over the live one
+	candidates := []string{}
+	for _, ext := range signatureExts {
+		if loc, ok := staged[manifestFile+ext]; ok {
+			candidates = append(candidates, loc)
+		}
+	}
+	for _, ext := range signatureExts {
+		candidates = append(candidates, filepath.Join(projectName, manifestFile+ext))
+	}
+	var sig []byte
+	for _, loc := range candidates {
+		sig, err = h.readStaged(bucket, loc)
+		if err == nil {
+			break
+		}
+	}
+	if sig == nil {
+		return fmt.Errorf("%s must be signed, upload %s.minisig or %s.asc next to it", manifestFile, manifestFile, manifestFile)
+	}
+	err = key.Verify(text, sig)
+	if err != nil {
+		return fmt.Errorf("%s: %w", manifestFile, err)
+	}
+
+	manifest, err := signing.ParseManifest(string(text))
+	if err != nil {
+		return fmt.Errorf("%s: %w", manifestFile, err)
+	}
+	for rel, loc := range staged {
+		if isManifest(rel) {
+			continue
+		}
+		meta, err := h.Storage.GetObjectMeta(bucket, loc)
+		if err != nil {
+			return fmt.Errorf("could not read (%s): %w", rel, err)
+		}
+		// sidecars are made from files that are verified themselves
+		if meta.Source != "" {
+			continue
+		}
+		sum, ok := manifest[signing.Clean(rel)]
+		if !ok {
+			return fmt.Errorf("(%s) is not in the signed manifest", rel)
+		}
+		if sum != meta.Checksum {
+			return fmt.Errorf("(%s) does not match the signed manifest", rel)
+		}
+	}
+	return nil
+}
+
+// signingKey handles `set <project> [key]`, `rm <project>` and
+// `show <project>`. The key is read from stdin when it is not an
+// argument, which an armored gpg key never fits into.
+func (h *UploadAssetHandler) signingKey(s ssh.Session, args []string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	usage := fmt.Errorf("usage: signing-key set {project} [key] | signing-key rm {project} | signing-key show {project}")
+	if len(args) < 2 {
+		return "", usage
+	}
+	project, err := h.DBPool.FindProjectByName(user.ID, args[1])
+	if err != nil {
+		return "", fmt.Errorf("project (%s) not found", args[1])
+	}
+
+	switch {
+	case args[0] == "set":
+		if !h.Cfg.AtomicDeploys {
+			return "", fmt.Errorf("signed deploys need atomic deploys, which are not enabled")
+		}
+		err := checkDeploy(s)
+		if err != nil {
+			return "", err
+		}
+		text := strings.Join(args[2:], " ")
+		if text == "" {
+			raw, err := io.ReadAll(io.LimitReader(s, maxSigningKeySize))
+			if err != nil {
+				return "", err
+			}
+			text = string(raw)
+		}
+		key, err := signing.ParseKey(text)
+		if err != nil {
+			return "", err
+		}
+		err = h.DBPool.SetProjectSigningKey(project.ID, strings.TrimSpace(text))
+		if err != nil {
+			return "", err
+		}
+		h.logger(s).Info("set signing key", "project", project.Name, "key", key.ID())
+		h.audit(s, audit.ActionSigningKeySet, "/"+project.Name)
+		return fmt.Sprintf(
+			"project (%s) only accepts deploys signed by %s key (%s) from now on",
+			project.Name, key.Kind(), key.ID(),
+		), nil
+	case len(args) == 2 && args[0] == "rm":
+		err := checkDeploy(s)
+		if err != nil {
+			return "", err
+		}
+		err = h.DBPool.RemoveProjectSigningKey(project.ID)
+		if err != nil {
+			return "", err
+		}
+		h.logger(s).Info("removed signing key", "project", project.Name)
+		h.audit(s, audit.ActionSigningKeyRemove, "/"+project.Name)
+		return fmt.Sprintf("project (%s) accepts unsigned deploys again", project.Name), nil
+	case len(args) == 2 && args[0] == "show":
+		found, err := h.DBPool.FindProjectSigningKey(project.ID)
+		if err != nil {
+			return "", err
+		}
+		if found == nil {
+			return "no signing key", nil
+		}
+		key, err := signing.ParseKey(found.Key)
+		if err != nil {
+			return "", err
+		}
+		created := ""
+		if found.CreatedAt != nil {
+			created = found.CreatedAt.Format("2006-01-02")
+		}
+		return fmt.Sprintf("%s\t%s\t%s", key.Kind(), key.ID(), created), nil
+	}
+
+	return "", usage
+}
+
+// SigningKeyMiddleware handles `command signing-key` which makes a
+// project only accept deploys whose files match a signed manifest.
+func SigningKeyMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "signing-key") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			out, err := h.signingKey(s, cmd[2:])
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package uploadassets
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type signingDB struct {
+	fakeDB
+	keys map[string]string
+}
+
+func (f *signingDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func (f *signingDB) SetProjectSigningKey(projectID, key string) error {
+	f.keys[projectID] = key
+	return nil
+}
+
+func (f *signingDB) RemoveProjectSigningKey(projectID string) error {
+	if _, ok := f.keys[projectID]; !ok {
+		return fmt.Errorf("signing key not found")
+	}
+	delete(f.keys, projectID)
+	return nil
+}
+
+func (f *signingDB) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	key, ok := f.keys[projectID]
+	if !ok {
+		return nil, nil
+	}
+	return &db.ProjectSigningKey{ProjectID: projectID, Key: key}, nil
+}
+
+// minisigner signs manifests the way `minisign -S -l` does.
+type minisigner struct {
+	id   []byte
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+func newMinisigner(t *testing.T) *minisigner {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &minisigner{id: []byte("12345678"), pub: pub, priv: priv}
+}
+
+func (m *minisigner) key() string {
+	return base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), m.id...), m.pub...))
+}
+
+func (m *minisigner) sign(message string) string {
+	sig := append(append([]byte("Ed"), m.id...), ed25519.Sign(m.priv, []byte(message))...)
+	global := ed25519.Sign(m.priv, append(append([]byte{}, sig[10:]...), "test"...))
+	return fmt.Sprintf(
+		"untrusted comment: signature\n%s\ntrusted comment: test\n%s\n",
+		base64.StdEncoding.EncodeToString(sig),
+		base64.StdEncoding.EncodeToString(global),
+	)
+}
+
+func manifestOf(files map[string]string) string {
+	lines := []string{}
+	for fpath, text := range files {
+		lines = append(lines, fmt.Sprintf("%s  ./%s", shared.Shasum([]byte(text)), fpath))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestSignedDeploy(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := newMinisigner(t)
+	dbpool := &signingDB{
+		fakeDB: fakeDB{projects: []string{"test"}},
+		keys:   map[string]string{"test": signer.key()},
+	}
+	handler := NewUploadAssetHandler(dbpool, &shared.ConfigSite{AtomicDeploys: true}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	deploy := func(files map[string]string) {
+		s := newFakeSession()
+		s.command = []string{"scp", "-t", "test"}
+		futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+		futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+		s.Context().SetValue(ctxBucketKey{}, bucket)
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+		AtomicDeployMiddleware(handler)(func(sesh ssh.Session) {
+			for fpath, text := range files {
+				_, _ = handler.Write(sesh, &utils.FileEntry{
+					Filepath: "/test/" + fpath,
+					Reader:   bytes.NewReader([]byte(text)),
+				})
+			}
+		})(s)
+	}
+
+	site := map[string]string{"index.html": "<h1>signed</h1>", "css/main.css": "body {}"}
+	manifest := manifestOf(site)
+	signed := map[string]string{manifestFile: manifest, manifestFile + ".minisig": signer.sign(manifest)}
+	for fpath, text := range site {
+		signed[fpath] = text
+	}
+	deploy(signed)
+	if text := readObject(t, st, bucket, "test/index.html"); text != "<h1>signed</h1>" {
+		t.Fatalf("expected the signed deploy to be promoted, found (%s)", text)
+	}
+
+	fixtures := []struct {
+		name  string
+		files map[string]string
+	}{
+		{name: "unlisted", files: map[string]string{"evil.html": "<h1>evil</h1>"}},
+		{name: "changed", files: map[string]string{"index.html": "<h1>evil</h1>"}},
+		{
+			name: "bad-signature",
+			files: map[string]string{
+				"index.html":              "<h1>evil</h1>",
+				manifestFile:              manifestOf(map[string]string{"index.html": "<h1>evil</h1>"}),
+				manifestFile + ".minisig": signer.sign(manifest),
+			},
+		},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			deploy(fixture.files)
+			if text := readObject(t, st, bucket, "test/index.html"); text != "<h1>signed</h1>" {
+				t.Fatalf("expected the deploy to be rejected, found (%s)", text)
+			}
+			if _, err := st.GetObjectSize(bucket, "test/evil.html"); err == nil {
+				t.Fatal("expected evil.html to be discarded")
+			}
+		})
+	}
+
+	// only what changed, checked against the live manifest
+	deploy(map[string]string{"css/main.css": "body {}"})
+	if staged, _ := storage.WalkObjects(st, bucket, storage.StagingDir); len(staged) > 0 {
+		t.Fatalf("expected the deploy to be promoted, found %v staged", staged)
+	}
+
+	// writes that skip staging would go live unverified
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+	_, err = handler.Write(s, &utils.FileEntry{Filepath: "/test/index.html", Reader: bytes.NewReader([]byte("<h1>evil</h1>"))})
+	if err == nil || !strings.Contains(err.Error(), "only accepts signed deploys") {
+		t.Fatalf("expected a direct write to be refused, got (%v)", err)
+	}
+}
+
+func TestSigningKeyCommand(t *testing.T) {
+	signer := newMinisigner(t)
+	dbpool := &signingDB{fakeDB: fakeDB{projects: []string{"site"}}, keys: map[string]string{}}
+	cfg := &shared.ConfigSite{AtomicDeploys: true}
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(dbpool, cfg, nil)
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+
+	fixtures := []struct {
+		name   string
+		args   []string
+		output string
+		err    string
+	}{
+		{name: "missing-project", args: []string{"show", "nope"}, err: "project (nope) not found"},
+		{name: "none", args: []string{"show", "site"}, output: "no signing key"},
+		{name: "invalid", args: []string{"set", "site", "RWQnope"}, err: "not a minisign or gpg public key"},
+		{
+			name:   "set",
+			args:   []string{"set", "site", signer.key()},
+			output: "project (site) only accepts deploys signed by minisign key (3837363534333231) from now on",
+		},
+		{name: "show", args: []string{"show", "site"}, output: "minisign\t3837363534333231\t"},
+		{name: "rm", args: []string{"rm", "site"}, output: "project (site) accepts unsigned deploys again"},
+		{name: "rm-missing", args: []string{"rm", "site"}, err: "signing key not found"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			output, err := handler.signingKey(s, fixture.args)
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected error (%s), got (%v)", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != fixture.output {
+				t.Fatalf("expected (%s), got (%s)", fixture.output, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package uploadassets
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxSitemapKey struct{}
+
+const (
+	sitemapFile = "sitemap.xml"
+	robotsFile  = "robots.txt"
+	// generatedMark tells the files we wrote apart from the ones a user
+	// uploaded, those are never replaced.
+	generatedMark = "generated by pgs"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+func (h *UploadAssetHandler) markSitemap(s ssh.Session, projectName string) {
+	markPending(s, ctxSitemapKey{}, projectName)
+}
+
+// pagePath is where the page rel is served, an `index.html` is served as
+// its directory.
+func pagePath(rel string) string {
+	if path.Base(rel) == "index.html" {
+		rel = strings.TrimSuffix(rel, "index.html")
+	}
+	return (&url.URL{Path: rel}).EscapedPath()
+}
+
+// buildSitemap lists every html page of projectName with the time it was
+// last uploaded.
+func (h *UploadAssetHandler) buildSitemap(bucket sst.Bucket, user *db.User, projectName string) ([]byte, error) {
+	entries, err := storage.WalkObjects(h.Storage, bucket, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []sitemapURL{}
+	for _, entry := range entries {
+		if storage.IsVersion(entry.Path) {
+			continue
+		}
+		if _, ok := storage.SidecarBase(entry.Path); ok {
+			continue
+		}
+		rel := strings.TrimPrefix(entry.Path, projectName+"/")
+		if path.Ext(rel) != ".html" || path.Base(rel) == "404.html" {
+			continue
+		}
+		urls = append(urls, sitemapURL{
+			Loc:     h.Cfg.AssetURL(user.Name, projectName, pagePath(rel)),
+			LastMod: entry.ModTime().UTC().Format(time.DateOnly),
+		})
+	}
+	slices.SortFunc(urls, func(a, b sitemapURL) int {
+		return strings.Compare(a.Loc, b.Loc)
+	})
+
+	text, err := xml.MarshalIndent(sitemapURLSet{
+		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		URLs:  urls,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	out.WriteString(xml.Header)
+	fmt.Fprintf(out, "<!-- %s, upload your own %s to replace it -->\n", generatedMark, sitemapFile)
+	out.Write(text)
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+func (h *UploadAssetHandler) buildRobots(user *db.User, projectName string) []byte {
+	return []byte(fmt.Sprintf(
+		"# %s, upload your own %s to replace it\nUser-agent: *\nAllow: /\n\nSitemap: %s\n",
+		generatedMark,
+		robotsFile,
+		h.Cfg.AssetURL(user.Name, projectName, sitemapFile),
+	))
+}
+
+// writeGenerated uploads text as fname unless the project has its own file
+// by that name or ours is already up to date.
+func (h *UploadAssetHandler) writeGenerated(s ssh.Session, bucket sst.Bucket, projectName, fname string, text []byte) (bool, error) {
+	fpath := path.Join(projectName, fname)
+	current, err := h.readStaged(bucket, fpath)
+	if err == nil && (!bytes.Contains(current, []byte(generatedMark)) || bytes.Equal(current, text)) {
+		return false, nil
+	}
+
+	_, err = h.Write(s, &utils.FileEntry{
+		Filepath: "/" + fpath,
+		Mode:     0o644,
+		Size:     int64(len(text)),
+		Mtime:    time.Now().Unix(),
+		Reader:   bytes.NewReader(text),
+	})
+	return err == nil, err
+}
+
+// runSitemap regenerates the sitemap and robots.txt of projectName when the
+// project asked for them with `sitemap {project} on`.
+func (h *UploadAssetHandler) runSitemap(s ssh.Session, projectName string) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return
+	}
+	project, err := h.DBPool.FindProjectByName(user.ID, projectName)
+	// the files of a linked project live in the one it points to
+	if err != nil || !project.Sitemap || project.ProjectDir != project.Name {
+		return
+	}
+	logger := h.logger(s).With("project", projectName)
+	stderr := s.Stderr()
+
+	key, err := h.sessionKey(s, user.ID, projectName)
+	if err != nil || key != nil {
+		_, _ = fmt.Fprintf(stderr, "skipping %s for (%s), signed projects must upload their own\r\n", sitemapFile, projectName)
+		return
+	}
+
+	sitemap, err := h.buildSitemap(bucket, user, projectName)
+	if err != nil {
+		logger.Error("could not build sitemap", "err", err.Error())
+		_, _ = fmt.Fprintf(stderr, "could not generate %s for (%s): %s\r\n", sitemapFile, projectName, err)
+		return
+	}
+
+	s.Context().SetValue(ctxProjectKey{}, project)
+	files := []struct {
+		name string
+		text []byte
+	}{
+		{name: sitemapFile, text: sitemap},
+		{name: robotsFile, text: h.buildRobots(user, projectName)},
+	}
+	for _, file := range files {
+		wrote, err := h.writeGenerated(s, bucket, projectName, file.name, file.text)
+		if err != nil {
+			logger.Error("could not write generated file", "filename", file.name, "err", err.Error())
+			_, _ = fmt.Fprintf(stderr, "could not generate %s for (%s): %s\r\n", file.name, projectName, err)
+			continue
+		}
+		if wrote {
+			logger.Info("generated file", "filename", file.name)
+			_, _ = fmt.Fprintf(stderr, "generated %s for (%s)\r\n", file.name, projectName)
+		}
+	}
+}
+
+// SitemapMiddleware writes the sitemap and robots.txt of the projects an
+// upload changed once it is done, after builds ran so their pages are
+// listed too.
+func SitemapMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if h.isDryRun(s) || !isUploadCmd(s.Command()) {
+				next(s)
+				return
+			}
+
+			pending := &pendingProjects{projects: map[string]bool{}}
+			s.Context().SetValue(ctxSitemapKey{}, pending)
+			next(s)
+			s.Context().SetValue(ctxSitemapKey{}, nil)
+			if s.Context().Err() != nil {
+				return
+			}
+
+			for _, projectName := range pending.sorted() {
+				h.runSitemap(s, projectName)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package uploadassets
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type sitemapDB struct {
+	signingDB
+	sitemaps []string
+}
+
+func (f *sitemapDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	project, err := f.signingDB.FindProjectByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	project.Sitemap = slices.Contains(f.sitemaps, name)
+	return project, nil
+}
+
+func TestSitemap(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbpool := &sitemapDB{
+		signingDB: signingDB{fakeDB: fakeDB{projects: []string{"site", "plain"}}, keys: map[string]string{}},
+		sitemaps:  []string{"site"},
+	}
+	cfg := &shared.ConfigSite{}
+	cfg.Protocol = "https"
+	cfg.Domain = "pgs.sh"
+	cfg.Logger = slog.Default()
+	handler := NewUploadAssetHandler(dbpool, cfg, st)
+
+	deploy := func(files map[string]string) {
+		s := newFakeSession()
+		s.command = []string{"scp", "-t", "site"}
+		futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+		futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+		s.Context().SetValue(ctxBucketKey{}, bucket)
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+		SitemapMiddleware(handler)(func(sesh ssh.Session) {
+			for fpath, text := range files {
+				_, err := handler.Write(sesh, &utils.FileEntry{
+					Filepath: fpath,
+					Reader:   bytes.NewReader([]byte(text)),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		})(s)
+	}
+
+	deploy(map[string]string{
+		"/site/index.html":     "<h1>home</h1>",
+		"/site/blog/post.html": "<h1>post</h1>",
+		"/site/404.html":       "<h1>missing</h1>",
+		"/site/main.css":       "body {}",
+		"/plain/index.html":    "<h1>plain</h1>",
+	})
+	sitemap := readObject(t, st, bucket, "site/sitemap.xml")
+	for _, loc := range []string{"<loc>https://test-site.pgs.sh/</loc>", "<loc>https://test-site.pgs.sh/blog/post.html</loc>"} {
+		if !strings.Contains(sitemap, loc) {
+			t.Errorf("expected (%s) in the sitemap:\n%s", loc, sitemap)
+		}
+	}
+	if strings.Contains(sitemap, "404.html") || strings.Contains(sitemap, "main.css") {
+		t.Errorf("expected only pages in the sitemap:\n%s", sitemap)
+	}
+	robots := readObject(t, st, bucket, "site/robots.txt")
+	if !strings.Contains(robots, "Sitemap: https://test-site.pgs.sh/sitemap.xml") {
+		t.Errorf("expected robots.txt to point at the sitemap:\n%s", robots)
+	}
+	if _, err := st.GetObjectSize(bucket, "plain/sitemap.xml"); err == nil {
+		t.Error("expected no sitemap for a project that did not ask for one")
+	}
+
+	// a robots.txt the user uploads is never replaced
+	deploy(map[string]string{"/site/about.html": "<h1>about</h1>", "/site/robots.txt": "User-agent: *\nDisallow: /\n"})
+	if sitemap := readObject(t, st, bucket, "site/sitemap.xml"); !strings.Contains(sitemap, "/about.html</loc>") {
+		t.Errorf("expected the sitemap to list the new page:\n%s", sitemap)
+	}
+	if robots := readObject(t, st, bucket, "site/robots.txt"); robots != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("expected the uploaded robots.txt, found:\n%s", robots)
+	}
+}
@@ -0,0 +1,90 @@
+package uploadassets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/picosh/send/send/utils"
+)
+
+// sniffLen is how much of a file `http.DetectContentType` looks at.
+var sniffLen = 512
+
+// spool collects an upload in memory until it grows past limit and writes
+// the rest to a temporary file, so large uploads never sit in RAM. The
+// checksum and the bytes needed to sniff the content type are kept as it
+// is written. A limit of zero keeps everything in memory.
+type spool struct {
+	limit int64
+	size  int64
+	buf   bytes.Buffer
+	file  *os.File
+	hash  hash.Hash
+	head  []byte
+}
+
+func newSpool(limit int64) *spool {
+	return &spool{limit: limit, hash: sha256.New()}
+}
+
+func (sp *spool) Write(p []byte) (int, error) {
+	if sp.file == nil && sp.limit > 0 && int64(sp.buf.Len()+len(p)) > sp.limit {
+		file, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			return 0, err
+		}
+		sp.file = file
+		_, err = file.Write(sp.buf.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		sp.buf = bytes.Buffer{}
+	}
+
+	var n int
+	var err error
+	if sp.file != nil {
+		n, err = sp.file.Write(p)
+	} else {
+		n, err = sp.buf.Write(p)
+	}
+
+	sp.hash.Write(p[:n])
+	if len(sp.head) < sniffLen {
+		sp.head = append(sp.head, p[:min(n, sniffLen-len(sp.head))]...)
+	}
+	sp.size += int64(n)
+	return n, err
+}
+
+// Bytes is the whole upload when it fit in memory and nil otherwise.
+func (sp *spool) Bytes() []byte {
+	if sp.file != nil {
+		return nil
+	}
+	return sp.buf.Bytes()
+}
+
+func (sp *spool) Reader() utils.ReaderAtCloser {
+	if sp.file != nil {
+		return utils.NopReaderAtCloser(io.NewSectionReader(sp.file, 0, sp.size))
+	}
+	return utils.NopReaderAtCloser(bytes.NewReader(sp.buf.Bytes()))
+}
+
+func (sp *spool) Checksum() string {
+	return hex.EncodeToString(sp.hash.Sum(nil))
+}
+
+// Close removes the temporary file, if there is one.
+func (sp *spool) Close() error {
+	if sp.file == nil {
+		return nil
+	}
+	_ = sp.file.Close()
+	return os.Remove(sp.file.Name())
+}
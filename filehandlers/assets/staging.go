@@ -0,0 +1,451 @@
+package uploadassets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxStagingKey struct{}
+
+// pendingDir collects uploads across sessions until `command publish` when
+// publishing is deferred.
+var pendingDir = filepath.Join(storage.StagingDir, "pending")
+
+// pendingPrefix is where a deferred session stages its files, sessions
+// don't share one so they can't overwrite each other's files. The start
+// time leads so `command publish` promotes them in the order they ran.
+func pendingPrefix(s ssh.Session) string {
+	return filepath.Join(pendingDir, fmt.Sprintf("%020d-%s", time.Now().UnixNano(), s.Context().SessionID()))
+}
+
+// staging collects the files written during a session so they can be
+// promoted to their projects together once every one of them succeeded.
+type staging struct {
+	mu     sync.Mutex
+	prefix string
+	files  []string
+	failed bool
+	// deletes are removed once the files are promoted, see `rsync --delete`
+	deletes []string
+}
+
+func (st *staging) record(fpath string, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err != nil {
+		st.failed = true
+		return
+	}
+	st.files = append(st.files, fpath)
+}
+
+func getStaging(s ssh.Session) *staging {
+	stage, ok := s.Context().Value(ctxStagingKey{}).(*staging)
+	if !ok {
+		return nil
+	}
+	return stage
+}
+
+func isUploadCmd(cmd []string) bool {
+	if len(cmd) == 0 {
+		return false
+	}
+
+	switch cmd[0] {
+	case "scp":
+		for _, arg := range cmd {
+			if arg == "-t" {
+				return true
+			}
+		}
+	case "rsync":
+		for _, arg := range cmd {
+			if arg == "--sender" {
+				return false
+			}
+		}
+		return true
+	case "git-receive-pack":
+		return true
+	}
+	return false
+}
+
+// AtomicDeployMiddleware stages every file a scp or rsync session uploads
+// and only moves them into their projects once the whole transfer
+// succeeded, so a failure partway never leaves a half-deployed site.
+func AtomicDeployMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if !h.Cfg.AtomicDeploys || !isUploadCmd(s.Command()) {
+				next(s)
+				return
+			}
+
+			prefix := filepath.Join(storage.StagingDir, s.Context().SessionID())
+			if h.Cfg.DeferPublish {
+				prefix = pendingPrefix(s)
+			}
+			stage := &staging{prefix: prefix}
+			s.Context().SetValue(ctxStagingKey{}, stage)
+			next(s)
+			s.Context().SetValue(ctxStagingKey{}, nil)
+
+			if h.Cfg.DeferPublish {
+				reportPending(s, stage)
+				return
+			}
+			err := h.promoteStaging(s, stage)
+			if err != nil {
+				h.logger(s).Error("could not deploy staged files", "staging", stage.prefix, "err", err.Error())
+				_, _ = s.Stderr().Write([]byte(err.Error() + "\r\n"))
+			}
+		}
+	}
+}
+
+func (h *UploadAssetHandler) promoteStaging(s ssh.Session, stage *staging) error {
+	stage.mu.Lock()
+	defer stage.mu.Unlock()
+
+	if len(stage.files) == 0 {
+		h.deleteFiles(s, stage.deletes)
+		return nil
+	}
+
+	logger := h.logger(s).With("staging", stage.prefix)
+	bucket, err := getBucket(s)
+	if err != nil {
+		return err
+	}
+
+	// the client disconnecting counts as a failure too
+	if stage.failed || s.Context().Err() != nil {
+		logger.Info("discarding staged files, transfer did not complete", "count", len(stage.files))
+		_, _, err := h.discardStaging(s, bucket, stage.prefix, stage.files)
+		return errors.Join(fmt.Errorf("deploy aborted, no files were changed"), err)
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return err
+	}
+	err = h.verifyDeploy(bucket, user.ID, stage.prefix, stage.files)
+	if err != nil {
+		logger.Info("discarding staged files, deploy is not signed", "err", err.Error())
+		_, _, discardErr := h.discardStaging(s, bucket, stage.prefix, stage.files)
+		return errors.Join(fmt.Errorf("ERROR: deploy rejected, no files were changed: %w", err), discardErr)
+	}
+
+	err = h.deploy(s, bucket, stage.prefix, stage.files)
+	if err != nil {
+		return fmt.Errorf("ERROR: could not promote staged files, rolled back: %w", err)
+	}
+
+	logger.Info("promoted staged files", "count", len(stage.files))
+	h.deleteFiles(s, stage.deletes)
+	h.recordDeploys(s, bucket, stage.files)
+	return h.saveStagedRules(s, user, stage.files)
+}
+
+// stagedUsage is what the files staged below prefix added to the storage
+// usage of the user, they were charged for how much they grow the files
+// they replace by.
+func (h *UploadAssetHandler) stagedUsage(bucket sst.Bucket, prefix string, files []string) (int64, error) {
+	entries, err := storage.WalkObjects(h.Storage, bucket, prefix)
+	if err != nil {
+		return 0, err
+	}
+	usage := int64(0)
+	for _, entry := range entries {
+		usage += entry.Size()
+	}
+
+	fpaths := slices.Clone(files)
+	slices.Sort(fpaths)
+	for _, fpath := range slices.Compact(fpaths) {
+		size, err := h.Storage.GetObjectSize(bucket, fpath)
+		if err == nil {
+			usage -= size
+		}
+	}
+	return usage, nil
+}
+
+// discardStaging throws away the files staged below prefix and gives the
+// space they were charged back.
+func (h *UploadAssetHandler) discardStaging(s ssh.Session, bucket sst.Bucket, prefix string, files []string) (int, int64, error) {
+	usage, err := h.stagedUsage(bucket, prefix, files)
+	if err != nil {
+		return 0, 0, err
+	}
+	count, size, err := storage.DeleteObjects(h.Storage, bucket, prefix)
+	if err != nil {
+		return count, size, err
+	}
+	h.adjustStorage(s, -usage)
+	// staged files were counted as they arrived
+	h.forgetFileCounts(s, files)
+	return count, size, nil
+}
+
+// deploy promotes the files staged below prefix, a promotion that is
+// rolled back gives the space they were charged back.
+func (h *UploadAssetHandler) deploy(s ssh.Session, bucket sst.Bucket, prefix string, files []string) error {
+	usage, err := h.stagedUsage(bucket, prefix, files)
+	if err != nil {
+		return err
+	}
+	err = h.promote(bucket, prefix, files)
+	if err != nil {
+		h.logger(s).Error("could not promote staged files", "staging", prefix, "err", err.Error())
+		h.adjustStorage(s, -usage)
+		h.forgetFileCounts(s, files)
+		return err
+	}
+	return nil
+}
+
+// saveStagedRules applies the `_headers` and `_redirects` files of a
+// deploy once it was promoted, staged rules that are thrown away never
+// take effect.
+func (h *UploadAssetHandler) saveStagedRules(s ssh.Session, user *db.User, files []string) error {
+	for _, fpath := range files {
+		projectName, _, _ := strings.Cut(strings.TrimPrefix(fpath, "/"), "/")
+		entry := &utils.FileEntry{Filepath: fpath}
+		if !isProjectHeaders(entry, projectName) && !isProjectRedirects(entry, projectName) {
+			continue
+		}
+
+		_, contents, err := h.Read(s, entry)
+		if err != nil {
+			return err
+		}
+		text, err := io.ReadAll(contents)
+		_ = contents.Close()
+		if err != nil {
+			return err
+		}
+		err = h.saveRules(user, projectName, entry, text)
+		if err != nil {
+			return fmt.Errorf("could not save rules for (%s): %w", projectName, err)
+		}
+	}
+	return nil
+}
+
+// promote moves staged files into their projects. The files they replace
+// are set aside first so a move that fails partway can put the previous
+// deploy back instead of leaving a mix of both.
+func (h *UploadAssetHandler) promote(bucket sst.Bucket, prefix string, files []string) error {
+	if h.Cfg.KeepVersions > 0 {
+		for _, fpath := range files {
+			err := h.versionAsset(bucket, fpath)
+			if err != nil {
+				return fmt.Errorf("could not version (%s): %w", fpath, err)
+			}
+		}
+	}
+
+	backup := prefix + ".backup"
+	replaced := map[string]bool{}
+	for _, fpath := range files {
+		if _, err := h.Storage.GetObjectSize(bucket, fpath); err != nil {
+			continue
+		}
+		err := storage.CopyObject(h.Storage, bucket, fpath, filepath.Join(backup, strings.TrimPrefix(fpath, "/")))
+		if err != nil {
+			_, _, cleanupErr := storage.DeleteObjects(h.Storage, bucket, backup)
+			return errors.Join(err, cleanupErr)
+		}
+		replaced[fpath] = true
+	}
+
+	err := h.Storage.MovePrefix(bucket, prefix, "/")
+	if err != nil {
+		return errors.Join(err, h.rollback(bucket, prefix, backup, files, replaced))
+	}
+
+	if len(replaced) == 0 {
+		return nil
+	}
+	// the deploy is in place, a backup that is left over is only clutter
+	_, _, err = storage.DeleteObjects(h.Storage, bucket, backup)
+	if err != nil {
+		h.Cfg.Logger.Error("could not remove deploy backup", "backup", backup, "err", err.Error())
+	}
+	return nil
+}
+
+func (h *UploadAssetHandler) rollback(bucket sst.Bucket, prefix, backup string, files []string, replaced map[string]bool) error {
+	errs := []error{}
+	for _, fpath := range files {
+		if replaced[fpath] {
+			continue
+		}
+		// new files that made it into place have nothing to go back to
+		err := h.Storage.DeleteObject(bucket, fpath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	err := h.Storage.MovePrefix(bucket, backup, "/")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not restore files replaced by deploy: %w", err))
+	}
+	_, _, err = storage.DeleteObjects(h.Storage, bucket, prefix)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not discard staged files: %w", err))
+	}
+	h.Cfg.Logger.Info("rolled back deploy", "staging", prefix, "count", len(files), "replaced", len(replaced))
+	return errors.Join(errs...)
+}
+
+func reportPending(s ssh.Session, stage *staging) {
+	stage.mu.Lock()
+	defer stage.mu.Unlock()
+
+	if len(stage.files) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("staged (%d) files, run `command publish` to deploy them\r\n", len(stage.files))
+	if stage.failed {
+		msg = "some files failed to upload, fix them and upload again before publishing\r\n" + msg
+	}
+	_, _ = s.Stderr().Write([]byte(msg))
+}
+
+// publish promotes every pending file, or throws them away with discard.
+// Every deferred session staged into a directory of its own, they are
+// promoted in the order they ran so later uploads win.
+func (h *UploadAssetHandler) publish(s ssh.Session, discard bool) (string, error) {
+	bucket, err := getBucket(s)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := storage.WalkObjects(h.Storage, bucket, pendingDir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "nothing to publish", nil
+	}
+
+	pending := map[string][]string{}
+	prefixes := []string{}
+	for _, entry := range entries {
+		rel := strings.TrimPrefix(strings.TrimPrefix(entry.Path, pendingDir), "/")
+		session, fpath, _ := strings.Cut(rel, "/")
+		prefix := filepath.Join(pendingDir, session)
+		if _, ok := pending[prefix]; !ok {
+			prefixes = append(prefixes, prefix)
+		}
+		pending[prefix] = append(pending[prefix], "/"+fpath)
+	}
+	slices.Sort(prefixes)
+
+	if discard {
+		count := 0
+		size := int64(0)
+		for _, prefix := range prefixes {
+			n, sz, err := h.discardStaging(s, bucket, prefix, pending[prefix])
+			count += n
+			size += sz
+			if err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("discarded (%d) staged files (%s)", count, shared.HumanSize(size)), nil
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	// pending files stay around so the deploy can be fixed and published
+	for _, prefix := range prefixes {
+		err = h.verifyDeploy(bucket, user.ID, prefix, pending[prefix])
+		if err != nil {
+			return "", fmt.Errorf("ERROR: could not publish: %w", err)
+		}
+	}
+
+	files := []string{}
+	for _, prefix := range prefixes {
+		err = h.deploy(s, bucket, prefix, pending[prefix])
+		if err != nil {
+			h.recordDeploys(s, bucket, files)
+			return "", fmt.Errorf("ERROR: could not publish staged files, rolled back: %w", err)
+		}
+		for _, fpath := range pending[prefix] {
+			if !slices.Contains(files, fpath) {
+				files = append(files, fpath)
+			}
+		}
+	}
+
+	h.logger(s).Info("published staged files", "count", len(files))
+	h.recordDeploys(s, bucket, files)
+	err = h.saveStagedRules(s, user, files)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("published (%d) files", len(files)), nil
+}
+
+// PublishMiddleware handles `command publish [--discard]` for deploys
+// that were staged with `DeferPublish`.
+func PublishMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "publish") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			args := cmd[2:]
+			discard := len(args) == 1 && args[0] == "--discard"
+			if len(args) > 0 && !discard {
+				utils.ErrorHandler(s, fmt.Errorf("usage: publish [--discard]"))
+				return
+			}
+
+			out, err := h.publish(s, discard)
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
+
+// stagingPath is where fpath is written during an atomic deploy.
+func (st *staging) path(fpath string) string {
+	return filepath.Join(st.prefix, strings.TrimPrefix(fpath, "/"))
+}
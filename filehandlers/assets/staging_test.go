@@ -0,0 +1,282 @@
+package uploadassets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestAtomicDeploy(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		files    []string
+		promoted bool
+	}{
+		{name: "success", files: []string{"/test/index.html", "/test/css/main.css"}, promoted: true},
+		{name: "failure", files: []string{"/test/index.html", "/test/evil.exe"}, promoted: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler, s, st, bucket := setupUpload(t, &fakeDB{}, &shared.ConfigSite{AtomicDeploys: true})
+			handler.Cfg.AllowedExt = []string{".html", ".css"}
+			s.command = []string{"scp", "-t", "test"}
+
+			mdw := AtomicDeployMiddleware(handler)
+			mdw(func(sesh ssh.Session) {
+				for _, fpath := range fixture.files {
+					_, _ = handler.Write(sesh, &utils.FileEntry{
+						Filepath: fpath,
+						Reader:   bytes.NewReader([]byte("hello")),
+					})
+					if _, err := st.GetObjectSize(bucket, fpath); err == nil {
+						t.Fatalf("expected (%s) to be staged, found it live", fpath)
+					}
+				}
+			})(s)
+
+			for _, fpath := range fixture.files[:1] {
+				_, err := st.GetObjectSize(bucket, fpath)
+				if fixture.promoted && err != nil {
+					t.Fatalf("expected (%s) to be promoted: %s", fpath, err)
+				}
+				if !fixture.promoted && err == nil {
+					t.Fatalf("expected (%s) to be discarded", fpath)
+				}
+			}
+
+			staged, _ := storage.WalkObjects(st, bucket, storage.StagingDir)
+			if len(staged) > 0 {
+				t.Fatalf("expected staging to be cleaned up, found %v", staged)
+			}
+		})
+	}
+}
+
+func TestAtomicDeployHeadersAndUsage(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		files    []string
+		promoted bool
+	}{
+		{name: "success", files: []string{"/test/_headers", "/test/index.html"}, promoted: true},
+		{name: "failure", files: []string{"/test/_headers", "/test/index.html", "/test/evil.exe"}, promoted: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dbpool := &fakeDB{}
+			handler, s, _, _ := setupUpload(t, dbpool, &shared.ConfigSite{AtomicDeploys: true})
+			handler.Cfg.AllowedExt = []string{".html"}
+			s.command = []string{"scp", "-t", "test"}
+
+			AtomicDeployMiddleware(handler)(func(sesh ssh.Session) {
+				for _, fpath := range fixture.files {
+					_, _ = handler.Write(sesh, &utils.FileEntry{
+						Filepath: fpath,
+						Reader:   bytes.NewReader([]byte("/*\n  X-Frame-Options: DENY\n")),
+					})
+					if len(dbpool.headers) > 0 {
+						t.Fatal("expected staged headers to wait for the deploy")
+					}
+				}
+			})(s)
+
+			if fixture.promoted && len(dbpool.headers["test"]) != 1 {
+				t.Fatalf("expected headers to be saved once promoted, got %v", dbpool.headers)
+			}
+			if !fixture.promoted && len(dbpool.headers) > 0 {
+				t.Fatalf("expected discarded headers to not be saved, got %v", dbpool.headers)
+			}
+			used := dbpool.usage["1"]
+			if fixture.promoted && used == 0 {
+				t.Fatal("expected promoted files to count toward the quota")
+			}
+			if !fixture.promoted && used != 0 {
+				t.Fatalf("expected discarded files to be given back, (%d bytes) still used", used)
+			}
+		})
+	}
+}
+
+func TestIsUploadCmd(t *testing.T) {
+	fixtures := []struct {
+		cmd    []string
+		expect bool
+	}{
+		{cmd: []string{"scp", "-r", "-t", "."}, expect: true},
+		{cmd: []string{"scp", "-f", "test"}, expect: false},
+		{cmd: []string{"rsync", "--server", "-vlogDtpre.iLsfxCIvu", ".", "test"}, expect: true},
+		{cmd: []string{"rsync", "--server", "--sender", "-vlogDtpre.iLsfxCIvu", ".", "test"}, expect: false},
+		{cmd: []string{"git-receive-pack", "/blog.git"}, expect: true},
+		{cmd: []string{"ls"}, expect: false},
+	}
+
+	for _, fixture := range fixtures {
+		if actual := isUploadCmd(fixture.cmd); actual != fixture.expect {
+			t.Errorf("%v: expected (%t), got (%t)", fixture.cmd, fixture.expect, actual)
+		}
+	}
+}
+
+// failMoveStorage promotes staged files and then reports an error, like a
+// move that broke after some objects were already in place.
+type failMoveStorage struct {
+	*storage.StorageFS
+}
+
+func (s *failMoveStorage) MovePrefix(bucket sst.Bucket, from, to string) error {
+	err := s.StorageFS.MovePrefix(bucket, from, to)
+	if err != nil || strings.HasSuffix(from, ".backup") {
+		return err
+	}
+	return fmt.Errorf("connection reset")
+}
+
+func readObject(t *testing.T, st storage.StorageServe, bucket sst.Bucket, fpath string) string {
+	contents, _, _, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		t.Fatalf("expected (%s) to exist: %s", fpath, err)
+	}
+	defer contents.Close()
+	text, err := io.ReadAll(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(text)
+}
+
+func TestPromoteRollback(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &failMoveStorage{fs}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUploadAssetHandler(&fakeDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.Logger = slog.Default()
+
+	_, err = st.PutObject(bucket, "/test/index.html", utils.NopReaderAtCloser(strings.NewReader("old")), &utils.FileEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := storage.StagingDir + "/1"
+	for _, fpath := range []string{"/test/index.html", "/test/new.html"} {
+		_, err = st.PutObject(bucket, prefix+fpath, utils.NopReaderAtCloser(strings.NewReader("new")), &utils.FileEntry{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = handler.promote(bucket, prefix, []string{"/test/index.html", "/test/new.html"})
+	if err == nil {
+		t.Fatal("expected promote to fail")
+	}
+
+	if text := readObject(t, st, bucket, "/test/index.html"); text != "old" {
+		t.Fatalf("expected replaced file to be restored, got %q", text)
+	}
+	if _, err := st.GetObjectSize(bucket, "/test/new.html"); err == nil {
+		t.Fatal("expected new file to be removed")
+	}
+	staged, _ := storage.WalkObjects(st, bucket, storage.StagingDir)
+	if len(staged) > 0 {
+		t.Fatalf("expected staging to be cleaned up, found %v", staged)
+	}
+}
+
+func TestDeferPublish(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUploadAssetHandler(&lockDB{}, &shared.ConfigSite{AtomicDeploys: true, DeferPublish: true}, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	newSession := func(cmd ...string) *fakeSession {
+		s := newFakeSession()
+		s.command = cmd
+		futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+		futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+		s.Context().SetValue(ctxBucketKey{}, bucket)
+		s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+		return s
+	}
+
+	// two separate uploads are published together
+	for _, fpath := range []string{"/test/index.html", "/test/about.html"} {
+		s := newSession("scp", "-t", "test")
+		AtomicDeployMiddleware(handler)(func(sesh ssh.Session) {
+			_, err := handler.Write(sesh, &utils.FileEntry{
+				Filepath: fpath,
+				Reader:   bytes.NewReader([]byte("hello")),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})(s)
+		if _, err := st.GetObjectSize(bucket, fpath); err == nil {
+			t.Fatalf("expected (%s) to wait for publish", fpath)
+		}
+	}
+
+	out, err := handler.publish(newSession("command", "publish"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "published (2) files" {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	for _, fpath := range []string{"/test/index.html", "/test/about.html"} {
+		if text := readObject(t, st, bucket, fpath); text != "hello" {
+			t.Fatalf("expected (%s) to be published, got %q", fpath, text)
+		}
+	}
+
+	out, err = handler.publish(newSession("command", "publish"), false)
+	if err != nil || out != "nothing to publish" {
+		t.Fatalf("expected nothing left to publish, got %q (%v)", out, err)
+	}
+
+	// a later upload of the same file wins
+	for _, text := range []string{"first", "second"} {
+		s := newSession("scp", "-t", "test")
+		AtomicDeployMiddleware(handler)(func(sesh ssh.Session) {
+			_, err := handler.Write(sesh, &utils.FileEntry{
+				Filepath: "/test/index.html",
+				Reader:   bytes.NewReader([]byte(text)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})(s)
+	}
+	out, err = handler.publish(newSession("command", "publish"), false)
+	if err != nil || out != "published (1) files" {
+		t.Fatalf("unexpected output: %q (%v)", out, err)
+	}
+	if text := readObject(t, st, bucket, "/test/index.html"); text != "second" {
+		t.Fatalf("expected the later upload to be published, got %q", text)
+	}
+}
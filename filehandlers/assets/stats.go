@@ -0,0 +1,83 @@
+package uploadassets
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bandwidth"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/wish/stats"
+)
+
+// Stats walks each project in storage, there is no per-file table so
+// counts and sizes come from the objects themselves. Links share the
+// assets of the project they point to and are left out.
+func (h *UploadAssetHandler) Stats(s ssh.Session, projectName string) (*stats.Stats, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := futil.GetFeatureFlag(s)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := h.DBPool.FindProjectsByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &stats.Stats{
+		Used:  getStorageSize(s),
+		Quota: ff.Data.StorageMax,
+	}
+	// bytes the web servers have not flushed yet are not included
+	if h.Cfg.BandwidthInterval > 0 {
+		months, err := h.DBPool.FindBandwidth(user.ID, h.Cfg.Space, bandwidth.MonthOf(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		for _, month := range months {
+			result.Served += uint64(month.Bytes)
+		}
+		result.Egress = shared.GetEgressForUser(h.DBPool, h.Cfg, user.ID)
+	}
+	found := false
+	for _, project := range projects {
+		if projectName != "" && project.Name != projectName {
+			continue
+		}
+		found = true
+		if project.Name != project.ProjectDir {
+			if projectName != "" {
+				return nil, fmt.Errorf("project (%s) is a link to (%s)", project.Name, project.ProjectDir)
+			}
+			continue
+		}
+
+		entries, err := storage.WalkObjects(h.Storage, bucket, project.Name)
+		if err != nil {
+			return nil, err
+		}
+		ps := stats.ProjectStats{Name: project.Name, FileCount: len(entries)}
+		for _, entry := range entries {
+			ps.TotalSize += entry.Size()
+			if entry.ModTime().After(ps.LastUpload) {
+				ps.LastUpload = entry.ModTime()
+			}
+		}
+		result.Projects = append(result.Projects, ps)
+	}
+
+	if projectName != "" && !found {
+		return nil, fmt.Errorf("project (%s) not found", projectName)
+	}
+	return result, nil
+}
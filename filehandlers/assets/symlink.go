@@ -0,0 +1,87 @@
+package uploadassets
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// Links are handled the same way however they are uploaded:
+//
+//   - a symlink is stored as a marker, an object holding its target with
+//     `ObjectMeta.Symlink` set, and the web server redirects to the file it
+//     points to. Targets are relative to the link, they cannot be absolute
+//     or leave the project and a link that ends up pointing back at itself
+//     is refused.
+//   - a hardlink is stored as a copy of the file it links to, the copy
+//     counts against the storage quota like any other file.
+//
+// sftp clients send links as requests of their own and archives carry them
+// as members. scp clients follow links before sending them. rsync only
+// sends regular files so links are dropped unless the client follows them
+// with `rsync -L`.
+
+// maxLinkTarget is the longest symlink target we store, PATH_MAX on linux.
+const maxLinkTarget = 4096
+
+func isSymlink(entry *utils.FileEntry) bool {
+	return entry.Mode&fs.ModeSymlink != 0
+}
+
+// linkTarget is the target of a symlink upload, the contents of the file.
+func linkTarget(entry *utils.FileEntry, sp *spool) (string, error) {
+	target := sp.Bytes()
+	if target == nil || len(target) > maxLinkTarget {
+		return "", fmt.Errorf("ERROR: target of symlink (%s) is longer than (%d bytes)", entry.Filepath, maxLinkTarget)
+	}
+	return string(target), nil
+}
+
+// symlink stores a symlink at fpath pointing to target.
+func (h *UploadAssetHandler) symlink(s ssh.Session, fpath, target string) (string, error) {
+	return h.Write(s, &utils.FileEntry{
+		Filepath: fpath,
+		Mode:     fs.ModeSymlink | 0o777,
+		Size:     int64(len(target)),
+		Mtime:    time.Now().Unix(),
+		Reader:   strings.NewReader(target),
+	})
+}
+
+// hardlink stores a copy of src at dst, when src is a symlink the file it
+// points to is copied.
+func (h *UploadAssetHandler) hardlink(s ssh.Session, src, dst string) (string, error) {
+	bucket, err := getBucket(s)
+	if err != nil {
+		return "", err
+	}
+	src, err = shared.SanitizePath(src)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: invalid file path: %w", err)
+	}
+
+	projectName := shared.GetProjectName(&utils.FileEntry{Filepath: src})
+	resolved, err := storage.FollowLinks(h.Storage, bucket, projectName, src)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: cannot link to (%s): %w", src, err)
+	}
+	info, contents, err := h.Read(s, &utils.FileEntry{Filepath: "/" + resolved})
+	if err != nil {
+		return "", fmt.Errorf("ERROR: cannot link to (%s): %w", src, err)
+	}
+	defer contents.Close()
+
+	return h.Write(s, &utils.FileEntry{
+		Filepath: dst,
+		Size:     info.Size(),
+		Mtime:    info.ModTime().Unix(),
+		Reader:   io.NewSectionReader(contents, 0, info.Size()),
+	})
+}
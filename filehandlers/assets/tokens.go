@@ -0,0 +1,119 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/send/send/utils"
+)
+
+func (h *UploadAssetHandler) listTokens(s ssh.Session) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	tokens, err := h.DBPool.FindTokensForUser(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, token := range tokens {
+		expires := "never"
+		if token.ExpiresAt != nil {
+			expires = token.ExpiresAt.Format("2006-01-02")
+		}
+		scope := token.Scope
+		if scope == db.TokenScopeDefault {
+			scope = "feeds"
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\texpires %s", token.ID, token.Name, scope, expires))
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+func (h *UploadAssetHandler) createToken(s ssh.Session, name string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	token, err := h.DBPool.InsertScopedToken(user.ID, name, db.TokenScopeDeploy)
+	if err != nil {
+		return "", err
+	}
+	h.logger(s).Info("created deploy token", "name", name)
+	return fmt.Sprintf(
+		"deploy token (%s) created, it is only shown once:\r\n%s",
+		name,
+		token,
+	), nil
+}
+
+// revokeToken only removes tokens that belong to the user, ids are not
+// secret.
+func (h *UploadAssetHandler) revokeToken(s ssh.Session, id string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	tokens, err := h.DBPool.FindTokensForUser(user.ID)
+	if err != nil {
+		return "", err
+	}
+	for _, token := range tokens {
+		if token.ID != id {
+			continue
+		}
+		err = h.DBPool.RemoveToken(id)
+		if err != nil {
+			return "", err
+		}
+		h.logger(s).Info("revoked api token", "token", id)
+		return fmt.Sprintf("token (%s) revoked", id), nil
+	}
+	return "", fmt.Errorf("token (%s) not found", id)
+}
+
+// TokensMiddleware handles `command token list`, `command token create
+// {name}` and `command token revoke {id}`. Created tokens are deploy tokens,
+// they only authenticate the http upload api and webdav, e.g. to deploy
+// from CI without an ssh key.
+func TokensMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "token") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			var out string
+			var err error
+			args := cmd[2:]
+			switch {
+			case len(args) == 1 && args[0] == "list":
+				out, err = h.listTokens(s)
+			case len(args) == 2 && args[0] == "create":
+				out, err = h.createToken(s, args[1])
+			case len(args) == 2 && args[0] == "revoke":
+				out, err = h.revokeToken(s, args[1])
+			default:
+				err = fmt.Errorf("usage: token list | token create {name} | token revoke {id}")
+			}
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
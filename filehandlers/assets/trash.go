@@ -0,0 +1,204 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/trash"
+	"github.com/picosh/pico/shared/webhooks"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// trashAsset moves a deleted asset to the trash of its user when
+// `TrashRetention` is set, false means it was removed for good.
+func (h *UploadAssetHandler) trashAsset(user *db.User, bucket sst.Bucket, fpath string, size int64) (bool, error) {
+	if h.Cfg.TrashRetention <= 0 {
+		return false, h.Storage.DeleteObject(bucket, fpath)
+	}
+
+	now := time.Now()
+	trashPath := trash.Path(fpath, now)
+	err := storage.CopyObject(h.Storage, bucket, fpath, trashPath)
+	if err != nil {
+		return false, err
+	}
+	expiresAt := now.Add(h.Cfg.TrashRetention)
+	err = h.DBPool.InsertTrashObject(&db.TrashObject{
+		UserID:    user.ID,
+		Path:      "/" + strings.TrimPrefix(fpath, "/"),
+		TrashPath: trashPath,
+		Size:      size,
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		_ = h.Storage.DeleteObject(bucket, trashPath)
+		return false, err
+	}
+	return true, h.Storage.DeleteObject(bucket, fpath)
+}
+
+func formatTrash(obj *db.TrashObject) string {
+	deleted := ""
+	if obj.CreatedAt != nil {
+		deleted = obj.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	expires := ""
+	if obj.ExpiresAt != nil {
+		expires = obj.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%s\t%s\tdeleted %s\texpires %s", obj.Path, shared.HumanSize(obj.Size), deleted, expires)
+}
+
+func (h *UploadAssetHandler) listTrash(s ssh.Session) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	objs, err := h.DBPool.FindTrashObjects(user.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(objs) == 0 {
+		return "trash is empty", nil
+	}
+
+	lines := []string{}
+	for _, obj := range objs {
+		lines = append(lines, formatTrash(obj))
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+// restoreCandidates picks the newest deletion of fpath, or of every file
+// below it when it is a directory.
+func restoreCandidates(objs []*db.TrashObject, fpath string) []*db.TrashObject {
+	dir := strings.TrimSuffix(fpath, "/") + "/"
+	seen := map[string]bool{}
+	found := []*db.TrashObject{}
+	// objs are newest first
+	for _, obj := range objs {
+		if obj.Path != fpath && !strings.HasPrefix(obj.Path, dir) {
+			continue
+		}
+		if seen[obj.Path] {
+			continue
+		}
+		seen[obj.Path] = true
+		found = append(found, obj)
+	}
+	return found
+}
+
+// restore puts deleted files back where they were, files that were
+// uploaded again since are left alone.
+func (h *UploadAssetHandler) restore(s ssh.Session, fpath string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	err = checkDeploy(s)
+	if err != nil {
+		return "", err
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return "", err
+	}
+	fpath, err = shared.SanitizePath(fpath)
+	if err != nil {
+		return "", fmt.Errorf("invalid file path: %w", err)
+	}
+
+	objs, err := h.DBPool.FindTrashObjects(user.ID)
+	if err != nil {
+		return "", err
+	}
+	candidates := restoreCandidates(objs, fpath)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("(%s) not found in trash", fpath)
+	}
+
+	lines := []string{}
+	for _, obj := range candidates {
+		if _, err := h.Storage.GetObjectSize(bucket, obj.Path); err == nil {
+			lines = append(lines, fmt.Sprintf("(%s) exists, remove it first to restore it", obj.Path))
+			continue
+		}
+
+		entry := &utils.FileEntry{Filepath: obj.Path}
+		projectName := shared.GetProjectName(entry)
+		unlock := h.projects.lock(user.ID, projectName)
+		_, err := h.findOrCreateProject(s, bucket, user, projectName)
+		unlock()
+		if err != nil {
+			return strings.Join(lines, "\r\n"), err
+		}
+		h.detachDeploy(s, user, projectName)
+		err = storage.CopyObject(h.Storage, bucket, obj.TrashPath, obj.Path)
+		if err != nil {
+			return strings.Join(lines, "\r\n"), err
+		}
+		err = h.DBPool.RemoveTrashObject(obj.ID)
+		if err != nil {
+			return strings.Join(lines, "\r\n"), err
+		}
+		_ = h.Storage.DeleteObject(bucket, obj.TrashPath)
+
+		h.adjustProjectFileCount(s, projectName, 1)
+		h.recordEvent(s, projectName, webhooks.ProjectUpdate)
+		h.audit(s, audit.ActionRestore, obj.Path)
+		h.logger(s).Info("restored file from trash", "filename", obj.Path)
+		lines = append(lines, fmt.Sprintf("restored (%s)", obj.Path))
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+// TrashMiddleware handles `command trash ls` and `command restore {path}`,
+// a directory restores every file below it.
+func TrashMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && (cmd[1] == "trash" || cmd[1] == "restore")) {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			if h.Cfg.TrashRetention <= 0 {
+				utils.ErrorHandler(s, fmt.Errorf("trash is not enabled"))
+				return
+			}
+
+			var out string
+			var err error
+			args := cmd[2:]
+			switch {
+			case cmd[1] == "trash" && len(args) == 1 && args[0] == "ls":
+				out, err = h.listTrash(s)
+			case cmd[1] == "restore" && len(args) == 1:
+				out, err = h.restore(s, args[0])
+			default:
+				err = fmt.Errorf("usage: trash ls | restore {path}")
+			}
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
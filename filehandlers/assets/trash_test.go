@@ -0,0 +1,148 @@
+package uploadassets
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type trashDB struct {
+	fakeDB
+	trash []*db.TrashObject
+}
+
+func (f *trashDB) UpdateProject(userID, name string) error {
+	return nil
+}
+
+func (f *trashDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	return []*db.Project{}, nil
+}
+
+func (f *trashDB) RemoveProject(projectID string) error {
+	f.projects = slices.DeleteFunc(f.projects, func(name string) bool { return name == projectID })
+	return nil
+}
+
+func (f *trashDB) InsertTrashObject(obj *db.TrashObject) error {
+	now := time.Now()
+	obj.ID = fmt.Sprint(len(f.trash) + 1)
+	obj.CreatedAt = &now
+	f.trash = append(f.trash, obj)
+	return nil
+}
+
+func (f *trashDB) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	objs := []*db.TrashObject{}
+	for i := len(f.trash) - 1; i >= 0; i-- {
+		objs = append(objs, f.trash[i])
+	}
+	return objs, nil
+}
+
+func (f *trashDB) RemoveTrashObject(id string) error {
+	for i, obj := range f.trash {
+		if obj.ID == id {
+			f.trash = append(f.trash[:i], f.trash[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func TestTrashRestore(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbpool := &trashDB{fakeDB: fakeDB{projects: []string{"blog"}}}
+	cfg := &shared.ConfigSite{TrashRetention: time.Hour}
+	cfg.MaxSize = 1000
+	cfg.MaxAssetSize = 100
+	handler := NewUploadAssetHandler(dbpool, cfg, st)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html"}
+
+	s := newFakeSession()
+	futil.SetUser(s, &db.User{ID: "1", Name: "test"})
+	futil.SetFeatureFlag(s, db.NewFeatureFlag("1", "pgs", uint64(shared.GB), int64(shared.GB)))
+	s.Context().SetValue(ctxBucketKey{}, bucket)
+	s.Context().SetValue(ctxStorageSizeKey{}, uint64(0))
+
+	write := func(fpath, text string) {
+		_, err := handler.Write(s, &utils.FileEntry{Filepath: fpath, Reader: strings.NewReader(text)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(fpath string) string {
+		contents, _, _, err := st.GetObject(bucket, fpath)
+		if err != nil {
+			return ""
+		}
+		defer contents.Close()
+		text, _ := io.ReadAll(contents)
+		return string(text)
+	}
+
+	write("/blog/index.html", "<p>index</p>")
+	write("/blog/a.html", "<p>first</p>")
+	size := getStorageSize(s)
+
+	for _, fpath := range []string{"/blog/a.html", "/blog/index.html"} {
+		err = handler.Delete(s, &utils.FileEntry{Filepath: fpath})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if read("/blog/a.html") != "" || len(dbpool.trash) != 2 || read(dbpool.trash[0].TrashPath) != "<p>first</p>" {
+		t.Fatalf("expected the files to move to the trash, found %+v", dbpool.trash)
+	}
+	// trash keeps using its space until it is purged
+	if getStorageSize(s) != size {
+		t.Fatalf("expected storage size (%d), got (%d)", size, getStorageSize(s))
+	}
+
+	out, err := handler.listTrash(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(out, "\r\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "/blog/index.html\t") {
+		t.Fatalf("expected the newest deletion first, got %q", out)
+	}
+
+	// a file that was uploaded again is not overwritten
+	write("/blog/a.html", "<p>second</p>")
+	out, err = handler.restore(s, "/blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "(/blog/a.html) exists") || !strings.Contains(out, "restored (/blog/index.html)") {
+		t.Fatalf("unexpected restore output %q", out)
+	}
+	if read("/blog/index.html") != "<p>index</p>" || read("/blog/a.html") != "<p>second</p>" {
+		t.Fatal("expected only the missing file to be restored")
+	}
+	if len(dbpool.trash) != 1 || dbpool.trash[0].Path != "/blog/a.html" {
+		t.Fatalf("expected the restored file to leave the trash, found %+v", dbpool.trash)
+	}
+
+	_, err = handler.restore(s, "/docs/a.html")
+	if err == nil || !strings.Contains(err.Error(), "not found in trash") {
+		t.Fatalf("expected a missing file to be rejected, got %v", err)
+	}
+}
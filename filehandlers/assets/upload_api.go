@@ -0,0 +1,101 @@
+package uploadassets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/send/send/utils"
+)
+
+type apiUploadResponse struct {
+	URL       string `json:"url"`
+	Size      int64  `json:"size"`
+	Unchanged bool   `json:"unchanged,omitempty"`
+}
+
+func (h *UploadAssetHandler) apiUpload(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.authHTTP(w, r, "api")
+	if !ok {
+		return
+	}
+	if err := checkDeploy(s); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	projectName := r.PathValue("name")
+	// a path cannot climb out of the project it is uploaded to
+	fpath := strings.TrimPrefix(path.Clean("/"+r.PathValue("path")), "/")
+	if projectName == "" || fpath == "" {
+		http.Error(w, "project name and file path are required", http.StatusBadRequest)
+		return
+	}
+
+	entry := &utils.FileEntry{
+		Filepath: path.Join("/", projectName, fpath),
+		Size:     r.ContentLength,
+		Mtime:    time.Now().Unix(),
+		Reader:   r.Body,
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := apiUploadResponse{URL: h.Cfg.AssetURL(user.Name, projectName, fpath)}
+	status := http.StatusCreated
+
+	// with the checksum of the file we can tell it is already stored
+	// without reading the body
+	bucket, bucketErr := getBucket(s)
+	unchanged := false
+	if text := r.Header.Get("x-checksum-sha256"); text != "" {
+		checksum, err := parseChecksum(text)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Context().SetValue(ctxClientChecksumKey{}, checksum)
+		unchanged = bucketErr == nil && h.unchanged(bucket, entry.Filepath, checksum)
+	}
+
+	if unchanged {
+		h.logger(s).Info("skipping unchanged file", "filename", entry.Filepath)
+		res.Unchanged = true
+		res.Size, _ = h.Storage.GetObjectSize(bucket, entry.Filepath)
+		status = http.StatusOK
+	} else {
+		_, err = h.Write(s, entry)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res.Size = entry.Size
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// UploadAPIHandler lets CI pipelines deploy without an ssh key,
+// `POST /api/projects/{name}/files/{path}` stores the request body at that
+// path with the same checks as scp. Requests authenticate with a bearer
+// token from `command token create`. An `x-checksum-sha256` header skips
+// files that are already stored and rejects bodies that do not match it.
+func (h *UploadAssetHandler) UploadAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/projects/{name}/files/{path...}", h.apiUpload)
+	return mux
+}
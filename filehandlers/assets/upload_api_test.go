@@ -0,0 +1,140 @@
+package uploadassets
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+)
+
+func TestUploadAPI(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUploadAssetHandler(&davDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.MaxSize = uint64(shared.GB)
+	handler.Cfg.MaxAssetSize = int64(shared.MB)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html", ".css"}
+
+	srv := httptest.NewServer(handler.UploadAPIHandler())
+	defer srv.Close()
+
+	fixtures := []struct {
+		name     string
+		method   string
+		fpath    string
+		token    string
+		status   int
+		contains string
+		stored   string
+	}{
+		{name: "no-token", method: "POST", fpath: "/api/projects/blog/files/index.html", status: http.StatusUnauthorized},
+		{name: "bad-token", method: "POST", fpath: "/api/projects/blog/files/index.html", token: "wrong", status: http.StatusUnauthorized},
+		{name: "get", method: "GET", fpath: "/api/projects/blog/files/index.html", token: "secret", status: http.StatusMethodNotAllowed},
+		{name: "upload", method: "POST", fpath: "/api/projects/blog/files/css/main.css", token: "secret", status: http.StatusCreated, contains: `"size":11`, stored: "blog/css/main.css"},
+		{name: "climb", method: "POST", fpath: "/api/projects/blog/files/..%2F..%2Fother%2Fa.css", token: "secret", status: http.StatusCreated, stored: "blog/other/a.css"},
+		{name: "invalid", method: "POST", fpath: "/api/projects/blog/files/app.exe", token: "secret", status: http.StatusBadRequest},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			req, err := http.NewRequest(fixture.method, srv.URL+fixture.fpath, strings.NewReader("body {}\n\n\n\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fixture.token != "" {
+				req.Header.Set("authorization", "Bearer "+fixture.token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != fixture.status {
+				t.Fatalf("expected status (%d), got (%d): %s", fixture.status, res.StatusCode, body)
+			}
+			if !strings.Contains(string(body), fixture.contains) {
+				t.Errorf("expected (%s) in %s", fixture.contains, body)
+			}
+			if fixture.stored == "" {
+				return
+			}
+			bucket, err := st.GetBucket("static-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = st.GetObjectSize(bucket, fixture.stored)
+			if err != nil {
+				t.Errorf("expected (%s) to be stored: %s", fixture.stored, err)
+			}
+		})
+	}
+	// a body without a length is still capped at the max file size
+	body := io.MultiReader(strings.NewReader("body {}"), strings.NewReader(strings.Repeat(" ", 2*shared.MB)))
+	req, err := http.NewRequest("POST", srv.URL+"/api/projects/blog/files/big.css", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status (%d), got (%d)", http.StatusRequestEntityTooLarge, res.StatusCode)
+	}
+}
+
+func TestUploadAPIChecksum(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUploadAssetHandler(&davDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.MaxSize = uint64(shared.GB)
+	handler.Cfg.MaxAssetSize = int64(shared.MB)
+	handler.Cfg.Logger = slog.Default()
+
+	srv := httptest.NewServer(handler.UploadAPIHandler())
+	defer srv.Close()
+
+	text := "<h1>hi</h1>"
+	fixtures := []struct {
+		name     string
+		checksum string
+		status   int
+		contains string
+	}{
+		{name: "mismatch", checksum: shared.Shasum([]byte("other")), status: http.StatusBadRequest, contains: "checksum mismatch"},
+		{name: "invalid", checksum: "abc", status: http.StatusBadRequest, contains: "hex encoded sha256"},
+		{name: "first", checksum: shared.Shasum([]byte(text)), status: http.StatusCreated, contains: `"size":11}`},
+		{name: "unchanged", checksum: shared.Shasum([]byte(text)), status: http.StatusOK, contains: `"unchanged":true`},
+	}
+
+	for _, fixture := range fixtures {
+		req, err := http.NewRequest("POST", srv.URL+"/api/projects/blog/files/index.html", strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("authorization", "Bearer secret")
+		req.Header.Set("x-checksum-sha256", fixture.checksum)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != fixture.status || !strings.Contains(string(body), fixture.contains) {
+			t.Fatalf("%s: expected (%d) with (%s), got (%d): %s", fixture.name, fixture.status, fixture.contains, res.StatusCode, body)
+		}
+	}
+}
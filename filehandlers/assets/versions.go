@@ -0,0 +1,69 @@
+package uploadassets
+
+import (
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// versionAsset moves the current copy of fpath to the next version key
+// before it is overwritten and prunes versions beyond `KeepVersions`.
+func (h *UploadAssetHandler) versionAsset(bucket sst.Bucket, fpath string) error {
+	_, err := h.Storage.GetObjectSize(bucket, fpath)
+	if err != nil {
+		// nothing to keep, this is a new file
+		return nil
+	}
+
+	versions, err := storage.FindVersions(h.Storage, bucket, fpath)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+
+	versionName := storage.VersionName(fpath, next)
+	err = storage.CopyObject(h.Storage, bucket, fpath, versionName)
+	if err != nil {
+		return err
+	}
+	versions = append(versions, next)
+
+	h.Cfg.Logger.Info(
+		"kept previous version of file",
+		"bucket", bucket.Name,
+		"filename", fpath,
+		"version", versionName,
+	)
+
+	for len(versions) > h.Cfg.KeepVersions {
+		err = h.Storage.DeleteObject(bucket, storage.VersionName(fpath, versions[0]))
+		if err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+
+	return nil
+}
+
+// versionedDelta is how much an overwrite of fpath with size bytes adds
+// to the bucket when the current copy is kept as a version, minus the
+// versions it pushes out.
+func (h *UploadAssetHandler) versionedDelta(bucket sst.Bucket, fpath string, size int64) (int64, error) {
+	versions, err := storage.FindVersions(h.Storage, bucket, fpath)
+	if err != nil {
+		return 0, err
+	}
+	delta := size
+	for _, version := range versions[:max(len(versions)+1-h.Cfg.KeepVersions, 0)] {
+		pruned, err := h.Storage.GetObjectSize(bucket, storage.VersionName(fpath, version))
+		if err != nil {
+			continue
+		}
+		delta -= pruned
+	}
+	return delta, nil
+}
@@ -0,0 +1,358 @@
+package uploadassets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+	"golang.org/x/net/webdav"
+)
+
+func cleanDavPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// davInfo trims the slash some backends leave on directory names.
+type davInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i *davInfo) Name() string { return i.name }
+
+type davFS struct {
+	h *UploadAssetHandler
+}
+
+func (fs *davFS) list(s *futil.RequestSession, dir string) ([]os.FileInfo, error) {
+	files, err := fs.h.List(s, dir, true, false)
+	if err != nil {
+		return nil, err
+	}
+	infos := []os.FileInfo{}
+	for _, file := range files {
+		name := strings.Trim(file.Name(), "/")
+		if name == "" {
+			continue
+		}
+		infos = append(infos, &davInfo{FileInfo: file, name: name})
+	}
+	return infos, nil
+}
+
+// stat looks the entry up in its parent so files and directories are found
+// the same way on every storage backend. Projects without any files are
+// still directories.
+func (fs *davFS) stat(s *futil.RequestSession, name string) (os.FileInfo, error) {
+	if name == "/" {
+		return &utils.VirtualFile{FName: "/", FIsDir: true}, nil
+	}
+
+	dir, base := path.Split(name)
+	files, err := fs.list(s, dir)
+	if err == nil {
+		for _, file := range files {
+			if file.Name() == base {
+				return file, nil
+			}
+		}
+	}
+
+	if dir == "/" {
+		user, err := futil.GetUser(s)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fs.h.DBPool.FindProjectByName(user.ID, base)
+		if err == nil {
+			return &utils.VirtualFile{FName: base, FIsDir: true}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	s, err := getHTTPSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fs.stat(s, cleanDavPath(name))
+}
+
+// Mkdir creates a project at the root, directories inside a project only
+// exist once they hold a file.
+func (fs *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	s, err := getHTTPSession(ctx)
+	if err != nil {
+		return err
+	}
+	name = cleanDavPath(name)
+	if _, err := fs.stat(s, name); err == nil {
+		return os.ErrExist
+	}
+
+	dir, projectName := path.Split(name)
+	if dir != "/" {
+		return nil
+	}
+
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return err
+	}
+	bucket, err := getBucket(s)
+	if err != nil {
+		return err
+	}
+	unlock := fs.h.projects.lock(user.ID, projectName)
+	defer unlock()
+	_, err = fs.h.findOrCreateProject(s, bucket, user, projectName)
+	return err
+}
+
+func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	s, err := getHTTPSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name = cleanDavPath(name)
+
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if path.Dir(name) == "/" {
+			return nil, os.ErrPermission
+		}
+		return newDavWriter(fs.h, s, name), nil
+	}
+
+	info, err := fs.stat(s, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &davDir{fs: fs, s: s, name: name, info: info}, nil
+	}
+
+	info, contents, err := fs.h.Read(s, &utils.FileEntry{Filepath: name})
+	if err != nil {
+		return nil, err
+	}
+	return &davReader{
+		SectionReader: io.NewSectionReader(contents, 0, info.Size()),
+		contents:      contents,
+		info:          info,
+	}, nil
+}
+
+// RemoveAll deletes a file or every file below a directory one at a time
+// so quotas, sidecars and empty projects are handled like `rm`.
+func (fs *davFS) RemoveAll(ctx context.Context, name string) error {
+	s, err := getHTTPSession(ctx)
+	if err != nil {
+		return err
+	}
+	name = cleanDavPath(name)
+	if name == "/" {
+		return os.ErrPermission
+	}
+
+	info, err := fs.stat(s, name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fs.h.Delete(s, &utils.FileEntry{Filepath: name})
+	}
+
+	bucket, err := getBucket(s)
+	if err != nil {
+		return err
+	}
+	entries, err := storage.WalkObjects(fs.h.Storage, bucket, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Path] = true
+	}
+	for _, entry := range entries {
+		// sidecars go along with the file they were made from
+		if base, ok := storage.SidecarBase(entry.Path); ok && names[base] {
+			continue
+		}
+		err := fs.h.Delete(s, &utils.FileEntry{Filepath: "/" + entry.Path})
+		if err != nil {
+			return err
+		}
+	}
+
+	// a project made with MKCOL has no file whose delete would remove it
+	if dir, projectName := path.Split(name); dir == "/" {
+		user, err := futil.GetUser(s)
+		if err != nil {
+			return err
+		}
+		_, err = fs.h.removeEmptyProject(user, bucket, projectName)
+		return err
+	}
+	return nil
+}
+
+func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return fmt.Errorf("rename is not supported, copy and delete instead")
+}
+
+type davDir struct {
+	fs    *davFS
+	s     *futil.RequestSession
+	name  string
+	info  os.FileInfo
+	files []os.FileInfo
+	read  bool
+}
+
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		files, err := d.fs.list(d.s, d.name)
+		// empty projects and buckets have nothing to list yet
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		d.files = files
+		d.read = true
+	}
+
+	if count <= 0 {
+		files := d.files
+		d.files = nil
+		return files, nil
+	}
+	if len(d.files) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.files))
+	files := d.files[:n]
+	d.files = d.files[n:]
+	return files, nil
+}
+
+func (d *davDir) Stat() (os.FileInfo, error)                { return d.info, nil }
+func (d *davDir) Read(p []byte) (int, error)                { return 0, os.ErrInvalid }
+func (d *davDir) Write(p []byte) (int, error)               { return 0, os.ErrInvalid }
+func (d *davDir) Seek(off int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (d *davDir) Close() error                              { return nil }
+
+type davReader struct {
+	*io.SectionReader
+	contents utils.ReaderAtCloser
+	info     os.FileInfo
+}
+
+func (f *davReader) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *davReader) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *davReader) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+func (f *davReader) Close() error                             { return f.contents.Close() }
+
+// davWriter streams the request body into `Write` as it arrives, the
+// upload only succeeds once Close returns.
+type davWriter struct {
+	pw   *io.PipeWriter
+	name string
+	size int64
+	done chan error
+}
+
+func newDavWriter(h *UploadAssetHandler, s *futil.RequestSession, name string) *davWriter {
+	pr, pw := io.Pipe()
+	w := &davWriter{pw: pw, name: name, done: make(chan error, 1)}
+	go func() {
+		_, err := h.Write(s, &utils.FileEntry{
+			Filepath: name,
+			Mtime:    time.Now().Unix(),
+			Reader:   pr,
+		})
+		// unblock the request if the upload stopped reading early
+		if err != nil {
+			_ = pr.CloseWithError(err)
+		} else {
+			_ = pr.Close()
+		}
+		w.done <- err
+	}()
+	return w
+}
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *davWriter) Close() error {
+	_ = w.pw.Close()
+	return <-w.done
+}
+
+func (w *davWriter) Stat() (os.FileInfo, error) {
+	return &utils.VirtualFile{
+		FName:    path.Base(w.name),
+		FSize:    w.size,
+		FModTime: time.Now(),
+	}, nil
+}
+
+func (w *davWriter) Read(p []byte) (int, error)                { return 0, os.ErrInvalid }
+func (w *davWriter) Seek(off int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (w *davWriter) Readdir(count int) ([]os.FileInfo, error)  { return nil, os.ErrInvalid }
+
+// WebdavHandler serves every project of the user over WebDAV for clients
+// that cannot use ssh. Requests authenticate with the user name and an api
+// token and then go through the same checks as uploads over ssh.
+func (h *UploadAssetHandler) WebdavHandler() http.Handler {
+	dav := &webdav.Handler{
+		FileSystem: &davFS{h: h},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err == nil {
+				return
+			}
+			logger := h.Cfg.Logger
+			if s, serr := getHTTPSession(r.Context()); serr == nil {
+				logger = h.logger(s)
+			}
+			logger.Error(
+				"webdav request failed",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"err", err.Error(),
+			)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := h.authHTTP(w, r, "webdav")
+		if !ok {
+			return
+		}
+		// read-only accounts can still browse and download
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		default:
+			if err := checkDeploy(s); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), ctxHTTPSessionKey{}, s)
+		dav.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,114 @@
+package uploadassets
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+)
+
+type davDB struct {
+	importDB
+}
+
+// FindUserForToken knows a feed token, it must not be able to deploy.
+func (f *davDB) FindUserForToken(token string) (*db.User, error) {
+	if token != "feed" {
+		return nil, db.ErrNameInvalid
+	}
+	return &db.User{ID: "1", Name: "test"}, nil
+}
+
+func (f *davDB) FindUserForScopedToken(token, scope string) (*db.User, error) {
+	if token != "secret" || scope != db.TokenScopeDeploy {
+		return nil, db.ErrNameInvalid
+	}
+	return &db.User{ID: "1", Name: "test"}, nil
+}
+
+func (f *davDB) HasFeatureForUser(userID, feature string) bool {
+	return false
+}
+
+func (f *davDB) FindProjectLinks(userID, projectName string) ([]*db.Project, error) {
+	return []*db.Project{}, nil
+}
+
+func (f *davDB) RemoveProject(projectID string) error {
+	return nil
+}
+
+func TestWebdav(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUploadAssetHandler(&davDB{}, &shared.ConfigSite{}, st)
+	handler.Cfg.MaxSize = uint64(shared.GB)
+	handler.Cfg.MaxAssetSize = int64(shared.MB)
+	handler.Cfg.Logger = slog.Default()
+	handler.Cfg.AllowedExt = []string{".html", ".css"}
+
+	srv := httptest.NewServer(handler.WebdavHandler())
+	defer srv.Close()
+
+	do := func(method, fpath, token, body string) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+fpath, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.SetBasicAuth("test", token)
+		}
+		if method == "PROPFIND" {
+			req.Header.Set("Depth", "1")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(data)
+	}
+
+	fixtures := []struct {
+		name     string
+		method   string
+		fpath    string
+		token    string
+		body     string
+		status   int
+		contains string
+	}{
+		{name: "no-auth", method: "PROPFIND", fpath: "/", status: http.StatusUnauthorized},
+		{name: "bad-token", method: "PROPFIND", fpath: "/", token: "wrong", status: http.StatusUnauthorized},
+		{name: "feed-token", method: "MKCOL", fpath: "/blog", token: "feed", status: http.StatusUnauthorized},
+		{name: "mkcol", method: "MKCOL", fpath: "/blog", token: "secret", status: http.StatusCreated},
+		{name: "put", method: "PUT", fpath: "/blog/index.html", token: "secret", body: "<h1>hi</h1>", status: http.StatusCreated},
+		{name: "put-root", method: "PUT", fpath: "/index.html", token: "secret", body: "<h1>hi</h1>", status: http.StatusNotFound},
+		{name: "put-ext", method: "PUT", fpath: "/blog/app.exe", token: "secret", body: "nope", status: http.StatusMethodNotAllowed},
+		{name: "propfind", method: "PROPFIND", fpath: "/blog", token: "secret", status: http.StatusMultiStatus, contains: "/blog/index.html"},
+		{name: "get", method: "GET", fpath: "/blog/index.html", token: "secret", status: http.StatusOK, contains: "<h1>hi</h1>"},
+		{name: "delete", method: "DELETE", fpath: "/blog", token: "secret", status: http.StatusNoContent},
+		{name: "gone", method: "GET", fpath: "/blog/index.html", token: "secret", status: http.StatusNotFound},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			status, body := do(fixture.method, fixture.fpath, fixture.token, fixture.body)
+			if status != fixture.status {
+				t.Fatalf("expected status (%d), got (%d): %s", fixture.status, status, body)
+			}
+			if !strings.Contains(body, fixture.contains) {
+				t.Errorf("expected (%s) in %s", fixture.contains, body)
+			}
+		})
+	}
+}
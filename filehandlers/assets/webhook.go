@@ -0,0 +1,210 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/webhooks"
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxWebhookEventsKey struct{}
+
+// webhookEvents is the event for every project a session changed. Upload
+// sessions hold on to them until the transfer is done so receivers and the
+// deploy feed see the finished deploy, anything else sends each one right
+// away.
+type webhookEvents struct {
+	mu       sync.Mutex
+	deferred bool
+	events   map[string]string
+	order    []string
+}
+
+func getWebhookEvents(s ssh.Session) *webhookEvents {
+	evts, ok := s.Context().Value(ctxWebhookEventsKey{}).(*webhookEvents)
+	if !ok {
+		evts = &webhookEvents{events: map[string]string{}}
+		s.Context().SetValue(ctxWebhookEventsKey{}, evts)
+	}
+	return evts
+}
+
+// eventRank decides which event wins when a session does several things to
+// one project, a project that is created also counts as updated.
+func eventRank(event string) int {
+	switch event {
+	case webhooks.ProjectDelete:
+		return 2
+	case webhooks.ProjectCreate:
+		return 1
+	}
+	return 0
+}
+
+// recordEvent notes that a session changed projectName, only the first
+// event per project and session is sent unless a later one outranks it.
+func (h *UploadAssetHandler) recordEvent(s ssh.Session, projectName, event string) {
+	if h.isDryRun(s) || projectName == "" {
+		return
+	}
+
+	evts := getWebhookEvents(s)
+	evts.mu.Lock()
+	prev, seen := evts.events[projectName]
+	if seen && eventRank(event) <= eventRank(prev) {
+		evts.mu.Unlock()
+		return
+	}
+	if !seen {
+		evts.order = append(evts.order, projectName)
+	}
+	evts.events[projectName] = event
+	deferred := evts.deferred
+	evts.mu.Unlock()
+
+	if !deferred {
+		h.sendEvent(s, projectName, event)
+	}
+}
+
+func (h *UploadAssetHandler) sendEvent(s ssh.Session, projectName, event string) {
+	h.emit(s, &bus.Event{Topic: event, Project: projectName})
+}
+
+func (h *UploadAssetHandler) flushEvents(s ssh.Session, evts *webhookEvents) {
+	evts.mu.Lock()
+	defer evts.mu.Unlock()
+	for _, projectName := range evts.order {
+		h.sendEvent(s, projectName, evts.events[projectName])
+	}
+}
+
+func (h *UploadAssetHandler) addWebhook(s ssh.Session, url string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	err = webhooks.ValidateURL(url)
+	if err != nil {
+		return "", err
+	}
+
+	hooks, err := h.DBPool.FindWebhooksForUser(user.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(hooks) >= webhooks.MaxPerUser {
+		return "", fmt.Errorf("webhook limit of (%d) reached, remove one first", webhooks.MaxPerUser)
+	}
+	for _, hook := range hooks {
+		if hook.URL == url {
+			return "", fmt.Errorf("webhook (%s) already exists", url)
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	id, err := h.DBPool.InsertWebhook(user.ID, url, secret)
+	if err != nil {
+		return "", err
+	}
+
+	h.logger(s).Info("added webhook", "url", url)
+	return strings.Join([]string{
+		fmt.Sprintf("webhook (%s) added for (%s)", id, url),
+		fmt.Sprintf("secret: %s", secret),
+		fmt.Sprintf("requests are signed with the secret in the `%s` header", webhooks.SignatureHeader),
+	}, "\r\n"), nil
+}
+
+func (h *UploadAssetHandler) listWebhooks(s ssh.Session) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	hooks, err := h.DBPool.FindWebhooksForUser(user.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(hooks) == 0 {
+		return "no webhooks found", nil
+	}
+
+	lines := []string{}
+	for _, hook := range hooks {
+		lines = append(lines, fmt.Sprintf("%s\t%s", hook.ID, hook.URL))
+	}
+	return strings.Join(lines, "\r\n"), nil
+}
+
+func (h *UploadAssetHandler) rmWebhook(s ssh.Session, id string) (string, error) {
+	user, err := futil.GetUser(s)
+	if err != nil {
+		return "", err
+	}
+	err = h.DBPool.RemoveWebhook(user.ID, id)
+	if err != nil {
+		return "", err
+	}
+	h.logger(s).Info("removed webhook", "id", id)
+	return fmt.Sprintf("webhook (%s) removed", id), nil
+}
+
+// WebhookMiddleware handles `command webhook add {url}`, `command webhook
+// ls` and `command webhook rm {id}`. Upload sessions send their events
+// once the whole transfer is done.
+func WebhookMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if isUploadCmd(cmd) {
+				evts := &webhookEvents{deferred: true, events: map[string]string{}}
+				s.Context().SetValue(ctxWebhookEventsKey{}, evts)
+				next(s)
+				h.flushEvents(s, evts)
+				return
+			}
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "webhook") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			if h.Webhooks == nil {
+				utils.ErrorHandler(s, fmt.Errorf("webhooks are not enabled"))
+				return
+			}
+
+			var out string
+			var err error
+			args := cmd[2:]
+			switch {
+			case len(args) == 2 && args[0] == "add":
+				out, err = h.addWebhook(s, args[1])
+			case len(args) == 1 && args[0] == "ls":
+				out, err = h.listWebhooks(s)
+			case len(args) == 2 && args[0] == "rm":
+				out, err = h.rmWebhook(s, args[1])
+			default:
+				err = fmt.Errorf("usage: webhook add {url} | webhook ls | webhook rm {id}")
+			}
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package uploadassets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+var errKeyNotRecognized = fmt.Errorf("key not recognized, add it to your account or create one first")
+
+// whoami resolves the session's key like `Validate` does but never
+// creates a bucket or enforces the feature gate, it only reports.
+func (h *UploadAssetHandler) whoami(s ssh.Session) (string, error) {
+	key, err := shared.KeyText(s)
+	if err != nil {
+		return "", errKeyNotRecognized
+	}
+
+	user, err := h.findUser(s, key)
+	if err != nil || user == nil || user.ID == "" {
+		return "", errKeyNotRecognized
+	}
+
+	lines := []string{fmt.Sprintf("user: %s", user.Name)}
+	if user.State() != db.UserActive {
+		lines = append(lines, fmt.Sprintf("status: %s", user.State()))
+	}
+
+	if len(h.Cfg.RequiredFeatures) > 0 {
+		features := strings.Join(h.Cfg.RequiredFeatures, ", ")
+		ok, err := h.DBPool.HasAnyFeatureForUser(user.ID, h.Cfg.RequiredFeatures...)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			lines = append(lines, fmt.Sprintf("features: ok (one of %s)", features))
+		} else {
+			lines = append(lines, fmt.Sprintf("features: missing, one of (%s) is required to upload", features))
+		}
+	} else {
+		lines = append(lines, "features: none required")
+	}
+
+	_, err = h.Storage.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err != nil {
+		lines = append(lines, "bucket: not created yet, it will be on your first upload")
+	} else {
+		lines = append(lines, "bucket: ok")
+	}
+
+	return strings.Join(lines, "\r\n"), nil
+}
+
+// WhoamiMiddleware handles `command whoami` so operators can check that a
+// key authenticates without uploading anything.
+func WhoamiMiddleware(h *UploadAssetHandler) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "whoami") {
+				next(s)
+				return
+			}
+
+			if err := checkCommand(s); err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+
+			out, err := h.whoami(s)
+			if err != nil {
+				utils.ErrorHandler(s, err)
+				return
+			}
+			_, _ = s.Write([]byte(out + "\r\n"))
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package filehandlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+	"golang.org/x/net/publicsuffix"
+)
+
+// MaxInboundEmailSize keeps an email posted to the gateway to a sane size,
+// the quota of the user still applies to the post made from it.
+var MaxInboundEmailSize = int64(5 * shared.MB)
+
+var errEmailForbidden = errors.New("sender may not post to this address")
+
+// InboundEmail is what the gateway reads from a message.
+type InboundEmail struct {
+	From       string
+	Recipients []string
+	Subject    string
+	Text       string
+	// AuthResults are the Authentication-Results headers the receiving
+	// mail server added
+	AuthResults []string
+}
+
+// ParseInboundEmail reads a raw message, the envelope recipients some
+// servers add as Delivered-To or X-Original-To are recipients too.
+func ParseInboundEmail(raw io.Reader) (*InboundEmail, error) {
+	msg, err := mail.ReadMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+
+	email := &InboundEmail{
+		From:        strings.ToLower(from.Address),
+		AuthResults: msg.Header["Authentication-Results"],
+	}
+	for _, key := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+		for _, value := range msg.Header[key] {
+			addrs, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				email.Recipients = append(email.Recipients, strings.ToLower(addr.Address))
+			}
+		}
+	}
+	email.Subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject: %w", err)
+	}
+
+	text, err := textBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	// everything after the signature delimiter is not part of the post,
+	// quoted-printable drops the space it ends with
+	for i, line := range lines {
+		if strings.TrimRight(line, " ") == "--" {
+			lines = lines[:i]
+			break
+		}
+	}
+	email.Text = strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+	return email, nil
+}
+
+// textBody returns the text/plain part of a message, the first one found
+// in a multipart message.
+func textBody(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	// a message without a content type is plain text
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := textBody(part.Header, part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("email has no text/plain part")
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	text, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// dkimPassed is true when our receiving server, the one named authservID,
+// found a valid dkim signature of domain on the email. Anyone can add an
+// Authentication-Results header so only the topmost one with our id is
+// read, an empty id trusts none. The signer has to be domain or share its
+// registrable domain, a signature of a public suffix like `com` is not
+// enough.
+func dkimPassed(results []string, authservID, domain string) bool {
+	if authservID == "" {
+		return false
+	}
+	for _, result := range results {
+		clauses := strings.Split(strings.ToLower(result), ";")
+		id := strings.Fields(clauses[0])
+		if len(id) == 0 || id[0] != strings.ToLower(authservID) {
+			continue
+		}
+
+		for _, clause := range clauses[1:] {
+			fields := strings.Fields(clause)
+			if len(fields) == 0 || fields[0] != "dkim=pass" {
+				continue
+			}
+			for _, field := range fields[1:] {
+				signer, ok := strings.CutPrefix(field, "header.d=")
+				if ok && sameOrganization(signer, domain) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// sameOrganization is true when both domains are the same or have the same
+// registrable domain, like dmarc's relaxed alignment.
+func sameOrganization(signer, domain string) bool {
+	if signer == domain {
+		return true
+	}
+	org, err := publicsuffix.EffectiveTLDPlusOne(signer)
+	if err != nil {
+		return false
+	}
+	other, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	return err == nil && org == other
+}
+
+// emailFilename is the subject of an email as a file name, a subject that
+// already is one keeps its extension.
+func emailFilename(subject, ext string) (string, error) {
+	subject = strings.TrimSpace(subject)
+	if path.Ext(subject) != "" && !strings.ContainsAny(subject, " /") {
+		return shared.SanitizeFilename(subject)
+	}
+
+	slug := &strings.Builder{}
+	dash := false
+	for _, c := range strings.ToLower(subject) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			slug.WriteRune(c)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteRune('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(slug.String(), "-")
+	if name == "" {
+		return "", fmt.Errorf("email must have a subject, it names the post")
+	}
+	return name + ext, nil
+}
+
+// recipientUser is the name of the user an email to the domain of the
+// space is for, `name+anything@domain` is for name too.
+func (r *FileHandlerRouter) recipientUser(recipients []string) string {
+	domain, _, _ := strings.Cut(strings.ToLower(r.Cfg.Domain), ":")
+	for _, recipient := range recipients {
+		at := strings.LastIndex(recipient, "@")
+		if at < 0 || recipient[at+1:] != domain {
+			continue
+		}
+		name, _, _ := strings.Cut(recipient[:at], "+")
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// postEmail publishes email for the user it is addressed to, named after
+// its subject with ext unless the subject has an extension.
+func (r *FileHandlerRouter) postEmail(req *http.Request, email *InboundEmail, ext string) (string, error) {
+	name := r.recipientUser(email.Recipients)
+	if name == "" {
+		return "", fmt.Errorf("email is not addressed to anyone at (%s)", r.Cfg.Domain)
+	}
+	user, err := r.DBPool.FindUserForName(name)
+	if err != nil || user.IsSuspended() {
+		return "", errEmailForbidden
+	}
+
+	senders, err := r.DBPool.FindPostEmailSenders(user.ID)
+	if err != nil {
+		return "", err
+	}
+	allowed := slices.ContainsFunc(senders, func(sender *db.PostEmailSender) bool {
+		return sender.Email == email.From
+	})
+	if !allowed {
+		return "", errEmailForbidden
+	}
+	_, domain, _ := strings.Cut(email.From, "@")
+	if !dkimPassed(email.AuthResults, r.Cfg.InboundEmailAuthservID, domain) {
+		return "", fmt.Errorf("%w: email is not signed by (%s)", errEmailForbidden, domain)
+	}
+
+	filename, err := emailFilename(email.Subject, ext)
+	if err != nil {
+		return "", err
+	}
+	// an empty file removes the post it is named after
+	if strings.TrimSpace(email.Text) == "" {
+		return "", fmt.Errorf("email has no text")
+	}
+
+	s := util.NewRequestSession(req, user)
+	r.setUser(s, user)
+	return r.Write(s, &utils.FileEntry{
+		Filepath: "/" + filename,
+		Mode:     0o644,
+		Size:     int64(len(email.Text)),
+		Mtime:    time.Now().Unix(),
+		Reader:   strings.NewReader(email.Text),
+	})
+}
+
+// InboundEmailHandler turns an email, posted as its raw message by a mail
+// server or provider with the inbound email secret as a bearer token, into
+// a post of the user it is addressed to. Only the addresses the user added
+// with `command email add` may post, and only with a dkim signature.
+func (r *FileHandlerRouter) InboundEmailHandler(ext string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := r.Cfg.Logger.With("protocol", "email")
+		token, _ := strings.CutPrefix(req.Header.Get("authorization"), "Bearer ")
+		secret := r.Cfg.InboundEmailSecret
+		if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		email, err := ParseInboundEmail(io.LimitReader(req.Body, MaxInboundEmailSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger = logger.With("from", email.From, "subject", email.Subject)
+
+		url, err := r.postEmail(req, email, ext)
+		if err != nil {
+			logger.Info("rejected inbound email", "err", err.Error())
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, errEmailForbidden) || errors.Is(err, db.ErrUserReadOnly) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		logger.Info("posted inbound email", "url", url)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(url + "\n"))
+	}
+}
@@ -0,0 +1,130 @@
+package filehandlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/wish/cms/config"
+)
+
+func TestParseInboundEmail(t *testing.T) {
+	raw := strings.Join([]string{
+		"Authentication-Results: mx.prose.sh; dkim=pass header.d=example.com; spf=pass",
+		"From: Me <Me@Example.com>",
+		"To: erock+blog@prose.sh",
+		"Cc: Friend <friend@example.com>",
+		"Subject: =?utf-8?q?Caf=C3=A9_notes?=",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/alternative; boundary="b1"`,
+		"",
+		"--b1",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"# Caf=C3=A9",
+		"",
+		"a long line that is wrapped by the=",
+		" sender",
+		"-- ",
+		"sent from my phone",
+		"--b1",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<h1>Café</h1>",
+		"--b1--",
+		"",
+	}, "\r\n")
+
+	email, err := ParseInboundEmail(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &InboundEmail{
+		From:        "me@example.com",
+		Recipients:  []string{"erock+blog@prose.sh", "friend@example.com"},
+		Subject:     "Café notes",
+		Text:        "# Café\n\na long line that is wrapped by the sender\n",
+		AuthResults: []string{"mx.prose.sh; dkim=pass header.d=example.com; spf=pass"},
+	}
+	if diff := cmp.Diff(expected, email); diff != "" {
+		t.Error(diff)
+	}
+
+	_, err = ParseInboundEmail(strings.NewReader("From: me@example.com\r\nContent-Type: text/html\r\n\r\n<p>hi</p>"))
+	if err == nil {
+		t.Error("expected an email without text to be rejected")
+	}
+}
+
+func TestDkimPassed(t *testing.T) {
+	fixtures := []struct {
+		results  []string
+		domain   string
+		expected bool
+	}{
+		{results: []string{"mx; dkim=pass header.d=example.com"}, domain: "example.com", expected: true},
+		{results: []string{"MX 1; dkim=pass header.d=example.com"}, domain: "example.com", expected: true},
+		{results: []string{"mx; dkim=pass header.d=example.com"}, domain: "mail.example.com", expected: true},
+		{results: []string{"mx; dkim=pass header.d=mail.example.com"}, domain: "example.com", expected: true},
+		{results: []string{"mx; dkim=pass header.d=example.com"}, domain: "badexample.com"},
+		{results: []string{"mx; dkim=pass header.d=com"}, domain: "example.com"},
+		{results: []string{"mx; dkim=pass header.d=co.uk"}, domain: "example.co.uk"},
+		{results: []string{"mx; dkim=fail header.d=example.com"}, domain: "example.com"},
+		{results: []string{"mx; dkim=pass header.d=other.com", "mx; spf=pass smtp.mailfrom=example.com"}, domain: "example.com"},
+		// a header of another server, or one the sender added below ours
+		{results: []string{"evil; dkim=pass header.d=example.com"}, domain: "example.com"},
+		{results: []string{"mx; dkim=fail header.d=example.com", "mx; dkim=pass header.d=example.com"}, domain: "example.com"},
+		{results: []string{"evil; dkim=pass header.d=example.com", "mx; dkim=pass header.d=example.com"}, domain: "example.com", expected: true},
+		{domain: "example.com"},
+	}
+	for _, fixture := range fixtures {
+		if actual := dkimPassed(fixture.results, "mx", fixture.domain); actual != fixture.expected {
+			t.Errorf("%v for (%s): expected %t", fixture.results, fixture.domain, fixture.expected)
+		}
+	}
+	if dkimPassed([]string{"mx; dkim=pass header.d=example.com"}, "", "example.com") {
+		t.Error("expected no header to be trusted without an authserv-id")
+	}
+}
+
+func TestEmailFilename(t *testing.T) {
+	fixtures := map[string]string{
+		"Hello, World!":   "hello-world.md",
+		"  Café notes  ":  "café-notes.md",
+		"notes.md":        "notes.md",
+		"Re: release 1.2": "re-release-1-2.md",
+	}
+	for subject, expected := range fixtures {
+		filename, err := emailFilename(subject, ".md")
+		if err != nil {
+			t.Fatalf("%s: %s", subject, err)
+		}
+		if filename != expected {
+			t.Errorf("%s: expected (%s), got (%s)", subject, expected, filename)
+		}
+	}
+
+	_, err := emailFilename(" !? ", ".md")
+	if err == nil {
+		t.Error("expected a subject without words to be rejected")
+	}
+}
+
+func TestRecipientUser(t *testing.T) {
+	router := &FileHandlerRouter{Cfg: &shared.ConfigSite{ConfigCms: config.ConfigCms{Domain: "prose.sh:3000"}}}
+	fixtures := []struct {
+		recipients []string
+		expected   string
+	}{
+		{recipients: []string{"friend@example.com", "erock+blog@prose.sh"}, expected: "erock"},
+		{recipients: []string{"erock@prose.sh.evil.com"}},
+		{recipients: []string{"+blog@prose.sh"}},
+	}
+	for _, fixture := range fixtures {
+		if name := router.recipientUser(fixture.recipients); name != fixture.expected {
+			t.Errorf("%v: expected (%s), got (%s)", fixture.recipients, fixture.expected, name)
+		}
+	}
+}
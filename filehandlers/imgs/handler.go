@@ -1,9 +1,11 @@
 package uploadimgs
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -23,6 +25,10 @@ import (
 
 var Space = "imgs"
 
+// KeepExifFeature opts a user out of having exif data stripped from their
+// uploads.
+var KeepExifFeature = "keep_exif"
+
 type PostMetaData struct {
 	*db.Post
 	OrigText []byte
@@ -37,14 +43,32 @@ type UploadImgHandler struct {
 	DBPool  db.DB
 	Cfg     *shared.ConfigSite
 	Storage storage.StorageServe
+	// Variants is nil when no variants are configured
+	Variants *VariantQueue
 }
 
 func NewUploadImgHandler(dbpool db.DB, cfg *shared.ConfigSite, storage storage.StorageServe) *UploadImgHandler {
-	return &UploadImgHandler{
+	h := &UploadImgHandler{
 		DBPool:  dbpool,
 		Cfg:     cfg,
 		Storage: storage,
 	}
+	if len(cfg.ImgVariants) > 0 {
+		h.Variants = NewVariantQueue(storage, cfg.ImgVariants, cfg.ImgVariantWorkers, cfg.Logger)
+	}
+	return h
+}
+
+// Drain waits for the variants of uploaded images until ctx is done.
+func (h *UploadImgHandler) Drain(ctx context.Context) error {
+	if h.Variants == nil {
+		return nil
+	}
+	return h.Variants.Drain(ctx)
+}
+
+func (h *UploadImgHandler) logger(s ssh.Session) *slog.Logger {
+	return shared.SessionLogger(s.Context(), h.Cfg.Logger)
 }
 
 func (h *UploadImgHandler) removePost(data *PostMetaData) error {
@@ -103,14 +127,50 @@ func (h *UploadImgHandler) Read(s ssh.Session, entry *utils.FileEntry) (os.FileI
 	return fileInfo, reader, nil
 }
 
+// stripExif removes the metadata photos carry, like where they were
+// taken. The orientation is kept by turning the pixels instead. Users with
+// KeepExifFeature upload their images untouched.
+func (h *UploadImgHandler) stripExif(s ssh.Session, user *db.User, filename string, text []byte) []byte {
+	logger := h.logger(s).With("filename", filename)
+	if h.DBPool.HasFeatureForUser(user.ID, KeepExifFeature) {
+		logger.Info("user keeps exif data, skipping")
+		return text
+	}
+
+	upright, rotated, err := storage.NormalizeOrientation(text)
+	if err != nil {
+		logger.Error("could not normalize orientation", "err", err.Error())
+	} else if rotated {
+		// re-encoding the pixels left no metadata behind
+		logger.Info("normalized orientation and stripped exif data")
+		return upright
+	}
+
+	noExifBytes, err := exifremove.Remove(text)
+	if err == nil {
+		if len(noExifBytes) == 0 {
+			logger.Info("file silently failed to strip exif data")
+		} else {
+			text = noExifBytes
+			logger.Info("stripped exif data")
+		}
+	} else {
+		logger.Error(err.Error())
+	}
+	return text
+}
+
 func (h *UploadImgHandler) Write(s ssh.Session, entry *utils.FileEntry) (string, error) {
 	user, err := util.GetUser(s)
 	if err != nil {
-		h.Cfg.Logger.Error(err.Error())
+		h.logger(s).Error(err.Error())
 		return "", err
 	}
 
-	filename := filepath.Base(entry.Filepath)
+	filename, err := shared.SanitizeFilename(entry.Filepath)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: invalid file name: %w", err)
+	}
 
 	var text []byte
 	if b, err := io.ReadAll(entry.Reader); err == nil {
@@ -121,19 +181,8 @@ func (h *UploadImgHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 	if ext == ".svg" {
 		mimeType = "image/svg+xml"
 	}
-	// strip exif data
 	if slices.Contains([]string{"image/png", "image/jpg", "image/jpeg"}, mimeType) {
-		noExifBytes, err := exifremove.Remove(text)
-		if err == nil {
-			if len(noExifBytes) == 0 {
-				h.Cfg.Logger.Info("file silently failed to strip exif data", "filename", filename)
-			} else {
-				text = noExifBytes
-				h.Cfg.Logger.Info("stripped exif data", "filename", filename)
-			}
-		} else {
-			h.Cfg.Logger.Error(err.Error())
-		}
+		text = h.stripExif(s, user, filename, text)
 	}
 
 	now := time.Now()
@@ -157,7 +206,7 @@ func (h *UploadImgHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 		Space,
 	)
 	if err != nil {
-		h.Cfg.Logger.Info("unable to find image, continuing", "filename", nextPost.Filename, "err", err.Error())
+		h.logger(s).Info("unable to find image, continuing", "filename", nextPost.Filename, "err", err.Error())
 	}
 
 	featureFlag, err := util.GetFeatureFlag(s)
@@ -179,13 +228,13 @@ func (h *UploadImgHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 
 	err = h.writeImg(s, &metadata)
 	if err != nil {
-		h.Cfg.Logger.Error(err.Error())
+		h.logger(s).Error(err.Error())
 		return "", err
 	}
 
 	totalFileSize, err := h.DBPool.FindTotalSizeForUser(user.ID)
 	if err != nil {
-		h.Cfg.Logger.Error(err.Error())
+		h.logger(s).Error(err.Error())
 		return "", err
 	}
 
@@ -3,6 +3,7 @@ package uploadimgs
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/filehandlers/util"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
 	"github.com/picosh/send/send/utils"
 )
 
@@ -29,6 +31,25 @@ func (h *UploadImgHandler) validateImg(data *PostMetaData) (bool, error) {
 		return false, fmt.Errorf("ERROR: user (%s) has exceeded (%d bytes) max (%d bytes)", data.User.Name, totalFileSize, storageMax)
 	}
 
+	fileCountMax := data.FeatureFlag.Data.FileCountMax
+	if fileCountMax > 0 && data.Cur == nil && data.FileSize > 0 {
+		count, err := h.DBPool.FindPostCountForUser(data.User.ID, Space)
+		if err != nil {
+			return false, err
+		}
+		if count >= fileCountMax {
+			return false, fmt.Errorf("ERROR: user (%s) has reached the max number of images (%d)", data.User.Name, fileCountMax)
+		}
+	}
+
+	if shared.IsExtInList(data.Filepath, h.Cfg.DeniedExt) {
+		return false, fmt.Errorf(
+			"ERROR: (%s) invalid file, extension (%s) is not allowed",
+			data.Filename,
+			strings.ToLower(filepath.Ext(data.Filename)),
+		)
+	}
+
 	if !shared.IsExtAllowed(data.Filepath, h.Cfg.AllowedExt) {
 		extStr := strings.Join(h.Cfg.AllowedExt, ",")
 		err := fmt.Errorf(
@@ -39,6 +60,23 @@ func (h *UploadImgHandler) validateImg(data *PostMetaData) (bool, error) {
 		return false, err
 	}
 
+	if data.FileSize > 0 && storage.MatchContentType(data.MimeType, h.Cfg.DeniedTypes) {
+		return false, fmt.Errorf(
+			"ERROR: (%s) invalid file, content type (%s) is not allowed",
+			data.Filename,
+			data.MimeType,
+		)
+	}
+
+	if data.FileSize > 0 && len(h.Cfg.AllowedTypes) > 0 && !storage.MatchContentType(data.MimeType, h.Cfg.AllowedTypes) {
+		return false, fmt.Errorf(
+			"ERROR: (%s) invalid file, content type (%s) must be one of (%s), skipping",
+			data.Filename,
+			data.MimeType,
+			strings.Join(h.Cfg.AllowedTypes, ","),
+		)
+	}
+
 	return true, nil
 }
 
@@ -87,15 +125,12 @@ func (h *UploadImgHandler) writeImg(s ssh.Session, data *PostMetaData) error {
 
 	err = h.metaImg(data)
 	if err != nil {
-		h.Cfg.Logger.Info(err.Error())
+		h.logger(s).Info(err.Error())
 		return err
 	}
 
 	modTime := time.Unix(data.Mtime, 0)
-	logger := h.Cfg.Logger.With(
-		"user", data.Username,
-		"filename", data.Filename,
-	)
+	logger := h.logger(s).With("filename", data.Filename)
 
 	if len(data.OrigText) == 0 {
 		err = h.removePost(data)
@@ -111,6 +146,9 @@ func (h *UploadImgHandler) writeImg(s ssh.Session, data *PostMetaData) error {
 		if err != nil {
 			return err
 		}
+		if h.Variants != nil {
+			h.Variants.Remove(bucket, data.Filename)
+		}
 	} else if data.Cur == nil {
 		logger.Info("file not found, adding record")
 		insertPost := db.Post{
@@ -147,6 +185,7 @@ func (h *UploadImgHandler) writeImg(s ssh.Session, data *PostMetaData) error {
 				return fmt.Errorf("error for %s: %v", data.Filename, err)
 			}
 		}
+		h.generateVariants(data)
 	} else {
 		if data.Shasum == data.Cur.Shasum && modTime.Equal(*data.Cur.UpdatedAt) {
 			logger.Info("image found, but image is identical, skipping")
@@ -184,7 +223,20 @@ func (h *UploadImgHandler) writeImg(s ssh.Session, data *PostMetaData) error {
 			logger.Error(err.Error())
 			return fmt.Errorf("error for %s: %v", data.Filename, err)
 		}
+		h.generateVariants(data)
 	}
 
 	return nil
 }
+
+func (h *UploadImgHandler) generateVariants(data *PostMetaData) {
+	if h.Variants == nil {
+		return
+	}
+	bucket, err := h.Storage.GetBucket(data.User.ID)
+	if err != nil {
+		h.Cfg.Logger.Error(err.Error(), "filename", data.Filename)
+		return
+	}
+	h.Variants.Generate(bucket, data.Filename)
+}
@@ -0,0 +1,115 @@
+package uploadimgs
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// how many jobs each worker holds before uploads stop queueing more, an
+// image without variants is still served by processing it on request
+const variantQueueSize = 100
+
+type variantJob struct {
+	bucket   sst.Bucket
+	filename string
+	remove   bool
+}
+
+// VariantQueue makes the variants of uploaded images in the background so
+// an upload does not wait for them. Jobs for one image always go to the
+// same worker, a replaced or removed image cannot be overtaken by the
+// variants of what it replaced.
+type VariantQueue struct {
+	Storage  storage.StorageServe
+	Variants []storage.ImgVariant
+	Logger   *slog.Logger
+	workers  []chan variantJob
+	inflight shared.Inflight
+}
+
+func NewVariantQueue(st storage.StorageServe, variants []storage.ImgVariant, workers int, logger *slog.Logger) *VariantQueue {
+	q := &VariantQueue{
+		Storage:  st,
+		Variants: variants,
+		Logger:   logger,
+	}
+	for i := 0; i < max(workers, 1); i++ {
+		jobs := make(chan variantJob, variantQueueSize)
+		q.workers = append(q.workers, jobs)
+		go q.work(jobs)
+	}
+	return q
+}
+
+func (q *VariantQueue) work(jobs chan variantJob) {
+	for job := range jobs {
+		q.run(job)
+		q.inflight.Done()
+	}
+}
+
+func (q *VariantQueue) run(job variantJob) {
+	logger := q.Logger.With("bucket", job.bucket.Name, "filename", job.filename)
+	for _, variant := range q.Variants {
+		fpath := storage.VariantPath(job.filename, variant)
+		if job.remove {
+			err := q.Storage.DeleteObject(job.bucket, fpath)
+			if err != nil {
+				logger.Info("could not remove variant", "variant", variant.Name, "err", err.Error())
+			}
+			continue
+		}
+
+		err := storage.PutImgVariant(q.Storage, job.bucket, job.filename, variant)
+		if errors.Is(err, storage.ErrImgUnsupported) {
+			logger.Debug("variant needs imgproxy, skipping", "variant", variant.Name)
+		} else if err != nil {
+			logger.Error("could not make variant", "variant", variant.Name, "err", err.Error())
+		}
+	}
+}
+
+// enqueue reports false when draining or when the worker for the image is
+// too far behind.
+func (q *VariantQueue) enqueue(job variantJob) bool {
+	if !q.inflight.Start() {
+		return false
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(job.bucket.Name + "/" + job.filename))
+	jobs := q.workers[hash.Sum32()%uint32(len(q.workers))]
+	select {
+	case jobs <- job:
+		return true
+	default:
+		q.inflight.Done()
+		return false
+	}
+}
+
+// Generate queues making every variant of the image.
+func (q *VariantQueue) Generate(bucket sst.Bucket, filename string) {
+	if !q.enqueue(variantJob{bucket: bucket, filename: filename}) {
+		q.Logger.Info("variant queue is full, skipping", "filename", filename)
+	}
+}
+
+// Remove queues removing the variants of a deleted image, behind any
+// job still making them. When it cannot be queued they are removed now.
+func (q *VariantQueue) Remove(bucket sst.Bucket, filename string) {
+	job := variantJob{bucket: bucket, filename: filename, remove: true}
+	if !q.enqueue(job) {
+		q.run(job)
+	}
+}
+
+// Drain stops queueing and waits for queued variants until ctx is done.
+func (q *VariantQueue) Drain(ctx context.Context) error {
+	return q.inflight.Drain(ctx)
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/filehandlers/util"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/bus"
 	"github.com/picosh/pico/shared/storage"
 	"github.com/picosh/send/send/utils"
 )
@@ -74,6 +76,48 @@ func (h *ScpUploadHandler) Read(s ssh.Session, entry *utils.FileEntry) (os.FileI
 	return fileInfo, reader, nil
 }
 
+// checkQuota enforces the limits on the user's feature flag, a limit of 0
+// is not enforced.
+func (h *ScpUploadHandler) checkQuota(s ssh.Session, data *PostMetaData) error {
+	ff, err := util.GetFeatureFlag(s)
+	if err != nil || data.FileSize == 0 {
+		return nil
+	}
+
+	fileMax := ff.Data.FileMax
+	if fileMax > 0 && int64(data.FileSize) > fileMax {
+		return fmt.Errorf("ERROR: file (%s) has exceeded maximum file size (%d bytes)", data.Filename, fileMax)
+	}
+
+	storageMax := ff.Data.StorageMax
+	if storageMax > 0 {
+		totalFileSize, err := h.DBPool.FindTotalSizeForUser(data.User.ID)
+		if err != nil {
+			return err
+		}
+		// an update replaces the size of the current post
+		if data.Cur != nil {
+			totalFileSize -= data.Cur.FileSize
+		}
+		if uint64(totalFileSize+data.FileSize) > storageMax {
+			return fmt.Errorf("ERROR: user (%s) has exceeded (%d bytes) max (%d bytes)", data.User.Name, totalFileSize, storageMax)
+		}
+	}
+
+	fileCountMax := ff.Data.FileCountMax
+	if fileCountMax > 0 && data.Cur == nil {
+		count, err := h.DBPool.FindPostCountForUser(data.User.ID, h.Cfg.Space)
+		if err != nil {
+			return err
+		}
+		if count >= fileCountMax {
+			return fmt.Errorf("ERROR: user (%s) has reached the max number of files (%d)", data.User.Name, fileCountMax)
+		}
+	}
+
+	return nil
+}
+
 func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string, error) {
 	logger := h.Cfg.Logger
 	user, err := util.GetUser(s)
@@ -83,7 +127,10 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 	}
 
 	userID := user.ID
-	filename := filepath.Base(entry.Filepath)
+	filename, err := shared.SanitizeFilename(entry.Filepath)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: invalid file name: %w", err)
+	}
 	logger = logger.With(
 		"user", user.Name,
 		"filename", filename,
@@ -138,6 +185,12 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 		metadata.Post.PublishAt = post.PublishAt
 	}
 
+	err = h.checkQuota(s, &metadata)
+	if err != nil {
+		logger.Error(err.Error())
+		return "", err
+	}
+
 	err = h.Hooks.FileMeta(s, &metadata)
 	if err != nil {
 		logger.Error(err.Error())
@@ -145,7 +198,10 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 	}
 
 	modTime := time.Unix(entry.Mtime, 0)
+	// a date in the future keeps the post out of listings until it is due
+	scheduled := metadata.PublishAt != nil && metadata.PublishAt.After(now)
 
+	action := audit.ActionWrite
 	// if the file is empty we remove it from our database
 	if len(origText) == 0 {
 		// skip empty files from being added to db
@@ -160,6 +216,7 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 			logger.Error(err.Error())
 			return "", fmt.Errorf("error for %s: %v", filename, err)
 		}
+		action = audit.ActionDelete
 	} else if post == nil {
 		logger.Info("file not found, adding record")
 		insertPost := db.Post{
@@ -179,6 +236,7 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 			Title:       metadata.Title,
 			ExpiresAt:   metadata.ExpiresAt,
 			UpdatedAt:   &modTime,
+			Scheduled:   scheduled,
 		}
 		post, err = h.DBPool.InsertPost(&insertPost)
 		if err != nil {
@@ -233,6 +291,7 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 			Hidden:      metadata.Hidden,
 			ExpiresAt:   metadata.ExpiresAt,
 			UpdatedAt:   &modTime,
+			Scheduled:   scheduled,
 		}
 		_, err = h.DBPool.UpdatePost(&updatePost)
 		if err != nil {
@@ -261,6 +320,23 @@ func (h *ScpUploadHandler) Write(s ssh.Session, entry *utils.FileEntry) (string,
 		}
 	}
 
+	change := audit.NewEntry(user, util.GetActor(s), h.Cfg.Space, s.Context().SessionID(), s.RemoteAddr(), action, filename)
+	audit.Record(h.DBPool, logger, change)
+
+	// scheduled and hidden posts are not published yet
+	if action == audit.ActionWrite && !scheduled && !metadata.Hidden && h.Cfg.Events != nil {
+		err = h.Cfg.Events.Publish(&bus.Event{
+			Topic:  bus.PostPublish,
+			UserID: user.ID,
+			User:   user.Name,
+			Space:  h.Cfg.Space,
+			Post:   metadata.Filename,
+		})
+		if err != nil {
+			logger.Error("could not publish event", "topic", bus.PostPublish, "err", err.Error())
+		}
+	}
+
 	curl := shared.NewCreateURL(h.Cfg)
 	return h.Cfg.FullPostURL(curl, user.Name, metadata.Slug), nil
 }
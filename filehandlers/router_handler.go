@@ -1,15 +1,18 @@
 package filehandlers
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/filehandlers/util"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/authn"
 	"github.com/picosh/send/send/utils"
 )
 
@@ -23,18 +26,31 @@ type FileHandlerRouter struct {
 	Cfg     *shared.ConfigSite
 	DBPool  db.DB
 	Spaces  []string
+	// Auth resolves the user of a key, nil only looks up registered keys
+	Auth authn.Authenticator
+	// inflight lets a shutdown wait for uploads that are still running
+	inflight shared.Inflight
 }
 
 var _ utils.CopyFromClientHandler = &FileHandlerRouter{}      // Verify implementation
 var _ utils.CopyFromClientHandler = (*FileHandlerRouter)(nil) // Verify implementation
 
 func NewFileHandlerRouter(cfg *shared.ConfigSite, dbpool db.DB, mapper map[string]ReadWriteHandler) *FileHandlerRouter {
-	return &FileHandlerRouter{
+	router := &FileHandlerRouter{
 		Cfg:     cfg,
 		DBPool:  dbpool,
 		FileMap: mapper,
 		Spaces:  []string{cfg.Space},
 	}
+	if len(cfg.AuthProviders) > 0 {
+		auth, err := authn.FromConfig(cfg, dbpool)
+		if err != nil {
+			cfg.Logger.Error("could not set up auth providers, only registered keys are accepted", "err", err.Error())
+		} else {
+			router.Auth = auth
+		}
+	}
+	return router
 }
 
 func (r *FileHandlerRouter) findHandler(entry *utils.FileEntry) (ReadWriteHandler, error) {
@@ -51,6 +67,16 @@ func (r *FileHandlerRouter) findHandler(entry *utils.FileEntry) (ReadWriteHandle
 }
 
 func (r *FileHandlerRouter) Write(s ssh.Session, entry *utils.FileEntry) (string, error) {
+	if !r.inflight.Start() {
+		return "", shared.ErrShuttingDown
+	}
+	defer r.inflight.Done()
+
+	// read-only accounts can still list and download their posts
+	if user, err := util.GetUser(s); err == nil && user.IsReadOnly() {
+		return "", db.ErrUserReadOnly
+	}
+
 	handler, err := r.findHandler(entry)
 	if err != nil {
 		return "", err
@@ -58,6 +84,11 @@ func (r *FileHandlerRouter) Write(s ssh.Session, entry *utils.FileEntry) (string
 	return handler.Write(s, entry)
 }
 
+// Drain refuses new uploads and waits for running ones until ctx is done.
+func (r *FileHandlerRouter) Drain(ctx context.Context) error {
+	return r.inflight.Drain(ctx)
+}
+
 func (r *FileHandlerRouter) Read(s ssh.Session, entry *utils.FileEntry) (os.FileInfo, utils.ReaderAtCloser, error) {
 	handler, err := r.findHandler(entry)
 	if err != nil {
@@ -114,21 +145,37 @@ func (r *FileHandlerRouter) List(s ssh.Session, fpath string, isDir bool, recurs
 	}
 
 	for _, post := range posts {
-		fileList = append(fileList, &utils.VirtualFile{
-			FName:    post.Filename,
-			FIsDir:   false,
-			FSize:    int64(post.FileSize),
-			FModTime: *post.UpdatedAt,
+		fileList = append(fileList, &postFile{
+			VirtualFile: &utils.VirtualFile{
+				FName:    post.Filename,
+				FIsDir:   false,
+				FSize:    int64(post.FileSize),
+				FModTime: *post.UpdatedAt,
+			},
+			expiresAt: post.ExpiresAt,
 		})
 	}
 
 	return fileList, nil
 }
 
+// postFile is a listed post, `command ls --expiring` picks up when pastes
+// are deleted from it.
+type postFile struct {
+	*utils.VirtualFile
+	expiresAt *time.Time
+}
+
+func (f *postFile) ExpiresAt() *time.Time { return f.expiresAt }
+
 func (r *FileHandlerRouter) GetLogger() *slog.Logger {
 	return r.Cfg.Logger
 }
 
+func (r *FileHandlerRouter) logger(s ssh.Session) *slog.Logger {
+	return shared.SessionLogger(s.Context(), r.Cfg.Logger)
+}
+
 func (r *FileHandlerRouter) Validate(s ssh.Session) error {
 	var err error
 	key, err := utils.KeyText(s)
@@ -136,7 +183,12 @@ func (r *FileHandlerRouter) Validate(s ssh.Session) error {
 		return fmt.Errorf("key not found")
 	}
 
-	user, err := r.DBPool.FindUserForKey(s.User(), key)
+	var user *db.User
+	if r.Auth != nil {
+		user, err = r.Auth.Authenticate(s.User(), key)
+	} else {
+		user, err = r.DBPool.FindUserForKey(s.User(), key)
+	}
 	if err != nil {
 		return err
 	}
@@ -145,16 +197,28 @@ func (r *FileHandlerRouter) Validate(s ssh.Session) error {
 		return fmt.Errorf("must have username set")
 	}
 
+	if user.IsSuspended() {
+		return db.ErrUserSuspended
+	}
+
+	r.setUser(s, user)
+	r.logger(s).Info("attempting to upload files", "space", r.Cfg.Space)
+	return nil
+}
+
+// setUser makes user the one the session uploads as, with the limits of
+// their feature flag.
+func (r *FileHandlerRouter) setUser(s ssh.Session, user *db.User) {
 	ff, _ := r.DBPool.FindFeatureForUser(user.ID, r.Cfg.Space)
 	// we have free tiers so users might not have a feature flag
 	// in which case we set sane defaults
 	if ff == nil {
-		ff = db.NewFeatureFlag(
-			user.ID,
-			r.Cfg.Space,
-			r.Cfg.MaxSize,
-			r.Cfg.MaxAssetSize,
-		)
+		ff = db.NewFeatureFlag(user.ID, r.Cfg.Space, 0, 0)
+	}
+	// a plan fills in whatever the user's own flag leaves unset
+	quota, err := r.DBPool.FindQuotaForUser(user.ID, r.Cfg.Space)
+	if err == nil {
+		ff.ApplyQuota(quota)
 	}
 	// this is jank
 	ff.Data.StorageMax = ff.FindStorageMax(r.Cfg.MaxSize)
@@ -162,7 +226,4 @@ func (r *FileHandlerRouter) Validate(s ssh.Session) error {
 
 	util.SetUser(s, user)
 	util.SetFeatureFlag(s, ff)
-
-	r.Cfg.Logger.Info("attempting to upload files", "user", user.Name, "space", r.Cfg.Space)
-	return nil
 }
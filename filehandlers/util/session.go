@@ -0,0 +1,85 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/picosh/pico/db"
+)
+
+// sessionContext stands in for the ssh context of a session, each request
+// is handled as a session of its own.
+type sessionContext struct {
+	context.Context
+	sync.Mutex
+	mu     sync.RWMutex
+	user   string
+	remote net.Addr
+	values map[interface{}]interface{}
+}
+
+func (c *sessionContext) Value(key interface{}) interface{} {
+	c.mu.RLock()
+	v, ok := c.values[key]
+	c.mu.RUnlock()
+	if ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (c *sessionContext) SetValue(key, value interface{}) {
+	c.mu.Lock()
+	c.values[key] = value
+	c.mu.Unlock()
+}
+
+func (c *sessionContext) User() string                  { return c.user }
+func (c *sessionContext) SessionID() string             { return "" }
+func (c *sessionContext) ClientVersion() string         { return "" }
+func (c *sessionContext) ServerVersion() string         { return "" }
+func (c *sessionContext) RemoteAddr() net.Addr          { return c.remote }
+func (c *sessionContext) LocalAddr() net.Addr           { return nil }
+func (c *sessionContext) Permissions() *ssh.Permissions { return nil }
+
+// RequestSession lets the file handlers serve an http request, e.g. a
+// webdav upload or an inbound email, as if it came over ssh. It only
+// implements what the handlers read from a session, there is no key,
+// command or terminal and what is written to stderr is kept.
+type RequestSession struct {
+	ssh.Session
+	ctx    *sessionContext
+	stderr bytes.Buffer
+}
+
+func (s *RequestSession) Context() ssh.Context     { return s.ctx }
+func (s *RequestSession) Command() []string        { return nil }
+func (s *RequestSession) User() string             { return s.ctx.user }
+func (s *RequestSession) PublicKey() ssh.PublicKey { return nil }
+func (s *RequestSession) RemoteAddr() net.Addr     { return s.ctx.remote }
+func (s *RequestSession) Stderr() io.ReadWriter    { return &s.stderr }
+func (s *RequestSession) Environ() []string        { return nil }
+func (s *RequestSession) Subsystem() string        { return "" }
+func (s *RequestSession) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	return ssh.Pty{}, nil, false
+}
+
+func NewRequestSession(r *http.Request, user *db.User) *RequestSession {
+	var remote net.Addr
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remote = addr
+	}
+	return &RequestSession{
+		ctx: &sessionContext{
+			Context: r.Context(),
+			user:    user.Name,
+			remote:  remote,
+			values:  map[interface{}]interface{}{},
+		},
+	}
+}
@@ -5,10 +5,12 @@ import (
 
 	"github.com/charmbracelet/ssh"
 	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
 )
 
 type ctxUserKey struct{}
 type ctxFeatureFlagKey struct{}
+type ctxActorKey struct{}
 
 func GetUser(s ssh.Session) (*db.User, error) {
 	user, ok := s.Context().Value(ctxUserKey{}).(*db.User)
@@ -18,8 +20,25 @@ func GetUser(s ssh.Session) (*db.User, error) {
 	return user, nil
 }
 
+// SetUser also tags the session logger so later lines name the user.
 func SetUser(s ssh.Session, user *db.User) {
 	s.Context().SetValue(ctxUserKey{}, user)
+	shared.AddSessionAttrs(s.Context(), "user", user.Name)
+}
+
+// GetActor is who is behind the session, it is only different from
+// GetUser when a member acts for an organization.
+func GetActor(s ssh.Session) *db.User {
+	actor, ok := s.Context().Value(ctxActorKey{}).(*db.User)
+	if ok {
+		return actor
+	}
+	user, _ := GetUser(s)
+	return user
+}
+
+func SetActor(s ssh.Session, actor *db.User) {
+	s.Context().SetValue(ctxActorKey{}, actor)
 }
 
 func GetFeatureFlag(s ssh.Session) (*db.FeatureFlag, error) {
@@ -13,7 +13,7 @@ import (
 
 	"github.com/gorilla/feeds"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/pgs"
 	"github.com/picosh/pico/shared"
 	"github.com/picosh/pico/shared/storage"
@@ -39,7 +39,7 @@ func ImgsListHandler(w http.ResponseWriter, r *http.Request) {
 	logger := shared.GetLogger(r)
 	cfg := shared.GetCfg(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "username", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -176,7 +176,7 @@ func ImgRequest(w http.ResponseWriter, r *http.Request) {
 	logger := shared.GetLogger(r)
 	username := shared.GetUsernameFromRequest(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("rss feed not found", "user", username)
 		http.Error(w, "rss feed not found", http.StatusNotFound)
@@ -193,22 +193,30 @@ func ImgRequest(w http.ResponseWriter, r *http.Request) {
 		imgOpts, _ = url.PathUnescape(shared.GetField(r, 1))
 	}
 
-	opts, err := storage.UriToImgProcessOpts(imgOpts)
-	if err != nil {
-		errMsg := fmt.Sprintf("error processing img options: %s", err.Error())
-		logger.Info(errMsg)
-		http.Error(w, errMsg, http.StatusUnprocessableEntity)
-		return
-	}
+	// a variant not made yet is processed on request with the same options
+	variant, isVariant := storage.FindImgVariant(cfg.ImgVariants, imgOpts)
+	var opts *storage.ImgProcessOpts
+	if isVariant {
+		variantOpts := *variant.Opts
+		opts = &variantOpts
+	} else {
+		opts, err = storage.UriToImgProcessOpts(imgOpts)
+		if err != nil {
+			errMsg := fmt.Sprintf("error processing img options: %s", err.Error())
+			logger.Info(errMsg)
+			http.Error(w, errMsg, http.StatusUnprocessableEntity)
+			return
+		}
 
-	// set default quality for web optimization
-	if opts.Quality == 0 {
-		opts.Quality = 80
-	}
+		// set default quality for web optimization
+		if opts.Quality == 0 {
+			opts.Quality = 80
+		}
 
-	// set default format to be webp
-	if opts.Ext == "" {
-		opts.Ext = "webp"
+		// set default format to be webp
+		if opts.Ext == "" {
+			opts.Ext = "webp"
+		}
 	}
 
 	ext := filepath.Ext(slug)
@@ -233,9 +241,23 @@ func ImgRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fname := post.Filename
+	if isVariant && hasVariant(r, user, fname, variant) {
+		pgs.ServeAsset(storage.VariantPath(fname, variant), nil, true, anyPerm, w, r)
+		return
+	}
 	pgs.ServeAsset(fname, opts, true, anyPerm, w, r)
 }
 
+func hasVariant(r *http.Request, user *db.User, fname string, variant storage.ImgVariant) bool {
+	st := shared.GetStorage(r)
+	bucket, err := st.GetBucket(shared.GetImgsBucketName(user.ID))
+	if err != nil {
+		return false
+	}
+	_, err = st.GetObjectSize(bucket, storage.VariantPath(fname, variant))
+	return err == nil
+}
+
 func FindImgPost(r *http.Request, user *db.User, slug string) (*db.Post, error) {
 	dbpool := shared.GetDB(r)
 	return dbpool.FindPostWithSlug(slug, user.ID, Space)
@@ -299,16 +321,12 @@ func StartApiServer() {
 	cfg := NewConfigSite()
 	logger := cfg.Logger
 
-	db := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	db := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer db.Close()
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
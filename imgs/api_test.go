@@ -0,0 +1,50 @@
+package imgs
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared"
+)
+
+func TestSuspendedUser(t *testing.T) {
+	dbpool := memory.NewDB(slog.Default())
+	user, err := dbpool.RegisterUser("snapper", "ssh-ed25519 snapper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &shared.ConfigSite{}
+	cfg.Space = Space
+	cfg.Logger = slog.Default()
+	httpCtx := &shared.HttpCtx{Cfg: cfg, Dbpool: dbpool}
+	router := shared.CreateServeBasic(createMainRoutes(nil), httpCtx.CreateCtx(context.Background(), ""))
+
+	// the image does not exist, only an active user gets as far as
+	// looking for it
+	fixtures := []struct {
+		name      string
+		suspended bool
+		body      string
+	}{
+		{name: "active", body: "image not found"},
+		{name: "suspended", suspended: true, body: "rss feed not found"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			err := dbpool.SetUserSuspended(user.ID, fixture.suspended, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			router(w, httptest.NewRequest("GET", "/snapper/cat.jpg", nil))
+			if !strings.Contains(w.Body.String(), fixture.body) {
+				t.Fatalf("expected %q, found (%d) %q", fixture.body, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package imgs
 
 import (
+	"strconv"
+
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/clientip"
+	"github.com/picosh/pico/shared/storage"
 	"github.com/picosh/pico/wish/cms/config"
 )
 
@@ -15,36 +19,50 @@ func NewConfigSite() *shared.ConfigSite {
 	protocol := shared.GetEnv("IMGS_PROTOCOL", "https")
 	allowRegister := shared.GetEnv("IMGS_ALLOW_REGISTER", "1")
 	storageDir := shared.GetEnv("IMGS_STORAGE_DIR", ".storage")
+	storageBackend := shared.GetEnv("STORAGE_BACKEND", "")
 	minioURL := shared.GetEnv("MINIO_URL", "")
 	minioUser := shared.GetEnv("MINIO_ROOT_USER", "")
 	minioPass := shared.GetEnv("MINIO_ROOT_PASSWORD", "")
 	dbURL := shared.GetEnv("DATABASE_URL", "")
+	trustedProxies := shared.GetEnv("TRUSTED_PROXIES", clientip.PrivateRanges)
 	useImgProxy := shared.GetEnv("USE_IMGPROXY", "1")
+	imgVariants, _ := storage.ParseImgVariants(shared.GetEnv("IMGS_VARIANTS", "t=200x200,m=x500"))
+	imgVariantWorkers, _ := strconv.Atoi(shared.GetEnv("IMGS_VARIANT_WORKERS", "2"))
+	deniedExt := shared.GetEnv("IMGS_DENIED_EXT", "")
+	allowedTypes := shared.GetEnv("IMGS_ALLOWED_TYPES", "image/")
+	deniedTypes := shared.GetEnv("IMGS_DENIED_TYPES", "")
 
 	intro := "To get started, enter a username.\n"
 	intro += "To learn next steps go to our docs at https://pico.sh/imgs\n"
 
 	cfg := shared.ConfigSite{
 		Debug:                debug == "1",
+		TrustedProxies:       clientip.ParseTrusted(shared.SplitList(trustedProxies)),
 		SubdomainsEnabled:    subdomains == "1",
 		CustomdomainsEnabled: customdomains == "1",
 		UseImgProxy:          useImgProxy == "1",
+		ImgVariants:          imgVariants,
+		ImgVariantWorkers:    imgVariantWorkers,
+		DeniedExt:            shared.SplitList(deniedExt),
+		AllowedTypes:         shared.SplitList(allowedTypes),
+		DeniedTypes:          shared.SplitList(deniedTypes),
 		ConfigCms: config.ConfigCms{
-			Domain:        domain,
-			Email:         email,
-			Port:          port,
-			Protocol:      protocol,
-			DbURL:         dbURL,
-			StorageDir:    storageDir,
-			MinioURL:      minioURL,
-			MinioUser:     minioUser,
-			MinioPass:     minioPass,
-			Description:   "An image hosting service for hackers.",
-			IntroText:     intro,
-			Space:         "imgs",
-			AllowedExt:    []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".ico"},
-			Logger:        shared.CreateLogger(debug == "1"),
-			AllowRegister: allowRegister == "1",
+			Domain:         domain,
+			Email:          email,
+			Port:           port,
+			Protocol:       protocol,
+			DbURL:          dbURL,
+			StorageDir:     storageDir,
+			StorageBackend: storageBackend,
+			MinioURL:       minioURL,
+			MinioUser:      minioUser,
+			MinioPass:      minioPass,
+			Description:    "An image hosting service for hackers.",
+			IntroText:      intro,
+			Space:          "imgs",
+			AllowedExt:     []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".ico"},
+			Logger:         shared.CreateLogger("imgs", debug == "1"),
+			AllowRegister:  allowRegister == "1",
 		},
 	}
 
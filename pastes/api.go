@@ -3,14 +3,18 @@ package pastes
 import (
 	"fmt"
 	"html/template"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
+	"github.com/picosh/pico/filehandlers"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bus"
 	"github.com/picosh/pico/shared/storage"
 )
 
@@ -46,6 +50,7 @@ type PostPageData struct {
 	PageTitle    string
 	URL          template.URL
 	RawURL       template.URL
+	DownloadURL  template.URL
 	BlogURL      template.URL
 	Title        string
 	Description  string
@@ -55,6 +60,7 @@ type PostPageData struct {
 	PublishAtISO string
 	PublishAt    string
 	ExpiresAt    string
+	Lang         string
 }
 
 type TransparencyPageData struct {
@@ -80,7 +86,7 @@ func blogHandler(w http.ResponseWriter, r *http.Request) {
 	logger := shared.GetLogger(r)
 	cfg := shared.GetCfg(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -169,7 +175,7 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 	dbpool := shared.GetDB(r)
 	logger := shared.GetLogger(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -181,7 +187,14 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 	var data PostPageData
 	post, err := dbpool.FindPostWithSlug(slug, user.ID, cfg.Space)
 	if err == nil {
-		parsedText, err := ParseText(post.Filename, post.Text)
+		_, text := splitFrontMatter(post.Text)
+		// fragments never reach us so highlighted lines travel in `hl`,
+		// e.g. `?hl=L10-L20#L10`
+		opts := ParseOpts{
+			Lang:  r.URL.Query().Get("lang"),
+			Lines: parseLines(r.URL.Query().Get("hl")),
+		}
+		parsedText, lang, err := ParseText(post.Filename, text, opts)
 		if err != nil {
 			logger.Error(err.Error())
 		}
@@ -195,6 +208,7 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 			PageTitle:    post.Filename,
 			URL:          template.URL(cfg.PostURL(post.Username, post.Slug)),
 			RawURL:       template.URL(cfg.RawPostURL(post.Username, post.Slug)),
+			DownloadURL:  template.URL(cfg.DownloadPostURL(post.Username, post.Slug)),
 			BlogURL:      template.URL(cfg.BlogURL(username)),
 			Description:  post.Description,
 			Title:        post.Filename,
@@ -204,6 +218,7 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 			BlogName:     blogName,
 			Contents:     template.HTML(parsedText),
 			ExpiresAt:    expiresAt,
+			Lang:         lang,
 		}
 	} else {
 		logger.Info("post not found", "user", username, "slug", slug)
@@ -237,7 +252,9 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func postHandlerRaw(w http.ResponseWriter, r *http.Request) {
+// findPaste loads the paste a request is for, it answers with a 404 when
+// there is none.
+func findPaste(w http.ResponseWriter, r *http.Request) (*db.Post, bool) {
 	username := shared.GetUsernameFromRequest(r)
 	subdomain := shared.GetSubdomain(r)
 	cfg := shared.GetCfg(r)
@@ -252,24 +269,51 @@ func postHandlerRaw(w http.ResponseWriter, r *http.Request) {
 	dbpool := shared.GetDB(r)
 	logger := shared.GetLogger(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
-		return
+		return nil, false
 	}
 
 	post, err := dbpool.FindPostWithSlug(slug, user.ID, cfg.Space)
 	if err != nil {
 		logger.Info("post not found", "user", username, "slug", slug)
 		http.Error(w, "post not found", http.StatusNotFound)
+		return nil, false
+	}
+	return post, true
+}
+
+func postHandlerRaw(w http.ResponseWriter, r *http.Request) {
+	post, ok := findPaste(w, r)
+	if !ok {
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
-	_, err = w.Write([]byte(post.Text))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, text := splitFrontMatter(post.Text)
+	_, err := w.Write([]byte(text))
 	if err != nil {
-		logger.Error(err.Error())
+		shared.GetLogger(r).Error(err.Error())
+	}
+}
+
+func postHandlerDownload(w http.ResponseWriter, r *http.Request) {
+	post, ok := findPaste(w, r)
+	if !ok {
+		return
+	}
+
+	_, text := splitFrontMatter(post.Text)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": post.Filename,
+	}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(text)))
+	_, err := w.Write([]byte(text))
+	if err != nil {
+		shared.GetLogger(r).Error(err.Error())
 	}
 }
 
@@ -324,6 +368,8 @@ func createMainRoutes(staticRoutes []shared.Route) []shared.Route {
 		shared.NewRoute("GET", "/([^/]+)/([^/]+)", postHandler),
 		shared.NewRoute("GET", "/([^/]+)/([^/]+)/raw", postHandlerRaw),
 		shared.NewRoute("GET", "/raw/([^/]+)/([^/]+)", postHandlerRaw),
+		shared.NewRoute("GET", "/([^/]+)/([^/]+)/download", postHandlerDownload),
+		shared.NewRoute("GET", "/download/([^/]+)/([^/]+)", postHandlerDownload),
 	)
 
 	return routes
@@ -344,6 +390,8 @@ func createSubdomainRoutes(staticRoutes []shared.Route) []shared.Route {
 		shared.NewRoute("GET", "/([^/]+)", postHandler),
 		shared.NewRoute("GET", "/([^/]+)/raw", postHandlerRaw),
 		shared.NewRoute("GET", "/raw/([^/]+)", postHandlerRaw),
+		shared.NewRoute("GET", "/([^/]+)/download", postHandlerDownload),
+		shared.NewRoute("GET", "/download/([^/]+)", postHandlerDownload),
 	)
 
 	return routes
@@ -351,17 +399,13 @@ func createSubdomainRoutes(staticRoutes []shared.Route) []shared.Route {
 
 func StartApiServer() {
 	cfg := NewConfigSite()
-	db := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	db := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer db.Close()
 	logger := cfg.Logger
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
@@ -379,6 +423,17 @@ func StartApiServer() {
 	mainRoutes := createMainRoutes(staticRoutes)
 	subdomainRoutes := createSubdomainRoutes(staticRoutes)
 
+	if cfg.InboundEmailSecret != "" {
+		cfg.Events = bus.Open(cfg.EventBusURL, logger)
+		defer cfg.Events.Close()
+		hooks := &FileHooks{Cfg: cfg, Db: db}
+		fileMap := map[string]filehandlers.ReadWriteHandler{
+			"fallback": filehandlers.NewScpPostHandler(db, cfg, hooks, st),
+		}
+		posts := filehandlers.NewFileHandlerRouter(cfg, db, fileMap)
+		mainRoutes = append(mainRoutes, shared.NewRoute("POST", "/_inbound/email", posts.InboundEmailHandler(".txt")))
+	}
+
 	httpCtx := &shared.HttpCtx{
 		Cfg:     cfg,
 		Dbpool:  db,
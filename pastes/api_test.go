@@ -0,0 +1,62 @@
+package pastes
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared"
+)
+
+func TestSuspendedUser(t *testing.T) {
+	dbpool := memory.NewDB(slog.Default())
+	user, err := dbpool.RegisterUser("paster", "ssh-ed25519 paster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	_, err = dbpool.InsertPost(&db.Post{
+		UserID:    user.ID,
+		Filename:  "hello.txt",
+		Slug:      "hello.txt",
+		Text:      "hello",
+		Space:     "pastes",
+		PublishAt: &now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &shared.ConfigSite{}
+	cfg.Space = "pastes"
+	cfg.Logger = slog.Default()
+	httpCtx := &shared.HttpCtx{Cfg: cfg, Dbpool: dbpool}
+	router := shared.CreateServeBasic(createMainRoutes(nil), httpCtx.CreateCtx(context.Background(), ""))
+
+	fixtures := []struct {
+		name      string
+		suspended bool
+		status    int
+	}{
+		{name: "active", status: http.StatusOK},
+		{name: "suspended", suspended: true, status: http.StatusNotFound},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			err := dbpool.SetUserSuspended(user.ID, fixture.suspended, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			router(w, httptest.NewRequest("GET", "/raw/paster/hello.txt", nil))
+			if w.Code != fixture.status {
+				t.Fatalf("expected status (%d), found (%d): %s", fixture.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package pastes
 
 import (
+	"time"
+
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/clientip"
 	"github.com/picosh/pico/wish/cms/config"
 )
 
@@ -13,37 +16,53 @@ func NewConfigSite() *shared.ConfigSite {
 	customdomains := shared.GetEnv("PASTES_CUSTOMDOMAINS", "0")
 	port := shared.GetEnv("PASTES_WEB_PORT", "3000")
 	dbURL := shared.GetEnv("DATABASE_URL", "")
+	trustedProxies := shared.GetEnv("TRUSTED_PROXIES", clientip.PrivateRanges)
+	sessionIdleTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_IDLE_TIMEOUT", "15m"))
+	sessionMaxTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_MAX_TIMEOUT", "6h"))
+	sessionKeepAlive, _ := time.ParseDuration(shared.GetEnv("SSH_KEEPALIVE_INTERVAL", "30s"))
 	protocol := shared.GetEnv("PASTES_PROTOCOL", "https")
 	allowRegister := shared.GetEnv("PASTES_ALLOW_REGISTER", "1")
 	storageDir := shared.GetEnv("IMGS_STORAGE_DIR", ".storage")
+	storageBackend := shared.GetEnv("STORAGE_BACKEND", "")
 	minioURL := shared.GetEnv("MINIO_URL", "")
 	minioUser := shared.GetEnv("MINIO_ROOT_USER", "")
 	minioPass := shared.GetEnv("MINIO_ROOT_PASSWORD", "")
 	useImgProxy := shared.GetEnv("USE_IMGPROXY", "1")
+	inboundEmailSecret := shared.GetEnv("PASTES_INBOUND_EMAIL_SECRET", "")
+	inboundEmailAuthservID := shared.GetEnv("PASTES_INBOUND_EMAIL_AUTHSERV_ID", "")
+	eventBusURL := shared.GetEnv("EVENT_BUS_URL", "")
 
 	intro := "To get started, enter a username.\n"
 	intro += "To learn next steps go to our docs at https://pico.sh/pastes\n"
 
 	return &shared.ConfigSite{
-		Debug:                debug == "1",
-		SubdomainsEnabled:    subdomains == "1",
-		CustomdomainsEnabled: customdomains == "1",
-		UseImgProxy:          useImgProxy == "1",
+		Debug:                  debug == "1",
+		TrustedProxies:         clientip.ParseTrusted(shared.SplitList(trustedProxies)),
+		SessionIdleTimeout:     sessionIdleTimeout,
+		SessionMaxTimeout:      sessionMaxTimeout,
+		SessionKeepAlive:       sessionKeepAlive,
+		SubdomainsEnabled:      subdomains == "1",
+		CustomdomainsEnabled:   customdomains == "1",
+		UseImgProxy:            useImgProxy == "1",
+		InboundEmailSecret:     inboundEmailSecret,
+		InboundEmailAuthservID: inboundEmailAuthservID,
+		EventBusURL:            eventBusURL,
 		ConfigCms: config.ConfigCms{
-			Domain:        domain,
-			Port:          port,
-			Protocol:      protocol,
-			Email:         email,
-			DbURL:         dbURL,
-			StorageDir:    storageDir,
-			MinioURL:      minioURL,
-			MinioUser:     minioUser,
-			MinioPass:     minioPass,
-			Description:   "A pastebin for hackers.",
-			IntroText:     intro,
-			Space:         "pastes",
-			Logger:        shared.CreateLogger(debug == "1"),
-			AllowRegister: allowRegister == "1",
+			Domain:         domain,
+			Port:           port,
+			Protocol:       protocol,
+			Email:          email,
+			DbURL:          dbURL,
+			StorageDir:     storageDir,
+			StorageBackend: storageBackend,
+			MinioURL:       minioURL,
+			MinioUser:      minioUser,
+			MinioPass:      minioPass,
+			Description:    "A pastebin for hackers.",
+			IntroText:      intro,
+			Space:          "pastes",
+			Logger:         shared.CreateLogger("pastes", debug == "1"),
+			AllowRegister:  allowRegister == "1",
 		},
 	}
 }
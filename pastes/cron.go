@@ -14,11 +14,17 @@ func deleteExpiredPosts(cfg *shared.ConfigSite, dbpool db.DB) error {
 		return err
 	}
 
+	if len(posts) == 0 {
+		return nil
+	}
+
 	postIds := []string{}
 	for _, post := range posts {
 		postIds = append(postIds, post.ID)
+		cfg.Logger.Info("deleting expired post", "user", post.Username, "filename", post.Filename, "expiresAt", post.ExpiresAt)
 	}
 
+	// pastes only live in the database, removing the rows removes them
 	cfg.Logger.Info("deleting expired posts", "len", len(postIds))
 	err = dbpool.RemovePosts(postIds)
 	if err != nil {
@@ -28,6 +34,8 @@ func deleteExpiredPosts(cfg *shared.ConfigSite, dbpool db.DB) error {
 	return nil
 }
 
+// CronDeleteExpiredPosts is the reaper for pastes past their `expires`,
+// see parseExpires.
 func CronDeleteExpiredPosts(cfg *shared.ConfigSite, dbpool db.DB) {
 	for {
 		err := deleteExpiredPosts(cfg, dbpool)
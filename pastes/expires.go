@@ -0,0 +1,84 @@
+package pastes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+)
+
+// parseExpires reads when a paste should be deleted: a duration like `1h`,
+// `7d` or `2w`, a date, or `false` to keep the paste forever. `true` keeps
+// the default of DEFAULT_EXPIRES_AT days. A nil time with found set never
+// expires.
+func parseExpires(val string, now time.Time) (expiresAt *time.Time, found bool, err error) {
+	val = strings.TrimSpace(val)
+	if keep, err := strconv.ParseBool(val); err == nil {
+		return nil, !keep, nil
+	}
+
+	// time.ParseDuration stops at hours
+	if strings.HasSuffix(val, "d") || strings.HasSuffix(val, "w") {
+		days, err := strconv.Atoi(val[:len(val)-1])
+		if err == nil && days > 0 {
+			if strings.HasSuffix(val, "w") {
+				days *= 7
+			}
+			expires := now.AddDate(0, 0, days)
+			return &expires, true, nil
+		}
+	}
+
+	if duration, err := time.ParseDuration(val); err == nil && duration > 0 {
+		expires := now.Add(duration)
+		return &expires, true, nil
+	}
+
+	if expires, err := dateparse.ParseStrict(val); err == nil {
+		return &expires, true, nil
+	}
+
+	return nil, false, fmt.Errorf("invalid expiration (%s), use a duration like `7d` or a date", val)
+}
+
+// frontMatterKeys are the settings a paste can carry in front matter, a
+// block with anything else is part of the paste, e.g. a markdown post.
+var frontMatterKeys = map[string]bool{
+	"expires": true,
+}
+
+// splitFrontMatter separates the settings at the top of a paste:
+//
+//	---
+//	expires: 7d
+//	---
+//	the paste
+//
+// The block is only treated as settings when it is nothing but known keys.
+func splitFrontMatter(text string) (map[string]string, string) {
+	settings := map[string]string{}
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return settings, text
+	}
+	block, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		block, ok = strings.CutSuffix(rest, "\n---")
+		if !ok {
+			return settings, text
+		}
+		body = ""
+	}
+
+	for _, line := range strings.Split(block, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || !frontMatterKeys[key] {
+			return map[string]string{}, text
+		}
+		settings[key] = strings.TrimSpace(val)
+	}
+	return settings, body
+}
@@ -0,0 +1,65 @@
+package pastes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseExpires(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixtures := []struct {
+		val      string
+		expected *time.Time
+		found    bool
+	}{
+		{val: "7d", expected: ptr(now.AddDate(0, 0, 7)), found: true},
+		{val: "2w", expected: ptr(now.AddDate(0, 0, 14)), found: true},
+		{val: "90m", expected: ptr(now.Add(90 * time.Minute)), found: true},
+		{val: "2024-05-01", expected: ptr(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)), found: true},
+		{val: "false", found: true},
+		{val: "true", found: false},
+	}
+	for _, fixture := range fixtures {
+		expires, found, err := parseExpires(fixture.val, now)
+		if err != nil {
+			t.Fatalf("(%s): %v", fixture.val, err)
+		}
+		if found != fixture.found {
+			t.Errorf("(%s): expected found (%t), got (%t)", fixture.val, fixture.found, found)
+		}
+		if diff := cmp.Diff(fixture.expected, expires); diff != "" {
+			t.Errorf("(%s): %s", fixture.val, diff)
+		}
+	}
+
+	for _, val := range []string{"soon", "0d", "-1h"} {
+		if _, _, err := parseExpires(val, now); err == nil {
+			t.Errorf("(%s): expected an error", val)
+		}
+	}
+}
+
+func TestSplitFrontMatter(t *testing.T) {
+	settings, body := splitFrontMatter("---\nexpires: 7d\n---\necho hi\n")
+	if settings["expires"] != "7d" || body != "echo hi\n" {
+		t.Errorf("unexpected front matter (%v) %q", settings, body)
+	}
+
+	// front matter of the pasted file itself stays in the paste
+	text := "---\ntitle: post\nexpires: 7d\n---\n# hi\n"
+	settings, body = splitFrontMatter(text)
+	if len(settings) != 0 || body != text {
+		t.Errorf("expected other front matter to be kept, got (%v) %q", settings, body)
+	}
+
+	settings, body = splitFrontMatter("no settings")
+	if len(settings) != 0 || body != "no settings" {
+		t.Errorf("unexpected front matter (%v) %q", settings, body)
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
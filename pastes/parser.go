@@ -2,33 +2,89 @@ package pastes
 
 import (
 	"bytes"
+	"strconv"
+	"strings"
 
+	"github.com/alecthomas/chroma"
 	"github.com/alecthomas/chroma/formatters/html"
 	"github.com/alecthomas/chroma/lexers"
 	"github.com/alecthomas/chroma/styles"
 )
 
-func ParseText(filename string, text string) (string, error) {
-	formatter := html.New(
-		html.WithLineNumbers(true),
-		html.LinkableLineNumbers(true, ""),
-		html.WithClasses(true),
-	)
-	lexer := lexers.Match(filename)
+// lineIDPrefix makes every line of a paste linkable as `#L10`.
+const lineIDPrefix = "L"
+
+// ParseOpts change how a paste is rendered, Lang overrides the language
+// that is detected and Lines are highlighted.
+type ParseOpts struct {
+	Lang  string
+	Lines [][2]int
+}
+
+// detectLexer picks the language of a paste, an explicit lang wins over
+// the file name which wins over the contents.
+func detectLexer(filename, text, lang string) chroma.Lexer {
+	var lexer chroma.Lexer
+	if lang != "" {
+		lexer = lexers.Get(lang)
+	}
+	if lexer == nil {
+		lexer = lexers.Match(filename)
+	}
 	if lexer == nil {
 		lexer = lexers.Analyse(text)
 	}
 	if lexer == nil {
 		lexer = lexers.Get("plaintext")
 	}
+	return lexer
+}
+
+// ParseText highlights a paste and returns it along with the name of the
+// language it was highlighted as.
+func ParseText(filename string, text string, opts ParseOpts) (string, string, error) {
+	formatter := html.New(
+		html.WithLineNumbers(true),
+		html.LinkableLineNumbers(true, lineIDPrefix),
+		html.HighlightLines(opts.Lines),
+		html.WithClasses(true),
+	)
+	lexer := detectLexer(filename, text, opts.Lang)
+	lang := lexer.Config().Name
 	iterator, err := lexer.Tokenise(nil, text)
 	if err != nil {
-		return text, err
+		return text, lang, err
 	}
 	var buf bytes.Buffer
 	err = formatter.Format(&buf, styles.Dracula, iterator)
 	if err != nil {
-		return text, err
+		return text, lang, err
+	}
+	return buf.String(), lang, nil
+}
+
+// parseLines reads the lines to highlight in the same form as the anchors
+// of a paste, e.g. `L10`, `L10-L20` or `L1-L3,L8`, with or without the
+// `L`. Anything it cannot read is ignored.
+func parseLines(val string) [][2]int {
+	lines := [][2]int{}
+	for _, part := range strings.Split(val, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(strings.TrimPrefix(from, lineIDPrefix))
+		if err != nil || start < 1 {
+			continue
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimPrefix(to, lineIDPrefix))
+			if err != nil || end < 1 {
+				continue
+			}
+		}
+		if end < start {
+			start, end = end, start
+		}
+		lines = append(lines, [2]int{start, end})
 	}
-	return buf.String(), nil
+	return lines
 }
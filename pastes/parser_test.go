@@ -0,0 +1,64 @@
+package pastes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLines(t *testing.T) {
+	tests := []struct {
+		val   string
+		lines [][2]int
+	}{
+		{val: "", lines: [][2]int{}},
+		{val: "L10", lines: [][2]int{{10, 10}}},
+		{val: "L10-L20", lines: [][2]int{{10, 20}}},
+		{val: "20-10", lines: [][2]int{{10, 20}}},
+		{val: "L1-L3,L8", lines: [][2]int{{1, 3}, {8, 8}}},
+		{val: "L0,nope,L2-x,L5", lines: [][2]int{{5, 5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			if diff := cmp.Diff(tt.lines, parseLines(tt.val)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseText(t *testing.T) {
+	text := "package main\n\nfunc main() {}\n"
+
+	html, lang, err := ParseText("main.go", text, ParseOpts{Lines: [][2]int{{3, 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lang != "Go" {
+		t.Errorf("expected the language to be detected from the file name, got %s", lang)
+	}
+	if !strings.Contains(html, `id="L3"`) || !strings.Contains(html, `href="#L3"`) {
+		t.Error("expected linkable line anchors")
+	}
+	if !strings.Contains(html, `class="line hl"`) {
+		t.Error("expected the line to be highlighted")
+	}
+
+	_, lang, err = ParseText("main.go", text, ParseOpts{Lang: "python"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lang != "Python" {
+		t.Errorf("expected lang to override detection, got %s", lang)
+	}
+
+	_, lang, err = ParseText("main.go", text, ParseOpts{Lang: "nope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lang != "Go" {
+		t.Errorf("expected an unknown lang to be ignored, got %s", lang)
+	}
+}
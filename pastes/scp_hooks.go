@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/araddon/dateparse"
 	"github.com/charmbracelet/ssh"
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/filehandlers"
@@ -37,62 +36,52 @@ func (p *FileHooks) FileMeta(s ssh.Session, data *filehandlers.PostMetaData) err
 	// we want the slug to be the filename for pastes
 	data.Slug = data.Filename
 
+	now := time.Now()
 	if data.Post.ExpiresAt == nil || data.Post.ExpiresAt.IsZero() {
 		// mark posts for deletion a X days after creation
-		expiresAt := time.Now().AddDate(0, 0, DEFAULT_EXPIRES_AT)
+		expiresAt := now.AddDate(0, 0, DEFAULT_EXPIRES_AT)
 		data.ExpiresAt = &expiresAt
 	}
 
-	var hidden bool
-	var expiresFound bool
-	var expires *time.Time
+	// front matter in the paste first, the command has the last word
+	settings, _ := splitFrontMatter(string(data.Text))
+	if val, ok := settings["expires"]; ok {
+		expires, found, err := parseExpires(val, now)
+		if err != nil {
+			return fmt.Errorf("ERROR: (%s) %w", data.Filename, err)
+		}
+		if found {
+			data.ExpiresAt = expires
+		}
+	}
 
+	var hidden bool
 	cmd := s.Command()
-
 	for _, arg := range cmd {
-		if strings.Contains(arg, "=") {
-			splitArg := strings.Split(arg, "=")
-			if len(splitArg) != 2 {
+		key, val, ok := strings.Cut(arg, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "hidden":
+			v, err := strconv.ParseBool(val)
+			if err != nil {
 				continue
 			}
-
-			switch splitArg[0] {
-			case "hidden":
-				val, err := strconv.ParseBool(splitArg[1])
-				if err != nil {
-					continue
-				}
-
-				hidden = val
-			case "expires":
-				val, err := strconv.ParseBool(splitArg[1])
-				if err == nil {
-					expiresFound = !val
-					continue
-				}
-
-				duration, err := time.ParseDuration(splitArg[1])
-				if err == nil {
-					expiresFound = true
-					expireTime := time.Now().Add(duration)
-					expires = &expireTime
-					continue
-				}
-
-				expireTime, err := dateparse.ParseStrict(splitArg[1])
-				if err == nil {
-					expiresFound = true
-					expires = &expireTime
-				}
+			hidden = v
+		case "expires":
+			expires, found, err := parseExpires(val, now)
+			if err != nil {
+				return fmt.Errorf("ERROR: (%s) %w", data.Filename, err)
+			}
+			if found {
+				data.ExpiresAt = expires
 			}
 		}
 	}
 
 	data.Hidden = hidden
 
-	if expiresFound {
-		data.ExpiresAt = expires
-	}
-
 	return nil
 }
@@ -1,24 +1,24 @@
 package pastes
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/charmbracelet/promwish"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	bm "github.com/charmbracelet/wish/bubbletea"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/filehandlers"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bus"
 	"github.com/picosh/pico/shared/storage"
 	wsh "github.com/picosh/pico/wish"
 	"github.com/picosh/pico/wish/cms"
-	"github.com/picosh/send/list"
+	"github.com/picosh/pico/wish/email"
+	"github.com/picosh/pico/wish/list"
 	"github.com/picosh/send/pipe"
 	"github.com/picosh/send/proxy"
 	"github.com/picosh/send/send/auth"
@@ -37,7 +37,8 @@ func createRouter(handler *filehandlers.FileHandlerRouter) proxy.Router {
 	return func(sh ssh.Handler, s ssh.Session) []wish.Middleware {
 		return []wish.Middleware{
 			pipe.Middleware(handler, ""),
-			list.Middleware(handler),
+			list.Middleware(handler, handler.Cfg),
+			email.Middleware(handler.DBPool, handler.Cfg),
 			scp.Middleware(handler),
 			wishrsync.Middleware(handler),
 			auth.Middleware(handler),
@@ -54,6 +55,13 @@ func withProxy(handler *filehandlers.FileHandlerRouter, otherMiddleware ...wish.
 			return err
 		}
 
+		timeouts := wsh.NewTimeouts(handler.Cfg)
+		err = timeouts.SubsystemOption(handler.GetLogger())(server)
+		if err != nil {
+			return err
+		}
+
+		otherMiddleware = append(otherMiddleware, timeouts.Middleware(handler.GetLogger()))
 		return proxy.WithProxy(createRouter(handler), otherMiddleware...)(server)
 	}
 }
@@ -64,8 +72,10 @@ func StartSshServer() {
 	promPort := shared.GetEnv("PASTES_PROM_PORT", "9222")
 	cfg := NewConfigSite()
 	logger := cfg.Logger
-	dbh := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	dbh := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer dbh.Close()
+	cfg.Events = bus.Open(cfg.EventBusURL, logger)
+	defer cfg.Events.Close()
 	hooks := &FileHooks{
 		Cfg: cfg,
 		Db:  dbh,
@@ -73,11 +83,7 @@ func StartSshServer() {
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
@@ -115,9 +121,7 @@ func StartSshServer() {
 
 	<-done
 	logger.Info("Stopping SSH server")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() { cancel() }()
-	if err := s.Shutdown(ctx); err != nil {
+	if err := shared.Shutdown(s, cfg.ShutdownTimeout, logger, handler.Drain); err != nil {
 		logger.Error(err.Error())
 	}
 }
@@ -1,12 +1,28 @@
 package pgs
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh"
 )
 
+// accessCookieTTL is how long a sign in to a private project lasts.
+var accessCookieTTL = 24 * time.Hour
+
 func HasProjectAccess(project *db.Project, owner *db.User, requester *db.User, pubkey ssh.PublicKey) bool {
 	aclType := project.Acl.Type
 	data := project.Acl.Data
@@ -40,5 +56,142 @@ func HasProjectAccess(project *db.Project, owner *db.User, requester *db.User, p
 		return slices.Contains(data, key)
 	}
 
+	// private projects sign in over http
+	if aclType == "private" {
+		return false
+	}
+
 	return true
 }
+
+func accessCookieName(project *db.Project) string {
+	return "pgs_access_" + project.ID
+}
+
+// accessSignature covers the current entries so changing the password or
+// the users signs everyone out.
+func accessSignature(secret, projectID string, expires int64, entries []*db.ProjectAccess) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%d\n", projectID, expires)
+	for _, entry := range entries {
+		fmt.Fprintf(mac, "%s:%s\n", entry.Kind, entry.Value)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validAccessCookie(value, secret, projectID string, entries []*db.ProjectAccess, now time.Time) bool {
+	expiresStr, sig, found := strings.Cut(value, ".")
+	if !found {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	expected := accessSignature(secret, projectID, expires, entries)
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
+
+// checkBasicAuth accepts the project password with any username, or the
+// name of an allowed pico user together with one of their api or deploy
+// tokens, anyone who can deploy a site can read it.
+func checkBasicAuth(dbpool db.DB, owner *db.User, entries []*db.ProjectAccess, username, password string) bool {
+	for _, entry := range entries {
+		if entry.Kind == db.AccessPassword {
+			if bcrypt.CompareHashAndPassword([]byte(entry.Value), []byte(password)) == nil {
+				return true
+			}
+		}
+	}
+
+	allowed := username == owner.Name
+	for _, entry := range entries {
+		if entry.Kind == db.AccessUser && entry.Value == username {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return false
+	}
+	user, err := dbpool.FindUserForToken(password)
+	if err != nil {
+		user, err = dbpool.FindUserForScopedToken(password, db.TokenScopeDeploy)
+	}
+	return err == nil && user.Name == username
+}
+
+// checkPrivateAccess lets a request into a private project with a signed
+// cookie or basic auth, a successful basic auth hands out the cookie. It
+// answers the request itself when access is denied.
+func checkPrivateAccess(w http.ResponseWriter, r *http.Request, dbpool db.DB, cfg *shared.ConfigSite, owner *db.User, project *db.Project, logger *slog.Logger) bool {
+	secret := cfg.AccessSecret
+	entries, err := dbpool.FindProjectAccess(project.ID)
+	if err != nil {
+		logger.Error("could not find project access", "err", err.Error())
+		http.Error(w, "cannot check access", http.StatusInternalServerError)
+		return false
+	}
+
+	// nobody can sign in without entries, the owner can always check
+	// over a tunnel
+	if len(entries) > 0 {
+		cookie, err := r.Cookie(accessCookieName(project))
+		if err == nil && secret != "" && validAccessCookie(cookie.Value, secret, project.ID, entries, time.Now()) {
+			w.Header().Set("cache-control", "private")
+			return true
+		}
+
+		username, password, ok := r.BasicAuth()
+		if ok && checkBasicAuth(dbpool, owner, entries, username, password) {
+			w.Header().Set("cache-control", "private")
+			if secret == "" {
+				return true
+			}
+			expires := time.Now().Add(accessCookieTTL).Unix()
+			http.SetCookie(w, &http.Cookie{
+				Name:     accessCookieName(project),
+				Value:    fmt.Sprintf("%d.%s", expires, accessSignature(secret, project.ID, expires, entries)),
+				Path:     "/",
+				MaxAge:   int(accessCookieTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   cfg.Protocol == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+			return true
+		}
+	}
+
+	logger.Info("private project requires sign in", "project", project.Name)
+	w.Header().Set("www-authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", project.Name))
+	http.Error(w, "You do not have access to this site", http.StatusUnauthorized)
+	return false
+}
+
+// shareSignature binds a `share` link to a single file of a project until
+// it expires.
+func shareSignature(secret, username, projectName, fpath string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", username, projectName, path.Clean("/"+fpath), expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func signedShareURL(cfg *shared.ConfigSite, username, projectName, fpath string, expires time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", shareSignature(cfg.AccessSecret, username, projectName, fpath, expires.Unix()))
+	return cfg.AssetURL(username, projectName, strings.TrimPrefix(fpath, "/")) + "?" + query.Encode()
+}
+
+// validShareURL checks the signature of a `share` link, it needs nothing
+// but the secret so it is done before any access lookup.
+func validShareURL(secret, username, projectName, fpath string, query url.Values, now time.Time) bool {
+	if secret == "" || !query.Has("sig") {
+		return false
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	expected := shareSignature(secret, username, projectName, fpath, expires)
+	return hmac.Equal([]byte(query.Get("sig")), []byte(expected))
+}
@@ -0,0 +1,90 @@
+package pgs
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type accessDB struct {
+	db.DB
+	entries []*db.ProjectAccess
+}
+
+func (a *accessDB) FindProjectAccess(projectID string) ([]*db.ProjectAccess, error) {
+	return a.entries, nil
+}
+
+func (a *accessDB) FindUserForToken(token string) (*db.User, error) {
+	if token == "friend-token" {
+		return &db.User{ID: "2", Name: "friend"}, nil
+	}
+	return nil, fmt.Errorf("token not found")
+}
+
+func (a *accessDB) FindUserForScopedToken(token, scope string) (*db.User, error) {
+	if token == "deploy-token" && scope == db.TokenScopeDeploy {
+		return &db.User{ID: "2", Name: "friend"}, nil
+	}
+	return nil, fmt.Errorf("token not found")
+}
+
+func TestCheckPrivateAccess(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbpool := &accessDB{entries: []*db.ProjectAccess{
+		{Kind: db.AccessUser, Value: "friend"},
+		{Kind: db.AccessPassword, Value: string(hash)},
+	}}
+	cfg := &shared.ConfigSite{AccessSecret: "secret"}
+	owner := &db.User{ID: "1", Name: "owner"}
+	project := &db.Project{ID: "p1", Name: "private", Acl: db.ProjectAcl{Type: "private"}}
+
+	check := func(setup func(r *http.Request)) (*httptest.ResponseRecorder, bool) {
+		r := httptest.NewRequest("GET", "/", nil)
+		setup(r)
+		w := httptest.NewRecorder()
+		return w, checkPrivateAccess(w, r, dbpool, cfg, owner, project, slog.Default())
+	}
+
+	w, ok := check(func(r *http.Request) {})
+	if ok || w.Code != http.StatusUnauthorized || w.Header().Get("www-authenticate") == "" {
+		t.Fatalf("expected a basic auth challenge, found (%d) %v", w.Code, w.Header())
+	}
+	for _, creds := range [][2]string{{"anyone", "hunter2"}, {"friend", "friend-token"}, {"friend", "deploy-token"}} {
+		_, ok = check(func(r *http.Request) { r.SetBasicAuth(creds[0], creds[1]) })
+		if !ok {
+			t.Fatalf("expected (%s) to sign in", creds[0])
+		}
+	}
+	for _, creds := range [][2]string{{"anyone", "wrong"}, {"stranger", "friend-token"}} {
+		_, ok = check(func(r *http.Request) { r.SetBasicAuth(creds[0], creds[1]) })
+		if ok {
+			t.Fatalf("expected (%s) to be denied", creds[0])
+		}
+	}
+
+	// the cookie handed out replaces basic auth until the entries change
+	w, _ = check(func(r *http.Request) { r.SetBasicAuth("anyone", "hunter2") })
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected an access cookie, found %v", cookies)
+	}
+	_, ok = check(func(r *http.Request) { r.AddCookie(cookies[0]) })
+	if !ok {
+		t.Fatal("expected the cookie to sign in")
+	}
+	dbpool.entries = dbpool.entries[:1]
+	_, ok = check(func(r *http.Request) { r.AddCookie(cookies[0]) })
+	if ok {
+		t.Fatal("expected the cookie to stop working once the password is gone")
+	}
+}
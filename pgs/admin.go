@@ -0,0 +1,402 @@
+package pgs
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+)
+
+// defaultFeatureTTL is how long `admin set-feature` grants a flag for.
+const defaultFeatureTTL = 365 * 24 * time.Hour
+
+func getAdminHelpText() string {
+	helpStr := "Operator commands, only available to users with the `admin` feature flag.\n\n"
+	helpStr += "admin users [filter]                        list accounts, their projects and feature flags\n"
+	helpStr += "admin set-feature <user> <flag> [flags]     grant a feature flag, replaces the current one\n"
+	helpStr += "    --storage-max, --file-max, --file-count-max, --object-count-max, --ttl\n"
+	helpStr += "admin rm-feature <user> <flag>              expire a feature flag\n"
+	helpStr += "admin state <user> <state>                  set an account active, read-only or suspended\n"
+	helpStr += "admin suspend <user>                        block an account\n"
+	helpStr += "admin unsuspend <user>                      unblock an account\n"
+	helpStr += "admin project <user> <project>              inspect a project of any user\n"
+	helpStr += "admin expire-sessions <user>                revoke api tokens and close live ssh sessions\n\n"
+	helpStr += "Commands that change anything *must* append `--write` for the changes to persist."
+	return helpStr
+}
+
+// requireAdmin keeps operator commands away from everyone else.
+func (c *Cmd) requireAdmin(action string) error {
+	if !c.Dbpool.HasFeatureForUser(c.User.ID, "admin") {
+		return fmt.Errorf("must be an admin to %s", action)
+	}
+	return nil
+}
+
+// adminUser finds the account an operator command targets.
+func (c *Cmd) adminUser(userName string) (*db.User, error) {
+	user, err := c.Dbpool.FindUserForName(userName)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("user (%s) does not exist", userName))
+	}
+	return user, nil
+}
+
+// admin runs an operator subcommand, args start after `admin`.
+func (c *Cmd) admin(args []string) error {
+	err := c.requireAdmin("run operator commands")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		c.output(getAdminHelpText())
+		return nil
+	}
+
+	sub := strings.TrimSpace(args[0])
+	cmd := flag.NewFlagSet("admin "+sub, flag.ContinueOnError)
+	cmd.SetOutput(c.Session)
+	write := cmd.Bool("write", false, "apply changes")
+	storageMax := cmd.Uint64("storage-max", 0, "storage quota in bytes")
+	fileMax := cmd.Int64("file-max", 0, "largest file in bytes")
+	fileCountMax := cmd.Int("file-count-max", 0, "most files per project, 0 is unlimited")
+	objectCountMax := cmd.Int("object-count-max", 0, "most files across every project, 0 is unlimited")
+	ttl := cmd.Duration("ttl", defaultFeatureTTL, "how long the feature flag is granted for")
+
+	// positional args come before the flags
+	pos := []string{}
+	rest := args[1:]
+	for len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		pos = append(pos, strings.TrimSpace(rest[0]))
+		rest = rest[1:]
+	}
+	if err := cmd.Parse(rest); err != nil {
+		return err
+	}
+	c.Write = *write
+
+	need := func(names ...string) error {
+		if len(pos) != len(names) {
+			return fmt.Errorf("usage: admin %s <%s>", sub, strings.Join(names, "> <"))
+		}
+		return nil
+	}
+
+	switch sub {
+	case "help":
+		c.output(getAdminHelpText())
+		return nil
+	case "users":
+		filter := ""
+		if len(pos) > 0 {
+			filter = pos[0]
+		}
+		return c.adminUsers(filter)
+	case "set-feature":
+		if err := need("user", "flag"); err != nil {
+			return err
+		}
+		if *ttl <= 0 {
+			return fmt.Errorf("must provide a positive `--ttl`, found (%s)", *ttl)
+		}
+		data := db.FeatureFlagData{
+			StorageMax:     *storageMax,
+			FileMax:        *fileMax,
+			FileCountMax:   *fileCountMax,
+			ObjectCountMax: *objectCountMax,
+		}
+		err = c.adminSetFeature(pos[0], pos[1], data, *ttl)
+	case "rm-feature":
+		if err := need("user", "flag"); err != nil {
+			return err
+		}
+		err = c.adminRmFeature(pos[0], pos[1])
+	case "state":
+		if err := need("user", "state"); err != nil {
+			return err
+		}
+		err = c.adminState(pos[0], pos[1])
+	case "suspend", "unsuspend":
+		if err := need("user"); err != nil {
+			return err
+		}
+		err = c.suspend(pos[0], sub == "suspend")
+	case "project":
+		if err := need("user", "project"); err != nil {
+			return err
+		}
+		return c.adminProject(pos[0], pos[1])
+	case "expire-sessions":
+		if err := need("user"); err != nil {
+			return err
+		}
+		err = c.adminExpireSessions(pos[0])
+	default:
+		return fmt.Errorf("unknown admin command (%s), see `admin help`", sub)
+	}
+
+	c.notice()
+	return err
+}
+
+func (c *Cmd) adminUsers(filter string) error {
+	c.Log.Info("operator running `admin users` command", "operator", c.User.Name, "filter", filter)
+
+	summaries, err := c.Dbpool.FindUserSummaries(filter)
+	if err != nil {
+		return err
+	}
+	if len(summaries) == 0 {
+		c.output("no users found")
+		return nil
+	}
+
+	data := [][]string{}
+	for _, summary := range summaries {
+		state := summary.State()
+		if summary.IsSuspended() {
+			state += " " + summary.SuspendedAt.Format(time.DateOnly)
+		} else if summary.IsReadOnly() {
+			state += " " + summary.ReadOnlyAt.Format(time.DateOnly)
+		}
+		created := "-"
+		if summary.CreatedAt != nil {
+			created = summary.CreatedAt.Format(time.DateOnly)
+		}
+		features := "-"
+		if len(summary.Features) > 0 {
+			features = strings.Join(summary.Features, ",")
+		}
+		data = append(data, []string{
+			summary.Name,
+			summary.ID,
+			created,
+			fmt.Sprintf("%d", summary.Projects),
+			features,
+			state,
+		})
+	}
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(c.Styles.CliBorder).
+		Headers("Name", "ID", "Created", "Projects", "Features", "State").
+		Rows(data...).
+		StyleFunc(styleRows(c.Styles))
+	c.output(t.String())
+	return nil
+}
+
+// adminState moves an account between the states of db.User, read-only
+// keeps a user's sites up while they sort out billing or an abuse report.
+func (c *Cmd) adminState(userName, state string) error {
+	switch state {
+	case db.UserActive, db.UserReadOnly, db.UserSuspended:
+	default:
+		return fmt.Errorf(
+			"state must be one of (%s, %s, %s), found (%s)",
+			db.UserActive, db.UserReadOnly, db.UserSuspended, state,
+		)
+	}
+	user, err := c.adminUser(userName)
+	if err != nil {
+		return err
+	}
+	if user.ID == c.User.ID {
+		return fmt.Errorf("cannot change the state of your own account")
+	}
+	c.output(fmt.Sprintf("changing account (%s) from (%s) to (%s)", user.Name, user.State(), state))
+	if !c.Write {
+		return nil
+	}
+
+	err = c.Dbpool.SetUserSuspended(user.ID, state == db.UserSuspended, c.User.ID)
+	if err != nil {
+		return err
+	}
+	err = c.Dbpool.SetUserReadOnly(user.ID, state == db.UserReadOnly, c.User.ID)
+	if err != nil {
+		return err
+	}
+	c.Log.Info(
+		"account state changed",
+		"operator", c.User.Name,
+		"operatorId", c.User.ID,
+		"target", user.Name,
+		"targetId", user.ID,
+		"from", user.State(),
+		"to", state,
+	)
+	return nil
+}
+
+func (c *Cmd) adminSetFeature(userName, name string, data db.FeatureFlagData, ttl time.Duration) error {
+	user, err := c.adminUser(userName)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ttl)
+	c.output(fmt.Sprintf(
+		"granting (%s) to (%s) until %s, storage (%d bytes), file (%d bytes), files per project (%d), files (%d)",
+		name,
+		user.Name,
+		expiresAt.Format(time.DateTime),
+		data.StorageMax,
+		data.FileMax,
+		data.FileCountMax,
+		data.ObjectCountMax,
+	))
+	if !c.Write {
+		return nil
+	}
+
+	err = c.Dbpool.SetFeatureForUser(user.ID, name, data, expiresAt)
+	if err != nil {
+		return err
+	}
+	c.Log.Info(
+		"feature flag granted",
+		"operator", c.User.Name,
+		"operatorId", c.User.ID,
+		"target", user.Name,
+		"targetId", user.ID,
+		"feature", name,
+		"expiresAt", expiresAt,
+	)
+	return nil
+}
+
+func (c *Cmd) adminRmFeature(userName, name string) error {
+	user, err := c.adminUser(userName)
+	if err != nil {
+		return err
+	}
+	if user.ID == c.User.ID && name == "admin" {
+		return fmt.Errorf("cannot remove your own admin flag")
+	}
+	c.output(fmt.Sprintf("removing (%s) from (%s)", name, user.Name))
+	if !c.Write {
+		return nil
+	}
+
+	err = c.Dbpool.RemoveFeatureForUser(user.ID, name)
+	if err != nil {
+		return err
+	}
+	c.Log.Info(
+		"feature flag removed",
+		"operator", c.User.Name,
+		"operatorId", c.User.ID,
+		"target", user.Name,
+		"targetId", user.ID,
+		"feature", name,
+	)
+	return nil
+}
+
+func (c *Cmd) adminProject(userName, projectName string) error {
+	c.Log.Info(
+		"operator running `admin project` command",
+		"operator", c.User.Name,
+		"user", userName,
+		"project", projectName,
+	)
+
+	user, err := c.adminUser(userName)
+	if err != nil {
+		return err
+	}
+	project, err := c.Dbpool.FindProjectByName(user.ID, projectName)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("project (%s) does not exist for (%s)", projectName, user.Name))
+	}
+
+	date := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.DateTime)
+	}
+	files, size := "-", "-"
+	if project.Name == project.ProjectDir {
+		bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(user.ID))
+		if err == nil {
+			count, bytes, err := c.projectSize(bucket, project.Name)
+			if err == nil {
+				files = fmt.Sprintf("%d", count)
+				size = shared.HumanSize(bytes)
+			}
+		}
+	}
+
+	data := [][]string{
+		{"ID", project.ID},
+		{"User", fmt.Sprintf("%s (%s)", user.Name, user.ID)},
+		{"Name", project.Name},
+		{"ProjectDir", project.ProjectDir},
+		{"Acl", project.Acl.Type},
+		{"Created", date(project.CreatedAt)},
+		{"Updated", date(project.UpdatedAt)},
+		{"Expires", date(project.ExpiresAt)},
+		{"Files", files},
+		{"Size", size},
+	}
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(c.Styles.CliBorder).
+		Rows(data...)
+	c.output(t.String())
+	return nil
+}
+
+// adminExpireSessions logs a user out everywhere we can: api tokens are
+// revoked and ssh sessions open on this server are closed. Sessions on
+// other servers end on their own once the account is suspended.
+func (c *Cmd) adminExpireSessions(userName string) error {
+	user, err := c.adminUser(userName)
+	if err != nil {
+		return err
+	}
+	tokens, err := c.Dbpool.FindTokensForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	live := 0
+	if c.Sessions != nil {
+		live = c.Sessions.Count(user.ID)
+	}
+	c.output(fmt.Sprintf(
+		"expiring sessions of (%s): (%d) api tokens, (%d) ssh sessions",
+		user.Name,
+		len(tokens),
+		live,
+	))
+	if !c.Write {
+		return nil
+	}
+
+	removed, err := c.Dbpool.RemoveTokensForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	closed := 0
+	if c.Sessions != nil {
+		closed = c.Sessions.Expire(user.ID)
+	}
+	c.Log.Info(
+		"sessions expired",
+		"operator", c.User.Name,
+		"operatorId", c.User.ID,
+		"target", user.Name,
+		"targetId", user.ID,
+		"tokens", removed,
+		"sessions", closed,
+	)
+	return nil
+}
@@ -0,0 +1,236 @@
+package pgs
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+type adminSession struct {
+	bytes.Buffer
+	stderr bytes.Buffer
+}
+
+func (s *adminSession) Exit(code int) error   { return nil }
+func (s *adminSession) Close() error          { return nil }
+func (s *adminSession) Stderr() io.ReadWriter { return &s.stderr }
+
+type adminDB struct {
+	db.DB
+	admins   []string
+	users    map[string]*db.User
+	features map[string]db.FeatureFlagData
+	removed  []string
+	states   []string
+	tokens   int
+}
+
+func (a *adminDB) HasFeatureForUser(userID, name string) bool {
+	if name == "admin" {
+		for _, id := range a.admins {
+			if id == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *adminDB) FindUserForName(name string) (*db.User, error) {
+	user, ok := a.users[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (a *adminDB) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	a.states = append(a.states, fmt.Sprintf("%s suspended=%t", userID, suspended))
+	return nil
+}
+
+func (a *adminDB) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	a.states = append(a.states, fmt.Sprintf("%s read-only=%t", userID, readOnly))
+	return nil
+}
+
+func (a *adminDB) FindUserSummaries(filter string) ([]*db.UserSummary, error) {
+	summaries := []*db.UserSummary{}
+	for _, user := range a.users {
+		if strings.Contains(user.Name, filter) {
+			summaries = append(summaries, &db.UserSummary{User: user, Features: []string{"pgs"}})
+		}
+	}
+	return summaries, nil
+}
+
+func (a *adminDB) SetFeatureForUser(userID, name string, data db.FeatureFlagData, expiresAt time.Time) error {
+	a.features[userID+"/"+name] = data
+	return nil
+}
+
+func (a *adminDB) RemoveFeatureForUser(userID, name string) error {
+	a.removed = append(a.removed, userID+"/"+name)
+	return nil
+}
+
+func (a *adminDB) FindTokensForUser(userID string) ([]*db.Token, error) {
+	tokens := []*db.Token{}
+	for range a.tokens {
+		tokens = append(tokens, &db.Token{UserID: userID})
+	}
+	return tokens, nil
+}
+
+func (a *adminDB) RemoveTokensForUser(userID string) (int, error) {
+	count := a.tokens
+	a.tokens = 0
+	return count, nil
+}
+
+func newAdminCmd(dbpool *adminDB, user *db.User) (*Cmd, *adminSession) {
+	sesh := &adminSession{}
+	return &Cmd{
+		User:    user,
+		Session: sesh,
+		Log:     slog.Default(),
+		Dbpool:  dbpool,
+	}, sesh
+}
+
+func TestAdmin(t *testing.T) {
+	operator := &db.User{ID: "1", Name: "op"}
+	target := &db.User{ID: "2", Name: "target"}
+	dbpool := &adminDB{
+		admins:   []string{operator.ID},
+		users:    map[string]*db.User{operator.Name: operator, target.Name: target},
+		features: map[string]db.FeatureFlagData{},
+		tokens:   2,
+	}
+
+	c, _ := newAdminCmd(dbpool, target)
+	err := c.admin([]string{"users"})
+	if err == nil || !strings.Contains(err.Error(), "must be an admin") {
+		t.Fatalf("expected non admins to be refused, got %v", err)
+	}
+
+	c, sesh := newAdminCmd(dbpool, operator)
+	err = c.admin([]string{"users", "targ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sesh.String(), "target") || strings.Contains(sesh.String(), "op ") {
+		t.Errorf("unexpected users output %q", sesh.String())
+	}
+
+	err = c.admin([]string{"set-feature", "target", "pgs", "--storage-max", "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dbpool.features) != 0 {
+		t.Fatal("expected nothing to be granted without `--write`")
+	}
+	err = c.admin([]string{"set-feature", "target", "pgs", "--storage-max", "100", "--file-max", "10", "--write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbpool.features["2/pgs"] != (db.FeatureFlagData{StorageMax: 100, FileMax: 10}) {
+		t.Errorf("unexpected feature flags %+v", dbpool.features)
+	}
+
+	err = c.admin([]string{"rm-feature", "op", "admin", "--write"})
+	if err == nil {
+		t.Error("expected operators to keep their own admin flag")
+	}
+	err = c.admin([]string{"rm-feature", "target", "pgs", "--write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dbpool.removed) != 1 || dbpool.removed[0] != "2/pgs" {
+		t.Errorf("unexpected removals %v", dbpool.removed)
+	}
+
+	err = c.admin([]string{"expire-sessions", "target", "--write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbpool.tokens != 0 {
+		t.Error("expected api tokens to be revoked")
+	}
+
+	err = c.admin([]string{"state", "target", "frozen", "--write"})
+	if err == nil {
+		t.Error("expected unknown states to be rejected")
+	}
+	err = c.admin([]string{"state", "target", "read-only", "--write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"2 suspended=false", "2 read-only=true"}, dbpool.states); diff != "" {
+		t.Error(diff)
+	}
+
+	err = c.admin([]string{"set-feature", "target"})
+	if err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("expected usage error, got %v", err)
+	}
+	err = c.admin([]string{"nope"})
+	if err == nil {
+		t.Error("expected unknown commands to fail")
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	operator := &db.User{ID: "1", Name: "op"}
+	target := &db.User{ID: "2", Name: "target"}
+	fixtures := []struct {
+		name      string
+		user      *db.User
+		args      string
+		suspended bool
+		write     bool
+		states    []string
+		err       string
+	}{
+		{name: "not-admin", user: target, args: "op", suspended: true, write: true, err: "must be an admin"},
+		{name: "missing", user: operator, args: "nobody", suspended: true, write: true, err: "does not exist"},
+		{name: "self", user: operator, args: "op", suspended: true, write: true, err: "your own account"},
+		{name: "dry-run", user: operator, args: "target", suspended: true, states: []string{}},
+		{name: "suspend", user: operator, args: "target", suspended: true, write: true, states: []string{"2 suspended=true"}},
+		{name: "unsuspend", user: operator, args: "target", write: true, states: []string{"2 suspended=false"}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dbpool := &adminDB{
+				admins: []string{operator.ID},
+				users:  map[string]*db.User{operator.Name: operator, target.Name: target},
+				states: []string{},
+			}
+			c, _ := newAdminCmd(dbpool, fixture.user)
+			c.Write = fixture.write
+
+			err := c.suspend(fixture.args, fixture.suspended)
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected %q, got %v", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(fixture.states, dbpool.states); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
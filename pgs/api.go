@@ -7,17 +7,24 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/gorilla/feeds"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/activity"
+	"github.com/picosh/pico/shared/analytics"
+	"github.com/picosh/pico/shared/bandwidth"
+	"github.com/picosh/pico/shared/listen"
+	"github.com/picosh/pico/shared/metrics"
 	"github.com/picosh/pico/shared/storage"
 	sst "github.com/picosh/pobj/storage"
 )
@@ -33,6 +40,7 @@ type AssetHandler struct {
 	Logger         *slog.Logger
 	UserID         string
 	Bucket         sst.Bucket
+	Project        *db.Project
 	ImgProcessOpts *storage.ImgProcessOpts
 }
 
@@ -46,7 +54,7 @@ func checkHandler(w http.ResponseWriter, r *http.Request) {
 		appDomain := strings.Split(cfg.ConfigCms.Domain, ":")[0]
 
 		if !strings.Contains(hostDomain, appDomain) {
-			subdomain := shared.GetCustomDomain(hostDomain, cfg.Space)
+			subdomain := shared.GetProjectDomain(dbpool, cfg, hostDomain)
 			props, err := getProjectFromSubdomain(subdomain)
 			if err != nil {
 				logger.Error(err.Error())
@@ -150,6 +158,74 @@ func createRssHandler(by string) http.HandlerFunc {
 	}
 }
 
+// createDeployFeedHandler serves the project events of a user as an atom,
+// rss or json feed. Events of projects that are not public are left out.
+func createDeployFeedHandler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := shared.GetField(r, 0)
+		dbpool := shared.GetDB(r)
+		logger := shared.GetLogger(r)
+		cfg := shared.GetCfg(r)
+
+		user, err := dbpool.FindUserForName(username)
+		if err != nil {
+			logger.Info("user not found", "user", username)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		events, err := dbpool.FindProjectEventsForUser(user.ID, activity.FeedSize)
+		if err != nil {
+			logger.Error(err.Error())
+			http.Error(w, "could not find project events", http.StatusInternalServerError)
+			return
+		}
+		projects, err := dbpool.FindProjectsByUser(user.ID)
+		if err != nil {
+			logger.Error(err.Error())
+			http.Error(w, "could not find projects", http.StatusInternalServerError)
+			return
+		}
+		private := map[string]bool{}
+		for _, project := range projects {
+			private[project.Name] = !publicPerm(project)
+		}
+		visible := []*db.ProjectEvent{}
+		for _, event := range events {
+			if !private[event.ProjectName] {
+				visible = append(visible, event)
+			}
+		}
+
+		feed := activity.Feed(user.Name, cfg.ReadURL(), visible, func(projectName string) string {
+			return strings.TrimSuffix(cfg.AssetURL(user.Name, projectName, ""), "/")
+		})
+
+		var out string
+		contentType := "application/atom+xml"
+		switch format {
+		case "rss":
+			contentType = "application/rss+xml"
+			out, err = feed.ToRss()
+		case "json":
+			contentType = "application/feed+json"
+			out, err = feed.ToJSON()
+		default:
+			out, err = feed.ToAtom()
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			http.Error(w, "could not generate deploy feed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", contentType)
+		_, err = w.Write([]byte(out))
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}
+}
+
 func (h *AssetHandler) handle(w http.ResponseWriter, r *http.Request) {
 	var redirects []*RedirectRule
 	redirectFp, _, _, err := h.Storage.GetObject(h.Bucket, filepath.Join(h.ProjectDir, "_redirects"))
@@ -169,26 +245,39 @@ func (h *AssetHandler) handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	routes := calcRoutes(h.ProjectDir, h.Filepath, redirects)
+	routes := calcRoutes(h.ProjectDir, h.Filepath, r.URL.Query(), redirects)
 
 	var contents io.ReadCloser
+	var size int64
+	var modTime time.Time
+	var meta *storage.ObjectMeta
 	contentType := ""
 	assetFilepath := ""
 	status := http.StatusOK
 	attempts := []string{}
 	for _, fp := range routes {
-		if hasProtocol(fp.Filepath) {
+		if hasProtocol(fp.Filepath) || isRedirectStatus(fp.Status) {
+			dest := fp.Filepath
+			// the query is passed along unless the rule matched on it
+			if len(fp.Query) == 0 && r.URL.RawQuery != "" && !strings.Contains(dest, "?") {
+				dest = dest + "?" + r.URL.RawQuery
+			}
 			h.Logger.Info(
 				"redirecting request",
 				"bucket", h.Bucket.Name,
 				"url", r.URL,
-				"destination", fp.Filepath,
+				"destination", dest,
 				"status", fp.Status,
 			)
-			http.Redirect(w, r, fp.Filepath, fp.Status)
+			http.Redirect(w, r, dest, fp.Status)
 			return
 		}
 
+		// previous versions are the owner's, not part of the site
+		if !h.Cfg.ServeVersions && storage.IsVersion(fp.Filepath) {
+			continue
+		}
+
 		attempts = append(attempts, fp.Filepath)
 		mimeType := storage.GetMimeType(fp.Filepath)
 		var c io.ReadCloser
@@ -200,7 +289,7 @@ func (h *AssetHandler) handle(w http.ResponseWriter, r *http.Request) {
 				h.ImgProcessOpts,
 			)
 		} else {
-			c, _, _, err = h.Storage.GetObject(h.Bucket, fp.Filepath)
+			c, size, modTime, meta, err = storage.GetObjectWithMeta(h.Storage, h.Bucket, fp.Filepath)
 		}
 		if err == nil {
 			contents = c
@@ -219,39 +308,54 @@ func (h *AssetHandler) handle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "404 not found", http.StatusNotFound)
 		return
 	}
-	defer contents.Close()
-
-	if contentType == "" {
-		contentType = storage.GetMimeType(assetFilepath)
+	// contents is swapped for a sidecar further down
+	defer func() {
+		_ = contents.Close()
+	}()
+
+	// directories are served from their index.html, redirect to the
+	// trailing slash so relative links in the page resolve inside it
+	isDirIndex := assetFilepath == dirIndexRoute(h.ProjectDir, h.Filepath)
+	if isDirIndex && status == http.StatusOK && !strings.HasSuffix(r.URL.Path, "/") {
+		dest := r.URL.Path + "/"
+		if r.URL.RawQuery != "" {
+			dest += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, dest, http.StatusMovedPermanently)
+		return
 	}
 
-	var headers []*HeaderRule
-	headersFp, _, _, err := h.Storage.GetObject(h.Bucket, filepath.Join(h.ProjectDir, "_headers"))
-	if err == nil {
-		defer headersFp.Close()
-		buf := new(strings.Builder)
-		_, err := io.Copy(buf, headersFp)
+	// the meta of images is not read along with them
+	if meta == nil {
+		meta, err = h.Storage.GetObjectMeta(h.Bucket, assetFilepath)
 		if err != nil {
-			h.Logger.Error(err.Error())
-			http.Error(w, "cannot read _headers file", http.StatusInternalServerError)
-			return
+			meta = &storage.ObjectMeta{}
 		}
+	}
 
-		headers, err = parseHeaderText(buf.String())
-		if err != nil {
-			h.Logger.Error(err.Error())
-		}
+	// symlinks are stored as markers, clients are sent to what they
+	// point to
+	if meta.Symlink != "" {
+		h.serveSymlink(w, r, assetFilepath)
+		return
 	}
 
-	userHeaders := []*HeaderLine{}
-	for _, headerRule := range headers {
-		rr := regexp.MustCompile(headerRule.Path)
-		match := rr.FindStringSubmatch(assetFilepath)
-		if len(match) > 0 {
-			userHeaders = headerRule.Headers
-		}
+	if contentType == "" {
+		contentType = storage.ContentTypeOf(meta, assetFilepath)
+	}
+	// processed images are not what the sidecars were made from
+	if h.ImgProcessOpts == nil {
+		contents = h.selectSidecar(w, r, assetFilepath, contentType, meta, contents)
 	}
 
+	matcher, err := h.headerMatcher()
+	if err != nil {
+		h.Logger.Error(err.Error())
+		http.Error(w, "cannot read _headers file", http.StatusInternalServerError)
+		return
+	}
+	userHeaders := matcher.Match(h.Filepath)
+
 	for _, hdr := range userHeaders {
 		w.Header().Add(hdr.Name, hdr.Value)
 	}
@@ -259,6 +363,17 @@ func (h *AssetHandler) handle(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("content-type", contentType)
 	}
 
+	// project csp only applies to html and should not clobber `_headers`
+	if h.Project != nil && strings.HasPrefix(w.Header().Get("content-type"), "text/html") {
+		cspName, cspValue := cspHeader(h.Project.Csp)
+		if cspValue != "" && w.Header().Get(cspName) == "" {
+			w.Header().Set(cspName, cspValue)
+		}
+	}
+
+	if h.Project != nil {
+		shared.GetAnalytics(r).Hit(r, h.UserID, h.Cfg.Space, h.Project.Name)
+	}
 	h.Logger.Info(
 		"serving asset",
 		"host", r.Host,
@@ -268,9 +383,44 @@ func (h *AssetHandler) handle(w http.ResponseWriter, r *http.Request) {
 		"status", status,
 		"contentType", w.Header().Get("content-type"),
 	)
+	body, err := h.decodeStored(w, r, meta, contents)
+	if err != nil {
+		h.Logger.Error(err.Error())
+		http.Error(w, "cannot read asset", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	h.logEncoding(r, w, assetFilepath)
+
+	// processed images do not match the stored checksum, modTime is only
+	// set for assets served as they were stored
+	if status == http.StatusOK && !modTime.IsZero() {
+		encoded := meta.ContentEncoding != ""
+		etag := assetETag(meta.Checksum, w.Header().Get("content-encoding"))
+		if etag != "" && w.Header().Get("etag") == "" {
+			w.Header().Set("etag", etag)
+		}
+		w.Header().Set("last-modified", modTime.UTC().Format(http.TimeFormat))
+
+		if isNotModified(r, w.Header().Get("etag"), modTime) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		// ranges are only served from assets sent as they were stored, so
+		// media players can seek
+		if !encoded && w.Header().Get("content-encoding") == "" {
+			w.Header().Set("accept-ranges", "bytes")
+			if h.serveRange(w, r, assetFilepath, size, modTime) {
+				return
+			}
+		}
+	}
 
 	w.WriteHeader(status)
-	_, err = io.Copy(w, contents)
+	_, err = io.Copy(w, body)
 
 	if err != nil {
 		h.Logger.Error(err.Error())
@@ -317,17 +467,25 @@ func ServeAsset(fname string, opts *storage.ImgProcessOpts, fromImgs bool, hasPe
 		return
 	}
 
+	if user.IsSuspended() {
+		logger.Info("user is suspended", "user", user.Name)
+		http.Error(w, db.ErrUserSuspended.Error(), http.StatusForbidden)
+		return
+	}
+
 	// TODO: this could probably be cleaned up more
 	// imgs wont have a project directory
 	projectDir := ""
 	var bucket sst.Bucket
+	var project *db.Project
 	// imgs has a different bucket directory
 	if fromImgs {
 		bucket, err = st.GetBucket(shared.GetImgsBucketName(user.ID))
 	} else {
 		bucket, err = st.GetBucket(shared.GetAssetBucketName(user.ID))
-		project, err := dbpool.FindProjectByName(user.ID, props.ProjectName)
-		if err != nil {
+		var perr error
+		project, perr = dbpool.FindProjectByName(user.ID, props.ProjectName)
+		if perr != nil {
 			logger.Info(
 				"project not found",
 				"projectName", props.ProjectName,
@@ -337,9 +495,24 @@ func ServeAsset(fname string, opts *storage.ImgProcessOpts, fromImgs bool, hasPe
 		}
 
 		projectDir = project.ProjectDir
-		if !hasPerm(project) {
-			http.Error(w, "You do not have access to this site", http.StatusUnauthorized)
-			return
+		// links follow the revision served by the project they point to
+		if cfg.KeepDeploys > 0 {
+			deploy, err := dbpool.FindCurrentDeploy(user.ID, project.ProjectDir)
+			if err == nil {
+				projectDir = storage.DeployName(project.ProjectDir, deploy.Revision)
+			}
+		}
+		// `share` links open a single file of any project
+		if validShareURL(cfg.AccessSecret, user.Name, project.Name, fname, r.URL.Query(), time.Now()) {
+			w.Header().Set("cache-control", "private")
+		} else if !hasPerm(project) {
+			if project.Acl.Type != "private" {
+				http.Error(w, "You do not have access to this site", http.StatusUnauthorized)
+				return
+			}
+			if !checkPrivateAccess(w, r, dbpool, cfg, user, project, logger) {
+				return
+			}
 		}
 	}
 
@@ -349,6 +522,20 @@ func ServeAsset(fname string, opts *storage.ImgProcessOpts, fromImgs bool, hasPe
 		return
 	}
 
+	if meter := shared.GetBandwidth(r); meter != nil && project != nil {
+		limit := shared.GetEgressForUser(dbpool, cfg, user.ID)
+		if meter.Over(user.ID, cfg.Space, limit) {
+			logger.Info("project is over its egress limit", "user", user.Name, "project", project.Name)
+			serveOverQuota(w, cfg, project.Name, time.Now())
+			return
+		}
+		counter := &bandwidth.Writer{ResponseWriter: w}
+		defer func() {
+			meter.Count(user.ID, cfg.Space, project.Name, counter.Bytes)
+		}()
+		w = counter
+	}
+
 	asset := &AssetHandler{
 		Username:       props.Username,
 		UserID:         user.ID,
@@ -360,6 +547,7 @@ func ServeAsset(fname string, opts *storage.ImgProcessOpts, fromImgs bool, hasPe
 		Storage:        st,
 		Logger:         logger,
 		Bucket:         bucket,
+		Project:        project,
 		ImgProcessOpts: opts,
 	}
 
@@ -403,6 +591,11 @@ var mainRoutes = []shared.Route{
 	shared.NewRoute("GET", "/check", checkHandler),
 	shared.NewRoute("GET", "/rss/updated", createRssHandler("updated_at")),
 	shared.NewRoute("GET", "/rss", createRssHandler("created_at")),
+	shared.NewRoute("GET", "/deploys/([^/]+)/atom.xml", createDeployFeedHandler("atom")),
+	shared.NewRoute("GET", "/deploys/([^/]+)/rss.xml", createDeployFeedHandler("rss")),
+	shared.NewRoute("GET", "/deploys/([^/]+)/feed.json", createDeployFeedHandler("json")),
+	shared.NewRoute("GET", "/_analytics", shared.AnalyticsHandler),
+	shared.NewRoute("GET", "/_analytics/(.+)", shared.AnalyticsHandler),
 	shared.NewRoute("GET", "/(.+)", shared.CreatePageHandler("html/marketing.page.tmpl")),
 }
 
@@ -425,36 +618,104 @@ func StartApiServer() {
 	cfg := NewConfigSite()
 	logger := cfg.Logger
 
-	db := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	db := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer db.Close()
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
 		return
 	}
+	st = storage.NewMetricsStorage(st)
+	if cfg.DedupStorage {
+		st = storage.NewDedupStorage(st, db)
+	}
+	if cfg.ObjectCacheSize > 0 {
+		st = storage.NewObjectCache(st, cfg.ObjectCacheSize, cfg.ObjectCacheMaxObject)
+	}
+
+	if cfg.MetricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			logger.Info("Starting metrics server", "addr", cfg.MetricsAddr)
+			ln, err := listen.Listen("metrics", cfg.MetricsAddr, cfg.ReusePort)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			logger.Error(http.Serve(ln, mux).Error())
+		}()
+	}
 
 	httpCtx := &shared.HttpCtx{
-		Cfg:     cfg,
-		Dbpool:  db,
-		Storage: st,
+		Cfg:       cfg,
+		Dbpool:    db,
+		Storage:   st,
+		Analytics: analytics.Start(db, logger, cfg.AnalyticsInterval),
+		Bandwidth: bandwidth.Start(db, logger, cfg.BandwidthInterval),
+	}
+	if cfg.KeepDeploys > 0 && cfg.DeployCacheTTL > 0 {
+		httpCtx.Dbpool = newDeployCache(db, cfg.DeployCacheTTL)
 	}
 	handler := shared.CreateServe(mainRoutes, createSubdomainRoutes(publicPerm), httpCtx)
-	router := http.HandlerFunc(handler)
+	var router http.Handler = http.HandlerFunc(handler)
+	servers := []*http.Server{}
+	if cfg.TLSAddr != "" {
+		var tlsServer *http.Server
+		router, tlsServer, err = startTLS(cfg, db, router)
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		servers = append(servers, tlsServer)
+	}
 
 	portStr := fmt.Sprintf(":%s", cfg.Port)
+	server := newWebServer(cfg, portStr, router, true)
+	ln, err := listen.Listen("http", portStr, cfg.ReusePort)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	servers = append(servers, server)
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	logger.Info(
 		"Starting server on port",
 		"port", cfg.Port,
 		"domain", cfg.Domain,
 		"email", cfg.Email,
+		"h2c", cfg.HTTP2Cleartext,
 	)
-	logger.Error(http.ListenAndServe(portStr, router).Error())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		logger.Error(err.Error())
+		return
+	case <-done:
+	}
+	logger.Info("stopping web server")
+	shutdownWeb(servers, cfg.ShutdownTimeout, logger)
+	// counts that were not stored yet would be gone with the process
+	if httpCtx.Analytics != nil {
+		err := httpCtx.Analytics.Flush()
+		if err != nil {
+			logger.Error("could not store analytics", "err", err.Error())
+		}
+	}
+	if httpCtx.Bandwidth != nil {
+		err := httpCtx.Bandwidth.Flush()
+		if err != nil {
+			logger.Error("could not store bandwidth", "err", err.Error())
+		}
+	}
 }
@@ -0,0 +1,386 @@
+package pgs
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestAssetHandler(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fpath, text := range map[string]string{
+		"test/index.html":      "home",
+		"test/docs/index.html": "docs",
+		"test/404.html":        "not here",
+		"test/index.html.v1":   "old home",
+	} {
+		_, err := st.PutObject(bucket, fpath, utils.NopReaderAtCloser(strings.NewReader(text)), &utils.FileEntry{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixtures := []struct {
+		name     string
+		url      string
+		fpath    string
+		status   int
+		body     string
+		location string
+	}{
+		{name: "root", url: "/", fpath: "/", status: http.StatusOK, body: "home"},
+		{name: "dir", url: "/docs/", fpath: "/docs/", status: http.StatusOK, body: "docs"},
+		{name: "dir-redirect", url: "/docs?a=1", fpath: "/docs", status: http.StatusMovedPermanently, location: "/docs/?a=1"},
+		{name: "not-found", url: "/missing", fpath: "/missing", status: http.StatusNotFound, body: "not here"},
+		{name: "version", url: "/index.html.v1", fpath: "/index.html.v1", status: http.StatusNotFound, body: "not here"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler := &AssetHandler{
+				ProjectDir: "test",
+				Filepath:   fixture.fpath,
+				Cfg:        &shared.ConfigSite{},
+				Storage:    st,
+				Logger:     slog.Default(),
+				Bucket:     bucket,
+			}
+
+			w := httptest.NewRecorder()
+			handler.handle(w, httptest.NewRequest("GET", fixture.url, nil))
+
+			if w.Code != fixture.status {
+				t.Fatalf("expected status (%d), found (%d)", fixture.status, w.Code)
+			}
+			if fixture.body != "" && w.Body.String() != fixture.body {
+				t.Fatalf("expected body %q, found %q", fixture.body, w.Body.String())
+			}
+			if w.Header().Get("location") != fixture.location {
+				t.Fatalf("expected location %q, found %q", fixture.location, w.Header().Get("location"))
+			}
+		})
+	}
+}
+
+func TestAssetHandlerConditional(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		"test/index.html",
+		utils.NopReaderAtCloser(strings.NewReader("home")),
+		&utils.FileEntry{},
+		&storage.ObjectMeta{ContentType: "text/html", Checksum: "abc"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	fixtures := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "unconditional", status: http.StatusOK},
+		{name: "etag-match", headers: map[string]string{"if-none-match": `"zzz", "abc"`}, status: http.StatusNotModified},
+		{name: "etag-mismatch", headers: map[string]string{"if-none-match": `"zzz"`}, status: http.StatusOK},
+		{name: "etag-wins", headers: map[string]string{"if-none-match": `"zzz"`, "if-modified-since": future}, status: http.StatusOK},
+		{name: "not-modified-since", headers: map[string]string{"if-modified-since": future}, status: http.StatusNotModified},
+		{name: "modified-since", headers: map[string]string{"if-modified-since": past}, status: http.StatusOK},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler := &AssetHandler{
+				ProjectDir: "test",
+				Filepath:   "/",
+				Cfg:        &shared.ConfigSite{},
+				Storage:    st,
+				Logger:     slog.Default(),
+				Bucket:     bucket,
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			for name, value := range fixture.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.handle(w, r)
+
+			if w.Code != fixture.status {
+				t.Fatalf("expected status (%d), found (%d)", fixture.status, w.Code)
+			}
+			if w.Header().Get("etag") != `"abc"` {
+				t.Fatalf("expected etag, found %q", w.Header().Get("etag"))
+			}
+			if w.Header().Get("last-modified") == "" {
+				t.Fatal("expected last-modified")
+			}
+		})
+	}
+}
+
+// metaCounter counts the meta looked up for each object.
+type metaCounter struct {
+	storage.StorageServe
+	lookups map[string]int
+}
+
+func (s *metaCounter) GetObjectMeta(bucket sst.Bucket, fpath string) (*storage.ObjectMeta, error) {
+	s.lookups[fpath] += 1
+	return s.StorageServe.GetObjectMeta(bucket, fpath)
+}
+
+func TestAssetHandlerMetaOnce(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := fs.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "<p>hello</p>"
+	_, err = fs.PutObjectWithMeta(
+		bucket,
+		"test/index.html",
+		utils.NopReaderAtCloser(strings.NewReader(text)),
+		&utils.FileEntry{Size: int64(len(text))},
+		&storage.ObjectMeta{ContentType: "text/html", Checksum: "abc", Mtime: 1709288400},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cached := range []bool{false, true} {
+		counter := &metaCounter{StorageServe: fs, lookups: map[string]int{}}
+		var st storage.StorageServe = counter
+		if cached {
+			st = storage.NewObjectCache(counter, 1024, 1024)
+		}
+		handler := &AssetHandler{
+			ProjectDir: "test",
+			Filepath:   "/index.html",
+			Cfg:        &shared.ConfigSite{},
+			Storage:    st,
+			Logger:     slog.Default(),
+			Bucket:     bucket,
+		}
+
+		w := httptest.NewRecorder()
+		handler.handle(w, httptest.NewRequest("GET", "/index.html", nil))
+		if w.Code != http.StatusOK || w.Body.String() != text {
+			t.Fatalf("cached=%v: unexpected response (%d) %q", cached, w.Code, w.Body.String())
+		}
+		if w.Header().Get("etag") == "" || w.Header().Get("content-type") != "text/html" {
+			t.Fatalf("cached=%v: expected the recorded meta in the headers, got %v", cached, w.Header())
+		}
+		if counter.lookups["test/index.html"] != 1 {
+			t.Fatalf("cached=%v: expected the meta to be looked up once, got (%d)", cached, counter.lookups["test/index.html"])
+		}
+	}
+}
+
+func TestAssetHandlerSidecars(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(fpath, text string, meta *storage.ObjectMeta) {
+		_, err := st.PutObjectWithMeta(bucket, fpath, utils.NopReaderAtCloser(strings.NewReader(text)), &utils.FileEntry{}, meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("test/index.html", "home", &storage.ObjectMeta{ContentType: "text/html", Checksum: "abc"})
+	put("test/index.html.br", "brotli", &storage.ObjectMeta{ContentType: "text/html", ContentEncoding: "br", Source: "abc"})
+	put("test/index.html.gz", "gzip", &storage.ObjectMeta{ContentType: "text/html", ContentEncoding: "gzip", Source: "old"})
+
+	fixtures := []struct {
+		name     string
+		accept   string
+		body     string
+		encoding string
+	}{
+		{name: "identity", accept: "", body: "home"},
+		{name: "brotli", accept: "gzip, br", body: "brotli", encoding: "br"},
+		{name: "refused", accept: "br;q=0, gzip", body: "home"},
+		{name: "stale", accept: "gzip", body: "home"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler := &AssetHandler{
+				ProjectDir: "test",
+				Filepath:   "/",
+				Cfg:        &shared.ConfigSite{},
+				Storage:    st,
+				Logger:     slog.Default(),
+				Bucket:     bucket,
+			}
+			handler.Cfg.CompressTypes = storage.DefaultCompressTypes
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("accept-encoding", fixture.accept)
+			w := httptest.NewRecorder()
+			handler.handle(w, r)
+
+			if w.Body.String() != fixture.body {
+				t.Fatalf("expected body %q, found %q", fixture.body, w.Body.String())
+			}
+			if w.Header().Get("content-encoding") != fixture.encoding {
+				t.Fatalf("expected encoding %q, found %q", fixture.encoding, w.Header().Get("content-encoding"))
+			}
+			if w.Header().Get("vary") != "accept-encoding" {
+				t.Fatalf("expected vary header, found %q", w.Header().Get("vary"))
+			}
+		})
+	}
+}
+
+func TestAssetHandlerRange(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		"test/clip.mp4",
+		utils.NopReaderAtCloser(strings.NewReader("0123456789")),
+		&utils.FileEntry{},
+		&storage.ObjectMeta{ContentType: "video/mp4", Checksum: "abc"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{name: "full", status: http.StatusOK, body: "0123456789"},
+		{name: "closed", headers: map[string]string{"range": "bytes=2-4"}, status: http.StatusPartialContent, body: "234", contentRange: "bytes 2-4/10"},
+		{name: "open", headers: map[string]string{"range": "bytes=7-"}, status: http.StatusPartialContent, body: "789", contentRange: "bytes 7-9/10"},
+		{name: "suffix", headers: map[string]string{"range": "bytes=-2"}, status: http.StatusPartialContent, body: "89", contentRange: "bytes 8-9/10"},
+		{name: "past-end", headers: map[string]string{"range": "bytes=8-20"}, status: http.StatusPartialContent, body: "89", contentRange: "bytes 8-9/10"},
+		{name: "unsatisfiable", headers: map[string]string{"range": "bytes=10-"}, status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */10"},
+		{name: "multiple", headers: map[string]string{"range": "bytes=0-1,4-5"}, status: http.StatusOK, body: "0123456789"},
+		{name: "if-range", headers: map[string]string{"range": "bytes=2-4", "if-range": `"abc"`}, status: http.StatusPartialContent, body: "234", contentRange: "bytes 2-4/10"},
+		{name: "if-range-stale", headers: map[string]string{"range": "bytes=2-4", "if-range": `"old"`}, status: http.StatusOK, body: "0123456789"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			handler := &AssetHandler{
+				ProjectDir: "test",
+				Filepath:   "/clip.mp4",
+				Cfg:        &shared.ConfigSite{},
+				Storage:    st,
+				Logger:     slog.Default(),
+				Bucket:     bucket,
+			}
+
+			r := httptest.NewRequest("GET", "/clip.mp4", nil)
+			for name, value := range fixture.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.handle(w, r)
+
+			if w.Code != fixture.status {
+				t.Fatalf("expected status (%d), found (%d)", fixture.status, w.Code)
+			}
+			if fixture.body != "" && w.Body.String() != fixture.body {
+				t.Fatalf("expected body %q, found %q", fixture.body, w.Body.String())
+			}
+			if w.Header().Get("content-range") != fixture.contentRange {
+				t.Fatalf("expected content-range %q, found %q", fixture.contentRange, w.Header().Get("content-range"))
+			}
+			if w.Header().Get("accept-ranges") != "bytes" {
+				t.Fatalf("expected accept-ranges, found %q", w.Header().Get("accept-ranges"))
+			}
+		})
+	}
+}
+
+func TestAssetHandlerHeaders(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(fpath, text string) {
+		_, err := st.PutObject(bucket, fpath, utils.NopReaderAtCloser(strings.NewReader(text)), &utils.FileEntry{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("test/index.html", "home")
+	put("test/docs/index.html", "docs")
+
+	serve := func(fpath string) http.Header {
+		handler := &AssetHandler{
+			ProjectDir: "test",
+			Filepath:   fpath,
+			Cfg:        &shared.ConfigSite{},
+			Storage:    st,
+			Logger:     slog.Default(),
+			Bucket:     bucket,
+		}
+		w := httptest.NewRecorder()
+		handler.handle(w, httptest.NewRequest("GET", fpath, nil))
+		return w.Header()
+	}
+
+	put("test/_headers", "/*\n  x-frame-options: DENY\n/docs/*\n  cache-control: max-age=60")
+	if hdr := serve("/docs/"); hdr.Get("x-frame-options") != "DENY" || hdr.Get("cache-control") != "max-age=60" {
+		t.Fatalf("expected both rules to apply, found %v", hdr)
+	}
+	if hdr := serve("/"); hdr.Get("cache-control") != "" {
+		t.Fatalf("expected only the catch-all rule, found %v", hdr)
+	}
+
+	// a new upload is picked up instead of the compiled rules
+	time.Sleep(10 * time.Millisecond)
+	put("test/_headers", "/*\n  x-frame-options: SAMEORIGIN")
+	if hdr := serve("/docs/"); hdr.Get("x-frame-options") != "SAMEORIGIN" || hdr.Get("cache-control") != "" {
+		t.Fatalf("expected the updated rules, found %v", hdr)
+	}
+}
@@ -3,8 +3,8 @@ package pgs
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/picosh/pico/shared"
@@ -50,24 +50,30 @@ func expandRoute(projectName, fp string, status int) []*HttpReply {
 		)
 	}
 
-	dirRoute := shared.GetAssetFileName(&utils.FileEntry{
-		Filepath: filepath.Join(projectName, fp, "index.html"),
-	})
-
 	routes = append(
 		routes,
-		&HttpReply{Filepath: dirRoute, Status: status},
+		&HttpReply{Filepath: dirIndexRoute(projectName, fp), Status: status},
 	)
 
 	return routes
 }
 
+// dirIndexRoute is the index.html a directory request is served from.
+func dirIndexRoute(projectName, fp string) string {
+	return shared.GetAssetFileName(&utils.FileEntry{
+		Filepath: filepath.Join(projectName, fp, "index.html"),
+	})
+}
+
 func hasProtocol(url string) bool {
 	isFullUrl := strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
 	return isFullUrl
 }
 
-func calcRoutes(projectName, fp string, userRedirects []*RedirectRule) []*HttpReply {
+// calcRoutes lists the files a request could be served from in order, the
+// first rule of _redirects matching fp and query is tried after the files
+// unless it is forced.
+func calcRoutes(projectName, fp string, query url.Values, userRedirects []*RedirectRule) []*HttpReply {
 	notFound := &HttpReply{
 		Filepath: filepath.Join(projectName, "404.html"),
 		Status:   http.StatusNotFound,
@@ -91,43 +97,44 @@ func calcRoutes(projectName, fp string, userRedirects []*RedirectRule) []*HttpRe
 
 	// user routes
 	for _, redirect := range userRedirects {
-		rr := regexp.MustCompile(redirect.From)
-		match := rr.FindStringSubmatch(fp)
-		if len(match) > 0 {
-			userReply := []*HttpReply{}
-			ruleRoute := redirect.To
-
-			// special case for redirects that include http(s)://
-			isFullUrl := hasProtocol(redirect.To)
-			if !isFullUrl {
-				ruleRoute = shared.GetAssetFileName(&utils.FileEntry{
-					Filepath: filepath.Join(projectName, redirect.To),
-				})
-			}
-
-			var rule *HttpReply
-			if redirect.To != "" && redirect.To != "/" {
-				rule = &HttpReply{
-					Filepath: ruleRoute,
-					Status:   redirect.Status,
-					Query:    redirect.Query,
-				}
-				userReply = append(userReply, rule)
+		to, ok := redirect.Match(fp, query)
+		if !ok {
+			continue
+		}
+		userReply := []*HttpReply{}
+
+		// special case for redirects that include http(s):// and for rules
+		// that send the client elsewhere, the handler answers with a location
+		isFullUrl := hasProtocol(to)
+		if isFullUrl || isRedirectStatus(redirect.Status) {
+			if !isFullUrl && !strings.HasPrefix(to, "/") {
+				to = "/" + to
 			}
-
-			if !isFullUrl {
-				expandedRoutes := expandRoute(projectName, redirect.To, redirect.Status)
-				userReply = append(userReply, expandedRoutes...)
+			userReply = append(userReply, &HttpReply{
+				Filepath: to,
+				Status:   redirect.Status,
+				Query:    redirect.Query,
+			})
+		} else {
+			if to != "" && to != "/" {
+				userReply = append(userReply, &HttpReply{
+					Filepath: shared.GetAssetFileName(&utils.FileEntry{
+						Filepath: filepath.Join(projectName, to),
+					}),
+					Status: redirect.Status,
+					Query:  redirect.Query,
+				})
 			}
+			userReply = append(userReply, expandRoute(projectName, to, redirect.Status)...)
+		}
 
-			if redirect.Force {
-				rts = userReply
-			} else {
-				rts = append(rts, userReply...)
-			}
-			// quit after first match
-			break
+		if redirect.Force {
+			rts = userReply
+		} else {
+			rts = append(rts, userReply...)
 		}
+		// quit after first match
+		break
 	}
 
 	rts = append(rts,
@@ -2,6 +2,7 @@ package pgs
 
 import (
 	"fmt"
+	"net/url"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -17,7 +18,7 @@ func TestCalcRoutes(t *testing.T) {
 	fixtures := []RouteFixture{
 		{
 			Name:   "basic-index",
-			Actual: calcRoutes("test", "/index.html", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/index.html", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/index.html", Status: 200},
 				{Filepath: "test/404.html", Status: 404},
@@ -25,7 +26,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name:   "basic-txt",
-			Actual: calcRoutes("test", "/index.txt", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/index.txt", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/index.txt", Status: 200},
 				{Filepath: "test/404.html", Status: 404},
@@ -33,7 +34,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name:   "basic-named",
-			Actual: calcRoutes("test", "/wow.html", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/wow.html", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/wow.html", Status: 200},
 				{Filepath: "test/404.html", Status: 404},
@@ -41,7 +42,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name:   "subdirectory-index",
-			Actual: calcRoutes("test", "/nice/index.html", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/nice/index.html", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/nice/index.html", Status: 200},
 				{Filepath: "test/404.html", Status: 404},
@@ -49,7 +50,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name:   "subdirectory-named",
-			Actual: calcRoutes("test", "/nice/wow.html", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/nice/wow.html", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/nice/wow.html", Status: 200},
 				{Filepath: "test/404.html", Status: 404},
@@ -57,7 +58,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name:   "subdirectory-bare",
-			Actual: calcRoutes("test", "/nice", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/nice", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/nice.html", Status: 200},
 				{Filepath: "test/nice/index.html", Status: 200},
@@ -66,7 +67,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name: "spa",
-			Actual: calcRoutes("test", "/nice", []*RedirectRule{
+			Actual: calcRoutes("test", "/nice", nil, []*RedirectRule{
 				{
 					From:   "/*",
 					To:     "/index.html",
@@ -82,7 +83,7 @@ func TestCalcRoutes(t *testing.T) {
 		},
 		{
 			Name:   "xml",
-			Actual: calcRoutes("test", "/index.xml", []*RedirectRule{}),
+			Actual: calcRoutes("test", "/index.xml", nil, []*RedirectRule{}),
 			Expected: []*HttpReply{
 				{Filepath: "test/index.xml", Status: 200},
 				{Filepath: "test/404.html", Status: 404},
@@ -93,6 +94,7 @@ func TestCalcRoutes(t *testing.T) {
 			Actual: calcRoutes(
 				"test",
 				"/wow",
+				nil,
 				[]*RedirectRule{
 					{
 						From:   "/wow",
@@ -104,7 +106,7 @@ func TestCalcRoutes(t *testing.T) {
 			Expected: []*HttpReply{
 				{Filepath: "test/wow.html", Status: 200},
 				{Filepath: "test/wow/index.html", Status: 200},
-				{Filepath: "test/index.html", Status: 301},
+				{Filepath: "/index.html", Status: 301},
 				{Filepath: "test/404.html", Status: 404},
 			},
 		},
@@ -113,6 +115,7 @@ func TestCalcRoutes(t *testing.T) {
 			Actual: calcRoutes(
 				"test",
 				"/wow",
+				nil,
 				[]*RedirectRule{
 					{
 						From:   "/wow",
@@ -124,7 +127,7 @@ func TestCalcRoutes(t *testing.T) {
 			Expected: []*HttpReply{
 				{Filepath: "test/wow.html", Status: 200},
 				{Filepath: "test/wow/index.html", Status: 200},
-				{Filepath: "test/index.html", Status: 301},
+				{Filepath: "/", Status: 301},
 				{Filepath: "test/404.html", Status: 404},
 			},
 		},
@@ -133,6 +136,7 @@ func TestCalcRoutes(t *testing.T) {
 			Actual: calcRoutes(
 				"test",
 				"/wow",
+				nil,
 				[]*RedirectRule{
 					{
 						From:   "/wow",
@@ -143,7 +147,7 @@ func TestCalcRoutes(t *testing.T) {
 				},
 			),
 			Expected: []*HttpReply{
-				{Filepath: "test/index.html", Status: 301},
+				{Filepath: "/", Status: 301},
 				{Filepath: "test/404.html", Status: 404},
 			},
 		},
@@ -152,6 +156,7 @@ func TestCalcRoutes(t *testing.T) {
 			Actual: calcRoutes(
 				"test",
 				"/wow",
+				nil,
 				[]*RedirectRule{
 					{
 						From:   "/wow",
@@ -167,6 +172,48 @@ func TestCalcRoutes(t *testing.T) {
 				{Filepath: "test/404.html", Status: 404},
 			},
 		},
+		{
+			Name: "rewriteSplat",
+			Actual: calcRoutes(
+				"test",
+				"/blog/2024/hello",
+				nil,
+				[]*RedirectRule{
+					{
+						From:   "/blog/*",
+						To:     "/posts/:splat.html",
+						Status: 200,
+					},
+				},
+			),
+			Expected: []*HttpReply{
+				{Filepath: "test/blog/2024/hello.html", Status: 200},
+				{Filepath: "test/blog/2024/hello/index.html", Status: 200},
+				{Filepath: "test/posts/2024/hello.html", Status: 200},
+				{Filepath: "test/404.html", Status: 404},
+			},
+		},
+		{
+			Name: "redirectQuery",
+			Actual: calcRoutes(
+				"test",
+				"/store",
+				url.Values{"id": []string{"42"}},
+				[]*RedirectRule{
+					{
+						From:   "/store",
+						To:     "/items/:id",
+						Status: 302,
+						Query:  map[string]string{"id": ":id"},
+						Force:  true,
+					},
+				},
+			),
+			Expected: []*HttpReply{
+				{Filepath: "/items/42", Status: 302, Query: map[string]string{"id": ":id"}},
+				{Filepath: "test/404.html", Status: 404},
+			},
+		},
 	}
 
 	for _, fixture := range fixtures {
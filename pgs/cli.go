@@ -4,17 +4,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
 	"github.com/picosh/pico/db"
+	uploadassets "github.com/picosh/pico/filehandlers/assets"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/bus"
 	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/webhooks"
 	"github.com/picosh/pico/wish/cms/ui/common"
+	sst "github.com/picosh/pobj/storage"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func styleRows(styles common.Styles) func(row, col int) lipgloss.Style {
@@ -67,7 +79,7 @@ func projectTable(styles common.Styles, projects []*db.Project) *table.Table {
 }
 
 func getHelpText(styles common.Styles, userName string) string {
-	helpStr := "Commands: [help, stats, ls, rm, link, unlink, prune, retain, depends, acl]\n\n"
+	helpStr := "Commands: [help, stats, df, ls, projects, rm, link, unlink, prune, retain, depends, verify, acl, csp, sitemap, reserve, mv, cp, set-ttl, share, org]\n\n"
 	helpStr += styles.Note.Render("NOTICE:") + " *must* append with `--write` for the changes to persist.\n\n"
 
 	projectName := "projA"
@@ -81,13 +93,21 @@ func getHelpText(styles common.Styles, userName string) string {
 			"stats",
 			"usage statistics",
 		},
+		{
+			"df --projects",
+			"storage used against your quota, optionally per project",
+		},
 		{
 			"ls",
 			"lists projects",
 		},
+		{
+			"projects",
+			"lists projects with file counts and sizes",
+		},
 		{
 			fmt.Sprintf("rm %s", projectName),
-			fmt.Sprintf("delete %s", projectName),
+			fmt.Sprintf("delete %s and its assets, alias `rm-project`", projectName),
 		},
 		{
 			fmt.Sprintf("link %s --to projB", projectName),
@@ -101,6 +121,10 @@ func getHelpText(styles common.Styles, userName string) string {
 			fmt.Sprintf("prune %s", projectName),
 			fmt.Sprintf("removes projects that match prefix `%s`", projectName),
 		},
+		{
+			"prune --days 30 --empty",
+			"removes projects not updated in 30 days or without files",
+		},
 		{
 			fmt.Sprintf("retain %s", projectName),
 			"alias to `prune` but keeps last N projects",
@@ -109,10 +133,54 @@ func getHelpText(styles common.Styles, userName string) string {
 			fmt.Sprintf("depends %s", projectName),
 			fmt.Sprintf("lists all projects linked to `%s`", projectName),
 		},
+		{
+			fmt.Sprintf("verify %s", projectName),
+			fmt.Sprintf("checks the files of `%s` against their checksums", projectName),
+		},
 		{
 			fmt.Sprintf("acl %s", projectName),
 			fmt.Sprintf("access control for `%s`", projectName),
 		},
+		{
+			fmt.Sprintf("acl set %s --password --user friend", projectName),
+			fmt.Sprintf("requires a password or pico sign in to view `%s`", projectName),
+		},
+		{
+			"org my-team --add friend --role deployer",
+			"members of an organization deploy with `ssh my-team@`",
+		},
+		{
+			fmt.Sprintf("csp %s \"default-src 'self'\"", projectName),
+			fmt.Sprintf("content-security-policy for `%s`", projectName),
+		},
+		{
+			fmt.Sprintf("sitemap %s on", projectName),
+			fmt.Sprintf("generate sitemap.xml and robots.txt when `%s` is deployed", projectName),
+		},
+		{
+			fmt.Sprintf("mv %s projB", projectName),
+			fmt.Sprintf("rename `%s` to `projB`", projectName),
+		},
+		{
+			fmt.Sprintf("mv %s/draft.html %s/index.html", projectName, projectName),
+			"rename a file within a project",
+		},
+		{
+			fmt.Sprintf("cp %s/index.html projB/index.html", projectName),
+			fmt.Sprintf("copy a file, or all of `%s/`, into another project", projectName),
+		},
+		{
+			fmt.Sprintf("set-ttl %s 24h", projectName),
+			fmt.Sprintf("delete `%s` after a duration, `none` keeps it forever", projectName),
+		},
+		{
+			fmt.Sprintf("share %s/index.html --ttl 24h", projectName),
+			"time-limited link to a file, even of a private project",
+		},
+		{
+			fmt.Sprintf("reserve %s 1000000", projectName),
+			fmt.Sprintf("check quota and hold bytes for a deploy to `%s`", projectName),
+		},
 	}
 
 	t := table.New().
@@ -163,6 +231,15 @@ type Cmd struct {
 	Dbpool  db.DB
 	Write   bool
 	Styles  common.Styles
+	// Sessions are the live ssh sessions on this server, see `admin`
+	Sessions *uploadassets.Sessions
+	// Events is where project changes are published, nil drops them
+	Events bus.Bus
+	// Actor is who is logged in when it is not User, e.g. an org member
+	Actor      *db.User
+	SessionID  string
+	RemoteAddr net.Addr
+	Space      string
 }
 
 func (c *Cmd) output(out string) {
@@ -175,6 +252,29 @@ func (c *Cmd) error(err error) {
 	_ = c.Session.Close()
 }
 
+// notify records a change that was written in the audit log and
+// publishes it for the deploy feed and the user's webhooks.
+func (c *Cmd) notify(event, projectName string) {
+	if !c.Write {
+		return
+	}
+	if c.Events != nil {
+		err := c.Events.Publish(&bus.Event{
+			Topic:   event,
+			UserID:  c.User.ID,
+			User:    c.User.Name,
+			Space:   c.Space,
+			Project: projectName,
+		})
+		if err != nil {
+			c.Log.Error("could not publish project event", "project", projectName, "err", err.Error())
+		}
+	}
+	// project events are named like the audit actions
+	entry := audit.NewEntry(c.User, c.Actor, c.Space, c.SessionID, c.RemoteAddr, event, projectName)
+	audit.Record(c.Dbpool, c.Log, entry)
+}
+
 func (c *Cmd) bail(err error) {
 	if err == nil {
 		return
@@ -197,42 +297,55 @@ func (c *Cmd) RmProjectAssets(projectName string) error {
 	}
 	c.output(fmt.Sprintf("removing project assets (%s)", projectName))
 
-	fileList, err := c.Store.ListObjects(bucket, projectName+"/", true)
-	if err != nil {
-		return err
+	fileList, err := storage.WalkObjects(c.Store, bucket, projectName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not list assets of project (%s): %w", projectName, err)
 	}
-
 	if len(fileList) == 0 {
 		c.output(fmt.Sprintf("no assets found for project (%s)", projectName))
 		return nil
 	}
 	c.output(fmt.Sprintf("found (%d) assets for project (%s), removing", len(fileList), projectName))
 
+	c.Log.Info(
+		"attempting to delete files",
+		"bucket", bucket.Name,
+		"project", projectName,
+		"count", len(fileList),
+	)
+
+	count := len(fileList)
+	size := int64(0)
 	for _, file := range fileList {
-		intent := fmt.Sprintf("deleted (%s)", file.Name())
-		c.Log.Info(
-			"attempting to delete file",
-			"user", c.User.Name,
-			"bucket", bucket.Name,
-			"filename", file.Name(),
-		)
-		if c.Write {
-			err = c.Store.DeleteObject(
-				bucket,
-				filepath.Join(projectName, file.Name()),
+		size += file.Size()
+	}
+
+	if c.Write {
+		count, size, err = storage.DeleteObjects(c.Store, bucket, projectName)
+		if err != nil {
+			return errors.Join(
+				err,
+				fmt.Errorf("deleted %d files (%s) before failing", count, shared.HumanSize(size)),
 			)
-			if err == nil {
-				c.output(intent)
-			} else {
-				return err
-			}
-		} else {
-			c.output(intent)
 		}
 	}
+
+	if c.Write {
+		c.forgetObjectCount(projectName)
+	}
+	c.output(fmt.Sprintf("deleted %d files (%s)", count, shared.HumanSize(size)))
 	return nil
 }
 
+// forgetObjectCount makes the next upload count the project again after a
+// command changed its files behind the upload handler's back.
+func (c *Cmd) forgetObjectCount(projectName string) {
+	err := c.Dbpool.SetProjectObjectCount(c.User.ID, projectName, nil)
+	if err != nil {
+		c.Log.Error("could not reset object count", "project", projectName, "err", err)
+	}
+}
+
 func (c *Cmd) help() {
 	c.output(getHelpText(c.Styles, c.User.Name))
 }
@@ -297,8 +410,168 @@ func (c *Cmd) ls() error {
 	return nil
 }
 
+// maxProjectSizes bounds how many projects we walk in storage for the
+// `projects` command so large accounts don't stall the connection.
+var maxProjectSizes = 100
+
+// usage is what the user's bucket holds and how much they may store.
+func (c *Cmd) usage(cfgMaxSize uint64) (sst.Bucket, storage.BucketStats, uint64, error) {
+	ff, err := c.Dbpool.FindFeatureForUser(c.User.ID, "pgs")
+	if err != nil {
+		ff = db.NewFeatureFlag(c.User.ID, "pgs", cfgMaxSize, 0)
+	}
+	storageMax := ff.FindStorageMax(cfgMaxSize)
+
+	bucket, err := c.Store.UpsertBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return bucket, storage.BucketStats{}, storageMax, err
+	}
+
+	stats, err := c.Store.GetBucketStats(bucket)
+	return bucket, stats, storageMax, err
+}
+
+// projectSize counts the files of a project and the bytes they take up.
+func (c *Cmd) projectSize(bucket sst.Bucket, projectName string) (int, int64, error) {
+	entries, err := storage.WalkObjects(c.Store, bucket, projectName)
+	if err != nil {
+		return 0, 0, err
+	}
+	size := int64(0)
+	for _, entry := range entries {
+		size += entry.Size()
+	}
+	return len(entries), size, nil
+}
+
+func (c *Cmd) df(cfgMaxSize uint64, byProject bool) error {
+	bucket, stats, storageMax, err := c.usage(cfgMaxSize)
+	if err != nil {
+		return err
+	}
+	used := stats.TotalSize
+
+	percent := float32(0)
+	if storageMax > 0 {
+		percent = (float32(used) / float32(storageMax)) * 100
+	}
+	c.output(fmt.Sprintf(
+		"used %s of %s (%.2f%%) across (%d) files",
+		shared.HumanSize(int64(used)),
+		shared.HumanSize(int64(storageMax)),
+		percent,
+		stats.FileCount,
+	))
+
+	if !byProject {
+		return nil
+	}
+
+	projects, err := c.Dbpool.FindProjectsByUser(c.User.ID)
+	if err != nil {
+		return err
+	}
+
+	data := [][]string{}
+	for _, project := range projects {
+		// links share the assets of the project they point to
+		if project.Name != project.ProjectDir {
+			continue
+		}
+
+		// projects without any uploads have nothing to walk
+		_, size, err := c.projectSize(bucket, project.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		share := float32(0)
+		if used > 0 {
+			share = (float32(size) / float32(used)) * 100
+		}
+		data = append(data, []string{
+			project.Name,
+			shared.HumanSize(size),
+			fmt.Sprintf("%.2f", share),
+		})
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(c.Styles.CliBorder).
+		Headers("Project", "Size", "Used (%)").
+		Rows(data...).
+		StyleFunc(styleRows(c.Styles))
+	c.output(t.String())
+	return nil
+}
+
+func (c *Cmd) projects() error {
+	projects, err := c.Dbpool.FindProjectsByUser(c.User.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(projects) == 0 {
+		c.output("no projects found")
+		return nil
+	}
+
+	bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Name < projects[j].Name
+	})
+
+	data := [][]string{}
+	walked := 0
+	for _, project := range projects {
+		row := []string{project.Name, "-", "-"}
+		// links do not have assets of their own
+		if project.Name != project.ProjectDir {
+			row[1] = fmt.Sprintf("-> %s", project.ProjectDir)
+			data = append(data, row)
+			continue
+		}
+
+		if walked >= maxProjectSizes {
+			data = append(data, row)
+			continue
+		}
+		walked += 1
+
+		count, size, err := c.projectSize(bucket, project.Name)
+		if err == nil {
+			row[1] = fmt.Sprintf("%d", count)
+			row[2] = shared.HumanSize(size)
+		}
+		data = append(data, row)
+	}
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(c.Styles.CliBorder).
+		Headers("Name", "Files", "Size").
+		Rows(data...).
+		StyleFunc(styleRows(c.Styles))
+	c.output(t.String())
+
+	if walked >= maxProjectSizes && len(projects) > walked {
+		c.output(fmt.Sprintf("sizes only computed for the first (%d) projects", maxProjectSizes))
+	}
+
+	return nil
+}
+
 func (c *Cmd) unlink(projectName string) error {
-	c.Log.Info("user running `unlink` command", "user", c.User.Name, "project", projectName)
+	c.Log.Info("user running `unlink` command", "project", projectName)
 	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
 	if err != nil {
 		return errors.Join(err, fmt.Errorf("project (%s) does not exit", projectName))
@@ -309,31 +582,50 @@ func (c *Cmd) unlink(projectName string) error {
 		return err
 	}
 	c.output(fmt.Sprintf("(%s) unlinked", project.Name))
+	c.notify(webhooks.ProjectUpdate, project.Name)
 
 	return nil
 }
 
 func (c *Cmd) link(projectName, linkTo string) error {
-	c.Log.Info("user running `link` command", "user", c.User.Name, "project", projectName, "link", linkTo)
+	c.Log.Info("user running `link` command", "project", projectName, "link", linkTo)
+
+	if projectName == linkTo {
+		return fmt.Errorf("(%s) cannot link to itself", projectName)
+	}
 
 	projectDir := linkTo
-	_, err := c.Dbpool.FindProjectByName(c.User.ID, linkTo)
+	target, err := c.Dbpool.FindProjectByName(c.User.ID, linkTo)
 	if err != nil {
 		e := fmt.Errorf("(%s) project doesn't exist", linkTo)
 		return e
 	}
+	// links are only followed one level deep
+	if target.Name != target.ProjectDir {
+		return fmt.Errorf("(%s) is a link itself, link to (%s) instead", linkTo, target.ProjectDir)
+	}
 
 	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
 	projectID := ""
+	event := webhooks.ProjectUpdate
 	if err == nil {
+		// links to this project would end up two levels deep
+		links, err := c.Dbpool.FindProjectLinks(c.User.ID, projectName)
+		if err != nil {
+			return err
+		}
+		if len(links) > 0 {
+			return fmt.Errorf("(%s) has (%d) projects linking to it, unlink them first", projectName, len(links))
+		}
+
 		projectID = project.ID
-		c.Log.Info("user already has project, updating", "user", c.User.Name, "project", projectName)
+		c.Log.Info("user already has project, updating", "project", projectName)
 		err = c.Dbpool.LinkToProject(c.User.ID, project.ID, projectDir, c.Write)
 		if err != nil {
 			return err
 		}
 	} else {
-		c.Log.Info("user has no project record, creating", "user", c.User.Name, "project", projectName)
+		c.Log.Info("user has no project record, creating", "project", projectName)
 		if !c.Write {
 			out := fmt.Sprintf("(%s) cannot create a new project without `--write` permission, aborting", projectName)
 			c.output(out)
@@ -344,13 +636,15 @@ func (c *Cmd) link(projectName, linkTo string) error {
 			return err
 		}
 		projectID = id
+		event = webhooks.ProjectCreate
 	}
 
-	c.Log.Info("user linking", "user", c.User.Name, "project", projectName, "projectDir", projectDir)
+	c.Log.Info("user linking", "project", projectName, "projectDir", projectDir)
 	err = c.Dbpool.LinkToProject(c.User.ID, projectID, projectDir, c.Write)
 	if err != nil {
 		return err
 	}
+	c.notify(event, projectName)
 
 	out := fmt.Sprintf("(%s) might have orphaned assets, removing", projectName)
 	c.output(out)
@@ -383,10 +677,79 @@ func (c *Cmd) depends(projectName string) error {
 	return nil
 }
 
+type corruptObject struct {
+	path     string
+	expected string
+	actual   string
+	err      error
+}
+
+// verifyObjects re-hashes every object below dir, it returns the ones that
+// no longer match their checksum and how many have none to compare with.
+func (c *Cmd) verifyObjects(bucket sst.Bucket, dir string) ([]corruptObject, int, int, error) {
+	corrupt := []corruptObject{}
+	unverified := 0
+	entries, err := storage.WalkObjects(c.Store, bucket, dir)
+	if err != nil {
+		return corrupt, unverified, 0, err
+	}
+
+	for _, entry := range entries {
+		expected, actual, err := storage.RehashObject(c.Store, bucket, entry.Path)
+		if errors.Is(err, storage.ErrNoChecksum) {
+			unverified += 1
+			continue
+		}
+		if err != nil || expected != actual {
+			corrupt = append(corrupt, corruptObject{path: entry.Path, expected: expected, actual: actual, err: err})
+		}
+	}
+	return corrupt, unverified, len(entries), nil
+}
+
+func (c *Cmd) verify(projectName string) error {
+	c.Log.Info("user running `verify` command", "project", projectName)
+
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil {
+		return fmt.Errorf("project (%s) does not exist", projectName)
+	}
+	bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	// links share the assets of the project they point to
+	corrupt, unverified, total, err := c.verifyObjects(bucket, project.ProjectDir)
+	if err != nil {
+		return err
+	}
+	for _, obj := range corrupt {
+		if obj.err != nil {
+			c.output(fmt.Sprintf("corrupt: %s (%s)", obj.path, obj.err))
+			continue
+		}
+		c.output(fmt.Sprintf("corrupt: %s (expected %s, found %s)", obj.path, obj.expected, obj.actual))
+	}
+	c.output(fmt.Sprintf(
+		"verified (%d) files of (%s): (%d) corrupt, (%d) stored without a checksum",
+		total,
+		project.ProjectDir,
+		len(corrupt),
+		unverified,
+	))
+
+	if len(corrupt) > 0 {
+		c.Log.Error("found corrupt objects", "project", projectName, "count", len(corrupt))
+		return fmt.Errorf("(%d) files of (%s) are corrupt, upload them again", len(corrupt), projectName)
+	}
+	return nil
+}
+
 // delete all the projects and associated assets matching prefix
 // but keep the latest N records.
 func (c *Cmd) prune(prefix string, keepNumLatest int) error {
-	c.Log.Info("user running `clean` command", "user", c.User.Name, "prefix", prefix)
+	c.Log.Info("user running `clean` command", "prefix", prefix)
 	c.output(fmt.Sprintf("searching for projects that match prefix (%s) and are not linked to other projects", prefix))
 
 	if prefix == "" || prefix == "*" {
@@ -451,6 +814,7 @@ func (c *Cmd) prune(prefix string, keepNumLatest int) error {
 			if err != nil {
 				return err
 			}
+			c.notify(webhooks.ProjectDelete, project.Name)
 		}
 	}
 
@@ -463,55 +827,978 @@ func (c *Cmd) prune(prefix string, keepNumLatest int) error {
 	return nil
 }
 
-func (c *Cmd) rm(projectName string) error {
-	c.Log.Info("user running `rm` command", "user", c.User.Name, "project", projectName)
-	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
-	if err == nil {
-		c.Log.Info("found project, checking dependencies", "project", projectName, "projectID", project.ID)
+type staleProject struct {
+	project *db.Project
+	reason  string
+}
 
-		links, err := c.Dbpool.FindProjectLinks(c.User.ID, projectName)
+// findStaleProjects returns the projects not updated in the last days and,
+// with empty, the projects without a single file. Links have no files of
+// their own so they only ever go stale.
+func (c *Cmd) findStaleProjects(bucket sst.Bucket, bucketErr error, days int, empty bool) ([]staleProject, error) {
+	found := []staleProject{}
+	seen := map[string]bool{}
+
+	if days > 0 {
+		projects, err := c.Dbpool.FindStaleProjects(c.User.ID, time.Now().AddDate(0, 0, -days))
 		if err != nil {
-			return err
+			return found, err
 		}
+		for _, project := range projects {
+			seen[project.ID] = true
+			found = append(found, staleProject{project, fmt.Sprintf("not updated in (%d) days", days)})
+		}
+	}
+
+	if empty {
+		projects, err := c.Dbpool.FindProjectsByUser(c.User.ID)
+		if err != nil {
+			return found, err
+		}
+		for _, project := range projects {
+			if seen[project.ID] || project.Name != project.ProjectDir {
+				continue
+			}
+			if bucketErr == nil {
+				fileList, err := c.Store.ListObjects(bucket, project.Name+"/", false)
+				// a project we could not list is not known to be empty
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					c.Log.Error("could not list project files", "project", project.Name, "err", err)
+					c.output(fmt.Sprintf("could not list files of project (%s), skipping it: %s", project.Name, err))
+					continue
+				}
+				if len(fileList) > 0 {
+					continue
+				}
+			}
+			found = append(found, staleProject{project, "no files"})
+		}
+	}
+
+	return found, nil
+}
+
+// pruneStale deletes projects that are empty or were not updated in days,
+// along with their assets and revisions. Projects other projects link to
+// are kept.
+func (c *Cmd) pruneStale(days int, empty bool) error {
+	c.Log.Info("user running `prune` command", "days", days, "empty", empty)
+	if days <= 0 && !empty {
+		return fmt.Errorf("must provide a prefix, `--days` or `--empty`")
+	}
+
+	bucket, bucketErr := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	found, err := c.findStaleProjects(bucket, bucketErr, days, empty)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		c.output("no projects to prune")
+		return nil
+	}
 
+	goodbye := []*db.Project{}
+	for _, stale := range found {
+		links, err := c.Dbpool.FindProjectLinks(c.User.ID, stale.project.Name)
+		if err != nil {
+			return err
+		}
 		if len(links) > 0 {
-			e := fmt.Errorf("project (%s) has (%d) projects linking to it, cannot delete project until they have been unlinked or removed, aborting", projectName, len(links))
-			return e
+			out := fmt.Sprintf("project (%s) has (%d) projects linked to it, cannot prune", stale.project.Name, len(links))
+			c.output(out)
+			continue
 		}
+		c.output(fmt.Sprintf("project (%s) is available to be pruned, %s", stale.project.Name, stale.reason))
+		goodbye = append(goodbye, stale.project)
+	}
 
-		out := fmt.Sprintf("(%s) removing", project.Name)
-		c.output(out)
-		if c.Write {
-			c.Log.Info("removing project", "project", project.Name)
-			err = c.Dbpool.RemoveProject(project.ID)
+	if !c.Write || len(goodbye) == 0 {
+		return nil
+	}
+
+	removed := []string{}
+	for _, project := range goodbye {
+		if project.Name == project.ProjectDir && bucketErr == nil {
+			entries, err := storage.WalkObjects(c.Store, bucket, project.Name)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				c.Log.Error("could not list project assets", "project", project.Name, "err", err)
+				c.output(fmt.Sprintf("could not list files of project (%s), keeping it: %s", project.Name, err))
+				continue
+			}
+			paths := []string{}
+			for _, entry := range entries {
+				paths = append(paths, entry.Path)
+			}
+
+			errs := c.Store.BatchDelete(bucket, paths)
+			if len(errs) > 0 {
+				c.Log.Error("could not remove project assets", "project", project.Name, "count", len(errs))
+				c.output(fmt.Sprintf("could not remove (%d) files of project (%s), keeping it", len(errs), project.Name))
+				continue
+			}
+			err = c.rmRevisions(project)
 			if err != nil {
-				return err
+				c.Log.Error("could not remove revisions", "project", project.Name, "err", err)
+				c.output(fmt.Sprintf("could not remove revisions of project (%s), keeping it", project.Name))
+				continue
 			}
 		}
-	} else {
-		e := fmt.Errorf("(%s) project not found for user (%s)", projectName, c.User.Name)
-		return e
+
+		c.Log.Info("removing project", "project", project.Name)
+		err := c.Dbpool.RemoveProject(project.ID)
+		if err != nil {
+			return err
+		}
+		c.notify(webhooks.ProjectDelete, project.Name)
+		removed = append(removed, project.Name)
 	}
 
-	err = c.RmProjectAssets(project.Name)
-	return err
+	c.output("\nsummary")
+	c.output("=======")
+	for _, name := range removed {
+		c.output(fmt.Sprintf("project (%s) removed", name))
+	}
+
+	return nil
 }
 
-func (c *Cmd) acl(projectName, aclType string, acls []string) error {
-	c.Log.Info(
-		"user running `acl` command",
-		"user", c.User.Name,
-		"project", projectName,
-		"actType", aclType,
-		"acls", acls,
-	)
-	c.output(fmt.Sprintf("setting acl for %s to %s (%s)", projectName, aclType, strings.Join(acls, ",")))
-	acl := db.ProjectAcl{
-		Type: aclType,
-		Data: acls,
+func (c *Cmd) rm(projectName string) error {
+	c.Log.Info("user running `rm` command", "project", projectName)
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil || project == nil {
+		return fmt.Errorf("(%s) project not found for user (%s)", projectName, c.User.Name)
 	}
-	if c.Write {
-		return c.Dbpool.UpdateProjectAcl(c.User.ID, projectName, acl)
+
+	c.Log.Info("found project, checking dependencies", "project", projectName, "projectID", project.ID)
+	links, err := c.Dbpool.FindProjectLinks(c.User.ID, projectName)
+	if err != nil {
+		return err
+	}
+
+	if len(links) > 0 {
+		e := fmt.Errorf("project (%s) has (%d) projects linking to it, cannot delete project until they have been unlinked or removed, aborting", projectName, len(links))
+		return e
+	}
+
+	// remove assets first so a failure leaves the project around to retry
+	if project.Name == project.ProjectDir {
+		err = c.RmProjectAssets(project.Name)
+		if err != nil {
+			return err
+		}
+		err = c.rmRevisions(project)
+		if err != nil {
+			return err
+		}
+	}
+
+	out := fmt.Sprintf("(%s) removing", project.Name)
+	c.output(out)
+	if c.Write {
+		c.Log.Info("removing project", "project", project.Name)
+		err = c.Dbpool.RemoveProject(project.ID)
+		if err != nil {
+			return err
+		}
+		c.notify(webhooks.ProjectDelete, project.Name)
+	}
+
+	return nil
+}
+
+func (c *Cmd) acl(projectName, aclType string, acls []string) error {
+	c.Log.Info(
+		"user running `acl` command",
+		"project", projectName,
+		"actType", aclType,
+		"acls", acls,
+	)
+	c.output(fmt.Sprintf("setting acl for %s to %s (%s)", projectName, aclType, strings.Join(acls, ",")))
+	acl := db.ProjectAcl{
+		Type: aclType,
+		Data: acls,
+	}
+	if c.Write {
+		return c.Dbpool.UpdateProjectAcl(c.User.ID, projectName, acl)
+	}
+	return nil
+}
+
+// org manages the organization name, it is created with the user as its
+// owner or gets add set to role and remove dropped. Only owners change
+// members and the last owner cannot leave.
+func (c *Cmd) org(name string, create bool, add, role, remove string) error {
+	c.Log.Info(
+		"user running `org` command",
+		"org", name,
+		"create", create,
+		"add", add,
+		"role", role,
+		"remove", remove,
+	)
+
+	if create {
+		c.output(fmt.Sprintf("creating organization (%s), deploy to it with `ssh %s@`", name, name))
+		if !c.Write {
+			return nil
+		}
+		_, err := c.Dbpool.CreateOrg(c.User.ID, name)
+		return err
+	}
+
+	org, err := c.Dbpool.FindOrgForName(name)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("organization (%s) does not exist", name))
+	}
+	self, err := c.Dbpool.FindOrgMember(org.ID, c.User.ID)
+	if err != nil {
+		return err
 	}
+	members, err := c.Dbpool.FindOrgMembers(org.ID)
+	if err != nil {
+		return err
+	}
+
+	if add == "" && remove == "" {
+		data := [][]string{}
+		for _, member := range members {
+			data = append(data, []string{member.Name, member.Role, member.CreatedAt.Format(time.DateOnly)})
+		}
+		t := table.New().
+			Border(lipgloss.NormalBorder()).
+			BorderStyle(c.Styles.CliBorder).
+			Headers("Member", "Role", "Since").
+			Rows(data...).
+			StyleFunc(styleRows(c.Styles))
+		c.output(t.String())
+		return nil
+	}
+
+	if self.Role != db.RoleOwner {
+		return fmt.Errorf("only owners of (%s) can change its members", org.Name)
+	}
+	owners := 0
+	for _, member := range members {
+		if member.Role == db.RoleOwner {
+			owners += 1
+		}
+	}
+
+	target := add
+	if target == "" {
+		target = remove
+	}
+	user, err := c.Dbpool.FindUserForName(target)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("user (%s) does not exist", target))
+	}
+	for _, member := range members {
+		if member.UserID == user.ID && member.Role == db.RoleOwner && owners == 1 && (remove != "" || role != db.RoleOwner) {
+			return fmt.Errorf("(%s) is the last owner of (%s)", user.Name, org.Name)
+		}
+	}
+
+	if remove != "" {
+		c.output(fmt.Sprintf("removing (%s) from (%s)", user.Name, org.Name))
+		if !c.Write {
+			return nil
+		}
+		return c.Dbpool.RemoveOrgMember(org.ID, user.ID)
+	}
+
+	if !slices.Contains(db.OrgRoles, role) {
+		return fmt.Errorf("role must be one of the following: [%s], found (%s)", strings.Join(db.OrgRoles, ", "), role)
+	}
+	c.output(fmt.Sprintf("setting (%s) to %s of (%s)", user.Name, role, org.Name))
+	if !c.Write {
+		return nil
+	}
+	return c.Dbpool.SetOrgMember(org.ID, user.ID, role)
+}
+
+// aclSet makes a project private, it is then only served over http to
+// whoever knows the password or signs in as one of users with an api token.
+// A new password is generated and shown once.
+func (c *Cmd) aclSet(projectName string, password bool, users []string) error {
+	c.Log.Info(
+		"user running `acl set` command",
+		"project", projectName,
+		"password", password,
+		"users", users,
+	)
+	if !password && len(users) == 0 {
+		return fmt.Errorf("must provide `--password` or at least one `--user`")
+	}
+
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("project (%s) does not exist", projectName))
+	}
+
+	entries := []*db.ProjectAccess{}
+	for _, name := range users {
+		_, err := c.Dbpool.FindUserForName(name)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("user (%s) does not exist", name))
+		}
+		entries = append(entries, &db.ProjectAccess{Kind: db.AccessUser, Value: name})
+	}
+
+	secret := ""
+	if password {
+		secret, err = webhooks.NewSecret()
+		if err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &db.ProjectAccess{Kind: db.AccessPassword, Value: string(hash)})
+	}
+
+	c.output(fmt.Sprintf("setting acl for %s to private (%s)", projectName, strings.Join(users, ",")))
+	if !c.Write {
+		return nil
+	}
+	err = c.Dbpool.SetProjectAccess(project.ID, entries)
+	if err != nil {
+		return err
+	}
+	err = c.Dbpool.UpdateProjectAcl(c.User.ID, projectName, db.ProjectAcl{Type: "private"})
+	if err != nil {
+		return err
+	}
+	if secret != "" {
+		c.output(fmt.Sprintf("password (shown only once): %s", secret))
+	}
+	if len(users) > 0 {
+		c.output("users sign in with their pico username and an api token")
+	}
+	return nil
+}
+
+func (c *Cmd) csp(projectName string, csp db.ProjectCsp) error {
+	c.Log.Info(
+		"user running `csp` command",
+		"project", projectName,
+		"policy", csp.Policy,
+		"reportOnly", csp.ReportOnly,
+		"reportUri", csp.ReportURI,
+	)
+
+	err := validateCsp(csp)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("project (%s) does not exist", projectName))
+	}
+
+	if csp.Policy == "" {
+		c.output(fmt.Sprintf("removing csp for %s", projectName))
+	} else {
+		header, value := cspHeader(csp)
+		c.output(fmt.Sprintf("setting csp for %s to %s: %s", projectName, header, value))
+	}
+
+	if c.Write {
+		return c.Dbpool.UpdateProjectCsp(c.User.ID, projectName, csp)
+	}
+	return nil
+}
+
+func (c *Cmd) setTTL(projectName string, ttl time.Duration) error {
+	c.Log.Info(
+		"user running `set-ttl` command",
+		"project", projectName,
+		"ttl", ttl,
+	)
+
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("project (%s) does not exist", projectName))
+	}
+
+	var expiresAt *time.Time
+	if ttl > 0 {
+		at := time.Now().Add(ttl)
+		expiresAt = &at
+		c.output(fmt.Sprintf("(%s) expires at %s", projectName, at.Format(time.RFC3339)))
+	} else {
+		c.output(fmt.Sprintf("(%s) removing expiry", projectName))
+	}
+
+	if c.Write {
+		return c.Dbpool.SetProjectExpiry(project.ID, expiresAt)
+	}
+	return nil
+}
+
+func (c *Cmd) sitemap(projectName string, enabled bool) error {
+	c.Log.Info(
+		"user running `sitemap` command",
+		"project", projectName,
+		"enabled", enabled,
+	)
+
+	_, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("project (%s) does not exist", projectName))
+	}
+
+	if enabled {
+		c.output(fmt.Sprintf("(%s) generates sitemap.xml and robots.txt on deploy", projectName))
+	} else {
+		c.output(fmt.Sprintf("(%s) no longer generates sitemap.xml and robots.txt", projectName))
+	}
+
+	if c.Write {
+		return c.Dbpool.UpdateProjectSitemap(c.User.ID, projectName, enabled)
+	}
+	return nil
+}
+
+func (c *Cmd) suspend(userName string, suspended bool) error {
+	c.Log.Info(
+		"user running `suspend` command",
+		"operator", c.User.Name,
+		"operatorId", c.User.ID,
+		"user", userName,
+		"suspended", suspended,
+	)
+
+	err := c.requireAdmin("suspend accounts")
+	if err != nil {
+		return err
+	}
+
+	user, err := c.adminUser(userName)
+	if err != nil {
+		return err
+	}
+
+	if user.ID == c.User.ID {
+		return fmt.Errorf("cannot suspend your own account")
+	}
+
+	if suspended {
+		c.output(fmt.Sprintf("suspending account (%s)", user.Name))
+	} else {
+		c.output(fmt.Sprintf("unsuspending account (%s)", user.Name))
+	}
+
+	if !c.Write {
+		return nil
+	}
+
+	err = c.Dbpool.SetUserSuspended(user.ID, suspended, c.User.ID)
+	if err != nil {
+		return err
+	}
+
+	c.Log.Info(
+		"account suspension changed",
+		"operator", c.User.Name,
+		"operatorId", c.User.ID,
+		"target", user.Name,
+		"targetId", user.ID,
+		"suspended", suspended,
+	)
+	return nil
+}
+
+// reservationTTL is how long `reserve` holds space for a deploy that
+// never comes.
+var reservationTTL = 15 * time.Minute
+
+func (c *Cmd) reserve(projectName string, size uint64, cfgMaxSize uint64) error {
+	c.Log.Info(
+		"user running `reserve` command",
+		"project", projectName,
+		"size", size,
+	)
+
+	ff, err := c.Dbpool.FindFeatureForUser(c.User.ID, "pgs")
+	if err != nil {
+		ff = db.NewFeatureFlag(c.User.ID, "pgs", cfgMaxSize, 0)
+	}
+	// this is jank
+	storageMax := ff.FindStorageMax(cfgMaxSize)
+
+	bucketName := shared.GetAssetBucketName(c.User.ID)
+	bucket, err := c.Store.UpsertBucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	totalFileSize, err := c.Store.GetBucketQuota(bucket)
+	if err != nil {
+		return err
+	}
+
+	remaining := uint64(0)
+	if totalFileSize < storageMax {
+		remaining = storageMax - totalFileSize
+	}
+
+	if size > remaining {
+		return fmt.Errorf(
+			"quota exceeded: (%d bytes) requested but only (%d bytes) of (%d bytes) remaining",
+			size,
+			remaining,
+			storageMax,
+		)
+	}
+
+	c.output(fmt.Sprintf("(%d bytes) available for %s, (%d bytes) remaining", size, projectName, remaining))
+	if !c.Write {
+		return nil
+	}
+
+	// the reservation is a hold in the usage uploads share, it counts
+	// against uploads to every other project until it expires
+	err = c.Dbpool.SeedStorageUsage(c.User.ID, int64(totalFileSize))
+	if err != nil {
+		return err
+	}
+	_, err = c.Dbpool.ReserveProjectStorage(
+		c.User.ID,
+		projectName,
+		int64(size),
+		int64(storageMax),
+		time.Now().Add(reservationTTL),
+	)
+	if errors.Is(err, db.ErrQuotaExceeded) {
+		return fmt.Errorf(
+			"quota exceeded: (%d bytes) requested but running uploads and reservations hold the rest of (%d bytes)",
+			size,
+			storageMax,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	c.output(fmt.Sprintf("reserved (%d bytes) for %s, expires in %s", size, projectName, reservationTTL))
+	return nil
+}
+
+// moveProjectAssets copies every asset to the new project directory. When
+// a copy fails the already copied assets are removed so we never leave a
+// half-moved project behind.
+func (c *Cmd) moveProjectAssets(bucket sst.Bucket, oldName, newName string) ([]storage.ObjectEntry, []string, error) {
+	copied := []string{}
+	entries, err := storage.WalkObjects(c.Store, bucket, oldName)
+	if err != nil {
+		return entries, copied, err
+	}
+
+	for _, entry := range entries {
+		newPath := filepath.Join(newName, strings.TrimPrefix(entry.Path, oldName+"/"))
+		err = c.copyObject(bucket, entry, newPath)
+		if err != nil {
+			c.removeObjects(bucket, copied)
+			return entries, []string{}, err
+		}
+		copied = append(copied, newPath)
+	}
+
+	return entries, copied, nil
+}
+
+// moveRevisions keeps the revisions of a renamed project servable, they
+// are stored under the project name.
+func (c *Cmd) moveRevisions(bucket sst.Bucket, project *db.Project, oldName, newName string) {
+	deploys, err := c.Dbpool.FindProjectDeploys(project.ID)
+	if err != nil {
+		c.Log.Error("could not find revisions", "project", oldName, "err", err)
+		return
+	}
+	for _, deploy := range deploys {
+		err := c.Store.MovePrefix(
+			bucket,
+			storage.DeployName(oldName, deploy.Revision),
+			storage.DeployName(newName, deploy.Revision),
+		)
+		if err != nil {
+			c.Log.Error("could not move revision", "project", oldName, "revision", deploy.Revision, "err", err)
+		}
+	}
+}
+
+// rmRevisions removes the assets of every revision of a project, the rows
+// go along with the project.
+func (c *Cmd) rmRevisions(project *db.Project) error {
+	deploys, err := c.Dbpool.FindProjectDeploys(project.ID)
+	if err != nil || len(deploys) == 0 {
+		return err
+	}
+	bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	c.output(fmt.Sprintf("removing (%d) revisions of project (%s)", len(deploys), project.Name))
+	if !c.Write {
+		return nil
+	}
+	for _, deploy := range deploys {
+		_, _, err := storage.DeleteObjects(c.Store, bucket, storage.DeployName(project.Name, deploy.Revision))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cmd) copyObject(bucket sst.Bucket, entry storage.ObjectEntry, newPath string) error {
+	return storage.CopyObject(c.Store, bucket, entry.Path, newPath)
+}
+
+func (c *Cmd) removeObjects(bucket sst.Bucket, paths []string) {
+	for _, fpath := range paths {
+		err := c.Store.DeleteObject(bucket, fpath)
+		if err != nil {
+			c.Log.Error("could not remove object", "bucket", bucket.Name, "filename", fpath, "err", err)
+		}
+	}
+}
+
+func (c *Cmd) mv(oldName, newName string) error {
+	c.Log.Info(
+		"user running `mv` command",
+		"project", oldName,
+		"newName", newName,
+	)
+
+	if newName == "" || strings.Contains(newName, "/") || newName == "." || newName == ".." {
+		return fmt.Errorf("(%s) is not a valid project name", newName)
+	}
+
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, oldName)
+	if err != nil {
+		return fmt.Errorf("(%s) project not found for user (%s)", oldName, c.User.Name)
+	}
+
+	_, err = c.Dbpool.FindProjectByName(c.User.ID, newName)
+	if err == nil {
+		return fmt.Errorf("(%s) project already exists, aborting", newName)
+	}
+
+	c.output(fmt.Sprintf("(%s) renaming to (%s)", oldName, newName))
+	if !c.Write {
+		return nil
+	}
+
+	// links do not have assets of their own
+	if project.Name != project.ProjectDir {
+		return c.Dbpool.RenameProject(c.User.ID, oldName, newName)
+	}
+
+	bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	entries, copied, err := c.moveProjectAssets(bucket, oldName, newName)
+	if err != nil {
+		return err
+	}
+
+	err = c.Dbpool.RenameProject(c.User.ID, oldName, newName)
+	if err != nil {
+		c.removeObjects(bucket, copied)
+		return err
+	}
+
+	old := []string{}
+	for _, entry := range entries {
+		old = append(old, entry.Path)
+	}
+	c.removeObjects(bucket, old)
+	c.output(fmt.Sprintf("(%s) moved (%d) assets to (%s)", oldName, len(entries), newName))
+	c.moveRevisions(bucket, project, oldName, newName)
+
+	return nil
+}
+
+// shareURL hands out a link to objPath of project that works for ttl,
+// clamped to the max share ttl. With an access secret it is a signed link to
+// the site, otherwise a presigned storage url. The file must exist before
+// we hand out a link for it.
+func (c *Cmd) shareURL(bucket sst.Bucket, project *db.Project, objPath string, ttl time.Duration, cfg *shared.ConfigSite) (string, time.Duration, error) {
+	if objPath == "" {
+		return "", 0, fmt.Errorf("(%s) must include a file, e.g. %s/index.html", project.Name, project.Name)
+	}
+	if ttl <= 0 {
+		return "", 0, fmt.Errorf("ttl must be positive, found (%s)", ttl)
+	}
+	if cfg.MaxShareTTL > 0 && ttl > cfg.MaxShareTTL {
+		ttl = cfg.MaxShareTTL
+	}
+
+	// links share the assets of the project they point to
+	name := filepath.Join(project.ProjectDir, objPath)
+	_, err := c.Store.GetObjectSize(bucket, name)
+	if err != nil {
+		return "", 0, fmt.Errorf("(%s) file not found", path.Join(project.Name, objPath))
+	}
+
+	if cfg.AccessSecret != "" {
+		url := signedShareURL(cfg, c.User.Name, project.Name, objPath, time.Now().Add(ttl))
+		return url, ttl, nil
+	}
+	url, err := c.Store.PresignGetURL(bucket, name, ttl)
+	return url, ttl, err
+}
+
+func (c *Cmd) share(fpath string, ttl time.Duration, cfg *shared.ConfigSite) error {
+	c.Log.Info(
+		"user running `share` command",
+		"filepath", fpath,
+		"ttl", ttl,
+	)
+
+	projectName, objPath, err := splitCopyPath(fpath)
+	if err != nil {
+		return err
+	}
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, projectName)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("project (%s) does not exist", projectName))
+	}
+
+	bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	url, ttl, err := c.shareURL(bucket, project, objPath, ttl, cfg)
+	if err != nil {
+		return err
+	}
+
+	c.output(url)
+	c.output(fmt.Sprintf("link expires at %s", time.Now().Add(ttl).Format(time.RFC3339)))
+	return nil
+}
+
+// mvFile renames a single file within a project. Nothing is counted
+// against the quota since the copy replaces the original.
+func (c *Cmd) mvFile(src, dst string) error {
+	c.Log.Info(
+		"user running `mv` command on a file",
+		"src", src,
+		"dst", dst,
+	)
+
+	srcProject, srcPath, err := splitCopyPath(src)
+	if err != nil {
+		return err
+	}
+	dstProject, dstPath, err := splitCopyPath(dst)
+	if err != nil {
+		return err
+	}
+	if srcProject != dstProject {
+		return fmt.Errorf("cannot move files between projects (%s) and (%s), use `cp` instead", srcProject, dstProject)
+	}
+	if srcPath == "" || dstPath == "" {
+		return fmt.Errorf("must provide a file to move and its new name, e.g. %s/draft.html %s/index.html", srcProject, srcProject)
+	}
+
+	project, err := c.Dbpool.FindProjectByName(c.User.ID, srcProject)
+	if err != nil {
+		return fmt.Errorf("(%s) project not found for user (%s)", srcProject, c.User.Name)
+	}
+	if project.Name != project.ProjectDir {
+		return fmt.Errorf("(%s) is linked to (%s), move files in (%s) instead", project.Name, project.ProjectDir, project.ProjectDir)
+	}
+
+	bucket, err := c.Store.GetBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	srcName := filepath.Join(srcProject, srcPath)
+	dstName := filepath.Join(dstProject, dstPath)
+	if srcName == dstName {
+		return fmt.Errorf("(%s) and (%s) are the same file", src, dst)
+	}
+
+	_, err = c.Store.GetObjectSize(bucket, srcName)
+	if err != nil {
+		return fmt.Errorf("(%s) file not found", src)
+	}
+	_, err = c.Store.GetObjectSize(bucket, dstName)
+	if err == nil {
+		c.output(fmt.Sprintf("(%s) already exists and will be replaced", dstName))
+	}
+
+	c.output(fmt.Sprintf("(%s) moving to (%s)", srcName, dstName))
+	if !c.Write {
+		return nil
+	}
+
+	err = storage.CopyObject(c.Store, bucket, srcName, dstName)
+	if err != nil {
+		return err
+	}
+	err = c.Store.DeleteObject(bucket, srcName)
+	c.forgetObjectCount(srcProject)
+	return err
+}
+
+type copyPair struct {
+	src  string
+	dst  string
+	size int64
+}
+
+// splitCopyPath turns `project/path/to/file` into its project and the path
+// inside of it.
+func splitCopyPath(text string) (string, string, error) {
+	clean, err := shared.SanitizePath(text)
+	if err != nil {
+		return "", "", err
+	}
+	projectName, fpath, _ := strings.Cut(strings.TrimPrefix(clean, "/"), "/")
+	if projectName == "" {
+		return "", "", fmt.Errorf("(%s) must start with a project name", text)
+	}
+	return projectName, fpath, nil
+}
+
+func (c *Cmd) findCopyPairs(bucket sst.Bucket, src, dst string) (string, []copyPair, error) {
+	srcProject, srcPath, err := splitCopyPath(src)
+	if err != nil {
+		return "", nil, err
+	}
+	dstProject, dstPath, err := splitCopyPath(dst)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pairs := []copyPair{}
+	if srcPath == "" {
+		entries, err := storage.WalkObjects(c.Store, bucket, srcProject)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(entries) == 0 {
+			return "", nil, fmt.Errorf("(%s) project has no files to copy", srcProject)
+		}
+		for _, entry := range entries {
+			rel := strings.TrimPrefix(entry.Path, srcProject+"/")
+			pairs = append(pairs, copyPair{
+				src:  entry.Path,
+				dst:  filepath.Join(dstProject, dstPath, rel),
+				size: entry.Size(),
+			})
+		}
+		return dstProject, pairs, nil
+	}
+
+	srcKey := filepath.Join(srcProject, srcPath)
+	size, err := c.Store.GetObjectSize(bucket, srcKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("(%s) file not found", src)
+	}
+	if dstPath == "" || strings.HasSuffix(dst, "/") {
+		dstPath = filepath.Join(dstPath, filepath.Base(srcPath))
+	}
+	pairs = append(pairs, copyPair{
+		src:  srcKey,
+		dst:  filepath.Join(dstProject, dstPath),
+		size: size,
+	})
+	return dstProject, pairs, nil
+}
+
+func (c *Cmd) cp(src, dst string, cfgMaxSize uint64) error {
+	c.Log.Info(
+		"user running `cp` command",
+		"src", src,
+		"dst", dst,
+	)
+
+	if src == "" || dst == "" {
+		return fmt.Errorf("must provide a source and destination, e.g. `cp projA/index.html projB/index.html`")
+	}
+
+	bucket, err := c.Store.UpsertBucket(shared.GetAssetBucketName(c.User.ID))
+	if err != nil {
+		return err
+	}
+
+	dstProject, pairs, err := c.findCopyPairs(bucket, src, dst)
+	if err != nil {
+		return err
+	}
+
+	project, findErr := c.Dbpool.FindProjectByName(c.User.ID, dstProject)
+	if findErr == nil && project.Name != project.ProjectDir {
+		return fmt.Errorf("(%s) is linked to (%s), copy into that project instead", dstProject, project.ProjectDir)
+	}
+
+	// overwriting a file only costs the difference in size
+	delta := int64(0)
+	for _, pair := range pairs {
+		curSize, _ := c.Store.GetObjectSize(bucket, pair.dst)
+		delta += pair.size - curSize
+	}
+
+	ff, err := c.Dbpool.FindFeatureForUser(c.User.ID, "pgs")
+	if err != nil {
+		ff = db.NewFeatureFlag(c.User.ID, "pgs", cfgMaxSize, 0)
+	}
+	storageMax := ff.FindStorageMax(cfgMaxSize)
+
+	used, err := c.Store.GetBucketQuota(bucket)
+	if err != nil {
+		return err
+	}
+	if delta > 0 && used+uint64(delta) > storageMax {
+		return fmt.Errorf(
+			"quota exceeded: copy would use (%d bytes) of (%d bytes)",
+			used+uint64(delta),
+			storageMax,
+		)
+	}
+
+	for _, pair := range pairs {
+		c.output(fmt.Sprintf("(%s) -> (%s)", pair.src, pair.dst))
+	}
+	if !c.Write {
+		return nil
+	}
+
+	event := webhooks.ProjectUpdate
+	if findErr != nil {
+		_, err = c.Dbpool.InsertProject(c.User.ID, dstProject, dstProject)
+		if err != nil {
+			return err
+		}
+		event = webhooks.ProjectCreate
+	} else {
+		err = c.Dbpool.UpdateProject(c.User.ID, dstProject)
+		if err != nil {
+			return err
+		}
+	}
+
+	// a copy that fails partway still changed the project
+	defer c.forgetObjectCount(dstProject)
+	for _, pair := range pairs {
+		err = storage.CopyObject(c.Store, bucket, pair.src, pair.dst)
+		if err != nil {
+			return err
+		}
+	}
+	c.output(fmt.Sprintf("copied (%d) files into (%s)", len(pairs), dstProject))
+	c.notify(event, dstProject)
+
 	return nil
 }
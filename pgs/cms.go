@@ -13,7 +13,8 @@ import (
 	"github.com/muesli/reflow/wordwrap"
 	"github.com/muesli/reflow/wrap"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
+	uploadassets "github.com/picosh/pico/filehandlers/assets"
 	"github.com/picosh/pico/shared"
 	"github.com/picosh/pico/shared/storage"
 	"github.com/picosh/pico/wish/cms/config"
@@ -32,6 +33,7 @@ const (
 	statusNoAccount
 	statusBrowsingKeys
 	statusBrowsingTokens
+	statusBrowsingProjects
 	statusQuitting
 )
 
@@ -50,7 +52,8 @@ type menuChoice int
 
 // menu choices.
 const (
-	keysChoice menuChoice = iota
+	projectsChoice menuChoice = iota
+	keysChoice
 	tokensChoice
 	exitChoice
 	unsetChoice // set when no choice has been made
@@ -58,9 +61,10 @@ const (
 
 // menu text corresponding to menu choices. these are presented to the user.
 var menuChoices = map[menuChoice]string{
-	keysChoice:   "Manage keys",
-	tokensChoice: "Manage tokens",
-	exitChoice:   "Exit",
+	projectsChoice: "Manage projects",
+	keysChoice:     "Manage keys",
+	tokensChoice:   "Manage tokens",
+	exitChoice:     "Exit",
 }
 
 func NewSpinner(styles common.Styles) spinner.Model {
@@ -72,7 +76,9 @@ func NewSpinner(styles common.Styles) spinner.Model {
 
 type GotDBMsg db.DB
 
-func CmsMiddleware(cfg *config.ConfigCms, urls config.ConfigURL) bm.Handler {
+// CmsMiddleware is what `ssh pgs.sh` without a command opens, projects are
+// managed through handler like the ssh commands do.
+func CmsMiddleware(cfg *config.ConfigCms, urls config.ConfigURL, handler *uploadassets.UploadAssetHandler) bm.Handler {
 	return func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 		logger := cfg.Logger
 
@@ -89,14 +95,10 @@ func CmsMiddleware(cfg *config.ConfigCms, urls config.ConfigURL) bm.Handler {
 
 		sshUser := s.User()
 
-		dbpool := postgres.NewDB(cfg.DbURL, cfg.Logger)
+		dbpool := backend.NewDB(cfg.DbURL, cfg.Logger)
 
 		var st storage.StorageServe
-		if cfg.MinioURL == "" {
-			st, err = storage.NewStorageFS(cfg.StorageDir)
-		} else {
-			st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-		}
+		st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 		if err != nil {
 			logger.Error(err.Error())
@@ -113,6 +115,8 @@ func CmsMiddleware(cfg *config.ConfigCms, urls config.ConfigURL) bm.Handler {
 			dbpool:     dbpool,
 			st:         st,
 			sshUser:    sshUser,
+			handler:    handler,
+			sessionID:  s.Context().SessionID(),
 			status:     statusInit,
 			menuChoice: unsetChoice,
 			styles:     styles,
@@ -133,6 +137,17 @@ func CmsMiddleware(cfg *config.ConfigCms, urls config.ConfigURL) bm.Handler {
 		ff, _ := m.findPlusFeatureFlag()
 		m.plusFeatureFlag = ff
 
+		if user != nil {
+			// org members manage the projects of the org they logged in as
+			owner, member, err := uploadassets.OrgUser(s, handler.DBPool, user)
+			if err != nil {
+				_, _ = fmt.Fprintln(s.Stderr(), err)
+				return nil, nil
+			}
+			readOnly := (member != nil && !member.CanDeploy()) || owner.IsReadOnly() || user.IsReadOnly()
+			m.projects = newDashboardModel(styles, handler, owner, user, readOnly, s.Context().SessionID())
+		}
+
 		return m, []tea.ProgramOption{tea.WithAltScreen()}
 	}
 }
@@ -156,6 +171,9 @@ type model struct {
 	spinner         spinner.Model
 	keys            keys.Model
 	tokens          tokens.Model
+	projects        dashboardModel
+	handler         *uploadassets.UploadAssetHandler
+	sessionID       string
 	createAccount   account.CreateModel
 	terminalSize    tea.WindowSizeMsg
 }
@@ -251,6 +269,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.keys = keys.NewModel(m.styles, m.cfg, m.dbpool, m.user)
 		m.tokens = tokens.NewModel(m.styles, m.cfg, m.dbpool, m.user)
 		m.createAccount = account.NewCreateModel(m.styles, m.cfg, m.dbpool, m.publicKey)
+		m.projects = newDashboardModel(m.styles, m.handler, m.user, m.user, false, m.sessionID)
 	}
 
 	switch m.status {
@@ -310,6 +329,18 @@ func updateChildren(msg tea.Msg, m model) (model, tea.Cmd) {
 			m.status = statusQuitting
 			return m, tea.Quit
 		}
+	case statusBrowsingProjects:
+		m.projects, cmd = m.projects.Update(msg)
+		if m.projects.Exit {
+			m.projects = newDashboardModel(
+				m.styles, m.handler, m.projects.user, m.projects.actor,
+				m.projects.readOnly, m.sessionID,
+			)
+			m.status = statusReady
+		} else if m.projects.Quit {
+			m.status = statusQuitting
+			return m, tea.Quit
+		}
 	case statusNoAccount:
 		m.createAccount, cmd = account.Update(msg, m.createAccount)
 		if m.createAccount.Done {
@@ -323,6 +354,10 @@ func updateChildren(msg tea.Msg, m model) (model, tea.Cmd) {
 
 	// Handle the menu
 	switch m.menuChoice {
+	case projectsChoice:
+		m.status = statusBrowsingProjects
+		m.menuChoice = unsetChoice
+		cmd = LoadDashboard(m.projects)
 	case keysChoice:
 		m.status = statusBrowsingKeys
 		m.menuChoice = unsetChoice
@@ -388,6 +423,8 @@ func (m model) View() string {
 		s += m.keys.View()
 	case statusBrowsingTokens:
 		s += m.tokens.View()
+	case statusBrowsingProjects:
+		s += m.projects.View()
 	}
 	return m.styles.App.Render(wrap.String(wordwrap.String(s, w), w))
 }
@@ -1,7 +1,14 @@
 package pgs
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/clientip"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/tracing"
 	"github.com/picosh/pico/wish/cms/config"
 )
 
@@ -18,11 +25,136 @@ func NewConfigSite() *shared.ConfigSite {
 	protocol := shared.GetEnv("PGS_PROTOCOL", "https")
 	allowRegister := shared.GetEnv("PGS_ALLOW_REGISTER", "1")
 	storageDir := shared.GetEnv("PGS_STORAGE_DIR", ".storage")
+	storageBackend := shared.GetEnv("STORAGE_BACKEND", "")
 	minioURL := shared.GetEnv("MINIO_URL", "")
 	minioUser := shared.GetEnv("MINIO_ROOT_USER", "")
 	minioPass := shared.GetEnv("MINIO_ROOT_PASSWORD", "")
 	dbURL := shared.GetEnv("DATABASE_URL", "")
+	trustedProxies := shared.GetEnv("TRUSTED_PROXIES", clientip.PrivateRanges)
+	sessionIdleTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_IDLE_TIMEOUT", "15m"))
+	sessionMaxTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_MAX_TIMEOUT", "6h"))
+	sessionKeepAlive, _ := time.ParseDuration(shared.GetEnv("SSH_KEEPALIVE_INTERVAL", "30s"))
 	useImgProxy := shared.GetEnv("USE_IMGPROXY", "1")
+	eventBusURL := shared.GetEnv("EVENT_BUS_URL", "")
+	traceEndpoint := shared.GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	traceService := shared.GetEnv("OTEL_SERVICE_NAME", "pgs")
+	traceHeaders := shared.GetEnv("OTEL_EXPORTER_OTLP_HEADERS", "")
+	traceSampleRatio, err := strconv.ParseFloat(shared.GetEnv("OTEL_TRACES_SAMPLER_ARG", "1"), 64)
+	if err != nil {
+		traceSampleRatio = 1
+	}
+	logEncoding := shared.GetEnv("PGS_LOG_ENCODING", "0")
+	logEncodingRate, _ := strconv.Atoi(shared.GetEnv("PGS_LOG_ENCODING_RATE", "60"))
+	verifyReads := shared.GetEnv("PGS_VERIFY_READS", "0")
+	allowedHosts := shared.GetEnv("PGS_ALLOWED_HOSTS", "")
+	listMaxDepth, _ := strconv.Atoi(shared.GetEnv("PGS_LS_MAX_DEPTH", "10"))
+	maxFileSize, _ := strconv.ParseUint(shared.GetEnv("PGS_MAX_FILE_SIZE", "0"), 10, 64)
+	memoryBufferSize, _ := strconv.ParseInt(shared.GetEnv("PGS_MEMORY_BUFFER_SIZE", strconv.Itoa(10*shared.MB)), 10, 64)
+	sftpChunkSize, _ := strconv.ParseInt(shared.GetEnv("PGS_SFTP_CHUNK_SIZE", strconv.Itoa(16*shared.MB)), 10, 64)
+	deniedExt := shared.GetEnv("PGS_DENIED_EXT", "")
+	allowedTypes := shared.GetEnv("PGS_ALLOWED_TYPES", "")
+	deniedTypes := shared.GetEnv("PGS_DENIED_TYPES", "")
+	verifyUploads := shared.GetEnv("PGS_VERIFY_UPLOADS", "0")
+	skipUnchanged := shared.GetEnv("PGS_SKIP_UNCHANGED", "0")
+	rejectCaseCollisions := shared.GetEnv("PGS_REJECT_CASE_COLLISIONS", "0")
+	allowEmptyFiles := shared.GetEnv("PGS_ALLOW_EMPTY_FILES", "0")
+	quotaTiers := shared.GetEnv("PGS_QUOTA_TIERS", "")
+	defaultQuota, _ := strconv.ParseUint(shared.GetEnv("PGS_DEFAULT_QUOTA", "0"), 10, 64)
+	keepVersions, _ := strconv.Atoi(shared.GetEnv("PGS_KEEP_VERSIONS", "0"))
+	serveVersions := shared.GetEnv("PGS_SERVE_VERSIONS", "0")
+	maxFilesPerProject, _ := strconv.Atoi(shared.GetEnv("PGS_MAX_FILES_PER_PROJECT", "0"))
+	maxObjectsPerUser, _ := strconv.Atoi(shared.GetEnv("PGS_MAX_OBJECTS_PER_USER", "0"))
+	bucketCacheTTL, _ := time.ParseDuration(shared.GetEnv("PGS_BUCKET_CACHE_TTL", "5m"))
+	objectCacheSize, _ := strconv.ParseInt(shared.GetEnv("PGS_OBJECT_CACHE_SIZE", "0"), 10, 64)
+	objectCacheMaxObject, _ := strconv.ParseInt(shared.GetEnv("PGS_OBJECT_CACHE_MAX_OBJECT", strconv.Itoa(shared.MB)), 10, 64)
+	storageMaxRetries, _ := strconv.Atoi(shared.GetEnv("PGS_STORAGE_MAX_RETRIES", "3"))
+	storageBaseDelay, _ := time.ParseDuration(shared.GetEnv("PGS_STORAGE_BASE_DELAY", "100ms"))
+	uploadRateLimit, _ := strconv.ParseInt(shared.GetEnv("PGS_UPLOAD_RATE_LIMIT", "0"), 10, 64)
+	uploadBurst, _ := strconv.ParseInt(shared.GetEnv("PGS_UPLOAD_BURST", "0"), 10, 64)
+	requestRateLimit, _ := strconv.ParseInt(shared.GetEnv("PGS_REQUEST_RATE_LIMIT", "0"), 10, 64)
+	requestBurst, _ := strconv.ParseInt(shared.GetEnv("PGS_REQUEST_BURST", "0"), 10, 64)
+	dryRun := shared.GetEnv("PGS_DRY_RUN", "0")
+	indexFile := shared.GetEnv("PGS_INDEX_FILE", "index.html")
+	storageConcurrency, _ := strconv.Atoi(shared.GetEnv("PGS_STORAGE_CONCURRENCY", "4"))
+	uploadConcurrency, _ := strconv.Atoi(shared.GetEnv("PGS_UPLOAD_CONCURRENCY", "1"))
+	expireInterval, _ := time.ParseDuration(shared.GetEnv("PGS_EXPIRE_INTERVAL", "5m"))
+	trashRetention, _ := time.ParseDuration(shared.GetEnv("PGS_TRASH_RETENTION", "0"))
+	trashInterval, _ := time.ParseDuration(shared.GetEnv("PGS_TRASH_INTERVAL", "1h"))
+	gcInterval, _ := time.ParseDuration(shared.GetEnv("PGS_GC_INTERVAL", "0"))
+	gcWrite := shared.GetEnv("PGS_GC_WRITE", "0")
+	usageInterval, _ := time.ParseDuration(shared.GetEnv("PGS_USAGE_INTERVAL", "1h"))
+	resetExpired := shared.GetEnv("PGS_RESET_EXPIRED", "0")
+	requiredFeatures := shared.GetEnv("PGS_REQUIRED_FEATURES", "")
+	compressThreshold, _ := strconv.ParseInt(shared.GetEnv("PGS_COMPRESS_THRESHOLD", "0"), 10, 64)
+	precompressThreshold, _ := strconv.ParseInt(shared.GetEnv("PGS_PRECOMPRESS_THRESHOLD", "0"), 10, 64)
+	defaultShareTTL, _ := time.ParseDuration(shared.GetEnv("PGS_SHARE_TTL", "1h"))
+	maxShareTTL, _ := time.ParseDuration(shared.GetEnv("PGS_MAX_SHARE_TTL", "168h"))
+	showProgress := shared.GetEnv("PGS_SHOW_PROGRESS", "0")
+	domainVerifyInterval, _ := time.ParseDuration(shared.GetEnv("PGS_DOMAIN_VERIFY_INTERVAL", "5m"))
+	domainRecheckAfter, _ := time.ParseDuration(shared.GetEnv("PGS_DOMAIN_RECHECK_AFTER", "24h"))
+	analyticsInterval, _ := time.ParseDuration(shared.GetEnv("PGS_ANALYTICS_INTERVAL", "1m"))
+	bandwidthInterval, _ := time.ParseDuration(shared.GetEnv("PGS_BANDWIDTH_INTERVAL", "1m"))
+	egressTiers := shared.GetEnv("PGS_EGRESS_TIERS", "")
+	defaultEgress, _ := strconv.ParseUint(shared.GetEnv("PGS_DEFAULT_EGRESS", "0"), 10, 64)
+	atomicDeploys := shared.GetEnv("PGS_ATOMIC_DEPLOYS", "0")
+	deferPublish := shared.GetEnv("PGS_DEFER_PUBLISH", "0")
+	keepDeploys, _ := strconv.Atoi(shared.GetEnv("PGS_KEEP_DEPLOYS", "0"))
+	deployCacheTTL, _ := time.ParseDuration(shared.GetEnv("PGS_DEPLOY_CACHE_TTL", "10s"))
+	deployLockTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_DEPLOY_LOCK_TIMEOUT", "30s"))
+	expandArchives := shared.GetEnv("PGS_EXPAND_ARCHIVES", "0")
+	checkLinks := shared.GetEnv("PGS_CHECK_LINKS", "0")
+	dedupStorage := shared.GetEnv("PGS_DEDUP_STORAGE", "0")
+	webhooks := shared.GetEnv("PGS_WEBHOOKS", "0")
+	metricsAddr := shared.GetEnv("PGS_METRICS_ADDR", "")
+	webdavAddr := shared.GetEnv("PGS_WEBDAV_ADDR", "")
+	uploadAPIAddr := shared.GetEnv("PGS_UPLOAD_API_ADDR", "")
+	uploadReadTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_UPLOAD_READ_TIMEOUT", "5m"))
+	shutdownTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_SHUTDOWN_TIMEOUT", "30s"))
+	reusePort := shared.GetEnv("PGS_REUSE_PORT", "0")
+	proxyProtocol := shared.GetEnv("PGS_PROXY_PROTOCOL", "0")
+	webhookMaxRetries, _ := strconv.Atoi(shared.GetEnv("PGS_WEBHOOK_MAX_RETRIES", "3"))
+	webhookBaseDelay, _ := time.ParseDuration(shared.GetEnv("PGS_WEBHOOK_BASE_DELAY", "1s"))
+	purgeProvider := shared.GetEnv("PGS_PURGE_PROVIDER", "")
+	purgeZone := shared.GetEnv("PGS_PURGE_ZONE", "")
+	purgeURL := shared.GetEnv("PGS_PURGE_URL", "")
+	purgeToken := shared.GetEnv("PGS_PURGE_TOKEN", "")
+	purgeAll := shared.GetEnv("PGS_PURGE_ALL", "0")
+	scanProvider := shared.GetEnv("PGS_SCAN_PROVIDER", "")
+	scanURL := shared.GetEnv("PGS_SCAN_URL", "")
+	scanToken := shared.GetEnv("PGS_SCAN_TOKEN", "")
+	scanAction := shared.GetEnv("PGS_SCAN_ACTION", "reject")
+	scanMaxSize, _ := strconv.ParseInt(shared.GetEnv("PGS_SCAN_MAX_SIZE", "0"), 10, 64)
+	scanFailOpen := shared.GetEnv("PGS_SCAN_FAIL_OPEN", "0")
+	envSecret := shared.GetEnv("PGS_ENV_SECRET", "")
+	buildGenerators := shared.GetEnv("PGS_BUILD_GENERATORS", "")
+	buildSandbox := shared.GetEnv("PGS_BUILD_SANDBOX", "")
+	buildTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_BUILD_TIMEOUT", "5m"))
+	buildConcurrency, _ := strconv.Atoi(shared.GetEnv("PGS_BUILD_CONCURRENCY", "2"))
+	authProviders := shared.GetEnv("PGS_AUTH_PROVIDERS", "")
+	authAllowlist := shared.GetEnv("PGS_AUTH_ALLOWLIST", "")
+	authURL := shared.GetEnv("PGS_AUTH_URL", "")
+	authToken := shared.GetEnv("PGS_AUTH_TOKEN", "")
+	authCommand := shared.GetEnv("PGS_AUTH_COMMAND", "")
+	http2Cleartext := shared.GetEnv("PGS_HTTP2_CLEARTEXT", "0")
+	webReadTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_WEB_READ_TIMEOUT", "30s"))
+	webWriteTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_WEB_WRITE_TIMEOUT", "5m"))
+	webIdleTimeout, _ := time.ParseDuration(shared.GetEnv("PGS_WEB_IDLE_TIMEOUT", "2m"))
+	altSvc := shared.GetEnv("PGS_ALT_SVC", "")
+	tlsAddr := shared.GetEnv("PGS_TLS_ADDR", "")
+	tlsCert := shared.GetEnv("PGS_TLS_CERT", "")
+	tlsKey := shared.GetEnv("PGS_TLS_KEY", "")
+	acmeDirectory := shared.GetEnv("PGS_ACME_DIRECTORY", "https://acme-v02.api.letsencrypt.org/directory")
+	acmeAccountKey := shared.GetEnv("PGS_ACME_ACCOUNT_KEY", ".acme/account.pem")
+	acmeChallenge := shared.GetEnv("PGS_ACME_CHALLENGE", "http-01")
+	acmeDNSProvider := shared.GetEnv("PGS_ACME_DNS_PROVIDER", "")
+	acmeDNSZone := shared.GetEnv("PGS_ACME_DNS_ZONE", "")
+	acmeDNSURL := shared.GetEnv("PGS_ACME_DNS_URL", "")
+	acmeDNSToken := shared.GetEnv("PGS_ACME_DNS_TOKEN", "")
+	certSecret := shared.GetEnv("PGS_CERT_SECRET", "")
+	certRenewBefore, _ := time.ParseDuration(shared.GetEnv("PGS_CERT_RENEW_BEFORE", "720h"))
+	certRenewInterval, _ := time.ParseDuration(shared.GetEnv("PGS_CERT_RENEW_INTERVAL", "10m"))
+	accessSecret := shared.GetEnv("PGS_ACCESS_SECRET", "")
+	compressTypes := shared.GetEnv("PGS_COMPRESS_TYPES", strings.Join(storage.DefaultCompressTypes, ","))
 
 	intro := "To create an account, enter a username.\n"
 	intro += "After that, go to https://pico.sh/getting-started#next-steps"
@@ -32,19 +164,142 @@ func NewConfigSite() *shared.ConfigSite {
 		SubdomainsEnabled:    subdomains == "1",
 		CustomdomainsEnabled: customdomains == "1",
 		UseImgProxy:          useImgProxy == "1",
+		LogEncoding:          logEncoding == "1",
+		LogEncodingSampler:   shared.NewSampler(logEncodingRate, time.Minute),
+		VerifyReads:          verifyReads == "1",
+		AllowedHosts:         shared.SplitList(allowedHosts),
+		ListMaxDepth:         listMaxDepth,
+		MaxFileSize:          maxFileSize,
+		MemoryBufferSize:     memoryBufferSize,
+		SftpChunkSize:        sftpChunkSize,
+		DeniedExt:            shared.SplitList(deniedExt),
+		AllowedTypes:         shared.SplitList(allowedTypes),
+		DeniedTypes:          shared.SplitList(deniedTypes),
+		VerifyUploads:        verifyUploads == "1",
+		SkipUnchanged:        skipUnchanged == "1",
+		AllowEmptyFiles:      allowEmptyFiles == "1",
+		RejectCaseCollisions: rejectCaseCollisions == "1",
+		QuotaTiers:           shared.ParseQuotaTiers(quotaTiers),
+		DefaultQuota:         defaultQuota,
+		KeepVersions:         keepVersions,
+		ServeVersions:        serveVersions == "1",
+		MaxFilesPerProject:   maxFilesPerProject,
+		MaxObjectsPerUser:    maxObjectsPerUser,
+		BucketCacheTTL:       bucketCacheTTL,
+		ObjectCacheSize:      objectCacheSize,
+		ObjectCacheMaxObject: objectCacheMaxObject,
+		StorageMaxRetries:    storageMaxRetries,
+		StorageBaseDelay:     storageBaseDelay,
+		UploadRateLimit:      uploadRateLimit,
+		UploadBurst:          uploadBurst,
+		RequestRateLimit:     requestRateLimit,
+		RequestBurst:         requestBurst,
+		DryRun:               dryRun == "1",
+		IndexFile:            indexFile,
+		StorageConcurrency:   storageConcurrency,
+		UploadConcurrency:    uploadConcurrency,
+		ExpireInterval:       expireInterval,
+		TrashRetention:       trashRetention,
+		TrashInterval:        trashInterval,
+		GCInterval:           gcInterval,
+		GCWrite:              gcWrite == "1",
+		UsageInterval:        usageInterval,
+		ResetExpired:         resetExpired == "1",
+		RequiredFeatures:     shared.SplitList(requiredFeatures),
+		CompressThreshold:    compressThreshold,
+		CompressTypes:        shared.SplitList(compressTypes),
+		PrecompressThreshold: precompressThreshold,
+		AtomicDeploys:        atomicDeploys == "1",
+		DeferPublish:         deferPublish == "1",
+		KeepDeploys:          keepDeploys,
+		DeployCacheTTL:       deployCacheTTL,
+		DeployLockTimeout:    deployLockTimeout,
+		ExpandArchives:       expandArchives == "1",
+		CheckLinks:           checkLinks == "1",
+		DedupStorage:         dedupStorage == "1" || keepDeploys > 0,
+		Webhooks:             webhooks == "1",
+		WebhookMaxRetries:    webhookMaxRetries,
+		WebhookBaseDelay:     webhookBaseDelay,
+		PurgeProvider:        purgeProvider,
+		PurgeZone:            purgeZone,
+		PurgeURL:             purgeURL,
+		PurgeToken:           purgeToken,
+		PurgeAll:             purgeAll == "1",
+		ScanProvider:         scanProvider,
+		ScanURL:              scanURL,
+		ScanToken:            scanToken,
+		ScanAction:           scanAction,
+		ScanMaxSize:          scanMaxSize,
+		ScanFailOpen:         scanFailOpen == "1",
+		EnvSecret:            envSecret,
+		BuildGenerators:      shared.SplitList(buildGenerators),
+		BuildSandbox:         strings.Fields(buildSandbox),
+		BuildTimeout:         buildTimeout,
+		BuildConcurrency:     buildConcurrency,
+		AuthProviders:        shared.SplitList(authProviders),
+		AuthAllowlist:        authAllowlist,
+		AuthURL:              authURL,
+		AuthToken:            authToken,
+		AuthCommand:          authCommand,
+		HTTP2Cleartext:       http2Cleartext == "1",
+		WebReadTimeout:       webReadTimeout,
+		WebWriteTimeout:      webWriteTimeout,
+		WebIdleTimeout:       webIdleTimeout,
+		AltSvc:               altSvc,
+		TLSAddr:              tlsAddr,
+		TLSCert:              tlsCert,
+		TLSKey:               tlsKey,
+		ACMEDirectory:        acmeDirectory,
+		ACMEAccountKey:       acmeAccountKey,
+		ACMEChallenge:        acmeChallenge,
+		ACMEDNSProvider:      acmeDNSProvider,
+		ACMEDNSZone:          acmeDNSZone,
+		ACMEDNSURL:           acmeDNSURL,
+		ACMEDNSToken:         acmeDNSToken,
+		CertSecret:           certSecret,
+		CertRenewBefore:      certRenewBefore,
+		CertRenewInterval:    certRenewInterval,
+		MetricsAddr:          metricsAddr,
+		TrustedProxies:       clientip.ParseTrusted(shared.SplitList(trustedProxies)),
+		EventBusURL:          eventBusURL,
+		TraceEndpoint:        traceEndpoint,
+		TraceService:         traceService,
+		TraceHeaders:         tracing.ParseHeaders(traceHeaders),
+		TraceSampleRatio:     traceSampleRatio,
+		SessionIdleTimeout:   sessionIdleTimeout,
+		SessionMaxTimeout:    sessionMaxTimeout,
+		SessionKeepAlive:     sessionKeepAlive,
+		ProxyProtocol:        proxyProtocol == "1",
+		WebdavAddr:           webdavAddr,
+		UploadAPIAddr:        uploadAPIAddr,
+		UploadReadTimeout:    uploadReadTimeout,
+		ShutdownTimeout:      shutdownTimeout,
+		ReusePort:            reusePort == "1",
+		DefaultShareTTL:      defaultShareTTL,
+		MaxShareTTL:          maxShareTTL,
+		ShowProgress:         showProgress == "1",
+		ProjectDomains:       true,
+		DomainVerifyInterval: domainVerifyInterval,
+		DomainRecheckAfter:   domainRecheckAfter,
+		AnalyticsInterval:    analyticsInterval,
+		BandwidthInterval:    bandwidthInterval,
+		EgressTiers:          shared.ParseQuotaTiers(egressTiers),
+		DefaultEgress:        defaultEgress,
+		AccessSecret:         accessSecret,
 		ConfigCms: config.ConfigCms{
-			Domain:      domain,
-			Email:       email,
-			Port:        port,
-			Protocol:    protocol,
-			DbURL:       dbURL,
-			StorageDir:  storageDir,
-			MinioURL:    minioURL,
-			MinioUser:   minioUser,
-			MinioPass:   minioPass,
-			Description: "A zero-install static site hosting service for hackers",
-			IntroText:   intro,
-			Space:       "pgs",
+			Domain:         domain,
+			Email:          email,
+			Port:           port,
+			Protocol:       protocol,
+			DbURL:          dbURL,
+			StorageDir:     storageDir,
+			StorageBackend: storageBackend,
+			MinioURL:       minioURL,
+			MinioUser:      minioUser,
+			MinioPass:      minioPass,
+			Description:    "A zero-install static site hosting service for hackers",
+			IntroText:      intro,
+			Space:          "pgs",
 			// IMPORTANT: make sure `shared.GetMimeType` has the extensions being
 			// added here.
 			AllowedExt: []string{
@@ -84,7 +339,7 @@ func NewConfigSite() *shared.ConfigSite {
 			},
 			MaxSize:       maxSize,
 			MaxAssetSize:  maxAssetSize,
-			Logger:        shared.CreateLogger(debug == "1"),
+			Logger:        shared.CreateLogger("pgs", debug == "1"),
 			AllowRegister: allowRegister == "1",
 		},
 	}
@@ -0,0 +1,68 @@
+package pgs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestFindCopyPairs(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fpath := range []string{"staging/index.html", "staging/css/main.css"} {
+		_, err = st.PutObject(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+			&utils.FileEntry{Filepath: fpath},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Cmd{Store: st}
+
+	dst, pairs, err := c.findCopyPairs(bucket, "staging/index.html", "prod/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []copyPair{{src: "staging/index.html", dst: "prod/index.html", size: 2}}
+	if dst != "prod" {
+		t.Fatalf("expected destination project (prod), got (%s)", dst)
+	}
+	if diff := cmp.Diff(expected, pairs, cmp.AllowUnexported(copyPair{})); diff != "" {
+		t.Fatal(diff)
+	}
+
+	_, pairs, err = c.findCopyPairs(bucket, "staging/", "prod/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []copyPair{
+		{src: "staging/css/main.css", dst: "prod/css/main.css", size: 2},
+		{src: "staging/index.html", dst: "prod/index.html", size: 2},
+	}
+	if diff := cmp.Diff(expected, pairs, cmp.AllowUnexported(copyPair{})); diff != "" {
+		t.Fatal(diff)
+	}
+
+	_, _, err = c.findCopyPairs(bucket, "staging/missing.html", "prod/")
+	if err == nil {
+		t.Fatal("expected missing source to fail")
+	}
+
+	_, _, err = c.findCopyPairs(bucket, "staging/../other/index.html", "prod/")
+	if err == nil {
+		t.Fatal("expected path traversal to fail")
+	}
+}
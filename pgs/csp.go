@@ -0,0 +1,71 @@
+package pgs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/picosh/pico/db"
+)
+
+var cspDirectiveRe = regexp.MustCompile(`^[a-z][a-z-]*$`)
+
+func validateCsp(csp db.ProjectCsp) error {
+	if strings.ContainsAny(csp.Policy, "\r\n\x00") {
+		return fmt.Errorf("csp policy cannot contain control characters")
+	}
+
+	if csp.Policy == "" {
+		if csp.ReportOnly || csp.ReportURI != "" {
+			return fmt.Errorf("must provide a csp policy when using `--report-only` or `--report-uri`")
+		}
+		return nil
+	}
+
+	found := 0
+	for _, directive := range strings.Split(csp.Policy, ";") {
+		parts := strings.Fields(directive)
+		if len(parts) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(parts[0])
+		if !cspDirectiveRe.MatchString(name) {
+			return fmt.Errorf("(%s) is not a valid csp directive", parts[0])
+		}
+		if name == "report-uri" && csp.ReportURI != "" {
+			return fmt.Errorf("csp policy already has a `report-uri` directive, remove `--report-uri`")
+		}
+		found += 1
+	}
+
+	if found == 0 {
+		return fmt.Errorf("csp policy must contain at least one directive")
+	}
+
+	if csp.ReportURI != "" && !isUrl(csp.ReportURI) && !strings.HasPrefix(csp.ReportURI, "/") {
+		return fmt.Errorf("(%s) report uri must start with '/', 'http:' or 'https:'", csp.ReportURI)
+	}
+
+	return nil
+}
+
+// cspHeader returns the header name and value for a project csp,
+// value is empty when the project has no policy.
+func cspHeader(csp db.ProjectCsp) (string, string) {
+	name := "content-security-policy"
+	if csp.ReportOnly {
+		name = "content-security-policy-report-only"
+	}
+
+	policy := strings.TrimSpace(csp.Policy)
+	if policy == "" {
+		return name, ""
+	}
+
+	if csp.ReportURI != "" {
+		policy = fmt.Sprintf("%s; report-uri %s", strings.TrimSuffix(policy, ";"), csp.ReportURI)
+	}
+
+	return name, policy
+}
@@ -0,0 +1,88 @@
+package pgs
+
+import (
+	"testing"
+
+	"github.com/picosh/pico/db"
+)
+
+type CspFixture struct {
+	name   string
+	input  db.ProjectCsp
+	header string
+	value  string
+	valid  bool
+}
+
+func TestCsp(t *testing.T) {
+	fixtures := []CspFixture{
+		{
+			name:   "empty",
+			input:  db.ProjectCsp{},
+			header: "content-security-policy",
+			value:  "",
+			valid:  true,
+		},
+		{
+			name:   "basic",
+			input:  db.ProjectCsp{Policy: "default-src 'self'; img-src *"},
+			header: "content-security-policy",
+			value:  "default-src 'self'; img-src *",
+			valid:  true,
+		},
+		{
+			name: "report-only",
+			input: db.ProjectCsp{
+				Policy:     "default-src 'self';",
+				ReportOnly: true,
+				ReportURI:  "https://example.com/csp",
+			},
+			header: "content-security-policy-report-only",
+			value:  "default-src 'self'; report-uri https://example.com/csp",
+			valid:  true,
+		},
+		{
+			name:  "bad-directive",
+			input: db.ProjectCsp{Policy: "default_src 'self'"},
+			valid: false,
+		},
+		{
+			name:  "newline",
+			input: db.ProjectCsp{Policy: "default-src 'self'\nx-evil: 1"},
+			valid: false,
+		},
+		{
+			name:  "report-uri-without-policy",
+			input: db.ProjectCsp{ReportURI: "/report"},
+			valid: false,
+		},
+		{
+			name:  "bad-report-uri",
+			input: db.ProjectCsp{Policy: "default-src 'self'", ReportURI: "example.com"},
+			valid: false,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			err := validateCsp(fixture.input)
+			if fixture.valid && err != nil {
+				t.Fatalf("expected valid csp, got: %s", err)
+			}
+			if !fixture.valid {
+				if err == nil {
+					t.Fatalf("expected invalid csp")
+				}
+				return
+			}
+
+			header, value := cspHeader(fixture.input)
+			if header != fixture.header {
+				t.Fatalf("expected header %s, got %s", fixture.header, header)
+			}
+			if value != fixture.value {
+				t.Fatalf("expected value %q, got %q", fixture.value, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package pgs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	pager "github.com/charmbracelet/bubbles/paginator"
+	"github.com/charmbracelet/bubbles/spinner"
+	input "github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/picosh/pico/db"
+	uploadassets "github.com/picosh/pico/filehandlers/assets"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/wish/cms/ui/common"
+)
+
+const (
+	projectsPerPage = 8
+	recentDeploys   = 5
+	gaugeWidth      = 30
+)
+
+type dashboardState int
+
+const (
+	dashboardLoading dashboardState = iota
+	dashboardRunning
+	dashboardNormal
+	dashboardDeleting
+	dashboardLinking
+	dashboardSharing
+)
+
+type dashboardProject struct {
+	project *db.Project
+	// files is -1 when the project was not walked
+	files int
+	size  int64
+}
+
+type (
+	dashboardLoadedMsg struct {
+		projects   []dashboardProject
+		events     []*db.ProjectEvent
+		used       uint64
+		storageMax uint64
+	}
+	dashboardErrMsg struct {
+		err error
+	}
+	// dashboardActionMsg is what a command printed, reload is set when it
+	// changed the projects.
+	dashboardActionMsg struct {
+		output string
+		err    error
+		reload bool
+	}
+)
+
+// dashboardSession collects what a command prints so the dashboard can
+// show it instead of an ssh session.
+type dashboardSession struct {
+	bytes.Buffer
+}
+
+func (d *dashboardSession) Exit(code int) error   { return nil }
+func (d *dashboardSession) Close() error          { return nil }
+func (d *dashboardSession) Stderr() io.ReadWriter { return &d.Buffer }
+
+// dashboardModel lists a user's projects with their usage and recent
+// deploys, its actions run the same commands as `ssh pgs.sh <cmd>`.
+type dashboardModel struct {
+	handler   *uploadassets.UploadAssetHandler
+	user      *db.User
+	actor     *db.User
+	readOnly  bool
+	sessionID string
+	styles    common.Styles
+	pager     pager.Model
+	spinner   spinner.Model
+	input     input.Model
+	state     dashboardState
+	err       error
+	output    string
+
+	projects   []dashboardProject
+	events     []*db.ProjectEvent
+	used       uint64
+	storageMax uint64
+	index      int
+
+	Exit bool
+	Quit bool
+}
+
+func newDashboardModel(styles common.Styles, handler *uploadassets.UploadAssetHandler, user, actor *db.User, readOnly bool, sessionID string) dashboardModel {
+	p := pager.New()
+	p.PerPage = projectsPerPage
+	p.Type = pager.Dots
+	p.InactiveDot = styles.InactivePagination.Render("•")
+
+	in := input.New()
+	in.Prompt = styles.FocusedPrompt.String()
+	in.CharLimit = 256
+
+	return dashboardModel{
+		handler:   handler,
+		user:      user,
+		actor:     actor,
+		readOnly:  readOnly,
+		sessionID: sessionID,
+		styles:    styles,
+		pager:     p,
+		spinner:   common.NewSpinner(styles),
+		input:     in,
+		state:     dashboardLoading,
+	}
+}
+
+// command is the `Cmd` the ssh commands use, writing into sesh.
+func (m dashboardModel) command(sesh CmdSession) *Cmd {
+	cfg := m.handler.Cfg
+	return &Cmd{
+		User:      m.user,
+		Session:   sesh,
+		Log:       cfg.Logger.With("user", m.user.Name),
+		Store:     m.handler.Storage,
+		Dbpool:    m.handler.DBPool,
+		Write:     true,
+		Styles:    m.styles,
+		Events:    m.handler.Events,
+		Actor:     m.actor,
+		SessionID: m.sessionID,
+		Space:     cfg.Space,
+	}
+}
+
+func (m dashboardModel) selected() *dashboardProject {
+	if m.index < 0 || m.index >= len(m.projects) {
+		return nil
+	}
+	return &m.projects[m.index]
+}
+
+func (m dashboardModel) Update(msg tea.Msg) (dashboardModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch m.state {
+		case dashboardLinking, dashboardSharing:
+			return m.updateInput(msg)
+		case dashboardDeleting:
+			m.state = dashboardNormal
+			project := m.selected()
+			if msg.String() != "y" || project == nil {
+				return m, nil
+			}
+			name := project.project.Name
+			m.state = dashboardRunning
+			return m, tea.Batch(m.spinner.Tick, m.run(true, func(c *Cmd) error {
+				return c.rm(name)
+			}))
+		case dashboardLoading, dashboardRunning:
+			if msg.String() == "q" || msg.String() == "esc" {
+				m.Exit = true
+			}
+			return m, nil
+		}
+
+		m.err = nil
+		switch msg.String() {
+		case "q", "esc":
+			m.Exit = true
+		case "up", "k":
+			m.index = max(0, m.index-1)
+		case "down", "j":
+			m.index = min(len(m.projects)-1, m.index+1)
+		case "left", "h":
+			m.index = max(0, m.index-projectsPerPage)
+		case "right", "l":
+			m.index = min(len(m.projects)-1, m.index+projectsPerPage)
+		case "r":
+			m.state = dashboardLoading
+			return m, LoadDashboard(m)
+		case "x", "d":
+			if m.canChange() {
+				m.state = dashboardDeleting
+			}
+		case "L":
+			if m.canChange() {
+				m.state = dashboardLinking
+				m.input.Placeholder = "project to link to"
+				m.input.SetValue("")
+				return m, m.input.Focus()
+			}
+		case "s":
+			if m.selected() != nil {
+				m.state = dashboardSharing
+				m.input.Placeholder = "file to share"
+				m.input.SetValue("index.html")
+				m.input.CursorEnd()
+				return m, m.input.Focus()
+			}
+		}
+		m.index = max(0, m.index)
+		m.pager.Page = m.index / projectsPerPage
+
+	case dashboardLoadedMsg:
+		m.state = dashboardNormal
+		m.projects = msg.projects
+		m.events = msg.events
+		m.used = msg.used
+		m.storageMax = msg.storageMax
+		m.index = max(0, min(m.index, len(m.projects)-1))
+		m.pager.SetTotalPages(len(m.projects))
+		m.pager.Page = m.index / projectsPerPage
+
+	case dashboardErrMsg:
+		m.state = dashboardNormal
+		m.err = msg.err
+
+	case dashboardActionMsg:
+		m.state = dashboardNormal
+		m.output = msg.output
+		m.err = msg.err
+		if msg.reload {
+			m.state = dashboardLoading
+			return m, LoadDashboard(m)
+		}
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		if m.state < dashboardNormal {
+			m.spinner, cmd = m.spinner.Update(msg)
+		}
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+// canChange keeps org members that may only look from changing projects,
+// the commands check the same role for `--write`.
+func (m *dashboardModel) canChange() bool {
+	if m.selected() == nil {
+		return false
+	}
+	if m.readOnly {
+		m.err = fmt.Errorf("your role cannot change the projects of (%s)", m.user.Name)
+		return false
+	}
+	return true
+}
+
+func (m dashboardModel) updateInput(msg tea.KeyMsg) (dashboardModel, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEscape:
+		m.state = dashboardNormal
+		m.input.Blur()
+		return m, nil
+	case tea.KeyEnter:
+		project := m.selected()
+		value := strings.TrimSpace(m.input.Value())
+		state := m.state
+		m.state = dashboardNormal
+		m.input.Blur()
+		if project == nil || value == "" {
+			return m, nil
+		}
+
+		name := project.project.Name
+		m.state = dashboardRunning
+		if state == dashboardLinking {
+			return m, tea.Batch(m.spinner.Tick, m.run(true, func(c *Cmd) error {
+				return c.link(name, value)
+			}))
+		}
+		cfg := m.handler.Cfg
+		fpath := name + "/" + strings.TrimPrefix(value, "/")
+		return m, tea.Batch(m.spinner.Tick, m.run(false, func(c *Cmd) error {
+			return c.share(fpath, cfg.DefaultShareTTL, cfg)
+		}))
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m dashboardModel) run(reload bool, fn func(c *Cmd) error) tea.Cmd {
+	return func() tea.Msg {
+		sesh := &dashboardSession{}
+		err := fn(m.command(sesh))
+		out := strings.ReplaceAll(sesh.String(), "\r\n", "\n")
+		return dashboardActionMsg{
+			output: strings.TrimSpace(out),
+			err:    err,
+			reload: reload,
+		}
+	}
+}
+
+// LoadDashboard returns the command that loads the user's projects.
+func LoadDashboard(m dashboardModel) tea.Cmd {
+	return tea.Batch(
+		m.spinner.Tick,
+		fetchDashboard(m),
+	)
+}
+
+func fetchDashboard(m dashboardModel) tea.Cmd {
+	return func() tea.Msg {
+		c := m.command(&dashboardSession{})
+		cfgMaxSize := shared.GetQuotaForUser(c.Dbpool, m.handler.Cfg, m.user.ID)
+		bucket, stats, storageMax, err := c.usage(cfgMaxSize)
+		if err != nil {
+			return dashboardErrMsg{err}
+		}
+
+		projects, err := c.Dbpool.FindProjectsByUser(m.user.ID)
+		if err != nil {
+			return dashboardErrMsg{err}
+		}
+		sort.Slice(projects, func(i, j int) bool {
+			return projects[i].Name < projects[j].Name
+		})
+
+		msg := dashboardLoadedMsg{used: stats.TotalSize, storageMax: storageMax}
+		walked := 0
+		for _, project := range projects {
+			item := dashboardProject{project: project, files: -1}
+			// links do not have assets of their own
+			if project.Name == project.ProjectDir && walked < maxProjectSizes {
+				walked += 1
+				count, size, err := c.projectSize(bucket, project.Name)
+				if err == nil {
+					item.files = count
+					item.size = size
+				}
+			}
+			msg.projects = append(msg.projects, item)
+		}
+
+		events, err := c.Dbpool.FindProjectEventsForUser(m.user.ID, recentDeploys)
+		if err != nil {
+			c.Log.Error("could not find project events", "err", err.Error())
+		}
+		msg.events = events
+		return msg
+	}
+}
+
+func (m dashboardModel) gaugeView() string {
+	percent := float64(0)
+	if m.storageMax > 0 {
+		percent = min(float64(m.used)/float64(m.storageMax), 1)
+	}
+	filled := int(percent * gaugeWidth)
+	style := m.styles.Note
+	if percent >= 0.9 {
+		style = m.styles.Error
+	}
+	bar := style.Render(strings.Repeat("█", filled)) +
+		m.styles.Subtle.Render(strings.Repeat("░", gaugeWidth-filled))
+	return fmt.Sprintf(
+		"%s %s of %s (%.2f%%)",
+		bar,
+		shared.HumanSize(int64(m.used)),
+		shared.HumanSize(int64(m.storageMax)),
+		percent*100,
+	)
+}
+
+func (m dashboardModel) projectsView() string {
+	if len(m.projects) == 0 {
+		return m.styles.Subtle.Render("no projects found, upload one with rsync, scp or sftp") + "\n"
+	}
+
+	var s string
+	start, end := m.pager.GetSliceBounds(len(m.projects))
+	for i, item := range m.projects[start:end] {
+		name := item.project.Name
+		detail := "-"
+		if item.project.Name != item.project.ProjectDir {
+			detail = fmt.Sprintf("-> %s", item.project.ProjectDir)
+		} else if item.files >= 0 {
+			detail = fmt.Sprintf("%d files, %s", item.files, shared.HumanSize(item.size))
+		}
+
+		line := fmt.Sprintf("%-24s %s", name, m.styles.Subtle.Render(detail))
+		if start+i == m.index {
+			marker := m.styles.SelectionMarker.String()
+			if m.state == dashboardDeleting {
+				line = marker + m.styles.Delete.Render(fmt.Sprintf("%-24s %s", name, detail))
+			} else {
+				line = marker + m.styles.SelectedMenuItem.Render(fmt.Sprintf("%-24s", name)) +
+					" " + m.styles.Subtle.Render(detail)
+			}
+		} else {
+			line = "  " + line
+		}
+		s += line + "\n"
+	}
+	if m.pager.TotalPages > 1 {
+		s += m.pager.View() + "\n"
+	}
+	return s
+}
+
+func (m dashboardModel) eventsView() string {
+	if len(m.events) == 0 {
+		return m.styles.Subtle.Render("no deploys yet") + "\n"
+	}
+
+	var s string
+	for _, event := range m.events {
+		when := ""
+		if event.CreatedAt != nil {
+			when = event.CreatedAt.Format("2006-01-02 15:04")
+		}
+		s += fmt.Sprintf(
+			"  %s %s %s %s\n",
+			m.styles.Subtle.Render(when),
+			m.styles.Label.Render(event.Event),
+			event.ProjectName,
+			m.styles.Subtle.Render(fmt.Sprintf("(%d files)", event.FileCount)),
+		)
+	}
+	return s
+}
+
+func (m dashboardModel) helpView() string {
+	items := []string{"j/k, ↑/↓: choose"}
+	if m.pager.TotalPages > 1 {
+		items = append(items, "h/l, ←/→: page")
+	}
+	items = append(items, "x: delete", "L: link", "s: share", "r: refresh", "esc: exit")
+	return common.HelpView(m.styles, items...)
+}
+
+func (m dashboardModel) View() string {
+	if m.state == dashboardLoading {
+		return m.spinner.View() + " Loading...\n\n"
+	}
+
+	s := fmt.Sprintf("Here are the projects of %s.\n\n", m.user.Name)
+	s += m.gaugeView() + "\n\n"
+	s += m.projectsView() + "\n"
+	s += m.styles.LabelDim.Render("Recent deploys") + "\n"
+	s += m.eventsView()
+
+	if m.output != "" {
+		s += "\n" + m.output + "\n"
+	}
+	if m.err != nil {
+		s += "\n" + m.styles.Error.Render("Error: ") + m.styles.Subtle.Render(m.err.Error()) + "\n"
+	}
+
+	switch m.state {
+	case dashboardRunning:
+		s += "\n" + m.spinner.View() + " Running..."
+	case dashboardDeleting:
+		st := m.styles.Delete.Copy().MarginTop(1).MarginRight(1)
+		s += st.Render("Delete this project and its files?") + m.styles.DeleteDim.Render("(y/N)")
+	case dashboardLinking:
+		s += "\nLink this project to\n" + m.input.View()
+	case dashboardSharing:
+		s += "\nShare a link to\n" + m.input.View()
+	default:
+		s += "\n" + m.helpView()
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package pgs
+
+import (
+	"io"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/wish/cms/ui/common"
+)
+
+func TestDashboardActions(t *testing.T) {
+	styles := common.DefaultStyles(lipgloss.NewRenderer(io.Discard))
+	loaded := dashboardLoadedMsg{
+		projects: []dashboardProject{
+			{project: &db.Project{Name: "blog", ProjectDir: "blog"}, files: 2, size: 10},
+			{project: &db.Project{Name: "site", ProjectDir: "blog"}, files: -1},
+		},
+		used:       10,
+		storageMax: 100,
+	}
+	key := func(k string) tea.KeyMsg {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+	}
+
+	m := newDashboardModel(styles, nil, &db.User{Name: "org"}, &db.User{Name: "erock"}, true, "")
+	m, _ = m.Update(loaded)
+	m, _ = m.Update(key("j"))
+	if m.selected().project.Name != "site" {
+		t.Fatalf("expected (site) to be selected, got (%s)", m.selected().project.Name)
+	}
+	m, _ = m.Update(key("x"))
+	if m.state != dashboardNormal || m.err == nil {
+		t.Fatal("expected a read only member to be refused a delete")
+	}
+
+	m = newDashboardModel(styles, nil, &db.User{Name: "erock"}, &db.User{Name: "erock"}, false, "")
+	m, _ = m.Update(loaded)
+	m, _ = m.Update(key("x"))
+	if m.state != dashboardDeleting {
+		t.Fatalf("expected delete to ask for confirmation, got state (%d)", m.state)
+	}
+	m, cmd := m.Update(key("n"))
+	if m.state != dashboardNormal || cmd != nil {
+		t.Fatal("expected anything but `y` to cancel the delete")
+	}
+
+	m, _ = m.Update(key("s"))
+	if m.state != dashboardSharing || m.input.Value() != "index.html" {
+		t.Fatalf("expected share to prompt for a file, got (%q)", m.input.Value())
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEscape})
+	if m.state != dashboardNormal || m.Exit {
+		t.Fatal("expected esc to only cancel the prompt")
+	}
+	m, _ = m.Update(key("q"))
+	if !m.Exit {
+		t.Fatal("expected q to leave the dashboard")
+	}
+}
@@ -0,0 +1,116 @@
+package pgs
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/wish/cms/ui/common"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestDf(t *testing.T) {
+	fixtures := []struct {
+		name      string
+		byProject bool
+		maxSize   uint64
+		summary   string
+		expect    map[string][]string
+	}{
+		{
+			name:    "summary",
+			maxSize: 100,
+			summary: "used 10 of 100 (10.00%) across (3) files",
+			expect:  map[string][]string{},
+		},
+		{
+			name:      "projects",
+			byProject: true,
+			maxSize:   100,
+			summary:   "used 10 of 100 (10.00%) across (3) files",
+			expect: map[string][]string{
+				"Project": {"Size", "Used (%)"},
+				"blog":    {"6", "60.00"},
+				"docs":    {"4", "40.00"},
+				"empty":   {"0", "0.00"},
+			},
+		},
+		{
+			name:    "unlimited",
+			summary: "used 10 of 0 (0.00%) across (3) files",
+			expect:  map[string][]string{},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket, err := st.UpsertBucket("static-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for fpath, text := range map[string]string{
+				"blog/index.html":   "hello!",
+				"docs/index.html":   "hi",
+				"docs/css/main.css": "hi",
+			} {
+				_, err = st.PutObject(
+					bucket,
+					fpath,
+					utils.NopReaderAtCloser(bytes.NewReader([]byte(text))),
+					&utils.FileEntry{Filepath: fpath},
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dbpool := memory.NewDB(slog.Default())
+			for _, name := range []string{"blog", "docs", "empty", "prod"} {
+				_, err = dbpool.InsertProject("1", name, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// links share the assets of blog and are left out
+			prod, err := dbpool.FindProjectByName("1", "prod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = dbpool.LinkToProject("1", prod.ID, "blog", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sesh := &adminSession{}
+			c := &Cmd{
+				User:    &db.User{ID: "1", Name: "test"},
+				Session: sesh,
+				Log:     slog.Default(),
+				Store:   st,
+				Dbpool:  dbpool,
+				Styles:  common.DefaultStyles(lipgloss.NewRenderer(io.Discard)),
+			}
+			err = c.df(fixture.maxSize, fixture.byProject)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(sesh.String(), fixture.summary) {
+				t.Errorf("expected %q, got %q", fixture.summary, sesh.String())
+			}
+			if diff := cmp.Diff(fixture.expect, tableRows(sesh.String())); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package pgs
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bandwidth"
+)
+
+// overQuotaPage is self contained, the site's own stylesheets would be
+// over the limit too.
+var overQuotaPage = template.Must(template.New("over-quota").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <title>{{.Project}} is taking a break</title>
+    <style>body { font-family: sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; line-height: 1.5; }</style>
+  </head>
+  <body>
+    <h1>{{.Project}} is taking a break</h1>
+    <p>This site served all the traffic its plan on {{.Domain}} includes for this month.</p>
+    <p>It will be back on {{.Reset}}, or as soon as its owner upgrades their plan.</p>
+  </body>
+</html>
+`))
+
+// serveOverQuota answers for a site that used up its monthly egress, it
+// asks clients to come back once the next month starts.
+func serveOverQuota(w http.ResponseWriter, cfg *shared.ConfigSite, projectName string, now time.Time) {
+	reset := bandwidth.MonthOf(now).AddDate(0, 1, 0)
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Header().Set("cache-control", "no-store")
+	w.Header().Set("retry-after", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = overQuotaPage.Execute(w, map[string]string{
+		"Project": projectName,
+		"Domain":  cfg.Domain,
+		"Reset":   reset.Format("January 2"),
+	})
+}
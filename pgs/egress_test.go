@@ -0,0 +1,31 @@
+package pgs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/shared"
+)
+
+func TestServeOverQuota(t *testing.T) {
+	cfg := &shared.ConfigSite{}
+	cfg.Domain = "pgs.sh"
+	w := httptest.NewRecorder()
+	serveOverQuota(w, cfg, "blog", time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status (%d), found (%d)", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("retry-after") != "3601" {
+		t.Errorf("expected to retry once the month is over, found (%s)", w.Header().Get("retry-after"))
+	}
+	body := w.Body.String()
+	for _, expected := range []string{"blog is taking a break", "on pgs.sh", "back on April 1"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected (%s) in:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package pgs
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/picosh/pico/shared/storage"
+)
+
+func (h *AssetHandler) findEncodingVariants(fpath string) []string {
+	variants := []string{"identity"}
+	for _, sidecar := range storage.Sidecars {
+		_, err := h.Storage.GetObjectSize(h.Bucket, fpath+sidecar.Ext)
+		if err == nil {
+			variants = append(variants, sidecar.Encoding)
+		}
+	}
+	return variants
+}
+
+func (h *AssetHandler) logEncoding(r *http.Request, w http.ResponseWriter, fpath string) {
+	if !h.Cfg.LogEncoding || !h.Cfg.LogEncodingSampler.Allow() {
+		return
+	}
+
+	chosen := w.Header().Get("content-encoding")
+	if chosen == "" {
+		chosen = "identity"
+	}
+
+	h.Logger.Debug(
+		"content encoding negotiation",
+		"bucket", h.Bucket.Name,
+		"key", fpath,
+		"acceptEncoding", r.Header.Get("accept-encoding"),
+		"variants", h.findEncodingVariants(fpath),
+		"selected", chosen,
+	)
+}
+
+// acceptsEncoding reports whether the client takes encoding, a `q=0`
+// refuses it.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, enc := range strings.Split(r.Header.Get("accept-encoding"), ",") {
+		parts := strings.Split(enc, ";")
+		name := strings.TrimSpace(parts[0])
+		if name != encoding && name != "*" {
+			continue
+		}
+		if len(parts) > 1 {
+			q, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(parts[1]), "q="), 64)
+			if err == nil && q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	return acceptsEncoding(r, "gzip")
+}
+
+// selectSidecar swaps contents for the most preferred sidecar the client
+// accepts, only sidecars made from the current version of fpath are used.
+func (h *AssetHandler) selectSidecar(w http.ResponseWriter, r *http.Request, fpath, contentType string, meta *storage.ObjectMeta, contents io.ReadCloser) io.ReadCloser {
+	if !storage.ShouldCompress(fpath, contentType, 1, 1, h.Cfg.CompressTypes) {
+		return contents
+	}
+	if meta.Checksum == "" || meta.ContentEncoding != "" {
+		return contents
+	}
+
+	found := false
+	for _, sidecar := range storage.Sidecars {
+		sidecarMeta, err := h.Storage.GetObjectMeta(h.Bucket, fpath+sidecar.Ext)
+		if err != nil || sidecarMeta.Source != meta.Checksum {
+			continue
+		}
+		found = true
+		if !acceptsEncoding(r, sidecar.Encoding) {
+			continue
+		}
+
+		c, _, _, err := h.Storage.GetObject(h.Bucket, fpath+sidecar.Ext)
+		if err != nil {
+			continue
+		}
+		_ = contents.Close()
+		w.Header().Add("vary", "accept-encoding")
+		w.Header().Set("content-encoding", sidecar.Encoding)
+		return c
+	}
+
+	if found {
+		w.Header().Add("vary", "accept-encoding")
+	}
+	return contents
+}
+
+// decodeStored handles assets that were gzipped at rest: clients that
+// accept gzip get the stored bytes as is, everyone else gets them inflated.
+// Closing the result does not close contents.
+func (h *AssetHandler) decodeStored(w http.ResponseWriter, r *http.Request, meta *storage.ObjectMeta, contents io.Reader) (io.ReadCloser, error) {
+	if meta.ContentEncoding != "gzip" {
+		return io.NopCloser(contents), nil
+	}
+
+	w.Header().Add("vary", "accept-encoding")
+	if acceptsGzip(r) {
+		w.Header().Set("content-encoding", "gzip")
+		return io.NopCloser(contents), nil
+	}
+
+	return gzip.NewReader(contents)
+}
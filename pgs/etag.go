@@ -0,0 +1,49 @@
+package pgs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// assetETag is a strong etag built from the checksum recorded at upload,
+// an encoded response is a different representation so it gets its own.
+func assetETag(checksum, contentEncoding string) string {
+	if checksum == "" {
+		return ""
+	}
+	if contentEncoding != "" {
+		return fmt.Sprintf(`"%s-%s"`, checksum, contentEncoding)
+	}
+	return fmt.Sprintf(`"%s"`, checksum)
+}
+
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified checks the conditional headers of a GET, `If-None-Match`
+// takes precedence over `If-Modified-Since` when both are sent.
+func isNotModified(r *http.Request, etag string, modTime time.Time) bool {
+	inm := r.Header.Get("if-none-match")
+	if inm != "" {
+		return etag != "" && etagMatches(inm, etag)
+	}
+
+	ims := r.Header.Get("if-modified-since")
+	if ims == "" || modTime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,44 @@
+package pgs
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/picosh/pico/db/backend"
+	"github.com/picosh/pico/shared/gc"
+)
+
+// RunGC reconciles storage with the database once and prints what it found,
+// nothing is removed unless `--write` is passed.
+func RunGC(args []string) int {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	write := flags.Bool("write", false, "remove what was found instead of only listing it")
+	grace := flags.Duration("grace", gc.DefaultGrace, "skip anything changed more recently than this")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := NewConfigSite()
+	logger := cfg.Logger
+	dbh := backend.NewDB(cfg.DbURL, cfg.Logger)
+	defer dbh.Close()
+
+	st, err := newStorage(cfg, dbh)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+
+	findings, err := gc.Reconcile(dbh, st, gc.Options{Write: *write, Grace: *grace}, logger)
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	if !*write && len(findings) > 0 {
+		logger.Info("dry run, nothing was removed, pass --write to remove it")
+	}
+	return 0
+}
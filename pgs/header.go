@@ -1,132 +1,60 @@
 package pgs
 
 import (
-	"fmt"
-	"slices"
+	"io"
+	"path/filepath"
 	"strings"
-)
+	"sync"
+	"time"
 
-type HeaderRule struct {
-	Path    string
-	Headers []*HeaderLine
-}
+	"github.com/picosh/pico/shared/headers"
+)
 
-type HeaderLine struct {
-	Path  string
-	Name  string
-	Value string
-}
+type HeaderRule = headers.HeaderRule
+type HeaderLine = headers.HeaderLine
 
-var headerDenyList = []string{
-	"accept-ranges",
-	"age",
-	"allow",
-	"alt-svc",
-	"connection",
-	"content-encoding",
-	"content-length",
-	"content-range",
-	"date",
-	"location",
-	"server",
-	"trailer",
-	"transfer-encoding",
-	"upgrade",
-}
+var headerDenyList = headers.DenyList
 
-// from https://github.com/netlify/build/tree/main/packages/headers-parser
 func parseHeaderText(text string) ([]*HeaderRule, error) {
-	rules := []*HeaderRule{}
-	parsed := []*HeaderLine{}
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		parsedLine, err := parseLine(strings.TrimSpace(line))
-		if parsedLine == nil {
-			continue
-		}
-		if err != nil {
-			return rules, err
-		}
-		parsed = append(parsed, parsedLine)
-	}
-
-	var prevPath *HeaderRule
-	for _, rule := range parsed {
-		if rule.Path != "" {
-			if prevPath != nil {
-				if len(prevPath.Headers) > 0 {
-					rules = append(rules, prevPath)
-				}
-			}
-
-			prevPath = &HeaderRule{
-				Path: rule.Path,
-			}
-		} else if prevPath != nil {
-			// do not add headers in deny list
-			if slices.Contains(headerDenyList, rule.Name) {
-				continue
-			}
-			prevPath.Headers = append(
-				prevPath.Headers,
-				&HeaderLine{Name: rule.Name, Value: rule.Value},
-			)
-		}
-	}
-
-	// cleanup
-	if prevPath != nil && len(prevPath.Headers) > 0 {
-		rules = append(rules, prevPath)
-	}
-
-	return rules, nil
+	return headers.ParseHeaderText(text)
 }
 
-func parseLine(line string) (*HeaderLine, error) {
-	rule := &HeaderLine{}
-
-	if isPathLine(line) {
-		rule.Path = line
-		return rule, nil
-	}
+type cachedHeaders struct {
+	modTime time.Time
+	matcher *headers.Matcher
+}
 
-	if isEmpty(line) {
-		return nil, nil
-	}
+// headerMatchers keeps the compiled `_headers` of every project directory
+// a server has served, it is only parsed again once the file changes.
+var headerMatchers sync.Map
 
-	if isComment(line) {
+// headerMatcher returns the compiled `_headers` of the project, nil when
+// it has none.
+func (h *AssetHandler) headerMatcher() (*headers.Matcher, error) {
+	fp, _, modTime, err := h.Storage.GetObject(h.Bucket, filepath.Join(h.ProjectDir, "_headers"))
+	if err != nil {
 		return nil, nil
 	}
+	defer fp.Close()
 
-	if !strings.Contains(line, ":") {
-		return nil, nil
+	key := h.Bucket.Name + "/" + h.ProjectDir
+	if v, ok := headerMatchers.Load(key); ok {
+		cached := v.(*cachedHeaders)
+		if !modTime.IsZero() && cached.modTime.Equal(modTime) {
+			return cached.matcher, nil
+		}
 	}
 
-	results := strings.SplitN(line, ":", 2)
-	name := strings.ToLower(strings.TrimSpace(results[0]))
-	value := strings.TrimSpace(results[1])
-
-	if name == "" {
-		return nil, fmt.Errorf("header name cannot be empty")
+	buf := new(strings.Builder)
+	_, err = io.Copy(buf, fp)
+	if err != nil {
+		return nil, err
 	}
-
-	if value == "" {
-		return nil, fmt.Errorf("header value cannot be empty")
+	rules, err := parseHeaderText(buf.String())
+	if err != nil {
+		h.Logger.Error(err.Error())
 	}
-
-	rule.Name = name
-	rule.Value = value
-	return rule, nil
-}
-
-func isComment(line string) bool {
-	return strings.HasPrefix(line, "#")
-}
-
-func isEmpty(line string) bool {
-	return line == ""
-}
-
-func isPathLine(line string) bool {
-	return strings.HasPrefix(line, "/")
+	matcher := headers.NewMatcher(rules)
+	headerMatchers.Store(key, &cachedHeaders{modTime: modTime, matcher: matcher})
+	return matcher, nil
 }
@@ -0,0 +1,101 @@
+package pgs
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/storage"
+)
+
+type linkDB struct {
+	db.DB
+	dirs map[string]string
+}
+
+func (f *linkDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	dir, ok := f.dirs[name]
+	if !ok {
+		return nil, db.ErrNameInvalid
+	}
+	return &db.Project{ID: name, Name: name, ProjectDir: dir}, nil
+}
+
+func (f *linkDB) InsertProject(userID, name, projectDir string) (string, error) {
+	f.dirs[name] = projectDir
+	return name, nil
+}
+
+func (f *linkDB) LinkToProject(userID, projectID, projectDir string, commit bool) error {
+	if commit {
+		f.dirs[projectID] = projectDir
+	}
+	return nil
+}
+
+func (f *linkDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	links := []*db.Project{}
+	for project, dir := range f.dirs {
+		if project != name && dir == name {
+			links = append(links, &db.Project{Name: project, ProjectDir: dir})
+		}
+	}
+	return links, nil
+}
+
+func (f *linkDB) InsertAuditEntry(entry *db.AuditEntry) error {
+	return nil
+}
+
+func TestLink(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbpool := &linkDB{dirs: map[string]string{"prod": "prod", "staging": "staging", "preview": "staging"}}
+	c := &Cmd{
+		User:    &db.User{ID: "1", Name: "test"},
+		Session: &CmdSessionLogger{Log: slog.Default()},
+		Log:     slog.Default(),
+		Store:   st,
+		Dbpool:  dbpool,
+	}
+
+	// without --write nothing changes
+	err = c.link("prod", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbpool.dirs["prod"] != "prod" {
+		t.Fatal("expected a dry run not to relink the project")
+	}
+
+	c.Write = true
+	for _, args := range [][]string{
+		{"prod", "prod"},
+		{"prod", "preview"},
+		{"staging", "prod"},
+	} {
+		err = c.link(args[0], args[1])
+		if err == nil {
+			t.Fatalf("expected link %v to fail", args)
+		}
+	}
+	if !strings.Contains(c.link("staging", "prod").Error(), "unlink them first") {
+		t.Fatal("expected a linked-to project to need its links removed")
+	}
+
+	err = c.link("prod", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbpool.dirs["prod"] != "staging" {
+		t.Fatalf("expected (prod) to point to (staging), got (%s)", dbpool.dirs["prod"])
+	}
+}
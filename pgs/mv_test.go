@@ -0,0 +1,198 @@
+package pgs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type mvDB struct {
+	db.DB
+}
+
+func (m *mvDB) FindProjectByName(userID, name string) (*db.Project, error) {
+	if name == "link" {
+		return &db.Project{Name: name, ProjectDir: "proj"}, nil
+	}
+	return &db.Project{Name: name, ProjectDir: name}, nil
+}
+
+func (m *mvDB) SetProjectObjectCount(userID, name string, count *int) error {
+	return nil
+}
+
+func TestMvFile(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"proj/draft.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("draft"))),
+		&utils.FileEntry{Filepath: "proj/draft.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cmd{
+		User:    &db.User{ID: "1", Name: "test"},
+		Session: &CmdSessionLogger{Log: slog.Default()},
+		Log:     slog.Default(),
+		Store:   st,
+		Dbpool:  &mvDB{},
+		Write:   true,
+	}
+
+	for _, args := range [][]string{
+		{"proj/draft.html", "other/index.html"},
+		{"link/draft.html", "link/index.html"},
+		{"proj/missing.html", "proj/index.html"},
+	} {
+		err = c.mvFile(args[0], args[1])
+		if err == nil {
+			t.Fatalf("expected mv %v to fail", args)
+		}
+	}
+
+	err = c.mvFile("proj/draft.html", "proj/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/draft.html"); err == nil {
+		t.Fatal("expected original file to be removed")
+	}
+	size, err := st.GetObjectSize(bucket, "proj/index.html")
+	if err != nil || size != 5 {
+		t.Fatalf("expected moved file (5 bytes), got (%d) %v", size, err)
+	}
+}
+
+func TestMv(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		from    string
+		to      string
+		write   bool
+		err     string
+		project string
+		exists  []string
+		missing []string
+	}{
+		{name: "invalid", from: "proj", to: "a/b", write: true, err: "not a valid project name"},
+		{name: "not-found", from: "nope", to: "next", write: true, err: "not found"},
+		{name: "exists", from: "proj", to: "other", write: true, err: "already exists"},
+		{
+			name:    "dry-run",
+			from:    "proj",
+			to:      "next",
+			project: "proj",
+			exists:  []string{"proj/index.html", "proj/css/main.css"},
+			missing: []string{"next/index.html"},
+		},
+		{
+			name:    "move",
+			from:    "proj",
+			to:      "next",
+			write:   true,
+			project: "next",
+			exists:  []string{"next/index.html", "next/css/main.css", "other/index.html"},
+			missing: []string{"proj/index.html", "proj/css/main.css"},
+		},
+		{
+			// links have no assets of their own
+			name:    "link",
+			from:    "link",
+			to:      "next",
+			write:   true,
+			project: "next",
+			exists:  []string{"proj/index.html", "proj/css/main.css"},
+			missing: []string{"next/index.html"},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket, err := st.UpsertBucket("static-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, fpath := range []string{"proj/index.html", "proj/css/main.css", "other/index.html"} {
+				_, err = st.PutObject(
+					bucket,
+					fpath,
+					utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+					&utils.FileEntry{Filepath: fpath},
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dbpool := memory.NewDB(slog.Default())
+			for _, name := range []string{"proj", "other"} {
+				_, err = dbpool.InsertProject("1", name, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			linkID, err := dbpool.InsertProject("1", "link", "link")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = dbpool.LinkToProject("1", linkID, "proj", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &Cmd{
+				User:    &db.User{ID: "1", Name: "test"},
+				Session: &CmdSessionLogger{Log: slog.Default()},
+				Log:     slog.Default(),
+				Store:   st,
+				Dbpool:  dbpool,
+				Write:   fixture.write,
+			}
+			err = c.mv(fixture.from, fixture.to)
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected %q, got %v", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = dbpool.FindProjectByName("1", fixture.project)
+			if err != nil {
+				t.Errorf("expected project (%s), got %s", fixture.project, err)
+			}
+			for _, fpath := range fixture.exists {
+				if _, err := st.GetObjectSize(bucket, fpath); err != nil {
+					t.Errorf("expected (%s) to exist, got %s", fpath, err)
+				}
+			}
+			for _, fpath := range fixture.missing {
+				if _, err := st.GetObjectSize(bucket, fpath); err == nil {
+					t.Errorf("expected (%s) to be gone", fpath)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package pgs
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/wish/cms/ui/common"
+	"github.com/picosh/send/send/utils"
+)
+
+// tableRows reads the cells of each row of a rendered table by its first
+// column.
+func tableRows(text string) map[string][]string {
+	rows := map[string][]string{}
+	for _, line := range strings.Split(text, "\n") {
+		cells := []string{}
+		for _, cell := range strings.Split(line, "│") {
+			cell = strings.TrimSpace(cell)
+			if cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+		if len(cells) > 1 {
+			rows[cells[0]] = cells[1:]
+		}
+	}
+	return rows
+}
+
+func TestProjects(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		maxSizes int
+		expect   map[string][]string
+		note     bool
+	}{
+		{
+			name:     "all",
+			maxSizes: 100,
+			expect: map[string][]string{
+				"Name": {"Files", "Size"},
+				"blog": {"1", "5"},
+				"docs": {"2", "4"},
+				"prod": {"-> blog", "-"},
+				// nothing was ever uploaded so there is nothing to walk
+				"empty": {"-", "-"},
+			},
+		},
+		{
+			name:     "bounded",
+			maxSizes: 1,
+			expect: map[string][]string{
+				"Name":  {"Files", "Size"},
+				"blog":  {"1", "5"},
+				"docs":  {"-", "-"},
+				"prod":  {"-> blog", "-"},
+				"empty": {"-", "-"},
+			},
+			note: true,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket, err := st.UpsertBucket("static-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for fpath, text := range map[string]string{
+				"blog/index.html":   "hello",
+				"docs/index.html":   "hi",
+				"docs/css/main.css": "hi",
+			} {
+				_, err = st.PutObject(
+					bucket,
+					fpath,
+					utils.NopReaderAtCloser(bytes.NewReader([]byte(text))),
+					&utils.FileEntry{Filepath: fpath},
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dbpool := memory.NewDB(slog.Default())
+			for _, name := range []string{"docs", "empty", "blog", "prod"} {
+				_, err = dbpool.InsertProject("1", name, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			prod, err := dbpool.FindProjectByName("1", "prod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = dbpool.LinkToProject("1", prod.ID, "blog", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			maxSizes := maxProjectSizes
+			defer func() { maxProjectSizes = maxSizes }()
+			maxProjectSizes = fixture.maxSizes
+
+			sesh := &adminSession{}
+			c := &Cmd{
+				User:    &db.User{ID: "1", Name: "test"},
+				Session: sesh,
+				Log:     slog.Default(),
+				Store:   st,
+				Dbpool:  dbpool,
+				Styles:  common.DefaultStyles(lipgloss.NewRenderer(io.Discard)),
+			}
+			err = c.projects()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(fixture.expect, tableRows(sesh.String())); diff != "" {
+				t.Error(diff)
+			}
+			if fixture.note != strings.Contains(sesh.String(), "sizes only computed") {
+				t.Errorf("expected note=%t, got %q", fixture.note, sesh.String())
+			}
+		})
+	}
+}
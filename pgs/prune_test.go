@@ -0,0 +1,200 @@
+package pgs
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type pruneDB struct {
+	db.DB
+	projects []*db.Project
+	removed  []string
+}
+
+func (p *pruneDB) FindStaleProjects(userID string, updatedBefore time.Time) ([]*db.Project, error) {
+	stale := []*db.Project{}
+	for _, project := range p.projects {
+		if project.UpdatedAt.Before(updatedBefore) {
+			stale = append(stale, project)
+		}
+	}
+	return stale, nil
+}
+
+func (p *pruneDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	return p.projects, nil
+}
+
+func (p *pruneDB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	links := []*db.Project{}
+	for _, project := range p.projects {
+		if project.Name != project.ProjectDir && project.ProjectDir == name {
+			links = append(links, project)
+		}
+	}
+	return links, nil
+}
+
+func (p *pruneDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	return []*db.ProjectDeploy{}, nil
+}
+
+func (p *pruneDB) InsertProjectEvent(event *db.ProjectEvent) error {
+	return nil
+}
+
+func (p *pruneDB) InsertAuditEntry(entry *db.AuditEntry) error {
+	return nil
+}
+
+func (p *pruneDB) RemoveProject(projectID string) error {
+	p.removed = append(p.removed, projectID)
+	return nil
+}
+
+func TestPruneStale(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fpath := range []string{"old/index.html", "linked/index.html", "fresh/index.html"} {
+		_, err = st.PutObject(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+			&utils.FileEntry{Filepath: fpath},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -60)
+	dbpool := &pruneDB{projects: []*db.Project{
+		{ID: "old", Name: "old", ProjectDir: "old", UpdatedAt: &old},
+		{ID: "linked", Name: "linked", ProjectDir: "linked", UpdatedAt: &old},
+		{ID: "alias", Name: "alias", ProjectDir: "linked", UpdatedAt: &now},
+		{ID: "fresh", Name: "fresh", ProjectDir: "fresh", UpdatedAt: &now},
+		{ID: "empty", Name: "empty", ProjectDir: "empty", UpdatedAt: &now},
+	}}
+	c := &Cmd{
+		User:    &db.User{ID: "1", Name: "test"},
+		Session: &CmdSessionLogger{Log: slog.Default()},
+		Log:     slog.Default(),
+		Store:   st,
+		Dbpool:  dbpool,
+	}
+
+	err = c.pruneStale(0, false)
+	if err == nil {
+		t.Fatal("expected prune without criteria to fail")
+	}
+
+	err = c.pruneStale(30, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dbpool.removed) != 0 {
+		t.Fatal("expected nothing to be removed without `--write`")
+	}
+
+	c.Write = true
+	err = c.pruneStale(30, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"old", "empty"}, dbpool.removed); diff != "" {
+		t.Fatal(diff)
+	}
+	if _, err := st.GetObjectSize(bucket, "old/index.html"); err == nil {
+		t.Fatal("expected assets of pruned project to be removed")
+	}
+	if _, err := st.GetObjectSize(bucket, "linked/index.html"); err != nil {
+		t.Fatal("expected project with links to be kept")
+	}
+}
+
+// brokenStore fails to list the project named broken.
+type brokenStore struct {
+	storage.StorageServe
+}
+
+func (b *brokenStore) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	if strings.HasPrefix(strings.TrimPrefix(dir, "/"), "broken") {
+		return nil, fmt.Errorf("connection reset")
+	}
+	return b.StorageServe.ListObjects(bucket, dir, recursive)
+}
+
+func TestPruneStaleListError(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket(shared.GetAssetBucketName("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"broken/index.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+		&utils.FileEntry{Filepath: "broken/index.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().AddDate(0, 0, -60)
+	dbpool := &pruneDB{projects: []*db.Project{
+		{ID: "broken", Name: "broken", ProjectDir: "broken", UpdatedAt: &old},
+	}}
+	c := &Cmd{
+		User:    &db.User{ID: "1", Name: "test"},
+		Session: &CmdSessionLogger{Log: slog.Default()},
+		Log:     slog.Default(),
+		Store:   &brokenStore{st},
+		Dbpool:  dbpool,
+		Write:   true,
+	}
+
+	// neither an empty project nor one whose files we can remove
+	for _, days := range []int{0, 30} {
+		err = c.pruneStale(days, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(dbpool.removed) != 0 {
+		t.Fatalf("expected a project that could not be listed to be kept, removed %v", dbpool.removed)
+	}
+	if _, err := st.GetObjectSize(bucket, "broken/index.html"); err != nil {
+		t.Fatal("expected the files of the project to be kept")
+	}
+
+	err = c.RmProjectAssets("broken")
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("expected the listing error, got %v", err)
+	}
+	err = c.RmProjectAssets("missing")
+	if err != nil {
+		t.Fatalf("expected a project without files to have nothing to remove, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package pgs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseRange reads a single `bytes=` range of an object of size bytes. ok
+// is false for anything we serve in full instead, like a malformed header
+// or several ranges at once.
+func parseRange(header string, size int64) (offset, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	// `bytes=-n` is the last n bytes
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	return start, end - start + 1, true, nil
+}
+
+// ifRangeMatches checks `If-Range`, a range of a representation that
+// changed since the client saw it is useless so it gets the whole asset.
+func ifRangeMatches(r *http.Request, etag string, modTime time.Time) bool {
+	ir := r.Header.Get("if-range")
+	if ir == "" {
+		return true
+	}
+	// only strong etags can be used to combine ranges
+	if strings.HasPrefix(ir, `"`) {
+		return etag != "" && ir == etag
+	}
+	since, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+	return modTime.Truncate(time.Second).Equal(since)
+}
+
+// serveRange answers a `Range` request with only the requested bytes,
+// false means the asset should be served in full.
+func (h *AssetHandler) serveRange(w http.ResponseWriter, r *http.Request, fpath string, size int64, modTime time.Time) bool {
+	header := r.Header.Get("range")
+	if header == "" || !ifRangeMatches(r, w.Header().Get("etag"), modTime) {
+		return false
+	}
+
+	offset, length, ok, err := parseRange(header, size)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		w.Header().Set("content-range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+	if !ok {
+		return false
+	}
+
+	contents, err := h.Storage.GetObjectRange(h.Bucket, fpath, offset, length)
+	if err != nil {
+		h.Logger.Error("could not read range, serving asset in full", "asset", fpath, "err", err.Error())
+		return false
+	}
+	defer contents.Close()
+
+	w.Header().Set("content-range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	w.Header().Set("content-length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	_, err = io.Copy(w, contents)
+	if err != nil {
+		h.Logger.Error(err.Error())
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package pgs
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	uploadassets "github.com/picosh/pico/filehandlers/assets"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/authn"
+	"github.com/picosh/pico/shared/build"
+	"github.com/picosh/pico/shared/certs"
+	"github.com/picosh/pico/shared/purge"
+	"github.com/picosh/pico/shared/scan"
+)
+
+// loadConfig reads the env file at PGS_CONFIG_FILE, when there is one,
+// before resolving the settings.
+func loadConfig() (*shared.ConfigSite, error) {
+	if fpath := os.Getenv("PGS_CONFIG_FILE"); fpath != "" {
+		err := shared.LoadEnvFile(fpath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewConfigSite(), nil
+}
+
+// ValidateConfig reports the settings the services would reject or
+// silently ignore.
+func ValidateConfig(cfg *shared.ConfigSite) []error {
+	errs := []error{}
+	if cfg.Domain == "" {
+		errs = append(errs, errors.New("PGS_DOMAIN is required"))
+	}
+	if cfg.Protocol != "http" && cfg.Protocol != "https" {
+		errs = append(errs, fmt.Errorf("PGS_PROTOCOL (%s) must be http or https", cfg.Protocol))
+	}
+	if cfg.PurgeProvider != "" {
+		_, err := purge.NewProvider(cfg.PurgeProvider, cfg.PurgeURL, cfg.PurgeZone, cfg.PurgeToken)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.ScanProvider != "" {
+		_, err := scan.NewScanner(cfg.ScanProvider, cfg.ScanURL, cfg.ScanToken)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if cfg.ScanAction != "reject" && cfg.ScanAction != "quarantine" {
+			errs = append(errs, fmt.Errorf("PGS_SCAN_ACTION (%s) must be reject or quarantine", cfg.ScanAction))
+		}
+	}
+	if len(cfg.BuildGenerators) > 0 && len(cfg.BuildSandbox) == 0 {
+		errs = append(errs, errors.New("PGS_BUILD_GENERATORS needs PGS_BUILD_SANDBOX, builds never run unsandboxed"))
+	}
+	for _, generator := range cfg.BuildGenerators {
+		if _, ok := build.Generators[generator]; !ok {
+			errs = append(errs, fmt.Errorf("unknown build generator (%s)", generator))
+		}
+	}
+	if len(cfg.AuthProviders) > 0 {
+		_, err := authn.FromConfig(cfg, nil)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		errs = append(errs, errors.New("PGS_TLS_CERT and PGS_TLS_KEY have to be set together"))
+	}
+	if cfg.TLSAddr != "" && cfg.CertSecret != "" {
+		switch cfg.ACMEChallenge {
+		case certs.ChallengeHTTP:
+		case certs.ChallengeDNS:
+			_, err := certs.NewDNSProvider(cfg.ACMEDNSProvider, cfg.ACMEDNSURL, cfg.ACMEDNSZone, cfg.ACMEDNSToken)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			errs = append(errs, fmt.Errorf("PGS_ACME_CHALLENGE (%s) must be %s or %s", cfg.ACMEChallenge, certs.ChallengeHTTP, certs.ChallengeDNS))
+		}
+	}
+	tiers := strings.Split(os.Getenv("PGS_QUOTA_TIERS"), ",")
+	tiers = slices.DeleteFunc(tiers, func(tier string) bool { return strings.TrimSpace(tier) == "" })
+	if len(tiers) != len(cfg.QuotaTiers) {
+		errs = append(errs, errors.New("PGS_QUOTA_TIERS has entries that are not `feature:bytes`"))
+	}
+	tiers = strings.Split(os.Getenv("PGS_EGRESS_TIERS"), ",")
+	tiers = slices.DeleteFunc(tiers, func(tier string) bool { return strings.TrimSpace(tier) == "" })
+	if len(tiers) != len(cfg.EgressTiers) {
+		errs = append(errs, errors.New("PGS_EGRESS_TIERS has entries that are not `feature:bytes`"))
+	}
+	return errs
+}
+
+// printConfig writes every resolved setting and then the problems found.
+func printConfig(w io.Writer, cfg *shared.ConfigSite, errs []error) {
+	for _, setting := range cfg.Settings() {
+		fmt.Fprintf(w, "%s = %s\n", setting[0], setting[1])
+	}
+	for _, err := range errs {
+		fmt.Fprintf(w, "error: %s\n", err)
+	}
+}
+
+// RunConfig handles `pgs-ssh config validate [--file pgs.env]`.
+func RunConfig(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: config validate [--file pgs.env]")
+		return 2
+	}
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	file := flags.String("file", os.Getenv("PGS_CONFIG_FILE"), "env file to read before the environment is resolved")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if *file != "" {
+		err := shared.LoadEnvFile(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 1
+		}
+	}
+	cfg := NewConfigSite()
+	errs := ValidateConfig(cfg)
+	printConfig(os.Stdout, cfg, errs)
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reloadConfig resolves the settings again and applies the reloadable
+// ones, a config with problems is not applied.
+func reloadConfig(cfg *shared.ConfigSite, handler *uploadassets.UploadAssetHandler, logger *slog.Logger) error {
+	next, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	errs := ValidateConfig(next)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	changed := cfg.Reload(next)
+	handler.ReloadLimits()
+	logger.Info("reloaded config", "changed", strings.Join(changed, ", "))
+	return nil
+}
+
+// reloadOnHangup reloads the config every time the process gets SIGHUP,
+// running sessions are left alone.
+func reloadOnHangup(cfg *shared.ConfigSite, handler *uploadassets.UploadAssetHandler, logger *slog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		err := reloadConfig(cfg, handler, logger)
+		if err != nil {
+			logger.Error("could not reload config, keeping the current one", "err", err.Error())
+		}
+	}
+}
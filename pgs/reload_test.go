@@ -0,0 +1,87 @@
+package pgs
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uploadassets "github.com/picosh/pico/filehandlers/assets"
+)
+
+func TestValidateConfig(t *testing.T) {
+	t.Setenv("PGS_PURGE_PROVIDER", "akamai")
+	t.Setenv("PGS_BUILD_GENERATORS", "hugo,jekyll")
+	t.Setenv("PGS_QUOTA_TIERS", "pro:100,broken")
+	t.Setenv("PGS_ENV_SECRET", "hunter2")
+	t.Setenv("PGS_AUTH_PROVIDERS", "db,ldap")
+	cfg := NewConfigSite()
+
+	errs := ValidateConfig(cfg)
+	out := &bytes.Buffer{}
+	printConfig(out, cfg, errs)
+	text := out.String()
+	for _, expected := range []string{
+		"Domain = pgs.sh\n",
+		"EnvSecret = (redacted)\n",
+		"error: unknown purge provider (akamai)",
+		"error: unknown build generator (jekyll)",
+		"error: PGS_BUILD_GENERATORS needs PGS_BUILD_SANDBOX",
+		"error: PGS_QUOTA_TIERS has entries",
+		"error: unknown auth provider (ldap)",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected (%s) in:\n%s", expected, text)
+		}
+	}
+	if strings.Contains(text, "hunter2") {
+		t.Error("expected secrets not to be printed")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "pgs.env")
+	t.Setenv("PGS_CONFIG_FILE", fpath)
+	t.Setenv("PGS_DENIED_EXT", "")
+	t.Setenv("PGS_DEBUG", "")
+	err := os.WriteFile(fpath, []byte("PGS_DENIED_EXT=.exe\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &uploadassets.UploadAssetHandler{Cfg: cfg}
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+
+	err = os.WriteFile(fpath, []byte("PGS_DENIED_EXT=.exe,.bat\nPGS_DEBUG=1\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reloadConfig(cfg, handler, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.DeniedExt) != 2 {
+		t.Errorf("expected the denied extensions to be reloaded, got %v", cfg.DeniedExt)
+	}
+	if cfg.Debug {
+		t.Error("expected debug to need a restart")
+	}
+
+	err = os.WriteFile(fpath, []byte("PGS_DENIED_EXT=.sh\nPGS_PURGE_PROVIDER=akamai\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGS_PURGE_PROVIDER", "")
+	err = reloadConfig(cfg, handler, logger)
+	if err == nil {
+		t.Error("expected an invalid config to be refused")
+	}
+	if len(cfg.DeniedExt) != 2 {
+		t.Error("expected a refused config not to be applied")
+	}
+}
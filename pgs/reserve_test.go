@@ -0,0 +1,56 @@
+package pgs
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared/storage"
+)
+
+func TestReserve(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbpool := memory.NewDB(slog.Default())
+	c := &Cmd{
+		User:    &db.User{ID: "1", Name: "test"},
+		Session: &CmdSessionLogger{Log: slog.Default()},
+		Log:     slog.Default(),
+		Store:   st,
+		Dbpool:  dbpool,
+		Write:   true,
+	}
+
+	ttl := reservationTTL
+	defer func() { reservationTTL = ttl }()
+
+	// a lapsed reservation no longer holds any space
+	reservationTTL = -time.Minute
+	err = c.reserve("docs", 80, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.reserve("blog", 80, 100)
+	if err != nil {
+		t.Fatalf("expected the lapsed reservation not to count: %v", err)
+	}
+
+	reservationTTL = time.Minute
+	err = c.reserve("docs", 80, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.reserve("blog", 80, 100)
+	if err == nil {
+		t.Fatal("expected the reservation of docs to count against blog")
+	}
+	// reserving again replaces the previous reservation of the project
+	err = c.reserve("docs", 90, 100)
+	if err != nil {
+		t.Fatalf("expected docs to replace its own reservation: %v", err)
+	}
+}
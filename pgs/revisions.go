@@ -0,0 +1,68 @@
+package pgs
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+// maxCachedDeploys is how many projects deployCache holds before it drops
+// the ones that expired.
+const maxCachedDeploys = 4096
+
+type cachedDeploy struct {
+	deploy  *db.ProjectDeploy
+	err     error
+	expires time.Time
+}
+
+// deployCache remembers which revision a project serves so every request
+// does not look it up, projects without one included. A rollback shows up
+// once the revision it replaced expires.
+type deployCache struct {
+	db.DB
+	ttl     time.Duration
+	mu      sync.RWMutex
+	deploys map[string]cachedDeploy
+}
+
+func newDeployCache(dbpool db.DB, ttl time.Duration) *deployCache {
+	return &deployCache{
+		DB:      dbpool,
+		ttl:     ttl,
+		deploys: map[string]cachedDeploy{},
+	}
+}
+
+func (c *deployCache) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	key := userID + "/" + projectName
+	now := time.Now()
+
+	c.mu.RLock()
+	cached, ok := c.deploys[key]
+	c.mu.RUnlock()
+	if ok && now.Before(cached.expires) {
+		return cached.deploy, cached.err
+	}
+
+	deploy, err := c.DB.FindCurrentDeploy(userID, projectName)
+	// other errors are the database failing, the next request retries
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return deploy, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.deploys) >= maxCachedDeploys {
+		for k, v := range c.deploys {
+			if now.After(v.expires) {
+				delete(c.deploys, k)
+			}
+		}
+	}
+	c.deploys[key] = cachedDeploy{deploy: deploy, err: err, expires: now.Add(c.ttl)}
+	return deploy, err
+}
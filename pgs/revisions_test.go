@@ -0,0 +1,53 @@
+package pgs
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+type deployDB struct {
+	db.DB
+	deploys map[string]*db.ProjectDeploy
+	lookups int
+}
+
+func (d *deployDB) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	d.lookups += 1
+	deploy, ok := d.deploys[projectName]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return deploy, nil
+}
+
+func TestDeployCache(t *testing.T) {
+	dbpool := &deployDB{deploys: map[string]*db.ProjectDeploy{"blog": {Revision: 2, Current: true}}}
+	cache := newDeployCache(dbpool, time.Hour)
+
+	for range 3 {
+		deploy, err := cache.FindCurrentDeploy("1", "blog")
+		if err != nil || deploy.Revision != 2 {
+			t.Fatalf("expected revision 2, got %v (%v)", deploy, err)
+		}
+		_, err = cache.FindCurrentDeploy("1", "docs")
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected docs to have no revision, got %v", err)
+		}
+	}
+	if dbpool.lookups != 2 {
+		t.Fatalf("expected one lookup per project, found %d", dbpool.lookups)
+	}
+
+	expiring := newDeployCache(dbpool, time.Millisecond)
+	_, _ = expiring.FindCurrentDeploy("1", "blog")
+	dbpool.deploys["blog"] = &db.ProjectDeploy{Revision: 1, Current: true}
+	time.Sleep(5 * time.Millisecond)
+	deploy, _ := expiring.FindCurrentDeploy("1", "blog")
+	if deploy.Revision != 1 {
+		t.Fatalf("expected the rollback once the cache expired, got revision %d", deploy.Revision)
+	}
+}
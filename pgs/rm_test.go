@@ -0,0 +1,108 @@
+package pgs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestRm(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		project string
+		write   bool
+		linked  bool
+		err     string
+		removed bool
+	}{
+		{name: "not-found", project: "nope", write: true, err: "not found"},
+		{name: "linked", project: "proj", write: true, linked: true, err: "projects linking to it"},
+		{name: "dry-run", project: "proj", removed: false},
+		{name: "write", project: "proj", write: true, removed: true},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			st, err := storage.NewStorageFS(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket, err := st.UpsertBucket("static-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, fpath := range []string{"proj/index.html", "proj/css/main.css", "other/index.html"} {
+				_, err = st.PutObject(
+					bucket,
+					fpath,
+					utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+					&utils.FileEntry{Filepath: fpath},
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dbpool := memory.NewDB(slog.Default())
+			for _, name := range []string{"proj", "other"} {
+				_, err = dbpool.InsertProject("1", name, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if fixture.linked {
+				linkID, err := dbpool.InsertProject("1", "link", "link")
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = dbpool.LinkToProject("1", linkID, "proj", true)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sesh := &adminSession{}
+			c := &Cmd{
+				User:    &db.User{ID: "1", Name: "test"},
+				Session: sesh,
+				Log:     slog.Default(),
+				Store:   st,
+				Dbpool:  dbpool,
+				Write:   fixture.write,
+			}
+			err = c.rm(fixture.project)
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected %q, got %v", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(sesh.String(), "deleted 2 files (4)") {
+				t.Errorf("expected nested assets to be reported, got %q", sesh.String())
+			}
+
+			_, err = dbpool.FindProjectByName("1", "proj")
+			if fixture.removed == (err == nil) {
+				t.Errorf("expected project removed=%t, got %v", fixture.removed, err)
+			}
+			for _, fpath := range []string{"proj/index.html", "proj/css/main.css"} {
+				_, err := st.GetObjectSize(bucket, fpath)
+				if fixture.removed == (err == nil) {
+					t.Errorf("expected (%s) removed=%t, got %v", fpath, fixture.removed, err)
+				}
+			}
+			if _, err := st.GetObjectSize(bucket, "other/index.html"); err != nil {
+				t.Errorf("expected other projects to be kept, got %s", err)
+			}
+		})
+	}
+}
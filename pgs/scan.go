@@ -0,0 +1,109 @@
+package pgs
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db/backend"
+	uploadassets "github.com/picosh/pico/filehandlers/assets"
+	"github.com/picosh/pico/shared/scan"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// findDetections reads every record the upload scanner left in the
+// quarantine bucket since then, oldest first.
+func findDetections(st storage.StorageServe, since time.Time) ([]scan.Detection, error) {
+	bucket, err := st.GetBucket(uploadassets.QuarantineBucket)
+	if err != nil {
+		// nothing was ever flagged
+		return nil, nil
+	}
+
+	users, err := st.ListObjects(bucket, "/", false)
+	if err != nil {
+		return nil, err
+	}
+
+	detections := []scan.Detection{}
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+		entries, err := storage.WalkObjects(st, bucket, user.Name())
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Path, uploadassets.DetectionSuffix) {
+				continue
+			}
+			detection, err := readDetection(st, bucket, entry.Path)
+			if err != nil {
+				return nil, fmt.Errorf("(%s): %w", entry.Path, err)
+			}
+			if detection.CreatedAt.Before(since) {
+				continue
+			}
+			detections = append(detections, detection)
+		}
+	}
+
+	sort.Slice(detections, func(i, j int) bool {
+		return detections[i].CreatedAt.Before(detections[j].CreatedAt)
+	})
+	return detections, nil
+}
+
+func readDetection(st storage.StorageServe, bucket sst.Bucket, fpath string) (scan.Detection, error) {
+	detection := scan.Detection{}
+	contents, _, _, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		return detection, err
+	}
+	defer contents.Close()
+
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		return detection, err
+	}
+	err = json.Unmarshal(data, &detection)
+	return detection, err
+}
+
+// RunScanReport prints the uploads the scanner flagged, quarantined files
+// are kept in the quarantine bucket next to their record.
+func RunScanReport(args []string) int {
+	flags := flag.NewFlagSet("scan-report", flag.ContinueOnError)
+	since := flags.Duration("since", 7*24*time.Hour, "only list detections this recent")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := NewConfigSite()
+	logger := cfg.Logger
+	dbh := backend.NewDB(cfg.DbURL, cfg.Logger)
+	defer dbh.Close()
+
+	st, err := newStorage(cfg, dbh)
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+
+	detections, err := findDetections(st, time.Now().Add(-*since))
+	if err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	for _, detection := range detections {
+		fmt.Println(detection)
+	}
+	logger.Info("scan report", "detections", len(detections), "since", *since)
+	return 0
+}
@@ -0,0 +1,66 @@
+package pgs
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newWebServer serves handler on addr with the configured timeouts, so a
+// slow client cannot hold a connection forever. The plain listener also
+// speaks h2c when HTTP2Cleartext is set, tls negotiates http/2 itself.
+func newWebServer(cfg *shared.ConfigSite, addr string, handler http.Handler, plain bool) *http.Server {
+	if cfg.AltSvc != "" {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Alt-Svc", cfg.AltSvc)
+			next.ServeHTTP(w, r)
+		})
+	}
+	if plain && cfg.HTTP2Cleartext {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: cfg.WebIdleTimeout})
+	}
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  cfg.WebReadTimeout,
+		WriteTimeout: cfg.WebWriteTimeout,
+		IdleTimeout:  cfg.WebIdleTimeout,
+	}
+}
+
+// newUploadServer serves webdav and the upload api, a client gets
+// WebReadTimeout to send its headers and UploadReadTimeout for the whole
+// request so a slow upload cannot hold a connection forever.
+func newUploadServer(cfg *shared.ConfigSite, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           cfg.TrustedProxies.Handler(handler),
+		ReadHeaderTimeout: cfg.WebReadTimeout,
+		ReadTimeout:       cfg.UploadReadTimeout,
+		IdleTimeout:       cfg.WebIdleTimeout,
+	}
+}
+
+// shutdownWeb stops the servers from accepting connections and waits for
+// running requests, they all share one deadline and whatever is left after
+// it is closed.
+func shutdownWeb(servers []*http.Server, timeout time.Duration, logger *slog.Logger) {
+	if timeout <= 0 {
+		timeout = shared.DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			logger.Error("shutdown", "err", err.Error())
+			_ = server.Close()
+		}
+	}
+}
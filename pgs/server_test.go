@@ -0,0 +1,63 @@
+package pgs
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"golang.org/x/net/http2"
+)
+
+func TestWebServerH2C(t *testing.T) {
+	cfg := &shared.ConfigSite{
+		HTTP2Cleartext: true,
+		WebReadTimeout: time.Second,
+		WebIdleTimeout: time.Second,
+		AltSvc:         `h3=":443"; ma=86400`,
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newWebServer(cfg, ln.Addr().String(), handler, true)
+	go func() { _ = server.Serve(ln) }()
+	defer server.Close()
+
+	if server.ReadTimeout != time.Second || server.IdleTimeout != time.Second {
+		t.Error("expected the configured timeouts")
+	}
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected http/2, got (%s)", resp.Proto)
+	}
+	if resp.Header.Get("Alt-Svc") != cfg.AltSvc {
+		t.Errorf("expected http/3 to be advertised, got (%s)", resp.Header.Get("Alt-Svc"))
+	}
+
+	resp, err = http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("expected http/1.1 clients to still be served, got (%s)", resp.Proto)
+	}
+}
@@ -0,0 +1,135 @@
+package pgs
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type signingStorage struct {
+	storage.StorageServe
+	signed int
+}
+
+func (s *signingStorage) PresignGetURL(bucket sst.Bucket, fname string, ttl time.Duration) (string, error) {
+	s.signed += 1
+	return fmt.Sprintf("https://s3.example.com/%s/%s?ttl=%s", bucket.Name, fname, ttl), nil
+}
+
+func TestShareURL(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &signingStorage{StorageServe: fs}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"proj/index.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+		&utils.FileEntry{Filepath: "proj/index.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cmd{Store: st, User: &db.User{Name: "erock"}}
+	project := &db.Project{Name: "site", ProjectDir: "proj"}
+	cfg := &shared.ConfigSite{MaxShareTTL: 24 * time.Hour}
+
+	url, ttl, err := c.shareURL(bucket, project, "index.html", 48*time.Hour, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != 24*time.Hour {
+		t.Fatalf("expected ttl to be clamped to (24h), got (%s)", ttl)
+	}
+	if url != "https://s3.example.com/static-1/proj/index.html?ttl=24h0m0s" {
+		t.Fatalf("unexpected url (%s)", url)
+	}
+
+	_, _, err = c.shareURL(bucket, project, "missing.html", time.Hour, cfg)
+	if err == nil {
+		t.Fatal("expected missing file to fail")
+	}
+	if st.signed != 1 {
+		t.Fatalf("expected missing file to fail before signing, signed (%d)", st.signed)
+	}
+
+	_, err = fs.PresignGetURL(bucket, "proj/index.html", time.Hour)
+	if err != storage.ErrPresignUnsupported {
+		t.Fatalf("expected filesystem storage to refuse signing, got %v", err)
+	}
+}
+
+func TestSignedShareURL(t *testing.T) {
+	fs, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &signingStorage{StorageServe: fs}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"proj/docs/index.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+		&utils.FileEntry{Filepath: "proj/docs/index.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cmd{Store: st, User: &db.User{Name: "erock"}}
+	project := &db.Project{Name: "site", ProjectDir: "proj"}
+	cfg := &shared.ConfigSite{AccessSecret: "secret"}
+	cfg.Protocol = "https"
+	cfg.Domain = "pgs.sh"
+
+	link, _, err := c.shareURL(bucket, project, "docs/index.html", time.Hour, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.signed != 0 {
+		t.Fatal("expected the site link instead of a presigned storage url")
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "erock-site.pgs.sh" || u.Path != "/docs/index.html" {
+		t.Fatalf("unexpected link (%s)", link)
+	}
+
+	now := time.Now()
+	if !validShareURL("secret", "erock", "site", u.Path, u.Query(), now) {
+		t.Fatal("expected the link to be valid")
+	}
+	if validShareURL("secret", "erock", "site", "/other.html", u.Query(), now) {
+		t.Fatal("expected the link to only open its own file")
+	}
+	if validShareURL("other", "erock", "site", u.Path, u.Query(), now) {
+		t.Fatal("expected a different secret to reject the link")
+	}
+	if validShareURL("secret", "erock", "site", u.Path, u.Query(), now.Add(2*time.Hour)) {
+		t.Fatal("expected the link to expire")
+	}
+	query := u.Query()
+	query.Set("expires", fmt.Sprint(now.Add(48*time.Hour).Unix()))
+	if validShareURL("secret", "erock", "site", u.Path, query, now) {
+		t.Fatal("expected a longer expiry to break the signature")
+	}
+}
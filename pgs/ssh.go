@@ -3,7 +3,9 @@ package pgs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,19 +17,33 @@ import (
 	"github.com/charmbracelet/wish"
 	bm "github.com/charmbracelet/wish/bubbletea"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
+	"github.com/picosh/pico/feeds"
+	"github.com/picosh/pico/filehandlers"
 	uploadassets "github.com/picosh/pico/filehandlers/assets"
+	"github.com/picosh/pico/pastes"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/domains"
+	"github.com/picosh/pico/shared/expire"
+	"github.com/picosh/pico/shared/gc"
+	"github.com/picosh/pico/shared/listen"
+	"github.com/picosh/pico/shared/metrics"
 	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/tracing"
+	"github.com/picosh/pico/shared/trash"
+	"github.com/picosh/pico/shared/usage"
 	wsh "github.com/picosh/pico/wish"
+	"github.com/picosh/pico/wish/analytics"
+	"github.com/picosh/pico/wish/audit"
+	"github.com/picosh/pico/wish/list"
+	"github.com/picosh/pico/wish/rm"
+	"github.com/picosh/pico/wish/stats"
 	"github.com/picosh/ptun"
-	"github.com/picosh/send/list"
 	"github.com/picosh/send/pipe"
 	"github.com/picosh/send/proxy"
 	"github.com/picosh/send/send/auth"
-	wishrsync "github.com/picosh/send/send/rsync"
-	"github.com/picosh/send/send/scp"
-	"github.com/picosh/send/send/sftp"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type ctxPublicKey struct{}
@@ -51,25 +67,60 @@ func authHandler(ctx ssh.Context, key ssh.PublicKey) bool {
 func createRouter(cfg *shared.ConfigSite, handler *uploadassets.UploadAssetHandler) proxy.Router {
 	return func(sh ssh.Handler, s ssh.Session) []wish.Middleware {
 		return []wish.Middleware{
-			pipe.Middleware(handler, ""),
-			list.Middleware(handler),
-			scp.Middleware(handler),
-			wishrsync.Middleware(handler),
-			auth.Middleware(handler),
-			wsh.PtyMdw(bm.Middleware(CmsMiddleware(&cfg.ConfigCms, cfg))),
-			WishMiddleware(handler),
-			wsh.LogMiddleware(handler.GetLogger()),
+			tracing.Wrap("pipe", pipe.Middleware(handler, "")),
+			tracing.Wrap("list", list.Middleware(handler, cfg)),
+			tracing.Wrap("rm", rm.Middleware(handler)),
+			tracing.Wrap("stats", stats.Middleware(handler)),
+			tracing.Wrap("analytics", analytics.Middleware(handler.DBPool, cfg)),
+			tracing.Wrap("audit", audit.Middleware(handler.DBPool)),
+			tracing.Wrap("whoami", uploadassets.WhoamiMiddleware(handler)),
+			tracing.Wrap("doctor", uploadassets.DoctorMiddleware(handler)),
+			tracing.Wrap("publish", uploadassets.PublishMiddleware(handler)),
+			tracing.Wrap("domain", uploadassets.DomainMiddleware(handler)),
+			tracing.Wrap("env", uploadassets.EnvMiddleware(handler)),
+			tracing.Wrap("signing-key", uploadassets.SigningKeyMiddleware(handler)),
+			tracing.Wrap("logs", uploadassets.LogsMiddleware(handler)),
+			tracing.Wrap("deploy", uploadassets.DeployMiddleware(handler)),
+			tracing.Wrap("trash", uploadassets.TrashMiddleware(handler)),
+			tracing.Wrap("keys", uploadassets.KeysMiddleware(handler)),
+			tracing.Wrap("export", uploadassets.ExportMiddleware(handler)),
+			tracing.Wrap("cat", uploadassets.CatMiddleware(handler)),
+			tracing.Wrap("import", uploadassets.ImportMiddleware(handler)),
+			tracing.Wrap("tokens", uploadassets.TokensMiddleware(handler)),
+			tracing.Wrap("scp", uploadassets.ScpMiddleware(handler)),
+			tracing.Wrap("git-push", uploadassets.GitPushMiddleware(handler)),
+			tracing.Wrap("rsync", uploadassets.RsyncMiddleware(handler)),
+			tracing.Wrap("write-queue", uploadassets.WriteQueueMiddleware(handler)),
+			tracing.Wrap("atomic-deploy", uploadassets.AtomicDeployMiddleware(handler)),
+			tracing.Wrap("upload-report", uploadassets.UploadReportMiddleware(handler)),
+			tracing.Wrap("build", uploadassets.BuildMiddleware(handler)),
+			tracing.Wrap("sitemap", uploadassets.SitemapMiddleware(handler)),
+			tracing.Wrap("lint", uploadassets.LintMiddleware(handler)),
+			tracing.Wrap("webhook", uploadassets.WebhookMiddleware(handler)),
+			tracing.Wrap("purge", uploadassets.PurgeMiddleware(handler)),
+			tracing.Wrap("auth", auth.Middleware(handler)),
+			tracing.Wrap("cms", wsh.PtyMdw(bm.Middleware(CmsMiddleware(&cfg.ConfigCms, cfg, handler)))),
+			tracing.Wrap("wish", WishMiddleware(handler)),
+			tracing.Wrap("log", wsh.LogMiddleware(handler.GetLogger())),
 		}
 	}
 }
 
 func withProxy(cfg *shared.ConfigSite, handler *uploadassets.UploadAssetHandler, otherMiddleware ...wish.Middleware) ssh.Option {
 	return func(server *ssh.Server) error {
-		err := sftp.SSHOption(handler)(server)
+		err := uploadassets.SftpOption(handler)(server)
 		if err != nil {
 			return err
 		}
 
+		timeouts := wsh.NewTimeouts(cfg)
+		err = timeouts.SubsystemOption(cfg.Logger)(server)
+		if err != nil {
+			return err
+		}
+
+		// the session span is outermost so it covers every other middleware
+		otherMiddleware = append(otherMiddleware, timeouts.Middleware(cfg.Logger), tracing.Middleware(cfg.Tracer))
 		return proxy.WithProxy(createRouter(cfg, handler), otherMiddleware...)(server)
 	}
 }
@@ -177,39 +228,121 @@ func createHttpHandler(httpCtx *shared.HttpCtx) CtxHttpBridge {
 	}
 }
 
+// newStorage wraps the configured storage backend the way every part of
+// the ssh server expects it.
+func newStorage(cfg *shared.ConfigSite, dbh db.DB) (storage.StorageServe, error) {
+	st, err := storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
+	if err != nil {
+		return nil, err
+	}
+
+	st = storage.NewMetricsStorage(st)
+	if cfg.StorageMaxRetries > 0 {
+		st = storage.NewRetryStorage(st, cfg.StorageMaxRetries, cfg.StorageBaseDelay)
+	}
+	if cfg.DedupStorage {
+		st = storage.NewDedupStorage(st, dbh)
+	}
+	if cfg.BucketCacheTTL > 0 {
+		st = storage.NewCachedStorage(st, cfg.BucketCacheTTL)
+	}
+	return st, nil
+}
+
+// postWriters parse the posts of `command import` with the hooks their
+// service uses for uploads. prose depends on pgs for its images so its
+// posts have to be uploaded to prose directly.
+func postWriters(dbh db.DB, st storage.StorageServe) map[string]uploadassets.PostWriter {
+	pastesCfg := pastes.NewConfigSite()
+	feedsCfg := feeds.NewConfigSite()
+	return map[string]uploadassets.PostWriter{
+		pastesCfg.Space: filehandlers.NewScpPostHandler(dbh, pastesCfg, &pastes.FileHooks{Cfg: pastesCfg, Db: dbh}, st),
+		feedsCfg.Space:  filehandlers.NewScpPostHandler(dbh, feedsCfg, &feeds.FeedHooks{Cfg: feedsCfg, Db: dbh}, st),
+	}
+}
+
 func StartSshServer() {
 	host := shared.GetEnv("PGS_HOST", "0.0.0.0")
 	port := shared.GetEnv("PGS_SSH_PORT", "2222")
 	promPort := shared.GetEnv("PGS_PROM_PORT", "9222")
-	cfg := NewConfigSite()
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("could not load config", "err", err.Error())
+		return
+	}
 	logger := cfg.Logger
-	dbh := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	dbh := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer dbh.Close()
+	cfg.Events = bus.Open(cfg.EventBusURL, logger)
+	defer cfg.Events.Close()
+	cfg.Tracer = tracing.New(cfg.TraceEndpoint, cfg.TraceService, cfg.TraceHeaders, cfg.TraceSampleRatio, logger)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = cfg.Tracer.Shutdown(ctx)
+	}()
 
-	var st storage.StorageServe
-	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
-
+	st, err := newStorage(cfg, dbh)
 	if err != nil {
 		logger.Error(err.Error())
 		return
 	}
 
+	if cfg.ExpireInterval > 0 {
+		go expire.Run(dbh, st, cfg.ExpireInterval, logger)
+	}
+	if cfg.TrashRetention > 0 && cfg.TrashInterval > 0 {
+		go trash.Run(dbh, st, cfg.TrashInterval, logger)
+	}
+	if cfg.GCInterval > 0 {
+		go gc.Run(dbh, st, cfg.GCInterval, gc.Options{Write: cfg.GCWrite}, logger)
+	}
+	if cfg.UsageInterval > 0 {
+		go usage.Run(dbh, st, cfg.UsageInterval, logger)
+	}
+	if cfg.DomainVerifyInterval > 0 {
+		go domains.Run(dbh, cfg.Space, cfg.DomainVerifyInterval, cfg.DomainRecheckAfter, logger)
+	}
+
 	handler := uploadassets.NewUploadAssetHandler(
 		dbh,
 		cfg,
 		st,
 	)
+	handler.PostWriters = postWriters(dbh, st)
+	go reloadOnHangup(cfg, handler, logger)
+
+	if cfg.WebdavAddr != "" {
+		go func() {
+			logger.Info("starting webdav server", "addr", cfg.WebdavAddr)
+			ln, err := listen.Listen("webdav", cfg.WebdavAddr, cfg.ReusePort)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			logger.Error(newUploadServer(cfg, handler.WebdavHandler()).Serve(ln).Error())
+		}()
+	}
+	if cfg.UploadAPIAddr != "" {
+		go func() {
+			logger.Info("starting upload api server", "addr", cfg.UploadAPIAddr)
+			ln, err := listen.Listen("upload-api", cfg.UploadAPIAddr, cfg.ReusePort)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			logger.Error(newUploadServer(cfg, handler.UploadAPIHandler()).Serve(ln).Error())
+		}()
+	}
 
 	httpCtx := &shared.HttpCtx{
 		Cfg:     cfg,
 		Dbpool:  dbh,
 		Storage: st,
 	}
+	if cfg.KeepDeploys > 0 && cfg.DeployCacheTTL > 0 {
+		httpCtx.Dbpool = newDeployCache(dbh, cfg.DeployCacheTTL)
+	}
 
 	webTunnel := &ptun.WebTunnelHandler{
 		Logger:      logger,
@@ -224,7 +357,11 @@ func StartSshServer() {
 		withProxy(
 			cfg,
 			handler,
-			promwish.Middleware(fmt.Sprintf("%s:%s", host, promPort), "pgs-ssh"),
+			promwish.MiddlewareRegistry(
+				prometheus.DefaultRegisterer,
+				prometheus.Labels{"app": "pgs-ssh"},
+				promwish.DefaultCommandFn,
+			),
 		),
 	)
 	if err != nil {
@@ -232,11 +369,34 @@ func StartSshServer() {
 		return
 	}
 
+	// promwish would exit when the old process still holds the port
+	go func() {
+		promAddr := fmt.Sprintf("%s:%s", host, promPort)
+		ln, err := listen.Listen("metrics", promAddr, cfg.ReusePort)
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		logger.Info("starting metrics server", "addr", promAddr)
+		logger.Error(http.Serve(ln, mux).Error())
+	}()
+
+	ln, err := listen.Listen("ssh", fmt.Sprintf("%s:%s", host, port), cfg.ReusePort)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	if cfg.ProxyProtocol {
+		ln = cfg.TrustedProxies.ProxyListener(ln)
+	}
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	logger.Info("starting SSH server on", "host", host, "port", port)
 	go func() {
-		if err = s.ListenAndServe(); err != nil {
+		if err = s.Serve(ln); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
 			logger.Error("serve", "err", err.Error())
 			os.Exit(1)
 		}
@@ -244,9 +404,9 @@ func StartSshServer() {
 
 	<-done
 	logger.Info("stopping SSH server")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() { cancel() }()
-	if err := s.Shutdown(ctx); err != nil {
+	// uploads still running get until the timeout to finish so deploys
+	// are not left with truncated objects
+	if err := shared.Shutdown(s, cfg.ShutdownTimeout, logger, handler.Drain); err != nil {
 		logger.Error("shutdown", "err", err.Error())
 		os.Exit(1)
 	}
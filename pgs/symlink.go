@@ -0,0 +1,32 @@
+package pgs
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/picosh/pico/shared/storage"
+)
+
+// serveSymlink redirects to the file at the end of the symlink at fpath. A
+// chain of links that never ends is answered with 508 like a loop in WebDAV.
+func (h *AssetHandler) serveSymlink(w http.ResponseWriter, r *http.Request, fpath string) {
+	final, err := storage.FollowLinks(h.Storage, h.Bucket, h.ProjectDir, fpath)
+	if errors.Is(err, storage.ErrLinkLoop) {
+		h.Logger.Error("symlink loop", "bucket", h.Bucket.Name, "filename", fpath)
+		http.Error(w, "508 loop detected", http.StatusLoopDetected)
+		return
+	}
+	if err != nil {
+		h.Logger.Error("could not follow symlink", "bucket", h.Bucket.Name, "filename", fpath, "err", err.Error())
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+
+	dest := "/" + strings.TrimPrefix(final, strings.Trim(h.ProjectDir, "/")+"/")
+	if r.URL.RawQuery != "" {
+		dest += "?" + r.URL.RawQuery
+	}
+	h.Logger.Info("redirecting symlink", "bucket", h.Bucket.Name, "filename", fpath, "destination", dest)
+	http.Redirect(w, r, dest, http.StatusFound)
+}
@@ -0,0 +1,79 @@
+package pgs
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestAssetHandlerSymlink(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fpath, target := range map[string]string{
+		"test/posts/one.html": "",
+		"test/latest.html":    "posts/one.html",
+		"test/a.html":         "b.html",
+		"test/b.html":         "a.html",
+	} {
+		text := "one"
+		if target != "" {
+			text = target
+		}
+		_, err := st.PutObjectWithMeta(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(strings.NewReader(text)),
+			&utils.FileEntry{},
+			&storage.ObjectMeta{Symlink: target},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixtures := []struct {
+		name     string
+		url      string
+		status   int
+		location string
+	}{
+		{name: "file", url: "/posts/one.html", status: http.StatusOK},
+		{name: "link", url: "/latest.html?a=1", status: http.StatusFound, location: "/posts/one.html?a=1"},
+		{name: "loop", url: "/a.html", status: http.StatusLoopDetected},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", fixture.url, nil)
+			handler := &AssetHandler{
+				ProjectDir: "test",
+				Filepath:   r.URL.Path,
+				Cfg:        &shared.ConfigSite{},
+				Storage:    st,
+				Logger:     slog.Default(),
+				Bucket:     bucket,
+			}
+
+			w := httptest.NewRecorder()
+			handler.handle(w, r)
+
+			if w.Code != fixture.status {
+				t.Fatalf("expected status (%d), found (%d)", fixture.status, w.Code)
+			}
+			if w.Header().Get("location") != fixture.location {
+				t.Fatalf("expected location %q, found %q", fixture.location, w.Header().Get("location"))
+			}
+		})
+	}
+}
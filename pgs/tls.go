@@ -0,0 +1,86 @@
+package pgs
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/certs"
+	"github.com/picosh/pico/shared/crypt"
+	"github.com/picosh/pico/shared/domains"
+	"github.com/picosh/pico/shared/listen"
+	"golang.org/x/crypto/acme"
+)
+
+// startTLS serves router over https on cfg.TLSAddr, picking certificates
+// by SNI. With a CertSecret the certificates of verified project domains
+// are issued and renewed in the background, the returned handler answers
+// their http-01 challenges and should be served on the plain listener. The
+// returned server is for shutting it down.
+func startTLS(cfg *shared.ConfigSite, dbpool db.DB, router http.Handler) (http.Handler, *http.Server, error) {
+	logger := cfg.Logger
+	store := certs.NewStore(dbpool, nil, logger)
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		store.Default = &cert
+	}
+
+	if cfg.CertSecret != "" {
+		box, err := crypt.NewBox(cfg.CertSecret)
+		if err != nil {
+			return nil, nil, err
+		}
+		store.Box = box
+
+		key, err := certs.LoadAccountKey(cfg.ACMEAccountKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		var dns certs.DNSProvider
+		if cfg.ACMEChallenge == certs.ChallengeDNS {
+			dns, err = certs.NewDNSProvider(cfg.ACMEDNSProvider, cfg.ACMEDNSURL, cfg.ACMEDNSZone, cfg.ACMEDNSToken)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		manager, err := certs.NewManager(
+			&acme.Client{Key: key, DirectoryURL: cfg.ACMEDirectory},
+			store,
+			cfg.Email,
+			cfg.ACMEChallenge,
+			dns,
+			cfg.CertRenewBefore,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		manager.Verify = func(domain *db.ProjectDomain) bool {
+			return domains.Recheck(dbpool, cfg.Space, domain, logger)
+		}
+		router = manager.HTTPHandler(router)
+		go manager.Run(cfg.CertRenewInterval, logger)
+	}
+
+	server := newWebServer(cfg, cfg.TLSAddr, router, false)
+	server.TLSConfig = &tls.Config{
+		GetCertificate: store.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	ln, err := listen.Listen("https", cfg.TLSAddr, cfg.ReusePort)
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		logger.Info("Starting tls server", "addr", cfg.TLSAddr)
+		err := server.ServeTLS(ln, "", "")
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(err.Error())
+		}
+	}()
+	return router, server, nil
+}
@@ -0,0 +1,64 @@
+package pgs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestVerifyObjects(t *testing.T) {
+	dir := t.TempDir()
+	st, err := storage.NewStorageFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fpath := range []string{"blog/index.html", "blog/css/main.css"} {
+		text := []byte("<h1>" + fpath + "</h1>")
+		_, err = st.PutObjectWithMeta(
+			bucket,
+			fpath,
+			utils.NopReaderAtCloser(bytes.NewReader(text)),
+			&utils.FileEntry{Filepath: fpath},
+			&storage.ObjectMeta{Checksum: shared.Shasum(text)},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = st.PutObject(
+		bucket,
+		"blog/legacy.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("old"))),
+		&utils.FileEntry{Filepath: "blog/legacy.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip the contents behind the storage's back
+	err = os.WriteFile(filepath.Join(bucket.Path, "blog/css/main.css"), []byte("body {}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cmd{Store: st}
+	corrupt, unverified, total, err := c.verifyObjects(bucket, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || unverified != 1 {
+		t.Fatalf("expected (3) files with (1) unverified, got (%d) and (%d)", total, unverified)
+	}
+	if len(corrupt) != 1 || corrupt[0].path != "blog/css/main.css" || corrupt[0].actual != shared.Shasum([]byte("body {}")) {
+		t.Fatalf("expected main.css to be corrupt, got %+v", corrupt)
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"flag"
 	"fmt"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/picosh/pico/db"
 	uploadassets "github.com/picosh/pico/filehandlers/assets"
+	futil "github.com/picosh/pico/filehandlers/util"
 	"github.com/picosh/pico/shared"
 	"github.com/picosh/pico/wish/cms/ui/common"
 	"github.com/picosh/send/send/utils"
@@ -32,6 +35,10 @@ func getUser(s ssh.Session, dbpool db.DB) (*db.User, error) {
 		return nil, fmt.Errorf("must have username set")
 	}
 
+	if user.IsSuspended() {
+		return nil, db.ErrUserSuspended
+	}
+
 	return user, nil
 }
 
@@ -53,6 +60,17 @@ func flagSet(cmdName string, sesh ssh.Session) (*flag.FlagSet, *bool) {
 	return cmd, write
 }
 
+// hasWriteFlag is true when a command was asked to apply its changes.
+func hasWriteFlag(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-write", "--write", "-write=true", "--write=true":
+			return true
+		}
+	}
+	return false
+}
+
 func flagCheck(cmd *flag.FlagSet, posArg string, cmdArgs []string) bool {
 	_ = cmd.Parse(cmdArgs)
 
@@ -77,6 +95,12 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 				return
 			}
 
+			err := handler.CheckRateLimit(sesh)
+			if err != nil {
+				utils.ErrorHandler(sesh, err)
+				return
+			}
+
 			user, err := getUser(sesh, dbpool)
 			if err != nil {
 				utils.ErrorHandler(sesh, err)
@@ -84,6 +108,11 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 			}
 
 			args := sesh.Command()
+			// read-only accounts can still look at their projects
+			if user.IsReadOnly() && hasWriteFlag(args) {
+				utils.ErrorHandler(sesh, db.ErrUserReadOnly)
+				return
+			}
 
 			renderer := lipgloss.NewRenderer(sesh)
 			// this might be dangerous but going with it for now
@@ -91,28 +120,96 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 			styles := common.DefaultStyles(renderer)
 
 			opts := Cmd{
-				Session: sesh,
-				User:    user,
-				Store:   store,
-				Log:     log,
-				Dbpool:  dbpool,
-				Write:   false,
-				Styles:  styles,
+				Session:    sesh,
+				User:       user,
+				Store:      store,
+				Log:        shared.SessionLogger(sesh.Context(), log).With("user", user.Name),
+				Dbpool:     dbpool,
+				Write:      false,
+				Styles:     styles,
+				Sessions:   handler.Sessions,
+				Events:     handler.Events,
+				SessionID:  sesh.Context().SessionID(),
+				RemoteAddr: sesh.RemoteAddr(),
+				Space:      cfg.Space,
 			}
 
 			cmd := strings.TrimSpace(args[0])
+			// operators act as themselves, never as an org
+			if cmd == "admin" {
+				err := opts.admin(args[1:])
+				opts.bail(err)
+				return
+			}
+
+			// org members work on the projects of the org they logged in
+			// as, `org` manages the memberships of the user themselves
+			if cmd != "org" {
+				org, member, err := uploadassets.OrgUser(sesh, dbpool, user)
+				if err != nil {
+					utils.ErrorHandler(sesh, err)
+					return
+				}
+				if member != nil && !member.CanDeploy() && hasWriteFlag(args) {
+					utils.ErrorHandler(sesh, fmt.Errorf("role (%s) cannot change the projects of (%s)", member.Role, org.Name))
+					return
+				}
+				if org.IsReadOnly() && hasWriteFlag(args) {
+					utils.ErrorHandler(sesh, fmt.Errorf("(%s): %w", org.Name, db.ErrUserReadOnly))
+					return
+				}
+				if member != nil {
+					opts.Log = opts.Log.With("org", org.Name)
+				}
+				user = org
+				opts.User = org
+				opts.Actor = futil.GetActor(sesh)
+			}
+
+			if cmd == "df" {
+				dfCmd := flag.NewFlagSet("df", flag.ContinueOnError)
+				dfCmd.SetOutput(sesh)
+				byProject := dfCmd.Bool("projects", false, "break usage down by project")
+				if err := dfCmd.Parse(args[1:]); err != nil {
+					return
+				}
+
+				err := opts.df(shared.GetQuotaForUser(dbpool, cfg, user.ID), *byProject)
+				opts.bail(err)
+				return
+			}
+
+			if cmd == "prune" && (len(args) == 1 || strings.HasPrefix(args[1], "-")) {
+				pruneCmd, write := flagSet("prune", sesh)
+				days := pruneCmd.Int("days", 0, "remove projects not updated in this many days")
+				empty := pruneCmd.Bool("empty", false, "remove projects without any files")
+				if err := pruneCmd.Parse(args[1:]); err != nil {
+					return
+				}
+				opts.Write = *write
+
+				err := opts.pruneStale(*days, *empty)
+				opts.notice()
+				opts.bail(err)
+				return
+			}
+
 			if len(args) == 1 {
 				if cmd == "help" {
 					opts.help()
 					return
 				} else if cmd == "stats" {
-					err := opts.stats(cfg.MaxSize)
+					err := opts.stats(shared.GetQuotaForUser(dbpool, cfg, user.ID))
 					opts.bail(err)
 					return
 				} else if cmd == "ls" {
 					err := opts.ls()
 					opts.bail(err)
 					return
+				} else if cmd == "projects" {
+					err := opts.projects()
+					opts.bail(err)
+					return
 				} else {
 					next(sesh)
 					return
@@ -166,6 +263,10 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 				err := opts.depends(projectName)
 				opts.bail(err)
 				return
+			} else if cmd == "verify" {
+				err := opts.verify(projectName)
+				opts.bail(err)
+				return
 			} else if cmd == "retain" {
 				retainCmd, write := flagSet("retain", sesh)
 				retainNum := retainCmd.Int("n", 3, "latest number of projects to keep")
@@ -189,8 +290,8 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 				opts.notice()
 				opts.bail(err)
 				return
-			} else if cmd == "rm" {
-				rmCmd, write := flagSet("rm", sesh)
+			} else if cmd == "rm" || cmd == "rm-project" {
+				rmCmd, write := flagSet(cmd, sesh)
 				if !flagCheck(rmCmd, projectName, cmdArgs) {
 					return
 				}
@@ -200,9 +301,38 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 				opts.notice()
 				opts.bail(err)
 				return
+			} else if cmd == "org" {
+				orgCmd, write := flagSet("org", sesh)
+				create := orgCmd.Bool("create", false, "create the organization with you as its owner")
+				add := orgCmd.String("add", "", "user to add or change the role of")
+				role := orgCmd.String("role", db.RoleDeployer, "role of the added user: owner, deployer, viewer")
+				remove := orgCmd.String("remove", "", "user to remove")
+				if !flagCheck(orgCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				err := opts.org(projectName, *create, *add, *role, *remove)
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "acl" && projectName == "set" && len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+				// acl set my-project --password --user friend
+				projectName = strings.TrimSpace(cmdArgs[0])
+				aclCmd, write := flagSet("acl", sesh)
+				password := aclCmd.Bool("password", false, "generate a password anyone can sign in with")
+				var users arrayFlags
+				aclCmd.Var(&users, "user", "pico user who signs in with an api token, can be repeated")
+				if !flagCheck(aclCmd, projectName, cmdArgs[1:]) {
+					return
+				}
+				opts.Write = *write
+
+				err := opts.aclSet(projectName, *password, users)
+				opts.notice()
+				opts.bail(err)
 			} else if cmd == "acl" {
 				aclCmd, write := flagSet("acl", sesh)
-				aclType := aclCmd.String("type", "", "access type: public, pico, pubkeys")
+				aclType := aclCmd.String("type", "", "access type: public, pico, pubkeys, see `acl set` for private")
 				var acls arrayFlags
 				aclCmd.Var(
 					&acls,
@@ -226,6 +356,166 @@ func WishMiddleware(handler *uploadassets.UploadAssetHandler) wish.Middleware {
 				err := opts.acl(projectName, *aclType, acls)
 				opts.notice()
 				opts.bail(err)
+			} else if cmd == "csp" {
+				// policy is positional and comes before any flags
+				policy := ""
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					policy = cmdArgs[0]
+					cmdArgs = cmdArgs[1:]
+				}
+				cspCmd, write := flagSet("csp", sesh)
+				reportOnly := cspCmd.Bool("report-only", false, "send policy as content-security-policy-report-only")
+				reportURI := cspCmd.String("report-uri", "", "endpoint where browsers report csp violations")
+				if !flagCheck(cspCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				err := opts.csp(projectName, db.ProjectCsp{
+					Policy:     strings.TrimSpace(policy),
+					ReportOnly: *reportOnly,
+					ReportURI:  *reportURI,
+				})
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "mv" {
+				// new name is positional and comes before any flags
+				newName := ""
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					newName = strings.TrimSpace(cmdArgs[0])
+					cmdArgs = cmdArgs[1:]
+				}
+				mvCmd, write := flagSet("mv", sesh)
+				if !flagCheck(mvCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				// paths rename a file within a project, names rename the project
+				var err error
+				if strings.Contains(projectName, "/") || strings.Contains(newName, "/") {
+					err = opts.mvFile(projectName, newName)
+				} else {
+					err = opts.mv(projectName, newName)
+				}
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "cp" {
+				// destination is positional and comes before any flags
+				dst := ""
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					dst = strings.TrimSpace(cmdArgs[0])
+					cmdArgs = cmdArgs[1:]
+				}
+				cpCmd, write := flagSet("cp", sesh)
+				if !flagCheck(cpCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				err := opts.cp(projectName, dst, shared.GetQuotaForUser(dbpool, cfg, user.ID))
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "reserve" {
+				// size is positional and comes before any flags
+				sizeStr := ""
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					sizeStr = cmdArgs[0]
+					cmdArgs = cmdArgs[1:]
+				}
+				reserveCmd, write := flagSet("reserve", sesh)
+				if !flagCheck(reserveCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				size, err := strconv.ParseUint(sizeStr, 10, 64)
+				if err != nil {
+					opts.bail(fmt.Errorf("must provide size in bytes, found (%s)", sizeStr))
+					return
+				}
+
+				err = opts.reserve(projectName, size, shared.GetQuotaForUser(dbpool, cfg, user.ID))
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "set-ttl" {
+				// duration is positional and comes before any flags
+				ttlStr := ""
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					ttlStr = strings.TrimSpace(cmdArgs[0])
+					cmdArgs = cmdArgs[1:]
+				}
+				ttlCmd, write := flagSet("set-ttl", sesh)
+				if !flagCheck(ttlCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				ttl := time.Duration(0)
+				if ttlStr != "none" && ttlStr != "0" {
+					var err error
+					ttl, err = time.ParseDuration(ttlStr)
+					if err != nil || ttl < 0 {
+						opts.bail(fmt.Errorf("must provide a duration like `24h` or `none`, found (%s)", ttlStr))
+						return
+					}
+				}
+
+				err := opts.setTTL(projectName, ttl)
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "sitemap" {
+				// on or off is positional and comes before any flags
+				toggle := ""
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					toggle = strings.TrimSpace(cmdArgs[0])
+					cmdArgs = cmdArgs[1:]
+				}
+				sitemapCmd, write := flagSet("sitemap", sesh)
+				if !flagCheck(sitemapCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				if toggle != "on" && toggle != "off" {
+					opts.bail(fmt.Errorf("must provide `on` or `off`, found (%s)", toggle))
+					return
+				}
+
+				err := opts.sitemap(projectName, toggle == "on")
+				opts.notice()
+				opts.bail(err)
+			} else if cmd == "share" {
+				// ttl is positional or `--ttl`, optional
+				ttl := cfg.DefaultShareTTL
+				if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+					ttl, err = time.ParseDuration(strings.TrimSpace(cmdArgs[0]))
+					if err != nil {
+						opts.bail(fmt.Errorf("must provide a duration like `1h`, found (%s)", cmdArgs[0]))
+						return
+					}
+					cmdArgs = cmdArgs[1:]
+				}
+				shareCmd := flag.NewFlagSet("share", flag.ContinueOnError)
+				shareCmd.SetOutput(sesh)
+				shareCmd.DurationVar(&ttl, "ttl", ttl, "how long the link works, e.g. 24h")
+				if !flagCheck(shareCmd, projectName, cmdArgs) {
+					return
+				}
+
+				err := opts.share(projectName, ttl, cfg)
+				opts.bail(err)
+			} else if cmd == "suspend" || cmd == "unsuspend" {
+				// the second arg is a username, not a project
+				suspendCmd, write := flagSet(cmd, sesh)
+				if !flagCheck(suspendCmd, projectName, cmdArgs) {
+					return
+				}
+				opts.Write = *write
+
+				err := opts.suspend(projectName, cmd == "suspend")
+				opts.notice()
+				opts.bail(err)
 			} else {
 				next(sesh)
 				return
@@ -2,8 +2,10 @@ package prose
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,10 +17,15 @@ import (
 
 	"github.com/gorilla/feeds"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
+	"github.com/picosh/pico/filehandlers"
 	"github.com/picosh/pico/imgs"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/analytics"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/social"
 	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/wish/search"
 )
 
 type PageData struct {
@@ -80,9 +87,12 @@ type PostPageData struct {
 	Tags         []string
 	Image        template.URL
 	ImageCard    string
+	ImageWidth   int
+	ImageHeight  int
 	Footer       template.HTML
 	Favicon      template.URL
 	Unlisted     bool
+	CanonicalURL template.URL
 }
 
 type TransparencyPageData struct {
@@ -128,7 +138,7 @@ func blogStyleHandler(w http.ResponseWriter, r *http.Request) {
 	logger := shared.GetLogger(r)
 	cfg := shared.GetCfg(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -150,13 +160,65 @@ func blogStyleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type SearchResultData struct {
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	PublishAt time.Time `json:"publish_at"`
+	Snippet   string    `json:"snippet"`
+}
+
+// searchHandler answers `_search?q=` with the blog posts matching the query
+// as json.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	username := shared.GetUsernameFromRequest(r)
+	dbpool := shared.GetDB(r)
+	logger := shared.GetLogger(r)
+	cfg := shared.GetCfg(r)
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	user, err := shared.FindPublicUser(dbpool, username)
+	if err != nil {
+		logger.Info("blog not found", "user", username)
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	}
+
+	results, err := dbpool.SearchPostsForUser(user.ID, cfg.Space, query, search.MaxResults)
+	if err != nil {
+		logger.Error(err.Error())
+		http.Error(w, "could not search posts", http.StatusInternalServerError)
+		return
+	}
+
+	curl := shared.CreateURLFromRequest(cfg, r)
+	data := []SearchResultData{}
+	for _, result := range results {
+		data = append(data, SearchResultData{
+			Title:     result.Title,
+			URL:       cfg.FullPostURL(curl, user.Name, result.Slug),
+			PublishAt: *result.PublishAt,
+			Snippet:   search.Snippet(result.Snippet),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(data)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
 func blogHandler(w http.ResponseWriter, r *http.Request) {
 	username := shared.GetUsernameFromRequest(r)
 	dbpool := shared.GetDB(r)
 	logger := shared.GetLogger(r)
 	cfg := shared.GetCfg(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -297,7 +359,7 @@ func postRawHandler(w http.ResponseWriter, r *http.Request) {
 	dbpool := shared.GetDB(r)
 	logger := shared.GetLogger(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -336,7 +398,7 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 	dbpool := shared.GetDB(r)
 	logger := shared.GetLogger(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("blog not found", "user", username)
 		http.Error(w, "blog not found", http.StatusNotFound)
@@ -349,6 +411,8 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 	favicon := ""
 	ogImage := ""
 	ogImageCard := ""
+	ogImageWidth := 0
+	ogImageHeight := 0
 	hasCSS := false
 	var data PostPageData
 
@@ -393,6 +457,11 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 
 		if parsedText.Image != "" {
 			ogImage = parsedText.Image
+		} else if hasSocialImage(r, user, post.Slug) {
+			ogImage = cfg.SocialImageURL(curl, username, post.Slug)
+			ogImageCard = "summary_large_image"
+			ogImageWidth = social.Width
+			ogImageHeight = social.Height
 		}
 
 		if parsedText.ImageCard != "" {
@@ -405,6 +474,7 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				logger.Error(err.Error())
 			}
+			shared.GetAnalytics(r).Hit(r, user.ID, cfg.Space, post.Slug)
 		}
 
 		unlisted := false
@@ -412,10 +482,16 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 			unlisted = true
 		}
 
+		postURL := cfg.FullPostURL(curl, post.Username, post.Slug)
+		canonicalURL := post.Data.CanonicalURL
+		if canonicalURL == "" {
+			canonicalURL = postURL
+		}
+
 		data = PostPageData{
 			Site:         *cfg.GetSiteData(),
 			PageTitle:    GetPostTitle(post),
-			URL:          template.URL(cfg.FullPostURL(curl, post.Username, post.Slug)),
+			URL:          template.URL(postURL),
 			BlogURL:      template.URL(cfg.FullBlogURL(curl, username)),
 			Description:  post.Description,
 			Title:        shared.FilenameToTitle(post.Filename, post.Title),
@@ -430,9 +506,12 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 			Tags:         parsedText.Tags,
 			Image:        template.URL(ogImage),
 			ImageCard:    ogImageCard,
+			ImageWidth:   ogImageWidth,
+			ImageHeight:  ogImageHeight,
 			Favicon:      template.URL(favicon),
 			Footer:       footerHTML,
 			Unlisted:     unlisted,
+			CanonicalURL: template.URL(canonicalURL),
 		}
 	} else {
 		// TODO: HACK to support imgs slugs inside prose
@@ -502,6 +581,66 @@ func postHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// hasSocialImage is whether a preview image was drawn for the post when it
+// was published.
+func hasSocialImage(r *http.Request, user *db.User, slug string) bool {
+	cfg := shared.GetCfg(r)
+	if !cfg.SocialImages {
+		return false
+	}
+	st := shared.GetStorage(r)
+	bucket, err := st.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err != nil {
+		return false
+	}
+	_, err = st.GetObjectSize(bucket, social.Path(cfg.Space, slug))
+	return err == nil
+}
+
+func socialImageHandler(w http.ResponseWriter, r *http.Request) {
+	username := shared.GetUsernameFromRequest(r)
+	subdomain := shared.GetSubdomain(r)
+	cfg := shared.GetCfg(r)
+	dbpool := shared.GetDB(r)
+	st := shared.GetStorage(r)
+	logger := shared.GetLogger(r)
+
+	var slug string
+	if !cfg.IsSubdomains() || subdomain == "" {
+		slug, _ = url.PathUnescape(shared.GetField(r, 1))
+	} else {
+		slug, _ = url.PathUnescape(shared.GetField(r, 0))
+	}
+
+	user, err := shared.FindPublicUser(dbpool, username)
+	if err != nil {
+		logger.Info("blog not found", "user", username)
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	}
+
+	bucket, err := st.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err != nil {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	contents, size, modTime, err := st.GetObject(bucket, social.Path(cfg.Space, slug))
+	if err != nil {
+		logger.Info("social image not found", "user", username, "slug", slug)
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	defer contents.Close()
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	_, err = io.Copy(w, contents)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
 func readHandler(w http.ResponseWriter, r *http.Request) {
 	dbpool := shared.GetDB(r)
 	logger := shared.GetLogger(r)
@@ -590,7 +729,7 @@ func rssBlogHandler(w http.ResponseWriter, r *http.Request) {
 	logger := shared.GetLogger(r)
 	cfg := shared.GetCfg(r)
 
-	user, err := dbpool.FindUserForName(username)
+	user, err := shared.FindPublicUser(dbpool, username)
 	if err != nil {
 		logger.Info("rss feed not found", "user", username)
 		http.Error(w, "rss feed not found", http.StatusNotFound)
@@ -845,6 +984,8 @@ func createMainRoutes(staticRoutes []shared.Route) []shared.Route {
 		shared.NewRoute("GET", "/rss.xml", rssHandler),
 		shared.NewRoute("GET", "/atom.xml", rssHandler),
 		shared.NewRoute("GET", "/feed.xml", rssHandler),
+		shared.NewRoute("GET", "/_analytics", shared.AnalyticsHandler),
+		shared.NewRoute("GET", "/_analytics/(.+)", shared.AnalyticsHandler),
 
 		shared.NewRoute("GET", "/([^/]+)", blogHandler),
 		shared.NewRoute("GET", "/([^/]+)/rss", rssBlogHandler),
@@ -854,7 +995,9 @@ func createMainRoutes(staticRoutes []shared.Route) []shared.Route {
 		shared.NewRoute("GET", "/([^/]+)/blog/index.xml", rssBlogHandler),
 		shared.NewRoute("GET", "/([^/]+)/feed.xml", rssBlogHandler),
 		shared.NewRoute("GET", "/([^/]+)/_styles.css", blogStyleHandler),
+		shared.NewRoute("GET", "/([^/]+)/_search", searchHandler),
 		shared.NewRoute("GET", "/raw/([^/]+)/(.+)", postRawHandler),
+		shared.NewRoute("GET", "/([^/]+)/_social/(.+)\\.png$", socialImageHandler),
 		shared.NewRoute("GET", "/([^/]+)/(.+)/(.+)", imgs.ImgRequest),
 		shared.NewRoute("GET", "/([^/]+)/(.+).(?:jpg|jpeg|png|gif|webp|svg)$", imgs.ImgRequest),
 		shared.NewRoute("GET", "/([^/]+)/i", imgs.ImgsListHandler),
@@ -868,6 +1011,7 @@ func createSubdomainRoutes(staticRoutes []shared.Route) []shared.Route {
 	routes := []shared.Route{
 		shared.NewRoute("GET", "/", blogHandler),
 		shared.NewRoute("GET", "/_styles.css", blogStyleHandler),
+		shared.NewRoute("GET", "/_search", searchHandler),
 		shared.NewRoute("GET", "/rss", rssBlogHandler),
 		shared.NewRoute("GET", "/rss.xml", rssBlogHandler),
 		shared.NewRoute("GET", "/atom.xml", rssBlogHandler),
@@ -884,6 +1028,7 @@ func createSubdomainRoutes(staticRoutes []shared.Route) []shared.Route {
 	routes = append(
 		routes,
 		shared.NewRoute("GET", "/raw/(.+)", postRawHandler),
+		shared.NewRoute("GET", "/_social/(.+)\\.png$", socialImageHandler),
 		shared.NewRoute("GET", "/([^/]+)/(.+)", imgs.ImgRequest),
 		shared.NewRoute("GET", "/(.+).(?:jpg|jpeg|png|gif|webp|svg)$", imgs.ImgRequest),
 		shared.NewRoute("GET", "/i", imgs.ImgsListHandler),
@@ -895,17 +1040,13 @@ func createSubdomainRoutes(staticRoutes []shared.Route) []shared.Route {
 
 func StartApiServer() {
 	cfg := NewConfigSite()
-	db := postgres.NewDB(cfg.ConfigCms.DbURL, cfg.Logger)
+	db := backend.NewDB(cfg.ConfigCms.DbURL, cfg.Logger)
 	defer db.Close()
 	logger := cfg.Logger
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
@@ -920,10 +1061,22 @@ func StartApiServer() {
 	mainRoutes := createMainRoutes(staticRoutes)
 	subdomainRoutes := createSubdomainRoutes(staticRoutes)
 
+	if cfg.InboundEmailSecret != "" {
+		cfg.Events = bus.Open(cfg.EventBusURL, logger)
+		defer cfg.Events.Close()
+		hooks := &MarkdownHooks{Cfg: cfg, Db: db, Storage: st}
+		fileMap := map[string]filehandlers.ReadWriteHandler{
+			".md": filehandlers.NewScpPostHandler(db, cfg, hooks, st),
+		}
+		posts := filehandlers.NewFileHandlerRouter(cfg, db, fileMap)
+		mainRoutes = append(mainRoutes, shared.NewRoute("POST", "/_inbound/email", posts.InboundEmailHandler(".md")))
+	}
+
 	httpCtx := &shared.HttpCtx{
-		Cfg:     cfg,
-		Dbpool:  db,
-		Storage: st,
+		Cfg:       cfg,
+		Dbpool:    db,
+		Storage:   st,
+		Analytics: analytics.Start(db, logger, cfg.AnalyticsInterval),
 	}
 	handler := shared.CreateServe(mainRoutes, subdomainRoutes, httpCtx)
 	router := http.HandlerFunc(handler)
@@ -1,7 +1,12 @@
 package prose
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/clientip"
+	"github.com/picosh/pico/shared/storage"
 	"github.com/picosh/pico/wish/cms/config"
 )
 
@@ -15,11 +20,24 @@ func NewConfigSite() *shared.ConfigSite {
 	protocol := shared.GetEnv("PROSE_PROTOCOL", "https")
 	allowRegister := shared.GetEnv("PROSE_ALLOW_REGISTER", "1")
 	storageDir := shared.GetEnv("IMGS_STORAGE_DIR", ".storage")
+	storageBackend := shared.GetEnv("STORAGE_BACKEND", "")
 	minioURL := shared.GetEnv("MINIO_URL", "")
 	minioUser := shared.GetEnv("MINIO_ROOT_USER", "")
 	minioPass := shared.GetEnv("MINIO_ROOT_PASSWORD", "")
 	dbURL := shared.GetEnv("DATABASE_URL", "")
+	trustedProxies := shared.GetEnv("TRUSTED_PROXIES", clientip.PrivateRanges)
+	sessionIdleTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_IDLE_TIMEOUT", "15m"))
+	sessionMaxTimeout, _ := time.ParseDuration(shared.GetEnv("SSH_MAX_TIMEOUT", "6h"))
+	sessionKeepAlive, _ := time.ParseDuration(shared.GetEnv("SSH_KEEPALIVE_INTERVAL", "30s"))
 	useImgProxy := shared.GetEnv("USE_IMGPROXY", "1")
+	imgVariants, _ := storage.ParseImgVariants(shared.GetEnv("IMGS_VARIANTS", "t=200x200,m=x500"))
+	imgVariantWorkers, _ := strconv.Atoi(shared.GetEnv("IMGS_VARIANT_WORKERS", "2"))
+	publishInterval, _ := time.ParseDuration(shared.GetEnv("PROSE_PUBLISH_INTERVAL", "1m"))
+	socialImages := shared.GetEnv("PROSE_SOCIAL_IMAGES", "1")
+	analyticsInterval, _ := time.ParseDuration(shared.GetEnv("PROSE_ANALYTICS_INTERVAL", "1m"))
+	inboundEmailSecret := shared.GetEnv("PROSE_INBOUND_EMAIL_SECRET", "")
+	inboundEmailAuthservID := shared.GetEnv("PROSE_INBOUND_EMAIL_AUTHSERV_ID", "")
+	eventBusURL := shared.GetEnv("EVENT_BUS_URL", "")
 	maxSize := uint64(500 * shared.MB)
 	maxImgSize := int64(10 * shared.MB)
 
@@ -27,23 +45,36 @@ func NewConfigSite() *shared.ConfigSite {
 	intro += "To learn next steps go to our docs at https://pico.sh/prose\n"
 
 	return &shared.ConfigSite{
-		Debug:                debug == "1",
-		SubdomainsEnabled:    subdomains == "1",
-		CustomdomainsEnabled: customdomains == "1",
-		UseImgProxy:          useImgProxy == "1",
+		Debug:                  debug == "1",
+		TrustedProxies:         clientip.ParseTrusted(shared.SplitList(trustedProxies)),
+		SessionIdleTimeout:     sessionIdleTimeout,
+		SessionMaxTimeout:      sessionMaxTimeout,
+		SessionKeepAlive:       sessionKeepAlive,
+		SubdomainsEnabled:      subdomains == "1",
+		CustomdomainsEnabled:   customdomains == "1",
+		UseImgProxy:            useImgProxy == "1",
+		ImgVariants:            imgVariants,
+		ImgVariantWorkers:      imgVariantWorkers,
+		PublishInterval:        publishInterval,
+		SocialImages:           socialImages == "1",
+		InboundEmailSecret:     inboundEmailSecret,
+		InboundEmailAuthservID: inboundEmailAuthservID,
+		EventBusURL:            eventBusURL,
+		AnalyticsInterval:      analyticsInterval,
 		ConfigCms: config.ConfigCms{
-			Domain:      domain,
-			Email:       email,
-			Port:        port,
-			Protocol:    protocol,
-			DbURL:       dbURL,
-			StorageDir:  storageDir,
-			MinioURL:    minioURL,
-			MinioUser:   minioUser,
-			MinioPass:   minioPass,
-			Description: "A blog platform for hackers.",
-			IntroText:   intro,
-			Space:       "prose",
+			Domain:         domain,
+			Email:          email,
+			Port:           port,
+			Protocol:       protocol,
+			DbURL:          dbURL,
+			StorageDir:     storageDir,
+			StorageBackend: storageBackend,
+			MinioURL:       minioURL,
+			MinioUser:      minioUser,
+			MinioPass:      minioPass,
+			Description:    "A blog platform for hackers.",
+			IntroText:      intro,
+			Space:          "prose",
 			AllowedExt: []string{
 				".md",
 				".jpg",
@@ -54,7 +85,7 @@ func NewConfigSite() *shared.ConfigSite {
 				".svg",
 			},
 			HiddenPosts:   []string{"_readme.md", "_styles.css", "_footer.md", "_404.md"},
-			Logger:        shared.CreateLogger(debug == "1"),
+			Logger:        shared.CreateLogger("prose", debug == "1"),
 			AllowRegister: allowRegister == "1",
 			MaxSize:       maxSize,
 			MaxAssetSize:  maxImgSize,
@@ -1,8 +1,11 @@
 package prose
 
 import (
+	"bytes"
 	"fmt"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"slices"
 
@@ -10,11 +13,15 @@ import (
 	"github.com/picosh/pico/db"
 	"github.com/picosh/pico/filehandlers"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/social"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
 )
 
 type MarkdownHooks struct {
-	Cfg *shared.ConfigSite
-	Db  db.DB
+	Cfg     *shared.ConfigSite
+	Db      db.DB
+	Storage storage.StorageServe
 }
 
 func (p *MarkdownHooks) FileValidate(s ssh.Session, data *filehandlers.PostMetaData) (bool, error) {
@@ -58,6 +65,20 @@ func (p *MarkdownHooks) FileMeta(s ssh.Session, data *filehandlers.PostMetaData)
 		data.Title = parsedText.Title
 	}
 
+	if parsedText.Slug != "" && parsedText.Slug != data.Slug {
+		other, err := p.Db.FindPostWithSlug(parsedText.Slug, data.User.ID, p.Cfg.Space)
+		if err == nil && other.Filename != data.Filename {
+			return fmt.Errorf(
+				"%s: slug (%s) is already used by (%s)",
+				data.Filename,
+				parsedText.Slug,
+				other.Filename,
+			)
+		}
+		data.Slug = parsedText.Slug
+	}
+	data.Data.CanonicalURL = parsedText.CanonicalURL
+
 	data.Aliases = parsedText.Aliases
 	data.Tags = parsedText.Tags
 	data.Description = parsedText.Description
@@ -69,5 +90,56 @@ func (p *MarkdownHooks) FileMeta(s ssh.Session, data *filehandlers.PostMetaData)
 	isHiddenFilename := slices.Contains(p.Cfg.HiddenPosts, data.Filename)
 	data.Hidden = parsedText.MetaData.Hidden || isHiddenFilename
 
+	if !isHiddenFilename {
+		p.socialImage(s, data)
+	}
+
 	return nil
 }
+
+// socialImage draws the preview image of the post into the user's asset
+// bucket, a post without text has its image removed. Failing to do either
+// never stops the post from being published.
+func (p *MarkdownHooks) socialImage(s ssh.Session, data *filehandlers.PostMetaData) {
+	if !p.Cfg.SocialImages || p.Storage == nil || filepath.Ext(data.Filename) != ".md" {
+		return
+	}
+	logger := p.Cfg.Logger.With("user", data.User.Name, "filename", data.Filename)
+
+	bucket, err := p.Storage.UpsertBucket(shared.GetAssetBucketName(data.User.ID))
+	if err != nil {
+		logger.Error("could not find bucket for social image", "err", err.Error())
+		return
+	}
+
+	// the image of a renamed post would never be served again
+	if data.Cur != nil && (data.Cur.Slug != data.Slug || len(data.Text) == 0) {
+		err := p.Storage.DeleteObject(bucket, social.Path(p.Cfg.Space, data.Cur.Slug))
+		if err != nil {
+			logger.Info("could not remove social image", "slug", data.Cur.Slug, "err", err.Error())
+		}
+	}
+	if len(data.Text) == 0 {
+		return
+	}
+
+	img, err := social.Render(social.Card{
+		Title:  data.Title,
+		Author: data.User.Name,
+		Domain: p.Cfg.Domain,
+	})
+	if err != nil {
+		logger.Error("could not render social image", "err", err.Error())
+		return
+	}
+	fpath := social.Path(p.Cfg.Space, data.Slug)
+	_, err = p.Storage.PutObject(
+		bucket,
+		fpath,
+		utils.NopReaderAtCloser(bytes.NewReader(img)),
+		&utils.FileEntry{Filepath: fpath, Size: int64(len(img)), Mtime: time.Now().Unix()},
+	)
+	if err != nil {
+		logger.Error("could not store social image", "err", err.Error())
+	}
+}
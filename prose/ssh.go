@@ -1,25 +1,29 @@
 package prose
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/charmbracelet/promwish"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	bm "github.com/charmbracelet/wish/bubbletea"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/filehandlers"
 	uploadimgs "github.com/picosh/pico/filehandlers/imgs"
 	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/publish"
 	"github.com/picosh/pico/shared/storage"
 	wsh "github.com/picosh/pico/wish"
+	"github.com/picosh/pico/wish/analytics"
+	"github.com/picosh/pico/wish/audit"
 	"github.com/picosh/pico/wish/cms"
-	"github.com/picosh/send/list"
+	"github.com/picosh/pico/wish/email"
+	"github.com/picosh/pico/wish/list"
+	"github.com/picosh/pico/wish/search"
 	"github.com/picosh/send/pipe"
 	"github.com/picosh/send/proxy"
 	"github.com/picosh/send/send/auth"
@@ -38,7 +42,11 @@ func createRouter(handler *filehandlers.FileHandlerRouter) proxy.Router {
 	return func(sh ssh.Handler, s ssh.Session) []wish.Middleware {
 		return []wish.Middleware{
 			pipe.Middleware(handler, ".md"),
-			list.Middleware(handler),
+			list.Middleware(handler, handler.Cfg),
+			search.Middleware(handler.DBPool, handler.Cfg),
+			analytics.Middleware(handler.DBPool, handler.Cfg),
+			audit.Middleware(handler.DBPool),
+			email.Middleware(handler.DBPool, handler.Cfg),
 			scp.Middleware(handler),
 			wishrsync.Middleware(handler),
 			auth.Middleware(handler),
@@ -55,6 +63,13 @@ func withProxy(handler *filehandlers.FileHandlerRouter, otherMiddleware ...wish.
 			return err
 		}
 
+		timeouts := wsh.NewTimeouts(handler.Cfg)
+		err = timeouts.SubsystemOption(handler.GetLogger())(server)
+		if err != nil {
+			return err
+		}
+
+		otherMiddleware = append(otherMiddleware, timeouts.Middleware(handler.GetLogger()))
 		return proxy.WithProxy(createRouter(handler), otherMiddleware...)(server)
 	}
 }
@@ -65,30 +80,35 @@ func StartSshServer() {
 	promPort := shared.GetEnv("PROSE_PROM_PORT", "9222")
 	cfg := NewConfigSite()
 	logger := cfg.Logger
-	dbh := postgres.NewDB(cfg.DbURL, cfg.Logger)
+	dbh := backend.NewDB(cfg.DbURL, cfg.Logger)
 	defer dbh.Close()
-	hooks := &MarkdownHooks{
-		Cfg: cfg,
-		Db:  dbh,
+	cfg.Events = bus.Open(cfg.EventBusURL, logger)
+	defer cfg.Events.Close()
+
+	if cfg.PublishInterval > 0 {
+		go publish.Run(dbh, cfg.PublishInterval, logger)
 	}
 
 	var st storage.StorageServe
 	var err error
-	if cfg.MinioURL == "" {
-		st, err = storage.NewStorageFS(cfg.StorageDir)
-	} else {
-		st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-	}
+	st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 	if err != nil {
 		logger.Error(err.Error())
 		return
 	}
 
+	hooks := &MarkdownHooks{
+		Cfg:     cfg,
+		Db:      dbh,
+		Storage: st,
+	}
+
+	imgHandler := uploadimgs.NewUploadImgHandler(dbh, cfg, st)
 	fileMap := map[string]filehandlers.ReadWriteHandler{
 		".md":      filehandlers.NewScpPostHandler(dbh, cfg, hooks, st),
 		".css":     filehandlers.NewScpPostHandler(dbh, cfg, hooks, st),
-		"fallback": uploadimgs.NewUploadImgHandler(dbh, cfg, st),
+		"fallback": imgHandler,
 	}
 	handler := filehandlers.NewFileHandlerRouter(cfg, dbh, fileMap)
 	handler.Spaces = []string{cfg.Space, "imgs"}
@@ -119,9 +139,7 @@ func StartSshServer() {
 
 	<-done
 	logger.Info("Stopping SSH server")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() { cancel() }()
-	if err := s.Shutdown(ctx); err != nil {
+	if err := shared.Shutdown(s, cfg.ShutdownTimeout, logger, handler.Drain, imgHandler.Drain); err != nil {
 		logger.Error(err.Error())
 	}
 }
@@ -0,0 +1,92 @@
+package activity
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/webhooks"
+)
+
+// FeedSize is how many events a deploy feed lists.
+var FeedSize = 50
+
+// Record stores that user changed projectName, the file count is the one
+// the project has right now.
+func Record(dbpool db.DB, user *db.User, event, projectName string) error {
+	fileCount := 0
+	if event != webhooks.ProjectDelete {
+		count, err := dbpool.FindProjectObjectCount(user.ID, projectName)
+		if err == nil && count != nil {
+			fileCount = *count
+		}
+	}
+	return dbpool.InsertProjectEvent(&db.ProjectEvent{
+		UserID:      user.ID,
+		ProjectName: projectName,
+		Event:       event,
+		FileCount:   fileCount,
+	})
+}
+
+// Subscribe records the project events published on b, each one once
+// among the recorders on the bus.
+func Subscribe(b bus.Bus, dbpool db.DB, logger *slog.Logger) {
+	for _, topic := range []string{webhooks.ProjectCreate, webhooks.ProjectUpdate, webhooks.ProjectDelete} {
+		b.Subscribe(topic, "activity", func(ev *bus.Event) {
+			err := Record(dbpool, &db.User{ID: ev.UserID, Name: ev.User}, ev.Topic, ev.Project)
+			if err != nil {
+				logger.Error("could not record project event", "project", ev.Project, "err", err.Error())
+			}
+		})
+	}
+}
+
+func title(event *db.ProjectEvent) string {
+	files := "files"
+	if event.FileCount == 1 {
+		files = "file"
+	}
+	switch event.Event {
+	case webhooks.ProjectCreate:
+		return fmt.Sprintf("%s created with %d %s", event.ProjectName, event.FileCount, files)
+	case webhooks.ProjectDelete:
+		return fmt.Sprintf("%s deleted", event.ProjectName)
+	}
+	return fmt.Sprintf("%s updated with %d %s", event.ProjectName, event.FileCount, files)
+}
+
+// Feed lists the project events of username, projectURL links to a
+// project.
+func Feed(username, link string, events []*db.ProjectEvent, projectURL func(projectName string) string) *feeds.Feed {
+	feed := &feeds.Feed{
+		Title:       fmt.Sprintf("%s deploys", username),
+		Link:        &feeds.Link{Href: link},
+		Description: fmt.Sprintf("every time a project of %s changes", username),
+		Author:      &feeds.Author{Name: username},
+		Created:     time.Now(),
+	}
+	for _, event := range events {
+		href := projectURL(event.ProjectName)
+		created := time.Now()
+		if event.CreatedAt != nil {
+			created = *event.CreatedAt
+		}
+		feed.Items = append(feed.Items, &feeds.Item{
+			Id:      fmt.Sprintf("%s#%s", href, event.ID),
+			Title:   title(event),
+			Link:    &feeds.Link{Href: href},
+			Content: fmt.Sprintf(`%s at <a href="%s">%s</a>`, event.Event, href, href),
+			Created: created,
+			Updated: created,
+			Author:  &feeds.Author{Name: username},
+		})
+	}
+	if len(feed.Items) > 0 {
+		feed.Updated = feed.Items[0].Created
+	}
+	return feed
+}
@@ -0,0 +1,43 @@
+package activity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/webhooks"
+)
+
+func TestFeed(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	events := []*db.ProjectEvent{
+		{ID: "3", ProjectName: "docs", Event: webhooks.ProjectDelete, CreatedAt: &created},
+		{ID: "2", ProjectName: "blog", Event: webhooks.ProjectUpdate, FileCount: 1, CreatedAt: &created},
+		{ID: "1", ProjectName: "blog", Event: webhooks.ProjectCreate, FileCount: 12, CreatedAt: &created},
+	}
+	feed := Feed("erock", "https://pgs.sh", events, func(projectName string) string {
+		return "https://erock-" + projectName + ".pgs.sh"
+	})
+
+	titles := []string{}
+	ids := []string{}
+	for _, item := range feed.Items {
+		titles = append(titles, item.Title)
+		ids = append(ids, item.Id)
+	}
+	expected := []string{"docs deleted", "blog updated with 1 file", "blog created with 12 files"}
+	if diff := cmp.Diff(expected, titles); diff != "" {
+		t.Error(diff)
+	}
+	if ids[1] != "https://erock-blog.pgs.sh#2" {
+		t.Errorf("unexpected id (%s)", ids[1])
+	}
+	if !feed.Updated.Equal(created) {
+		t.Errorf("expected the feed to be updated at the newest event, got (%s)", feed.Updated)
+	}
+	_, err := feed.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,216 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+// maxVisitors caps how many visitors are told apart per day, once it is
+// reached new visitors still count as hits but not as uniques.
+var maxVisitors = 1_000_000
+
+var bots = []string{"bot", "crawler", "spider", "slurp", "curl", "wget"}
+
+type target struct {
+	userID string
+	space  string
+	name   string
+	day    time.Time
+}
+
+type counts struct {
+	hits    int
+	uniques int
+}
+
+// Recorder counts hits and unique visitors per day in memory and adds them
+// to the database on Flush. Visitors are told apart by a hash of their
+// address and user agent salted with a random value that is replaced every
+// day and never stored, so no address is kept and a visitor can't be
+// followed from one day to the next.
+type Recorder struct {
+	dbpool  db.DB
+	logger  *slog.Logger
+	mu      sync.Mutex
+	day     time.Time
+	salt    []byte
+	seen    map[[sha256.Size]byte]struct{}
+	pending map[target]*counts
+	now     func() time.Time
+}
+
+func NewRecorder(dbpool db.DB, logger *slog.Logger) *Recorder {
+	return &Recorder{
+		dbpool:  dbpool,
+		logger:  logger,
+		pending: map[target]*counts{},
+		now:     time.Now,
+	}
+}
+
+// Start returns a recorder that flushes every interval, or nil when interval
+// is 0 which turns analytics off.
+func Start(dbpool db.DB, logger *slog.Logger, interval time.Duration) *Recorder {
+	if interval <= 0 {
+		return nil
+	}
+	rec := NewRecorder(dbpool, logger)
+	go rec.Run(interval)
+	return rec
+}
+
+// clientAddr is the host of RemoteAddr, the router already replaced it
+// with the client of a request forwarded by a trusted proxy.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isBot(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return true
+	}
+	for _, bot := range bots {
+		if strings.Contains(ua, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hit counts a request for name, a project or a post of the user. Only
+// GET requests of what looks like a browser are counted.
+func (rec *Recorder) Hit(r *http.Request, userID, space, name string) {
+	if rec == nil || r.Method != http.MethodGet || isBot(r.UserAgent()) {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	day := rec.now().UTC().Truncate(24 * time.Hour)
+	if !day.Equal(rec.day) {
+		rec.day = day
+		rec.salt = make([]byte, 32)
+		_, _ = rand.Read(rec.salt)
+		rec.seen = map[[sha256.Size]byte]struct{}{}
+	}
+
+	key := target{userID: userID, space: space, name: name, day: day}
+	cur, ok := rec.pending[key]
+	if !ok {
+		cur = &counts{}
+		rec.pending[key] = cur
+	}
+	cur.hits += 1
+
+	h := sha256.New()
+	h.Write(rec.salt)
+	for _, part := range []string{userID, space, name, clientAddr(r), r.UserAgent()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	var visitor [sha256.Size]byte
+	copy(visitor[:], h.Sum(nil))
+	if _, seen := rec.seen[visitor]; !seen && len(rec.seen) < maxVisitors {
+		rec.seen[visitor] = struct{}{}
+		cur.uniques += 1
+	}
+}
+
+// Flush adds the counts since the last flush to the database, the ones
+// that could not be stored are kept for the next try.
+func (rec *Recorder) Flush() error {
+	rec.mu.Lock()
+	pending := rec.pending
+	rec.pending = map[target]*counts{}
+	rec.mu.Unlock()
+
+	var errs []error
+	for key, cur := range pending {
+		err := rec.dbpool.AddAnalytics(&db.AnalyticsDay{
+			UserID:  key.userID,
+			Space:   key.space,
+			Name:    key.name,
+			Day:     key.day,
+			Hits:    cur.hits,
+			Uniques: cur.uniques,
+		})
+		if err == nil {
+			continue
+		}
+		errs = append(errs, err)
+		rec.mu.Lock()
+		if next, ok := rec.pending[key]; ok {
+			next.hits += cur.hits
+			next.uniques += cur.uniques
+		} else {
+			rec.pending[key] = cur
+		}
+		rec.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Run flushes the counts every interval, it never returns.
+func (rec *Recorder) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := rec.Flush()
+		if err != nil {
+			rec.logger.Error("could not store analytics", "err", err.Error())
+		}
+	}
+}
+
+// Total is what a project or post added up to over a number of days, a
+// visitor that came back on another day counts as unique again.
+type Total struct {
+	Name    string `json:"name"`
+	Hits    int    `json:"hits"`
+	Uniques int    `json:"uniques"`
+}
+
+// Totals adds up days per name, the most visited first.
+func Totals(days []*db.AnalyticsDay) []Total {
+	byName := map[string]*Total{}
+	totals := []*Total{}
+	for _, day := range days {
+		total, ok := byName[day.Name]
+		if !ok {
+			total = &Total{Name: day.Name}
+			byName[day.Name] = total
+			totals = append(totals, total)
+		}
+		total.Hits += day.Hits
+		total.Uniques += day.Uniques
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		if totals[i].Hits != totals[j].Hits {
+			return totals[i].Hits > totals[j].Hits
+		}
+		return totals[i].Name < totals[j].Name
+	})
+
+	out := []Total{}
+	for _, total := range totals {
+		out = append(out, *total)
+	}
+	return out
+}
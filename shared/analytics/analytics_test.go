@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+type analyticsDB struct {
+	db.DB
+	days []*db.AnalyticsDay
+}
+
+func (a *analyticsDB) AddAnalytics(day *db.AnalyticsDay) error {
+	a.days = append(a.days, day)
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	dbpool := &analyticsDB{}
+	rec := NewRecorder(dbpool, nil)
+	now := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	rec.now = func() time.Time { return now }
+
+	hit := func(addr, userAgent, name string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr + ":1234"
+		r.Header.Set("User-Agent", userAgent)
+		rec.Hit(r, "1", "pgs", name)
+	}
+	hit("10.0.0.1", "firefox", "blog")
+	hit("10.0.0.1", "firefox", "blog")
+	hit("10.0.0.2", "firefox", "blog")
+	hit("10.0.0.1", "firefox", "docs")
+	hit("10.0.0.3", "Googlebot/2.1", "blog")
+	now = now.Add(time.Hour)
+	hit("10.0.0.1", "firefox", "blog")
+
+	err := rec.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := map[string]Total{}
+	for _, day := range dbpool.days {
+		key := day.Name + " " + day.Day.Format(time.DateOnly)
+		totals[key] = Total{Name: day.Name, Hits: day.Hits, Uniques: day.Uniques}
+	}
+	expected := map[string]Total{
+		"blog 2024-03-01": {Name: "blog", Hits: 3, Uniques: 2},
+		"docs 2024-03-01": {Name: "docs", Hits: 1, Uniques: 1},
+		"blog 2024-03-02": {Name: "blog", Hits: 1, Uniques: 1},
+	}
+	if diff := cmp.Diff(expected, totals); diff != "" {
+		t.Error(diff)
+	}
+
+	dbpool.days = nil
+	err = rec.Flush()
+	if err != nil || len(dbpool.days) != 0 {
+		t.Errorf("expected nothing left to flush, got %v %v", dbpool.days, err)
+	}
+}
@@ -1,13 +1,32 @@
 package shared
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/analytics"
 )
 
+// FindPublicUser finds the user whose content is served under name, the
+// content of a suspended user is not served at all.
+func FindPublicUser(dbpool db.DB, name string) (*db.User, error) {
+	user, err := dbpool.FindUserForName(name)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsSuspended() {
+		return nil, db.ErrUserSuspended
+	}
+	return user, nil
+}
+
 func CheckHandler(w http.ResponseWriter, r *http.Request) {
 	dbpool := GetDB(r)
 	cfg := GetCfg(r)
@@ -19,7 +38,7 @@ func CheckHandler(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(hostDomain, appDomain) {
 			subdomain := GetCustomDomain(hostDomain, cfg.Space)
 			if subdomain != "" {
-				u, err := dbpool.FindUserForName(subdomain)
+				u, err := FindPublicUser(dbpool, subdomain)
 				if u != nil && err == nil {
 					w.WriteHeader(http.StatusOK)
 					return
@@ -118,3 +137,58 @@ func CreatePageHandler(fname string) http.HandlerFunc {
 		}
 	}
 }
+
+// AnalyticsDays is how far back analytics go unless `days` asks otherwise.
+var AnalyticsDays = 30
+
+type AnalyticsData struct {
+	Since  time.Time          `json:"since"`
+	Totals []analytics.Total  `json:"totals"`
+	Days   []*db.AnalyticsDay `json:"days"`
+}
+
+// AnalyticsHandler answers with the analytics of the user the bearer token
+// belongs to, the first route field narrows them down to one project or
+// post.
+func AnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	dbpool := GetDB(r)
+	logger := GetLogger(r)
+	cfg := GetCfg(r)
+
+	token, ok := strings.CutPrefix(r.Header.Get("authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "missing credentials", http.StatusUnauthorized)
+		return
+	}
+	user, err := dbpool.FindUserForToken(token)
+	if err != nil {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	days := AnalyticsDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err = strconv.Atoi(raw)
+		if err != nil || days < 1 || days > 366 {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+	}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	found, err := dbpool.FindAnalytics(user.ID, cfg.Space, GetField(r, 0), since)
+	if err != nil {
+		logger.Error(err.Error())
+		http.Error(w, "could not find analytics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(AnalyticsData{
+		Since:  since,
+		Totals: analytics.Totals(found),
+		Days:   found,
+	})
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"log/slog"
+	"net"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/clientip"
+)
+
+// actions recorded in the audit log
+const (
+	ActionWrite         = "write"
+	ActionDelete        = "delete"
+	ActionRestore       = "restore"
+	ActionProjectCreate = "project.create"
+	ActionProjectUpdate = "project.update"
+	ActionProjectDelete = "project.delete"
+	ActionKeyAdd        = "key.add"
+	ActionKeyRemove     = "key.remove"
+	// signing keys are recorded against the project they belong to
+	ActionSigningKeySet    = "signing_key.set"
+	ActionSigningKeyRemove = "signing_key.remove"
+)
+
+// MaxEntries is how many entries `audit` lists at most.
+var MaxEntries = 500
+
+// NewEntry is a change to the account user made by actor from remote, a
+// nil actor is the user themselves.
+func NewEntry(user, actor *db.User, space, sessionID string, remote net.Addr, action, path string) *db.AuditEntry {
+	if actor == nil {
+		actor = user
+	}
+	remoteAddr := ""
+	if addr := clientip.FromAddr(remote); addr.IsValid() {
+		remoteAddr = addr.String()
+	}
+	return &db.AuditEntry{
+		UserID:     user.ID,
+		ActorID:    actor.ID,
+		Actor:      actor.Name,
+		Space:      space,
+		Action:     action,
+		SessionID:  sessionID,
+		Path:       path,
+		RemoteAddr: remoteAddr,
+	}
+}
+
+// Record appends entry to the audit log. A failure is only logged so it
+// never undoes or blocks the change it describes.
+func Record(dbpool db.DB, logger *slog.Logger, entry *db.AuditEntry) {
+	err := dbpool.InsertAuditEntry(entry)
+	if err != nil {
+		logger.Error(
+			"could not record audit entry",
+			"action", entry.Action,
+			"path", entry.Path,
+			"err", err.Error(),
+		)
+	}
+}
@@ -0,0 +1,285 @@
+package authn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	ProviderDB        = "db"
+	ProviderAllowlist = "allowlist"
+	ProviderHTTP      = "http"
+	ProviderCommand   = "command"
+)
+
+// ErrUnknownKey is returned by a provider that does not know the key, the
+// next one in the chain gets to try.
+var ErrUnknownKey = errors.New("key not found")
+
+// how long an http registry or a command gets to answer.
+var lookupTimeout = 10 * time.Second
+
+// Authenticator resolves the user behind the public key of an ssh session,
+// key is in `type base64` form and username is what the client logged in
+// as.
+type Authenticator interface {
+	Authenticate(username, key string) (*db.User, error)
+}
+
+// DBKeys is the default, it looks the key up in the keys users registered.
+type DBKeys struct {
+	DB db.DB
+}
+
+func (d *DBKeys) Authenticate(username, key string) (*db.User, error) {
+	return d.DB.FindUserForKey(username, key)
+}
+
+// sameKey compares keys by their wire format so comments and whitespace
+// do not matter.
+func sameKey(a, b gossh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+// Allowlist maps keys to users with a file of `username key` lines, like
+// an authorized_keys file with the user in front. The file is read again
+// when it changes, the users still have to exist.
+type Allowlist struct {
+	Path string
+	DB   db.DB
+
+	mu      sync.Mutex
+	modTime time.Time
+	entries []allowEntry
+}
+
+type allowEntry struct {
+	username string
+	key      gossh.PublicKey
+}
+
+func (a *Allowlist) load() ([]allowEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if info.ModTime().Equal(a.modTime) {
+		return a.entries, nil
+	}
+
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []allowEntry{}
+	scanner := bufio.NewScanner(file)
+	for num := 1; scanner.Scan(); num += 1 {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, rest, _ := strings.Cut(line, " ")
+		key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", a.Path, num, err)
+		}
+		entries = append(entries, allowEntry{username: username, key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	a.entries = entries
+	a.modTime = info.ModTime()
+	return entries, nil
+}
+
+func (a *Allowlist) Authenticate(username, key string) (*db.User, error) {
+	pk, _, _, _, err := gossh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []string{}
+	for _, entry := range entries {
+		if sameKey(entry.key, pk) {
+			found = append(found, entry.username)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return nil, ErrUnknownKey
+	case len(found) > 1:
+		// the key is shared, the login name picks the user
+		for _, name := range found {
+			if name == username {
+				return a.DB.FindUserForName(name)
+			}
+		}
+		return nil, &db.ErrMultiplePublicKeys{}
+	}
+	return a.DB.FindUserForName(found[0])
+}
+
+// HTTPRegistry asks a key registry, like one backed by an OIDC provider,
+// who a key belongs to: `GET URL?user=name&key=key` answers 200 with
+// `{"username": "..."}` or 404 for keys it does not know.
+type HTTPRegistry struct {
+	URL    string
+	Token  string
+	DB     db.DB
+	Client *http.Client
+}
+
+func (h *HTTPRegistry) Authenticate(username, key string) (*db.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	query := url.Values{"user": {username}, "key": {key}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrUnknownKey
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key registry responded with (%d)", resp.StatusCode)
+	}
+
+	body := struct {
+		Username string `json:"username"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+	if body.Username == "" {
+		return nil, ErrUnknownKey
+	}
+	return h.DB.FindUserForName(body.Username)
+}
+
+// Command runs an operator's program, for example one that searches LDAP,
+// with the login name in AUTH_USERNAME and the key on stdin. It prints the
+// username the key belongs to, or nothing for keys it does not know. The
+// login name is chosen by the client so it is never passed as an argument
+// the program could mistake for a flag.
+type Command struct {
+	Args []string
+	DB   db.DB
+}
+
+func (c *Command) Authenticate(username, key string) (*db.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Env = append(os.Environ(), "AUTH_USERNAME="+username)
+	cmd.Stdin = strings.NewReader(key + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("auth command failed: %w", err)
+	}
+	name := strings.TrimSpace(string(out))
+	if name == "" {
+		return nil, ErrUnknownKey
+	}
+	return c.DB.FindUserForName(name)
+}
+
+// Chain asks each authenticator in turn until one knows the key.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(username, key string) (*db.User, error) {
+	var first error
+	for _, auth := range c {
+		user, err := auth.Authenticate(username, key)
+		if err == nil {
+			return user, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first == nil {
+		first = ErrUnknownKey
+	}
+	return nil, first
+}
+
+// New builds the chain of the named providers, in order.
+func New(names []string, dbpool db.DB, allowlist, registry, token, command string) (Authenticator, error) {
+	chain := Chain{}
+	for _, name := range names {
+		switch name {
+		case ProviderDB:
+			chain = append(chain, &DBKeys{DB: dbpool})
+		case ProviderAllowlist:
+			if allowlist == "" {
+				return nil, fmt.Errorf("auth provider (%s) requires a file", name)
+			}
+			chain = append(chain, &Allowlist{Path: allowlist, DB: dbpool})
+		case ProviderHTTP:
+			if registry == "" {
+				return nil, fmt.Errorf("auth provider (%s) requires a url", name)
+			}
+			chain = append(chain, &HTTPRegistry{URL: registry, Token: token, DB: dbpool, Client: &http.Client{}})
+		case ProviderCommand:
+			args := strings.Fields(command)
+			if len(args) == 0 {
+				return nil, fmt.Errorf("auth provider (%s) requires a command", name)
+			}
+			chain = append(chain, &Command{Args: args, DB: dbpool})
+		default:
+			return nil, fmt.Errorf(
+				"unknown auth provider (%s), expected %s, %s, %s or %s",
+				name, ProviderDB, ProviderAllowlist, ProviderHTTP, ProviderCommand,
+			)
+		}
+	}
+	if len(chain) == 0 {
+		return &DBKeys{DB: dbpool}, nil
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+// FromConfig builds the providers a service's config picked, only the key
+// lookup when it picked none.
+func FromConfig(cfg *shared.ConfigSite, dbpool db.DB) (Authenticator, error) {
+	return New(cfg.AuthProviders, dbpool, cfg.AuthAllowlist, cfg.AuthURL, cfg.AuthToken, cfg.AuthCommand)
+}
@@ -0,0 +1,205 @@
+package authn
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type fakeDB struct {
+	db.DB
+	users map[string]*db.User
+	keys  map[string]string
+}
+
+func (f *fakeDB) FindUserForName(name string) (*db.User, error) {
+	user, ok := f.users[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (f *fakeDB) FindUserForKey(username, key string) (*db.User, error) {
+	name, ok := f.keys[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return f.users[name], nil
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := shared.KeyForKeyText(pk)
+	return text
+}
+
+func newDB() *fakeDB {
+	return &fakeDB{
+		users: map[string]*db.User{"alice": {ID: "1", Name: "alice"}, "bob": {ID: "2", Name: "bob"}},
+		keys:  map[string]string{},
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	dbpool := newDB()
+	alice, common, unknown := newKey(t), newKey(t), newKey(t)
+	fpath := filepath.Join(t.TempDir(), "allowlist")
+	text := fmt.Sprintf("# team\nalice %s laptop\nalice %s\nbob %s\n", alice, common, common)
+	err := os.WriteFile(fpath, []byte(text), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &Allowlist{Path: fpath, DB: dbpool}
+
+	user, err := auth.Authenticate("", alice)
+	if err != nil || user.Name != "alice" {
+		t.Fatalf("expected alice, got %v %v", user, err)
+	}
+	_, err = auth.Authenticate("", unknown)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected an unknown key, got %v", err)
+	}
+	user, err = auth.Authenticate("bob", common)
+	if err != nil || user.Name != "bob" {
+		t.Errorf("expected the login name to pick the user of a shared key, got %v %v", user, err)
+	}
+	_, err = auth.Authenticate("carol", common)
+	if !errors.Is(err, &db.ErrMultiplePublicKeys{}) {
+		t.Errorf("expected a shared key to need a login name, got %v", err)
+	}
+
+	err = os.WriteFile(fpath, []byte("bob "+unknown+"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(fpath, future, future)
+	user, err = auth.Authenticate("", unknown)
+	if err != nil || user.Name != "bob" {
+		t.Errorf("expected the changed file to be read again, got %v %v", user, err)
+	}
+}
+
+func TestHTTPRegistry(t *testing.T) {
+	dbpool := newDB()
+	alice := newKey(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("key") != alice {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"username": "alice"}`))
+	}))
+	defer srv.Close()
+
+	auth := &HTTPRegistry{URL: srv.URL, Token: "token", DB: dbpool, Client: srv.Client()}
+	user, err := auth.Authenticate("", alice)
+	if err != nil || user.Name != "alice" {
+		t.Fatalf("expected alice, got %v %v", user, err)
+	}
+	_, err = auth.Authenticate("", newKey(t))
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected an unknown key, got %v", err)
+	}
+	auth.Token = "wrong"
+	_, err = auth.Authenticate("", alice)
+	if err == nil || errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected a failing registry to be an error, got %v", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	dbpool := newDB()
+	alice := newKey(t)
+	script := filepath.Join(t.TempDir(), "lookup.sh")
+	text := fmt.Sprintf("#!/bin/sh\n[ $# -eq 0 ] || exit 1\nread key\nif [ \"$key\" = \"%s\" ]; then echo \"$AUTH_USERNAME\"; fi\n", alice)
+	err := os.WriteFile(script, []byte(text), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &Command{Args: []string{script}, DB: dbpool}
+	user, err := auth.Authenticate("bob", alice)
+	if err != nil || user.Name != "bob" {
+		t.Fatalf("expected the command to pick bob, got %v %v", user, err)
+	}
+	dbpool.users["--help"] = &db.User{ID: "3", Name: "--help"}
+	user, err = auth.Authenticate("--help", alice)
+	if err != nil || user.Name != "--help" {
+		t.Fatalf("expected the login name to stay out of the arguments, got %v %v", user, err)
+	}
+	_, err = auth.Authenticate("bob", newKey(t))
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected an unknown key, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	dbpool := newDB()
+	alice, bob := newKey(t), newKey(t)
+	dbpool.keys[alice] = "alice"
+	fpath := filepath.Join(t.TempDir(), "allowlist")
+	err := os.WriteFile(fpath, []byte("bob "+bob+"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := New(nil, dbpool, "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auth.(*DBKeys); !ok {
+		t.Errorf("expected only the key lookup by default, got %T", auth)
+	}
+
+	auth, err = New([]string{ProviderDB, ProviderAllowlist}, dbpool, fpath, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, name := range map[string]string{alice: "alice", bob: "bob"} {
+		user, err := auth.Authenticate("", key)
+		if err != nil || user.Name != name {
+			t.Errorf("expected (%s), got %v %v", name, user, err)
+		}
+	}
+	_, err = auth.Authenticate("", newKey(t))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the first provider's error, got %v", err)
+	}
+
+	for _, names := range [][]string{{"ldap"}, {ProviderAllowlist}, {ProviderHTTP}, {ProviderCommand}} {
+		_, err := New(names, dbpool, "", "", "", "")
+		if err == nil {
+			t.Errorf("expected (%v) to fail without its settings", names)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package bandwidth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+type target struct {
+	userID string
+	space  string
+	name   string
+	month  time.Time
+}
+
+type account struct {
+	userID string
+	space  string
+}
+
+// Meter adds up the bytes served per project in memory and adds them to
+// the database on Flush. It also keeps what each user served this month so
+// caps are checked without a query per request, those totals are read
+// again after every flush to pick up what other servers stored.
+type Meter struct {
+	dbpool  db.DB
+	logger  *slog.Logger
+	mu      sync.Mutex
+	month   time.Time
+	used    map[account]int64
+	pending map[target]int64
+	now     func() time.Time
+}
+
+func NewMeter(dbpool db.DB, logger *slog.Logger) *Meter {
+	return &Meter{
+		dbpool:  dbpool,
+		logger:  logger,
+		used:    map[account]int64{},
+		pending: map[target]int64{},
+		now:     time.Now,
+	}
+}
+
+// Start returns a meter that flushes every interval, or nil when interval
+// is 0 which turns bandwidth accounting off.
+func Start(dbpool db.DB, logger *slog.Logger, interval time.Duration) *Meter {
+	if interval <= 0 {
+		return nil
+	}
+	meter := NewMeter(dbpool, logger)
+	go meter.Run(interval)
+	return meter
+}
+
+// MonthOf returns the first day of the calendar month of t in UTC.
+func MonthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// rollover forgets the totals of the last month, callers hold the lock.
+func (m *Meter) rollover() time.Time {
+	month := MonthOf(m.now())
+	if !month.Equal(m.month) {
+		m.month = month
+		m.used = map[account]int64{}
+	}
+	return month
+}
+
+// Count adds bytes served for name, a project of the user.
+func (m *Meter) Count(userID, space, name string, bytes int64) {
+	if m == nil || bytes <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	month := m.rollover()
+	m.pending[target{userID: userID, space: space, name: name, month: month}] += bytes
+	acct := account{userID: userID, space: space}
+	if _, ok := m.used[acct]; ok {
+		m.used[acct] += bytes
+	}
+}
+
+// Used returns the bytes the user served this month, stored or not.
+func (m *Meter) Used(userID, space string) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+	acct := account{userID: userID, space: space}
+
+	m.mu.Lock()
+	month := m.rollover()
+	used, ok := m.used[acct]
+	m.mu.Unlock()
+	if ok {
+		return used, nil
+	}
+
+	months, err := m.dbpool.FindBandwidth(userID, space, month)
+	if err != nil {
+		return 0, err
+	}
+	stored := int64(0)
+	for _, cur := range months {
+		stored += cur.Bytes
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if used, ok := m.used[acct]; ok {
+		return used, nil
+	}
+	for key, bytes := range m.pending {
+		if key.userID == userID && key.space == space && key.month.Equal(month) {
+			stored += bytes
+		}
+	}
+	m.used[acct] = stored
+	return stored, nil
+}
+
+// Over reports whether the user served limit bytes or more this month, a
+// limit of 0 is unlimited. When the usage cannot be read the request is let
+// through rather than taking every site of the user down.
+func (m *Meter) Over(userID, space string, limit uint64) bool {
+	if m == nil || limit == 0 {
+		return false
+	}
+	used, err := m.Used(userID, space)
+	if err != nil {
+		m.logger.Error("could not find bandwidth", "err", err.Error())
+		return false
+	}
+	return uint64(used) >= limit
+}
+
+// Flush adds the bytes since the last flush to the database, the ones that
+// could not be stored are kept for the next try.
+func (m *Meter) Flush() error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = map[target]int64{}
+	m.mu.Unlock()
+
+	var errs []error
+	for key, bytes := range pending {
+		err := m.dbpool.AddBandwidth(&db.BandwidthMonth{
+			UserID: key.userID,
+			Space:  key.space,
+			Name:   key.name,
+			Month:  key.month,
+			Bytes:  bytes,
+		})
+		if err == nil {
+			continue
+		}
+		errs = append(errs, err)
+		m.mu.Lock()
+		m.pending[key] += bytes
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	m.used = map[account]int64{}
+	m.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Run flushes the bytes every interval, it never returns.
+func (m *Meter) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := m.Flush()
+		if err != nil {
+			m.logger.Error("could not store bandwidth", "err", err.Error())
+		}
+	}
+}
+
+// Writer counts the bytes of a response body.
+type Writer struct {
+	http.ResponseWriter
+	Bytes int64
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
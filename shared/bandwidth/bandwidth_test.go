@@ -0,0 +1,105 @@
+package bandwidth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+type bandwidthDB struct {
+	db.DB
+	months []*db.BandwidthMonth
+	fail   bool
+}
+
+func (b *bandwidthDB) AddBandwidth(month *db.BandwidthMonth) error {
+	if b.fail {
+		return errors.New("db is down")
+	}
+	b.months = append(b.months, month)
+	return nil
+}
+
+func (b *bandwidthDB) FindBandwidth(userID, space string, month time.Time) ([]*db.BandwidthMonth, error) {
+	found := []*db.BandwidthMonth{}
+	for _, cur := range b.months {
+		if cur.UserID == userID && cur.Space == space && cur.Month.Equal(month) {
+			found = append(found, cur)
+		}
+	}
+	return found, nil
+}
+
+func TestMeter(t *testing.T) {
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	dbpool := &bandwidthDB{months: []*db.BandwidthMonth{
+		{UserID: "1", Space: "pgs", Name: "blog", Month: march, Bytes: 900},
+	}}
+	meter := NewMeter(dbpool, slog.Default())
+	now := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	meter.now = func() time.Time { return now }
+
+	meter.Count("1", "pgs", "blog", 50)
+	used, err := meter.Used("1", "pgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 950 {
+		t.Errorf("expected the stored and pending bytes, got (%d)", used)
+	}
+	meter.Count("1", "pgs", "docs", 50)
+	if !meter.Over("1", "pgs", 1000) || meter.Over("1", "pgs", 1001) || meter.Over("1", "pgs", 0) {
+		t.Error("expected the user to be at the limit of 1000 bytes")
+	}
+
+	dbpool.fail = true
+	err = meter.Flush()
+	if err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	dbpool.fail = false
+	err = meter.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := map[string]int64{}
+	for _, cur := range dbpool.months {
+		totals[cur.Name+" "+cur.Month.Format(time.DateOnly)] += cur.Bytes
+	}
+	expected := map[string]int64{"blog 2024-03-01": 950, "docs 2024-03-01": 50}
+	if diff := cmp.Diff(expected, totals); diff != "" {
+		t.Error(diff)
+	}
+
+	now = now.Add(2 * time.Hour)
+	used, err = meter.Used("1", "pgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 0 {
+		t.Errorf("expected a new month to start from nothing, got (%d)", used)
+	}
+}
+
+func TestNilMeter(t *testing.T) {
+	var meter *Meter
+	meter.Count("1", "pgs", "blog", 50)
+	if meter.Over("1", "pgs", 1) {
+		t.Error("expected a nil meter to have no limits")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &Writer{ResponseWriter: rec}
+	_, _ = w.Write([]byte("hello "))
+	_, _ = w.Write([]byte("world"))
+	if w.Bytes != 11 || rec.Body.String() != "hello world" {
+		t.Errorf("expected 11 bytes to be counted and written, got (%d) %q", w.Bytes, rec.Body.String())
+	}
+}
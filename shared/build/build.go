@@ -0,0 +1,163 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SpecFile is the file at the root of a project that turns it into the
+// sources of a build.
+const SpecFile = "_build"
+
+// LogDir is where the output of the last build of every project is kept
+// in a user's bucket.
+var LogDir = ".builds"
+
+// Generator is a static site generator we know how to run, Args builds
+// the command line from the source and output directories.
+type Generator struct {
+	Name string
+	Args func(src, out string) []string
+}
+
+// Generators are the ones operators can enable, nothing else is ever run.
+var Generators = map[string]Generator{
+	"hugo": {
+		Name: "hugo",
+		Args: func(src, out string) []string {
+			return []string{"hugo", "--source", src, "--destination", out, "--minify"}
+		},
+	},
+	"zola": {
+		Name: "zola",
+		Args: func(src, out string) []string {
+			return []string{"zola", "--root", src, "build", "--output-dir", out, "--force"}
+		},
+	},
+}
+
+// Spec is what a `_build` file declares:
+//
+//	generator = "hugo"
+//	target = "blog"
+//
+// the output of the generator replaces the files of the target project.
+type Spec struct {
+	Generator string `toml:"generator"`
+	Target    string `toml:"target"`
+}
+
+// ParseSpec reads a `_build` file, the generator has to be one operators
+// enabled and the target has to be another project.
+func ParseSpec(text string, allowed []string, projectName string) (*Spec, error) {
+	spec := &Spec{}
+	_, err := toml.Decode(text, spec)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(allowed, spec.Generator) {
+		if len(allowed) == 0 {
+			return nil, errors.New("builds are not enabled")
+		}
+		return nil, fmt.Errorf(
+			"generator (%s) is not available, expected one of (%s)",
+			spec.Generator, strings.Join(allowed, ", "),
+		)
+	}
+	if spec.Target == "" || strings.ContainsAny(spec.Target, "/.") {
+		return nil, fmt.Errorf("target (%s) is not a valid project name", spec.Target)
+	}
+	if spec.Target == projectName {
+		return nil, errors.New("target has to be another project, the output would replace the sources")
+	}
+	return spec, nil
+}
+
+// limitWriter drops what is written past its limit, a chatty build cannot
+// fill up memory.
+type limitWriter struct {
+	w         io.Writer
+	remaining int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.remaining <= 0 {
+		return n, nil
+	}
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+	l.remaining -= len(p)
+	_, err := l.w.Write(p)
+	return n, err
+}
+
+// Runner runs generators in a worker slot: at most `concurrency` builds at
+// once, each with a timeout, an empty environment and, when operators set
+// one, wrapped in a sandbox command like `bwrap` or `nsjail`.
+type Runner struct {
+	Allowed []string
+	Sandbox []string
+	Timeout time.Duration
+	// MaxLog caps how much of the build output is kept
+	MaxLog int
+	slots  chan struct{}
+}
+
+func NewRunner(allowed, sandbox []string, timeout time.Duration, concurrency int) *Runner {
+	return &Runner{
+		Allowed: allowed,
+		Sandbox: sandbox,
+		Timeout: timeout,
+		MaxLog:  1024 * 1024,
+		slots:   make(chan struct{}, max(concurrency, 1)),
+	}
+}
+
+// Run builds src into out with the spec's generator, its output goes to
+// log.
+func (r *Runner) Run(ctx context.Context, spec *Spec, src, out string, log io.Writer) error {
+	gen, ok := Generators[spec.Generator]
+	if !ok || !slices.Contains(r.Allowed, spec.Generator) {
+		return fmt.Errorf("generator (%s) is not available", spec.Generator)
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	args := append(append([]string{}, r.Sandbox...), gen.Args(src, out)...)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = src
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + src}
+	output := &limitWriter{w: log, remaining: r.MaxLog}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// generators can leave children behind that hold on to the output
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("build timed out after %s", r.Timeout)
+	}
+	return err
+}
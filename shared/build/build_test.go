@@ -0,0 +1,98 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	allowed := []string{"hugo"}
+	fixtures := []struct {
+		name string
+		text string
+		err  string
+	}{
+		{name: "valid", text: "generator = \"hugo\"\ntarget = \"blog\""},
+		{name: "not-allowed", text: "generator = \"zola\"\ntarget = \"blog\"", err: "not available"},
+		{name: "no-target", text: "generator = \"hugo\"", err: "not a valid project name"},
+		{name: "same-project", text: "generator = \"hugo\"\ntarget = \"src\"", err: "another project"},
+		{name: "invalid", text: "generator = ", err: "expected"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			spec, err := ParseSpec(fixture.text, allowed, "src")
+			if fixture.err != "" {
+				if err == nil || !strings.Contains(err.Error(), fixture.err) {
+					t.Fatalf("expected error %q, got %v", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec.Generator != "hugo" || spec.Target != "blog" {
+				t.Fatalf("unexpected spec %+v", spec)
+			}
+		})
+	}
+
+	_, err := ParseSpec("generator = \"hugo\"\ntarget = \"blog\"", nil, "src")
+	if err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("expected builds to be disabled, got %v", err)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	Generators["fake"] = Generator{
+		Name: "fake",
+		Args: func(src, out string) []string {
+			return []string{"sh", "-c", `echo "building $HOME"; cp index.md "$1/index.html"; sleep "${2:-0}"`, "sh", out, os.Getenv("FAKE_SLEEP")}
+		},
+	}
+	defer delete(Generators, "fake")
+
+	src := t.TempDir()
+	out := t.TempDir()
+	err := os.WriteFile(filepath.Join(src, "index.md"), []byte("# hi"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewRunner([]string{"fake"}, nil, time.Minute, 1)
+	log := &bytes.Buffer{}
+	err = runner.Run(context.Background(), &Spec{Generator: "fake"}, src, out, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil || string(built) != "# hi" {
+		t.Fatalf("expected the output to be built, got %q %v", built, err)
+	}
+	if log.String() != "building "+src+"\n" {
+		t.Fatalf("expected the build output with an isolated home, got %q", log.String())
+	}
+
+	runner.MaxLog = 3
+	log.Reset()
+	_ = runner.Run(context.Background(), &Spec{Generator: "fake"}, src, out, log)
+	if log.String() != "bui" {
+		t.Fatalf("expected the log to be capped, got %q", log.String())
+	}
+
+	t.Setenv("FAKE_SLEEP", "5")
+	runner.Timeout = 50 * time.Millisecond
+	err = runner.Run(context.Background(), &Spec{Generator: "fake"}, src, out, log)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected the build to time out, got %v", err)
+	}
+
+	err = runner.Run(context.Background(), &Spec{Generator: "hugo"}, src, out, log)
+	if err == nil {
+		t.Fatal("expected generators operators did not enable to be refused")
+	}
+}
@@ -0,0 +1,164 @@
+// Package bus carries events like deploys, published posts and added keys
+// between the services that cause them and the ones that act on them, in
+// process or through nats or redis when they run apart.
+package bus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/shared/metrics"
+)
+
+const (
+	ProjectCreate = "project.create"
+	ProjectUpdate = "project.update"
+	ProjectDelete = "project.delete"
+	// AssetsChange carries the public urls of the files a deploy changed
+	AssetsChange = "assets.change"
+	PostPublish  = "post.publish"
+	KeyAdd       = "key.add"
+)
+
+// Prefix namespaces the subjects and streams of events on a shared server.
+var Prefix = "pico."
+
+// Event is what is published, only the fields of its topic are set.
+type Event struct {
+	Topic   string `json:"topic"`
+	UserID  string `json:"user_id"`
+	User    string `json:"user"`
+	Space   string `json:"space,omitempty"`
+	Project string `json:"project,omitempty"`
+	// Post is the filename of a published post
+	Post string `json:"post,omitempty"`
+	// Key is the id of an added public key
+	Key  string    `json:"key,omitempty"`
+	URLs []string  `json:"urls,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+type Handler func(ev *Event)
+
+// ErrDropped is returned by Publish for an event the bus could not take.
+// Events are notifications, they are never queued or retried and a
+// dropped event is only logged by the publisher and counted.
+var ErrDropped = errors.New("event dropped")
+
+// drop counts ev as dropped because of err.
+func drop(ev *Event, err error) error {
+	metrics.ObserveEventDropped(ev.Topic)
+	return fmt.Errorf("%w: %w", ErrDropped, err)
+}
+
+// Bus delivers every event published on a topic to its subscribers. A
+// subscriber with a group shares the events with the other members of the
+// group, across all processes on the bus each event goes to one of them.
+// Handlers are called one at a time and should hand slow work off.
+// Publish returns once the bus has the event, or ErrDropped when it is not
+// reachable.
+type Bus interface {
+	Publish(ev *Event) error
+	Subscribe(topic, group string, handler Handler)
+	Close() error
+}
+
+// New opens the bus at busURL, `nats://[user:pass@]host[:port]` or
+// `tls://` for nats over tls, `redis://[user:pass@]host[:port][/db]` or
+// `rediss://` for redis over tls. Empty keeps events in the process.
+func New(busURL string, logger *slog.Logger) (Bus, error) {
+	if busURL == "" {
+		return NewLocal(), nil
+	}
+	u, err := url.Parse(busURL)
+	if err != nil {
+		return nil, fmt.Errorf("(%s) is not a valid event bus url", busURL)
+	}
+	switch u.Scheme {
+	case "nats", "tls":
+		return NewNats(u, logger), nil
+	case "redis", "rediss":
+		return NewRedis(u, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus (%s), expected nats or redis", u.Scheme)
+	}
+}
+
+// Open is New that keeps events in the process when busURL is not valid,
+// services still work on their own then.
+func Open(busURL string, logger *slog.Logger) Bus {
+	b, err := New(busURL, logger)
+	if err != nil {
+		logger.Error("could not open event bus, events stay in this process", "err", err.Error())
+		return NewLocal()
+	}
+	return b
+}
+
+func encode(ev *Event) ([]byte, error) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	return json.Marshal(ev)
+}
+
+type subscription struct {
+	group   string
+	handler Handler
+}
+
+// Local delivers events to the subscribers in this process before Publish
+// returns, one subscriber per group.
+type Local struct {
+	mu     sync.RWMutex
+	topics map[string][]*subscription
+}
+
+func NewLocal() *Local {
+	return &Local{topics: map[string][]*subscription{}}
+}
+
+func (l *Local) Publish(ev *Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	l.dispatch(ev)
+	return nil
+}
+
+func (l *Local) dispatch(ev *Event) {
+	l.mu.RLock()
+	subs := l.topics[ev.Topic]
+	l.mu.RUnlock()
+
+	groups := map[string]bool{}
+	for _, sub := range subs {
+		if sub.group != "" {
+			if groups[sub.group] {
+				continue
+			}
+			groups[sub.group] = true
+		}
+		sub.handler(ev)
+	}
+}
+
+func (l *Local) Subscribe(topic, group string, handler Handler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.topics[topic] = append(l.topics[topic], &subscription{group: group, handler: handler})
+}
+
+func (l *Local) Close() error {
+	return nil
+}
+
+// backoff is how long to wait before reconnecting after attempt failures.
+func backoff(attempt int) time.Duration {
+	return min(time.Second*time.Duration(1<<min(attempt, 5)), 30*time.Second)
+}
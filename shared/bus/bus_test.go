@@ -0,0 +1,305 @@
+package bus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLocal(t *testing.T) {
+	b := NewLocal()
+	got := []string{}
+	b.Subscribe(ProjectCreate, "", func(ev *Event) { got = append(got, "all:"+ev.Project) })
+	b.Subscribe(ProjectCreate, "webhooks", func(ev *Event) { got = append(got, "webhooks:"+ev.Project) })
+	b.Subscribe(ProjectCreate, "webhooks", func(ev *Event) { got = append(got, "twice:"+ev.Project) })
+	b.Subscribe(ProjectDelete, "", func(ev *Event) { got = append(got, "delete:"+ev.Project) })
+
+	ev := &Event{Topic: ProjectCreate, Project: "test"}
+	err := b.Publish(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"all:test", "webhooks:test"}, got); diff != "" {
+		t.Error(diff)
+	}
+	if ev.Time.IsZero() {
+		t.Error("expected the event to be stamped")
+	}
+}
+
+func TestNew(t *testing.T) {
+	b, err := New("", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*Local); !ok {
+		t.Errorf("expected an empty url to keep events local, got %T", b)
+	}
+
+	_, err = New("kafka://localhost", slog.Default())
+	if err == nil {
+		t.Error("expected an unknown bus to be refused")
+	}
+}
+
+// fakeNats routes PUB to the SUBs of every connection, one member of a
+// queue group each.
+// With tls set it requires clients to upgrade their connection.
+type fakeNats struct {
+	mu      sync.Mutex
+	subs    map[string][]string
+	clients []*bufio.Writer
+	connect chan string
+	tls     *tls.Config
+}
+
+func (f *fakeNats) serve(conn net.Conn) {
+	if f.tls == nil {
+		fmt.Fprint(conn, "INFO {}\r\n")
+	} else {
+		fmt.Fprint(conn, "INFO {\"tls_required\":true}\r\n")
+		conn = tls.Server(conn, f.tls)
+	}
+	w := bufio.NewWriter(conn)
+	f.mu.Lock()
+	f.clients = append(f.clients, w)
+	client := len(f.clients) - 1
+	f.mu.Unlock()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "CONNECT":
+			f.connect <- strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")
+		case "SUB":
+			f.mu.Lock()
+			group := ""
+			if len(fields) == 4 {
+				group = fields[2]
+			}
+			f.subs[fields[1]] = append(f.subs[fields[1]], fmt.Sprintf("%d %s %s", client, group, fields[len(fields)-1]))
+			f.mu.Unlock()
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			_, _ = io.ReadFull(r, payload)
+			f.mu.Lock()
+			groups := map[string]bool{}
+			for _, sub := range f.subs[fields[1]] {
+				var to int
+				var group, sid string
+				parts := strings.Split(sub, " ")
+				to, _ = strconv.Atoi(parts[0])
+				group, sid = parts[1], parts[2]
+				if group != "" && groups[group] {
+					continue
+				}
+				groups[group] = group != ""
+				fmt.Fprintf(f.clients[to], "MSG %s %s %d\r\n%s", fields[1], sid, size, payload)
+				f.clients[to].Flush()
+			}
+			f.mu.Unlock()
+		case "PING":
+			f.mu.Lock()
+			fmt.Fprint(w, "PONG\r\n")
+			w.Flush()
+			f.mu.Unlock()
+		}
+	}
+}
+
+func startFakeNats(t *testing.T, tlsConfig *tls.Config) (*fakeNats, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	srv := &fakeNats{subs: map[string][]string{}, connect: make(chan string, 2), tls: tlsConfig}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func TestNats(t *testing.T) {
+	srv, addr := startFakeNats(t, nil)
+	u, _ := url.Parse("nats://pico:secret@" + addr)
+	events := make(chan *Event, 4)
+	subscriber := NewNats(u, slog.Default())
+	defer subscriber.Close()
+	subscriber.Subscribe(PostPublish, "", func(ev *Event) { events <- ev })
+	subscriber.Subscribe(PostPublish, "feeds", func(ev *Event) { events <- ev })
+	publisher := NewNats(u, slog.Default())
+	defer publisher.Close()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case opts := <-srv.connect:
+			if !strings.Contains(opts, `"user":"pico"`) || !strings.Contains(opts, `"pass":"secret"`) {
+				t.Errorf("expected credentials, got %s", opts)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected both clients to connect")
+		}
+	}
+
+	// subscriptions and publishes go out on the same connection in order,
+	// wait for the subscriber's to reach the server
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		srv.mu.Lock()
+		subs := len(srv.subs[Prefix+PostPublish])
+		srv.mu.Unlock()
+		if subs == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 subscriptions, got %d", subs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := publisher.Publish(&Event{Topic: PostPublish, User: "erock", Post: "hello.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.User != "erock" || ev.Post != "hello.md" || ev.Topic != PostPublish {
+				t.Errorf("unexpected event %+v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the event to be delivered to both subscribers")
+		}
+	}
+}
+
+func TestNatsTLS(t *testing.T) {
+	// borrow the certificate of a tls test server and the client trusting it
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	srv, addr := startFakeNats(t, ts.TLS)
+	clientConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	clientConfig.ServerName = "127.0.0.1"
+
+	u, _ := url.Parse("tls://" + addr)
+	events := make(chan *Event, 1)
+	n := newNats(u, slog.Default(), clientConfig)
+	defer n.Close()
+	n.Subscribe(KeyAdd, "", func(ev *Event) { events <- ev })
+
+	select {
+	case opts := <-srv.connect:
+		if !strings.Contains(opts, `"tls_required":true`) {
+			t.Errorf("expected the client to ask for tls, got %s", opts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the client to connect over tls")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		srv.mu.Lock()
+		subs := len(srv.subs[Prefix+KeyAdd])
+		srv.mu.Unlock()
+		if subs == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the subscription to reach the server")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := n.Publish(&Event{Topic: KeyAdd, User: "erock", Key: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Key != "1" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event to be delivered")
+	}
+}
+
+func TestDropped(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens here anymore
+	addr := ln.Addr().String()
+	ln.Close()
+
+	for _, busURL := range []string{"nats://" + addr, "redis://" + addr} {
+		b, err := New(busURL, slog.Default())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.Publish(&Event{Topic: ProjectCreate, Project: "test"})
+		if !errors.Is(err, ErrDropped) {
+			t.Errorf("%s: expected the event to be dropped, got %v", busURL, err)
+		}
+		b.Close()
+	}
+}
+
+func TestRedisReplies(t *testing.T) {
+	raw := strings.Join([]string{
+		"*1",
+		"*2",
+		"$10", "pico.a.b.c",
+		"*2",
+		"*2", "$3", "1-0", "*2", "$5", "event", "$13", `{"user":"a"}` + " ",
+		"*2", "$3", "2-0", "*2", "$5", "other", "$-1",
+		"",
+	}, "\r\n")
+	reply, err := readReply(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []streamEntry{{id: "1-0", event: `{"user":"a"} `}, {id: "2-0"}}
+	if diff := cmp.Diff(expected, streamEntries(reply), cmp.AllowUnexported(streamEntry{})); diff != "" {
+		t.Error(diff)
+	}
+
+	reply, err = readReply(bufio.NewReader(strings.NewReader("-BUSYGROUP exists\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != redisError("BUSYGROUP exists") {
+		t.Errorf("expected an error reply, got %v", reply)
+	}
+	if len(streamEntries(nil)) != 0 {
+		t.Error("expected a timed out read to have no entries")
+	}
+}
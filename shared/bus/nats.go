@@ -0,0 +1,299 @@
+package bus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errNotConnected = errors.New("event bus is not connected")
+
+type natsSub struct {
+	subject string
+	group   string
+	handler Handler
+}
+
+// natsInfo is what the server greets us with.
+type natsInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	TLSAvailable bool `json:"tls_available"`
+}
+
+// Nats publishes events as `{Prefix}{topic}` subjects, grouped subscribers
+// join a queue group. It reconnects on its own and subscribes again, what
+// is published while it is not connected is dropped. The connection is
+// upgraded to tls for `tls://` urls and servers that require it.
+type Nats struct {
+	addr      string
+	user      string
+	pass      string
+	token     string
+	tls       bool
+	tlsConfig *tls.Config
+	logger    *slog.Logger
+
+	mu     sync.Mutex
+	conn   net.Conn
+	w      *bufio.Writer
+	subs   map[int]*natsSub
+	sid    int
+	closed bool
+}
+
+func NewNats(u *url.URL, logger *slog.Logger) *Nats {
+	return newNats(u, logger, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+}
+
+func newNats(u *url.URL, logger *slog.Logger, tlsConfig *tls.Config) *Nats {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	n := &Nats{
+		addr:      addr,
+		tls:       u.Scheme == "tls",
+		tlsConfig: tlsConfig,
+		logger:    logger.With("bus", "nats", "addr", addr),
+		subs:      map[int]*natsSub{},
+	}
+	if u.User != nil {
+		pass, ok := u.User.Password()
+		if ok {
+			n.user, n.pass = u.User.Username(), pass
+		} else {
+			n.token = u.User.Username()
+		}
+	}
+	go n.run()
+	return n
+}
+
+func (n *Nats) isClosed() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.closed
+}
+
+func (n *Nats) run() {
+	attempt := 0
+	for !n.isClosed() {
+		r, err := n.connect()
+		if err == nil {
+			attempt = 0
+			err = n.read(r)
+			n.disconnect()
+		}
+		if n.isClosed() {
+			return
+		}
+		attempt += 1
+		n.logger.Error("event bus connection lost", "err", err.Error())
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// connect logs in and subscribes to everything subscribed so far.
+func (n *Nats) connect() (*bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", n.addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	text, ok := strings.CutPrefix(greeting, "INFO ")
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(greeting))
+	}
+	info := &natsInfo{}
+	_ = json.Unmarshal([]byte(text), info)
+
+	secure := n.tls || info.TLSRequired
+	if n.tls && !info.TLSRequired && !info.TLSAvailable {
+		conn.Close()
+		return nil, fmt.Errorf("server does not offer tls")
+	}
+	if secure {
+		tlsConn := tls.Client(conn, n.tlsConfig)
+		err = tlsConn.Handshake()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	opts, _ := json.Marshal(map[string]any{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": secure,
+		"name":         "pico",
+		"lang":         "go",
+		"user":         n.user,
+		"pass":         n.pass,
+		"auth_token":   n.token,
+	})
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		conn.Close()
+		return nil, errNotConnected
+	}
+	n.conn = conn
+	n.w = bufio.NewWriter(conn)
+	fmt.Fprintf(n.w, "CONNECT %s\r\n", opts)
+	for sid, sub := range n.subs {
+		n.writeSub(sid, sub)
+	}
+	_, _ = n.w.WriteString("PING\r\n")
+	err = n.w.Flush()
+	if err != nil {
+		n.conn, n.w = nil, nil
+		conn.Close()
+		return nil, err
+	}
+	n.logger.Info("connected to event bus")
+	return r, nil
+}
+
+func (n *Nats) disconnect() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.conn, n.w = nil, nil
+}
+
+func (n *Nats) writeSub(sid int, sub *natsSub) {
+	if sub.group == "" {
+		fmt.Fprintf(n.w, "SUB %s %d\r\n", sub.subject, sid)
+	} else {
+		fmt.Fprintf(n.w, "SUB %s %s %d\r\n", sub.subject, sub.group, sid)
+	}
+}
+
+// send writes parts as one message, the caller holds mu.
+func (n *Nats) send(parts ...[]byte) error {
+	if n.conn == nil {
+		return errNotConnected
+	}
+	_ = n.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	for _, part := range parts {
+		_, _ = n.w.Write(part)
+	}
+	return n.w.Flush()
+}
+
+// read handles what the server sends until the connection fails.
+func (n *Nats) read(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(op) {
+		case "MSG":
+			// MSG {subject} {sid} [reply-to] {size}
+			fields := strings.Fields(args)
+			if len(fields) < 3 {
+				return fmt.Errorf("invalid message: %s", line)
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("invalid message: %s", line)
+			}
+			payload := make([]byte, size+2)
+			_, err = io.ReadFull(r, payload)
+			if err != nil {
+				return err
+			}
+			sid, _ := strconv.Atoi(fields[1])
+			n.deliver(sid, payload[:size])
+		case "PING":
+			n.mu.Lock()
+			err = n.send([]byte("PONG\r\n"))
+			n.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		case "-ERR":
+			n.logger.Error("event bus refused a request", "err", args)
+		}
+	}
+}
+
+func (n *Nats) deliver(sid int, payload []byte) {
+	n.mu.Lock()
+	sub := n.subs[sid]
+	n.mu.Unlock()
+	if sub == nil {
+		return
+	}
+	ev := &Event{}
+	err := json.Unmarshal(payload, ev)
+	if err != nil {
+		n.logger.Error("could not decode event", "subject", sub.subject, "err", err.Error())
+		return
+	}
+	sub.handler(ev)
+}
+
+func (n *Nats) Publish(ev *Event) error {
+	data, err := encode(ev)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	header := fmt.Sprintf("PUB %s%s %d\r\n", Prefix, ev.Topic, len(data))
+	err = n.send([]byte(header), data, []byte("\r\n"))
+	if err != nil {
+		return drop(ev, err)
+	}
+	return nil
+}
+
+func (n *Nats) Subscribe(topic, group string, handler Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sid += 1
+	sub := &natsSub{subject: Prefix + topic, group: group, handler: handler}
+	n.subs[n.sid] = sub
+	if n.conn != nil {
+		n.writeSub(n.sid, sub)
+		// a failed write is noticed by read, connecting subscribes again
+		_ = n.send()
+	}
+}
+
+func (n *Nats) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closed = true
+	if n.conn == nil {
+		return nil
+	}
+	_ = n.w.Flush()
+	return n.conn.Close()
+}
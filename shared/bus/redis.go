@@ -0,0 +1,365 @@
+package bus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamLength is about how many events redis keeps per topic for
+// subscribers that were away.
+var StreamLength = 10_000
+
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply, an error reply is returned as
+// the error.
+func (c *redisConn) do(args ...string) (any, error) {
+	cmd := &strings.Builder{}
+	fmt.Fprintf(cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.Write([]byte(cmd.String()))
+	if err != nil {
+		return nil, err
+	}
+	reply, err := readReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if rerr, ok := reply.(redisError); ok {
+		return nil, rerr
+	}
+	return reply, nil
+}
+
+// readReply reads one RESP value, nested errors are kept as redisError.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]any, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply: %s", line)
+}
+
+type streamEntry struct {
+	id    string
+	event string
+}
+
+// streamEntries reads the entries of an XREAD reply for a single stream,
+// a timeout is no entries.
+func streamEntries(reply any) []streamEntry {
+	streams, _ := reply.([]any)
+	entries := []streamEntry{}
+	for _, stream := range streams {
+		pair, _ := stream.([]any)
+		if len(pair) != 2 {
+			continue
+		}
+		items, _ := pair[1].([]any)
+		for _, item := range items {
+			fields, _ := item.([]any)
+			if len(fields) != 2 {
+				continue
+			}
+			entry := streamEntry{}
+			entry.id, _ = fields[0].(string)
+			values, _ := fields[1].([]any)
+			for i := 0; i+1 < len(values); i += 2 {
+				if values[i] == "event" {
+					entry.event, _ = values[i+1].(string)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Redis adds events to a `{Prefix}{topic}` stream, grouped subscribers read
+// it through a consumer group. Every subscriber has a connection of its
+// own since reads block, publishing shares one. Events are dropped when
+// redis is not reachable.
+type Redis struct {
+	addr     string
+	tls      bool
+	user     string
+	pass     string
+	db       string
+	consumer string
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	pub    *redisConn
+	conns  map[*redisConn]bool
+	closed bool
+}
+
+func NewRedis(u *url.URL, logger *slog.Logger) *Redis {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	consumer, err := os.Hostname()
+	if err != nil {
+		consumer = "pico"
+	}
+	r := &Redis{
+		addr:     addr,
+		tls:      u.Scheme == "rediss",
+		db:       strings.TrimPrefix(u.Path, "/"),
+		consumer: consumer,
+		logger:   logger.With("bus", "redis", "addr", addr),
+		conns:    map[*redisConn]bool{},
+	}
+	if u.User != nil {
+		r.user = u.User.Username()
+		r.pass, _ = u.User.Password()
+	}
+	return r
+}
+
+func (r *Redis) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if r.tls {
+		host, _, _ := net.SplitHostPort(r.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+
+	switch {
+	case r.user != "" && r.pass != "":
+		_, err = c.do("AUTH", r.user, r.pass)
+	case r.user != "":
+		// `redis://secret@host` is the password of the default user
+		_, err = c.do("AUTH", r.user)
+	}
+	if err == nil && r.db != "" {
+		_, err = c.do("SELECT", r.db)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *Redis) Publish(ev *Event) error {
+	data, err := encode(ev)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return drop(ev, errNotConnected)
+	}
+	if r.pub == nil {
+		r.pub, err = r.dial()
+		if err != nil {
+			return drop(ev, err)
+		}
+	}
+	_ = r.pub.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = r.pub.do(
+		"XADD", Prefix+ev.Topic, "MAXLEN", "~", strconv.Itoa(StreamLength),
+		"*", "event", string(data),
+	)
+	if err != nil {
+		var rerr redisError
+		if !errors.As(err, &rerr) {
+			// the connection is in an unknown state, the next publish dials
+			r.pub.Close()
+			r.pub = nil
+		}
+		return drop(ev, err)
+	}
+	return nil
+}
+
+func (r *Redis) Subscribe(topic, group string, handler Handler) {
+	go r.consume(Prefix+topic, group, handler)
+}
+
+// track keeps conn so Close can interrupt its blocking read, it reports
+// false once closed.
+func (r *Redis) track(conn *redisConn, add bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !add {
+		delete(r.conns, conn)
+		return !r.closed
+	}
+	if r.closed {
+		return false
+	}
+	r.conns[conn] = true
+	return true
+}
+
+func (r *Redis) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func (r *Redis) consume(key, group string, handler Handler) {
+	// without a group only what is added after subscribing is read
+	last := "$"
+	attempt := 0
+	for !r.isClosed() {
+		conn, err := r.dial()
+		if err == nil {
+			if r.track(conn, true) {
+				attempt = 0
+				err = r.read(conn, key, group, &last, handler)
+			}
+			r.track(conn, false)
+			conn.Close()
+		}
+		if r.isClosed() {
+			return
+		}
+		attempt += 1
+		r.logger.Error("event bus connection lost", "stream", key, "err", err.Error())
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// read handles the entries of key until the connection fails, a group
+// first reads what it was handed before and never acknowledged.
+func (r *Redis) read(conn *redisConn, key, group string, last *string, handler Handler) error {
+	if group != "" {
+		_, err := conn.do("XGROUP", "CREATE", key, group, "$", "MKSTREAM")
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	pending := "0"
+	for {
+		var reply any
+		var err error
+		if group != "" {
+			reply, err = conn.do(
+				"XREADGROUP", "GROUP", group, r.consumer, "COUNT", "100",
+				"BLOCK", "5000", "STREAMS", key, pending,
+			)
+		} else {
+			reply, err = conn.do("XREAD", "COUNT", "100", "BLOCK", "5000", "STREAMS", key, *last)
+		}
+		if err != nil {
+			return err
+		}
+
+		entries := streamEntries(reply)
+		if len(entries) == 0 {
+			pending = ">"
+		}
+		for _, entry := range entries {
+			*last = entry.id
+			ev := &Event{}
+			err := json.Unmarshal([]byte(entry.event), ev)
+			if err != nil {
+				r.logger.Error("could not decode event", "stream", key, "id", entry.id, "err", err.Error())
+			} else {
+				handler(ev)
+			}
+			if group != "" {
+				_, err = conn.do("XACK", key, group, entry.id)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.pub != nil {
+		r.pub.Close()
+		r.pub = nil
+	}
+	for conn := range r.conns {
+		conn.Close()
+	}
+	return nil
+}
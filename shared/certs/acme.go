@@ -0,0 +1,374 @@
+package certs
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	ChallengeHTTP = "http-01"
+	ChallengeDNS  = "dns-01"
+)
+
+// ChallengePath is where acme servers fetch http-01 answers.
+const ChallengePath = "/.well-known/acme-challenge/"
+
+var (
+	// how many domains a single renewal pass handles.
+	claimLimit = 50
+	// how long a single domain may take to be issued.
+	issueTimeout = 5 * time.Minute
+	// how long a TXT record is given to reach the authoritative servers.
+	dnsPropagation = 30 * time.Second
+	// a domain that failed waits failureDelay, doubled on every failure up
+	// to maxFailureDelay, so a broken domain does not eat the rate limits.
+	failureDelay    = time.Hour
+	maxFailureDelay = 24 * time.Hour
+)
+
+// LoadAccountKey reads the acme account's key from fpath, a new one is
+// created there the first time.
+func LoadAccountKey(fpath string) (crypto.Signer, error) {
+	data, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(filepath.Dir(fpath), 0o700)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(fpath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("(%s) is not an acme account key", fpath)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+type failure struct {
+	delay time.Duration
+	retry time.Time
+}
+
+// Manager issues certificates for verified project domains and renews them
+// before they expire. http-01 answers are kept in memory, so the web server
+// answering them has to be the one running the manager.
+type Manager struct {
+	Client    *acme.Client
+	Email     string
+	Challenge string
+	// DNS publishes dns-01 records
+	DNS         DNSProvider
+	Store       *Store
+	RenewBefore time.Duration
+	// Verify confirms a domain still belongs to its project before its
+	// certificate is issued or renewed, nil trusts the database
+	Verify func(domain *db.ProjectDomain) bool
+
+	mu         sync.Mutex
+	registered bool
+	tokens     map[string]string
+	failures   map[string]*failure
+}
+
+func NewManager(client *acme.Client, store *Store, email, challenge string, dns DNSProvider, renewBefore time.Duration) (*Manager, error) {
+	switch challenge {
+	case ChallengeHTTP:
+	case ChallengeDNS:
+		if dns == nil {
+			return nil, fmt.Errorf("challenge (%s) requires a dns provider", challenge)
+		}
+	default:
+		return nil, fmt.Errorf("unknown acme challenge (%s), expected %s or %s", challenge, ChallengeHTTP, ChallengeDNS)
+	}
+	return &Manager{
+		Client:      client,
+		Email:       email,
+		Challenge:   challenge,
+		DNS:         dns,
+		Store:       store,
+		RenewBefore: renewBefore,
+		tokens:      map[string]string{},
+		failures:    map[string]*failure{},
+	}, nil
+}
+
+func (m *Manager) register(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.registered {
+		return nil
+	}
+	acct := &acme.Account{}
+	if m.Email != "" {
+		acct.Contact = []string{"mailto:" + m.Email}
+	}
+	_, err := m.Client.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return err
+	}
+	m.registered = true
+	return nil
+}
+
+func (m *Manager) setToken(token, keyAuth string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if keyAuth == "" {
+		delete(m.tokens, token)
+		return
+	}
+	m.tokens[token] = keyAuth
+}
+
+// HTTPHandler answers the http-01 challenges of pending orders and hands
+// every other request to next.
+func (m *Manager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, ChallengePath)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		keyAuth, found := m.tokens[token]
+		m.mu.Unlock()
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(keyAuth))
+	})
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) authorize(ctx context.Context, authz *acme.Authorization) error {
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.Challenge {
+			chal = c
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme server offers no %s challenge for (%s)", m.Challenge, authz.Identifier.Value)
+	}
+
+	switch m.Challenge {
+	case ChallengeHTTP:
+		keyAuth, err := m.Client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return err
+		}
+		m.setToken(chal.Token, keyAuth)
+		defer m.setToken(chal.Token, "")
+	case ChallengeDNS:
+		record, err := m.Client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return err
+		}
+		name := "_acme-challenge." + authz.Identifier.Value
+		err = m.DNS.Present(ctx, name, record)
+		if err != nil {
+			return fmt.Errorf("could not publish dns record: %w", err)
+		}
+		defer func() {
+			// the order's context may be done, clean up regardless
+			_ = m.DNS.CleanUp(context.Background(), name, record)
+		}()
+		err = sleep(ctx, dnsPropagation)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := m.Client.Accept(ctx, chal)
+	if err != nil {
+		return err
+	}
+	_, err = m.Client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// Issue orders a certificate for domain, stores it with its key encrypted
+// and starts serving it.
+func (m *Manager) Issue(ctx context.Context, domain string) error {
+	err := m.register(ctx)
+	if err != nil {
+		return fmt.Errorf("could not register acme account: %w", err)
+	}
+
+	order, err := m.Client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return err
+	}
+	for _, url := range order.AuthzURLs {
+		authz, err := m.Client.GetAuthorization(ctx, url)
+		if err != nil {
+			return err
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+		err = m.authorize(ctx, authz)
+		if err != nil {
+			return err
+		}
+	}
+	order, err = m.Client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.Client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	certPEM := []byte{}
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return m.Save(domain, certPEM, keyPEM)
+}
+
+// Save stores a certificate and hot loads it into the store.
+func (m *Manager) Save(domain string, certPEM, keyPEM []byte) error {
+	sealed, err := m.Store.Box.Seal(string(keyPEM))
+	if err != nil {
+		return err
+	}
+	stored := &db.DomainCert{Domain: domain, CertPEM: string(certPEM), KeyPEM: sealed}
+	cert, err := m.Store.Load(stored)
+	if err != nil {
+		return err
+	}
+	stored.ExpiresAt = &cert.Leaf.NotAfter
+	err = m.Store.Dbpool.UpsertDomainCert(stored)
+	if err != nil {
+		return err
+	}
+	m.Store.Put(domain, cert)
+	return nil
+}
+
+func (m *Manager) failed(domain string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.failures[domain]
+	if !ok {
+		f = &failure{}
+		m.failures[domain] = f
+	}
+	f.delay = min(max(f.delay*2, failureDelay), maxFailureDelay)
+	f.retry = time.Now().Add(f.delay)
+}
+
+func (m *Manager) waiting(domain string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.failures[domain]
+	return ok && time.Now().Before(f.retry)
+}
+
+// Renew issues certificates for verified domains without one and renews
+// the ones expiring within RenewBefore.
+func (m *Manager) Renew(logger *slog.Logger) (int, error) {
+	domains, err := m.Store.Dbpool.FindDomainsForCerts(time.Now().Add(m.RenewBefore), claimLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	issued := 0
+	for _, domain := range domains {
+		if m.waiting(domain.Domain) {
+			continue
+		}
+		if m.Verify != nil && !m.Verify(domain) {
+			logger.Info("skipped certificate of unconfirmed domain", "domain", domain.Domain)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), issueTimeout)
+		err := m.Issue(ctx, domain.Domain)
+		cancel()
+		if err != nil {
+			m.failed(domain.Domain)
+			logger.Error("could not issue certificate", "domain", domain.Domain, "err", err.Error())
+			continue
+		}
+
+		m.mu.Lock()
+		delete(m.failures, domain.Domain)
+		m.mu.Unlock()
+		logger.Info("issued certificate", "domain", domain.Domain, "project", domain.ProjectName)
+		issued += 1
+	}
+	return issued, nil
+}
+
+// Run renews certificates every interval, it never returns.
+func (m *Manager) Run(interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := m.Renew(logger)
+		if err != nil {
+			logger.Error("could not renew certificates", "err", err.Error())
+		}
+	}
+}
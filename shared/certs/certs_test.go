@@ -0,0 +1,358 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/crypt"
+)
+
+type fakeDB struct {
+	db.DB
+	mu      sync.Mutex
+	certs   map[string]*db.DomainCert
+	due     []*db.ProjectDomain
+	queries int
+}
+
+func (f *fakeDB) FindDomainCert(domain string) (*db.DomainCert, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries += 1
+	cert, ok := f.certs[domain]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return cert, nil
+}
+
+func (f *fakeDB) FindDomainsForCerts(renewBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	return f.due, nil
+}
+
+func (f *fakeDB) UpsertDomainCert(cert *db.DomainCert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.certs[cert.Domain] = cert
+	return nil
+}
+
+func selfSigned(t *testing.T, domain string, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newStore(t *testing.T) (*Store, *fakeDB) {
+	t.Helper()
+	box, err := crypt.NewBox("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbpool := &fakeDB{certs: map[string]*db.DomainCert{}}
+	return NewStore(dbpool, box, slog.Default()), dbpool
+}
+
+func commonName(cert *tls.Certificate) string {
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	return leaf.Subject.CommonName
+}
+
+func TestGetCertificate(t *testing.T) {
+	store, dbpool := newStore(t)
+	manager, err := NewManager(nil, store, "", ChallengeHTTP, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM := selfSigned(t, "example.com", time.Now().Add(24*time.Hour))
+	err = manager.Save("example.com", certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbpool.certs["example.com"].KeyPEM == string(keyPEM) {
+		t.Error("expected the key to be stored encrypted")
+	}
+	if dbpool.certs["example.com"].ExpiresAt == nil {
+		t.Error("expected the expiry to be stored")
+	}
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.com."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commonName(cert) != "example.com" {
+		t.Errorf("expected the certificate of example.com, got (%s)", commonName(cert))
+	}
+
+	_, err = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.com"})
+	if err == nil {
+		t.Error("expected no certificate for an unknown domain")
+	}
+	queries := dbpool.queries
+	_, _ = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.com"})
+	if dbpool.queries != queries {
+		t.Error("expected a missing certificate to be cached")
+	}
+
+	defaultPEM, defaultKey := selfSigned(t, "pgs.sh", time.Now().Add(24*time.Hour))
+	fallback, err := tls.X509KeyPair(defaultPEM, defaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Default = &fallback
+	cert, err = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.com"})
+	if err != nil || commonName(cert) != "pgs.sh" {
+		t.Errorf("expected the default certificate, got %v", err)
+	}
+
+	expiredPEM, expiredKey := selfSigned(t, "old.com", time.Now().Add(-time.Minute))
+	sealed, _ := store.Box.Seal(string(expiredKey))
+	dbpool.certs["old.com"] = &db.DomainCert{Domain: "old.com", CertPEM: string(expiredPEM), KeyPEM: sealed}
+	cert, _ = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "old.com"})
+	if commonName(cert) != "pgs.sh" {
+		t.Error("expected an expired certificate not to be served")
+	}
+}
+
+func TestRenewedCertificateIsHotLoaded(t *testing.T) {
+	store, _ := newStore(t)
+	manager, err := NewManager(nil, store, "", ChallengeHTTP, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, notAfter := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(48 * time.Hour)} {
+		certPEM, keyPEM := selfSigned(t, "example.com", notAfter)
+		err := manager.Save("example.com", certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(cert.Leaf.NotAfter) < 24*time.Hour {
+		t.Error("expected the renewed certificate to be served")
+	}
+}
+
+func TestMissesAreBounded(t *testing.T) {
+	defer func(prev int) { maxMisses = prev }(maxMisses)
+	maxMisses = 2
+	store, dbpool := newStore(t)
+
+	for _, host := range []string{"a.com", "b.com", "c.com"} {
+		_, _ = store.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+	}
+	if len(store.missed) != 2 || store.misses.Len() != 2 {
+		t.Fatalf("expected (2) remembered misses, got (%d)", len(store.missed))
+	}
+	queries := dbpool.queries
+	_, _ = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "c.com"})
+	if dbpool.queries != queries {
+		t.Error("expected a recent miss to be cached")
+	}
+	_, _ = store.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.com"})
+	if dbpool.queries != queries+1 {
+		t.Error("expected the oldest miss to be forgotten")
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	manager, err := NewManager(nil, nil, "", ChallengeHTTP, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.failed("broken.com")
+	if manager.failures["broken.com"].delay != failureDelay {
+		t.Errorf("expected the first failure to wait (%s)", failureDelay)
+	}
+	// a domain that keeps failing must not overflow the delay
+	for range 100 {
+		manager.failed("broken.com")
+	}
+	if manager.failures["broken.com"].delay != maxFailureDelay || !manager.waiting("broken.com") {
+		t.Errorf("expected the delay to stay at (%s), got (%s)", maxFailureDelay, manager.failures["broken.com"].delay)
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	_, err := NewManager(nil, nil, "", ChallengeDNS, nil, time.Hour)
+	if err == nil {
+		t.Error("expected dns-01 to require a provider")
+	}
+	_, err = NewManager(nil, nil, "", "tls-alpn-01", nil, time.Hour)
+	if err == nil {
+		t.Error("expected an unknown challenge to fail")
+	}
+}
+
+func TestRenewVerifiesDomains(t *testing.T) {
+	store, dbpool := newStore(t)
+	dbpool.due = []*db.ProjectDomain{{ID: "1", Domain: "gone.example.com"}}
+	manager, err := NewManager(nil, store, "", ChallengeHTTP, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := []string{}
+	manager.Verify = func(domain *db.ProjectDomain) bool {
+		checked = append(checked, domain.Domain)
+		return false
+	}
+
+	// the nil client would fail any order that got through
+	issued, err := manager.Renew(slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued != 0 || len(checked) != 1 {
+		t.Fatalf("expected the domain to be checked and skipped, issued (%d) checked %v", issued, checked)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	store, _ := newStore(t)
+	manager, err := NewManager(nil, store, "", ChallengeHTTP, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.setToken("abc", "abc.thumbprint")
+	handler := manager.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: ChallengePath + "abc", status: http.StatusOK, body: "abc.thumbprint"},
+		{path: ChallengePath + "other", status: http.StatusNotFound},
+		{path: "/index.html", status: http.StatusTeapot},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s: expected (%d), got (%d)", tc.path, tc.status, rec.Code)
+		}
+		if tc.body != "" && rec.Body.String() != tc.body {
+			t.Errorf("%s: expected (%s), got (%s)", tc.path, tc.body, rec.Body.String())
+		}
+	}
+
+	manager.setToken("abc", "")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ChallengePath+"abc", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Error("expected a finished challenge to be gone")
+	}
+}
+
+func TestLoadAccountKey(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "acme", "account.pem")
+	key, err := LoadAccountKey(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadAccountKey(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.(*ecdsa.PrivateKey).Equal(again) {
+		t.Error("expected the account key to be kept")
+	}
+}
+
+func TestDNSProviders(t *testing.T) {
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, fmt.Sprintf("%s %s %v %v %v", r.Method, r.URL.Path, body["action"], body["name"], body["content"]))
+		_, _ = w.Write([]byte(`{"result":{"id":"rec1"}}`))
+	}))
+	defer srv.Close()
+
+	cf, err := NewDNSProvider(DNSCloudflare, srv.URL, "zone", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := NewDNSProvider(DNSWebhook, srv.URL+"/hook", "", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, provider := range []DNSProvider{cf, hook} {
+		err := provider.Present(ctx, "_acme-challenge.example.com", "value")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = provider.CleanUp(ctx, "_acme-challenge.example.com", "value")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		"POST /zones/zone/dns_records <nil> _acme-challenge.example.com value",
+		"DELETE /zones/zone/dns_records/rec1 <nil> <nil> <nil>",
+		"POST /hook present _acme-challenge.example.com <nil>",
+		"POST /hook cleanup _acme-challenge.example.com <nil>",
+	}
+	if diff := cmp.Diff(expected, requests); diff != "" {
+		t.Error(diff)
+	}
+
+	_, err = NewDNSProvider("route53", "", "", "")
+	if err == nil {
+		t.Error("expected an unknown provider to fail")
+	}
+	_, err = NewDNSProvider(DNSCloudflare, "", "", "")
+	if err == nil {
+		t.Error("expected cloudflare to require a zone and a token")
+	}
+}
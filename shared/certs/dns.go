@@ -0,0 +1,143 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DNSCloudflare = "cloudflare"
+	DNSWebhook    = "webhook"
+)
+
+// DNSProvider publishes the TXT records of dns-01 challenges, name is the
+// full record name like `_acme-challenge.example.com`.
+type DNSProvider interface {
+	Present(ctx context.Context, name, value string) error
+	CleanUp(ctx context.Context, name, value string) error
+}
+
+// NewDNSProvider picks the adapter for name. zone is the cloudflare zone
+// id, endpoint is where the webhook is posted or overrides the cloudflare
+// api.
+func NewDNSProvider(name, endpoint, zone, token string) (DNSProvider, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch name {
+	case DNSCloudflare:
+		if zone == "" || token == "" {
+			return nil, fmt.Errorf("dns provider (%s) requires a zone and a token", name)
+		}
+		if endpoint == "" {
+			endpoint = "https://api.cloudflare.com/client/v4"
+		}
+		return &Cloudflare{API: endpoint, Zone: zone, Token: token, client: client, records: map[string]string{}}, nil
+	case DNSWebhook:
+		if endpoint == "" {
+			return nil, fmt.Errorf("dns provider (%s) requires a url", name)
+		}
+		return &Webhook{URL: endpoint, Token: token, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown dns provider (%s), expected %s or %s", name, DNSCloudflare, DNSWebhook)
+	}
+}
+
+func send(ctx context.Context, client *http.Client, method, endpoint, token string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("dns provider responded with (%d)", resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Cloudflare manages the records through the zone's `dns_records` api, the
+// ids of the records it created are kept to remove them again.
+type Cloudflare struct {
+	API   string
+	Zone  string
+	Token string
+
+	client  *http.Client
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func (c *Cloudflare) Present(ctx context.Context, name, value string) error {
+	record := map[string]any{"type": "TXT", "name": name, "content": value, "ttl": 120}
+	result := struct {
+		Result struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}{}
+	err := send(ctx, c.client, http.MethodPost, fmt.Sprintf("%s/zones/%s/dns_records", c.API, c.Zone), c.Token, record, &result)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records[name+" "+value] = result.Result.ID
+	return nil
+}
+
+func (c *Cloudflare) CleanUp(ctx context.Context, name, value string) error {
+	c.mu.Lock()
+	id, ok := c.records[name+" "+value]
+	delete(c.records, name+" "+value)
+	c.mu.Unlock()
+	if !ok || id == "" {
+		return nil
+	}
+	return send(ctx, c.client, http.MethodDelete, fmt.Sprintf("%s/zones/%s/dns_records/%s", c.API, c.Zone, id), c.Token, nil, nil)
+}
+
+// WebhookPayload is the json body posted to a generic dns hook, Action is
+// `present` or `cleanup`.
+type WebhookPayload struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+}
+
+// Webhook posts the records to an operator's own endpoint, with the token
+// as a bearer token when there is one.
+type Webhook struct {
+	URL   string
+	Token string
+
+	client *http.Client
+}
+
+func (w *Webhook) Present(ctx context.Context, name, value string) error {
+	return send(ctx, w.client, http.MethodPost, w.URL, w.Token, WebhookPayload{Action: "present", Name: name, Value: value}, nil)
+}
+
+func (w *Webhook) CleanUp(ctx context.Context, name, value string) error {
+	return send(ctx, w.client, http.MethodPost, w.URL, w.Token, WebhookPayload{Action: "cleanup", Name: name, Value: value}, nil)
+}
@@ -0,0 +1,173 @@
+package certs
+
+import (
+	"container/list"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/crypt"
+)
+
+// how long a certificate, or the lack of one, is kept in memory before the
+// database is asked again, removed domains stop being served after it.
+var cacheTTL = 10 * time.Minute
+
+// how many hosts without a certificate are remembered, anyone can make up
+// new ones so the least recently asked for are forgotten past it.
+var maxMisses = 10_000
+
+type cached struct {
+	cert     *tls.Certificate
+	loadedAt time.Time
+}
+
+type miss struct {
+	domain   string
+	loadedAt time.Time
+}
+
+// Store hands the tls listener the certificate of the domain a client asks
+// for. Certificates are loaded from the database on first use and replaced
+// in place when they are renewed, so the listener never restarts.
+type Store struct {
+	Dbpool db.DB
+	// Box decrypts stored keys, without one only Default is served
+	Box    *crypt.Box
+	Logger *slog.Logger
+	// Default is served for hosts without a certificate of their own, like
+	// the service's own subdomains
+	Default *tls.Certificate
+
+	mu     sync.RWMutex
+	certs  map[string]*cached
+	misses *list.List
+	missed map[string]*list.Element
+}
+
+func NewStore(dbpool db.DB, box *crypt.Box, logger *slog.Logger) *Store {
+	return &Store{
+		Dbpool: dbpool,
+		Box:    box,
+		Logger: logger,
+		certs:  map[string]*cached{},
+		misses: list.New(),
+		missed: map[string]*list.Element{},
+	}
+}
+
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// Put makes cert the one served for domain.
+func (s *Store) Put(domain string, cert *tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	domain = normalize(domain)
+	s.forgetMiss(domain)
+	s.certs[domain] = &cached{cert: cert, loadedAt: time.Now()}
+}
+
+func (s *Store) forgetMiss(domain string) {
+	if el, ok := s.missed[domain]; ok {
+		s.misses.Remove(el)
+		delete(s.missed, domain)
+	}
+}
+
+// putMiss remembers that domain has no certificate.
+func (s *Store) putMiss(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.certs, domain)
+	s.forgetMiss(domain)
+	s.missed[domain] = s.misses.PushFront(&miss{domain: domain, loadedAt: time.Now()})
+	for s.misses.Len() > maxMisses {
+		el := s.misses.Back()
+		s.misses.Remove(el)
+		delete(s.missed, el.Value.(*miss).domain)
+	}
+}
+
+// isMiss is true when domain was recently found to have no certificate.
+func (s *Store) isMiss(domain string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.missed[domain]
+	if !ok {
+		return false
+	}
+	if time.Since(el.Value.(*miss).loadedAt) >= cacheTTL {
+		s.forgetMiss(domain)
+		return false
+	}
+	s.misses.MoveToFront(el)
+	return true
+}
+
+// Load decrypts a stored certificate.
+func (s *Store) Load(stored *db.DomainCert) (*tls.Certificate, error) {
+	keyPEM, err := s.Box.Open(stored.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt key of (%s): %w", stored.Domain, err)
+	}
+	cert, err := tls.X509KeyPair([]byte(stored.CertPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (s *Store) lookup(domain string) *tls.Certificate {
+	s.mu.RLock()
+	found, ok := s.certs[domain]
+	s.mu.RUnlock()
+	if ok && time.Since(found.loadedAt) < cacheTTL {
+		return found.cert
+	}
+	if s.Box == nil || s.isMiss(domain) {
+		return nil
+	}
+
+	var cert *tls.Certificate
+	stored, err := s.Dbpool.FindDomainCert(domain)
+	if err == nil {
+		cert, err = s.Load(stored)
+		if err != nil {
+			s.Logger.Error("could not load certificate", "domain", domain, "err", err.Error())
+		}
+	}
+	// missing certificates are cached too, a flood of unknown hosts should
+	// not turn into a flood of queries
+	if cert == nil {
+		s.putMiss(domain)
+		return nil
+	}
+	s.Put(domain, cert)
+	return cert
+}
+
+// GetCertificate is the tls.Config callback picking a certificate by SNI.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := normalize(hello.ServerName)
+	if domain != "" {
+		cert := s.lookup(domain)
+		if cert != nil && (cert.Leaf == nil || time.Now().Before(cert.Leaf.NotAfter)) {
+			return cert, nil
+		}
+	}
+	if s.Default != nil {
+		return s.Default, nil
+	}
+	return nil, fmt.Errorf("no certificate for (%s)", domain)
+}
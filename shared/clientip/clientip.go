@@ -0,0 +1,133 @@
+// Package clientip finds the address of the client behind our reverse
+// proxies. Only proxies in a trusted list get to say who the client is,
+// anyone else could claim any address.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// PrivateRanges is what a proxy running next to us, e.g. in the same
+// docker network, connects from.
+var PrivateRanges = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+// Trusted are the networks of proxies whose word on the client is taken.
+type Trusted []netip.Prefix
+
+// ParseTrusted reads CIDRs, or single addresses, and skips what it cannot
+// read so a typo trusts less rather than more.
+func ParseTrusted(items []string) Trusted {
+	trusted := Trusted{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			addr = addr.Unmap()
+			trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return trusted
+}
+
+// Contains is whether addr belongs to a trusted proxy.
+func (t Trusted) Contains(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromAddr is the ip of a connection's address, invalid when there is none.
+func FromAddr(addr net.Addr) netip.Addr {
+	if addr == nil {
+		return netip.Addr{}
+	}
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip, _ := netip.AddrFromSlice(tcp.IP)
+		return ip.Unmap()
+	}
+	return parse(addr.String())
+}
+
+// parse reads an address with or without a port.
+func parse(val string) netip.Addr {
+	val = strings.TrimSpace(val)
+	if addrPort, err := netip.ParseAddrPort(val); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	addr, err := netip.ParseAddr(strings.Trim(val, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// FromRequest is the client of a request. X-Forwarded-For is read from
+// the right, the address each trusted proxy saw, until one was not sent
+// by a trusted proxy.
+func (t Trusted) FromRequest(r *http.Request) netip.Addr {
+	client := parse(r.RemoteAddr)
+	if !t.Contains(client) {
+		return client
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i -= 1 {
+		addr := parse(hops[i])
+		if !addr.IsValid() {
+			break
+		}
+		client = addr
+		if !t.Contains(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// Resolve sets the RemoteAddr of a request to its client so everything
+// after it, logs, analytics and rate limits, sees the same address.
+func (t Trusted) Resolve(r *http.Request) {
+	peer := parse(r.RemoteAddr)
+	client := t.FromRequest(r)
+	if client.IsValid() && client != peer {
+		r.RemoteAddr = netip.AddrPortFrom(client, 0).String()
+	}
+}
+
+// Handler resolves the client of every request before next sees it.
+func (t Trusted) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Resolve(r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Key groups the addresses of one client for rate limits, an ipv6 client
+// usually gets a whole /64 to pick addresses from.
+func Key(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, _ := addr.WithZone("").Prefix(64)
+	return prefix.String()
+}
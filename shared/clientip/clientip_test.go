@@ -0,0 +1,82 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseTrusted(t *testing.T) {
+	trusted := ParseTrusted([]string{"10.0.0.0/8", " 2001:db8::1 ", "nope", "::ffff:192.0.2.1"})
+	if len(trusted) != 3 {
+		t.Fatalf("expected invalid entries to be skipped, got %v", trusted)
+	}
+	for _, addr := range []string{"10.1.2.3", "2001:db8::1", "192.0.2.1", "::ffff:10.0.0.1"} {
+		if !trusted.Contains(netip.MustParseAddr(addr)) {
+			t.Errorf("expected %s to be trusted", addr)
+		}
+	}
+	if trusted.Contains(netip.MustParseAddr("2001:db8::2")) {
+		t.Error("expected a single address to only trust itself")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	trusted := ParseTrusted([]string{"10.0.0.0/8", "fd00::/8"})
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		client    string
+	}{
+		{name: "direct", remote: "192.0.2.1:1234", client: "192.0.2.1"},
+		{name: "untrusted peer", remote: "192.0.2.1:1234", forwarded: []string{"198.51.100.1"}, client: "192.0.2.1"},
+		{name: "trusted peer", remote: "10.0.0.2:1234", forwarded: []string{"198.51.100.1"}, client: "198.51.100.1"},
+		{name: "spoofed hop", remote: "10.0.0.2:1234", forwarded: []string{"203.0.113.9, 198.51.100.1"}, client: "198.51.100.1"},
+		{name: "proxy chain", remote: "10.0.0.2:1234", forwarded: []string{"198.51.100.1", "10.0.0.3"}, client: "198.51.100.1"},
+		{name: "ipv6", remote: "[fd00::2]:1234", forwarded: []string{"2001:db8::5"}, client: "2001:db8::5"},
+		{name: "garbage", remote: "10.0.0.2:1234", forwarded: []string{"nope, 10.0.0.3"}, client: "10.0.0.3"},
+		{name: "no header", remote: "10.0.0.2:1234", client: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, header := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if client := trusted.FromRequest(r); client.String() != tt.client {
+				t.Errorf("expected %s, got %s", tt.client, client)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	trusted := ParseTrusted([]string{"10.0.0.0/8"})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("X-Forwarded-For", "2001:db8::5")
+	trusted.Resolve(r)
+	if r.RemoteAddr != "[2001:db8::5]:0" {
+		t.Errorf("unexpected remote addr %s", r.RemoteAddr)
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":           "192.0.2.1",
+		"::ffff:192.0.2.1":    "192.0.2.1",
+		"2001:db8:1:2:3::4":   "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::": "2001:db8:1:2::/64",
+	}
+	for addr, key := range tests {
+		if got := Key(netip.MustParseAddr(addr)); got != key {
+			t.Errorf("%s: expected %s, got %s", addr, key, got)
+		}
+	}
+	if Key(netip.Addr{}) != "" {
+		t.Error("expected no key without an address")
+	}
+}
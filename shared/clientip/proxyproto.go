@@ -0,0 +1,166 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headerTimeout is how long a trusted proxy has to send the PROXY header.
+var headerTimeout = 5 * time.Second
+
+// v2Signature starts every binary PROXY protocol header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyListener reads the PROXY protocol header, v1 or v2, that proxies
+// like haproxy send ahead of a connection. Connections of trusted proxies
+// report the client as their RemoteAddr, the header of anyone else is
+// left alone and breaks their handshake.
+func (t Trusted) ProxyListener(ln net.Listener) net.Listener {
+	return &proxyListener{Listener: ln, trusted: t}
+}
+
+type proxyListener struct {
+	net.Listener
+	trusted Trusted
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, trusted: l.trusted}, nil
+}
+
+// proxyConn reads the header the first time the connection is used, never
+// while accepting, so a slow proxy can't hold up other connections.
+type proxyConn struct {
+	net.Conn
+	trusted Trusted
+	once    sync.Once
+	r       *bufio.Reader
+	remote  net.Addr
+	err     error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.r = bufio.NewReader(c.Conn)
+		c.remote = c.Conn.RemoteAddr()
+		if !c.trusted.Contains(FromAddr(c.remote)) {
+			return
+		}
+
+		_ = c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+		defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+		remote, err := readHeader(c.r)
+		if err != nil {
+			c.err = err
+			return
+		}
+		if remote != nil {
+			c.remote = remote
+		}
+	})
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+// readHeader returns the client the header names, nil when there is no
+// header or it carries no address, e.g. a health check of the proxy.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case 'P':
+		return readHeaderV1(r)
+	case v2Signature[0]:
+		return readHeaderV2(r)
+	}
+	return nil, nil
+}
+
+// readHeaderV1 reads `PROXY TCP4 <src> <dst> <sport> <dport>\r\n`.
+func readHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	raw, err := r.ReadSlice('\n')
+	// 107 bytes is the longest header v1 allows
+	if err != nil || len(raw) > 107 || !bytes.HasPrefix(raw, []byte("PROXY ")) || !bytes.HasSuffix(raw, []byte("\r\n")) {
+		return nil, fmt.Errorf("invalid PROXY protocol header")
+	}
+	line := string(raw[:len(raw)-2])
+
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol header (%s)", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid PROXY protocol header (%s)", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readHeaderV2 reads the binary header, only tcp over ipv4 and ipv6 name
+// a client.
+func readHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	header, err := r.Peek(16)
+	if err != nil || !bytes.Equal(header[:12], v2Signature) {
+		return nil, fmt.Errorf("invalid PROXY protocol header")
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version (%d)", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	size := int(binary.BigEndian.Uint16(header[14:16]))
+
+	body := make([]byte, 16+size)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+	body = body[16:]
+
+	// LOCAL is the proxy talking to us itself
+	if command == 0x0 {
+		return nil, nil
+	}
+	switch family {
+	case 0x11:
+		if len(body) < 12 {
+			return nil, fmt.Errorf("invalid PROXY protocol header")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21:
+		if len(body) < 36 {
+			return nil, fmt.Errorf("invalid PROXY protocol header")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil
+}
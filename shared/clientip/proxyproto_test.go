@@ -0,0 +1,107 @@
+package clientip
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+func v2Header(command byte, src net.IP, port uint16) []byte {
+	header := append([]byte{}, v2Signature...)
+	body := make([]byte, 12)
+	copy(body[0:4], src.To4())
+	copy(body[4:8], net.IPv4(10, 0, 0, 1).To4())
+	binary.BigEndian.PutUint16(body[8:10], port)
+	binary.BigEndian.PutUint16(body[10:12], 22)
+	header = append(header, 0x20|command, 0x11, 0, byte(len(body)))
+	return append(header, body...)
+}
+
+func TestProxyListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted Trusted
+		header  []byte
+		remote  string
+	}{
+		{name: "v1", trusted: ParseTrusted([]string{"127.0.0.1"}), header: []byte("PROXY TCP4 192.0.2.1 10.0.0.1 5555 22\r\n"), remote: "192.0.2.1:5555"},
+		{name: "v1 ipv6", trusted: ParseTrusted([]string{"127.0.0.1"}), header: []byte("PROXY TCP6 2001:db8::1 fd00::1 5555 22\r\n"), remote: "[2001:db8::1]:5555"},
+		{name: "v2", trusted: ParseTrusted([]string{"127.0.0.1"}), header: v2Header(0x1, net.IPv4(192, 0, 2, 1), 5555), remote: "192.0.2.1:5555"},
+		{name: "v2 local", trusted: ParseTrusted([]string{"127.0.0.1"}), header: v2Header(0x0, net.IPv4(192, 0, 2, 1), 5555)},
+		{name: "no header", trusted: ParseTrusted([]string{"127.0.0.1"})},
+		{name: "untrusted", trusted: Trusted{}, header: []byte("PROXY TCP4 192.0.2.1 10.0.0.1 5555 22\r\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer inner.Close()
+			ln := tt.trusted.ProxyListener(inner)
+
+			client, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			payload := append(append([]byte{}, tt.header...), []byte("SSH-2.0-test\r\n")...)
+			go func() { _, _ = client.Write(payload) }()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			remote := tt.remote
+			if remote == "" {
+				remote = client.LocalAddr().String()
+			}
+			if conn.RemoteAddr().String() != remote {
+				t.Errorf("expected %s, got %s", remote, conn.RemoteAddr())
+			}
+
+			want := "SSH-2.0-test\r\n"
+			if tt.name == "untrusted" {
+				want = string(tt.header) + want
+			}
+			got := make([]byte, len(want))
+			_, err = io.ReadFull(conn, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestProxyListenerInvalid(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+	ln := ParseTrusted([]string{"127.0.0.0/8"}).ProxyListener(inner)
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go func() { _, _ = client.Write([]byte("PROXY TCP4 nope\r\n")) }()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil {
+		t.Error("expected an invalid header to fail the connection")
+	}
+}
@@ -3,13 +3,16 @@ package shared
 import (
 	"fmt"
 	"html/template"
-	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/picosh/pico/shared/bus"
+	"github.com/picosh/pico/shared/clientip"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/tracing"
 	"github.com/picosh/pico/wish/cms/config"
 )
 
@@ -32,6 +35,336 @@ type ConfigSite struct {
 	CustomdomainsEnabled bool
 	SendgridKey          string
 	UseImgProxy          bool
+	// SmtpAddr is the host:port of the relay feed digests are sent through,
+	// sendgrid is used when it is empty
+	SmtpAddr string
+	SmtpUser string
+	SmtpPass string
+	// InboundEmailSecret is the bearer token mail servers post inbound
+	// emails with, the email gateway is off when it is empty.
+	// InboundEmailAuthservID names the mail server whose
+	// Authentication-Results are trusted, without it no email passes dkim
+	InboundEmailSecret     string
+	InboundEmailAuthservID string
+	// EventBusURL is where services publish events like deploys for each
+	// other, a `nats://`, `tls://` or `redis://` url, empty keeps them in
+	// the process.
+	// Events is the bus opened from it when a server starts
+	EventBusURL string
+	Events      bus.Bus
+	// TraceEndpoint is the OTLP/HTTP collector spans are exported to, e.g.
+	// `http://otel:4318`, tracing is off when it is empty.
+	// Tracer is the exporter started from it when a server starts
+	TraceEndpoint    string
+	TraceService     string
+	TraceHeaders     map[string]string
+	TraceSampleRatio float64
+	Tracer           *tracing.Tracer
+	// ImgVariants are made in the background for every uploaded image
+	ImgVariants []storage.ImgVariant
+	// ImgVariantWorkers is how many variants are made at once
+	ImgVariantWorkers int
+	// LogEncoding logs content-encoding negotiation for served assets
+	// at debug level, sampled by LogEncodingSampler
+	LogEncoding        bool
+	LogEncodingSampler *Sampler
+	// VerifyReads reads objects fully before serving them over ssh to
+	// confirm storage returned as many bytes as it reported
+	VerifyReads bool
+	// AllowedHosts, when set, rejects html uploads whose `src` or `href`
+	// attributes point to hosts not in this list
+	AllowedHosts []string
+	// ListMaxDepth caps how deep `ls -R` walks a bucket
+	ListMaxDepth int
+	// MaxFileSize, when non-zero, rejects any single upload larger than
+	// this many bytes before it is fully read into memory
+	MaxFileSize uint64
+	// MemoryBufferSize is how much of an upload is held in memory, anything
+	// larger is spooled to a temporary file and streamed to storage. Zero
+	// keeps every upload in memory
+	MemoryBufferSize int64
+	// SftpChunkSize is how much of an sftp upload is stored at a time, a
+	// dropped connection resumes from the last stored chunk. 0 stores the
+	// upload once it is complete and disables resuming
+	SftpChunkSize int64
+	// DeniedExt rejects uploads with these extensions, even when they
+	// would otherwise be allowed
+	DeniedExt []string
+	// AllowedTypes and DeniedTypes do the same for the detected content
+	// type, a trailing `/` matches every subtype, e.g. `image/`
+	AllowedTypes []string
+	DeniedTypes  []string
+	// VerifyUploads re-reads every stored object to confirm its checksum,
+	// this doubles storage bandwidth for uploads
+	VerifyUploads bool
+	// SkipUnchanged does not store a file again when its checksum matches
+	// the stored object, uploads with a client checksum always skip
+	SkipUnchanged bool
+	// AllowEmptyFiles silently skips empty uploads instead of erroring,
+	// empty files are never stored either way
+	AllowEmptyFiles bool
+	// RejectCaseCollisions refuses new files whose path only differs in
+	// case from a file already in the project, case-insensitive clients
+	// like macOS and Windows cannot download both
+	RejectCaseCollisions bool
+	// QuotaTiers and DefaultQuota determine a user's storage ceiling when
+	// their feature flag does not set one, see `GetQuotaForUser`
+	QuotaTiers   []QuotaTier
+	DefaultQuota uint64
+	// KeepVersions is how many previous copies of an overwritten file we
+	// keep around, 0 disables versioning. Versions count toward the quota
+	// and are only served over the web with ServeVersions, owners can
+	// always fetch them over ssh
+	KeepVersions  int
+	ServeVersions bool
+	// MaxFilesPerProject caps how many files a project can hold, 0 is
+	// unlimited
+	MaxFilesPerProject int
+	// MaxObjectsPerUser caps how many files a user keeps across every
+	// project, 0 is unlimited
+	MaxObjectsPerUser int
+	// BucketCacheTTL is how long bucket handles are cached, 0 disables it
+	BucketCacheTTL time.Duration
+	// ObjectCacheSize is how many bytes of popular files the web server
+	// keeps in memory, 0 disables it. Files larger than
+	// ObjectCacheMaxObject are never cached.
+	ObjectCacheSize      int64
+	ObjectCacheMaxObject int64
+	// StorageMaxRetries is how many times transient storage errors are
+	// retried, each retry waits twice as long starting at StorageBaseDelay
+	StorageMaxRetries int
+	StorageBaseDelay  time.Duration
+	// DedupStorage keeps each distinct file once per bucket, addressed by
+	// its checksum, and maps paths to it in the database
+	DedupStorage bool
+	// OnUpload and OnDelete are called in their own goroutine once a file
+	// operation finishes, successful or not
+	OnUpload func(UploadEvent)
+	OnDelete func(UploadEvent)
+	// UploadRateLimit throttles each user to this many bytes per second
+	// after an initial UploadBurst, 0 disables throttling
+	UploadRateLimit int64
+	UploadBurst     int64
+	// RequestRateLimit is how many sessions, uploads and commands alike, a
+	// single public key can open per minute after an initial RequestBurst,
+	// 0 disables the limit
+	RequestRateLimit int64
+	RequestBurst     int64
+	// DryRun validates uploads without storing anything
+	DryRun bool
+	// IndexFile is read when a client downloads a directory, defaults to
+	// index.html
+	IndexFile string
+	// StorageConcurrency bounds how many objects a bulk read fetches at once
+	StorageConcurrency int
+	// UploadConcurrency is how many files of a scp or rsync session are
+	// stored at once while the next ones are read, 1 stores them in turn
+	UploadConcurrency int
+	// ExpireInterval is how often expired projects are swept, 0 disables
+	// the sweeper
+	ExpireInterval time.Duration
+	// TrashRetention keeps deleted assets this long for `command restore`,
+	// they count against the quota until TrashInterval purges them. 0
+	// deletes assets right away
+	TrashRetention time.Duration
+	TrashInterval  time.Duration
+	// GCInterval is how often storage is reconciled with the database, 0
+	// disables the worker. It only reports what it finds unless GCWrite
+	GCInterval time.Duration
+	GCWrite    bool
+	// UsageInterval is how often the storage usage uploads account for is
+	// compared with the size of the buckets, 0 disables the worker
+	UsageInterval time.Duration
+	// ResetExpired lets uploads to an expired, not yet swept, project wipe
+	// and revive it instead of rejecting them
+	ResetExpired bool
+	// RequiredFeatures gates uploads behind any one of these feature flags,
+	// empty lets every user upload
+	RequiredFeatures []string
+	// CompressThreshold gzips text assets at rest once they reach this many
+	// bytes, 0 disables it. CompressTypes are the content types considered
+	// text, a trailing `/` matches every subtype
+	CompressThreshold int64
+	CompressTypes     []string
+	// PrecompressThreshold writes brotli and gzip sidecars next to text
+	// assets of at least this many bytes for the web server to pick from,
+	// 0 disables it
+	PrecompressThreshold int64
+	// AtomicDeploys stages scp and rsync uploads and only promotes them to
+	// their projects once the whole session succeeded
+	AtomicDeploys bool
+	// DeferPublish keeps staged uploads across sessions until the user runs
+	// `command publish`, it only applies with AtomicDeploys
+	DeferPublish bool
+	// KeepDeploys snapshots each promoted deploy as an immutable revision
+	// and keeps this many of them around for `command rollback`, it only
+	// applies with AtomicDeploys. Revisions share the files they have in
+	// common through DedupStorage, which it turns on
+	KeepDeploys int
+	// DeployCacheTTL is how long the web server remembers which revision a
+	// project serves, 0 looks it up on every request
+	DeployCacheTTL time.Duration
+	// DeployLockTimeout is how long a session waits for another one that
+	// is writing to the same project before it gives up, 0 lets sessions
+	// write to a project at the same time
+	DeployLockTimeout time.Duration
+	// ExpandArchives unpacks `.tar.gz`, `.tgz` and `.zip` files uploaded to
+	// the root of a project into individual assets instead of storing them
+	ExpandArchives bool
+	// CheckLinks crawls the pages of every project an upload changed once it
+	// is done and keeps the links that lead nowhere for `command lint`
+	CheckLinks bool
+	// Webhooks lets users register urls through `command webhook` that are
+	// notified when their projects change, failed deliveries are retried
+	// WebhookMaxRetries times starting at WebhookBaseDelay
+	Webhooks          bool
+	WebhookMaxRetries int
+	WebhookBaseDelay  time.Duration
+	// PurgeProvider drops what an upload changed from the cache of a cdn in
+	// front of the web server: `cloudflare`, `fastly` or `webhook`, empty
+	// disables it. PurgeZone is the cloudflare zone or fastly service,
+	// PurgeURL is where the webhook is posted or overrides the provider's
+	// api and PurgeToken authenticates the requests. PurgeAll drops the
+	// whole zone instead of the changed urls. Failed purges are retried
+	// like webhooks
+	PurgeProvider string
+	PurgeZone     string
+	PurgeURL      string
+	PurgeToken    string
+	PurgeAll      bool
+	// ScanProvider checks uploads for malware before they are stored:
+	// `clamav` streams them to clamd at ScanURL (host:port), `http` posts
+	// them to ScanURL with ScanToken as a bearer token, empty disables it.
+	// ScanAction is `reject` or `quarantine`, which also keeps a copy for
+	// operators. Files larger than ScanMaxSize are not scanned, 0 scans
+	// everything, and ScanFailOpen stores uploads the scanner failed on
+	ScanProvider string
+	ScanURL      string
+	ScanToken    string
+	ScanAction   string
+	ScanMaxSize  int64
+	ScanFailOpen bool
+	// EnvSecret encrypts the variables set with `command env`, empty
+	// disables them
+	EnvSecret string
+	// BuildGenerators are the static site generators a project's `_build`
+	// file can pick, empty disables builds. Builds run at most
+	// BuildConcurrency at once for BuildTimeout each, with BuildSandbox
+	// (e.g. `bwrap --unshare-net ...`) in front of the generator's command.
+	// Builds stay disabled without a BuildSandbox.
+	BuildGenerators  []string
+	BuildSandbox     []string
+	BuildTimeout     time.Duration
+	BuildConcurrency int
+	// AuthProviders resolve who is behind an ssh key, in order: `db` looks
+	// up registered keys, `allowlist` reads `username key` lines from
+	// AuthAllowlist, `http` asks the key registry at AuthURL with
+	// AuthToken and `command` runs AuthCommand, e.g. an LDAP lookup. Empty
+	// only uses `db`
+	AuthProviders []string
+	AuthAllowlist string
+	AuthURL       string
+	AuthToken     string
+	AuthCommand   string
+	// HTTP2Cleartext lets the web server's plain listener speak http/2
+	// without tls (h2c) for proxies in front of it, https negotiates it on
+	// its own. WebReadTimeout, WebWriteTimeout and WebIdleTimeout bound
+	// how long a client can hold on to a connection, 0 disables each.
+	// AltSvc is sent as the `Alt-Svc` header to advertise http/3, e.g.
+	// `h3=":443"; ma=86400`, when a proxy in front terminates quic
+	HTTP2Cleartext  bool
+	WebReadTimeout  time.Duration
+	WebWriteTimeout time.Duration
+	WebIdleTimeout  time.Duration
+	AltSvc          string
+	// TLSAddr is where the web server also serves https, with TLSCert and
+	// TLSKey for its own hosts, empty disables it. Certificates for
+	// verified project domains are requested from ACMEDirectory with the
+	// account key kept at ACMEAccountKey, through ACMEChallenge: `http-01`
+	// is answered by the web server, `dns-01` publishes records through
+	// ACMEDNSProvider (`cloudflare` or `webhook`) with ACMEDNSZone,
+	// ACMEDNSURL and ACMEDNSToken like the purge provider. CertSecret
+	// encrypts their keys, empty disables issuing. Certificates are renewed
+	// CertRenewBefore they expire, checked every CertRenewInterval
+	TLSAddr           string
+	TLSCert           string
+	TLSKey            string
+	ACMEDirectory     string
+	ACMEAccountKey    string
+	ACMEChallenge     string
+	ACMEDNSProvider   string
+	ACMEDNSZone       string
+	ACMEDNSURL        string
+	ACMEDNSToken      string
+	CertSecret        string
+	CertRenewBefore   time.Duration
+	CertRenewInterval time.Duration
+	// MetricsAddr is where the web server exposes `/metrics`, empty
+	// disables it. The ssh server always exposes them on its prom port
+	MetricsAddr string
+	// TrustedProxies are the proxies in front of us whose X-Forwarded-For,
+	// and PROXY protocol header with ProxyProtocol on the ssh listener,
+	// name the client. Everyone else is taken as the client themselves
+	TrustedProxies clientip.Trusted
+	ProxyProtocol  bool
+	// WebdavAddr is where the ssh server also serves projects over WebDAV,
+	// authenticated with api tokens, empty disables it
+	WebdavAddr string
+	// UploadAPIAddr is where the ssh server also accepts uploads over http
+	// from CI, authenticated with deploy tokens, empty disables it.
+	// UploadReadTimeout bounds how long reading a request to either may
+	// take, uploads need longer than WebReadTimeout
+	UploadAPIAddr     string
+	UploadReadTimeout time.Duration
+	// ShutdownTimeout is how long a stopping ssh server waits for running
+	// uploads and sessions, and a web server for running requests, 0 uses
+	// DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+	// SessionIdleTimeout ends ssh sessions that sent or received nothing
+	// for that long, SessionMaxTimeout ends them after that long no matter
+	// what, 0 disables either. SessionKeepAlive is how often they are
+	// checked and clients are asked whether they are still there
+	SessionIdleTimeout time.Duration
+	SessionMaxTimeout  time.Duration
+	SessionKeepAlive   time.Duration
+	// ReusePort listens with SO_REUSEPORT so a new process can take over
+	// the addresses while the old one drains, sockets passed by systemd
+	// socket activation are used either way
+	ReusePort bool
+	// DefaultShareTTL is how long `share` links last when no ttl is given,
+	// a requested ttl is clamped to MaxShareTTL
+	DefaultShareTTL time.Duration
+	MaxShareTTL     time.Duration
+	// ShowProgress writes periodic upload progress to the client's stderr
+	ShowProgress bool
+	// ProjectDomains resolves custom domains through `project_domains`
+	// before their TXT record, DomainVerifyInterval is how often pending
+	// domains are checked, 0 disables the worker. Verified domains have
+	// their record checked again once it is DomainRecheckAfter old
+	ProjectDomains       bool
+	DomainVerifyInterval time.Duration
+	DomainRecheckAfter   time.Duration
+	// PublishInterval is how often scheduled posts are checked for being
+	// due, 0 disables the worker
+	PublishInterval time.Duration
+	// SocialImages draws a preview image for every post when it is
+	// published, link previews use it unless the post sets its own image
+	SocialImages bool
+	// AnalyticsInterval is how often hit counts are written to the
+	// database, 0 turns analytics off
+	AnalyticsInterval time.Duration
+	// BandwidthInterval is how often the bytes served are written to the
+	// database, 0 turns bandwidth accounting and egress caps off
+	BandwidthInterval time.Duration
+	// EgressTiers and DefaultEgress cap the bytes a user's sites serve in a
+	// calendar month, see `GetEgressForUser`
+	EgressTiers   []QuotaTier
+	DefaultEgress uint64
+	// AccessSecret signs the cookies handed out once someone signed into a
+	// private project and `share` links, the ssh and web servers need the
+	// same one. When it is empty private projects ask for basic auth on
+	// every request and `share` falls back to presigned storage urls
+	AccessSecret string
 }
 
 type CreateURL struct {
@@ -138,6 +471,15 @@ func (c *ConfigSite) RawPostURL(username, slug string) string {
 	return fmt.Sprintf("/raw/%s/%s", username, fname)
 }
 
+func (c *ConfigSite) DownloadPostURL(username, slug string) string {
+	fname := url.PathEscape(slug)
+	if c.IsSubdomains() {
+		return fmt.Sprintf("%s://%s.%s/download/%s", c.Protocol, username, c.Domain, fname)
+	}
+
+	return fmt.Sprintf("/download/%s/%s", username, fname)
+}
+
 func (c *ConfigSite) ImgFullURL(username, slug string) string {
 	fname := url.PathEscape(strings.TrimLeft(slug, "/"))
 	return fmt.Sprintf("%s://%s.%s/%s", c.Protocol, username, c.Domain, fname)
@@ -169,6 +511,22 @@ func (c *ConfigSite) FullPostURL(curl *CreateURL, username, slug string) string
 	return fmt.Sprintf("%s://%s/%s", c.Protocol, curl.HostDomain, fname)
 }
 
+// SocialImageURL is where the preview image of a post is served, link
+// previews need it absolute.
+func (c *ConfigSite) SocialImageURL(curl *CreateURL, username, slug string) string {
+	fname := url.PathEscape(strings.TrimLeft(slug, "/")) + ".png"
+
+	if curl.Subdomain && c.IsSubdomains() {
+		return fmt.Sprintf("%s://%s.%s/_social/%s", c.Protocol, username, c.Domain, fname)
+	}
+
+	if curl.UsernameInRoute {
+		return fmt.Sprintf("%s://%s/%s/_social/%s", c.Protocol, c.Domain, username, fname)
+	}
+
+	return fmt.Sprintf("%s://%s/_social/%s", c.Protocol, curl.HostDomain, fname)
+}
+
 func (c *ConfigSite) RssBlogURL(curl *CreateURL, username, tag string) string {
 	url := ""
 	if c.IsSubdomains() && curl.Subdomain {
@@ -250,12 +608,3 @@ func (c *ConfigSite) AssetURL(username, projectName, fpath string) string {
 		fpath,
 	)
 }
-
-func CreateLogger(debug bool) *slog.Logger {
-	opts := &slog.HandlerOptions{
-		AddSource: true,
-	}
-	return slog.New(
-		slog.NewTextHandler(os.Stdout, opts),
-	)
-}
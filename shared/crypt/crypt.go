@@ -0,0 +1,62 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Box encrypts short secrets, like project variables, before they are
+// stored with AES-GCM keyed by the sha256 of an operator secret.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(secret string) (*Box, error) {
+	if secret == "" {
+		return nil, errors.New("a secret is required to encrypt values")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plain, the nonce is prepended and the result base64
+// encoded so it fits a text column.
+func (b *Box) Seal(plain string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value made by Seal with the same secret.
+func (b *Box) Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	size := b.aead.NonceSize()
+	if len(data) < size {
+		return "", fmt.Errorf("sealed value is too short")
+	}
+	plain, err := b.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,47 @@
+package crypt
+
+import "testing"
+
+func TestBox(t *testing.T) {
+	box, err := NewBox("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := box.Seal("https://api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == "https://api.example.com" {
+		t.Fatal("expected the value to be encrypted")
+	}
+	again, err := box.Seal("https://api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == again {
+		t.Error("expected every seal to use its own nonce")
+	}
+
+	plain, err := box.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != "https://api.example.com" {
+		t.Errorf("expected the original value, found %s", plain)
+	}
+
+	other, err := NewBox("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.Open(sealed)
+	if err == nil {
+		t.Error("expected a different secret to fail")
+	}
+
+	_, err = NewBox("")
+	if err == nil {
+		t.Error("expected an empty secret to be refused")
+	}
+}
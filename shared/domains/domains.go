@@ -0,0 +1,135 @@
+package domains
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+// how many pending domains a single sweep checks at once.
+var claimLimit = 100
+
+var lookupTXT = net.LookupTXT
+
+// VerifyRecord is the TXT record that must hold a domain's token.
+func VerifyRecord(space, domain string) string {
+	return fmt.Sprintf("_%s-verify.%s", space, domain)
+}
+
+// lookup checks the domain's TXT record for its token. A missing record
+// is an answer, err is only set when dns could not be asked.
+func lookup(space string, domain *db.ProjectDomain) (bool, error) {
+	records, err := lookupTXT(VerifyRecord(space, domain.Domain))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.Token {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsVerified checks the domain's TXT record for its token.
+func IsVerified(space string, domain *db.ProjectDomain) bool {
+	found, _ := lookup(space, domain)
+	return found
+}
+
+// Recheck looks up the TXT record of a verified domain again. A domain
+// whose record is gone stops being served until a sweep finds it again,
+// one that could not be looked up is left alone and retried later.
+func Recheck(dbpool db.DB, space string, domain *db.ProjectDomain, logger *slog.Logger) bool {
+	found, err := lookup(space, domain)
+	if err != nil {
+		logger.Error("could not recheck domain", "domain", domain.Domain, "err", err.Error())
+		return false
+	}
+
+	if !found {
+		err = dbpool.UnverifyProjectDomain(domain.ID)
+		if err != nil {
+			logger.Error("could not unverify domain", "domain", domain.Domain, "err", err.Error())
+			return false
+		}
+		logger.Info(
+			"project domain lost its verification record",
+			"domain", domain.Domain,
+			"project", domain.ProjectName,
+		)
+		return false
+	}
+
+	err = dbpool.VerifyProjectDomain(domain.ID)
+	if err != nil {
+		logger.Error("could not verify domain", "domain", domain.Domain, "err", err.Error())
+	}
+	return true
+}
+
+// Sweep checks pending domains and marks the ones whose TXT record holds
+// their token as verified. Domains that fail are checked again by a later
+// sweep. Verified domains last checked more than recheckAfter ago are
+// checked again, 0 never does.
+func Sweep(dbpool db.DB, space string, recheckAfter time.Duration, logger *slog.Logger) (int, error) {
+	domains, err := dbpool.FindUnverifiedDomains(claimLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	verified := 0
+	for _, domain := range domains {
+		if !IsVerified(space, domain) {
+			continue
+		}
+
+		err = dbpool.VerifyProjectDomain(domain.ID)
+		if err != nil {
+			logger.Error("could not verify domain", "domain", domain.Domain, "err", err.Error())
+			continue
+		}
+
+		logger.Info(
+			"verified project domain",
+			"domain", domain.Domain,
+			"project", domain.ProjectName,
+		)
+		verified += 1
+	}
+
+	if recheckAfter <= 0 {
+		return verified, nil
+	}
+	stale, err := dbpool.FindDomainsToRecheck(time.Now().Add(-recheckAfter), claimLimit)
+	if err != nil {
+		return verified, err
+	}
+	for _, domain := range stale {
+		Recheck(dbpool, space, domain, logger)
+	}
+
+	return verified, nil
+}
+
+// Run sweeps pending domains every interval, it never returns.
+func Run(dbpool db.DB, space string, interval, recheckAfter time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := Sweep(dbpool, space, recheckAfter, logger)
+		if err != nil {
+			logger.Error("could not sweep project domains", "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package domains
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+type fakeDB struct {
+	db.DB
+	domains    []*db.ProjectDomain
+	stale      []*db.ProjectDomain
+	verified   []string
+	unverified []string
+}
+
+func (f *fakeDB) FindUnverifiedDomains(limit int) ([]*db.ProjectDomain, error) {
+	return f.domains, nil
+}
+
+func (f *fakeDB) FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	return f.stale, nil
+}
+
+func (f *fakeDB) UnverifyProjectDomain(domainID string) error {
+	f.unverified = append(f.unverified, domainID)
+	return nil
+}
+
+func (f *fakeDB) VerifyProjectDomain(domainID string) error {
+	f.verified = append(f.verified, domainID)
+	return nil
+}
+
+func TestSweep(t *testing.T) {
+	records := map[string][]string{
+		"_pgs-verify.good.com":  {"nope", " token-1 "},
+		"_pgs-verify.wrong.com": {"token-1"},
+	}
+	lookupTXT = func(name string) ([]string, error) {
+		if txt, ok := records[name]; ok {
+			return txt, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+
+	dbpool := &fakeDB{domains: []*db.ProjectDomain{
+		{ID: "1", Domain: "good.com", Token: "token-1"},
+		{ID: "2", Domain: "wrong.com", Token: "token-2"},
+		{ID: "3", Domain: "missing.com", Token: "token-3"},
+	}}
+
+	count, err := Sweep(dbpool, "pgs", 0, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected one verified domain, found %d", count)
+	}
+	if diff := cmp.Diff([]string{"1"}, dbpool.verified); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSweepRecheck(t *testing.T) {
+	records := map[string][]string{
+		"_pgs-verify.good.com":  {"token-1"},
+		"_pgs-verify.moved.com": {"someone-else"},
+	}
+	lookupTXT = func(name string) ([]string, error) {
+		if txt, ok := records[name]; ok {
+			return txt, nil
+		}
+		if name == "_pgs-verify.flaky.com" {
+			return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	dbpool := &fakeDB{stale: []*db.ProjectDomain{
+		{ID: "1", Domain: "good.com", Token: "token-1"},
+		{ID: "2", Domain: "moved.com", Token: "token-2"},
+		{ID: "3", Domain: "gone.com", Token: "token-3"},
+		{ID: "4", Domain: "flaky.com", Token: "token-4"},
+	}}
+
+	_, err := Sweep(dbpool, "pgs", time.Hour, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"1"}, dbpool.verified); diff != "" {
+		t.Error(diff)
+	}
+	// a failed lookup is not proof the record is gone
+	if diff := cmp.Diff([]string{"2", "3"}, dbpool.unverified); diff != "" {
+		t.Error(diff)
+	}
+}
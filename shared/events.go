@@ -0,0 +1,16 @@
+package shared
+
+import (
+	"time"
+)
+
+// UploadEvent describes a finished upload or delete, it is handed to the
+// `OnUpload` and `OnDelete` hooks on `ConfigSite`.
+type UploadEvent struct {
+	User     string
+	Project  string
+	Filename string
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
@@ -0,0 +1,132 @@
+package expire
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// how many expired projects a single sweep claims at once.
+var claimLimit = 100
+
+// PurgeProject removes every asset of a project, links share their assets
+// with the project they point to so only the row is removed for those.
+func PurgeProject(st storage.StorageServe, bucket sst.Bucket, project *db.Project) (int, int64, error) {
+	if project.Name != project.ProjectDir {
+		return 0, 0, nil
+	}
+	return storage.DeleteObjects(st, bucket, project.Name)
+}
+
+// PurgeRevisions removes every revision of a project along with its row so
+// nothing keeps serving a purged project.
+func PurgeRevisions(dbpool db.DB, st storage.StorageServe, bucket sst.Bucket, project *db.Project) (int, int64, error) {
+	count := 0
+	size := int64(0)
+
+	deploys, err := dbpool.FindProjectDeploys(project.ID)
+	if err != nil {
+		return count, size, err
+	}
+	for _, deploy := range deploys {
+		c, s, err := storage.DeleteObjects(st, bucket, storage.DeployName(project.Name, deploy.Revision))
+		count += c
+		size += s
+		if err != nil {
+			return count, size, err
+		}
+		err = dbpool.RemoveProjectDeploy(deploy.ID)
+		if err != nil {
+			return count, size, err
+		}
+	}
+	return count, size, nil
+}
+
+// Sweep claims expired projects and purges their storage and rows. Claiming
+// first means multiple instances can sweep at the same time without
+// stepping on each other, a claim that is never finished is picked up again
+// by a later sweep.
+func Sweep(dbpool db.DB, st storage.StorageServe, logger *slog.Logger) (int, error) {
+	projects, err := dbpool.ClaimExpiredProjects(claimLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, project := range projects {
+		// linked projects are not claimed, this catches a link made since
+		links, err := dbpool.FindProjectLinks(project.UserID, project.Name)
+		if err != nil {
+			logger.Error("could not find project links", "project", project.Name, "err", err.Error())
+			continue
+		}
+		if len(links) > 0 {
+			logger.Info(
+				"skipping expired project with links",
+				"userID", project.UserID,
+				"project", project.Name,
+				"links", len(links),
+			)
+			continue
+		}
+
+		count := 0
+		size := int64(0)
+		// no bucket means there is nothing to purge
+		bucket, bucketErr := st.GetBucket(shared.GetAssetBucketName(project.UserID))
+		if bucketErr == nil {
+			count, size, err = PurgeProject(st, bucket, project)
+			if err == nil {
+				_, revSize, revErr := PurgeRevisions(dbpool, st, bucket, project)
+				size += revSize
+				err = revErr
+			}
+		}
+		if err != nil {
+			logger.Error(
+				"could not purge expired project",
+				"userID", project.UserID,
+				"project", project.Name,
+				"count", count,
+				"err", err.Error(),
+			)
+			continue
+		}
+
+		err = dbpool.RemoveProject(project.ID)
+		if err != nil {
+			logger.Error("could not remove expired project", "project", project.Name, "err", err.Error())
+			continue
+		}
+
+		logger.Info(
+			"removed expired project",
+			"userID", project.UserID,
+			"project", project.Name,
+			"expiresAt", project.ExpiresAt,
+			"count", count,
+			"size", shared.HumanSize(size),
+		)
+		removed += 1
+	}
+
+	return removed, nil
+}
+
+// Run sweeps expired projects every interval, it never returns.
+func Run(dbpool db.DB, st storage.StorageServe, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := Sweep(dbpool, st, logger)
+		if err != nil {
+			logger.Error("could not sweep expired projects", "err", err.Error())
+		}
+	}
+}
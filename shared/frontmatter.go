@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/parser"
+	gtext "github.com/yuin/goldmark/text"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var tomlDelim = []byte("+++")
+
+// parseFrontMatter reads the yaml front matter between `---` or the toml
+// front matter between `+++`. Toml is handed back the way goldmark-meta
+// returns yaml and cut from the body since goldmark would render it.
+func parseFrontMatter(text []byte) (map[string]interface{}, yaml.MapSlice, []byte, error) {
+	if !bytes.HasPrefix(text, tomlDelim) {
+		context := parser.NewContext()
+		goldmark.New(goldmark.WithExtensions(meta.Meta)).Parser().Parse(
+			gtext.NewReader(text),
+			parser.WithContext(context),
+		)
+		return meta.Get(context), meta.GetItems(context), text, nil
+	}
+
+	lines := bytes.SplitAfter(text, []byte("\n"))
+	if len(bytes.TrimSpace(lines[0])) != len(tomlDelim) {
+		return map[string]interface{}{}, yaml.MapSlice{}, text, nil
+	}
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if bytes.Equal(bytes.TrimSpace(lines[i]), tomlDelim) {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, nil, text, fmt.Errorf("front-matter: missing closing (%s)", tomlDelim)
+	}
+
+	var data map[string]interface{}
+	md, err := toml.Decode(string(bytes.Join(lines[1:end], nil)), &data)
+	if err != nil {
+		return nil, nil, text, fmt.Errorf("front-matter: %w", err)
+	}
+	items := tomlItems(md, data, nil)
+	metaData := map[string]interface{}{}
+	for _, item := range items {
+		metaData[item.Key.(string)] = item.Value
+	}
+	return metaData, items, bytes.Join(lines[end+1:], nil), nil
+}
+
+// tomlItems orders a table like it was written, the way yaml.MapSlice
+// keeps nav links in order.
+func tomlItems(md toml.MetaData, table map[string]interface{}, prefix toml.Key) yaml.MapSlice {
+	items := yaml.MapSlice{}
+	seen := map[string]bool{}
+	add := func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		value := table[key]
+		if sub, ok := value.(map[string]interface{}); ok {
+			path := append(append(toml.Key{}, prefix...), key)
+			items = append(items, yaml.MapItem{Key: key, Value: tomlItems(md, sub, path)})
+			return
+		}
+		items = append(items, yaml.MapItem{Key: key, Value: tomlValue(value)})
+	}
+
+	for _, key := range md.Keys() {
+		if len(key) == len(prefix)+1 && key[:len(prefix)].String() == prefix.String() {
+			add(key[len(prefix)])
+		}
+	}
+	// keys inside arrays of tables are not in md.Keys
+	rest := []string{}
+	for key := range table {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		add(key)
+	}
+	return items
+}
+
+// tomlValue turns what toml decodes into what yaml would have given us.
+func tomlValue(value interface{}) interface{} {
+	switch val := value.(type) {
+	case int64:
+		return int(val)
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case map[string]interface{}:
+		return tomlItems(toml.MetaData{}, val, nil)
+	case []map[string]interface{}:
+		list := []interface{}{}
+		for _, table := range val {
+			list = append(list, tomlItems(toml.MetaData{}, table, nil))
+		}
+		return list
+	case []interface{}:
+		list := []interface{}{}
+		for _, item := range val {
+			list = append(list, tomlValue(item))
+		}
+		return list
+	}
+	return value
+}
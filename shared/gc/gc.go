@@ -0,0 +1,458 @@
+package gc
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/build"
+	"github.com/picosh/pico/shared/linkcheck"
+	"github.com/picosh/pico/shared/social"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/trash"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// kinds of records that are checked
+const (
+	KindProject  = "project"
+	KindRevision = "revision"
+	KindLink     = "link"
+	KindObject   = "object"
+	KindImage    = "image"
+	KindTrash    = "trash"
+)
+
+// ReservedDirs are kept at the top of a bucket next to the projects by the
+// packages that own them, they are never projects of their own.
+var ReservedDirs = []string{
+	storage.ObjectsDir,
+	storage.StagingDir,
+	storage.UploadsDir,
+	trash.Dir,
+	build.LogDir,
+	social.Dir,
+	linkcheck.Dir,
+}
+
+// space imgs stores its image posts in
+var imgsSpace = "imgs"
+
+// DefaultGrace is how old something has to be before Reconcile calls it an
+// orphan, a project row is written before its first object so anything
+// younger can still be in the middle of an upload.
+var DefaultGrace = time.Hour
+
+type Options struct {
+	// Write removes what was found, without it Reconcile only reports
+	Write bool
+	Grace time.Duration
+}
+
+// Finding is a record on one side without its counterpart on the other,
+// Orphan means objects without a row, otherwise a row without objects.
+// Empty projects are only reported, their rows are never removed.
+type Finding struct {
+	UserID  string
+	Kind    string
+	Name    string
+	Orphan  bool
+	Removed bool
+	remove  func() error
+	// object is set for a single orphaned object, those are removed
+	// together per bucket instead of through remove
+	object string
+	bucket sst.Bucket
+}
+
+func (f *Finding) String() string {
+	side := "row without objects"
+	if f.Orphan {
+		side = "objects without a row"
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\t%s", f.UserID, f.Kind, f.Name, side)
+	if f.Removed {
+		line += "\t(removed)"
+	}
+	return line
+}
+
+type checker struct {
+	dbpool db.DB
+	st     storage.StorageServe
+	opts   Options
+	now    time.Time
+}
+
+func (c *checker) old(t *time.Time) bool {
+	return t == nil || t.Before(c.now.Add(-c.opts.Grace))
+}
+
+// newest is the latest modification of any object below prefix, false
+// when there are none left, e.g. an empty directory on the fs backend.
+func (c *checker) newest(bucket sst.Bucket, prefix string) (time.Time, bool, error) {
+	latest := time.Time{}
+	entries, err := storage.WalkObjects(c.st, bucket, prefix)
+	if err != nil {
+		return latest, false, err
+	}
+	for _, entry := range entries {
+		if entry.ModTime().After(latest) {
+			latest = entry.ModTime()
+		}
+	}
+	return latest, len(entries) > 0, nil
+}
+
+// assets compares the top level of a pgs bucket with the projects and
+// revisions of its user.
+func (c *checker) assets(user *db.User, bucket sst.Bucket) ([]*Finding, error) {
+	findings := []*Finding{}
+	projects, err := c.dbpool.FindProjectsByUser(user.ID)
+	if err != nil {
+		return findings, err
+	}
+	top, err := c.st.ListObjects(bucket, "/", false)
+	if err != nil {
+		return findings, err
+	}
+	stored := map[string]bool{}
+	for _, file := range top {
+		stored[strings.Trim(file.Name(), "/")] = true
+	}
+
+	dirs := map[string]*db.Project{}
+	revisions := map[string]bool{}
+	for _, project := range projects {
+		if project.Name != project.ProjectDir {
+			continue
+		}
+		dirs[project.Name] = project
+		deploys, err := c.dbpool.FindProjectDeploys(project.ID)
+		if err != nil {
+			return findings, err
+		}
+		for _, deploy := range deploys {
+			revisions[storage.DeployName(project.Name, deploy.Revision)] = true
+		}
+	}
+
+	for _, file := range top {
+		name := strings.Trim(file.Name(), "/")
+		if name == "" || slices.Contains(ReservedDirs, name) {
+			continue
+		}
+		kind := KindProject
+		if !file.IsDir() {
+			kind = KindObject
+		} else if storage.IsDeploy(name) {
+			kind = KindRevision
+		}
+		if (kind == KindProject && dirs[name] != nil) || (kind == KindRevision && revisions[name]) {
+			continue
+		}
+
+		modTime := file.ModTime()
+		if file.IsDir() {
+			var found bool
+			modTime, found, err = c.newest(bucket, name)
+			if err != nil {
+				return findings, err
+			}
+			if !found {
+				continue
+			}
+		}
+		if !c.old(&modTime) {
+			continue
+		}
+		if kind == KindObject {
+			findings = append(findings, &Finding{
+				UserID: user.ID,
+				Kind:   kind,
+				Name:   name,
+				Orphan: true,
+				object: name,
+				bucket: bucket,
+			})
+			continue
+		}
+		prefix := name
+		findings = append(findings, &Finding{
+			UserID: user.ID,
+			Kind:   kind,
+			Name:   name,
+			Orphan: true,
+			remove: func() error {
+				_, _, err := storage.DeleteObjects(c.st, bucket, prefix)
+				return err
+			},
+		})
+	}
+
+	for _, project := range projects {
+		kind := KindProject
+		missing := project.Name == project.ProjectDir && !stored[project.Name]
+		if project.Name != project.ProjectDir {
+			kind = KindLink
+			missing = dirs[project.ProjectDir] == nil
+		}
+		if !missing || !c.old(project.UpdatedAt) {
+			continue
+		}
+		finding := &Finding{
+			UserID: user.ID,
+			Kind:   kind,
+			Name:   project.Name,
+		}
+		// a project without files is still the user's, e.g. one that was
+		// emptied to deploy again, only links to nothing are removed
+		if kind == KindLink {
+			id := project.ID
+			finding.remove = func() error { return c.dbpool.RemoveProject(id) }
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// trash compares the objects kept in the trash with their rows.
+func (c *checker) trash(user *db.User, bucket sst.Bucket) ([]*Finding, error) {
+	findings := []*Finding{}
+	objs, err := c.dbpool.FindTrashObjects(user.ID)
+	if err != nil {
+		return findings, err
+	}
+	entries, err := storage.WalkObjects(c.st, bucket, trash.Dir)
+	if err != nil {
+		return findings, err
+	}
+
+	rows := map[string]bool{}
+	for _, obj := range objs {
+		rows[obj.TrashPath] = true
+	}
+	stored := map[string]bool{}
+	for _, entry := range entries {
+		stored[entry.Path] = true
+		modTime := entry.ModTime()
+		if rows[entry.Path] || !c.old(&modTime) {
+			continue
+		}
+		findings = append(findings, &Finding{
+			UserID: user.ID,
+			Kind:   KindTrash,
+			Name:   entry.Path,
+			Orphan: true,
+			object: entry.Path,
+			bucket: bucket,
+		})
+	}
+
+	for _, obj := range objs {
+		if stored[obj.TrashPath] || !c.old(obj.CreatedAt) {
+			continue
+		}
+		id := obj.ID
+		findings = append(findings, &Finding{
+			UserID: user.ID,
+			Kind:   KindTrash,
+			Name:   obj.TrashPath,
+			remove: func() error { return c.dbpool.RemoveTrashObject(id) },
+		})
+	}
+
+	return findings, nil
+}
+
+// images compares an imgs bucket with the image posts of its user,
+// variants belong to the image they were made from.
+func (c *checker) images(user *db.User, bucket sst.Bucket) ([]*Finding, error) {
+	findings := []*Finding{}
+	posts, err := c.dbpool.FindAllPostsForUser(user.ID, imgsSpace)
+	if err != nil {
+		return findings, err
+	}
+	entries, err := storage.WalkObjects(c.st, bucket, "")
+	if err != nil {
+		return findings, err
+	}
+
+	names := map[string]bool{}
+	for _, post := range posts {
+		names[post.Filename] = true
+	}
+	stored := map[string]bool{}
+	for _, entry := range entries {
+		stored[entry.Path] = true
+		base, variant := storage.VariantBase(entry.Path)
+		if names[base] || (variant && names[strings.TrimSuffix(base, path.Ext(base))]) {
+			continue
+		}
+		modTime := entry.ModTime()
+		if !c.old(&modTime) {
+			continue
+		}
+		findings = append(findings, &Finding{
+			UserID: user.ID,
+			Kind:   KindImage,
+			Name:   entry.Path,
+			Orphan: true,
+			object: entry.Path,
+			bucket: bucket,
+		})
+	}
+
+	for _, post := range posts {
+		if stored[post.Filename] || !c.old(post.UpdatedAt) {
+			continue
+		}
+		id := post.ID
+		findings = append(findings, &Finding{
+			UserID: user.ID,
+			Kind:   KindImage,
+			Name:   post.Filename,
+			remove: func() error { return c.dbpool.RemovePosts([]string{id}) },
+		})
+	}
+
+	return findings, nil
+}
+
+func (c *checker) user(user *db.User, logger *slog.Logger) []*Finding {
+	findings := []*Finding{}
+	collect := func(what string, found []*Finding, err error) {
+		if err != nil {
+			logger.Error("could not check "+what, "userID", user.ID, "err", err.Error())
+			return
+		}
+		findings = append(findings, found...)
+	}
+
+	// a user without a bucket has nothing stored to compare against, rows
+	// are only ever called dangling next to a bucket we could read
+	bucket, err := c.st.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err == nil {
+		found, err := c.assets(user, bucket)
+		collect("assets", found, err)
+		found, err = c.trash(user, bucket)
+		collect("trash", found, err)
+	}
+
+	bucket, err = c.st.GetBucket(shared.GetImgsBucketName(user.ID))
+	if err == nil {
+		found, err := c.images(user, bucket)
+		collect("images", found, err)
+	}
+	return findings
+}
+
+// removeObjects deletes the orphaned objects among findings with one batch
+// per bucket.
+func (c *checker) removeObjects(findings []*Finding, logger *slog.Logger) {
+	batches := map[string][]*Finding{}
+	for _, finding := range findings {
+		if finding.object != "" {
+			batches[finding.bucket.Name] = append(batches[finding.bucket.Name], finding)
+		}
+	}
+
+	for _, batch := range batches {
+		fpaths := make([]string, 0, len(batch))
+		for _, finding := range batch {
+			fpaths = append(fpaths, finding.object)
+		}
+		errs := c.st.BatchDelete(batch[0].bucket, fpaths)
+		for _, finding := range batch {
+			if err, ok := errs[finding.object]; ok {
+				logger.Error("could not remove", "userID", finding.UserID, "kind", finding.Kind, "name", finding.Name, "err", err.Error())
+				continue
+			}
+			finding.Removed = true
+		}
+	}
+}
+
+// abortUploads aborts the multipart uploads of the user that were never
+// resumed, their parts are not counted towards any quota.
+func (c *checker) abortUploads(user *db.User, logger *slog.Logger) {
+	bucket, err := c.st.GetBucket(shared.GetAssetBucketName(user.ID))
+	if err != nil {
+		return
+	}
+	count, err := c.st.AbortStaleMultipartUploads(bucket, c.now.Add(-storage.UploadTTL))
+	if err != nil {
+		logger.Error("could not abort stale uploads", "userID", user.ID, "err", err.Error())
+		return
+	}
+	if count > 0 {
+		logger.Info("aborted stale uploads", "userID", user.ID, "count", count)
+	}
+}
+
+// Reconcile cross-checks what is in storage with the database for every
+// user, what it finds is only removed with `Options.Write`. Stale
+// multipart uploads are aborted with it too. A check that
+// fails is logged and skipped so it never removes anything based on half
+// a listing.
+func Reconcile(dbpool db.DB, st storage.StorageServe, opts Options, logger *slog.Logger) ([]*Finding, error) {
+	if opts.Grace <= 0 {
+		opts.Grace = DefaultGrace
+	}
+	c := &checker{dbpool: dbpool, st: st, opts: opts, now: time.Now()}
+
+	users, err := dbpool.FindUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []*Finding{}
+	for _, user := range users {
+		found := c.user(user, logger)
+		for _, finding := range found {
+			logger.Info(
+				"found inconsistency",
+				"userID", finding.UserID,
+				"kind", finding.Kind,
+				"name", finding.Name,
+				"orphan", finding.Orphan,
+			)
+			if !opts.Write || finding.object != "" || finding.remove == nil {
+				continue
+			}
+			err := finding.remove()
+			if err != nil {
+				logger.Error("could not remove", "userID", finding.UserID, "kind", finding.Kind, "name", finding.Name, "err", err.Error())
+				continue
+			}
+			finding.Removed = true
+		}
+		if opts.Write {
+			c.removeObjects(found, logger)
+			c.abortUploads(user, logger)
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+// Run reconciles every interval, it never returns.
+func Run(dbpool db.DB, st storage.StorageServe, interval time.Duration, opts Options, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		findings, err := Reconcile(dbpool, st, opts, logger)
+		if err != nil {
+			logger.Error("could not reconcile storage", "err", err.Error())
+			continue
+		}
+		logger.Info("reconciled storage", "found", len(findings), "write", opts.Write)
+	}
+}
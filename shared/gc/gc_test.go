@@ -0,0 +1,190 @@
+package gc
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type gcDB struct {
+	db.DB
+	projects []*db.Project
+	deploys  map[string][]*db.ProjectDeploy
+	trash    []*db.TrashObject
+	posts    []*db.Post
+}
+
+func (f *gcDB) FindUsers() ([]*db.User, error) {
+	return []*db.User{{ID: "1", Name: "test"}}, nil
+}
+
+func (f *gcDB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	return f.projects, nil
+}
+
+func (f *gcDB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	return f.deploys[projectID], nil
+}
+
+func (f *gcDB) RemoveProject(projectID string) error {
+	f.projects = slices.DeleteFunc(f.projects, func(p *db.Project) bool { return p.ID == projectID })
+	return nil
+}
+
+func (f *gcDB) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	return f.trash, nil
+}
+
+func (f *gcDB) RemoveTrashObject(id string) error {
+	f.trash = slices.DeleteFunc(f.trash, func(obj *db.TrashObject) bool { return obj.ID == id })
+	return nil
+}
+
+func (f *gcDB) FindAllPostsForUser(userID, space string) ([]*db.Post, error) {
+	return f.posts, nil
+}
+
+func (f *gcDB) RemovePosts(postIDs []string) error {
+	f.posts = slices.DeleteFunc(f.posts, func(post *db.Post) bool { return slices.Contains(postIDs, post.ID) })
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	put := func(bucketName string, mtime time.Time, fpaths ...string) {
+		bucket, err := st.UpsertBucket(bucketName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fpath := range fpaths {
+			_, err := st.PutObject(bucket, fpath, utils.NopReaderAtCloser(strings.NewReader("hi")), &utils.FileEntry{Mtime: mtime.Unix()})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put("static-1", old,
+		"blog/index.html",
+		"blog@1/index.html",
+		"blog@2/index.html",
+		"orphan/index.html",
+		"stray.html",
+		".staging/pending/blog/index.html",
+		".uploads/blog/big.html",
+		".objects/ab/abcd",
+		".trash/1/blog/a.html",
+		".trash/2/blog/b.html",
+	)
+	put("static-1", time.Now(), "fresh/index.html")
+	put("1", old, "cat.jpg", "_variants/t/cat.jpg.webp", "dog.jpg")
+
+	dbpool := &gcDB{
+		projects: []*db.Project{
+			{ID: "p1", Name: "blog", ProjectDir: "blog", UpdatedAt: &old},
+			{ID: "p2", Name: "docs", ProjectDir: "docs", UpdatedAt: &old},
+			{ID: "p3", Name: "www", ProjectDir: "gone", UpdatedAt: &old},
+			{ID: "p4", Name: "new", ProjectDir: "new", UpdatedAt: &[]time.Time{time.Now()}[0]},
+		},
+		deploys: map[string][]*db.ProjectDeploy{"p1": {{Revision: 1}}},
+		trash: []*db.TrashObject{
+			{ID: "t1", TrashPath: ".trash/1/blog/a.html", CreatedAt: &old},
+			{ID: "t2", TrashPath: ".trash/3/blog/c.html", CreatedAt: &old},
+		},
+		posts: []*db.Post{
+			{ID: "i1", Filename: "cat.jpg", UpdatedAt: &old},
+			{ID: "i2", Filename: "lost.jpg", UpdatedAt: &old},
+		},
+	}
+
+	expected := []string{
+		"1\timage\tdog.jpg\tobjects without a row",
+		"1\timage\tlost.jpg\trow without objects",
+		"1\tlink\twww\trow without objects",
+		"1\tobject\tstray.html\tobjects without a row",
+		"1\tproject\tdocs\trow without objects",
+		"1\tproject\torphan\tobjects without a row",
+		"1\trevision\tblog@2\tobjects without a row",
+		"1\ttrash\t.trash/2/blog/b.html\tobjects without a row",
+		"1\ttrash\t.trash/3/blog/c.html\trow without objects",
+	}
+	lines := func(findings []*Finding) []string {
+		found := []string{}
+		for _, finding := range findings {
+			found = append(found, strings.TrimSuffix(finding.String(), "\t(removed)"))
+		}
+		slices.Sort(found)
+		return found
+	}
+
+	findings, err := Reconcile(dbpool, st, Options{}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, lines(findings)); diff != "" {
+		t.Fatal(diff)
+	}
+	if len(dbpool.projects) != 4 || len(dbpool.trash) != 2 || len(dbpool.posts) != 2 {
+		t.Fatal("expected a dry run to leave everything in place")
+	}
+
+	findings, err = Reconcile(dbpool, st, Options{Write: true}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, lines(findings)); diff != "" {
+		t.Fatal(diff)
+	}
+	for _, finding := range findings {
+		// an empty project keeps its row
+		if finding.Removed == (finding.Kind == KindProject && !finding.Orphan) {
+			t.Errorf("unexpected removal of (%s)", finding)
+		}
+	}
+
+	findings, err = Reconcile(dbpool, st, Options{}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"1\tproject\tdocs\trow without objects"}, lines(findings)); diff != "" {
+		t.Fatalf("expected only the empty project left to reconcile: %s", diff)
+	}
+	bucket, _ := st.GetBucket("static-1")
+	for _, fpath := range []string{"blog/index.html", "blog@1/index.html", "fresh/index.html", ".staging/pending/blog/index.html", ".uploads/blog/big.html", ".objects/ab/abcd"} {
+		if _, err := st.GetObjectSize(bucket, fpath); err != nil {
+			t.Errorf("expected (%s) to be kept", fpath)
+		}
+	}
+	// uploads that were never resumed are aborted once they are stale
+	_, err = st.CreateMultipartUpload(bucket, ".uploads/blog/big.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Reconcile(dbpool, st, Options{Write: true}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.FindMultipartUpload(bucket, ".uploads/blog/big.html"); err != nil {
+		t.Fatal("expected a fresh upload to be kept")
+	}
+	ttl := storage.UploadTTL
+	storage.UploadTTL = 0
+	defer func() { storage.UploadTTL = ttl }()
+	_, err = Reconcile(dbpool, st, Options{Write: true}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.FindMultipartUpload(bucket, ".uploads/blog/big.html"); err == nil {
+		t.Error("expected a stale upload to be aborted")
+	}
+}
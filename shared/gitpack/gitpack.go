@@ -0,0 +1,199 @@
+package gitpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ZeroID is the object id of a ref that does not exist, it is the old id
+// of a new branch and the new id of a deleted one.
+const ZeroID = "0000000000000000000000000000000000000000"
+
+// Capabilities are what we tell clients receive-pack supports, refs are
+// never deleted.
+var Capabilities = []string{"report-status", "side-band-64k", "ofs-delta", "quiet", "agent=pico"}
+
+// pkt-lines carry at most this much data after their length.
+const maxPktData = 65516
+
+var errFlush = errors.New("flush")
+
+// WritePkt writes data as a pkt-line.
+func WritePkt(w io.Writer, data []byte) error {
+	_, err := fmt.Fprintf(w, "%04x", len(data)+4)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteFlush ends a list of pkt-lines.
+func WriteFlush(w io.Writer) error {
+	_, err := w.Write([]byte("0000"))
+	return err
+}
+
+// ReadPkt reads the next pkt-line, a flush returns errFlush.
+func ReadPkt(r io.Reader) ([]byte, error) {
+	head := make([]byte, 4)
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseUint(string(head), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length (%s)", head)
+	}
+	if size == 0 {
+		return nil, errFlush
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("invalid pkt-line length (%d)", size)
+	}
+	data := make([]byte, size-4)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+// Advertise sends the refs we know of, there are none since every push is
+// deployed from scratch, so only the capabilities are sent.
+func Advertise(w io.Writer) error {
+	line := fmt.Sprintf("%s capabilities^{}\x00%s\n", ZeroID, strings.Join(Capabilities, " "))
+	err := WritePkt(w, []byte(line))
+	if err != nil {
+		return err
+	}
+	return WriteFlush(w)
+}
+
+// Command is a ref the client asks us to update.
+type Command struct {
+	Old string
+	New string
+	Ref string
+}
+
+func (c Command) IsDelete() bool {
+	return c.New == ZeroID
+}
+
+// Request is what the client sent before the pack.
+type Request struct {
+	Commands     []Command
+	Capabilities []string
+}
+
+func (r *Request) Has(capability string) bool {
+	for _, c := range r.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadRequest reads the commands up to their flush, the first one also
+// carries the capabilities the client picked.
+func ReadRequest(r io.Reader) (*Request, error) {
+	req := &Request{}
+	for {
+		line, err := ReadPkt(r)
+		if errors.Is(err, errFlush) {
+			return req, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if caps, rest, ok := bytes.Cut(line, []byte{0}); ok {
+			line = caps
+			req.Capabilities = strings.Fields(string(rest))
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) != 3 || len(fields[0]) != 40 || len(fields[1]) != 40 {
+			return nil, fmt.Errorf("invalid command (%s)", line)
+		}
+		req.Commands = append(req.Commands, Command{Old: fields[0], New: fields[1], Ref: fields[2]})
+	}
+}
+
+// Sideband multiplexes pack data, progress and errors on one stream when
+// the client asked for side-band-64k, otherwise everything but the data is
+// dropped.
+type Sideband struct {
+	w       io.Writer
+	enabled bool
+}
+
+func NewSideband(w io.Writer, enabled bool) *Sideband {
+	return &Sideband{w: w, enabled: enabled}
+}
+
+func (s *Sideband) band(n byte, data []byte) error {
+	if !s.enabled {
+		if n == 1 {
+			_, err := s.w.Write(data)
+			return err
+		}
+		return nil
+	}
+	for len(data) > 0 {
+		chunk := data[:min(len(data), maxPktData-1)]
+		data = data[len(chunk):]
+		err := WritePkt(s.w, append([]byte{n}, chunk...))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Progress shows msg as `remote: msg` on the client.
+func (s *Sideband) Progress(msg string) error {
+	return s.band(2, []byte(msg+"\n"))
+}
+
+// Status is the result of a command, an empty Err means it was applied.
+type Status struct {
+	Ref string
+	Err string
+}
+
+// Report sends the report-status the client prints after a push.
+func (s *Sideband) Report(unpackErr error, statuses []Status) error {
+	buf := &bytes.Buffer{}
+	unpack := "unpack ok\n"
+	if unpackErr != nil {
+		unpack = fmt.Sprintf("unpack %s\n", unpackErr)
+	}
+	err := WritePkt(buf, []byte(unpack))
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		line := fmt.Sprintf("ok %s\n", status.Ref)
+		if status.Err != "" {
+			line = fmt.Sprintf("ng %s %s\n", status.Ref, status.Err)
+		}
+		err := WritePkt(buf, []byte(line))
+		if err != nil {
+			return err
+		}
+	}
+	err = WriteFlush(buf)
+	if err != nil {
+		return err
+	}
+
+	err = s.band(1, buf.Bytes())
+	if err != nil || !s.enabled {
+		return err
+	}
+	return WriteFlush(s.w)
+}
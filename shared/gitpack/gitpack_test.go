@@ -0,0 +1,185 @@
+package gitpack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func git(t *testing.T, dir string, stdin []byte, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@pico.sh",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@pico.sh",
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s: %s", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestReadPack(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git(t, dir, nil, "init", "-q")
+	write := func(name, text string) {
+		fpath := filepath.Join(dir, name)
+		_ = os.MkdirAll(filepath.Dir(fpath), 0o755)
+		err := os.WriteFile(fpath, []byte(text), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a second version of a large file makes git store it as a delta
+	page := strings.Repeat("<p>hello world</p>\n", 500)
+	write("index.html", page)
+	write("css/site.css", "body {}")
+	git(t, dir, nil, "add", "-A")
+	git(t, dir, nil, "commit", "-q", "-m", "first")
+	write("index.html", page+"<p>more</p>\n")
+	write("js/app.js", "console.log(1)")
+	git(t, dir, nil, "add", "-A")
+	git(t, dir, nil, "commit", "-q", "-m", "second")
+	head := strings.TrimSpace(string(git(t, dir, nil, "rev-parse", "HEAD")))
+
+	packed := git(t, dir, []byte("HEAD\n"), "pack-objects", "--stdout", "--revs", "--delta-base-offset")
+	pack, err := ReadPack(bytes.NewReader(packed), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pack.Close()
+	files, err := pack.Files(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, f := range files {
+		data, _ := io.ReadAll(f.Reader())
+		got = append(got, fmt.Sprintf("%s %d %d %o", f.Path, f.Size, len(data), f.Mode))
+	}
+	expected := []string{
+		"css/site.css 7 7 644",
+		fmt.Sprintf("index.html %[1]d %[1]d 644", len(page)+len("<p>more</p>\n")),
+		"js/app.js 14 14 644",
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatal(diff)
+	}
+
+	_, err = ReadPack(bytes.NewReader(packed), 100)
+	if err == nil {
+		t.Error("expected the pack to be over the max size")
+	}
+
+	// a header claiming more objects than the pack could hold
+	lying := append([]byte{}, packed...)
+	binary.BigEndian.PutUint32(lying[8:12], uint32(len(packed)))
+	_, err = ReadPack(bytes.NewReader(lying), 0)
+	if err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Errorf("expected the object count to be checked, got %v", err)
+	}
+
+	corrupt := append([]byte{}, packed...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	_, err = ReadPack(bytes.NewReader(corrupt), 0)
+	if err == nil {
+		t.Error("expected a corrupt checksum to fail")
+	}
+}
+
+// buildPack packs one blob whose header claims size but inflates to data.
+func buildPack(size byte, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("PACK")
+	_ = binary.Write(buf, binary.BigEndian, uint32(2))
+	_ = binary.Write(buf, binary.BigEndian, uint32(1))
+	buf.WriteByte(objBlob<<4 | size)
+	zw := zlib.NewWriter(buf)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+func TestReadPackInflate(t *testing.T) {
+	pack, err := ReadPack(bytes.NewReader(buildPack(5, []byte("hello"))), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = pack.Close()
+
+	// inflating stops at the size in the header
+	_, err = ReadPack(bytes.NewReader(buildPack(5, bytes.Repeat([]byte("a"), 1<<20))), 0)
+	if err == nil || !strings.Contains(err.Error(), "wrong size") {
+		t.Errorf("expected the inflated size to be checked, got %v", err)
+	}
+
+	// the size in the header is checked before inflating
+	_, err = ReadPack(bytes.NewReader(buildPack(15, bytes.Repeat([]byte("a"), 15))), 10)
+	if err == nil {
+		t.Error("expected the object to be over the max size")
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	in := &bytes.Buffer{}
+	newID := strings.Repeat("a", 40)
+	_ = WritePkt(in, []byte(fmt.Sprintf("%s %s refs/heads/main\x00report-status side-band-64k\n", ZeroID, newID)))
+	_ = WriteFlush(in)
+	req, err := ReadRequest(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Commands) != 1 || req.Commands[0].Ref != "refs/heads/main" || req.Commands[0].New != newID {
+		t.Fatalf("unexpected commands %+v", req.Commands)
+	}
+	if !req.Has("side-band-64k") || req.Has("quiet") {
+		t.Fatalf("unexpected capabilities %v", req.Capabilities)
+	}
+
+	out := &bytes.Buffer{}
+	band := NewSideband(out, true)
+	_ = band.Progress("deployed")
+	_ = band.Report(nil, []Status{{Ref: "refs/heads/main"}, {Ref: "refs/heads/dev", Err: "rejected"}})
+
+	progress, _ := ReadPkt(out)
+	if string(progress) != "\x02deployed\n" {
+		t.Fatalf("expected progress on band 2, got %q", progress)
+	}
+	report, _ := ReadPkt(out)
+	if report[0] != 1 {
+		t.Fatalf("expected the report on band 1, got %q", report)
+	}
+	status := bytes.NewReader(report[1:])
+	lines := []string{}
+	for {
+		line, err := ReadPkt(status)
+		if err != nil {
+			break
+		}
+		lines = append(lines, string(line))
+	}
+	expected := []string{"unpack ok\n", "ok refs/heads/main\n", "ng refs/heads/dev rejected\n"}
+	if diff := cmp.Diff(expected, lines); diff != "" {
+		t.Fatal(diff)
+	}
+}
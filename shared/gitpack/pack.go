@@ -0,0 +1,542 @@
+package gitpack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+)
+
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var typeNames = map[int]string{
+	objCommit: "commit",
+	objTree:   "tree",
+	objBlob:   "blob",
+	objTag:    "tag",
+}
+
+// MaxObjects caps how many objects a pack may hold, every object is
+// tracked in memory while the pack is resolved.
+const MaxObjects = 1 << 20
+
+// minEntrySize is the smallest an object can be in a pack, a one byte
+// header and an empty zlib stream. Counts that could not fit in the pack
+// are rejected before anything is allocated for them.
+const minEntrySize = 9
+
+// packOverhead is how much larger than its inflated objects a pack may
+// be, incompressible objects grow a little when deflated.
+func packOverhead(maxSize int64) int64 {
+	return maxSize/64 + 1<<20
+}
+
+// object is inflated into the spool, only where it is and what it is
+// stay in memory.
+type object struct {
+	typ    int
+	offset int64
+	size   int64
+}
+
+// Pack holds every object of a pushed packfile by id, deltas resolved.
+// Objects are spooled to a temporary file, Close removes it.
+type Pack struct {
+	objects map[string]*object
+	spool   *os.File
+	end     int64
+	// budget is how many inflated bytes may still be spooled, negative
+	// when there is no cap
+	budget int64
+}
+
+func (p *Pack) Close() error {
+	err := p.spool.Close()
+	_ = os.Remove(p.spool.Name())
+	return err
+}
+
+// reserve takes size from the budget before it is inflated or allocated.
+func (p *Pack) reserve(size int64) error {
+	if p.budget < 0 {
+		return nil
+	}
+	if size > p.budget {
+		return errTooLarge
+	}
+	p.budget -= size
+	return nil
+}
+
+var errTooLarge = errors.New("pack is larger than allowed")
+
+// store appends size bytes of r to the spool as an object of typ, r must
+// hold exactly size bytes.
+func (p *Pack) store(typ int, r io.Reader, size int64) (*object, string, error) {
+	obj := &object{typ: typ, offset: p.end, size: size}
+	h := sha1.New()
+	if typeNames[typ] != "" {
+		fmt.Fprintf(h, "%s %d\x00", typeNames[typ], size)
+	}
+	n, err := io.Copy(io.NewOffsetWriter(p.spool, p.end), io.TeeReader(io.LimitReader(r, size+1), h))
+	if err != nil {
+		return nil, "", err
+	}
+	if n != size {
+		return nil, "", fmt.Errorf("object has the wrong size, expected (%d) found (%d)", size, n)
+	}
+	p.end += size
+	return obj, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (p *Pack) read(obj *object) ([]byte, error) {
+	data := make([]byte, obj.size)
+	_, err := p.spool.ReadAt(data, obj.offset)
+	return data, err
+}
+
+func (p *Pack) reader(obj *object) io.Reader {
+	return io.NewSectionReader(p.spool, obj.offset, obj.size)
+}
+
+// packReader hashes and counts what it reads, zlib reads it byte by byte
+// so it never reads past the end of an object.
+type packReader struct {
+	r      *bufio.Reader
+	hash   hash.Hash
+	offset int64
+}
+
+func (p *packReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.hash.Write(b[:n])
+	p.offset += int64(n)
+	return n, err
+}
+
+func (p *packReader) ReadByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	p.hash.Write([]byte{c})
+	p.offset += 1
+	return c, nil
+}
+
+// entry is an object as it is stored in the pack, deltas point at their
+// base by offset or by id. Delta instructions are spooled like objects.
+type entry struct {
+	offset     int64
+	typ        int
+	data       *object
+	baseOffset int64
+	baseID     string
+	resolved   *object
+}
+
+// ReadPack reads a packfile up to its trailing checksum. The pack and its
+// inflated objects are spooled to disk, maxSize caps their inflated size,
+// 0 does not.
+func ReadPack(r io.Reader, maxSize int64) (*Pack, error) {
+	raw, err := os.CreateTemp("", "pack-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = raw.Close()
+		_ = os.Remove(raw.Name())
+	}()
+	limit := int64(-1)
+	if maxSize > 0 {
+		limit = maxSize + packOverhead(maxSize)
+		r = io.LimitReader(r, limit+1)
+	}
+	length, err := io.Copy(raw, r)
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && length > limit {
+		return nil, errTooLarge
+	}
+	_, err = raw.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp("", "pack-objects-*")
+	if err != nil {
+		return nil, err
+	}
+	pack := &Pack{objects: map[string]*object{}, spool: spool, budget: -1}
+	if maxSize > 0 {
+		pack.budget = maxSize
+	}
+	err = pack.readEntries(&packReader{r: bufio.NewReader(raw), hash: sha1.New()}, length)
+	if err != nil {
+		_ = pack.Close()
+		return nil, err
+	}
+	return pack, nil
+}
+
+func (p *Pack) readEntries(pr *packReader, length int64) error {
+	head := make([]byte, 12)
+	_, err := io.ReadFull(pr, head)
+	if err != nil {
+		return fmt.Errorf("could not read pack header: %w", err)
+	}
+	if string(head[:4]) != "PACK" {
+		return fmt.Errorf("not a packfile")
+	}
+	version := binary.BigEndian.Uint32(head[4:8])
+	if version != 2 && version != 3 {
+		return fmt.Errorf("unsupported pack version (%d)", version)
+	}
+	count := int64(binary.BigEndian.Uint32(head[8:12]))
+	if count > MaxObjects {
+		return fmt.Errorf("pack has more than (%d) objects", MaxObjects)
+	}
+	if count*minEntrySize > length-int64(len(head))-sha1.Size {
+		return fmt.Errorf("pack is too short for (%d) objects", count)
+	}
+
+	entries := make([]*entry, 0, count)
+	byOffset := map[int64]*entry{}
+	for i := int64(0); i < count; i++ {
+		e, err := p.readEntry(pr)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		byOffset[e.offset] = e
+	}
+
+	sum := pr.hash.Sum(nil)
+	trailer := make([]byte, sha1.Size)
+	_, err = io.ReadFull(pr.r, trailer)
+	if err != nil {
+		return fmt.Errorf("could not read pack checksum: %w", err)
+	}
+	if !bytes.Equal(sum, trailer) {
+		return fmt.Errorf("pack checksum does not match")
+	}
+
+	return p.resolve(entries, byOffset)
+}
+
+func (p *Pack) readEntry(pr *packReader) (*entry, error) {
+	e := &entry{offset: pr.offset}
+
+	c, err := pr.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	e.typ = int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if shift > 56 {
+			return nil, fmt.Errorf("object at (%d) has an invalid size", e.offset)
+		}
+		c, err = pr.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	switch e.typ {
+	case objOfsDelta:
+		c, err := pr.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		back := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			c, err = pr.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			back = ((back + 1) << 7) | int64(c&0x7f)
+		}
+		e.baseOffset = e.offset - back
+	case objRefDelta:
+		id := make([]byte, sha1.Size)
+		_, err := io.ReadFull(pr, id)
+		if err != nil {
+			return nil, err
+		}
+		e.baseID = hex.EncodeToString(id)
+	case objCommit, objTree, objBlob, objTag:
+	default:
+		return nil, fmt.Errorf("unknown object type (%d)", e.typ)
+	}
+
+	// the size is checked before inflating so a small object that
+	// inflates to far more than it claims stops at its claim
+	err = p.reserve(size)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zlib.NewReader(pr)
+	if err != nil {
+		return nil, err
+	}
+	obj, id, err := p.store(e.typ, zr, size)
+	if err != nil {
+		return nil, fmt.Errorf("object at (%d): %w", e.offset, err)
+	}
+	e.data = obj
+	if e.typ != objOfsDelta && e.typ != objRefDelta {
+		e.resolved = obj
+		p.objects[id] = obj
+	}
+	return e, nil
+}
+
+// resolve applies deltas until every object is whole, a base can come
+// after the delta pointing at it so it takes as many passes as needed.
+// Only one delta, its base and the result are in memory at a time.
+func (p *Pack) resolve(entries []*entry, byOffset map[int64]*entry) error {
+	pending := 0
+	for _, e := range entries {
+		if e.resolved == nil {
+			pending += 1
+		}
+	}
+	for pending > 0 {
+		progress := false
+		for _, e := range entries {
+			if e.resolved != nil {
+				continue
+			}
+
+			var base *object
+			switch e.typ {
+			case objOfsDelta:
+				if found := byOffset[e.baseOffset]; found != nil {
+					base = found.resolved
+				}
+			case objRefDelta:
+				base = p.objects[e.baseID]
+			}
+			if base == nil {
+				continue
+			}
+
+			baseData, err := p.read(base)
+			if err != nil {
+				return err
+			}
+			delta, err := p.read(e.data)
+			if err != nil {
+				return err
+			}
+			data, err := applyDelta(baseData, delta, p.reserve)
+			if err != nil {
+				return err
+			}
+			obj, id, err := p.store(base.typ, bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return err
+			}
+			e.resolved = obj
+			p.objects[id] = obj
+			pending -= 1
+			progress = true
+		}
+		if !progress {
+			return fmt.Errorf("pack is missing the base of (%d) deltas", pending)
+		}
+	}
+	return nil
+}
+
+func deltaSize(delta []byte) (int, []byte, error) {
+	size := 0
+	for shift := 0; ; shift += 7 {
+		if len(delta) == 0 {
+			return 0, nil, errors.New("truncated delta")
+		}
+		c := delta[0]
+		delta = delta[1:]
+		size |= int(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+}
+
+// applyDelta rebuilds an object from its base, reserve is asked for the
+// size of the result before it is allocated.
+func applyDelta(base, delta []byte, reserve func(int64) error) ([]byte, error) {
+	srcSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != len(base) {
+		return nil, errors.New("delta does not match its base")
+	}
+	dstSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reserve(int64(dstSize))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+		switch {
+		case cmd&0x80 != 0:
+			// copy from the base, the set bits say which offset and size
+			// bytes follow
+			var offset, size int
+			for i := 0; i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta")
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					size |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errors.New("delta copies past its base")
+			}
+			out = append(out, base[offset:offset+size]...)
+		case cmd != 0:
+			// insert the next cmd bytes
+			if int(cmd) > len(delta) {
+				return nil, errors.New("truncated delta")
+			}
+			out = append(out, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errors.New("invalid delta instruction")
+		}
+	}
+	if len(out) != dstSize {
+		return nil, errors.New("delta produced the wrong size")
+	}
+	return out, nil
+}
+
+// File is a blob of the pushed tree, its contents stay in the spool of
+// the pack until they are read.
+type File struct {
+	Path string
+	Mode fs.FileMode
+	Size int64
+	obj  *object
+	pack *Pack
+}
+
+// Reader reads the contents of the file, the pack must still be open.
+func (f File) Reader() io.Reader {
+	return f.pack.reader(f.obj)
+}
+
+// Files lists every regular file of the commit's tree, symlinks and
+// submodules are skipped.
+func (p *Pack) Files(commitID string) ([]File, error) {
+	commit, ok := p.objects[commitID]
+	if !ok || commit.typ != objCommit {
+		return nil, fmt.Errorf("commit (%s) is not in the pack", commitID)
+	}
+	data, err := p.read(commit)
+	if err != nil {
+		return nil, err
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	treeID, ok := bytes.CutPrefix(line, []byte("tree "))
+	if !ok {
+		return nil, fmt.Errorf("commit (%s) has no tree", commitID)
+	}
+
+	files := []File{}
+	err = p.walk(string(treeID), "", &files)
+	return files, err
+}
+
+func (p *Pack) walk(treeID, prefix string, files *[]File) error {
+	tree, ok := p.objects[treeID]
+	if !ok || tree.typ != objTree {
+		return fmt.Errorf("tree (%s) is not in the pack", treeID)
+	}
+
+	data, err := p.read(tree)
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		mode, rest, ok := bytes.Cut(data, []byte(" "))
+		if !ok {
+			return fmt.Errorf("tree (%s) is corrupt", treeID)
+		}
+		name, rest, ok := bytes.Cut(rest, []byte{0})
+		if !ok || len(rest) < sha1.Size {
+			return fmt.Errorf("tree (%s) is corrupt", treeID)
+		}
+		id := hex.EncodeToString(rest[:sha1.Size])
+		data = rest[sha1.Size:]
+
+		if string(name) == "." || string(name) == ".." || bytes.ContainsRune(name, '/') {
+			continue
+		}
+		fpath := path.Join(prefix, string(name))
+		perm, err := strconv.ParseUint(string(mode), 8, 32)
+		if err != nil {
+			return fmt.Errorf("tree (%s) has an invalid mode (%s)", treeID, mode)
+		}
+
+		switch perm & 0o170000 {
+		case 0o040000:
+			err := p.walk(id, fpath, files)
+			if err != nil {
+				return err
+			}
+		case 0o100000:
+			blob, ok := p.objects[id]
+			if !ok || blob.typ != objBlob {
+				return fmt.Errorf("blob (%s) is not in the pack", id)
+			}
+			*files = append(*files, File{
+				Path: fpath,
+				Mode: fs.FileMode(perm & 0o777),
+				Size: blob.size,
+				obj:  blob,
+				pack: p,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package headers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type HeaderRule struct {
+	Path    string        `json:"path"`
+	Headers []*HeaderLine `json:"headers"`
+}
+
+type HeaderLine struct {
+	Path  string `json:"-"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DenyList are headers we control ourselves or that only make sense for
+// a single connection (hop-by-hop), users are not allowed to set them.
+var DenyList = []string{
+	"accept-ranges",
+	"age",
+	"allow",
+	"alt-svc",
+	"connection",
+	"content-encoding",
+	"content-length",
+	"content-range",
+	"date",
+	"keep-alive",
+	"location",
+	"proxy-authenticate",
+	"proxy-authorization",
+	"proxy-connection",
+	"server",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
+}
+
+// header names are tokens, see RFC 9110 section 5.6.2
+var reHeaderName = regexp.MustCompile("^[a-z0-9!#$%&'*+.^_`|~-]+$")
+
+// ParseHeaderText is lenient, anything it cannot make sense of is
+// skipped. It is used when serving so a bad file never breaks a site.
+// from https://github.com/netlify/build/tree/main/packages/headers-parser
+func ParseHeaderText(text string) ([]*HeaderRule, error) {
+	return parseHeaderText(text, false)
+}
+
+// ValidateHeaderText is strict and reports the first malformed line, it
+// is used to reject a `_headers` file on upload.
+func ValidateHeaderText(text string) ([]*HeaderRule, error) {
+	return parseHeaderText(text, true)
+}
+
+func parseHeaderText(text string, strict bool) ([]*HeaderRule, error) {
+	rules := []*HeaderRule{}
+	parsed := []*HeaderLine{}
+	lines := strings.Split(text, "\n")
+	hasPath := false
+	for idx, line := range lines {
+		parsedLine, err := parseLine(strings.TrimSpace(line), strict)
+		if err != nil && strict {
+			return rules, fmt.Errorf("line %d: %w", idx+1, err)
+		}
+		if parsedLine == nil {
+			continue
+		}
+
+		if parsedLine.Path != "" {
+			hasPath = true
+		} else if !hasPath && strict {
+			return rules, fmt.Errorf("line %d: header (%s) must be listed below a path", idx+1, parsedLine.Name)
+		}
+		parsed = append(parsed, parsedLine)
+	}
+
+	var prevPath *HeaderRule
+	for _, rule := range parsed {
+		if rule.Path != "" {
+			if prevPath != nil {
+				if len(prevPath.Headers) > 0 {
+					rules = append(rules, prevPath)
+				}
+			}
+
+			prevPath = &HeaderRule{
+				Path: rule.Path,
+			}
+		} else if prevPath != nil {
+			// do not add headers in deny list
+			if slices.Contains(DenyList, rule.Name) {
+				continue
+			}
+			prevPath.Headers = append(
+				prevPath.Headers,
+				&HeaderLine{Name: rule.Name, Value: rule.Value},
+			)
+		}
+	}
+
+	// cleanup
+	if prevPath != nil && len(prevPath.Headers) > 0 {
+		rules = append(rules, prevPath)
+	}
+
+	return rules, nil
+}
+
+func parseLine(line string, strict bool) (*HeaderLine, error) {
+	rule := &HeaderLine{}
+
+	if isPathLine(line) {
+		rule.Path = line
+		return rule, nil
+	}
+
+	if isEmpty(line) {
+		return nil, nil
+	}
+
+	if isComment(line) {
+		return nil, nil
+	}
+
+	if !strings.Contains(line, ":") {
+		return nil, fmt.Errorf("(%s) must be a path or a `name: value` header", line)
+	}
+
+	results := strings.SplitN(line, ":", 2)
+	name := strings.ToLower(strings.TrimSpace(results[0]))
+	value := strings.TrimSpace(results[1])
+
+	if name == "" {
+		return nil, fmt.Errorf("header name cannot be empty")
+	}
+
+	if value == "" {
+		return nil, fmt.Errorf("header value cannot be empty")
+	}
+
+	if strict {
+		if !reHeaderName.MatchString(name) {
+			return nil, fmt.Errorf("(%s) is not a valid header name", name)
+		}
+		if slices.Contains(DenyList, name) {
+			return nil, fmt.Errorf("header (%s) is not allowed", name)
+		}
+		if strings.ContainsAny(value, "\r\x00") {
+			return nil, fmt.Errorf("header (%s) value cannot contain control characters", name)
+		}
+	}
+
+	rule.Name = name
+	rule.Value = value
+	return rule, nil
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(line, "#")
+}
+
+func isEmpty(line string) bool {
+	return line == ""
+}
+
+func isPathLine(line string) bool {
+	return strings.HasPrefix(line, "/")
+}
@@ -0,0 +1,91 @@
+package headers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type ValidateFixture struct {
+	name   string
+	input  string
+	expect []*HeaderRule
+	err    string
+}
+
+func TestValidateHeaderText(t *testing.T) {
+	fixtures := []ValidateFixture{
+		{
+			name:  "nested-indentation",
+			input: "/blog/*\n  x-frame-options: DENY\n\t\tcache-control: max-age=60\n    x-robots-tag: noindex",
+			expect: []*HeaderRule{
+				{
+					Path: "/blog/*",
+					Headers: []*HeaderLine{
+						{Name: "x-frame-options", Value: "DENY"},
+						{Name: "cache-control", Value: "max-age=60"},
+						{Name: "x-robots-tag", Value: "noindex"},
+					},
+				},
+			},
+		},
+		{
+			name:  "comments",
+			input: "# security headers\n/*\n  # no framing\n  x-frame-options: DENY\n\n/index.html\n  cache-control: no-cache",
+			expect: []*HeaderRule{
+				{
+					Path:    "/*",
+					Headers: []*HeaderLine{{Name: "x-frame-options", Value: "DENY"}},
+				},
+				{
+					Path:    "/index.html",
+					Headers: []*HeaderLine{{Name: "cache-control", Value: "no-cache"}},
+				},
+			},
+		},
+		{
+			name:  "header-before-path",
+			input: "# comment\n  x-frame-options: DENY\n/*",
+			err:   "line 2:",
+		},
+		{
+			name:  "no-colon",
+			input: "/*\n  x-frame-options: DENY\n  cache-control = none",
+			err:   "line 3:",
+		},
+		{
+			name:  "empty-value",
+			input: "/*\n  x-frame-options:",
+			err:   "line 2:",
+		},
+		{
+			name:  "invalid-name",
+			input: "/*\n  x frame: DENY",
+			err:   "line 2:",
+		},
+		{
+			name:  "hop-by-hop",
+			input: "/*\n  x-frame-options: DENY\n\n  Transfer-Encoding: chunked",
+			err:   "line 4:",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			results, err := ValidateHeaderText(fixture.input)
+			if fixture.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), fixture.err) {
+					t.Fatalf("expected error starting with (%s), got (%v)", fixture.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(fixture.expect, results); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
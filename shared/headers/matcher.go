@@ -0,0 +1,69 @@
+package headers
+
+import (
+	"regexp"
+	"strings"
+)
+
+var rePathPlaceholder = regexp.MustCompile(`^:[A-Za-z_][A-Za-z0-9_]*$`)
+
+type compiledRule struct {
+	re      *regexp.Regexp
+	headers []*HeaderLine
+}
+
+// Matcher holds the rules of a `_headers` file with their paths compiled
+// once so serving a request does not have to.
+type Matcher struct {
+	rules []*compiledRule
+}
+
+// compilePath anchors a rule path, `*` matches anything and a `:name`
+// segment matches a single path segment.
+func compilePath(path string) (*regexp.Regexp, error) {
+	segments := strings.Split(path, "/")
+	for idx, seg := range segments {
+		if rePathPlaceholder.MatchString(seg) {
+			segments[idx] = "[^/]+"
+			continue
+		}
+		parts := strings.Split(seg, "*")
+		for pidx, part := range parts {
+			parts[pidx] = regexp.QuoteMeta(part)
+		}
+		segments[idx] = strings.Join(parts, ".*")
+	}
+	return regexp.Compile("^" + strings.Join(segments, "/") + "$")
+}
+
+// NewMatcher compiles rules, a rule whose path cannot be compiled is
+// skipped like any other line the lenient parser does not understand.
+func NewMatcher(rules []*HeaderRule) *Matcher {
+	matcher := &Matcher{}
+	for _, rule := range rules {
+		re, err := compilePath(rule.Path)
+		if err != nil {
+			continue
+		}
+		matcher.rules = append(matcher.rules, &compiledRule{re: re, headers: rule.Headers})
+	}
+	return matcher
+}
+
+// Match returns the headers of every rule matching fpath in the order
+// they are listed in the file.
+func (m *Matcher) Match(fpath string) []*HeaderLine {
+	lines := []*HeaderLine{}
+	if m == nil {
+		return lines
+	}
+	if !strings.HasPrefix(fpath, "/") {
+		fpath = "/" + fpath
+	}
+	for _, rule := range m.rules {
+		if rule.re.MatchString(fpath) {
+			lines = append(lines, rule.headers...)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,40 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatcher(t *testing.T) {
+	rules, err := ValidateHeaderText("/*\n  x-frame-options: DENY\n/blog/:slug\n  cache-control: max-age=60\n/assets/*.css\n  cache-control: max-age=31536000\n/index.html\n  x-robots-tag: noindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher := NewMatcher(rules)
+
+	fixtures := []struct {
+		name   string
+		fpath  string
+		expect []string
+	}{
+		{name: "catch-all", fpath: "/about.html", expect: []string{"x-frame-options"}},
+		{name: "placeholder", fpath: "/blog/hello", expect: []string{"x-frame-options", "cache-control"}},
+		{name: "placeholder-one-segment", fpath: "/blog/hello/world", expect: []string{"x-frame-options"}},
+		{name: "splat-in-segment", fpath: "/assets/css/main.css", expect: []string{"x-frame-options", "cache-control"}},
+		{name: "no-substring", fpath: "/old/index.html", expect: []string{"x-frame-options"}},
+		{name: "exact", fpath: "index.html", expect: []string{"x-frame-options", "x-robots-tag"}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			names := []string{}
+			for _, line := range matcher.Match(fixture.fpath) {
+				names = append(names, line.Name)
+			}
+			if !cmp.Equal(names, fixture.expect) {
+				t.Fatal(cmp.Diff(fixture.expect, names))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package linkcheck finds the links on the pages of a project that do not
+// lead to any of its files.
+package linkcheck
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/shared/redirects"
+	"golang.org/x/net/html"
+)
+
+// Dir is where the report of the last check of every project is kept in
+// a user's bucket.
+var Dir = ".lint"
+
+// Broken is a link on Page, relative to the project, that leads nowhere.
+type Broken struct {
+	Page string `json:"page"`
+	Link string `json:"link"`
+}
+
+// Report is the outcome of checking every page of a project.
+type Report struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Pages     int       `json:"pages"`
+	Links     int       `json:"links"`
+	Broken    []Broken  `json:"broken"`
+}
+
+// Links returns the `href` and `src` attributes of an html document.
+func Links(text []byte) []string {
+	links := []string{}
+	tokenizer := html.NewTokenizer(bytes.NewReader(text))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		for {
+			key, val, more := tokenizer.TagAttr()
+			attr := string(key)
+			if attr == "src" || attr == "href" {
+				links = append(links, strings.TrimSpace(string(val)))
+			}
+			if !more {
+				break
+			}
+		}
+	}
+}
+
+// Site is what a check knows about a project: the paths of its files,
+// relative to the project, and the rules of its `_redirects`.
+type Site struct {
+	Files     map[string]bool
+	Redirects []*redirects.RedirectRule
+}
+
+// target is the path on the project a link on page leads to, false for
+// links to other hosts, other schemes and to the page itself.
+func target(page, link string) (string, url.Values, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", nil, false
+	}
+	fpath := u.Path
+	if !strings.HasPrefix(fpath, "/") {
+		fpath = path.Join("/", path.Dir(page), fpath)
+	}
+	return fpath, u.Query(), true
+}
+
+// Resolves is true when a request for fpath would be answered with one of
+// the files of the site or by a rule that does not answer with an error.
+func (s *Site) Resolves(fpath string, query url.Values) bool {
+	rel := strings.Trim(path.Clean("/"+fpath), "/")
+	candidates := []string{"index.html"}
+	if rel != "" {
+		candidates = []string{rel, rel + ".html", rel + "/index.html"}
+	}
+	for _, candidate := range candidates {
+		if s.Files[candidate] {
+			return true
+		}
+	}
+
+	// only the first matching rule applies, like on the web server
+	for _, rule := range s.Redirects {
+		if _, ok := rule.Match("/"+rel, query); ok {
+			return rule.Status != http.StatusNotFound && rule.Status != http.StatusGone
+		}
+	}
+	return false
+}
+
+// Check returns the links of page that lead nowhere, each one once.
+func (s *Site) Check(page string, links []string) []Broken {
+	broken := []Broken{}
+	seen := map[string]bool{}
+	for _, link := range links {
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		fpath, query, ok := target(page, link)
+		if !ok || s.Resolves(fpath, query) {
+			continue
+		}
+		broken = append(broken, Broken{Page: page, Link: link})
+	}
+	return broken
+}
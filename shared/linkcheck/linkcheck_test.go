@@ -0,0 +1,49 @@
+package linkcheck
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/shared/redirects"
+)
+
+func TestLinks(t *testing.T) {
+	text := `<html><head><link rel="stylesheet" href="/main.css"></head>
+<body><a href=" about.html ">about</a><img src="img/logo.png" /><p>no links</p></body></html>`
+	expect := []string{"/main.css", "about.html", "img/logo.png"}
+	if diff := cmp.Diff(expect, Links([]byte(text))); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules, err := redirects.ParseRedirectText("/old/*  /blog/:splat  301\n/gone  /  410\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := &Site{
+		Files: map[string]bool{
+			"index.html":      true,
+			"main.css":        true,
+			"about.html":      true,
+			"blog/index.html": true,
+			"blog/post.html":  true,
+		},
+		Redirects: rules,
+	}
+
+	links := []string{
+		"/", "/main.css", "/about", "/about.html", "/blog/", "post.html", "../index.html",
+		"#top", "?page=2", "https://example.com/missing", "mailto:me@example.com", "//cdn.example.com/x.js",
+		"/old/post", "/old/post",
+		"missing.html", "/gone", "/blog/missing",
+	}
+	expect := []Broken{
+		{Page: "blog/index.html", Link: "missing.html"},
+		{Page: "blog/index.html", Link: "/gone"},
+		{Page: "blog/index.html", Link: "/blog/missing"},
+	}
+	if diff := cmp.Diff(expect, site.Check("blog/index.html", links)); diff != "" {
+		t.Fatal(diff)
+	}
+}
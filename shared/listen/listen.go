@@ -0,0 +1,94 @@
+// Package listen hands listening sockets from one pico process to the next
+// so a deploy does not refuse connections. Sockets passed by systemd socket
+// activation are picked by their FileDescriptorName, e.g. `ssh` or `http`.
+// Without them, SO_REUSEPORT lets the new process bind next to the old one
+// while the old one drains.
+package listen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFdsStart is the first file descriptor systemd passes, see
+// sd_listen_fds(3).
+const listenFdsStart = 3
+
+var (
+	mu        sync.Mutex
+	loaded    bool
+	activated map[string]net.Listener
+)
+
+// activatedListeners wraps the count file descriptors from start on, names
+// are separated by colons like LISTEN_FDNAMES.
+func activatedListeners(start, count int, names string) (map[string]net.Listener, error) {
+	listeners := map[string]net.Listener{}
+	fdnames := strings.Split(names, ":")
+	for i := 0; i < count; i += 1 {
+		name := "unknown"
+		if i < len(fdnames) && fdnames[i] != "" {
+			name = fdnames[i]
+		}
+		file := os.NewFile(uintptr(start+i), name)
+		ln, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket (%s) passed by systemd: %w", name, err)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+// fromSystemd reads the sockets passed to this process once, the
+// environment is cleared so commands we run, like site generators, do not
+// take them for their own.
+func fromSystemd() (map[string]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return map[string]net.Listener{}, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return map[string]net.Listener{}, nil
+	}
+	names := os.Getenv("LISTEN_FDNAMES")
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(key)
+	}
+	return activatedListeners(listenFdsStart, count, names)
+}
+
+// Listen returns the socket systemd passed as name, otherwise it listens on
+// addr over tcp. With reusePort other processes can listen on addr at the
+// same time, the kernel spreads new connections between them.
+func Listen(name, addr string, reusePort bool) (net.Listener, error) {
+	mu.Lock()
+	if !loaded {
+		found, err := fromSystemd()
+		if err != nil {
+			mu.Unlock()
+			return nil, err
+		}
+		activated = found
+		loaded = true
+	}
+	ln, ok := activated[name]
+	delete(activated, name)
+	mu.Unlock()
+	if ok {
+		return ln, nil
+	}
+
+	cfg := net.ListenConfig{}
+	if reusePort {
+		cfg.Control = reusePortControl
+	}
+	return cfg.Listen(context.Background(), "tcp", addr)
+}
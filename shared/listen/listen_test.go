@@ -0,0 +1,56 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package listen
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestActivatedListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	file, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the copy is closed once it is wrapped, like the ones systemd passes
+	fd, err := syscall.Dup(int(file.Fd()))
+	_ = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listeners, err := activatedListeners(fd, 1, "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passed, ok := listeners["ssh"]
+	if !ok {
+		t.Fatalf("expected the socket to be found by name, got %v", listeners)
+	}
+	defer passed.Close()
+	if passed.Addr().String() != ln.Addr().String() {
+		t.Errorf("expected (%s), got (%s)", ln.Addr(), passed.Addr())
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	first, err := Listen("test", "127.0.0.1:0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	// the next process binds the same address while the first still
+	// serves
+	second, err := Listen("test", first.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("expected a second listener on the same address, got %v", err)
+	}
+	defer second.Close()
+}
@@ -23,6 +23,8 @@ var DigestIntervalOpts = []string{
 	"1day",
 	"7day",
 	"30day",
+	"daily",
+	"weekly",
 }
 
 type ListParsedText struct {
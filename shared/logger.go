@@ -0,0 +1,68 @@
+package shared
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+)
+
+type ctxSessionLoggerKey struct{}
+
+// CreateLogger writes text lines to stdout, set LOG_FORMAT=json to get one
+// json object per line for log aggregation instead. Every line carries the
+// service that wrote it.
+func CreateLogger(service string, debug bool) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+	}
+	if debug {
+		opts.Level = slog.LevelDebug
+	}
+
+	var handler slog.Handler
+	if strings.ToLower(GetEnv("LOG_FORMAT", "text")) == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	return slog.New(handler).With("service", service)
+}
+
+// NewSessionID returns a short random id used to tie together every log
+// line of one ssh session.
+func NewSessionID() string {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+func SetSessionLogger(ctx ssh.Context, logger *slog.Logger) {
+	ctx.SetValue(ctxSessionLoggerKey{}, logger)
+}
+
+// SessionLogger returns the logger attached to the session context, or
+// fallback when nothing set one up.
+func SessionLogger(ctx ssh.Context, fallback *slog.Logger) *slog.Logger {
+	logger, ok := ctx.Value(ctxSessionLoggerKey{}).(*slog.Logger)
+	if !ok || logger == nil {
+		return fallback
+	}
+	return logger
+}
+
+// AddSessionAttrs attaches args to every later line of the session logger,
+// it does nothing when the session has no logger.
+func AddSessionAttrs(ctx ssh.Context, args ...any) {
+	logger, ok := ctx.Value(ctxSessionLoggerKey{}).(*slog.Logger)
+	if !ok || logger == nil {
+		return
+	}
+	SetSessionLogger(ctx, logger.With(args...))
+}
@@ -3,6 +3,7 @@ package shared
 import (
 	"bytes"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -38,8 +39,40 @@ type MetaData struct {
 	ImageCard   string
 	Favicon     string
 	Hidden      bool
+	// Slug replaces the one taken from the filename
+	Slug         string
+	CanonicalURL string
+	Render       RenderOpts
 }
 
+// RenderOpts are the parts of the markdown pipeline a post can change in
+// its front matter.
+type RenderOpts struct {
+	Tables    bool
+	Footnotes bool
+	Highlight bool
+	Anchors   bool
+	// Toc is the deepest heading level the table of contents lists, 0
+	// turns the [[toc]] macro off
+	Toc int
+	// TocTop puts the table of contents above a post without the macro
+	TocTop bool
+}
+
+func DefaultRenderOpts() RenderOpts {
+	return RenderOpts{
+		Tables:    true,
+		Footnotes: true,
+		Highlight: true,
+		Anchors:   true,
+		Toc:       3,
+	}
+}
+
+// tocMacro is replaced with the table of contents when written as its own
+// paragraph.
+var tocMacro = "[[toc]]"
+
 type ParsedText struct {
 	Html string
 	*MetaData
@@ -78,6 +111,77 @@ func toBool(obj interface{}) (bool, error) {
 	}
 }
 
+func toSlug(obj interface{}) (string, error) {
+	slug, err := toString(obj)
+	if err != nil {
+		return "", err
+	}
+	slug = strings.Trim(strings.TrimSpace(slug), "/")
+	if strings.ContainsAny(slug, "/?# \t") {
+		return "", fmt.Errorf("(%s) must not contain slashes, spaces, `?` or `#`", slug)
+	}
+	return slug, nil
+}
+
+func toCanonicalURL(obj interface{}) (string, error) {
+	canonical, err := toString(obj)
+	if err != nil || canonical == "" {
+		return "", err
+	}
+	u, err := url.Parse(canonical)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("(%s) must be an absolute http(s) url", canonical)
+	}
+	return canonical, nil
+}
+
+func toOptBool(obj interface{}, fallback bool) (bool, error) {
+	if obj == nil {
+		return fallback, nil
+	}
+	return toBool(obj)
+}
+
+func toRenderOpts(metaData map[string]interface{}) (RenderOpts, error) {
+	opts := DefaultRenderOpts()
+	var err error
+	fields := []struct {
+		key string
+		val *bool
+	}{
+		{"tables", &opts.Tables},
+		{"footnotes", &opts.Footnotes},
+		{"highlight", &opts.Highlight},
+		{"anchors", &opts.Anchors},
+	}
+	for _, field := range fields {
+		*field.val, err = toOptBool(metaData[field.key], *field.val)
+		if err != nil {
+			return opts, fmt.Errorf("front-matter field (%s): %w", field.key, err)
+		}
+	}
+
+	// toc is either a bool or the deepest heading level to list
+	switch val := metaData["toc"].(type) {
+	case nil:
+	case bool:
+		opts.TocTop = val
+		if !val {
+			opts.Toc = 0
+		}
+	case int:
+		if val < 2 || val > 6 {
+			return opts, fmt.Errorf("front-matter field (%s): heading level %d must be between 2 and 6", "toc", val)
+		}
+		opts.Toc = val
+		opts.TocTop = true
+	default:
+		return opts, fmt.Errorf("front-matter field (%s): incorrect type for value: %T, should be bool or int", "toc", val)
+	}
+
+	return opts, nil
+}
+
 func toLinks(orderedMetaData yaml.MapSlice) ([]Link, error) {
 	var navData interface{}
 	for i := 0; i < len(orderedMetaData); i++ {
@@ -169,30 +273,36 @@ func toTags(obj interface{}) ([]string, error) {
 	return arr, nil
 }
 
-func ParseText(text string) (*ParsedText, error) {
-	parsed := ParsedText{
-		MetaData: &MetaData{
-			Tags:    []string{},
-			Aliases: []string{},
-		},
+func newMarkdown(opts RenderOpts) goldmark.Markdown {
+	extensions := []goldmark.Extender{
+		extension.Linkify,
+		extension.Strikethrough,
+		extension.TaskList,
+		meta.Meta,
 	}
-	hili := highlighting.NewHighlighting(
-		highlighting.WithFormatOptions(
-			html.WithLineNumbers(true),
-			html.WithClasses(true),
-		),
-	)
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Footnote,
-			meta.Meta,
-			hili,
-			&anchor.Extender{
-				Position: anchor.Before,
-				Texter:   anchor.Text("#"),
-			},
-		),
+	if opts.Tables {
+		extensions = append(extensions, extension.Table)
+	}
+	if opts.Footnotes {
+		extensions = append(extensions, extension.Footnote)
+	}
+	if opts.Highlight {
+		extensions = append(extensions, highlighting.NewHighlighting(
+			highlighting.WithFormatOptions(
+				html.WithLineNumbers(true),
+				html.WithClasses(true),
+			),
+		))
+	}
+	if opts.Anchors {
+		extensions = append(extensions, &anchor.Extender{
+			Position: anchor.Before,
+			Texter:   anchor.Text("#"),
+		})
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
@@ -200,12 +310,31 @@ func ParseText(text string) (*ParsedText, error) {
 			ghtml.WithUnsafe(),
 		),
 	)
-	context := parser.NewContext()
+}
+
+func ParseText(text string) (*ParsedText, error) {
+	parsed := ParsedText{
+		MetaData: &MetaData{
+			Tags:    []string{},
+			Aliases: []string{},
+			Render:  DefaultRenderOpts(),
+		},
+	}
+	// the front matter decides how the rest is parsed so it is read first
+	metaData, orderedMetaData, btext, err := parseFrontMatter([]byte(text))
+	if err != nil {
+		return &parsed, err
+	}
+
+	render, err := toRenderOpts(metaData)
+	if err != nil {
+		return &parsed, err
+	}
+	parsed.MetaData.Render = render
+	md := newMarkdown(render)
 
 	// we do the Parse/Render steps manually to get a chance to examine the AST
-	btext := []byte(text)
-	doc := md.Parser().Parse(gtext.NewReader(btext), parser.WithContext(context))
-	metaData := meta.Get(context)
+	doc := md.Parser().Parse(gtext.NewReader(btext))
 
 	// title:
 	// 1. if specified in frontmatter, use that
@@ -257,6 +386,18 @@ func ParseText(text string) (*ParsedText, error) {
 	}
 	parsed.MetaData.Favicon = favicon
 
+	slug, err := toSlug(metaData["slug"])
+	if err != nil {
+		return &parsed, fmt.Errorf("front-matter field (%s): %w", "slug", err)
+	}
+	parsed.MetaData.Slug = slug
+
+	canonicalURL, err := toCanonicalURL(metaData["canonical_url"])
+	if err != nil {
+		return &parsed, fmt.Errorf("front-matter field (%s): %w", "canonical_url", err)
+	}
+	parsed.MetaData.CanonicalURL = canonicalURL
+
 	var publishAt *time.Time = nil
 	date, err := toString(metaData["date"])
 	if err != nil {
@@ -272,8 +413,6 @@ func ParseText(text string) (*ParsedText, error) {
 	}
 	parsed.MetaData.PublishAt = publishAt
 
-	orderedMetaData := meta.GetItems(context)
-
 	nav, err := toLinks(orderedMetaData)
 	if err != nil {
 		return &parsed, err
@@ -292,6 +431,8 @@ func ParseText(text string) (*ParsedText, error) {
 	}
 	parsed.MetaData.Tags = tags
 
+	AstToc(doc, btext, render)
+
 	// Rendering happens last to allow any of the previous steps to manipulate
 	// the AST.
 	var buf bytes.Buffer
@@ -329,3 +470,102 @@ func AstTitle(doc ast.Node, src []byte, clean bool) string {
 	}
 	return out
 }
+
+// AstToc replaces the [[toc]] macro with a list of links to the headings
+// below the title.
+func AstToc(doc ast.Node, src []byte, opts RenderOpts) {
+	macros := []ast.Node{}
+	headings := []*ast.Heading{}
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if ast.IsParagraph(n) && strings.TrimSpace(linesText(n, src)) == tocMacro {
+			macros = append(macros, n)
+			return ast.WalkSkipChildren, nil
+		}
+		if h, ok := n.(*ast.Heading); ok {
+			if h.Level > 1 && h.Level <= opts.Toc {
+				headings = append(headings, h)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		panic(err) // unreachable
+	}
+
+	if len(macros) == 0 && opts.TocTop && opts.Toc > 0 && doc.FirstChild() != nil {
+		placeholder := ast.NewParagraph()
+		doc.InsertBefore(doc, doc.FirstChild(), placeholder)
+		macros = append(macros, placeholder)
+	}
+
+	for _, macro := range macros {
+		parent := macro.Parent()
+		if opts.Toc > 0 && len(headings) > 0 {
+			parent.ReplaceChild(parent, macro, tocList(headings, src))
+		} else {
+			parent.RemoveChild(parent, macro)
+		}
+	}
+}
+
+func linesText(n ast.Node, src []byte) string {
+	out := ""
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		out += string(segment.Value(src))
+	}
+	return out
+}
+
+// tocList nests the headings by their level, levels that are skipped get
+// an empty item so links always sit at the depth of their heading.
+func tocList(headings []*ast.Heading, src []byte) ast.Node {
+	minLevel := headings[0].Level
+	for _, h := range headings {
+		minLevel = min(minLevel, h.Level)
+	}
+
+	newList := func() *ast.List {
+		list := ast.NewList('-')
+		list.IsTight = true
+		return list
+	}
+	root := newList()
+	root.SetAttributeString("class", []byte("toc"))
+	stack := []*ast.List{root}
+	for _, h := range headings {
+		depth := h.Level - minLevel
+		for len(stack)-1 > depth {
+			stack = stack[:len(stack)-1]
+		}
+		for len(stack)-1 < depth {
+			top := stack[len(stack)-1]
+			last := top.LastChild()
+			if last == nil {
+				last = ast.NewListItem(2)
+				top.AppendChild(top, last)
+			}
+			sub := newList()
+			last.AppendChild(last, sub)
+			stack = append(stack, sub)
+		}
+
+		link := ast.NewLink()
+		if id, ok := h.AttributeString("id"); ok {
+			link.Destination = append([]byte("#"), id.([]byte)...)
+		}
+		link.AppendChild(link, ast.NewString(h.Text(src)))
+		block := ast.NewTextBlock()
+		block.AppendChild(block, link)
+		item := ast.NewListItem(2)
+		item.AppendChild(item, block)
+		top := stack[len(stack)-1]
+		top.AppendChild(top, item)
+	}
+	return root
+}
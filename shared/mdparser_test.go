@@ -0,0 +1,122 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+type ParseTextFixture struct {
+	name     string
+	input    string
+	contains []string
+	excludes []string
+	err      bool
+}
+
+func TestParseText(t *testing.T) {
+	body := "## One\n\n### Sub\n\n## Two\n\n```go\nx := 1\n```\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\nnote[^1]\n\n[^1]: footnote\n"
+	fixtures := []ParseTextFixture{
+		{
+			name:     "defaults",
+			input:    "# Title\n\n" + body,
+			contains: []string{`class="chroma"`, "<table>", `class="footnotes"`, `class="anchor"`},
+			excludes: []string{`class="toc"`},
+		},
+		{
+			name:     "macro",
+			input:    "# Title\n\n[[toc]]\n\n" + body,
+			contains: []string{`<ul class="toc">`, `<a href="#one" rel="nofollow">One</a>`, `<a href="#sub" rel="nofollow">Sub</a>`},
+			excludes: []string{"[[toc]]", `href="#title" rel="nofollow">Title`},
+		},
+		{
+			name:     "toc_top_depth",
+			input:    "---\ntoc: 2\n---\n" + body,
+			contains: []string{`<ul class="toc">`, `href="#two"`},
+			excludes: []string{`<a href="#sub"`},
+		},
+		{
+			name:     "toc_off",
+			input:    "---\ntoc: false\n---\n[[toc]]\n\n" + body,
+			excludes: []string{`class="toc"`, "[[toc]]"},
+		},
+		{
+			name:     "everything_off",
+			input:    "---\nhighlight: false\ntables: false\nfootnotes: false\nanchors: false\n---\n" + body,
+			contains: []string{`class="language-go"`, "| a | b |"},
+			excludes: []string{`class="chroma"`, "<table>", `class="footnotes"`, `class="anchor"`},
+		},
+		{
+			name:  "bad_toc",
+			input: "---\ntoc: deep\n---\n" + body,
+			err:   true,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			parsed, err := ParseText(fixture.input)
+			if fixture.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range fixture.contains {
+				if !strings.Contains(parsed.Html, want) {
+					t.Errorf("expected (%s) in:\n%s", want, parsed.Html)
+				}
+			}
+			for _, unwanted := range fixture.excludes {
+				if strings.Contains(parsed.Html, unwanted) {
+					t.Errorf("did not expect (%s) in:\n%s", unwanted, parsed.Html)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTextFrontMatter(t *testing.T) {
+	yamlText := "---\ntitle: hello\nslug: /custom/\ncanonical_url: https://example.com/hello\ndate: 2024-03-18\ndraft: true\ntags: [a, b]\nnav:\n  - home: /\n  - about: /about\n---\nbody\n"
+	tomlText := "+++\ntitle = \"hello\"\nslug = \"custom\"\ncanonical_url = \"https://example.com/hello\"\ndate = 2024-03-18\ndraft = true\ntags = [\"a\", \"b\"]\n[nav]\nhome = \"/\"\nabout = \"/about\"\n+++\nbody\n"
+
+	for name, text := range map[string]string{"yaml": yamlText, "toml": tomlText} {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParseText(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Title != "hello" || parsed.Slug != "custom" || !parsed.Hidden {
+				t.Errorf("unexpected meta data %+v", parsed.MetaData)
+			}
+			if parsed.CanonicalURL != "https://example.com/hello" {
+				t.Errorf("unexpected canonical url (%s)", parsed.CanonicalURL)
+			}
+			if parsed.PublishAt == nil || parsed.PublishAt.Format("2006-01-02") != "2024-03-18" {
+				t.Errorf("unexpected publish at (%v)", parsed.PublishAt)
+			}
+			if strings.Join(parsed.Tags, ",") != "a,b" {
+				t.Errorf("unexpected tags (%v)", parsed.Tags)
+			}
+			if len(parsed.Nav) != 2 || parsed.Nav[0].Text != "home" || parsed.Nav[1].URL != "/about" {
+				t.Errorf("unexpected nav (%v)", parsed.Nav)
+			}
+			if strings.TrimSpace(parsed.Html) != "<p>body</p>" {
+				t.Errorf("expected only the body to render, got (%s)", parsed.Html)
+			}
+		})
+	}
+
+	for _, bad := range []string{
+		"---\nslug: a/b\n---\n",
+		"---\ncanonical_url: /relative\n---\n",
+		"+++\ntitle = \"unterminated\"\n",
+	} {
+		_, err := ParseText(bad)
+		if err == nil {
+			t.Errorf("expected (%q) to be rejected", bad)
+		}
+	}
+}
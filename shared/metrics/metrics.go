@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// every collector is registered with the default registry which the ssh
+// servers already expose through promwish.
+
+var (
+	uploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pico_uploads_total",
+		Help: "Files written through scp, sftp and rsync",
+	}, []string{"status"})
+	uploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pico_upload_bytes_total",
+		Help: "Bytes of files written successfully",
+	})
+	uploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pico_upload_duration_seconds",
+		Help:    "How long writing a single file took",
+		Buckets: prometheus.DefBuckets,
+	})
+	deletes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pico_deletes_total",
+		Help: "Files deleted through sftp, rsync and `command rm`",
+	}, []string{"status"})
+
+	commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pico_commands_total",
+		Help: "Commands run over ssh",
+	}, []string{"command", "status"})
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pico_command_duration_seconds",
+		Help:    "How long commands run over ssh took",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command"})
+
+	storageRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pico_storage_requests_total",
+		Help: "Calls made to the storage backend",
+	}, []string{"op", "status"})
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pico_storage_duration_seconds",
+		Help:    "How long calls to the storage backend took",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"op"})
+	objectCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pico_object_cache_reads_total",
+		Help: "Objects read through the object cache, by whether they were cached",
+	}, []string{"result"})
+	objectCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pico_object_cache_evictions_total",
+		Help: "Objects dropped from the object cache to make room",
+	})
+	objectCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pico_object_cache_bytes",
+		Help: "Bytes held by the object cache",
+	})
+
+	eventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pico_events_dropped_total",
+		Help: "Events the event bus could not take and were dropped",
+	}, []string{"topic"})
+)
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func ObserveUpload(size int64, duration time.Duration, err error) {
+	uploads.WithLabelValues(status(err)).Inc()
+	uploadDuration.Observe(duration.Seconds())
+	if err == nil && size > 0 {
+		uploadBytes.Add(float64(size))
+	}
+}
+
+func ObserveDelete(err error) {
+	deletes.WithLabelValues(status(err)).Inc()
+}
+
+func ObserveCommand(command string, start time.Time, err error) {
+	commands.WithLabelValues(command, status(err)).Inc()
+	commandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+}
+
+func ObserveStorage(op string, start time.Time, err error) {
+	storageRequests.WithLabelValues(op, status(err)).Inc()
+	storageDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// ObserveObjectCache counts a read of the object cache, result is `hit`,
+// `miss` or `skip` for objects that can't be cached.
+func ObserveObjectCache(result string) {
+	objectCache.WithLabelValues(result).Inc()
+}
+
+// ObserveObjectCacheSize records what the object cache holds after it
+// evicted evicted objects.
+func ObserveObjectCacheSize(size int64, evicted int) {
+	objectCacheBytes.Set(float64(size))
+	if evicted > 0 {
+		objectCacheEvictions.Add(float64(evicted))
+	}
+}
+
+// ObserveEventDropped counts an event of topic that was not published.
+func ObserveEventDropped(topic string) {
+	eventsDropped.WithLabelValues(topic).Inc()
+}
+
+// Handler serves every collector in the prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
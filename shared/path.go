@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxPathComponent is the longest file or directory name we accept in
+// bytes, NAME_MAX on most filesystems. Longer names could not be
+// downloaded again.
+const MaxPathComponent = 255
+
+// SanitizePath normalizes a client provided file path so it always stays
+// inside the user's root. Paths are returned with a single leading `/`,
+// anything that tries to climb out with `..`, hides separators behind
+// percent encoding or contains null bytes is rejected.
+func SanitizePath(fpath string) (string, error) {
+	if strings.ContainsRune(fpath, '\x00') {
+		return "", fmt.Errorf("(%q) contains a null byte", fpath)
+	}
+
+	unescaped, err := url.PathUnescape(fpath)
+	if err != nil {
+		unescaped = fpath
+	}
+	if strings.ContainsRune(unescaped, '\x00') {
+		return "", fmt.Errorf("(%q) contains a null byte", fpath)
+	}
+	if strings.Count(unescaped, "/") != strings.Count(fpath, "/") ||
+		strings.Count(unescaped, "\\") != strings.Count(fpath, "\\") {
+		return "", fmt.Errorf("(%s) contains an encoded path separator", fpath)
+	}
+
+	for _, candidate := range []string{fpath, unescaped} {
+		candidate = strings.ReplaceAll(candidate, "\\", "/")
+		for _, segment := range strings.Split(candidate, "/") {
+			if segment == ".." {
+				return "", fmt.Errorf("(%s) cannot contain `..`", fpath)
+			}
+		}
+	}
+
+	return path.Clean("/" + fpath), nil
+}
+
+// SanitizeUploadPath is SanitizePath for files about to be stored. Names
+// are also normalized to unicode NFC, the form most filesystems other than
+// macOS use, so the same name typed on two machines is the same object.
+// Names with control characters or longer than MaxPathComponent are
+// rejected. Objects stored before keep their names, lookups still go
+// through SanitizePath.
+func SanitizeUploadPath(fpath string) (string, error) {
+	unescaped, err := url.PathUnescape(fpath)
+	if err != nil {
+		unescaped = fpath
+	}
+	for _, candidate := range []string{fpath, unescaped} {
+		if strings.IndexFunc(candidate, unicode.IsControl) >= 0 {
+			return "", fmt.Errorf("(%q) contains a control character", fpath)
+		}
+	}
+
+	clean, err := SanitizePath(norm.NFC.String(fpath))
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range strings.Split(clean, "/") {
+		if len(segment) > MaxPathComponent {
+			return "", fmt.Errorf("(%s) has a name longer than (%d bytes)", fpath, MaxPathComponent)
+		}
+	}
+	return clean, nil
+}
+
+// SanitizeFilename is SanitizeUploadPath for services that only keep the
+// name of an upload.
+func SanitizeFilename(fpath string) (string, error) {
+	clean, err := SanitizeUploadPath(fpath)
+	if err != nil {
+		return "", err
+	}
+	if clean == "/" {
+		return "", fmt.Errorf("(%s) is not a file", fpath)
+	}
+	return path.Base(clean), nil
+}
+
+// FoldPath is the key two paths share when a case-insensitive filesystem,
+// like the defaults on macOS and Windows, would store them as one file.
+func FoldPath(fpath string) string {
+	return strings.ToLower(norm.NFC.String(fpath))
+}
@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+type SanitizePathFixture struct {
+	name   string
+	input  string
+	expect string
+	valid  bool
+}
+
+func TestSanitizePath(t *testing.T) {
+	fixtures := []SanitizePathFixture{
+		{name: "basic", input: "/proj/index.html", expect: "/proj/index.html", valid: true},
+		{name: "relative", input: "proj/index.html", expect: "/proj/index.html", valid: true},
+		{name: "double-slash", input: "//proj//css/./main.css", expect: "/proj/css/main.css", valid: true},
+		{name: "dots-in-name", input: "/proj/..hidden/a..b", expect: "/proj/..hidden/a..b", valid: true},
+		{name: "parent", input: "../etc/passwd", valid: false},
+		{name: "nested-parent", input: "a/../../b", valid: false},
+		{name: "absolute-parent", input: "/proj/../../etc/passwd", valid: false},
+		{name: "backslash", input: "/proj/..\\..\\etc", valid: false},
+		{name: "encoded-dots", input: "/proj/%2e%2e/etc", valid: false},
+		{name: "encoded-slash", input: "/proj/..%2f..%2fetc", valid: false},
+		{name: "encoded-backslash", input: "/proj/a%5cb", valid: false},
+		{name: "null-byte", input: "/proj/index.html\x00.png", valid: false},
+		{name: "encoded-null-byte", input: "/proj/index.html%00.png", valid: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			actual, err := SanitizePath(fixture.input)
+			if !fixture.valid {
+				if err == nil {
+					t.Fatalf("expected (%q) to be rejected, got (%s)", fixture.input, actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != fixture.expect {
+				t.Fatalf("expected (%s), got (%s)", fixture.expect, actual)
+			}
+		})
+	}
+}
+
+func TestSanitizeUploadPath(t *testing.T) {
+	fixtures := []SanitizePathFixture{
+		{name: "basic", input: "/proj/index.html", expect: "/proj/index.html", valid: true},
+		{name: "parent", input: "/proj/../../etc/passwd", valid: false},
+		{name: "null-byte", input: "/proj/index.html\x00.png", valid: false},
+		{name: "control", input: "/proj/index\r.html", valid: false},
+		{name: "encoded-control", input: "/proj/index%1b.html", valid: false},
+		{name: "nfd", input: "/proj/cafe\u0301.html", expect: "/proj/caf\u00e9.html", valid: true},
+		{name: "long-name", input: "/proj/" + strings.Repeat("a", 256), valid: false},
+		{name: "max-name", input: "/proj/" + strings.Repeat("a", 255), expect: "/proj/" + strings.Repeat("a", 255), valid: true},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			actual, err := SanitizeUploadPath(fixture.input)
+			if !fixture.valid {
+				if err == nil {
+					t.Fatalf("expected (%q) to be rejected, got (%s)", fixture.input, actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != fixture.expect {
+				t.Fatalf("expected (%s), got (%s)", fixture.expect, actual)
+			}
+		})
+	}
+}
+
+func TestFoldPath(t *testing.T) {
+	if FoldPath("/proj/README.md") != FoldPath("/proj/readme.md") {
+		t.Error("expected paths that only differ in case to fold to the same key")
+	}
+	if FoldPath("/proj/Cafe\u0301.md") != FoldPath("/proj/caf\u00e9.md") {
+		t.Error("expected paths that only differ in normalization to fold to the same key")
+	}
+}
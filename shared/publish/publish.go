@@ -0,0 +1,50 @@
+package publish
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+// how many scheduled posts a single sweep publishes at once.
+var claimLimit = 100
+
+// Sweep publishes the scheduled posts whose date has arrived, from then on
+// they show up in listings and feeds. It keeps going until none are left so
+// a backlog does not wait for the next sweep.
+func Sweep(dbpool db.DB, logger *slog.Logger) (int, error) {
+	published := 0
+	for {
+		posts, err := dbpool.PublishScheduledPosts(claimLimit)
+		if err != nil {
+			return published, err
+		}
+		for _, post := range posts {
+			logger.Info(
+				"published scheduled post",
+				"userID", post.UserID,
+				"space", post.Space,
+				"slug", post.Slug,
+				"publishAt", post.PublishAt,
+			)
+		}
+		published += len(posts)
+		if len(posts) < claimLimit {
+			return published, nil
+		}
+	}
+}
+
+// Run sweeps scheduled posts every interval, it never returns.
+func Run(dbpool db.DB, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := Sweep(dbpool, logger)
+		if err != nil {
+			logger.Error("could not publish scheduled posts", "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package publish
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/db/memory"
+)
+
+type brokenDB struct {
+	db.DB
+}
+
+func (b *brokenDB) PublishScheduledPosts(limit int) ([]*db.Post, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestSweep(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		due    int
+		later  int
+		expect int
+	}{
+		{name: "none", later: 2, expect: 0},
+		{name: "one-batch", due: 1, later: 1, expect: 1},
+		{name: "full-batch", due: 2, expect: 2},
+		// a backlog is published in one sweep
+		{name: "backlog", due: 5, later: 1, expect: 5},
+	}
+
+	limit := claimLimit
+	defer func() { claimLimit = limit }()
+	claimLimit = 2
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			dbpool := memory.NewDB(slog.Default())
+			user, err := dbpool.RegisterUser("test", "ssh-ed25519 test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			insert := func(slug string, publishAt time.Time) {
+				_, err := dbpool.InsertPost(&db.Post{
+					UserID:    user.ID,
+					Filename:  slug + ".md",
+					Slug:      slug,
+					PublishAt: &publishAt,
+					UpdatedAt: &publishAt,
+					Space:     "prose",
+					Scheduled: true,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := range fixture.due {
+				insert(fmt.Sprintf("due-%d", i), time.Now().Add(-time.Minute))
+			}
+			for i := range fixture.later {
+				insert(fmt.Sprintf("later-%d", i), time.Now().Add(time.Hour))
+			}
+
+			published, err := Sweep(dbpool, slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if published != fixture.expect {
+				t.Errorf("expected (%d) posts to be published, got (%d)", fixture.expect, published)
+			}
+			published, err = Sweep(dbpool, slog.Default())
+			if err != nil || published != 0 {
+				t.Errorf("expected nothing left to publish, got (%d) %v", published, err)
+			}
+		})
+	}
+
+	_, err := Sweep(&brokenDB{}, slog.Default())
+	if err == nil {
+		t.Error("expected the database error to be returned")
+	}
+}
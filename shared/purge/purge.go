@@ -0,0 +1,256 @@
+package purge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bus"
+)
+
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderFastly     = "fastly"
+	ProviderWebhook    = "webhook"
+)
+
+// cloudflare takes at most this many urls per request.
+var cloudflareBatch = 30
+
+// Provider drops urls from the cache of a CDN, no urls drops everything
+// it caches for the zone.
+type Provider interface {
+	Purge(ctx context.Context, client *http.Client, urls []string) error
+}
+
+// NewProvider picks the adapter for name. zone is the cloudflare zone id
+// or the fastly service id, endpoint is where the webhook is posted or
+// overrides the api of the other providers.
+func NewProvider(name, endpoint, zone, token string) (Provider, error) {
+	switch name {
+	case ProviderCloudflare:
+		if zone == "" || token == "" {
+			return nil, fmt.Errorf("purge provider (%s) requires a zone and a token", name)
+		}
+		if endpoint == "" {
+			endpoint = "https://api.cloudflare.com/client/v4"
+		}
+		return &Cloudflare{API: endpoint, Zone: zone, Token: token}, nil
+	case ProviderFastly:
+		if zone == "" || token == "" {
+			return nil, fmt.Errorf("purge provider (%s) requires a service and a token", name)
+		}
+		if endpoint == "" {
+			endpoint = "https://api.fastly.com"
+		}
+		return &Fastly{API: endpoint, Service: zone, Token: token}, nil
+	case ProviderWebhook:
+		if endpoint == "" {
+			return nil, fmt.Errorf("purge provider (%s) requires a url", name)
+		}
+		return &Webhook{URL: endpoint, Token: token}, nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown purge provider (%s), expected %s, %s or %s",
+			name, ProviderCloudflare, ProviderFastly, ProviderWebhook,
+		)
+	}
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("purge responded with (%d)", e.code)
+}
+
+func isRetryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	return err != nil
+}
+
+func do(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint, token string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return do(client, req)
+}
+
+// Cloudflare purges through the zone's `purge_cache` endpoint.
+type Cloudflare struct {
+	API   string
+	Zone  string
+	Token string
+}
+
+func (c *Cloudflare) Purge(ctx context.Context, client *http.Client, urls []string) error {
+	endpoint := fmt.Sprintf("%s/zones/%s/purge_cache", c.API, c.Zone)
+	if len(urls) == 0 {
+		return postJSON(ctx, client, endpoint, c.Token, map[string]bool{"purge_everything": true})
+	}
+
+	for start := 0; start < len(urls); start += cloudflareBatch {
+		end := min(start+cloudflareBatch, len(urls))
+		err := postJSON(ctx, client, endpoint, c.Token, map[string][]string{"files": urls[start:end]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fastly purges single urls by their host and path and everything through
+// the service's `purge_all`.
+type Fastly struct {
+	API     string
+	Service string
+	Token   string
+}
+
+func (f *Fastly) post(ctx context.Context, client *http.Client, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", f.Token)
+	return do(client, req)
+}
+
+func (f *Fastly) Purge(ctx context.Context, client *http.Client, urls []string) error {
+	if len(urls) == 0 {
+		return f.post(ctx, client, fmt.Sprintf("%s/service/%s/purge_all", f.API, f.Service))
+	}
+
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return err
+		}
+		err = f.post(ctx, client, fmt.Sprintf("%s/purge/%s%s", f.API, u.Host, u.EscapedPath()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhookPayload is the json body posted to a generic purge hook, All is
+// set instead of URLs when the whole zone should be dropped.
+type WebhookPayload struct {
+	URLs []string `json:"urls,omitempty"`
+	All  bool     `json:"all,omitempty"`
+}
+
+// Webhook posts the urls to an operator's own endpoint, with the token as
+// a bearer token when there is one.
+type Webhook struct {
+	URL   string
+	Token string
+}
+
+func (w *Webhook) Purge(ctx context.Context, client *http.Client, urls []string) error {
+	return postJSON(ctx, client, w.URL, w.Token, WebhookPayload{URLs: urls, All: len(urls) == 0})
+}
+
+// Purger hands changed urls to a Provider, requests that fail with a
+// network error or a 429 or 5xx response are retried with exponential
+// backoff.
+type Purger struct {
+	provider Provider
+	// all drops the whole zone no matter which urls changed
+	all        bool
+	logger     *slog.Logger
+	client     *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+	sleep      func(d time.Duration)
+	pending    shared.Inflight
+}
+
+func NewPurger(provider Provider, all bool, logger *slog.Logger, maxRetries int, baseDelay time.Duration) *Purger {
+	return &Purger{
+		provider:   provider,
+		all:        all,
+		logger:     logger,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		maxRetries: maxRetries,
+		baseDelay:  baseDelay,
+		sleep:      time.Sleep,
+	}
+}
+
+// Purge drops urls from the cache, retrying transient failures.
+func (p *Purger) Purge(urls []string) error {
+	if p.all {
+		urls = nil
+	}
+	err := p.provider.Purge(context.Background(), p.client, urls)
+	for attempt := 0; attempt < p.maxRetries && isRetryable(err); attempt += 1 {
+		p.sleep(p.baseDelay * time.Duration(1<<attempt))
+		err = p.provider.Purge(context.Background(), p.client, urls)
+	}
+	return err
+}
+
+// Notify is Purge without blocking the caller, failures are only logged.
+func (p *Purger) Notify(urls []string) {
+	if len(urls) == 0 {
+		return
+	}
+	p.pending.Go(func() {
+		err := p.Purge(urls)
+		if err != nil {
+			p.logger.Error(
+				"could not purge cache",
+				"urls", strings.Join(urls, ", "),
+				"err", err.Error(),
+			)
+		}
+	})
+}
+
+// Subscribe purges the urls of the asset changes published on b, each
+// change once among the purgers on the bus.
+func (p *Purger) Subscribe(b bus.Bus) {
+	b.Subscribe(bus.AssetsChange, "purge", func(ev *bus.Event) {
+		p.Notify(ev.URLs)
+	})
+}
+
+// Wait blocks until every purge started by Notify finished or ctx is done.
+func (p *Purger) Wait(ctx context.Context) error {
+	return p.pending.Drain(ctx)
+}
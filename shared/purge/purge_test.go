@@ -0,0 +1,144 @@
+package purge
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type purgeRequest struct {
+	Path string
+	Auth string
+	Body string
+}
+
+func newPurgeServer(t *testing.T, fails int) (*httptest.Server, func() []purgeRequest) {
+	var mu sync.Mutex
+	requests := []purgeRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if fails > 0 {
+			fails -= 1
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			auth = r.Header.Get("Fastly-Key")
+		}
+		requests = append(requests, purgeRequest{Path: r.URL.Path, Auth: auth, Body: string(body)})
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []purgeRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestProviders(t *testing.T) {
+	urls := []string{"https://erock-test.pgs.sh/index.html", "https://erock-test.pgs.sh/"}
+	filesBody, _ := json.Marshal(map[string][]string{"files": urls})
+
+	fixtures := []struct {
+		name     string
+		provider string
+		zone     string
+		all      bool
+		expected []purgeRequest
+	}{
+		{
+			name:     "cloudflare",
+			provider: ProviderCloudflare,
+			zone:     "zone",
+			expected: []purgeRequest{{Path: "/zones/zone/purge_cache", Auth: "Bearer token", Body: string(filesBody)}},
+		},
+		{
+			name:     "cloudflare-all",
+			provider: ProviderCloudflare,
+			zone:     "zone",
+			all:      true,
+			expected: []purgeRequest{{Path: "/zones/zone/purge_cache", Auth: "Bearer token", Body: `{"purge_everything":true}`}},
+		},
+		{
+			name:     "fastly",
+			provider: ProviderFastly,
+			zone:     "service",
+			expected: []purgeRequest{
+				{Path: "/purge/erock-test.pgs.sh/index.html", Auth: "token"},
+				{Path: "/purge/erock-test.pgs.sh/", Auth: "token"},
+			},
+		},
+		{
+			name:     "fastly-all",
+			provider: ProviderFastly,
+			zone:     "service",
+			all:      true,
+			expected: []purgeRequest{{Path: "/service/service/purge_all", Auth: "token"}},
+		},
+		{
+			name:     "webhook",
+			provider: ProviderWebhook,
+			expected: []purgeRequest{{Path: "/", Auth: "Bearer token", Body: `{"urls":["https://erock-test.pgs.sh/index.html","https://erock-test.pgs.sh/"]}`}},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			srv, requests := newPurgeServer(t, 0)
+			provider, err := NewProvider(fixture.provider, srv.URL, fixture.zone, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			purger := NewPurger(provider, fixture.all, slog.Default(), 0, 0)
+			err = purger.Purge(urls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(fixture.expected, requests()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	_, err := NewProvider(ProviderCloudflare, "", "", "token")
+	if err == nil {
+		t.Fatal("expected cloudflare without a zone to be rejected")
+	}
+	_, err = NewProvider("akamai", "", "", "")
+	if err == nil {
+		t.Fatal("expected unknown provider to be rejected")
+	}
+}
+
+func TestPurgeRetries(t *testing.T) {
+	srv, requests := newPurgeServer(t, 2)
+	provider, err := NewProvider(ProviderWebhook, srv.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delays := []time.Duration{}
+	purger := NewPurger(provider, false, slog.Default(), 3, time.Second)
+	purger.sleep = func(d time.Duration) { delays = append(delays, d) }
+	err = purger.Purge([]string{"https://erock.pgs.sh/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests()) != 1 {
+		t.Fatalf("expected the purge to go through once, got %v", requests())
+	}
+	if diff := cmp.Diff([]time.Duration{time.Second, 2 * time.Second}, delays); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,59 @@
+package shared
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/picosh/pico/db"
+)
+
+// QuotaTier grants a storage ceiling to users with a feature.
+type QuotaTier struct {
+	Feature string
+	Quota   uint64
+}
+
+// ParseQuotaTiers reads tiers in the form `feature:bytes,feature:bytes`.
+func ParseQuotaTiers(text string) []QuotaTier {
+	tiers := []QuotaTier{}
+	for _, item := range strings.Split(text, ",") {
+		feature, size, found := strings.Cut(strings.TrimSpace(item), ":")
+		if !found {
+			continue
+		}
+		quota, err := strconv.ParseUint(strings.TrimSpace(size), 10, 64)
+		if err != nil {
+			continue
+		}
+		tiers = append(tiers, QuotaTier{Feature: strings.TrimSpace(feature), Quota: quota})
+	}
+	return tiers
+}
+
+// GetQuotaForUser returns the storage ceiling for a user based on their
+// features. Tiers are checked in order and the first match wins,
+// otherwise we fall back to `DefaultQuota` and then `MaxSize`.
+func GetQuotaForUser(dbpool db.DB, cfg *ConfigSite, userID string) uint64 {
+	for _, tier := range cfg.QuotaTiers {
+		if dbpool.HasFeatureForUser(userID, tier.Feature) {
+			return tier.Quota
+		}
+	}
+
+	if cfg.DefaultQuota > 0 {
+		return cfg.DefaultQuota
+	}
+	return cfg.MaxSize
+}
+
+// GetEgressForUser returns how many bytes the sites of a user can serve in
+// a calendar month, tiers are checked like `GetQuotaForUser` and 0 is
+// unlimited.
+func GetEgressForUser(dbpool db.DB, cfg *ConfigSite, userID string) uint64 {
+	for _, tier := range cfg.EgressTiers {
+		if dbpool.HasFeatureForUser(userID, tier.Feature) {
+			return tier.Quota
+		}
+	}
+	return cfg.DefaultEgress
+}
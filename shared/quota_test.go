@@ -0,0 +1,69 @@
+package shared
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+type quotaDB struct {
+	db.DB
+	features []string
+}
+
+func (q *quotaDB) HasFeatureForUser(userID, feature string) bool {
+	return slices.Contains(q.features, feature)
+}
+
+func TestParseQuotaTiers(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		input  string
+		expect []QuotaTier
+	}{
+		{name: "empty", input: "", expect: []QuotaTier{}},
+		{name: "one", input: "plus:100", expect: []QuotaTier{{Feature: "plus", Quota: 100}}},
+		{
+			name:   "spaces",
+			input:  " plus : 100 , pro:200",
+			expect: []QuotaTier{{Feature: "plus", Quota: 100}, {Feature: "pro", Quota: 200}},
+		},
+		{name: "invalid", input: "plus,pro:lots,team:-1,max:300", expect: []QuotaTier{{Feature: "max", Quota: 300}}},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			if diff := cmp.Diff(fixture.expect, ParseQuotaTiers(fixture.input)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGetQuotaForUser(t *testing.T) {
+	tiers := []QuotaTier{{Feature: "pro", Quota: 300}, {Feature: "plus", Quota: 200}}
+	fixtures := []struct {
+		name         string
+		features     []string
+		tiers        []QuotaTier
+		defaultQuota uint64
+		expect       uint64
+	}{
+		{name: "max-size", expect: 10},
+		{name: "default", tiers: tiers, defaultQuota: 50, expect: 50},
+		{name: "tier", features: []string{"plus"}, tiers: tiers, defaultQuota: 50, expect: 200},
+		{name: "first-match", features: []string{"plus", "pro"}, tiers: tiers, expect: 300},
+		{name: "no-match", features: []string{"team"}, tiers: tiers, expect: 10},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			cfg := &ConfigSite{QuotaTiers: fixture.tiers, DefaultQuota: fixture.defaultQuota}
+			cfg.MaxSize = 10
+			actual := GetQuotaForUser(&quotaDB{features: fixture.features}, cfg, "1")
+			if actual != fixture.expect {
+				t.Errorf("expected (%d), got (%d)", fixture.expect, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package redirects
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type RedirectRule struct {
+	From       string
+	To         string
+	Status     int
+	Query      map[string]string
+	Conditions map[string]string
+	Force      bool
+	Signed     bool
+}
+
+var reSplitWhitespace = regexp.MustCompile(`\s+`)
+
+var rePlaceholder = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+
+// 200 is a rewrite, everything else is a redirect or an error page.
+var validStatusCodes = []int{
+	http.StatusOK,
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusSeeOther,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+	http.StatusNotFound,
+	http.StatusGone,
+}
+
+func IsUrl(text string) bool {
+	return strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://")
+}
+
+func isToPart(part string) bool {
+	return strings.HasPrefix(part, "/") || IsUrl(part)
+}
+
+func hasStatusCode(part string) (int, bool) {
+	status := 0
+	forced := false
+	pt := part
+	if strings.HasSuffix(part, "!") {
+		pt = strings.TrimSuffix(part, "!")
+		forced = true
+	}
+
+	status, err := strconv.Atoi(pt)
+	if err != nil {
+		return 0, forced
+	}
+	return status, forced
+}
+
+func parsePairs(pairs []string) map[string]string {
+	mapper := map[string]string{}
+	for _, pair := range pairs {
+		val := strings.SplitN(pair, "=", 2)
+		if len(val) > 1 {
+			mapper[val[0]] = val[1]
+		}
+	}
+	return mapper
+}
+
+/*
+https://github.com/netlify/build/blob/main/packages/redirect-parser/src/line_parser.js#L9-L26
+Parse `_redirects` file to an array of objects.
+Each line in that file must be either:
+  - An empty line
+  - A comment starting with #
+  - A redirect line, optionally ended with a comment
+
+Each redirect line has the following format:
+
+	from [query] [to] [status[!]] [conditions]
+
+The parts are:
+  - "from": a path or a URL
+  - "query": a whitespace-separated list of "key=value"
+  - "to": a path or a URL
+  - "status": an HTTP status integer
+  - "!": an optional exclamation mark appended to "status" meant to indicate
+    "forced"
+  - "conditions": a whitespace-separated list of "key=value"
+  - "Sign" is a special condition
+*/
+func ParseRedirectText(text string) ([]*RedirectRule, error) {
+	rules := []*RedirectRule{}
+	origLines := strings.Split(text, "\n")
+	for idx, line := range origLines {
+		lineNum := idx + 1
+		trimmed := strings.TrimSpace(line)
+		// ignore empty lines
+		if trimmed == "" {
+			continue
+		}
+
+		// ignore comments
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		parts := reSplitWhitespace.Split(trimmed, -1)
+		if len(parts) < 2 {
+			return rules, fmt.Errorf("line %d: missing destination path/URL", lineNum)
+		}
+
+		from := parts[0]
+		rest := parts[0:]
+		status, forced := hasStatusCode(rest[0])
+		if status != 0 {
+			rules = append(rules, &RedirectRule{
+				Query:  map[string]string{},
+				Status: status,
+				Force:  forced,
+			})
+		} else {
+			toIndex := -1
+			for idx, part := range rest {
+				// the first part is always "from"
+				if idx > 0 && isToPart(part) {
+					toIndex = idx
+				}
+			}
+
+			if toIndex == -1 {
+				return rules, fmt.Errorf("line %d: the destination path/URL must start with '/', 'http:' or 'https:'", lineNum)
+			}
+
+			queryParts := parts[1:toIndex]
+			to := parts[toIndex]
+			lastParts := parts[toIndex+1:]
+			conditions := map[string]string{}
+			sts := http.StatusOK
+			// other sites can only be redirected to
+			if IsUrl(to) {
+				sts = http.StatusMovedPermanently
+			}
+			frcd := false
+			if len(lastParts) > 0 {
+				sts, frcd = hasStatusCode(lastParts[0])
+				if !slices.Contains(validStatusCodes, sts) {
+					return rules, fmt.Errorf("line %d: (%s) is not a supported status code", lineNum, lastParts[0])
+				}
+			}
+			if IsUrl(to) && !IsRedirectStatus(sts) {
+				return rules, fmt.Errorf("line %d: (%s) can only be redirected to, use a 3xx status", lineNum, to)
+			}
+			err := validateFrom(from)
+			if err != nil {
+				return rules, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if len(lastParts) > 1 {
+				conditions = parsePairs(lastParts[1:])
+			}
+
+			rules = append(rules, &RedirectRule{
+				To:         to,
+				From:       from,
+				Status:     sts,
+				Force:      frcd,
+				Query:      parsePairs(queryParts),
+				Conditions: conditions,
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+// IsRedirectStatus reports whether status sends the client elsewhere
+// instead of serving a file.
+func IsRedirectStatus(status int) bool {
+	return status >= 300 && status < 400
+}
+
+func validateFrom(from string) error {
+	if !strings.HasPrefix(from, "/") {
+		return fmt.Errorf("(%s) must be a path starting with '/'", from)
+	}
+	if strings.Count(from, "*") > 1 || strings.Contains(from, "*") && !strings.HasSuffix(from, "/*") {
+		return fmt.Errorf("(%s) can only end with a splat '/*'", from)
+	}
+	return nil
+}
+
+func splitPath(fpath string) []string {
+	return strings.Split(strings.Trim(fpath, "/"), "/")
+}
+
+// matchPath matches fpath segment by segment, `:name` takes any segment and
+// a trailing `*` takes the rest of the path as `splat`.
+func matchPath(pattern, fpath string) (map[string]string, bool) {
+	params := map[string]string{}
+	patternSegs := splitPath(pattern)
+	pathSegs := splitPath(fpath)
+
+	splat := len(patternSegs) > 0 && patternSegs[len(patternSegs)-1] == "*"
+	if splat {
+		patternSegs = patternSegs[:len(patternSegs)-1]
+		// `/*` has nothing in front of the splat
+		if len(patternSegs) == 1 && patternSegs[0] == "" {
+			patternSegs = []string{}
+		}
+		if len(pathSegs) < len(patternSegs) {
+			return nil, false
+		}
+	} else if len(pathSegs) != len(patternSegs) {
+		return nil, false
+	}
+
+	for idx, seg := range patternSegs {
+		if strings.HasPrefix(seg, ":") && pathSegs[idx] != "" {
+			params[seg[1:]] = pathSegs[idx]
+		} else if seg != pathSegs[idx] {
+			return nil, false
+		}
+	}
+	if splat {
+		params["splat"] = strings.Join(pathSegs[len(patternSegs):], "/")
+	}
+	return params, true
+}
+
+// Match checks fpath and the query of a request against the rule, it
+// returns where the rule points with the placeholders and `:splat` of
+// From and Query filled in.
+func (rule *RedirectRule) Match(fpath string, query url.Values) (string, bool) {
+	params, ok := matchPath(rule.From, fpath)
+	if !ok {
+		return "", false
+	}
+	for key, want := range rule.Query {
+		if !query.Has(key) {
+			return "", false
+		}
+		got := query.Get(key)
+		if strings.HasPrefix(want, ":") {
+			params[want[1:]] = got
+		} else if got != want {
+			return "", false
+		}
+	}
+
+	to := rePlaceholder.ReplaceAllStringFunc(rule.To, func(placeholder string) string {
+		if val, ok := params[placeholder[1:]]; ok {
+			return val
+		}
+		return placeholder
+	})
+	return to, true
+}
@@ -0,0 +1,169 @@
+package redirects
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type RedirectFixture struct {
+	name   string
+	input  string
+	expect []*RedirectRule
+}
+
+func TestParseRedirectText(t *testing.T) {
+	empty := map[string]string{}
+	fixtures := []RedirectFixture{
+		{
+			name:  "splat",
+			input: "/blog/*   /posts/:splat   301",
+			expect: []*RedirectRule{
+				{
+					From:       "/blog/*",
+					To:         "/posts/:splat",
+					Status:     301,
+					Query:      empty,
+					Conditions: empty,
+				},
+			},
+		},
+		{
+			name:  "placeholder",
+			input: "/users/:id   /profile/:id   302",
+			expect: []*RedirectRule{
+				{
+					From:       "/users/:id",
+					To:         "/profile/:id",
+					Status:     302,
+					Query:      empty,
+					Conditions: empty,
+				},
+			},
+		},
+		{
+			name:  "comments-and-forced",
+			input: "# comment\n\n/old   https://example.com/new   301!",
+			expect: []*RedirectRule{
+				{
+					From:       "/old",
+					To:         "https://example.com/new",
+					Status:     301,
+					Force:      true,
+					Query:      empty,
+					Conditions: empty,
+				},
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			results, err := ParseRedirectText(fixture.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if cmp.Equal(results, fixture.expect) == false {
+				t.Fatal(cmp.Diff(fixture.expect, results))
+			}
+		})
+	}
+}
+
+func TestParseRedirectTextErrors(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{
+			name:   "missing-destination",
+			input:  "/ok /index.html\n/wow",
+			expect: "line 2: missing destination path/URL",
+		},
+		{
+			name:   "bad-destination",
+			input:  "/wow index.html",
+			expect: "line 1: the destination path/URL must start with '/', 'http:' or 'https:'",
+		},
+		{
+			name:   "bad-status",
+			input:  "# comment\n/wow /index.html 999",
+			expect: "line 2: (999) is not a supported status code",
+		},
+		{
+			name:   "rewrite-other-site",
+			input:  "/wow https://example.com 200",
+			expect: "line 1: (https://example.com) can only be redirected to, use a 3xx status",
+		},
+		{
+			name:   "splat-in-middle",
+			input:  "/blog/*/edit /edit/:splat",
+			expect: "line 1: (/blog/*/edit) can only end with a splat '/*'",
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			_, err := ParseRedirectText(fixture.input)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if err.Error() != fixture.expect {
+				t.Fatalf("expected %q, got %q", fixture.expect, err.Error())
+			}
+		})
+	}
+}
+
+func TestRedirectRuleMatch(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		rule   string
+		path   string
+		query  url.Values
+		expect string
+		match  bool
+	}{
+		{name: "exact", rule: "/old /new", path: "/old/", expect: "/new", match: true},
+		{name: "no-substring", rule: "/old /new", path: "/older", match: false},
+		{name: "splat", rule: "/blog/* /posts/:splat", path: "/blog/2024/hello", expect: "/posts/2024/hello", match: true},
+		{name: "splat-bare", rule: "/blog/* /posts/:splat", path: "/blog", expect: "/posts/", match: true},
+		{name: "catch-all", rule: "/* /index.html 200", path: "/a/b", expect: "/index.html", match: true},
+		{name: "placeholder", rule: "/users/:id/:tab /u/:tab/:id", path: "/users/7/posts", expect: "/u/posts/7", match: true},
+		{name: "placeholder-missing", rule: "/users/:id /u/:id", path: "/users", match: false},
+		{
+			name:   "query",
+			rule:   "/store id=:id /items/:id 302",
+			path:   "/store",
+			query:  url.Values{"id": []string{"42"}},
+			expect: "/items/42",
+			match:  true,
+		},
+		{name: "query-missing", rule: "/store id=:id /items/:id 302", path: "/store", match: false},
+		{
+			name:  "query-literal",
+			rule:  "/store page=2 /two",
+			path:  "/store",
+			query: url.Values{"page": []string{"3"}},
+			match: false,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			rules, err := ParseRedirectText(fixture.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, ok := rules[0].Match(fixture.path, fixture.query)
+			if ok != fixture.match {
+				t.Fatalf("expected match (%t), got (%t)", fixture.match, ok)
+			}
+			if to != fixture.expect {
+				t.Fatalf("expected (%s), got (%s)", fixture.expect, to)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package shared
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LoadEnvFile sets the `KEY=value` lines of fpath as environment variables,
+// overriding ones already set. Blank lines and `#` comments are skipped,
+// values can be quoted.
+func LoadEnvFile(fpath string) error {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for num := 1; scanner.Scan(); num += 1 {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return fmt.Errorf("%s:%d: expected KEY=value", fpath, num)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) > 1 && value[0] == '"' {
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", fpath, num, err)
+			}
+		} else if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// only touch the environment once the whole file is known to be valid
+	for key, value := range env {
+		err := os.Setenv(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reloadable are the settings a running server picks up again on SIGHUP,
+// everything else needs a restart.
+var Reloadable = []string{
+	"MaxSize",
+	"MaxFileSize",
+	"DefaultQuota",
+	"QuotaTiers",
+	"MaxFilesPerProject",
+	"MaxObjectsPerUser",
+	"DeniedExt",
+	"AllowedTypes",
+	"DeniedTypes",
+	"AllowedHosts",
+	"CustomdomainsEnabled",
+	"UploadRateLimit",
+	"UploadBurst",
+	"RequestRateLimit",
+	"RequestBurst",
+}
+
+var reloadMu sync.Mutex
+
+// Reload copies the Reloadable settings of next into c and returns the
+// names of the ones that changed. Readers do not lock, so a session that
+// is already running can see old values for some settings and new ones for
+// others, every new session sees the new ones.
+func (c *ConfigSite) Reload(next *ConfigSite) []string {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	changed := []string{}
+	cur := reflect.ValueOf(c).Elem()
+	upd := reflect.ValueOf(next).Elem()
+	for _, name := range Reloadable {
+		field := cur.FieldByName(name)
+		value := upd.FieldByName(name)
+		if reflect.DeepEqual(field.Interface(), value.Interface()) {
+			continue
+		}
+		field.Set(value)
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+func isSecretSetting(name string) bool {
+	for _, secret := range []string{"Secret", "Token", "Pass", "Key", "DbURL"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func collectSettings(value reflect.Value, settings *[][2]string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectSettings(value.Field(i), settings)
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Func, reflect.Chan:
+			continue
+		}
+
+		text := fmt.Sprintf("%v", value.Field(i).Interface())
+		if isSecretSetting(field.Name) && text != "" {
+			text = "(redacted)"
+		}
+		*settings = append(*settings, [2]string{field.Name, text})
+	}
+}
+
+// Settings lists every setting of c by name with its resolved value,
+// secrets are redacted.
+func (c *ConfigSite) Settings() [][2]string {
+	settings := [][2]string{}
+	collectSettings(reflect.ValueOf(c).Elem(), &settings)
+	return settings
+}
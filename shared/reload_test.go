@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadEnvFile(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "pgs.env")
+	text := "# limits\nPGS_TEST_QUOTA=100\n\nexport PGS_TEST_EXT=\".exe, .bat\"\nPGS_TEST_HOST='cdn.example.com'\n"
+	err := os.WriteFile(fpath, []byte(text), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGS_TEST_QUOTA", "1")
+	t.Setenv("PGS_TEST_EXT", "")
+	t.Setenv("PGS_TEST_HOST", "")
+
+	err = LoadEnvFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{os.Getenv("PGS_TEST_QUOTA"), os.Getenv("PGS_TEST_EXT"), os.Getenv("PGS_TEST_HOST")}
+	if diff := cmp.Diff([]string{"100", ".exe, .bat", "cdn.example.com"}, got); diff != "" {
+		t.Error(diff)
+	}
+
+	err = os.WriteFile(fpath, []byte("PGS_TEST_QUOTA=5\nnot a setting\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = LoadEnvFile(fpath)
+	if err == nil || err.Error() != fpath+":2: expected KEY=value" {
+		t.Errorf("expected the bad line to be reported, got %v", err)
+	}
+	if os.Getenv("PGS_TEST_QUOTA") != "100" {
+		t.Error("expected an invalid file not to change anything")
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := &ConfigSite{DeniedExt: []string{".exe"}, UploadRateLimit: 10, Debug: false}
+	cfg.MaxSize = 100
+	next := &ConfigSite{DeniedExt: []string{".exe", ".bat"}, UploadRateLimit: 10, Debug: true}
+	next.MaxSize = 200
+
+	changed := cfg.Reload(next)
+	if diff := cmp.Diff([]string{"MaxSize", "DeniedExt"}, changed); diff != "" {
+		t.Error(diff)
+	}
+	if cfg.MaxSize != 200 || len(cfg.DeniedExt) != 2 {
+		t.Error("expected the reloadable settings to be replaced")
+	}
+	if cfg.Debug {
+		t.Error("expected settings that need a restart to be kept")
+	}
+}
+
+func TestSettings(t *testing.T) {
+	cfg := &ConfigSite{EnvSecret: "hunter2", WebdavAddr: ":8080"}
+	cfg.DbURL = "postgres://user:pass@db"
+	settings := map[string]string{}
+	for _, setting := range cfg.Settings() {
+		settings[setting[0]] = setting[1]
+	}
+	if settings["EnvSecret"] != "(redacted)" || settings["DbURL"] != "(redacted)" {
+		t.Error("expected secrets to be redacted")
+	}
+	if settings["WebdavAddr"] != ":8080" {
+		t.Errorf("expected (:8080), got (%s)", settings["WebdavAddr"])
+	}
+	if _, ok := settings["Logger"]; ok {
+		t.Error("expected pointers to be skipped")
+	}
+}
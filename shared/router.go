@@ -11,6 +11,8 @@ import (
 	"strings"
 
 	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/analytics"
+	"github.com/picosh/pico/shared/bandwidth"
 	"github.com/picosh/pico/shared/storage"
 )
 
@@ -48,6 +50,10 @@ type HttpCtx struct {
 	Cfg     *ConfigSite
 	Dbpool  db.DB
 	Storage storage.StorageServe
+	// Analytics is nil when analytics are turned off
+	Analytics *analytics.Recorder
+	// Bandwidth is nil when bandwidth accounting is turned off
+	Bandwidth *bandwidth.Meter
 }
 
 func (hc *HttpCtx) CreateCtx(prevCtx context.Context, subdomain string) context.Context {
@@ -56,7 +62,9 @@ func (hc *HttpCtx) CreateCtx(prevCtx context.Context, subdomain string) context.
 	dbCtx := context.WithValue(subdomainCtx, ctxDBKey{}, hc.Dbpool)
 	storageCtx := context.WithValue(dbCtx, ctxStorageKey{}, hc.Storage)
 	cfgCtx := context.WithValue(storageCtx, ctxCfg{}, hc.Cfg)
-	return cfgCtx
+	analyticsCtx := context.WithValue(cfgCtx, ctxAnalyticsKey{}, hc.Analytics)
+	bandwidthCtx := context.WithValue(analyticsCtx, ctxBandwidthKey{}, hc.Bandwidth)
+	return bandwidthCtx
 }
 
 func CreateServeBasic(routes []Route, ctx context.Context) ServeFn {
@@ -83,7 +91,7 @@ func CreateServeBasic(routes []Route, ctx context.Context) ServeFn {
 	}
 }
 
-func findRouteConfig(r *http.Request, routes []Route, subdomainRoutes []Route, cfg *ConfigSite) ([]Route, string) {
+func findRouteConfig(r *http.Request, routes []Route, subdomainRoutes []Route, cfg *ConfigSite, dbpool db.DB) ([]Route, string) {
 	var subdomain string
 	curRoutes := routes
 
@@ -98,7 +106,7 @@ func findRouteConfig(r *http.Request, routes []Route, subdomainRoutes []Route, c
 					curRoutes = subdomainRoutes
 				}
 			} else {
-				subdomain = GetCustomDomain(hostDomain, cfg.Space)
+				subdomain = GetProjectDomain(dbpool, cfg, hostDomain)
 				if subdomain != "" {
 					curRoutes = subdomainRoutes
 				}
@@ -111,7 +119,8 @@ func findRouteConfig(r *http.Request, routes []Route, subdomainRoutes []Route, c
 
 func CreateServe(routes []Route, subdomainRoutes []Route, httpCtx *HttpCtx) ServeFn {
 	return func(w http.ResponseWriter, r *http.Request) {
-		curRoutes, subdomain := findRouteConfig(r, routes, subdomainRoutes, httpCtx.Cfg)
+		httpCtx.Cfg.TrustedProxies.Resolve(r)
+		curRoutes, subdomain := findRouteConfig(r, routes, subdomainRoutes, httpCtx.Cfg, httpCtx.Dbpool)
 		ctx := httpCtx.CreateCtx(r.Context(), subdomain)
 		router := CreateServeBasic(curRoutes, ctx)
 		router(w, r)
@@ -124,6 +133,8 @@ type ctxKey struct{}
 type ctxLoggerKey struct{}
 type ctxSubdomainKey struct{}
 type ctxCfg struct{}
+type ctxAnalyticsKey struct{}
+type ctxBandwidthKey struct{}
 
 func GetCfg(r *http.Request) *ConfigSite {
 	return r.Context().Value(ctxCfg{}).(*ConfigSite)
@@ -141,6 +152,20 @@ func GetStorage(r *http.Request) storage.StorageServe {
 	return r.Context().Value(ctxStorageKey{}).(storage.StorageServe)
 }
 
+// GetAnalytics returns nil when analytics are turned off, a nil recorder
+// ignores hits.
+func GetAnalytics(r *http.Request) *analytics.Recorder {
+	rec, _ := r.Context().Value(ctxAnalyticsKey{}).(*analytics.Recorder)
+	return rec
+}
+
+// GetBandwidth returns nil when bandwidth accounting is turned off, a nil
+// meter ignores bytes and caps.
+func GetBandwidth(r *http.Request) *bandwidth.Meter {
+	meter, _ := r.Context().Value(ctxBandwidthKey{}).(*bandwidth.Meter)
+	return meter
+}
+
 func GetField(r *http.Request, index int) string {
 	fields := r.Context().Value(ctxKey{}).([]string)
 	if index >= len(fields) {
@@ -153,6 +178,18 @@ func GetSubdomain(r *http.Request) string {
 	return r.Context().Value(ctxSubdomainKey{}).(string)
 }
 
+// GetProjectDomain resolves a custom domain through the verified project
+// domains before falling back to its TXT record.
+func GetProjectDomain(dbpool db.DB, cfg *ConfigSite, host string) string {
+	if cfg.ProjectDomains {
+		subdomain, err := dbpool.FindSubdomainForDomain(host)
+		if err == nil {
+			return subdomain
+		}
+	}
+	return GetCustomDomain(host, cfg.Space)
+}
+
 func GetCustomDomain(host string, space string) string {
 	txt := fmt.Sprintf("_%s.%s", space, host)
 	records, err := net.LookupTXT(txt)
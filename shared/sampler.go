@@ -0,0 +1,44 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampler allows at most `limit` events per `interval` and drops the rest.
+// It is used to keep noisy debug logging from flooding our logs.
+type Sampler struct {
+	mu       sync.Mutex
+	limit    int
+	interval time.Duration
+	count    int
+	start    time.Time
+}
+
+func NewSampler(limit int, interval time.Duration) *Sampler {
+	return &Sampler{
+		limit:    limit,
+		interval: interval,
+	}
+}
+
+func (s *Sampler) Allow() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.start) >= s.interval {
+		s.start = now
+		s.count = 0
+	}
+
+	if s.count >= s.limit {
+		return false
+	}
+	s.count += 1
+	return true
+}
@@ -0,0 +1,187 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderClamAV = "clamav"
+	ProviderHTTP   = "http"
+
+	// ActionReject refuses the upload, ActionQuarantine also keeps a copy
+	// of the file for operators to look at.
+	ActionReject     = "reject"
+	ActionQuarantine = "quarantine"
+)
+
+// clamd reads streams in chunks of this size.
+var chunkSize = 32 * 1024
+
+// Result is what a scanner found in a file, Signature names the match.
+type Result struct {
+	Infected  bool   `json:"infected"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Scanner looks for malware or abuse in the contents of an upload.
+type Scanner interface {
+	Scan(ctx context.Context, contents io.Reader) (Result, error)
+}
+
+// NewScanner picks the scanner for name, endpoint is clamd's tcp address
+// or the url the http scanner posts files to.
+func NewScanner(name, endpoint, token string) (Scanner, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("scanner (%s) requires an address", name)
+	}
+	switch name {
+	case ProviderClamAV:
+		return &ClamAV{Addr: endpoint, Timeout: time.Minute}, nil
+	case ProviderHTTP:
+		return &HTTP{
+			URL:    endpoint,
+			Token:  token,
+			Client: &http.Client{Timeout: time.Minute},
+		}, nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown scanner (%s), expected %s or %s",
+			name, ProviderClamAV, ProviderHTTP,
+		)
+	}
+}
+
+// ClamAV streams files to clamd with its `INSTREAM` command.
+type ClamAV struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+func (c *ClamAV) Scan(ctx context.Context, contents io.Reader) (Result, error) {
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return Result{}, err
+	}
+
+	// every chunk is prefixed by its length, an empty one ends the stream
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := contents.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			_, werr := conn.Write(size)
+			if werr == nil {
+				_, werr = conn.Write(buf[:n])
+			}
+			if werr != nil {
+				return Result{}, werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	_, err = conn.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		return Result{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return Result{}, err
+	}
+	return parseClamReply(reply)
+}
+
+// parseClamReply reads `stream: OK` or `stream: {signature} FOUND`.
+func parseClamReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	status := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd replied (%s)", reply)
+	}
+}
+
+// HTTP posts files to an external scanner, it answers with a json
+// `Result`.
+type HTTP struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func (h *HTTP) Scan(ctx context.Context, contents io.Reader) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, contents)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Result{}, fmt.Errorf("scanner responded with (%d)", resp.StatusCode)
+	}
+
+	result := Result{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// Detection is kept for every file a scanner flagged, it makes up the
+// operator report.
+type Detection struct {
+	User      string    `json:"user"`
+	Project   string    `json:"project"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Signature string    `json:"signature"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (d Detection) String() string {
+	return fmt.Sprintf(
+		"%s %s %s/%s (%d bytes): %s",
+		d.CreatedAt.Format(time.DateTime),
+		d.Action,
+		d.User,
+		strings.TrimPrefix(d.Path, "/"),
+		d.Size,
+		d.Signature,
+	)
+}
@@ -0,0 +1,133 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var eicar = "X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"
+
+// newClamd answers INSTREAM like clamd, files containing eicar are found.
+func newClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil || cmd != "zINSTREAM\x00" {
+					_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				stream := bytes.Buffer{}
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&stream, r, int64(n)); err != nil {
+						return
+					}
+				}
+				if strings.Contains(stream.String(), eicar) {
+					_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				_, _ = conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamAV(t *testing.T) {
+	chunkSize = 16
+	defer func() { chunkSize = 32 * 1024 }()
+
+	scanner, err := NewScanner(ProviderClamAV, newClamd(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader("<h1>hello</h1>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Infected {
+		t.Fatal("expected a clean file to pass")
+	}
+
+	result, err = scanner.Scan(context.Background(), strings.NewReader("prefix "+eicar+" suffix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected eicar to be found across chunks, got %+v", result)
+	}
+
+	_, err = parseClamReply("INSTREAM size limit exceeded. ERROR\x00")
+	if err == nil {
+		t.Fatal("expected clamd errors to fail the scan")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), eicar) {
+			_, _ = w.Write([]byte(`{"infected":true,"signature":"eicar"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"infected":false}`))
+	}))
+	defer srv.Close()
+
+	scanner, err := NewScanner(ProviderHTTP, srv.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := scanner.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Infected || result.Signature != "eicar" {
+		t.Fatalf("expected eicar to be found, got %+v", result)
+	}
+
+	scanner, _ = NewScanner(ProviderHTTP, srv.URL, "wrong")
+	_, err = scanner.Scan(context.Background(), strings.NewReader("hi"))
+	if err == nil {
+		t.Fatal("expected a failed request to fail the scan")
+	}
+
+	_, err = NewScanner("nope", srv.URL, "")
+	if err == nil {
+		t.Fatal("expected an unknown scanner to fail")
+	}
+}
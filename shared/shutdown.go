@@ -0,0 +1,106 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// DefaultShutdownTimeout bounds how long a stopping server waits for
+// running sessions and uploads.
+var DefaultShutdownTimeout = 30 * time.Second
+
+var ErrShuttingDown = errors.New("server is shutting down, try again shortly")
+
+// Inflight counts running operations so a shutdown can wait for them, the
+// zero value is ready to use. Once Drain was called Start refuses new ones.
+type Inflight struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+}
+
+// Start reports false when draining, otherwise Done must be called once
+// the operation finished.
+func (f *Inflight) Start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return false
+	}
+	f.wg.Add(1)
+	return true
+}
+
+func (f *Inflight) Done() {
+	f.wg.Done()
+}
+
+// Join tracks an operation even while draining, it is meant for work that
+// belongs to one that already started. Done must be called for it too.
+func (f *Inflight) Join() {
+	f.wg.Add(1)
+}
+
+// Go runs fn in its own goroutine and tracks it even while draining, it
+// is meant for work an operation already started hands off, like hooks.
+func (f *Inflight) Go(fn func()) {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		fn()
+	}()
+}
+
+// Drain refuses new operations and waits for running ones until ctx is
+// done.
+func (f *Inflight) Drain(ctx context.Context) error {
+	f.mu.Lock()
+	f.draining = true
+	f.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the server from accepting sessions, then waits for every
+// drain, e.g. running uploads, and for open sessions to end. All of it
+// shares one deadline, whatever is left after it is closed.
+func Shutdown(s *ssh.Server, timeout time.Duration, logger *slog.Logger, drains ...func(context.Context) error) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.Shutdown(ctx)
+	}()
+
+	for _, drain := range drains {
+		err := drain(ctx)
+		if err != nil {
+			logger.Error("could not drain before shutdown", "err", err.Error())
+		}
+	}
+
+	err := <-closed
+	if err != nil {
+		_ = s.Close()
+	}
+	return err
+}
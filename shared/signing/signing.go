@@ -0,0 +1,185 @@
+// Package signing verifies the manifests deploys are signed with. Keys
+// and signatures come from minisign or gpg, the manifest is the output of
+// `sha256sum`.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Key checks the signature of a manifest.
+type Key interface {
+	// Verify fails unless sig is a valid signature of message.
+	Verify(message, sig []byte) error
+	// Kind is `minisign` or `gpg`.
+	Kind() string
+	// ID is the key id the way its tool prints it.
+	ID() string
+}
+
+// ParseKey reads a minisign public key, with or without its comment line,
+// or an armored gpg public key.
+func ParseKey(text string) (Key, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		return parseGPGKey(text)
+	}
+	return parseMinisignKey(text)
+}
+
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PublicKey
+}
+
+func parseMinisignKey(text string) (*minisignKey, error) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+			return nil, fmt.Errorf("not a minisign or gpg public key")
+		}
+		key := &minisignKey{key: ed25519.PublicKey(raw[10:])}
+		copy(key.id[:], raw[2:10])
+		return key, nil
+	}
+	return nil, fmt.Errorf("not a minisign or gpg public key")
+}
+
+func (k *minisignKey) Kind() string {
+	return "minisign"
+}
+
+// ID is printed by minisign as a little endian number.
+func (k *minisignKey) ID() string {
+	id := make([]byte, len(k.id))
+	for i := range k.id {
+		id[len(id)-1-i] = k.id[i]
+	}
+	return strings.ToUpper(hex.EncodeToString(id))
+}
+
+// Verify checks a .minisig file, both the signature of the message and the
+// one covering its trusted comment. `Ed` signs the message itself, `ED`
+// signs its blake2b hash.
+func (k *minisignKey) Verify(message, sig []byte) error {
+	lines := []string{}
+	for _, line := range strings.Split(string(sig), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("not a minisign signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("not a minisign signature")
+	}
+	if !bytes.Equal(raw[2:10], k.id[:]) {
+		return fmt.Errorf("signed by another key")
+	}
+
+	signed := message
+	switch string(raw[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(message)
+		signed = sum[:]
+	default:
+		return fmt.Errorf("unsupported minisign algorithm (%s)", raw[:2])
+	}
+	if !ed25519.Verify(k.key, signed, raw[10:]) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return fmt.Errorf("not a minisign signature")
+	}
+	comment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	signed = append(append([]byte{}, raw[10:]...), comment...)
+	if !ed25519.Verify(k.key, signed, global) {
+		return fmt.Errorf("invalid signature of the trusted comment")
+	}
+	return nil
+}
+
+type gpgKey struct {
+	keyring openpgp.EntityList
+}
+
+func parseGPGKey(text string) (*gpgKey, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("could not read gpg public key: %w", err)
+	}
+	if len(keyring) != 1 {
+		return nil, fmt.Errorf("expected one gpg public key, found (%d)", len(keyring))
+	}
+	return &gpgKey{keyring: keyring}, nil
+}
+
+func (k *gpgKey) Kind() string {
+	return "gpg"
+}
+
+func (k *gpgKey) ID() string {
+	return k.keyring[0].PrimaryKey.KeyIdString()
+}
+
+// Verify checks a detached signature, armored or not.
+func (k *gpgKey) Verify(message, sig []byte) error {
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP SIGNATURE-----")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(k.keyring, bytes.NewReader(message), bytes.NewReader(sig))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(k.keyring, bytes.NewReader(message), bytes.NewReader(sig))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// Manifest maps the paths of a deploy, relative to the project, to the
+// hex encoded sha256 of their contents.
+type Manifest map[string]string
+
+// ParseManifest reads the output of `sha256sum`, one `{hash}  {path}` per
+// line. Paths may start with `./`, binary mode's `*` is dropped.
+func ParseManifest(text string) (Manifest, error) {
+	manifest := Manifest{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		sum, fpath, ok := strings.Cut(line, " ")
+		fpath = strings.TrimPrefix(strings.TrimPrefix(fpath, " "), "*")
+		if _, err := hex.DecodeString(sum); !ok || err != nil || len(sum) != 64 || fpath == "" {
+			return nil, fmt.Errorf("line (%d) is not a sha256 and a path", i+1)
+		}
+		manifest[Clean(fpath)] = strings.ToLower(sum)
+	}
+	return manifest, nil
+}
+
+// Clean is how paths are compared, relative to the project without a
+// leading slash.
+func Clean(fpath string) string {
+	return strings.TrimPrefix(path.Clean("/"+fpath), "/")
+}
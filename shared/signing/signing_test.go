@@ -0,0 +1,119 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// minisign signs message the way `minisign -S` does.
+func minisign(priv ed25519.PrivateKey, id []byte, message []byte, comment string) string {
+	sum := blake2b.Sum512(message)
+	sig := append(append([]byte("ED"), id...), ed25519.Sign(priv, sum[:])...)
+	global := ed25519.Sign(priv, append(append([]byte{}, sig[10:]...), comment...))
+	return fmt.Sprintf(
+		"untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig),
+		comment,
+		base64.StdEncoding.EncodeToString(global),
+	)
+}
+
+func TestMinisign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	text := "untrusted comment: minisign public key 0807060504030201\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...)) + "\n"
+
+	key, err := ParseKey(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Kind() != "minisign" || key.ID() != "0807060504030201" {
+		t.Fatalf("unexpected key (%s) (%s)", key.Kind(), key.ID())
+	}
+
+	message := []byte("abc  index.html\n")
+	sig := minisign(priv, id, message, "timestamp:1709288400")
+	if err := key.Verify(message, []byte(sig)); err != nil {
+		t.Fatal(err)
+	}
+	if key.Verify([]byte("abc  evil.html\n"), []byte(sig)) == nil {
+		t.Error("expected a changed message to fail")
+	}
+	tampered := bytes.Replace([]byte(sig), []byte("timestamp:1709288400"), []byte("timestamp:1709288401"), 1)
+	if key.Verify(message, tampered) == nil {
+		t.Error("expected a changed trusted comment to fail")
+	}
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	if key.Verify(message, []byte(minisign(other, id, message, "x"))) == nil {
+		t.Error("expected a signature of another key to fail")
+	}
+
+	if _, err := ParseKey("RWQ not a key"); err == nil {
+		t.Error("expected garbage to fail")
+	}
+}
+
+func TestGPG(t *testing.T) {
+	entity, err := openpgp.NewEntity("site", "", "site@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pub bytes.Buffer
+	w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	key, err := ParseKey(pub.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Kind() != "gpg" || key.ID() != entity.PrimaryKey.KeyIdString() {
+		t.Fatalf("unexpected key (%s) (%s)", key.Kind(), key.ID())
+	}
+
+	message := []byte("abc  index.html\n")
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(message), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Verify(message, sig.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if key.Verify([]byte("abc  evil.html\n"), sig.Bytes()) == nil {
+		t.Error("expected a changed message to fail")
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	manifest, err := ParseManifest(sum + "  ./index.html\r\n" + sum + " *css/main.css\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Manifest{"index.html": sum, "css/main.css": sum}
+	if diff := cmp.Diff(expect, manifest); diff != "" {
+		t.Fatal(diff)
+	}
+
+	if _, err := ParseManifest("nope  index.html\n"); err == nil {
+		t.Error("expected an invalid hash to fail")
+	}
+}
@@ -0,0 +1,140 @@
+package social
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"path"
+	"strings"
+)
+
+// Width and Height are what link previews expect for a large card.
+const (
+	Width  = 1200
+	Height = 630
+)
+
+// Dir is where the preview images of posts are kept in a user's asset
+// bucket, it can never be a project name.
+var Dir = ".social"
+
+// Path is where the preview image of a post is stored.
+func Path(space, slug string) string {
+	return path.Join(Dir, space, strings.Trim(slug, "/")+".png")
+}
+
+// Card is what a preview image shows.
+type Card struct {
+	Title  string
+	Author string
+	Domain string
+}
+
+var (
+	background = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	foreground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	accent     = color.RGBA{0xa8, 0x48, 0xa8, 0xff}
+	muted      = color.RGBA{0x99, 0x99, 0x99, 0xff}
+)
+
+const (
+	margin     = 80
+	titleScale = 9
+	titleLines = 4
+	smallScale = 5
+)
+
+// Render draws the card onto the template and encodes it as a png.
+func Render(card Card) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, Width, 16), &image.Uniform{accent}, image.Point{}, draw.Src)
+
+	perLine := (Width - 2*margin) / advance(titleScale)
+	y := margin
+	for _, line := range wrap(card.Title, perLine, titleLines) {
+		drawText(img, line, margin, y, titleScale, foreground)
+		y += (glyphHeight + 3) * titleScale
+	}
+
+	bottom := Height - margin - glyphHeight*smallScale
+	if card.Author != "" {
+		drawText(img, card.Author, margin, bottom, smallScale, accent)
+	}
+	if card.Domain != "" {
+		x := Width - margin - len([]rune(card.Domain))*advance(smallScale)
+		drawText(img, card.Domain, x, bottom, smallScale, muted)
+	}
+
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func advance(scale int) int {
+	return (glyphWidth + 1) * scale
+}
+
+// wrap breaks text into at most maxLines lines of width runes, words too
+// long for a line are split and text that does not fit ends in an ellipsis.
+func wrap(text string, width, maxLines int) []string {
+	lines := []string{}
+	cur := []rune{}
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > 0 {
+			if len(cur) > 0 && len(cur)+1+len(runes) <= width {
+				cur = append(append(cur, ' '), runes...)
+				runes = nil
+				continue
+			}
+			if len(cur) > 0 {
+				lines = append(lines, string(cur))
+				cur = []rune{}
+			}
+			n := min(len(runes), width)
+			cur = append(cur, runes[:n]...)
+			runes = runes[n:]
+		}
+	}
+	if len(cur) > 0 {
+		lines = append(lines, string(cur))
+	}
+
+	if len(lines) > maxLines {
+		last := []rune(lines[maxLines-1])
+		if len(last) > width-3 {
+			last = last[:width-3]
+		}
+		lines = append(lines[:maxLines-1], strings.TrimRight(string(last), " ")+"...")
+	}
+	return lines
+}
+
+// drawText writes text with its top left corner at x, y, runes without a
+// glyph are drawn as `?`.
+func drawText(img draw.Image, text string, x, y, scale int, c color.Color) {
+	fill := &image.Uniform{c}
+	for _, r := range text {
+		glyph, ok := font[r]
+		if !ok {
+			glyph = font['?']
+		}
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				px := x + col*scale
+				py := y + row*scale
+				draw.Draw(img, image.Rect(px, py, px+scale, py+scale), fill, image.Point{}, draw.Src)
+			}
+		}
+		x += advance(scale)
+	}
+}
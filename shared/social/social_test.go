@@ -0,0 +1,58 @@
+package social
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		lines []string
+	}{
+		{name: "fits", text: "hello you", lines: []string{"hello you"}},
+		{name: "breaks between words", text: "the quick brown fox", lines: []string{"the quick", "brown fox"}},
+		{name: "splits long words", text: "abcdefghijklmn", lines: []string{"abcdefghij", "klmn"}},
+		{
+			name:  "ellipsis",
+			text:  "one two three four five six seven eight",
+			lines: []string{"one two", "three four", "five si..."},
+		},
+		{name: "empty", text: "  ", lines: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.lines, wrap(tt.text, 10, 3)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	data, err := Render(Card{Title: "Hello, world! ünïcode", Author: "erock", Domain: "prose.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != Width || img.Bounds().Dy() != Height {
+		t.Errorf("unexpected size %v", img.Bounds())
+	}
+	if r, _, _, _ := img.At(margin+2, margin+2).RGBA(); r == 0 {
+		t.Error("expected the title to be drawn")
+	}
+}
+
+func TestPath(t *testing.T) {
+	if got := Path("prose", "/hello-world"); got != ".social/prose/hello-world.png" {
+		t.Errorf("unexpected path %s", got)
+	}
+}
@@ -0,0 +1,32 @@
+package storage
+
+import "fmt"
+
+const (
+	BackendFS    = "fs"
+	BackendMinio = "minio"
+)
+
+// NewStorage creates the storage for a backend, an empty backend keeps the
+// old behavior of using minio whenever a url is configured and the local
+// filesystem otherwise.
+func NewStorage(backend, dir, minioURL, minioUser, minioPass string) (StorageServe, error) {
+	if backend == "" {
+		backend = BackendFS
+		if minioURL != "" {
+			backend = BackendMinio
+		}
+	}
+
+	switch backend {
+	case BackendFS:
+		return NewStorageFS(dir)
+	case BackendMinio:
+		if minioURL == "" {
+			return nil, fmt.Errorf("storage backend (%s) requires a minio url", backend)
+		}
+		return NewStorageMinio(minioURL, minioUser, minioPass)
+	default:
+		return nil, fmt.Errorf("unknown storage backend (%s), expected %s or %s", backend, BackendFS, BackendMinio)
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestNewStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	// an explicit fs backend ignores the minio url
+	st, err := NewStorage(BackendFS, dir, "http://minio:9000", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.(*StorageFS); !ok {
+		t.Fatalf("expected fs storage, got %T", st)
+	}
+
+	st, err = NewStorage("", dir, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.(*StorageFS); !ok {
+		t.Fatalf("expected fs storage without a minio url, got %T", st)
+	}
+
+	_, err = NewStorage(BackendMinio, dir, "", "", "")
+	if err == nil {
+		t.Fatal("expected minio without a url to fail")
+	}
+
+	_, err = NewStorage("s3", dir, "", "", "")
+	if err == nil {
+		t.Fatal("expected unknown backend to fail")
+	}
+}
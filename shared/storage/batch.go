@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// GetObjects fetches many objects at once using at most `concurrency`
+// requests in flight. A failed object does not fail the batch, its error is
+// reported under its name instead.
+func GetObjects(st sst.ObjectStorage, bucket sst.Bucket, names []string, concurrency int) (map[string]utils.ReaderAtCloser, map[string]error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	results := map[string]utils.ReaderAtCloser{}
+	errs := map[string]error{}
+
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				contents, _, _, err := st.GetObject(bucket, name)
+				mu.Lock()
+				if err != nil {
+					errs[name] = err
+				} else {
+					results[name] = contents
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, errs
+}
+
+// RemoveObjects deletes many objects at once using at most `concurrency`
+// requests in flight. Objects that could not be deleted are returned with
+// their error, the rest of the batch goes ahead regardless.
+func RemoveObjects(st sst.ObjectStorage, bucket sst.Bucket, names []string, concurrency int) map[string]error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	errs := map[string]error{}
+
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				err := st.DeleteObject(bucket, name)
+				if err != nil {
+					mu.Lock()
+					errs[name] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	return errs
+}
+
+// batchConcurrency caps the requests in flight for backends without a bulk
+// call of their own.
+const batchConcurrency = 8
+
+// BatchDelete removes every path in fpaths, a missing path counts as
+// removed. The filesystem has no bulk call, paths are removed one by one.
+func (s *StorageFS) BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error {
+	errs := map[string]error{}
+	for _, fpath := range fpaths {
+		err := s.DeleteObject(bucket, fpath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs[fpath] = err
+		}
+	}
+	return errs
+}
+
+// BatchStat returns the file info of every path in fpaths that exists,
+// missing paths are left out.
+func (s *StorageFS) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	infos := map[string]os.FileInfo{}
+	for _, fpath := range fpaths {
+		info, err := os.Stat(filepath.Join(bucket.Path, fpath))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return infos, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		infos[fpath] = info
+	}
+	return infos, nil
+}
+
+// BatchDelete removes fpaths with the s3 multi-object delete, up to a
+// thousand keys per request. s3 reports no error for keys that are gone.
+func (s *StorageMinio) BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error {
+	errs := map[string]error{}
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for _, fpath := range fpaths {
+			objects <- minio.ObjectInfo{Key: fpath}
+		}
+	}()
+
+	for failed := range s.Client.RemoveObjects(context.Background(), bucket.Name, objects, minio.RemoveObjectsOptions{}) {
+		errs[failed.ObjectName] = failed.Err
+	}
+	return errs
+}
+
+// BatchStat heads fpaths with a few requests in flight, s3 has no bulk
+// head. Missing paths are left out.
+func (s *StorageMinio) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	var mu sync.Mutex
+	infos := map[string]os.FileInfo{}
+	var errs []error
+
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < batchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fpath := range queue {
+				info, err := s.Client.StatObject(context.Background(), bucket.Name, fpath, minio.StatObjectOptions{})
+				mu.Lock()
+				if err == nil {
+					infos[fpath] = &utils.VirtualFile{
+						FName:    filepath.Base(fpath),
+						FSize:    info.Size,
+						FModTime: info.LastModified,
+					}
+				} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+					errs = append(errs, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, fpath := range fpaths {
+		queue <- fpath
+	}
+	close(queue)
+	wg.Wait()
+
+	return infos, errors.Join(errs...)
+}
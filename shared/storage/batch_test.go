@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type slowStorage struct {
+	StorageServe
+	mu       sync.Mutex
+	inflight int
+	peak     int
+}
+
+func (s *slowStorage) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	s.mu.Lock()
+	s.inflight += 1
+	s.peak = max(s.peak, s.inflight)
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inflight -= 1
+	s.mu.Unlock()
+
+	if fpath == "missing.html" {
+		return nil, 0, time.Time{}, os.ErrNotExist
+	}
+	return utils.NopReaderAtCloser(bytes.NewReader([]byte(fpath))), int64(len(fpath)), time.Time{}, nil
+}
+
+func TestGetObjects(t *testing.T) {
+	st := &slowStorage{}
+	names := []string{"missing.html"}
+	for i := 0; i < 20; i++ {
+		names = append(names, string(rune('a'+i))+".html")
+	}
+
+	results, errs := GetObjects(st, sst.Bucket{Name: "test"}, names, 3)
+	if len(results) != 20 {
+		t.Fatalf("expected 20 objects, got %d", len(results))
+	}
+	if len(errs) != 1 || errs["missing.html"] == nil {
+		t.Fatalf("expected missing object to be reported by name, got %v", errs)
+	}
+	if st.peak > 3 {
+		t.Fatalf("expected at most 3 requests in flight, saw %d", st.peak)
+	}
+	if st.peak < 2 {
+		t.Fatalf("expected objects to be fetched concurrently, saw %d in flight", st.peak)
+	}
+}
+
+func TestStorageFSBatch(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, st, "proj/index.html", "<h1>hi</h1>")
+	putFile(t, st, "proj/css/main.css", "body {}")
+	putFile(t, st, "proj/keep.html", "keep")
+	bucket, err := st.GetBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := st.BatchStat(bucket, []string{"proj/index.html", "proj/css/main.css", "proj/missing.html", "proj/css"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos["proj/index.html"].Size() != 11 || infos["proj/css/main.css"].Size() != 7 {
+		t.Fatalf("expected both files and nothing else, got %v", infos)
+	}
+
+	errs := st.BatchDelete(bucket, []string{"proj/index.html", "proj/css/main.css", "proj/missing.html"})
+	if len(errs) > 0 {
+		t.Fatalf("expected missing files to count as removed, got %v", errs)
+	}
+	entries, err := WalkObjects(st, bucket, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "proj/keep.html" {
+		t.Fatalf("expected only keep.html to be left, got %v", entries)
+	}
+	if _, err := st.GetObjectMeta(bucket, "proj/index.html"); err == nil {
+		t.Fatal("expected the meta of removed files to be gone")
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+type cachedBucket struct {
+	bucket  sst.Bucket
+	expires time.Time
+}
+
+// CachedStorage memoizes bucket handles so uploading many files in one
+// session does not look the same bucket up over and over. Every other
+// call goes straight to the underlying storage.
+type CachedStorage struct {
+	StorageServe
+	ttl     time.Duration
+	mu      sync.RWMutex
+	buckets map[string]cachedBucket
+}
+
+func NewCachedStorage(st StorageServe, ttl time.Duration) *CachedStorage {
+	return &CachedStorage{
+		StorageServe: st,
+		ttl:          ttl,
+		buckets:      map[string]cachedBucket{},
+	}
+}
+
+func (s *CachedStorage) get(name string) (sst.Bucket, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cached, ok := s.buckets[name]
+	if !ok || time.Now().After(cached.expires) {
+		return sst.Bucket{}, false
+	}
+	return cached.bucket, true
+}
+
+func (s *CachedStorage) set(bucket sst.Bucket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets[bucket.Name] = cachedBucket{
+		bucket:  bucket,
+		expires: time.Now().Add(s.ttl),
+	}
+}
+
+// Invalidate drops a bucket from the cache, call it whenever a bucket is
+// removed or renamed outside of DeleteBucket.
+func (s *CachedStorage) Invalidate(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets, name)
+}
+
+func (s *CachedStorage) GetBucket(name string) (sst.Bucket, error) {
+	if bucket, ok := s.get(name); ok {
+		return bucket, nil
+	}
+
+	bucket, err := s.StorageServe.GetBucket(name)
+	if err != nil {
+		return bucket, err
+	}
+	s.set(bucket)
+	return bucket, nil
+}
+
+func (s *CachedStorage) UpsertBucket(name string) (sst.Bucket, error) {
+	if bucket, ok := s.get(name); ok {
+		return bucket, nil
+	}
+
+	bucket, err := s.StorageServe.UpsertBucket(name)
+	if err != nil {
+		return bucket, err
+	}
+	s.set(bucket)
+	return bucket, nil
+}
+
+func (s *CachedStorage) DeleteBucket(bucket sst.Bucket) error {
+	s.Invalidate(bucket.Name)
+	return s.StorageServe.DeleteBucket(bucket)
+}
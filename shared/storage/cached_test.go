@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+type countingStorage struct {
+	StorageServe
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *countingStorage) GetBucket(name string) (sst.Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls += 1
+	return sst.Bucket{Name: name}, nil
+}
+
+func (s *countingStorage) UpsertBucket(name string) (sst.Bucket, error) {
+	return s.GetBucket(name)
+}
+
+func (s *countingStorage) DeleteBucket(bucket sst.Bucket) error {
+	return nil
+}
+
+func TestCachedStorage(t *testing.T) {
+	backend := &countingStorage{}
+	st := NewCachedStorage(backend, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = st.UpsertBucket("static-1")
+			_, _ = st.GetBucket("static-1")
+		}()
+	}
+	wg.Wait()
+
+	// concurrent misses can race to fill the cache but later calls are hits
+	before := backend.calls
+	_, _ = st.GetBucket("static-1")
+	if backend.calls != before {
+		t.Fatalf("expected cached bucket, backend was called %d times", backend.calls)
+	}
+
+	err := st.DeleteBucket(sst.Bucket{Name: "static-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = st.GetBucket("static-1")
+	if backend.calls != before+1 {
+		t.Fatal("expected deleted bucket to be looked up again")
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+// ErrNoChecksum is returned for objects stored before we recorded
+// checksums.
+var ErrNoChecksum = errors.New("no checksum recorded")
+
+// RehashObject reads fpath back and returns the checksum recorded at upload
+// along with the one of what is stored now. Objects compressed at rest are
+// hashed as they were uploaded, sidecars as they are stored.
+func RehashObject(st StorageServe, bucket sst.Bucket, fpath string) (string, string, error) {
+	meta, err := st.GetObjectMeta(bucket, fpath)
+	if err != nil || meta.Checksum == "" {
+		return "", "", ErrNoChecksum
+	}
+
+	contents, _, _, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		return meta.Checksum, "", err
+	}
+	if meta.ContentEncoding == "gzip" && meta.Source == "" {
+		contents, _, err = Decompress(contents)
+		if err != nil {
+			return meta.Checksum, "", err
+		}
+	}
+	defer contents.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, contents)
+	if err != nil {
+		return meta.Checksum, "", err
+	}
+	return meta.Checksum, hex.EncodeToString(hash.Sum(nil)), nil
+}
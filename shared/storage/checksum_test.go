@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/picosh/send/send/utils"
+)
+
+func shasum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestRehashObject(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := []byte("<h1>hi</h1>")
+	gzipped, err := Sidecar{Encoding: "gzip", Ext: ".gz"}.Compress(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := []struct {
+		fpath string
+		data  []byte
+		meta  *ObjectMeta
+	}{
+		// compressed at rest, hashed as it was uploaded
+		{fpath: "proj/index.html", data: gzipped, meta: &ObjectMeta{Checksum: shasum(text), ContentEncoding: "gzip"}},
+		// a sidecar is hashed as it is stored
+		{fpath: "proj/index.html.gz", data: gzipped, meta: &ObjectMeta{Checksum: shasum(gzipped), ContentEncoding: "gzip", Source: shasum(text)}},
+	}
+	for _, fixture := range fixtures {
+		_, err = st.PutObjectWithMeta(
+			bucket,
+			fixture.fpath,
+			utils.NopReaderAtCloser(bytes.NewReader(fixture.data)),
+			&utils.FileEntry{Filepath: fixture.fpath},
+			fixture.meta,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, actual, err := RehashObject(st, bucket, fixture.fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != actual {
+			t.Errorf("(%s) expected checksum (%s), got (%s)", fixture.fpath, expected, actual)
+		}
+	}
+
+	_, err = st.PutObject(bucket, "proj/old.html", utils.NopReaderAtCloser(bytes.NewReader(text)), &utils.FileEntry{Filepath: "proj/old.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = RehashObject(st, bucket, "proj/old.html")
+	if !errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("expected an object without meta to have no checksum, got %v", err)
+	}
+}
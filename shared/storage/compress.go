@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// DefaultCompressTypes are text formats that shrink well, anything already
+// compressed (images, archives, fonts) is left alone.
+var DefaultCompressTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// ShouldCompress reports whether an object of contentType and size should be
+// gzipped at rest. Types ending in `/` match every subtype. Special files
+// like `_headers` and `_redirects` are always stored as is.
+func ShouldCompress(fpath, contentType string, size, threshold int64, types []string) bool {
+	if threshold <= 0 || size < threshold {
+		return false
+	}
+	if strings.HasPrefix(filepath.Base(fpath), "_") {
+		return false
+	}
+
+	return MatchContentType(contentType, types)
+}
+
+// MatchContentType reports whether contentType is one of types, parameters
+// like `charset` are ignored. Types ending in `/` match every subtype.
+func MatchContentType(contentType string, types []string) bool {
+	mimeType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mimeType, t) {
+			return true
+		}
+		if mimeType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sidecar is a precompressed copy of an object stored next to it under
+// the object's name plus `Ext`.
+type Sidecar struct {
+	Encoding string
+	Ext      string
+}
+
+// Sidecars in order of preference when serving.
+var Sidecars = []Sidecar{
+	{Encoding: "br", Ext: ".br"},
+	{Encoding: "gzip", Ext: ".gz"},
+}
+
+func (sc Sidecar) Compress(data []byte) ([]byte, error) {
+	if sc.Encoding != "br" {
+		return Compress(data)
+	}
+
+	var buf bytes.Buffer
+	br := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	_, err := br.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = br.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SidecarBase returns the object a sidecar name would have been made from.
+func SidecarBase(fpath string) (string, bool) {
+	for _, sc := range Sidecars {
+		if strings.HasSuffix(fpath, sc.Ext) {
+			return strings.TrimSuffix(fpath, sc.Ext), true
+		}
+	}
+	return fpath, false
+}
+
+// Decompress reads a gzipped object into memory and closes it, the result
+// reports its uncompressed size.
+func Decompress(contents utils.ReaderAtCloser) (utils.ReaderAtCloser, int64, error) {
+	defer contents.Close()
+	gz, err := gzip.NewReader(contents)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer gz.Close()
+
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, 0, err
+	}
+	return utils.NopReaderAtCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+// IsCompressed reports whether an object was gzipped when it was stored.
+func IsCompressed(st StorageServe, bucket sst.Bucket, fpath string) bool {
+	meta, err := st.GetObjectMeta(bucket, fpath)
+	return err == nil && meta.ContentEncoding == "gzip"
+}
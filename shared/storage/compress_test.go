@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/picosh/send/send/utils"
+)
+
+func TestShouldCompress(t *testing.T) {
+	fixtures := []struct {
+		name        string
+		fpath       string
+		contentType string
+		size        int64
+		expect      bool
+	}{
+		{name: "html", fpath: "proj/index.html", contentType: "text/html; charset=utf-8", size: 2048, expect: true},
+		{name: "svg", fpath: "proj/logo.svg", contentType: "image/svg+xml", size: 2048, expect: true},
+		{name: "js", fpath: "proj/main.js", contentType: "application/javascript", size: 2048, expect: true},
+		{name: "below-threshold", fpath: "proj/index.html", contentType: "text/html", size: 10, expect: false},
+		{name: "png", fpath: "proj/logo.png", contentType: "image/png", size: 2048, expect: false},
+		{name: "jpg", fpath: "proj/logo.jpg", contentType: "image/jpeg", size: 2048, expect: false},
+		{name: "zip", fpath: "proj/site.zip", contentType: "application/zip", size: 2048, expect: false},
+		{name: "headers", fpath: "proj/_headers", contentType: "text/plain", size: 2048, expect: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			actual := ShouldCompress(fixture.fpath, fixture.contentType, fixture.size, 1024, DefaultCompressTypes)
+			if actual != fixture.expect {
+				t.Fatalf("expected (%t), got (%t)", fixture.expect, actual)
+			}
+		})
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte("<p>hello world</p>\n"), 100)
+	compressed, err := Compress(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(text) {
+		t.Fatalf("expected compression to shrink (%d bytes), got (%d bytes)", len(text), len(compressed))
+	}
+
+	decoded, size, err := Decompress(utils.NopReaderAtCloser(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, _ := io.ReadAll(decoded)
+	if !bytes.Equal(actual, text) || size != int64(len(text)) {
+		t.Fatalf("expected round trip to be byte-identical, got (%d bytes)", size)
+	}
+}
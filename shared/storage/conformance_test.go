@@ -0,0 +1,16 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/pico/shared/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storagetest.Run(t, st)
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/picosh/send/send/utils"
+)
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// ContextReader returns a reader that fails with ctx.Err() once ctx is done
+// so aborted transfers stop reading from the client.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, r: r}
+}
+
+type ctxReaderAtCloser struct {
+	ctxReader
+	contents utils.ReaderAtCloser
+}
+
+func (c *ctxReaderAtCloser) ReadAt(p []byte, off int64) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.contents.ReadAt(p, off)
+}
+
+func (c *ctxReaderAtCloser) Close() error {
+	return c.contents.Close()
+}
+
+func contextReaderAtCloser(ctx context.Context, contents utils.ReaderAtCloser) utils.ReaderAtCloser {
+	return &ctxReaderAtCloser{
+		ctxReader: ctxReader{ctx: ctx, r: contents},
+		contents:  contents,
+	}
+}
@@ -0,0 +1,525 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/db"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// ObjectsDir is where content addressed objects are kept inside a bucket.
+var ObjectsDir = ".objects"
+
+// ObjectManifests is the part of the database DedupStorage needs.
+type ObjectManifests interface {
+	UpsertObjectManifest(manifest *db.ObjectManifest) error
+	FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error)
+	FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error)
+	RemoveObjectManifest(bucket, fpath string) error
+	CountObjectManifestRefs(bucket, checksum string) (int, error)
+}
+
+// DedupStorage stores every object once per bucket under the sha256 of its
+// contents, a manifest in the database maps paths to those objects. Writing
+// a file that is already stored only touches the manifest so unchanged
+// files of a deploy cost neither time nor space. Objects written before it
+// was enabled are still read from their own path until they are written
+// again.
+type DedupStorage struct {
+	StorageServe
+	manifests ObjectManifests
+	locks     checksumLocks
+}
+
+func NewDedupStorage(st StorageServe, manifests ObjectManifests) *DedupStorage {
+	return &DedupStorage{
+		StorageServe: st,
+		manifests:    manifests,
+		locks:        checksumLocks{held: map[string]*checksumLock{}},
+	}
+}
+
+// checksumLocks serializes putting and releasing the object of a checksum,
+// a release that counted no references must not delete an object a put
+// found and is about to point a manifest at. Locks are dropped once nobody
+// waits on them.
+type checksumLocks struct {
+	mu   sync.Mutex
+	held map[string]*checksumLock
+}
+
+type checksumLock struct {
+	sync.Mutex
+	waiting int
+}
+
+func (l *checksumLocks) lock(bucket sst.Bucket, checksum string) func() {
+	key := bucket.Name + "/" + checksum
+	l.mu.Lock()
+	lock, ok := l.held[key]
+	if !ok {
+		lock = &checksumLock{}
+		l.held[key] = lock
+	}
+	lock.waiting += 1
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.waiting -= 1
+		if lock.waiting == 0 {
+			delete(l.held, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func manifestKey(fpath string) string {
+	return strings.Trim(path.Clean("/"+fpath), "/")
+}
+
+func objectPath(checksum string) string {
+	return path.Join(ObjectsDir, checksum[:2], checksum)
+}
+
+func isObjectPath(key string) bool {
+	return key == ObjectsDir || strings.HasPrefix(key, ObjectsDir+"/")
+}
+
+func manifestMeta(manifest *db.ObjectManifest) *ObjectMeta {
+	meta := &ObjectMeta{}
+	if len(manifest.Meta) > 0 {
+		_ = json.Unmarshal(manifest.Meta, meta)
+	}
+	return meta
+}
+
+func manifestModTime(manifest *db.ObjectManifest) time.Time {
+	meta := manifestMeta(manifest)
+	if meta.Mtime > 0 {
+		return time.Unix(meta.Mtime, 0)
+	}
+	if manifest.UpdatedAt != nil {
+		return *manifest.UpdatedAt
+	}
+	return time.Time{}
+}
+
+func manifestInfo(manifest *db.ObjectManifest, name string) os.FileInfo {
+	return &utils.VirtualFile{
+		FName:    name,
+		FIsDir:   false,
+		FSize:    manifest.Size,
+		FModTime: manifestModTime(manifest),
+	}
+}
+
+func (s *DedupStorage) find(bucket sst.Bucket, fpath string) (*db.ObjectManifest, bool) {
+	key := manifestKey(fpath)
+	if key == "" || isObjectPath(key) {
+		return nil, false
+	}
+	manifest, err := s.manifests.FindObjectManifest(bucket.Name, key)
+	if err != nil {
+		return nil, false
+	}
+	return manifest, true
+}
+
+// release removes the object behind checksum once no path points at it.
+func (s *DedupStorage) release(bucket sst.Bucket, checksum string) {
+	unlock := s.locks.lock(bucket, checksum)
+	defer unlock()
+	s.releaseLocked(bucket, checksum)
+}
+
+// releaseLocked is release with the lock of checksum held.
+func (s *DedupStorage) releaseLocked(bucket sst.Bucket, checksum string) {
+	refs, err := s.manifests.CountObjectManifestRefs(bucket.Name, checksum)
+	if err != nil || refs > 0 {
+		return
+	}
+	_ = s.StorageServe.DeleteObject(bucket, objectPath(checksum))
+}
+
+func hashContents(contents io.ReaderAt, size int64) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, io.NewSectionReader(contents, 0, size))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *DedupStorage) put(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	key := manifestKey(fpath)
+	// without a size we can't read the contents twice, it is stored as
+	// it is and must not be shadowed by an older manifest entry
+	if entry == nil || entry.Size <= 0 || key == "" || isObjectPath(key) {
+		loc, err := s.StorageServe.PutObjectCtx(ctx, bucket, fpath, contents, entry, meta)
+		if err == nil {
+			if previous, ok := s.find(bucket, fpath); ok {
+				_ = s.manifests.RemoveObjectManifest(bucket.Name, key)
+				s.release(bucket, previous.Checksum)
+			}
+		}
+		return loc, err
+	}
+
+	if meta == nil {
+		meta = &ObjectMeta{ContentType: GetMimeType(fpath), Mtime: entry.Mtime}
+	}
+	if meta.Mtime == 0 {
+		meta.Mtime = entry.Mtime
+	}
+
+	// the checksum we are handed is of the file before it was compressed
+	checksum := meta.Checksum
+	if checksum == "" || meta.ContentEncoding != "" {
+		var err error
+		checksum, err = hashContents(contextReaderAtCloser(ctx, contents), entry.Size)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	// the object is found or stored and the manifest points at it before
+	// anyone may count its references again
+	unlock := s.locks.lock(bucket, checksum)
+	defer func() {
+		if unlock != nil {
+			unlock()
+		}
+	}()
+	loc := path.Join(bucket.Name, objectPath(checksum))
+	if _, err := s.StorageServe.GetObjectSize(bucket, objectPath(checksum)); err != nil {
+		var err error
+		loc, err = s.StorageServe.PutObjectCtx(
+			ctx,
+			bucket,
+			objectPath(checksum),
+			utils.NopReaderAtCloser(io.NewSectionReader(contents, 0, entry.Size)),
+			entry,
+			meta,
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	previous, hasPrevious := s.find(bucket, fpath)
+	err = s.manifests.UpsertObjectManifest(&db.ObjectManifest{
+		Bucket:   bucket.Name,
+		Path:     key,
+		Checksum: checksum,
+		Size:     entry.Size,
+		Meta:     data,
+	})
+	if err != nil {
+		s.releaseLocked(bucket, checksum)
+		return "", err
+	}
+	unlock()
+	unlock = nil
+
+	if !hasPrevious {
+		// replaces a copy stored before deduplication, if there is one
+		_ = s.StorageServe.DeleteObject(bucket, fpath)
+	} else if previous.Checksum != checksum {
+		s.release(bucket, previous.Checksum)
+	}
+	return loc, nil
+}
+
+func (s *DedupStorage) PutObject(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry) (string, error) {
+	return s.put(context.Background(), bucket, fpath, contents, entry, nil)
+}
+
+func (s *DedupStorage) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	return s.put(context.Background(), bucket, fpath, contents, entry, meta)
+}
+
+func (s *DedupStorage) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return s.put(ctx, bucket, fpath, contents, entry, meta)
+}
+
+func (s *DedupStorage) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	manifest, ok := s.find(bucket, fpath)
+	if !ok {
+		return s.StorageServe.GetObject(bucket, fpath)
+	}
+
+	contents, _, _, err := s.StorageServe.GetObject(bucket, objectPath(manifest.Checksum))
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	return contents, manifest.Size, manifestModTime(manifest), nil
+}
+
+func (s *DedupStorage) ServeObject(bucket sst.Bucket, fpath string, opts *ImgProcessOpts) (io.ReadCloser, string, error) {
+	manifest, ok := s.find(bucket, fpath)
+	if !ok {
+		return s.StorageServe.ServeObject(bucket, fpath, opts)
+	}
+	if opts != nil {
+		return s.StorageServe.ServeObject(bucket, objectPath(manifest.Checksum), opts)
+	}
+
+	contentType := manifestMeta(manifest).ContentType
+	if contentType == "" {
+		contentType = GetMimeType(fpath)
+	}
+	contents, _, _, err := s.StorageServe.GetObject(bucket, objectPath(manifest.Checksum))
+	return contents, contentType, err
+}
+
+func (s *DedupStorage) GetObjectSize(bucket sst.Bucket, fpath string) (int64, error) {
+	manifest, ok := s.find(bucket, fpath)
+	if !ok {
+		return s.StorageServe.GetObjectSize(bucket, fpath)
+	}
+	return manifest.Size, nil
+}
+
+func (s *DedupStorage) GetObjectMeta(bucket sst.Bucket, fpath string) (*ObjectMeta, error) {
+	manifest, ok := s.find(bucket, fpath)
+	if !ok {
+		return s.StorageServe.GetObjectMeta(bucket, fpath)
+	}
+	return manifestMeta(manifest), nil
+}
+
+func (s *DedupStorage) GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error) {
+	manifest, ok := s.find(bucket, fpath)
+	if !ok {
+		return s.StorageServe.GetObjectRange(bucket, fpath, offset, length)
+	}
+	return s.StorageServe.GetObjectRange(bucket, objectPath(manifest.Checksum), offset, length)
+}
+
+func (s *DedupStorage) PresignGetURL(bucket sst.Bucket, fname string, ttl time.Duration) (string, error) {
+	manifest, ok := s.find(bucket, fname)
+	if !ok {
+		return s.StorageServe.PresignGetURL(bucket, fname, ttl)
+	}
+	return s.StorageServe.PresignGetURL(bucket, objectPath(manifest.Checksum), ttl)
+}
+
+func (s *DedupStorage) DeleteObject(bucket sst.Bucket, fpath string) error {
+	manifest, ok := s.find(bucket, fpath)
+	if !ok {
+		return s.StorageServe.DeleteObject(bucket, fpath)
+	}
+
+	err := s.manifests.RemoveObjectManifest(bucket.Name, manifest.Path)
+	if err != nil {
+		return err
+	}
+	s.release(bucket, manifest.Checksum)
+	return nil
+}
+
+// BatchDelete removes the manifest of deduplicated paths and releases their
+// objects once, the rest is removed by the underlying storage.
+func (s *DedupStorage) BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error {
+	errs := map[string]error{}
+	rest := []string{}
+	checksums := map[string]bool{}
+	for _, fpath := range fpaths {
+		manifest, ok := s.find(bucket, fpath)
+		if !ok {
+			rest = append(rest, fpath)
+			continue
+		}
+		err := s.manifests.RemoveObjectManifest(bucket.Name, manifest.Path)
+		if err != nil {
+			errs[fpath] = err
+			continue
+		}
+		checksums[manifest.Checksum] = true
+	}
+
+	for checksum := range checksums {
+		s.release(bucket, checksum)
+	}
+	if len(rest) > 0 {
+		for fpath, err := range s.StorageServe.BatchDelete(bucket, rest) {
+			errs[fpath] = err
+		}
+	}
+	return errs
+}
+
+func (s *DedupStorage) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	infos := map[string]os.FileInfo{}
+	rest := []string{}
+	for _, fpath := range fpaths {
+		manifest, ok := s.find(bucket, fpath)
+		if !ok {
+			rest = append(rest, fpath)
+			continue
+		}
+		infos[fpath] = manifestInfo(manifest, path.Base(fpath))
+	}
+	if len(rest) == 0 {
+		return infos, nil
+	}
+
+	found, err := s.StorageServe.BatchStat(bucket, rest)
+	for fpath, info := range found {
+		infos[fpath] = info
+	}
+	return infos, err
+}
+
+// MovePrefix only rewrites the manifest, objects stored before
+// deduplication are moved by the underlying storage.
+func (s *DedupStorage) MovePrefix(bucket sst.Bucket, from, to string) error {
+	manifests, err := s.manifests.FindObjectManifests(bucket.Name, manifestKey(from)+"/")
+	if err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		dst := manifestKey(movePath(from, to, manifest.Path))
+		previous, hasPrevious := s.find(bucket, dst)
+		err := s.manifests.UpsertObjectManifest(&db.ObjectManifest{
+			Bucket:   bucket.Name,
+			Path:     dst,
+			Checksum: manifest.Checksum,
+			Size:     manifest.Size,
+			Meta:     manifest.Meta,
+		})
+		if err != nil {
+			return err
+		}
+		err = s.manifests.RemoveObjectManifest(bucket.Name, manifest.Path)
+		if err != nil {
+			return err
+		}
+		if hasPrevious && previous.Checksum != manifest.Checksum {
+			s.release(bucket, previous.Checksum)
+		}
+	}
+
+	err = s.StorageServe.MovePrefix(bucket, from, to)
+	if err != nil && len(manifests) > 0 && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ListObjects merges the manifest with what the underlying storage lists,
+// keeping the semantics of the filesystem backend: a directory without a
+// trailing slash lists itself, with one it lists its children and
+// recursive listings only return files relative to dir.
+func (s *DedupStorage) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	key := manifestKey(dir)
+	if isObjectPath(key) {
+		return s.StorageServe.ListObjects(bucket, dir, recursive)
+	}
+
+	if manifest, ok := s.find(bucket, dir); ok {
+		return []os.FileInfo{manifestInfo(manifest, path.Base(manifest.Path))}, nil
+	}
+
+	stored, storedErr := s.StorageServe.ListObjects(bucket, dir, recursive)
+	stored = hideObjects(key, stored)
+
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	manifests, err := s.manifests.FindObjectManifests(bucket.Name, prefix)
+	if err != nil || len(manifests) == 0 {
+		return stored, storedErr
+	}
+
+	if !strings.HasSuffix(dir, "/") {
+		if storedErr == nil {
+			return stored, nil
+		}
+		modTime := time.Time{}
+		for _, manifest := range manifests {
+			if mt := manifestModTime(manifest); mt.After(modTime) {
+				modTime = mt
+			}
+		}
+		return []os.FileInfo{&utils.VirtualFile{FName: "", FIsDir: true, FModTime: modTime}}, nil
+	}
+
+	seen := map[string]bool{}
+	fileList := []os.FileInfo{}
+	for _, manifest := range manifests {
+		name := strings.TrimPrefix(manifest.Path, prefix)
+		if !recursive && strings.Contains(name, "/") {
+			name = strings.Split(name, "/")[0]
+			if !seen[name] {
+				seen[name] = true
+				fileList = append(fileList, &utils.VirtualFile{
+					FName:    name,
+					FIsDir:   true,
+					FModTime: manifestModTime(manifest),
+				})
+			}
+			continue
+		}
+		seen[name] = true
+		fileList = append(fileList, manifestInfo(manifest, name))
+	}
+
+	if storedErr == nil {
+		for _, file := range stored {
+			name := strings.Trim(file.Name(), "/")
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			fileList = append(fileList, file)
+		}
+	}
+
+	sort.Slice(fileList, func(i, j int) bool {
+		return fileList[i].Name() < fileList[j].Name()
+	})
+	return fileList, nil
+}
+
+// hideObjects drops the objects directory from listings of a bucket root.
+func hideObjects(key string, fileList []os.FileInfo) []os.FileInfo {
+	if key != "" {
+		return fileList
+	}
+
+	visible := []os.FileInfo{}
+	for _, file := range fileList {
+		if isObjectPath(strings.Trim(file.Name(), "/")) {
+			continue
+		}
+		visible = append(visible, file)
+	}
+	return visible
+}
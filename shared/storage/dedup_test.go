@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type memManifests struct {
+	mu   sync.Mutex
+	rows map[string]*db.ObjectManifest
+}
+
+func (m *memManifests) UpsertObjectManifest(manifest *db.ObjectManifest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[manifest.Bucket+":"+manifest.Path] = manifest
+	return nil
+}
+
+func (m *memManifests) FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	manifest, ok := m.rows[bucket+":"+fpath]
+	if !ok {
+		return nil, fmt.Errorf("manifest not found")
+	}
+	return manifest, nil
+}
+
+func (m *memManifests) FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	manifests := []*db.ObjectManifest{}
+	for _, manifest := range m.rows {
+		if manifest.Bucket == bucket && strings.HasPrefix(manifest.Path, prefix) {
+			manifests = append(manifests, manifest)
+		}
+	}
+	return manifests, nil
+}
+
+func (m *memManifests) RemoveObjectManifest(bucket, fpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rows, bucket+":"+fpath)
+	return nil
+}
+
+func (m *memManifests) CountObjectManifestRefs(bucket, checksum string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, manifest := range m.rows {
+		if manifest.Bucket == bucket && manifest.Checksum == checksum {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+func dedupPut(t *testing.T, st StorageServe, bucket sst.Bucket, fpath, text string) {
+	t.Helper()
+	_, err := st.PutObjectWithMeta(
+		bucket,
+		fpath,
+		utils.NopReaderAtCloser(strings.NewReader(text)),
+		&utils.FileEntry{Filepath: fpath, Size: int64(len(text)), Mtime: 1709288400},
+		&ObjectMeta{ContentType: "text/html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDedupStorage(t *testing.T) {
+	backend, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := backend.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// written before deduplication was enabled
+	putFile(t, backend, "proj/legacy.html", "<p>old</p>")
+
+	manifests := &memManifests{rows: map[string]*db.ObjectManifest{}}
+	st := NewDedupStorage(backend, manifests)
+	dedupPut(t, st, bucket, "proj/index.html", "<h1>hi</h1>")
+	dedupPut(t, st, bucket, "proj/about/index.html", "<h1>hi</h1>")
+	dedupPut(t, st, bucket, "other/index.html", "<h1>other</h1>")
+
+	stats, err := backend.GetBucketStats(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// legacy.html plus one object per distinct file
+	if stats.FileCount != 3 {
+		t.Fatalf("expected (3) stored objects, got (%d)", stats.FileCount)
+	}
+
+	contents, size, modTime, err := st.GetObject(bucket, "/proj/about/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := io.ReadAll(contents)
+	contents.Close()
+	if string(text) != "<h1>hi</h1>" || size != int64(len(text)) || modTime.Unix() != 1709288400 {
+		t.Fatalf("unexpected contents (%s) with size (%d) and mtime (%d)", text, size, modTime.Unix())
+	}
+	if GetContentType(st, bucket, "proj/index.html") != "text/html" {
+		t.Fatal("expected content type from the manifest")
+	}
+
+	fixtures := []struct {
+		dir       string
+		recursive bool
+		expect    []string
+	}{
+		{dir: "", expect: []string{""}},
+		{dir: "/", expect: []string{"other", "proj"}},
+		{dir: "proj/", expect: []string{"about", "index.html", "legacy.html"}},
+		{dir: "proj/", recursive: true, expect: []string{"about/index.html", "index.html", "legacy.html"}},
+		{dir: "proj/index.html", expect: []string{"index.html"}},
+		{dir: "proj/about", expect: []string{""}},
+	}
+	for _, fixture := range fixtures {
+		files, err := st.ListObjects(bucket, fixture.dir, fixture.recursive)
+		if err != nil {
+			t.Fatalf("%s: %s", fixture.dir, err)
+		}
+		if diff := cmp.Diff(fixture.expect, names(files)); diff != "" {
+			t.Fatalf("%s: %s", fixture.dir, diff)
+		}
+	}
+
+	err = st.MovePrefix(bucket, "proj", "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := WalkObjects(st, bucket, "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected (3) moved files, got (%d)", len(entries))
+	}
+
+	// the shared object stays until the last path pointing at it is gone
+	dedupPut(t, st, bucket, "moved/index.html", "<h1>changed</h1>")
+	contents, _, _, err = st.GetObject(bucket, "moved/about/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ = io.ReadAll(contents)
+	contents.Close()
+	if string(text) != "<h1>hi</h1>" {
+		t.Fatalf("expected the unchanged copy to be intact, got (%s)", text)
+	}
+	for _, fpath := range []string{"moved/about/index.html", "moved/index.html", "moved/legacy.html", "other/index.html"} {
+		err := st.DeleteObject(bucket, fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err = backend.GetBucketStats(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FileCount != 0 || len(manifests.rows) != 0 {
+		t.Fatalf("expected nothing left, got (%d) objects and (%d) manifests", stats.FileCount, len(manifests.rows))
+	}
+}
+
+func TestDedupStorageBatch(t *testing.T) {
+	backend, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := backend.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, backend, "proj/legacy.html", "<p>old</p>")
+
+	manifests := &memManifests{rows: map[string]*db.ObjectManifest{}}
+	st := NewDedupStorage(backend, manifests)
+	dedupPut(t, st, bucket, "proj/index.html", "<h1>hi</h1>")
+	dedupPut(t, st, bucket, "proj/about/index.html", "<h1>hi</h1>")
+	dedupPut(t, st, bucket, "other/index.html", "<h1>hi</h1>")
+
+	fpaths := []string{"proj/index.html", "proj/about/index.html", "proj/legacy.html"}
+	infos, err := st.BatchStat(bucket, fpaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 || infos["proj/about/index.html"].Name() != "index.html" || infos["proj/legacy.html"].Size() != 10 {
+		t.Fatalf("expected deduplicated and legacy files, got %v", infos)
+	}
+
+	errs := st.BatchDelete(bucket, fpaths)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	// other/index.html still points at the shared object
+	contents, _, _, err := st.GetObject(bucket, "other/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents.Close()
+
+	stats, err := backend.GetBucketStats(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FileCount != 1 {
+		t.Fatalf("expected only the shared object to be left, got (%d)", stats.FileCount)
+	}
+}
+
+func TestDedupStorageRace(t *testing.T) {
+	backend, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := backend.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewDedupStorage(backend, &memManifests{rows: map[string]*db.ObjectManifest{}})
+
+	// one path keeps releasing the object another path keeps reusing
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		text := "<h1>hi</h1>"
+		for i := 0; i < 200; i++ {
+			_, err := st.PutObject(
+				bucket,
+				"proj/b.html",
+				utils.NopReaderAtCloser(strings.NewReader(text)),
+				&utils.FileEntry{Filepath: "proj/b.html", Size: int64(len(text))},
+			)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = st.DeleteObject(bucket, "proj/b.html")
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		dedupPut(t, st, bucket, "proj/a.html", "<h1>hi</h1>")
+		_ = st.DeleteObject(bucket, "proj/a.html")
+	}
+	dedupPut(t, st, bucket, "proj/a.html", "<h1>hi</h1>")
+	wg.Wait()
+
+	contents, _, _, err := st.GetObject(bucket, "proj/a.html")
+	if err != nil {
+		t.Fatalf("expected the object of a.html to be kept: %s", err)
+	}
+	_ = contents.Close()
+}
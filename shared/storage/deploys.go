@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+var deployRe = regexp.MustCompile(`^(.+)@([0-9]+)$`)
+
+// DeployName is the prefix revision rev of a project is kept under, `@` is
+// not allowed in project names so a revision never clashes with a project.
+func DeployName(projectName string, rev int) string {
+	return fmt.Sprintf("%s@%d", projectName, rev)
+}
+
+// ParseDeployName is the inverse of DeployName.
+func ParseDeployName(name string) (string, int, bool) {
+	match := deployRe.FindStringSubmatch(name)
+	if match == nil {
+		return name, 0, false
+	}
+	rev, err := strconv.Atoi(match[2])
+	if err != nil || rev == 0 {
+		return name, 0, false
+	}
+	return match[1], rev, true
+}
+
+func IsDeploy(name string) bool {
+	_, _, ok := ParseDeployName(name)
+	return ok
+}
+
+// SnapshotDeploy copies the assets of a project into revision rev. Previous
+// versions of files are left out, they belong to the project directory. A
+// snapshot that fails partway is removed again.
+func SnapshotDeploy(st StorageServe, bucket sst.Bucket, projectName string, rev int) (int, int64, error) {
+	count := 0
+	size := int64(0)
+	dst := DeployName(projectName, rev)
+
+	entries, err := WalkObjects(st, bucket, projectName)
+	if err != nil {
+		return count, size, err
+	}
+
+	for _, entry := range entries {
+		if IsVersion(entry.Path) {
+			continue
+		}
+		err := CopyObject(st, bucket, entry.Path, movePath(projectName, dst, entry.Path))
+		if err != nil {
+			_, _, _ = DeleteObjects(st, bucket, dst)
+			return 0, 0, err
+		}
+		count += 1
+		size += entry.Size()
+	}
+
+	return count, size, nil
+}
+
+// PruneDeploys removes the revisions beyond the newest keep, revisions are
+// expected newest first. The current revision is never removed, even when
+// a rollback made it an old one. It returns the removed revisions and the
+// bytes they freed.
+func PruneDeploys(st StorageServe, bucket sst.Bucket, projectName string, revisions []int, current, keep int) ([]int, int64, error) {
+	removed := []int{}
+	size := int64(0)
+
+	kept := 0
+	for _, rev := range revisions {
+		if rev == current || kept < keep {
+			kept += 1
+			continue
+		}
+
+		_, freed, err := DeleteObjects(st, bucket, DeployName(projectName, rev))
+		if err != nil {
+			return removed, size, err
+		}
+		removed = append(removed, rev)
+		size += freed
+	}
+
+	return removed, size, nil
+}
@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
 )
 
 type StorageFS struct {
@@ -23,7 +28,7 @@ func NewStorageFS(dir string) (*StorageFS, error) {
 
 func (s *StorageFS) ServeObject(bucket sst.Bucket, fpath string, opts *ImgProcessOpts) (io.ReadCloser, string, error) {
 	if opts == nil || os.Getenv("IMGPROXY_URL") == "" {
-		contentType := GetMimeType(fpath)
+		contentType := GetContentType(s, bucket, fpath)
 		rc, _, _, err := s.GetObject(bucket, fpath)
 		return rc, contentType, err
 	}
@@ -41,3 +46,137 @@ func (s *StorageFS) GetObjectSize(bucket sst.Bucket, fpath string) (int64, error
 	size := fi.Size()
 	return size, nil
 }
+
+// the filesystem has nowhere to keep object metadata so we store it as
+// json in a separate tree that bucket listings never walk.
+func (s *StorageFS) metaPath(bucket sst.Bucket, fpath string) string {
+	return filepath.Join(s.Dir, ".meta", bucket.Name, fpath+".json")
+}
+
+func (s *StorageFS) GetObjectMeta(bucket sst.Bucket, fpath string) (*ObjectMeta, error) {
+	data, err := os.ReadFile(s.metaPath(bucket, fpath))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ObjectMeta{}
+	err = json.Unmarshal(data, meta)
+	return meta, err
+}
+
+func (s *StorageFS) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	loc, err := s.PutObject(bucket, fpath, contents, entry)
+	if err != nil || meta == nil {
+		return loc, err
+	}
+
+	metaLoc := s.metaPath(bucket, fpath)
+	err = os.MkdirAll(filepath.Dir(metaLoc), os.ModePerm)
+	if err != nil {
+		return loc, err
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return loc, err
+	}
+
+	return loc, os.WriteFile(metaLoc, data, 0644)
+}
+
+// PutObjectCtx stops writing when ctx is done and removes the partial file
+// that would otherwise be left behind.
+func (s *StorageFS) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	loc, err := s.PutObjectWithMeta(bucket, fpath, contextReaderAtCloser(ctx, contents), entry, meta)
+	if err != nil && ctx.Err() != nil {
+		_ = s.DeleteObject(bucket, fpath)
+		return "", ctx.Err()
+	}
+	return loc, err
+}
+
+func (s *StorageFS) DeleteObject(bucket sst.Bucket, fpath string) error {
+	err := s.StorageFS.DeleteObject(bucket, fpath)
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(s.metaPath(bucket, fpath))
+	return nil
+}
+
+// ListObjects matches the minio backend for recursive listings: only
+// files are returned and their names are relative to dir.
+func (s *StorageFS) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	if !recursive {
+		return s.StorageFS.ListObjects(bucket, dir, recursive)
+	}
+
+	var fileList []os.FileInfo
+	fpath := filepath.Join(bucket.Path, dir)
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return fileList, err
+	}
+
+	if !info.IsDir() || !strings.HasSuffix(dir, "/") {
+		return s.StorageFS.ListObjects(bucket, dir, recursive)
+	}
+
+	err = filepath.WalkDir(fpath, func(loc string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(fpath, loc)
+		if err != nil {
+			return err
+		}
+
+		fileList = append(fileList, &utils.VirtualFile{
+			FName:    filepath.ToSlash(name),
+			FIsDir:   false,
+			FSize:    info.Size(),
+			FModTime: info.ModTime(),
+		})
+		return nil
+	})
+
+	return fileList, err
+}
+
+type limitedFile struct {
+	io.Reader
+	f *os.File
+}
+
+func (l *limitedFile) Close() error {
+	return l.f.Close()
+}
+
+func (s *StorageFS) GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(bucket.Path, fpath))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &limitedFile{Reader: io.LimitReader(f, length), f: f}, nil
+}
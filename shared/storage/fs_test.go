@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/send/send/utils"
+)
+
+func putFile(t *testing.T, st *StorageFS, fpath, text string) {
+	t.Helper()
+	bucket, err := st.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		fpath,
+		utils.NopReaderAtCloser(bytes.NewReader([]byte(text))),
+		&utils.FileEntry{Filepath: fpath, Mtime: 1709288400},
+		&ObjectMeta{ContentType: "text/html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(files []os.FileInfo) []string {
+	results := []string{}
+	for _, file := range files {
+		results = append(results, file.Name())
+	}
+	sort.Strings(results)
+	return results
+}
+
+func TestStorageFSRoundTrip(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, st, "proj/index.html", "<h1>hi</h1>")
+
+	bucket, err := st.GetBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, size, modTime, err := st.GetObject(bucket, "proj/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+
+	buf := make([]byte, 2)
+	_, err = contents.ReadAt(buf, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hi" {
+		t.Fatalf("expected ReadAt to return `hi`, got %q", buf)
+	}
+
+	text, err := io.ReadAll(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "<h1>hi</h1>" || size != int64(len(text)) {
+		t.Fatalf("unexpected contents (%s) with size (%d)", text, size)
+	}
+	if modTime.Unix() != 1709288400 {
+		t.Fatalf("expected mtime to be preserved, got %d", modTime.Unix())
+	}
+
+	quota, err := st.GetBucketQuota(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quota != uint64(size) {
+		t.Fatalf("expected quota (%d), got (%d)", size, quota)
+	}
+}
+
+func TestStorageFSListObjects(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, st, "proj/index.html", "index")
+	putFile(t, st, "proj/css/main.css", "css")
+
+	bucket, err := st.GetBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := st.ListObjects(bucket, "proj/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"css", "index.html"}, names(files)); diff != "" {
+		t.Error(diff)
+	}
+
+	files, err = st.ListObjects(bucket, "proj/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"css/main.css", "index.html"}, names(files)); diff != "" {
+		t.Error(diff)
+	}
+
+	entries, err := WalkObjects(st, bucket, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	sort.Strings(paths)
+	if diff := cmp.Diff([]string{"proj/css/main.css", "proj/index.html"}, paths); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDeleteObjects(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, st, "proj/index.html", "index")
+	putFile(t, st, "proj/css/main.css", "css")
+	putFile(t, st, "other/index.html", "other")
+
+	bucket, err := st.GetBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, size, err := DeleteObjects(st, bucket, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || size != 8 {
+		t.Errorf("expected 2 files (8 bytes) to be deleted, got %d (%d bytes)", count, size)
+	}
+	entries, err := WalkObjects(st, bucket, "proj")
+	if err == nil && len(entries) > 0 {
+		t.Errorf("expected nested files to be deleted, found %d", len(entries))
+	}
+	_, err = st.GetObjectSize(bucket, "other/index.html")
+	if err != nil {
+		t.Errorf("expected other projects to be kept, got %s", err)
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, st, "proj/video.mp4", "0123456789")
+
+	bucket, err := st.GetBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewRangeReader(st, bucket, "proj/video.mp4", 10)
+
+	buf := make([]byte, 4)
+	n, err := reader.ReadAt(buf, 3)
+	if err != nil || string(buf[:n]) != "3456" {
+		t.Fatalf("expected `3456`, got %q (%v)", buf[:n], err)
+	}
+
+	n, err = reader.ReadAt(buf, 8)
+	if err != io.EOF || string(buf[:n]) != "89" {
+		t.Fatalf("expected `89` with io.EOF, got %q (%v)", buf[:n], err)
+	}
+
+	n, err = reader.ReadAt(buf, 20)
+	if err != io.EOF || n != 0 {
+		t.Fatalf("expected io.EOF past the end, got %d (%v)", n, err)
+	}
+
+	text, err := io.ReadAll(reader)
+	if err != nil || string(text) != "0123456789" {
+		t.Fatalf("expected full contents, got %q (%v)", text, err)
+	}
+}
+
+func TestFindVersions(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, st, "proj/index.html", "<h1>v3</h1>")
+	putFile(t, st, "proj/index.html.v2", "<h1>v2</h1>")
+	putFile(t, st, "proj/index.html.v10", "<h1>v1</h1>")
+	putFile(t, st, "proj/about.html.v1", "<h1>about</h1>")
+
+	bucket, err := st.GetBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := FindVersions(st, bucket, "proj/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{2, 10}, versions); diff != "" {
+		t.Error(diff)
+	}
+
+	err = CopyObject(st, bucket, "proj/index.html", VersionName("proj/index.html", 11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _, _, err := st.GetObject(bucket, "proj/index.html.v11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	text, _ := io.ReadAll(contents)
+	if diff := cmp.Diff("<h1>v3</h1>", string(text)); diff != "" {
+		t.Error(diff)
+	}
+
+	if IsVersion("proj/index.html") || IsVersion("proj/index.html.v0") {
+		t.Error("expected file to not be a version")
+	}
+}
+
+func TestPutObjectCtxCanceled(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = st.PutObjectCtx(
+		ctx,
+		bucket,
+		"proj/index.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("<h1>hi</h1>"))),
+		&utils.FileEntry{Filepath: "proj/index.html"},
+		nil,
+	)
+	if err == nil {
+		t.Fatal("expected canceled upload to fail")
+	}
+
+	_, err = st.GetObjectSize(bucket, "proj/index.html")
+	if err == nil {
+		t.Fatal("expected no object to be left behind")
+	}
+}
+
+func TestServeObjectContentType(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := []byte("<!DOCTYPE html><h1>hi</h1>")
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		"/test/page",
+		utils.NopReaderAtCloser(bytes.NewReader(text)),
+		&utils.FileEntry{Filepath: "/test/page"},
+		&ObjectMeta{ContentType: DetectContentType("/test/page", text)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"/test/main.css",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("body {}"))),
+		&utils.FileEntry{Filepath: "/test/main.css"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := map[string]string{
+		// sniffed at upload, the extension would say text/plain
+		"/test/page": "text/html; charset=utf-8",
+		// no metadata so we go by the extension
+		"/test/main.css": "text/css",
+	}
+	for fpath, expected := range fixtures {
+		rc, contentType, err := st.ServeObject(bucket, fpath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+		if contentType != expected {
+			t.Errorf("%s: expected (%s), got (%s)", fpath, expected, contentType)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+// Package memory keeps objects in memory behind storage.StorageServe. It
+// passes the same conformance tests as the filesystem and minio backends
+// so services can be tested without a bucket on disk.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type object struct {
+	data    []byte
+	modTime time.Time
+	meta    *storage.ObjectMeta
+}
+
+func (o *object) info(name string) os.FileInfo {
+	return &utils.VirtualFile{
+		FName:    name,
+		FSize:    int64(len(o.data)),
+		FModTime: o.modTime,
+	}
+}
+
+type upload struct {
+	id        string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+type StorageMemory struct {
+	mu sync.Mutex
+	// objects are keyed by bucket and then by their path in the bucket
+	objects map[string]map[string]*object
+	// uploads are keyed by bucket and path, the newest upload is last
+	uploads map[string]map[string][]*upload
+	nextID  int64
+}
+
+var _ storage.StorageServe = (*StorageMemory)(nil)
+
+func NewStorageMemory() *StorageMemory {
+	return &StorageMemory{
+		objects: map[string]map[string]*object{},
+		uploads: map[string]map[string][]*upload{},
+	}
+}
+
+// clean turns fpath into the key it is stored under, paths never start or
+// end with a slash.
+func clean(fpath string) string {
+	return strings.TrimPrefix(path.Clean("/"+fpath), "/")
+}
+
+func notExist(op, fpath string) error {
+	return &fs.PathError{Op: op, Path: fpath, Err: fs.ErrNotExist}
+}
+
+// find assumes the lock is held.
+func (s *StorageMemory) find(bucket sst.Bucket, fpath string) (*object, error) {
+	obj, ok := s.objects[bucket.Name][clean(fpath)]
+	if !ok {
+		return nil, notExist("open", fpath)
+	}
+	return obj, nil
+}
+
+// put assumes the lock is held.
+func (s *StorageMemory) put(bucket sst.Bucket, fpath string, obj *object) error {
+	objects, ok := s.objects[bucket.Name]
+	if !ok {
+		return fmt.Errorf("bucket does not exist: %s", bucket.Name)
+	}
+	objects[clean(fpath)] = obj
+	return nil
+}
+
+func (s *StorageMemory) GetBucket(name string) (sst.Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := sst.Bucket{Name: name, Path: name}
+	if _, ok := s.objects[name]; !ok {
+		return bucket, fmt.Errorf("bucket does not exist: %s %w", name, fs.ErrNotExist)
+	}
+	return bucket, nil
+}
+
+func (s *StorageMemory) UpsertBucket(name string) (sst.Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[name]; !ok {
+		s.objects[name] = map[string]*object{}
+	}
+	return sst.Bucket{Name: name, Path: name}, nil
+}
+
+func (s *StorageMemory) ListBuckets() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *StorageMemory) DeleteBucket(bucket sst.Bucket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, bucket.Name)
+	delete(s.uploads, bucket.Name)
+	return nil
+}
+
+func (s *StorageMemory) GetBucketStats(bucket sst.Bucket) (storage.BucketStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := storage.BucketStats{}
+	objects, ok := s.objects[bucket.Name]
+	if !ok {
+		return stats, notExist("stat", bucket.Name)
+	}
+	for _, obj := range objects {
+		stats.TotalSize += uint64(len(obj.data))
+		stats.FileCount += 1
+	}
+	return stats, nil
+}
+
+func (s *StorageMemory) GetBucketQuota(bucket sst.Bucket) (uint64, error) {
+	stats, err := s.GetBucketStats(bucket)
+	return stats.TotalSize, err
+}
+
+// GetObject hands out the stored bytes, objects are replaced rather than
+// changed in place so readers never see a later write.
+func (s *StorageMemory) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := s.find(bucket, fpath)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	return utils.NopReaderAtCloser(bytes.NewReader(obj.data)), int64(len(obj.data)), obj.modTime, nil
+}
+
+func (s *StorageMemory) PutObject(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry) (string, error) {
+	return s.PutObjectWithMeta(bucket, fpath, contents, entry, nil)
+}
+
+func (s *StorageMemory) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *storage.ObjectMeta) (string, error) {
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		return "", err
+	}
+
+	obj := &object{data: data, modTime: time.Now()}
+	if entry != nil && entry.Mtime > 0 {
+		obj.modTime = time.Unix(entry.Mtime, 0)
+	}
+	if meta != nil {
+		copied := *meta
+		obj.meta = &copied
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return path.Join(bucket.Name, clean(fpath)), s.put(bucket, fpath, obj)
+}
+
+// PutObjectCtx only stores the object once it was read in full, a
+// cancelled upload leaves nothing behind.
+func (s *StorageMemory) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *storage.ObjectMeta) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(storage.ContextReader(ctx, contents))
+	if err != nil {
+		return "", err
+	}
+	return s.PutObjectWithMeta(bucket, fpath, utils.NopReaderAtCloser(bytes.NewReader(data)), entry, meta)
+}
+
+func (s *StorageMemory) DeleteObject(bucket sst.Bucket, fpath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.find(bucket, fpath); err != nil {
+		return notExist("remove", fpath)
+	}
+	delete(s.objects[bucket.Name], clean(fpath))
+	return nil
+}
+
+// ListObjects matches the filesystem backend: a directory without a
+// trailing slash is listed as itself, with one it is listed by its
+// children and recursive listings return only files named relative to
+// dir.
+func (s *StorageMemory) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileList := []os.FileInfo{}
+	objects, ok := s.objects[bucket.Name]
+	if !ok {
+		return fileList, notExist("stat", dir)
+	}
+
+	key := clean(dir)
+	if obj, ok := objects[key]; ok {
+		return append(fileList, obj.info(path.Base(key))), nil
+	}
+
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	seen := map[string]bool{}
+	var modTime time.Time
+	for fpath, obj := range objects {
+		if !strings.HasPrefix(fpath, prefix) {
+			continue
+		}
+		if obj.modTime.After(modTime) {
+			modTime = obj.modTime
+		}
+
+		rel := strings.TrimPrefix(fpath, prefix)
+		if recursive {
+			fileList = append(fileList, obj.info(rel))
+			continue
+		}
+
+		name, _, isDir := strings.Cut(rel, "/")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if isDir {
+			fileList = append(fileList, &utils.VirtualFile{FName: name, FIsDir: true})
+		} else {
+			fileList = append(fileList, obj.info(name))
+		}
+	}
+
+	if modTime.IsZero() && key != "" {
+		return fileList, notExist("stat", dir)
+	}
+	if !strings.HasSuffix(dir, "/") {
+		return []os.FileInfo{&utils.VirtualFile{FIsDir: true, FModTime: modTime}}, nil
+	}
+
+	sort.Slice(fileList, func(i, j int) bool {
+		return fileList[i].Name() < fileList[j].Name()
+	})
+	return fileList, nil
+}
+
+// ServeObject ignores opts, there is no file an image proxy could read.
+func (s *StorageMemory) ServeObject(bucket sst.Bucket, fpath string, opts *storage.ImgProcessOpts) (io.ReadCloser, string, error) {
+	contentType := storage.GetContentType(s, bucket, fpath)
+	rc, _, _, err := s.GetObject(bucket, fpath)
+	return rc, contentType, err
+}
+
+func (s *StorageMemory) GetObjectSize(bucket sst.Bucket, fpath string) (int64, error) {
+	_, size, _, err := s.GetObject(bucket, fpath)
+	return size, err
+}
+
+func (s *StorageMemory) GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := s.find(bucket, fpath)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("negative offset %d", offset)
+	}
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(obj.data), offset, length)), nil
+}
+
+func (s *StorageMemory) PresignGetURL(bucket sst.Bucket, fname string, ttl time.Duration) (string, error) {
+	return "", storage.ErrPresignUnsupported
+}
+
+func (s *StorageMemory) BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, fpath := range fpaths {
+		delete(s.objects[bucket.Name], clean(fpath))
+	}
+	return map[string]error{}
+}
+
+func (s *StorageMemory) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := map[string]os.FileInfo{}
+	for _, fpath := range fpaths {
+		obj, err := s.find(bucket, fpath)
+		if err != nil {
+			continue
+		}
+		infos[fpath] = obj.info(path.Base(clean(fpath)))
+	}
+	return infos, nil
+}
+
+// MovePrefix is atomic here, unlike on the other backends.
+func (s *StorageMemory) MovePrefix(bucket sst.Bucket, from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.objects[bucket.Name]
+	if !ok {
+		return notExist("rename", from)
+	}
+
+	prefix := clean(from) + "/"
+	for fpath, obj := range objects {
+		if !strings.HasPrefix(fpath, prefix) {
+			continue
+		}
+		delete(objects, fpath)
+		objects[clean(path.Join(to, strings.TrimPrefix(fpath, prefix)))] = obj
+	}
+	return nil
+}
+
+func (s *StorageMemory) GetObjectMeta(bucket sst.Bucket, fpath string) (*storage.ObjectMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := s.find(bucket, fpath)
+	if err != nil {
+		return nil, err
+	}
+	if obj.meta == nil {
+		return nil, notExist("open", fpath)
+	}
+	meta := *obj.meta
+	return &meta, nil
+}
+
+// findUpload assumes the lock is held.
+func (s *StorageMemory) findUpload(bucket sst.Bucket, fpath, uploadID string) (*upload, error) {
+	for _, up := range s.uploads[bucket.Name][clean(fpath)] {
+		if up.id == uploadID {
+			return up, nil
+		}
+	}
+	return nil, notExist("open", uploadID)
+}
+
+// CreateMultipartUpload counts ids up so the newest upload of a path
+// sorts last, like the timestamps of the filesystem backend.
+func (s *StorageMemory) CreateMultipartUpload(bucket sst.Bucket, fpath string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID += 1
+	up := &upload{id: strconv.FormatInt(s.nextID, 10), initiated: time.Now(), parts: map[int][]byte{}}
+
+	uploads, ok := s.uploads[bucket.Name]
+	if !ok {
+		uploads = map[string][]*upload{}
+		s.uploads[bucket.Name] = uploads
+	}
+	uploads[clean(fpath)] = append(uploads[clean(fpath)], up)
+	return up.id, nil
+}
+
+func (s *StorageMemory) FindMultipartUpload(bucket sst.Bucket, fpath string) (*storage.MultipartUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads := s.uploads[bucket.Name][clean(fpath)]
+	if len(uploads) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	latest := uploads[len(uploads)-1]
+	result := &storage.MultipartUpload{ID: latest.id, Initiated: latest.initiated}
+	for number, data := range latest.parts {
+		result.Parts = append(result.Parts, storage.ObjectPart{Number: number, Size: int64(len(data))})
+	}
+	sort.Slice(result.Parts, func(i, j int) bool {
+		return result.Parts[i].Number < result.Parts[j].Number
+	})
+	return result, nil
+}
+
+// PutObjectPart never keeps a part that was cut short.
+func (s *StorageMemory) PutObjectPart(bucket sst.Bucket, fpath, uploadID string, number int, contents io.Reader, size int64) (storage.ObjectPart, error) {
+	data, err := io.ReadAll(io.LimitReader(contents, size))
+	if err != nil {
+		return storage.ObjectPart{}, err
+	}
+	if int64(len(data)) != size {
+		return storage.ObjectPart{}, io.ErrUnexpectedEOF
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up, err := s.findUpload(bucket, fpath, uploadID)
+	if err != nil {
+		return storage.ObjectPart{}, err
+	}
+	up.parts[number] = data
+	return storage.ObjectPart{Number: number, Size: size}, nil
+}
+
+func (s *StorageMemory) CompleteMultipartUpload(bucket sst.Bucket, fpath, uploadID string, parts []storage.ObjectPart) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up, err := s.findUpload(bucket, fpath, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	data := []byte{}
+	for _, part := range parts {
+		chunk, ok := up.parts[part.Number]
+		if !ok {
+			return "", fmt.Errorf("part %d of upload %s: %w", part.Number, uploadID, fs.ErrNotExist)
+		}
+		data = append(data, chunk...)
+	}
+
+	err = s.put(bucket, fpath, &object{data: data, modTime: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	s.abort(bucket, fpath, uploadID)
+	return path.Join(bucket.Name, clean(fpath)), nil
+}
+
+// abort assumes the lock is held.
+func (s *StorageMemory) abort(bucket sst.Bucket, fpath, uploadID string) {
+	uploads := s.uploads[bucket.Name]
+	key := clean(fpath)
+	for i, up := range uploads[key] {
+		if up.id == uploadID {
+			uploads[key] = append(uploads[key][:i], uploads[key][i+1:]...)
+			break
+		}
+	}
+	if len(uploads[key]) == 0 {
+		delete(uploads, key)
+	}
+}
+
+func (s *StorageMemory) AbortMultipartUpload(bucket sst.Bucket, fpath, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.abort(bucket, fpath, uploadID)
+	return nil
+}
+
+func (s *StorageMemory) AbortStaleMultipartUploads(bucket sst.Bucket, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stale := map[string][]string{}
+	for key, uploads := range s.uploads[bucket.Name] {
+		for _, up := range uploads {
+			if up.initiated.Before(before) {
+				stale[key] = append(stale[key], up.id)
+			}
+		}
+	}
+	count := 0
+	for key, ids := range stale {
+		for _, id := range ids {
+			s.abort(bucket, key, id)
+			count += 1
+		}
+	}
+	return count, nil
+}
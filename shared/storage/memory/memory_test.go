@@ -0,0 +1,11 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/picosh/pico/shared/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, NewStorageMemory())
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// ObjectMeta is extra information recorded alongside an object when it
+// is uploaded.
+type ObjectMeta struct {
+	ContentType string `json:"content_type"`
+	// Checksum is the hex encoded sha256 of the object
+	Checksum string `json:"checksum"`
+	// Mtime is the unix modification time reported by the client
+	Mtime int64 `json:"mtime"`
+	// ContentEncoding is `gzip` when the object was compressed at rest
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	// Source is the checksum of the object a sidecar was compressed from
+	Source string `json:"source,omitempty"`
+	// Symlink is the target of an uploaded symlink, see ResolveLink
+	Symlink string `json:"symlink,omitempty"`
+}
+
+// DetectContentType prefers the file extension and falls back to sniffing
+// the first 512 bytes of the file.
+func DetectContentType(fpath string, data []byte) string {
+	contentType := mime.TypeByExtension(filepath.Ext(fpath))
+	if contentType != "" {
+		return contentType
+	}
+
+	if len(data) > 512 {
+		data = data[:512]
+	}
+	return http.DetectContentType(data)
+}
+
+// GetContentType returns the content type recorded when the object was
+// uploaded, objects from before we recorded it fall back to the extension.
+func GetContentType(st StorageServe, bucket sst.Bucket, fpath string) string {
+	meta, _ := st.GetObjectMeta(bucket, fpath)
+	return ContentTypeOf(meta, fpath)
+}
+
+// ContentTypeOf is GetContentType for meta that was already fetched, meta
+// is nil when nothing was recorded.
+func ContentTypeOf(meta *ObjectMeta, fpath string) string {
+	if meta != nil && meta.ContentType != "" {
+		return meta.ContentType
+	}
+	return GetMimeType(fpath)
+}
+
+// objectMetaGetter is implemented by storages that read the meta of an
+// object anyway when they read the object.
+type objectMetaGetter interface {
+	GetObjectWithMeta(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, *ObjectMeta, error)
+}
+
+// GetObjectWithMeta reads an object and its meta, the meta is empty for
+// objects stored before it was recorded. Requests use it so the meta is
+// only fetched once.
+func GetObjectWithMeta(st StorageServe, bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, *ObjectMeta, error) {
+	if getter, ok := st.(objectMetaGetter); ok {
+		return getter.GetObjectWithMeta(bucket, fpath)
+	}
+	contents, size, modTime, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		return contents, size, modTime, nil, err
+	}
+	meta, err := st.GetObjectMeta(bucket, fpath)
+	if err != nil {
+		meta = &ObjectMeta{}
+	}
+	return contents, size, modTime, meta, nil
+}
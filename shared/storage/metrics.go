@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/picosh/pico/shared/metrics"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// MetricsStorage counts and times every call that reaches the backend, wrap
+// the backend itself with it so retries are counted one by one.
+type MetricsStorage struct {
+	StorageServe
+}
+
+func NewMetricsStorage(st StorageServe) *MetricsStorage {
+	return &MetricsStorage{StorageServe: st}
+}
+
+func (s *MetricsStorage) GetBucket(name string) (sst.Bucket, error) {
+	start := time.Now()
+	bucket, err := s.StorageServe.GetBucket(name)
+	metrics.ObserveStorage("get_bucket", start, err)
+	return bucket, err
+}
+
+func (s *MetricsStorage) UpsertBucket(name string) (sst.Bucket, error) {
+	start := time.Now()
+	bucket, err := s.StorageServe.UpsertBucket(name)
+	metrics.ObserveStorage("upsert_bucket", start, err)
+	return bucket, err
+}
+
+func (s *MetricsStorage) GetBucketStats(bucket sst.Bucket) (BucketStats, error) {
+	start := time.Now()
+	stats, err := s.StorageServe.GetBucketStats(bucket)
+	metrics.ObserveStorage("bucket_stats", start, err)
+	return stats, err
+}
+
+func (s *MetricsStorage) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	start := time.Now()
+	fileList, err := s.StorageServe.ListObjects(bucket, dir, recursive)
+	metrics.ObserveStorage("list", start, err)
+	return fileList, err
+}
+
+func (s *MetricsStorage) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	start := time.Now()
+	contents, size, modTime, err := s.StorageServe.GetObject(bucket, fpath)
+	metrics.ObserveStorage("get", start, err)
+	return contents, size, modTime, err
+}
+
+func (s *MetricsStorage) GetObjectSize(bucket sst.Bucket, fpath string) (int64, error) {
+	start := time.Now()
+	size, err := s.StorageServe.GetObjectSize(bucket, fpath)
+	metrics.ObserveStorage("stat", start, err)
+	return size, err
+}
+
+func (s *MetricsStorage) GetObjectMeta(bucket sst.Bucket, fpath string) (*ObjectMeta, error) {
+	start := time.Now()
+	meta, err := s.StorageServe.GetObjectMeta(bucket, fpath)
+	metrics.ObserveStorage("meta", start, err)
+	return meta, err
+}
+
+func (s *MetricsStorage) GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	contents, err := s.StorageServe.GetObjectRange(bucket, fpath, offset, length)
+	metrics.ObserveStorage("get_range", start, err)
+	return contents, err
+}
+
+func (s *MetricsStorage) ServeObject(bucket sst.Bucket, fpath string, opts *ImgProcessOpts) (io.ReadCloser, string, error) {
+	start := time.Now()
+	contents, contentType, err := s.StorageServe.ServeObject(bucket, fpath, opts)
+	metrics.ObserveStorage("serve", start, err)
+	return contents, contentType, err
+}
+
+func (s *MetricsStorage) PutObject(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry) (string, error) {
+	start := time.Now()
+	loc, err := s.StorageServe.PutObject(bucket, fpath, contents, entry)
+	metrics.ObserveStorage("put", start, err)
+	return loc, err
+}
+
+func (s *MetricsStorage) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	start := time.Now()
+	loc, err := s.StorageServe.PutObjectWithMeta(bucket, fpath, contents, entry, meta)
+	metrics.ObserveStorage("put", start, err)
+	return loc, err
+}
+
+func (s *MetricsStorage) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	start := time.Now()
+	loc, err := s.StorageServe.PutObjectCtx(ctx, bucket, fpath, contents, entry, meta)
+	metrics.ObserveStorage("put", start, err)
+	return loc, err
+}
+
+func (s *MetricsStorage) DeleteObject(bucket sst.Bucket, fpath string) error {
+	start := time.Now()
+	err := s.StorageServe.DeleteObject(bucket, fpath)
+	metrics.ObserveStorage("delete", start, err)
+	return err
+}
+
+func (s *MetricsStorage) BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error {
+	start := time.Now()
+	errs := s.StorageServe.BatchDelete(bucket, fpaths)
+	var err error
+	if len(errs) > 0 {
+		err = fmt.Errorf("could not delete %d objects", len(errs))
+	}
+	metrics.ObserveStorage("delete_batch", start, err)
+	return errs
+}
+
+func (s *MetricsStorage) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	start := time.Now()
+	infos, err := s.StorageServe.BatchStat(bucket, fpaths)
+	metrics.ObserveStorage("stat_batch", start, err)
+	return infos, err
+}
+
+func (s *MetricsStorage) MovePrefix(bucket sst.Bucket, from, to string) error {
+	start := time.Now()
+	err := s.StorageServe.MovePrefix(bucket, from, to)
+	metrics.ObserveStorage("move", start, err)
+	return err
+}
+
+func (s *MetricsStorage) PutObjectPart(bucket sst.Bucket, fpath, uploadID string, number int, contents io.Reader, size int64) (ObjectPart, error) {
+	start := time.Now()
+	part, err := s.StorageServe.PutObjectPart(bucket, fpath, uploadID, number, contents, size)
+	metrics.ObserveStorage("put_part", start, err)
+	return part, err
+}
+
+func (s *MetricsStorage) CompleteMultipartUpload(bucket sst.Bucket, fpath, uploadID string, parts []ObjectPart) (string, error) {
+	start := time.Now()
+	loc, err := s.StorageServe.CompleteMultipartUpload(bucket, fpath, uploadID, parts)
+	metrics.ObserveStorage("complete_upload", start, err)
+	return loc, err
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestMetricsStorage(t *testing.T) {
+	backend, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewMetricsStorage(backend)
+
+	bucket, err := st.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObject(
+		bucket,
+		"proj/index.html",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("hi"))),
+		&utils.FileEntry{Filepath: "proj/index.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/missing.html"); err == nil {
+		t.Fatal("expected missing object to fail")
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, line := range []string{
+		`pico_storage_requests_total{op="put",status="ok"} 1`,
+		`pico_storage_requests_total{op="stat",status="error"} 1`,
+		`pico_storage_duration_seconds_count{op="upsert_bucket"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Fatalf("expected (%s) in metrics:\n%s", line, body)
+		}
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/minio/minio-go/v7"
 	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
 )
 
 type StorageMinio struct {
@@ -25,7 +27,7 @@ func NewStorageMinio(address, user, pass string) (*StorageMinio, error) {
 
 func (s *StorageMinio) ServeObject(bucket sst.Bucket, fpath string, opts *ImgProcessOpts) (io.ReadCloser, string, error) {
 	if opts == nil || os.Getenv("IMGPROXY_URL") == "" {
-		contentType := GetMimeType(fpath)
+		contentType := GetContentType(s, bucket, fpath)
 		rc, _, _, err := s.GetObject(bucket, fpath)
 		return rc, contentType, err
 	}
@@ -42,3 +44,71 @@ func (s *StorageMinio) GetObjectSize(bucket sst.Bucket, fpath string) (int64, er
 	}
 	return info.Size, nil
 }
+
+func (s *StorageMinio) GetObjectMeta(bucket sst.Bucket, fpath string) (*ObjectMeta, error) {
+	info, err := s.Client.StatObject(context.Background(), bucket.Name, fpath, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ObjectMeta{
+		ContentType:     info.ContentType,
+		Checksum:        info.UserMetadata["Checksum"],
+		ContentEncoding: info.Metadata.Get("Content-Encoding"),
+		Source:          info.UserMetadata["Source"],
+		Symlink:         info.UserMetadata["Symlink"],
+	}
+	if mtime, err := strconv.ParseInt(info.UserMetadata["Mtime"], 10, 64); err == nil {
+		meta.Mtime = mtime
+	}
+	return meta, nil
+}
+
+func (s *StorageMinio) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	return s.PutObjectCtx(context.TODO(), bucket, fpath, contents, entry, meta)
+}
+
+// PutObjectCtx aborts the upload when ctx is done, minio only replaces the
+// object once the upload completes so there is nothing to clean up.
+func (s *StorageMinio) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	opts := minio.PutObjectOptions{
+		UserMetadata: map[string]string{},
+	}
+	if meta != nil {
+		opts.ContentType = meta.ContentType
+		opts.ContentEncoding = meta.ContentEncoding
+		if meta.Checksum != "" {
+			opts.UserMetadata["Checksum"] = meta.Checksum
+		}
+		if meta.Source != "" {
+			opts.UserMetadata["Source"] = meta.Source
+		}
+		if meta.Symlink != "" {
+			opts.UserMetadata["Symlink"] = meta.Symlink
+		}
+	}
+
+	mtime := entry.Mtime
+	if meta != nil && meta.Mtime > 0 {
+		mtime = meta.Mtime
+	}
+	if mtime > 0 {
+		opts.UserMetadata["Mtime"] = strconv.FormatInt(mtime, 10)
+	}
+
+	info, err := s.Client.PutObject(ctx, bucket.Name, fpath, contents, -1, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", info.Bucket, info.Key), nil
+}
+
+func (s *StorageMinio) GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	err := opts.SetRange(offset, offset+length-1)
+	if err != nil {
+		return nil, err
+	}
+	return s.Client.GetObject(context.Background(), bucket.Name, fpath, opts)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	sst "github.com/picosh/pobj/storage"
+)
+
+func movePath(from, to, fpath string) string {
+	rel := strings.TrimPrefix(strings.Trim(fpath, "/"), strings.Trim(from, "/"))
+	return filepath.Join(strings.Trim(to, "/"), strings.TrimPrefix(rel, "/"))
+}
+
+// MovePrefix renames every object below from to the same path below to,
+// replacing anything already there. Each object is renamed in place so
+// moving a prefix is quick, but not atomic as a whole.
+func (s *StorageFS) MovePrefix(bucket sst.Bucket, from, to string) error {
+	entries, err := WalkObjects(s, bucket, from)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		dst := movePath(from, to, entry.Path)
+		loc := filepath.Join(bucket.Path, dst)
+		err := os.MkdirAll(filepath.Dir(loc), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(filepath.Join(bucket.Path, entry.Path), loc)
+		if err != nil {
+			return err
+		}
+
+		metaLoc := s.metaPath(bucket, dst)
+		_ = os.Remove(metaLoc)
+		if _, err := os.Stat(s.metaPath(bucket, entry.Path)); err == nil {
+			_ = os.MkdirAll(filepath.Dir(metaLoc), os.ModePerm)
+			_ = os.Rename(s.metaPath(bucket, entry.Path), metaLoc)
+		}
+	}
+
+	_ = os.RemoveAll(filepath.Join(bucket.Path, from))
+	return nil
+}
+
+// MovePrefix copies every object below from to the same path below to on
+// the server and then removes the originals, s3 has no rename.
+func (s *StorageMinio) MovePrefix(bucket sst.Bucket, from, to string) error {
+	entries, err := WalkObjects(s, bucket, from)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		_, err := s.Client.CopyObject(
+			context.Background(),
+			minio.CopyDestOptions{Bucket: bucket.Name, Object: movePath(from, to, entry.Path)},
+			minio.CopySrcOptions{Bucket: bucket.Name, Object: entry.Path},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		err := s.DeleteObject(bucket, entry.Path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
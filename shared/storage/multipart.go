@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	sst "github.com/picosh/pobj/storage"
+)
+
+// ObjectPart is one stored piece of a multipart upload.
+type ObjectPart struct {
+	Number int
+	Size   int64
+	ETag   string
+}
+
+// UploadsDir is where multipart uploads are put together inside a bucket
+// before they are written like any other upload, the filesystem backend
+// also keeps their parts under it.
+var UploadsDir = ".uploads"
+
+// StagingDir is where uploads of an atomic deploy wait inside a bucket to
+// be promoted to their project.
+var StagingDir = ".staging"
+
+// UploadTTL is how long an unfinished multipart upload can be resumed,
+// older ones are aborted.
+var UploadTTL = 24 * time.Hour
+
+// MultipartUpload is an object that is still being uploaded, its parts
+// are stored as they arrive and the object only exists once the upload
+// is completed.
+type MultipartUpload struct {
+	ID        string
+	Initiated time.Time
+	Parts     []ObjectPart
+}
+
+// Stale is true when the upload was started longer than UploadTTL ago.
+func (u *MultipartUpload) Stale(now time.Time) bool {
+	return u.Initiated.Before(now.Add(-UploadTTL))
+}
+
+// Size is how many bytes of the object were stored so far.
+func (u *MultipartUpload) Size() int64 {
+	size := int64(0)
+	for _, part := range u.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+// NextPart is the number the next part has to be stored under.
+func (u *MultipartUpload) NextPart() int {
+	return len(u.Parts) + 1
+}
+
+// uploadDir keeps the parts of every upload to fpath, outside of the
+// bucket so listings never see them.
+func (s *StorageFS) uploadDir(bucket sst.Bucket, fpath string) string {
+	sum := sha256.Sum256([]byte(fpath))
+	return filepath.Join(s.Dir, UploadsDir, bucket.Name, hex.EncodeToString(sum[:]))
+}
+
+func partName(number int) string {
+	return fmt.Sprintf("%05d", number)
+}
+
+// CreateMultipartUpload uses timestamps as ids so the newest upload of a
+// path sorts last.
+func (s *StorageFS) CreateMultipartUpload(bucket sst.Bucket, fpath string) (string, error) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	err := os.MkdirAll(filepath.Join(s.uploadDir(bucket, fpath), id), os.ModePerm)
+	return id, err
+}
+
+// uploadTime is when an upload of the filesystem backend was started, its
+// id is the time in nanoseconds.
+func uploadTime(id string) time.Time {
+	nanos, _ := strconv.ParseInt(id, 10, 64)
+	return time.Unix(0, nanos)
+}
+
+func (s *StorageFS) FindMultipartUpload(bucket sst.Bucket, fpath string) (*MultipartUpload, error) {
+	entries, err := os.ReadDir(s.uploadDir(bucket, fpath))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	upload := &MultipartUpload{ID: entries[len(entries)-1].Name()}
+	upload.Initiated = uploadTime(upload.ID)
+	parts, err := os.ReadDir(filepath.Join(s.uploadDir(bucket, fpath), upload.ID))
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		number, err := strconv.Atoi(part.Name())
+		if err != nil {
+			continue
+		}
+		info, err := part.Info()
+		if err != nil {
+			return nil, err
+		}
+		upload.Parts = append(upload.Parts, ObjectPart{Number: number, Size: info.Size()})
+	}
+	sort.Slice(upload.Parts, func(i, j int) bool {
+		return upload.Parts[i].Number < upload.Parts[j].Number
+	})
+	return upload, nil
+}
+
+// PutObjectPart writes the part next to its final name and renames it so
+// a part that was cut short is never listed.
+func (s *StorageFS) PutObjectPart(bucket sst.Bucket, fpath, uploadID string, number int, contents io.Reader, size int64) (ObjectPart, error) {
+	dir := filepath.Join(s.uploadDir(bucket, fpath), uploadID)
+	f, err := os.CreateTemp(dir, ".part-*")
+	if err != nil {
+		return ObjectPart{}, err
+	}
+	defer os.Remove(f.Name())
+
+	n, err := io.Copy(f, io.LimitReader(contents, size))
+	_ = f.Close()
+	if err != nil {
+		return ObjectPart{}, err
+	}
+	if n != size {
+		return ObjectPart{}, io.ErrUnexpectedEOF
+	}
+
+	err = os.Rename(f.Name(), filepath.Join(dir, partName(number)))
+	if err != nil {
+		return ObjectPart{}, err
+	}
+	return ObjectPart{Number: number, Size: size}, nil
+}
+
+// CompleteMultipartUpload joins the parts in place and moves the result
+// into the bucket, so fpath never holds a partial object.
+func (s *StorageFS) CompleteMultipartUpload(bucket sst.Bucket, fpath, uploadID string, parts []ObjectPart) (string, error) {
+	dir := filepath.Join(s.uploadDir(bucket, fpath), uploadID)
+	f, err := os.CreateTemp(dir, ".object-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	for _, part := range parts {
+		err := appendFile(f, filepath.Join(dir, partName(part.Number)))
+		if err != nil {
+			_ = f.Close()
+			return "", err
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	loc := filepath.Join(bucket.Path, fpath)
+	err = os.MkdirAll(filepath.Dir(loc), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(f.Name(), loc)
+	if err != nil {
+		return "", err
+	}
+	_ = s.AbortMultipartUpload(bucket, fpath, uploadID)
+	return loc, nil
+}
+
+func appendFile(dst io.Writer, fname string) error {
+	src, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (s *StorageFS) AbortMultipartUpload(bucket sst.Bucket, fpath, uploadID string) error {
+	dir := s.uploadDir(bucket, fpath)
+	err := os.RemoveAll(filepath.Join(dir, uploadID))
+	if err != nil {
+		return err
+	}
+	// only succeeds once no other upload of fpath is left
+	_ = os.Remove(dir)
+	return nil
+}
+
+// AbortStaleMultipartUploads walks the uploads of every path in bucket,
+// they are kept by the hash of their path.
+func (s *StorageFS) AbortStaleMultipartUploads(bucket sst.Bucket, before time.Time) (int, error) {
+	root := filepath.Join(s.Dir, UploadsDir, bucket.Name)
+	dirs, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, dir := range dirs {
+		ids, err := os.ReadDir(filepath.Join(root, dir.Name()))
+		if err != nil {
+			return count, err
+		}
+		for _, id := range ids {
+			if !uploadTime(id.Name()).Before(before) {
+				continue
+			}
+			err := os.RemoveAll(filepath.Join(root, dir.Name(), id.Name()))
+			if err != nil {
+				return count, err
+			}
+			count += 1
+		}
+		_ = os.Remove(filepath.Join(root, dir.Name()))
+	}
+	return count, nil
+}
+
+func (s *StorageMinio) core() *minio.Core {
+	return &minio.Core{Client: s.Client}
+}
+
+func (s *StorageMinio) CreateMultipartUpload(bucket sst.Bucket, fpath string) (string, error) {
+	return s.core().NewMultipartUpload(context.Background(), bucket.Name, fpath, minio.PutObjectOptions{})
+}
+
+func (s *StorageMinio) FindMultipartUpload(bucket sst.Bucket, fpath string) (*MultipartUpload, error) {
+	ctx := context.Background()
+	result, err := s.core().ListMultipartUploads(ctx, bucket.Name, fpath, "", "", "", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *minio.ObjectMultipartInfo
+	for i, info := range result.Uploads {
+		if info.Key != fpath {
+			continue
+		}
+		if latest == nil || info.Initiated.After(latest.Initiated) {
+			latest = &result.Uploads[i]
+		}
+	}
+	if latest == nil {
+		return nil, os.ErrNotExist
+	}
+
+	upload := &MultipartUpload{ID: latest.UploadID, Initiated: latest.Initiated}
+	marker := 0
+	for {
+		parts, err := s.core().ListObjectParts(ctx, bucket.Name, fpath, upload.ID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts.ObjectParts {
+			upload.Parts = append(upload.Parts, ObjectPart{
+				Number: part.PartNumber,
+				Size:   part.Size,
+				ETag:   part.ETag,
+			})
+		}
+		if !parts.IsTruncated {
+			break
+		}
+		marker = parts.NextPartNumberMarker
+	}
+	return upload, nil
+}
+
+func (s *StorageMinio) PutObjectPart(bucket sst.Bucket, fpath, uploadID string, number int, contents io.Reader, size int64) (ObjectPart, error) {
+	part, err := s.core().PutObjectPart(context.Background(), bucket.Name, fpath, uploadID, number, contents, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return ObjectPart{}, err
+	}
+	return ObjectPart{Number: part.PartNumber, Size: part.Size, ETag: part.ETag}, nil
+}
+
+func (s *StorageMinio) CompleteMultipartUpload(bucket sst.Bucket, fpath, uploadID string, parts []ObjectPart) (string, error) {
+	complete := []minio.CompletePart{}
+	for _, part := range parts {
+		complete = append(complete, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	info, err := s.core().CompleteMultipartUpload(context.Background(), bucket.Name, fpath, uploadID, complete, minio.PutObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s", info.Bucket, info.Key), nil
+}
+
+func (s *StorageMinio) AbortMultipartUpload(bucket sst.Bucket, fpath, uploadID string) error {
+	return s.core().AbortMultipartUpload(context.Background(), bucket.Name, fpath, uploadID)
+}
+
+func (s *StorageMinio) AbortStaleMultipartUploads(bucket sst.Bucket, before time.Time) (int, error) {
+	ctx := context.Background()
+	count := 0
+	keyMarker, idMarker := "", ""
+	for {
+		result, err := s.core().ListMultipartUploads(ctx, bucket.Name, "", keyMarker, idMarker, "", 1000)
+		if err != nil {
+			return count, err
+		}
+		for _, info := range result.Uploads {
+			if !info.Initiated.Before(before) {
+				continue
+			}
+			err := s.core().AbortMultipartUpload(ctx, bucket.Name, info.Key, info.UploadID)
+			if err != nil {
+				return count, err
+			}
+			count += 1
+		}
+		if !result.IsTruncated {
+			return count, nil
+		}
+		keyMarker, idMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
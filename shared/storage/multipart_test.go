@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStorageFSMultipart(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := st.CreateMultipartUpload(bucket, "proj/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObjectPart(bucket, "proj/big.bin", id, 1, strings.NewReader("hello "), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a part cut short is never kept
+	_, err = st.PutObjectPart(bucket, "proj/big.bin", id, 2, strings.NewReader("wor"), 5)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected short part to fail, got %v", err)
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/big.bin"); err == nil {
+		t.Fatal("expected nothing to be stored before the upload completes")
+	}
+
+	upload, err := st.FindMultipartUpload(bucket, "proj/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.ID != id || upload.Size() != 6 || upload.NextPart() != 2 {
+		t.Fatalf("expected one stored part, got %+v", upload)
+	}
+
+	part, err := st.PutObjectPart(bucket, "proj/big.bin", id, 2, strings.NewReader("world"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.CompleteMultipartUpload(bucket, "proj/big.bin", id, append(upload.Parts, part))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _, _, err := st.GetObject(bucket, "proj/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	text, _ := io.ReadAll(contents)
+	if string(text) != "hello world" {
+		t.Fatalf("expected parts in order, got %q", text)
+	}
+	if _, err := st.FindMultipartUpload(bucket, "proj/big.bin"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected completed upload to be gone, got %v", err)
+	}
+}
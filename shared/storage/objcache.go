@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/picosh/pico/shared/metrics"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type cachedObject struct {
+	key  string
+	data []byte
+}
+
+// ObjectCache keeps popular objects in memory for the web server so they
+// are not fetched from the backend on every request. Objects are cached by
+// their checksum, a file that is written again gets a new one so nothing
+// stale is ever served, and the least recently read are evicted once
+// maxSize bytes are cached. Objects larger than maxObject, or stored before
+// their checksum and mtime were recorded, always go to the backend.
+type ObjectCache struct {
+	StorageServe
+	maxSize   int64
+	maxObject int64
+
+	mu      sync.Mutex
+	size    int64
+	recent  *list.List
+	objects map[string]*list.Element
+}
+
+func NewObjectCache(st StorageServe, maxSize, maxObject int64) *ObjectCache {
+	return &ObjectCache{
+		StorageServe: st,
+		maxSize:      maxSize,
+		maxObject:    min(maxObject, maxSize),
+		recent:       list.New(),
+		objects:      map[string]*list.Element{},
+	}
+}
+
+// cacheKey is the checksum of what was uploaded, an object compressed at
+// rest holds different bytes for the same checksum.
+func cacheKey(meta *ObjectMeta) string {
+	return meta.Checksum + ":" + meta.ContentEncoding
+}
+
+func (c *ObjectCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.objects[key]
+	if !ok {
+		return nil, false
+	}
+	c.recent.MoveToFront(el)
+	return el.Value.(*cachedObject).data, true
+}
+
+func (c *ObjectCache) set(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.objects[key]; ok {
+		return
+	}
+	c.objects[key] = c.recent.PushFront(&cachedObject{key: key, data: data})
+	c.size += int64(len(data))
+
+	evicted := 0
+	for c.size > c.maxSize {
+		el := c.recent.Back()
+		obj := el.Value.(*cachedObject)
+		c.recent.Remove(el)
+		delete(c.objects, obj.key)
+		c.size -= int64(len(obj.data))
+		evicted += 1
+	}
+	metrics.ObserveObjectCacheSize(c.size, evicted)
+}
+
+// Size is how many bytes are cached.
+func (c *ObjectCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// GetObject looks the checksum of the object up first, which is cheaper
+// than reading it. Its modification time is the one the client uploaded
+// it with, whether it was cached or not.
+func (c *ObjectCache) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	contents, size, modTime, _, err := c.GetObjectWithMeta(bucket, fpath)
+	return contents, size, modTime, err
+}
+
+// GetObjectWithMeta is GetObject that also returns the meta it looked up.
+func (c *ObjectCache) GetObjectWithMeta(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, *ObjectMeta, error) {
+	meta, err := c.StorageServe.GetObjectMeta(bucket, fpath)
+	if err != nil {
+		meta = &ObjectMeta{}
+	}
+	if meta.Checksum == "" || meta.Mtime <= 0 || meta.Symlink != "" {
+		metrics.ObserveObjectCache("skip")
+		contents, size, modTime, err := c.StorageServe.GetObject(bucket, fpath)
+		return contents, size, modTime, meta, err
+	}
+	modTime := time.Unix(meta.Mtime, 0)
+
+	if data, ok := c.get(cacheKey(meta)); ok {
+		metrics.ObserveObjectCache("hit")
+		return utils.NopReaderAtCloser(bytes.NewReader(data)), int64(len(data)), modTime, meta, nil
+	}
+
+	contents, size, storedModTime, err := c.StorageServe.GetObject(bucket, fpath)
+	if err != nil || size > c.maxObject {
+		metrics.ObserveObjectCache("skip")
+		return contents, size, storedModTime, meta, err
+	}
+	metrics.ObserveObjectCache("miss")
+	defer contents.Close()
+	data, err := io.ReadAll(io.NewSectionReader(contents, 0, size))
+	if err != nil {
+		return nil, 0, modTime, meta, err
+	}
+	c.set(cacheKey(meta), data)
+	return utils.NopReaderAtCloser(bytes.NewReader(data)), int64(len(data)), modTime, meta, nil
+}
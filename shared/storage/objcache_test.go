@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// readCounter counts the objects read from the backend.
+type readCounter struct {
+	StorageServe
+	reads int
+}
+
+func (s *readCounter) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	s.reads += 1
+	return s.StorageServe.GetObject(bucket, fpath)
+}
+
+func cachePut(t *testing.T, st StorageServe, bucket sst.Bucket, fpath, text string, meta *ObjectMeta) {
+	t.Helper()
+	_, err := st.PutObjectWithMeta(
+		bucket,
+		fpath,
+		utils.NopReaderAtCloser(strings.NewReader(text)),
+		&utils.FileEntry{Filepath: fpath, Size: int64(len(text)), Mtime: 1709288400},
+		meta,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checksumMeta(text string) *ObjectMeta {
+	sum := sha256.Sum256([]byte(text))
+	return &ObjectMeta{ContentType: "text/html", Checksum: hex.EncodeToString(sum[:]), Mtime: 1709288400}
+}
+
+func cacheRead(t *testing.T, st StorageServe, bucket sst.Bucket, fpath string) string {
+	t.Helper()
+	contents, size, modTime, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	text, err := io.ReadAll(io.NewSectionReader(contents, 0, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modTime.Unix() != 1709288400 {
+		t.Fatalf("%s: unexpected mtime (%d)", fpath, modTime.Unix())
+	}
+	return string(text)
+}
+
+func TestObjectCache(t *testing.T) {
+	fs, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := fs.UpsertBucket("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &readCounter{StorageServe: fs}
+	st := NewObjectCache(backend, 20, 12)
+
+	cachePut(t, st, bucket, "proj/index.html", "<h1>hi</h1>", checksumMeta("<h1>hi</h1>"))
+	for i := 0; i < 3; i++ {
+		if text := cacheRead(t, st, bucket, "proj/index.html"); text != "<h1>hi</h1>" {
+			t.Fatalf("unexpected contents (%s)", text)
+		}
+	}
+	if backend.reads != 1 {
+		t.Fatalf("expected (1) backend read, got (%d)", backend.reads)
+	}
+
+	// the same contents elsewhere are already cached
+	cachePut(t, st, bucket, "proj/copy.html", "<h1>hi</h1>", checksumMeta("<h1>hi</h1>"))
+	_ = cacheRead(t, st, bucket, "proj/copy.html")
+	if backend.reads != 1 {
+		t.Fatalf("expected (1) backend read, got (%d)", backend.reads)
+	}
+
+	// a rewritten file gets a new checksum and is never served stale
+	cachePut(t, st, bucket, "proj/index.html", "<h1>bye</h1>", checksumMeta("<h1>bye</h1>"))
+	if text := cacheRead(t, st, bucket, "proj/index.html"); text != "<h1>bye</h1>" {
+		t.Fatalf("expected the rewritten contents, got (%s)", text)
+	}
+	if backend.reads != 2 {
+		t.Fatalf("expected (2) backend reads, got (%d)", backend.reads)
+	}
+
+	// both objects are 11 and 12 bytes, the least recently read is evicted
+	if st.Size() != 12 {
+		t.Fatalf("expected (12) cached bytes, got (%d)", st.Size())
+	}
+	_ = cacheRead(t, st, bucket, "proj/copy.html")
+	if backend.reads != 3 || st.Size() != 11 {
+		t.Fatalf("expected an eviction, got (%d) reads and (%d) cached bytes", backend.reads, st.Size())
+	}
+
+	// objects too large or without a checksum always go to the backend
+	cachePut(t, st, bucket, "proj/large.html", "<h1>large</h1>", checksumMeta("<h1>large</h1>"))
+	cachePut(t, st, bucket, "proj/legacy.html", "<p>old</p>", &ObjectMeta{ContentType: "text/html"})
+	for i := 0; i < 2; i++ {
+		_ = cacheRead(t, st, bucket, "proj/large.html")
+		_ = cacheRead(t, st, bucket, "proj/legacy.html")
+	}
+	if backend.reads != 7 {
+		t.Fatalf("expected (7) backend reads, got (%d)", backend.reads)
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+const exifOrientationTag = 0x0112
+
+// ExifOrientation returns the exif orientation of a jpeg or png, 1 when it
+// has none.
+func ExifOrientation(contents []byte) int {
+	var tiff []byte
+	if bytes.HasPrefix(contents, []byte("\xff\xd8")) {
+		tiff = jpegExif(contents)
+	} else if bytes.HasPrefix(contents, []byte("\x89PNG\r\n\x1a\n")) {
+		tiff = pngExif(contents)
+	}
+	orientation := tiffOrientation(tiff)
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// jpegExif finds the tiff data of the exif segment, it stops at the start
+// of the image data since metadata always comes before it.
+func jpegExif(contents []byte) []byte {
+	pos := 2
+	for pos+4 <= len(contents) {
+		if contents[pos] != 0xff {
+			return nil
+		}
+		marker := contents[pos+1]
+		if marker == 0xff {
+			// fill byte
+			pos += 1
+			continue
+		}
+		if marker == 0xd9 || marker == 0xda {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(contents[pos+2:]))
+		end := pos + 2 + size
+		if size < 2 || end > len(contents) {
+			return nil
+		}
+		segment := contents[pos+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos = end
+	}
+	return nil
+}
+
+func pngExif(contents []byte) []byte {
+	pos := 8
+	for pos+8 <= len(contents) {
+		size := int(binary.BigEndian.Uint32(contents[pos:]))
+		end := pos + 8 + size + 4
+		if size < 0 || end > len(contents) {
+			return nil
+		}
+		if string(contents[pos+4:pos+8]) == "eXIf" {
+			return contents[pos+8 : pos+8+size]
+		}
+		pos = end
+	}
+	return nil
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// NormalizeOrientation turns the pixels of a jpeg or png the way its exif
+// orientation says it is meant to be shown. The result is re-encoded so it
+// carries no metadata at all, false means the image was already upright.
+func NormalizeOrientation(contents []byte) ([]byte, bool, error) {
+	orientation := ExifOrientation(contents)
+	if orientation == 1 {
+		return contents, false, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, false, err
+	}
+	if cfg.Width*cfg.Height > maxResizePixels {
+		return nil, false, fmt.Errorf("image (%dx%d) is too large to process", cfg.Width, cfg.Height)
+	}
+	src, format, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, false, err
+	}
+	img := toRGBA(src)
+	// https://exiftool.org/TagNames/EXIF.html orientation values
+	switch orientation {
+	case 2:
+		img = flipImg(img)
+	case 3:
+		img = rotateImg(img, 180)
+	case 4:
+		img = flipImg(rotateImg(img, 180))
+	case 5:
+		img = rotateImg(flipImg(img), 270)
+	case 6:
+		img = rotateImg(img, 90)
+	case 7:
+		img = rotateImg(flipImg(img), 90)
+	case 8:
+		img = rotateImg(img, 270)
+	}
+
+	buf := &bytes.Buffer{}
+	if format == "png" {
+		err = png.Encode(buf, img)
+	} else {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// flipImg mirrors the image horizontally.
+func flipImg(src *image.RGBA) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copy(dst.Pix[dst.PixOffset(w-1-x, y):dst.PixOffset(w-1-x, y)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// withOrientation puts an exif segment with only an orientation tag right
+// after the start of a jpeg.
+func withOrientation(contents []byte, orientation uint16, order binary.ByteOrder) []byte {
+	tiff := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	_ = binary.Write(tiff, order, uint16(42))
+	_ = binary.Write(tiff, order, uint32(8))
+	_ = binary.Write(tiff, order, uint16(1))
+	_ = binary.Write(tiff, order, uint16(exifOrientationTag))
+	_ = binary.Write(tiff, order, uint16(3))
+	_ = binary.Write(tiff, order, uint32(1))
+	_ = binary.Write(tiff, order, orientation)
+	_ = binary.Write(tiff, order, uint16(0))
+	_ = binary.Write(tiff, order, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	out := []byte{0xff, 0xd8, 0xff, 0xe1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, contents[2:]...)
+}
+
+func TestNormalizeOrientation(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := []struct {
+		name    string
+		input   []byte
+		rotated bool
+		width   int
+		height  int
+	}{
+		{name: "none", input: buf.Bytes(), width: 40, height: 20},
+		{name: "upright", input: withOrientation(buf.Bytes(), 1, binary.BigEndian), width: 40, height: 20},
+		{name: "rotate_90", input: withOrientation(buf.Bytes(), 6, binary.LittleEndian), rotated: true, width: 20, height: 40},
+		{name: "rotate_180", input: withOrientation(buf.Bytes(), 3, binary.BigEndian), rotated: true, width: 40, height: 20},
+		{name: "transpose", input: withOrientation(buf.Bytes(), 5, binary.BigEndian), rotated: true, width: 20, height: 40},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			out, rotated, err := NormalizeOrientation(fixture.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated != fixture.rotated {
+				t.Fatalf("expected rotated (%t), got (%t)", fixture.rotated, rotated)
+			}
+			if ExifOrientation(out) != 1 || (rotated && jpegExif(out) != nil) {
+				t.Fatal("expected the exif data to be gone")
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != fixture.width || cfg.Height != fixture.height {
+				t.Fatalf("expected (%dx%d), got (%dx%d)", fixture.width, fixture.height, cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+var ErrPresignUnsupported = errors.New("storage backend cannot sign urls")
+
+func (s *StorageFS) PresignGetURL(bucket sst.Bucket, fname string, ttl time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+func (s *StorageMinio) PresignGetURL(bucket sst.Bucket, fname string, ttl time.Duration) (string, error) {
+	u, err := s.Client.PresignedGetObject(context.Background(), bucket.Name, fname, ttl, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
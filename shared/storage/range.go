@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"io"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+// RangeReader satisfies ReadAt calls by fetching only the requested byte
+// range from storage instead of holding the whole object.
+type RangeReader struct {
+	st     StorageServe
+	bucket sst.Bucket
+	fpath  string
+	size   int64
+	offset int64
+}
+
+func NewRangeReader(st StorageServe, bucket sst.Bucket, fpath string, size int64) *RangeReader {
+	return &RangeReader{
+		st:     st,
+		bucket: bucket,
+		fpath:  fpath,
+		size:   size,
+	}
+}
+
+func (r *RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	length := int64(len(p))
+	if off+length > r.size {
+		length = r.size - off
+	}
+
+	rc, err := r.st.GetObjectRange(r.bucket, r.fpath, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.ReadFull(rc, p[:length])
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if err == nil && int64(n) < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		return n, nil
+	}
+	return n, err
+}
+
+func (r *RangeReader) Close() error {
+	return nil
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// ErrImgUnsupported is returned for what only imgproxy can do, like
+// encoding webp or keeping the frames of an animated gif.
+var ErrImgUnsupported = errors.New("image processing needs imgproxy")
+
+// refuse to decode anything that would take more memory than this many
+// pixels, an image header is cheap to lie in
+const maxResizePixels = 50_000_000
+
+// ResizeImg applies opts to an image without imgproxy. It reads jpeg, png
+// and gif and returns the encoded result with its content type.
+func ResizeImg(contents []byte, opts *ImgProcessOpts) ([]byte, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width*cfg.Height > maxResizePixels {
+		return nil, "", fmt.Errorf("image (%dx%d) is too large to process", cfg.Width, cfg.Height)
+	}
+
+	ext := strings.ToLower(opts.Ext)
+	if ext == "" {
+		ext = format
+	}
+	if ext == "jpg" {
+		ext = "jpeg"
+	}
+	if ext != "jpeg" && ext != "png" && ext != "gif" {
+		return nil, "", ErrImgUnsupported
+	}
+
+	if format == "gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(contents))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(anim.Image) > 1 {
+			return nil, "", ErrImgUnsupported
+		}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, "", err
+	}
+
+	img := toRGBA(src)
+	if opts.Ratio != nil {
+		img = fitImg(img, opts.Ratio.Width, opts.Ratio.Height)
+	}
+	img = rotateImg(img, opts.Rotate)
+
+	buf := &bytes.Buffer{}
+	switch ext {
+	case "jpeg":
+		quality := opts.Quality
+		if quality <= 0 || quality > 100 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(buf, img)
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/" + ext, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// fitImg scales the image down to fit inside width and height keeping its
+// aspect ratio, a zero side is not constrained. Like imgproxy it never
+// enlarges.
+func fitImg(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	scale := 1.0
+	if width > 0 {
+		scale = min(scale, float64(width)/float64(sw))
+	}
+	if height > 0 {
+		scale = min(scale, float64(height)/float64(sh))
+	}
+	if scale >= 1 {
+		return src
+	}
+
+	dw := max(1, int(math.Round(float64(sw)*scale)))
+	dh := max(1, int(math.Round(float64(sh)*scale)))
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	// every destination pixel is the average of the box it covers
+	for y := 0; y < dh; y++ {
+		y0 := y * sh / dh
+		y1 := max(y0+1, (y+1)*sh/dh)
+		for x := 0; x < dw; x++ {
+			x0 := x * sw / dw
+			x1 := max(x0+1, (x+1)*sw/dw)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[off+c])
+					}
+					off += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// rotateImg turns the image clockwise, only multiples of 90 degrees are
+// supported and anything else is left as is.
+func rotateImg(src *image.RGBA, angle int) *image.RGBA {
+	angle = ((angle % 360) + 360) % 360
+	if angle == 0 || angle%90 != 0 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	rect := image.Rect(0, 0, h, w)
+	if angle == 180 {
+		rect = image.Rect(0, 0, w, h)
+	}
+	dst := image.NewRGBA(rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch angle {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
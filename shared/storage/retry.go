@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// IsRetryable reports whether a storage error is likely transient. Anything
+// we do not recognize is treated as permanent so we never hammer the
+// backend with requests that cannot succeed.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, fs.ErrPermission) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	resp := minio.ToErrorResponse(err)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	switch resp.Code {
+	case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return true
+	}
+
+	return false
+}
+
+// RetryStorage retries reads, writes and listings that fail with a
+// transient error using exponential backoff.
+type RetryStorage struct {
+	StorageServe
+	maxRetries int
+	baseDelay  time.Duration
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+func NewRetryStorage(st StorageServe, maxRetries int, baseDelay time.Duration) *RetryStorage {
+	return &RetryStorage{
+		StorageServe: st,
+		maxRetries:   maxRetries,
+		baseDelay:    baseDelay,
+		sleep:        sleepCtx,
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *RetryStorage) retry(ctx context.Context, op func() error) error {
+	err := op()
+	for attempt := 0; attempt < s.maxRetries && IsRetryable(err); attempt += 1 {
+		sleepErr := s.sleep(ctx, s.baseDelay*time.Duration(1<<attempt))
+		if sleepErr != nil {
+			return err
+		}
+		err = op()
+	}
+	return err
+}
+
+// rewind returns a fresh reader over contents for every attempt, we can
+// only do that when we know how many bytes to read.
+func rewind(contents utils.ReaderAtCloser, entry *utils.FileEntry) (func() utils.ReaderAtCloser, bool) {
+	if entry == nil || entry.Size <= 0 {
+		return func() utils.ReaderAtCloser { return contents }, false
+	}
+	return func() utils.ReaderAtCloser {
+		return utils.NopReaderAtCloser(io.NewSectionReader(contents, 0, entry.Size))
+	}, true
+}
+
+func (s *RetryStorage) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	var contents utils.ReaderAtCloser
+	var size int64
+	var modTime time.Time
+	err := s.retry(context.Background(), func() error {
+		var err error
+		contents, size, modTime, err = s.StorageServe.GetObject(bucket, fpath)
+		return err
+	})
+	return contents, size, modTime, err
+}
+
+func (s *RetryStorage) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	var fileList []os.FileInfo
+	err := s.retry(context.Background(), func() error {
+		var err error
+		fileList, err = s.StorageServe.ListObjects(bucket, dir, recursive)
+		return err
+	})
+	return fileList, err
+}
+
+func (s *RetryStorage) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	var infos map[string]os.FileInfo
+	err := s.retry(context.Background(), func() error {
+		var err error
+		infos, err = s.StorageServe.BatchStat(bucket, fpaths)
+		return err
+	})
+	return infos, err
+}
+
+func (s *RetryStorage) PutObject(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry) (string, error) {
+	reader, ok := rewind(contents, entry)
+	if !ok {
+		return s.StorageServe.PutObject(bucket, fpath, contents, entry)
+	}
+
+	var loc string
+	err := s.retry(context.Background(), func() error {
+		var err error
+		loc, err = s.StorageServe.PutObject(bucket, fpath, reader(), entry)
+		return err
+	})
+	return loc, err
+}
+
+func (s *RetryStorage) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	return s.PutObjectCtx(context.Background(), bucket, fpath, contents, entry, meta)
+}
+
+func (s *RetryStorage) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	reader, ok := rewind(contents, entry)
+	if !ok {
+		return s.StorageServe.PutObjectCtx(ctx, bucket, fpath, contents, entry, meta)
+	}
+
+	var loc string
+	err := s.retry(ctx, func() error {
+		var err error
+		loc, err = s.StorageServe.PutObjectCtx(ctx, bucket, fpath, reader(), entry, meta)
+		return err
+	})
+	return loc, err
+}
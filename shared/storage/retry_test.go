@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type flakyStorage struct {
+	StorageServe
+	failures int
+	err      error
+	calls    int
+	body     []byte
+}
+
+func (s *flakyStorage) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	s.calls += 1
+	// read the whole body so every retry proves it got a fresh reader
+	body, _ := io.ReadAll(contents)
+	if s.calls <= s.failures {
+		return "", s.err
+	}
+	s.body = body
+	return fpath, nil
+}
+
+func TestRetryStorage(t *testing.T) {
+	unavailable := minio.ErrorResponse{StatusCode: 503, Code: "ServiceUnavailable"}
+	fixtures := []struct {
+		name     string
+		failures int
+		err      error
+		calls    int
+		ok       bool
+	}{
+		{name: "recovers", failures: 2, err: unavailable, calls: 3, ok: true},
+		{name: "gives-up", failures: 10, err: unavailable, calls: 4, ok: false},
+		{name: "not-found", failures: 10, err: os.ErrNotExist, calls: 1, ok: false},
+		{name: "access-denied", failures: 10, err: minio.ErrorResponse{StatusCode: 403, Code: "AccessDenied"}, calls: 1, ok: false},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			backend := &flakyStorage{failures: fixture.failures, err: fixture.err}
+			st := NewRetryStorage(backend, 3, time.Millisecond)
+			delays := []time.Duration{}
+			st.sleep = func(ctx context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			text := []byte("<h1>hi</h1>")
+			_, err := st.PutObjectWithMeta(
+				sst.Bucket{Name: "test"},
+				"proj/index.html",
+				utils.NopReaderAtCloser(bytes.NewReader(text)),
+				&utils.FileEntry{Filepath: "proj/index.html", Size: int64(len(text))},
+				nil,
+			)
+			if fixture.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !fixture.ok && err == nil {
+				t.Fatal("expected error")
+			}
+			if backend.calls != fixture.calls {
+				t.Fatalf("expected %d calls, got %d", fixture.calls, backend.calls)
+			}
+			if fixture.ok && !bytes.Equal(backend.body, text) {
+				t.Fatalf("expected full body on retry, got %q", backend.body)
+			}
+			for i := 1; i < len(delays); i++ {
+				if delays[i] != delays[i-1]*2 {
+					t.Fatalf("expected exponential backoff, got %v", delays)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/minio/madmin-go/v3"
+	sst "github.com/picosh/pobj/storage"
+)
+
+type BucketStats struct {
+	TotalSize uint64
+	FileCount int
+}
+
+// GetBucketStats walks the bucket directory once for both numbers.
+func (s *StorageFS) GetBucketStats(bucket sst.Bucket) (BucketStats, error) {
+	stats := BucketStats{}
+	err := filepath.WalkDir(bucket.Path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.TotalSize += uint64(info.Size())
+		stats.FileCount += 1
+		return nil
+	})
+	return stats, err
+}
+
+func (s *StorageFS) GetBucketQuota(bucket sst.Bucket) (uint64, error) {
+	stats, err := s.GetBucketStats(bucket)
+	return stats.TotalSize, err
+}
+
+// GetBucketStats uses the usage minio already tracks per bucket instead of
+// listing every object.
+func (s *StorageMinio) GetBucketStats(bucket sst.Bucket) (BucketStats, error) {
+	stats := BucketStats{}
+	info, err := s.Admin.AccountInfo(context.TODO(), madmin.AccountOpts{})
+	if err != nil {
+		return stats, err
+	}
+	for _, b := range info.Buckets {
+		if b.Name == bucket.Name {
+			stats.TotalSize = b.Size
+			stats.FileCount = int(b.Objects)
+			return stats, nil
+		}
+	}
+
+	return stats, fmt.Errorf("%s bucket not found in account info", bucket.Name)
+}
+
+func (s *StorageMinio) GetBucketQuota(bucket sst.Bucket) (uint64, error) {
+	stats, err := s.GetBucketStats(bucket)
+	return stats.TotalSize, err
+}
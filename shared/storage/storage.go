@@ -1,13 +1,52 @@
 package storage
 
 import (
+	"context"
 	"io"
+	"os"
+	"time"
 
 	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
 )
 
 type StorageServe interface {
 	sst.ObjectStorage
 	ServeObject(bucket sst.Bucket, fpath string, opts *ImgProcessOpts) (io.ReadCloser, string, error)
 	GetObjectSize(bucket sst.Bucket, fpath string) (int64, error)
+	// GetBucketStats returns the size and number of objects in a bucket.
+	GetBucketStats(bucket sst.Bucket) (BucketStats, error)
+	// GetObjectRange reads length bytes starting at offset.
+	GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error)
+	// PresignGetURL returns a link anyone can use to download fname until
+	// ttl passes, backends that cannot sign return ErrPresignUnsupported.
+	PresignGetURL(bucket sst.Bucket, fname string, ttl time.Duration) (string, error)
+	// BatchDelete removes many objects in as few requests as the backend
+	// allows, objects that could not be removed are returned with their
+	// error. Missing objects count as removed.
+	BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error
+	// BatchStat returns the file info of many objects at once, keyed by
+	// path. Missing objects are left out.
+	BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error)
+	// MovePrefix moves every object below from to the same path below to.
+	MovePrefix(bucket sst.Bucket, from, to string) error
+	// GetObjectMeta returns what was recorded by PutObjectWithMeta.
+	GetObjectMeta(bucket sst.Bucket, fpath string) (*ObjectMeta, error)
+	PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error)
+	// PutObjectCtx is PutObjectWithMeta that gives up once ctx is done.
+	PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error)
+	// CreateMultipartUpload starts an upload of fpath that is stored in
+	// parts, nothing is visible at fpath until it is completed.
+	CreateMultipartUpload(bucket sst.Bucket, fpath string) (string, error)
+	// FindMultipartUpload returns the newest upload of fpath that was
+	// neither completed nor aborted, with the parts stored so far.
+	FindMultipartUpload(bucket sst.Bucket, fpath string) (*MultipartUpload, error)
+	// PutObjectPart stores size bytes of contents as part number of an
+	// upload, every part but the last has to be at least 5MB on s3.
+	PutObjectPart(bucket sst.Bucket, fpath, uploadID string, number int, contents io.Reader, size int64) (ObjectPart, error)
+	CompleteMultipartUpload(bucket sst.Bucket, fpath, uploadID string, parts []ObjectPart) (string, error)
+	AbortMultipartUpload(bucket sst.Bucket, fpath, uploadID string) error
+	// AbortStaleMultipartUploads aborts every upload in bucket that was
+	// started before `before` and returns how many there were.
+	AbortStaleMultipartUploads(bucket sst.Bucket, before time.Time) (int, error)
 }
@@ -0,0 +1,435 @@
+// Package storagetest holds the conformance tests every implementation of
+// storage.StorageServe has to pass so services behave the same on any
+// backend.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/shared/storage"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+var seq atomic.Int64
+
+// every test gets its own bucket so they stay independent when they share
+// a backend.
+func bucket(t *testing.T, st storage.StorageServe) sst.Bucket {
+	t.Helper()
+	name := fmt.Sprintf("test-%d-%d", time.Now().UnixNano(), seq.Add(1))
+	bucket, err := st.UpsertBucket(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.DeleteBucket(bucket) })
+	return bucket
+}
+
+func put(t *testing.T, st storage.StorageServe, bucket sst.Bucket, fpath, text string, meta *storage.ObjectMeta) {
+	t.Helper()
+	_, err := st.PutObjectWithMeta(
+		bucket,
+		fpath,
+		utils.NopReaderAtCloser(strings.NewReader(text)),
+		&utils.FileEntry{Filepath: fpath, Mtime: 1709288400},
+		meta,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, st storage.StorageServe, bucket sst.Bucket, fpath string) string {
+	t.Helper()
+	contents, _, _, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer contents.Close()
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func names(files []os.FileInfo) []string {
+	results := []string{}
+	for _, file := range files {
+		results = append(results, file.Name())
+	}
+	sort.Strings(results)
+	return results
+}
+
+// Run exercises every method of storage.StorageServe against st, which
+// has to let the tests create and delete buckets of their own.
+func Run(t *testing.T, st storage.StorageServe) {
+	t.Run("buckets", func(t *testing.T) { testBuckets(t, st) })
+	t.Run("objects", func(t *testing.T) { testObjects(t, st) })
+	t.Run("list", func(t *testing.T) { testList(t, st) })
+	t.Run("stats", func(t *testing.T) { testStats(t, st) })
+	t.Run("batch", func(t *testing.T) { testBatch(t, st) })
+	t.Run("move", func(t *testing.T) { testMove(t, st) })
+	t.Run("context", func(t *testing.T) { testContext(t, st) })
+	t.Run("multipart", func(t *testing.T) { testMultipart(t, st) })
+	t.Run("presign", func(t *testing.T) { testPresign(t, st) })
+}
+
+func testBuckets(t *testing.T, st storage.StorageServe) {
+	if _, err := st.GetBucket(fmt.Sprintf("missing-%d", seq.Add(1))); err == nil {
+		t.Error("expected a missing bucket to fail")
+	}
+
+	bucket := bucket(t, st)
+	again, err := st.UpsertBucket(bucket.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := st.GetBucket(bucket.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Name != bucket.Name || found.Name != bucket.Name {
+		t.Errorf("expected upsert to return the same bucket, got %+v and %+v", again, found)
+	}
+}
+
+func testObjects(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	meta := &storage.ObjectMeta{ContentType: "text/x-test", Checksum: "abc", Mtime: 1709288400}
+	put(t, st, bucket, "proj/index.html", "<h1>hi</h1>", meta)
+
+	contents, size, modTime, err := st.GetObject(bucket, "proj/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := contents.ReadAt(buf, 4); err != nil || string(buf) != "hi</" {
+		t.Errorf("expected to read at an offset, got %q %v", buf, err)
+	}
+	contents.Close()
+	if size != 11 || modTime.Unix() != 1709288400 {
+		t.Errorf("expected the size and mtime of the upload, got %d %v", size, modTime)
+	}
+	if text := read(t, st, bucket, "proj/index.html"); text != "<h1>hi</h1>" {
+		t.Errorf("unexpected contents %q", text)
+	}
+
+	size, err = st.GetObjectSize(bucket, "proj/index.html")
+	if err != nil || size != 11 {
+		t.Errorf("expected a size of 11, got %d %v", size, err)
+	}
+
+	found, err := st.GetObjectMeta(bucket, "proj/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(meta, found); diff != "" {
+		t.Error(diff)
+	}
+
+	rc, contentType, err := st.ServeObject(bucket, "proj/index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if contentType != "text/x-test" {
+		t.Errorf("expected the recorded content type, got %s", contentType)
+	}
+
+	rc, err = st.GetObjectRange(bucket, "proj/index.html", 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(part) != "hi" {
+		t.Errorf("expected a range of the object, got %q", part)
+	}
+
+	// uploading again replaces the object
+	put(t, st, bucket, "proj/index.html", "<h1>bye</h1>", nil)
+	if text := read(t, st, bucket, "proj/index.html"); text != "<h1>bye</h1>" {
+		t.Errorf("expected the object to be replaced, got %q", text)
+	}
+
+	err = st.DeleteObject(bucket, "proj/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := st.GetObject(bucket, "proj/index.html"); err == nil {
+		t.Error("expected a deleted object to be gone")
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/index.html"); err == nil {
+		t.Error("expected a deleted object to have no size")
+	}
+	if _, err := st.GetObjectMeta(bucket, "proj/index.html"); err == nil {
+		t.Error("expected the meta of a deleted object to be gone")
+	}
+}
+
+func testList(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	put(t, st, bucket, "proj/index.html", "index", nil)
+	put(t, st, bucket, "proj/css/main.css", "main", nil)
+	put(t, st, bucket, "proj/css/vendor/reset.css", "reset", nil)
+	put(t, st, bucket, "other/index.html", "other", nil)
+
+	files, err := st.ListObjects(bucket, "proj/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"css", "index.html"}, names(files)); diff != "" {
+		t.Error(diff)
+	}
+	for _, file := range files {
+		if file.IsDir() != (file.Name() == "css") {
+			t.Errorf("expected only css to be a directory, got %s %v", file.Name(), file.IsDir())
+		}
+	}
+
+	files, err = st.ListObjects(bucket, "proj/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"css/main.css", "css/vendor/reset.css", "index.html"}, names(files)); diff != "" {
+		t.Error(diff)
+	}
+
+	files, err = st.ListObjects(bucket, "proj", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !files[0].IsDir() {
+		t.Errorf("expected a directory to be listed as itself, got %+v", files)
+	}
+
+	if _, err := st.ListObjects(bucket, "missing/", false); err == nil {
+		t.Error("expected listing a missing directory to fail")
+	}
+
+	entries, err := storage.WalkObjects(st, bucket, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	sort.Strings(paths)
+	expected := []string{"proj/css/main.css", "proj/css/vendor/reset.css", "proj/index.html"}
+	if diff := cmp.Diff(expected, paths); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func testStats(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	put(t, st, bucket, "proj/a.txt", "aaaa", nil)
+	put(t, st, bucket, "proj/sub/b.txt", "bb", nil)
+
+	stats, err := st.GetBucketStats(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(storage.BucketStats{TotalSize: 6, FileCount: 2}, stats); diff != "" {
+		t.Error(diff)
+	}
+
+	quota, err := st.GetBucketQuota(bucket)
+	if err != nil || quota != 6 {
+		t.Errorf("expected a quota of 6, got %d %v", quota, err)
+	}
+}
+
+func testBatch(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	put(t, st, bucket, "proj/a.txt", "aaaa", nil)
+	put(t, st, bucket, "proj/b.txt", "bb", nil)
+
+	infos, err := st.BatchStat(bucket, []string{"proj/a.txt", "proj/b.txt", "proj/missing.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos["proj/a.txt"].Size() != 4 || infos["proj/b.txt"].Size() != 2 {
+		t.Errorf("expected the two stored objects, got %+v", infos)
+	}
+
+	errs := st.BatchDelete(bucket, []string{"proj/a.txt", "proj/missing.txt"})
+	if len(errs) != 0 {
+		t.Errorf("expected missing objects to count as removed, got %v", errs)
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/a.txt"); err == nil {
+		t.Error("expected proj/a.txt to be removed")
+	}
+	if text := read(t, st, bucket, "proj/b.txt"); text != "bb" {
+		t.Errorf("expected proj/b.txt to be kept, got %q", text)
+	}
+}
+
+func testMove(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	meta := &storage.ObjectMeta{ContentType: "text/css"}
+	put(t, st, bucket, "proj-old/index.html", "index", nil)
+	put(t, st, bucket, "proj-old/css/main.css", "main", meta)
+	put(t, st, bucket, "proj-new/stale.html", "stale", nil)
+
+	err := st.MovePrefix(bucket, "proj-old", "proj-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text := read(t, st, bucket, "proj-new/css/main.css"); text != "main" {
+		t.Errorf("expected the object to be moved, got %q", text)
+	}
+	found, err := st.GetObjectMeta(bucket, "proj-new/css/main.css")
+	if err != nil || found.ContentType != "text/css" {
+		t.Errorf("expected the meta to move with the object, got %+v %v", found, err)
+	}
+	if _, err := st.GetObjectSize(bucket, "proj-old/index.html"); err == nil {
+		t.Error("expected nothing to be left below the old prefix")
+	}
+	if _, err := st.GetObjectSize(bucket, "proj-new/stale.html"); err != nil {
+		t.Error("expected objects only below the new prefix to be kept")
+	}
+}
+
+func testContext(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := st.PutObjectCtx(
+		ctx,
+		bucket,
+		"proj/cancelled.txt",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("cancelled"))),
+		&utils.FileEntry{Filepath: "proj/cancelled.txt"},
+		nil,
+	)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the upload to be cancelled, got %v", err)
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/cancelled.txt"); err == nil {
+		t.Error("expected a cancelled upload to leave nothing behind")
+	}
+
+	_, err = st.PutObjectCtx(
+		context.Background(),
+		bucket,
+		"proj/done.txt",
+		utils.NopReaderAtCloser(bytes.NewReader([]byte("done"))),
+		&utils.FileEntry{Filepath: "proj/done.txt"},
+		&storage.ObjectMeta{ContentType: "text/plain"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := read(t, st, bucket, "proj/done.txt"); text != "done" {
+		t.Errorf("unexpected contents %q", text)
+	}
+}
+
+func testMultipart(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	id, err := st.CreateMultipartUpload(bucket, "proj/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObjectPart(bucket, "proj/big.bin", id, 1, strings.NewReader("hello "), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a part cut short is never kept
+	_, err = st.PutObjectPart(bucket, "proj/big.bin", id, 2, strings.NewReader("wor"), 5)
+	if err == nil {
+		t.Fatal("expected a short part to fail")
+	}
+	if _, err := st.GetObjectSize(bucket, "proj/big.bin"); err == nil {
+		t.Fatal("expected nothing to be stored before the upload completes")
+	}
+
+	upload, err := st.FindMultipartUpload(bucket, "proj/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.ID != id || upload.Size() != 6 || upload.NextPart() != 2 {
+		t.Fatalf("expected one stored part, got %+v", upload)
+	}
+
+	part, err := st.PutObjectPart(bucket, "proj/big.bin", id, 2, strings.NewReader("world"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.CompleteMultipartUpload(bucket, "proj/big.bin", id, append(upload.Parts, part))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := read(t, st, bucket, "proj/big.bin"); text != "hello world" {
+		t.Errorf("expected the parts to be joined, got %q", text)
+	}
+	if _, err := st.FindMultipartUpload(bucket, "proj/big.bin"); err == nil {
+		t.Error("expected a completed upload to be gone")
+	}
+
+	id, err = st.CreateMultipartUpload(bucket, "proj/aborted.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.AbortMultipartUpload(bucket, "proj/aborted.bin", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.FindMultipartUpload(bucket, "proj/aborted.bin"); err == nil {
+		t.Error("expected an aborted upload to be gone")
+	}
+
+	_, err = st.CreateMultipartUpload(bucket, "proj/stale.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err = st.FindMultipartUpload(bucket, "proj/stale.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Stale(time.Now()) || !upload.Stale(time.Now().Add(storage.UploadTTL+time.Minute)) {
+		t.Errorf("unexpected start of the upload %s", upload.Initiated)
+	}
+	count, err := st.AbortStaleMultipartUploads(bucket, time.Now().Add(-time.Minute))
+	if err != nil || count != 0 {
+		t.Fatalf("expected a fresh upload to stay, got (%d, %v)", count, err)
+	}
+	count, err = st.AbortStaleMultipartUploads(bucket, time.Now().Add(time.Minute))
+	if err != nil || count != 1 {
+		t.Fatalf("expected the stale upload to be aborted, got (%d, %v)", count, err)
+	}
+	if _, err := st.FindMultipartUpload(bucket, "proj/stale.bin"); err == nil {
+		t.Error("expected a stale upload to be gone")
+	}
+}
+
+func testPresign(t *testing.T, st storage.StorageServe) {
+	bucket := bucket(t, st)
+	put(t, st, bucket, "proj/index.html", "index", nil)
+
+	url, err := st.PresignGetURL(bucket, "proj/index.html", time.Minute)
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		return
+	}
+	if err != nil || url == "" {
+		t.Errorf("expected a url or ErrPresignUnsupported, got %q %v", url, err)
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+// MaxLinkHops is how many symlinks in a row are followed before we call it
+// a loop, like ELOOP on a filesystem.
+var MaxLinkHops = 8
+
+var ErrLinkLoop = errors.New("too many levels of symbolic links")
+
+// ResolveLink returns the path a symlink at fpath points to. Targets are
+// relative to the directory of the link like on a filesystem, they cannot
+// be absolute or leave root, the directory of the project.
+func ResolveLink(root, fpath, target string) (string, error) {
+	root = strings.Trim(root, "/")
+	if target == "" || strings.HasPrefix(target, "/") {
+		return "", fmt.Errorf("link target (%s) must be a relative path", target)
+	}
+	resolved := path.Join(path.Dir("/"+strings.Trim(fpath, "/")), target)
+	resolved = strings.TrimPrefix(resolved, "/")
+	if !strings.HasPrefix(resolved, root+"/") {
+		return "", fmt.Errorf("link target (%s) points outside of (%s)", target, root)
+	}
+	return resolved, nil
+}
+
+// followLinks resolves fpath until it is not a symlink, paths in seen
+// count as already visited.
+func followLinks(st StorageServe, bucket sst.Bucket, root, fpath string, seen map[string]bool) (string, error) {
+	cur := strings.Trim(fpath, "/")
+	for hops := 0; ; hops += 1 {
+		if seen[cur] || hops > MaxLinkHops {
+			return "", ErrLinkLoop
+		}
+		meta, err := st.GetObjectMeta(bucket, cur)
+		if err != nil || meta.Symlink == "" {
+			return cur, nil
+		}
+		seen[cur] = true
+		cur, err = ResolveLink(root, cur, meta.Symlink)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// FollowLinks returns the object a chain of symlinks starting at fpath ends
+// at, which might not exist, or ErrLinkLoop when it never ends.
+func FollowLinks(st StorageServe, bucket sst.Bucket, root, fpath string) (string, error) {
+	return followLinks(st, bucket, root, fpath, map[string]bool{})
+}
+
+// CheckLink validates a symlink at fpath to target before it is stored and
+// returns the path it resolves to. A link that would end up pointing back
+// at itself is a loop. Dangling links are fine, the target might still be
+// on its way.
+func CheckLink(st StorageServe, bucket sst.Bucket, root, fpath, target string) (string, error) {
+	resolved, err := ResolveLink(root, fpath, target)
+	if err != nil {
+		return "", err
+	}
+	self := strings.Trim(fpath, "/")
+	_, err = followLinks(st, bucket, root, resolved, map[string]bool{self: true})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
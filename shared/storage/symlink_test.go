@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/picosh/send/send/utils"
+)
+
+func TestResolveLink(t *testing.T) {
+	fixtures := []struct {
+		fpath    string
+		target   string
+		expected string
+	}{
+		{fpath: "/test/latest.html", target: "posts/one.html", expected: "test/posts/one.html"},
+		{fpath: "/test/posts/latest.html", target: "../index.html", expected: "test/index.html"},
+		{fpath: "/test/latest.html", target: "/etc/passwd"},
+		{fpath: "/test/latest.html", target: "../other/index.html"},
+		{fpath: "/test/latest.html", target: ""},
+	}
+	for _, fixture := range fixtures {
+		resolved, err := ResolveLink("test", fixture.fpath, fixture.target)
+		if fixture.expected == "" {
+			if err == nil {
+				t.Errorf("expected (%s) to be rejected, got (%s)", fixture.target, resolved)
+			}
+			continue
+		}
+		if err != nil || resolved != fixture.expected {
+			t.Errorf("expected (%s), got (%s) %v", fixture.expected, resolved, err)
+		}
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	st, err := NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := st.UpsertBucket("static-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		"test/a.html",
+		utils.NopReaderAtCloser(strings.NewReader("b.html")),
+		&utils.FileEntry{},
+		&ObjectMeta{Symlink: "b.html"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = CheckLink(st, bucket, "test", "test/b.html", "a.html")
+	if !errors.Is(err, ErrLinkLoop) {
+		t.Fatalf("expected a loop, got %v", err)
+	}
+	resolved, err := CheckLink(st, bucket, "test", "test/b.html", "missing.html")
+	if err != nil || resolved != "test/missing.html" {
+		t.Fatalf("expected a dangling link to be allowed, got (%s) %v", resolved, err)
+	}
+	final, err := FollowLinks(st, bucket, "test", "test/a.html")
+	if err != nil || final != "test/b.html" {
+		t.Fatalf("expected the link to end at (test/b.html), got (%s) %v", final, err)
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/picosh/pico/shared/tracing"
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// TracingStorage records every call as a span of Span, it is made for each
+// traced operation.
+type TracingStorage struct {
+	StorageServe
+	Span *tracing.Span
+}
+
+// NewTracingStorage is st itself when span is nil.
+func NewTracingStorage(st StorageServe, span *tracing.Span) StorageServe {
+	if span == nil {
+		return st
+	}
+	return &TracingStorage{StorageServe: st, Span: span}
+}
+
+func (s *TracingStorage) call(op, bucket, fpath string) *tracing.Span {
+	return s.Span.Child("storage."+op, tracing.KindClient, "storage.bucket", bucket, "storage.path", fpath)
+}
+
+func (s *TracingStorage) GetBucket(name string) (sst.Bucket, error) {
+	span := s.call("get_bucket", name, "")
+	bucket, err := s.StorageServe.GetBucket(name)
+	span.End(err)
+	return bucket, err
+}
+
+func (s *TracingStorage) UpsertBucket(name string) (sst.Bucket, error) {
+	span := s.call("upsert_bucket", name, "")
+	bucket, err := s.StorageServe.UpsertBucket(name)
+	span.End(err)
+	return bucket, err
+}
+
+func (s *TracingStorage) GetBucketStats(bucket sst.Bucket) (BucketStats, error) {
+	span := s.call("bucket_stats", bucket.Name, "")
+	stats, err := s.StorageServe.GetBucketStats(bucket)
+	span.End(err)
+	return stats, err
+}
+
+func (s *TracingStorage) ListObjects(bucket sst.Bucket, dir string, recursive bool) ([]os.FileInfo, error) {
+	span := s.call("list", bucket.Name, dir)
+	fileList, err := s.StorageServe.ListObjects(bucket, dir, recursive)
+	span.SetAttrs("storage.objects", len(fileList))
+	span.End(err)
+	return fileList, err
+}
+
+func (s *TracingStorage) GetObject(bucket sst.Bucket, fpath string) (utils.ReaderAtCloser, int64, time.Time, error) {
+	span := s.call("get", bucket.Name, fpath)
+	contents, size, modTime, err := s.StorageServe.GetObject(bucket, fpath)
+	span.End(err)
+	return contents, size, modTime, err
+}
+
+func (s *TracingStorage) GetObjectSize(bucket sst.Bucket, fpath string) (int64, error) {
+	span := s.call("stat", bucket.Name, fpath)
+	size, err := s.StorageServe.GetObjectSize(bucket, fpath)
+	span.End(err)
+	return size, err
+}
+
+func (s *TracingStorage) GetObjectMeta(bucket sst.Bucket, fpath string) (*ObjectMeta, error) {
+	span := s.call("meta", bucket.Name, fpath)
+	meta, err := s.StorageServe.GetObjectMeta(bucket, fpath)
+	span.End(err)
+	return meta, err
+}
+
+func (s *TracingStorage) GetObjectRange(bucket sst.Bucket, fpath string, offset, length int64) (io.ReadCloser, error) {
+	span := s.call("get_range", bucket.Name, fpath)
+	contents, err := s.StorageServe.GetObjectRange(bucket, fpath, offset, length)
+	span.End(err)
+	return contents, err
+}
+
+func (s *TracingStorage) ServeObject(bucket sst.Bucket, fpath string, opts *ImgProcessOpts) (io.ReadCloser, string, error) {
+	span := s.call("serve", bucket.Name, fpath)
+	contents, contentType, err := s.StorageServe.ServeObject(bucket, fpath, opts)
+	span.End(err)
+	return contents, contentType, err
+}
+
+func (s *TracingStorage) PutObject(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry) (string, error) {
+	span := s.call("put", bucket.Name, fpath)
+	loc, err := s.StorageServe.PutObject(bucket, fpath, contents, entry)
+	span.End(err)
+	return loc, err
+}
+
+func (s *TracingStorage) PutObjectWithMeta(bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	span := s.call("put", bucket.Name, fpath)
+	loc, err := s.StorageServe.PutObjectWithMeta(bucket, fpath, contents, entry, meta)
+	span.End(err)
+	return loc, err
+}
+
+func (s *TracingStorage) PutObjectCtx(ctx context.Context, bucket sst.Bucket, fpath string, contents utils.ReaderAtCloser, entry *utils.FileEntry, meta *ObjectMeta) (string, error) {
+	span := s.call("put", bucket.Name, fpath)
+	span.SetAttrs("storage.size", entry.Size)
+	loc, err := s.StorageServe.PutObjectCtx(ctx, bucket, fpath, contents, entry, meta)
+	span.End(err)
+	return loc, err
+}
+
+func (s *TracingStorage) DeleteObject(bucket sst.Bucket, fpath string) error {
+	span := s.call("delete", bucket.Name, fpath)
+	err := s.StorageServe.DeleteObject(bucket, fpath)
+	span.End(err)
+	return err
+}
+
+func (s *TracingStorage) BatchDelete(bucket sst.Bucket, fpaths []string) map[string]error {
+	span := s.call("delete_batch", bucket.Name, "")
+	span.SetAttrs("storage.objects", len(fpaths))
+	errs := s.StorageServe.BatchDelete(bucket, fpaths)
+	var err error
+	if len(errs) > 0 {
+		err = fmt.Errorf("could not delete %d objects", len(errs))
+	}
+	span.End(err)
+	return errs
+}
+
+func (s *TracingStorage) BatchStat(bucket sst.Bucket, fpaths []string) (map[string]os.FileInfo, error) {
+	span := s.call("stat_batch", bucket.Name, "")
+	span.SetAttrs("storage.objects", len(fpaths))
+	infos, err := s.StorageServe.BatchStat(bucket, fpaths)
+	span.End(err)
+	return infos, err
+}
+
+func (s *TracingStorage) MovePrefix(bucket sst.Bucket, from, to string) error {
+	span := s.call("move", bucket.Name, from)
+	err := s.StorageServe.MovePrefix(bucket, from, to)
+	span.End(err)
+	return err
+}
+
+func (s *TracingStorage) PutObjectPart(bucket sst.Bucket, fpath, uploadID string, number int, contents io.Reader, size int64) (ObjectPart, error) {
+	span := s.call("put_part", bucket.Name, fpath)
+	span.SetAttrs("storage.size", size)
+	part, err := s.StorageServe.PutObjectPart(bucket, fpath, uploadID, number, contents, size)
+	span.End(err)
+	return part, err
+}
+
+func (s *TracingStorage) CompleteMultipartUpload(bucket sst.Bucket, fpath, uploadID string, parts []ObjectPart) (string, error) {
+	span := s.call("complete_upload", bucket.Name, fpath)
+	loc, err := s.StorageServe.CompleteMultipartUpload(bucket, fpath, uploadID, parts)
+	span.End(err)
+	return loc, err
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+// image names never contain a directory so nothing uploaded can land here
+const variantDir = "_variants"
+
+// ImgVariant is a processed copy of an image made when it is uploaded,
+// requesting the image with Name as its options serves the copy.
+type ImgVariant struct {
+	Name string
+	Opts *ImgProcessOpts
+}
+
+// ParseImgVariants reads comma separated `name=opts` pairs where opts are
+// written like in image urls, e.g. `t=200x200,m=x500,webp=ext:webp/q:80`.
+// Pairs that do not parse are skipped and reported in the error.
+func ParseImgVariants(text string) ([]ImgVariant, error) {
+	variants := []ImgVariant{}
+	errs := []error{}
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, uri, found := strings.Cut(item, "=")
+		if !found || name == "" || strings.ContainsAny(name, "/.") {
+			errs = append(errs, fmt.Errorf("variant (%s) must be in format name=opts", item))
+			continue
+		}
+		opts, err := UriToImgProcessOpts(uri)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("variant (%s): %w", name, err))
+			continue
+		}
+		variants = append(variants, ImgVariant{Name: name, Opts: opts})
+	}
+	return variants, errors.Join(errs...)
+}
+
+func FindImgVariant(variants []ImgVariant, name string) (ImgVariant, bool) {
+	for _, variant := range variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return ImgVariant{}, false
+}
+
+// VariantPath is where the variant of the image at fpath is stored, it
+// gets the extension of the format the variant converts to.
+func VariantPath(fpath string, variant ImgVariant) string {
+	name := path.Join(variantDir, variant.Name, fpath)
+	ext := variant.Opts.Ext
+	if ext != "" && !strings.EqualFold(filepath.Ext(fpath), "."+ext) {
+		name += "." + ext
+	}
+	return name
+}
+
+// VariantBase returns the image a variant path was made from, it can still
+// carry the extension of the variant's format.
+func VariantBase(fpath string) (string, bool) {
+	parts := strings.SplitN(strings.Trim(fpath, "/"), "/", 3)
+	if len(parts) != 3 || parts[0] != variantDir {
+		return fpath, false
+	}
+	return parts[2], true
+}
+
+// ProcessImg makes a variant of the image stored at fpath, through imgproxy
+// when IMGPROXY_URL is set and with ResizeImg otherwise.
+func ProcessImg(st StorageServe, bucket sst.Bucket, fpath string, opts *ImgProcessOpts) ([]byte, string, error) {
+	if os.Getenv("IMGPROXY_URL") != "" {
+		rc, contentType, err := st.ServeObject(bucket, fpath, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		defer rc.Close()
+		processed, err := io.ReadAll(rc)
+		return processed, contentType, err
+	}
+
+	rc, _, _, err := st.GetObject(bucket, fpath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+	contents, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, "", err
+	}
+	return ResizeImg(contents, opts)
+}
+
+// PutImgVariant processes the image at fpath and stores the result at its
+// VariantPath.
+func PutImgVariant(st StorageServe, bucket sst.Bucket, fpath string, variant ImgVariant) error {
+	processed, contentType, err := ProcessImg(st, bucket, fpath, variant.Opts)
+	if err != nil {
+		return err
+	}
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		VariantPath(fpath, variant),
+		utils.NopReaderAtCloser(bytes.NewReader(processed)),
+		&utils.FileEntry{},
+		&ObjectMeta{ContentType: contentType},
+	)
+	return err
+}
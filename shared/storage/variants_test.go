@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func testPng(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResizeImg(t *testing.T) {
+	fixtures := []struct {
+		name        string
+		opts        string
+		width       int
+		height      int
+		contentType string
+		err         error
+	}{
+		{name: "width", opts: "200x", width: 200, height: 100, contentType: "image/png"},
+		{name: "height", opts: "x50", width: 100, height: 50, contentType: "image/png"},
+		{name: "fit", opts: "100x100", width: 100, height: 50, contentType: "image/png"},
+		{name: "no_enlarge", opts: "1000x", width: 400, height: 200, contentType: "image/png"},
+		{name: "rotate", opts: "200x/rt:90", width: 100, height: 200, contentType: "image/png"},
+		{name: "jpeg", opts: "200x/ext:jpg/q:70", width: 200, height: 100, contentType: "image/jpeg"},
+		{name: "webp", opts: "ext:webp", err: ErrImgUnsupported},
+	}
+
+	contents := testPng(t, 400, 200)
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			opts, err := UriToImgProcessOpts(fixture.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			processed, contentType, err := ResizeImg(contents, opts)
+			if !errors.Is(err, fixture.err) {
+				t.Fatalf("expected error (%v), got (%v)", fixture.err, err)
+			}
+			if fixture.err != nil {
+				return
+			}
+			if contentType != fixture.contentType {
+				t.Fatalf("expected content type (%s), got (%s)", fixture.contentType, contentType)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(processed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != fixture.width || cfg.Height != fixture.height {
+				t.Fatalf("expected (%dx%d), got (%dx%d)", fixture.width, fixture.height, cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
+
+func TestParseImgVariants(t *testing.T) {
+	variants, err := ParseImgVariants("t=200x200, webp=ext:webp/q:80,bad,x/y=x500")
+	if err == nil {
+		t.Fatal("expected the malformed variants to be reported")
+	}
+	if len(variants) != 2 {
+		t.Fatalf("expected 2 variants, got %d", len(variants))
+	}
+
+	thumb, ok := FindImgVariant(variants, "t")
+	if !ok || thumb.Opts.Ratio.Width != 200 {
+		t.Fatalf("expected thumbnail variant, got %+v", thumb)
+	}
+	if got := VariantPath("cat.png", thumb); got != "_variants/t/cat.png" {
+		t.Fatalf("unexpected variant path (%s)", got)
+	}
+
+	webp, _ := FindImgVariant(variants, "webp")
+	if got := VariantPath("cat.png", webp); got != "_variants/webp/cat.png.webp" {
+		t.Fatalf("unexpected variant path (%s)", got)
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	sst "github.com/picosh/pobj/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+var versionRe = regexp.MustCompile(`^(.+)\.v([0-9]+)$`)
+
+// VersionName returns the key a previous copy of fpath is stored under.
+func VersionName(fpath string, version int) string {
+	return fmt.Sprintf("%s.v%d", fpath, version)
+}
+
+// ParseVersion is the inverse of VersionName.
+func ParseVersion(fpath string) (string, int, bool) {
+	match := versionRe.FindStringSubmatch(fpath)
+	if match == nil {
+		return fpath, 0, false
+	}
+	version, err := strconv.Atoi(match[2])
+	if err != nil || version == 0 {
+		return fpath, 0, false
+	}
+	return match[1], version, true
+}
+
+func IsVersion(fpath string) bool {
+	_, _, ok := ParseVersion(fpath)
+	return ok
+}
+
+// FindVersions returns the versions stored for fpath, oldest first.
+func FindVersions(st sst.ObjectStorage, bucket sst.Bucket, fpath string) ([]int, error) {
+	versions := []int{}
+	dir, name := path.Split(strings.TrimPrefix(fpath, "/"))
+
+	fileList, err := st.ListObjects(bucket, dir, false)
+	if err != nil {
+		return versions, err
+	}
+
+	for _, file := range fileList {
+		if file.IsDir() {
+			continue
+		}
+		base, version, ok := ParseVersion(strings.Trim(file.Name(), "/"))
+		if ok && base == name {
+			versions = append(versions, version)
+		}
+	}
+
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// CopyObject copies src to dst within a bucket, keeping the modification
+// time and metadata of the original object.
+func CopyObject(st StorageServe, bucket sst.Bucket, src string, dst string) error {
+	contents, size, modTime, err := st.GetObject(bucket, src)
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	meta, err := st.GetObjectMeta(bucket, src)
+	if err != nil {
+		meta = &ObjectMeta{ContentType: GetMimeType(src)}
+	}
+	meta.Mtime = modTime.Unix()
+
+	_, err = st.PutObjectWithMeta(
+		bucket,
+		dst,
+		contents,
+		&utils.FileEntry{
+			Filepath: dst,
+			Size:     size,
+			Mtime:    modTime.Unix(),
+		},
+		meta,
+	)
+	return err
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sst "github.com/picosh/pobj/storage"
+)
+
+type ObjectEntry struct {
+	os.FileInfo
+	// Path is relative to the bucket, e.g. project/css/main.css
+	Path string
+}
+
+// WalkObjects lists every object below dir. Recursive listings from the
+// backends do not agree on whether names are full paths so we walk one
+// directory at a time instead.
+func WalkObjects(st sst.ObjectStorage, bucket sst.Bucket, dir string) ([]ObjectEntry, error) {
+	entries := []ObjectEntry{}
+	dir = strings.Trim(dir, "/")
+
+	fileList, err := st.ListObjects(bucket, dir+"/", false)
+	if err != nil {
+		return entries, err
+	}
+
+	for _, file := range fileList {
+		name := strings.Trim(file.Name(), "/")
+		if name == "" {
+			continue
+		}
+
+		fpath := filepath.Join(dir, name)
+		if file.IsDir() {
+			sub, err := WalkObjects(st, bucket, fpath)
+			if err != nil {
+				return entries, err
+			}
+			entries = append(entries, sub...)
+			continue
+		}
+
+		entries = append(entries, ObjectEntry{FileInfo: file, Path: fpath})
+	}
+
+	return entries, nil
+}
+
+// DeleteObjects removes every object below prefix and reports how many
+// objects and bytes were removed.
+func DeleteObjects(st StorageServe, bucket sst.Bucket, prefix string) (int, int64, error) {
+	count := 0
+	size := int64(0)
+
+	entries, err := WalkObjects(st, bucket, prefix)
+	if err != nil {
+		return count, size, err
+	}
+
+	fpaths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		fpaths = append(fpaths, entry.Path)
+	}
+	errs := st.BatchDelete(bucket, fpaths)
+
+	var failed []error
+	for _, entry := range entries {
+		if err, ok := errs[entry.Path]; ok {
+			failed = append(failed, err)
+			continue
+		}
+		count += 1
+		size += entry.Size()
+	}
+
+	return count, size, errors.Join(failed...)
+}
@@ -0,0 +1,1071 @@
+package tracing
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared/headers"
+	"github.com/picosh/pico/shared/redirects"
+)
+
+// DB records every query of a deploy as a span of Span.
+type DB struct {
+	db.DB
+	Span *Span
+}
+
+// NewDB is dbpool itself when span is nil.
+func NewDB(dbpool db.DB, span *Span) db.DB {
+	if span == nil {
+		return dbpool
+	}
+	return &DB{DB: dbpool, Span: span}
+}
+
+func (d *DB) query(name string) *Span {
+	return d.Span.Child("db."+name, KindClient, "db.operation", name)
+}
+
+func (d *DB) RegisterUser(name, pubkey string) (*db.User, error) {
+	span := d.query("RegisterUser")
+	user, err := d.DB.RegisterUser(name, pubkey)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) RemoveUsers(userIDs []string) error {
+	span := d.query("RemoveUsers")
+	err := d.DB.RemoveUsers(userIDs)
+	span.End(err)
+	return err
+}
+
+func (d *DB) LinkUserKey(userID string, pubkey string, tx *sql.Tx) error {
+	span := d.query("LinkUserKey")
+	err := d.DB.LinkUserKey(userID, pubkey, tx)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindPublicKeyForKey(pubkey string) (*db.PublicKey, error) {
+	span := d.query("FindPublicKeyForKey")
+	key, err := d.DB.FindPublicKeyForKey(pubkey)
+	span.End(err)
+	return key, err
+}
+
+func (d *DB) FindKeysForUser(user *db.User) ([]*db.PublicKey, error) {
+	span := d.query("FindKeysForUser")
+	keys, err := d.DB.FindKeysForUser(user)
+	span.End(err)
+	return keys, err
+}
+
+func (d *DB) RemoveKeys(pubkeyIDs []string) error {
+	span := d.query("RemoveKeys")
+	err := d.DB.RemoveKeys(pubkeyIDs)
+	span.End(err)
+	return err
+}
+
+func (d *DB) InsertPublicKey(userID, pubkey string) (*db.PublicKey, error) {
+	span := d.query("InsertPublicKey")
+	key, err := d.DB.InsertPublicKey(userID, pubkey)
+	span.End(err)
+	return key, err
+}
+
+func (d *DB) RemovePublicKey(userID, pubkeyID string) error {
+	span := d.query("RemovePublicKey")
+	err := d.DB.RemovePublicKey(userID, pubkeyID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) ListKeysForUser(userID string) ([]*db.PublicKey, error) {
+	span := d.query("ListKeysForUser")
+	keys, err := d.DB.ListKeysForUser(userID)
+	span.End(err)
+	return keys, err
+}
+
+func (d *DB) FindSiteAnalytics(space string) (*db.Analytics, error) {
+	span := d.query("FindSiteAnalytics")
+	analytics, err := d.DB.FindSiteAnalytics(space)
+	span.End(err)
+	return analytics, err
+}
+
+func (d *DB) FindUsers() ([]*db.User, error) {
+	span := d.query("FindUsers")
+	users, err := d.DB.FindUsers()
+	span.End(err)
+	return users, err
+}
+
+func (d *DB) FindUserForName(name string) (*db.User, error) {
+	span := d.query("FindUserForName")
+	user, err := d.DB.FindUserForName(name)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindUserForNameAndKey(name string, pubkey string) (*db.User, error) {
+	span := d.query("FindUserForNameAndKey")
+	user, err := d.DB.FindUserForNameAndKey(name, pubkey)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindUserForKey(name string, pubkey string) (*db.User, error) {
+	span := d.query("FindUserForKey")
+	user, err := d.DB.FindUserForKey(name, pubkey)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindUser(userID string) (*db.User, error) {
+	span := d.query("FindUser")
+	user, err := d.DB.FindUser(userID)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) ValidateName(name string) (bool, error) {
+	span := d.query("ValidateName")
+	ok, err := d.DB.ValidateName(name)
+	span.End(err)
+	return ok, err
+}
+
+func (d *DB) SetUserName(userID string, name string) error {
+	span := d.query("SetUserName")
+	err := d.DB.SetUserName(userID, name)
+	span.End(err)
+	return err
+}
+
+func (d *DB) SetUserSuspended(userID string, suspended bool, operatorID string) error {
+	span := d.query("SetUserSuspended")
+	err := d.DB.SetUserSuspended(userID, suspended, operatorID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) SetUserReadOnly(userID string, readOnly bool, operatorID string) error {
+	span := d.query("SetUserReadOnly")
+	err := d.DB.SetUserReadOnly(userID, readOnly, operatorID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindUserForToken(token string) (*db.User, error) {
+	span := d.query("FindUserForToken")
+	user, err := d.DB.FindUserForToken(token)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindUserForScopedToken(token, scope string) (*db.User, error) {
+	span := d.query("FindUserForScopedToken")
+	user, err := d.DB.FindUserForScopedToken(token, scope)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindTokensForUser(userID string) ([]*db.Token, error) {
+	span := d.query("FindTokensForUser")
+	tokens, err := d.DB.FindTokensForUser(userID)
+	span.End(err)
+	return tokens, err
+}
+
+func (d *DB) InsertToken(userID, name string) (string, error) {
+	span := d.query("InsertToken")
+	token, err := d.DB.InsertToken(userID, name)
+	span.End(err)
+	return token, err
+}
+
+func (d *DB) InsertScopedToken(userID, name, scope string) (string, error) {
+	span := d.query("InsertScopedToken")
+	token, err := d.DB.InsertScopedToken(userID, name, scope)
+	span.End(err)
+	return token, err
+}
+
+func (d *DB) RemoveToken(tokenID string) error {
+	span := d.query("RemoveToken")
+	err := d.DB.RemoveToken(tokenID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindUserSummaries(filter string) ([]*db.UserSummary, error) {
+	span := d.query("FindUserSummaries")
+	summaries, err := d.DB.FindUserSummaries(filter)
+	span.End(err)
+	return summaries, err
+}
+
+func (d *DB) SetFeatureForUser(userID, name string, data db.FeatureFlagData, expiresAt time.Time) error {
+	span := d.query("SetFeatureForUser")
+	err := d.DB.SetFeatureForUser(userID, name, data, expiresAt)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveFeatureForUser(userID, name string) error {
+	span := d.query("RemoveFeatureForUser")
+	err := d.DB.RemoveFeatureForUser(userID, name)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveTokensForUser(userID string) (int, error) {
+	span := d.query("RemoveTokensForUser")
+	count, err := d.DB.RemoveTokensForUser(userID)
+	span.End(err)
+	return count, err
+}
+
+func (d *DB) FindPosts() ([]*db.Post, error) {
+	span := d.query("FindPosts")
+	posts, err := d.DB.FindPosts()
+	span.End(err)
+	return posts, err
+}
+
+func (d *DB) FindPost(postID string) (*db.Post, error) {
+	span := d.query("FindPost")
+	post, err := d.DB.FindPost(postID)
+	span.End(err)
+	return post, err
+}
+
+func (d *DB) FindPostsForUser(pager *db.Pager, userID string, space string) (*db.Paginate[*db.Post], error) {
+	span := d.query("FindPostsForUser")
+	page, err := d.DB.FindPostsForUser(pager, userID, space)
+	span.End(err)
+	return page, err
+}
+
+func (d *DB) FindAllPostsForUser(userID string, space string) ([]*db.Post, error) {
+	span := d.query("FindAllPostsForUser")
+	posts, err := d.DB.FindAllPostsForUser(userID, space)
+	span.End(err)
+	return posts, err
+}
+
+func (d *DB) FindPostCountForUser(userID string, space string) (int, error) {
+	span := d.query("FindPostCountForUser")
+	count, err := d.DB.FindPostCountForUser(userID, space)
+	span.End(err)
+	return count, err
+}
+
+func (d *DB) FindPostsBeforeDate(date *time.Time, space string) ([]*db.Post, error) {
+	span := d.query("FindPostsBeforeDate")
+	posts, err := d.DB.FindPostsBeforeDate(date, space)
+	span.End(err)
+	return posts, err
+}
+
+func (d *DB) FindExpiredPosts(space string) ([]*db.Post, error) {
+	span := d.query("FindExpiredPosts")
+	posts, err := d.DB.FindExpiredPosts(space)
+	span.End(err)
+	return posts, err
+}
+
+func (d *DB) FindUpdatedPostsForUser(userID string, space string) ([]*db.Post, error) {
+	span := d.query("FindUpdatedPostsForUser")
+	posts, err := d.DB.FindUpdatedPostsForUser(userID, space)
+	span.End(err)
+	return posts, err
+}
+
+func (d *DB) FindPostWithFilename(filename string, userID string, space string) (*db.Post, error) {
+	span := d.query("FindPostWithFilename")
+	post, err := d.DB.FindPostWithFilename(filename, userID, space)
+	span.End(err)
+	return post, err
+}
+
+func (d *DB) FindPostWithSlug(slug string, userID string, space string) (*db.Post, error) {
+	span := d.query("FindPostWithSlug")
+	post, err := d.DB.FindPostWithSlug(slug, userID, space)
+	span.End(err)
+	return post, err
+}
+
+func (d *DB) FindAllPosts(pager *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	span := d.query("FindAllPosts")
+	page, err := d.DB.FindAllPosts(pager, space)
+	span.End(err)
+	return page, err
+}
+
+func (d *DB) FindAllUpdatedPosts(pager *db.Pager, space string) (*db.Paginate[*db.Post], error) {
+	span := d.query("FindAllUpdatedPosts")
+	page, err := d.DB.FindAllUpdatedPosts(pager, space)
+	span.End(err)
+	return page, err
+}
+
+func (d *DB) InsertPost(post *db.Post) (*db.Post, error) {
+	span := d.query("InsertPost")
+	post, err := d.DB.InsertPost(post)
+	span.End(err)
+	return post, err
+}
+
+func (d *DB) UpdatePost(post *db.Post) (*db.Post, error) {
+	span := d.query("UpdatePost")
+	post, err := d.DB.UpdatePost(post)
+	span.End(err)
+	return post, err
+}
+
+func (d *DB) RemovePosts(postIDs []string) error {
+	span := d.query("RemovePosts")
+	err := d.DB.RemovePosts(postIDs)
+	span.End(err)
+	return err
+}
+
+func (d *DB) PublishScheduledPosts(limit int) ([]*db.Post, error) {
+	span := d.query("PublishScheduledPosts")
+	posts, err := d.DB.PublishScheduledPosts(limit)
+	span.End(err)
+	return posts, err
+}
+
+func (d *DB) SearchPostsForUser(userID, space, query string, limit int) ([]*db.PostSearchResult, error) {
+	span := d.query("SearchPostsForUser")
+	results, err := d.DB.SearchPostsForUser(userID, space, query, limit)
+	span.End(err)
+	return results, err
+}
+
+func (d *DB) ReplaceTagsForPost(tags []string, postID string) error {
+	span := d.query("ReplaceTagsForPost")
+	err := d.DB.ReplaceTagsForPost(tags, postID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindUserPostsByTag(pager *db.Pager, tag, userID, space string) (*db.Paginate[*db.Post], error) {
+	span := d.query("FindUserPostsByTag")
+	page, err := d.DB.FindUserPostsByTag(pager, tag, userID, space)
+	span.End(err)
+	return page, err
+}
+
+func (d *DB) FindPostsByTag(pager *db.Pager, tag, space string) (*db.Paginate[*db.Post], error) {
+	span := d.query("FindPostsByTag")
+	page, err := d.DB.FindPostsByTag(pager, tag, space)
+	span.End(err)
+	return page, err
+}
+
+func (d *DB) FindPopularTags(space string) ([]string, error) {
+	span := d.query("FindPopularTags")
+	names, err := d.DB.FindPopularTags(space)
+	span.End(err)
+	return names, err
+}
+
+func (d *DB) FindTagsForPost(postID string) ([]string, error) {
+	span := d.query("FindTagsForPost")
+	names, err := d.DB.FindTagsForPost(postID)
+	span.End(err)
+	return names, err
+}
+
+func (d *DB) ReplaceAliasesForPost(aliases []string, postID string) error {
+	span := d.query("ReplaceAliasesForPost")
+	err := d.DB.ReplaceAliasesForPost(aliases, postID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) AddViewCount(postID string) (int, error) {
+	span := d.query("AddViewCount")
+	count, err := d.DB.AddViewCount(postID)
+	span.End(err)
+	return count, err
+}
+
+func (d *DB) AddPicoPlusUser(username string, paymentType, txId string) error {
+	span := d.query("AddPicoPlusUser")
+	err := d.DB.AddPicoPlusUser(username, paymentType, txId)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindFeatureForUser(userID string, feature string) (*db.FeatureFlag, error) {
+	span := d.query("FindFeatureForUser")
+	ff, err := d.DB.FindFeatureForUser(userID, feature)
+	span.End(err)
+	return ff, err
+}
+
+func (d *DB) HasFeatureForUser(userID string, feature string) bool {
+	span := d.query("HasFeatureForUser")
+	ok := d.DB.HasFeatureForUser(userID, feature)
+	span.End(nil)
+	return ok
+}
+
+func (d *DB) FindQuotaForUser(userID string, feature string) (*db.Quota, error) {
+	span := d.query("FindQuotaForUser")
+	quota, err := d.DB.FindQuotaForUser(userID, feature)
+	span.End(err)
+	return quota, err
+}
+
+func (d *DB) HasAnyFeatureForUser(userID string, features ...string) (bool, error) {
+	span := d.query("HasAnyFeatureForUser")
+	ok, err := d.DB.HasAnyFeatureForUser(userID, features...)
+	span.End(err)
+	return ok, err
+}
+
+func (d *DB) FindTotalSizeForUser(userID string) (int, error) {
+	span := d.query("FindTotalSizeForUser")
+	count, err := d.DB.FindTotalSizeForUser(userID)
+	span.End(err)
+	return count, err
+}
+
+func (d *DB) InsertFeedItems(postID string, items []*db.FeedItem) error {
+	span := d.query("InsertFeedItems")
+	err := d.DB.InsertFeedItems(postID, items)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindFeedItemsByPostID(postID string) ([]*db.FeedItem, error) {
+	span := d.query("FindFeedItemsByPostID")
+	feedItems, err := d.DB.FindFeedItemsByPostID(postID)
+	span.End(err)
+	return feedItems, err
+}
+
+func (d *DB) UpsertDigestSubscription(userID string) (*db.DigestSubscription, error) {
+	span := d.query("UpsertDigestSubscription")
+	sub, err := d.DB.UpsertDigestSubscription(userID)
+	span.End(err)
+	return sub, err
+}
+
+func (d *DB) UnsubscribeDigests(token string) (*db.DigestSubscription, error) {
+	span := d.query("UnsubscribeDigests")
+	sub, err := d.DB.UnsubscribeDigests(token)
+	span.End(err)
+	return sub, err
+}
+
+func (d *DB) ResubscribeDigests(userID string) error {
+	span := d.query("ResubscribeDigests")
+	err := d.DB.ResubscribeDigests(userID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) AddPostEmailSender(userID, email string) error {
+	span := d.query("AddPostEmailSender")
+	err := d.DB.AddPostEmailSender(userID, email)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemovePostEmailSender(userID, email string) error {
+	span := d.query("RemovePostEmailSender")
+	err := d.DB.RemovePostEmailSender(userID, email)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindPostEmailSenders(userID string) ([]*db.PostEmailSender, error) {
+	span := d.query("FindPostEmailSenders")
+	senders, err := d.DB.FindPostEmailSenders(userID)
+	span.End(err)
+	return senders, err
+}
+
+func (d *DB) InsertProject(userID, name, projectDir string) (string, error) {
+	span := d.query("InsertProject")
+	id, err := d.DB.InsertProject(userID, name, projectDir)
+	span.End(err)
+	return id, err
+}
+
+func (d *DB) UpdateProject(userID, name string) error {
+	span := d.query("UpdateProject")
+	err := d.DB.UpdateProject(userID, name)
+	span.End(err)
+	return err
+}
+
+func (d *DB) UpdateProjectAcl(userID, name string, acl db.ProjectAcl) error {
+	span := d.query("UpdateProjectAcl")
+	err := d.DB.UpdateProjectAcl(userID, name, acl)
+	span.End(err)
+	return err
+}
+
+func (d *DB) UpdateProjectCsp(userID, name string, csp db.ProjectCsp) error {
+	span := d.query("UpdateProjectCsp")
+	err := d.DB.UpdateProjectCsp(userID, name, csp)
+	span.End(err)
+	return err
+}
+
+func (d *DB) UpdateProjectSitemap(userID, name string, sitemap bool) error {
+	span := d.query("UpdateProjectSitemap")
+	err := d.DB.UpdateProjectSitemap(userID, name, sitemap)
+	span.End(err)
+	return err
+}
+
+func (d *DB) UpsertHeaders(projectID string, rules []*headers.HeaderRule) error {
+	span := d.query("UpsertHeaders")
+	err := d.DB.UpsertHeaders(projectID, rules)
+	span.End(err)
+	return err
+}
+
+func (d *DB) UpsertRedirects(projectID string, rules []*redirects.RedirectRule) error {
+	span := d.query("UpsertRedirects")
+	err := d.DB.UpsertRedirects(projectID, rules)
+	span.End(err)
+	return err
+}
+
+func (d *DB) LinkToProject(userID, projectID, projectDir string, commit bool) error {
+	span := d.query("LinkToProject")
+	err := d.DB.LinkToProject(userID, projectID, projectDir, commit)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveProject(projectID string) error {
+	span := d.query("RemoveProject")
+	err := d.DB.RemoveProject(projectID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) SetProjectExpiry(projectID string, expiresAt *time.Time) error {
+	span := d.query("SetProjectExpiry")
+	err := d.DB.SetProjectExpiry(projectID, expiresAt)
+	span.End(err)
+	return err
+}
+
+func (d *DB) ClaimExpiredProjects(limit int) ([]*db.Project, error) {
+	span := d.query("ClaimExpiredProjects")
+	projects, err := d.DB.ClaimExpiredProjects(limit)
+	span.End(err)
+	return projects, err
+}
+
+func (d *DB) RenameProject(userID, oldName, newName string) error {
+	span := d.query("RenameProject")
+	err := d.DB.RenameProject(userID, oldName, newName)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectByName(userID, name string) (*db.Project, error) {
+	span := d.query("FindProjectByName")
+	project, err := d.DB.FindProjectByName(userID, name)
+	span.End(err)
+	return project, err
+}
+
+func (d *DB) FindProjectLinks(userID, name string) ([]*db.Project, error) {
+	span := d.query("FindProjectLinks")
+	projects, err := d.DB.FindProjectLinks(userID, name)
+	span.End(err)
+	return projects, err
+}
+
+func (d *DB) FindProjectsByUser(userID string) ([]*db.Project, error) {
+	span := d.query("FindProjectsByUser")
+	projects, err := d.DB.FindProjectsByUser(userID)
+	span.End(err)
+	return projects, err
+}
+
+func (d *DB) FindProjectsByPrefix(userID, name string) ([]*db.Project, error) {
+	span := d.query("FindProjectsByPrefix")
+	projects, err := d.DB.FindProjectsByPrefix(userID, name)
+	span.End(err)
+	return projects, err
+}
+
+func (d *DB) FindStaleProjects(userID string, updatedBefore time.Time) ([]*db.Project, error) {
+	span := d.query("FindStaleProjects")
+	projects, err := d.DB.FindStaleProjects(userID, updatedBefore)
+	span.End(err)
+	return projects, err
+}
+
+func (d *DB) FindAllProjects(page *db.Pager, by string) (*db.Paginate[*db.Project], error) {
+	span := d.query("FindAllProjects")
+	projects, err := d.DB.FindAllProjects(page, by)
+	span.End(err)
+	return projects, err
+}
+
+func (d *DB) FindProjectObjectCount(userID, name string) (*int, error) {
+	span := d.query("FindProjectObjectCount")
+	count, err := d.DB.FindProjectObjectCount(userID, name)
+	span.End(err)
+	return count, err
+}
+
+func (d *DB) FindObjectCountsForUser(userID string) (map[string]*int, error) {
+	span := d.query("FindObjectCountsForUser")
+	found, err := d.DB.FindObjectCountsForUser(userID)
+	span.End(err)
+	return found, err
+}
+
+func (d *DB) SetProjectObjectCount(userID, name string, count *int) error {
+	span := d.query("SetProjectObjectCount")
+	err := d.DB.SetProjectObjectCount(userID, name, count)
+	span.End(err)
+	return err
+}
+
+func (d *DB) AdjustProjectObjectCount(userID, name string, delta int) error {
+	span := d.query("AdjustProjectObjectCount")
+	err := d.DB.AdjustProjectObjectCount(userID, name, delta)
+	span.End(err)
+	return err
+}
+
+func (d *DB) InsertProjectDomain(projectID, domain string) (string, error) {
+	span := d.query("InsertProjectDomain")
+	id, err := d.DB.InsertProjectDomain(projectID, domain)
+	span.End(err)
+	return id, err
+}
+
+func (d *DB) RemoveProjectDomain(userID, domain string) error {
+	span := d.query("RemoveProjectDomain")
+	err := d.DB.RemoveProjectDomain(userID, domain)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectDomains(userID string) ([]*db.ProjectDomain, error) {
+	span := d.query("FindProjectDomains")
+	domains, err := d.DB.FindProjectDomains(userID)
+	span.End(err)
+	return domains, err
+}
+
+func (d *DB) FindUnverifiedDomains(limit int) ([]*db.ProjectDomain, error) {
+	span := d.query("FindUnverifiedDomains")
+	domains, err := d.DB.FindUnverifiedDomains(limit)
+	span.End(err)
+	return domains, err
+}
+
+func (d *DB) VerifyProjectDomain(domainID string) error {
+	span := d.query("VerifyProjectDomain")
+	err := d.DB.VerifyProjectDomain(domainID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindDomainsToRecheck(verifiedBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	span := d.query("FindDomainsToRecheck")
+	domains, err := d.DB.FindDomainsToRecheck(verifiedBefore, limit)
+	span.End(err)
+	return domains, err
+}
+
+func (d *DB) UnverifyProjectDomain(domainID string) error {
+	span := d.query("UnverifyProjectDomain")
+	err := d.DB.UnverifyProjectDomain(domainID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindSubdomainForDomain(domain string) (string, error) {
+	span := d.query("FindSubdomainForDomain")
+	id, err := d.DB.FindSubdomainForDomain(domain)
+	span.End(err)
+	return id, err
+}
+
+func (d *DB) UpsertDomainCert(cert *db.DomainCert) error {
+	span := d.query("UpsertDomainCert")
+	err := d.DB.UpsertDomainCert(cert)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindDomainCert(domain string) (*db.DomainCert, error) {
+	span := d.query("FindDomainCert")
+	domainCert, err := d.DB.FindDomainCert(domain)
+	span.End(err)
+	return domainCert, err
+}
+
+func (d *DB) FindDomainsForCerts(renewBefore time.Time, limit int) ([]*db.ProjectDomain, error) {
+	span := d.query("FindDomainsForCerts")
+	domains, err := d.DB.FindDomainsForCerts(renewBefore, limit)
+	span.End(err)
+	return domains, err
+}
+
+func (d *DB) InsertProjectDeploy(projectID string, revision, fileCount int, size int64) error {
+	span := d.query("InsertProjectDeploy")
+	err := d.DB.InsertProjectDeploy(projectID, revision, fileCount, size)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectDeploys(projectID string) ([]*db.ProjectDeploy, error) {
+	span := d.query("FindProjectDeploys")
+	deploys, err := d.DB.FindProjectDeploys(projectID)
+	span.End(err)
+	return deploys, err
+}
+
+func (d *DB) FindCurrentDeploy(userID, projectName string) (*db.ProjectDeploy, error) {
+	span := d.query("FindCurrentDeploy")
+	deploy, err := d.DB.FindCurrentDeploy(userID, projectName)
+	span.End(err)
+	return deploy, err
+}
+
+func (d *DB) SetCurrentDeploy(projectID string, revision int) error {
+	span := d.query("SetCurrentDeploy")
+	err := d.DB.SetCurrentDeploy(projectID, revision)
+	span.End(err)
+	return err
+}
+
+func (d *DB) ClearCurrentDeploy(userID, projectName string) error {
+	span := d.query("ClearCurrentDeploy")
+	err := d.DB.ClearCurrentDeploy(userID, projectName)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveProjectDeploy(deployID string) error {
+	span := d.query("RemoveProjectDeploy")
+	err := d.DB.RemoveProjectDeploy(deployID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) InsertWebhook(userID, url, secret string) (string, error) {
+	span := d.query("InsertWebhook")
+	id, err := d.DB.InsertWebhook(userID, url, secret)
+	span.End(err)
+	return id, err
+}
+
+func (d *DB) FindWebhooksForUser(userID string) ([]*db.Webhook, error) {
+	span := d.query("FindWebhooksForUser")
+	webhooks, err := d.DB.FindWebhooksForUser(userID)
+	span.End(err)
+	return webhooks, err
+}
+
+func (d *DB) RemoveWebhook(userID, webhookID string) error {
+	span := d.query("RemoveWebhook")
+	err := d.DB.RemoveWebhook(userID, webhookID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) InsertAuditEntry(entry *db.AuditEntry) error {
+	span := d.query("InsertAuditEntry")
+	err := d.DB.InsertAuditEntry(entry)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindAuditLog(userID string, since time.Time, limit int) ([]*db.AuditEntry, error) {
+	span := d.query("FindAuditLog")
+	auditEntries, err := d.DB.FindAuditLog(userID, since, limit)
+	span.End(err)
+	return auditEntries, err
+}
+
+func (d *DB) InsertTrashObject(obj *db.TrashObject) error {
+	span := d.query("InsertTrashObject")
+	err := d.DB.InsertTrashObject(obj)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindTrashObjects(userID string) ([]*db.TrashObject, error) {
+	span := d.query("FindTrashObjects")
+	objects, err := d.DB.FindTrashObjects(userID)
+	span.End(err)
+	return objects, err
+}
+
+func (d *DB) RemoveTrashObject(id string) error {
+	span := d.query("RemoveTrashObject")
+	err := d.DB.RemoveTrashObject(id)
+	span.End(err)
+	return err
+}
+
+func (d *DB) ClaimExpiredTrash(limit int) ([]*db.TrashObject, error) {
+	span := d.query("ClaimExpiredTrash")
+	objects, err := d.DB.ClaimExpiredTrash(limit)
+	span.End(err)
+	return objects, err
+}
+
+func (d *DB) SetProjectEnv(projectID, key, value string) error {
+	span := d.query("SetProjectEnv")
+	err := d.DB.SetProjectEnv(projectID, key, value)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveProjectEnv(projectID, key string) error {
+	span := d.query("RemoveProjectEnv")
+	err := d.DB.RemoveProjectEnv(projectID, key)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectEnv(projectID string) ([]*db.ProjectEnv, error) {
+	span := d.query("FindProjectEnv")
+	envs, err := d.DB.FindProjectEnv(projectID)
+	span.End(err)
+	return envs, err
+}
+
+func (d *DB) SetProjectSigningKey(projectID, key string) error {
+	span := d.query("SetProjectSigningKey")
+	err := d.DB.SetProjectSigningKey(projectID, key)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveProjectSigningKey(projectID string) error {
+	span := d.query("RemoveProjectSigningKey")
+	err := d.DB.RemoveProjectSigningKey(projectID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectSigningKey(projectID string) (*db.ProjectSigningKey, error) {
+	span := d.query("FindProjectSigningKey")
+	key, err := d.DB.FindProjectSigningKey(projectID)
+	span.End(err)
+	return key, err
+}
+
+func (d *DB) CreateOrg(ownerID, name string) (*db.User, error) {
+	span := d.query("CreateOrg")
+	user, err := d.DB.CreateOrg(ownerID, name)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindOrgForName(name string) (*db.User, error) {
+	span := d.query("FindOrgForName")
+	user, err := d.DB.FindOrgForName(name)
+	span.End(err)
+	return user, err
+}
+
+func (d *DB) FindOrgMember(orgID, userID string) (*db.OrgMember, error) {
+	span := d.query("FindOrgMember")
+	orgMember, err := d.DB.FindOrgMember(orgID, userID)
+	span.End(err)
+	return orgMember, err
+}
+
+func (d *DB) FindOrgMembers(orgID string) ([]*db.OrgMember, error) {
+	span := d.query("FindOrgMembers")
+	orgMembers, err := d.DB.FindOrgMembers(orgID)
+	span.End(err)
+	return orgMembers, err
+}
+
+func (d *DB) SetOrgMember(orgID, userID, role string) error {
+	span := d.query("SetOrgMember")
+	err := d.DB.SetOrgMember(orgID, userID, role)
+	span.End(err)
+	return err
+}
+
+func (d *DB) RemoveOrgMember(orgID, userID string) error {
+	span := d.query("RemoveOrgMember")
+	err := d.DB.RemoveOrgMember(orgID, userID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) SetProjectAccess(projectID string, entries []*db.ProjectAccess) error {
+	span := d.query("SetProjectAccess")
+	err := d.DB.SetProjectAccess(projectID, entries)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectAccess(projectID string) ([]*db.ProjectAccess, error) {
+	span := d.query("FindProjectAccess")
+	entries, err := d.DB.FindProjectAccess(projectID)
+	span.End(err)
+	return entries, err
+}
+
+func (d *DB) InsertProjectEvent(event *db.ProjectEvent) error {
+	span := d.query("InsertProjectEvent")
+	err := d.DB.InsertProjectEvent(event)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindProjectEventsForUser(userID string, limit int) ([]*db.ProjectEvent, error) {
+	span := d.query("FindProjectEventsForUser")
+	events, err := d.DB.FindProjectEventsForUser(userID, limit)
+	span.End(err)
+	return events, err
+}
+
+func (d *DB) AddAnalytics(day *db.AnalyticsDay) error {
+	span := d.query("AddAnalytics")
+	err := d.DB.AddAnalytics(day)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindAnalytics(userID, space, name string, since time.Time) ([]*db.AnalyticsDay, error) {
+	span := d.query("FindAnalytics")
+	days, err := d.DB.FindAnalytics(userID, space, name, since)
+	span.End(err)
+	return days, err
+}
+
+func (d *DB) AddBandwidth(month *db.BandwidthMonth) error {
+	span := d.query("AddBandwidth")
+	err := d.DB.AddBandwidth(month)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindBandwidth(userID, space string, month time.Time) ([]*db.BandwidthMonth, error) {
+	span := d.query("FindBandwidth")
+	months, err := d.DB.FindBandwidth(userID, space, month)
+	span.End(err)
+	return months, err
+}
+
+func (d *DB) SeedStorageUsage(userID string, used int64) error {
+	span := d.query("SeedStorageUsage")
+	err := d.DB.SeedStorageUsage(userID, used)
+	span.End(err)
+	return err
+}
+
+func (d *DB) ReserveStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	span := d.query("ReserveStorage")
+	id, err := d.DB.ReserveStorage(userID, projectName, size, max, expiresAt)
+	span.End(err)
+	return id, err
+}
+
+func (d *DB) ReserveProjectStorage(userID, projectName string, size, max int64, expiresAt time.Time) (string, error) {
+	span := d.query("ReserveProjectStorage")
+	id, err := d.DB.ReserveProjectStorage(userID, projectName, size, max, expiresAt)
+	span.End(err)
+	return id, err
+}
+
+func (d *DB) CommitStorage(userID, holdID string, delta int64) error {
+	span := d.query("CommitStorage")
+	err := d.DB.CommitStorage(userID, holdID, delta)
+	span.End(err)
+	return err
+}
+
+func (d *DB) ReleaseStorage(holdID string) error {
+	span := d.query("ReleaseStorage")
+	err := d.DB.ReleaseStorage(holdID)
+	span.End(err)
+	return err
+}
+
+func (d *DB) AddStorageUsage(userID string, delta int64) error {
+	span := d.query("AddStorageUsage")
+	err := d.DB.AddStorageUsage(userID, delta)
+	span.End(err)
+	return err
+}
+
+func (d *DB) SetStorageUsage(userID string, used int64) (bool, error) {
+	span := d.query("SetStorageUsage")
+	ok, err := d.DB.SetStorageUsage(userID, used)
+	span.End(err)
+	return ok, err
+}
+
+func (d *DB) FindStorageUsages() ([]*db.StorageUsage, error) {
+	span := d.query("FindStorageUsages")
+	usages, err := d.DB.FindStorageUsages()
+	span.End(err)
+	return usages, err
+}
+
+func (d *DB) RemoveExpiredStorageHolds() (int, error) {
+	span := d.query("RemoveExpiredStorageHolds")
+	count, err := d.DB.RemoveExpiredStorageHolds()
+	span.End(err)
+	return count, err
+}
+
+func (d *DB) UpsertObjectManifest(manifest *db.ObjectManifest) error {
+	span := d.query("UpsertObjectManifest")
+	err := d.DB.UpsertObjectManifest(manifest)
+	span.End(err)
+	return err
+}
+
+func (d *DB) FindObjectManifest(bucket, fpath string) (*db.ObjectManifest, error) {
+	span := d.query("FindObjectManifest")
+	manifest, err := d.DB.FindObjectManifest(bucket, fpath)
+	span.End(err)
+	return manifest, err
+}
+
+func (d *DB) FindObjectManifests(bucket, prefix string) ([]*db.ObjectManifest, error) {
+	span := d.query("FindObjectManifests")
+	manifests, err := d.DB.FindObjectManifests(bucket, prefix)
+	span.End(err)
+	return manifests, err
+}
+
+func (d *DB) RemoveObjectManifest(bucket, fpath string) error {
+	span := d.query("RemoveObjectManifest")
+	err := d.DB.RemoveObjectManifest(bucket, fpath)
+	span.End(err)
+	return err
+}
+
+func (d *DB) CountObjectManifestRefs(bucket, checksum string) (int, error) {
+	span := d.query("CountObjectManifestRefs")
+	count, err := d.DB.CountObjectManifestRefs(bucket, checksum)
+	span.End(err)
+	return count, err
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+type ctxSpanKey struct{}
+
+// FromContext is the span ctx belongs to, nil when it is not traced.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(ctxSpanKey{}).(*Span)
+	return span
+}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, ctxSpanKey{}, span)
+}
+
+// spanContext is the context of a session with its own current span,
+// values set on it are set on the session.
+type spanContext struct {
+	ssh.Context
+	span *Span
+}
+
+func (c *spanContext) Value(key interface{}) interface{} {
+	if key == (ctxSpanKey{}) {
+		return c.span
+	}
+	return c.Context.Value(key)
+}
+
+type spanSession struct {
+	ssh.Session
+	ctx *spanContext
+}
+
+func (s *spanSession) Context() ssh.Context {
+	return s.ctx
+}
+
+// Start begins a span below the current one of s and returns s with it
+// as its current span, so concurrent operations of one session each keep
+// their own. The session is returned as is when it is not traced.
+func Start(s ssh.Session, name string, attrs ...any) (ssh.Session, *Span) {
+	span := FromContext(s.Context()).Child(name, KindInternal, attrs...)
+	if span == nil {
+		return s, nil
+	}
+	return &spanSession{Session: s, ctx: &spanContext{Context: s.Context(), span: span}}, span
+}
+
+// Middleware starts a trace for every sampled session, put it last so it
+// runs first.
+func Middleware(tracer *Tracer) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			span := tracer.Root(
+				"ssh.session",
+				KindServer,
+				"ssh.user", s.User(),
+				"ssh.command", strings.Join(s.Command(), " "),
+				"net.peer.addr", s.RemoteAddr().String(),
+			)
+			if span == nil {
+				next(s)
+				return
+			}
+			s.Context().SetValue(ctxSpanKey{}, span)
+			next(s)
+			span.End(nil)
+		}
+	}
+}
+
+// Wrap records how long mw and everything it calls took as a span named
+// after it.
+func Wrap(name string, mw wish.Middleware) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		handler := mw(next)
+		return func(s ssh.Session) {
+			parent := FromContext(s.Context())
+			span := parent.Child("ssh.middleware "+name, KindInternal)
+			if span == nil {
+				handler(s)
+				return
+			}
+			s.Context().SetValue(ctxSpanKey{}, span)
+			handler(s)
+			s.Context().SetValue(ctxSpanKey{}, parent)
+			span.End(nil)
+		}
+	}
+}
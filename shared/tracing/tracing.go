@@ -0,0 +1,409 @@
+// Package tracing records where sessions spend their time as spans and
+// exports them to an OTLP collector over http in the json encoding.
+//
+// Every span is nil safe, a nil tracer hands out nil spans and a session
+// that was not sampled costs a nil check per call.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	mrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+var (
+	// MaxBatch is how many ended spans are sent in one request.
+	MaxBatch = 512
+	// MaxQueue is how many ended spans are kept while the collector is
+	// slow or away, spans past it are dropped.
+	MaxQueue = 4096
+	// ExportInterval is how often ended spans are sent.
+	ExportInterval = 5 * time.Second
+)
+
+type attribute struct {
+	key   string
+	value any
+}
+
+type Span struct {
+	tracer  *Tracer
+	traceID [16]byte
+	id      [8]byte
+	parent  [8]byte
+	name    string
+	kind    Kind
+	start   time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []attribute
+	err   error
+	ended bool
+}
+
+func (s *Span) setAttrs(kv []any) {
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		s.attrs = append(s.attrs, attribute{key: key, value: kv[i+1]})
+	}
+}
+
+// Child starts a span below s, attrs are key value pairs like slog's.
+func (s *Span) Child(name string, kind Kind, attrs ...any) *Span {
+	if s == nil {
+		return nil
+	}
+	child := &Span{
+		tracer:  s.tracer,
+		traceID: s.traceID,
+		id:      newSpanID(),
+		parent:  s.id,
+		name:    name,
+		kind:    kind,
+		start:   time.Now(),
+	}
+	child.setAttrs(attrs)
+	return child
+}
+
+func (s *Span) SetAttrs(attrs ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setAttrs(attrs)
+}
+
+// End hands s to the exporter, a span only ends once.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+	s.tracer.queue(s)
+}
+
+// TraceID is what operators search the collector for.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// Tracer batches ended spans and posts them to Endpoint.
+type Tracer struct {
+	Endpoint string
+	Service  string
+	Headers  map[string]string
+	// Ratio of sessions that are traced, 1 traces every one
+	Ratio  float64
+	Logger *slog.Logger
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []*Span
+	dropped int
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New exports to the OTLP/HTTP collector at endpoint, e.g.
+// `http://otel:4318`. It is nil, which traces nothing, when endpoint is
+// empty.
+func New(endpoint, service string, headers map[string]string, ratio float64, logger *slog.Logger) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	t := &Tracer{
+		Endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		Service:  service,
+		Headers:  headers,
+		Ratio:    ratio,
+		Logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// ParseHeaders reads `key=value,key=value` like OTEL_EXPORTER_OTLP_HEADERS.
+func ParseHeaders(raw string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// Root starts a trace, or returns nil when the trace is not sampled.
+func (t *Tracer) Root(name string, kind Kind, attrs ...any) *Span {
+	if t == nil || (t.Ratio < 1 && mrand.Float64() >= t.Ratio) {
+		return nil
+	}
+	span := &Span{
+		tracer: t,
+		id:     newSpanID(),
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+	_, _ = rand.Read(span.traceID[:])
+	span.setAttrs(attrs)
+	return span
+}
+
+func (t *Tracer) queue(span *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= MaxQueue {
+		t.dropped += 1
+		return
+	}
+	t.pending = append(t.pending, span)
+	if len(t.pending) >= MaxBatch {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(ExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.flush:
+		case <-t.stop:
+			t.export(context.Background())
+			return
+		}
+		t.export(context.Background())
+	}
+}
+
+// export sends everything that ended so far, a batch the collector did
+// not take is dropped.
+func (t *Tracer) export(ctx context.Context) {
+	for {
+		t.mu.Lock()
+		batch := t.pending[:min(len(t.pending), MaxBatch)]
+		t.pending = t.pending[len(batch):]
+		dropped := t.dropped
+		t.dropped = 0
+		t.mu.Unlock()
+
+		if dropped > 0 {
+			t.Logger.Error("dropped spans, the collector can't keep up", "spans", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		err := t.post(ctx, batch)
+		if err != nil {
+			t.Logger.Error("could not export spans", "endpoint", t.Endpoint, "spans", len(batch), "err", err.Error())
+		}
+	}
+}
+
+func (t *Tracer) post(ctx context.Context, batch []*Span) error {
+	body, err := json.Marshal(t.encode(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with (%d)", resp.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown sends what is left, spans that end afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// the OTLP json encoding of an ExportTraceServiceRequest, ids are hex and
+// 64 bit numbers are strings.
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func toValue(value any) otlpValue {
+	switch v := value.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case uint64:
+		s := strconv.FormatUint(v, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	case time.Duration:
+		s := v.String()
+		return otlpValue{StringValue: &s}
+	}
+	s := fmt.Sprint(value)
+	return otlpValue{StringValue: &s}
+}
+
+func toAttributes(attrs []attribute) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		out = append(out, otlpAttribute{Key: attr.key, Value: toValue(attr.value)})
+	}
+	return out
+}
+
+func (t *Tracer) encode(batch []*Span) *otlpRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "github.com/picosh/pico"
+	for _, span := range batch {
+		span.mu.Lock()
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(span.traceID[:]),
+			SpanID:            hex.EncodeToString(span.id[:]),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        toAttributes(span.attrs),
+		}
+		if span.parent != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(span.parent[:])
+		}
+		if span.err != nil {
+			out.Status = otlpStatus{Code: 2, Message: span.err.Error()}
+		}
+		span.mu.Unlock()
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = toAttributes([]attribute{{key: "service.name", value: t.Service}})
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
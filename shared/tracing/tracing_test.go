@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeContext struct {
+	context.Context
+	sync.Mutex
+	values map[interface{}]interface{}
+}
+
+func (c *fakeContext) Value(key interface{}) interface{} {
+	c.Lock()
+	defer c.Unlock()
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (c *fakeContext) SetValue(key, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[key] = value
+}
+
+func (c *fakeContext) User() string                  { return "test" }
+func (c *fakeContext) SessionID() string             { return "" }
+func (c *fakeContext) ClientVersion() string         { return "" }
+func (c *fakeContext) ServerVersion() string         { return "" }
+func (c *fakeContext) RemoteAddr() net.Addr          { return nil }
+func (c *fakeContext) LocalAddr() net.Addr           { return nil }
+func (c *fakeContext) Permissions() *ssh.Permissions { return nil }
+
+type fakeSession struct {
+	ssh.Session
+	ctx *fakeContext
+}
+
+func (s *fakeSession) Context() ssh.Context { return s.ctx }
+func (s *fakeSession) User() string         { return "test" }
+func (s *fakeSession) Command() []string    { return []string{"ls"} }
+func (s *fakeSession) RemoteAddr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{
+		ctx: &fakeContext{Context: context.Background(), values: map[interface{}]interface{}{}},
+	}
+}
+
+// collect starts a tracer exporting to a fake collector, spans are there
+// once it is shut down.
+func collect(t *testing.T) (*Tracer, func() []otlpSpan) {
+	var mu sync.Mutex
+	spans := []otlpSpan{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		req := otlpRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			if *rs.Resource.Attributes[0].Value.StringValue != "pgs" {
+				t.Errorf("expected the service name, got %+v", rs.Resource.Attributes)
+			}
+			for _, scope := range rs.ScopeSpans {
+				spans = append(spans, scope.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	headers := ParseHeaders("Authorization=Bearer secret, broken")
+	tracer := New(srv.URL+"/", "pgs", headers, 1, slog.Default())
+	return tracer, func() []otlpSpan {
+		err := tracer.Shutdown(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func TestExport(t *testing.T) {
+	tracer, spans := collect(t)
+	root := tracer.Root("ssh.session", KindServer, "ssh.user", "erock")
+	query := root.Child("db.FindUserForKey", KindClient, "db.operation", "FindUserForKey")
+	query.End(errors.New("no rows"))
+	query.End(nil)
+	root.End(nil)
+
+	got := spans()
+	if len(got) != 2 {
+		t.Fatalf("expected each span once, got %d", len(got))
+	}
+	if got[0].TraceID != root.TraceID() || got[1].TraceID != root.TraceID() {
+		t.Error("expected both spans in the trace of the root")
+	}
+	if got[0].ParentSpanID != got[1].SpanID || got[1].ParentSpanID != "" {
+		t.Errorf("expected the query below the session, got %+v", got)
+	}
+	if diff := cmp.Diff(otlpStatus{Code: 2, Message: "no rows"}, got[0].Status); diff != "" {
+		t.Error(diff)
+	}
+	if got[0].Kind != KindClient || *got[0].Attributes[0].Value.StringValue != "FindUserForKey" {
+		t.Errorf("unexpected query span %+v", got[0])
+	}
+}
+
+// TestDBTracesEveryQuery keeps DB in step with the db.DB interface, a
+// method it does not wrap would go to the database untraced.
+func TestDBTracesEveryQuery(t *testing.T) {
+	fset := token.NewFileSet()
+	wrapped := map[string]bool{}
+	f, err := parser.ParseFile(fset, "db.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+			wrapped[fn.Name.Name] = true
+		}
+	}
+
+	f, err = parser.ParseFile(fset, "../../db/db.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := f.Scope.Lookup("DB").Decl.(*ast.TypeSpec).Type.(*ast.InterfaceType)
+	for _, method := range iface.Methods.List {
+		name := method.Names[0].Name
+		if name != "Close" && !wrapped[name] {
+			t.Errorf("expected (%s) to be traced", name)
+		}
+	}
+}
+
+func TestNil(t *testing.T) {
+	if New("", "pgs", nil, 1, slog.Default()) != nil {
+		t.Error("expected no tracer without an endpoint")
+	}
+	var tracer *Tracer
+	span := tracer.Root("ssh.session", KindServer)
+	span.Child("db.query", KindClient).End(nil)
+	span.SetAttrs("key", "value")
+	span.End(nil)
+	if span.TraceID() != "" {
+		t.Error("expected an untraced session to have no trace id")
+	}
+	if NewDB(nil, nil) != nil {
+		t.Error("expected an untraced db to be the db itself")
+	}
+
+	tracer = &Tracer{Ratio: 0}
+	if tracer.Root("ssh.session", KindServer) != nil {
+		t.Error("expected nothing to be sampled")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tracer, spans := collect(t)
+	inner := Wrap("deploy", func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			traced, span := Start(s, "UploadAssetHandler.Write")
+			FromContext(traced.Context()).Child("storage.put", KindClient).End(nil)
+			span.End(nil)
+			next(s)
+		}
+	})
+	handler := Middleware(tracer)(inner(func(s ssh.Session) {
+		if FromContext(s.Context()).name != "ssh.middleware deploy" {
+			t.Error("expected the session to be back in the middleware's span")
+		}
+	}))
+
+	s := newFakeSession()
+	handler(s)
+	if FromContext(s.Context()).name != "ssh.session" {
+		t.Error("expected the session to be back in its own span")
+	}
+
+	names := map[string]string{}
+	ids := map[string]string{}
+	for _, span := range spans() {
+		ids[span.SpanID] = span.Name
+		names[span.Name] = span.ParentSpanID
+	}
+	expected := map[string]string{
+		"storage.put":              "UploadAssetHandler.Write",
+		"UploadAssetHandler.Write": "ssh.middleware deploy",
+		"ssh.middleware deploy":    "ssh.session",
+		"ssh.session":              "",
+	}
+	got := map[string]string{}
+	for name, parent := range names {
+		got[name] = ids[parent]
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,85 @@
+package trash
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+)
+
+// Dir is where deleted assets wait in a user's bucket, it can never be a
+// project name.
+var Dir = ".trash"
+
+// how many expired objects a single sweep claims at once.
+var claimLimit = 100
+
+// Path is where fpath is kept once it was deleted at deletedAt, the time
+// keeps every deletion of the same file apart.
+func Path(fpath string, deletedAt time.Time) string {
+	return filepath.Join(Dir, strconv.FormatInt(deletedAt.UnixNano(), 10), strings.TrimPrefix(fpath, "/"))
+}
+
+// Sweep purges the trash whose retention has passed, the space it took
+// counts against the quota of its user until then. It keeps going until
+// nothing expired is left.
+func Sweep(dbpool db.DB, st storage.StorageServe, logger *slog.Logger) (int, error) {
+	purged := 0
+	for {
+		objs, err := dbpool.ClaimExpiredTrash(claimLimit)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, obj := range objs {
+			// no bucket or object means there is nothing left to purge, a
+			// failed purge is claimed again once the claim lapses
+			bucket, err := st.GetBucket(shared.GetAssetBucketName(obj.UserID))
+			if err == nil {
+				if _, sizeErr := st.GetObjectSize(bucket, obj.TrashPath); sizeErr == nil {
+					err = st.DeleteObject(bucket, obj.TrashPath)
+					if err != nil {
+						logger.Error("could not purge trash", "userID", obj.UserID, "path", obj.TrashPath, "err", err.Error())
+						continue
+					}
+				}
+			}
+
+			err = dbpool.RemoveTrashObject(obj.ID)
+			if err != nil {
+				logger.Error("could not remove trash", "userID", obj.UserID, "path", obj.TrashPath, "err", err.Error())
+				continue
+			}
+
+			logger.Info(
+				"purged trash",
+				"userID", obj.UserID,
+				"path", obj.Path,
+				"size", shared.HumanSize(obj.Size),
+			)
+			purged += 1
+		}
+
+		if len(objs) < claimLimit {
+			return purged, nil
+		}
+	}
+}
+
+// Run purges expired trash every interval, it never returns.
+func Run(dbpool db.DB, st storage.StorageServe, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := Sweep(dbpool, st, logger)
+		if err != nil {
+			logger.Error("could not sweep trash", "err", err.Error())
+		}
+	}
+}
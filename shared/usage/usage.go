@@ -0,0 +1,77 @@
+// Package usage keeps the storage usage uploads account for in the
+// database in step with what the asset buckets actually take up.
+package usage
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+)
+
+// Reconcile replaces the usage of every user with the size of their asset
+// bucket, it catches what drifted through changes that don't account for
+// themselves, e.g. trash being purged, or a process that died mid upload.
+// Users with an upload running are left for the next run. It returns how
+// many usages were off.
+func Reconcile(dbpool db.DB, st storage.StorageServe, logger *slog.Logger) (int, error) {
+	removed, err := dbpool.RemoveExpiredStorageHolds()
+	if err != nil {
+		return 0, err
+	}
+	if removed > 0 {
+		logger.Info("removed lapsed storage holds", "count", removed)
+	}
+
+	usages, err := dbpool.FindStorageUsages()
+	if err != nil {
+		return 0, err
+	}
+
+	drifted := 0
+	for _, usage := range usages {
+		bucket, err := st.GetBucket(shared.GetAssetBucketName(usage.UserID))
+		if err != nil {
+			continue
+		}
+		stats, err := st.GetBucketStats(bucket)
+		if err != nil {
+			logger.Error("could not find bucket size", "userID", usage.UserID, "err", err.Error())
+			continue
+		}
+
+		size := int64(stats.TotalSize)
+		set, err := dbpool.SetStorageUsage(usage.UserID, size)
+		if err != nil {
+			logger.Error("could not reconcile storage usage", "userID", usage.UserID, "err", err.Error())
+			continue
+		}
+		if set && size != usage.Used {
+			logger.Info(
+				"storage usage drifted",
+				"userID", usage.UserID,
+				"recorded", usage.Used,
+				"stored", size,
+			)
+			drifted += 1
+		}
+	}
+	return drifted, nil
+}
+
+// Run reconciles the usage every interval, it never returns.
+func Run(dbpool db.DB, st storage.StorageServe, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		drifted, err := Reconcile(dbpool, st, logger)
+		if err != nil {
+			logger.Error("could not reconcile storage usage", "err", err.Error())
+			continue
+		}
+		logger.Info("reconciled storage usage", "drifted", drifted)
+	}
+}
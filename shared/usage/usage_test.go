@@ -0,0 +1,79 @@
+package usage
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+type usageDB struct {
+	db.DB
+	usages []*db.StorageUsage
+	set    map[string]int64
+}
+
+func (f *usageDB) RemoveExpiredStorageHolds() (int, error) {
+	return 0, nil
+}
+
+func (f *usageDB) FindStorageUsages() ([]*db.StorageUsage, error) {
+	return f.usages, nil
+}
+
+func (f *usageDB) SetStorageUsage(userID string, used int64) (bool, error) {
+	for _, usage := range f.usages {
+		if usage.UserID == userID && usage.Held > 0 {
+			return false, nil
+		}
+	}
+	f.set[userID] = used
+	return true, nil
+}
+
+func TestReconcile(t *testing.T) {
+	st, err := storage.NewStorageFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []string{"1", "2", "3"} {
+		bucket, err := st.UpsertBucket(shared.GetAssetBucketName(userID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = st.PutObject(bucket, "blog/index.html", utils.NopReaderAtCloser(strings.NewReader("hello")), &utils.FileEntry{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbpool := &usageDB{
+		usages: []*db.StorageUsage{
+			{UserID: "1", Used: 5},
+			{UserID: "2", Used: 100},
+			{UserID: "3", Used: 100, Held: 10},
+			{UserID: "4", Used: 7},
+		},
+		set: map[string]int64{},
+	}
+	drifted, err := Reconcile(dbpool, st, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drifted != 1 {
+		t.Errorf("expected one usage to have drifted, found (%d)", drifted)
+	}
+	if dbpool.set["2"] != 5 {
+		t.Errorf("expected the usage to be replaced with the bucket size, found %v", dbpool.set)
+	}
+	if _, ok := dbpool.set["3"]; ok {
+		t.Error("expected usage with space held to be left alone")
+	}
+	if _, ok := dbpool.set["4"]; ok {
+		t.Error("expected usage without a bucket to be left alone")
+	}
+}
@@ -15,8 +15,6 @@ import (
 	"unicode"
 	"unicode/utf8"
 
-	"slices"
-
 	"github.com/charmbracelet/ssh"
 )
 
@@ -94,9 +92,34 @@ func IsText(s string) bool {
 	return true
 }
 
+// SplitList splits a comma separated env var, dropping empty items.
+func SplitList(items string) []string {
+	list := []string{}
+	for _, item := range strings.Split(items, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// IsExtAllowed matches case-insensitively, an empty list allows everything.
 func IsExtAllowed(filename string, allowedExt []string) bool {
-	ext := pathpkg.Ext(filename)
-	return slices.Contains(allowedExt, ext)
+	if len(allowedExt) == 0 {
+		return true
+	}
+	return IsExtInList(filename, allowedExt)
+}
+
+func IsExtInList(filename string, exts []string) bool {
+	ext := strings.ToLower(pathpkg.Ext(filename))
+	for _, e := range exts {
+		if strings.ToLower(e) == ext {
+			return true
+		}
+	}
+	return false
 }
 
 // IsTextFile reports whether the file has a known extension indicating
@@ -147,3 +170,22 @@ func Shasum(data []byte) string {
 func BytesToGB(size int) float32 {
 	return (((float32(size) / 1024) / 1024) / 1024)
 }
+
+// HumanSize formats bytes the way `ls -h` does, e.g. 1.2K or 3.4M.
+func HumanSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d", size)
+	}
+
+	value := float64(size)
+	for _, unit := range []string{"K", "M", "G", "T"} {
+		value = value / 1024
+		if value < 1024 || unit == "T" {
+			if value < 10 {
+				return fmt.Sprintf("%.1f%s", value, unit)
+			}
+			return fmt.Sprintf("%.0f%s", value, unit)
+		}
+	}
+	return fmt.Sprintf("%d", size)
+}
@@ -0,0 +1,25 @@
+package shared
+
+import "testing"
+
+func TestHumanSize(t *testing.T) {
+	fixtures := []struct {
+		size   int64
+		expect string
+	}{
+		{size: 0, expect: "0"},
+		{size: 1023, expect: "1023"},
+		{size: 1024, expect: "1.0K"},
+		{size: 1536, expect: "1.5K"},
+		{size: 20 * 1024, expect: "20K"},
+		{size: 3 * 1024 * 1024, expect: "3.0M"},
+		{size: 5 * 1024 * 1024 * 1024, expect: "5.0G"},
+		{size: 2048 * 1024 * 1024 * 1024 * 1024, expect: "2048T"},
+	}
+	for _, fixture := range fixtures {
+		actual := HumanSize(fixture.size)
+		if actual != fixture.expect {
+			t.Errorf("HumanSize(%d) = %q, expected %q", fixture.size, actual, fixture.expect)
+		}
+	}
+}
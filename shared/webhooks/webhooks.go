@@ -0,0 +1,242 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/bus"
+)
+
+// SignatureHeader carries `sha256=` followed by the hex encoded HMAC-SHA256
+// of the request body, keyed with the secret shown when the webhook was
+// added.
+const SignatureHeader = "X-Pico-Signature"
+
+// EventHeader repeats the event of the payload so receivers can route
+// without parsing the body.
+const EventHeader = "X-Pico-Event"
+
+const (
+	ProjectCreate = bus.ProjectCreate
+	ProjectUpdate = bus.ProjectUpdate
+	ProjectDelete = bus.ProjectDelete
+)
+
+// MaxPerUser is how many webhooks a single user can register.
+var MaxPerUser = 5
+
+var errBlockedAddress = errors.New("webhook address is not public")
+
+// Payload is the json body sent for every event.
+type Payload struct {
+	Event   string    `json:"event"`
+	User    string    `json:"user"`
+	Project string    `json:"project"`
+	Time    time.Time `json:"time"`
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ValidateURL only accepts absolute http and https urls.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("(%s) is not a valid url", raw)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("(%s) must be an http or https url", raw)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("(%s) has no host", raw)
+	}
+	return nil
+}
+
+// publicOnly refuses to connect to loopback, private and link local
+// addresses so a webhook can't be pointed at our own network. It runs
+// after the name is resolved which also covers names that resolve there.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// Sender delivers events to the webhooks of a user, requests that fail
+// with a network error or a 429 or 5xx response are retried with
+// exponential backoff.
+type Sender struct {
+	dbpool     db.DB
+	logger     *slog.Logger
+	client     *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+	sleep      func(d time.Duration)
+	pending    shared.Inflight
+}
+
+func NewSender(dbpool db.DB, logger *slog.Logger, maxRetries int, baseDelay time.Duration) *Sender {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}
+	return &Sender{
+		dbpool: dbpool,
+		logger: logger,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Proxy:       nil,
+				DialContext: dialer.DialContext,
+			},
+			// a redirect could point anywhere, receivers get one url
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxRetries: maxRetries,
+		baseDelay:  baseDelay,
+		sleep:      time.Sleep,
+	}
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("webhook responded with (%d)", e.code)
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, errBlockedAddress) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	return err != nil
+}
+
+func (s *Sender) post(hook *db.Webhook, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// Deliver posts body to a single webhook, retrying transient failures.
+func (s *Sender) Deliver(hook *db.Webhook, event string, body []byte) error {
+	err := s.post(hook, event, body)
+	for attempt := 0; attempt < s.maxRetries && isRetryable(err); attempt += 1 {
+		s.sleep(s.baseDelay * time.Duration(1<<attempt))
+		err = s.post(hook, event, body)
+	}
+	return err
+}
+
+// Send delivers event for project to every webhook of user, failures are
+// only logged.
+func (s *Sender) Send(user *db.User, event, project string) {
+	hooks, err := s.dbpool.FindWebhooksForUser(user.ID)
+	if err != nil {
+		s.logger.Error("could not find webhooks", "user", user.Name, "err", err.Error())
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Payload{
+		Event:   event,
+		User:    user.Name,
+		Project: project,
+		Time:    time.Now().UTC(),
+	})
+	if err != nil {
+		s.logger.Error("could not encode webhook payload", "err", err.Error())
+		return
+	}
+
+	for _, hook := range hooks {
+		err := s.Deliver(hook, event, body)
+		if err != nil {
+			s.logger.Error(
+				"could not deliver webhook",
+				"user", user.Name,
+				"url", hook.URL,
+				"event", event,
+				"project", project,
+				"err", err.Error(),
+			)
+		}
+	}
+}
+
+// Notify is Send without blocking the caller.
+func (s *Sender) Notify(user *db.User, event, project string) {
+	s.pending.Go(func() {
+		s.Send(user, event, project)
+	})
+}
+
+// Subscribe delivers the project events published on b, each one once
+// among the senders on the bus.
+func (s *Sender) Subscribe(b bus.Bus) {
+	for _, topic := range []string{ProjectCreate, ProjectUpdate, ProjectDelete} {
+		b.Subscribe(topic, "webhooks", func(ev *bus.Event) {
+			s.Notify(&db.User{ID: ev.UserID, Name: ev.User}, ev.Topic, ev.Project)
+		})
+	}
+}
+
+// Wait blocks until every delivery started by Notify finished or ctx is
+// done.
+func (s *Sender) Wait(ctx context.Context) error {
+	return s.pending.Drain(ctx)
+}
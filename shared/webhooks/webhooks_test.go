@@ -0,0 +1,79 @@
+package webhooks
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/picosh/pico/db"
+)
+
+func TestDeliver(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		attempts[r.URL.Path] += 1
+		count := attempts[r.URL.Path]
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/flaky" && count < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	delays := []time.Duration{}
+	sender := NewSender(nil, slog.Default(), 3, time.Second)
+	sender.client = srv.Client()
+	sender.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	fixtures := []struct {
+		path     string
+		fails    bool
+		attempts int
+	}{
+		{path: "/ok", attempts: 1},
+		{path: "/flaky", attempts: 3},
+		{path: "/gone", fails: true, attempts: 1},
+	}
+	for _, fixture := range fixtures {
+		hook := &db.Webhook{URL: srv.URL + fixture.path, Secret: "secret"}
+		err := sender.Deliver(hook, ProjectUpdate, []byte(`{"event":"project.update"}`))
+		if (err != nil) != fixture.fails {
+			t.Fatalf("%s: unexpected error %v", fixture.path, err)
+		}
+		if attempts[fixture.path] != fixture.attempts {
+			t.Fatalf("%s: expected (%d) attempts, got (%d)", fixture.path, fixture.attempts, attempts[fixture.path])
+		}
+	}
+
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Fatalf("expected exponential backoff, got %v", delays)
+	}
+
+	err := publicOnly("tcp", "127.0.0.1:80", nil)
+	if err == nil {
+		t.Fatal("expected loopback address to be refused")
+	}
+	for _, raw := range []string{"ftp://example.com", "/hook", "https://"} {
+		if ValidateURL(raw) == nil {
+			t.Fatalf("expected (%s) to be rejected", raw)
+		}
+	}
+}
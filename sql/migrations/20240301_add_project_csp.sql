@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN csp jsonb NOT NULL DEFAULT '{"policy":"","report_only":false,"report_uri":""}'::jsonb;
@@ -0,0 +1,6 @@
+ALTER TABLE app_users ADD COLUMN suspended_at timestamp without time zone;
+ALTER TABLE app_users ADD COLUMN suspended_by uuid;
+ALTER TABLE app_users ADD CONSTRAINT fk_app_users_suspended_by
+    FOREIGN KEY(suspended_by)
+  REFERENCES app_users(id)
+  ON DELETE SET NULL;
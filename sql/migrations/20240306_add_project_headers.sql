@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS project_headers (
+  project_id uuid NOT NULL,
+  rules jsonb NOT NULL DEFAULT '[]'::jsonb,
+  updated_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_headers_pkey PRIMARY KEY (project_id),
+  CONSTRAINT fk_project_headers_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
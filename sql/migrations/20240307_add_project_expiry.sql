@@ -0,0 +1,3 @@
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS expires_at timestamp without time zone;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS expire_claimed_at timestamp without time zone;
+CREATE INDEX IF NOT EXISTS projects_expires_at_idx ON projects (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,13 @@
+-- name is the feature flag that grants the plan, service is the feature
+-- the limits apply to: "pgs", "prose", "imgs"
+CREATE TABLE IF NOT EXISTS quota_plans (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  name character varying(50) NOT NULL,
+  service character varying(50) NOT NULL,
+  storage_max bigint NOT NULL DEFAULT 0,
+  file_max bigint NOT NULL DEFAULT 0,
+  file_count_max integer NOT NULL DEFAULT 0,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT quota_plans_unique_name UNIQUE (name, service),
+  CONSTRAINT quota_plans_pkey PRIMARY KEY (id)
+);
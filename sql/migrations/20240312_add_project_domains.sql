@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS project_domains (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  project_id uuid NOT NULL,
+  domain character varying(255) NOT NULL,
+  token uuid NOT NULL DEFAULT uuid_generate_v4(),
+  verified_at timestamp without time zone,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_domains_unique_domain UNIQUE (domain),
+  CONSTRAINT project_domains_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_project_domains_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
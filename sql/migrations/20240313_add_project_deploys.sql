@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS project_deploys (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  project_id uuid NOT NULL,
+  revision integer NOT NULL,
+  current boolean NOT NULL DEFAULT false,
+  file_count integer NOT NULL DEFAULT 0,
+  size bigint NOT NULL DEFAULT 0,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_deploys_unique_revision UNIQUE (project_id, revision),
+  CONSTRAINT project_deploys_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_project_deploys_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS project_deploys_current_idx
+  ON project_deploys (project_id) WHERE current;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS object_manifests (
+  bucket character varying(255) NOT NULL,
+  path text NOT NULL,
+  checksum character varying(64) NOT NULL,
+  size bigint NOT NULL DEFAULT 0,
+  meta jsonb NOT NULL DEFAULT '{}'::jsonb,
+  updated_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT object_manifests_pkey PRIMARY KEY (bucket, path)
+);
+
+CREATE INDEX IF NOT EXISTS object_manifests_checksum_idx
+  ON object_manifests (bucket, checksum);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  user_id uuid NOT NULL,
+  url text NOT NULL,
+  secret character varying(64) NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT webhooks_unique_url UNIQUE (user_id, url),
+  CONSTRAINT webhooks_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_webhooks_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
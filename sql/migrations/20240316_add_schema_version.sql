@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS schema_version (
+  version character varying(255) NOT NULL,
+  applied_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT schema_version_pkey PRIMARY KEY (version)
+);
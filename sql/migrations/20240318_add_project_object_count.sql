@@ -0,0 +1,3 @@
+-- object_count is kept up to date by uploads and deletes, NULL means the
+-- project has not been counted yet and is walked on the next upload
+ALTER TABLE projects ADD COLUMN object_count integer;
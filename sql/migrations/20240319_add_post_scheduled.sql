@@ -0,0 +1,5 @@
+-- scheduled posts stay out of listings and feeds until the publish worker
+-- flips them once their publish_at has passed
+ALTER TABLE posts ADD COLUMN scheduled boolean NOT NULL DEFAULT FALSE;
+UPDATE posts SET scheduled = TRUE WHERE publish_at > now();
+CREATE INDEX posts_scheduled_idx ON posts (publish_at) WHERE scheduled = TRUE;
@@ -0,0 +1,8 @@
+-- full-text search over a user's posts, weighted so a match in the title
+-- ranks above one in the body
+ALTER TABLE posts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+  setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+  setweight(to_tsvector('english', coalesce(text, '')), 'C')
+) STORED;
+CREATE INDEX posts_search_idx ON posts USING GIN (search_vector);
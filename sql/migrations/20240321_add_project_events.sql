@@ -0,0 +1,16 @@
+-- every create, update and delete of a project, they are what the deploy
+-- feed of a user lists
+CREATE TABLE IF NOT EXISTS project_events (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  user_id uuid NOT NULL,
+  project_name character varying(255) NOT NULL,
+  event character varying(50) NOT NULL,
+  file_count integer NOT NULL DEFAULT 0,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_events_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_project_events_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX project_events_user_idx ON project_events (user_id, created_at DESC);
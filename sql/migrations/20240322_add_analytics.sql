@@ -0,0 +1,15 @@
+-- daily hit counts of projects and posts, uniques are counted from salted
+-- hashes that only live in memory so no visitor address is stored
+CREATE TABLE IF NOT EXISTS analytics_daily (
+  user_id uuid NOT NULL,
+  space character varying(50) NOT NULL,
+  name character varying(255) NOT NULL,
+  day date NOT NULL,
+  hits integer NOT NULL DEFAULT 0,
+  uniques integer NOT NULL DEFAULT 0,
+  CONSTRAINT analytics_daily_pkey PRIMARY KEY (user_id, space, name, day),
+  CONSTRAINT fk_analytics_daily_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+-- ways into a private project over http, a bcrypt hashed password or the
+-- name of a pico user who signs in with one of their api tokens
+CREATE TABLE IF NOT EXISTS project_acls (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  project_id uuid NOT NULL,
+  kind character varying(50) NOT NULL,
+  value text NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_acls_pkey PRIMARY KEY (id),
+  CONSTRAINT project_acls_unique UNIQUE (project_id, kind, value),
+  CONSTRAINT fk_project_acls_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,30 @@
+-- organizations are accounts without keys of their own, their members
+-- deploy to the org's projects according to their role
+CREATE TABLE IF NOT EXISTS orgs (
+  id uuid NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT orgs_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_orgs_app_users
+    FOREIGN KEY(id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  org_id uuid NOT NULL,
+  user_id uuid NOT NULL,
+  role character varying(50) NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT org_members_pkey PRIMARY KEY (id),
+  CONSTRAINT org_members_unique UNIQUE (org_id, user_id),
+  CONSTRAINT fk_org_members_orgs
+    FOREIGN KEY(org_id)
+  REFERENCES orgs(id)
+  ON DELETE CASCADE,
+  CONSTRAINT fk_org_members_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX org_members_user_idx ON org_members (user_id);
@@ -0,0 +1,25 @@
+-- every change made to an account, it outlives the users it names so
+-- there are no foreign keys and rows can never be changed or removed
+CREATE TABLE IF NOT EXISTS audit_log (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  user_id uuid NOT NULL,
+  actor_id uuid NOT NULL,
+  actor character varying(255) NOT NULL,
+  space character varying(255) NOT NULL,
+  action character varying(50) NOT NULL,
+  session_id character varying(255) NOT NULL DEFAULT '',
+  path text NOT NULL DEFAULT '',
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT audit_log_pkey PRIMARY KEY (id)
+);
+CREATE INDEX audit_log_user_idx ON audit_log (user_id, created_at DESC);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+  BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,19 @@
+-- deleted assets kept below trash_path in the user's bucket until they
+-- expire so they can be restored
+CREATE TABLE IF NOT EXISTS trash_objects (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  user_id uuid NOT NULL,
+  path text NOT NULL,
+  trash_path text NOT NULL,
+  size bigint NOT NULL DEFAULT 0,
+  expires_at timestamp without time zone NOT NULL,
+  purge_claimed_at timestamp without time zone,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT trash_objects_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_trash_objects_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX trash_objects_user_idx ON trash_objects (user_id, path);
+CREATE INDEX trash_objects_expires_idx ON trash_objects (expires_at);
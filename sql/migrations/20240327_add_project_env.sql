@@ -0,0 +1,16 @@
+-- variables substituted into a project's files when they are uploaded,
+-- values are encrypted before they are stored
+CREATE TABLE IF NOT EXISTS project_env (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  project_id uuid NOT NULL,
+  key varchar(255) NOT NULL,
+  value text NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_env_pkey PRIMARY KEY (id),
+  CONSTRAINT project_env_unique_key UNIQUE (project_id, key),
+  CONSTRAINT fk_project_env_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+-- tls certificates issued for verified project domains, private keys are
+-- encrypted before they are stored
+CREATE TABLE IF NOT EXISTS domain_certs (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  domain varchar(255) NOT NULL,
+  cert_pem text NOT NULL,
+  key_pem text NOT NULL,
+  expires_at timestamp without time zone NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT domain_certs_pkey PRIMARY KEY (id),
+  CONSTRAINT domain_certs_unique_domain UNIQUE (domain),
+  CONSTRAINT fk_domain_certs_project_domains
+    FOREIGN KEY(domain)
+  REFERENCES project_domains(domain)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- bytes served per project and calendar month, `month` is its first day
+CREATE TABLE IF NOT EXISTS bandwidth_monthly (
+  user_id uuid NOT NULL,
+  space character varying(50) NOT NULL,
+  name character varying(255) NOT NULL,
+  month date NOT NULL,
+  bytes bigint NOT NULL DEFAULT 0,
+  CONSTRAINT bandwidth_monthly_pkey PRIMARY KEY (user_id, space, name, month),
+  CONSTRAINT fk_bandwidth_monthly_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE app_users ADD COLUMN read_only_at timestamp without time zone;
+ALTER TABLE app_users ADD COLUMN read_only_by uuid;
+ALTER TABLE app_users ADD CONSTRAINT fk_app_users_read_only_by
+    FOREIGN KEY(read_only_by)
+  REFERENCES app_users(id)
+  ON DELETE SET NULL;
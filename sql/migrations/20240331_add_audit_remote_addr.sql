@@ -0,0 +1,2 @@
+-- where the change came from, empty for changes made before it was kept
+ALTER TABLE audit_log ADD COLUMN remote_addr character varying(255) NOT NULL DEFAULT '';
@@ -0,0 +1,27 @@
+-- bytes stored in the asset bucket of a user as uploads account for them,
+-- compared against storage every now and then to catch what drifted
+CREATE TABLE IF NOT EXISTS storage_usage (
+  user_id uuid NOT NULL,
+  used bigint NOT NULL DEFAULT 0,
+  reconciled_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT storage_usage_pkey PRIMARY KEY (user_id),
+  CONSTRAINT fk_storage_usage_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+
+-- space held by uploads still being stored, the holds of a process that
+-- died lapse at `expires_at`
+CREATE TABLE IF NOT EXISTS storage_holds (
+  id uuid NOT NULL DEFAULT uuid_generate_v4(),
+  user_id uuid NOT NULL,
+  size bigint NOT NULL,
+  expires_at timestamp without time zone NOT NULL,
+  CONSTRAINT storage_holds_pkey PRIMARY KEY (id),
+  CONSTRAINT fk_storage_holds_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
+CREATE INDEX storage_holds_user_idx ON storage_holds (user_id);
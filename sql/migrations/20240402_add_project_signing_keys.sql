@@ -0,0 +1,12 @@
+-- the minisign or gpg public key a project's deploys must be signed with,
+-- projects without one accept unsigned deploys
+CREATE TABLE IF NOT EXISTS project_signing_keys (
+  project_id uuid NOT NULL,
+  key text NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_signing_keys_pkey PRIMARY KEY (project_id),
+  CONSTRAINT fk_project_signing_keys_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
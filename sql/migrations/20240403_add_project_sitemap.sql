@@ -0,0 +1,2 @@
+-- generate sitemap.xml and robots.txt on every deploy of the project
+ALTER TABLE projects ADD COLUMN sitemap boolean NOT NULL DEFAULT false;
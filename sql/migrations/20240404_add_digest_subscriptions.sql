@@ -0,0 +1,14 @@
+-- the token in every feed digest that unsubscribes its user from all of
+-- them, unsubscribed_at is set once they did
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+  user_id uuid NOT NULL,
+  token uuid NOT NULL DEFAULT uuid_generate_v4(),
+  unsubscribed_at timestamp without time zone,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT digest_subscriptions_pkey PRIMARY KEY (user_id),
+  CONSTRAINT unique_digest_subscriptions_token UNIQUE (token),
+  CONSTRAINT fk_digest_subscriptions_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+-- the addresses a user accepts emails from as new posts, every space
+-- shares them
+CREATE TABLE IF NOT EXISTS post_email_senders (
+  user_id uuid NOT NULL,
+  email varchar(255) NOT NULL,
+  created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT post_email_senders_pkey PRIMARY KEY (user_id, email),
+  CONSTRAINT fk_post_email_senders_app_users
+    FOREIGN KEY(user_id)
+  REFERENCES app_users(id)
+  ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- what a token can authenticate, the empty scope covers feeds and the
+-- api, deploy tokens only upload
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS scope varchar(32) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- the parsed rules of a project's `_redirects`, kept like `_headers`
+CREATE TABLE IF NOT EXISTS project_redirects (
+  project_id uuid NOT NULL,
+  rules jsonb NOT NULL DEFAULT '[]'::jsonb,
+  updated_at timestamp without time zone NOT NULL DEFAULT NOW(),
+  CONSTRAINT project_redirects_pkey PRIMARY KEY (project_id),
+  CONSTRAINT fk_project_redirects_projects
+    FOREIGN KEY(project_id)
+  REFERENCES projects(id)
+  ON DELETE CASCADE
+);
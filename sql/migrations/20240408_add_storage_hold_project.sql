@@ -0,0 +1,3 @@
+-- holds made by `reserve` for an upcoming deploy name their project, the
+-- holds of running uploads have none
+ALTER TABLE storage_holds ADD COLUMN IF NOT EXISTS project_name varchar(255) NOT NULL DEFAULT '';
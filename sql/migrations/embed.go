@@ -0,0 +1,8 @@
+// Package migrations embeds the schema migrations so every binary can
+// bring the database up to date, files are applied in name order.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
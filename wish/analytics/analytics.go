@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/analytics"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/send/send/utils"
+)
+
+var usage = "usage: analytics [project|post]"
+
+func formatTable(rows [][]string) string {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, col := range row {
+			widths[i] = max(widths[i], len(col))
+		}
+	}
+	lines := []string{}
+	for _, row := range rows {
+		cols := []string{}
+		for i, col := range row {
+			cols = append(cols, fmt.Sprintf("%-*s", widths[i], col))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cols, "  "), " "))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// formatAnalytics lists the totals of every name, or the days of a single
+// one when name is set.
+func formatAnalytics(days []*db.AnalyticsDay, name string, since time.Time) string {
+	header := fmt.Sprintf("since %s", since.Format(time.DateOnly))
+	if len(days) == 0 {
+		return header + "\r\nno visits found"
+	}
+
+	if name == "" {
+		rows := [][]string{{"NAME", "HITS", "UNIQUES"}}
+		for _, total := range analytics.Totals(days) {
+			rows = append(rows, []string{total.Name, fmt.Sprint(total.Hits), fmt.Sprint(total.Uniques)})
+		}
+		return header + "\r\n" + formatTable(rows)
+	}
+
+	rows := [][]string{{"DAY", "HITS", "UNIQUES"}}
+	for _, day := range days {
+		rows = append(rows, []string{day.Day.Format(time.DateOnly), fmt.Sprint(day.Hits), fmt.Sprint(day.Uniques)})
+	}
+	return fmt.Sprintf("%s for %s\r\n%s", header, name, formatTable(rows))
+}
+
+func report(session ssh.Session, dbpool db.DB, cfg *shared.ConfigSite) error {
+	args := session.Command()[2:]
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments, %s", usage)
+	}
+	name := ""
+	if len(args) == 1 {
+		name = args[0]
+	}
+	user, err := futil.GetUser(session)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-shared.AnalyticsDays)
+	days, err := dbpool.FindAnalytics(user.ID, cfg.Space, name, since)
+	if err != nil {
+		return err
+	}
+	_, err = session.Write([]byte(formatAnalytics(days, name, since) + "\r\n"))
+	return err
+}
+
+// Middleware handles `command analytics [project|post]`, the daily hits
+// of the user's projects or posts.
+func Middleware(dbpool db.DB, cfg *shared.ConfigSite) wish.Middleware {
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "analytics") {
+				sshHandler(session)
+				return
+			}
+
+			start := time.Now()
+			err := report(session, dbpool, cfg)
+			metrics.ObserveCommand("analytics", start, err)
+			if err != nil {
+				utils.ErrorHandler(session, err)
+			}
+		}
+	}
+}
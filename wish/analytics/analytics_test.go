@@ -0,0 +1,40 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+func TestFormatAnalytics(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	next := since.AddDate(0, 0, 1)
+	days := []*db.AnalyticsDay{
+		{Name: "blog", Day: since, Hits: 12, Uniques: 4},
+		{Name: "docs", Day: since, Hits: 100, Uniques: 30},
+		{Name: "blog", Day: next, Hits: 3, Uniques: 1},
+	}
+
+	expected := "since 2024-03-01\r\n" +
+		"NAME  HITS  UNIQUES\r\n" +
+		"docs  100   30\r\n" +
+		"blog  15    5"
+	if diff := cmp.Diff(expected, formatAnalytics(days, "", since)); diff != "" {
+		t.Error(diff)
+	}
+
+	expected = "since 2024-03-01 for blog\r\n" +
+		"DAY         HITS  UNIQUES\r\n" +
+		"2024-03-01  12    4\r\n" +
+		"2024-03-02  3     1"
+	if diff := cmp.Diff(expected, formatAnalytics([]*db.AnalyticsDay{days[0], days[2]}, "blog", since)); diff != "" {
+		t.Error(diff)
+	}
+
+	expected = "since 2024-03-01\r\nno visits found"
+	if diff := cmp.Diff(expected, formatAnalytics(nil, "", since)); diff != "" {
+		t.Error(diff)
+	}
+}
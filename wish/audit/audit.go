@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared/audit"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/send/send/utils"
+)
+
+var usage = "usage: audit [--since 24h|2006-01-02]"
+
+// how far back `audit` looks without --since.
+var defaultSince = 7 * 24 * time.Hour
+
+func formatTable(rows [][]string) string {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, col := range row {
+			widths[i] = max(widths[i], len(col))
+		}
+	}
+	lines := []string{}
+	for _, row := range rows {
+		cols := []string{}
+		for i, col := range row {
+			cols = append(cols, fmt.Sprintf("%-*s", widths[i], col))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cols, "  "), " "))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// parseSince accepts a duration back from now or a date.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		var days int
+		_, err := fmt.Sscanf(value, "%dd", &days)
+		if err == nil && days > 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	dur, err := time.ParseDuration(value)
+	if err == nil && dur > 0 {
+		return now.Add(-dur), nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since (%s), %s", value, usage)
+}
+
+func formatAudit(entries []*db.AuditEntry, since time.Time) string {
+	header := fmt.Sprintf("since %s", since.Format(time.DateTime))
+	if len(entries) == 0 {
+		return header + "\r\nno changes found"
+	}
+
+	rows := [][]string{{"TIME", "ACTOR", "SPACE", "ACTION", "PATH", "SESSION", "SOURCE"}}
+	for _, entry := range entries {
+		created := ""
+		if entry.CreatedAt != nil {
+			created = entry.CreatedAt.UTC().Format(time.DateTime)
+		}
+		session := entry.SessionID
+		if len(session) > 8 {
+			session = session[:8]
+		}
+		rows = append(rows, []string{created, entry.Actor, entry.Space, entry.Action, entry.Path, session, entry.RemoteAddr})
+	}
+	return header + "\r\n" + formatTable(rows)
+}
+
+func report(session ssh.Session, dbpool db.DB) error {
+	args := session.Command()[2:]
+	since := time.Now().UTC().Add(-defaultSince)
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "--since":
+		var err error
+		since, err = parseSince(args[1], time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New(usage)
+	}
+	user, err := futil.GetUser(session)
+	if err != nil {
+		return err
+	}
+
+	entries, err := dbpool.FindAuditLog(user.ID, since, audit.MaxEntries)
+	if err != nil {
+		return err
+	}
+	_, err = session.Write([]byte(formatAudit(entries, since) + "\r\n"))
+	return err
+}
+
+// Middleware handles `command audit [--since]`, the changes made to the
+// user's account newest first.
+func Middleware(dbpool db.DB) wish.Middleware {
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "audit") {
+				sshHandler(session)
+				return
+			}
+
+			start := time.Now()
+			err := report(session, dbpool)
+			metrics.ObserveCommand("audit", start, err)
+			if err != nil {
+				utils.ErrorHandler(session, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+func TestFormatAudit(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	first := since.Add(2 * time.Hour)
+	second := since.Add(3 * time.Hour)
+	entries := []*db.AuditEntry{
+		{Actor: "bob", Space: "pgs", Action: "delete", Path: "/blog/old.html", SessionID: "0123456789abcdef", RemoteAddr: "203.0.113.7", CreatedAt: &second},
+		{Actor: "alice", Space: "pgs", Action: "project.create", Path: "blog", SessionID: "fedcba98", CreatedAt: &first},
+	}
+
+	expected := "since 2024-03-01 00:00:00\r\n" +
+		"TIME                 ACTOR  SPACE  ACTION          PATH            SESSION   SOURCE\r\n" +
+		"2024-03-01 03:00:00  bob    pgs    delete          /blog/old.html  01234567  203.0.113.7\r\n" +
+		"2024-03-01 02:00:00  alice  pgs    project.create  blog            fedcba98"
+	if diff := cmp.Diff(expected, formatAudit(entries, since)); diff != "" {
+		t.Error(diff)
+	}
+
+	expected = "since 2024-03-01 00:00:00\r\nno changes found"
+	if diff := cmp.Diff(expected, formatAudit(nil, since)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	fixtures := map[string]time.Time{
+		"24h":        now.Add(-24 * time.Hour),
+		"30m":        now.Add(-30 * time.Minute),
+		"3d":         now.AddDate(0, 0, -3),
+		"2024-03-01": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for value, expected := range fixtures {
+		since, err := parseSince(value, now)
+		if err != nil {
+			t.Fatalf("%s: %s", value, err)
+		}
+		if !since.Equal(expected) {
+			t.Errorf("%s: expected (%s), got (%s)", value, expected, since)
+		}
+	}
+
+	for _, bad := range []string{"", "-1h", "0d", "yesterday"} {
+		_, err := parseSince(bad, now)
+		if err == nil {
+			t.Errorf("expected (%s) to be rejected", bad)
+		}
+	}
+}
@@ -14,7 +14,7 @@ import (
 	"github.com/muesli/reflow/wordwrap"
 	"github.com/muesli/reflow/wrap"
 	"github.com/picosh/pico/db"
-	"github.com/picosh/pico/db/postgres"
+	"github.com/picosh/pico/db/backend"
 	"github.com/picosh/pico/shared"
 	"github.com/picosh/pico/shared/storage"
 	"github.com/picosh/pico/wish/cms/config"
@@ -94,14 +94,10 @@ func Middleware(cfg *config.ConfigCms, urls config.ConfigURL) bm.Handler {
 
 		sshUser := s.User()
 
-		dbpool := postgres.NewDB(cfg.DbURL, cfg.Logger)
+		dbpool := backend.NewDB(cfg.DbURL, cfg.Logger)
 
 		var st storage.StorageServe
-		if cfg.MinioURL == "" {
-			st, err = storage.NewStorageFS(cfg.StorageDir)
-		} else {
-			st, err = storage.NewStorageMinio(cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
-		}
+		st, err = storage.NewStorage(cfg.StorageBackend, cfg.StorageDir, cfg.MinioURL, cfg.MinioUser, cfg.MinioPass)
 
 		if err != nil {
 			logger.Error(err.Error())
@@ -8,24 +8,26 @@ type ConfigURL interface {
 }
 
 type ConfigCms struct {
-	Domain        string
-	Port          string
-	Email         string
-	Protocol      string
-	DbURL         string
-	StorageDir    string
-	MinioURL      string
-	MinioUser     string
-	MinioPass     string
-	Description   string
-	IntroText     string
-	Space         string
-	AllowedExt    []string
-	HiddenPosts   []string
-	Logger        *slog.Logger
-	AllowRegister bool
-	MaxSize       uint64
-	MaxAssetSize  int64
+	Domain     string
+	Port       string
+	Email      string
+	Protocol   string
+	DbURL      string
+	StorageDir string
+	// StorageBackend is fs or minio, empty picks minio when MinioURL is set
+	StorageBackend string
+	MinioURL       string
+	MinioUser      string
+	MinioPass      string
+	Description    string
+	IntroText      string
+	Space          string
+	AllowedExt     []string
+	HiddenPosts    []string
+	Logger         *slog.Logger
+	AllowRegister  bool
+	MaxSize        uint64
+	MaxAssetSize   int64
 }
 
 func NewConfigCms() *ConfigCms {
@@ -0,0 +1,113 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/send/send/utils"
+)
+
+var usage = "usage: email ls | email add {address} | email rm {address}"
+
+// PostAddress is where the emails that become posts of name are sent.
+func PostAddress(cfg *shared.ConfigSite, name string) string {
+	domain, _, _ := strings.Cut(cfg.Domain, ":")
+	return fmt.Sprintf("%s@%s", name, domain)
+}
+
+func formatSenders(senders []*db.PostEmailSender, address string) string {
+	if len(senders) == 0 {
+		return "no senders, add one with `email add {address}`"
+	}
+	lines := []string{fmt.Sprintf("emails to %s from these senders become posts:", address)}
+	for _, sender := range senders {
+		lines = append(lines, sender.Email)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// parseSender accepts a bare address, stored lower-cased since that is how
+// the gateway compares it.
+func parseSender(text string) (string, error) {
+	addr, err := mail.ParseAddress(text)
+	if err != nil || addr.Name != "" || addr.Address != text {
+		return "", fmt.Errorf("(%s) is not an email address", text)
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+func run(session ssh.Session, dbpool db.DB, cfg *shared.ConfigSite) error {
+	args := session.Command()[2:]
+	user, err := futil.GetUser(session)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	switch {
+	case len(args) == 1 && args[0] == "ls":
+		senders, err := dbpool.FindPostEmailSenders(user.ID)
+		if err != nil {
+			return err
+		}
+		out = formatSenders(senders, PostAddress(cfg, user.Name))
+	case len(args) == 2 && args[0] == "add":
+		if user.IsReadOnly() {
+			return db.ErrUserReadOnly
+		}
+		sender, err := parseSender(args[1])
+		if err != nil {
+			return err
+		}
+		err = dbpool.AddPostEmailSender(user.ID, sender)
+		if err != nil {
+			return err
+		}
+		out = fmt.Sprintf("emails from (%s) to %s become posts", sender, PostAddress(cfg, user.Name))
+	case len(args) == 2 && args[0] == "rm":
+		sender, err := parseSender(args[1])
+		if err != nil {
+			return err
+		}
+		err = dbpool.RemovePostEmailSender(user.ID, sender)
+		if err != nil {
+			return err
+		}
+		out = fmt.Sprintf("emails from (%s) are no longer posted", sender)
+	default:
+		return errors.New(usage)
+	}
+
+	_, err = session.Write([]byte(out + "\r\n"))
+	return err
+}
+
+// Middleware handles `command email`, the addresses whose emails to the
+// user's post address are published for them.
+func Middleware(dbpool db.DB, cfg *shared.ConfigSite) wish.Middleware {
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "email") {
+				sshHandler(session)
+				return
+			}
+
+			start := time.Now()
+			err := run(session, dbpool, cfg)
+			metrics.ObserveCommand("email", start, err)
+			if err != nil {
+				utils.ErrorHandler(session, err)
+			}
+		}
+	}
+}
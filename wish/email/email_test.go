@@ -0,0 +1,49 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/picosh/pico/db"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/wish/cms/config"
+)
+
+func TestParseSender(t *testing.T) {
+	fixtures := map[string]string{
+		"me@example.com": "me@example.com",
+		"Me@Example.COM": "me@example.com",
+	}
+	for text, expected := range fixtures {
+		sender, err := parseSender(text)
+		if err != nil {
+			t.Fatalf("%s: %s", text, err)
+		}
+		if sender != expected {
+			t.Errorf("%s: expected (%s), got (%s)", text, expected, sender)
+		}
+	}
+
+	for _, bad := range []string{"", "me", "Me <me@example.com>", "me@example.com, you@example.com"} {
+		_, err := parseSender(bad)
+		if err == nil {
+			t.Errorf("expected (%s) to be rejected", bad)
+		}
+	}
+}
+
+func TestFormatSenders(t *testing.T) {
+	cfg := &shared.ConfigSite{ConfigCms: config.ConfigCms{Domain: "prose.sh:3000"}}
+	address := PostAddress(cfg, "erock")
+	if address != "erock@prose.sh" {
+		t.Fatalf("expected the port to be dropped, got (%s)", address)
+	}
+
+	senders := []*db.PostEmailSender{{Email: "alt@example.com"}, {Email: "me@example.com"}}
+	expected := "emails to erock@prose.sh from these senders become posts:\r\nalt@example.com\r\nme@example.com"
+	if out := formatSenders(senders, address); out != expected {
+		t.Errorf("expected (%s), got (%s)", expected, out)
+	}
+	if out := formatSenders(nil, address); out != "no senders, add one with `email add {address}`" {
+		t.Errorf("unexpected empty listing (%s)", out)
+	}
+}
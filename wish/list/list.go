@@ -0,0 +1,493 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/pico/shared/storage"
+	"github.com/picosh/send/send/utils"
+)
+
+var defaultMaxDepth = 10
+
+var usage = "usage: ls [-RlhtSr] [--time] [--size] [--dirs-first] [--json] [--all] [--urls] [--expiring] [path] [pattern]"
+
+type sortKey int
+
+const (
+	sortByName sortKey = iota
+	sortByTime
+	sortBySize
+)
+
+type listOpts struct {
+	recursive bool
+	long      bool
+	human     bool
+	json      bool
+	// sortBy is whichever of `-t` or `-S` came last, like ls
+	sortBy  sortKey
+	reverse bool
+	// dirsFirst keeps directories, and so projects at the root, above
+	// files whatever the sort order
+	dirsFirst bool
+	// all includes previous versions and precompressed sidecars of files
+	all bool
+	// dir is where the listing starts, a project or a directory inside one
+	dir string
+	// pattern is matched against the base name of each file
+	pattern string
+	// urls prints the public url of each file instead of its name, long
+	// listings get it as an extra column instead
+	urls bool
+	// expiring only lists files that are deleted on their own, like
+	// pastes, soonest first with the time they go
+	expiring bool
+	// assetURL builds the public url for a file inside a project, it is
+	// set by the middleware once the user is known
+	assetURL func(projectName, fpath string) string
+}
+
+func parseArgs(args []string) (*listOpts, error) {
+	opts := &listOpts{dir: "/"}
+	hasPath := false
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if opts.pattern != "" {
+				return nil, fmt.Errorf("unknown argument (%s), %s", arg, usage)
+			}
+			dir, pattern := splitPattern(arg)
+			if dir != "" {
+				if hasPath {
+					return nil, fmt.Errorf("unknown argument (%s), %s", arg, usage)
+				}
+				hasPath = true
+				opts.dir = path.Join(opts.dir, dir)
+			}
+			if pattern == "" {
+				continue
+			}
+			_, err := filepath.Match(pattern, "")
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern (%s): %w", arg, err)
+			}
+			opts.pattern = pattern
+			continue
+		}
+
+		if arg == "--json" {
+			opts.json = true
+			continue
+		}
+
+		if arg == "--all" {
+			opts.all = true
+			continue
+		}
+
+		if arg == "--expiring" {
+			opts.expiring = true
+			continue
+		}
+
+		if arg == "--urls" {
+			opts.urls = true
+			continue
+		}
+
+		if arg == "--time" {
+			opts.sortBy = sortByTime
+			continue
+		}
+
+		if arg == "--size" {
+			opts.sortBy = sortBySize
+			continue
+		}
+
+		if arg == "--dirs-first" {
+			opts.dirsFirst = true
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			return nil, fmt.Errorf("unknown flag (%s), %s", arg, usage)
+		}
+
+		for _, flag := range strings.TrimPrefix(arg, "-") {
+			switch flag {
+			case 'R':
+				opts.recursive = true
+			case 'l':
+				opts.long = true
+			case 'h':
+				opts.human = true
+			case 't':
+				opts.sortBy = sortByTime
+			case 'S':
+				opts.sortBy = sortBySize
+			case 'r':
+				opts.reverse = true
+			default:
+				return nil, fmt.Errorf("unknown flag (-%c), %s", flag, usage)
+			}
+		}
+	}
+	return opts, nil
+}
+
+// splitPattern tells a path from a pattern: anything with a glob in its
+// last element is a pattern, whatever comes before is the path it applies
+// to, so `ls blog/*.css` lists the css files of the blog project.
+func splitPattern(arg string) (dir string, pattern string) {
+	base := path.Base(arg)
+	if !strings.ContainsAny(base, "*?[") {
+		return path.Clean("/" + arg), ""
+	}
+	dir = path.Dir(arg)
+	if dir == "." {
+		dir = ""
+	}
+	return dir, base
+}
+
+type dirListing struct {
+	dir   string
+	files []os.FileInfo
+}
+
+func fileName(file os.FileInfo) string {
+	return strings.Trim(file.Name(), "/")
+}
+
+// walk lists dir and, when recursive, every directory below it up to
+// maxDepth levels deep.
+func walk(session ssh.Session, handler utils.CopyFromClientHandler, dir string, depth int, maxDepth int, recursive bool) ([]dirListing, error) {
+	fileList, err := handler.List(session, dir, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []os.FileInfo{}
+	for _, file := range fileList {
+		if fileName(file) == "" {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return fileName(files[i]) < fileName(files[j])
+	})
+
+	listings := []dirListing{{dir: dir, files: files}}
+	if !recursive || depth >= maxDepth {
+		return listings, nil
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		sub, err := walk(session, handler, path.Join(dir, fileName(file)), depth+1, maxDepth, recursive)
+		if err != nil {
+			return nil, err
+		}
+		listings = append(listings, sub...)
+	}
+	return listings, nil
+}
+
+// expiringFile is a listed file that is deleted on its own, like a paste.
+type expiringFile interface {
+	ExpiresAt() *time.Time
+}
+
+// expiresAt is when file is deleted, nil when it is kept.
+func expiresAt(file os.FileInfo) *time.Time {
+	ef, ok := file.(expiringFile)
+	if !ok {
+		return nil
+	}
+	at := ef.ExpiresAt()
+	if at == nil || at.IsZero() {
+		return nil
+	}
+	return at
+}
+
+func formatName(file os.FileInfo) string {
+	name := fileName(file)
+	if file.IsDir() {
+		name += "/"
+	}
+	return name
+}
+
+// fileURL returns the public url of a file listed in dir, directories and
+// files outside of a project have none.
+func fileURL(dir string, file os.FileInfo, opts *listOpts) string {
+	if file.IsDir() || opts.assetURL == nil {
+		return ""
+	}
+	full := path.Join(strings.TrimPrefix(dir, "/"), fileName(file))
+	projectName, fpath, found := strings.Cut(full, "/")
+	if !found {
+		return ""
+	}
+	return opts.assetURL(projectName, fpath)
+}
+
+// displayName is what a listing line ends with, the url of the file when
+// asked for and it has one.
+func displayName(dir string, file os.FileInfo, opts *listOpts) string {
+	if opts.urls {
+		url := fileURL(dir, file, opts)
+		if url != "" {
+			return url
+		}
+	}
+	return formatName(file)
+}
+
+func filterFiles(files []os.FileInfo, opts *listOpts) []os.FileInfo {
+	names := map[string]bool{}
+	for _, file := range files {
+		names[path.Base(fileName(file))] = true
+	}
+
+	filtered := []os.FileInfo{}
+	for _, file := range files {
+		name := path.Base(fileName(file))
+		if !opts.all && !file.IsDir() && storage.IsVersion(name) {
+			continue
+		}
+		// precompressed sidecars are hidden next to the file they belong to
+		if base, ok := storage.SidecarBase(name); ok && !opts.all && !file.IsDir() && names[base] {
+			continue
+		}
+		if opts.expiring && expiresAt(file) == nil {
+			continue
+		}
+		if opts.pattern != "" {
+			matched, _ := filepath.Match(opts.pattern, name)
+			if !matched {
+				continue
+			}
+		}
+		filtered = append(filtered, file)
+	}
+	return filtered
+}
+
+// sortFiles orders files newest or largest first when asked to, name
+// breaks ties, and `-r` reverses whichever order is active. With
+// `--dirs-first` directories stay on top even when reversed.
+func sortFiles(files []os.FileInfo, opts *listOpts) []os.FileInfo {
+	sorted := append([]os.FileInfo{}, files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if opts.dirsFirst && a.IsDir() != b.IsDir() {
+			return a.IsDir() != opts.reverse
+		}
+		if opts.expiring {
+			if at, bt := expiresAt(a), expiresAt(b); !at.Equal(*bt) {
+				return at.Before(*bt)
+			}
+		}
+		switch opts.sortBy {
+		case sortByTime:
+			if !a.ModTime().Equal(b.ModTime()) {
+				return a.ModTime().After(b.ModTime())
+			}
+		case sortBySize:
+			if a.Size() != b.Size() {
+				return a.Size() > b.Size()
+			}
+		}
+		return fileName(a) < fileName(b)
+	})
+
+	if opts.reverse {
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+	return sorted
+}
+
+// expiresPrefix starts the lines of `--expiring` listings with when the
+// file is deleted.
+func expiresPrefix(file os.FileInfo, opts *listOpts) string {
+	at := expiresAt(file)
+	if !opts.expiring || at == nil {
+		return ""
+	}
+	return at.Format("2006-01-02 15:04") + " "
+}
+
+func formatFiles(dir string, files []os.FileInfo, opts *listOpts) []string {
+	data := []string{}
+	files = sortFiles(filterFiles(files, opts), opts)
+	if !opts.long {
+		for _, file := range files {
+			data = append(data, expiresPrefix(file, opts)+displayName(dir, file, opts))
+		}
+		return data
+	}
+
+	sizes := []string{}
+	width := 0
+	for _, file := range files {
+		size := "-"
+		if !file.IsDir() {
+			if opts.human {
+				size = shared.HumanSize(file.Size())
+			} else {
+				size = fmt.Sprintf("%d", file.Size())
+			}
+		}
+		if len(size) > width {
+			width = len(size)
+		}
+		sizes = append(sizes, size)
+	}
+
+	for i, file := range files {
+		modTime := "-"
+		if !file.ModTime().IsZero() {
+			modTime = file.ModTime().Format("2006-01-02 15:04")
+		}
+		line := fmt.Sprintf("%s%*s %-16s %s", expiresPrefix(file, opts), width, sizes[i], modTime, formatName(file))
+		if url := fileURL(dir, file, opts); opts.urls && url != "" {
+			line += " " + url
+		}
+		data = append(data, line)
+	}
+	return data
+}
+
+func formatListings(listings []dirListing, opts *listOpts) string {
+	if !opts.recursive {
+		return strings.Join(formatFiles(listings[0].dir, listings[0].files, opts), "\r\n")
+	}
+
+	groups := []string{}
+	for _, listing := range listings {
+		dir := strings.TrimPrefix(listing.dir, "/")
+		if dir == "" {
+			dir = "."
+		}
+		lines := append([]string{dir + ":"}, formatFiles(listing.dir, listing.files, opts)...)
+		groups = append(groups, strings.Join(lines, "\r\n"))
+	}
+	return strings.Join(groups, "\r\n\r\n")
+}
+
+type jsonFile struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"modTime"`
+	IsDir   bool   `json:"isDir"`
+	URL     string `json:"url,omitempty"`
+	// ExpiresAt is set for files that are deleted on their own
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// formatJSON flattens all listings into a single array, names are
+// relative to the root so recursive listings stay unambiguous.
+func formatJSON(listings []dirListing, opts *listOpts) (string, error) {
+	files := []jsonFile{}
+	for _, listing := range listings {
+		dir := strings.TrimPrefix(listing.dir, "/")
+		for _, file := range sortFiles(filterFiles(listing.files, opts), opts) {
+			jf := jsonFile{
+				Name:    path.Join(dir, fileName(file)),
+				Size:    file.Size(),
+				ModTime: file.ModTime().UTC().Format(time.RFC3339),
+				IsDir:   file.IsDir(),
+			}
+			if opts.urls {
+				jf.URL = fileURL(listing.dir, file, opts)
+			}
+			if at := expiresAt(file); at != nil {
+				jf.ExpiresAt = at.UTC().Format(time.RFC3339)
+			}
+			files = append(files, jf)
+		}
+	}
+
+	out, err := json.Marshal(files)
+	return string(out), err
+}
+
+// list runs `command ls`, it writes the listings itself and returns any
+// error for the caller to report.
+func list(session ssh.Session, writeHandler utils.CopyFromClientHandler, cfg *shared.ConfigSite, maxDepth int) error {
+	opts, err := parseArgs(session.Command()[2:])
+	if err != nil {
+		return err
+	}
+
+	if opts.urls {
+		user, err := futil.GetUser(session)
+		if err != nil {
+			return err
+		}
+		opts.assetURL = func(projectName, fpath string) string {
+			return cfg.AssetURL(user.Name, projectName, fpath)
+		}
+	}
+
+	listings, err := walk(session, writeHandler, opts.dir, 0, maxDepth, opts.recursive)
+	if err != nil {
+		return err
+	}
+
+	out := ""
+	if opts.json {
+		out, err = formatJSON(listings, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		out = formatListings(listings, opts)
+	}
+
+	_, err = session.Write([]byte(out))
+	return err
+}
+
+func Middleware(writeHandler utils.CopyFromClientHandler, cfg *shared.ConfigSite) wish.Middleware {
+	maxDepth := cfg.ListMaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDepth
+	}
+
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "ls") {
+				sshHandler(session)
+				return
+			}
+
+			start := time.Now()
+			err := list(session, writeHandler, cfg, maxDepth)
+			metrics.ObserveCommand("ls", start, err)
+			if err != nil {
+				utils.ErrorHandler(session, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package list
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/send/send/utils"
+)
+
+func TestFormatListings(t *testing.T) {
+	listings := []dirListing{
+		{
+			dir: "/",
+			files: []os.FileInfo{
+				&utils.VirtualFile{FName: "proj", FIsDir: true},
+				&utils.VirtualFile{FName: "readme.md"},
+			},
+		},
+		{
+			dir: "/proj",
+			files: []os.FileInfo{
+				&utils.VirtualFile{FName: "index.html"},
+				&utils.VirtualFile{FName: "index.html.v1"},
+			},
+		},
+	}
+
+	flat := formatListings(listings, &listOpts{})
+	if diff := cmp.Diff("proj/\r\nreadme.md", flat); diff != "" {
+		t.Error(diff)
+	}
+
+	filtered := formatListings(listings, &listOpts{pattern: "*.md"})
+	if diff := cmp.Diff("readme.md", filtered); diff != "" {
+		t.Error(diff)
+	}
+
+	recursive := formatListings(listings, &listOpts{recursive: true})
+	expected := ".:\r\nproj/\r\nreadme.md\r\n\r\nproj:\r\nindex.html"
+	if diff := cmp.Diff(expected, recursive); diff != "" {
+		t.Error(diff)
+	}
+
+	all := formatListings(listings, &listOpts{recursive: true, all: true})
+	expected = ".:\r\nproj/\r\nreadme.md\r\n\r\nproj:\r\nindex.html\r\nindex.html.v1"
+	if diff := cmp.Diff(expected, all); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	listings := []dirListing{
+		{
+			dir: "/",
+			files: []os.FileInfo{
+				&utils.VirtualFile{FName: "proj", FIsDir: true, FModTime: modTime},
+			},
+		},
+		{
+			dir: "/proj",
+			files: []os.FileInfo{
+				&utils.VirtualFile{FName: "index.html", FSize: 12, FModTime: modTime},
+			},
+		},
+	}
+
+	out, err := formatJSON(listings, &listOpts{json: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"name":"proj","size":0,"modTime":"2024-03-01T12:30:00Z","isDir":true},` +
+		`{"name":"proj/index.html","size":12,"modTime":"2024-03-01T12:30:00Z","isDir":false}]`
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFormatLong(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	files := []os.FileInfo{
+		&utils.VirtualFile{FName: "css", FIsDir: true, FModTime: modTime},
+		&utils.VirtualFile{FName: "index.html", FSize: 1250, FModTime: modTime},
+		&utils.VirtualFile{FName: "video.mp4", FSize: 3565158, FModTime: modTime},
+	}
+
+	expected := []string{
+		"      - 2024-03-01 12:30 css/",
+		"   1250 2024-03-01 12:30 index.html",
+		"3565158 2024-03-01 12:30 video.mp4",
+	}
+	if diff := cmp.Diff(expected, formatFiles("/", files, &listOpts{long: true})); diff != "" {
+		t.Error(diff)
+	}
+
+	expected = []string{
+		"   - 2024-03-01 12:30 css/",
+		"1.2K 2024-03-01 12:30 index.html",
+		"3.4M 2024-03-01 12:30 video.mp4",
+	}
+	if diff := cmp.Diff(expected, formatFiles("/", files, &listOpts{long: true, human: true})); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-R"})
+	if err != nil || !opts.recursive {
+		t.Fatalf("expected recursive, got %v (%v)", opts, err)
+	}
+
+	opts, err = parseArgs([]string{"-lh"})
+	if err != nil || !opts.long || !opts.human {
+		t.Fatalf("expected long and human, got %v (%v)", opts, err)
+	}
+
+	opts, err = parseArgs([]string{"-l", "*.css"})
+	if err != nil || opts.pattern != "*.css" {
+		t.Fatalf("expected pattern, got %v (%v)", opts, err)
+	}
+
+	_, err = parseArgs([]string{"[a-"})
+	if err == nil {
+		t.Fatal("expected invalid pattern error")
+	}
+
+	_, err = parseArgs([]string{"-x"})
+	if err == nil {
+		t.Fatal("expected unknown flag error")
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		args    []string
+		dir     string
+		pattern string
+	}{
+		{name: "root", args: []string{}, dir: "/"},
+		{name: "project", args: []string{"blog"}, dir: "/blog"},
+		{name: "nested", args: []string{"-R", "blog/css/"}, dir: "/blog/css"},
+		{name: "pattern", args: []string{"*.css"}, dir: "/", pattern: "*.css"},
+		{name: "project-pattern", args: []string{"blog/*.css"}, dir: "/blog", pattern: "*.css"},
+		{name: "path-then-pattern", args: []string{"blog", "*.css"}, dir: "/blog", pattern: "*.css"},
+		{name: "escape", args: []string{"../../etc"}, dir: "/etc"},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			opts, err := parseArgs(fixture.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.dir != fixture.dir || opts.pattern != fixture.pattern {
+				t.Errorf("expected (%s, %s), got (%s, %s)", fixture.dir, fixture.pattern, opts.dir, opts.pattern)
+			}
+		})
+	}
+
+	_, err := parseArgs([]string{"blog", "docs"})
+	if err == nil {
+		t.Fatal("expected error for two paths")
+	}
+}
+
+func TestSortFiles(t *testing.T) {
+	older := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	files := []os.FileInfo{
+		&utils.VirtualFile{FName: "b.html", FSize: 10, FModTime: older},
+		&utils.VirtualFile{FName: "a.html", FSize: 30, FModTime: older},
+		&utils.VirtualFile{FName: "c.html", FSize: 20, FModTime: newer},
+	}
+
+	fixtures := []struct {
+		name   string
+		args   []string
+		expect []string
+	}{
+		{name: "name", args: []string{}, expect: []string{"a.html", "b.html", "c.html"}},
+		{name: "reverse", args: []string{"-r"}, expect: []string{"c.html", "b.html", "a.html"}},
+		{name: "time", args: []string{"-t"}, expect: []string{"c.html", "a.html", "b.html"}},
+		{name: "time-reverse", args: []string{"-tr"}, expect: []string{"b.html", "a.html", "c.html"}},
+		{name: "size", args: []string{"-S"}, expect: []string{"a.html", "c.html", "b.html"}},
+		{name: "size-reverse", args: []string{"-S", "-r"}, expect: []string{"b.html", "c.html", "a.html"}},
+		{name: "last-wins", args: []string{"-tS"}, expect: []string{"a.html", "c.html", "b.html"}},
+		{name: "long-size", args: []string{"--size"}, expect: []string{"a.html", "c.html", "b.html"}},
+		{name: "long-time", args: []string{"-S", "--time"}, expect: []string{"c.html", "a.html", "b.html"}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			opts, err := parseArgs(fixture.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(fixture.expect, formatFiles("/", files, opts)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSortDirsFirst(t *testing.T) {
+	files := []os.FileInfo{
+		&utils.VirtualFile{FName: "a.html", FSize: 30},
+		&utils.VirtualFile{FName: "zoo", FIsDir: true},
+		&utils.VirtualFile{FName: "blog", FIsDir: true},
+	}
+
+	fixtures := []struct {
+		name   string
+		args   []string
+		expect []string
+	}{
+		{name: "default", args: []string{}, expect: []string{"a.html", "blog/", "zoo/"}},
+		{name: "dirs-first", args: []string{"--dirs-first"}, expect: []string{"blog/", "zoo/", "a.html"}},
+		{name: "dirs-first-reverse", args: []string{"--dirs-first", "-r"}, expect: []string{"zoo/", "blog/", "a.html"}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			opts, err := parseArgs(fixture.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(fixture.expect, formatFiles("/", files, opts)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFormatLongURLs(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	files := []os.FileInfo{
+		&utils.VirtualFile{FName: "css", FIsDir: true, FModTime: modTime},
+		&utils.VirtualFile{FName: "index.html", FSize: 1250, FModTime: modTime},
+	}
+	opts := &listOpts{
+		long: true,
+		urls: true,
+		assetURL: func(projectName, fpath string) string {
+			return "https://test-" + projectName + ".pgs.sh/" + fpath
+		},
+	}
+
+	expected := []string{
+		"   - 2024-03-01 12:30 css/",
+		"1250 2024-03-01 12:30 index.html https://test-proj.pgs.sh/index.html",
+	}
+	if diff := cmp.Diff(expected, formatFiles("/proj", files, opts)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFormatURLs(t *testing.T) {
+	listings := []dirListing{
+		{
+			dir: "/",
+			files: []os.FileInfo{
+				&utils.VirtualFile{FName: "proj", FIsDir: true},
+				&utils.VirtualFile{FName: "readme.md"},
+			},
+		},
+		{
+			dir: "/proj",
+			files: []os.FileInfo{
+				&utils.VirtualFile{FName: "css", FIsDir: true},
+				&utils.VirtualFile{FName: "index.html"},
+			},
+		},
+	}
+	opts := &listOpts{
+		recursive: true,
+		urls:      true,
+		assetURL: func(projectName, fpath string) string {
+			return "https://test-" + projectName + ".pgs.sh/" + fpath
+		},
+	}
+
+	expected := ".:\r\nproj/\r\nreadme.md\r\n\r\nproj:\r\ncss/\r\nhttps://test-proj.pgs.sh/index.html"
+	if diff := cmp.Diff(expected, formatListings(listings, opts)); diff != "" {
+		t.Error(diff)
+	}
+
+	out, err := formatJSON(listings[1:], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"url":"https://test-proj.pgs.sh/index.html"`) || strings.Count(out, `"url"`) != 1 {
+		t.Fatalf("expected only the file to have a url, got %s", out)
+	}
+}
+
+type expiringTestFile struct {
+	*utils.VirtualFile
+	expiresAt *time.Time
+}
+
+func (f *expiringTestFile) ExpiresAt() *time.Time { return f.expiresAt }
+
+func TestFormatExpiring(t *testing.T) {
+	soon := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	later := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	listings := []dirListing{
+		{
+			dir: "/",
+			files: []os.FileInfo{
+				&expiringTestFile{VirtualFile: &utils.VirtualFile{FName: "a.txt"}, expiresAt: &later},
+				&expiringTestFile{VirtualFile: &utils.VirtualFile{FName: "b.txt"}},
+				&expiringTestFile{VirtualFile: &utils.VirtualFile{FName: "c.txt"}, expiresAt: &soon},
+			},
+		},
+	}
+
+	opts, err := parseArgs([]string{"--expiring"})
+	if err != nil || !opts.expiring {
+		t.Fatalf("expected expiring, got %v (%v)", opts, err)
+	}
+
+	out := formatListings(listings, opts)
+	expected := "2024-03-02 09:00 c.txt\r\n2024-04-01 09:00 a.txt"
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Error(diff)
+	}
+
+	out, err = formatJSON(listings, &listOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"isDir":false,"expiresAt":"2024-03-02T09:00:00Z"}`) || strings.Count(out, "expiresAt") != 2 {
+		t.Errorf("expected the expiry in the json listing, got %s", out)
+	}
+}
@@ -6,14 +6,20 @@ import (
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared"
 )
 
+// LogMiddleware gives every session its own logger tagged with a session id,
+// handlers further down pick it up with shared.SessionLogger.
 func LogMiddleware(logger *slog.Logger) wish.Middleware {
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
 			ct := time.Now()
 			pty, _, ok := s.Pty()
 
+			logger := logger.With("session", shared.NewSessionID())
+			shared.SetSessionLogger(s.Context(), logger)
+
 			logger.Info(
 				"connect",
 				"user",
@@ -32,6 +38,7 @@ func LogMiddleware(logger *slog.Logger) wish.Middleware {
 
 			sh(s)
 
+			logger = shared.SessionLogger(s.Context(), logger)
 			logger.Info(
 				"disconnect",
 				"ip",
@@ -0,0 +1,72 @@
+package rm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/send/send/utils"
+)
+
+var usage = "usage: rm <path>..."
+
+// DeleteHandler is a copy handler that can also remove files, the handler
+// is responsible for any quota accounting.
+type DeleteHandler interface {
+	utils.CopyFromClientHandler
+	Delete(ssh.Session, *utils.FileEntry) error
+}
+
+// remove deletes every path and reports one line per file, it keeps going
+// after a failure so a single bad path doesn't stop the rest.
+func remove(session ssh.Session, handler DeleteHandler, paths []string) ([]string, []error) {
+	out := []string{}
+	errs := []error{}
+	for _, fpath := range paths {
+		fpath = "/" + strings.Trim(fpath, "/")
+		if !strings.Contains(strings.TrimPrefix(fpath, "/"), "/") {
+			errs = append(errs, fmt.Errorf("cannot remove (%s): is a directory", fpath))
+			continue
+		}
+
+		entry := &utils.FileEntry{Filepath: fpath}
+		err := handler.Delete(session, entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, fmt.Sprintf("deleted %s (%s)", entry.Filepath, shared.HumanSize(entry.Size)))
+	}
+	return out, errs
+}
+
+func Middleware(deleteHandler DeleteHandler) wish.Middleware {
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "rm") {
+				sshHandler(session)
+				return
+			}
+
+			paths := cmd[2:]
+			if len(paths) == 0 {
+				utils.ErrorHandler(session, fmt.Errorf("missing path, %s", usage))
+				return
+			}
+
+			start := time.Now()
+			out, errs := remove(session, deleteHandler, paths)
+			metrics.ObserveCommand("rm", start, errors.Join(errs...))
+			utils.PrintMsg(session, out, errs)
+			if len(errs) > 0 {
+				_ = session.Exit(1)
+			}
+		}
+	}
+}
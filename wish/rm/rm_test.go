@@ -0,0 +1,44 @@
+package rm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/send/send/utils"
+)
+
+type fakeHandler struct {
+	DeleteHandler
+	files map[string]int64
+}
+
+func (h *fakeHandler) Delete(s ssh.Session, entry *utils.FileEntry) error {
+	size, ok := h.files[entry.Filepath]
+	if !ok {
+		return fmt.Errorf("ERROR: file (%s) not found", entry.Filepath)
+	}
+	delete(h.files, entry.Filepath)
+	entry.Size = size
+	return nil
+}
+
+func TestRemove(t *testing.T) {
+	handler := &fakeHandler{files: map[string]int64{
+		"/proj/index.html": 1250,
+		"/proj/css/a.css":  10,
+	}}
+
+	out, errs := remove(nil, handler, []string{"proj/index.html", "/proj/missing.html", "proj", "proj/css/a.css/"})
+	expected := []string{"deleted /proj/index.html (1.2K)", "deleted /proj/css/a.css (10)"}
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Error(diff)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected missing file and directory to fail, got %v", errs)
+	}
+	if len(handler.files) != 0 {
+		t.Fatalf("expected all files to be deleted, found %v", handler.files)
+	}
+}
@@ -0,0 +1,85 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/db"
+	futil "github.com/picosh/pico/filehandlers/util"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/pico/shared/metrics"
+	"github.com/picosh/send/send/utils"
+)
+
+var usage = "usage: search <query>"
+
+// MaxResults is how many posts a search returns at most.
+var MaxResults = 25
+
+// Snippet collapses the whitespace of a search snippet onto a single line.
+func Snippet(snippet string) string {
+	return strings.Join(strings.Fields(snippet), " ")
+}
+
+func formatResults(results []*db.PostSearchResult, postURL func(*db.Post) string) string {
+	if len(results) == 0 {
+		return "no posts found\r\n"
+	}
+	out := ""
+	for _, result := range results {
+		date := ""
+		if result.PublishAt != nil {
+			date = result.PublishAt.Format(time.DateOnly)
+		}
+		out += fmt.Sprintf("%s  %s  %s\r\n", date, result.Title, postURL(result.Post))
+		if snippet := Snippet(result.Snippet); snippet != "" {
+			out += fmt.Sprintf("  %s\r\n", snippet)
+		}
+	}
+	return out
+}
+
+func search(session ssh.Session, dbpool db.DB, cfg *shared.ConfigSite) error {
+	query := strings.Join(session.Command()[2:], " ")
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf("missing query, %s", usage)
+	}
+	user, err := futil.GetUser(session)
+	if err != nil {
+		return err
+	}
+
+	results, err := dbpool.SearchPostsForUser(user.ID, cfg.Space, query, MaxResults)
+	if err != nil {
+		return err
+	}
+	curl := shared.NewCreateURL(cfg)
+	_, err = session.Write([]byte(formatResults(results, func(post *db.Post) string {
+		return cfg.FullPostURL(curl, user.Name, post.Slug)
+	})))
+	return err
+}
+
+// Middleware handles `command search <query>`, it searches the posts of the
+// user that is logged in.
+func Middleware(dbpool db.DB, cfg *shared.ConfigSite) wish.Middleware {
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "search") {
+				sshHandler(session)
+				return
+			}
+
+			start := time.Now()
+			err := search(session, dbpool, cfg)
+			metrics.ObserveCommand("search", start, err)
+			if err != nil {
+				utils.ErrorHandler(session, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/db"
+)
+
+func TestFormatResults(t *testing.T) {
+	publishAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	results := []*db.PostSearchResult{
+		{
+			Post:    &db.Post{Slug: "garden", Title: "Garden", PublishAt: &publishAt},
+			Snippet: "all about\nthe **garden**  and more",
+		},
+		{Post: &db.Post{Slug: "empty", Title: "Empty"}},
+	}
+	postURL := func(post *db.Post) string {
+		return "https://erock.prose.sh/" + post.Slug
+	}
+
+	expected := "2024-03-01  Garden  https://erock.prose.sh/garden\r\n" +
+		"  all about the **garden** and more\r\n" +
+		"  Empty  https://erock.prose.sh/empty\r\n"
+	if diff := cmp.Diff(expected, formatResults(results, postURL)); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff("no posts found\r\n", formatResults(nil, postURL)); diff != "" {
+		t.Error(diff)
+	}
+}
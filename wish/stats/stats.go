@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared"
+	"github.com/picosh/send/send/utils"
+)
+
+var usage = "usage: stats [project]"
+
+type ProjectStats struct {
+	Name      string
+	FileCount int
+	TotalSize int64
+	// LastUpload is the newest modification time of any file, zero when
+	// the project is empty
+	LastUpload time.Time
+}
+
+type Stats struct {
+	Projects []ProjectStats
+	// Used and Quota are for the whole bucket, not only the projects
+	// listed
+	Used  uint64
+	Quota uint64
+	// Served is what every project served this month, Egress is the
+	// monthly cap where 0 is unlimited
+	Served uint64
+	Egress uint64
+}
+
+// StatsHandler is a copy handler that can report storage usage, an empty
+// projectName means every project.
+type StatsHandler interface {
+	utils.CopyFromClientHandler
+	Stats(s ssh.Session, projectName string) (*Stats, error)
+}
+
+func formatStats(stats *Stats) string {
+	remaining := uint64(0)
+	if stats.Quota > stats.Used {
+		remaining = stats.Quota - stats.Used
+	}
+	lines := []string{fmt.Sprintf(
+		"used %s of %s, %s remaining",
+		shared.HumanSize(int64(stats.Used)),
+		shared.HumanSize(int64(stats.Quota)),
+		shared.HumanSize(int64(remaining)),
+	)}
+	if stats.Egress > 0 {
+		lines = append(lines, fmt.Sprintf(
+			"served %s of %s this month",
+			shared.HumanSize(int64(stats.Served)),
+			shared.HumanSize(int64(stats.Egress)),
+		))
+	} else if stats.Served > 0 {
+		lines = append(lines, fmt.Sprintf("served %s this month", shared.HumanSize(int64(stats.Served))))
+	}
+	if len(stats.Projects) == 0 {
+		return strings.Join(append(lines, "no projects found"), "\r\n")
+	}
+
+	rows := [][]string{{"PROJECT", "FILES", "SIZE", "LAST UPLOAD"}}
+	for _, project := range stats.Projects {
+		lastUpload := "-"
+		if !project.LastUpload.IsZero() {
+			lastUpload = project.LastUpload.UTC().Format("2006-01-02 15:04")
+		}
+		rows = append(rows, []string{
+			project.Name,
+			fmt.Sprintf("%d", project.FileCount),
+			shared.HumanSize(project.TotalSize),
+			lastUpload,
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, col := range row {
+			widths[i] = max(widths[i], len(col))
+		}
+	}
+	for _, row := range rows {
+		cols := []string{}
+		for i, col := range row {
+			cols = append(cols, fmt.Sprintf("%-*s", widths[i], col))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cols, "  "), " "))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+func Middleware(statsHandler StatsHandler) wish.Middleware {
+	return func(sshHandler ssh.Handler) ssh.Handler {
+		return func(session ssh.Session) {
+			cmd := session.Command()
+			if !(len(cmd) > 1 && cmd[0] == "command" && cmd[1] == "stats") {
+				sshHandler(session)
+				return
+			}
+
+			args := cmd[2:]
+			if len(args) > 1 {
+				utils.ErrorHandler(session, fmt.Errorf("too many arguments, %s", usage))
+				return
+			}
+			projectName := ""
+			if len(args) == 1 {
+				projectName = args[0]
+			}
+
+			stats, err := statsHandler.Stats(session, projectName)
+			if err != nil {
+				utils.ErrorHandler(session, err)
+				return
+			}
+
+			_, err = session.Write([]byte(formatStats(stats) + "\r\n"))
+			if err != nil {
+				utils.ErrorHandler(session, err)
+			}
+		}
+	}
+}
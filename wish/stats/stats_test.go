@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/picosh/pico/shared"
+)
+
+func TestFormatStats(t *testing.T) {
+	stats := &Stats{
+		Projects: []ProjectStats{
+			{
+				Name:       "blog",
+				FileCount:  12,
+				TotalSize:  1250,
+				LastUpload: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+			},
+			{Name: "empty"},
+		},
+		Used:  uint64(shared.MB),
+		Quota: uint64(shared.GB),
+	}
+
+	expected := "used 1.0M of 1.0G, 1023M remaining\r\n" +
+		"PROJECT  FILES  SIZE  LAST UPLOAD\r\n" +
+		"blog     12     1.2K  2024-03-01 12:30\r\n" +
+		"empty    0      0     -"
+	if diff := cmp.Diff(expected, formatStats(stats)); diff != "" {
+		t.Error(diff)
+	}
+
+	expected = "used 0 of 0, 0 remaining\r\nno projects found"
+	if diff := cmp.Diff(expected, formatStats(&Stats{})); diff != "" {
+		t.Error(diff)
+	}
+
+	expected = "used 0 of 0, 0 remaining\r\nserved 512M of 1.0G this month\r\nno projects found"
+	if diff := cmp.Diff(expected, formatStats(&Stats{Served: uint64(512 * shared.MB), Egress: uint64(shared.GB)})); diff != "" {
+		t.Error(diff)
+	}
+}
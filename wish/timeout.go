@@ -0,0 +1,160 @@
+package wish
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/picosh/pico/shared"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Timeouts end ssh sessions that stall, e.g. an scp or rsync client that
+// stopped sending, so they don't hold on to buckets and memory. A zero
+// Idle or Max disables it, KeepAlive is how often both are checked and
+// the client is asked whether it is still there.
+type Timeouts struct {
+	Idle      time.Duration
+	Max       time.Duration
+	KeepAlive time.Duration
+}
+
+// NewTimeouts reads the timeouts of cfg.
+func NewTimeouts(cfg *shared.ConfigSite) Timeouts {
+	return Timeouts{
+		Idle:      cfg.SessionIdleTimeout,
+		Max:       cfg.SessionMaxTimeout,
+		KeepAlive: cfg.SessionKeepAlive,
+	}
+}
+
+func (t Timeouts) enabled() bool {
+	return t.KeepAlive > 0 && (t.Idle > 0 || t.Max > 0)
+}
+
+// expired is why a session that started at start and last sent or
+// received data at last is over at now, empty while it is not.
+func (t Timeouts) expired(now, start, last time.Time) string {
+	if t.Max > 0 && now.Sub(start) >= t.Max {
+		return fmt.Sprintf("session exceeded the maximum duration of %s", t.Max)
+	}
+	if t.Idle > 0 && now.Sub(last) >= t.Idle {
+		return fmt.Sprintf("session was idle for %s", t.Idle)
+	}
+	return ""
+}
+
+// activitySession remembers when data last went through the session.
+type activitySession struct {
+	ssh.Session
+	last atomic.Int64
+}
+
+func (s *activitySession) touch() {
+	s.last.Store(time.Now().UnixNano())
+}
+
+func (s *activitySession) Read(p []byte) (int, error) {
+	n, err := s.Session.Read(p)
+	if n > 0 {
+		s.touch()
+	}
+	return n, err
+}
+
+func (s *activitySession) Write(p []byte) (int, error) {
+	n, err := s.Session.Write(p)
+	if n > 0 {
+		s.touch()
+	}
+	return n, err
+}
+
+// keepAlive asks the client whether it is still there, a client that
+// does not answer within wait is gone.
+func keepAlive(sesh ssh.Session, wait time.Duration) bool {
+	conn, ok := sesh.Context().Value(ssh.ContextKeyConn).(gossh.Conn)
+	if !ok {
+		return true
+	}
+	answered := make(chan error, 1)
+	go func() {
+		// clients answer requests they don't know with a failure, any
+		// answer will do
+		_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+		answered <- err
+	}()
+	select {
+	case err := <-answered:
+		return err == nil
+	case <-time.After(wait):
+		return false
+	}
+}
+
+// watch ends sesh once it expired or its client stopped answering.
+func (t Timeouts) watch(sesh *activitySession, start time.Time, logger *slog.Logger, done <-chan struct{}) {
+	ticker := time.NewTicker(t.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-sesh.Context().Done():
+			return
+		case now := <-ticker.C:
+			logger := shared.SessionLogger(sesh.Context(), logger)
+			reason := t.expired(now, start, time.Unix(0, sesh.last.Load()))
+			if reason == "" && !keepAlive(sesh, t.KeepAlive) {
+				logger.Info("closing session, client stopped answering keepalives")
+				_ = sesh.Close()
+				return
+			}
+			if reason == "" {
+				continue
+			}
+			logger.Info("closing session", "reason", reason)
+			_, _ = sesh.Stderr().Write([]byte(fmt.Sprintf("%s, closing connection\r\n", reason)))
+			_ = sesh.Exit(1)
+			_ = sesh.Close()
+			return
+		}
+	}
+}
+
+func (t Timeouts) handle(sh ssh.Handler, logger *slog.Logger) ssh.Handler {
+	if !t.enabled() {
+		return sh
+	}
+	return func(s ssh.Session) {
+		start := time.Now()
+		sesh := &activitySession{Session: s}
+		sesh.touch()
+		done := make(chan struct{})
+		defer close(done)
+		go t.watch(sesh, start, logger, done)
+		sh(sesh)
+	}
+}
+
+// Middleware enforces the timeouts on every session, it goes last so it
+// wraps the session every other middleware sees.
+func (t Timeouts) Middleware(logger *slog.Logger) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return t.handle(sh, logger)
+	}
+}
+
+// SubsystemOption enforces the timeouts on subsystems like sftp, which
+// don't go through middleware. It must come after the subsystems are set.
+func (t Timeouts) SubsystemOption(logger *slog.Logger) ssh.Option {
+	return func(server *ssh.Server) error {
+		for name, handler := range server.SubsystemHandlers {
+			server.SubsystemHandlers[name] = ssh.SubsystemHandler(t.handle(ssh.Handler(handler), logger))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package wish
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutsExpired(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	timeouts := Timeouts{Idle: 10 * time.Minute, Max: time.Hour, KeepAlive: 30 * time.Second}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		last   time.Time
+		reason string
+	}{
+		{name: "active", now: start.Add(30 * time.Minute), last: start.Add(25 * time.Minute)},
+		{
+			name:   "idle",
+			now:    start.Add(30 * time.Minute),
+			last:   start.Add(20 * time.Minute),
+			reason: "session was idle for 10m0s",
+		},
+		{
+			name:   "max",
+			now:    start.Add(time.Hour),
+			last:   start.Add(time.Hour),
+			reason: "session exceeded the maximum duration of 1h0m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timeouts.expired(tt.now, start, tt.last); got != tt.reason {
+				t.Errorf("expected (%s), got (%s)", tt.reason, got)
+			}
+		})
+	}
+
+	disabled := Timeouts{KeepAlive: 30 * time.Second}
+	if disabled.enabled() || disabled.expired(start.Add(24*time.Hour), start, start) != "" {
+		t.Error("expected zero timeouts to never expire")
+	}
+}